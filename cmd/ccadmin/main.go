@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/client"
+)
+
+/**
+ * Ccadmin administers a running server through its admin API, as one of the users listed in the server config's
+ * Admins. It logs in over the WebSocket endpoint like any other client, so it needs no access to the databases, and
+ * every command it runs is recorded in the audit log under the admin's name.
+ *
+ *   ccadmin [flags] user show <username>
+ *   ccadmin [flags] user delete -yes <username>
+ *   ccadmin [flags] user unlock <username>
+ *   ccadmin [flags] project show <projectID>
+ *   ccadmin [flags] quota report [-limit N] [-over]
+ *   ccadmin [flags] quota set <projectID> <bytes>
+ *   ccadmin [flags] scrunch <fileID>...
+ *   ccadmin [flags] check [-last]
+ *
+ * The admin's password is read from the CCADMIN_PASSWORD environment variable, rather than a flag, so that it isn't
+ * left in shell histories or process listings. Results are printed as tables, or as JSON with -json.
+ */
+
+var url = flag.String("url", "ws://localhost:8000/ws/", "WebSocket endpoint of the server to administer")
+var username = flag.String("user", "", "username of a server admin; defaults to $CCADMIN_USER")
+var timeout = flag.Duration("timeout", 5*time.Minute, "how long to wait for each response; integrity checks and scrunches can take a while")
+var printJSON = flag.Bool("json", false, "print results as JSON")
+
+// errUsage is returned by commands given the wrong arguments, after printing their usage
+var errUsage = errors.New("Invalid arguments")
+
+// command runs a subcommand with the arguments after its name
+type command func(c *client.Client, args []string) error
+
+var commands = map[string]map[string]command{
+	"user": {
+		"show":   userShow,
+		"delete": userDelete,
+		"unlock": userUnlock,
+	},
+	"project": {
+		"show": projectShow,
+	},
+	"quota": {
+		"report": quotaReport,
+		"set":    quotaSet,
+	},
+}
+
+// topLevelCommands are those without subcommands
+var topLevelCommands = map[string]command{
+	"scrunch": scrunch,
+	"check":   check,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: ccadmin [flags] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	fmt.Fprintln(os.Stderr, "  user show <username>             show a user's account, projects and storage usage")
+	fmt.Fprintln(os.Stderr, "  user delete -yes <username>      delete a user, and the projects they own")
+	fmt.Fprintln(os.Stderr, "  user unlock <username>           clear a user's failed logins on the server")
+	fmt.Fprintln(os.Stderr, "  project show <projectID>         show a project's permissions, files and storage usage")
+	fmt.Fprintln(os.Stderr, "  quota report [-limit N] [-over]  list the projects using the most storage")
+	fmt.Fprintln(os.Stderr, "  quota set <projectID> <bytes>    override a project's quota; 0 restores the default")
+	fmt.Fprintln(os.Stderr, "  scrunch <fileID>...              scrunch files' changes into their contents now")
+	fmt.Fprintln(os.Stderr, "  check [-last]                    check every file on disk, or show the last check's report")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	run, args := findCommand(flag.Args())
+	if run == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	c, err := connect()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect:", err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	if err := run(c, args); err == errUsage {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// findCommand returns the command named by the arguments, and the arguments that follow its name; nil if there is none
+func findCommand(args []string) (command, []string) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if run, ok := topLevelCommands[args[0]]; ok {
+		return run, args[1:]
+	}
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return commands[args[0]][args[1]], args[2:]
+}
+
+// connect dials the server, and logs in as the admin
+func connect() (*client.Client, error) {
+	user := *username
+	if user == "" {
+		user = os.Getenv("CCADMIN_USER")
+	}
+	password := os.Getenv("CCADMIN_PASSWORD")
+	if user == "" || password == "" {
+		return nil, errors.New("The admin's username and password must be given with -user or $CCADMIN_USER, and $CCADMIN_PASSWORD")
+	}
+
+	c, err := client.Dial(*url, client.Options{ResponseTimeout: *timeout, ReconnectInterval: -1})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.UserLogin(client.UserLoginRequest{Username: user, Password: password}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseFlags parses the command's flags, printing its usage if they, or the number of arguments after them, are wrong
+func parseFlags(flags *flag.FlagSet, args []string, argUsage string, numArgs int) error {
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ccadmin %s %s\n", flags.Name(), argUsage)
+		flags.PrintDefaults()
+	}
+	flags.SetOutput(os.Stderr)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if (numArgs >= 0 && flags.NArg() != numArgs) || (numArgs < 0 && flags.NArg() == 0) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// parseID parses the ID of a project or file
+func parseID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("Invalid ID: %q", arg)
+	}
+	return id, nil
+}
+
+// printResult prints the result as JSON, if requested, or as a table with the given rows otherwise
+func printResult(result interface{}, table func(w *tabwriter.Writer)) error {
+	if *printJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// formatBytes returns the size in the largest unit it is at least one of
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatQuota returns the quota, noting whether it is an override
+func formatQuota(usage client.ProjectUsage) string {
+	quota := "unlimited"
+	if usage.QuotaBytes > 0 {
+		quota = formatBytes(usage.QuotaBytes)
+	}
+	if usage.Override {
+		quota += " (override)"
+	}
+	return quota
+}
+
+func userShow(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("user show", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "<username>", 1); err != nil {
+		return err
+	}
+
+	user, err := c.AdminGetUser(client.AdminGetUserRequest{Username: flags.Arg(0)})
+	if err != nil {
+		return err
+	}
+	return printResult(user, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Username:\t%s\n", user.User.Username)
+		fmt.Fprintf(w, "Name:\t%s %s\n", user.User.FirstName, user.User.LastName)
+		fmt.Fprintf(w, "Email:\t%s (verified: %t)\n", user.User.Email, user.User.EmailVerified)
+		fmt.Fprintf(w, "Unlisted:\t%t\n", user.User.Unlisted)
+		if len(user.Aliases) > 0 {
+			fmt.Fprintf(w, "Former usernames:\t%s\n", strings.Join(user.Aliases, ", "))
+		}
+		fmt.Fprintf(w, "Storage used:\t%s\n", formatBytes(user.UsedBytes))
+		fmt.Fprintf(w, "\nPROJECT\tNAME\tPERMISSION\n")
+		for _, project := range user.Projects {
+			fmt.Fprintf(w, "%d\t%s\t%d\n", project.ProjectID, project.Name, project.PermissionLevel)
+		}
+	})
+}
+
+func userDelete(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("user delete", flag.ContinueOnError)
+	confirmed := flags.Bool("yes", false, "confirm that the user, and the projects they own, should be deleted")
+	if err := parseFlags(flags, args, "-yes <username>", 1); err != nil {
+		return err
+	}
+	if !*confirmed {
+		return errors.New("Deleting a user also deletes the projects they own, and can't be undone; confirm with -yes")
+	}
+
+	if err := c.AdminDeleteUser(client.AdminDeleteUserRequest{Username: flags.Arg(0)}); err != nil {
+		return err
+	}
+	fmt.Printf("Deleted user %s\n", flags.Arg(0))
+	return nil
+}
+
+func userUnlock(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("user unlock", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "<username>", 1); err != nil {
+		return err
+	}
+
+	cleared, err := c.AdminUnlockLogin(client.AdminUnlockLoginRequest{Username: flags.Arg(0)})
+	if err != nil {
+		return err
+	}
+	if cleared {
+		fmt.Printf("Cleared failed logins of %s\n", flags.Arg(0))
+	} else {
+		fmt.Printf("%s had no failed logins on this server\n", flags.Arg(0))
+	}
+	return nil
+}
+
+func projectShow(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("project show", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "<projectID>", 1); err != nil {
+		return err
+	}
+	projectID, err := parseID(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	project, err := c.AdminGetProject(client.AdminGetProjectRequest{ProjectID: projectID})
+	if err != nil {
+		return err
+	}
+	return printResult(project, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Project:\t%d\n", project.ProjectID)
+		fmt.Fprintf(w, "Name:\t%s\n", project.Name)
+		if project.Archive != "" {
+			fmt.Fprintf(w, "Archive:\t%s\n", project.Archive)
+		}
+		fmt.Fprintf(w, "Storage used:\t%s of %s\n", formatBytes(project.UsedBytes), formatQuota(project.ProjectUsage))
+		fmt.Fprintf(w, "\nUSER\tPERMISSION\tGRANTED BY\n")
+		for _, permission := range project.Permissions {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", permission.Username, permission.PermissionLevel, permission.GrantedBy)
+		}
+		fmt.Fprintf(w, "\nFILE\tPATH\tCREATOR\n")
+		for _, file := range project.Files {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", file.FileID, strings.TrimPrefix(file.RelativePath+"/"+file.Filename, "./"), file.Creator)
+		}
+	})
+}
+
+func quotaReport(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("quota report", flag.ContinueOnError)
+	limit := flags.Int("limit", 50, "number of projects to list, at most 1000")
+	overOnly := flags.Bool("over", false, "only list projects using more than their quota")
+	if err := parseFlags(flags, args, "[-limit N] [-over]", 0); err != nil {
+		return err
+	}
+
+	projects, err := c.AdminGetQuotaReport(client.AdminGetQuotaReportRequest{Limit: *limit})
+	if err != nil {
+		return err
+	}
+	if *overOnly {
+		over := []client.ProjectQuota{}
+		for _, project := range projects {
+			if project.QuotaBytes > 0 && project.UsedBytes > project.QuotaBytes {
+				over = append(over, project)
+			}
+		}
+		projects = over
+	}
+	return printResult(projects, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "PROJECT\tNAME\tOWNER\tUSED\tQUOTA\n")
+		for _, project := range projects {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", project.ProjectID, project.Name, project.Owner,
+				formatBytes(project.UsedBytes), formatQuota(project.ProjectUsage))
+		}
+	})
+}
+
+func quotaSet(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("quota set", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "<projectID> <bytes>", 2); err != nil {
+		return err
+	}
+	projectID, err := parseID(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	quota, err := strconv.ParseInt(flags.Arg(1), 10, 64)
+	if err != nil || quota < 0 {
+		return fmt.Errorf("Invalid quota: %q", flags.Arg(1))
+	}
+
+	err = c.AdminSetProjectQuota(client.AdminSetProjectQuotaRequest{ProjectID: projectID, QuotaBytes: quota})
+	if err != nil {
+		return err
+	}
+	usage, err := c.AdminGetProjectUsage(client.AdminGetProjectUsageRequest{ProjectID: projectID})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Project %d uses %s of %s\n", projectID, formatBytes(usage.UsedBytes), formatQuota(usage))
+	return nil
+}
+
+func scrunch(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("scrunch", flag.ContinueOnError)
+	if err := parseFlags(flags, args, "<fileID>...", -1); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, arg := range flags.Args() {
+		fileID, err := parseID(arg)
+		if err == nil {
+			err = c.AdminScrunchFile(client.AdminScrunchFileRequest{FileID: fileID})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "File %s: %v\n", arg, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Scrunched file %d\n", fileID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed to scrunch %d of %d files", failed, flags.NArg())
+	}
+	return nil
+}
+
+func check(c *client.Client, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	last := flags.Bool("last", false, "show the report of the last check, rather than running one")
+	if err := parseFlags(flags, args, "[-last]", 0); err != nil {
+		return err
+	}
+
+	var report client.IntegrityReport
+	var err error
+	if *last {
+		report, err = c.AdminGetIntegrityReport()
+	} else {
+		report, err = c.AdminCheckIntegrity()
+	}
+	if err != nil {
+		return err
+	}
+	if err := printResult(report, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Started:\t%s\n", report.Started.Format(time.RFC3339))
+		fmt.Fprintf(w, "Finished:\t%s\n", report.Finished.Format(time.RFC3339))
+		fmt.Fprintf(w, "Files checked:\t%d\n", report.FilesChecked)
+		fmt.Fprintf(w, "Missing:\t%s\n", formatIDs(report.Missing))
+		fmt.Fprintf(w, "Corrupt:\t%s\n", formatIDs(report.Corrupt))
+		fmt.Fprintf(w, "Repaired:\t%s\n", formatIDs(report.Repaired))
+	}); err != nil {
+		return err
+	}
+
+	// Files that are still missing or corrupt need an operator, so scripts running checks can tell
+	if unrepaired := len(report.Missing) + len(report.Corrupt) - len(report.Repaired); unrepaired > 0 {
+		return fmt.Errorf("%d files are still missing or corrupt", unrepaired)
+	}
+	return nil
+}
+
+// formatIDs lists the IDs of files in an integrity report
+func formatIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+/**
+ * Loadgen drives File.Change traffic through a running server, to measure how it performs under concurrent editing.
+ * It registers a user for each editor, has the first create a project with the files to edit, and grants the others
+ * write access. Each editor then types and deletes text in the files over its own connection, as a plugin would: it
+ * keeps the text of each file, makes changes against the version it last saw, and applies the patches it missed and
+ * its own transformed change from each response. Editors don't subscribe to the project, so what they miss is only
+ * learned from the responses, and every change made on a stale version is transformed by the server.
+ *
+ * When the run ends, the number of changes made, how many were transformed or refused, and their latencies are
+ * printed. Loadgen should only be pointed at development servers; the users and project it creates are left behind.
+ */
+
+var url = flag.String("url", "ws://localhost:8000/ws/", "WebSocket endpoint of the server to load")
+var editors = flag.Int("editors", 4, "number of users editing concurrently, each over their own connection")
+var files = flag.Int("files", 1, "number of files the editors share; fewer files means more changes to transform")
+var duration = flag.Duration("duration", 30*time.Second, "how long to make changes for")
+var rate = flag.Float64("rate", 0, "changes per second each editor makes; 0 makes the next change as soon as the last is answered")
+var changeSize = flag.Int("change_size", 8, "number of characters each change inserts or deletes")
+var deleteRatio = flag.Float64("delete_ratio", 0.2, "fraction of changes that delete text rather than insert it")
+
+// initialText is what each file is created with
+const initialText = "package main\n\nfunc main() {\n}\n"
+
+// words are what editors type
+var words = []string{"func", "return", "if", "err", "nil", "for", "range", "var", "type", "struct", "go", "defer"}
+
+// document is an editor's view of a file
+type document struct {
+	fileID  int64
+	version int64
+	text    string
+}
+
+// results are the outcomes of the changes made during a run
+type results struct {
+	mutex       sync.Mutex
+	latencies   []time.Duration
+	transformed int // Changes that were made on a stale version
+	outOfDate   int // Changes refused because their version had been scrunched away
+	failed      int
+}
+
+func (res *results) record(latency time.Duration, missed int, err error) {
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
+
+	if statusErr, ok := err.(*client.StatusError); ok && statusErr.Status == messages.StatusVersionOutOfDate {
+		res.outOfDate++
+	} else if err != nil {
+		res.failed++
+	} else {
+		res.latencies = append(res.latencies, latency)
+		if missed > 0 {
+			res.transformed++
+		}
+	}
+}
+
+func (res *results) print(elapsed time.Duration) {
+	res.mutex.Lock()
+	defer res.mutex.Unlock()
+
+	fmt.Printf("Changes:     %d (%.1f/s)\n", len(res.latencies), float64(len(res.latencies))/elapsed.Seconds())
+	fmt.Printf("Transformed: %d\n", res.transformed)
+	fmt.Printf("Out of date: %d\n", res.outOfDate)
+	fmt.Printf("Failed:      %d\n", res.failed)
+	if len(res.latencies) == 0 {
+		return
+	}
+
+	sort.Slice(res.latencies, func(i, j int) bool {
+		return res.latencies[i] < res.latencies[j]
+	})
+	percentile := func(p float64) time.Duration {
+		return res.latencies[int(p*float64(len(res.latencies)-1))]
+	}
+	fmt.Printf("Latency:     p50 %v, p90 %v, p99 %v, max %v\n",
+		percentile(0.5), percentile(0.9), percentile(0.99), res.latencies[len(res.latencies)-1])
+}
+
+func main() {
+	flag.Parse()
+	if *editors < 1 || *files < 1 || *changeSize < 1 {
+		fmt.Fprintln(os.Stderr, "editors, files and change_size must be at least 1")
+		os.Exit(2)
+	}
+
+	clients, fileIDs, err := setUp()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to set up:", err)
+		os.Exit(1)
+	}
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+
+	fmt.Printf("Making changes to %d file(s) with %d editor(s) for %v\n", *files, *editors, *duration)
+	res := &results{}
+	started := time.Now()
+	deadline := started.Add(*duration)
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(c *client.Client, seed int64) {
+			defer wg.Done()
+			edit(c, fileIDs, deadline, mathrand.New(mathrand.NewSource(seed)), res)
+		}(c, started.UnixNano()+int64(i))
+	}
+	wg.Wait()
+	res.print(time.Since(started))
+}
+
+// setUp registers and logs in the editors, and creates the files they edit, returning their clients and the files' IDs
+func setUp() ([]*client.Client, []int64, error) {
+	run := make([]byte, 4)
+	if _, err := rand.Read(run); err != nil {
+		return nil, nil, err
+	}
+	password := hex.EncodeToString(run) + " load generator password"
+
+	clients := make([]*client.Client, *editors)
+	for i := range clients {
+		c, err := client.Dial(*url, client.Options{ReconnectInterval: -1})
+		if err != nil {
+			return nil, nil, err
+		}
+		clients[i] = c
+
+		username := fmt.Sprintf("lg%s_%d", hex.EncodeToString(run), i)
+		err = c.UserRegister(client.UserRegisterRequest{
+			Username:  username,
+			FirstName: "Load",
+			LastName:  "Generator",
+			Email:     username + "@loadgen.invalid",
+			Password:  password,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := c.UserLogin(client.UserLoginRequest{Username: username, Password: password}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	owner := clients[0]
+	projectID, err := owner.ProjectCreate(client.ProjectCreateRequest{Name: "loadgen " + hex.EncodeToString(run)})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 1; i < *editors; i++ {
+		err := owner.ProjectGrantPermissions(client.ProjectGrantPermissionsRequest{
+			ProjectID:     projectID,
+			GrantUsername: fmt.Sprintf("lg%s_%d", hex.EncodeToString(run), i),
+			Role:          "write",
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fileIDs := make([]int64, *files)
+	for i := range fileIDs {
+		fileIDs[i], err = owner.FileCreate(client.FileCreateRequest{
+			Name:         fmt.Sprintf("file%d.go", i),
+			RelativePath: ".",
+			ProjectID:    projectID,
+			FileBytes:    []byte(initialText),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return clients, fileIDs, nil
+}
+
+// edit makes changes to random files until the deadline
+func edit(c *client.Client, fileIDs []int64, deadline time.Time, rnd *mathrand.Rand, res *results) {
+	docs := make([]*document, len(fileIDs))
+	for i, fileID := range fileIDs {
+		docs[i] = &document{fileID: fileID, version: 1, text: initialText}
+	}
+
+	var tick <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for time.Now().Before(deadline) {
+		if tick != nil {
+			<-tick
+		}
+		doc := docs[rnd.Intn(len(docs))]
+
+		started := time.Now()
+		result, err := c.FileChange(client.FileChangeRequest{
+			FileID:  doc.fileID,
+			Changes: nextChange(doc, rnd).String(),
+		})
+		res.record(time.Since(started), len(result.MissingPatches), err)
+		if err == client.ErrClosed || err == client.ErrDisconnected {
+			fmt.Fprintln(os.Stderr, "Editor disconnected:", err)
+			return
+		} else if err == nil {
+			if err := doc.update(result); err != nil {
+				fmt.Fprintln(os.Stderr, "Editor failed to apply the server's patches:", err)
+			} else {
+				continue
+			}
+		}
+
+		// Refused changes, such as those on a version that has since been scrunched, are followed by a fresh copy
+		if err := doc.pull(c); err != nil {
+			fmt.Fprintln(os.Stderr, "Editor failed to pull file:", err)
+			return
+		}
+	}
+}
+
+// nextChange returns a patch typing or deleting text at a random place in the document
+func nextChange(doc *document, rnd *mathrand.Rand) *patching.Patch {
+	text := []rune(doc.text)
+	var diff *patching.Diff
+	if len(text) > *changeSize && rnd.Float64() < *deleteRatio {
+		start := rnd.Intn(len(text) - *changeSize + 1)
+		diff = patching.NewDiff(false, start, string(text[start:start+*changeSize]))
+	} else {
+		typed := strings.Repeat(words[rnd.Intn(len(words))]+" ", *changeSize)
+		diff = patching.NewDiff(true, rnd.Intn(len(text)+1), typed[:*changeSize])
+	}
+	return patching.NewPatch(doc.version, patching.Diffs{diff}, len(text))
+}
+
+// update applies the patches the document missed, and its transformed change, as the server did
+func (doc *document) update(result client.FileChangeResult) error {
+	text := doc.text
+	for _, patchStr := range append(result.MissingPatches, result.Changes) {
+		patch, err := patching.NewPatchFromString(patchStr)
+		if err != nil {
+			return err
+		}
+		text, err = patch.Apply(text)
+		if err != nil {
+			return err
+		}
+	}
+	doc.text = text
+	doc.version = result.FileVersion
+	return nil
+}
+
+// pull replaces the document with the server's, such as once the version it was on has been scrunched
+func (doc *document) pull(c *client.Client) error {
+	result, err := c.FilePull(client.FilePullRequest{FileID: doc.fileID})
+	if err != nil {
+		return err
+	}
+	if result.Version == 0 {
+		return errors.New("the server did not report the file's version")
+	}
+	text, err := patching.PatchTextFromString(string(result.FileBytes), result.Changes)
+	if err != nil {
+		return err
+	}
+	doc.text = text
+	doc.version = result.Version
+	return nil
+}
@@ -19,6 +19,130 @@ USE `cc`;
 /*!40101 SET @OLD_SQL_MODE=@@SQL_MODE, SQL_MODE='NO_AUTO_VALUE_ON_ZERO' */;
 /*!40111 SET @OLD_SQL_NOTES=@@SQL_NOTES, SQL_NOTES=0 */;
 
+--
+-- Table structure for table `APIToken`
+--
+
+DROP TABLE IF EXISTS `APIToken`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `APIToken` (
+  `TokenID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `TokenHash` char(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Name` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
+  `Scope` varchar(10) COLLATE utf8_unicode_ci NOT NULL,
+  `ProjectIDs` varchar(1000) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `CreationDate` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `ExpiresAt` timestamp NULL DEFAULT NULL,
+  PRIMARY KEY (`TokenID`),
+  UNIQUE KEY `TokenHash_UNIQUE` (`TokenHash`),
+  KEY `fk_APIToken_Username_idx` (`Username`),
+  CONSTRAINT `fk_APIToken_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `AuditLog`
+--
+
+DROP TABLE IF EXISTS `AuditLog`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `AuditLog` (
+  `AuditID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Event` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Actor` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `RemoteAddr` varchar(45) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `ProjectID` bigint(20) NOT NULL DEFAULT '0',
+  `Status` int(11) NOT NULL,
+  `Details` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`AuditID`),
+  KEY `idx_AuditLog_Time` (`Time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ChangeFeedCursor`
+--
+
+DROP TABLE IF EXISTS `ChangeFeedCursor`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ChangeFeedCursor` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Sequence` bigint(20) NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ChangeFeedCursor_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `Comment`
+--
+
+DROP TABLE IF EXISTS `Comment`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `Comment` (
+  `CommentID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `ThreadID` bigint(20) DEFAULT NULL,
+  `FileID` bigint(20) NOT NULL,
+  `Author` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Body` text COLLATE utf8_unicode_ci NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Version` bigint(20) NOT NULL DEFAULT '0',
+  `StartOffset` int(11) NOT NULL DEFAULT '0',
+  `EndOffset` int(11) NOT NULL DEFAULT '0',
+  `Outdated` tinyint(1) NOT NULL DEFAULT '0',
+  `ResolvedBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`CommentID`),
+  KEY `fk_Comment_ThreadID_idx` (`ThreadID`),
+  KEY `fk_Comment_FileID_idx` (`FileID`),
+  KEY `fk_Comment_Author_idx` (`Author`),
+  CONSTRAINT `fk_Comment_ThreadID` FOREIGN KEY (`ThreadID`) REFERENCES `Comment` (`CommentID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_Comment_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_Comment_Author` FOREIGN KEY (`Author`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `CommentReaction`
+--
+
+DROP TABLE IF EXISTS `CommentReaction`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `CommentReaction` (
+  `CommentID` bigint(20) NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Reaction` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`CommentID`,`Username`,`Reaction`),
+  KEY `fk_CommentReaction_Username_idx` (`Username`),
+  CONSTRAINT `fk_CommentReaction_CommentID` FOREIGN KEY (`CommentID`) REFERENCES `Comment` (`CommentID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_CommentReaction_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ExternalIdentity`
+--
+
+DROP TABLE IF EXISTS `ExternalIdentity`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ExternalIdentity` (
+  `Provider` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
+  `Subject` varchar(255) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`Provider`,`Subject`),
+  KEY `fk_ExternalIdentity_Username_idx` (`Username`),
+  CONSTRAINT `fk_ExternalIdentity_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
 --
 -- Table structure for table `File`
 --
@@ -33,14 +157,122 @@ CREATE TABLE `File` (
   `RelativePath` varchar(2083) COLLATE utf8_unicode_ci NOT NULL,
   `ProjectID` bigint(20) NOT NULL,
   `Filename` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
+  `ExternalID` char(36) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
   PRIMARY KEY (`FileID`),
   UNIQUE KEY `FileID_UNIQUE` (`FileID`),
+  UNIQUE KEY `ExternalID_UNIQUE` (`ExternalID`),
   KEY `fk_File_Username_idx` (`Creator`),
   KEY `fk_File_ProjectID_idx` (`ProjectID`),
   CONSTRAINT `fk_File_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE NO ACTION ON UPDATE CASCADE,
   CONSTRAINT `fk_File_Username` FOREIGN KEY (`Creator`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
 /*!40101 SET character_set_client = @saved_cs_client */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+  /*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `cc`.`File_BEFORE_INSERT` BEFORE INSERT ON `File` FOR EACH ROW
+  BEGIN
+    IF NEW.ExternalID = '' THEN
+      SET NEW.ExternalID = random_uuid();
+    END IF;
+  END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+
+--
+-- Table structure for table `FileContentHash`
+--
+
+DROP TABLE IF EXISTS `FileContentHash`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `FileContentHash` (
+  `FileID` bigint(20) NOT NULL,
+  `Version` bigint(20) NOT NULL,
+  `Hash` char(64) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`FileID`),
+  CONSTRAINT `fk_FileContentHash_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `FileMetadata`
+--
+
+DROP TABLE IF EXISTS `FileMetadata`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `FileMetadata` (
+  `FileID` bigint(20) NOT NULL,
+  `MetaKey` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `MetaValue` varchar(1024) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`FileID`,`MetaKey`),
+  CONSTRAINT `fk_FileMetadata_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `FileSize`
+--
+
+DROP TABLE IF EXISTS `FileSize`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `FileSize` (
+  `FileID` bigint(20) NOT NULL,
+  `Bytes` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`FileID`),
+  CONSTRAINT `fk_FileSize_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `IdempotentRequest`
+--
+
+DROP TABLE IF EXISTS `IdempotentRequest`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `IdempotentRequest` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `IdempotencyKey` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Method` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Status` int(11) NOT NULL,
+  `Response` mediumtext COLLATE utf8_unicode_ci NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Username`,`IdempotencyKey`),
+  KEY `idx_IdempotentRequest_Created` (`Created`),
+  CONSTRAINT `fk_IdempotentRequest_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `NotificationAck`
+--
+
+DROP TABLE IF EXISTS `NotificationAck`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `NotificationAck` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `ProjectID` bigint(20) NOT NULL,
+  `Sequence` bigint(20) NOT NULL,
+  `Acked` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Username`,`ProjectID`),
+  KEY `fk_NotificationAck_ProjectID_idx` (`ProjectID`),
+  CONSTRAINT `fk_NotificationAck_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_NotificationAck_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
 
 --
 -- Table structure for table `Permissions`
@@ -74,9 +306,11 @@ CREATE TABLE `Project` (
   `ProjectID` bigint(20) NOT NULL AUTO_INCREMENT,
   `Name` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
   `Owner` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `ExternalID` char(36) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
   PRIMARY KEY (`ProjectID`),
   UNIQUE KEY `ProjectID_UNIQUE` (`ProjectID`),
   UNIQUE KEY `NameOwner_UNIQUE` (`Name`,`Owner`),
+  UNIQUE KEY `ExternalID_UNIQUE` (`ExternalID`),
   KEY `fk_Project_Username_idx` (`Owner`),
   CONSTRAINT `fk_Project_Username` FOREIGN KEY (`Owner`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
@@ -90,46 +324,2360 @@ CREATE TABLE `Project` (
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-  /*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `cc`.`Project_BEFORE_DELETE` BEFORE DELETE ON `Project` FOR EACH ROW
+  /*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `cc`.`Project_BEFORE_DELETE` BEFORE DELETE ON `Project` FOR EACH ROW
+  BEGIN
+    DELETE FROM Permissions
+    WHERE Permissions.ProjectID = OLD.ProjectID;
+    DELETE FROM `File`
+    WHERE `File`.ProjectID = OLD.ProjectID;
+  END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+  /*!50003 CREATE*/ /*!50017 DEFINER=`root`@`localhost`*/ /*!50003 TRIGGER `cc`.`Project_BEFORE_INSERT` BEFORE INSERT ON `Project` FOR EACH ROW
+  BEGIN
+    IF NEW.ExternalID = '' THEN
+      SET NEW.ExternalID = random_uuid();
+    END IF;
+  END */;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+
+--
+-- Table structure for table `ProjectArchive`
+--
+
+DROP TABLE IF EXISTS `ProjectArchive`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ProjectArchive` (
+  `ProjectID` bigint(20) NOT NULL,
+  `State` varchar(16) COLLATE utf8_unicode_ci NOT NULL,
+  `Since` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectArchive_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ProjectIgnoreRules`
+--
+
+DROP TABLE IF EXISTS `ProjectIgnoreRules`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ProjectIgnoreRules` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Rules` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectIgnoreRules_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ProjectLineEndings`
+--
+
+DROP TABLE IF EXISTS `ProjectLineEndings`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ProjectLineEndings` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Policy` varchar(16) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectLineEndings_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ProjectQuota`
+--
+
+DROP TABLE IF EXISTS `ProjectQuota`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ProjectQuota` (
+  `ProjectID` bigint(20) NOT NULL,
+  `QuotaBytes` bigint(20) NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectQuota_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ProjectSettings`
+--
+
+DROP TABLE IF EXISTS `ProjectSettings`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ProjectSettings` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Settings` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectSettings_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ServerInstance`
+--
+
+DROP TABLE IF EXISTS `ServerInstance`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ServerInstance` (
+  `InstanceID` varchar(32) COLLATE utf8_unicode_ci NOT NULL,
+  `Name` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Host` varchar(255) COLLATE utf8_unicode_ci NOT NULL,
+  `Version` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `StartedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastHeartbeat` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Connections` int(11) NOT NULL DEFAULT '0',
+  `Draining` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`InstanceID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `ServerMaintenance`
+--
+
+DROP TABLE IF EXISTS `ServerMaintenance`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `ServerMaintenance` (
+  `MaintenanceID` tinyint(1) NOT NULL DEFAULT '1',
+  `Enabled` tinyint(1) NOT NULL DEFAULT '0',
+  `Message` varchar(1024) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `SetBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `SetAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`MaintenanceID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `SessionSubscription`
+--
+
+DROP TABLE IF EXISTS `SessionSubscription`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `SessionSubscription` (
+  `SessionID` char(32) COLLATE utf8_unicode_ci NOT NULL,
+  `SubKey` varchar(255) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Bindings` text COLLATE utf8_unicode_ci NOT NULL,
+  `LastSeen` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`SessionID`,`SubKey`),
+  KEY `fk_SessionSubscription_Username_idx` (`Username`),
+  CONSTRAINT `fk_SessionSubscription_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `Team`
+--
+
+DROP TABLE IF EXISTS `Team`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `Team` (
+  `TeamID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Name` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
+  `Creator` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `CreationDate` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`TeamID`),
+  KEY `fk_Team_Creator_idx` (`Creator`),
+  CONSTRAINT `fk_Team_Creator` FOREIGN KEY (`Creator`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `TeamMember`
+--
+
+DROP TABLE IF EXISTS `TeamMember`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `TeamMember` (
+  `TeamID` bigint(20) NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `IsAdmin` tinyint(1) NOT NULL DEFAULT '0',
+  `AddedBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `AddedDate` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`TeamID`,`Username`),
+  KEY `fk_TeamMember_Username_idx` (`Username`),
+  CONSTRAINT `fk_TeamMember_TeamID` FOREIGN KEY (`TeamID`) REFERENCES `Team` (`TeamID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_TeamMember_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `TeamPermissions`
+--
+
+DROP TABLE IF EXISTS `TeamPermissions`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `TeamPermissions` (
+  `TeamID` bigint(20) NOT NULL,
+  `ProjectID` bigint(20) NOT NULL,
+  `PermissionLevel` tinyint(1) NOT NULL DEFAULT '0',
+  `GrantedBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `GrantedDate` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`ProjectID`,`TeamID`),
+  KEY `fk_TeamPermissions_TeamID_idx` (`TeamID`),
+  CONSTRAINT `fk_TeamPermissions_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_TeamPermissions_TeamID` FOREIGN KEY (`TeamID`) REFERENCES `Team` (`TeamID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `User`
+--
+
+DROP TABLE IF EXISTS `User`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `User` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Password` varchar(255) COLLATE utf8_unicode_ci NOT NULL,
+  `Email` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
+  `FirstName` varchar(30) COLLATE utf8_unicode_ci NOT NULL,
+  `LastName` varchar(30) COLLATE utf8_unicode_ci NOT NULL,
+  `EmailVerified` tinyint(1) NOT NULL DEFAULT '0',
+  `Unlisted` tinyint(1) NOT NULL DEFAULT '0',
+  `AvatarHash` char(64) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`Username`),
+  UNIQUE KEY `Email_UNIQUE` (`Email`),
+  KEY `Email_INDEX` (`Email`),
+  KEY `FirstName_INDEX` (`FirstName`),
+  KEY `LastName_INDEX` (`LastName`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `UserNotificationPrefs`
+--
+
+DROP TABLE IF EXISTS `UserNotificationPrefs`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `UserNotificationPrefs` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `MutedProjects` text COLLATE utf8_unicode_ci NOT NULL,
+  `MutedEvents` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`Username`),
+  CONSTRAINT `fk_UserNotificationPrefs_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `UserSession`
+--
+
+DROP TABLE IF EXISTS `UserSession`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `UserSession` (
+  `SessionID` char(32) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `WebsocketID` bigint(20) NOT NULL,
+  `InstanceID` varchar(32) COLLATE utf8_unicode_ci NOT NULL,
+  `RemoteAddr` varchar(45) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `Device` varchar(255) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `TokenHash` char(64) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `TokenExpires` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `ConnectedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastActive` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastHeartbeat` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Revoked` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`SessionID`,`Username`),
+  KEY `fk_UserSession_Username_idx` (`Username`),
+  KEY `idx_UserSession_TokenHash` (`TokenHash`),
+  CONSTRAINT `fk_UserSession_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `UserToken`
+--
+
+DROP TABLE IF EXISTS `UserToken`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `UserToken` (
+  `TokenHash` char(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Purpose` varchar(20) COLLATE utf8_unicode_ci NOT NULL,
+  `ExpiresAt` timestamp NOT NULL,
+  PRIMARY KEY (`TokenHash`),
+  KEY `fk_UserToken_Username_idx` (`Username`),
+  CONSTRAINT `fk_UserToken_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Table structure for table `UsernameAlias`
+--
+
+DROP TABLE IF EXISTS `UsernameAlias`;
+/*!40101 SET @saved_cs_client     = @@character_set_client */;
+/*!40101 SET character_set_client = utf8 */;
+CREATE TABLE `UsernameAlias` (
+  `Alias` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `CreatedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Alias`),
+  KEY `fk_UsernameAlias_Username_idx` (`Username`),
+  CONSTRAINT `fk_UsernameAlias_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+/*!40101 SET character_set_client = @saved_cs_client */;
+
+--
+-- Dumping events for database 'cc'
+--
+
+--
+-- Dumping routines for database 'cc'
+--
+/*!50003 DROP FUNCTION IF EXISTS `random_uuid` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` FUNCTION `random_uuid`() RETURNS char(36) CHARSET utf8
+    NO SQL
+  BEGIN
+    -- A version 4 UUID, from MySQL's cryptographically secure generator, rather than UUID(), which is based on the time
+    DECLARE bytes char(32) DEFAULT LOWER(HEX(RANDOM_BYTES(16)));
+    RETURN CONCAT_WS('-',
+      SUBSTR(bytes, 1, 8),
+      SUBSTR(bytes, 9, 4),
+      CONCAT('4', SUBSTR(bytes, 14, 3)),
+      CONCAT(SUBSTR('89ab', CONV(SUBSTR(bytes, 17, 1), 16, 10) % 4 + 1, 1), SUBSTR(bytes, 18, 3)),
+      SUBSTR(bytes, 21, 12));
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `api_token_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `api_token_create`(IN tokenHash char(64),
+                                                               IN username varchar(25),
+                                                               IN tokenName varchar(50),
+                                                               IN scope varchar(10),
+                                                               IN projectIDs varchar(1000),
+                                                               IN validSeconds int)
+  BEGIN
+    INSERT INTO APIToken (TokenHash, Username, Name, Scope, ProjectIDs, ExpiresAt)
+    VALUES (tokenHash, username, tokenName, scope, projectIDs,
+            IF(validSeconds > 0, DATE_ADD(NOW(), INTERVAL validSeconds SECOND), NULL));
+    SELECT LAST_INSERT_ID();
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `api_token_lookup` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `api_token_lookup`(IN tokenHash char(64))
+  BEGIN
+    SELECT APIToken.TokenID, APIToken.Username, APIToken.Name, APIToken.Scope, APIToken.ProjectIDs,
+      APIToken.CreationDate, APIToken.ExpiresAt
+    FROM APIToken
+    WHERE APIToken.TokenHash = tokenHash AND (APIToken.ExpiresAt IS NULL OR APIToken.ExpiresAt > NOW());
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `api_token_revoke` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `api_token_revoke`(IN tokenID bigint(20),
+                                                               IN username varchar(25))
+  BEGIN
+    DELETE FROM APIToken
+    WHERE APIToken.TokenID = tokenID AND APIToken.Username = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `audit_log_append` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_append`(IN event varchar(64),
+                                                               IN actor varchar(25),
+                                                               IN remoteAddr varchar(45),
+                                                               IN projectID bigint(20),
+                                                               IN status int(11),
+                                                               IN details text)
+  BEGIN
+    INSERT INTO AuditLog (Event, Actor, RemoteAddr, ProjectID, Status, Details)
+    VALUES (event, actor, remoteAddr, projectID, status, details);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `audit_log_query` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_query`(IN sinceTime bigint(20),
+                                                              IN untilTime bigint(20),
+                                                              IN afterAuditID bigint(20),
+                                                              IN event varchar(64),
+                                                              IN actor varchar(25),
+                                                              IN maxEntries int(11))
+  BEGIN
+    SELECT AuditLog.AuditID, UNIX_TIMESTAMP(AuditLog.Time), AuditLog.Event, AuditLog.Actor, AuditLog.RemoteAddr,
+      AuditLog.ProjectID, AuditLog.Status, AuditLog.Details
+    FROM AuditLog
+    WHERE AuditLog.Time >= FROM_UNIXTIME(sinceTime)
+      AND AuditLog.Time < FROM_UNIXTIME(untilTime)
+      AND AuditLog.AuditID > afterAuditID
+      AND (event = '' OR AuditLog.Event = event)
+      AND (actor = '' OR AuditLog.Actor = actor)
+    ORDER BY AuditLog.AuditID
+    LIMIT maxEntries;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `change_feed_cursor_advance` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `change_feed_cursor_advance`(IN projectID bigint(20),
+                                                                         IN fromSequence bigint(20),
+                                                                         IN toSequence bigint(20))
+  BEGIN
+    IF fromSequence = 0 THEN
+      INSERT IGNORE INTO ChangeFeedCursor (ProjectID, Sequence)
+      VALUES (projectID, toSequence);
+    ELSE
+      UPDATE ChangeFeedCursor
+      SET ChangeFeedCursor.Sequence = toSequence
+      WHERE ChangeFeedCursor.ProjectID = projectID AND ChangeFeedCursor.Sequence = fromSequence;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `change_feed_cursor_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `change_feed_cursor_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Sequence
+    FROM ChangeFeedCursor
+    WHERE ChangeFeedCursor.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `comment_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_create`(IN threadID bigint(20), IN fileID bigint(20),
+                                                             IN author varchar(25), IN body text,
+                                                             IN version bigint(20), IN startOffset int(11),
+                                                             IN endOffset int(11))
+  BEGIN
+    INSERT INTO Comment (ThreadID, FileID, Author, Body, Version, StartOffset, EndOffset)
+    VALUES (NULLIF(threadID, 0), fileID, author, body, version, startOffset, endOffset);
+    SELECT LAST_INSERT_ID();
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `comment_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_get`(IN commentID bigint(20))
+  BEGIN
+    SELECT Comment.CommentID, COALESCE(Comment.ThreadID, Comment.CommentID), Comment.FileID, Comment.Author,
+      Comment.Body, UNIX_TIMESTAMP(Comment.Created), Comment.Version, Comment.StartOffset, Comment.EndOffset,
+      Comment.Outdated, Comment.ResolvedBy
+    FROM Comment
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `comment_reaction_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_reaction_set`(IN commentID bigint(20), IN username varchar(25),
+                                                                   IN reaction varchar(16) CHARACTER SET utf8mb4,
+                                                                   IN remove tinyint(1))
+  BEGIN
+    IF remove THEN
+      DELETE FROM CommentReaction
+      WHERE CommentReaction.CommentID = commentID AND CommentReaction.Username = username
+        AND CommentReaction.Reaction = reaction;
+    ELSE
+      INSERT IGNORE INTO CommentReaction (CommentID, Username, Reaction)
+      VALUES (commentID, username, reaction);
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `comment_set_anchor` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_set_anchor`(IN commentID bigint(20), IN version bigint(20),
+                                                                 IN startOffset int(11), IN endOffset int(11),
+                                                                 IN outdated tinyint(1))
+  BEGIN
+    UPDATE Comment
+    SET Comment.Version = version, Comment.StartOffset = startOffset, Comment.EndOffset = endOffset,
+      Comment.Outdated = outdated
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `comment_set_resolved` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_set_resolved`(IN commentID bigint(20),
+                                                                   IN resolvedBy varchar(25))
+  BEGIN
+    UPDATE Comment
+    SET Comment.ResolvedBy = resolvedBy
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `external_identity_link` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `external_identity_link`(IN provider varchar(50),
+                                                                     IN subject varchar(255),
+                                                                     IN username varchar(25))
+  BEGIN
+    INSERT INTO ExternalIdentity (Provider, Subject, Username)
+    VALUES (provider, subject, username);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `external_identity_lookup` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `external_identity_lookup`(IN provider varchar(50),
+                                                                       IN subject varchar(255))
+  BEGIN
+    SELECT ExternalIdentity.Username
+    FROM ExternalIdentity
+    WHERE ExternalIdentity.Provider = provider AND ExternalIdentity.Subject = subject;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_content_hash_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_content_hash_get`(IN fileID bigint(20))
+  BEGIN
+    SELECT Version, Hash
+    FROM FileContentHash
+    WHERE FileContentHash.FileID = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_content_hash_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_content_hash_set`(IN fileID bigint(20), IN version bigint(20),
+                                                                     IN hash char(64))
+  BEGIN
+    -- Hashes of earlier versions, from servers that fell behind, don't replace later ones
+    INSERT INTO FileContentHash (FileID, Version, Hash)
+    VALUES (fileID, version, hash)
+    ON DUPLICATE KEY UPDATE
+      Hash = IF(version >= FileContentHash.Version, hash, FileContentHash.Hash),
+      Version = GREATEST(version, FileContentHash.Version);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_create`(IN username varchar(25), IN filename varchar(50), IN relativePath varchar(2083), IN projectID bigint(20))
+BEGIN
+  IF ( NOT EXISTS ( SELECT `File`.`FileID`
+          FROM `File`
+          WHERE `File`.`ProjectID` =  projectID AND `File`.`RelativePath` = relativePath AND `File`.`Filename` = filename ) ) THEN
+      BEGIN
+        INSERT INTO `File`
+        (Creator, RelativePath, ProjectID, Filename)
+        VALUES (username, relativePath, projectID, filename);
+        SELECT LAST_INSERT_ID();
+      END;
+    ELSE
+      BEGIN
+        SELECT null;
+      END;
+    END IF;
+END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_delete`(IN fileID bigint(20))
+  BEGIN
+    DELETE FROM `File`
+    WHERE `File`.FileID = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_external_id_resolve` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_external_id_resolve`(IN externalID char(36))
+  BEGIN
+    SELECT FileID
+    FROM File
+    WHERE File.ExternalID = externalID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_external_ids_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_external_ids_get`(IN fileIDs text)
+  BEGIN
+    -- fileIDs is a comma-separated list, checked before it is made part of the query
+    IF fileIDs REGEXP '^[0-9]+(,[0-9]+)*$' THEN
+      SET @query = CONCAT('SELECT FileID, ExternalID FROM File WHERE FileID IN (', fileIDs, ')');
+      PREPARE statement FROM @query;
+      EXECUTE statement;
+      DEALLOCATE PREPARE statement;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_get_by_path` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_by_path`(IN projectID bigint(20),
+                                                               IN relativePath varchar(2083),
+                                                               IN filename varchar(50))
+  BEGIN
+    SELECT `File`.`FileID`, `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
+    FROM File
+    WHERE `File`.`ProjectID` = projectID
+      AND `File`.`RelativePath` = relativePath
+      AND `File`.`Filename` = filename;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_get_comment_reactions` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_comment_reactions`(IN fileID bigint(20))
+  BEGIN
+    SELECT CommentReaction.CommentID, CommentReaction.Username, CommentReaction.Reaction
+    FROM CommentReaction
+    JOIN Comment ON Comment.CommentID = CommentReaction.CommentID
+    WHERE Comment.FileID = fileID
+    ORDER BY CommentReaction.CommentID, CommentReaction.Created, CommentReaction.Username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_get_comments` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_comments`(IN fileID bigint(20))
+  BEGIN
+    SELECT Comment.CommentID, COALESCE(Comment.ThreadID, Comment.CommentID), Comment.FileID, Comment.Author,
+      Comment.Body, UNIX_TIMESTAMP(Comment.Created), Comment.Version, Comment.StartOffset, Comment.EndOffset,
+      Comment.Outdated, Comment.ResolvedBy
+    FROM Comment
+    WHERE Comment.FileID = fileID
+    ORDER BY Comment.CommentID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_get_info` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_info`(IN fileID bigint(20))
+  BEGIN
+    SELECT `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
+    FROM File
+    WHERE `File`.`FileID` = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_list` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_list`(IN afterFileID bigint(20), IN maxFiles int(11))
+  BEGIN
+    SELECT FileID, Creator, CreationDate, RelativePath, ProjectID, Filename
+    FROM File
+    WHERE File.FileID > afterFileID
+    ORDER BY File.FileID
+    LIMIT maxFiles;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_metadata_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_metadata_delete`(IN fileID bigint(20), IN metaKey varchar(64))
+  BEGIN
+    DELETE FROM FileMetadata
+    WHERE FileMetadata.FileID = fileID AND FileMetadata.MetaKey = metaKey;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_metadata_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_metadata_get`(IN fileID bigint(20))
+  BEGIN
+    SELECT MetaKey, MetaValue
+    FROM FileMetadata
+    WHERE FileMetadata.FileID = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_metadata_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_metadata_set`(IN fileID bigint(20),
+                                                                IN metaKey varchar(64),
+                                                                IN metaValue varchar(1024))
+  BEGIN
+    INSERT INTO FileMetadata (FileID, MetaKey, MetaValue)
+    VALUES (fileID, metaKey, metaValue)
+    ON DUPLICATE KEY UPDATE
+      MetaValue = metaValue;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_move` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_move`(IN fileID bigint(20), IN newPath varchar(2083))
+  BEGIN
+    UPDATE `File`
+    SET `File`.RelativePath = newPath
+    WHERE `File`.FileID = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_rename` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_rename`(IN fileID bigint(20), IN newName varchar(50))
+  BEGIN
+    UPDATE `File`
+    SET `File`.Filename = newName
+    WHERE `File`.FileID = fileID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `file_size_add` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_size_add`(IN fileID bigint(20), IN delta bigint(20))
+  BEGIN
+    INSERT INTO FileSize (FileID, Bytes)
+    VALUES (fileID, GREATEST(delta, 0))
+    ON DUPLICATE KEY UPDATE
+      Bytes = GREATEST(Bytes + delta, 0);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `files_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `files_create`(IN files json)
+  BEGIN
+    DECLARE i int DEFAULT 0;
+    DECLARE creator varchar(25);
+    DECLARE projectID bigint(20);
+    DECLARE relativePath varchar(2083);
+    DECLARE filename varchar(50);
+    DECLARE size bigint(20);
+    DECLARE newFileID bigint(20);
+
+    DROP TEMPORARY TABLE IF EXISTS `FilesCreated`;
+    CREATE TEMPORARY TABLE `FilesCreated` (
+      `Idx` int NOT NULL,
+      `FileID` bigint(20) DEFAULT NULL,
+      PRIMARY KEY (`Idx`)
+    );
+
+    WHILE i < JSON_LENGTH(files) DO
+      SET creator = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].Creator')));
+      SET projectID = JSON_EXTRACT(files, CONCAT('$[', i, '].ProjectID'));
+      SET relativePath = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].RelativePath')));
+      SET filename = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].Filename')));
+      SET size = JSON_EXTRACT(files, CONCAT('$[', i, '].Size'));
+
+      IF ( NOT EXISTS ( SELECT `File`.`FileID`
+                        FROM `File`
+                        WHERE `File`.`ProjectID` = projectID AND `File`.`RelativePath` = relativePath AND `File`.`Filename` = filename ) ) THEN
+        INSERT INTO `File` (Creator, RelativePath, ProjectID, Filename)
+        VALUES (creator, relativePath, projectID, filename);
+        SET newFileID = LAST_INSERT_ID();
+        INSERT INTO FileSize (FileID, Bytes)
+        VALUES (newFileID, GREATEST(size, 0));
+        INSERT INTO `FilesCreated` (Idx, FileID)
+        VALUES (i, newFileID);
+      ELSE
+        -- Files that already exist are left as they are
+        INSERT INTO `FilesCreated` (Idx, FileID)
+        VALUES (i, NULL);
+      END IF;
+      SET i = i + 1;
+    END WHILE;
+
+    SELECT `FilesCreated`.`FileID`
+    FROM `FilesCreated`
+    ORDER BY `FilesCreated`.`Idx`;
+    DROP TEMPORARY TABLE `FilesCreated`;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `idempotent_request_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_get`(IN username varchar(25),
+                                                                     IN idempotencyKey varchar(64),
+                                                                     IN validSeconds int)
+  BEGIN
+    SELECT Method, Status, Response, Created
+    FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey
+      AND IdempotentRequest.Created > DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `idempotent_request_release` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_release`(IN username varchar(25),
+                                                                         IN idempotencyKey varchar(64))
+  BEGIN
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `idempotent_request_reserve` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_reserve`(IN username varchar(25),
+                                                                         IN idempotencyKey varchar(64),
+                                                                         IN method varchar(64),
+                                                                         IN validSeconds int,
+                                                                         IN leaseSeconds int)
+  BEGIN
+    -- Outcomes are only looked up within the validity period, so the user's expired ones are cleaned up here
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.Created <= DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+    -- A reservation whose lease has passed was made by a request that never finished, so it is taken over
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey
+      AND IdempotentRequest.Status = 0
+      AND IdempotentRequest.Created <= DATE_SUB(NOW(), INTERVAL leaseSeconds SECOND);
+    INSERT IGNORE INTO IdempotentRequest (Username, IdempotencyKey, Method, Status, Response)
+    VALUES (username, idempotencyKey, method, 0, '');
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `idempotent_request_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_set`(IN username varchar(25),
+                                                                     IN idempotencyKey varchar(64),
+                                                                     IN status int,
+                                                                     IN response mediumtext)
+  BEGIN
+    UPDATE IdempotentRequest
+    SET IdempotentRequest.Status = status, IdempotentRequest.Response = response
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `notification_ack` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `notification_ack`(IN username varchar(25), IN projectID bigint(20),
+                                                               IN sequence bigint(20))
+  BEGIN
+    -- Acks that arrive out of order don't take the user's place back
+    INSERT INTO NotificationAck (Username, ProjectID, Sequence)
+    VALUES (username, projectID, sequence)
+    ON DUPLICATE KEY UPDATE
+      Sequence = GREATEST(sequence, NotificationAck.Sequence);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_archive_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_archive_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT State
+    FROM ProjectArchive
+    WHERE ProjectArchive.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_archive_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_archive_set`(IN projectID bigint(20), IN state varchar(16))
+  BEGIN
+    IF state = '' THEN
+      DELETE FROM ProjectArchive
+      WHERE ProjectArchive.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectArchive (ProjectID, State)
+      VALUES (projectID, state)
+      ON DUPLICATE KEY UPDATE
+        State = state,
+        Since = CURRENT_TIMESTAMP;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_create`(IN projectName varchar(50), IN username varchar(25))
+  BEGIN
+    INSERT INTO Project (`Name`, `Owner`)
+    VALUES (projectName, username);
+    SELECT LAST_INSERT_ID();
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_delete`(IN projectID bigint(20),
+                                                             IN revokeUsername varchar(25))
+  BEGIN
+    DELETE FROM Project
+    WHERE Project.ProjectID = projectID AND Project.Owner = revokeUsername;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_external_id_resolve` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_external_id_resolve`(IN externalID char(36))
+  BEGIN
+    SELECT ProjectID
+    FROM Project
+    WHERE Project.ExternalID = externalID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_external_ids_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_external_ids_get`(IN projectIDs text)
+  BEGIN
+    -- projectIDs is a comma-separated list, checked before it is made part of the query
+    IF projectIDs REGEXP '^[0-9]+(,[0-9]+)*$' THEN
+      SET @query = CONCAT('SELECT ProjectID, ExternalID FROM Project WHERE ProjectID IN (', projectIDs, ')');
+      PREPARE statement FROM @query;
+      EXECUTE statement;
+      DEALLOCATE PREPARE statement;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_file_content_hashes` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_file_content_hashes`(IN projectID bigint(20))
+  BEGIN
+    SELECT FileContentHash.FileID, Version, Hash
+    FROM FileContentHash
+    JOIN `File` ON `File`.FileID = FileContentHash.FileID
+    WHERE `File`.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_file_metadata` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_file_metadata`(IN projectID bigint(20))
+  BEGIN
+    SELECT FileMetadata.FileID, MetaKey, MetaValue
+    FROM FileMetadata
+      JOIN File ON File.FileID = FileMetadata.FileID
+    WHERE File.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_files` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_files`(IN projectID bigint(20))
+  BEGIN
+    SELECT FileID, Creator, CreationDate, RelativePath, ProjectID, Filename
+    FROM File
+    WHERE File.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_files_filtered` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_files_filtered`(IN projectID bigint(20),
+                                                                        IN directory varchar(2083),
+                                                                        IN subdirectories varchar(2083),
+                                                                        IN filenames varchar(255))
+  BEGIN
+    SELECT `File`.`FileID`, `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
+    FROM File
+    WHERE `File`.`ProjectID` = projectID
+      AND (directory = '' OR `File`.`RelativePath` = directory OR `File`.`RelativePath` LIKE subdirectories)
+      AND `File`.`Filename` LIKE filenames;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_notification_acks` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_notification_acks`(IN projectID bigint(20))
+  BEGIN
+    SELECT NotificationAck.Username, NotificationAck.Sequence, UNIX_TIMESTAMP(NotificationAck.Acked)
+    FROM NotificationAck
+    WHERE NotificationAck.ProjectID = projectID
+    ORDER BY NotificationAck.Username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_get_usage` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_usage`(IN projectID bigint(20))
+  BEGIN
+    SELECT COALESCE(SUM(FileSize.Bytes), 0)
+    FROM `File`
+    JOIN FileSize ON FileSize.FileID = `File`.FileID
+    WHERE `File`.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_grant_permissions` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_grant_permissions`(IN projectID bigint(20),
+                                                                        IN grantUsername varchar(25),
+                                                                        IN permissionLevel tinyint(1),
+                                                                        IN grantedByUsername varchar(25))
+  BEGIN
+    insert into `Permissions`
+    (Username, ProjectID, PermissionLevel, GrantedBy)
+    values (grantUsername, projectID, permissionLevel, grantedByUsername)
+    on duplicate key update
+      PermissionLevel = permissionLevel,
+      GrantedBy = grantedByUsername;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_ignore_rules_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_ignore_rules_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Rules
+    FROM ProjectIgnoreRules
+    WHERE ProjectIgnoreRules.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_ignore_rules_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_ignore_rules_set`(IN projectID bigint(20), IN rules text)
+  BEGIN
+    IF rules = '' THEN
+      DELETE FROM ProjectIgnoreRules
+      WHERE ProjectIgnoreRules.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectIgnoreRules (ProjectID, Rules)
+      VALUES (projectID, rules)
+      ON DUPLICATE KEY UPDATE
+        Rules = rules;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_line_endings_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_line_endings_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Policy
+    FROM ProjectLineEndings
+    WHERE ProjectLineEndings.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_line_endings_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_line_endings_set`(IN projectID bigint(20), IN policy varchar(16))
+  BEGIN
+    IF policy = 'Preserve' THEN
+      DELETE FROM ProjectLineEndings
+      WHERE ProjectLineEndings.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectLineEndings (ProjectID, Policy)
+      VALUES (projectID, policy)
+      ON DUPLICATE KEY UPDATE
+        Policy = policy;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_lookup` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_lookup`(IN projectID bigint(20))
+  BEGIN
+    SELECT `Project`.`Name`, `Permissions`.`Username`, `Permissions`.`PermissionLevel`, `Permissions`.`GrantedBy`, `Permissions`.`GrantedDate`
+    FROM Project JOIN Permissions
+        ON Project.ProjectID = Permissions.ProjectID
+    WHERE Project.ProjectID = projectID
+    UNION
+    SELECT `Project`.`Name`, `Project`.`Owner`, 10, `Project`.`Owner`, 0
+    FROM `Project`
+    WHERE `Project`.`ProjectID` = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_quota_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_quota_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT QuotaBytes
+    FROM ProjectQuota
+    WHERE ProjectQuota.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_quota_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_quota_set`(IN projectID bigint(20), IN quotaBytes bigint(20))
+  BEGIN
+    IF quotaBytes > 0 THEN
+      INSERT INTO ProjectQuota (ProjectID, QuotaBytes)
+      VALUES (projectID, quotaBytes)
+      ON DUPLICATE KEY UPDATE
+        QuotaBytes = quotaBytes;
+    ELSE
+      DELETE FROM ProjectQuota
+      WHERE ProjectQuota.ProjectID = projectID;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_rename` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_rename`(IN projectID bigint(20), IN newName varchar(50))
+  BEGIN
+    UPDATE Project
+    SET `Name` = newName
+    WHERE Project.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_revoke_permissions` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_revoke_permissions`(IN projectID bigint(20),
+                                                                         IN revokeUsername varchar(25))
+  BEGIN
+    DELETE FROM Permissions
+    WHERE Permissions.ProjectID = projectID
+          AND Permissions.Username = revokeUsername;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_settings_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_settings_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT
+      COALESCE(ProjectLineEndings.Policy, ''),
+      COALESCE(ProjectIgnoreRules.Rules, ''),
+      COALESCE(ProjectQuota.QuotaBytes, 0),
+      COALESCE(ProjectSettings.Settings, '{}')
+    FROM Project
+      LEFT JOIN ProjectLineEndings ON ProjectLineEndings.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectIgnoreRules ON ProjectIgnoreRules.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectQuota ON ProjectQuota.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectSettings ON ProjectSettings.ProjectID = Project.ProjectID
+    WHERE Project.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_settings_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_settings_set`(IN projectID bigint(20), IN settings text)
+  BEGIN
+    IF settings = '{}' THEN
+      DELETE FROM ProjectSettings
+      WHERE ProjectSettings.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectSettings (ProjectID, Settings)
+      VALUES (projectID, settings)
+      ON DUPLICATE KEY UPDATE
+        Settings = settings;
+    END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `project_usage_report` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_usage_report`(IN maxResults int)
+  BEGIN
+    SELECT
+      Project.ProjectID,
+      Project.Name,
+      Project.Owner,
+      COALESCE(SUM(FileSize.Bytes), 0) AS UsedBytes,
+      COALESCE(ProjectQuota.QuotaBytes, 0)
+    FROM Project
+      LEFT JOIN `File` ON `File`.ProjectID = Project.ProjectID
+      LEFT JOIN FileSize ON FileSize.FileID = `File`.FileID
+      LEFT JOIN ProjectQuota ON ProjectQuota.ProjectID = Project.ProjectID
+    GROUP BY Project.ProjectID, Project.Name, Project.Owner, ProjectQuota.QuotaBytes
+    ORDER BY UsedBytes DESC, Project.ProjectID
+    LIMIT maxResults;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_instance_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_delete`(IN instanceID varchar(32))
+  BEGIN
+    DELETE FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_instance_heartbeat` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_heartbeat`(IN instanceID varchar(32),
+                                                                        IN name varchar(64),
+                                                                        IN host varchar(255),
+                                                                        IN version varchar(64),
+                                                                        IN startedAt bigint(20),
+                                                                        IN connections int(11),
+                                                                        IN forgetBefore bigint(20))
+  BEGIN
+    INSERT INTO ServerInstance (InstanceID, Name, Host, Version, StartedAt, Connections)
+    VALUES (instanceID, name, host, version, FROM_UNIXTIME(startedAt), connections)
+    ON DUPLICATE KEY UPDATE
+      Name = name,
+      Host = host,
+      Version = version,
+      LastHeartbeat = CURRENT_TIMESTAMP,
+      Connections = connections;
+
+    DELETE FROM ServerInstance
+    WHERE ServerInstance.LastHeartbeat < FROM_UNIXTIME(forgetBefore);
+
+    SELECT Draining
+    FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_instance_list` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_list`()
+  BEGIN
+    SELECT InstanceID, Name, Host, Version, UNIX_TIMESTAMP(StartedAt), UNIX_TIMESTAMP(LastHeartbeat), Connections,
+      Draining
+    FROM ServerInstance
+    ORDER BY Name, InstanceID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_instance_set_draining` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_set_draining`(IN instanceID varchar(32),
+                                                                           IN draining tinyint(1))
+  BEGIN
+    UPDATE ServerInstance
+    SET ServerInstance.Draining = draining
+    WHERE ServerInstance.InstanceID = instanceID;
+
+    -- Rows whose Draining is already set are not counted as affected
+    SELECT COUNT(*)
+    FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_maintenance_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_maintenance_get`()
+  BEGIN
+    SELECT Enabled, Message, SetBy, UNIX_TIMESTAMP(SetAt)
+    FROM ServerMaintenance
+    WHERE ServerMaintenance.MaintenanceID = 1;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `server_maintenance_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_maintenance_set`(IN enabled tinyint(1),
+                                                                     IN message varchar(1024),
+                                                                     IN setBy varchar(25))
+  BEGIN
+    INSERT INTO ServerMaintenance (MaintenanceID, Enabled, Message, SetBy)
+    VALUES (1, enabled, message, setBy)
+    ON DUPLICATE KEY UPDATE
+      Enabled = enabled,
+      Message = message,
+      SetBy = setBy,
+      SetAt = CURRENT_TIMESTAMP;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `session_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_delete`(IN sessionID char(32))
+  BEGIN
+    DELETE FROM SessionSubscription
+    WHERE SessionSubscription.SessionID = sessionID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `session_get_subscriptions` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_get_subscriptions`(IN sessionID char(32),
+                                                                        IN validSeconds int)
+  BEGIN
+    SELECT SubKey, Username, Bindings, LastSeen
+    FROM SessionSubscription
+    WHERE SessionSubscription.SessionID = sessionID
+      AND SessionSubscription.LastSeen > DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `session_subscription_remove` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_subscription_remove`(IN sessionID char(32),
+                                                                          IN subKey varchar(255))
+  BEGIN
+    DELETE FROM SessionSubscription
+    WHERE SessionSubscription.SessionID = sessionID AND SessionSubscription.SubKey = subKey;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `session_subscription_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_subscription_set`(IN sessionID char(32),
+                                                                       IN subKey varchar(255),
+                                                                       IN username varchar(25),
+                                                                       IN bindings text,
+                                                                       IN validSeconds int)
+  BEGIN
+    -- Sessions are never explicitly closed, so the user's expired sessions are cleaned up here
+    DELETE FROM SessionSubscription
+    WHERE SessionSubscription.Username = username
+      AND SessionSubscription.LastSeen <= DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+    INSERT INTO SessionSubscription (SessionID, SubKey, Username, Bindings)
+    VALUES (sessionID, subKey, username, bindings)
+    ON DUPLICATE KEY UPDATE
+      Username = username,
+      Bindings = bindings,
+      LastSeen = CURRENT_TIMESTAMP;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `session_touch` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_touch`(IN sessionID char(32))
+  BEGIN
+    UPDATE SessionSubscription
+    SET LastSeen = CURRENT_TIMESTAMP
+    WHERE SessionSubscription.SessionID = sessionID;
+
+    UPDATE UserSession
+    SET LastHeartbeat = CURRENT_TIMESTAMP
+    WHERE UserSession.SessionID = sessionID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `team_add_member` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `team_add_member`(IN teamID bigint(20),
+                                                              IN username varchar(25),
+                                                              IN isAdmin tinyint(1),
+                                                              IN addedByUsername varchar(25))
+  BEGIN
+    INSERT INTO TeamMember (TeamID, Username, IsAdmin, AddedBy)
+    VALUES (teamID, username, isAdmin, addedByUsername)
+    ON DUPLICATE KEY UPDATE
+      IsAdmin = isAdmin;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `team_create` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `team_create`(IN teamName varchar(50), IN username varchar(25))
+  BEGIN
+    DECLARE newTeamID bigint(20);
+    INSERT INTO Team (Name, Creator)
+    VALUES (teamName, username);
+    SET newTeamID = LAST_INSERT_ID();
+    INSERT INTO TeamMember (TeamID, Username, IsAdmin, AddedBy)
+    VALUES (newTeamID, username, 1, username);
+    SELECT newTeamID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `team_get_members` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `team_get_members`(IN teamID bigint(20))
+  BEGIN
+    SELECT TeamMember.Username, TeamMember.IsAdmin
+    FROM TeamMember
+    WHERE TeamMember.TeamID = teamID;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `team_grant_project_access` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `team_grant_project_access`(IN teamID bigint(20),
+                                                                        IN projectID bigint(20),
+                                                                        IN permissionLevel tinyint(1),
+                                                                        IN grantedByUsername varchar(25))
+  BEGIN
+    INSERT INTO TeamPermissions (TeamID, ProjectID, PermissionLevel, GrantedBy)
+    VALUES (teamID, projectID, permissionLevel, grantedByUsername)
+    ON DUPLICATE KEY UPDATE
+      PermissionLevel = permissionLevel,
+      GrantedBy = grantedByUsername;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_change_username` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_change_username`(IN oldUsername varchar(25),
+                                                                   IN newUsername varchar(25))
+  BEGIN
+    UPDATE Permissions
+    SET Permissions.GrantedBy = newUsername
+    WHERE Permissions.GrantedBy = oldUsername;
+
+    UPDATE TeamPermissions
+    SET TeamPermissions.GrantedBy = newUsername
+    WHERE TeamPermissions.GrantedBy = oldUsername;
+
+    UPDATE TeamMember
+    SET TeamMember.AddedBy = newUsername
+    WHERE TeamMember.AddedBy = oldUsername;
+
+    UPDATE Comment
+    SET Comment.ResolvedBy = newUsername
+    WHERE Comment.ResolvedBy = oldUsername;
+
+    UPDATE User
+    SET User.Username = newUsername
+    WHERE User.Username = oldUsername;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_delete` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_delete`(IN username varchar(25))
+  BEGIN
+    DELETE FROM `User`
+    WHERE `User`.Username = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_get_password` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_get_password`(IN username varchar(25))
+  BEGIN
+    SELECT Password
+    FROM User where User.Username = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_get_projectids` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_get_projectids`(IN username varchar(25))
   BEGIN
-    DELETE FROM Permissions
-    WHERE Permissions.ProjectID = OLD.ProjectID;
-    DELETE FROM `File`
-    WHERE `File`.ProjectID = OLD.ProjectID;
-  END */;;
+    SELECT `Project`.`ProjectID` FROM `Project`
+      WHERE `Project`.`Owner` = username;
+  END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-
---
--- Table structure for table `User`
---
-
-DROP TABLE IF EXISTS `User`;
-/*!40101 SET @saved_cs_client     = @@character_set_client */;
-/*!40101 SET character_set_client = utf8 */;
-CREATE TABLE `User` (
-  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
-  `Password` varchar(100) COLLATE utf8_unicode_ci NOT NULL,
-  `Email` varchar(50) COLLATE utf8_unicode_ci NOT NULL,
-  `FirstName` varchar(30) COLLATE utf8_unicode_ci NOT NULL,
-  `LastName` varchar(30) COLLATE utf8_unicode_ci NOT NULL,
-  PRIMARY KEY (`Username`),
-  UNIQUE KEY `Email_UNIQUE` (`Email`),
-  KEY `Email_INDEX` (`Email`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
-/*!40101 SET character_set_client = @saved_cs_client */;
-
---
--- Dumping events for database 'cc'
---
-
---
--- Dumping routines for database 'cc'
---
-/*!50003 DROP PROCEDURE IF EXISTS `file_create` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_get_usage` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -139,29 +2687,158 @@ CREATE TABLE `User` (
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `file_create`(IN username varchar(25), IN filename varchar(50), IN relativePath varchar(2083), IN projectID bigint(20))
-BEGIN
-  IF ( NOT EXISTS ( SELECT `File`.`FileID`
-          FROM `File`
-          WHERE `File`.`ProjectID` =  projectID AND `File`.`RelativePath` = relativePath AND `File`.`Filename` = filename ) ) THEN
-      BEGIN
-        INSERT INTO `File`
-        (Creator, RelativePath, ProjectID, Filename)
-        VALUES (username, relativePath, projectID, filename);
-        SELECT LAST_INSERT_ID();
-      END;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_get_usage`(IN username varchar(25))
+  BEGIN
+    SELECT COALESCE(SUM(FileSize.Bytes), 0)
+    FROM `File`
+    JOIN FileSize ON FileSize.FileID = `File`.FileID
+    WHERE `File`.Creator = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_lookup` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_lookup`(IN username varchar(25))
+  BEGIN
+    SELECT FirstName, LastName, Email, Username, EmailVerified, Unlisted, AvatarHash
+    FROM User where User.Username = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_notification_prefs_get` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_notification_prefs_get`(IN username varchar(25))
+  BEGIN
+    SELECT MutedProjects, MutedEvents
+    FROM UserNotificationPrefs
+    WHERE UserNotificationPrefs.Username = username;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_notification_prefs_set` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_notification_prefs_set`(IN username varchar(25),
+                                                                          IN mutedProjects text,
+                                                                          IN mutedEvents text)
+  BEGIN
+    IF mutedProjects = '[]' AND mutedEvents = '[]' THEN
+      DELETE FROM UserNotificationPrefs
+      WHERE UserNotificationPrefs.Username = username;
     ELSE
-      BEGIN
-        SELECT null;
-      END;
+      INSERT INTO UserNotificationPrefs (Username, MutedProjects, MutedEvents)
+      VALUES (username, mutedProjects, mutedEvents)
+      ON DUPLICATE KEY UPDATE
+        MutedProjects = mutedProjects,
+        MutedEvents = mutedEvents;
     END IF;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_projects` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_projects`(IN username varchar(25))
+  BEGIN
+    SELECT `Levels`.`ProjectID`, `Levels`.`Name`, MAX(`Levels`.`PermissionLevel`)
+    FROM (
+      SELECT `Project`.`ProjectID`, `Project`.`Name`, `Permissions`.`PermissionLevel`
+      FROM (Permissions LEFT JOIN Project ON Permissions.ProjectID = Project.ProjectID)
+      WHERE Permissions.Username = username
+      UNION ALL
+      SELECT `Project`.`ProjectID`, `Project`.`Name`, `TeamPermissions`.`PermissionLevel`
+      FROM (TeamPermissions JOIN TeamMember ON TeamPermissions.TeamID = TeamMember.TeamID
+        JOIN Project ON TeamPermissions.ProjectID = Project.ProjectID)
+      WHERE TeamMember.Username = username
+      UNION ALL
+      SELECT `Project`.`ProjectID`, `Project`.`Name`, 10
+      FROM `Project`
+      WHERE `Project`.`Owner` = username
+    ) AS Levels
+    GROUP BY `Levels`.`ProjectID`, `Levels`.`Name`;
+  END ;;
+DELIMITER ;
+/*!50003 SET sql_mode              = @saved_sql_mode */ ;
+/*!50003 SET character_set_client  = @saved_cs_client */ ;
+/*!50003 SET character_set_results = @saved_cs_results */ ;
+/*!50003 SET collation_connection  = @saved_col_connection */ ;
+/*!50003 DROP PROCEDURE IF EXISTS `user_project_permission` */;
+/*!50003 SET @saved_cs_client      = @@character_set_client */ ;
+/*!50003 SET @saved_cs_results     = @@character_set_results */ ;
+/*!50003 SET @saved_col_connection = @@collation_connection */ ;
+/*!50003 SET character_set_client  = utf8 */ ;
+/*!50003 SET character_set_results = utf8 */ ;
+/*!50003 SET collation_connection  = utf8_general_ci */ ;
+/*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
+/*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_project_permission`(username varchar(25), projectID bigint(20))
+BEGIN
+  SELECT MAX(Levels.PermissionLevel)
+  FROM (
+    SELECT Permissions.PermissionLevel
+    FROM Permissions
+    WHERE Permissions.Username = username and Permissions.ProjectID = projectID
+    UNION ALL
+    SELECT TeamPermissions.PermissionLevel
+    FROM TeamPermissions JOIN TeamMember
+        ON TeamPermissions.TeamID = TeamMember.TeamID
+    WHERE TeamMember.Username = username and TeamPermissions.ProjectID = projectID
+    UNION ALL
+    SELECT 10
+    FROM Project
+    WHERE Project.ProjectID = projectID and Project.Owner = username
+  ) AS Levels
+  HAVING MAX(Levels.PermissionLevel) IS NOT NULL;
 END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `file_delete` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_register` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -171,17 +2848,23 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `file_delete`(IN fileID bigint(20))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_register`(IN username varchar(25),
+                                                            IN pass varchar(255),
+                                                            IN email varchar(50),
+                                                            IN firstName varchar(30),
+                                                            IN lastName varchar(30))
   BEGIN
-    DELETE FROM `File`
-    WHERE `File`.FileID = fileID;
+    INSERT INTO User (Username, Password, Email, FirstName, LastName)
+    SELECT username, pass, email, firstName, lastName
+    FROM DUAL
+    WHERE NOT EXISTS (SELECT 1 FROM UsernameAlias WHERE UsernameAlias.Alias = username);
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `file_get_info` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_search` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -191,18 +2874,41 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_info`(IN fileID bigint(20))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_search`(IN username varchar(25), IN pattern varchar(101),
+                                                          IN maxResults int(11))
   BEGIN
-    SELECT `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
-    FROM File
-    WHERE `File`.`FileID` = fileID;
+    -- Each prefix is matched separately, so that each match can use its column's index
+    SELECT Matches.Username, Matches.FirstName, Matches.LastName
+    FROM (
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Username = username
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.Username LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.Email LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.FirstName LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.LastName LIKE pattern
+    ) AS Matches
+    ORDER BY Matches.Username = username DESC, Matches.Username
+    LIMIT maxResults;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `file_move` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_session_end` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -212,18 +2918,18 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `file_move`(IN fileID bigint(20), IN newPath varchar(2083))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_end`(IN sessionID char(32))
   BEGIN
-    UPDATE `File`
-    SET `File`.RelativePath = newPath
-    WHERE `File`.FileID = fileID;
+    DELETE FROM UserSession
+    WHERE UserSession.SessionID = sessionID
+      AND UserSession.Revoked = 0;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `file_rename` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_session_list` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -233,18 +2939,23 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `file_rename`(IN fileID bigint(20), IN newName varchar(50))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_list`(IN username varchar(25),
+                                                                IN activeSince bigint(20))
   BEGIN
-    UPDATE `File`
-    SET `File`.Filename = newName
-    WHERE `File`.FileID = fileID;
+    SELECT SessionID, WebsocketID, InstanceID, RemoteAddr, Device, TokenHash, UNIX_TIMESTAMP(TokenExpires),
+      UNIX_TIMESTAMP(ConnectedAt), UNIX_TIMESTAMP(LastActive)
+    FROM UserSession
+    WHERE UserSession.Username = username
+      AND UserSession.Revoked = 0
+      AND UserSession.LastHeartbeat >= FROM_UNIXTIME(activeSince)
+    ORDER BY UserSession.LastActive DESC, UserSession.SessionID;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_create` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_session_record` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -254,18 +2965,38 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_create`(IN projectName varchar(50), IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_record`(IN sessionID char(32),
+                                                                  IN username varchar(25),
+                                                                  IN websocketID bigint(20),
+                                                                  IN instanceID varchar(32),
+                                                                  IN remoteAddr varchar(45),
+                                                                  IN device varchar(255),
+                                                                  IN tokenHash char(64),
+                                                                  IN tokenExpires bigint(20),
+                                                                  IN forgetBefore bigint(20))
   BEGIN
-    INSERT INTO Project (`Name`, `Owner`)
-    VALUES (projectName, username);
-    SELECT LAST_INSERT_ID();
+    INSERT INTO UserSession (SessionID, Username, WebsocketID, InstanceID, RemoteAddr, Device, TokenHash, TokenExpires)
+    VALUES (sessionID, username, websocketID, instanceID, remoteAddr, device, tokenHash, FROM_UNIXTIME(tokenExpires))
+    ON DUPLICATE KEY UPDATE
+      RemoteAddr = remoteAddr,
+      Device = device,
+      TokenHash = tokenHash,
+      TokenExpires = FROM_UNIXTIME(tokenExpires),
+      LastActive = CURRENT_TIMESTAMP,
+      LastHeartbeat = CURRENT_TIMESTAMP;
+
+    -- Rows of connections on servers that stopped without removing them, and of revoked sessions whose token expired
+    DELETE FROM UserSession
+    WHERE UserSession.Username = username
+      AND ((UserSession.Revoked = 0 AND UserSession.LastHeartbeat < FROM_UNIXTIME(forgetBefore))
+        OR (UserSession.Revoked = 1 AND UserSession.TokenExpires < CURRENT_TIMESTAMP));
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_delete` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_session_revoke` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -275,18 +3006,21 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_delete`(IN projectID bigint(20),
-                                                             IN revokeUsername varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_revoke`(IN sessionID char(32),
+                                                                  IN username varchar(25))
   BEGIN
-    DELETE FROM Project
-    WHERE Project.ProjectID = projectID AND Project.Owner = revokeUsername;
+    UPDATE UserSession
+    SET UserSession.Revoked = 1
+    WHERE UserSession.SessionID = sessionID
+      AND UserSession.Username = username
+      AND UserSession.Revoked = 0;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_get_files` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_session_token_revoked` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -296,18 +3030,19 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_files`(IN projectID bigint(20))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_token_revoked`(IN tokenHash char(64))
   BEGIN
-    SELECT *
-    FROM File
-    WHERE File.ProjectID = projectID;
+    SELECT COUNT(*)
+    FROM UserSession
+    WHERE UserSession.TokenHash = tokenHash
+      AND UserSession.Revoked = 1;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_grant_permissions` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_set_avatar` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -317,24 +3052,18 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_grant_permissions`(IN projectID bigint(20),
-                                                                        IN grantUsername varchar(25),
-                                                                        IN permissionLevel tinyint(1),
-                                                                        IN grantedByUsername varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_avatar`(IN username varchar(25), IN avatarHash char(64))
   BEGIN
-    insert into `Permissions`
-    (Username, ProjectID, PermissionLevel, GrantedBy)
-    values (grantUsername, projectID, permissionLevel, grantedByUsername)
-    on duplicate key update
-      PermissionLevel = permissionLevel,
-      GrantedBy = grantedByUsername;
+    UPDATE User
+    SET User.AvatarHash = avatarHash
+    WHERE User.Username = username;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_lookup` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_set_password` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -344,23 +3073,17 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_lookup`(IN projectID bigint(20))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_password`(IN username varchar(25),
+                                                                IN pass varchar(255))
   BEGIN
-    SELECT `Project`.`Name`, `Permissions`.`Username`, `Permissions`.`PermissionLevel`, `Permissions`.`GrantedBy`, `Permissions`.`GrantedDate`
-    FROM Project JOIN Permissions
-        ON Project.ProjectID = Permissions.ProjectID
-    WHERE Project.ProjectID = projectID
-    UNION
-    SELECT `Project`.`Name`, `Project`.`Owner`, 10, `Project`.`Owner`, 0
-    FROM `Project`
-    WHERE `Project`.`ProjectID` = projectID;
+    UPDATE User SET User.Password = pass WHERE User.Username = username;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_rename` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_set_email_verified` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -370,18 +3093,16 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_rename`(IN projectID bigint(20), IN newName varchar(50))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_email_verified`(IN username varchar(25))
   BEGIN
-    UPDATE Project
-    SET `Name` = newName
-    WHERE Project.ProjectID = projectID;
+    UPDATE User SET User.EmailVerified = 1 WHERE User.Username = username;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `project_revoke_permissions` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_set_unlisted` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -391,19 +3112,18 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `project_revoke_permissions`(IN projectID bigint(20),
-                                                                         IN revokeUsername varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_unlisted`(IN username varchar(25), IN unlisted tinyint(1))
   BEGIN
-    DELETE FROM Permissions
-    WHERE Permissions.ProjectID = projectID
-          AND Permissions.Username = revokeUsername;
+    UPDATE User
+    SET User.Unlisted = unlisted
+    WHERE User.Username = username;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_delete` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_token_create` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -413,17 +3133,23 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_delete`(IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_token_create`(IN tokenHash char(64),
+                                                                IN username varchar(25),
+                                                                IN purpose varchar(20),
+                                                                IN validSeconds int)
   BEGIN
-    DELETE FROM `User`
-    WHERE `User`.Username = username;
+    -- Only the newest token for each purpose stays valid
+    DELETE FROM UserToken
+    WHERE UserToken.Username = username AND UserToken.Purpose = purpose;
+    INSERT INTO UserToken (TokenHash, Username, Purpose, ExpiresAt)
+    VALUES (tokenHash, username, purpose, DATE_ADD(NOW(), INTERVAL validSeconds SECOND));
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_get_password` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_token_consume` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -433,17 +3159,21 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_get_password`(IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_token_consume`(IN tokenHash char(64),
+                                                                 IN purpose varchar(20))
   BEGIN
-    SELECT Password
-    FROM User where User.Username = username;
+    SELECT UserToken.Username
+    FROM UserToken
+    WHERE UserToken.TokenHash = tokenHash AND UserToken.Purpose = purpose AND UserToken.ExpiresAt > NOW();
+    DELETE FROM UserToken
+    WHERE UserToken.TokenHash = tokenHash OR UserToken.ExpiresAt <= NOW();
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_get_projectids` */;
+/*!50003 DROP PROCEDURE IF EXISTS `user_update_profile` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -453,17 +3183,19 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_get_projectids`(IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_update_profile`(IN username varchar(25), IN firstName varchar(30),
+                                                                  IN lastName varchar(30))
   BEGIN
-    SELECT `Project`.`ProjectID` FROM `Project`
-      WHERE `Project`.`Owner` = username;
+    UPDATE User
+    SET User.FirstName = firstName, User.LastName = lastName
+    WHERE User.Username = username;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_lookup` */;
+/*!50003 DROP PROCEDURE IF EXISTS `username_alias_add` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -473,17 +3205,20 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_lookup`(IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_add`(IN alias varchar(25), IN username varchar(25))
   BEGIN
-    SELECT FirstName, LastName, Email, Username
-    FROM User where User.Username = username;
+    DELETE FROM UsernameAlias
+    WHERE UsernameAlias.Alias = username;
+
+    INSERT INTO UsernameAlias (Alias, Username)
+    VALUES (alias, username);
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_projects` */;
+/*!50003 DROP PROCEDURE IF EXISTS `username_alias_list` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -493,22 +3228,19 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_projects`(IN username varchar(25))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_list`(IN username varchar(25))
   BEGIN
-    SELECT `Project`.`ProjectID`, `Project`.`Name`, `Permissions`.`PermissionLevel`
-    FROM (Permissions LEFT JOIN Project ON Permissions.ProjectID = Project.ProjectID)
-    WHERE Permissions.Username = username
-    UNION
-    SELECT `Project`.`ProjectID`, `Project`.`Name`, 10
-    FROM `Project`
-    WHERE `Project`.`Owner` = username;
+    SELECT Alias
+    FROM UsernameAlias
+    WHERE UsernameAlias.Username = username
+    ORDER BY UsernameAlias.CreatedAt, UsernameAlias.Alias;
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_project_permission` */;
+/*!50003 DROP PROCEDURE IF EXISTS `username_alias_resolve` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -518,22 +3250,18 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_project_permission`(username varchar(25), projectID bigint(20))
-BEGIN
-  SELECT Permissions.PermissionLevel
-    FROM Permissions
-    WHERE Permissions.Username = username and Permissions.ProjectID = projectID
-    UNION
-    SELECT 10
-    FROM Project
-    WHERE Project.ProjectID = projectID and Project.Owner = username;
-END ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_resolve`(IN alias varchar(25))
+  BEGIN
+    SELECT Username
+    FROM UsernameAlias
+    WHERE UsernameAlias.Alias = alias;
+  END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
 /*!50003 SET character_set_client  = @saved_cs_client */ ;
 /*!50003 SET character_set_results = @saved_cs_results */ ;
 /*!50003 SET collation_connection  = @saved_col_connection */ ;
-/*!50003 DROP PROCEDURE IF EXISTS `user_register` */;
+/*!50003 DROP PROCEDURE IF EXISTS `username_taken` */;
 /*!50003 SET @saved_cs_client      = @@character_set_client */ ;
 /*!50003 SET @saved_cs_results     = @@character_set_results */ ;
 /*!50003 SET @saved_col_connection = @@collation_connection */ ;
@@ -543,13 +3271,11 @@ DELIMITER ;
 /*!50003 SET @saved_sql_mode       = @@sql_mode */ ;
 /*!50003 SET sql_mode              = 'ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_AUTO_CREATE_USER,NO_ENGINE_SUBSTITUTION' */ ;
 DELIMITER ;;
-CREATE DEFINER=`root`@`localhost` PROCEDURE `user_register`(IN username varchar(25),
-                                                            IN pass varchar(100),
-                                                            IN email varchar(50),
-                                                            IN firstName varchar(30),
-                                                            IN lastName varchar(30))
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_taken`(IN username varchar(25), IN exceptUsername varchar(25))
   BEGIN
-    INSERT INTO User VALUES (username, pass, email, firstName, lastName);
+    SELECT (SELECT COUNT(*) FROM User WHERE User.Username = username) +
+           (SELECT COUNT(*) FROM UsernameAlias
+            WHERE UsernameAlias.Alias = username AND UsernameAlias.Username <> exceptUsername);
   END ;;
 DELIMITER ;
 /*!50003 SET sql_mode              = @saved_sql_mode */ ;
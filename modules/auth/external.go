@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/dgrijalva/jwt-go"
+)
+
+/**
+ * External identity providers, used for single sign-on.
+ *
+ * OIDC providers (Google, Azure AD, Okta, Keycloak, ...) are validated by checking the ID token's signature against the
+ * provider's published JWKS, and its issuer, audience and expiry. GitHub does not issue ID tokens, so GitHub access
+ * tokens are instead checked with GitHub's API, which also confirms that they were issued to our OAuth app.
+ */
+
+// ErrUnknownProvider is returned when the requested provider has not been configured
+var ErrUnknownProvider = errors.New("The requested identity provider is not configured")
+
+// ErrInvalidExternalToken is returned when an external token fails validation
+var ErrInvalidExternalToken = errors.New("The external identity token is invalid")
+
+// ErrDomainNotAllowed is returned when the user's email domain is not allowed for the provider
+var ErrDomainNotAllowed = errors.New("The user's email domain is not allowed to log in with this provider")
+
+// How long discovery documents and signing keys are cached, and how often unknown key IDs may trigger a refetch
+const (
+	jwksCacheDuration   = time.Hour
+	jwksRefetchInterval = time.Minute
+)
+
+// ExternalIdentity is the identity asserted by an external provider
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string // Stable, provider-unique user ID
+	Username      string // Suggested username; may be taken, or need sanitizing
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+var externalHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// VerifyExternalToken validates the token with the provider the config names, and returns the identity it asserts.
+func VerifyExternalToken(cfg *config.Config, providerName string, token string) (*ExternalIdentity, error) {
+	if cfg == nil {
+		return nil, ErrUnknownProvider
+	}
+	providerCfg, ok := cfg.ServerConfig.OIDCProviders[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return verifyExternalToken(providerName, providerCfg, token)
+}
+
+func verifyExternalToken(providerName string, providerCfg config.OIDCProviderCfg, token string) (*ExternalIdentity, error) {
+	var identity *ExternalIdentity
+	var err error
+	switch providerCfg.Type {
+	case "", "oidc":
+		identity, err = verifyOIDCToken(providerCfg, token)
+	case "github":
+		identity, err = verifyGitHubToken(providerCfg, token)
+	default:
+		return nil, fmt.Errorf("unknown identity provider type %q", providerCfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	identity.Provider = providerName
+
+	if len(providerCfg.AllowedDomains) > 0 && !emailInDomains(identity, providerCfg.AllowedDomains) {
+		return nil, ErrDomainNotAllowed
+	}
+
+	return identity, nil
+}
+
+func emailInDomains(identity *ExternalIdentity, domains []string) bool {
+	// Unverified emails could be set to anything by the user
+	if !identity.EmailVerified {
+		return false
+	}
+	at := strings.LastIndex(identity.Email, "@")
+	if at < 0 {
+		return false
+	}
+	emailDomain := strings.ToLower(identity.Email[at+1:])
+	for _, domain := range domains {
+		if emailDomain == strings.ToLower(domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyOIDCToken(providerCfg config.OIDCProviderCfg, idToken string) (*ExternalIdentity, error) {
+	keys, err := getKeySet(providerCfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return keys.get(kid)
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidExternalToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidExternalToken
+	}
+	if !claims.VerifyIssuer(providerCfg.Issuer, true) || !hasAudience(claims["aud"], providerCfg.ClientID) {
+		return nil, ErrInvalidExternalToken
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, ErrInvalidExternalToken
+	}
+
+	identity := &ExternalIdentity{
+		Subject:   stringClaim(claims, "sub"),
+		Email:     stringClaim(claims, "email"),
+		FirstName: stringClaim(claims, "given_name"),
+		LastName:  stringClaim(claims, "family_name"),
+	}
+	if identity.Subject == "" {
+		return nil, ErrInvalidExternalToken
+	}
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers send this as a string
+		identity.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+
+	usernameClaim := providerCfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	identity.Username = stringClaim(claims, usernameClaim)
+	if identity.Username == "" {
+		identity.Username = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	return identity, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// hasAudience checks the aud claim, which may be a single string or a list.
+func hasAudience(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, entry := range aud {
+			if entry == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type keySet struct {
+	jwksURI     string
+	keys        map[string]interface{}
+	fetched     time.Time
+	lastRefetch time.Time
+	mutex       sync.Mutex
+}
+
+var keySetsMutex sync.Mutex
+var keySets = make(map[string]*keySet)
+
+func getKeySet(issuer string) (*keySet, error) {
+	keySetsMutex.Lock()
+	defer keySetsMutex.Unlock()
+
+	if keys, ok := keySets[issuer]; ok {
+		return keys, nil
+	}
+
+	discovery := struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	if err := getJSON(strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != issuer || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("invalid OIDC discovery document for %s", issuer)
+	}
+
+	keys := &keySet{jwksURI: discovery.JWKSURI}
+	if err := keys.refresh(); err != nil {
+		return nil, err
+	}
+	keySets[issuer] = keys
+	return keys, nil
+}
+
+// get returns the key with the given ID, refetching the key set if it is stale, or the key is unknown; providers
+// rotate their keys regularly.
+func (ks *keySet) get(kid string) (interface{}, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	key, ok := ks.keys[kid]
+	stale := time.Since(ks.fetched) > jwksCacheDuration
+	if stale || (!ok && time.Since(ks.lastRefetch) > jwksRefetchInterval) {
+		ks.lastRefetch = time.Now()
+		if err := ks.refreshLocked(); err != nil {
+			return nil, err
+		}
+		key, ok = ks.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (ks *keySet) refresh() error {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	return ks.refreshLocked()
+}
+
+func (ks *keySet) refreshLocked() error {
+	jwks := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}{}
+	if err := getJSON(ks.jwksURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				continue
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil {
+				continue
+			}
+			y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	ks.keys = keys
+	ks.fetched = time.Now()
+	return nil
+}
+
+func getJSON(url string, result interface{}) error {
+	resp, err := externalHTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// verifyGitHubToken checks the access token with GitHub's "check a token" API, which fails for tokens issued to other
+// OAuth apps, and returns the user the token belongs to.
+func verifyGitHubToken(providerCfg config.OIDCProviderCfg, accessToken string) (*ExternalIdentity, error) {
+	apiURL := providerCfg.APIURL
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+
+	body, err := json.Marshal(struct {
+		AccessToken string `json:"access_token"`
+	}{accessToken})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(apiURL, "/")+"/applications/"+providerCfg.ClientID+"/token", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(providerCfg.ClientID, providerCfg.ClientSecret)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := externalHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ErrInvalidExternalToken
+	}
+
+	result := struct {
+		User struct {
+			ID    int64  `json:"id"`
+			Login string `json:"login"`
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"user"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.User.ID == 0 {
+		return nil, ErrInvalidExternalToken
+	}
+
+	identity := &ExternalIdentity{
+		Subject:  strconv.FormatInt(result.User.ID, 10),
+		Username: result.User.Login,
+		// GitHub only exposes the user's public email, which it requires to be verified
+		Email:         result.User.Email,
+		EmailVerified: result.User.Email != "",
+	}
+	names := strings.SplitN(strings.TrimSpace(result.User.Name), " ", 2)
+	identity.FirstName = names[0]
+	if len(names) > 1 {
+		identity.LastName = names[1]
+	}
+	return identity, nil
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestIssuer starts an OIDC discovery and JWKS server that publishes the given key under the key ID "test-key"
+func newTestIssuer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   server.URL,
+			"jwks_uri": server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	return server
+}
+
+func signTestIDToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyExternalToken_OIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := newTestIssuer(t, key)
+	defer issuer.Close()
+
+	providerCfg := config.OIDCProviderCfg{
+		Issuer:   issuer.URL,
+		ClientID: "codecollaborate",
+	}
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":                issuer.URL,
+			"aud":                []string{"other-client", "codecollaborate"},
+			"sub":                "1234567890",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"email":              "gene@example.com",
+			"email_verified":     true,
+			"preferred_username": "GeneHynson",
+			"given_name":         "Gene",
+			"family_name":        "Hynson",
+		}
+	}
+
+	identity, err := verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, &ExternalIdentity{
+		Provider:      "corp",
+		Subject:       "1234567890",
+		Username:      "GeneHynson",
+		Email:         "gene@example.com",
+		EmailVerified: true,
+		FirstName:     "Gene",
+		LastName:      "Hynson",
+	}, identity)
+
+	claims := validClaims()
+	claims["aud"] = "other-client"
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, claims))
+	assert.Equal(t, ErrInvalidExternalToken, err, "token for another client should be rejected")
+
+	claims = validClaims()
+	claims["iss"] = "https://evil.example.com"
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, claims))
+	assert.Equal(t, ErrInvalidExternalToken, err, "token from another issuer should be rejected")
+
+	claims = validClaims()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, claims))
+	assert.Equal(t, ErrInvalidExternalToken, err, "expired token should be rejected")
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, otherKey, validClaims()))
+	assert.Equal(t, ErrInvalidExternalToken, err, "token with an invalid signature should be rejected")
+
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyExternalToken("corp", providerCfg, unsigned)
+	assert.Equal(t, ErrInvalidExternalToken, err, "unsigned token should be rejected")
+
+	providerCfg.AllowedDomains = []string{"codecollaborate.com"}
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, validClaims()))
+	assert.Equal(t, ErrDomainNotAllowed, err)
+
+	providerCfg.AllowedDomains = []string{"Example.com"}
+	claims = validClaims()
+	claims["email_verified"] = false
+	_, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, claims))
+	assert.Equal(t, ErrDomainNotAllowed, err, "unverified emails should not satisfy the domain restriction")
+
+	claims = validClaims()
+	delete(claims, "preferred_username")
+	identity, err = verifyExternalToken("corp", providerCfg, signTestIDToken(t, key, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, "gene", identity.Username, "username should fall back to the email's local part")
+}
+
+func TestVerifyExternalToken_GitHub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, secret, ok := r.BasicAuth()
+		body := struct {
+			AccessToken string `json:"access_token"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		if r.Method != "POST" || r.URL.Path != "/applications/client-id/token" ||
+			!ok || clientID != "client-id" || secret != "client-secret" || body.AccessToken != "gho_valid" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"user": {"id": 42, "login": "octocat", "name": "The Octocat", "email": "octocat@github.com"}}`))
+	}))
+	defer server.Close()
+
+	providerCfg := config.OIDCProviderCfg{
+		Type:         "github",
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		APIURL:       server.URL,
+	}
+
+	identity, err := verifyExternalToken("github", providerCfg, "gho_valid")
+	assert.NoError(t, err)
+	assert.Equal(t, &ExternalIdentity{
+		Provider:      "github",
+		Subject:       "42",
+		Username:      "octocat",
+		Email:         "octocat@github.com",
+		EmailVerified: true,
+		FirstName:     "The",
+		LastName:      "Octocat",
+	}, identity)
+
+	_, err = verifyExternalToken("github", providerCfg, "gho_invalid")
+	assert.Equal(t, ErrInvalidExternalToken, err)
+}
+
+func TestVerifyExternalToken_UnknownProvider(t *testing.T) {
+	_, err := VerifyExternalToken(nil, "not-configured", "token")
+	assert.Equal(t, ErrUnknownProvider, err)
+	_, err = VerifyExternalToken(&config.Config{}, "not-configured", "token")
+	assert.Equal(t, ErrUnknownProvider, err)
+}
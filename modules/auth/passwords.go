@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/**
+ * Password hashing for the CodeCollaborate Server.
+ *
+ * New passwords are hashed with argon2id, and stored in the standard PHC encoding, which records every parameter
+ * alongside the hash:
+ *
+ *	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+ *
+ * This lets the parameters be strengthened over time; hashes made with older parameters, or with the legacy bcrypt
+ * scheme, still verify, and are flagged for re-hashing so that they can be upgraded on the user's next login.
+ */
+
+// ErrMismatchedPassword is returned when a password does not match the stored hash
+var ErrMismatchedPassword = errors.New("The given password does not match the stored hash")
+
+// ErrUnknownHashFormat is returned when a stored hash was not produced by any supported scheme
+var ErrUnknownHashFormat = errors.New("The stored password hash is in an unknown format")
+
+// Argon2Params are the tunable parameters for argon2id hashing.
+type Argon2Params struct {
+	Memory     uint32 // in KiB
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2Params are used for any parameter not set in the server config.
+var DefaultArgon2Params = Argon2Params{
+	Memory:     64 * 1024,
+	Iterations: 3,
+	Threads:    2,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+// CurrentArgon2Params returns the parameters that new hashes are made with by the server with the config; a nil config
+// is the process's.
+func CurrentArgon2Params(cfg *config.Config) Argon2Params {
+	params := DefaultArgon2Params
+
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
+	if cfg == nil {
+		return params
+	}
+	if cfg.ServerConfig.PasswordHashMemory > 0 {
+		params.Memory = cfg.ServerConfig.PasswordHashMemory
+	}
+	if cfg.ServerConfig.PasswordHashIterations > 0 {
+		params.Iterations = cfg.ServerConfig.PasswordHashIterations
+	}
+	if cfg.ServerConfig.PasswordHashThreads > 0 {
+		params.Threads = cfg.ServerConfig.PasswordHashThreads
+	}
+	return params
+}
+
+// HashPassword hashes the password with argon2id, using the current parameters of the server with the config.
+func HashPassword(cfg *config.Config, password string) (string, error) {
+	return hashArgon2id(password, CurrentArgon2Params(cfg))
+}
+
+// VerifyPassword checks the password against the stored hash. If the password matches, but the hash was made with an
+// older scheme or other parameters than the config's, needsRehash is set, and the caller should store a new hash from
+// HashPassword.
+func VerifyPassword(cfg *config.Config, hash string, password string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, ErrMismatchedPassword
+		}
+
+		return params != CurrentArgon2Params(cfg), nil
+
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		// Legacy scheme; always upgrade
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				return false, ErrMismatchedPassword
+			}
+			return false, err
+		}
+		return true, nil
+
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+func hashArgon2id(password string, params Argon2Params) (string, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Threads, params.KeyLength)
+
+	return encodeArgon2id(params, salt, key), nil
+}
+
+// encodeArgon2id returns the PHC encoding of the hash; with the default salt and key lengths, it is at most 113
+// characters, however large the parameters
+func encodeArgon2id(params Argon2Params, salt []byte, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Threads); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
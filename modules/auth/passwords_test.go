@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hashed, err := HashPassword(nil, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hashed, "$argon2id$v=19$m=65536,t=3,p=2$"), "unexpected hash format: %s", hashed)
+	assert.True(t, len(hashed) <= 255, "hash must fit in the User.Password column")
+
+	other, err := HashPassword(nil, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.NotEqual(t, hashed, other, "hashes should be salted")
+
+	needsRehash, err := VerifyPassword(nil, hashed, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.False(t, needsRehash, "hash with current parameters should not need re-hashing")
+
+	_, err = VerifyPassword(nil, hashed, "incorrect horse battery staple")
+	assert.Equal(t, ErrMismatchedPassword, err)
+}
+
+func TestEncodeArgon2idLength(t *testing.T) {
+	strongest := DefaultArgon2Params
+	strongest.Memory = math.MaxUint32
+	strongest.Iterations = math.MaxUint32
+	strongest.Threads = math.MaxUint8
+	encoded := encodeArgon2id(strongest, make([]byte, strongest.SaltLength), make([]byte, strongest.KeyLength))
+	assert.Equal(t, 113, len(encoded))
+	assert.True(t, len(encoded) <= 255, "hashes with any configured parameters must fit in the User.Password column")
+}
+
+func TestHashPasswordServerConfig(t *testing.T) {
+	serverCfg := &config.Config{}
+	serverCfg.ServerConfig.PasswordHashIterations = 4
+	hashed, err := HashPassword(serverCfg, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(hashed, "$argon2id$v=19$m=65536,t=4,p=2$"), "unexpected hash format: %s", hashed)
+
+	needsRehash, err := VerifyPassword(serverCfg, hashed, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.False(t, needsRehash, "hash with the server's parameters should not need re-hashing")
+	needsRehash, err = VerifyPassword(&config.Config{}, hashed, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, needsRehash, "hash with another server's parameters should need re-hashing")
+}
+
+func TestVerifyPasswordOutdatedParams(t *testing.T) {
+	weak := DefaultArgon2Params
+	weak.Iterations = 1
+	hashed, err := hashArgon2id("correct horse battery staple", weak)
+	assert.Nil(t, err)
+
+	needsRehash, err := VerifyPassword(nil, hashed, "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, needsRehash, "hash with outdated parameters should need re-hashing")
+
+	_, err = VerifyPassword(nil, hashed, "incorrect horse battery staple")
+	assert.Equal(t, ErrMismatchedPassword, err)
+}
+
+func TestVerifyPasswordLegacyBcrypt(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	assert.Nil(t, err)
+
+	needsRehash, err := VerifyPassword(nil, string(hashed), "correct horse battery staple")
+	assert.Nil(t, err)
+	assert.True(t, needsRehash, "legacy hashes should always need re-hashing")
+
+	_, err = VerifyPassword(nil, string(hashed), "incorrect horse battery staple")
+	assert.Equal(t, ErrMismatchedPassword, err)
+}
+
+func TestVerifyPasswordInvalidHash(t *testing.T) {
+	_, err := VerifyPassword(nil, "plaintext", "plaintext")
+	assert.Equal(t, ErrUnknownHashFormat, err)
+
+	_, err = VerifyPassword(nil, "$argon2id$v=19$m=65536,t=3,p=2$notbase64!", "password")
+	assert.Equal(t, ErrUnknownHashFormat, err)
+}
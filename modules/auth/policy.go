@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * Password strength policy for the CodeCollaborate Server.
+ */
+
+// DefaultPasswordMinLength is used if PasswordMinLength is not set in the server config
+const DefaultPasswordMinLength = 8
+
+// PasswordMaxLength bounds the work done hashing a single password
+const PasswordMaxLength = 256
+
+// ErrPasswordTooShort is returned when a password is shorter than the configured minimum length
+var ErrPasswordTooShort = errors.New("The password is too short")
+
+// ErrPasswordTooLong is returned when a password is longer than PasswordMaxLength
+var ErrPasswordTooLong = errors.New("The password is too long")
+
+// ErrPasswordContainsUsername is returned when a password contains the user's username
+var ErrPasswordContainsUsername = errors.New("The password must not contain the username")
+
+// ErrPasswordTooCommon is returned when a password is on the list of commonly used passwords
+var ErrPasswordTooCommon = errors.New("The password is too common")
+
+// commonPasswords is a short list of the most frequently used passwords, compared case-insensitively.
+var commonPasswords = map[string]bool{
+	"password":   true,
+	"password1":  true,
+	"12345678":   true,
+	"123456789":  true,
+	"1234567890": true,
+	"qwertyuiop": true,
+	"qwerty123":  true,
+	"iloveyou":   true,
+	"sunshine":   true,
+	"princess":   true,
+	"football":   true,
+	"baseball":   true,
+	"welcome1":   true,
+	"letmein1":   true,
+	"trustno1":   true,
+	"abcd1234":   true,
+	"11111111":   true,
+	"00000000":   true,
+}
+
+// ValidatePassword checks the password against the password policy of the server with the config, returning the first
+// rule it breaks; a nil config is the process's. Length is measured in characters, not bytes.
+func ValidatePassword(cfg *config.Config, username string, password string) error {
+	minLength := DefaultPasswordMinLength
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
+	if cfg != nil && cfg.ServerConfig.PasswordMinLength > 0 {
+		minLength = cfg.ServerConfig.PasswordMinLength
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < minLength {
+		return ErrPasswordTooShort
+	}
+	if length > PasswordMaxLength {
+		return ErrPasswordTooLong
+	}
+
+	lowered := strings.ToLower(password)
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return ErrPasswordContainsUsername
+	}
+	if commonPasswords[lowered] {
+		return ErrPasswordTooCommon
+	}
+
+	return nil
+}
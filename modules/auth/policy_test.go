@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePassword(t *testing.T) {
+	assert.Nil(t, ValidatePassword(nil, "loganga", "correct horse battery staple"))
+	assert.Nil(t, ValidatePassword(nil, "loganga", "密码密码密码密码"), "length should be counted in characters")
+
+	assert.Equal(t, ErrPasswordTooShort, ValidatePassword(nil, "loganga", "short"))
+	assert.Equal(t, ErrPasswordTooLong, ValidatePassword(nil, "loganga", strings.Repeat("a", PasswordMaxLength+1)))
+	assert.Equal(t, ErrPasswordContainsUsername, ValidatePassword(nil, "loganga", "my name is LoganGA"))
+	assert.Equal(t, ErrPasswordTooCommon, ValidatePassword(nil, "loganga", "Password1"))
+
+	serverCfg := &config.Config{}
+	serverCfg.ServerConfig.PasswordMinLength = 40
+	assert.Equal(t, ErrPasswordTooShort, ValidatePassword(serverCfg, "loganga", "correct horse battery staple"),
+		"the server's minimum length should be used")
+}
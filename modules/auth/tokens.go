@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+/**
+ * Single-use tokens, such as those used for email verification and password resets.
+ */
+
+const tokenBytes = 32
+
+// NewToken generates a random token to give to the user, and the hash of it to store.
+// Only the hash should ever be persisted, so that a database leak does not leak usable tokens.
+func NewToken() (token string, hash string, err error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(raw)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash under which the given token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
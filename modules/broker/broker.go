@@ -0,0 +1,81 @@
+package broker
+
+import (
+	"errors"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * The pub/sub layer that websockets send and receive messages through. The datahandling closures publish
+ * rabbitmq.AMQPMessages, with the same routing keys, whichever broker is in use.
+ */
+
+// Broker runs the publisher and subscriber for each websocket, and binds routing keys to websocket queues
+type Broker interface {
+	rabbitmq.QueueBinder
+	// RunPublisher publishes the messages sent on cfg.PubCfg.Messages, until cfg.Control is shut down
+	RunPublisher(cfg *rabbitmq.AMQPPubSubCfg) error
+	// RunSubscriber passes the messages for the websocket's queue to cfg.SubCfg.HandleMessageFunc, until cfg.Control
+	// is shut down
+	RunSubscriber(cfg *rabbitmq.AMQPPubSubCfg) error
+}
+
+// ErrUnknownBroker is returned when the configured broker is not supported
+var ErrUnknownBroker = errors.New("Unknown message broker")
+
+// Connect sets up the broker selected by ServerConfig.Broker, using the connection config of the same name; "Memory"
+// selects the in-process MemoryBroker, which is also used if no broker or RabbitMQ connection is configured. The
+// broker is shut down when control exits.
+func Connect(cfg *config.Config, control *utils.Control) (Broker, error) {
+	brokerName := cfg.ServerConfig.Broker
+	if brokerName == "" {
+		brokerName = "RabbitMQ"
+		if cfg.ConnectionConfig["RabbitMQ"].Host == "" {
+			utils.LogWarn("No RabbitMQ connection configured; using the in-process broker", nil)
+			brokerName = "Memory"
+		}
+	}
+
+	switch brokerName {
+	case "Memory":
+		control.Ready.Done()
+		return NewMemoryBroker(), nil
+	case "RabbitMQ":
+		rabbitTLSConfig, err := cfg.ConnectionConfig["RabbitMQ"].TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		// RabbitMQ uses "Exchanges" as containers for Queues, and ours is initialized here.
+		err = rabbitmq.SetupRabbitExchange(
+			&rabbitmq.AMQPConnCfg{
+				ConnCfg:   cfg.ConnectionConfig["RabbitMQ"],
+				TLSConfig: rabbitTLSConfig,
+				Exchanges: []rabbitmq.AMQPExchCfg{
+					{
+						ExchangeName: cfg.ServerConfig.Name,
+						Durable:      true,
+					},
+				},
+				Control: control,
+			},
+		)
+		return rabbitmq.RabbitBroker{}, err
+	case "NATS":
+		nats, err := NewNATSBroker(cfg.ConnectionConfig["NATS"])
+		if err != nil {
+			return nil, err
+		}
+		control.Ready.Done()
+		go func() {
+			<-control.Exit
+			nats.Close()
+		}()
+		return nats, nil
+	default:
+		return nil, ErrUnknownBroker
+	}
+}
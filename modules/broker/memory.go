@@ -0,0 +1,226 @@
+package broker
+
+import (
+	"errors"
+	"expvar"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+// memoryQueueBuffer is the number of messages buffered for each websocket
+const memoryQueueBuffer = 256
+
+var memoryMetrics = expvar.NewMap("memorybroker")
+
+// MemoryBroker routes messages between the websockets of this process, without an external broker; it suits
+// single-server deployments, development and tests. Bindings are matched like a RabbitMQ topic exchange.
+//
+// Bindings are indexed by their first word (such as "Project-12"), so publishing only checks the queues bound to the
+// message's project, user or websocket.
+type MemoryBroker struct {
+	mutex  sync.RWMutex
+	queues map[string]*memoryQueue
+	// Queues bound to keys starting with each word; wildcard first words are indexed under "*" or "#"
+	index map[string]map[*memoryQueue]bool
+}
+
+type memoryQueue struct {
+	name     string
+	messages chan rabbitmq.AMQPMessage
+	bindings map[string]bool // Guarded by the broker's mutex
+}
+
+// NewMemoryBroker creates a MemoryBroker with no queues
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues: make(map[string]*memoryQueue),
+		index:  make(map[string]map[*memoryQueue]bool),
+	}
+}
+
+func firstWord(key string) string {
+	if i := strings.IndexByte(key, '.'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// topicMatch reports whether the routing key matches the binding, where "*" matches one word and "#" zero or more
+func topicMatch(binding []string, key []string) bool {
+	if len(binding) == 0 {
+		return len(key) == 0
+	}
+	if binding[0] == "#" {
+		for i := 0; i <= len(key); i++ {
+			if topicMatch(binding[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(key) == 0 || (binding[0] != "*" && binding[0] != key[0]) {
+		return false
+	}
+	return topicMatch(binding[1:], key[1:])
+}
+
+// RunSubscriber binds the websocket's queue name and configured keys, and passes routed messages to the handler.
+func (b *MemoryBroker) RunSubscriber(cfg *rabbitmq.AMQPPubSubCfg) error {
+	defer func() {
+		cfg.Control.Shutdown()
+	}()
+
+	q := &memoryQueue{
+		name:     cfg.SubCfg.QueueName(),
+		messages: make(chan rabbitmq.AMQPMessage, memoryQueueBuffer),
+		bindings: make(map[string]bool),
+	}
+	b.mutex.Lock()
+	b.queues[q.name] = q
+	b.mutex.Unlock()
+	defer b.removeQueue(q)
+
+	for _, key := range append(cfg.SubCfg.Keys, q.name) {
+		if err := b.BindQueue(q.name, key, cfg.ExchangeName); err != nil {
+			return err
+		}
+	}
+
+	// Signal that this Subscriber is ready
+	cfg.Control.Ready.Done()
+	for {
+		select {
+		case <-cfg.Control.Exit:
+			return nil
+		case msg := <-q.messages:
+			err := cfg.SubCfg.HandleMessageFunc(msg)
+			utils.LogError("Message handler failed", err, nil)
+		}
+	}
+}
+
+func (b *MemoryBroker) removeQueue(q *memoryQueue) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.queues[q.name] == q {
+		delete(b.queues, q.name)
+	}
+	for key := range q.bindings {
+		b.unindex(q, key)
+	}
+}
+
+func (b *MemoryBroker) unindex(q *memoryQueue, key string) {
+	delete(q.bindings, key)
+	word := firstWord(key)
+	// Other bindings may share the first word
+	for other := range q.bindings {
+		if firstWord(other) == word {
+			return
+		}
+	}
+	delete(b.index[word], q)
+	if len(b.index[word]) == 0 {
+		delete(b.index, word)
+	}
+}
+
+// BindQueue binds the key to the queue; the exchange name is ignored, since there is only one exchange
+func (b *MemoryBroker) BindQueue(queueName, key, exchangeName string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return errUnknownQueue
+	}
+	q.bindings[key] = true
+	word := firstWord(key)
+	if b.index[word] == nil {
+		b.index[word] = make(map[*memoryQueue]bool)
+	}
+	b.index[word][q] = true
+	return nil
+}
+
+// UnbindQueue unbinds the key from the queue
+func (b *MemoryBroker) UnbindQueue(queueName, key, exchangeName string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return errUnknownQueue
+	}
+	if q.bindings[key] {
+		b.unindex(q, key)
+	}
+	return nil
+}
+
+// RunPublisher routes the websocket's messages to the queues bound to them.
+func (b *MemoryBroker) RunPublisher(cfg *rabbitmq.AMQPPubSubCfg) error {
+	defer func() {
+		cfg.Control.Shutdown()
+	}()
+
+	// Signal that this Publisher is ready
+	cfg.Control.Ready.Done()
+	for {
+		select {
+		case <-cfg.Control.Exit:
+			return nil
+		case message := <-cfg.PubCfg.Messages:
+			b.publish(message)
+			if message.Published != nil {
+				message.Published()
+			}
+		}
+	}
+}
+
+// publish delivers the message once to each queue with a matching binding. Queues that are not keeping up miss the
+// message, as they would with NATS.
+func (b *MemoryBroker) publish(message rabbitmq.AMQPMessage) {
+	key := strings.Split(message.RoutingKey, ".")
+
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	// A queue may be indexed under both the key's first word and a wildcard
+	matched := make(map[*memoryQueue]bool)
+	for _, word := range []string{key[0], "*", "#"} {
+		for q := range b.index[word] {
+			if !matched[q] && q.matches(key) {
+				matched[q] = true
+			}
+		}
+	}
+
+	for q := range matched {
+		select {
+		case q.messages <- message:
+			memoryMetrics.Add("Published", 1)
+		default:
+			memoryMetrics.Add("Dropped", 1)
+			utils.LogError("Subscriber is not keeping up; dropping message", errors.New("Queue buffer full"), utils.LogFields{
+				"Queue":      q.name,
+				"RoutingKey": message.RoutingKey,
+			})
+		}
+	}
+}
+
+// matches reports whether any of the queue's bindings match the key
+func (q *memoryQueue) matches(key []string) bool {
+	for binding := range q.bindings {
+		if topicMatch(strings.Split(binding, "."), key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package broker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		binding string
+		key     string
+		match   bool
+	}{
+		{"Project-1.#", "Project-1.File-2.File.Change", true},
+		{"Project-1.#", "Project-1", true},
+		{"Project-1.#", "Project-10.Project.Project.Rename", false},
+		{"Project-1.*.File.Change", "Project-1.File-2.File.Change", true},
+		{"Project-1.*.File.Change", "Project-1.File-2.File.Rename", false},
+		{"Project-1.Project.#", "Project-1.File-2.File.Change", false},
+		{"#.Change", "Project-1.File-2.File.Change", true},
+		{"User-a", "User-a", true},
+		{"User-a", "User-a.b", false},
+	}
+	for _, test := range tests {
+		match := topicMatch(strings.Split(test.binding, "."), strings.Split(test.key, "."))
+		assert.Equal(t, test.match, match, "binding %s, key %s", test.binding, test.key)
+	}
+}
+
+// runMemorySubscriber starts a publisher and subscriber for a websocket, returning its queue name, the channel its
+// messages are published on and the channel they are received on.
+func runMemorySubscriber(b *MemoryBroker, queueID uint64) (string, chan rabbitmq.AMQPMessage, chan rabbitmq.AMQPMessage, *utils.Control) {
+	received := make(chan rabbitmq.AMQPMessage, 10)
+	pubCfg := rabbitmq.NewPubConfig(nil, 10)
+	subCfg := &rabbitmq.AMQPSubCfg{
+		QueueID: queueID,
+		HandleMessageFunc: func(msg rabbitmq.AMQPMessage) error {
+			received <- msg
+			return nil
+		},
+	}
+	cfg := rabbitmq.NewAMQPPubSubCfg("CodeCollaborate", pubCfg, subCfg)
+	go b.RunPublisher(cfg)
+	go b.RunSubscriber(cfg)
+	cfg.Control.Ready.Wait()
+	return subCfg.QueueName(), pubCfg.Messages, received, cfg.Control
+}
+
+func TestMemoryBroker(t *testing.T) {
+	b := NewMemoryBroker()
+	queueOne, publish, receivedOne, controlOne := runMemorySubscriber(b, 1)
+	defer controlOne.Shutdown()
+	queueTwo, _, receivedTwo, controlTwo := runMemorySubscriber(b, 2)
+	defer controlTwo.Shutdown()
+
+	expectMessage := func(received chan rabbitmq.AMQPMessage, body string) {
+		select {
+		case msg := <-received:
+			assert.Equal(t, body, string(msg.Message))
+		case <-time.After(time.Second):
+			t.Fatalf("Message %q was not received", body)
+		}
+	}
+	expectNoMessage := func(received chan rabbitmq.AMQPMessage) {
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message %q", msg.Message)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// Messages to a websocket's own queue only go to that websocket
+	publish <- rabbitmq.AMQPMessage{RoutingKey: queueTwo, Message: []byte("direct")}
+	expectMessage(receivedTwo, "direct")
+	expectNoMessage(receivedOne)
+
+	// Project notifications fan out to every subscribed websocket, once each
+	require.NoError(t, b.BindQueue(queueOne, "Project-1.#", "CodeCollaborate"))
+	require.NoError(t, b.BindQueue(queueOne, "#.Change", "CodeCollaborate"))
+	require.NoError(t, b.BindQueue(queueTwo, "Project-1.*.File.Change", "CodeCollaborate"))
+	publish <- rabbitmq.AMQPMessage{RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 2, "File", "Change"), Message: []byte("change")}
+	expectMessage(receivedOne, "change")
+	expectMessage(receivedTwo, "change")
+	expectNoMessage(receivedOne)
+
+	publish <- rabbitmq.AMQPMessage{RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 0, "Project", "Rename"), Message: []byte("rename")}
+	expectMessage(receivedOne, "rename")
+	expectNoMessage(receivedTwo)
+
+	require.NoError(t, b.UnbindQueue(queueOne, "Project-1.#", "CodeCollaborate"))
+	require.NoError(t, b.UnbindQueue(queueOne, "#.Change", "CodeCollaborate"))
+	publish <- rabbitmq.AMQPMessage{RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 2, "File", "Change"), Message: []byte("unbound")}
+	expectMessage(receivedTwo, "unbound")
+	expectNoMessage(receivedOne)
+
+	// Bindings are removed when the subscriber exits
+	controlTwo.Shutdown()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, errUnknownQueue, b.BindQueue(queueTwo, "Project-1.#", "CodeCollaborate"))
+	b.mutex.RLock()
+	assert.Len(t, b.index["Project-1"], 0)
+	b.mutex.RUnlock()
+}
+
+func TestConnectMemoryBroker(t *testing.T) {
+	cfg := &config.Config{
+		ConnectionConfig: config.ConnCfgMap{},
+	}
+	b, err := Connect(cfg, utils.NewControl(1))
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryBroker{}, b)
+}
@@ -0,0 +1,345 @@
+package broker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * NATS broker, for small deployments that don't want to operate RabbitMQ.
+ *
+ * Routing keys are mapped to subjects under the exchange name; a trailing "#" in a binding becomes ">", so bindings
+ * must only use "#" as their last word. NATS delivers messages at most once: messages for websockets that are not
+ * keeping up are dropped, and nothing is kept for websockets that are offline.
+ */
+
+// natsQueueBuffer is the number of received messages buffered for each websocket
+const natsQueueBuffer = 256
+
+// natsDedupWindow is the number of recent message IDs remembered by each websocket, so that messages matching
+// several of its bindings are only handled once
+const natsDedupWindow = 64
+
+var natsMetrics = expvar.NewMap("nats")
+
+var errUnknownQueue = errors.New("No subscriber is running for the queue")
+var errUnsupportedBinding = errors.New("NATS: \"#\" is only supported as the last word of a binding")
+
+// natsEnvelope carries an AMQPMessage, with its headers, as a NATS payload
+type natsEnvelope struct {
+	ID          string
+	Headers     map[string]interface{}
+	ContentType int
+	Persistent  bool
+	Message     []byte
+}
+
+var envelopeIDPrefix = func() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}()
+var envelopeIDCounter uint64
+
+func newEnvelopeID() string {
+	return fmt.Sprintf("%s-%d", envelopeIDPrefix, atomic.AddUint64(&envelopeIDCounter, 1))
+}
+
+// natsSubject maps a routing key to a subject under the exchange. If binding is set, "*" and a trailing "#" are kept
+// as wildcards; all other characters that NATS does not allow in subjects are escaped.
+func natsSubject(exchangeName string, key string, binding bool) (string, error) {
+	words := strings.Split(key, ".")
+	tokens := []string{escapeNATSToken(exchangeName, true)}
+	for i, word := range words {
+		switch {
+		case binding && word == "*":
+			tokens = append(tokens, "*")
+		case binding && word == "#":
+			if i != len(words)-1 {
+				return "", errUnsupportedBinding
+			}
+			tokens = append(tokens, ">")
+		default:
+			tokens = append(tokens, escapeNATSToken(word, false))
+		}
+	}
+	return strings.Join(tokens, "."), nil
+}
+
+// escapeNATSToken percent-encodes whitespace, control characters, wildcards and "%" (and "." if escapeDots is set).
+// Empty tokens, which NATS does not allow, become "%".
+func escapeNATSToken(token string, escapeDots bool) string {
+	if token == "" {
+		return "%"
+	}
+	var escaped bytes.Buffer
+	for i := 0; i < len(token); i++ {
+		b := token[i]
+		if b <= ' ' || b == 0x7f || b == '*' || b == '>' || b == '%' || (escapeDots && b == '.') {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		} else {
+			escaped.WriteByte(b)
+		}
+	}
+	return escaped.String()
+}
+
+// NATSBroker publishes and receives messages through a NATS server. Each websocket queue is a set of subscriptions,
+// one for each of its bindings.
+type NATSBroker struct {
+	conn   *natsConn
+	mutex  sync.Mutex
+	queues map[string]*natsQueue
+}
+
+// NewNATSBroker connects to the NATS server described by the connection config
+func NewNATSBroker(connCfg config.ConnCfg) (*NATSBroker, error) {
+	conn, err := dialNATS(connCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSBroker{
+		conn:   conn,
+		queues: make(map[string]*natsQueue),
+	}, nil
+}
+
+// Close disconnects from the server
+func (b *NATSBroker) Close() {
+	b.conn.close()
+}
+
+type natsQueue struct {
+	name     string
+	group    string // Queue group for work queues, so that each message is handled once
+	messages chan rabbitmq.AMQPMessage
+
+	mutex    sync.Mutex
+	bindings map[string]uint64 // Subscription IDs, keyed on routing key
+	recent   [natsDedupWindow]string
+	next     int
+}
+
+// deliver decodes the message, and queues it for the subscriber unless it has already been received
+func (q *natsQueue) deliver(subject string, payload []byte) {
+	var envelope natsEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		utils.LogError("Failed to decode NATS message", err, utils.LogFields{
+			"Subject": subject,
+		})
+		return
+	}
+
+	q.mutex.Lock()
+	for _, id := range q.recent {
+		if id == envelope.ID {
+			q.mutex.Unlock()
+			return
+		}
+	}
+	q.recent[q.next] = envelope.ID
+	q.next = (q.next + 1) % natsDedupWindow
+	q.mutex.Unlock()
+
+	msg := rabbitmq.AMQPMessage{
+		Headers:     envelope.Headers,
+		RoutingKey:  subject,
+		ContentType: envelope.ContentType,
+		Persistent:  envelope.Persistent,
+		Message:     envelope.Message,
+	}
+	select {
+	case q.messages <- msg:
+	default:
+		natsMetrics.Add("Dropped", 1)
+		utils.LogError("NATS subscriber is not keeping up; dropping message", errors.New("Queue buffer full"), utils.LogFields{
+			"Queue":   q.name,
+			"Subject": subject,
+		})
+	}
+}
+
+// RunSubscriber subscribes to the websocket's queue name and configured keys, and passes received messages to the
+// handler.
+func (b *NATSBroker) RunSubscriber(cfg *rabbitmq.AMQPPubSubCfg) error {
+	defer func() {
+		cfg.Control.Shutdown()
+	}()
+
+	q := &natsQueue{
+		name:     cfg.SubCfg.QueueName(),
+		messages: make(chan rabbitmq.AMQPMessage, natsQueueBuffer),
+		bindings: make(map[string]uint64),
+	}
+	if cfg.SubCfg.IsWorkQueue {
+		q.group = escapeNATSToken(q.name, true)
+	}
+
+	b.mutex.Lock()
+	b.queues[q.name] = q
+	b.mutex.Unlock()
+	defer b.removeQueue(q)
+
+	for _, key := range append(cfg.SubCfg.Keys, q.name) {
+		if err := b.BindQueue(q.name, key, cfg.ExchangeName); err != nil {
+			return err
+		}
+	}
+
+	// Signal that this Subscriber is ready
+	cfg.Control.Ready.Done()
+	for {
+		select {
+		case <-cfg.Control.Exit:
+			return nil
+		case msg := <-q.messages:
+			err := cfg.SubCfg.HandleMessageFunc(msg)
+			utils.LogError("Message handler failed", err, nil)
+		}
+	}
+}
+
+func (b *NATSBroker) removeQueue(q *natsQueue) {
+	b.mutex.Lock()
+	if b.queues[q.name] == q {
+		delete(b.queues, q.name)
+	}
+	b.mutex.Unlock()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for key, sid := range q.bindings {
+		b.conn.unsubscribe(sid)
+		delete(q.bindings, key)
+	}
+}
+
+func (b *NATSBroker) queue(queueName string) (*natsQueue, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil, errUnknownQueue
+	}
+	return q, nil
+}
+
+// BindQueue subscribes the queue to the key; binding a key twice has no effect
+func (b *NATSBroker) BindQueue(queueName, key, exchangeName string) error {
+	q, err := b.queue(queueName)
+	if err != nil {
+		return err
+	}
+	subject, err := natsSubject(exchangeName, key, true)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, ok := q.bindings[key]; ok {
+		return nil
+	}
+	sid, err := b.conn.subscribe(subject, q.group, q.deliver)
+	if err != nil {
+		b.conn.unsubscribe(sid)
+		return err
+	}
+	q.bindings[key] = sid
+	return nil
+}
+
+// UnbindQueue unsubscribes the queue from the key
+func (b *NATSBroker) UnbindQueue(queueName, key, exchangeName string) error {
+	q, err := b.queue(queueName)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	sid, ok := q.bindings[key]
+	if !ok {
+		return nil
+	}
+	delete(q.bindings, key)
+	return b.conn.unsubscribe(sid)
+}
+
+// RunPublisher publishes the websocket's messages, retrying while disconnected. Messages that still cannot be
+// published are dead-lettered, and passed to the PubErrHandler.
+func (b *NATSBroker) RunPublisher(cfg *rabbitmq.AMQPPubSubCfg) error {
+	defer func() {
+		cfg.Control.Shutdown()
+	}()
+
+	// Signal that this Publisher is ready
+	cfg.Control.Ready.Done()
+	for {
+		select {
+		case <-cfg.Control.Exit:
+			return nil
+		case message := <-cfg.PubCfg.Messages:
+			err := b.publish(cfg.ExchangeName, message, cfg.Control.Exit)
+			if err != nil {
+				rabbitmq.RecordDeadLetter(message, err)
+				if cfg.PubCfg.PubErrHandler != nil {
+					cfg.PubCfg.PubErrHandler(message)
+				}
+			} else if message.Published != nil {
+				message.Published()
+			}
+		}
+	}
+}
+
+func (b *NATSBroker) publish(exchangeName string, message rabbitmq.AMQPMessage, exit <-chan bool) error {
+	subject, err := natsSubject(exchangeName, message.RoutingKey, false)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(natsEnvelope{
+		ID:          newEnvelopeID(),
+		Headers:     message.Headers,
+		ContentType: message.ContentType,
+		Persistent:  message.Persistent,
+		Message:     message.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= rabbitmq.PublishMaxRetries; attempt++ {
+		if attempt > 0 {
+			natsMetrics.Add("Retried", 1)
+			select {
+			case <-time.After(rabbitmq.PublishBackoff(attempt)):
+			case <-exit:
+				return err
+			}
+		}
+
+		err = b.conn.publish(subject, payload)
+		if err == nil {
+			natsMetrics.Add("Published", 1)
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,251 @@
+package broker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNATSServer implements enough of the NATS protocol to route messages between subscriptions
+type fakeNATSServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	conns    map[net.Conn]bool
+	subs     map[net.Conn]map[string]string // Subjects, keyed on connection and subscription ID
+}
+
+func newFakeNATSServer(t *testing.T) *fakeNATSServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeNATSServer{
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+		subs:     make(map[net.Conn]map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNATSServer) connCfg() config.ConnCfg {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.ConnCfg{
+		Host:    addr.IP.String(),
+		Port:    uint16(addr.Port),
+		Timeout: 1,
+	}
+}
+
+func (s *fakeNATSServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func (s *fakeNATSServer) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeNATSServer) serve(conn net.Conn) {
+	s.mutex.Lock()
+	s.conns[conn] = true
+	s.subs[conn] = make(map[string]string)
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		delete(s.subs, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	fmt.Fprint(conn, "INFO {}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		s.mutex.Lock()
+		switch fields[0] {
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "SUB":
+			s.subs[conn][fields[len(fields)-1]] = fields[1]
+		case "UNSUB":
+			delete(s.subs[conn], fields[1])
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			s.mutex.Unlock()
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.mutex.Lock()
+			for subConn, subs := range s.subs {
+				for sid, subject := range subs {
+					if fakeNATSMatch(subject, fields[1]) {
+						fmt.Fprintf(subConn, "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+					}
+				}
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func fakeNATSMatch(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for i, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) || (token != "*" && token != subjectTokens[i]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+func TestNATSSubject(t *testing.T) {
+	subject, err := natsSubject("CodeCollaborate", "Project-12.File-34.File.Change", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "CodeCollaborate.Project-12.File-34.File.Change", subject)
+
+	subject, err = natsSubject("CodeCollaborate", "Project-12.*.File.#", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "CodeCollaborate.Project-12.*.File.>", subject)
+
+	// Wildcards are only kept in bindings
+	subject, err = natsSubject("Code.Collaborate", "User-a *>%.#", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Code%2ECollaborate.User-a%20%2A%3E%25.#", subject)
+
+	_, err = natsSubject("CodeCollaborate", "Project-12.#.Change", true)
+	assert.Equal(t, errUnsupportedBinding, err)
+}
+
+func TestNATSBroker(t *testing.T) {
+	server := newFakeNATSServer(t)
+	defer server.close()
+	defer func(delay time.Duration) { natsReconnectDelay = delay }(natsReconnectDelay)
+	natsReconnectDelay = 10 * time.Millisecond
+
+	b, err := NewNATSBroker(server.connCfg())
+	require.NoError(t, err)
+	defer b.Close()
+
+	received := make(chan rabbitmq.AMQPMessage, 10)
+	pubCfg := rabbitmq.NewPubConfig(nil, 10)
+	subCfg := &rabbitmq.AMQPSubCfg{
+		QueueID: 1,
+		HandleMessageFunc: func(msg rabbitmq.AMQPMessage) error {
+			received <- msg
+			return nil
+		},
+	}
+	cfg := rabbitmq.NewAMQPPubSubCfg("CodeCollaborate", pubCfg, subCfg)
+	go b.RunPublisher(cfg)
+	go b.RunSubscriber(cfg)
+	cfg.Control.Ready.Wait()
+	defer cfg.Control.Shutdown()
+
+	expectMessage := func(body string) {
+		select {
+		case msg := <-received:
+			assert.Equal(t, body, string(msg.Message))
+		case <-time.After(time.Second):
+			t.Fatalf("Message %q was not received", body)
+		}
+	}
+	expectNoMessage := func() {
+		select {
+		case msg := <-received:
+			t.Fatalf("Unexpected message %q", msg.Message)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// Messages to the websocket's own queue
+	pubCfg.Messages <- rabbitmq.AMQPMessage{
+		Headers:     map[string]interface{}{"Origin": "test"},
+		RoutingKey:  subCfg.QueueName(),
+		ContentType: rabbitmq.ContentTypeMsg,
+		Message:     []byte("direct"),
+	}
+	select {
+	case msg := <-received:
+		assert.Equal(t, "direct", string(msg.Message))
+		assert.Equal(t, "test", msg.Headers["Origin"])
+		assert.Equal(t, rabbitmq.ContentTypeMsg, msg.ContentType)
+	case <-time.After(time.Second):
+		t.Fatal("Message to the websocket's queue was not received")
+	}
+
+	// Overlapping bindings only deliver each message once
+	require.NoError(t, b.BindQueue(subCfg.QueueName(), "Project-1.#", "CodeCollaborate"))
+	require.NoError(t, b.BindQueue(subCfg.QueueName(), "Project-1.*.File.Change", "CodeCollaborate"))
+	pubCfg.Messages <- rabbitmq.AMQPMessage{
+		RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 2, "File", "Change"),
+		Message:    []byte("change"),
+	}
+	expectMessage("change")
+	expectNoMessage()
+
+	// Subscriptions are restored after reconnecting
+	server.dropConnections()
+	time.Sleep(200 * time.Millisecond)
+	pubCfg.Messages <- rabbitmq.AMQPMessage{
+		RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 0, "Project", "Rename"),
+		Message:    []byte("rename"),
+	}
+	expectMessage("rename")
+
+	require.NoError(t, b.UnbindQueue(subCfg.QueueName(), "Project-1.#", "CodeCollaborate"))
+	require.NoError(t, b.UnbindQueue(subCfg.QueueName(), "Project-1.*.File.Change", "CodeCollaborate"))
+	pubCfg.Messages <- rabbitmq.AMQPMessage{
+		RoutingKey: rabbitmq.RabbitProjectRoutingKey(1, 2, "File", "Change"),
+		Message:    []byte("ignored"),
+	}
+	expectNoMessage()
+
+	assert.Equal(t, errUnknownQueue, b.BindQueue("WS-unknown", "Project-1.#", "CodeCollaborate"))
+}
+
+func TestConnectUnknownBroker(t *testing.T) {
+	cfg := &config.Config{
+		ServerConfig: config.ServerCfg{Broker: "Kafka"},
+	}
+	_, err := Connect(cfg, utils.NewControl(1))
+	assert.Equal(t, ErrUnknownBroker, err)
+}
@@ -0,0 +1,345 @@
+package broker
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * A minimal client for the NATS text protocol (https://docs.nats.io/reference/reference-protocols/nats-protocol);
+ * just enough to publish and subscribe. Subscriptions are restored after reconnecting.
+ */
+
+// natsReconnectDelay is the delay before the first reconnection attempt; it grows with each failed attempt, up to
+// maxNATSReconnectDelay
+var natsReconnectDelay = time.Second
+
+const maxNATSReconnectDelay = 30 * time.Second
+
+var errNATSDisconnected = errors.New("NATS: not connected")
+
+type natsSubscription struct {
+	subject string
+	queue   string // Queue group, if any; each message is delivered to one member of the group
+	handler func(subject string, payload []byte)
+}
+
+type natsConn struct {
+	connCfg config.ConnCfg
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	writer  *bufio.Writer // nil while disconnected
+	subs    map[uint64]*natsSubscription
+	nextSID uint64
+	closed  bool
+}
+
+// dialNATS connects to the server described by the connection config, retrying up to NumRetries times
+func dialNATS(connCfg config.ConnCfg) (*natsConn, error) {
+	c := &natsConn{
+		connCfg: connCfg,
+		subs:    make(map[uint64]*natsSubscription),
+	}
+
+	var reader *bufio.Reader
+	var err error
+	for retry := uint16(0); retry <= connCfg.NumRetries; retry++ {
+		reader, err = c.connect()
+		if err == nil {
+			go c.readLoop(reader)
+			return c, nil
+		}
+		utils.LogError("Failed to connect to NATS", err, utils.LogFields{
+			"Host": connCfg.Host,
+			"Port": connCfg.Port,
+		})
+		c.connCfg.InvalidatePassword()
+		time.Sleep(reconnectDelay(int(retry) + 1))
+	}
+	return nil, err
+}
+
+func reconnectDelay(attempt int) time.Duration {
+	delay := time.Duration(attempt) * natsReconnectDelay
+	if delay > maxNATSReconnectDelay {
+		return maxNATSReconnectDelay
+	}
+	return delay
+}
+
+// connect dials the server and performs the handshake, then resends all subscriptions. The returned reader must be
+// passed to readLoop.
+func (c *natsConn) connect() (*bufio.Reader, error) {
+	timeout := time.Duration(c.connCfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	port := c.connCfg.Port
+	if port == 0 {
+		port = 4222
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.connCfg.Host, strconv.Itoa(int(port))), timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	reader := bufio.NewReader(conn)
+	line, err := readNATSLine(reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("NATS: expected INFO, got %q", line)
+	}
+
+	if c.connCfg.UseTLS {
+		tlsConfig, err := c.connCfg.TLSConfig()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = c.connCfg.Host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	password, err := c.connCfg.ResolvePassword()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	connect, err := json.Marshal(map[string]interface{}{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": c.connCfg.UseTLS,
+		"user":         c.connCfg.Username,
+		"pass":         password,
+		"name":         "CodeCollaborate",
+		"lang":         "go",
+		"version":      "1.0",
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "CONNECT %s\r\nPING\r\n", connect)
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The server answers the PING once it has accepted the connection
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if line == "PONG" {
+			break
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return nil, fmt.Errorf("NATS: %s", line)
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return nil, errNATSDisconnected
+	}
+	for sid, sub := range c.subs {
+		writeSub(writer, sid, sub)
+	}
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.conn = conn
+	c.writer = writer
+	return reader, nil
+}
+
+// readLoop dispatches messages to subscriptions until the connection fails, then reconnects.
+func (c *natsConn) readLoop(reader *bufio.Reader) {
+	for {
+		err := c.read(reader)
+
+		c.mutex.Lock()
+		closed := c.closed
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.conn = nil
+		c.writer = nil
+		c.mutex.Unlock()
+		if closed {
+			return
+		}
+		utils.LogError("Lost connection to NATS; reconnecting", err, nil)
+
+		for attempt := 1; ; attempt++ {
+			time.Sleep(reconnectDelay(attempt))
+			reader, err = c.connect()
+			if err == nil {
+				break
+			}
+			if err == errNATSDisconnected {
+				return
+			}
+			utils.LogError("Failed to reconnect to NATS", err, utils.LogFields{
+				"Attempt": attempt,
+			})
+			c.connCfg.InvalidatePassword()
+		}
+	}
+}
+
+func (c *natsConn) read(reader *bufio.Reader) error {
+	for {
+		line, err := readNATSLine(reader)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 || len(fields) > 5 {
+				return fmt.Errorf("NATS: malformed message %q", line)
+			}
+			sid, err := strconv.ParseUint(fields[2], 10, 64)
+			if err != nil {
+				return err
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return err
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return err
+			}
+
+			c.mutex.Lock()
+			sub := c.subs[sid]
+			c.mutex.Unlock()
+			if sub != nil {
+				sub.handler(fields[1], payload[:size])
+			}
+		case line == "PING":
+			c.write("PONG\r\n", nil)
+		case strings.HasPrefix(line, "-ERR"):
+			utils.LogError("NATS server error", errors.New(line), nil)
+		}
+	}
+}
+
+func readNATSLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeSub(writer *bufio.Writer, sid uint64, sub *natsSubscription) {
+	if sub.queue != "" {
+		fmt.Fprintf(writer, "SUB %s %s %d\r\n", sub.subject, sub.queue, sid)
+	} else {
+		fmt.Fprintf(writer, "SUB %s %d\r\n", sub.subject, sid)
+	}
+}
+
+// write sends a protocol line, and payload if it is not nil
+func (c *natsConn) write(line string, payload []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.writer == nil {
+		return errNATSDisconnected
+	}
+	c.writer.WriteString(line)
+	if payload != nil {
+		c.writer.Write(payload)
+		c.writer.WriteString("\r\n")
+	}
+	return c.writer.Flush()
+}
+
+func (c *natsConn) publish(subject string, payload []byte) error {
+	return c.write(fmt.Sprintf("PUB %s %d\r\n", subject, len(payload)), payload)
+}
+
+// subscribe registers the handler for messages on the subject. The subscription is kept, and sent once reconnected,
+// if the connection is down.
+func (c *natsConn) subscribe(subject string, queue string, handler func(subject string, payload []byte)) (uint64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextSID++
+	sid := c.nextSID
+	sub := &natsSubscription{
+		subject: subject,
+		queue:   queue,
+		handler: handler,
+	}
+	c.subs[sid] = sub
+
+	if c.writer == nil {
+		return sid, nil
+	}
+	writeSub(c.writer, sid, sub)
+	return sid, c.writer.Flush()
+}
+
+func (c *natsConn) unsubscribe(sid uint64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.subs, sid)
+	if c.writer == nil {
+		return nil
+	}
+	fmt.Fprintf(c.writer, "UNSUB %d\r\n", sid)
+	return c.writer.Flush()
+}
+
+func (c *natsConn) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
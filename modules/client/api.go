@@ -0,0 +1,1609 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+/**
+ * Typed methods for each Resource.Method of the protocol. The fields of each request type match those of the server's
+ * request, which a test in the datahandling package checks, so that the two stay in sync.
+ */
+
+// Requests maps each "Resource.Method" to the type of its request's data
+var Requests = map[string]interface{}{
+	"Admin.SetProjectQuota":          AdminSetProjectQuotaRequest{},
+	"Admin.GetProjectUsage":          AdminGetProjectUsageRequest{},
+	"Admin.CheckIntegrity":           struct{}{},
+	"Admin.GetIntegrityReport":       struct{}{},
+	"Admin.GetAuditLog":              AdminGetAuditLogRequest{},
+	"Admin.UnlockLogin":              AdminUnlockLoginRequest{},
+	"Admin.ListInstances":            struct{}{},
+	"Admin.DrainInstance":            AdminDrainInstanceRequest{},
+	"Admin.SetMaintenance":           AdminSetMaintenanceRequest{},
+	"Admin.Announce":                 AdminAnnounceRequest{},
+	"Admin.GetLatencyReport":         struct{}{},
+	"Admin.GetUser":                  AdminGetUserRequest{},
+	"Admin.DeleteUser":               AdminDeleteUserRequest{},
+	"Admin.GetProject":               AdminGetProjectRequest{},
+	"Admin.GetQuotaReport":           AdminGetQuotaReportRequest{},
+	"Admin.ScrunchFile":              AdminScrunchFileRequest{},
+	"Comment.Create":                 CommentCreateRequest{},
+	"Comment.Reply":                  CommentReplyRequest{},
+	"Comment.Resolve":                CommentResolveRequest{},
+	"Comment.React":                  CommentReactRequest{},
+	"Comment.List":                   CommentListRequest{},
+	"File.Create":                    FileCreateRequest{},
+	"File.Rename":                    FileRenameRequest{},
+	"File.Move":                      FileMoveRequest{},
+	"File.Delete":                    FileDeleteRequest{},
+	"File.Change":                    FileChangeRequest{},
+	"File.Pull":                      FilePullRequest{},
+	"File.GetHistory":                FileGetHistoryRequest{},
+	"File.Annotate":                  FileAnnotateRequest{},
+	"File.Diff":                      FileDiffRequest{},
+	"File.Search":                    FileSearchRequest{},
+	"File.SetMetadata":               FileSetMetadataRequest{},
+	"File.GetMetadata":               FileGetMetadataRequest{},
+	"Notification.Ack":               NotificationAckRequest{},
+	"Notification.GetAcks":           NotificationGetAcksRequest{},
+	"Project.Create":                 ProjectCreateRequest{},
+	"Project.Rename":                 ProjectRenameRequest{},
+	"Project.GetPermissionConstants": struct{}{},
+	"Project.ListRoles":              struct{}{},
+	"Project.Search":                 ProjectSearchRequest{},
+	"Project.GrantPermissions":       ProjectGrantPermissionsRequest{},
+	"Project.RevokePermissions":      ProjectRevokePermissionsRequest{},
+	"Project.GetOnlineClients":       ProjectGetOnlineClientsRequest{},
+	"Project.Lookup":                 ProjectLookupRequest{},
+	"Project.GetFiles":               ProjectGetFilesRequest{},
+	"Project.ImportFromGit":          ProjectImportFromGitRequest{},
+	"Project.Subscribe":              ProjectSubscribeRequest{},
+	"Project.Unsubscribe":            ProjectUnsubscribeRequest{},
+	"Project.Delete":                 ProjectDeleteRequest{},
+	"Project.Archive":                ProjectArchiveRequest{},
+	"Project.Unarchive":              ProjectUnarchiveRequest{},
+	"Project.SetLineEndings":         ProjectSetLineEndingsRequest{},
+	"Project.SetIgnoreRules":         ProjectSetIgnoreRulesRequest{},
+	"Project.GetIgnoreRules":         ProjectGetIgnoreRulesRequest{},
+	"Project.GetSettings":            ProjectGetSettingsRequest{},
+	"Project.UpdateSettings":         ProjectUpdateSettingsRequest{},
+	"Project.GetNotificationsSince":  ProjectGetNotificationsSinceRequest{},
+	"Project.Sync":                   ProjectSyncRequest{},
+	"Session.Resume":                 SessionResumeRequest{},
+	"Team.Create":                    TeamCreateRequest{},
+	"Team.AddMember":                 TeamAddMemberRequest{},
+	"Team.GrantProjectAccess":        TeamGrantProjectAccessRequest{},
+	"User.Register":                  UserRegisterRequest{},
+	"User.Login":                     UserLoginRequest{},
+	"User.LoginExternal":             UserLoginExternalRequest{},
+	"User.VerifyEmail":               UserVerifyEmailRequest{},
+	"User.RequestEmailVerification":  struct{}{},
+	"User.RequestPasswordReset":      UserRequestPasswordResetRequest{},
+	"User.ConfirmReset":              UserConfirmResetRequest{},
+	"User.CreateAPIToken":            UserCreateAPITokenRequest{},
+	"User.RevokeAPIToken":            UserRevokeAPITokenRequest{},
+	"User.ListSessions":              struct{}{},
+	"User.RevokeSession":             UserRevokeSessionRequest{},
+	"User.Delete":                    struct{}{},
+	"User.ExportData":                struct{}{},
+	"User.Lookup":                    UserLookupRequest{},
+	"User.Search":                    UserSearchRequest{},
+	"User.SetUnlisted":               UserSetUnlistedRequest{},
+	"User.UpdateProfile":             UserUpdateProfileRequest{},
+	"User.ChangeUsername":            UserChangeUsernameRequest{},
+	"User.SetAvatar":                 UserSetAvatarRequest{},
+	"User.GetAvatar":                 UserGetAvatarRequest{},
+	"User.Projects":                  UserProjectsRequest{},
+	"User.GetNotificationPrefs":      struct{}{},
+	"User.SetNotificationPrefs":      NotificationPrefs{},
+}
+
+// idempotentMethods are the requests the server deduplicates by idempotency key
+var idempotentMethods = map[string]bool{
+	"File.Create":           true,
+	"File.Change":           true,
+	"Project.Create":        true,
+	"Project.ImportFromGit": true,
+	"Team.Create":           true,
+}
+
+/**
+ * Results
+ */
+
+// File is a file in a project, as returned by Project.GetFiles
+type File struct {
+	FileID       int64
+	Filename     string
+	Creator      string
+	CreationDate time.Time
+	RelativePath string
+	Version      int64
+	Metadata     map[string]string
+	ContentHash  string // The SHA-256 of the file's text at Version, if the server has recorded it; see ContentHash
+}
+
+// Project is a project and the permissions granted on it
+type Project struct {
+	ProjectID   int64
+	Name        string
+	Permissions map[string]ProjectPermission
+	Archive     string // "archiving", "archived" or "unarchiving"; empty for live projects
+}
+
+// ProjectPermission is a user's permission on a project
+type ProjectPermission struct {
+	Username        string
+	PermissionLevel int8
+	GrantedBy       string
+	GrantedDate     time.Time
+}
+
+// Role is a project role, and what it allows
+type Role struct {
+	Name         string
+	Level        int8
+	Capabilities []string
+}
+
+// User is a user's profile
+type User struct {
+	Username      string
+	Email         string
+	FirstName     string
+	LastName      string
+	EmailVerified bool
+	Unlisted      bool   // Whether the user is hidden from UserSearch, other than by their exact username
+	AvatarHash    string // The SHA-256 of the user's avatar, which changes whenever it does; "" if they have none
+}
+
+// SearchMatch is a line matching a search
+type SearchMatch struct {
+	FileID  int64
+	Path    string
+	Line    int // 1-based
+	Snippet string
+}
+
+// ProjectUsage is a project's storage usage and quota
+type ProjectUsage struct {
+	UsedBytes  int64
+	QuotaBytes int64 // 0 if unlimited
+	Override   bool  // Whether QuotaBytes was set with AdminSetProjectQuota, rather than being the default
+}
+
+// ProjectQuota is a project's storage usage and quota, in a quota report
+type ProjectQuota struct {
+	ProjectID int64
+	Name      string
+	Owner     string
+	ProjectUsage
+}
+
+// ProjectAccess is a user's permission on one of the projects they have access to
+type ProjectAccess struct {
+	ProjectID       int64
+	Name            string
+	PermissionLevel int8
+}
+
+// AdminUser is a user's account, as server admins see it
+type AdminUser struct {
+	User      User
+	Aliases   []string // The usernames the user changed from, oldest first
+	Projects  []ProjectAccess
+	UsedBytes int64 // The total size of the files the user created
+}
+
+// AdminProject is a project, as server admins see it
+type AdminProject struct {
+	Project
+	Files []File // Without their Version, Metadata or ContentHash
+	ProjectUsage
+}
+
+// AuditEntry is an entry of the audit log
+type AuditEntry struct {
+	AuditID    int64
+	Time       time.Time
+	Event      string // The request's "Resource.Method"
+	Actor      string // The authenticated sender; empty for requests made without a session, such as logins
+	RemoteAddr string // The IP address the request came from, if known
+	ProjectID  int64  // 0 if the request is not about a project
+	Status     int    // The status of the request's response
+	Details    string // The request's data, as JSON, with passwords and tokens redacted
+}
+
+// Instance is a server in the instance registry
+type Instance struct {
+	InstanceID    string
+	Name          string
+	Host          string
+	Version       string
+	StartedAt     time.Time
+	LastHeartbeat time.Time
+	Connections   int    // The number of open WebSocket connections
+	Draining      bool   // Whether the server has been asked to stop accepting new connections
+	Health        string // "ok", "draining" or "unresponsive"
+	Self          bool   // Whether this is the server the client is connected to
+}
+
+// IntegrityReport is the outcome of checking the files on disk
+type IntegrityReport struct {
+	Started      time.Time
+	Finished     time.Time
+	FilesChecked int
+	Missing      []int64
+	Corrupt      []int64
+	Repaired     []int64
+}
+
+// LatencyReport is the latency of the File.Change requests a server received within its objective's window, from
+// receiving each change to publishing its notification. Latencies are in milliseconds.
+type LatencyReport struct {
+	Window               string
+	Changes              int
+	P50                  float64
+	P95                  float64
+	P99                  float64
+	Max                  float64
+	Threshold            string
+	Target               float64 // The fraction of changes that should take at most Threshold
+	WithinThreshold      float64
+	Met                  bool
+	ErrorBudgetRemaining float64 // Negative once the objective has been missed
+}
+
+// ProjectSettings are a project's settings
+type ProjectSettings struct {
+	LineEndings string   // "LF" or "Preserve"
+	IgnoreRules []string // In the format of a .ccignore file, one rule per element
+	QuotaBytes  int64    // The project's storage quota override; 0 if the server's default applies
+	DefaultRole string   // The role ProjectGrantPermissions grants if none is given; "" if one must be given
+}
+
+// APIToken is a newly created API token; the token itself is only ever returned once
+type APIToken struct {
+	TokenID int64
+	Token   string
+}
+
+// UserSession is a connection the user has made authenticated requests on
+type UserSession struct {
+	SessionID   string
+	Device      string // The User-Agent the connection was opened with, if any
+	RemoteAddr  string
+	InstanceID  string // The server the connection is on
+	ConnectedAt int64  // Seconds since the Unix epoch
+	LastActive  int64  // Seconds since the Unix epoch
+	Current     bool   // Whether this is the client's own connection
+}
+
+// SessionResumeResult is the session a connection is in, and the subscriptions resumed into it
+type SessionResumeResult struct {
+	SessionID string
+	Resumed   []string
+}
+
+// FileChangeResult is the outcome of a change, as transformed against the changes it had not seen
+type FileChangeResult struct {
+	FileVersion    int64
+	Changes        string
+	MissingPatches []string
+	LineEndings    string // "CRLF" if Changes and MissingPatches were converted to CRLF line endings
+	Coalesced      bool   // The change was composed with later ones; the last of their results has the patch appended
+}
+
+// PatchAuthorship is who made a stored patch, and when
+type PatchAuthorship struct {
+	FileVersion int64 // The version of the file the patch made
+	Author      string
+	ClientID    string
+	Timestamp   int64 // Seconds since the Unix epoch; 0 if not recorded
+}
+
+// FilePullResult is a file's contents, and the changes not yet applied to them; if materialized, the file's text, with
+// no changes
+type FilePullResult struct {
+	FileBytes   []byte
+	Changes     []string
+	Authorship  []PatchAuthorship // Who made each of Changes
+	LineEndings string            // "CRLF" if FileBytes and Changes were converted to CRLF line endings
+	Version     int64             // The version once Changes are applied; 0 if not materialized and without a ContentHash
+	ContentHash string            // The SHA-256 of the file's text at Version, before any conversion to CRLF
+}
+
+// FileDiffResult is a patch from one version of a file to another
+type FileDiffResult struct {
+	FromVersion int64
+	ToVersion   int64
+	Changes     string
+	LineEndings string // "CRLF" if Changes was converted to CRLF line endings
+}
+
+// FileResyncRequired is the data of File.ResyncRequired notifications, sent once several of the connection's changes
+// to a file have been rejected for being made against stale versions
+type FileResyncRequired struct {
+	FileVersion int64  // The file's current version
+	FromVersion int64  // The version the last rejected change was made against; 0 if Changes is empty
+	Changes     string // The patch from FromVersion to FileVersion; empty if the file must be pulled
+	LineEndings string // "CRLF" if Changes was converted to CRLF line endings
+}
+
+// Comment is a comment on a file; the first comment of each thread is anchored to a range of the file's text
+type Comment struct {
+	CommentID  int64
+	ThreadID   int64 // The CommentID of the thread's first comment
+	FileID     int64
+	Author     string
+	Body       string
+	Created    time.Time
+	Version    int64  // The version of the file the anchor is in; 0 for replies
+	Start      int    // The offset of the start of the anchored range, in characters
+	End        int    // The offset of the end of the anchored range, exclusive
+	Outdated   bool   // Whether the anchor could no longer be carried forward to the file's current version
+	ResolvedBy string // Who resolved the thread; empty if it is open
+}
+
+// CommentReaction is a user's reaction to a comment
+type CommentReaction struct {
+	CommentID int64
+	Username  string
+	Reaction  string
+}
+
+// CommentListResult is the comments on a file, and the reactions to them
+type CommentListResult struct {
+	Comments  []Comment
+	Reactions []CommentReaction // By comment, in the order they were made
+}
+
+// NotificationAck is the last of a project's notifications a user has seen
+type NotificationAck struct {
+	Username string
+	Sequence int64
+	Acked    time.Time
+}
+
+// FileHistory is the patches kept since a file was last scrunched, and who made them
+type FileHistory struct {
+	FileVersion int64
+	Changes     []string
+	Authorship  []PatchAuthorship // Who made each of Changes
+}
+
+/**
+ * Admin
+ */
+
+// AdminSetProjectQuotaRequest is the data of Admin.SetProjectQuota
+type AdminSetProjectQuotaRequest struct {
+	ProjectID  int64
+	QuotaBytes int64 // 0 removes the override, so that the project uses the default quota
+}
+
+// AdminSetProjectQuota sets a project's storage quota
+func (client *Client) AdminSetProjectQuota(req AdminSetProjectQuotaRequest) error {
+	return client.call("Admin", "SetProjectQuota", req, nil)
+}
+
+// AdminGetProjectUsageRequest is the data of Admin.GetProjectUsage
+type AdminGetProjectUsageRequest struct {
+	ProjectID int64
+}
+
+// AdminGetProjectUsage returns a project's storage usage and quota
+func (client *Client) AdminGetProjectUsage(req AdminGetProjectUsageRequest) (ProjectUsage, error) {
+	var usage ProjectUsage
+	err := client.call("Admin", "GetProjectUsage", req, &usage)
+	return usage, err
+}
+
+// AdminCheckIntegrity checks every file on disk, returning the report once it finishes
+func (client *Client) AdminCheckIntegrity() (IntegrityReport, error) {
+	var report IntegrityReport
+	err := client.call("Admin", "CheckIntegrity", nil, &report)
+	return report, err
+}
+
+// AdminGetIntegrityReport returns the report of the last integrity check
+func (client *Client) AdminGetIntegrityReport() (IntegrityReport, error) {
+	var report IntegrityReport
+	err := client.call("Admin", "GetIntegrityReport", nil, &report)
+	return report, err
+}
+
+// AdminGetAuditLogRequest is the data of Admin.GetAuditLog
+type AdminGetAuditLogRequest struct {
+	Since        int64  // Seconds since the Unix epoch, inclusive
+	Until        int64  // Seconds since the Unix epoch, exclusive; 0 for now
+	AfterAuditID int64  // The AuditID of the last entry of the previous page
+	Event        string // A "Resource.Method", such as "User.Login"; empty for every event
+	Actor        string // Empty for every actor
+	Limit        int    // At most 1000; 0 for 1000
+}
+
+// AdminGetAuditLog returns the entries of the audit log matching the request, oldest first
+func (client *Client) AdminGetAuditLog(req AdminGetAuditLogRequest) ([]AuditEntry, error) {
+	var data struct {
+		Entries []AuditEntry
+	}
+	err := client.call("Admin", "GetAuditLog", req, &data)
+	return data.Entries, err
+}
+
+// AdminUnlockLoginRequest is the data of Admin.UnlockLogin; at least one field must be set
+type AdminUnlockLoginRequest struct {
+	Username   string
+	RemoteAddr string // An IP address
+}
+
+// AdminUnlockLogin clears the failed logins of an account or address on the server the client is connected to,
+// returning whether there were any
+func (client *Client) AdminUnlockLogin(req AdminUnlockLoginRequest) (bool, error) {
+	var data struct {
+		Cleared bool
+	}
+	err := client.call("Admin", "UnlockLogin", req, &data)
+	return data.Cleared, err
+}
+
+// AdminListInstances returns the servers in the instance registry
+func (client *Client) AdminListInstances() ([]Instance, error) {
+	var data struct {
+		Instances []Instance
+	}
+	err := client.call("Admin", "ListInstances", nil, &data)
+	return data.Instances, err
+}
+
+// AdminDrainInstanceRequest is the data of Admin.DrainInstance
+type AdminDrainInstanceRequest struct {
+	InstanceID string
+	Draining   bool // false to accept new connections again
+}
+
+// AdminDrainInstance asks a server to stop accepting new connections, or to accept them again. Servers other than the
+// one the client is connected to take up to their heartbeat interval to notice.
+func (client *Client) AdminDrainInstance(req AdminDrainInstanceRequest) error {
+	return client.call("Admin", "DrainInstance", req, nil)
+}
+
+// AdminSetMaintenanceRequest is the data of Admin.SetMaintenance
+type AdminSetMaintenanceRequest struct {
+	Enabled bool
+	Message string // Shown to users while maintenance mode is enabled
+}
+
+// AdminSetMaintenance puts every server into maintenance mode, in which requests that change anything fail with
+// status 503, or takes them out of it. Connected clients are sent a Server.Maintenance notification; servers other
+// than the one the client is connected to take up to their heartbeat interval to apply it.
+func (client *Client) AdminSetMaintenance(req AdminSetMaintenanceRequest) error {
+	return client.call("Admin", "SetMaintenance", req, nil)
+}
+
+// AdminAnnounceRequest is the data of Admin.Announce
+type AdminAnnounceRequest struct {
+	Message    string
+	Level      string  // "info" (the default) or "warning"
+	ProjectIDs []int64 // The projects whose subscribers are sent the announcement; if empty, every connected client is
+}
+
+// AdminAnnounce sends a Server.Announcement notification to every connected client, or to the subscribers of the given
+// projects
+func (client *Client) AdminAnnounce(req AdminAnnounceRequest) error {
+	return client.call("Admin", "Announce", req, nil)
+}
+
+// AdminGetLatencyReport returns the keystroke latency of the server the client is connected to
+func (client *Client) AdminGetLatencyReport() (LatencyReport, error) {
+	var report LatencyReport
+	err := client.call("Admin", "GetLatencyReport", nil, &report)
+	return report, err
+}
+
+// AdminGetUserRequest is the data of Admin.GetUser
+type AdminGetUserRequest struct {
+	Username string
+}
+
+// AdminGetUser returns a user's account, former usernames, projects and storage usage
+func (client *Client) AdminGetUser(req AdminGetUserRequest) (AdminUser, error) {
+	var user AdminUser
+	err := client.call("Admin", "GetUser", req, &user)
+	return user, err
+}
+
+// AdminDeleteUserRequest is the data of Admin.DeleteUser
+type AdminDeleteUserRequest struct {
+	Username string
+}
+
+// AdminDeleteUser deletes a user's account and the projects they own, as UserDelete would if they called it
+func (client *Client) AdminDeleteUser(req AdminDeleteUserRequest) error {
+	return client.call("Admin", "DeleteUser", req, nil)
+}
+
+// AdminGetProjectRequest is the data of Admin.GetProject
+type AdminGetProjectRequest struct {
+	ProjectID int64
+}
+
+// AdminGetProject returns a project's permissions, files and storage usage, whether or not the client's user has
+// access to it
+func (client *Client) AdminGetProject(req AdminGetProjectRequest) (AdminProject, error) {
+	var project AdminProject
+	err := client.call("Admin", "GetProject", req, &project)
+	return project, err
+}
+
+// AdminGetQuotaReportRequest is the data of Admin.GetQuotaReport
+type AdminGetQuotaReportRequest struct {
+	Limit int // At most 1000; 0 for 1000
+}
+
+// AdminGetQuotaReport returns the projects using the most storage, most first, with their quotas
+func (client *Client) AdminGetQuotaReport(req AdminGetQuotaReportRequest) ([]ProjectQuota, error) {
+	var data struct {
+		Projects []ProjectQuota
+	}
+	err := client.call("Admin", "GetQuotaReport", req, &data)
+	return data.Projects, err
+}
+
+// AdminScrunchFileRequest is the data of Admin.ScrunchFile
+type AdminScrunchFileRequest struct {
+	FileID int64
+}
+
+// AdminScrunchFile scrunches a file's changes into its contents, returning once it has been scrunched
+func (client *Client) AdminScrunchFile(req AdminScrunchFileRequest) error {
+	return client.call("Admin", "ScrunchFile", req, nil)
+}
+
+/**
+ * Comment
+ */
+
+// CommentCreateRequest is the data of Comment.Create
+type CommentCreateRequest struct {
+	FileID  int64
+	Version int64 // The version of the file Start and End are offsets into
+	Start   int
+	End     int // Exclusive
+	Body    string
+}
+
+// CommentCreate starts a comment thread on a range of a file, returning its first comment
+func (client *Client) CommentCreate(req CommentCreateRequest) (Comment, error) {
+	var data struct {
+		Comment Comment
+	}
+	err := client.call("Comment", "Create", req, &data)
+	return data.Comment, err
+}
+
+// CommentReplyRequest is the data of Comment.Reply
+type CommentReplyRequest struct {
+	CommentID int64 // Any comment in the thread
+	Body      string
+}
+
+// CommentReply adds a comment to a thread
+func (client *Client) CommentReply(req CommentReplyRequest) (Comment, error) {
+	var data struct {
+		Comment Comment
+	}
+	err := client.call("Comment", "Reply", req, &data)
+	return data.Comment, err
+}
+
+// CommentResolveRequest is the data of Comment.Resolve
+type CommentResolveRequest struct {
+	CommentID int64 // Any comment in the thread
+	Reopen    bool  // Reopens the thread instead
+}
+
+// CommentResolve resolves or reopens a thread, returning its first comment
+func (client *Client) CommentResolve(req CommentResolveRequest) (Comment, error) {
+	var data struct {
+		Comment Comment
+	}
+	err := client.call("Comment", "Resolve", req, &data)
+	return data.Comment, err
+}
+
+// CommentListRequest is the data of Comment.List
+type CommentListRequest struct {
+	FileID int64
+}
+
+// CommentList returns every comment on a file, in the order they were made, with anchors at the file's current version,
+// and the reactions to them
+func (client *Client) CommentList(req CommentListRequest) (CommentListResult, error) {
+	var data CommentListResult
+	err := client.call("Comment", "List", req, &data)
+	return data, err
+}
+
+// CommentReactRequest is the data of Comment.React
+type CommentReactRequest struct {
+	CommentID int64
+	Reaction  string // Usually an emoji; at most 16 characters
+	Remove    bool   // Removes the reaction instead
+}
+
+// CommentReact adds a reaction to a comment, or removes it, returning every reaction to the comment
+func (client *Client) CommentReact(req CommentReactRequest) ([]CommentReaction, error) {
+	var data struct {
+		Reactions []CommentReaction
+	}
+	err := client.call("Comment", "React", req, &data)
+	return data.Reactions, err
+}
+
+/**
+ * File
+ */
+
+// FileCreateRequest is the data of File.Create
+type FileCreateRequest struct {
+	Name         string
+	RelativePath string
+	ProjectID    int64
+	FileBytes    []byte
+	LineEndings  string // "CRLF" if FileBytes has CRLF line endings
+}
+
+// FileCreate creates a file, returning its ID
+func (client *Client) FileCreate(req FileCreateRequest) (int64, error) {
+	var data struct {
+		FileID int64
+	}
+	err := client.call("File", "Create", req, &data)
+	return data.FileID, err
+}
+
+// FileRenameRequest is the data of File.Rename
+type FileRenameRequest struct {
+	FileID  int64
+	NewName string
+}
+
+// FileRename renames a file
+func (client *Client) FileRename(req FileRenameRequest) error {
+	return client.call("File", "Rename", req, nil)
+}
+
+// FileMoveRequest is the data of File.Move
+type FileMoveRequest struct {
+	FileID  int64
+	NewPath string
+}
+
+// FileMove moves a file to another directory of its project
+func (client *Client) FileMove(req FileMoveRequest) error {
+	return client.call("File", "Move", req, nil)
+}
+
+// FileDeleteRequest is the data of File.Delete
+type FileDeleteRequest struct {
+	FileID int64
+}
+
+// FileDelete deletes a file
+func (client *Client) FileDelete(req FileDeleteRequest) error {
+	return client.call("File", "Delete", req, nil)
+}
+
+// FileChangeRequest is the data of File.Change
+type FileChangeRequest struct {
+	FileID      int64
+	Changes     string // The ClientID of the patch's metadata is kept; its author and timestamp are set by the server
+	LineEndings string // "CRLF" if Changes was made against the file's text with CRLF line endings
+	Coalesce    bool   // Whether the server may compose the change with the ones sent after it, within its batching window
+}
+
+// FileChange applies a patch to a file
+func (client *Client) FileChange(req FileChangeRequest) (FileChangeResult, error) {
+	var result FileChangeResult
+	err := client.call("File", "Change", req, &result)
+	return result, err
+}
+
+// FilePullRequest is the data of File.Pull
+type FilePullRequest struct {
+	FileID      int64
+	LineEndings string // "CRLF" to have the contents and changes converted to CRLF line endings
+	Materialize bool   // Have the server apply the changes, returning the file's text
+}
+
+// FilePull returns a file's contents, and the changes made since they were written
+func (client *Client) FilePull(req FilePullRequest) (FilePullResult, error) {
+	var result FilePullResult
+	err := client.call("File", "Pull", req, &result)
+	return result, err
+}
+
+// FileGetHistoryRequest is the data of File.GetHistory
+type FileGetHistoryRequest struct {
+	FileID int64
+}
+
+// FileGetHistory returns the patches kept for a file, and who made them
+func (client *Client) FileGetHistory(req FileGetHistoryRequest) (FileHistory, error) {
+	var result FileHistory
+	err := client.call("File", "GetHistory", req, &result)
+	return result, err
+}
+
+// FileAnnotateRequest is the data of File.Annotate
+type FileAnnotateRequest struct {
+	FileID int64
+}
+
+// FileAnnotate returns who last changed each line of a file; lines unchanged since the file was last scrunched have
+// no authorship
+func (client *Client) FileAnnotate(req FileAnnotateRequest) ([]PatchAuthorship, error) {
+	var data struct {
+		Lines []PatchAuthorship
+	}
+	err := client.call("File", "Annotate", req, &data)
+	return data.Lines, err
+}
+
+// FileDiffRequest is the data of File.Diff
+type FileDiffRequest struct {
+	FileID      int64
+	FromVersion int64
+	ToVersion   int64  // 0 for the file's current version
+	LineEndings string // "CRLF" to have the patch converted to CRLF line endings
+}
+
+// FileDiff returns a single patch from one version of a file to another. It fails with a StatusError of status 409 if
+// the file has been scrunched since FromVersion.
+func (client *Client) FileDiff(req FileDiffRequest) (FileDiffResult, error) {
+	var result FileDiffResult
+	err := client.call("File", "Diff", req, &result)
+	return result, err
+}
+
+// FileSearchRequest is the data of File.Search
+type FileSearchRequest struct {
+	FileID     int64
+	Query      string
+	MaxResults int
+}
+
+// FileSearch searches a file's contents
+func (client *Client) FileSearch(req FileSearchRequest) ([]SearchMatch, error) {
+	var data struct {
+		Matches []SearchMatch
+	}
+	err := client.call("File", "Search", req, &data)
+	return data.Matches, err
+}
+
+// FileSetMetadataRequest is the data of File.SetMetadata
+type FileSetMetadataRequest struct {
+	FileID   int64
+	Metadata map[string]string // Keys to set; keys with empty values are removed
+}
+
+// FileSetMetadata updates a file's metadata, returning all of it
+func (client *Client) FileSetMetadata(req FileSetMetadataRequest) (map[string]string, error) {
+	var data struct {
+		Metadata map[string]string
+	}
+	err := client.call("File", "SetMetadata", req, &data)
+	return data.Metadata, err
+}
+
+// FileGetMetadataRequest is the data of File.GetMetadata
+type FileGetMetadataRequest struct {
+	FileID int64
+}
+
+// FileGetMetadata returns a file's metadata
+func (client *Client) FileGetMetadata(req FileGetMetadataRequest) (map[string]string, error) {
+	var data struct {
+		Metadata map[string]string
+	}
+	err := client.call("File", "GetMetadata", req, &data)
+	return data.Metadata, err
+}
+
+/**
+ * Notification
+ */
+
+// NotificationAckRequest is the data of Notification.Ack
+type NotificationAckRequest struct {
+	ProjectID int64
+	Sequence  int64 // The Sequence of the last of the project's notifications the user has seen
+}
+
+// NotificationAck records that the user has seen a project's notifications up to a sequence number, and tells the
+// project's other subscribers
+func (client *Client) NotificationAck(req NotificationAckRequest) error {
+	return client.call("Notification", "Ack", req, nil)
+}
+
+// NotificationGetAcksRequest is the data of Notification.GetAcks
+type NotificationGetAcksRequest struct {
+	ProjectID int64
+}
+
+// NotificationGetAcks returns the last of a project's notifications each user has seen
+func (client *Client) NotificationGetAcks(req NotificationGetAcksRequest) ([]NotificationAck, error) {
+	var data struct {
+		Acks []NotificationAck
+	}
+	err := client.call("Notification", "GetAcks", req, &data)
+	return data.Acks, err
+}
+
+/**
+ * Project
+ */
+
+// ProjectCreateRequest is the data of Project.Create
+type ProjectCreateRequest struct {
+	Name string
+}
+
+// ProjectCreate creates a project, returning its ID
+func (client *Client) ProjectCreate(req ProjectCreateRequest) (int64, error) {
+	var data struct {
+		ProjectID int64
+	}
+	err := client.call("Project", "Create", req, &data)
+	return data.ProjectID, err
+}
+
+// ProjectRenameRequest is the data of Project.Rename
+type ProjectRenameRequest struct {
+	ProjectID int64
+	NewName   string
+}
+
+// ProjectRenameResult is the project's name before and after it was renamed
+type ProjectRenameResult struct {
+	ProjectID int64
+	OldName   string
+	NewName   string
+}
+
+// ProjectRename renames a project
+func (client *Client) ProjectRename(req ProjectRenameRequest) (ProjectRenameResult, error) {
+	var data ProjectRenameResult
+	err := client.call("Project", "Rename", req, &data)
+	return data, err
+}
+
+// ProjectGetPermissionConstants returns the permission levels, by name
+func (client *Client) ProjectGetPermissionConstants() (map[string]int8, error) {
+	var data struct {
+		Constants map[string]int8
+	}
+	err := client.call("Project", "GetPermissionConstants", nil, &data)
+	return data.Constants, err
+}
+
+// ProjectListRoles returns the project roles, from least to most privileged
+func (client *Client) ProjectListRoles() ([]Role, error) {
+	var data struct {
+		Roles []Role
+	}
+	err := client.call("Project", "ListRoles", nil, &data)
+	return data.Roles, err
+}
+
+// ProjectSearchRequest is the data of Project.Search
+type ProjectSearchRequest struct {
+	ProjectID  int64
+	Query      string
+	MaxResults int
+}
+
+// ProjectSearch searches the contents of a project's files
+func (client *Client) ProjectSearch(req ProjectSearchRequest) ([]SearchMatch, error) {
+	var data struct {
+		Matches []SearchMatch
+	}
+	err := client.call("Project", "Search", req, &data)
+	return data.Matches, err
+}
+
+// ProjectGrantPermissionsRequest is the data of Project.GrantPermissions
+type ProjectGrantPermissionsRequest struct {
+	ProjectID       int64
+	GrantUsername   string
+	Role            string
+	PermissionLevel int8 // Deprecated: use Role
+}
+
+// ProjectGrantPermissions gives a user a role on a project
+func (client *Client) ProjectGrantPermissions(req ProjectGrantPermissionsRequest) error {
+	return client.call("Project", "GrantPermissions", req, nil)
+}
+
+// ProjectRevokePermissionsRequest is the data of Project.RevokePermissions
+type ProjectRevokePermissionsRequest struct {
+	ProjectID      int64
+	RevokeUsername string
+}
+
+// ProjectRevokePermissions removes a user's role on a project
+func (client *Client) ProjectRevokePermissions(req ProjectRevokePermissionsRequest) error {
+	return client.call("Project", "RevokePermissions", req, nil)
+}
+
+// ProjectGetOnlineClientsRequest is the data of Project.GetOnlineClients
+type ProjectGetOnlineClientsRequest struct {
+	ProjectID int64
+}
+
+// ProjectGetOnlineClients is not yet implemented by the server, and always fails
+func (client *Client) ProjectGetOnlineClients(req ProjectGetOnlineClientsRequest) error {
+	return client.call("Project", "GetOnlineClients", req, nil)
+}
+
+// ProjectLookupRequest is the data of Project.Lookup
+type ProjectLookupRequest struct {
+	ProjectIDs []int64
+}
+
+// ProjectLookup returns the projects with the given IDs that the user may view
+func (client *Client) ProjectLookup(req ProjectLookupRequest) ([]Project, error) {
+	var data struct {
+		Projects []Project
+	}
+	err := client.call("Project", "Lookup", req, &data)
+	return data.Projects, err
+}
+
+// ProjectGetFilesRequest is the data of Project.GetFiles
+type ProjectGetFilesRequest struct {
+	ProjectID int64
+	Offset    int    // The number of files to skip
+	Limit     int    // The number of files to return, at most 1000; 0 returns every file after Offset
+	Directory string // Only files in this directory, or its subdirectories, are returned
+	Glob      string // Only files whose names match are returned. '*' matches any characters, and '?' matches one
+}
+
+// ProjectGetFiles returns a project's files
+func (client *Client) ProjectGetFiles(req ProjectGetFilesRequest) ([]File, error) {
+	files, _, err := client.ProjectGetFilesPage(req)
+	return files, err
+}
+
+// ProjectGetFilesPage returns a page of a project's files, and the number of files in the project
+func (client *Client) ProjectGetFilesPage(req ProjectGetFilesRequest) ([]File, int, error) {
+	var data struct {
+		Files []File
+		Total int
+	}
+	err := client.call("Project", "GetFiles", req, &data)
+	return data.Files, data.Total, err
+}
+
+// ProjectImportFromGitRequest is the data of Project.ImportFromGit
+type ProjectImportFromGitRequest struct {
+	ProjectID int64
+	URL       string
+	Branch    string // Optional; defaults to the repository's default branch
+}
+
+// ProjectImportFromGit starts importing a Git repository into a project. Its progress is sent to the project's
+// subscribers as notifications.
+func (client *Client) ProjectImportFromGit(req ProjectImportFromGitRequest) error {
+	return client.call("Project", "ImportFromGit", req, nil)
+}
+
+// ProjectSubscribeRequest is the data of Project.Subscribe
+type ProjectSubscribeRequest struct {
+	ProjectID int64
+	Events    []string // Optional; "Resource.Method" or "Resource.*". Only these notifications are received
+	FileIDs   []int64  // Optional; only notifications about these files, or the whole project, are received
+}
+
+// ProjectSubscribe subscribes to a project's notifications. The subscription is restored if the client reconnects.
+func (client *Client) ProjectSubscribe(req ProjectSubscribeRequest) error {
+	if err := client.call("Project", "Subscribe", req, nil); err != nil {
+		return err
+	}
+	client.mutex.Lock()
+	client.subscriptions[req.ProjectID] = req
+	client.mutex.Unlock()
+	return nil
+}
+
+// ProjectUnsubscribeRequest is the data of Project.Unsubscribe
+type ProjectUnsubscribeRequest struct {
+	ProjectID int64
+}
+
+// ProjectUnsubscribe stops the notifications of a project
+func (client *Client) ProjectUnsubscribe(req ProjectUnsubscribeRequest) error {
+	client.mutex.Lock()
+	delete(client.subscriptions, req.ProjectID)
+	client.mutex.Unlock()
+	return client.call("Project", "Unsubscribe", req, nil)
+}
+
+// ProjectDeleteRequest is the data of Project.Delete
+type ProjectDeleteRequest struct {
+	ProjectID int64
+}
+
+// ProjectDelete deletes a project and its files
+func (client *Client) ProjectDelete(req ProjectDeleteRequest) error {
+	if err := client.call("Project", "Delete", req, nil); err != nil {
+		return err
+	}
+	client.mutex.Lock()
+	delete(client.subscriptions, req.ProjectID)
+	client.mutex.Unlock()
+	return nil
+}
+
+// ProjectArchiveRequest is the data of Project.Archive
+type ProjectArchiveRequest struct {
+	ProjectID int64
+}
+
+// ProjectArchive makes a project read-only, and moves its files to cold storage. Until it is unarchived, requests for
+// its files fail with a StatusError of status 423.
+func (client *Client) ProjectArchive(req ProjectArchiveRequest) error {
+	return client.call("Project", "Archive", req, nil)
+}
+
+// ProjectUnarchiveRequest is the data of Project.Unarchive
+type ProjectUnarchiveRequest struct {
+	ProjectID int64
+}
+
+// ProjectUnarchive moves an archived project's files back from cold storage, and makes it writable again
+func (client *Client) ProjectUnarchive(req ProjectUnarchiveRequest) error {
+	return client.call("Project", "Unarchive", req, nil)
+}
+
+// ProjectSetLineEndingsRequest is the data of Project.SetLineEndings
+type ProjectSetLineEndingsRequest struct {
+	ProjectID   int64
+	LineEndings string // "LF" to store files with LF line endings, or "Preserve" to store them as written
+}
+
+// ProjectSetLineEndings sets the line endings the project's files are stored with
+func (client *Client) ProjectSetLineEndings(req ProjectSetLineEndingsRequest) error {
+	return client.call("Project", "SetLineEndings", req, nil)
+}
+
+// ProjectSetIgnoreRulesRequest is the data of Project.SetIgnoreRules
+type ProjectSetIgnoreRulesRequest struct {
+	ProjectID int64
+	Rules     []string // In the format of a .ccignore file, one rule per element; empty removes the rules
+}
+
+// ProjectSetIgnoreRules replaces the rules for files that are kept out of the project
+func (client *Client) ProjectSetIgnoreRules(req ProjectSetIgnoreRulesRequest) error {
+	return client.call("Project", "SetIgnoreRules", req, nil)
+}
+
+// ProjectGetIgnoreRulesRequest is the data of Project.GetIgnoreRules
+type ProjectGetIgnoreRulesRequest struct {
+	ProjectID int64
+}
+
+// ProjectGetIgnoreRules returns the rules for files that are kept out of the project
+func (client *Client) ProjectGetIgnoreRules(req ProjectGetIgnoreRulesRequest) ([]string, error) {
+	var data struct {
+		Rules []string
+	}
+	err := client.call("Project", "GetIgnoreRules", req, &data)
+	return data.Rules, err
+}
+
+// ProjectGetSettingsRequest is the data of Project.GetSettings
+type ProjectGetSettingsRequest struct {
+	ProjectID int64
+}
+
+// ProjectGetSettings returns the project's settings
+func (client *Client) ProjectGetSettings(req ProjectGetSettingsRequest) (ProjectSettings, error) {
+	var settings ProjectSettings
+	err := client.call("Project", "GetSettings", req, &settings)
+	return settings, err
+}
+
+// ProjectUpdateSettingsRequest is the data of Project.UpdateSettings. Settings left nil are unchanged.
+type ProjectUpdateSettingsRequest struct {
+	ProjectID   int64
+	LineEndings *string
+	IgnoreRules *[]string
+	QuotaBytes  *int64 // Server admins only; 0 removes the override
+	DefaultRole *string
+}
+
+// ProjectUpdateSettings changes the project's settings, returning every one of them
+func (client *Client) ProjectUpdateSettings(req ProjectUpdateSettingsRequest) (ProjectSettings, error) {
+	var settings ProjectSettings
+	err := client.call("Project", "UpdateSettings", req, &settings)
+	return settings, err
+}
+
+// ProjectGetNotificationsSinceRequest is the data of Project.GetNotificationsSince
+type ProjectGetNotificationsSinceRequest struct {
+	ProjectID int64
+	Sequence  int64 // The Sequence of the last notification received; 0 for every stored notification
+}
+
+// ProjectGetNotificationsSince returns the project's notifications after the given sequence number, in order. If they
+// are no longer stored, it fails with a StatusError of status 409, and the project should be resynced instead.
+func (client *Client) ProjectGetNotificationsSince(req ProjectGetNotificationsSinceRequest) ([]Notification, error) {
+	var data struct {
+		Notifications []Notification
+	}
+	err := client.call("Project", "GetNotificationsSince", req, &data)
+	return data.Notifications, err
+}
+
+// ContentHash returns the hash of a file's contents, as sent in a sync manifest and returned with File and FilePullResult
+func ContentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// SyncManifestEntry is a file the client has, as listed in a ProjectSyncRequest
+type SyncManifestEntry struct {
+	Path    string // The file's RelativePath and Filename, joined with '/'
+	Version int64  // The version the client's copy is at; 0 if unknown
+	Hash    string // Optional; the ContentHash of the client's copy, which is replaced if it doesn't match
+}
+
+// ProjectSyncRequest is the data of Project.Sync
+type ProjectSyncRequest struct {
+	ProjectID int64
+	Files     []SyncManifestEntry
+}
+
+// SyncEntry is a change to the client's copy of a project
+type SyncEntry struct {
+	Action    string // "Create", "Patch" or "Delete"
+	Path      string
+	FileID    int64
+	Version   int64  // The version the file is at once the entry is applied
+	FileBytes []byte // Creates: the file's contents, replacing the client's copy if it has one
+	Patch     string // Patches: the patch to apply to the client's copy
+}
+
+// ProjectSync reconciles the client's copy of a project, listed in the request, with the server's, calling apply with
+// each of the changes to make as they arrive. It returns the paths of the files that couldn't be synced, which must be
+// pulled instead. If apply returns an error, the sync stops with that error.
+func (client *Client) ProjectSync(req ProjectSyncRequest, apply func(SyncEntry) error) ([]string, error) {
+	stream := make(chan Notification, 16)
+	client.mutex.Lock()
+	if _, ok := client.syncs[req.ProjectID]; ok {
+		client.mutex.Unlock()
+		return nil, ErrSyncInProgress
+	}
+	client.syncs[req.ProjectID] = stream
+	client.mutex.Unlock()
+	defer func() {
+		client.mutex.Lock()
+		if client.syncs[req.ProjectID] == stream {
+			delete(client.syncs, req.ProjectID)
+		}
+		client.mutex.Unlock()
+	}()
+
+	if err := client.call("Project", "Sync", req, nil); err != nil {
+		return nil, err
+	}
+	for {
+		var notification Notification
+		select {
+		case received, ok := <-stream:
+			if !ok {
+				return nil, ErrDisconnected
+			}
+			notification = received
+		case <-time.After(client.options.ResponseTimeout):
+			return nil, ErrTimeout
+		}
+
+		var chunk struct {
+			Entries []SyncEntry
+			Done    bool
+			Failed  []string
+		}
+		if err := notification.Decode(&chunk); err != nil {
+			return nil, err
+		}
+		for _, entry := range chunk.Entries {
+			if err := apply(entry); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			return chunk.Failed, nil
+		}
+	}
+}
+
+/**
+ * Session
+ */
+
+// SessionResumeRequest is the data of Session.Resume
+type SessionResumeRequest struct {
+	SessionID string // The previous connection's session; if empty, only the current session's ID is returned
+}
+
+// SessionResume resumes the subscriptions of a previous connection's session. The client does this itself when it
+// reconnects.
+func (client *Client) SessionResume(req SessionResumeRequest) (SessionResumeResult, error) {
+	var result SessionResumeResult
+	if err := client.call("Session", "Resume", req, &result); err != nil {
+		return result, err
+	}
+	client.mutex.Lock()
+	client.sessionID = result.SessionID
+	client.mutex.Unlock()
+	return result, nil
+}
+
+/**
+ * Team
+ */
+
+// TeamCreateRequest is the data of Team.Create
+type TeamCreateRequest struct {
+	Name string
+}
+
+// TeamCreate creates a team, returning its ID
+func (client *Client) TeamCreate(req TeamCreateRequest) (int64, error) {
+	var data struct {
+		TeamID int64
+	}
+	err := client.call("Team", "Create", req, &data)
+	return data.TeamID, err
+}
+
+// TeamAddMemberRequest is the data of Team.AddMember
+type TeamAddMemberRequest struct {
+	TeamID   int64
+	Username string
+	IsAdmin  bool
+}
+
+// TeamAddMember adds a user to a team, or changes whether they are an admin of it
+func (client *Client) TeamAddMember(req TeamAddMemberRequest) error {
+	return client.call("Team", "AddMember", req, nil)
+}
+
+// TeamGrantProjectAccessRequest is the data of Team.GrantProjectAccess
+type TeamGrantProjectAccessRequest struct {
+	TeamID          int64
+	ProjectID       int64
+	Role            string
+	PermissionLevel int8 // Deprecated: use Role
+}
+
+// TeamGrantProjectAccess gives every member of a team a role on a project
+func (client *Client) TeamGrantProjectAccess(req TeamGrantProjectAccessRequest) error {
+	return client.call("Team", "GrantProjectAccess", req, nil)
+}
+
+/**
+ * User
+ */
+
+// UserRegisterRequest is the data of User.Register
+type UserRegisterRequest struct {
+	Username  string
+	FirstName string
+	LastName  string
+	Email     string
+	Password  string
+}
+
+// UserRegister creates a user
+func (client *Client) UserRegister(req UserRegisterRequest) error {
+	return client.call("User", "Register", req, nil)
+}
+
+// UserLoginRequest is the data of User.Login
+type UserLoginRequest struct {
+	Username string
+	Password string
+}
+
+// UserLogin logs in, authenticating every later request as the user
+func (client *Client) UserLogin(req UserLoginRequest) error {
+	return client.login("Login", req.Username, req)
+}
+
+// UserLoginExternalRequest is the data of User.LoginExternal
+type UserLoginExternalRequest struct {
+	Provider string
+	IDToken  string // For GitHub, the OAuth access token
+}
+
+// UserLoginExternal logs in with an identity from an external provider, authenticating every later request as the
+// user it is linked to, or a new user created for it
+func (client *Client) UserLoginExternal(req UserLoginExternalRequest) error {
+	return client.login("LoginExternal", "", req)
+}
+
+// login logs in with the given method, and records the session so that it can be resumed after a reconnect
+func (client *Client) login(method string, username string, req interface{}) error {
+	var data struct {
+		Token string
+	}
+	if err := client.call("User", method, req, &data); err != nil {
+		return err
+	}
+	if username == "" {
+		username = tokenUsername(data.Token)
+	}
+	client.Authenticate(username, data.Token)
+
+	_, err := client.SessionResume(SessionResumeRequest{})
+	return err
+}
+
+// tokenUsername returns the username a session token was issued to, read from its claims. The signature is left to the
+// server to check.
+func tokenUsername(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Username string
+	}
+	json.Unmarshal(payload, &claims)
+	return claims.Username
+}
+
+// UserVerifyEmailRequest is the data of User.VerifyEmail
+type UserVerifyEmailRequest struct {
+	Token string
+}
+
+// UserVerifyEmail confirms a user's email address, with the token they were emailed
+func (client *Client) UserVerifyEmail(req UserVerifyEmailRequest) error {
+	return client.call("User", "VerifyEmail", req, nil)
+}
+
+// UserRequestEmailVerification emails the user a new verification token
+func (client *Client) UserRequestEmailVerification() error {
+	return client.call("User", "RequestEmailVerification", nil, nil)
+}
+
+// UserRequestPasswordResetRequest is the data of User.RequestPasswordReset
+type UserRequestPasswordResetRequest struct {
+	Username string
+}
+
+// UserRequestPasswordReset emails the user a token to reset their password with
+func (client *Client) UserRequestPasswordReset(req UserRequestPasswordResetRequest) error {
+	return client.call("User", "RequestPasswordReset", req, nil)
+}
+
+// UserConfirmResetRequest is the data of User.ConfirmReset
+type UserConfirmResetRequest struct {
+	Token       string
+	NewPassword string
+}
+
+// UserConfirmReset sets a new password, with the token the user was emailed
+func (client *Client) UserConfirmReset(req UserConfirmResetRequest) error {
+	return client.call("User", "ConfirmReset", req, nil)
+}
+
+// UserCreateAPITokenRequest is the data of User.CreateAPIToken
+type UserCreateAPITokenRequest struct {
+	Name       string
+	Scope      string  // "read", "write" or "admin"
+	ProjectIDs []int64 // If non-empty, the only projects the token may access
+	Validity   string  // Duration, such as "720h"; the token never expires if empty
+}
+
+// UserCreateAPIToken creates an API token, which can be used with Authenticate
+func (client *Client) UserCreateAPIToken(req UserCreateAPITokenRequest) (APIToken, error) {
+	var token APIToken
+	err := client.call("User", "CreateAPIToken", req, &token)
+	return token, err
+}
+
+// UserRevokeAPITokenRequest is the data of User.RevokeAPIToken
+type UserRevokeAPITokenRequest struct {
+	TokenID int64
+}
+
+// UserRevokeAPIToken revokes one of the user's API tokens
+func (client *Client) UserRevokeAPIToken(req UserRevokeAPITokenRequest) error {
+	return client.call("User", "RevokeAPIToken", req, nil)
+}
+
+// UserListSessions returns the connections the user has made authenticated requests on, most recently active first
+func (client *Client) UserListSessions() ([]UserSession, error) {
+	var data struct {
+		Sessions []UserSession
+	}
+	err := client.call("User", "ListSessions", nil, &data)
+	return data.Sessions, err
+}
+
+// UserRevokeSessionRequest is the data of User.RevokeSession
+type UserRevokeSessionRequest struct {
+	SessionID string
+}
+
+// UserRevokeSession disconnects one of the user's sessions, and refuses the token it used from then on
+func (client *Client) UserRevokeSession(req UserRevokeSessionRequest) error {
+	return client.call("User", "RevokeSession", req, nil)
+}
+
+// UserDelete deletes the user, and the projects they own. Their authorship of the changes they made in other projects
+// is erased afterwards.
+func (client *Client) UserDelete() error {
+	return client.call("User", "Delete", nil, nil)
+}
+
+// UserExportData returns a zip archive of the data the server keeps about the user: their profile in profile.json,
+// their projects in projects.json, the stored changes they made in changes.json, and their avatar, if any
+func (client *Client) UserExportData() ([]byte, error) {
+	var data struct {
+		Archive []byte
+	}
+	err := client.call("User", "ExportData", nil, &data)
+	return data.Archive, err
+}
+
+// UserLookupRequest is the data of User.Lookup
+type UserLookupRequest struct {
+	Usernames []string
+}
+
+// UserLookup returns the profiles of the given users
+func (client *Client) UserLookup(req UserLookupRequest) ([]User, error) {
+	var data struct {
+		Users []User
+	}
+	err := client.call("User", "Lookup", req, &data)
+	return data.Users, err
+}
+
+// UserSearchRequest is the data of User.Search
+type UserSearchRequest struct {
+	Prefix string // A prefix of the users' usernames, emails, first or last names; at least 2 characters
+	Limit  int    // The number of users to return, at most 50; 0 for 10
+}
+
+// UserSearch returns the users matching a prefix, with only their Username, FirstName and LastName, to complete
+// usernames as they are typed
+func (client *Client) UserSearch(req UserSearchRequest) ([]User, error) {
+	var data struct {
+		Users []User
+	}
+	err := client.call("User", "Search", req, &data)
+	return data.Users, err
+}
+
+// UserSetUnlistedRequest is the data of User.SetUnlisted
+type UserSetUnlistedRequest struct {
+	Unlisted bool
+}
+
+// UserSetUnlisted sets whether the user is hidden from UserSearch, other than by their exact username
+func (client *Client) UserSetUnlisted(req UserSetUnlistedRequest) error {
+	return client.call("User", "SetUnlisted", req, nil)
+}
+
+// UserUpdateProfileRequest is the data of User.UpdateProfile
+type UserUpdateProfileRequest struct {
+	FirstName string // At most 30 characters
+	LastName  string // At most 30 characters
+}
+
+// UserUpdateProfile replaces the user's first and last name
+func (client *Client) UserUpdateProfile(req UserUpdateProfileRequest) error {
+	return client.call("User", "UpdateProfile", req, nil)
+}
+
+// UserChangeUsernameRequest is the data of User.ChangeUsername
+type UserChangeUsernameRequest struct {
+	NewUsername string // At most 25 letters, digits, '.', '_' or '-'; not another user's current or former username
+}
+
+// UserChangeUsername renames the user, authenticating every later request under the new username. Tokens issued to the
+// old username keep working until they expire.
+func (client *Client) UserChangeUsername(req UserChangeUsernameRequest) error {
+	return client.login("ChangeUsername", "", req)
+}
+
+// UserSetAvatarRequest is the data of User.SetAvatar
+type UserSetAvatarRequest struct {
+	Image []byte // A PNG, JPEG or GIF image of at most 256KB and 1024x1024 pixels; empty to remove the avatar
+}
+
+// UserSetAvatar replaces the user's avatar, returning its hash; "" if it was removed
+func (client *Client) UserSetAvatar(req UserSetAvatarRequest) (string, error) {
+	var data struct {
+		AvatarHash string
+	}
+	err := client.call("User", "SetAvatar", req, &data)
+	return data.AvatarHash, err
+}
+
+// UserGetAvatarRequest is the data of User.GetAvatar
+type UserGetAvatarRequest struct {
+	Username string
+}
+
+// UserGetAvatar returns a user's avatar and its hash. Avatars may be cached by their hash, which User.AvatarHash
+// returns, so they need only be fetched when it changes
+func (client *Client) UserGetAvatar(req UserGetAvatarRequest) ([]byte, string, error) {
+	var data struct {
+		AvatarHash string
+		Image      []byte
+	}
+	err := client.call("User", "GetAvatar", req, &data)
+	return data.Image, data.AvatarHash, err
+}
+
+// UserProjectsRequest is the data of User.Projects
+type UserProjectsRequest struct {
+	Offset int // The number of projects to skip
+	Limit  int // The number of projects to return, at most 1000; 0 returns every project after Offset
+}
+
+// UserProjects returns the projects the user has access to
+func (client *Client) UserProjects() ([]Project, error) {
+	projects, _, err := client.UserProjectsPage(UserProjectsRequest{})
+	return projects, err
+}
+
+// UserProjectsPage returns a page of the projects the user has access to, and the number of projects they have
+// access to
+func (client *Client) UserProjectsPage(req UserProjectsRequest) ([]Project, int, error) {
+	var data struct {
+		Projects []Project
+		Total    int
+	}
+	err := client.call("User", "Projects", req, &data)
+	return data.Projects, data.Total, err
+}
+
+// NotificationPrefs are the projects and events whose notifications the user doesn't receive; it is also the data of
+// User.SetNotificationPrefs
+type NotificationPrefs struct {
+	MutedProjects []int64
+	MutedEvents   []string // "Resource.Method" or "Resource.*", such as "File.SetMetadata"
+}
+
+// UserGetNotificationPrefs returns the projects and events the user has muted
+func (client *Client) UserGetNotificationPrefs() (NotificationPrefs, error) {
+	var prefs NotificationPrefs
+	err := client.call("User", "GetNotificationPrefs", nil, &prefs)
+	return prefs, err
+}
+
+// UserSetNotificationPrefs replaces the projects and events the user has muted, on each of their connections
+func (client *Client) UserSetNotificationPrefs(prefs NotificationPrefs) error {
+	return client.call("User", "SetNotificationPrefs", prefs, nil)
+}
@@ -0,0 +1,549 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/compression"
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * Client is a Go client for the CodeCollaborate WebSocket protocol, so that plugins and tools don't have to build the
+ * JSON messages themselves. Requests are matched to their responses by tag, and notifications are delivered on a
+ * channel.
+ *
+ * If the connection drops, the client reconnects and resumes its session, so that its subscriptions are kept. If the
+ * session can no longer be resumed, the projects subscribed to with ProjectSubscribe are subscribed to again. Changes made
+ * while disconnected are not replayed; use Options.OnReconnect to pull them.
+ *
+ * Requests the server deduplicates, such as FileCreate and ProjectCreate, are sent with an idempotency key. If the
+ * connection drops before they are answered, they are sent again once the client has reconnected, and are answered
+ * with the original outcome if the first attempt got through.
+ *
+ * Notifications are received compressed with a shared dictionary, if the server has it, as this saves most of their
+ * size; see the compression package.
+ */
+
+// statusSuccess is the status of a successful response
+const statusSuccess = 200
+
+// ErrTimeout is returned when the server does not respond in time
+var ErrTimeout = errors.New("Timed out waiting for the server")
+
+// ErrClosed is returned for requests made after Close
+var ErrClosed = errors.New("Client is closed")
+
+// ErrDisconnected is returned for requests that were waiting for a response when the connection dropped
+var ErrDisconnected = errors.New("Disconnected from the server")
+
+// ErrSyncInProgress is returned by ProjectSync if the project is already being synced
+var ErrSyncInProgress = errors.New("The project is already being synced")
+
+// OutdatedClientError is returned when the server refuses to connect because Options.ClientVersion is older than it
+// allows, or was not set
+type OutdatedClientError struct {
+	Reason string // Given by the server, naming the version required
+}
+
+func (err *OutdatedClientError) Error() string {
+	return "The server refused the client's version: " + err.Reason
+}
+
+// StatusError is returned when the server responds with a status other than success
+type StatusError struct {
+	Resource   string
+	Method     string
+	Status     int
+	Reason     string // Given by the server for some failures, such as rejected passwords
+	RetryAfter int64  // For status 429, the seconds until a locked out login may be tried again
+	Archive    string // For status 423, the archive state of the project whose files were requested
+	Limit      int    // For status 439, the number of connections or requests in progress the server allows
+	Retryable  bool   // Whether the request may succeed if it is made again later, such as once a database recovers
+}
+
+func (err *StatusError) Error() string {
+	if err.Reason != "" {
+		return fmt.Sprintf("%s.%s failed with status %d: %s", err.Resource, err.Method, err.Status, err.Reason)
+	}
+	return fmt.Sprintf("%s.%s failed with status %d", err.Resource, err.Method, err.Status)
+}
+
+// Response is a response from the server, with its data left for the caller to decode
+type Response struct {
+	Tag    int64
+	Status int
+	Data   json.RawMessage
+}
+
+// Decode unmarshals the response's data into v
+func (res Response) Decode(v interface{}) error {
+	return json.Unmarshal(res.Data, v)
+}
+
+// Notification is a notification from the server, with its data left for the caller to decode
+type Notification struct {
+	Resource   string
+	Method     string
+	ResourceID int64
+	Data       json.RawMessage
+	Sequence   int64 // Orders the project's notifications; 0 for those not sent to a project's subscribers
+}
+
+// Decode unmarshals the notification's data into v
+func (notification Notification) Decode(v interface{}) error {
+	return json.Unmarshal(notification.Data, v)
+}
+
+type serverMessage struct {
+	Type          string
+	Timestamp     int64
+	ServerMessage json.RawMessage
+}
+
+// Options configure a Client; the zero value uses the defaults
+type Options struct {
+	// How long to wait for a response; defaults to 30 seconds
+	ResponseTimeout time.Duration
+	// How long to wait before the first attempt to reconnect, doubling up to a minute; defaults to a second. A
+	// negative interval disables reconnecting.
+	ReconnectInterval time.Duration
+	// Called once the client has reconnected and resubscribed, such as to pull the changes it missed
+	OnReconnect func()
+	// The number of notifications buffered for Notifications; later notifications are dropped until there is space.
+	// Defaults to 256.
+	NotificationBuffer int
+	// WebSocket subprotocols to offer, for servers that require one
+	Subprotocols []string
+	// The client's name and version, such as "vim/1.4.2", for servers that refuse outdated clients
+	ClientVersion string
+	// Don't offer to receive notifications compressed with a shared dictionary, such as to inspect the traffic
+	DisableDictionaryCompression bool
+}
+
+// Client is a connection to a CodeCollaborate server. Its methods are safe for concurrent use.
+type Client struct {
+	url     string
+	options Options
+
+	mutex         sync.Mutex
+	conn          *websocket.Conn // nil while disconnected
+	connected     chan struct{}   // Closed while connected
+	closed        bool
+	nextTag       int64
+	pending       map[int64]chan Response
+	username      string
+	token         string
+	sessionID     string
+	subscriptions map[int64]ProjectSubscribeRequest
+	syncs         map[int64]chan Notification // The Project.Sync notifications of the projects being synced
+
+	writeMutex    sync.Mutex
+	notifications chan Notification
+	done          chan struct{} // Closed by Close
+}
+
+// Dial connects to the WebSocket endpoint at the URL, such as "wss://example.com/ws/"
+func Dial(url string, options Options) (*Client, error) {
+	if options.ResponseTimeout == 0 {
+		options.ResponseTimeout = 30 * time.Second
+	}
+	if options.ReconnectInterval == 0 {
+		options.ReconnectInterval = time.Second
+	}
+	if options.NotificationBuffer == 0 {
+		options.NotificationBuffer = 256
+	}
+
+	conn, dictionary, err := dial(url, options)
+	if err != nil {
+		return nil, err
+	}
+	client := &Client{
+		url:           url,
+		options:       options,
+		conn:          conn,
+		connected:     make(chan struct{}),
+		nextTag:       1,
+		pending:       make(map[int64]chan Response),
+		subscriptions: make(map[int64]ProjectSubscribeRequest),
+		syncs:         make(map[int64]chan Notification),
+		notifications: make(chan Notification, options.NotificationBuffer),
+		done:          make(chan struct{}),
+	}
+	close(client.connected)
+	go client.read(conn, dictionary)
+	return client, nil
+}
+
+// Notifications returns the channel notifications are delivered on. It is never closed.
+func (client *Client) Notifications() <-chan Notification {
+	return client.notifications
+}
+
+// NextNotification waits for the next notification, up to the timeout
+func (client *Client) NextNotification(timeout time.Duration) (Notification, error) {
+	select {
+	case notification := <-client.notifications:
+		return notification, nil
+	case <-time.After(timeout):
+		return Notification{}, ErrTimeout
+	}
+}
+
+// Authenticate sends the username and token with every later request, such as with an API token. UserLogin does this
+// itself.
+func (client *Client) Authenticate(username string, token string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.username = username
+	client.token = token
+}
+
+// read passes the messages from the server to the requests waiting for them, until the connection drops. Binary
+// messages are notifications compressed with the dictionary negotiated when connecting.
+func (client *Client) read(conn *websocket.Conn, dictionary string) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			client.disconnected(conn)
+			return
+		}
+		if messageType == websocket.BinaryMessage {
+			if data, err = compression.Decompress(dictionary, data); err != nil {
+				continue
+			}
+		}
+
+		var msg serverMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch msg.Type {
+		case "Response":
+			var res Response
+			if err := json.Unmarshal(msg.ServerMessage, &res); err != nil {
+				continue
+			}
+			client.mutex.Lock()
+			waiting, ok := client.pending[res.Tag]
+			delete(client.pending, res.Tag)
+			client.mutex.Unlock()
+			if ok {
+				waiting <- res
+			}
+		case "Notification":
+			var notification Notification
+			if err := json.Unmarshal(msg.ServerMessage, &notification); err != nil {
+				continue
+			}
+			// Syncs can't afford to miss any of their notifications, so they are not sent with the others
+			if notification.Resource == "Project" && notification.Method == "Sync" {
+				client.mutex.Lock()
+				stream, ok := client.syncs[notification.ResourceID]
+				client.mutex.Unlock()
+				if ok {
+					select {
+					case stream <- notification:
+					case <-time.After(client.options.ResponseTimeout):
+					}
+					continue
+				}
+			}
+			select {
+			case client.notifications <- notification:
+			default:
+				// A client that isn't reading its notifications shouldn't hold up its responses
+			}
+		}
+	}
+}
+
+// disconnected fails the requests waiting on the connection, and starts reconnecting unless the client was closed
+func (client *Client) disconnected(conn *websocket.Conn) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.conn != conn {
+		return
+	}
+	conn.Close()
+	client.conn = nil
+	client.connected = make(chan struct{})
+	for tag, waiting := range client.pending {
+		close(waiting)
+		delete(client.pending, tag)
+	}
+	for projectID, stream := range client.syncs {
+		close(stream)
+		delete(client.syncs, projectID)
+	}
+
+	if !client.closed && client.options.ReconnectInterval > 0 {
+		go client.reconnect()
+	}
+}
+
+// reconnect redials the server until it succeeds or the client is closed, then restores the client's subscriptions
+func (client *Client) reconnect() {
+	interval := client.options.ReconnectInterval
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-time.After(interval):
+		}
+
+		conn, dictionary, err := dial(client.url, client.options)
+		if err != nil {
+			if interval *= 2; interval > time.Minute {
+				interval = time.Minute
+			}
+			continue
+		}
+
+		client.mutex.Lock()
+		if client.closed {
+			client.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		client.conn = conn
+		close(client.connected)
+		client.mutex.Unlock()
+		go client.read(conn, dictionary)
+		break
+	}
+
+	client.resubscribe()
+	if client.options.OnReconnect != nil {
+		client.options.OnReconnect()
+	}
+}
+
+// resubscribe resumes the previous connection's session, or, if it can't be, subscribes to the projects again
+func (client *Client) resubscribe() {
+	client.mutex.Lock()
+	sessionID := client.sessionID
+	loggedIn := client.token != ""
+	subscriptions := make([]ProjectSubscribeRequest, 0, len(client.subscriptions))
+	for _, sub := range client.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	client.mutex.Unlock()
+
+	if !loggedIn {
+		return
+	}
+	if sessionID != "" {
+		if _, err := client.SessionResume(SessionResumeRequest{SessionID: sessionID}); err == nil {
+			return
+		}
+	}
+	for _, sub := range subscriptions {
+		client.send("Project", "Subscribe", "", sub)
+	}
+	client.SessionResume(SessionResumeRequest{})
+}
+
+// Send makes a request, waiting for its response. data holds the request's fields, such as a struct or a map. Unlike
+// the typed methods, it does not check the response's status.
+func (client *Client) Send(resource string, method string, data interface{}) (Response, error) {
+	return client.send(resource, method, "", data)
+}
+
+// send makes a request with the given idempotency key, if it is not empty
+func (client *Client) send(resource string, method string, idempotencyKey string, data interface{}) (Response, error) {
+	if data == nil {
+		data = struct{}{}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return Response{}, err
+	}
+
+	client.mutex.Lock()
+	if client.closed {
+		client.mutex.Unlock()
+		return Response{}, ErrClosed
+	}
+	conn := client.conn
+	if conn == nil {
+		client.mutex.Unlock()
+		return Response{}, ErrDisconnected
+	}
+	tag := client.nextTag
+	client.nextTag++
+	waiting := make(chan Response, 1)
+	client.pending[tag] = waiting
+	message, err := json.Marshal(map[string]interface{}{
+		"Tag":            tag,
+		"Resource":       resource,
+		"Method":         method,
+		"SenderID":       client.username,
+		"SenderToken":    client.token,
+		"Timestamp":      time.Now().Unix(),
+		"Nonce":          newRandomKey(),
+		"Data":           json.RawMessage(encoded),
+		"IdempotencyKey": idempotencyKey,
+	})
+	client.mutex.Unlock()
+	if err != nil {
+		return Response{}, err
+	}
+
+	client.writeMutex.Lock()
+	err = conn.WriteMessage(websocket.TextMessage, message)
+	client.writeMutex.Unlock()
+	if err != nil {
+		return Response{}, ErrDisconnected
+	}
+
+	select {
+	case res, ok := <-waiting:
+		if !ok {
+			return Response{}, ErrDisconnected
+		}
+		return res, nil
+	case <-time.After(client.options.ResponseTimeout):
+		client.mutex.Lock()
+		delete(client.pending, tag)
+		client.mutex.Unlock()
+		return Response{}, ErrTimeout
+	}
+}
+
+// waitConnected waits for the client to be connected, up to the response timeout
+func (client *Client) waitConnected() bool {
+	client.mutex.Lock()
+	connected := client.connected
+	client.mutex.Unlock()
+
+	select {
+	case <-connected:
+		return true
+	case <-client.done:
+		return false
+	case <-time.After(client.options.ResponseTimeout):
+		return false
+	}
+}
+
+// responseReason is the Data of a response to a request that failed
+type responseReason struct {
+	Reason     string
+	RetryAfter int64
+	Archive    string
+	Limit      int
+	Retryable  bool
+}
+
+// requestInProgress returns whether the response tells a retry that the request it repeats is still being processed,
+// and how long to wait before making it again
+func requestInProgress(res Response) (time.Duration, bool) {
+	var reason responseReason
+	if res.Status == statusSuccess || json.Unmarshal(res.Data, &reason) != nil || reason.Reason != "Request in progress" {
+		return 0, false
+	}
+	return time.Duration(reason.RetryAfter) * time.Second, true
+}
+
+// call makes a request, decoding the data of a successful response into result, if it is not nil. Requests the
+// server deduplicates are retried if the connection drops before they are answered.
+func (client *Client) call(resource string, method string, data interface{}, result interface{}) error {
+	var idempotencyKey string
+	if idempotentMethods[resource+"."+method] {
+		idempotencyKey = newRandomKey()
+	}
+
+	res, err := client.send(resource, method, idempotencyKey, data)
+	if err == ErrDisconnected && idempotencyKey != "" && client.options.ReconnectInterval > 0 && client.waitConnected() {
+		res, err = client.send(resource, method, idempotencyKey, data)
+
+		// The first attempt may still be being processed, in which case the retry is made again once it is done
+		for deadline := time.Now().Add(client.options.ResponseTimeout); err == nil && time.Now().Before(deadline); {
+			retryAfter, inProgress := requestInProgress(res)
+			if !inProgress {
+				break
+			}
+			time.Sleep(retryAfter)
+			res, err = client.send(resource, method, idempotencyKey, data)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if res.Status != statusSuccess {
+		statusErr := &StatusError{Resource: resource, Method: method, Status: res.Status}
+		var reason responseReason
+		if json.Unmarshal(res.Data, &reason) == nil {
+			statusErr.Reason = reason.Reason
+			statusErr.RetryAfter = reason.RetryAfter
+			statusErr.Archive = reason.Archive
+			statusErr.Limit = reason.Limit
+			statusErr.Retryable = reason.Retryable
+		}
+		return statusErr
+	}
+	if result == nil {
+		return nil
+	}
+	return res.Decode(result)
+}
+
+// dial opens a WebSocket connection to the URL, returning the compression dictionary the server chose, if any
+func dial(url string, options Options) (*websocket.Conn, string, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = options.Subprotocols
+	header := http.Header{}
+	if options.ClientVersion != "" {
+		header.Set("X-Client-Version", options.ClientVersion)
+	}
+	if !options.DisableDictionaryCompression {
+		header.Set(compression.Header, compression.NotificationsV1)
+	}
+	conn, res, err := dialer.Dial(url, header)
+	if err == websocket.ErrBadHandshake && res != nil && res.StatusCode == 426 {
+		reason, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return nil, "", &OutdatedClientError{Reason: strings.TrimSpace(string(reason))}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return conn, res.Header.Get(compression.Header), nil
+}
+
+// newRandomKey returns a random idempotency key or nonce
+func newRandomKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
+
+// Close disconnects from the server, and stops reconnecting
+func (client *Client) Close() error {
+	client.mutex.Lock()
+	if client.closed {
+		client.mutex.Unlock()
+		return nil
+	}
+	client.closed = true
+	close(client.done)
+	conn := client.conn
+	client.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
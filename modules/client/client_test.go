@@ -0,0 +1,223 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/testserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnect(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	editor, err := server.Dial()
+	require.NoError(t, err)
+	defer editor.Close()
+
+	reconnected := make(chan struct{}, 1)
+	watcher, err := client.Dial(server.URL, client.Options{
+		ReconnectInterval: 10 * time.Millisecond,
+		OnReconnect: func() {
+			reconnected <- struct{}{}
+		},
+	})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	const password = "correct horse battery staple"
+	require.NoError(t, editor.UserRegister(client.UserRegisterRequest{
+		Username:  "loganga",
+		FirstName: "Logan",
+		LastName:  "Ga",
+		Email:     "loganga@example.com",
+		Password:  password,
+	}))
+	login := client.UserLoginRequest{Username: "loganga", Password: password}
+	require.NoError(t, editor.UserLogin(login))
+	require.NoError(t, watcher.UserLogin(login))
+
+	projectID, err := editor.ProjectCreate(client.ProjectCreateRequest{Name: "hi"})
+	require.NoError(t, err)
+	require.NoError(t, watcher.ProjectSubscribe(client.ProjectSubscribeRequest{ProjectID: projectID}))
+
+	client.DropConnection(watcher)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client did not reconnect")
+	}
+
+	// The subscription survives the reconnect
+	fileID, err := editor.FileCreate(client.FileCreateRequest{Name: "a.txt", RelativePath: ".", ProjectID: projectID})
+	require.NoError(t, err)
+	notification, err := watcher.NextNotification(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "File", notification.Resource)
+	assert.Equal(t, "Create", notification.Method)
+
+	files, err := watcher.ProjectGetFiles(client.ProjectGetFilesRequest{ProjectID: projectID})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, fileID, files[0].FileID)
+}
+
+func TestRetryAfterDisconnect(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	c, err := client.Dial(server.URL, client.Options{ReconnectInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer c.Close()
+
+	const password = "correct horse battery staple"
+	require.NoError(t, c.UserRegister(client.UserRegisterRequest{
+		Username: "loganga",
+		Email:    "loganga@example.com",
+		Password: password,
+	}))
+	require.NoError(t, c.UserLogin(client.UserLoginRequest{Username: "loganga", Password: password}))
+
+	// The connection drops while the project is being created, so the request is sent again once reconnected
+	db := server.DB.(*dbfs.DatabaseMock)
+	db.SetLatency("MySQLProjectCreate", 200*time.Millisecond)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.DropConnection(c)
+	}()
+	projectID, err := c.ProjectCreate(client.ProjectCreateRequest{Name: "hi"})
+	require.NoError(t, err)
+
+	projects, err := c.UserProjects()
+	require.NoError(t, err)
+	require.Len(t, projects, 1, "the retry should not have created another project")
+	assert.Equal(t, projectID, projects[0].ProjectID)
+	assert.Equal(t, 1, db.CallCount("MySQLProjectCreate"))
+}
+
+func TestClosed(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	c, err := server.Dial()
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	_, err = c.ProjectGetPermissionConstants()
+	assert.Equal(t, client.ErrClosed, err)
+}
+
+func TestOutdatedClient(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	serverCfg := &server.Config.ServerConfig
+	defer func(minVersions map[string]string) {
+		serverCfg.MinClientVersions = minVersions
+	}(serverCfg.MinClientVersions)
+	serverCfg.MinClientVersions = map[string]string{"test": "1.4.0"}
+
+	_, err = client.Dial(server.URL, client.Options{ClientVersion: "test/1.3.9"})
+	require.IsType(t, &client.OutdatedClientError{}, err)
+	assert.Contains(t, err.(*client.OutdatedClientError).Reason, "1.4.0")
+
+	c, err := client.Dial(server.URL, client.Options{ClientVersion: "test/1.10.0"})
+	require.NoError(t, err)
+	c.Close()
+}
+
+func TestProjectSync(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	c, err := server.Dial()
+	require.NoError(t, err)
+	defer c.Close()
+
+	const password = "correct horse battery staple"
+	require.NoError(t, c.UserRegister(client.UserRegisterRequest{
+		Username: "loganga",
+		Email:    "loganga@example.com",
+		Password: password,
+	}))
+	require.NoError(t, c.UserLogin(client.UserLoginRequest{Username: "loganga", Password: password}))
+	projectID, err := c.ProjectCreate(client.ProjectCreateRequest{Name: "hi"})
+	require.NoError(t, err)
+	contents := []byte("hello\n")
+	_, err = c.FileCreate(client.FileCreateRequest{Name: "kept.txt", RelativePath: "src", ProjectID: projectID, FileBytes: contents})
+	require.NoError(t, err)
+	newID, err := c.FileCreate(client.FileCreateRequest{Name: "new.txt", RelativePath: ".", ProjectID: projectID, FileBytes: contents})
+	require.NoError(t, err)
+
+	var entries []client.SyncEntry
+	failed, err := c.ProjectSync(client.ProjectSyncRequest{
+		ProjectID: projectID,
+		Files: []client.SyncManifestEntry{
+			{Path: "src/kept.txt", Version: 1, Hash: client.ContentHash(contents)},
+			{Path: "removed.txt", Version: 1},
+		},
+	}, func(entry client.SyncEntry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.Equal(t, []client.SyncEntry{
+		{Action: "Create", Path: "new.txt", FileID: newID, Version: 1, FileBytes: contents},
+		{Action: "Delete", Path: "removed.txt"},
+	}, entries)
+
+	// Project.Sync notifications are not delivered with the others
+	_, err = c.NextNotification(50 * time.Millisecond)
+	assert.Equal(t, client.ErrTimeout, err)
+}
+
+func TestDictionaryCompression(t *testing.T) {
+	server, err := testserver.Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	editor, err := server.Dial()
+	require.NoError(t, err)
+	defer editor.Close()
+	const password = "correct horse battery staple"
+	require.NoError(t, editor.UserRegister(client.UserRegisterRequest{
+		Username: "loganga",
+		Email:    "loganga@example.com",
+		Password: password,
+	}))
+	login := client.UserLoginRequest{Username: "loganga", Password: password}
+	require.NoError(t, editor.UserLogin(login))
+	projectID, err := editor.ProjectCreate(client.ProjectCreateRequest{Name: "hi"})
+	require.NoError(t, err)
+
+	compressed, err := server.Dial()
+	require.NoError(t, err)
+	defer compressed.Close()
+	uncompressed, err := client.Dial(server.URL, client.Options{DisableDictionaryCompression: true})
+	require.NoError(t, err)
+	defer uncompressed.Close()
+	for _, c := range []*client.Client{compressed, uncompressed} {
+		require.NoError(t, c.UserLogin(login))
+		require.NoError(t, c.ProjectSubscribe(client.ProjectSubscribeRequest{ProjectID: projectID}))
+	}
+
+	// Both receive the same notifications, whether compressed or not
+	_, err = editor.FileCreate(client.FileCreateRequest{Name: "a.txt", RelativePath: ".", ProjectID: projectID})
+	require.NoError(t, err)
+	for _, c := range []*client.Client{compressed, uncompressed} {
+		notification, err := c.NextNotification(time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "File", notification.Resource)
+		assert.Equal(t, "Create", notification.Method)
+	}
+}
@@ -0,0 +1,11 @@
+package client
+
+// DropConnection closes the client's connection as if the network had failed, so that it reconnects
+func DropConnection(client *Client) {
+	client.mutex.Lock()
+	conn := client.conn
+	client.mutex.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+}
@@ -0,0 +1,117 @@
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+/**
+ * Dictionary compression of the notifications sent to WebSocket clients. Notifications are small, and mostly the same
+ * JSON, so permessage-deflate, which compresses each message on its own, saves little on them. Compressing them with
+ * a preset dictionary of that JSON shrinks a typical File.Change notification to a fraction of its size, which matters
+ * to mobile clients receiving every keystroke of a busy project.
+ *
+ * Clients that have a dictionary name it when they connect, in the X-Compression-Dictionary header, or the
+ * compression_dictionary query parameter, since browsers can't set headers on WebSocket connections; they may name
+ * several, separated by commas, in order of preference. The server answers the upgrade with the one it chose in the
+ * same header, then sends notifications as binary messages, each a raw DEFLATE stream (RFC 1951) compressed with the
+ * dictionary preset. Responses, and notifications that don't compress, are sent as text, as to other clients.
+ *
+ * A dictionary's contents never change once released, as clients have copies of them; improved dictionaries are added
+ * under new names.
+ */
+
+// Header is the HTTP header clients name the dictionaries they have in, and the server the one it chose
+const Header = "X-Compression-Dictionary"
+
+// Param is the query parameter clients that can't set headers name the dictionaries they have in
+const Param = "compression_dictionary"
+
+// NotificationsV1 is the first dictionary of notifications
+const NotificationsV1 = "notifications-v1"
+
+// maxDecompressedSize is the largest message Decompress returns, so that a small message can't exhaust memory
+const maxDecompressedSize = 64 << 20
+
+// ErrUnknownDictionary is returned for dictionaries this version doesn't have
+var ErrUnknownDictionary = errors.New("Unknown compression dictionary")
+
+var errTooLarge = errors.New("Decompressed message is too large")
+
+// dictionaries are the contents of each dictionary, by name
+var dictionaries = map[string][]byte{
+	NotificationsV1: []byte(notificationsV1),
+}
+
+// notificationsV1 is made of samples of the JSON of notifications. DEFLATE encodes references to the end of the
+// dictionary most cheaply, so the most common notifications, those of File.Change, come last.
+const notificationsV1 = `{"Type":"Response","Timestamp":17,"ServerMessage":{"Tag":1,"Status":200,"Data":{}}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Server","Method":"Announcement","ResourceID":0,"Data":{"Message":"","Level":"info"}}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Project","Method":"Delete","ResourceID":1,"Data":{},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Project","Method":"Rename","ResourceID":1,"Data":{"NewName":""},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Project","Method":"GrantPermissions","ResourceID":1,"Data":{"GrantUsername":"","PermissionLevel":1},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Project","Method":"RevokePermissions","ResourceID":1,"Data":{"RevokeUsername":""},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Comment","Method":"Create","ResourceID":1,"Data":{"Comment":{"CommentID":1,"FileID":1,"Author":"","Body":""}},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Create","ResourceID":1,"Data":{"File":{"FileID":1,"Filename":"","Creator":"","CreationDate":"2026-01-01T00:00:00Z","RelativePath":"","Version":1}},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Rename","ResourceID":1,"Data":{"NewName":""},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Move","ResourceID":1,"Data":{"NewPath":""},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Delete","ResourceID":1,"Data":{},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"Project","Method":"Cursor","ResourceID":1,"Data":{"Username":"","FileID":1,"Offset":1}}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Change","ResourceID":1,"Data":{"FileVersion":1,"Changes":"v1:\n1:+1:%20,\n1:-1:%0A:\n1"},"Sequence":1}}` +
+	`{"Type":"Notification","Timestamp":17,"ServerMessage":{"Resource":"File","Method":"Change","ResourceID":1,"Data":{"FileVersion":1,"Changes":"v1:\n1:+1:e:\n1"},"Sequence":1}}`
+
+// Negotiate returns the first of the offered dictionaries, as the client names them, that this version has; "" if
+// there is none
+func Negotiate(offered string) string {
+	for _, name := range strings.Split(offered, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := dictionaries[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Compress compresses the message with the named dictionary
+func Compress(dictionary string, data []byte) ([]byte, error) {
+	dict, ok := dictionaries[dictionary]
+	if !ok {
+		return nil, ErrUnknownDictionary
+	}
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses a message compressed with the named dictionary
+func Decompress(dictionary string, data []byte) ([]byte, error) {
+	dict, ok := dictionaries[dictionary]
+	if !ok {
+		return nil, ErrUnknownDictionary
+	}
+
+	r := flate.NewReaderDict(bytes.NewReader(data), dict)
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > maxDecompressedSize {
+		return nil, errTooLarge
+	}
+	return decompressed, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/CodeCollaborate/Server/utils"
@@ -16,6 +17,7 @@ import (
  */
 
 var config *Config
+var configMutex sync.RWMutex
 var configDir = "./config"
 
 // SetConfigDir sets config directory to be read from.
@@ -27,46 +29,65 @@ func SetConfigDir(dir string) {
 // if not explicitly set by SetConfigDir. Will parse from json, and return
 // a pointer to a Config struct, or error if it failed.
 func LoadConfig() error {
-	var err error
 	utils.LogInfo("Reading Configuration", utils.LogFields{
 		"ConfigDir": configDir,
 	})
-	config, err = parseConfig(configDir)
+	parsed, err := parseConfig(configDir)
+
+	configMutex.Lock()
+	config = parsed
+	configMutex.Unlock()
 
 	if err == nil {
 		utils.LogInfo("Loaded Configuration", utils.LogFields{
-			"ServerConfig": pretty.Sprint(config.ServerConfig),
+			"ServerConfig": pretty.Sprint(parsed.ServerConfig),
 		})
 		setLogLevel()
+		notifyChange(nil, parsed)
 	}
 
 	return err
 }
 
+// SetConfig replaces the configuration with one built in code rather than read from the configDir, such as by programs
+// and tests that embed the server. Change handlers are called as they are for LoadConfig.
+func SetConfig(cfg *Config) {
+	configMutex.Lock()
+	oldCfg := config
+	config = cfg
+	configMutex.Unlock()
+
+	setLogLevel()
+	notifyChange(oldCfg, cfg)
+}
+
 func setLogLevel() {
-	switch {
-	case config.ServerConfig.LogLevel == "Panic":
-		log.Info("Logger level set to Panic")
-		log.SetLevel(log.PanicLevel)
-	case config.ServerConfig.LogLevel == "Fatal":
-		log.Info("Logger level set to Fatal")
-		log.SetLevel(log.FatalLevel)
-	case config.ServerConfig.LogLevel == "Error":
-		log.Info("Logger level set to Error")
-		log.SetLevel(log.ErrorLevel)
-	case config.ServerConfig.LogLevel == "Warn":
-		log.Info("Logger level set to Warn")
-		log.SetLevel(log.WarnLevel)
-	case config.ServerConfig.LogLevel == "Info":
-		log.Info("Logger level set to Info")
-		log.SetLevel(log.InfoLevel)
-	case config.ServerConfig.LogLevel == "Debug":
-		log.Info("Logger level set to Debug")
-		log.SetLevel(log.DebugLevel)
-	default:
-		log.Info("Logger level set to Warn")
-		log.SetLevel(log.WarnLevel) // Default to Warn
+	cfg := GetConfig().ServerConfig
+	logCfg := utils.LogConfig{
+		Level:            cfg.LogLevel,
+		ModuleLevels:     cfg.Logging.ModuleLevels,
+		Format:           cfg.Logging.Format,
+		SampleInitial:    cfg.Logging.SampleInitial,
+		SampleThereafter: cfg.Logging.SampleThereafter,
+	}
+	if len(cfg.Logging.Sinks) > 0 && logCfg.Format == "" {
+		logCfg.Format = "json"
 	}
+	for _, sink := range cfg.Logging.Sinks {
+		if sink.Tag == "" {
+			sink.Tag = cfg.Name
+		}
+		logCfg.Sinks = append(logCfg.Sinks, utils.LogSink(sink))
+	}
+
+	if err := utils.ConfigureLogging(logCfg); err != nil {
+		utils.LogError("Invalid logging configuration; keeping the previous one", err, nil)
+		return
+	}
+	utils.LogInfo("Logging configured", utils.LogFields{
+		"Level":        cfg.LogLevel,
+		"ModuleLevels": cfg.Logging.ModuleLevels,
+	})
 }
 
 // EnableLoggingToFile redirects logger output to a logfile in the config's LogDir.
@@ -94,5 +115,8 @@ func EnableLoggingToFile(logDir string) {
 // if not explicitly set by SetConfigDir. Will parse from json, and return
 // a pointer to a Config struct, or error if it failed.
 func GetConfig() *Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+
 	return config
 }
@@ -23,10 +23,191 @@ type ServerCfg struct {
 	ProjectPath     string
 	DisableAuth     bool
 	UseTLS          bool
-	LogLevel        string
+	LogLevel        string // The default level for modules not in Logging.ModuleLevels
 	TokenValidity   string
 	MinBufferLength int
 	MaxBufferLength int
+	FeatureFlags    map[string]bool
+	Broker          string // Message broker: "RabbitMQ" (default) or "NATS", using the connection of the same name
+
+	// Where files' changes and projects' notifications are kept: "Couchbase" (default), "Memory", or the name of a
+	// store registered with dbfs.RegisterDocumentStore
+	DocumentStore string
+	// Where files' contents are kept: "Filesystem" (default), under ProjectPath, "Memory", "WebDAV" in servers built
+	// with the webdav tag, using the connection of the same name, or the name of a store registered with
+	// dbfs.RegisterFileStore
+	FileStore string
+
+	// PEM-encoded ECDSA P-256 private key that login tokens are signed with. Every server instance behind the same
+	// load balancer must use the same key; if unset, a key is generated at startup, and tokens are only accepted by
+	// the instance that issued them.
+	TokenSigningKeyFile string
+
+	// permessage-deflate compression of websocket messages, for clients that support it. Messages smaller than
+	// CompressionThreshold bytes (default 1024) are sent uncompressed, since compressing them saves little.
+	DisableCompression   bool
+	CompressionThreshold int
+
+	// WebSocket upgrade policy. Browsers send the Origin of the page opening a connection, and pages whose Origin isn't
+	// in AllowedOrigins, such as "https://app.example.com" or "https://*.example.com", are refused, so that other sites
+	// can't connect on their visitors' behalf. Unset allows only pages from the server's own host, and "*" allows any.
+	// Clients other than browsers send no Origin, and are always allowed.
+	AllowedOrigins []string
+
+	// WebSocket subprotocols the server speaks, in order of preference. If RequireSubprotocol is set, clients that
+	// don't offer one of them are refused.
+	Subprotocols       []string
+	RequireSubprotocol bool
+
+	// The oldest version of each client the server accepts connections from, by the name clients send with their
+	// version in the X-Client-Version header, such as {"vim": "1.4.0"}. "*" applies to every client not named,
+	// including those that don't send a version. Older clients are refused with a message naming the version they need.
+	MinClientVersions map[string]string
+
+	// The largest message a client may send, in bytes; the connection is closed if it sends a larger one. Unset
+	// means no limit.
+	MaxMessageSize int64
+
+	// The most WebSocket connections each user may make requests on at once, and the most requests each connection
+	// may have in progress at once; requests beyond either are refused with StatusConcurrencyLimited. Unset means no
+	// limit. Connections are counted by each server separately.
+	MaxConnectionsPerUser    int
+	MaxRequestsPerConnection int
+
+	// Limits on the requests of each priority lane this server processes at once, by lane: "interactive", such as
+	// File.Change, "bulk", such as Project.ImportFromGit, and "normal", for every other request; see
+	// datahandling/lanes.go. Lanes not configured use their defaults.
+	PriorityLanes map[string]PriorityLaneCfg
+
+	// Serve the gRPC API (modules/grpcapi) alongside the WebSocket endpoint. Without TLS, HTTP/2 is accepted in
+	// cleartext (h2c), which gRPC clients must be configured to use.
+	EnableGRPC bool
+
+	// Default storage quotas, in bytes; 0 means unlimited. Admins can override a project's quota with
+	// Admin.SetProjectQuota.
+	ProjectQuotaBytes int64
+	UserQuotaBytes    int64
+
+	// How long, such as "50ms", the server waits for more changes to a file from the same connection before appending
+	// them, so that the changes of fast typists are composed into a single version and notification. Only changes
+	// sent with Coalesce are waited for; unset appends each change as soon as it arrives.
+	ChangeBatchWindow string
+
+	// The objective for the latency of File.Change, from the server receiving a change to publishing its notification,
+	// reported by Admin.GetLatencyReport
+	ChangeLatencySLO LatencySLOCfg
+
+	// Caching of file metadata and project permissions, which are looked up by every File.Change
+	MetadataCache MetadataCacheCfg
+
+	// Limits on the files users may create
+	FilePolicy FilePolicyCfg
+
+	// At-rest encryption of file contents on disk
+	FileEncryption FileEncryptionCfg
+
+	// Store identical file contents only once on disk, such as vendored libraries copied across projects
+	DeduplicateFiles bool
+
+	// Where the files of archived projects are kept (see Project.Archive), such as the mount point of a bucket in a
+	// cheaper storage class; defaults to _archive in ProjectPath
+	ColdStoragePath string
+
+	// Treat file paths that differ only in case as the same path, for projects shared with Windows and macOS clients,
+	// whose filesystems can't hold both "Readme.md" and "README.md". Files then can't be created, moved or renamed
+	// onto such a path, and new paths take the case of the project's existing directories.
+	CaseInsensitivePaths bool
+
+	// Where contents flagged by the malware scanner (see the "ClamAV" connection) are kept for review; defaults to
+	// ./data/quarantine
+	QuarantineDir string
+
+	// The longest a request may spend in the database, such as "30s"; unset means no limit. Requests are also
+	// abandoned when their client disconnects.
+	RequestTimeout string
+
+	// Requests that take longer than SlowRequestThreshold to process, and database operations that take longer than
+	// SlowQueryThreshold, such as "500ms", are logged as warnings with the trace ID of their request, so they can be
+	// found without debug logging. Unset disables each.
+	SlowRequestThreshold string
+	SlowQueryThreshold   string
+
+	// Replay protection for authenticated requests. Requests whose Timestamp is further than ReplayWindow, such as
+	// "5m", from the server's clock are rejected, as are requests that repeat a Nonce the same user sent within it.
+	// Unset disables both checks. If RequireNonce is set, authenticated requests without a Nonce are rejected too.
+	ReplayWindow string
+	RequireNonce bool
+
+	// Lockout of accounts and addresses after repeated failed logins
+	LoginThrottle LoginThrottleCfg
+
+	// Networks clients may or may not connect from, as CIDRs such as "10.0.0.0/8" or single addresses. Clients in
+	// DeniedNetworks are refused; if AllowedNetworks is set, so is every client outside of it.
+	AllowedNetworks []string
+	DeniedNetworks  []string
+
+	// Reverse proxies and load balancers in front of the server, as CIDRs or single addresses. Requests they forward
+	// are attributed to the client named in their X-Forwarded-For header. If ProxyProtocol is set, connections from
+	// them must instead start with a PROXY protocol (version 1) header naming the client.
+	TrustedProxies []string
+	ProxyProtocol  bool
+
+	// How often every file on disk is checked against its checksum and its MySQL row, such as "24h"; unset disables
+	// the scheduled checks, though admins can still run them with Admin.CheckIntegrity
+	IntegrityCheckInterval string
+
+	// Apply pending MySQL schema migrations at startup. The MySQL account then needs privileges to change the schema;
+	// otherwise, run `server migrate` as an account that has them, using the -mysql_* flags.
+	AutoMigrate bool
+
+	// Usernames of server administrators, who may make Admin requests
+	Admins []string
+
+	// Start the server in maintenance mode, in which requests that change anything are refused, such as while
+	// migrating the databases; it can be turned off by reloading the config. Admins can also put every server into
+	// maintenance mode with Admin.SetMaintenance.
+	Maintenance bool
+
+	// Mirroring of file contents to a Git repository, as a backup with diff-able history
+	GitExport GitExportCfg
+
+	// Export of projects' file events to other services, such as for analytics or plagiarism detection
+	ChangeFeed ChangeFeedCfg
+
+	// Relaying of project notifications between the RabbitMQ brokers of regions, so that users of the same project
+	// who are connected to servers in different regions see each other's changes
+	Federation FederationCfg
+
+	// Password policy and argon2id hashing parameters. Unset values use the defaults in the auth module.
+	// Raising the hashing parameters upgrades existing hashes as users log in.
+	PasswordMinLength      int
+	PasswordHashMemory     uint32 // in KiB
+	PasswordHashIterations uint32
+	PasswordHashThreads    uint8
+
+	// Account emails, sent through the "SMTP" connection
+	EmailFrom                string
+	RequireEmailVerification bool // If set, users must verify their email before they can log in
+
+	// What deleting a user does to the authorship of the patches they made: "anonymize" (the default) replaces their
+	// username with a pseudonym, the same for each of their patches, and "scrub" removes the author, client and time
+	UserErasure string
+
+	// External identity providers for User.LoginExternal, keyed on the provider name clients send
+	OIDCProviders map[string]OIDCProviderCfg
+
+	// TLS settings, used if UseTLS is set. If TLSCertFile and TLSKeyFile are empty, certificates are requested
+	// from Let's Encrypt for Host, and cached in TLSAutocertCacheDir.
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSAutocertCacheDir string
+	TLSMinVersion       string   // One of "1.0", "1.1", "1.2", "1.3"; defaults to "1.2"
+	TLSCipherSuites     []string // Cipher suite names, as in crypto/tls; defaults to Go's default suites
+	HTTPRedirectPort    uint16   // If set, plain HTTP requests on this port are redirected to HTTPS
+
+	// Format, sampling, per-module levels and sinks of the server's logs. Without sinks, logs are written to a new
+	// file in the -log_dir directory each time the server starts.
+	Logging LoggingCfg
 
 	// Parsed validity
 	tokenValidityDuration time.Duration
@@ -43,13 +224,286 @@ func (cfg ServerCfg) TokenValidityDuration() (time.Duration, error) {
 	return cfg.tokenValidityDuration, err
 }
 
+// RequestTimeoutDuration parses RequestTimeout, returning 0 if it is unset
+func (cfg ServerCfg) RequestTimeoutDuration() (time.Duration, error) {
+	if cfg.RequestTimeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.RequestTimeout)
+}
+
+// SlowRequestThresholdDuration parses SlowRequestThreshold, returning 0 if it is unset
+func (cfg ServerCfg) SlowRequestThresholdDuration() (time.Duration, error) {
+	if cfg.SlowRequestThreshold == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.SlowRequestThreshold)
+}
+
+// SlowQueryThresholdDuration parses SlowQueryThreshold, returning 0 if it is unset
+func (cfg ServerCfg) SlowQueryThresholdDuration() (time.Duration, error) {
+	if cfg.SlowQueryThreshold == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.SlowQueryThreshold)
+}
+
+// ReplayWindowDuration parses ReplayWindow, returning 0 if it is unset
+func (cfg ServerCfg) ReplayWindowDuration() (time.Duration, error) {
+	if cfg.ReplayWindow == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.ReplayWindow)
+}
+
+// ChangeBatchWindowDuration parses ChangeBatchWindow, returning 0 if it is unset
+func (cfg ServerCfg) ChangeBatchWindowDuration() (time.Duration, error) {
+	if cfg.ChangeBatchWindow == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.ChangeBatchWindow)
+}
+
+// IntegrityCheckIntervalDuration parses IntegrityCheckInterval, returning 0 if it is unset
+func (cfg ServerCfg) IntegrityCheckIntervalDuration() (time.Duration, error) {
+	if cfg.IntegrityCheckInterval == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.IntegrityCheckInterval)
+}
+
+// FeatureEnabled returns whether the given feature flag has been turned on. Unknown flags are disabled.
+func (cfg ServerCfg) FeatureEnabled(flag string) bool {
+	return cfg.FeatureFlags[flag]
+}
+
+// ConnMaxLifetimeDuration parses ConnMaxLifetime, returning 0, meaning connections are reused forever, if it is unset
+func (cfg ConnCfg) ConnMaxLifetimeDuration() (time.Duration, error) {
+	if cfg.ConnMaxLifetime == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(cfg.ConnMaxLifetime)
+}
+
+// GitExportCfg configures the mirroring of file contents to a Git remote. Each project is a directory named after its
+// ID, holding the project's files at their relative paths.
+type GitExportCfg struct {
+	Remote           string // URL of the remote to push to; export is disabled if empty
+	Branch           string // Defaults to "master"
+	WorkDir          string // Local clone of the remote; defaults to ./data/gitexport
+	Mode             string // "scrunch" (default) commits each file as it is scrunched; "snapshot" commits every changed file every SnapshotInterval
+	SnapshotInterval string // Defaults to "1h"
+	CommitterName    string // Defaults to "CodeCollaborate"; commit authors are the users that made the changes
+	CommitterEmail   string
+}
+
+// SnapshotIntervalDuration parses SnapshotInterval, defaulting to an hour
+func (cfg GitExportCfg) SnapshotIntervalDuration() (time.Duration, error) {
+	if cfg.SnapshotInterval == "" {
+		return time.Hour, nil
+	}
+	return time.ParseDuration(cfg.SnapshotInterval)
+}
+
+// ChangeFeedCfg configures the change feed, which posts the File notifications of each project, such as File.Change,
+// to webhooks as they are made. If Secret is set, each request is signed with it; see datahandling/changefeed.go.
+type ChangeFeedCfg struct {
+	Webhooks []string // URLs the notifications are posted to; the change feed is disabled if empty
+	Secret   string
+	Interval string // How often projects with new notifications are exported; defaults to "1s"
+}
+
+// IntervalDuration parses Interval, defaulting to a second
+func (cfg ChangeFeedCfg) IntervalDuration() (time.Duration, error) {
+	if cfg.Interval == "" {
+		return time.Second, nil
+	}
+	return time.ParseDuration(cfg.Interval)
+}
+
+// FederationCfg configures the notification bridge, which relays the project notifications published to each peer
+// region's RabbitMQ exchange to this region's; see rabbitmq/bridge.go. Every region runs a bridge, which pulls from all
+// of the others, and every region's exchange has the same Name.
+type FederationCfg struct {
+	Region string            // This region's name; federation is disabled if unset
+	Peers  map[string]string // The name of each peer region -> the ConnectionConfig entry of its RabbitMQ
+	MaxAge string            // How long notifications wait for the bridge before they are dropped; defaults to "5m"
+}
+
+// MaxAgeDuration parses MaxAge, defaulting to 5 minutes
+func (cfg FederationCfg) MaxAgeDuration() (time.Duration, error) {
+	if cfg.MaxAge == "" {
+		return 5 * time.Minute, nil
+	}
+	return time.ParseDuration(cfg.MaxAge)
+}
+
+// PriorityLaneCfg limits the requests of a priority lane. Requests beyond the lane's Workers wait for one of them to
+// finish, and those beyond its QueueLimit waiting are refused with StatusConcurrencyLimited. Unset values use the
+// lane's defaults, and negative ones are unlimited.
+type PriorityLaneCfg struct {
+	Workers    int
+	QueueLimit int
+}
+
+// LoginThrottleCfg limits password guessing. Once an account has had MaxFailures failed logins in a row, or an address
+// IPMaxFailures, further logins to it or from it are refused for Lockout, which doubles with each later failure up to
+// MaxLockout. Failures are counted by each server separately, and forgotten once MaxLockout has passed without any.
+type LoginThrottleCfg struct {
+	Disabled      bool
+	MaxFailures   int    // Defaults to 5
+	IPMaxFailures int    // Defaults to 20
+	Lockout       string // Defaults to "30s"
+	MaxLockout    string // Defaults to "15m"
+}
+
+// LockoutDurations parses Lockout and MaxLockout, applying their defaults
+func (cfg LoginThrottleCfg) LockoutDurations() (lockout time.Duration, maxLockout time.Duration, err error) {
+	lockout, maxLockout = 30*time.Second, 15*time.Minute
+	if cfg.Lockout != "" {
+		if lockout, err = time.ParseDuration(cfg.Lockout); err != nil {
+			return 0, 0, err
+		}
+	}
+	if cfg.MaxLockout != "" {
+		if maxLockout, err = time.ParseDuration(cfg.MaxLockout); err != nil {
+			return 0, 0, err
+		}
+	}
+	if maxLockout < lockout {
+		maxLockout = lockout
+	}
+	return lockout, maxLockout, nil
+}
+
+// MetadataCacheCfg configures the read-through cache of files' metadata and users' permissions on projects. Entries
+// are dropped when the server changes them, but other servers only see such changes once their own entries expire,
+// unless every server shares the cache in Redis, using the "Redis" connection.
+type MetadataCacheCfg struct {
+	Disabled   bool
+	Backend    string // "memory" (the default) or "redis"
+	TTL        string // How long entries are kept; defaults to "10s"
+	MaxEntries int    // memory: the most entries kept; defaults to 100000
+}
+
+// TTLDuration parses TTL, defaulting to 10 seconds
+func (cfg MetadataCacheCfg) TTLDuration() (time.Duration, error) {
+	if cfg.TTL == "" {
+		return 10 * time.Second, nil
+	}
+	return time.ParseDuration(cfg.TTL)
+}
+
+// LatencySLOCfg is a latency objective: the fraction Target of requests within Window should take at most Threshold
+type LatencySLOCfg struct {
+	Threshold string  // Defaults to "100ms"
+	Target    float64 // Defaults to 0.99
+	Window    string  // Defaults to "1h"
+}
+
+// Durations parses Threshold and Window, applying their defaults
+func (cfg LatencySLOCfg) Durations() (threshold time.Duration, window time.Duration, err error) {
+	threshold, window = 100*time.Millisecond, time.Hour
+	if cfg.Threshold != "" {
+		if threshold, err = time.ParseDuration(cfg.Threshold); err != nil {
+			return 0, 0, err
+		}
+	}
+	if cfg.Window != "" {
+		if window, err = time.ParseDuration(cfg.Window); err != nil {
+			return 0, 0, err
+		}
+	}
+	return threshold, window, nil
+}
+
+// TargetFraction returns Target, applying its default
+func (cfg LatencySLOCfg) TargetFraction() float64 {
+	if cfg.Target <= 0 || cfg.Target > 1 {
+		return 0.99
+	}
+	return cfg.Target
+}
+
+// LoggingCfg configures the server's logs. Modules are the package directories that log, such as "dbfs" or
+// "datahandling", and ModuleLevels sets their levels by name, as LogLevel does.
+type LoggingCfg struct {
+	Format           string // "text" or "json"; defaults to "json"
+	ModuleLevels     map[string]string
+	SampleInitial    int // If set, each message is logged at most this many times a second,
+	SampleThereafter int // and then only every SampleThereafter-th time
+	Sinks            []LogSinkCfg
+}
+
+// LogSinkCfg is a destination for the server's logs
+type LogSinkCfg struct {
+	Type       string // "stderr", "stdout", "file" or "syslog"
+	Path       string // file: the log file
+	MaxSizeMB  int    // file: the size at which the file is rotated; 0 never rotates
+	MaxBackups int    // file: the number of rotated files kept; defaults to 5
+	Network    string // syslog: "udp" or "tcp" for a remote daemon; empty for the local one
+	Address    string // syslog: the remote daemon's address
+	Tag        string // syslog: defaults to the server's Name
+}
+
+// FilePolicyCfg limits the size and type of files that may be created. Extensions include their leading dot, and are
+// matched case-insensitively; MIME types are detected from the file's content, and may end in "/*" to match a whole
+// type, such as "image/*". If an allow-list is set, only files that match it may be created.
+type FilePolicyCfg struct {
+	MaxFileSizeBytes  int64 // 0 means unlimited
+	AllowedExtensions []string
+	DeniedExtensions  []string
+	AllowedMIMETypes  []string
+	DeniedMIMETypes   []string
+}
+
+// FileEncryptionCfg configures the AES-256-GCM encryption of file contents on disk. Keys maps key IDs to secret
+// references (see ResolveSecret), such as "vault:secret/data/codecollaborate/files#key", each resolving to a
+// base64-encoded 32-byte key. Files are written with KeyID, and read with the key named in their header; to rotate
+// keys, add a new key and make it the KeyID, keeping the old one until every file has been rewritten.
+type FileEncryptionCfg struct {
+	KeyID string // If empty, files are written unencrypted, but encrypted files can still be read
+	Keys  map[string]string
+}
+
+// OIDCProviderCfg configures an external identity provider
+type OIDCProviderCfg struct {
+	Type           string   // "oidc" (default), or "github", which does not issue ID tokens
+	Issuer         string   // OIDC issuer URL, used for discovery and to validate the iss claim
+	ClientID       string   // Our client ID; the expected audience of ID tokens
+	ClientSecret   string   // Only used for "github", to check that access tokens were issued to us
+	APIURL         string   // Only used for "github"; defaults to https://api.github.com
+	UsernameClaim  string   // Claim used for new usernames; defaults to preferred_username, then email
+	AllowedDomains []string // If set, only users with an email in one of these domains may log in
+}
+
 // ConnCfg represents the information required to make a connection
 type ConnCfg struct {
-	Host       string
-	Port       uint16
-	Username   string
-	Password   string
-	Timeout    uint16
-	NumRetries uint16
-	Schema     string
+	Host           string
+	Port           uint16
+	Username       string
+	Password       string
+	PasswordSecret string // If set, Password is resolved from a secrets provider; see ResolvePassword
+	Timeout        uint16
+	NumRetries     uint16
+	Schema         string
+
+	// Connection management. PoolSize is the number of connections kept open to each Couchbase node, defaulting to
+	// the client's own default. BreakerThreshold is the number of consecutive Couchbase failures after which requests
+	// fail fast until it recovers; defaults to 5.
+	PoolSize         int
+	BreakerThreshold int
+
+	// MySQL connection pool limits, as in database/sql. MaxIdleConns defaults to 2; the others are unlimited if
+	// unset. ConnMaxLifetime is a duration, such as "5m", and should be shorter than the server's wait_timeout.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime string
+
+	// TLS settings; see TLSConfig
+	UseTLS        bool
+	TLSCAFile     string // PEM bundle used to verify the server; defaults to the system roots
+	TLSCertFile   string // PEM client certificate, for mutual TLS
+	TLSKeyFile    string
+	TLSSkipVerify bool // Disables server certificate verification. Never use in production.
 }
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+/**
+ * Network access settings for the CodeCollaborate Server's listener: which client addresses are allowed to connect,
+ * and which proxies are trusted to report the addresses of the clients behind them.
+ */
+
+// NetworkPolicy is the parsed form of AllowedNetworks, DeniedNetworks and TrustedProxies
+type NetworkPolicy struct {
+	allowed        []*net.IPNet
+	denied         []*net.IPNet
+	trustedProxies []*net.IPNet
+}
+
+// NetworkPolicy parses the server's network lists
+func (cfg ServerCfg) NetworkPolicy() (*NetworkPolicy, error) {
+	allowed, err := ParseNetworks(cfg.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("AllowedNetworks: %v", err)
+	}
+	denied, err := ParseNetworks(cfg.DeniedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("DeniedNetworks: %v", err)
+	}
+	trustedProxies, err := ParseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("TrustedProxies: %v", err)
+	}
+	return &NetworkPolicy{allowed: allowed, denied: denied, trustedProxies: trustedProxies}, nil
+}
+
+// ParseNetworks parses CIDRs, such as "10.0.0.0/8", and single addresses, which match only themselves
+func ParseNetworks(networks []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(networks))
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if !strings.Contains(network, "/") {
+			ip := net.ParseIP(network)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", network)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns whether a client at the given address may connect. Denied networks take precedence over allowed
+// ones, and if no networks are allowed, every address that isn't denied is.
+func (policy *NetworkPolicy) Allows(ip net.IP) bool {
+	if containsIP(policy.denied, ip) {
+		return false
+	}
+	return len(policy.allowed) == 0 || containsIP(policy.allowed, ip)
+}
+
+// TrustsProxy returns whether the given address is a trusted proxy
+func (policy *NetworkPolicy) TrustsProxy(ip net.IP) bool {
+	return containsIP(policy.trustedProxies, ip)
+}
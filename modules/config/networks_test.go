@@ -0,0 +1,35 @@
+package config
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkPolicy(t *testing.T) {
+	policy, err := ServerCfg{}.NetworkPolicy()
+	assert.Nil(t, err)
+	assert.True(t, policy.Allows(net.ParseIP("203.0.113.9")), "should allow everyone by default")
+	assert.False(t, policy.TrustsProxy(net.ParseIP("127.0.0.1")))
+
+	policy, err = ServerCfg{
+		AllowedNetworks: []string{"10.0.0.0/8", "2001:db8::/32", "203.0.113.9"},
+		DeniedNetworks:  []string{"10.1.0.0/16"},
+		TrustedProxies:  []string{"127.0.0.1"},
+	}.NetworkPolicy()
+	assert.Nil(t, err)
+	assert.True(t, policy.Allows(net.ParseIP("10.2.3.4")))
+	assert.True(t, policy.Allows(net.ParseIP("2001:db8::1")))
+	assert.True(t, policy.Allows(net.ParseIP("203.0.113.9")))
+	assert.True(t, policy.Allows(net.ParseIP("::ffff:203.0.113.9")), "IPv4-mapped addresses are the same address")
+	assert.False(t, policy.Allows(net.ParseIP("203.0.113.10")))
+	assert.False(t, policy.Allows(net.ParseIP("10.1.2.3")), "denied networks should take precedence")
+	assert.True(t, policy.TrustsProxy(net.ParseIP("127.0.0.1")))
+	assert.False(t, policy.TrustsProxy(net.ParseIP("127.0.0.2")))
+
+	_, err = ServerCfg{DeniedNetworks: []string{"10.0.0.0/33"}}.NetworkPolicy()
+	assert.NotNil(t, err)
+	_, err = ServerCfg{TrustedProxies: []string{"localhost"}}.NetworkPolicy()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+/**
+ * Environment variable and command-line flag overrides for the CodeCollaborate Server configuration.
+ *
+ * Every exported field of ServerCfg and ConnCfg holding a string, bool, number, list of strings or feature flags can
+ * be overridden, including those of the structs they contain. Values are layered with the precedence
+ * env > flag > file. Server fields use the "server" prefix, connection fields use the lowercased connection name, and
+ * the fields of contained structs are prefixed with the name of the field holding them:
+ *
+ *	ServerCfg.Port                        -server_port                          CC_SERVER_PORT
+ *	ServerCfg.MinBufferLength             -server_min_buffer_length             CC_SERVER_MIN_BUFFER_LENGTH
+ *	ServerCfg.LoginThrottle.MaxFailures   -server_login_throttle_max_failures   CC_SERVER_LOGIN_THROTTLE_MAX_FAILURES
+ *	ConnCfgMap["MySQL"].Host              -mysql_host                           CC_MYSQL_HOST
+ *
+ * Lists are given as comma separated values, and feature flags as a comma separated list of "name" or "name=bool"
+ * entries. Other maps, such as MinClientVersions and PriorityLanes, can only be set in the config files.
+ */
+
+const (
+	envPrefix        = "CC_"
+	serverOverrideID = "server"
+)
+
+// overrideValue records a single command-line override; it implements flag.Value.
+type overrideValue struct {
+	value string
+	set   bool
+}
+
+func (v *overrideValue) String() string {
+	return v.value
+}
+
+func (v *overrideValue) Set(value string) error {
+	v.value = value
+	v.set = true
+	return nil
+}
+
+var overrideFlagsMutex sync.Mutex
+var overrideFlags = make(map[string]*overrideValue)
+var overrideConnNames = make(map[string]bool)
+
+// RegisterFlags registers a command-line flag for every ServerCfg field, and every ConnCfg field of each
+// of the given connections. Must be called before the FlagSet is parsed. Flags that are not explicitly set
+// on the command line do not override the config files.
+func RegisterFlags(fs *flag.FlagSet, connNames ...string) {
+	overrideFlagsMutex.Lock()
+	defer overrideFlagsMutex.Unlock()
+
+	registerStructFlags(fs, serverOverrideID, reflect.TypeOf(ServerCfg{}), "server config")
+	for _, connName := range connNames {
+		overrideConnNames[connName] = true
+		registerStructFlags(fs, strings.ToLower(connName), reflect.TypeOf(ConnCfg{}), connName+" connection config")
+	}
+}
+
+func registerStructFlags(fs *flag.FlagSet, prefix string, structType reflect.Type, description string) {
+	walkOverridableFields(structType, prefix, nil, "", func(index []int, name string, path string) {
+		value := &overrideValue{}
+		overrideFlags[name] = value
+		fs.Var(value, name, fmt.Sprintf("overrides %s field %s (env: %s)", description, path, envName(name)))
+	})
+}
+
+// walkOverridableFields calls visit with the index, override name and path of each field of the struct that can be
+// overridden, descending into the structs it contains
+func walkOverridableFields(structType reflect.Type, prefix string, index []int, path string,
+	visit func(index []int, name string, path string)) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name := overrideName(prefix, field.Name)
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Type.Kind() == reflect.Struct {
+			walkOverridableFields(field.Type, name, fieldIndex, path+field.Name+".", visit)
+		} else if overridable(field.Type) {
+			visit(fieldIndex, name, path+field.Name)
+		}
+	}
+}
+
+// overridable returns whether setField can parse values for fields of the type
+func overridable(fieldType reflect.Type) bool {
+	switch fieldType.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return fieldType.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return fieldType == reflect.TypeOf(map[string]bool{})
+	}
+	return false
+}
+
+// applyOverrides layers the command-line flags, and then the environment variables on top of the config parsed from file.
+func applyOverrides(cfg *Config) error {
+	if err := applyStructOverrides(reflect.ValueOf(&cfg.ServerConfig).Elem(), serverOverrideID); err != nil {
+		return err
+	}
+
+	if cfg.ConnectionConfig == nil {
+		cfg.ConnectionConfig = ConnCfgMap{}
+	}
+
+	for _, connName := range overrideConnectionNames(cfg.ConnectionConfig) {
+		connCfg := cfg.ConnectionConfig[connName]
+		if err := applyStructOverrides(reflect.ValueOf(&connCfg).Elem(), strings.ToLower(connName)); err != nil {
+			return err
+		}
+		// Don't create connections for registered flags that were never used.
+		if _, ok := cfg.ConnectionConfig[connName]; ok || connCfg != (ConnCfg{}) {
+			cfg.ConnectionConfig[connName] = connCfg
+		}
+	}
+
+	return nil
+}
+
+func overrideConnectionNames(connCfgs ConnCfgMap) []string {
+	overrideFlagsMutex.Lock()
+	defer overrideFlagsMutex.Unlock()
+
+	names := []string{}
+	for name := range connCfgs {
+		names = append(names, name)
+	}
+	for name := range overrideConnNames {
+		if _, ok := connCfgs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func applyStructOverrides(structValue reflect.Value, prefix string) error {
+	var err error
+	walkOverridableFields(structValue.Type(), prefix, nil, "", func(index []int, name string, path string) {
+		if err != nil {
+			return
+		}
+		field := structValue.FieldByIndex(index)
+
+		overrideFlagsMutex.Lock()
+		flagValue, ok := overrideFlags[name]
+		overrideFlagsMutex.Unlock()
+		if ok && flagValue.set {
+			if setErr := setField(field, flagValue.value); setErr != nil {
+				err = fmt.Errorf("invalid value for flag -%s: %v", name, setErr)
+				return
+			}
+		}
+
+		if envValue, ok := os.LookupEnv(envName(name)); ok {
+			if setErr := setField(field, envValue); setErr != nil {
+				err = fmt.Errorf("invalid value for environment variable %s: %v", envName(name), setErr)
+			}
+		}
+	})
+	return err
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		values := []string{}
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				values = append(values, entry)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	case reflect.Map:
+		if field.Type() != reflect.TypeOf(map[string]bool{}) {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		flags, err := parseFeatureFlags(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(flags))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// parseFeatureFlags parses a comma separated list of "name" or "name=bool" entries.
+func parseFeatureFlags(value string) (map[string]bool, error) {
+	flags := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		enabled := true
+		if len(parts) == 2 {
+			var err error
+			enabled, err = strconv.ParseBool(parts[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		flags[strings.TrimSpace(parts[0])] = enabled
+	}
+	return flags, nil
+}
+
+// overrideName builds the flag name for the given field, converting the CamelCase field name to snake_case.
+// Runs of capitals are treated as a single word, so UseTLS becomes use_tls.
+func overrideName(prefix string, fieldName string) string {
+	runes := []rune(fieldName)
+	name := []rune(prefix + "_")
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToLower(r))
+	}
+	return string(name)
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(flagName)
+}
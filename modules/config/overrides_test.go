@@ -0,0 +1,121 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resetOverrideFlags() {
+	overrideFlagsMutex.Lock()
+	defer overrideFlagsMutex.Unlock()
+
+	overrideFlags = make(map[string]*overrideValue)
+	overrideConnNames = make(map[string]bool)
+}
+
+func TestOverrideName(t *testing.T) {
+	assert.Equal(t, "server_port", overrideName("server", "Port"))
+	assert.Equal(t, "server_min_buffer_length", overrideName("server", "MinBufferLength"))
+	assert.Equal(t, "server_use_tls", overrideName("server", "UseTLS"))
+	assert.Equal(t, "mysql_num_retries", overrideName("mysql", "NumRetries"))
+	assert.Equal(t, "CC_MYSQL_HOST", envName(overrideName("mysql", "Host")))
+}
+
+func TestApplyOverridesPrecedence(t *testing.T) {
+	resetOverrideFlags()
+	defer resetOverrideFlags()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs, "MySQL", "Couchbase")
+	err := fs.Parse([]string{"-server_port=9000", "-server_log_level=Info", "-mysql_host=flagHost", "-mysql_port=3307"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("CC_SERVER_LOG_LEVEL", "Debug")
+	os.Setenv("CC_MYSQL_HOST", "envHost")
+	os.Setenv("CC_SERVER_FEATURE_FLAGS", "a, b=false")
+	os.Setenv("CC_SERVER_TLS_CIPHER_SUITES", "suiteA,suiteB")
+	defer os.Unsetenv("CC_SERVER_LOG_LEVEL")
+	defer os.Unsetenv("CC_MYSQL_HOST")
+	defer os.Unsetenv("CC_SERVER_FEATURE_FLAGS")
+	defer os.Unsetenv("CC_SERVER_TLS_CIPHER_SUITES")
+
+	cfg := &Config{
+		ServerConfig: ServerCfg{
+			Name:     "CodeCollaborate",
+			Port:     80,
+			LogLevel: "Warn",
+		},
+		ConnectionConfig: ConnCfgMap{
+			"MySQL": ConnCfg{
+				Host:     "fileHost",
+				Port:     3306,
+				Username: "user1",
+			},
+		},
+	}
+
+	err = applyOverrides(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "CodeCollaborate", cfg.ServerConfig.Name, "unset fields should come from file")
+	assert.Equal(t, uint16(9000), cfg.ServerConfig.Port, "flag should override file")
+	assert.Equal(t, "Debug", cfg.ServerConfig.LogLevel, "env should override flag")
+	assert.Equal(t, map[string]bool{"a": true, "b": false}, cfg.ServerConfig.FeatureFlags)
+	assert.Equal(t, []string{"suiteA", "suiteB"}, cfg.ServerConfig.TLSCipherSuites)
+	assert.Equal(t, ConnCfg{Host: "envHost", Port: 3307, Username: "user1"}, cfg.ConnectionConfig["MySQL"])
+
+	_, ok := cfg.ConnectionConfig["Couchbase"]
+	assert.False(t, ok, "connections without overrides should not be created")
+}
+
+func TestApplyOverridesInvalidValue(t *testing.T) {
+	os.Setenv("CC_SERVER_PORT", "notANumber")
+	defer os.Unsetenv("CC_SERVER_PORT")
+
+	err := applyOverrides(&Config{})
+	if err == nil {
+		t.Fatal("Invalid port override. Should have failed.")
+	}
+}
+
+func TestApplyOverridesNested(t *testing.T) {
+	resetOverrideFlags()
+	defer resetOverrideFlags()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterFlags(fs)
+	err := fs.Parse([]string{"-server_login_throttle_max_failures=3", "-server_git_export_branch=main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CC_SERVER_LOGIN_THROTTLE_LOCKOUT", "2m")
+	defer os.Unsetenv("CC_SERVER_LOGIN_THROTTLE_LOCKOUT")
+
+	cfg := &Config{ServerConfig: ServerCfg{LoginThrottle: LoginThrottleCfg{MaxFailures: 10, IPMaxFailures: 30}}}
+	err = applyOverrides(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, cfg.ServerConfig.LoginThrottle.MaxFailures)
+	assert.Equal(t, 30, cfg.ServerConfig.LoginThrottle.IPMaxFailures, "unset fields should come from file")
+	assert.Equal(t, "2m", cfg.ServerConfig.LoginThrottle.Lockout)
+	assert.Equal(t, "main", cfg.ServerConfig.GitExport.Branch)
+
+	// Fields that can't be parsed from a single value are only set in the config files
+	assert.Nil(t, fs.Lookup("server_login_throttle"))
+	assert.Nil(t, fs.Lookup("server_min_client_versions"))
+	assert.Nil(t, fs.Lookup("server_priority_lanes"))
+
+	// Every flag that is registered can be applied
+	fs.VisitAll(func(f *flag.Flag) {
+		assert.NoError(t, fs.Set(f.Name, "1"))
+	})
+	assert.NoError(t, applyOverrides(&Config{}))
+}
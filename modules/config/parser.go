@@ -26,6 +26,10 @@ func parseConfig(filepath string) (*Config, error) {
 		ConnectionConfig: *connectionConfig,
 	}
 
+	if err := applyOverrides(config); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
 
@@ -2,54 +2,147 @@ package config
 
 import "errors"
 
-// PermissionsByLabel is the permission constants for API access levels
-var PermissionsByLabel = map[string]int8{
-	"read":  1,
-	"write": 4,
-	"admin": 8,
-	"owner": 10,
+/**
+ * Project roles.
+ *
+ * Every permission a user (or team) holds on a project is one of the roles below, and what a role may do is decided
+ * solely by its capabilities. Roles are stored by level, so that the effective role of a user with several grants
+ * (directly, through teams, or as owner) is simply the highest level; levels must therefore increase with privilege.
+ */
+
+// Capability is a single action that a role may allow on a project
+type Capability string
+
+// Project capabilities
+const (
+	CapabilityViewProject    Capability = "ViewProject"    // Look up the project, pull files, and subscribe to changes
+	CapabilityEditFiles      Capability = "EditFiles"      // Create, change, move, rename and delete files
+	CapabilityRenameProject  Capability = "RenameProject"  // Rename the project
+	CapabilityManageAccess   Capability = "ManageAccess"   // Grant and revoke users' and teams' access
+	CapabilityManageSettings Capability = "ManageSettings" // Change the project's settings, such as its line endings
+	CapabilityDeleteProject  Capability = "DeleteProject"  // Delete the project
+)
+
+// Role is a named set of capabilities on a project
+type Role struct {
+	Name         string
+	Level        int8
+	Capabilities []Capability
 }
 
-// Permission is the struct representation of an API permission level
-type Permission struct {
-	Level int8
-	Label string
+// The project roles, from least to most privileged
+var (
+	ReadRole = Role{
+		Name:         "read",
+		Level:        1,
+		Capabilities: []Capability{CapabilityViewProject},
+	}
+	WriteRole = Role{
+		Name:         "write",
+		Level:        4,
+		Capabilities: []Capability{CapabilityViewProject, CapabilityEditFiles, CapabilityRenameProject},
+	}
+	AdminRole = Role{
+		Name:  "admin",
+		Level: 8,
+		Capabilities: []Capability{CapabilityViewProject, CapabilityEditFiles, CapabilityRenameProject, CapabilityManageAccess,
+			CapabilityManageSettings},
+	}
+	// OwnerRole is held only by the project's creator, and cannot be granted
+	OwnerRole = Role{
+		Name:  "owner",
+		Level: 10,
+		Capabilities: []Capability{CapabilityViewProject, CapabilityEditFiles, CapabilityRenameProject,
+			CapabilityManageAccess, CapabilityManageSettings, CapabilityDeleteProject},
+	}
+)
+
+// Roles lists every project role, from least to most privileged
+var Roles = []Role{ReadRole, WriteRole, AdminRole, OwnerRole}
+
+// Can returns true if the role has the given capability
+func (r Role) Can(capability Capability) bool {
+	for _, c := range r.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoMatchingRole is returned if a role that does not exist is attempted to be accessed
+var ErrNoMatchingRole = errors.New("Not a valid project role")
+
+// RoleByName returns the role with the given name, if found
+func RoleByName(name string) (Role, error) {
+	for _, role := range Roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+	return Role{}, ErrNoMatchingRole
+}
+
+// RoleByLevel returns the role stored as the given level, if found
+func RoleByLevel(level int8) (Role, error) {
+	for _, role := range Roles {
+		if role.Level == level {
+			return role, nil
+		}
+	}
+	return Role{}, ErrNoMatchingRole
 }
 
-// internal map in other direction
-var byLevel map[int8]string
+// EffectiveRole returns the most privileged role whose level does not exceed the given one. Levels stored before roles
+// were introduced may fall between roles; they are rounded down, so they never grant more than they used to. Returns
+// false if the level is below every role, meaning no access.
+func EffectiveRole(level int8) (Role, bool) {
+	for i := len(Roles) - 1; i >= 0; i-- {
+		if Roles[i].Level <= level {
+			return Roles[i], true
+		}
+	}
+	return Role{}, false
+}
+
+// PermissionsByLabel maps role names to their levels, for clients that still send numeric permission levels
+var PermissionsByLabel = make(map[string]int8)
 
-// initialize maps
 func init() {
-	byLevel = make(map[int8]string)
-	for label, level := range PermissionsByLabel {
-		byLevel[level] = label
+	for _, role := range Roles {
+		PermissionsByLabel[role.Name] = role.Level
 	}
 }
 
+// Permission is the struct representation of an API permission level
+type Permission struct {
+	Level int8
+	Label string
+}
+
 // ErrNoMatchingPermission is returned if a permission that does not exist is attempted to be accessed
-var ErrNoMatchingPermission = errors.New("Not a valid server permission level")
+var ErrNoMatchingPermission = ErrNoMatchingRole
 
 // PermissionByLevel returns the string representation of the provided level, if found
 func PermissionByLevel(level int8) (Permission, error) {
-	label, ok := byLevel[level]
-	if !ok {
-		return Permission{}, ErrNoMatchingPermission
+	role, err := RoleByLevel(level)
+	if err != nil {
+		return Permission{}, err
 	}
 	return Permission{
-		Label: label,
-		Level: level,
+		Label: role.Name,
+		Level: role.Level,
 	}, nil
 }
 
 // PermissionByLabel returns the int8 representation of the provided label, if found
 func PermissionByLabel(label string) (Permission, error) {
-	level, ok := PermissionsByLabel[label]
-	if !ok {
-		return Permission{}, ErrNoMatchingPermission
+	role, err := RoleByName(label)
+	if err != nil {
+		return Permission{}, err
 	}
 	return Permission{
-		Level: level,
-		Label: label,
+		Level: role.Level,
+		Label: role.Name,
 	}, nil
 }
@@ -21,3 +21,42 @@ func TestGetPermissionLevel(t *testing.T) {
 		assert.Equal(t, level, permission.Level, "unexpected permission label")
 	}
 }
+
+func TestRoles(t *testing.T) {
+	for i := 1; i < len(Roles); i++ {
+		lower, higher := Roles[i-1], Roles[i]
+		assert.True(t, lower.Level < higher.Level, "roles should be ordered by level")
+		for _, capability := range lower.Capabilities {
+			assert.True(t, higher.Can(capability), "%s should be able to do everything %s can", higher.Name, lower.Name)
+		}
+	}
+
+	assert.True(t, OwnerRole.Can(CapabilityDeleteProject))
+	assert.False(t, AdminRole.Can(CapabilityDeleteProject))
+	assert.False(t, ReadRole.Can(CapabilityEditFiles))
+
+	_, err := RoleByName("superuser")
+	assert.Equal(t, ErrNoMatchingRole, err)
+}
+
+func TestEffectiveRole(t *testing.T) {
+	tests := []struct {
+		level int8
+		role  string
+		ok    bool
+	}{
+		{0, "", false},
+		{1, "read", true},
+		{3, "read", true},
+		{4, "write", true},
+		{9, "admin", true},
+		{10, "owner", true},
+		{127, "owner", true},
+	}
+
+	for _, test := range tests {
+		role, ok := EffectiveRole(test.level)
+		assert.Equal(t, test.ok, ok, "level %d", test.level)
+		assert.Equal(t, test.role, role.Name, "level %d", test.level)
+	}
+}
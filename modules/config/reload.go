@@ -0,0 +1,181 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Hot-reloading of the configuration for the CodeCollaborate Server.
+ */
+
+// ChangeHandler is called once a new configuration has been applied. oldCfg is nil for the initial load.
+type ChangeHandler func(oldCfg, newCfg *Config)
+
+var changeHandlersMutex sync.Mutex
+var changeHandlers = make(map[string]ChangeHandler)
+
+// OnChange registers the handler under the given name, replacing any handler previously registered with that name.
+// Handlers are called after every successful LoadConfig or ReloadConfig.
+func OnChange(name string, handler ChangeHandler) {
+	changeHandlersMutex.Lock()
+	defer changeHandlersMutex.Unlock()
+
+	changeHandlers[name] = handler
+}
+
+// RemoveOnChange removes the handler registered under the given name, if any.
+func RemoveOnChange(name string) {
+	changeHandlersMutex.Lock()
+	defer changeHandlersMutex.Unlock()
+
+	delete(changeHandlers, name)
+}
+
+func notifyChange(oldCfg, newCfg *Config) {
+	changeHandlersMutex.Lock()
+	names := make([]string, 0, len(changeHandlers))
+	for name := range changeHandlers {
+		names = append(names, name)
+	}
+	handlers := make(map[string]ChangeHandler, len(changeHandlers))
+	for name, handler := range changeHandlers {
+		handlers[name] = handler
+	}
+	changeHandlersMutex.Unlock()
+
+	// Run in a stable order, so that reloads behave the same every time.
+	sort.Strings(names)
+	for _, name := range names {
+		handlers[name](oldCfg, newCfg)
+	}
+}
+
+// ReloadConfig re-reads the configuration from the configDir, and applies the values that are safe to change while
+// the server is running: the log level, token validity, scrunching buffer lengths, feature flags, maintenance mode,
+// minimum client versions, and connection timeouts and retry counts. Changes to any other value are logged, and require a restart to take effect.
+func ReloadConfig() error {
+	parsed, err := parseConfig(configDir)
+	if err != nil {
+		utils.LogError("Failed to reload configuration; keeping current configuration", err, utils.LogFields{
+			"ConfigDir": configDir,
+		})
+		return err
+	}
+
+	configMutex.Lock()
+	oldCfg := config
+	if oldCfg == nil {
+		config = parsed
+	} else {
+		config = applySafeChanges(oldCfg, parsed)
+	}
+	newCfg := config
+	configMutex.Unlock()
+
+	utils.LogInfo("Reloaded Configuration", utils.LogFields{
+		"ConfigDir": configDir,
+	})
+	setLogLevel()
+	notifyChange(oldCfg, newCfg)
+
+	return nil
+}
+
+// applySafeChanges returns a copy of the current config, updated with the values from the parsed config that can be
+// changed without restarting the server.
+func applySafeChanges(current, parsed *Config) *Config {
+	updated := *current
+
+	updated.ServerConfig.LogLevel = parsed.ServerConfig.LogLevel
+	updated.ServerConfig.Logging = parsed.ServerConfig.Logging
+	updated.ServerConfig.TokenValidity = parsed.ServerConfig.TokenValidity
+	updated.ServerConfig.tokenValidityDuration = 0
+	updated.ServerConfig.MinBufferLength = parsed.ServerConfig.MinBufferLength
+	updated.ServerConfig.MaxBufferLength = parsed.ServerConfig.MaxBufferLength
+	updated.ServerConfig.FeatureFlags = parsed.ServerConfig.FeatureFlags
+	updated.ServerConfig.Maintenance = parsed.ServerConfig.Maintenance
+	updated.ServerConfig.MinClientVersions = parsed.ServerConfig.MinClientVersions
+
+	// Everything else must match, otherwise a restart is needed.
+	if !reflect.DeepEqual(updated.ServerConfig, parsed.ServerConfig) {
+		utils.LogWarn("Server configuration changed values that cannot be reloaded; restart to apply", nil)
+	}
+
+	updated.ConnectionConfig = make(ConnCfgMap, len(current.ConnectionConfig))
+	for name, connCfg := range current.ConnectionConfig {
+		if parsedConnCfg, ok := parsed.ConnectionConfig[name]; ok {
+			connCfg.Timeout = parsedConnCfg.Timeout
+			connCfg.NumRetries = parsedConnCfg.NumRetries
+
+			if connCfg != parsedConnCfg {
+				utils.LogWarn("Connection configuration changed values that cannot be reloaded; restart to apply", utils.LogFields{
+					"Connection": name,
+				})
+			}
+		}
+		updated.ConnectionConfig[name] = connCfg
+	}
+
+	return &updated
+}
+
+// WatchConfig reloads the configuration whenever the process receives a SIGHUP, or, if pollInterval is non-zero,
+// whenever the modification time of one of the config files changes. The watcher stops once ctrl.Exit is signalled.
+func WatchConfig(pollInterval time.Duration, ctrl *utils.Control) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	lastModified := configModTime()
+
+	go func() {
+		defer signal.Stop(hangup)
+
+		var poll <-chan time.Time
+		if pollInterval > 0 {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctrl.Exit:
+				return
+			case <-hangup:
+				utils.LogInfo("Received SIGHUP, reloading configuration", nil)
+				lastModified = configModTime()
+				ReloadConfig()
+			case <-poll:
+				modified := configModTime()
+				if modified.After(lastModified) {
+					lastModified = modified
+					ReloadConfig()
+				}
+			}
+		}
+	}()
+}
+
+// configModTime returns the latest modification time of the config files, or the zero time if none could be read.
+func configModTime() time.Time {
+	var latest time.Time
+	for _, filename := range []string{"server.cfg", "conn.cfg"} {
+		info, err := os.Stat(filepath.Join(configDir, filename))
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
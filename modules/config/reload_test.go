@@ -0,0 +1,86 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFiles(t *testing.T, dir string, serverContent string, connContent string) {
+	err := ioutil.WriteFile(filepath.Join(dir, "server.cfg"), []byte(serverContent), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "conn.cfg"), []byte(connContent), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	tmpDir := createTmpDir(t, ".", "test-config-files")
+	defer os.RemoveAll(tmpDir)
+	SetConfigDir(tmpDir)
+
+	writeConfigFiles(t, tmpDir,
+		"{\"Name\": \"CodeCollaborate\",\"Port\": 80,\"LogLevel\": \"Warn\"}",
+		"{\"MySQL\": {\"Host\": \"mysqlHost\",\"Port\": 3306,\"NumRetries\": 3}}")
+	err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfigFiles(t, tmpDir,
+		"{\"Name\": \"CodeCollaborate\",\"Port\": 8080,\"LogLevel\": \"Debug\",\"FeatureFlags\": {\"test\": true},\"Maintenance\": true}",
+		"{\"MySQL\": {\"Host\": \"otherHost\",\"Port\": 3306,\"NumRetries\": 5}}")
+
+	var oldSeen, newSeen *Config
+	OnChange("test", func(oldCfg, newCfg *Config) {
+		oldSeen = oldCfg
+		newSeen = newCfg
+	})
+	defer RemoveOnChange("test")
+
+	err = ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := GetConfig()
+	assert.Equal(t, "Debug", cfg.ServerConfig.LogLevel, "log level should have been reloaded")
+	assert.True(t, cfg.ServerConfig.FeatureEnabled("test"), "feature flags should have been reloaded")
+	assert.False(t, cfg.ServerConfig.FeatureEnabled("other"), "unknown feature flags should be disabled")
+	assert.True(t, cfg.ServerConfig.Maintenance, "maintenance mode should have been reloaded")
+	assert.Equal(t, uint16(80), cfg.ServerConfig.Port, "port should not be reloaded")
+	assert.Equal(t, uint16(5), cfg.ConnectionConfig["MySQL"].NumRetries, "retry count should have been reloaded")
+	assert.Equal(t, "mysqlHost", cfg.ConnectionConfig["MySQL"].Host, "host should not be reloaded")
+
+	assert.NotNil(t, oldSeen, "change handler was not called with the old config")
+	assert.Equal(t, "Warn", oldSeen.ServerConfig.LogLevel, "old config should not have been mutated")
+	assert.Equal(t, cfg, newSeen, "change handler was not called with the new config")
+}
+
+func TestReloadConfigInvalidKeepsCurrent(t *testing.T) {
+	tmpDir := createTmpDir(t, ".", "test-config-files")
+	defer os.RemoveAll(tmpDir)
+	SetConfigDir(tmpDir)
+
+	writeConfigFiles(t, tmpDir,
+		"{\"Name\": \"CodeCollaborate\",\"Port\": 80,\"LogLevel\": \"Warn\"}",
+		"{}")
+	err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfigFiles(t, tmpDir, "{\"InvalidJson\"}", "{}")
+
+	err = ReloadConfig()
+	if err == nil {
+		t.Fatal("Invalid JSON input. Should have failed.")
+	}
+	assert.Equal(t, "Warn", GetConfig().ServerConfig.LogLevel, "config should not change on a failed reload")
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Secrets resolution for connection credentials.
+ *
+ * A ConnCfg may set PasswordSecret instead of Password, in the form "<provider>:<reference>". The reference is passed
+ * as-is to the provider registered for that scheme, for example:
+ *
+ *	file:/run/secrets/mysql_password
+ *	vault:secret/data/codecollaborate/mysql#password
+ *	aws:prod/codecollaborate/mysql#password
+ *
+ * Resolved secrets are cached until their TTL expires, or they are invalidated after a failed connection attempt, so
+ * that rotated credentials are picked up on the next connect without a redeploy.
+ */
+
+// DefaultSecretTTL is how long a resolved secret is cached when the provider does not specify a lease.
+var DefaultSecretTTL = 5 * time.Minute
+
+// ErrUnknownSecretsProvider is returned when a secret reference uses a scheme that has no registered provider.
+var ErrUnknownSecretsProvider = errors.New("No secrets provider registered for the given scheme")
+
+// ErrInvalidSecretRef is returned when a secret reference is not of the form "<provider>:<reference>".
+var ErrInvalidSecretRef = errors.New("Secret references must be of the form <provider>:<reference>")
+
+// SecretsProvider fetches secrets from an external store. A ttl of 0 uses DefaultSecretTTL.
+type SecretsProvider interface {
+	GetSecret(ref string) (secret string, ttl time.Duration, err error)
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+var secretsMutex sync.Mutex
+var secretsProviders = map[string]SecretsProvider{
+	"file":  fileSecretsProvider{},
+	"vault": newVaultSecretsProvider(),
+	"aws":   newAWSSecretsProvider(),
+}
+var secretsCache = make(map[string]cachedSecret)
+
+// RegisterSecretsProvider registers the provider for the given scheme, replacing any existing provider.
+// A nil provider unregisters the scheme.
+func RegisterSecretsProvider(scheme string, provider SecretsProvider) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	if provider == nil {
+		delete(secretsProviders, scheme)
+	} else {
+		secretsProviders[scheme] = provider
+	}
+	for ref := range secretsCache {
+		if strings.HasPrefix(ref, scheme+":") {
+			delete(secretsCache, ref)
+		}
+	}
+}
+
+// ResolveSecret returns the secret for the given reference, fetching it from its provider if it is not cached.
+func ResolveSecret(secretRef string) (string, error) {
+	parts := strings.SplitN(secretRef, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", ErrInvalidSecretRef
+	}
+
+	secretsMutex.Lock()
+	if cached, ok := secretsCache[secretRef]; ok && time.Now().Before(cached.expires) {
+		secretsMutex.Unlock()
+		return cached.value, nil
+	}
+	provider, ok := secretsProviders[parts[0]]
+	secretsMutex.Unlock()
+
+	if !ok {
+		return "", ErrUnknownSecretsProvider
+	}
+
+	secret, ttl, err := provider.GetSecret(parts[1])
+	if err != nil {
+		return "", err
+	}
+	if ttl <= 0 {
+		ttl = DefaultSecretTTL
+	}
+
+	secretsMutex.Lock()
+	secretsCache[secretRef] = cachedSecret{
+		value:   secret,
+		expires: time.Now().Add(ttl),
+	}
+	secretsMutex.Unlock()
+
+	return secret, nil
+}
+
+// InvalidateSecret drops the cached value for the given reference, forcing the next ResolveSecret to refetch it.
+// Should be called when a connection is rejected, in case the credentials were rotated.
+func InvalidateSecret(secretRef string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	delete(secretsCache, secretRef)
+}
+
+// ResolvePassword returns the password to connect with, resolving PasswordSecret if it has been set.
+func (cfg ConnCfg) ResolvePassword() (string, error) {
+	if cfg.PasswordSecret == "" {
+		return cfg.Password, nil
+	}
+	password, err := ResolveSecret(cfg.PasswordSecret)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve secret %q: %v", cfg.PasswordSecret, err)
+	}
+	return password, nil
+}
+
+// InvalidatePassword drops the cached PasswordSecret, if one is set.
+func (cfg ConnCfg) InvalidatePassword() {
+	if cfg.PasswordSecret != "" {
+		InvalidateSecret(cfg.PasswordSecret)
+	}
+}
+
+// fileSecretsProvider reads secrets from files, such as those mounted by Docker or Kubernetes.
+// The file is reread on every cache expiry, so rotation only requires replacing the file.
+type fileSecretsProvider struct{}
+
+func (fileSecretsProvider) GetSecret(ref string) (string, time.Duration, error) {
+	contents, err := ioutil.ReadFile(ref)
+	if err != nil {
+		return "", 0, err
+	}
+	return strings.TrimRight(string(contents), "\r\n"), 0, nil
+}
+
+// splitSecretKey splits a "path#key" reference into its path and key; key is empty if not given.
+func splitSecretKey(ref string) (string, string) {
+	if idx := strings.LastIndex(ref, "#"); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+// awsSecretsProvider reads secrets from AWS Secrets Manager, signing requests with Signature Version 4. Credentials and
+// region are read from the standard AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and AWS_REGION
+// environment variables.
+//
+// References are of the form "<secret id>#<key>". If key is given, the secret string is parsed as a JSON object and the
+// value under that key is returned; otherwise the whole secret string is returned.
+type awsSecretsProvider struct {
+	client *http.Client
+	// endpoint overrides the regional endpoint; used for testing.
+	endpoint string
+	now      func() time.Time
+}
+
+func newAWSSecretsProvider() *awsSecretsProvider {
+	return &awsSecretsProvider{
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (p *awsSecretsProvider) GetSecret(ref string) (string, time.Duration, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", 0, fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	secretID, key := splitSecretKey(ref)
+	payload, err := json.Marshal(struct {
+		SecretId string
+	}{secretID})
+	if err != nil {
+		return "", 0, err
+	}
+
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSRequestV4(req, payload, "secretsmanager", region, accessKey, secretKey, p.now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("secrets manager returned status %d: %s", resp.StatusCode, respBody)
+	}
+
+	result := struct {
+		SecretString string
+	}{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", 0, err
+	}
+
+	if key == "" {
+		return result.SecretString, 0, nil
+	}
+
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(result.SecretString), &values); err != nil {
+		return "", 0, fmt.Errorf("secret %s is not a JSON object: %v", secretID, err)
+	}
+	secret, ok := values[key].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("secret %s has no key %q", secretID, key)
+	}
+	return secret, 0, nil
+}
+
+// signAWSRequestV4 adds the X-Amz-Date and Authorization headers for AWS Signature Version 4.
+// Only the headers that Secrets Manager requires are signed.
+func signAWSRequestV4(req *http.Request, payload []byte, service, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := now.UTC().Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	payloadHash := sha256.Sum256(payload)
+	// Headers must be in sorted order.
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + token + "\n"
+	}
+	signedHeaders += ";x-amz-target"
+	canonicalHeaders += "x-amz-target:" + req.Header.Get("X-Amz-Target") + "\n"
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := req.Method + "\n" +
+		path + "\n" +
+		req.URL.Query().Encode() + "\n" +
+		canonicalHeaders + "\n" +
+		signedHeaders + "\n" +
+		hex.EncodeToString(payloadHash[:])
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingSecretsProvider struct {
+	secret string
+	calls  int
+}
+
+func (p *countingSecretsProvider) GetSecret(ref string) (string, time.Duration, error) {
+	p.calls++
+	return p.secret + ref, 0, nil
+}
+
+func TestResolvePassword(t *testing.T) {
+	provider := &countingSecretsProvider{secret: "pw-"}
+	RegisterSecretsProvider("test", provider)
+	defer RegisterSecretsProvider("test", nil)
+
+	password, err := ConnCfg{Password: "plain"}.ResolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "plain", password, "Password should be used if no secret is configured")
+
+	cfg := ConnCfg{Password: "plain", PasswordSecret: "test:mysql"}
+	password, err = cfg.ResolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "pw-mysql", password)
+
+	password, err = cfg.ResolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "pw-mysql", password)
+	assert.Equal(t, 1, provider.calls, "secret should have been cached")
+
+	provider.secret = "rotated-"
+	cfg.InvalidatePassword()
+	password, err = cfg.ResolvePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-mysql", password, "secret should be refetched after invalidation")
+	assert.Equal(t, 2, provider.calls)
+
+	_, err = ResolveSecret("nonexistent:mysql")
+	assert.Equal(t, ErrUnknownSecretsProvider, err)
+	_, err = ResolveSecret("noScheme")
+	assert.Equal(t, ErrInvalidSecretRef, err)
+}
+
+func TestFileSecretsProvider(t *testing.T) {
+	tmpDir := createTmpDir(t, ".", "test-secret-files")
+	defer os.RemoveAll(tmpDir)
+
+	secretFile := filepath.Join(tmpDir, "mysql_password")
+	err := ioutil.WriteFile(secretFile, []byte("filePassword\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret, _, err := fileSecretsProvider{}.GetSecret(secretFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "filePassword", secret)
+
+	_, _, err = fileSecretsProvider{}.GetSecret(filepath.Join(tmpDir, "missing"))
+	assert.NotNil(t, err)
+}
+
+func TestVaultSecretsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		assert.Equal(t, "/v1/secret/data/mysql", r.URL.Path)
+		w.Write([]byte(`{"lease_duration":60,"data":{"data":{"password":"vaultPassword"},"metadata":{"version":3}}}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_TOKEN", "token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+
+	secret, ttl, err := newVaultSecretsProvider().GetSecret("secret/data/mysql")
+	assert.Nil(t, err)
+	assert.Equal(t, "vaultPassword", secret)
+	assert.Equal(t, time.Minute, ttl)
+
+	_, _, err = newVaultSecretsProvider().GetSecret("secret/data/mysql#missing")
+	assert.NotNil(t, err)
+
+	os.Setenv("VAULT_TOKEN", "wrong")
+	_, _, err = newVaultSecretsProvider().GetSecret("secret/data/mysql")
+	assert.NotNil(t, err)
+}
+
+func TestAWSSecretsProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "20170102T030405Z", r.Header.Get("X-Amz-Date"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=access/20170102/us-east-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature="))
+
+		body := struct{ SecretId string }{}
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "prod/mysql", body.SecretId)
+
+		w.Write([]byte(`{"SecretString":"{\"password\":\"awsPassword\"}"}`))
+	}))
+	defer server.Close()
+
+	os.Setenv("AWS_REGION", "us-east-1")
+	os.Setenv("AWS_ACCESS_KEY_ID", "access")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	defer os.Unsetenv("AWS_REGION")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	provider := newAWSSecretsProvider()
+	provider.endpoint = server.URL
+	provider.now = func() time.Time {
+		return time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+
+	secret, _, err := provider.GetSecret("prod/mysql#password")
+	assert.Nil(t, err)
+	assert.Equal(t, "awsPassword", secret)
+
+	secret, _, err = provider.GetSecret("prod/mysql")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"password":"awsPassword"}`, secret)
+}
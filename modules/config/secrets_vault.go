@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultSecretsProvider reads secrets from HashiCorp Vault over its HTTP API. It supports both version 1 and 2 of the
+// KV secrets engine. The address and token are read from the standard VAULT_ADDR and VAULT_TOKEN environment variables.
+//
+// References are of the form "<path>#<key>", with key defaulting to "password".
+type vaultSecretsProvider struct {
+	client *http.Client
+}
+
+func newVaultSecretsProvider() *vaultSecretsProvider {
+	return &vaultSecretsProvider{
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type vaultResponse struct {
+	LeaseDuration int                    `json:"lease_duration"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+func (p *vaultSecretsProvider) GetSecret(ref string) (string, time.Duration, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", 0, fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	path, key := splitSecretKey(ref)
+	if key == "" {
+		key = "password"
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body := vaultResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", 0, fmt.Errorf("vault returned status %d: %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(body.Errors, "; "))
+	}
+
+	data := body.Data
+	// KV version 2 nests the secret under data.data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+
+	secret, ok := data[key].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("vault secret %s has no key %q", path, key)
+	}
+	return secret, time.Duration(body.LeaseDuration) * time.Second, nil
+}
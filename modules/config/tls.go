@@ -0,0 +1,96 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+/**
+ * TLS settings for the CodeCollaborate Server's listener, and its connections to datastores.
+ */
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSMinVersionID returns the crypto/tls version ID for TLSMinVersion, defaulting to TLS 1.2.
+func (cfg ServerCfg) TLSMinVersionID() (uint16, error) {
+	if cfg.TLSMinVersion == "" {
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[cfg.TLSMinVersion]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q", cfg.TLSMinVersion)
+	}
+	return version, nil
+}
+
+// TLSCipherSuiteIDs returns the crypto/tls IDs for TLSCipherSuites, or nil to use the default suites.
+func (cfg ServerCfg) TLSCipherSuiteIDs() ([]uint16, error) {
+	if len(cfg.TLSCipherSuites) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(cfg.TLSCipherSuites))
+	for _, name := range cfg.TLSCipherSuites {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// UseAutocert returns true if TLS certificates should be requested from Let's Encrypt, rather than loaded from file.
+func (cfg ServerCfg) UseAutocert() bool {
+	return cfg.TLSCertFile == "" && cfg.TLSKeyFile == ""
+}
+
+// TLSConfig builds the client TLS configuration for this connection, or returns nil if UseTLS is not set.
+// The returned config has no ServerName; it is filled in from the host by the drivers that need it.
+func (cfg ConnCfg) TLSConfig() (*tls.Config, error) {
+	if !cfg.UseTLS {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+
+	if cfg.TLSCAFile != "" {
+		caBundle, err := ioutil.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
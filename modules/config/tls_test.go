@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSMinVersionID(t *testing.T) {
+	version, err := ServerCfg{}.TLSMinVersionID()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS12), version, "should default to TLS 1.2")
+
+	version, err = ServerCfg{TLSMinVersion: "1.1"}.TLSMinVersionID()
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS11), version)
+
+	_, err = ServerCfg{TLSMinVersion: "SSLv3"}.TLSMinVersionID()
+	assert.NotNil(t, err)
+}
+
+func TestTLSCipherSuiteIDs(t *testing.T) {
+	suites, err := ServerCfg{}.TLSCipherSuiteIDs()
+	assert.Nil(t, err)
+	assert.Nil(t, suites, "should use the default suites")
+
+	suites, err = ServerCfg{TLSCipherSuites: []string{
+		"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	}}.TLSCipherSuiteIDs()
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, suites)
+
+	_, err = ServerCfg{TLSCipherSuites: []string{"TLS_NOT_A_SUITE"}}.TLSCipherSuiteIDs()
+	assert.NotNil(t, err)
+}
+
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "codecollaborate-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestConnCfgTLSConfig(t *testing.T) {
+	tmpDir := createTmpDir(t, ".", "test-tls-files")
+	defer os.RemoveAll(tmpDir)
+	certFile, keyFile := writeTestCertificate(t, tmpDir)
+
+	tlsConfig, err := ConnCfg{TLSCAFile: certFile}.TLSConfig()
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig, "TLS should be disabled unless UseTLS is set")
+
+	tlsConfig, err = ConnCfg{
+		UseTLS:      true,
+		TLSCAFile:   certFile,
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	}.TLSConfig()
+	assert.Nil(t, err)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	_, err = ConnCfg{UseTLS: true, TLSCAFile: keyFile}.TLSConfig()
+	assert.NotNil(t, err, "CA bundle without certificates should fail")
+
+	_, err = ConnCfg{UseTLS: true, TLSCertFile: certFile}.TLSConfig()
+	assert.NotNil(t, err, "Client certificate without key should fail")
+}
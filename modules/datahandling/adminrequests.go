@@ -0,0 +1,707 @@
+package datahandling
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Admin requests manage the server, rather than any one user's projects. They may only be made by the users listed in
+ * the server config's Admins, and only with a session token.
+ */
+
+var errNotAdmin = errors.New("The sender is not a server admin")
+
+var adminRequestsSetup = false
+
+// initAdminRequests populates the requestMap from requestmap.go with the appropriate constructors for the admin methods
+func initAdminRequests() {
+	if adminRequestsSetup {
+		return
+	}
+
+	authenticatedRequestMap["Admin.SetProjectQuota"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminSetProjectQuotaRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetProjectUsage"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetProjectUsageRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.CheckIntegrity"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminCheckIntegrityRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetIntegrityReport"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetIntegrityReportRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetAuditLog"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetAuditLogRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.UnlockLogin"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminUnlockLoginRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.ListInstances"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminListInstancesRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.DrainInstance"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminDrainInstanceRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.SetMaintenance"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminSetMaintenanceRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.Announce"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminAnnounceRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetLatencyReport"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetLatencyReportRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetUser"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetUserRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.DeleteUser"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminDeleteUserRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetProject"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetProjectRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.GetQuotaReport"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminGetQuotaReportRequest), req)
+	}
+
+	authenticatedRequestMap["Admin.ScrunchFile"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(adminScrunchFileRequest), req)
+	}
+
+	adminRequestsSetup = true
+}
+
+// isServerAdmin returns true if the user is one of the configured server admins
+func isServerAdmin(cfg *config.Config, username string) bool {
+	for _, admin := range cfg.ServerConfig.Admins {
+		if strings.EqualFold(admin, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// Admin.SetProjectQuota
+type adminSetProjectQuotaRequest struct {
+	ProjectID  int64 `validate:"required"`
+	QuotaBytes int64 `validate:"min=0"` // 0 removes the override, so that the project uses the default quota
+	abstractRequest
+}
+
+func (a *adminSetProjectQuotaRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminSetProjectQuotaRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource":  a.Resource,
+			"Method":    a.Method,
+			"SenderID":  a.SenderID,
+			"ProjectID": a.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	err := db.MySQLProjectSetQuota(a.ProjectID, a.QuotaBytes)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+
+	utils.LogInfo("Project quota changed", utils.LogFields{
+		"SenderID":   a.SenderID,
+		"ProjectID":  a.ProjectID,
+		"QuotaBytes": a.QuotaBytes,
+	})
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, a.Tag)}}, nil
+}
+
+// Admin.GetProjectUsage
+type adminGetProjectUsageRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (a *adminGetProjectUsageRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetProjectUsageRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource":  a.Resource,
+			"Method":    a.Method,
+			"SenderID":  a.SenderID,
+			"ProjectID": a.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	usage, err := db.MySQLProjectGetUsage(a.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	override, err := db.MySQLProjectGetQuota(a.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	quota := effectiveQuota(a.config(), override)
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			UsedBytes  int64
+			QuotaBytes int64 // 0 if unlimited
+			Override   bool  // Whether QuotaBytes was set with Admin.SetProjectQuota, rather than being the default
+		}{
+			UsedBytes:  usage,
+			QuotaBytes: quota,
+			Override:   override > 0,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.CheckIntegrity
+type adminCheckIntegrityRequest struct {
+	abstractRequest
+}
+
+func (a *adminCheckIntegrityRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminCheckIntegrityRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	report, err := CheckIntegrity(db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, a.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data:   report,
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.GetIntegrityReport
+type adminGetIntegrityReportRequest struct {
+	abstractRequest
+}
+
+func (a *adminGetIntegrityReportRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetIntegrityReportRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	report := LastIntegrityReport()
+	if report == nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, a.Tag)}}, nil
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data:   report,
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// maxAuditLogEntries is the most entries Admin.GetAuditLog returns at once
+const maxAuditLogEntries = 1000
+
+// Admin.GetAuditLog
+type adminGetAuditLogRequest struct {
+	Since        int64  `validate:"min=0"`          // Seconds since the Unix epoch, inclusive
+	Until        int64  `validate:"min=0"`          // Seconds since the Unix epoch, exclusive; 0 for now
+	AfterAuditID int64  `validate:"min=0"`          // The last entry of the previous page
+	Event        string `validate:"max=64"`         // A "Resource.Method", such as "User.Login"; empty for every event
+	Actor        string `validate:"max=25"`         // Empty for every actor
+	Limit        int    `validate:"min=0,max=1000"` // 0 for the most entries, 1000
+	abstractRequest
+}
+
+func (a *adminGetAuditLogRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetAuditLogRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	filter := dbfs.AuditLogFilter{
+		Since:        time.Unix(a.Since, 0),
+		Until:        time.Unix(a.Until, 0),
+		AfterAuditID: a.AfterAuditID,
+		Event:        a.Event,
+		Actor:        strings.ToLower(a.Actor),
+		Limit:        a.Limit,
+	}
+	if a.Until == 0 {
+		// Until is exclusive, so entries from the current second are included
+		filter.Until = time.Now().Add(time.Second)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = maxAuditLogEntries
+	}
+
+	entries, err := db.MySQLAuditLogQuery(filter)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			Entries []dbfs.AuditEntryMeta
+		}{
+			Entries: entries,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.UnlockLogin clears the failed logins of an account, an address, or both, on the server the admin is connected
+// to; see loginthrottle.go
+type adminUnlockLoginRequest struct {
+	Username   string `validate:"max=25"`
+	RemoteAddr string `validate:"max=45"` // An IP address, as logins are counted against
+	abstractRequest
+}
+
+func (a *adminUnlockLoginRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminUnlockLoginRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	if a.Username == "" && a.RemoteAddr == "" {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, a.Tag)}}, nil
+	}
+
+	cleared := false
+	if a.Username != "" {
+		cleared = loginThrottles.unlock(accountThrottleKey(strings.ToLower(a.Username))) || cleared
+	}
+	if a.RemoteAddr != "" {
+		cleared = loginThrottles.unlock(addressThrottleKey(a.RemoteAddr)) || cleared
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			Cleared bool // Whether there were failed logins to clear
+		}{
+			Cleared: cleared,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.ListInstances lists the servers in the instance registry; see instances.go
+type adminListInstancesRequest struct {
+	abstractRequest
+}
+
+func (a *adminListInstancesRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminListInstancesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	instances, err := db.MySQLInstanceList()
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+
+	type instanceStatus struct {
+		dbfs.InstanceMeta
+		Health string // "ok", "draining" or "unresponsive"
+		Self   bool   // Whether this is the server the admin is connected to
+	}
+	now := time.Now()
+	statuses := make([]instanceStatus, len(instances))
+	for i, instance := range instances {
+		statuses[i] = instanceStatus{
+			InstanceMeta: instance,
+			Health:       instanceHealth(instance, now),
+			Self:         instance.InstanceID == InstanceID,
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			Instances []instanceStatus
+		}{
+			Instances: statuses,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.DrainInstance asks a server to stop accepting new connections, or to resume accepting them
+type adminDrainInstanceRequest struct {
+	InstanceID string `validate:"required,max=32"`
+	Draining   bool
+	abstractRequest
+}
+
+func (a *adminDrainInstanceRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminDrainInstanceRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	err := db.MySQLInstanceSetDraining(a.InstanceID, a.Draining)
+	if err == dbfs.ErrNoDbChange {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, a.Tag)}}, nil
+	} else if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, a.Tag)}}, err
+	}
+
+	// Other servers pick the change up on their next heartbeat
+	if a.InstanceID == InstanceID {
+		setDraining(a.Draining)
+	}
+
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, a.Tag)}}, nil
+}
+
+// Admin.GetUser returns a user's account, former usernames, projects and storage usage
+type adminGetUserRequest struct {
+	Username string `validate:"required,max=25"`
+	abstractRequest
+}
+
+func (a *adminGetUserRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetUserRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	username := strings.ToLower(a.Username)
+	user, err := db.MySQLUserLookup(username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	aliases, err := db.MySQLUserAliases(username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	projects, err := db.MySQLUserProjects(username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	usage, err := db.MySQLUserGetUsage(username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	user.Password = ""
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			User      dbfs.UserMeta
+			Aliases   []string
+			Projects  []dbfs.ProjectMeta
+			UsedBytes int64 // The total size of the files the user created
+		}{
+			User:      user,
+			Aliases:   aliases,
+			Projects:  projects,
+			UsedBytes: usage,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Admin.DeleteUser deletes a user's account as User.Delete would if they made it, along with the projects they own
+type adminDeleteUserRequest struct {
+	Username string `validate:"required,max=25"`
+	abstractRequest
+}
+
+func (a *adminDeleteUserRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminDeleteUserRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	utils.LogInfo("Admin deleting user", utils.LogFields{
+		"SenderID": a.SenderID,
+		"Username": a.Username,
+	})
+	deletion := userDeleteRequest{abstractRequest: a.abstractRequest}
+	deletion.SenderID = strings.ToLower(a.Username)
+	return deletion.process(db)
+}
+
+// Admin.GetProject returns a project's permissions, files and storage usage, whether or not the admin has access to it
+type adminGetProjectRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (a *adminGetProjectRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetProjectRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource":  a.Resource,
+			"Method":    a.Method,
+			"SenderID":  a.SenderID,
+			"ProjectID": a.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	project, err := projectLookup("", a.ProjectID, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	} else if len(project.Permissions) == 0 {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, a.Tag)}}, nil
+	}
+	files, err := db.MySQLProjectGetFiles(a.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	usage, err := db.MySQLProjectGetUsage(a.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	override, err := db.MySQLProjectGetQuota(a.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			projectLookupResult
+			Files      []dbfs.FileMeta
+			UsedBytes  int64
+			QuotaBytes int64 // 0 if unlimited
+			Override   bool  // Whether QuotaBytes was set with Admin.SetProjectQuota, rather than being the default
+		}{
+			projectLookupResult: project,
+			Files:               files,
+			UsedBytes:           usage,
+			QuotaBytes:          effectiveQuota(a.config(), override),
+			Override:            override > 0,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// maxQuotaReportProjects is the most projects Admin.GetQuotaReport returns
+const maxQuotaReportProjects = 1000
+
+// Admin.GetQuotaReport returns the projects using the most storage, with their quotas
+type adminGetQuotaReportRequest struct {
+	Limit int `validate:"min=0,max=1000"` // 0 for the most projects, 1000
+	abstractRequest
+}
+
+func (a *adminGetQuotaReportRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetQuotaReportRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	limit := a.Limit
+	if limit == 0 {
+		limit = maxQuotaReportProjects
+	}
+	usages, err := db.MySQLProjectUsageReport(limit)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+
+	type projectQuota struct {
+		ProjectID  int64
+		Name       string
+		Owner      string
+		UsedBytes  int64
+		QuotaBytes int64 // 0 if unlimited
+		Override   bool  // Whether QuotaBytes was set with Admin.SetProjectQuota, rather than being the default
+	}
+	projects := make([]projectQuota, len(usages))
+	for i, usage := range usages {
+		projects[i] = projectQuota{
+			ProjectID:  usage.ProjectID,
+			Name:       usage.Name,
+			Owner:      usage.Owner,
+			UsedBytes:  usage.UsedBytes,
+			QuotaBytes: effectiveQuota(a.config(), usage.QuotaBytes),
+			Override:   usage.QuotaBytes > 0,
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data: struct {
+			Projects []projectQuota
+		}{
+			Projects: projects,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// effectiveQuota returns the quota of a project with the override, which is the default quota if it has none
+func effectiveQuota(cfg *config.Config, override int64) int64 {
+	if override > 0 {
+		return override
+	}
+	return cfg.ServerConfig.ProjectQuotaBytes
+}
+
+// Admin.ScrunchFile scrunches a file's changes into its contents now, rather than waiting for them to reach
+// MaxBufferLength. It returns once the file has been scrunched.
+type adminScrunchFileRequest struct {
+	FileID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (a *adminScrunchFileRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminScrunchFileRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+			"FileID":   a.FileID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	fileMeta, err := db.MySQLFileGetInfo(a.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	} else if fileMeta.ProjectID == 0 {
+		// No file was found
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, a.Tag)}}, nil
+	}
+
+	reanchorFileComments(fileMeta, db)
+	if err := db.ScrunchFile(fileMeta); err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, a.Tag)}}, err
+	}
+	if scanScrunchedFile(a.config(), fileMeta, a.SenderID, db) {
+		exportScrunchedFile(fileMeta, db)
+	}
+
+	utils.LogInfo("File scrunched by admin", utils.LogFields{
+		"SenderID": a.SenderID,
+		"FileID":   a.FileID,
+	})
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, a.Tag)}}, nil
+}
@@ -0,0 +1,80 @@
+package datahandling
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminUserAndProjectRequests(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+	serverCfg.Admins = []string{"admin"}
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", ".", projectID)
+	db.MySQLFileAddSize(fileID, 20)
+	db.FileWrite(".", "file", projectID, []byte("contents"))
+
+	respond := func(req request, sender string) messages.Response {
+		req.setAbstractRequest(&abstractRequest{SenderID: sender, Resource: "Admin"})
+		closures, _ := req.process(db)
+		require.NotEmpty(t, closures)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+
+	// Only admins may make them
+	assert.Equal(t, messages.StatusUnauthorized, respond(&adminGetUserRequest{Username: "loganga"}, "loganga").Status)
+	assert.Equal(t, messages.StatusUnauthorized, respond(&adminGetProjectRequest{ProjectID: projectID}, "loganga").Status)
+	assert.Equal(t, messages.StatusUnauthorized, respond(&adminScrunchFileRequest{FileID: fileID}, "loganga").Status)
+	assert.Equal(t, messages.StatusUnauthorized, respond(&adminDeleteUserRequest{Username: "loganga"}, "loganga").Status)
+
+	res := respond(&adminGetUserRequest{Username: "LoganGA"}, "admin")
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	user := res.Data.(struct {
+		User      dbfs.UserMeta
+		Aliases   []string
+		Projects  []dbfs.ProjectMeta
+		UsedBytes int64
+	})
+	assert.Equal(t, "loganga", user.User.Username)
+	assert.Empty(t, user.User.Password, "password hashes should never be returned")
+	assert.Equal(t, []dbfs.ProjectMeta{{ProjectID: projectID, Name: "hi", PermissionLevel: config.OwnerRole.Level}}, user.Projects)
+	assert.EqualValues(t, 20, user.UsedBytes)
+
+	// Admins can inspect projects they have no access to
+	res = respond(&adminGetProjectRequest{ProjectID: projectID}, "admin")
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := res.Data.(struct {
+		projectLookupResult
+		Files      []dbfs.FileMeta
+		UsedBytes  int64
+		QuotaBytes int64
+		Override   bool
+	})
+	assert.Equal(t, "hi", data.Name)
+	assert.Contains(t, data.Permissions, "loganga")
+	require.Len(t, data.Files, 1)
+	assert.Equal(t, fileID, data.Files[0].FileID)
+	assert.EqualValues(t, 20, data.UsedBytes)
+	assert.Equal(t, messages.StatusNotFound, respond(&adminGetProjectRequest{ProjectID: projectID + 1}, "admin").Status)
+
+	assert.Equal(t, messages.StatusSuccess, respond(&adminScrunchFileRequest{FileID: fileID}, "admin").Status)
+	assert.Equal(t, messages.StatusNotFound, respond(&adminScrunchFileRequest{FileID: fileID + 1}, "admin").Status)
+
+	// Deleting a user deletes the projects they own, as if they had deleted their own account
+	assert.Equal(t, messages.StatusSuccess, respond(&adminDeleteUserRequest{Username: "loganga"}, "admin").Status)
+	_, err := db.MySQLUserLookup("loganga")
+	assert.Error(t, err)
+	assert.Empty(t, db.Files[projectID])
+	assert.NotEqual(t, messages.StatusSuccess, respond(&adminGetUserRequest{Username: "loganga"}, "admin").Status)
+}
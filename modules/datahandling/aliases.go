@@ -0,0 +1,92 @@
+package datahandling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Users who change their username with User.ChangeUsername keep each username they had as an alias of their current
+ * one. Authenticated requests are processed as the sender's current username, so that session tokens issued to an old
+ * username, and clients that still send it as their SenderID, keep working until the token expires. The authors
+ * recorded in stored patches are never rewritten, so they are resolved the same way wherever authorship is shown.
+ *
+ * Every authenticated request resolves its sender, so each server caches what usernames resolve to, including that
+ * they are not aliases, for usernameAliasTTL. A rename is seen at once by the server that made it, and by the others
+ * once their cached entries expire; until then, requests they receive under the old username are refused access to
+ * the user's projects.
+ */
+
+// usernameAliasTTL is how long a resolved username is cached
+const usernameAliasTTL = time.Minute
+
+// maxUsernameAliasEntries bounds the cache; it is emptied when it grows past this
+const maxUsernameAliasEntries = 10000
+
+// usernameAliases caches the resolved usernames on this server
+var usernameAliases = &usernameAliasCache{entries: make(map[string]usernameAliasEntry)}
+
+type usernameAliasCache struct {
+	mutex   sync.Mutex
+	entries map[string]usernameAliasEntry
+}
+
+type usernameAliasEntry struct {
+	username string
+	expires  time.Time
+}
+
+// resolve returns the current username of the user who had the username, or the username itself if it is not an
+// alias. Usernames that can't be resolved, such as while MySQL is unavailable, are returned as they are.
+func (cache *usernameAliasCache) resolve(username string, db dbfs.DBFS) string {
+	if username == "" {
+		return username
+	}
+
+	now := time.Now()
+	cache.mutex.Lock()
+	entry, ok := cache.entries[username]
+	cache.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.username
+	}
+
+	resolved, err := db.MySQLUserResolveAlias(username)
+	if err == dbfs.ErrNoData {
+		resolved = username
+	} else if err != nil {
+		utils.LogError("Failed to resolve username alias", err, utils.LogFields{
+			"Username": username,
+		})
+		return username
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if len(cache.entries) >= maxUsernameAliasEntries {
+		cache.entries = make(map[string]usernameAliasEntry)
+	}
+	cache.entries[username] = usernameAliasEntry{username: resolved, expires: now.Add(usernameAliasTTL)}
+	return resolved
+}
+
+// forget removes the usernames from the cache, once a user has changed from or to them
+func (cache *usernameAliasCache) forget(usernames ...string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for _, username := range usernames {
+		delete(cache.entries, username)
+	}
+	// Other aliases of the user resolve to the username they changed from
+	for alias, entry := range cache.entries {
+		for _, username := range usernames {
+			if entry.username == username {
+				delete(cache.entries, alias)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFullRequest_UsernameAlias(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	apiToken := newTestAPIToken(t, db, "read")
+	sessionToken, err := newAuthToken(config.GetConfig(), "loganga")
+	require.NoError(t, err)
+
+	require.NoError(t, db.MySQLUserChangeUsername("loganga", "genelogan"))
+	usernameAliases.forget("loganga", "genelogan")
+	defer usernameAliases.forget("loganga", "genelogan")
+
+	for _, test := range []struct {
+		desc     string
+		senderID string
+		token    string
+	}{
+		{"Session token issued to the old username", "loganga", sessionToken},
+		{"API token, sent under the old username", "loganga", apiToken},
+		{"API token, sent under the new username", "genelogan", apiToken},
+	} {
+		req := abstractRequest{
+			Resource:    "File",
+			Method:      "Pull",
+			SenderID:    test.senderID,
+			SenderToken: test.token,
+			Data:        json.RawMessage(`{"FileID": 1}`),
+		}
+		_, err := getFullRequest(&req, db)
+		assert.NoError(t, err, test.desc)
+		assert.Equal(t, "genelogan", req.SenderID, test.desc)
+	}
+
+	req := abstractRequest{
+		Resource:    "File",
+		Method:      "Pull",
+		SenderID:    "genelogan",
+		SenderToken: sessionToken,
+		Data:        json.RawMessage(`{"FileID": 1}`),
+	}
+	_, err = getFullRequest(&req, db)
+	assert.Equal(t, ErrAuthenticationFailed, err, "session tokens still name the username they were issued to")
+}
+
+func TestDescribeAuthorship_UsernameAlias(t *testing.T) {
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	changes := []string{stampAuthorship("v1:\n0:+5:hello:\n0", "loganga")}
+
+	require.NoError(t, db.MySQLUserChangeUsername("loganga", "genelogan"))
+	usernameAliases.forget("loganga", "genelogan")
+	defer usernameAliases.forget("loganga", "genelogan")
+
+	authorship, err := describeAuthorship(changes, db)
+	require.NoError(t, err)
+	require.Len(t, authorship, 1)
+	assert.Equal(t, "genelogan", authorship[0].Author, "patches should be attributed to their author's current username")
+}
@@ -0,0 +1,88 @@
+package datahandling
+
+import (
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Admins announce things to users, such as upcoming downtime, with Admin.Announce. Announcements are sent as
+ * Server.Announcement notifications, either to every connected client, on every server, or to the subscribers of the
+ * given projects. Announcements to projects are sequenced with the project's other notifications, so clients that
+ * resume their session or fetch the notifications they missed get them too; those to everyone only reach the clients
+ * connected at the time. Announcements to projects that don't exist reach no one.
+ */
+
+// announcement is the Data of Server.Announcement notifications
+type announcement struct {
+	Message string
+	Level   string // "info" or "warning", for clients to choose how to show it
+	From    string // The admin who made the announcement
+}
+
+// Admin.Announce
+type adminAnnounceRequest struct {
+	Message    string  `validate:"required,max=1024"`
+	Level      string  `validate:"omitempty,oneof=info warning"` // Defaults to info
+	ProjectIDs []int64 `validate:"max=1000"`                     // If empty, the announcement is sent to everyone
+	abstractRequest
+}
+
+func (a *adminAnnounceRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminAnnounceRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	data := announcement{
+		Message: a.Message,
+		Level:   a.Level,
+		From:    a.SenderID,
+	}
+	if data.Level == "" {
+		data.Level = "info"
+	}
+
+	closures := []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, a.Tag)}}
+	if len(a.ProjectIDs) == 0 {
+		not := messages.Notification{
+			Resource: "Server",
+			Method:   "Announcement",
+			Data:     data,
+		}.Wrap()
+		closures = append(closures, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitBroadcastKey, includeSender: true})
+	}
+	seen := make(map[int64]bool, len(a.ProjectIDs))
+	for _, projectID := range a.ProjectIDs {
+		if seen[projectID] {
+			continue
+		}
+		seen[projectID] = true
+		not := messages.Notification{
+			Resource:   "Server",
+			Method:     "Announcement",
+			ResourceID: projectID,
+			Data:       data,
+		}.Wrap()
+		announce := projectNotificationClosure(projectID, 0, not)
+		announce.includeSender = true
+		closures = append(closures, announce)
+	}
+
+	utils.LogInfo("Announcement made", utils.LogFields{
+		"SenderID":   a.SenderID,
+		"Level":      data.Level,
+		"ProjectIDs": a.ProjectIDs,
+	})
+	return closures, nil
+}
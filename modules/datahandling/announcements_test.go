@@ -0,0 +1,51 @@
+package datahandling
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAnnounce(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+
+	db := dbfs.NewDBMock()
+	announce := adminAnnounceRequest{Message: "Upgrading at 5pm"}
+	setBaseFields(&announce)
+	announce.Resource = "Admin"
+	announce.Method = "Announce"
+	res, _ := processForTest(t, &announce, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	serverCfg.Admins = []string{announce.SenderID}
+	closures, err := announce.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	everyone := closures[1].(toRabbitChannelClosure)
+	assert.Equal(t, rabbitmq.RabbitBroadcastKey, everyone.key)
+	assert.Equal(t, announcement{Message: "Upgrading at 5pm", Level: "info", From: "loganga"},
+		everyone.msg.ServerMessage.(messages.Notification).Data)
+
+	announce.Level = "warning"
+	announce.ProjectIDs = []int64{1, 2, 1}
+	closures, err = announce.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 3, "each project should be sent the announcement once")
+	for i, projectID := range []int64{1, 2} {
+		project := closures[i+1].(toRabbitChannelClosure)
+		assert.Equal(t, projectID, project.projectID)
+		assert.True(t, project.includeSender)
+		not := project.msg.ServerMessage.(messages.Notification)
+		assert.Equal(t, projectID, not.ResourceID)
+		assert.Equal(t, "warning", not.Data.(announcement).Level)
+	}
+}
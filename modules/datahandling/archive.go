@@ -0,0 +1,185 @@
+package datahandling
+
+import (
+	"strconv"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Archival of dormant projects, such as those of past classes. Project.Archive makes the project read-only, then moves
+ * each of its files, with all of their changes applied, to cold storage (see dbfs/coldstorage.go), and removes their
+ * Couchbase documents; Project.Unarchive moves them back. Until it is unarchived, requests that read or change the
+ * project's files are refused with StatusArchived, while the project can still be looked up, renamed and shared.
+ *
+ * Both are resumable: if either is interrupted, the project stays read-only, and either request can be made again to
+ * finish archiving it or to bring it back.
+ *
+ * Every request for a file checks its project's archive state, which the database caches with the file's metadata.
+ */
+
+// Archive states of projects; projects without one are live
+const (
+	archiveStateArchiving   = "archiving"
+	archiveStateArchived    = "archived"
+	archiveStateUnarchiving = "unarchiving"
+)
+
+// archiveLockName is the name of the lock held while archiving or unarchiving the project, so that a project is only
+// archived or unarchived by one server at a time
+func archiveLockName(projectID int64) string {
+	return "project-archive-" + strconv.FormatInt(projectID, 10)
+}
+
+// archivedResponse returns the response to a request for the project's files if it is not live, or nil if it is
+func archivedResponse(projectID int64, tag int64, db dbfs.DBFS) (*messages.ServerMessageWrapper, error) {
+	state, err := db.MySQLProjectGetArchiveState(projectID)
+	if err != nil {
+		return messages.NewEmptyResponse(messages.StatusFail, tag), err
+	}
+	if state == "" {
+		return nil, nil
+	}
+	return messages.Response{
+		Status: messages.StatusArchived,
+		Tag:    tag,
+		Data: struct {
+			Archive string
+		}{
+			Archive: state,
+		},
+	}.Wrap(), nil
+}
+
+// Project.Archive
+type projectArchiveRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (p *projectArchiveRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectArchiveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityDeleteProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	return setProjectArchived(p.abstractRequest, p.ProjectID, true, db)
+}
+
+// Project.Unarchive
+type projectUnarchiveRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (p *projectUnarchiveRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectUnarchiveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityEditFiles, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	return setProjectArchived(p.abstractRequest, p.ProjectID, false, db)
+}
+
+// setProjectArchived archives or unarchives every file in the project, and notifies its subscribers once done
+func setProjectArchived(abs abstractRequest, projectID int64, archive bool, db dbfs.DBFS) ([]dhClosure, error) {
+	lock, err := db.MySQLLockAcquire(archiveLockName(projectID), 0)
+	if err == dbfs.ErrLockHeld {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, abs.Tag)}}, nil
+	} else if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, abs.Tag)}}, err
+	}
+	defer lock.Release()
+
+	state, err := db.MySQLProjectGetArchiveState(projectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, abs.Tag)}}, err
+	}
+	pending, done := archiveStateUnarchiving, ""
+	if archive {
+		pending, done = archiveStateArchiving, archiveStateArchived
+	}
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    abs.Tag,
+		Data: struct {
+			Archive string
+		}{
+			Archive: done,
+		},
+	}.Wrap()
+	if state == done {
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	// The project is read-only from here until it is live again
+	if err := db.MySQLProjectSetArchiveState(projectID, pending); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, abs.Tag)}}, err
+	}
+	files, err := db.MySQLProjectGetFiles(projectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, abs.Tag)}}, err
+	}
+	if archive {
+		exportBeforeArchiving(files, db)
+	}
+	for _, file := range files {
+		if archive {
+			err = db.FileArchive(file)
+		} else {
+			err = db.FileUnarchive(file)
+		}
+		if err != nil {
+			utils.LogError("Failed to move file to or from cold storage", err, utils.LogFields{
+				"ProjectID": projectID,
+				"FileID":    file.FileID,
+				"Archive":   archive,
+			})
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, abs.Tag)}}, err
+		}
+	}
+	if err := db.MySQLProjectSetArchiveState(projectID, done); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, abs.Tag)}}, err
+	}
+
+	utils.LogInfo("Project archive state changed", utils.LogFields{
+		"ProjectID": projectID,
+		"SenderID":  abs.SenderID,
+		"Archive":   done,
+		"Files":     len(files),
+	})
+	not := messages.Notification{
+		Resource:   abs.Resource,
+		Method:     abs.Method,
+		ResourceID: projectID,
+		Data: struct {
+			Archive string
+		}{
+			Archive: done,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(projectID, 0, not)}, nil
+}
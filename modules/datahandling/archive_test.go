@@ -0,0 +1,118 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectArchive(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.CBInsertNewFile(fileID, 3, []string{})
+	db.MySQLProjectGrantPermission(projectID, "notloganga", config.WriteRole.Level, "loganga")
+
+	archive := projectArchiveRequest{ProjectID: projectID}
+	setBaseFields(&archive)
+	archive.Resource = "Project"
+	archive.Method = "Archive"
+	unarchive := projectUnarchiveRequest{ProjectID: projectID}
+	setBaseFields(&unarchive)
+	unarchive.Resource = "Project"
+	unarchive.Method = "Unarchive"
+	pull := filePullRequest{FileID: fileID}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	change := fileChangeRequest{FileID: fileID, Changes: "v3:\n0:+1:x:\n0"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+
+	// Only the owner may archive
+	archive.SenderID = "notloganga"
+	res, _ := processForTest(t, &archive, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+	archive.SenderID = "loganga"
+
+	res, not := processForTest(t, &archive, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	require.NotNil(t, not)
+	assert.Equal(t, "archived", reflect.ValueOf(not.Data).FieldByName("Archive").String())
+	assert.Equal(t, map[int64]int64{fileID: 3}, db.ArchivedFiles)
+	assert.NotContains(t, db.FileVersion, fileID, "the Couchbase document should be removed")
+
+	// The files can't be read or changed, but the project can still be looked up
+	res, _ = processForTest(t, &pull, db)
+	assert.Equal(t, messages.StatusArchived, res.Status)
+	assert.Equal(t, "archived", reflect.ValueOf(res.Data).FieldByName("Archive").String())
+	res, _ = processForTest(t, &change, db)
+	assert.Equal(t, messages.StatusArchived, res.Status)
+	result, err := projectLookup("loganga", projectID, db)
+	require.NoError(t, err)
+	assert.Equal(t, "archived", result.Archive)
+
+	// Archiving again does nothing
+	res, not = processForTest(t, &archive, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Nil(t, not)
+
+	// Anyone who could edit the files may unarchive them
+	unarchive.SenderID = "notloganga"
+	res, not = processForTest(t, &unarchive, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	require.NotNil(t, not)
+	assert.Equal(t, "", reflect.ValueOf(not.Data).FieldByName("Archive").String())
+	assert.Empty(t, db.ArchivedFiles)
+	assert.Equal(t, int64(3), db.FileVersion[fileID], "the file should keep its version")
+
+	res, _ = processForTest(t, &change, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+}
+
+func TestProjectArchive_Interrupted(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.CBInsertNewFile(fileID, 1, []string{})
+
+	archive := projectArchiveRequest{ProjectID: projectID}
+	setBaseFields(&archive)
+	archive.Resource = "Project"
+	archive.Method = "Archive"
+
+	db.FailCall("FileArchive", 0, nil)
+	closures, err := archive.process(db)
+	assert.Error(t, err)
+	assert.Equal(t, messages.StatusServFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	state, _ := db.MySQLProjectGetArchiveState(projectID)
+	assert.Equal(t, archiveStateArchiving, state, "the project should stay read-only until archiving is finished")
+	db.ClearFaults()
+
+	res, _ := processForTest(t, &archive, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	state, _ = db.MySQLProjectGetArchiveState(projectID)
+	assert.Equal(t, archiveStateArchived, state)
+
+	// Only one server archives or unarchives a project at a time
+	lock, err := db.MySQLLockAcquire(archiveLockName(projectID), 0)
+	require.NoError(t, err)
+	defer lock.Release()
+	unarchive := projectUnarchiveRequest{ProjectID: projectID}
+	setBaseFields(&unarchive)
+	unarchive.Resource = "Project"
+	unarchive.Method = "Unarchive"
+	res, _ = processForTest(t, &unarchive, db)
+	assert.Equal(t, messages.StatusFail, res.Status)
+}
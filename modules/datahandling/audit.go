@@ -0,0 +1,94 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * The audit log is an append-only record, in MySQL, of the requests that authenticate users or change what they may
+ * do: logins, whether they succeed or fail, password resets, API token issuance and revocation, permission grants and
+ * revocations, and every admin request. Each entry records the request's Resource.Method, the authenticated sender,
+ * the project the request was about, the status it was answered with, and its data, with passwords and tokens
+ * redacted. Entries are recorded outside of the request's context, so that requests from clients that disconnect are
+ * still recorded. Admins query the log with Admin.GetAuditLog.
+ *
+ * The server never updates or deletes entries, so that they outlive the users and projects they are about.
+ */
+
+// auditedMethods are the requests recorded in the audit log, besides admin requests
+var auditedMethods = map[string]bool{
+	"User.Login":                true,
+	"User.LoginExternal":        true,
+	"User.ConfirmReset":         true,
+	"User.CreateAPIToken":       true,
+	"User.RevokeAPIToken":       true,
+	"User.RevokeSession":        true,
+	"User.ChangeUsername":       true,
+	"Project.GrantPermissions":  true,
+	"Project.RevokePermissions": true,
+	"Team.AddMember":            true,
+	"Team.GrantProjectAccess":   true,
+}
+
+// isAudited returns true if requests to the method are recorded in the audit log
+func isAudited(method string) bool {
+	return auditedMethods[method] || strings.HasPrefix(method, "Admin.")
+}
+
+// auditRequest records audited requests in the audit log, however they are answered
+func auditRequest(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		closures, err := next(dh, call, db)
+		if isAudited(call.req.Resource + "." + call.req.Method) {
+			status := messages.StatusServFail
+			if res, ok := senderResponse(closures, call.req.Tag); ok {
+				status = res.Status
+			}
+			closures = append(closures, newAuditClosure(call.req, call.authenticated, status))
+		}
+		return closures, err
+	}
+}
+
+type auditClosure struct {
+	entry dbfs.AuditEntryMeta
+}
+
+// auditClosure.call records the entry in the audit log
+func (cont auditClosure) call(dh DataHandler) error {
+	err := dh.Db.MySQLAuditLogAppend(cont.entry)
+	if err != nil {
+		utils.LogError("Failed to record audit log entry", err, utils.LogFields{
+			"Event": cont.entry.Event,
+			"Actor": cont.entry.Actor,
+		})
+	}
+	return err
+}
+
+// newAuditClosure records the request, and the status it was answered with, in the audit log. The actor is only
+// recorded if the request was authenticated, since the sender of any other request is only what the client claims.
+func newAuditClosure(req *abstractRequest, authenticated bool, status int) auditClosure {
+	entry := dbfs.AuditEntryMeta{
+		Event:      req.Resource + "." + req.Method,
+		RemoteAddr: req.remoteAddr,
+		Status:     status,
+		Details:    utils.RedactJSON(req.Data),
+	}
+	if authenticated {
+		entry.Actor = req.SenderID
+	}
+
+	var project struct {
+		ProjectID int64
+	}
+	if json.Unmarshal(req.Data, &project) == nil {
+		entry.ProjectID = project.ProjectID
+	}
+	return auditClosure{entry: entry}
+}
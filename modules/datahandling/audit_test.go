@@ -0,0 +1,112 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataHandler_HandleAudited(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	user := geneMeta
+	hashed, err := auth.HashPassword(nil, user.Password)
+	require.NoError(t, err)
+	user.Password = hashed
+	db.MySQLUserRegister(user)
+
+	dh := DataHandler{MessageChan: make(chan rabbitmq.AMQPMessage, 8), Db: db, RemoteAddr: "192.0.2.7"}
+	defer loginThrottles.unlock(addressThrottleKey(dh.RemoteAddr))
+	handle := func(message string) {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		dh.Handle(0, []byte(message), wg)
+	}
+	handle(`{"Tag": 1, "Resource": "User", "Method": "Login", "Data": {"Username": "loganga", "Password": "hunter2"}}`)
+	handle(`{"Tag": 2, "Resource": "User", "Method": "Login", "Data": {"Username": "loganga", "Password": "correct horse battery staple"}}`)
+	// Neither unaudited requests, nor unauthenticated requests to audited methods' actors, are recorded
+	handle(`{"Tag": 3, "Resource": "Project", "Method": "Lookup", "SenderID": "loganga", "SenderToken": "forged", "Data": {}}`)
+	handle(`{"Tag": 4, "Resource": "Project", "Method": "GrantPermissions", "SenderID": "loganga", "SenderToken": "forged", "Data": {"ProjectID": 7}}`)
+
+	require.Len(t, db.AuditLog, 3)
+	assert.Equal(t, "User.Login", db.AuditLog[0].Event)
+	assert.Equal(t, messages.StatusUnauthorized, db.AuditLog[0].Status)
+	assert.Equal(t, "", db.AuditLog[0].Actor)
+	assert.Equal(t, "192.0.2.7", db.AuditLog[0].RemoteAddr)
+	var details map[string]string
+	require.NoError(t, json.Unmarshal([]byte(db.AuditLog[0].Details), &details))
+	assert.Equal(t, map[string]string{"Username": "loganga", "Password": utils.Redacted}, details)
+	assert.Equal(t, messages.StatusSuccess, db.AuditLog[1].Status)
+
+	assert.Equal(t, "Project.GrantPermissions", db.AuditLog[2].Event)
+	assert.Equal(t, messages.StatusUnauthorized, db.AuditLog[2].Status)
+	assert.Equal(t, "", db.AuditLog[2].Actor)
+	assert.Equal(t, int64(7), db.AuditLog[2].ProjectID)
+
+	entry := newAuditClosure(&abstractRequest{Resource: "Admin", Method: "CheckIntegrity", SenderID: "loganga"}, true, messages.StatusSuccess).entry
+	assert.Equal(t, "loganga", entry.Actor)
+	assert.True(t, isAudited("Admin.GetAuditLog"))
+}
+
+func TestAdminGetAuditLogRequest_Process(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+
+	db := dbfs.NewDBMock()
+	for _, entry := range []dbfs.AuditEntryMeta{
+		{Event: "User.Login", Status: messages.StatusUnauthorized},
+		{Event: "User.CreateAPIToken", Actor: "loganga", Status: messages.StatusSuccess},
+		{Event: "User.Login", Status: messages.StatusSuccess},
+	} {
+		require.NoError(t, db.MySQLAuditLogAppend(entry))
+	}
+
+	req := adminGetAuditLogRequest{Event: "User.Login"}
+	setBaseFields(&req)
+	req.Resource = "Admin"
+	req.Method = "GetAuditLog"
+	res, _ := processForTest(t, &req, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	serverCfg.Admins = []string{"loganga"}
+	entries := func() []dbfs.AuditEntryMeta {
+		res, _ := processForTest(t, &req, db)
+		require.Equal(t, messages.StatusSuccess, res.Status)
+		var data struct {
+			Entries []dbfs.AuditEntryMeta
+		}
+		resJSON, err := json.Marshal(res.Data)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(resJSON, &data))
+		return data.Entries
+	}
+	logins := entries()
+	require.Len(t, logins, 2)
+	assert.Equal(t, []int64{1, 3}, []int64{logins[0].AuditID, logins[1].AuditID})
+
+	// Pages continue after the last entry of the previous one
+	req.Event = ""
+	req.Limit = 1
+	req.AfterAuditID = 1
+	page := entries()
+	require.Len(t, page, 1)
+	assert.Equal(t, "loganga", page[0].Actor)
+
+	// Entries before Since are excluded
+	req.Limit = 0
+	req.AfterAuditID = 0
+	req.Since = logins[1].Time.Unix() + 1
+	assert.Empty(t, entries())
+}
@@ -23,13 +23,28 @@ func (tokenPayload) Valid() error {
 	return nil
 }
 
+// Authenticator checks that a request's SenderToken was issued to its SenderID, returning an error if it wasn't
+type Authenticator func(senderID string, token string) error
+
 func authenticate(abs abstractRequest) error {
+	if abs.authenticator != nil {
+		if err := abs.authenticator(abs.SenderID, abs.SenderToken); err != nil {
+			return fmt.Errorf("authenticate - rejected by authenticator: %s", err)
+		}
+		return nil
+	}
+
+	key, err := signingKey(abs.config())
+	if err != nil {
+		return fmt.Errorf("authenticate - failed to load signing key: %s", err)
+	}
+
 	token, err := jwt.ParseWithClaims(abs.SenderToken, &tokenPayload{}, func(token *jwt.Token) (interface{}, error) {
 		// Don't forget to validate the alg is what you expect:
 		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
 			return nil, fmt.Errorf("ParseWithClaims - Unexpected signing method: %v", token.Header["alg"])
 		}
-		return &privKey.PublicKey, nil
+		return &key.PublicKey, nil
 	})
 	if err != nil {
 		return fmt.Errorf("authenticate - failed to parse token: %s", err)
@@ -52,8 +67,12 @@ func authenticate(abs abstractRequest) error {
 	return errors.New("authenticate - claims struct was not of tokenPayload type")
 }
 
-func newAuthToken(username string) (string, error) {
-	tokenValidityDuration, err := config.GetConfig().ServerConfig.TokenValidityDuration()
+func newAuthToken(cfg *config.Config, username string) (string, error) {
+	tokenValidityDuration, err := cfg.ServerConfig.TokenValidityDuration()
+	if err != nil {
+		return "", err
+	}
+	key, err := signingKey(cfg)
 	if err != nil {
 		return "", err
 	}
@@ -64,5 +83,5 @@ func newAuthToken(username string) (string, error) {
 		Validity:     time.Now().Add(tokenValidityDuration).Unix(),
 	})
 
-	return token.SignedString(privKey)
+	return token.SignedString(key)
 }
@@ -2,13 +2,23 @@ package datahandling
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/kr/pretty"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAuthenticateRandomUsernames(t *testing.T) {
@@ -179,3 +189,48 @@ func randomString(strlen int) string {
 	}
 	return string(result)
 }
+
+func TestAuthenticator(t *testing.T) {
+	check := func(senderID string, token string) error {
+		if senderID != "loganga" || token != "issued-elsewhere" {
+			return errors.New("unknown token")
+		}
+		return nil
+	}
+
+	assert.NoError(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: "issued-elsewhere", authenticator: check}))
+	assert.Error(t, authenticate(abstractRequest{SenderID: "notloganga", SenderToken: "issued-elsewhere", authenticator: check}))
+
+	// The server's own tokens are not accepted by servers with an authenticator
+	token := testToken(t, "loganga")
+	assert.Error(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token, authenticator: check}))
+	assert.NoError(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token}))
+}
+
+func TestSigningKey_PerConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "signingkey")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(tmpDir, "signing.pem")
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	withKey := &config.Config{ServerConfig: config.ServerCfg{TokenValidity: "1h", TokenSigningKeyFile: keyFile}}
+	require.NoError(t, LoadTokenSigningKey(withKey))
+	withoutKey := &config.Config{ServerConfig: config.ServerCfg{TokenValidity: "1h"}}
+	missingKey := &config.Config{ServerConfig: config.ServerCfg{TokenSigningKeyFile: filepath.Join(tmpDir, "missing.pem")}}
+	assert.Error(t, LoadTokenSigningKey(missingKey))
+
+	// Each server only accepts the tokens it issued
+	token, err := newAuthToken(withKey, "loganga")
+	require.NoError(t, err)
+	assert.NoError(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token, cfg: withKey}))
+	assert.Error(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token, cfg: withoutKey}))
+	token, err = newAuthToken(withoutKey, "loganga")
+	require.NoError(t, err)
+	assert.Error(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token, cfg: withKey}))
+	assert.NoError(t, authenticate(abstractRequest{SenderID: "loganga", SenderToken: token, cfg: withoutKey}))
+}
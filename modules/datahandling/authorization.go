@@ -0,0 +1,152 @@
+package datahandling
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+)
+
+/**
+ * Authorization for authenticated requests.
+ *
+ * Requests authenticated with a session token may do anything the sender's project permissions allow. Requests
+ * authenticated with an API token are further limited by the token: its scope names the most privileged role it may act
+ * with, and if it lists any projects, it may only access those. Methods that are not listed in apiTokenPolicies, such as
+ * account management, can only be used with a session token.
+ */
+
+// apiTokenPrefix distinguishes API tokens from session tokens in the SenderToken field
+const apiTokenPrefix = "ccapi_"
+
+// apiTokenScopes are the scopes an API token may be created with; "owner" is deliberately excluded
+var apiTokenScopes = []string{"read", "write", "admin"}
+
+type apiTokenPolicy struct {
+	capability config.Capability // The capability a token's scope needs to call the method
+	// The method is not tied to a single project, so project-restricted tokens may not use it
+	unrestrictedOnly bool
+}
+
+// apiTokenPolicies lists the methods API tokens may call. Methods that create projects or teams have no project role to
+// consult, so they require a scope that can edit files.
+var apiTokenPolicies = map[string]apiTokenPolicy{
+	"Project.Create":                 {capability: config.CapabilityEditFiles, unrestrictedOnly: true},
+	"Project.Rename":                 {capability: config.CapabilityRenameProject},
+	"Project.GetPermissionConstants": {capability: config.CapabilityViewProject},
+	"Project.ListRoles":              {capability: config.CapabilityViewProject},
+	"Project.GrantPermissions":       {capability: config.CapabilityManageAccess},
+	"Project.RevokePermissions":      {capability: config.CapabilityManageAccess},
+	"Project.GetOnlineClients":       {capability: config.CapabilityViewProject},
+	"Project.Lookup":                 {capability: config.CapabilityViewProject},
+	"Project.GetFiles":               {capability: config.CapabilityViewProject},
+	"Project.Subscribe":              {capability: config.CapabilityViewProject},
+	"Project.Unsubscribe":            {capability: config.CapabilityViewProject},
+	"Project.Search":                 {capability: config.CapabilityViewProject},
+	"Project.Delete":                 {capability: config.CapabilityManageAccess},
+	"Project.Unarchive":              {capability: config.CapabilityEditFiles},
+	"Project.ImportFromGit":          {capability: config.CapabilityEditFiles},
+	"Project.SetLineEndings":         {capability: config.CapabilityManageSettings},
+	"Project.SetIgnoreRules":         {capability: config.CapabilityManageSettings},
+	"Project.GetIgnoreRules":         {capability: config.CapabilityViewProject},
+	"Project.GetSettings":            {capability: config.CapabilityViewProject},
+	"Project.UpdateSettings":         {capability: config.CapabilityManageSettings},
+	"Project.GetNotificationsSince":  {capability: config.CapabilityViewProject},
+	"Project.Sync":                   {capability: config.CapabilityViewProject},
+	"File.Create":                    {capability: config.CapabilityEditFiles},
+	"File.Rename":                    {capability: config.CapabilityEditFiles},
+	"File.Move":                      {capability: config.CapabilityEditFiles},
+	"File.Delete":                    {capability: config.CapabilityEditFiles},
+	"File.Change":                    {capability: config.CapabilityEditFiles},
+	"File.Pull":                      {capability: config.CapabilityViewProject},
+	"File.GetHistory":                {capability: config.CapabilityViewProject},
+	"File.Annotate":                  {capability: config.CapabilityViewProject},
+	"File.Diff":                      {capability: config.CapabilityViewProject},
+	"File.Search":                    {capability: config.CapabilityViewProject},
+	"File.SetMetadata":               {capability: config.CapabilityEditFiles},
+	"File.GetMetadata":               {capability: config.CapabilityViewProject},
+	"Comment.Create":                 {capability: config.CapabilityViewProject},
+	"Comment.Reply":                  {capability: config.CapabilityViewProject},
+	"Comment.Resolve":                {capability: config.CapabilityViewProject},
+	"Comment.React":                  {capability: config.CapabilityViewProject},
+	"Comment.List":                   {capability: config.CapabilityViewProject},
+	"Notification.Ack":               {capability: config.CapabilityViewProject},
+	"Notification.GetAcks":           {capability: config.CapabilityViewProject},
+	"Team.Create":                    {capability: config.CapabilityEditFiles, unrestrictedOnly: true},
+	"Team.AddMember":                 {capability: config.CapabilityManageAccess, unrestrictedOnly: true},
+	"Team.GrantProjectAccess":        {capability: config.CapabilityManageAccess},
+	"User.Lookup":                    {capability: config.CapabilityViewProject},
+	"User.Search":                    {capability: config.CapabilityViewProject},
+	"User.GetAvatar":                 {capability: config.CapabilityViewProject},
+	"User.Projects":                  {capability: config.CapabilityViewProject},
+	"User.GetNotificationPrefs":      {capability: config.CapabilityViewProject},
+	"Session.Resume":                 {capability: config.CapabilityViewProject},
+}
+
+// ErrForbiddenByToken is returned when an API token's scope or project restrictions do not allow a request
+var ErrForbiddenByToken = errors.New("The API token does not allow this request")
+
+// authenticateAPIToken checks the API token in the request, and attaches it to the request for authorization.
+func authenticateAPIToken(req *abstractRequest, db dbfs.DBFS) error {
+	hash := auth.HashToken(strings.TrimPrefix(req.SenderToken, apiTokenPrefix))
+	token, err := db.MySQLAPITokenLookup(hash)
+	if err != nil {
+		return errors.New("authenticate - invalid or expired API token")
+	}
+	// API tokens are renamed with their user, but clients may still send the username the token was created under
+	if !strings.EqualFold(token.Username, req.SenderID) && !strings.EqualFold(token.Username, usernameAliases.resolve(req.SenderID, db)) {
+		return errors.New("authenticate - senderID did not match API token username")
+	}
+
+	req.apiToken = &token
+	return nil
+}
+
+// authorizeRequest checks that the request's method is allowed by its API token, if it was made with one.
+func authorizeRequest(req *abstractRequest) error {
+	if req.apiToken == nil {
+		return nil
+	}
+
+	policy, ok := apiTokenPolicies[req.Resource+"."+req.Method]
+	if !ok || !scopeAllows(req.apiToken.Scope, policy.capability) {
+		return ErrForbiddenByToken
+	}
+	if policy.unrestrictedOnly && len(req.apiToken.ProjectIDs) > 0 {
+		return ErrForbiddenByToken
+	}
+	return nil
+}
+
+// authorizeProject checks that the sender's role on the project has the given capability, and that their API token, if
+// any, allows using it on the project.
+func authorizeProject(abs abstractRequest, projectID int64, capability config.Capability, db dbfs.DBFS) (bool, error) {
+	if abs.apiToken != nil && (!scopeAllows(abs.apiToken.Scope, capability) || !abs.tokenAllowsProject(projectID)) {
+		return false, nil
+	}
+	return dbfs.HasCapability(abs.SenderID, projectID, capability, db)
+}
+
+// tokenAllowsProject returns false if the request was made with an API token that is restricted to other projects.
+func (abs abstractRequest) tokenAllowsProject(projectID int64) bool {
+	if abs.apiToken == nil || len(abs.apiToken.ProjectIDs) == 0 {
+		return true
+	}
+	for _, allowed := range abs.apiToken.ProjectIDs {
+		if allowed == projectID {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllows returns true if the role named by the token scope has the given capability.
+func scopeAllows(scope string, capability config.Capability) bool {
+	role, err := config.RoleByName(scope)
+	if err != nil {
+		return false
+	}
+	return role.Can(capability)
+}
@@ -0,0 +1,98 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAPIToken stores an API token for geneMeta in the mock, and returns the token to send
+func newTestAPIToken(t *testing.T, db *dbfs.DatabaseMock, scope string, projectIDs ...int64) string {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.MySQLAPITokenCreate(hash, dbfs.APITokenMeta{
+		Username:   geneMeta.Username,
+		Name:       "test",
+		Scope:      scope,
+		ProjectIDs: projectIDs,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apiTokenPrefix + token
+}
+
+func TestGetFullRequest_APIToken(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	readToken := newTestAPIToken(t, db, "read")
+	restrictedToken := newTestAPIToken(t, db, "write", 1)
+
+	tests := []struct {
+		desc     string
+		senderID string
+		token    string
+		resource string
+		method   string
+		err      error
+	}{
+		{"Read token, read method", geneMeta.Username, readToken, "File", "Pull", nil},
+		{"Read token, write method", geneMeta.Username, readToken, "File", "Change", ErrForbiddenByToken},
+		{"Token management requires a session", geneMeta.Username, readToken, "User", "CreateAPIToken", ErrForbiddenByToken},
+		{"Restricted token, project method", geneMeta.Username, restrictedToken, "Project", "Rename", nil},
+		{"Restricted token, unrestricted method", geneMeta.Username, restrictedToken, "Project", "Create", ErrForbiddenByToken},
+		{"Wrong sender", "someoneelse", readToken, "File", "Pull", ErrAuthenticationFailed},
+		{"Unknown token", geneMeta.Username, apiTokenPrefix + "notarealtoken", "File", "Pull", ErrAuthenticationFailed},
+	}
+
+	for _, test := range tests {
+		req := abstractRequest{
+			Resource:    test.resource,
+			Method:      test.method,
+			SenderID:    test.senderID,
+			SenderToken: test.token,
+			Data:        json.RawMessage(`{"FileID": 1, "ProjectID": 1, "Name": "new", "NewName": "new"}`),
+		}
+
+		_, err := getFullRequest(&req, db)
+		assert.Equal(t, test.err, err, test.desc)
+	}
+}
+
+func TestAuthorizeProject(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID1, _ := db.MySQLProjectCreate(geneMeta.Username, "_test_project1")
+	projectID2, _ := db.MySQLProjectCreate(geneMeta.Username, "_test_project2")
+
+	session := abstractRequest{SenderID: geneMeta.Username}
+	allowed, err := authorizeProject(session, projectID2, config.CapabilityDeleteProject, db)
+	assert.NoError(t, err)
+	assert.True(t, allowed, "session requests should be limited only by project permissions")
+
+	restricted := abstractRequest{
+		SenderID: geneMeta.Username,
+		apiToken: &dbfs.APITokenMeta{Scope: "write", ProjectIDs: []int64{projectID1}},
+	}
+	allowed, err = authorizeProject(restricted, projectID1, config.CapabilityEditFiles, db)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = authorizeProject(restricted, projectID1, config.CapabilityManageAccess, db)
+	assert.NoError(t, err)
+	assert.False(t, allowed, "token scope should cap the role")
+
+	allowed, err = authorizeProject(restricted, projectID2, config.CapabilityViewProject, db)
+	assert.NoError(t, err)
+	assert.False(t, allowed, "token should be restricted to its projects")
+}
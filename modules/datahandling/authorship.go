@@ -0,0 +1,85 @@
+package datahandling
+
+import (
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+/**
+ * Every patch is stored with the username of its author and the time the server received it, in the patch's metadata,
+ * so that clients can show who last changed each line. Clients may set the ClientID of their patches' metadata to
+ * tell their own editors apart; the author and timestamp they set are replaced.
+ *
+ * The stored patches carry their metadata in File.Pull and in File.Change notifications. File.GetHistory returns it
+ * parsed, for clients that don't parse patches themselves, and File.Annotate returns the authorship of the patch that
+ * last changed each line of the file. Only the patches since the file was last scrunched are kept, so lines unchanged
+ * since then have no authorship. Authors are recorded under the username they had when they made the patch, which
+ * is resolved to their current one wherever authorship is described; see aliases.go.
+ */
+
+// patchAuthorship is the metadata of a stored patch, and the version it made
+type patchAuthorship struct {
+	FileVersion int64 // The version of the file the patch made
+	Author      string
+	ClientID    string
+	Timestamp   int64 // Seconds since the Unix epoch; 0 for patches stored before authorship was recorded
+}
+
+// stampAuthorship sets the author and timestamp of a patch from a client. Patches that cannot be parsed are returned
+// unchanged, for CBAppendFileChange to reject.
+func stampAuthorship(patchStr string, author string) string {
+	patch, err := patching.NewPatchFromString(patchStr)
+	if err != nil {
+		return patchStr
+	}
+	patch.Metadata.Author = author
+	patch.Metadata.Timestamp = time.Now().Unix()
+	return patch.String()
+}
+
+// describeAuthorship returns the metadata of each stored patch, with authors who have since changed their username
+// under their current one
+func describeAuthorship(changes []string, db dbfs.DBFS) ([]patchAuthorship, error) {
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	authorship := make([]patchAuthorship, len(patches))
+	for i, patch := range patches {
+		authorship[i] = patchAuthorship{
+			FileVersion: patch.BaseVersion + 1,
+			Author:      usernameAliases.resolve(patch.Metadata.Author, db),
+			ClientID:    patch.Metadata.ClientID,
+			Timestamp:   patch.Metadata.Timestamp,
+		}
+	}
+	return authorship, nil
+}
+
+// annotateLines returns the authorship of the patch that last changed each line of the file, from its stored contents
+// and the patches stored since
+func annotateLines(raw []byte, changes []string, db dbfs.DBFS) ([]patchAuthorship, error) {
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return nil, err
+	}
+	authorship, err := describeAuthorship(changes, db)
+	if err != nil {
+		return nil, err
+	}
+
+	changedBy, err := patching.AnnotateText(string(raw), patches)
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]patchAuthorship, len(changedBy))
+	for i, index := range changedBy {
+		if index >= 0 {
+			lines[i] = authorship[index]
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,141 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withoutAuthorship strips the metadata from a stored patch, for tests of what it changes
+func withoutAuthorship(t *testing.T, patchStr string) string {
+	patch, err := patching.NewPatchFromString(patchStr)
+	require.NoError(t, err)
+	patch.Metadata = patching.Metadata{}
+	return patch.String()
+}
+
+// allWithoutAuthorship strips the metadata from stored patches
+func allWithoutAuthorship(t *testing.T, patchStrs interface{}) []string {
+	stripped := []string{}
+	for _, patchStr := range patchStrs.([]string) {
+		stripped = append(stripped, withoutAuthorship(t, patchStr))
+	}
+	return stripped
+}
+
+func TestStampAuthorship(t *testing.T) {
+	before := time.Now().Unix()
+	stamped, err := patching.NewPatchFromString(stampAuthorship("v1:\n0:+1:a:\n10:\nauthor=gene&client=vim", "loganga"))
+	require.NoError(t, err)
+	assert.Equal(t, "loganga", stamped.Metadata.Author, "clients can't claim another author")
+	assert.Equal(t, "vim", stamped.Metadata.ClientID)
+	assert.True(t, stamped.Metadata.Timestamp >= before)
+
+	assert.Equal(t, "not a patch", stampAuthorship("not a patch", "loganga"))
+}
+
+func TestFileGetHistory(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.CBInsertNewFile(fileID, 1, []string{})
+	fileBytes := []byte("one\ntwo\n")
+	db.File = &fileBytes
+
+	// Stored before authorship was recorded
+	db.FileChanges[fileID] = []string{"v1:\n0:+1:x:\n8"}
+	db.FileVersion[fileID] = 2
+
+	change := fileChangeRequest{FileID: fileID, Changes: "v2:\n1:+1:y:\n9:\nclient=eclipse"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+	res, not := processForTest(t, &change, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	notified, err := patching.NewPatchFromString(reflect.ValueOf(not.Data).FieldByName("Changes").String())
+	require.NoError(t, err)
+	assert.Equal(t, "loganga", notified.Metadata.Author)
+
+	history := fileGetHistoryRequest{FileID: fileID}
+	setBaseFields(&history)
+	history.Resource = "File"
+	history.Method = "GetHistory"
+	// Authors are resolved through the cache of username aliases, which is filled first so that only the request's own
+	// calls are counted
+	usernameAliases.resolve("loganga", db)
+	db.FunctionCallCount = 0
+	res, _ = processForTest(t, &history, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, 4, db.FunctionCallCount)
+
+	data := reflect.ValueOf(res.Data)
+	assert.Equal(t, int64(3), data.FieldByName("FileVersion").Int())
+	assert.Equal(t, []string{"v1:\n0:+1:x:\n8", "v2:\n1:+1:y:\n9"}, allWithoutAuthorship(t, data.FieldByName("Changes").Interface()))
+	authorship := data.FieldByName("Authorship").Interface().([]patchAuthorship)
+	require.Len(t, authorship, 2)
+	assert.Equal(t, patchAuthorship{FileVersion: 2}, authorship[0])
+	assert.Equal(t, int64(3), authorship[1].FileVersion)
+	assert.Equal(t, "loganga", authorship[1].Author)
+	assert.Equal(t, "eclipse", authorship[1].ClientID)
+	assert.NotZero(t, authorship[1].Timestamp)
+
+	pull := filePullRequest{FileID: fileID}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, authorship, reflect.ValueOf(res.Data).FieldByName("Authorship").Interface())
+
+	// Users who can't view the project can't see its history
+	history.SenderID = "notloganga"
+	res, _ = processForTest(t, &history, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+}
+
+func TestFileAnnotate(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.CBInsertNewFile(fileID, 1, []string{})
+	fileBytes := []byte("one\ntwo\nthree\n")
+	db.File = &fileBytes
+
+	db.FileChanges[fileID] = []string{
+		"v1:\n0:+1:x:\n14:\nauthor=gene&time=100",
+		"v2:\n5:+1:y:\n15:\nauthor=loganga&client=vim&time=200",
+	}
+	db.FileVersion[fileID] = 3
+
+	annotate := fileAnnotateRequest{FileID: fileID}
+	setBaseFields(&annotate)
+	annotate.Resource = "File"
+	annotate.Method = "Annotate"
+	usernameAliases.resolve("gene", db)
+	usernameAliases.resolve("loganga", db)
+	db.FunctionCallCount = 0
+	res, _ := processForTest(t, &annotate, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, 4, db.FunctionCallCount)
+	assert.Equal(t, []patchAuthorship{
+		{FileVersion: 2, Author: "gene", Timestamp: 100},
+		{FileVersion: 3, Author: "loganga", ClientID: "vim", Timestamp: 200},
+		{},
+	}, reflect.ValueOf(res.Data).FieldByName("Lines").Interface())
+
+	// Patches that don't apply to the stored contents can't be annotated
+	db.FileChanges[fileID] = []string{"v1:\n0:-3:two:\n14"}
+	closures, err := annotate.process(db)
+	assert.Error(t, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
@@ -0,0 +1,345 @@
+package datahandling
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Clients of fast typists can send File.Change with Coalesce set, so that the server composes the changes they send
+ * to a file in quick succession into a single patch, appending it once as a single version, with a single
+ * notification. Such clients don't wait for each change's response before sending the next: each change is made
+ * against the FileVersion of the latest response they have, and the changes they have sent since, which they are
+ * still waiting for responses to.
+ *
+ * The first such change to a file on a connection is held for the ChangeBatchWindow, while the connection's changes
+ * to the file made against the same version are composed with it, up to maxBatchedChanges, before the composed patch
+ * is appended. Every change in the batch is answered with the version the composed patch made; the last one's
+ * response carries the composed patch as transformed, and the patches it was transformed against, while the others
+ * are marked Coalesced. Changes that arrive once the batch has been closed, made against the same version, are made
+ * against that version too, and so are appended on top of it. Without a ChangeBatchWindow, each change is its own
+ * batch, appended as soon as it arrives.
+ *
+ * The connection's messages are handled concurrently, so its DataHandler's MessageOrder numbers them as they are
+ * received, and each change waits for the connection's earlier messages to join their batch, or to turn out not to be
+ * changes, before joining its own. Changes are thus composed and appended in the order the connection sent them.
+ *
+ * Changes from CRLF clients are not coalesced.
+ */
+
+// maxOrderWait is the longest a change waits for the connection's earlier messages, in case one is never processed
+const maxOrderWait = 10 * time.Second
+
+// maxBatchedChanges is the most changes composed into a single patch; the batch is appended once it has this many
+const maxBatchedChanges = 64
+
+// changeBatches are the batches of changes being composed, and the versions earlier batches made
+var changeBatches = &changeBatcher{
+	batches: make(map[string]*changeBatch),
+	flushed: make(map[string]flushedBatch),
+}
+
+type changeBatcher struct {
+	mutex   sync.Mutex
+	batches map[string]*changeBatch // By session ID and file ID
+	flushed map[string]flushedBatch // The connection's last batch appended to each file; by session ID and file ID
+}
+
+// flushedBatch records the version a batch of changes, made against baseVersion, was appended as
+type flushedBatch struct {
+	baseVersion int64
+	version     int64
+	at          time.Time
+}
+
+type changeBatch struct {
+	baseVersion int64 // The version the changes were made against, as the client sent it
+	changes     []*batchedChange
+	closed      bool          // Set once the batch is being appended, after which no more changes may join it
+	full        chan struct{} // Closed once the batch has maxBatchedChanges
+	done        chan struct{} // Closed once the batch has been appended
+}
+
+type batchedChange struct {
+	req    fileChangeRequest
+	patch  *patching.Patch
+	result chan batchResult
+}
+
+type batchResult struct {
+	closures []dhClosure
+	err      error
+}
+
+// MessageOrder numbers a connection's messages in the order they are received, and lets each wait its turn, until
+// every earlier message has passed its own. It is safe for concurrent use; a nil MessageOrder orders nothing.
+type MessageOrder struct {
+	mutex    sync.Mutex
+	received uint64              // The number of the last message received
+	next     uint64              // The first message whose turn has not passed
+	passed   map[uint64]struct{} // Later messages whose turn has passed
+	advanced chan struct{}       // Closed, and replaced, whenever next advances
+}
+
+// NewMessageOrder creates the MessageOrder of a new connection
+func NewMessageOrder() *MessageOrder {
+	return &MessageOrder{
+		next:     1,
+		passed:   make(map[uint64]struct{}),
+		advanced: make(chan struct{}),
+	}
+}
+
+// receive numbers the next message received, from 1; 0 if there is no order
+func (order *MessageOrder) receive() uint64 {
+	if order == nil {
+		return 0
+	}
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	order.received++
+	return order.received
+}
+
+// pass ends the turn of the message with the given number, once it no longer holds up later ones. Passing a turn
+// twice has no effect.
+func (order *MessageOrder) pass(sequence uint64) {
+	if order == nil || sequence == 0 {
+		return
+	}
+	order.mutex.Lock()
+	defer order.mutex.Unlock()
+	if sequence < order.next {
+		return
+	}
+	order.passed[sequence] = struct{}{}
+	if sequence != order.next {
+		return
+	}
+	for {
+		if _, ok := order.passed[order.next]; !ok {
+			break
+		}
+		delete(order.passed, order.next)
+		order.next++
+	}
+	close(order.advanced)
+	order.advanced = make(chan struct{})
+}
+
+// wait waits for the turn of the message with the given number, returning false if it did not come within the timeout
+func (order *MessageOrder) wait(sequence uint64, timeout time.Duration) bool {
+	if order == nil || sequence == 0 {
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		order.mutex.Lock()
+		turn := order.next >= sequence
+		advanced := order.advanced
+		order.mutex.Unlock()
+		if turn {
+			return true
+		}
+
+		select {
+		case <-advanced:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// flushedBatchTTL is how long the version a batch was appended as is remembered, for the changes the client sent
+// before it was told
+const flushedBatchTTL = time.Minute
+
+func changeBatchKey(sessionID string, fileID int64) string {
+	return fmt.Sprintf("%s %d", sessionID, fileID)
+}
+
+// coalesceChange appends the change as part of a batch of the connection's changes to the file
+func coalesceChange(f fileChangeRequest, fileMeta dbfs.FileMeta, db dbfs.DBFS) ([]dhClosure, error) {
+	patch, err := patching.NewPatchFromString(f.Changes)
+	if err != nil || f.sessionID == "" {
+		// Changes that cannot be parsed are left for CBAppendFileChange to reject
+		return f.appendChange(fileMeta, nil, db)
+	}
+	window, err := f.config().ServerConfig.ChangeBatchWindowDuration()
+	if err != nil {
+		utils.LogError("Invalid change batch window", err, nil)
+	}
+
+	// Changes join their batches in the order the connection sent them
+	if !f.order.wait(f.sequence, maxOrderWait) {
+		utils.LogWarn("Coalescing change out of order, after waiting for earlier messages", utils.LogFields{
+			"FileID":   f.FileID,
+			"Sequence": f.sequence,
+		})
+	}
+
+	key := changeBatchKey(f.sessionID, f.FileID)
+	change := &batchedChange{req: f, patch: patch, result: make(chan batchResult, 1)}
+	for {
+		changeBatches.mutex.Lock()
+		batch := changeBatches.batches[key]
+		if batch == nil {
+			batch = &changeBatch{
+				baseVersion: patch.BaseVersion,
+				changes:     []*batchedChange{change},
+				full:        make(chan struct{}),
+				done:        make(chan struct{}),
+			}
+			changeBatches.batches[key] = batch
+			changeBatches.mutex.Unlock()
+			f.order.pass(f.sequence)
+			return changeBatches.lead(key, batch, fileMeta, window, db)
+		}
+		if !batch.closed && batch.baseVersion == patch.BaseVersion {
+			batch.changes = append(batch.changes, change)
+			if len(batch.changes) == maxBatchedChanges {
+				close(batch.full)
+				batch.closed = true
+			}
+			changeBatches.mutex.Unlock()
+			f.order.pass(f.sequence)
+			result := <-change.result
+			return result.closures, result.err
+		}
+		changeBatches.mutex.Unlock()
+
+		// The change follows the batch being appended, or was made against another version
+		<-batch.done
+	}
+}
+
+// lead waits for the batch's window to pass, or for it to fill up, then appends it, and answers its changes
+func (batcher *changeBatcher) lead(key string, batch *changeBatch, fileMeta dbfs.FileMeta, window time.Duration,
+	db dbfs.DBFS) ([]dhClosure, error) {
+	if window > 0 {
+		timer := time.NewTimer(window)
+		select {
+		case <-timer.C:
+		case <-batch.full:
+			timer.Stop()
+		}
+	}
+
+	batcher.mutex.Lock()
+	batch.closed = true
+	changes := batch.changes
+	baseVersion := batch.baseVersion
+	if flushed, ok := batcher.flushed[key]; ok && flushed.baseVersion == baseVersion {
+		// The client made the changes before it was told the version the previous batch was appended as
+		baseVersion = flushed.version
+	}
+	batcher.mutex.Unlock()
+
+	results := appendBatch(changes, baseVersion, fileMeta, db)
+
+	batcher.mutex.Lock()
+	now := time.Now()
+	if version, ok := batchVersion(results[len(results)-1].closures, changes[len(changes)-1].req.Tag); ok {
+		batcher.flushed[key] = flushedBatch{baseVersion: batch.baseVersion, version: version, at: now}
+	}
+	for flushedKey, flushed := range batcher.flushed {
+		if now.Sub(flushed.at) > flushedBatchTTL {
+			delete(batcher.flushed, flushedKey)
+		}
+	}
+	delete(batcher.batches, key)
+	batcher.mutex.Unlock()
+	close(batch.done)
+
+	for i, change := range changes[1:] {
+		change.result <- results[i+1]
+	}
+	return results[0].closures, results[0].err
+}
+
+// appendBatch composes the changes into a single patch, made against baseVersion, appends it, and returns each
+// change's closures. The notification and the other consequences of the append go to the first change.
+func appendBatch(changes []*batchedChange, baseVersion int64, fileMeta dbfs.FileMeta, db dbfs.DBFS) []batchResult {
+	last := changes[len(changes)-1]
+	patches := make([]*patching.Patch, len(changes))
+	for i, change := range changes {
+		patches[i] = change.patch
+	}
+	composed, err := patching.ConsolidatePatches(patches)
+	if err != nil {
+		utils.LogError("Failed to compose changes", err, utils.LogFields{
+			"FileID":  fileMeta.FileID,
+			"Changes": len(changes),
+		})
+		return failedBatch(changes, err)
+	}
+	composed.BaseVersion = baseVersion
+	composed.Metadata = last.patch.Metadata
+
+	req := last.req
+	req.Changes = composed.String()
+	closures, err := req.appendChange(fileMeta, nil, db)
+	res, ok := senderResponse(closures, req.Tag)
+	if !ok {
+		utils.LogError("Appending changes returned no response", err, utils.LogFields{
+			"FileID":  fileMeta.FileID,
+			"Changes": len(changes),
+		})
+		return failedBatch(changes, err)
+	}
+	version, _ := batchVersion(closures, req.Tag)
+
+	results := make([]batchResult, len(changes))
+	for i, change := range changes[:len(changes)-1] {
+		coalesced := res
+		coalesced.Tag = change.req.Tag
+		if res.Status == messages.StatusSuccess {
+			coalesced.Data = struct {
+				FileVersion int64
+				Coalesced   bool // The change was composed with later ones, whose response carries the patch appended
+			}{
+				FileVersion: version,
+				Coalesced:   true,
+			}
+		}
+		results[i] = batchResult{closures: []dhClosure{toSenderClosure{msg: coalesced.Wrap()}}, err: err}
+	}
+	results[len(changes)-1] = batchResult{err: err}
+	for _, closure := range closures {
+		if _, ok := senderResponse([]dhClosure{closure}, req.Tag); ok && results[len(changes)-1].closures == nil {
+			results[len(changes)-1].closures = []dhClosure{closure}
+		} else {
+			results[0].closures = append(results[0].closures, closure)
+		}
+	}
+	return results
+}
+
+// failedBatch answers each of the changes with a failure
+func failedBatch(changes []*batchedChange, err error) []batchResult {
+	results := make([]batchResult, len(changes))
+	for i, change := range changes {
+		results[i] = batchResult{
+			closures: []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, change.req.Tag)}},
+			err:      err,
+		}
+	}
+	return results
+}
+
+// batchVersion returns the version the change appendChange answered was appended as, if it was
+func batchVersion(closures []dhClosure, tag int64) (int64, bool) {
+	res, ok := senderResponse(closures, tag)
+	if !ok || res.Status != messages.StatusSuccess {
+		return 0, false
+	}
+	data, ok := res.Data.(fileChangeResponse)
+	return data.FileVersion, ok
+}
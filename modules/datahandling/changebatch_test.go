@@ -0,0 +1,198 @@
+package datahandling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalesceChange(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(window string) {
+		serverCfg.ChangeBatchWindow = window
+	}(serverCfg.ChangeBatchWindow)
+	serverCfg.ChangeBatchWindow = "200ms"
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "new file", "", projectID)
+	db.CBInsertNewFile(fileID, newFileVersion, []string{})
+	fileMeta, err := db.MySQLFileGetInfo(fileID)
+	require.NoError(t, err)
+
+	type result struct {
+		closures []dhClosure
+		err      error
+	}
+	sessionID := NewSessionID()
+	order := NewMessageOrder()
+	// newChange numbers the change as the connection would on receiving it
+	newChange := func(tag int64, changes string) fileChangeRequest {
+		req := fileChangeRequest{FileID: fileID, Changes: changes, Coalesce: true}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Change"
+		req.Tag = tag
+		req.sessionID = sessionID
+		req.order = order
+		req.sequence = order.receive()
+		return req
+	}
+	send := func(req fileChangeRequest) chan result {
+		done := make(chan result, 1)
+		go func() {
+			closures, err := coalesceChange(req, fileMeta, db)
+			done <- result{closures, err}
+		}()
+		return done
+	}
+	change := func(tag int64, changes string) chan result {
+		return send(newChange(tag, changes))
+	}
+
+	// The connection's changes are handled concurrently, so they may be processed in any order
+	requests := []fileChangeRequest{
+		newChange(1, "v1:\n0:+1:a:\n0"),
+		newChange(2, "v1:\n1:+1:b:\n1"),
+		newChange(3, "v1:\n2:+1:c:\n2"),
+	}
+	third := send(requests[2])
+	time.Sleep(10 * time.Millisecond)
+	second := send(requests[1])
+	time.Sleep(10 * time.Millisecond)
+	first := send(requests[0])
+
+	results := []result{<-first, <-second, <-third}
+	for i, res := range results {
+		require.NoError(t, res.err)
+		response := res.closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+		assert.Equal(t, messages.StatusSuccess, response.Status)
+		assert.EqualValues(t, i+1, response.Tag, "each change should be answered with its own tag")
+	}
+	require.Len(t, db.FileChanges[fileID], 1, "the changes should have been appended as a single version")
+	composed, err := patching.NewPatchFromString(db.FileChanges[fileID][0])
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, composed.BaseVersion)
+	text, err := composed.Apply("")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", text)
+
+	assert.Len(t, results[0].closures, 2, "only the first change's closures should notify the project")
+	assert.Len(t, results[1].closures, 1)
+	assert.Len(t, results[2].closures, 1)
+	coalesced := results[1].closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Data
+	assert.EqualValues(t, 2, coalesced.(struct {
+		FileVersion int64
+		Coalesced   bool
+	}).FileVersion)
+	last := results[2].closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Data.(fileChangeResponse)
+	assert.EqualValues(t, 2, last.FileVersion)
+
+	// A change made before the client was told of the batch's version is rebased onto it
+	serverCfg.ChangeBatchWindow = ""
+	res := <-change(4, "v1:\n3:+1:d:\n3")
+	require.NoError(t, res.err)
+	require.Len(t, db.FileChanges[fileID], 2)
+	rebased, err := patching.NewPatchFromString(db.FileChanges[fileID][1])
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, rebased.BaseVersion)
+}
+
+func TestCoalesceChange_Unbatched(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(window string) {
+		serverCfg.ChangeBatchWindow = window
+	}(serverCfg.ChangeBatchWindow)
+	serverCfg.ChangeBatchWindow = ""
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "new file", "", projectID)
+	db.CBInsertNewFile(fileID, newFileVersion, []string{})
+	fileMeta, err := db.MySQLFileGetInfo(fileID)
+	require.NoError(t, err)
+
+	// Changes sent concurrently, each made without waiting for the previous one's response, are appended in order
+	sessionID := NewSessionID()
+	order := NewMessageOrder()
+	changes := []string{"v1:\n0:+1:a:\n0", "v1:\n1:+1:b:\n1", "v1:\n2:+1:c:\n2", "v1:\n3:+1:d:\n3"}
+	requests := make([]fileChangeRequest, len(changes))
+	for i, changes := range changes {
+		req := fileChangeRequest{FileID: fileID, Changes: changes, Coalesce: true}
+		setBaseFields(&req)
+		req.Tag = int64(i + 1)
+		req.sessionID = sessionID
+		req.order = order
+		req.sequence = order.receive()
+		requests[i] = req
+	}
+	done := make(chan error, len(requests))
+	for i := len(requests) - 1; i >= 0; i-- {
+		go func(req fileChangeRequest) {
+			_, err := coalesceChange(req, fileMeta, db)
+			done <- err
+		}(requests[i])
+		time.Sleep(10 * time.Millisecond)
+	}
+	for range requests {
+		require.NoError(t, <-done)
+	}
+
+	require.Len(t, db.FileChanges[fileID], len(changes), "each change should be its own version")
+	text := ""
+	for i, change := range db.FileChanges[fileID] {
+		patch, err := patching.NewPatchFromString(change)
+		require.NoError(t, err)
+		assert.EqualValues(t, i+1, patch.BaseVersion)
+		text, err = patch.Apply(text)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "abcd", text)
+}
+
+func TestMessageOrder(t *testing.T) {
+	order := NewMessageOrder()
+	first, second, third := order.receive(), order.receive(), order.receive()
+	assert.True(t, order.wait(first, time.Millisecond))
+	assert.False(t, order.wait(third, time.Millisecond), "earlier messages haven't passed their turns")
+
+	order.pass(second)
+	assert.False(t, order.wait(third, time.Millisecond))
+	order.pass(first)
+	assert.True(t, order.wait(third, time.Millisecond))
+	order.pass(first)
+	assert.True(t, order.wait(third, time.Millisecond), "passing a turn twice should have no effect")
+
+	var unordered *MessageOrder
+	assert.EqualValues(t, 0, unordered.receive())
+	unordered.pass(1)
+	assert.True(t, unordered.wait(1, time.Millisecond))
+}
+
+func TestBatchWithoutResponse(t *testing.T) {
+	// Closures that don't start with the sender's response fail every change, rather than panicking the lead
+	for _, closures := range [][]dhClosure{nil, {toRabbitChannelClosure{key: "project"}}} {
+		_, ok := batchVersion(closures, 1)
+		assert.False(t, ok)
+	}
+
+	changes := []*batchedChange{{req: fileChangeRequest{}}, {req: fileChangeRequest{}}}
+	changes[0].req.Tag, changes[1].req.Tag = 1, 2
+	for i, result := range failedBatch(changes, nil) {
+		require.Len(t, result.closures, 1)
+		res, ok := senderResponse(result.closures, int64(i+1))
+		require.True(t, ok)
+		assert.Equal(t, messages.StatusFail, res.Status)
+		assert.EqualValues(t, i+1, res.Tag)
+	}
+}
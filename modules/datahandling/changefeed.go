@@ -0,0 +1,240 @@
+package datahandling
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * The change feed exports each project's File notifications, such as File.Change, to other services, by posting them
+ * to the configured webhooks, so that they needn't read the databases. It tails the notification sequence: each
+ * project's cursor, in MySQL, is the sequence number of the last notification exported, and every Interval, the
+ * projects this server sent File notifications for have their stored notifications since their cursor posted, before
+ * the cursor is moved past them.
+ *
+ * Notifications are delivered in order, at least once: those whose delivery fails are posted again, to every webhook,
+ * with the next notification of their project, and two servers may both post the same ones. Consumers should discard
+ * notifications whose Sequence they have already seen for the project. Projects that fall further behind than
+ * notifications are stored for skip the ones they missed, which is logged, and posted as MissedFrom and MissedTo.
+ *
+ * Each request is a changeFeedBatch. If a Secret is configured, its body is signed with HMAC-SHA256, sent as
+ * "sha256=<hex>" in the X-CodeCollaborate-Signature header. Services that want the notifications in Kafka, or another
+ * queue, can be sent them by a webhook that publishes what it is posted.
+ */
+
+const changeFeedSignatureHeader = "X-CodeCollaborate-Signature"
+
+// changeFeedTimeout is how long each webhook has to answer
+const changeFeedTimeout = 10 * time.Second
+
+// changeFeedRetries is the number of times a failed post is retried before the project is left for the next interval
+const changeFeedRetries = 2
+
+// changeFeedRetryDelay is the delay before the first retry; it grows with each retry
+var changeFeedRetryDelay = time.Second
+
+// changeFeedBatch is the body of the change feed's requests
+type changeFeedBatch struct {
+	ProjectID     int64
+	Notifications []json.RawMessage // In the order of their Sequence
+
+	// Set if the notifications after MissedFrom, up to and including MissedTo, were lost before they were exported
+	MissedFrom int64 `json:",omitempty"`
+	MissedTo   int64 `json:",omitempty"`
+}
+
+var changeFeed struct {
+	mutex    sync.Mutex
+	cfg      config.ChangeFeedCfg
+	client   *http.Client
+	projects map[int64]bool // Projects with notifications to export; nil while the change feed is disabled
+}
+
+// EnableChangeFeed starts exporting projects' File notifications to the configured webhooks, until control is shut
+// down
+func EnableChangeFeed(cfg config.ChangeFeedCfg, db dbfs.DBFS, control *utils.Control) error {
+	interval, err := cfg.IntervalDuration()
+	if err == nil && interval <= 0 {
+		err = fmt.Errorf("Interval must be positive")
+	}
+	if err != nil {
+		return err
+	}
+
+	changeFeed.mutex.Lock()
+	changeFeed.cfg = cfg
+	changeFeed.client = &http.Client{Timeout: changeFeedTimeout}
+	changeFeed.projects = make(map[int64]bool)
+	changeFeed.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-control.Exit:
+				return
+			case <-ticker.C:
+				exportChangeFeed(db)
+			}
+		}
+	}()
+	return nil
+}
+
+// noteChangeFeedNotification marks the project for export, if the notification is one the change feed exports
+func noteChangeFeedNotification(projectID int64, resource string) {
+	if resource != "File" {
+		return
+	}
+	changeFeed.mutex.Lock()
+	defer changeFeed.mutex.Unlock()
+
+	if changeFeed.projects != nil {
+		changeFeed.projects[projectID] = true
+	}
+}
+
+// exportChangeFeed exports the notifications of each project marked since the last export. Projects whose
+// notifications could not be delivered are marked again, to be retried.
+func exportChangeFeed(db dbfs.DBFS) {
+	changeFeed.mutex.Lock()
+	projects := changeFeed.projects
+	if projects != nil {
+		changeFeed.projects = make(map[int64]bool)
+	}
+	changeFeed.mutex.Unlock()
+
+	for projectID := range projects {
+		if err := exportProjectChanges(projectID, db); err != nil {
+			utils.LogError("Failed to export project's notifications to the change feed", err, utils.LogFields{
+				"ProjectID": projectID,
+			})
+			changeFeed.mutex.Lock()
+			changeFeed.projects[projectID] = true
+			changeFeed.mutex.Unlock()
+		}
+	}
+}
+
+// exportProjectChanges posts the project's File notifications since its cursor, then advances the cursor
+func exportProjectChanges(projectID int64, db dbfs.DBFS) error {
+	cursor, err := db.MySQLChangeFeedCursorGet(projectID)
+	if err != nil {
+		return err
+	}
+
+	batch := changeFeedBatch{ProjectID: projectID, Notifications: []json.RawMessage{}}
+	latest := cursor
+	notifications, err := db.CBGetNotificationsSince(projectID, cursor)
+	if err == dbfs.ErrVersionOutOfDate {
+		if latest, err = db.CBGetNotificationSequence(projectID); err != nil {
+			return err
+		}
+		utils.LogError("Change feed missed notifications that are no longer stored", dbfs.ErrVersionOutOfDate,
+			utils.LogFields{
+				"ProjectID": projectID,
+				"From":      cursor,
+				"To":        latest,
+			})
+		batch.MissedFrom, batch.MissedTo = cursor, latest
+	} else if err != nil {
+		return err
+	}
+
+	for _, notification := range notifications {
+		var header struct {
+			Resource string
+			Sequence int64
+		}
+		if err := json.Unmarshal(notification, &header); err != nil {
+			return err
+		}
+		latest = header.Sequence
+		if header.Resource == "File" {
+			batch.Notifications = append(batch.Notifications, notification)
+		}
+	}
+	if latest == cursor {
+		return nil
+	}
+
+	if len(batch.Notifications) > 0 || batch.MissedTo != 0 {
+		if err := postChangeFeedBatch(batch); err != nil {
+			return err
+		}
+	}
+
+	// If another server moved the cursor first, it has posted the notifications too
+	_, err = db.MySQLChangeFeedCursorAdvance(projectID, cursor, latest)
+	return err
+}
+
+// postChangeFeedBatch posts the batch to every webhook, retrying failed posts
+func postChangeFeedBatch(batch changeFeedBatch) error {
+	changeFeed.mutex.Lock()
+	cfg, client := changeFeed.cfg, changeFeed.client
+	changeFeed.mutex.Unlock()
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	for _, webhook := range cfg.Webhooks {
+		for attempt := 0; ; attempt++ {
+			err = postChangeFeedWebhook(client, webhook, body, cfg.Secret)
+			if err == nil {
+				break
+			}
+			if attempt == changeFeedRetries {
+				return err
+			}
+			utils.LogWarn("Failed to post to change feed webhook; retrying", utils.LogFields{
+				"Webhook": webhook,
+				"Attempt": attempt + 1,
+				"error":   err.Error(),
+			})
+			time.Sleep(time.Duration(attempt+1) * changeFeedRetryDelay)
+		}
+	}
+	return nil
+}
+
+func postChangeFeedWebhook(client *http.Client, webhook string, body []byte, secret string) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(changeFeedSignatureHeader, changeFeedSignature(body, secret))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Change feed webhook %s responded with %s", webhook, res.Status)
+	}
+	return nil
+}
+
+// changeFeedSignature returns the signature of the body, for the X-CodeCollaborate-Signature header
+func changeFeedSignature(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,95 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeFeed(t *testing.T) {
+	defer func(delay time.Duration) {
+		changeFeedRetryDelay = delay
+	}(changeFeedRetryDelay)
+	changeFeedRetryDelay = time.Millisecond
+
+	var mutex sync.Mutex
+	var batches []changeFeedBatch
+	failing := false
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, changeFeedSignature(body, "secret"), r.Header.Get(changeFeedSignatureHeader))
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch changeFeedBatch
+		require.NoError(t, json.Unmarshal(body, &batch))
+		batches = append(batches, batch)
+	}))
+	defer webhook.Close()
+
+	db := dbfs.NewDBMock()
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	defer func() {
+		changeFeed.mutex.Lock()
+		changeFeed.projects = nil
+		changeFeed.mutex.Unlock()
+	}()
+	require.NoError(t, EnableChangeFeed(config.ChangeFeedCfg{
+		Webhooks: []string{webhook.URL},
+		Secret:   "secret",
+		Interval: "1h",
+	}, db, control))
+
+	dh := DataHandler{MessageChan: make(chan rabbitmq.AMQPMessage, 8), Db: db}
+	notify := func(resource, method string) {
+		not := messages.Notification{Resource: resource, Method: method, ResourceID: 1}.Wrap()
+		require.NoError(t, projectNotificationClosure(1, 1, not).call(dh))
+	}
+
+	notify("File", "Change")
+	notify("Project", "Rename")
+	exportChangeFeed(db)
+	require.Len(t, batches, 1)
+	assert.EqualValues(t, 1, batches[0].ProjectID)
+	require.Len(t, batches[0].Notifications, 1, "only File notifications should be exported")
+	var not messages.Notification
+	require.NoError(t, json.Unmarshal(batches[0].Notifications[0], &not))
+	assert.Equal(t, "File.Change", not.Resource+"."+not.Method)
+	assert.EqualValues(t, 1, not.Sequence)
+	assert.EqualValues(t, 2, db.ChangeFeedCursors[1], "the cursor should be moved past every exported notification")
+
+	exportChangeFeed(db)
+	assert.Len(t, batches, 1, "nothing should be exported for projects without new File notifications")
+
+	mutex.Lock()
+	failing = true
+	mutex.Unlock()
+	notify("File", "Delete")
+	exportChangeFeed(db)
+	assert.Len(t, batches, 1)
+	assert.EqualValues(t, 2, db.ChangeFeedCursors[1], "the cursor should not move until the notifications are delivered")
+
+	mutex.Lock()
+	failing = false
+	mutex.Unlock()
+	exportChangeFeed(db)
+	require.Len(t, batches, 2, "undelivered notifications should be retried")
+	require.Len(t, batches[1].Notifications, 1)
+	assert.EqualValues(t, 3, db.ChangeFeedCursors[1])
+}
@@ -0,0 +1,76 @@
+package datahandling
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Clients are identified by their IP address for network access control, login throttling, logs and the audit log.
+ * Behind a reverse proxy, every request comes from the proxy, so requests from the configured TrustedProxies are
+ * instead attributed to the address the proxy reports in X-Forwarded-For. The header is read from the right, since
+ * each proxy appends the address it received the request from; the first address that isn't itself a trusted proxy is
+ * the client, and anything to the left of it may have been forged by the client. Addresses reported in a PROXY
+ * protocol header are already the request's RemoteAddr; see the handlers module.
+ */
+
+// networkPolicy returns the config's network policy, or nil if it is invalid. A nil config is the process's.
+func networkPolicy(cfg *config.Config) *config.NetworkPolicy {
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
+	policy, err := cfg.ServerConfig.NetworkPolicy()
+	if err != nil {
+		utils.LogError("Invalid network policy", err, nil)
+		return nil
+	}
+	return policy
+}
+
+// remoteHost returns the address the request's connection came from, without its port
+func remoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// ClientAddr returns the IP address of the client that sent the request to the server with the config, nil for the
+// process's, without its port
+func ClientAddr(cfg *config.Config, request *http.Request) string {
+	addr := remoteHost(request)
+	policy := networkPolicy(cfg)
+	if policy == nil || !policy.TrustsProxy(net.ParseIP(addr)) {
+		return addr
+	}
+
+	forwarded := strings.Split(strings.Join(request.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// Whatever is left of a malformed entry can't be trusted either
+			break
+		}
+		addr = ip.String()
+		if !policy.TrustsProxy(ip) {
+			break
+		}
+	}
+	return addr
+}
+
+// ClientAllowed returns whether the client that sent the request may connect, under the config's AllowedNetworks and
+// DeniedNetworks. Clients without an IP address are only allowed if AllowedNetworks is unset, and every client is
+// refused if the networks are invalid.
+func ClientAllowed(cfg *config.Config, request *http.Request) bool {
+	policy := networkPolicy(cfg)
+	if policy == nil {
+		return false
+	}
+	return policy.Allows(net.ParseIP(ClientAddr(cfg, request)))
+}
@@ -0,0 +1,59 @@
+package datahandling
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAddr(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.ServerCfg) {
+		*serverCfg = cfg
+	}(*serverCfg)
+	serverCfg.TrustedProxies = []string{"10.0.0.0/8"}
+
+	request := httptest.NewRequest("GET", "/ws/", nil)
+	request.RemoteAddr = "203.0.113.9:4242"
+	request.Header.Set("X-Forwarded-For", "192.0.2.7")
+	assert.Equal(t, "203.0.113.9", ClientAddr(config.GetConfig(), request), "untrusted peers' headers should be ignored")
+
+	// Addresses left of the first untrusted one may be forged
+	request.RemoteAddr = "10.0.0.2:4242"
+	request.Header.Set("X-Forwarded-For", "198.51.100.1, 192.0.2.7")
+	request.Header.Add("X-Forwarded-For", "10.0.0.3")
+	assert.Equal(t, "192.0.2.7", ClientAddr(config.GetConfig(), request))
+
+	request.Header.Set("X-Forwarded-For", "not an address, 10.0.0.3")
+	assert.Equal(t, "10.0.0.3", ClientAddr(config.GetConfig(), request))
+
+	request.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.2", ClientAddr(config.GetConfig(), request))
+}
+
+func TestClientAllowed(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.ServerCfg) {
+		*serverCfg = cfg
+	}(*serverCfg)
+
+	request := httptest.NewRequest("GET", "/ws/", nil)
+	request.RemoteAddr = "10.0.0.2:4242"
+	request.Header.Set("X-Forwarded-For", "192.0.2.7")
+	assert.True(t, ClientAllowed(config.GetConfig(), request))
+
+	serverCfg.AllowedNetworks = []string{"192.0.2.0/24"}
+	assert.False(t, ClientAllowed(config.GetConfig(), request))
+	serverCfg.TrustedProxies = []string{"10.0.0.2"}
+	assert.True(t, ClientAllowed(config.GetConfig(), request), "the forwarded client's address should be checked")
+
+	serverCfg.DeniedNetworks = []string{"192.0.2.7"}
+	assert.False(t, ClientAllowed(config.GetConfig(), request))
+
+	serverCfg.DeniedNetworks = []string{"bogus"}
+	assert.False(t, ClientAllowed(config.GetConfig(), request), "invalid networks should refuse everyone")
+}
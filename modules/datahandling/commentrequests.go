@@ -0,0 +1,387 @@
+package datahandling
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Project members may discuss ranges of a file's text in comment threads. A thread starts with a comment anchored to a
+ * range of the file at a version, as offsets into its text as stored, in characters; replies join the thread, and have
+ * no anchor of their own. As the file changes, anchors are carried forward through the patches kept since their
+ * version, when the file's comments are listed and before its patches are scrunched. Anchors whose patches are no
+ * longer kept are marked Outdated, and left at the version they were in.
+ *
+ * Anyone who can view the project may comment; threads may be resolved, or reopened, by their author and anyone who
+ * can edit the project's files. Each new comment, and each resolved or reopened thread, is sent to the project as a
+ * Comment notification.
+ */
+
+var errInvalidCommentRange = errors.New("Comments must be anchored to a range within the file's text")
+
+var commentRequestsSetup = false
+
+// initCommentRequests populates the requestMap from requestmap.go with the appropriate constructors for the comment methods
+func initCommentRequests() {
+	if commentRequestsSetup {
+		return
+	}
+
+	authenticatedRequestMap["Comment.Create"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(commentCreateRequest), req)
+	}
+
+	authenticatedRequestMap["Comment.Reply"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(commentReplyRequest), req)
+	}
+
+	authenticatedRequestMap["Comment.Resolve"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(commentResolveRequest), req)
+	}
+
+	authenticatedRequestMap["Comment.List"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(commentListRequest), req)
+	}
+
+	commentRequestsSetup = true
+}
+
+// Comment.Create
+type commentCreateRequest struct {
+	FileID  int64  `validate:"required"`
+	Version int64  `validate:"required"` // The version of the file Start and End are offsets into
+	Start   int    `validate:"min=0"`
+	End     int    `validate:"min=0"` // Exclusive
+	Body    string `validate:"required,max=10000"`
+	abstractRequest
+}
+
+func (c *commentCreateRequest) setAbstractRequest(req *abstractRequest) {
+	c.abstractRequest = *req
+}
+
+func (c commentCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(c.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(c.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  c.Resource,
+			"Method":    c.Method,
+			"SenderID":  c.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, c.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, c.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	rawFile, changes, err := db.PullFile(fileMeta)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	version, err := db.CBGetFileVersion(c.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, c.Tag)}}, err
+	}
+
+	text, err := textAtVersion(*rawFile, patches, version, c.Version)
+	if err == errBaseVersionUnavailable {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusVersionOutOfDate, c.Tag)}}, nil
+	} else if err == errVersionRange {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, c.Tag)}}, errInvalidCommentRange
+	} else if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, c.Tag)}}, err
+	}
+	if c.Start > c.End || c.End > utf8.RuneCountInString(text) {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, c.Tag)}}, errInvalidCommentRange
+	}
+
+	comment := dbfs.CommentMeta{
+		FileID:  c.FileID,
+		Author:  c.SenderID,
+		Body:    c.Body,
+		Version: c.Version,
+		Start:   c.Start,
+		End:     c.End,
+	}
+	// Comments on earlier versions are stored at the current one, so they aren't outdated by the next scrunch
+	transformAnchor(&comment, patches, version)
+
+	comment.CommentID, err = db.MySQLCommentCreate(comment)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	comment, err = db.MySQLCommentGet(comment.CommentID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	return commentClosures(c.abstractRequest, fileMeta.ProjectID, comment), nil
+}
+
+// Comment.Reply
+type commentReplyRequest struct {
+	CommentID int64  `validate:"required"` // Any comment in the thread
+	Body      string `validate:"required,max=10000"`
+	abstractRequest
+}
+
+func (c *commentReplyRequest) setAbstractRequest(req *abstractRequest) {
+	c.abstractRequest = *req
+}
+
+func (c commentReplyRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	replyTo, fileMeta, err := commentFile(c.CommentID, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(c.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  c.Resource,
+			"Method":    c.Method,
+			"SenderID":  c.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, c.Tag)}}, nil
+	}
+
+	commentID, err := db.MySQLCommentCreate(dbfs.CommentMeta{
+		ThreadID: replyTo.ThreadID,
+		FileID:   replyTo.FileID,
+		Author:   c.SenderID,
+		Body:     c.Body,
+	})
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	comment, err := db.MySQLCommentGet(commentID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	return commentClosures(c.abstractRequest, fileMeta.ProjectID, comment), nil
+}
+
+// Comment.Resolve
+type commentResolveRequest struct {
+	CommentID int64 `validate:"required"` // Any comment in the thread
+	Reopen    bool  // Reopens the thread instead
+	abstractRequest
+}
+
+func (c *commentResolveRequest) setAbstractRequest(req *abstractRequest) {
+	c.abstractRequest = *req
+}
+
+func (c commentResolveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	comment, fileMeta, err := commentFile(c.CommentID, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	thread := comment
+	if comment.ThreadID != comment.CommentID {
+		if thread, err = db.MySQLCommentGet(comment.ThreadID); err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+		}
+	}
+
+	// The thread's author may resolve it as long as they can still see it
+	capability := config.CapabilityEditFiles
+	if thread.Author == c.SenderID {
+		capability = config.CapabilityViewProject
+	}
+	hasPermission, err := authorizeProject(c.abstractRequest, fileMeta.ProjectID, capability, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  c.Resource,
+			"Method":    c.Method,
+			"SenderID":  c.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, c.Tag)}}, nil
+	}
+
+	thread.ResolvedBy = c.SenderID
+	if c.Reopen {
+		thread.ResolvedBy = ""
+	}
+	err = db.MySQLCommentSetResolved(thread.CommentID, thread.ResolvedBy)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	return commentClosures(c.abstractRequest, fileMeta.ProjectID, thread), nil
+}
+
+// Comment.List
+type commentListRequest struct {
+	FileID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (c *commentListRequest) setAbstractRequest(req *abstractRequest) {
+	c.abstractRequest = *req
+}
+
+func (c commentListRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(c.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(c.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  c.Resource,
+			"Method":    c.Method,
+			"SenderID":  c.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, c.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, c.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	comments, err := db.MySQLFileGetComments(c.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	err = reanchorComments(fileMeta, comments, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	reactions, err := db.MySQLFileGetCommentReactions(c.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    c.Tag,
+		Data: struct {
+			Comments  []dbfs.CommentMeta
+			Reactions []dbfs.CommentReactionMeta // See reactions.go
+		}{
+			Comments:  comments,
+			Reactions: reactions,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// commentFile returns the comment, and the file it is on
+func commentFile(commentID int64, db dbfs.DBFS) (dbfs.CommentMeta, dbfs.FileMeta, error) {
+	comment, err := db.MySQLCommentGet(commentID)
+	if err != nil {
+		return dbfs.CommentMeta{}, dbfs.FileMeta{}, err
+	}
+	fileMeta, err := db.MySQLFileGetInfo(comment.FileID)
+	if err != nil {
+		return dbfs.CommentMeta{}, dbfs.FileMeta{}, err
+	}
+	return comment, fileMeta, nil
+}
+
+// commentClosures returns the response to a request that created or resolved the comment, and its notification
+func commentClosures(req abstractRequest, projectID int64, comment dbfs.CommentMeta) []dhClosure {
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    req.Tag,
+		Data: struct {
+			Comment dbfs.CommentMeta
+		}{
+			Comment: comment,
+		},
+	}.Wrap()
+	not := messages.Notification{
+		Resource:   req.Resource,
+		Method:     req.Method,
+		ResourceID: comment.CommentID,
+		Data:       comment,
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(projectID, comment.FileID, not)}
+}
+
+// transformAnchor carries the anchor of the thread's first comment forward to the given version through the file's
+// patches, marking it outdated if the patches from its version are no longer kept. Returns whether it was changed.
+func transformAnchor(comment *dbfs.CommentMeta, patches []*patching.Patch, version int64) bool {
+	if comment.ThreadID != comment.CommentID || comment.Outdated || comment.Version >= version {
+		return false
+	}
+	if len(patches) == 0 || comment.Version < patches[0].BaseVersion {
+		comment.Outdated = true
+		return true
+	}
+
+	var since []*patching.Patch
+	for _, patch := range patches {
+		if patch.BaseVersion >= comment.Version {
+			since = append(since, patch)
+		}
+	}
+	comment.Start, comment.End = patching.TransformRange(comment.Start, comment.End, since)
+	comment.Version = version
+	return true
+}
+
+// reanchorComments carries the anchors of the given comments on the file forward to its current version, and stores
+// those that changed
+func reanchorComments(fileMeta dbfs.FileMeta, comments []dbfs.CommentMeta, db dbfs.DBFS) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	changes, _, version, _, err := db.PullChanges(fileMeta)
+	if err != nil {
+		return err
+	}
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		if !transformAnchor(&comments[i], patches, version) {
+			continue
+		}
+		if err := db.MySQLCommentSetAnchor(comments[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reanchorFileComments carries the anchors of the file's comments forward before its patches are scrunched. Failures
+// are only logged, since the file must still be scrunched; the anchors are then marked outdated.
+func reanchorFileComments(fileMeta dbfs.FileMeta, db dbfs.DBFS) {
+	comments, err := db.MySQLFileGetComments(fileMeta.FileID)
+	if err == nil {
+		err = reanchorComments(fileMeta, comments, db)
+	}
+	if err != nil {
+		utils.LogError("Failed to re-anchor comments", err, utils.LogFields{
+			"FileID": fileMeta.FileID,
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// commentRequest sets the base fields of a Comment request, as sent by the given user
+func commentRequest(req request, method string, senderID string) request {
+	req.setAbstractRequest(&abstractRequest{
+		Resource:    "Comment",
+		Method:      method,
+		SenderID:    senderID,
+		SenderToken: "supersecure",
+	})
+	return req
+}
+
+func responseComment(t *testing.T, res messages.Response) dbfs.CommentMeta {
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	return reflect.ValueOf(res.Data).FieldByName("Comment").Interface().(dbfs.CommentMeta)
+}
+
+func TestCommentRequests(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "reviewed")
+	fileID, _ := db.MySQLFileCreate("loganga", "reviewed.txt", ".", projectID)
+	db.MySQLProjectGrantPermission(projectID, "notloganga", config.ReadRole.Level, "loganga")
+
+	raw := []byte("one\ntwo\n")
+	db.File = &raw
+	db.FileVersion[fileID] = 6
+	db.FileChanges[fileID] = []string{"v3:\n0:+1:x:\n8", "v4:\n5:-3:two:\n9", "v5:\n5:+5:three:\n6"}
+
+	// Comments on earlier versions are carried forward to the current one
+	create := commentRequest(&commentCreateRequest{FileID: fileID, Version: 3, Start: 0, End: 3, Body: "Rename?"},
+		"Create", "loganga")
+	res, not := processForTest(t, create, db)
+	root := responseComment(t, res)
+	assert.Equal(t, root.CommentID, root.ThreadID)
+	assert.Equal(t, "loganga", root.Author)
+	assert.EqualValues(t, 6, root.Version)
+	assert.Equal(t, 1, root.Start)
+	assert.Equal(t, 4, root.End)
+	require.NotNil(t, not)
+	assert.Equal(t, "Comment", not.Resource)
+	assert.Equal(t, "Create", not.Method)
+	assert.Equal(t, root.CommentID, not.ResourceID)
+
+	// Replies join the thread of the comment they reply to
+	res, _ = processForTest(t, commentRequest(&commentReplyRequest{CommentID: root.CommentID, Body: "Sure"},
+		"Reply", "notloganga"), db)
+	reply := responseComment(t, res)
+	assert.Equal(t, root.CommentID, reply.ThreadID)
+	res, _ = processForTest(t, commentRequest(&commentReplyRequest{CommentID: reply.CommentID, Body: "Thanks"},
+		"Reply", "loganga"), db)
+	assert.Equal(t, root.CommentID, responseComment(t, res).ThreadID)
+
+	// Only the thread's author, and those who can edit files, may resolve it
+	res, _ = processForTest(t, commentRequest(&commentResolveRequest{CommentID: reply.CommentID}, "Resolve", "notloganga"), db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+	res, _ = processForTest(t, commentRequest(&commentResolveRequest{CommentID: reply.CommentID}, "Resolve", "loganga"), db)
+	assert.Equal(t, "loganga", responseComment(t, res).ResolvedBy)
+	assert.Equal(t, "loganga", db.Comments[root.CommentID].ResolvedBy)
+
+	// Listing carries anchors through the changes made since
+	db.FileVersion[fileID] = 7
+	db.FileChanges[fileID] = append(db.FileChanges[fileID], "v6:\n0:+2:ab:\n11")
+	list := commentRequest(&commentListRequest{FileID: fileID}, "List", "notloganga")
+	res, _ = processForTest(t, list, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	comments := reflect.ValueOf(res.Data).FieldByName("Comments").Interface().([]dbfs.CommentMeta)
+	require.Len(t, comments, 3)
+	assert.EqualValues(t, 7, comments[0].Version)
+	assert.Equal(t, 3, comments[0].Start)
+	assert.Equal(t, 6, comments[0].End)
+	assert.Equal(t, comments[0], db.Comments[root.CommentID], "re-anchored comments should be stored")
+	assert.Zero(t, comments[1].Version, "replies have no anchor")
+
+	// Anchors whose patches were scrunched are outdated
+	db.FileVersion[fileID] = 9
+	db.FileChanges[fileID] = nil
+	res, _ = processForTest(t, list, db)
+	comments = reflect.ValueOf(res.Data).FieldByName("Comments").Interface().([]dbfs.CommentMeta)
+	assert.True(t, comments[0].Outdated)
+	assert.EqualValues(t, 7, comments[0].Version)
+}
+
+func TestCommentCreateRequest_Invalid(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "reviewed")
+	fileID, _ := db.MySQLFileCreate("loganga", "reviewed.txt", ".", projectID)
+	raw := []byte("one\ntwo\n")
+	db.File = &raw
+	db.FileVersion[fileID] = 4
+	db.FileChanges[fileID] = []string{"v3:\n0:+1:x:\n8"}
+
+	closures, err := commentRequest(&commentCreateRequest{FileID: fileID, Version: 4, Start: 2, End: 10, Body: "?"},
+		"Create", "loganga").process(db)
+	assert.Equal(t, errInvalidCommentRange, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	res, _ := processForTest(t, commentRequest(&commentCreateRequest{FileID: fileID, Version: 2, End: 1, Body: "?"},
+		"Create", "loganga"), db)
+	assert.Equal(t, messages.StatusVersionOutOfDate, res.Status)
+	assert.Empty(t, db.Comments)
+}
@@ -0,0 +1,205 @@
+package datahandling
+
+import (
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Shared servers are protected from clients that open many connections, or flood one with requests, such as a buggy
+ * plugin opening a socket per file. A user's connections are counted once they make an authenticated request on them,
+ * since connections aren't tied to a user until then; once the user has MaxConnectionsPerUser, their requests on any
+ * other connection are refused, until one of the counted connections closes. Requests beyond
+ * MaxRequestsPerConnection in progress on one connection are refused as well. Refused requests are answered with
+ * StatusConcurrencyLimited, and logged, so that the offending clients can be found.
+ *
+ * Connections are counted by session ID, by the server they are on; requests that aren't made over a WebSocket
+ * connection, such as those of the REST API, are not limited.
+ */
+
+// connectionLimits tracks the connections of this server
+var connectionLimits = &connectionTracker{
+	connections: make(map[string]*connectionUsage),
+	users:       make(map[string]int),
+}
+
+// Reasons given in StatusConcurrencyLimited responses
+const (
+	reasonTooManyConnections = "Too many connections for this user"
+	reasonTooManyRequests    = "Too many requests in progress on this connection"
+)
+
+// concurrencyLimitedResponse is the Data of a StatusConcurrencyLimited response
+type concurrencyLimitedResponse struct {
+	Reason string
+	Limit  int // The number of connections or requests that was reached
+}
+
+func newConcurrencyLimitedResponse(tag int64, reason string, limit int) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusConcurrencyLimited,
+		Tag:    tag,
+		Data: concurrencyLimitedResponse{
+			Reason: reason,
+			Limit:  limit,
+		},
+	}.Wrap()
+}
+
+// connectionUsage is what a connection is counted for
+type connectionUsage struct {
+	inFlight int
+	users    map[string]bool // The users that have made authenticated requests on the connection
+}
+
+type connectionTracker struct {
+	connections map[string]*connectionUsage // By session ID
+	users       map[string]int              // The number of connections each user is counted for
+	mutex       sync.Mutex
+}
+
+func (tracker *connectionTracker) usage(sessionID string) *connectionUsage {
+	usage, ok := tracker.connections[sessionID]
+	if !ok {
+		usage = &connectionUsage{users: make(map[string]bool)}
+		tracker.connections[sessionID] = usage
+	}
+	return usage
+}
+
+// startRequest counts a request in progress on the connection, returning false if it already has maxRequests in
+// progress; 0 is no limit. Requests that are counted must be finished with finishRequest.
+func (tracker *connectionTracker) startRequest(sessionID string, maxRequests int) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	usage := tracker.usage(sessionID)
+	if maxRequests > 0 && usage.inFlight >= maxRequests {
+		return false
+	}
+	usage.inFlight++
+	return true
+}
+
+// finishRequest stops counting a request started with startRequest
+func (tracker *connectionTracker) finishRequest(sessionID string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if usage, ok := tracker.connections[sessionID]; ok {
+		usage.inFlight--
+	}
+}
+
+// addUser counts the connection towards the user's connections, returning false if they already have maxConnections
+// other connections; 0 is no limit
+func (tracker *connectionTracker) addUser(sessionID string, username string, maxConnections int) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	usage := tracker.usage(sessionID)
+	if usage.users[username] {
+		return true
+	}
+	if maxConnections > 0 && tracker.users[username] >= maxConnections {
+		return false
+	}
+	usage.users[username] = true
+	tracker.users[username]++
+	return true
+}
+
+// remove forgets the connection, once it has closed
+func (tracker *connectionTracker) remove(sessionID string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	usage, ok := tracker.connections[sessionID]
+	if !ok {
+		return
+	}
+	for username := range usage.users {
+		tracker.users[username]--
+		if tracker.users[username] <= 0 {
+			delete(tracker.users, username)
+		}
+	}
+	delete(tracker.connections, sessionID)
+}
+
+// startConcurrencyLimited counts the request against the connection's limits, returning the response to refuse it
+// with if it is over either of them. Requests that aren't refused must be finished with finishConcurrencyLimited.
+func (dh DataHandler) startConcurrencyLimited(req *abstractRequest) *messages.ServerMessageWrapper {
+	if dh.SessionID == "" {
+		return nil
+	}
+
+	maxRequests := dh.config().ServerConfig.MaxRequestsPerConnection
+	if !connectionLimits.startRequest(dh.SessionID, maxRequests) {
+		utils.LogWarn("Refused request over the connection's concurrency limit", utils.LogFields{
+			"SenderID":   req.SenderID,
+			"RemoteAddr": dh.RemoteAddr,
+			"Resource":   req.Resource,
+			"Method":     req.Method,
+			"Limit":      maxRequests,
+		})
+		return newConcurrencyLimitedResponse(req.Tag, reasonTooManyRequests, maxRequests)
+	}
+	return nil
+}
+
+// finishConcurrencyLimited stops counting a request that startConcurrencyLimited didn't refuse
+func (dh DataHandler) finishConcurrencyLimited() {
+	if dh.SessionID != "" {
+		connectionLimits.finishRequest(dh.SessionID)
+	}
+}
+
+// checkConnectionLimit counts the connection towards the connections of the sender of an authenticated request,
+// returning the response to refuse the request with if they already have too many
+func (dh DataHandler) checkConnectionLimit(req *abstractRequest) *messages.ServerMessageWrapper {
+	if dh.SessionID == "" || req.SenderID == "" {
+		return nil
+	}
+
+	maxConnections := dh.config().ServerConfig.MaxConnectionsPerUser
+	if !connectionLimits.addUser(dh.SessionID, req.SenderID, maxConnections) {
+		utils.LogWarn("Refused request from a user over their connection limit", utils.LogFields{
+			"SenderID":   req.SenderID,
+			"RemoteAddr": dh.RemoteAddr,
+			"Resource":   req.Resource,
+			"Method":     req.Method,
+			"Limit":      maxConnections,
+		})
+		return newConcurrencyLimitedResponse(req.Tag, reasonTooManyConnections, maxConnections)
+	}
+	return nil
+}
+
+// limitConnections refuses authenticated requests from users over their connection limit, and records the activity
+// of the sessions they are made in
+func limitConnections(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		// Users' connections are only counted once they are known to be theirs
+		if call.authenticated {
+			limited := dh.checkConnectionLimit(call.req)
+			dh.recordSessionActivity(call.req, db)
+			if limited != nil {
+				return []dhClosure{toSenderClosure{msg: limited}}, nil
+			}
+		}
+		return next(dh, call, db)
+	}
+}
+
+// Close forgets the connection's concurrency limits and its session, once it has closed and its requests have
+// completed
+func (dh DataHandler) Close() {
+	if dh.SessionID != "" {
+		connectionLimits.remove(dh.SessionID)
+		dh.endSession()
+	}
+}
@@ -0,0 +1,90 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(maxConnections, maxRequests int) {
+		serverCfg.MaxConnectionsPerUser = maxConnections
+		serverCfg.MaxRequestsPerConnection = maxRequests
+	}(serverCfg.MaxConnectionsPerUser, serverCfg.MaxRequestsPerConnection)
+	serverCfg.MaxConnectionsPerUser = 1
+	serverCfg.MaxRequestsPerConnection = 1
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+
+	lookup := func(dh DataHandler, senderID string) messages.Response {
+		messageChan := make(chan rabbitmq.AMQPMessage, 8)
+		dh.MessageChan = messageChan
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		dh.Handle(0, []byte(fmt.Sprintf(
+			`{"Tag": 1, "Resource": "User", "Method": "Lookup", "SenderID": %q, "SenderToken": %q, "Data": {"Usernames": []}}`,
+			senderID, testToken(t, senderID))), wg)
+		require.Len(t, messageChan, 1)
+		var res struct {
+			ServerMessage struct {
+				Status int
+				Data   concurrencyLimitedResponse
+			}
+		}
+		require.NoError(t, json.Unmarshal((<-messageChan).Message, &res))
+		return messages.Response{Status: res.ServerMessage.Status, Data: res.ServerMessage.Data}
+	}
+
+	first := DataHandler{SessionID: "first", Db: db}
+	second := DataHandler{SessionID: "second", Db: db}
+	defer first.Close()
+	defer second.Close()
+
+	assert.Equal(t, messages.StatusSuccess, lookup(first, "loganga").Status)
+	assert.Equal(t, messages.StatusSuccess, lookup(first, "loganga").Status)
+	res := lookup(second, "loganga")
+	assert.Equal(t, messages.StatusConcurrencyLimited, res.Status)
+	assert.Equal(t, concurrencyLimitedResponse{Reason: reasonTooManyConnections, Limit: 1}, res.Data)
+	assert.Equal(t, messages.StatusSuccess, lookup(second, "notloganga").Status, "other users shouldn't be limited")
+
+	// Closing a connection frees its place
+	first.Close()
+	assert.Equal(t, messages.StatusSuccess, lookup(second, "loganga").Status)
+
+	// Connections with as many requests in progress as they may have are refused more
+	require.True(t, connectionLimits.startRequest(second.SessionID, 1))
+	res = lookup(second, "loganga")
+	assert.Equal(t, messages.StatusConcurrencyLimited, res.Status)
+	assert.Equal(t, concurrencyLimitedResponse{Reason: reasonTooManyRequests, Limit: 1}, res.Data)
+	connectionLimits.finishRequest(second.SessionID)
+
+	// Requests that aren't made over a connection aren't counted
+	assert.Equal(t, messages.StatusSuccess, lookup(DataHandler{Db: db}, "loganga").Status)
+}
+
+func TestConnectionTracker_Requests(t *testing.T) {
+	tracker := &connectionTracker{connections: make(map[string]*connectionUsage), users: make(map[string]int)}
+	assert.True(t, tracker.startRequest("session", 2))
+	assert.True(t, tracker.startRequest("session", 2))
+	assert.False(t, tracker.startRequest("session", 2))
+	assert.True(t, tracker.startRequest("other", 2))
+	tracker.finishRequest("session")
+	assert.True(t, tracker.startRequest("session", 2))
+	assert.True(t, tracker.startRequest("session", 0), "0 should be no limit")
+
+	tracker.remove("session")
+	tracker.remove("other")
+	assert.Empty(t, tracker.connections)
+}
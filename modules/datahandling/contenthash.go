@@ -0,0 +1,69 @@
+package datahandling
+
+import (
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Each file has the SHA-256 of its text at some version recorded alongside it, so that clients can tell whether their
+ * cached copy is current without pulling the file. The hash is recorded when the file is scrunched, of the scrunched
+ * text, and when it is pulled, of its text once the stored patches are applied; recording a hash never replaces that
+ * of a later version. File.Pull returns the hash of the text it sends, and Project.GetFiles the hash of each file
+ * whose recorded hash is of its current version, leaving it empty otherwise. Hashes are of the text as stored, before
+ * any conversion to the client's line endings.
+ */
+
+// contentHash returns the hex-encoded SHA-256 of the text, as recorded for files and sent in sync manifests
+func contentHash(text string) string {
+	return dbfs.ContentHash([]byte(text))
+}
+
+// pulledContentHash returns the hash of the file's text once the changes pulled are applied to its contents, recording
+// it if the recorded hash is of an earlier version
+func pulledContentHash(file dbfs.FileMeta, raw []byte, changes []string, db dbfs.DBFS) (dbfs.ContentHashMeta, error) {
+	recorded, err := db.MySQLFileGetContentHash(file.FileID)
+	if err != nil {
+		return dbfs.ContentHashMeta{}, err
+	}
+
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return dbfs.ContentHashMeta{}, err
+	}
+	version, err := pulledVersion(file, patches, db)
+	if err != nil {
+		return dbfs.ContentHashMeta{}, err
+	}
+	if recorded.Version == version {
+		return recorded, nil
+	}
+
+	text, err := patching.PatchText(string(raw), patches)
+	if err != nil {
+		return dbfs.ContentHashMeta{}, err
+	}
+	hash := dbfs.ContentHashMeta{Version: version, Hash: contentHash(text)}
+	recordContentHash(file.FileID, hash, db)
+	return hash, nil
+}
+
+// pulledVersion returns the version the file is at once the patches pulled are applied to its contents
+func pulledVersion(file dbfs.FileMeta, patches []*patching.Patch, db dbfs.DBFS) (int64, error) {
+	if len(patches) > 0 {
+		return patches[len(patches)-1].BaseVersion + 1, nil
+	}
+	return db.CBGetFileVersion(file.FileID)
+}
+
+// recordContentHash records the hash of the file's text. Failures are only logged, since the hash is still correct, and
+// is computed again on the next pull.
+func recordContentHash(fileID int64, hash dbfs.ContentHashMeta, db dbfs.DBFS) {
+	if err := db.MySQLFileSetContentHash(fileID, hash); err != nil {
+		utils.LogError("Failed to record content hash", err, utils.LogFields{
+			"FileID":  fileID,
+			"Version": hash.Version,
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package datahandling
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHash_PullAndGetFiles(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hashed")
+	fileID, _ := db.MySQLFileCreate("loganga", "hashed.txt", ".", projectID)
+
+	raw := []byte("one\ntwo\n")
+	db.File = &raw
+	db.FileVersion[fileID] = 5
+	db.FileChanges[fileID] = []string{"v3:\n0:+1:x:\n8", "v4:\n5:-3:two:\n9"}
+
+	getFiles := func() fileLookupResult {
+		req := projectGetFilesRequest{ProjectID: projectID}
+		setBaseFields(&req)
+		req.Resource = "Project"
+		req.Method = "GetFiles"
+		res, _ := processForTest(t, &req, db)
+		require.Equal(t, messages.StatusSuccess, res.Status)
+		files := reflect.ValueOf(res.Data).FieldByName("Files").Interface().([]fileLookupResult)
+		require.Len(t, files, 1)
+		return files[0]
+	}
+	assert.Empty(t, getFiles().ContentHash, "files that haven't been hashed should have no hash")
+
+	pull := filePullRequest{FileID: fileID}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	res, _ := processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := reflect.ValueOf(res.Data)
+	assert.EqualValues(t, 5, data.FieldByName("Version").Int())
+	assert.Equal(t, contentHash("xone\n\n"), data.FieldByName("ContentHash").String())
+	assert.Equal(t, dbfs.ContentHashMeta{Version: 5, Hash: contentHash("xone\n\n")}, db.FileHashes[fileID])
+
+	file := getFiles()
+	assert.EqualValues(t, 5, file.Version)
+	assert.Equal(t, contentHash("xone\n\n"), file.ContentHash)
+
+	// Hashes of earlier versions aren't returned as the current file's
+	db.FileVersion[fileID] = 6
+	db.FileChanges[fileID] = append(db.FileChanges[fileID], "v5:\n5:+5:three:\n6")
+	assert.Empty(t, getFiles().ContentHash)
+
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, contentHash("xone\nthree\n"), reflect.ValueOf(res.Data).FieldByName("ContentHash").String())
+	assert.Equal(t, contentHash("xone\nthree\n"), getFiles().ContentHash)
+
+	// Recorded hashes are reused
+	db.FunctionCallCount = 0
+	processForTest(t, &pull, db)
+	callsWithHash := db.FunctionCallCount
+	db.FileHashes[fileID] = dbfs.ContentHashMeta{}
+	db.FunctionCallCount = 0
+	processForTest(t, &pull, db)
+	assert.Equal(t, callsWithHash+1, db.FunctionCallCount, "the hash should only be recorded when it is missing")
+}
+
+func TestContentHash_Scrunch(t *testing.T) {
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hashed")
+	fileID, _ := db.MySQLFileCreate("loganga", "hashed.txt", ".", projectID)
+	meta, _ := db.MySQLFileGetInfo(fileID)
+
+	raw := []byte{}
+	db.File = &raw
+	for i := 0; i <= dbfs.MaxBufferLength(); i++ {
+		db.FileChanges[fileID] = append(db.FileChanges[fileID], fmt.Sprintf("v%d:\n%d:+1:x:\n%d", i+1, i, i))
+	}
+	db.FileVersion[fileID] = int64(dbfs.MaxBufferLength() + 2)
+	require.NoError(t, db.ScrunchFile(meta))
+
+	scrunched := dbfs.MaxBufferLength() + 1 - dbfs.MinBufferLength()
+	assert.Equal(t, dbfs.ContentHashMeta{
+		Version: int64(scrunched + 1),
+		Hash:    contentHash(strings.Repeat("x", scrunched)),
+	}, db.FileHashes[fileID])
+}
+
+func TestContentHash_Sync(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "synced")
+	fileID, _ := db.MySQLFileCreate("loganga", "hashed.txt", ".", projectID)
+	db.FileVersion[fileID] = 3
+	db.FileHashes[fileID] = dbfs.ContentHashMeta{Version: 3, Hash: contentHash("current")}
+
+	// Copies matching the recorded hash are up to date without the file being read
+	db.FailCall("PullFile", 1, dbfs.ErrCouchbaseUnavailable)
+	chunks := runSync(t, db, projectID, []syncManifestEntry{{Path: "hashed.txt", Version: 3, Hash: contentHash("current")}})
+	require.Len(t, chunks, 1)
+	assert.Empty(t, chunks[0].Entries)
+	assert.Empty(t, chunks[0].Failed)
+}
@@ -0,0 +1,140 @@
+package datahandling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/mail"
+	"github.com/CodeCollaborate/Server/modules/scanning"
+	"github.com/CodeCollaborate/Server/modules/search"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Malware scanning of file contents, with the scanner from the scanning module. New files are scanned before they are
+ * created, and existing files once their changes are scrunched into them. Flagged contents are moved to the quarantine
+ * directory for review, and the project's owners are emailed.
+ */
+
+// scanContent returns the verdict of the scanner of the server with the config on the content; if scanning is disabled,
+// all contents are clean
+func scanContent(cfg *config.Config, content []byte) (scanning.Result, error) {
+	scanner := scanning.ScannerFor(cfg)
+	if scanner == nil {
+		return scanning.Result{}, nil
+	}
+	return scanner.Scan(content)
+}
+
+// scanScrunchedFile scans the file's contents after it has been scrunched, quarantining it if flagged. Flagged files
+// are removed from the project. Returns true if the file is still in the project, and its contents were scanned.
+func scanScrunchedFile(cfg *config.Config, meta dbfs.FileMeta, requester string, db dbfs.DBFS) bool {
+	if scanning.ScannerFor(cfg) == nil {
+		return true
+	}
+
+	rawFile, _, err := db.PullFile(meta)
+	if err != nil {
+		utils.LogError("Failed to read scrunched file for scanning", err, utils.LogFields{
+			"FileID": meta.FileID,
+		})
+		return false
+	}
+	result, err := scanContent(cfg, *rawFile)
+	if err != nil {
+		utils.LogError("Failed to scan scrunched file", err, utils.LogFields{
+			"FileID": meta.FileID,
+		})
+		return false
+	}
+	if !result.Infected {
+		return true
+	}
+
+	quarantineFile(cfg, meta.ProjectID, path.Join(meta.RelativePath, meta.Filename), *rawFile, result, requester, db)
+
+	// Collaborators find the file gone when they next pull the project
+	err = db.MySQLFileDelete(meta.FileID)
+	if err == nil {
+		err = db.FileDelete(meta.RelativePath, meta.Filename, meta.ProjectID)
+	}
+	if err == nil {
+		err = db.CBDeleteFile(meta.FileID)
+	}
+	utils.LogError("Failed to remove quarantined file from project", err, utils.LogFields{
+		"FileID": meta.FileID,
+	})
+	err = search.Unindex(cfg, meta.FileID)
+	utils.LogError("Search: failed to remove file from index", err, utils.LogFields{
+		"FileID": meta.FileID,
+	})
+	return false
+}
+
+// quarantineFile keeps the flagged contents for review, and emails the project's owners. requester is a user with
+// access to the project, such as the one whose request led to the scan.
+func quarantineFile(cfg *config.Config, projectID int64, filePath string, content []byte, result scanning.Result, requester string, db dbfs.DBFS) {
+	quarantinePath, err := writeQuarantine(cfg, projectID, filePath, content)
+	utils.LogError("Failed to write quarantined file", err, utils.LogFields{
+		"ProjectID": projectID,
+		"Path":      filePath,
+	})
+	utils.LogWarn("Quarantined file flagged by malware scanner", utils.LogFields{
+		"ProjectID":      projectID,
+		"Path":           filePath,
+		"Signature":      result.Signature,
+		"Requester":      requester,
+		"QuarantinePath": quarantinePath,
+	})
+
+	projectName, permissions, err := db.MySQLProjectLookup(projectID, requester)
+	if err != nil {
+		utils.LogError("Failed to look up project owners", err, utils.LogFields{
+			"ProjectID": projectID,
+		})
+		return
+	}
+	for username, permission := range permissions {
+		if permission.PermissionLevel < config.OwnerRole.Level {
+			continue
+		}
+		owner, err := db.MySQLUserLookup(username)
+		if err != nil || owner.Email == "" {
+			continue
+		}
+		msg := mail.Message{
+			To:      owner.Email,
+			Subject: fmt.Sprintf("A file in %s was quarantined", projectName),
+			Body: fmt.Sprintf("Hi %s,\n\nThe file %s in your project %s was flagged by the malware scanner as %s, and "+
+				"has been quarantined. It was last changed by %s.\n\nContact your server administrator to review it.\n",
+				owner.FirstName, filePath, projectName, result.Signature, requester),
+		}
+		go func() {
+			err := mail.MailerFor(cfg).Send(msg)
+			utils.LogError("Failed to send email", err, utils.LogFields{
+				"To":      msg.To,
+				"Subject": msg.Subject,
+			})
+		}()
+	}
+}
+
+// writeQuarantine writes the contents to the config's quarantine directory, returning the path written to
+func writeQuarantine(cfg *config.Config, projectID int64, filePath string, content []byte) (string, error) {
+	dir := cfg.ServerConfig.QuarantineDir
+	if dir == "" {
+		dir = filepath.Join("data", "quarantine")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%d-%s", time.Now().UnixNano(), projectID, filepath.Base(filepath.FromSlash(filePath)))
+	quarantinePath := filepath.Join(dir, name)
+	return quarantinePath, ioutil.WriteFile(quarantinePath, content, 0600)
+}
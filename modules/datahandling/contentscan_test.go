@@ -0,0 +1,124 @@
+package datahandling
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/mail"
+	"github.com/CodeCollaborate/Server/modules/scanning"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testScanner flags contents containing "MALWARE"
+type testScanner struct{}
+
+func (testScanner) Scan(content []byte) (scanning.Result, error) {
+	if bytes.Contains(content, []byte("MALWARE")) {
+		return scanning.Result{Infected: true, Signature: "Test-Signature"}, nil
+	}
+	return scanning.Result{}, nil
+}
+
+type chanMailer chan mail.Message
+
+func (m chanMailer) Send(msg mail.Message) error {
+	m <- msg
+	return nil
+}
+
+func setupContentScan(t *testing.T) (string, chanMailer, func()) {
+	configSetup(t)
+	dir, err := ioutil.TempDir("", "quarantine")
+	require.NoError(t, err)
+	serverCfg := &config.GetConfig().ServerConfig
+	oldDir := serverCfg.QuarantineDir
+	serverCfg.QuarantineDir = dir
+
+	mailer := make(chanMailer, 4)
+	mail.SetMailer(mailer)
+	scanning.SetScanner(testScanner{})
+	return dir, mailer, func() {
+		scanning.SetScanner(nil)
+		mail.SetMailer(nil)
+		serverCfg.QuarantineDir = oldDir
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileCreateRequest_ContentScan(t *testing.T) {
+	dir, mailer, cleanup := setupContentScan(t)
+	defer cleanup()
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	req := *new(fileCreateRequest)
+	setBaseFields(&req)
+	req.Resource = "File"
+	req.Method = "Create"
+	req.Name = "payload.txt"
+	req.ProjectID = projectID
+	req.FileBytes = []byte("some MALWARE here")
+
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 1)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFileRejected, resp.Status)
+	assert.Equal(t, filePolicyViolation{Reason: contentFlagged, Size: 17, Signature: "Test-Signature"}, resp.Data)
+	assert.Empty(t, db.Files[projectID], "flagged files should not be created")
+
+	quarantined, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	content, _ := ioutil.ReadFile(dir + "/" + quarantined[0].Name())
+	assert.Equal(t, req.FileBytes, content)
+
+	select {
+	case msg := <-mailer:
+		assert.Equal(t, geneMeta.Email, msg.To)
+		assert.Contains(t, msg.Body, "payload.txt")
+	case <-time.After(time.Second):
+		t.Fatal("project owner was not emailed")
+	}
+
+	req.FileBytes = []byte("clean")
+	closures, err = req.process(db)
+	require.NoError(t, err)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
+
+func TestScanScrunchedFile(t *testing.T) {
+	dir, mailer, cleanup := setupContentScan(t)
+	defer cleanup()
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file.txt", "", projectID)
+	db.FileWrite("", "file.txt", projectID, []byte("clean"))
+	meta, _ := db.MySQLFileGetInfo(fileID)
+
+	assert.True(t, scanScrunchedFile(config.GetConfig(), meta, "loganga", db))
+	assert.Len(t, db.Files[projectID], 1)
+
+	db.FileWrite("", "file.txt", projectID, []byte("now with MALWARE"))
+	assert.False(t, scanScrunchedFile(config.GetConfig(), meta, "loganga", db))
+	assert.Empty(t, db.Files[projectID], "flagged files should be removed from the project")
+
+	quarantined, _ := ioutil.ReadDir(dir)
+	assert.Len(t, quarantined, 1)
+	select {
+	case <-mailer:
+	case <-time.After(time.Second):
+		t.Fatal("project owner was not emailed")
+	}
+}
@@ -1,26 +1,83 @@
 package datahandling
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
+	"io/ioutil"
 	"sync"
+	"time"
 
 	"strings"
 
-	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
 	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/CodeCollaborate/Server/utils"
+	"github.com/dgrijalva/jwt-go"
 )
 
+// privKey signs tokens of servers with no TokenSigningKeyFile; they are only valid until the process exits
 var privKey *ecdsa.PrivateKey
 
+// signingKeys are the keys loaded from TokenSigningKeyFiles, by the file's path
+var signingKeys = struct {
+	mutex sync.Mutex
+	keys  map[string]*ecdsa.PrivateKey
+}{keys: make(map[string]*ecdsa.PrivateKey)}
+
 func init() {
 	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	utils.LogFatal("Failed to generate signing key", err, nil)
 
 	privKey = key
+
+	// The key file cannot be changed by a reload, so it is only loaded once.
+	config.OnChange("datahandling", func(oldCfg, newCfg *config.Config) {
+		if oldCfg != nil {
+			return
+		}
+		utils.LogFatal("Failed to load token signing key", LoadTokenSigningKey(newCfg), utils.LogFields{
+			"KeyFile": newCfg.ServerConfig.TokenSigningKeyFile, // Not named after the setting, which logs would redact
+		})
+	})
+}
+
+// LoadTokenSigningKey loads the config's TokenSigningKeyFile, if it has one, returning an error if it can't be read.
+// Keys are otherwise loaded when first used; servers load theirs on creation so that they fail early.
+func LoadTokenSigningKey(cfg *config.Config) error {
+	_, err := signingKey(cfg)
+	return err
+}
+
+// signingKey returns the key that signs the tokens of the server with the config
+func signingKey(cfg *config.Config) (*ecdsa.PrivateKey, error) {
+	if cfg == nil || cfg.ServerConfig.TokenSigningKeyFile == "" {
+		return privKey, nil
+	}
+	keyFile := cfg.ServerConfig.TokenSigningKeyFile
+
+	signingKeys.mutex.Lock()
+	defer signingKeys.mutex.Unlock()
+	if key, ok := signingKeys.keys[keyFile]; ok {
+		return key, nil
+	}
+	key, err := loadSigningKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	signingKeys.keys[keyFile] = key
+	return key, nil
+}
+
+// loadSigningKey reads a PEM-encoded ECDSA private key
+func loadSigningKey(keyFile string) (*ecdsa.PrivateKey, error) {
+	pemBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseECPrivateKeyFromPEM(pemBytes)
 }
 
 /**
@@ -31,7 +88,57 @@ func init() {
 type DataHandler struct {
 	MessageChan chan<- rabbitmq.AMQPMessage
 	WebsocketID uint64
+	SessionID   string // Identifies the connection's subscriptions in the session registry, so they can be resumed
 	Db          dbfs.DBFS
+	Config      *config.Config  // The config of the server the connection was made to; defaults to the process's
+	Context     context.Context // Done when the client disconnects, abandoning its requests; defaults to Background
+	RemoteAddr  string          // The client's IP address, for login throttling and the audit log; see ClientAddr
+	UserAgent   string          // The User-Agent the connection was opened with, shown in User.ListSessions
+
+	// Authenticator checks login tokens in place of those the server issues, if set, such as those of a program the
+	// server is embedded in. API tokens are still checked by the server.
+	Authenticator Authenticator
+
+	// Order numbers the connection's messages as they are received, so that the changes it coalesces are composed in
+	// the order they were sent, though its messages are handled concurrently; see Receive
+	Order    *MessageOrder
+	sequence uint64 // The message's position in the Order, set by Receive
+}
+
+// Receive returns the handler of the connection's next message, numbered in its Order. It must be called in the order
+// the messages are received, before they are handled.
+func (dh DataHandler) Receive() DataHandler {
+	dh.sequence = dh.Order.receive()
+	return dh
+}
+
+// config returns the config of the server the connection was made to
+func (dh DataHandler) config() *config.Config {
+	if dh.Config != nil {
+		return dh.Config
+	}
+	return config.GetConfig()
+}
+
+// requestContext returns the context a request is processed in, bounded by the configured RequestTimeout, and
+// carrying a new trace ID
+func (dh DataHandler) requestContext() (context.Context, context.CancelFunc) {
+	ctx := dh.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = utils.WithTraceID(ctx, utils.NewTraceID())
+	serverCfg := dh.config().ServerConfig
+	timeout, err := serverCfg.RequestTimeoutDuration()
+	if err != nil {
+		utils.LogError("Invalid request timeout", err, utils.LogFields{
+			"RequestTimeout": serverCfg.RequestTimeout,
+		})
+	}
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
 }
 
 // Handle takes the MessageType and message in byte-array form,
@@ -39,59 +146,52 @@ type DataHandler struct {
 // the waitgroup allows the websocket manager to know when all requests have completed processing
 func (dh DataHandler) Handle(messageType int, message []byte, wg *sync.WaitGroup) error {
 	defer wg.Done()
+	defer dh.Order.pass(dh.sequence)
+	received := time.Now()
 
-	// Ignore any request that has a password JSON field
-	if !strings.Contains(strings.ToLower(string(message)), "\"password\":") {
-		utils.LogDebug("Received Message", utils.LogFields{
-			"Message": string(message),
-		})
-	}
+	// Passwords, tokens and file contents in the message are redacted by the logger
+	utils.LogDebug("Received Message", utils.LogFields{
+		"Message": string(message),
+	})
 
 	req, err := createAbstractRequest(message)
 	if err != nil {
-		utils.LogError("Failed to parse json", err, nil) // Do not log request since passwords may be sent
+		utils.LogError("Failed to parse json", err, nil)
 		return err
 	}
 
 	req.SenderID = strings.ToLower(req.SenderID)
+	req.remoteAddr = dh.RemoteAddr
+	req.sessionID = dh.SessionID
+	req.cfg = dh.Config
+	req.authenticator = dh.Authenticator
+	req.order = dh.Order
+	req.sequence = dh.sequence
+	if req.Resource+"."+req.Method != "File.Change" {
+		// Only changes are ordered, so later ones needn't wait for the request to be processed
+		dh.Order.pass(dh.sequence)
+	}
 
-	// automatically determines if the request is authenticated or not
-	fullRequest, err := getFullRequest(req)
-
-	var closures []dhClosure
-
-	if err != nil {
-		// Ignore requests where there
-		if req.Resource == "User" && (req.Method == "Register" || req.Method == "Login") {
-			utils.LogError("getFullRequest failed for Register/Login", err, nil)
-		} else {
-			utils.LogError("getFullRequest failed", err, utils.LogFields{
-				"Request": string(message),
-			})
-		}
-		if err == ErrAuthenticationFailed {
-			utils.LogDebug("User not logged in", utils.LogFields{
-				"Resource": req.Resource,
-				"Method":   req.Method,
-			})
-			closures = []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, req.Tag)}}
-		} else {
-			utils.LogDebug("No such resource/method", utils.LogFields{
-				"Resource": req.Resource,
-				"Method":   req.Method,
-			})
-			closures = []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnimplemented, req.Tag)}}
-		}
-	} else {
-		closures, err = fullRequest.process(dh.Db)
-		if err != nil {
-			utils.LogError("Failed to process request", err, utils.LogFields{
-				"Resource": req.Resource,
-				"Method":   req.Method,
-			})
-			// TODO: forward error message onto client? (or at least inform that error occurred)
-		}
+	if limited := dh.startConcurrencyLimited(req); limited != nil {
+		return toSenderClosure{msg: limited}.call(dh)
 	}
+	defer dh.finishConcurrencyLimited()
+
+	ctx, cancel := dh.requestContext()
+	defer cancel()
+	started := time.Now()
+	if ctx.Err() != nil {
+		// The client disconnected before the request was started
+		utils.LogDebug("Abandoned request", utils.LogFields{
+			"Resource": req.Resource,
+			"Method":   req.Method,
+		})
+		return ctx.Err()
+	}
+	db := dh.Db.WithContext(ctx)
+
+	call := &requestCall{req: req, message: message, received: received, ctx: ctx}
+	closures, err := requestChain(req.Resource+"."+req.Method)(dh, call, db)
 
 	for _, closure := range closures {
 		err := closure.call(dh)
@@ -103,5 +203,34 @@ func (dh DataHandler) Handle(messageType int, message []byte, wg *sync.WaitGroup
 		}
 	}
 
+	logSlowRequest(ctx, req, closures, started)
 	return err
 }
+
+// logSlowRequest logs the request, if it took longer than the SlowRequestThreshold since it started
+func logSlowRequest(ctx context.Context, req *abstractRequest, closures []dhClosure, started time.Time) {
+	elapsed := time.Since(started)
+	serverCfg := req.config().ServerConfig
+	threshold, err := serverCfg.SlowRequestThresholdDuration()
+	if err != nil {
+		utils.LogError("Invalid slow request threshold", err, utils.LogFields{
+			"SlowRequestThreshold": serverCfg.SlowRequestThreshold,
+		})
+	}
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	status := 0
+	if res, ok := senderResponse(closures, req.Tag); ok {
+		status = res.Status
+	}
+	utils.LogWarn("Slow request", utils.LogFields{
+		"TraceID":  utils.TraceID(ctx),
+		"Resource": req.Resource,
+		"Method":   req.Method,
+		"SenderID": req.SenderID,
+		"Status":   status,
+		"Duration": elapsed.String(),
+	})
+}
@@ -0,0 +1,58 @@
+package datahandling
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataHandler_RequestContext(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(timeout string) {
+		serverCfg.RequestTimeout = timeout
+	}(serverCfg.RequestTimeout)
+
+	serverCfg.RequestTimeout = ""
+	ctx, cancel := DataHandler{}.requestContext()
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	cancel()
+	assert.Equal(t, context.Canceled, ctx.Err())
+
+	serverCfg.RequestTimeout = "1m"
+	ctx, cancel = DataHandler{}.requestContext()
+	defer cancel()
+	deadline, hasDeadline := ctx.Deadline()
+	assert.True(t, hasDeadline)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	// Requests are abandoned when their connection's context is done
+	connCtx, disconnect := context.WithCancel(context.Background())
+	ctx, cancel = DataHandler{Context: connCtx}.requestContext()
+	defer cancel()
+	disconnect()
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
+
+func TestDataHandler_HandleAfterDisconnect(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	messageChan := make(chan rabbitmq.AMQPMessage, 1)
+	ctx, disconnect := context.WithCancel(context.Background())
+	dh := DataHandler{MessageChan: messageChan, Db: db, Context: ctx}
+	disconnect()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	err := dh.Handle(0, []byte(`{"Tag": 1, "Resource": "Project", "Method": "Lookup", "SenderID": "loganga", "Data": {}}`), wg)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, db.FunctionCallCount, "abandoned requests should not reach the database")
+	assert.Empty(t, messageChan, "abandoned requests should not be responded to")
+}
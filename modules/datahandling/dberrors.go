@@ -0,0 +1,45 @@
+package datahandling
+
+import (
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+)
+
+// dbErrorStatuses is the status requests respond with when they fail with a database error of each category
+var dbErrorStatuses = map[dbfs.ErrorCategory]int{
+	dbfs.CategoryInternal:    messages.StatusServFail,
+	dbfs.CategoryNotFound:    messages.StatusNotFound,
+	dbfs.CategoryNoChange:    messages.StatusFail,
+	dbfs.CategoryConflict:    messages.StatusVersionOutOfDate,
+	dbfs.CategoryInvalid:     messages.StatusFail,
+	dbfs.CategoryForbidden:   messages.StatusUnauthorized,
+	dbfs.CategoryBusy:        messages.StatusFail,
+	dbfs.CategoryUnavailable: messages.StatusServFail,
+	dbfs.CategoryCorrupt:     messages.StatusServFail,
+}
+
+// dbErrorStatus returns the status a request that failed with the database error responds with
+func dbErrorStatus(err error) int {
+	status, ok := dbErrorStatuses[dbfs.Category(err)]
+	if !ok {
+		return messages.StatusServFail
+	}
+	return status
+}
+
+// dbErrorResponse returns the response to a request that failed with the database error. Clients are told when the
+// request may succeed if it is made again.
+func dbErrorResponse(err error, tag int64) *messages.ServerMessageWrapper {
+	if !dbfs.Retryable(err) {
+		return messages.NewEmptyResponse(dbErrorStatus(err), tag)
+	}
+	return messages.Response{
+		Status: dbErrorStatus(err),
+		Tag:    tag,
+		Data: struct {
+			Retryable bool
+		}{
+			Retryable: true,
+		},
+	}.Wrap()
+}
@@ -0,0 +1,32 @@
+package datahandling
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBErrorResponse(t *testing.T) {
+	for err, status := range map[error]int{
+		dbfs.ErrNoData:               messages.StatusNotFound,
+		dbfs.ErrNoDbChange:           messages.StatusFail,
+		dbfs.ErrVersionOutOfDate:     messages.StatusVersionOutOfDate,
+		dbfs.ErrMaliciousRequest:     messages.StatusUnauthorized,
+		dbfs.ErrLockHeld:             messages.StatusFail,
+		dbfs.ErrChecksumMismatch:     messages.StatusServFail,
+		dbfs.ErrCouchbaseUnavailable: messages.StatusServFail,
+		errors.New("unknown"):        messages.StatusServFail,
+	} {
+		assert.Equal(t, status, dbErrorStatus(err), err.Error())
+	}
+
+	res := dbErrorResponse(dbfs.ErrNoData, 3).ServerMessage.(messages.Response)
+	assert.Equal(t, int64(3), res.Tag)
+	assert.Equal(t, struct{}{}, res.Data, "only retryable failures should say so")
+
+	res = dbErrorResponse(dbfs.ErrCouchbaseUnavailable, 3).ServerMessage.(messages.Response)
+	assert.Equal(t, struct{ Retryable bool }{true}, res.Data)
+}
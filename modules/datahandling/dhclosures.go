@@ -5,6 +5,8 @@ import (
 	"errors"
 
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/mail"
 	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/CodeCollaborate/Server/utils"
 )
@@ -19,22 +21,11 @@ type toSenderClosure struct {
 
 // toSenderClosure.call is the function that will forward a server message back to the client
 func (cont toSenderClosure) call(dh DataHandler) error {
-	msgJSON, err := json.Marshal(cont.msg)
+	msg, err := senderMessage(dh, cont.msg)
 	if err != nil {
 		return err
 	}
 
-	msg := rabbitmq.AMQPMessage{
-		Headers: map[string]interface{}{
-			"Origin":      rabbitmq.RabbitWebsocketQueueName(dh.WebsocketID),
-			"MessageType": cont.msg.Type,
-		},
-		RoutingKey:  rabbitmq.RabbitWebsocketQueueName(dh.WebsocketID),
-		ContentType: rabbitmq.ContentTypeMsg,
-		Persistent:  false,
-		Message:     msgJSON,
-	}
-
 	select {
 	case dh.MessageChan <- msg:
 	default:
@@ -46,13 +37,55 @@ func (cont toSenderClosure) call(dh DataHandler) error {
 	return nil
 }
 
+// senderMessage addresses the server message to the websocket that sent the request
+func senderMessage(dh DataHandler, serverMsg *messages.ServerMessageWrapper) (rabbitmq.AMQPMessage, error) {
+	msgJSON, err := json.Marshal(serverMsg)
+	if err != nil {
+		return rabbitmq.AMQPMessage{}, err
+	}
+
+	return rabbitmq.AMQPMessage{
+		Headers: map[string]interface{}{
+			"Origin":      rabbitmq.RabbitWebsocketQueueName(dh.WebsocketID),
+			"MessageType": serverMsg.Type,
+		},
+		RoutingKey:  rabbitmq.RabbitWebsocketQueueName(dh.WebsocketID),
+		ContentType: rabbitmq.ContentTypeMsg,
+		Persistent:  false,
+		Message:     msgJSON,
+	}, nil
+}
+
 type toRabbitChannelClosure struct {
 	msg *messages.ServerMessageWrapper
 	key string
+	// Ephemeral messages, which are superseded by later ones, may be dropped for clients that are not keeping up
+	ephemeral bool
+	// Messages are not delivered back to the websocket that sent the request, which already has its response, unless
+	// includeSender is set
+	includeSender bool
+	// The project whose subscribers the message is sent to, if any; its notifications are given sequence numbers
+	projectID int64
+	// The notification's "Resource.Method", by which users may mute it
+	event string
+	// Called once the message has been published, such as to time it; see latency.go
+	published func()
 }
 
 // toRabbitChannelClosure.call is the function that will forward a server message to a channel based on the given routing key
 func (cont toRabbitChannelClosure) call(dh DataHandler) error {
+	if cont.projectID != 0 && !cont.ephemeral {
+		sequenced, err := sequenceNotification(cont.projectID, cont.msg, dh.Db)
+		if err != nil {
+			// Clients treat the missing sequence number as a gap, and resync
+			utils.LogError("Failed to sequence notification", err, utils.LogFields{
+				"ProjectID": cont.projectID,
+			})
+		} else {
+			cont.msg = sequenced
+		}
+	}
+
 	msgJSON, err := json.Marshal(cont.msg)
 	if err != nil {
 		return err
@@ -68,6 +101,18 @@ func (cont toRabbitChannelClosure) call(dh DataHandler) error {
 		Persistent:  false,
 		Message:     msgJSON,
 	}
+	msg.Published = cont.published
+	if cont.ephemeral {
+		msg.Headers["Ephemeral"] = true
+	}
+	if !cont.includeSender {
+		msg.Headers["ExcludeOrigin"] = true
+	}
+	// Used to drop the notification for users who muted the project or event; see rabbitmq/mutes.go
+	if cont.projectID != 0 {
+		msg.Headers["Project"] = rabbitmq.RabbitProjectQueueName(cont.projectID)
+		msg.Headers["Event"] = cont.event
+	}
 
 	select {
 	case dh.MessageChan <- msg:
@@ -81,11 +126,56 @@ func (cont toRabbitChannelClosure) call(dh DataHandler) error {
 	return nil
 }
 
+// projectNotificationClosure publishes a notification to the project's subscribers, with the routing key for its
+// resource and method. fileID is the file the notification is about, or 0 for project-wide notifications.
+func projectNotificationClosure(projectID int64, fileID int64, not *messages.ServerMessageWrapper) toRabbitChannelClosure {
+	var resource, method string
+	if notification, ok := not.ServerMessage.(messages.Notification); ok {
+		resource, method = notification.Resource, notification.Method
+	}
+	return toRabbitChannelClosure{
+		msg:       not,
+		key:       rabbitmq.RabbitProjectRoutingKey(projectID, fileID, resource, method),
+		projectID: projectID,
+		event:     resource + "." + method,
+	}
+}
+
+// sequenceNotification gives the project's notification the next sequence number, and stores it for clients that miss
+// it, before it is published
+func sequenceNotification(projectID int64, msg *messages.ServerMessageWrapper, db dbfs.DBFS) (*messages.ServerMessageWrapper, error) {
+	notification, ok := msg.ServerMessage.(messages.Notification)
+	if !ok {
+		return msg, nil
+	}
+
+	sequence, err := db.CBNextNotificationSequence(projectID)
+	if err != nil {
+		return nil, err
+	}
+	notification.Sequence = sequence
+	notificationJSON, err := json.Marshal(notification)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CBInsertNotification(projectID, sequence, notificationJSON); err != nil {
+		return nil, err
+	}
+	noteChangeFeedNotification(projectID, notification.Resource)
+
+	sequenced := *msg
+	sequenced.ServerMessage = notification
+	return &sequenced, nil
+}
+
 type rabbitCommandClosure struct {
 	Command string
 	Tag     int64
 	Key     string
 	Data    interface{}
+
+	// The user the subscription belongs to; subscriptions with a username are recorded in the session registry
+	username string
 }
 
 // toRabbitChannelClosure.call is the function that will forward a server message to a channel based on the given routing key
@@ -118,5 +208,73 @@ func (cont rabbitCommandClosure) call(dh DataHandler) error {
 		return errors.New("Channel buffer full")
 	}
 
+	// Only this websocket's own subscriptions can be resumed by its session
+	if cont.Key == rabbitmq.RabbitWebsocketQueueName(dh.WebsocketID) && dh.SessionID != "" {
+		cont.recordSubscription(dh)
+	}
+	return nil
+}
+
+// recordSubscription updates the session registry, so that the subscription can be resumed by another connection.
+// Failures are only logged, since the subscription itself has been made.
+func (cont rabbitCommandClosure) recordSubscription(dh DataHandler) {
+	data, ok := cont.Data.(rabbitmq.RabbitQueueData)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch {
+	case cont.Command == "Subscribe" && cont.username != "":
+		err = dh.Db.MySQLSessionSubscriptionSet(dbfs.SessionSubscriptionMeta{
+			SessionID: dh.SessionID,
+			Key:       data.Key,
+			Username:  cont.username,
+			Bindings:  data.Bindings,
+		}, SessionResumeWindow)
+	case cont.Command == "Unsubscribe":
+		err = dh.Db.MySQLSessionSubscriptionRemove(dh.SessionID, data.Key)
+	}
+	utils.LogError("Failed to record subscription in session registry", err, utils.LogFields{
+		"SessionID": dh.SessionID,
+		"Command":   cont.Command,
+		"Key":       data.Key,
+	})
+}
+
+// sessionClosure tells the client the ID of its connection's session, and the subscriptions that were resumed
+type sessionClosure struct {
+	tag     int64
+	resumed []string
+}
+
+func (cont sessionClosure) call(dh DataHandler) error {
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    cont.tag,
+		Data: struct {
+			SessionID string
+			Resumed   []string
+		}{
+			SessionID: dh.SessionID,
+			Resumed:   cont.resumed,
+		},
+	}.Wrap()
+	return toSenderClosure{msg: res}.call(dh)
+}
+
+type emailClosure struct {
+	msg mail.Message
+}
+
+// emailClosure.call sends the email in the background, so that a slow mail server does not hold up the connection
+func (cont emailClosure) call(dh DataHandler) error {
+	go func() {
+		err := mail.MailerFor(dh.Config).Send(cont.msg)
+		utils.LogError("Failed to send email", err, utils.LogFields{
+			"To":      cont.msg.To,
+			"Subject": cont.msg.Subject,
+		})
+	}()
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
 )
 
@@ -27,6 +28,25 @@ type abstractRequest struct {
 	Method      string
 	Timestamp   int64
 	Data        json.RawMessage // date is a byte for now because we don't want it to unmarshal it yet
+
+	IdempotencyKey string // Optional; repeats of the request are answered with its first response. See idempotency.go
+	Nonce          string // Unique to each request, so that it can't be replayed. See replay.go
+
+	apiToken      *dbfs.APITokenMeta // set if the request was authenticated with an API token
+	remoteAddr    string             // the client's IP address, if known; see DataHandler.RemoteAddr
+	sessionID     string             // the connection's session, if the request was made over a websocket
+	cfg           *config.Config     // the config of the server that received it; see DataHandler.Config
+	authenticator Authenticator      // checks login tokens, if set; see DataHandler.Authenticator
+	order         *MessageOrder      // orders the connection's coalesced changes, if set; see DataHandler.Order
+	sequence      uint64             // the request's position among the connection's messages; see MessageOrder
+}
+
+// config returns the config of the server that received the request
+func (req abstractRequest) config() *config.Config {
+	if req.cfg != nil {
+		return req.cfg
+	}
+	return config.GetConfig()
 }
 
 // CreateAbstractRequest is the testable parsing into abstractRequests
@@ -39,9 +59,9 @@ func createAbstractRequest(jsony []byte) (req *abstractRequest, err error) {
 }
 
 func commonJSON(req request, absReq *abstractRequest) (request, error) {
+	err := decodeRequestData((*absReq).Data, req)
+	// Set after decoding, so that the data can't overwrite the sender or any other field of the envelope
 	req.setAbstractRequest(absReq)
-	rawData := (*absReq).Data
-	err := json.Unmarshal(rawData, req)
 	return req, err
 }
 
@@ -0,0 +1,297 @@
+package datahandling
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Projects and files each have an ExternalID: a random UUID which, unlike their sequential ProjectID and FileID, can't
+ * be guessed from another's, and is unique across databases, so that they can be merged. Requests may name projects
+ * and files by either: resolveExternalIDs replaces the UUIDs given as a ProjectID, FileID, ProjectIDs or FileIDs, at
+ * any depth of the request's data, with the IDs they name, before it is parsed. UUIDs that name nothing are replaced
+ * with -1, so the request fails as it would for any other project or file that doesn't exist.
+ *
+ * Responses to the sender carry both: beside each of those fields, they have a ProjectUUID, FileUUID, ProjectUUIDs or
+ * FileUUIDs. Notifications still name projects and files only by their ID.
+ */
+
+// externalIDField is the resource named by a field of request or response data, and the field its UUID is added as
+type externalIDField struct {
+	resource  string
+	uuidField string
+}
+
+var externalIDFields = map[string]externalIDField{
+	"ProjectID":  {resource: "Project", uuidField: "ProjectUUID"},
+	"ProjectIDs": {resource: "Project", uuidField: "ProjectUUIDs"},
+	"FileID":     {resource: "File", uuidField: "FileUUID"},
+	"FileIDs":    {resource: "File", uuidField: "FileUUIDs"},
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// maxExternalIDEntries bounds the cache; it is emptied when it grows past this
+const maxExternalIDEntries = 100000
+
+// externalIDs caches the ExternalIDs this server has read, which never change
+var externalIDs = newExternalIDCache()
+
+type externalIDKey struct {
+	resource string
+	id       int64
+}
+
+type externalIDCache struct {
+	mutex       sync.Mutex
+	externalIDs map[externalIDKey]string
+	ids         map[string]externalIDKey // ExternalID -> ID
+}
+
+func newExternalIDCache() *externalIDCache {
+	return &externalIDCache{
+		externalIDs: make(map[externalIDKey]string),
+		ids:         make(map[string]externalIDKey),
+	}
+}
+
+func (cache *externalIDCache) add(resource string, id int64, externalID string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if len(cache.externalIDs) >= maxExternalIDEntries {
+		cache.externalIDs = make(map[externalIDKey]string)
+		cache.ids = make(map[string]externalIDKey)
+	}
+	cache.externalIDs[externalIDKey{resource: resource, id: id}] = externalID
+	cache.ids[externalID] = externalIDKey{resource: resource, id: id}
+}
+
+// resolve returns the ID of the resource with the ExternalID, or -1 if there is none
+func (cache *externalIDCache) resolve(resource string, externalID string, db dbfs.DBFS) (int64, error) {
+	externalID = strings.ToLower(externalID)
+	cache.mutex.Lock()
+	key, ok := cache.ids[externalID]
+	cache.mutex.Unlock()
+	if ok && key.resource == resource {
+		return key.id, nil
+	}
+
+	id, err := db.MySQLExternalIDResolve(resource, externalID)
+	if err == dbfs.ErrNoData {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+	cache.add(resource, id, externalID)
+	return id, nil
+}
+
+// lookup returns the ExternalIDs of the resources with the IDs, by ID, leaving out those that don't exist
+func (cache *externalIDCache) lookup(resource string, ids []int64, db dbfs.DBFS) (map[int64]string, error) {
+	found := make(map[int64]string)
+	missing := []int64{}
+	cache.mutex.Lock()
+	for _, id := range ids {
+		if externalID, ok := cache.externalIDs[externalIDKey{resource: resource, id: id}]; ok {
+			found[id] = externalID
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	cache.mutex.Unlock()
+	if len(missing) == 0 {
+		return found, nil
+	}
+
+	read, err := db.MySQLExternalIDsGet(resource, missing)
+	if err != nil {
+		return nil, err
+	}
+	for id, externalID := range read {
+		cache.add(resource, id, externalID)
+		found[id] = externalID
+	}
+	return found, nil
+}
+
+// resolveExternalIDs replaces the UUIDs in the request's data with the IDs they name, and adds the UUIDs of the
+// projects and files named in the responses to the sender
+func resolveExternalIDs(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		req := call.req
+		data, err := resolveRequestExternalIDs(req.Data, db)
+		if err != nil {
+			utils.LogError("Failed to resolve external IDs", err, utils.LogFields{
+				"Resource": req.Resource,
+				"Method":   req.Method,
+			})
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, req.Tag)}}, err
+		}
+		req.Data = data
+
+		closures, err := next(dh, call, db)
+		for i, closure := range closures {
+			if toSender, ok := closure.(toSenderClosure); ok {
+				closures[i] = toSenderClosure{msg: addResponseExternalIDs(toSender.msg, db)}
+			}
+		}
+		return closures, err
+	}
+}
+
+// resolveRequestExternalIDs returns the request data with the UUIDs it names projects and files by replaced with their
+// IDs. Data with no UUIDs, or that can't be decoded, is returned as it is, to be parsed as usual.
+func resolveRequestExternalIDs(data json.RawMessage, db dbfs.DBFS) (json.RawMessage, error) {
+	if !bytes.Contains(data, []byte("ID")) {
+		return data, nil
+	}
+	decoded, err := decodeExternalIDData(data)
+	if err != nil {
+		return data, nil
+	}
+
+	resolved := false
+	resolve := func(resource string, value interface{}) (interface{}, error) {
+		externalID, ok := value.(string)
+		if !ok || !uuidPattern.MatchString(externalID) {
+			return value, nil
+		}
+		resolved = true
+		return externalIDs.resolve(resource, externalID, db)
+	}
+	err = walkExternalIDFields(decoded, func(object map[string]interface{}, name string, field externalIDField) error {
+		var err error
+		if values, isList := object[name].([]interface{}); isList {
+			for i := 0; i < len(values) && err == nil; i++ {
+				values[i], err = resolve(field.resource, values[i])
+			}
+		} else {
+			object[name], err = resolve(field.resource, object[name])
+		}
+		return err
+	})
+	if err != nil || !resolved {
+		return data, err
+	}
+	return json.Marshal(decoded)
+}
+
+// addResponseExternalIDs returns the message with the UUIDs of the projects and files its data names added, if it is a
+// response. Responses whose UUIDs can't be read are returned as they are.
+func addResponseExternalIDs(msg *messages.ServerMessageWrapper, db dbfs.DBFS) *messages.ServerMessageWrapper {
+	res, ok := msg.ServerMessage.(messages.Response)
+	if !ok || res.Data == nil {
+		return msg
+	}
+	data, err := json.Marshal(res.Data)
+	if err != nil || !bytes.Contains(data, []byte("ID")) {
+		return msg
+	}
+	decoded, err := decodeExternalIDData(data)
+	if err != nil {
+		return msg
+	}
+
+	// Every UUID is read first, so that each resource's are read from MySQL at once
+	ids := make(map[string][]int64)
+	walkExternalIDFields(decoded, func(object map[string]interface{}, name string, field externalIDField) error {
+		ids[field.resource] = append(ids[field.resource], externalIDValues(object[name])...)
+		return nil
+	})
+	if len(ids) == 0 {
+		return msg
+	}
+	found := make(map[string]map[int64]string)
+	for resource, resourceIDs := range ids {
+		if found[resource], err = externalIDs.lookup(resource, resourceIDs, db); err != nil {
+			utils.LogError("Failed to read external IDs for response", err, utils.LogFields{
+				"Resource": resource,
+			})
+			return msg
+		}
+	}
+
+	walkExternalIDFields(decoded, func(object map[string]interface{}, name string, field externalIDField) error {
+		if _, isList := object[name].([]interface{}); isList {
+			uuids := []string{}
+			for _, id := range externalIDValues(object[name]) {
+				uuids = append(uuids, found[field.resource][id])
+			}
+			object[field.uuidField] = uuids
+		} else if id := externalIDValues(object[name]); len(id) == 1 && found[field.resource][id[0]] != "" {
+			object[field.uuidField] = found[field.resource][id[0]]
+		}
+		return nil
+	})
+	raw, err := json.Marshal(decoded)
+	if err != nil {
+		return msg
+	}
+	res.Data = json.RawMessage(raw)
+	withIDs := *msg
+	withIDs.ServerMessage = res
+	return &withIDs
+}
+
+func decodeExternalIDData(data []byte) (interface{}, error) {
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&decoded)
+	return decoded, err
+}
+
+// externalIDValues returns the IDs of a field that names projects or files, ignoring any that aren't IDs
+func externalIDValues(value interface{}) []int64 {
+	values, ok := value.([]interface{})
+	if !ok {
+		values = []interface{}{value}
+	}
+	ids := []int64{}
+	for _, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if id, err := number.Int64(); err == nil && id > 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// walkExternalIDFields calls visit with each field of the decoded data that names projects or files, at any depth
+func walkExternalIDFields(decoded interface{}, visit func(object map[string]interface{}, name string,
+	field externalIDField) error) error {
+	switch value := decoded.(type) {
+	case map[string]interface{}:
+		for name, field := range externalIDFields {
+			if _, ok := value[name]; ok {
+				if err := visit(value, name, field); err != nil {
+					return err
+				}
+			}
+		}
+		for name, child := range value {
+			if _, ok := externalIDFields[name]; ok {
+				continue
+			}
+			if err := walkExternalIDFields(child, visit); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range value {
+			if err := walkExternalIDFields(child, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveExternalIDs(t *testing.T) {
+	externalIDs = newExternalIDCache()
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", ".", projectID)
+	projectUUIDs, _ := db.MySQLExternalIDsGet("Project", []int64{projectID})
+	fileUUIDs, _ := db.MySQLExternalIDsGet("File", []int64{fileID})
+	projectUUID, fileUUID := projectUUIDs[projectID], fileUUIDs[fileID]
+	require.Len(t, projectUUID, 36)
+
+	var parsed json.RawMessage
+	process := resolveExternalIDs(func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		parsed = call.req.Data
+		res := messages.Response{
+			Status: messages.StatusSuccess,
+			Data: struct {
+				Files []dbfs.FileMeta
+			}{
+				Files: []dbfs.FileMeta{{FileID: fileID, ProjectID: projectID}},
+			},
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	})
+
+	data := fmt.Sprintf(`{"ProjectID": %q, "Changes": [{"FileIDs": [%q, 7, "00000000-0000-4000-8000-000000000000"]}]}`,
+		strings.ToUpper(projectUUID), fileUUID)
+	closures, err := process(DataHandler{}, &requestCall{req: &abstractRequest{Data: json.RawMessage(data)}}, db)
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"ProjectID": %d, "Changes": [{"FileIDs": [%d, 7, -1]}]}`, projectID, fileID),
+		string(parsed), "UUIDs should be resolved at any depth, and unknown ones should name nothing")
+
+	res := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	var files struct {
+		Files []struct {
+			FileID      int64
+			FileUUID    string
+			ProjectID   int64
+			ProjectUUID string
+		}
+	}
+	require.NoError(t, json.Unmarshal(res.Data.(json.RawMessage), &files))
+	require.Len(t, files.Files, 1)
+	assert.Equal(t, fileID, files.Files[0].FileID)
+	assert.Equal(t, fileUUID, files.Files[0].FileUUID)
+	assert.Equal(t, projectUUID, files.Files[0].ProjectUUID)
+
+	// Requests by ID are passed on untouched, and cached UUIDs aren't read again
+	calls := db.FunctionCallCount
+	data = fmt.Sprintf(`{"ProjectID":%d}`, projectID)
+	_, err = process(DataHandler{}, &requestCall{req: &abstractRequest{Data: json.RawMessage(data)}}, db)
+	require.NoError(t, err)
+	assert.Equal(t, data, string(parsed))
+	assert.Equal(t, calls, db.FunctionCallCount)
+}
+
+func TestResolveExternalIDs_Handle(t *testing.T) {
+	configSetup(t)
+	externalIDs = newExternalIDCache()
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+	projectUUIDs, _ := db.MySQLExternalIDsGet("Project", []int64{projectID})
+
+	messageChan := make(chan rabbitmq.AMQPMessage, 8)
+	dh := DataHandler{MessageChan: messageChan, Db: db}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	dh.Handle(0, []byte(fmt.Sprintf(
+		`{"Tag": 1, "Resource": "Project", "Method": "Lookup", "SenderID": "loganga", "SenderToken": %q, "Data": {"ProjectIDs": [%q]}}`,
+		testToken(t, "loganga"), projectUUIDs[projectID])), wg)
+	require.Len(t, messageChan, 1)
+
+	var res struct {
+		ServerMessage struct {
+			Status int
+			Data   struct {
+				Projects []struct {
+					ProjectID   int64
+					ProjectUUID string
+					Name        string
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal((<-messageChan).Message, &res))
+	require.Equal(t, messages.StatusSuccess, res.ServerMessage.Status)
+	require.Len(t, res.ServerMessage.Data.Projects, 1)
+	assert.Equal(t, projectID, res.ServerMessage.Data.Projects[0].ProjectID)
+	assert.Equal(t, projectUUIDs[projectID], res.ServerMessage.Data.Projects[0].ProjectUUID)
+	assert.Equal(t, "project", res.ServerMessage.Data.Projects[0].Name)
+}
@@ -0,0 +1,68 @@
+package datahandling
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+/**
+ * File.Diff returns a single patch from one version of a file to another, composed from the patches stored between
+ * them, so that clients that have been away can catch up on a file without replaying each change. Only the patches
+ * since the file was last scrunched are kept; diffs from earlier versions are answered with StatusVersionOutOfDate, and
+ * the client must pull the file instead.
+ */
+
+// errVersionRange is returned for a diff to a version the file hasn't reached, or from a version after the one diffed to
+var errVersionRange = errors.New("The versions to diff are out of range")
+
+// diffVersions returns the patch that takes the file from one version to another, from its stored contents, the
+// patches stored since, and its current version
+func diffVersions(raw []byte, changes []string, version int64, from int64, to int64) (*patching.Patch, error) {
+	if from > to || to > version {
+		return nil, errVersionRange
+	}
+
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return nil, err
+	}
+	if len(patches) > 0 && from < patches[0].BaseVersion || len(patches) == 0 && from < version {
+		return nil, errBaseVersionUnavailable
+	}
+
+	var between []*patching.Patch
+	for _, patch := range patches {
+		if patch.BaseVersion >= from && patch.BaseVersion < to {
+			between = append(between, patch)
+		}
+	}
+	if len(between) > 0 {
+		return patching.ConsolidatePatches(between)
+	}
+
+	// Nothing changed, so the patch is empty
+	text, err := textAtVersion(raw, patches, version, from)
+	if err != nil {
+		return nil, err
+	}
+	return patching.NewPatch(from, patching.Diffs{}, utf8.RuneCountInString(text)), nil
+}
+
+// textAtVersion returns the file's text at the given version, from its stored contents, the patches stored since, and
+// its current version
+func textAtVersion(raw []byte, patches []*patching.Patch, version int64, at int64) (string, error) {
+	if at > version {
+		return "", errVersionRange
+	}
+	if len(patches) > 0 && at < patches[0].BaseVersion || len(patches) == 0 && at < version {
+		return "", errBaseVersionUnavailable
+	}
+
+	applied := 0
+	for applied < len(patches) && patches[applied].BaseVersion < at {
+		applied++
+	}
+	return patching.PatchText(string(raw), patches[:applied])
+}
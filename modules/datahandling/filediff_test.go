@@ -0,0 +1,87 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffVersions(t *testing.T) {
+	raw := []byte("one\ntwo\n")
+	changes := []string{
+		"v3:\n0:+1:x:\n8",
+		"v4:\n5:-3:two:\n9",
+		"v5:\n5:+5:three:\n6",
+	}
+	texts := map[int64]string{3: "one\ntwo\n", 4: "xone\ntwo\n", 5: "xone\n\n", 6: "xone\nthree\n"}
+
+	for from := int64(3); from <= 6; from++ {
+		for to := from; to <= 6; to++ {
+			patch, err := diffVersions(raw, changes, 6, from, to)
+			require.NoError(t, err)
+			assert.Equal(t, from, patch.BaseVersion)
+			text, err := patching.PatchText(texts[from], []*patching.Patch{patch})
+			require.NoError(t, err)
+			assert.Equal(t, texts[to], text, "diff from version %d to %d", from, to)
+		}
+	}
+
+	_, err := diffVersions(raw, changes, 6, 2, 6)
+	assert.Equal(t, errBaseVersionUnavailable, err)
+	_, err = diffVersions(raw, changes, 6, 5, 4)
+	assert.Equal(t, errVersionRange, err)
+	_, err = diffVersions(raw, changes, 6, 5, 7)
+	assert.Equal(t, errVersionRange, err)
+
+	// Without stored patches, only the current version is available
+	patch, err := diffVersions(raw, nil, 3, 3, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "v3:\n:\n8", patch.String())
+	_, err = diffVersions(raw, nil, 3, 2, 3)
+	assert.Equal(t, errBaseVersionUnavailable, err)
+}
+
+func TestFileDiff(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.CBInsertNewFile(fileID, 1, []string{})
+	fileBytes := []byte("one\ntwo\n")
+	db.File = &fileBytes
+	db.FileChanges[fileID] = []string{"v1:\n0:+1:x:\n8", "v2:\n5:+1:y:\n9"}
+	db.FileVersion[fileID] = 3
+
+	diff := fileDiffRequest{FileID: fileID, FromVersion: 1}
+	setBaseFields(&diff)
+	diff.Resource = "File"
+	diff.Method = "Diff"
+	db.FunctionCallCount = 0
+	res, _ := processForTest(t, &diff, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, 5, db.FunctionCallCount)
+	data := reflect.ValueOf(res.Data)
+	assert.Equal(t, int64(3), data.FieldByName("ToVersion").Int())
+	assert.Equal(t, "v1:\n0:+1:x,\n4:+1:y:\n8", data.FieldByName("Changes").String())
+
+	// CRLF clients are sent the diff against their own text
+	require.NoError(t, db.MySQLProjectSetLineEndings(projectID, "LF"))
+	diff.ToVersion = 2
+	diff.LineEndings = "CRLF"
+	res, _ = processForTest(t, &diff, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data = reflect.ValueOf(res.Data)
+	assert.Equal(t, "v1:\n0:+1:x:\n10", data.FieldByName("Changes").String())
+	assert.Equal(t, "CRLF", data.FieldByName("LineEndings").String())
+
+	// History before the file was last scrunched is gone
+	db.FileChanges[fileID] = db.FileChanges[fileID][1:]
+	res, _ = processForTest(t, &diff, db)
+	assert.Equal(t, messages.StatusVersionOutOfDate, res.Status)
+}
@@ -0,0 +1,104 @@
+package datahandling
+
+import (
+	"path"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+)
+
+/**
+ * No two files in a project may share a path, since they would share a path in the bucket, and each would overwrite
+ * the other's contents. Creating, moving or renaming a file onto another file's path is answered with StatusConflict,
+ * and the other file's ID.
+ *
+ * Paths are compared exactly, unless ServerConfig.CaseInsensitivePaths is set. Then, paths that differ only in case
+ * collide too, and the directories of a new path take the case of the project's existing directories, so that
+ * clients on case-insensitive filesystems don't see one directory split into two.
+ */
+
+// pathsCaseInsensitive returns true if file paths that differ only in case are treated as the same path
+func pathsCaseInsensitive(cfg *config.Config) bool {
+	return cfg.ServerConfig.CaseInsensitivePaths
+}
+
+// samePath returns true if the paths are the same file
+func samePath(cfg *config.Config, a string, b string) bool {
+	if pathsCaseInsensitive(cfg) {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// splitPath returns the directories of a relative path, outermost first
+func splitPath(relativePath string) []string {
+	cleaned := strings.Trim(path.Clean("/"+relativePath), "/")
+	if cleaned == "" {
+		return nil
+	}
+	return strings.Split(cleaned, "/")
+}
+
+// matchDirectoryCase returns relativePath with its leading directories in the case of the project's existing
+// directories of the same names, ignoring the file being moved. Paths are returned unchanged unless paths are
+// case-insensitive.
+func matchDirectoryCase(cfg *config.Config, projectID int64, fileID int64, relativePath string,
+	db dbfs.DBFS) (string, error) {
+	dirs := splitPath(relativePath)
+	if !pathsCaseInsensitive(cfg) || len(dirs) == 0 {
+		return relativePath, nil
+	}
+
+	files, err := db.MySQLProjectGetFiles(projectID)
+	if err != nil {
+		return relativePath, err
+	}
+
+	var matched []string
+	for _, file := range files {
+		if file.FileID == fileID {
+			continue
+		}
+		existing := splitPath(file.RelativePath)
+		n := 0
+		for n < len(dirs) && n < len(existing) && strings.EqualFold(dirs[n], existing[n]) {
+			n++
+		}
+		if n > len(matched) {
+			matched = existing[:n]
+		}
+	}
+	if len(matched) == 0 {
+		return relativePath, nil
+	}
+	return path.Join(append(append([]string{}, matched...), dirs[len(matched):]...)...), nil
+}
+
+// checkFileCollision returns the response to send if another file in the project already has the given path and
+// name, or nil if the file with ID fileID (0 for a new file) may have them
+func checkFileCollision(req abstractRequest, projectID int64, fileID int64, relativePath string, filename string, db dbfs.DBFS) ([]dhClosure, error) {
+	files, err := db.MySQLFileGetByPath(projectID, relativePath, filename)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, req.Tag)}}, err
+	}
+
+	target := path.Join(relativePath, filename)
+	for _, other := range files {
+		if other.FileID == fileID || !samePath(req.config(), path.Join(other.RelativePath, other.Filename), target) {
+			continue
+		}
+		res := messages.Response{
+			Status: messages.StatusConflict,
+			Tag:    req.Tag,
+			Data: struct {
+				FileID int64
+			}{
+				FileID: other.FileID,
+			},
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+	return nil, nil
+}
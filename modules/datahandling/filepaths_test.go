@@ -0,0 +1,126 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchDirectoryCase(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "main.go", "Src/Server", projectID)
+	db.MySQLFileCreate("loganga", "Readme.md", ".", projectID)
+
+	tests := []struct {
+		desc     string
+		path     string
+		fileID   int64
+		expected string
+	}{
+		{"Matching directories", "src/server", 0, "Src/Server"},
+		{"Matching parent", "SRC/client/", 0, "Src/client"},
+		{"New directory", "docs", 0, "docs"},
+		{"Project root", "", 0, ""},
+		{"File being moved", "src/server", fileID, "src/server"},
+	}
+
+	for _, test := range tests {
+		actual, err := matchDirectoryCase(config.GetConfig(), projectID, test.fileID, test.path, db)
+		require.NoError(t, err)
+		assert.Equal(t, test.path, actual, "%s: paths should be unchanged by default", test.desc)
+	}
+
+	config.GetConfig().ServerConfig.CaseInsensitivePaths = true
+	for _, test := range tests {
+		actual, err := matchDirectoryCase(config.GetConfig(), projectID, test.fileID, test.path, db)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, actual, test.desc)
+	}
+}
+
+func TestFileCreate_CaseInsensitivePaths(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	create := func(relativePath string, name string) messages.Response {
+		req := fileCreateRequest{Name: name, RelativePath: relativePath, ProjectID: projectID}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Create"
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+
+	readmeID := reflect.ValueOf(create("Docs", "README.md").Data).FieldByName("FileID").Int()
+
+	// Only the exact path collides by default
+	assert.Equal(t, messages.StatusConflict, create("Docs", "README.md").Status)
+	assert.Equal(t, messages.StatusSuccess, create("Docs", "Readme.md").Status)
+
+	config.GetConfig().ServerConfig.CaseInsensitivePaths = true
+	res := create("docs", "readme.MD")
+	assert.Equal(t, messages.StatusConflict, res.Status)
+	assert.Equal(t, readmeID, reflect.ValueOf(res.Data).FieldByName("FileID").Int())
+
+	// New files join the existing directory, rather than starting another
+	res = create("docs", "guide.md")
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	file, err := db.MySQLFileGetInfo(reflect.ValueOf(res.Data).FieldByName("FileID").Int())
+	require.NoError(t, err)
+	assert.Equal(t, "Docs", file.RelativePath)
+}
+
+func TestFileMoveAndRename_CaseInsensitivePaths(t *testing.T) {
+	configSetup(t)
+	config.GetConfig().ServerConfig.CaseInsensitivePaths = true
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "main.go", "src", projectID)
+	db.MySQLFileCreate("loganga", "Main.go", "Cmd", projectID)
+	db.MySQLFileCreate("loganga", "util.go", "src", projectID)
+
+	respond := func(req request) messages.Response {
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+	move := func(newPath string) messages.Response {
+		req := fileMoveRequest{FileID: fileID, NewPath: newPath}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Move"
+		return respond(&req)
+	}
+	rename := func(newName string) messages.Response {
+		req := fileRenameRequest{FileID: fileID, NewName: newName}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Rename"
+		return respond(&req)
+	}
+
+	assert.Equal(t, messages.StatusConflict, move("cmd").Status)
+
+	// A file may change the case of its own name
+	assert.Equal(t, messages.StatusSuccess, rename("Main.go").Status)
+	assert.Equal(t, messages.StatusConflict, rename("UTIL.go").Status)
+
+	assert.Equal(t, messages.StatusSuccess, rename("server.go").Status)
+	assert.Equal(t, messages.StatusSuccess, move("cmd").Status)
+	file, err := db.MySQLFileGetInfo(fileID)
+	require.NoError(t, err)
+	assert.Equal(t, "Cmd", file.RelativePath)
+	assert.Equal(t, "server.go", file.Filename)
+}
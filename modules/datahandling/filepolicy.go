@@ -0,0 +1,100 @@
+package datahandling
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * The file policy keeps files that do not belong in a text collaboration system, such as large binaries, out of
+ * projects. Files it rejects are answered with StatusFileRejected, and a filePolicyViolation describing why.
+ */
+
+// Reasons a file may be rejected
+const (
+	fileTooLarge        = "FileTooLarge"
+	extensionNotAllowed = "ExtensionNotAllowed"
+	typeNotAllowed      = "TypeNotAllowed"
+	contentFlagged      = "ContentFlagged" // Flagged by the malware scanner; see contentscan.go
+	pathIgnored         = "PathIgnored"    // Matched by the project's ignore rules; see ignorerules.go
+)
+
+// filePolicyViolation is the Data of a StatusFileRejected response
+type filePolicyViolation struct {
+	Reason           string
+	Size             int64
+	MaxFileSizeBytes int64
+	Extension        string
+	MIMEType         string
+	Signature        string // The malware signature that matched, if flagged by the scanner
+	IgnoreRule       string // The ignore rule that matched, if ignored
+}
+
+// checkFilePolicy returns the reason the configured file policy rejects the file, or nil if the file is allowed
+func checkFilePolicy(cfg *config.Config, filename string, content []byte) *filePolicyViolation {
+	policy := cfg.ServerConfig.FilePolicy
+	violation := filePolicyViolation{
+		Size:             int64(len(content)),
+		MaxFileSizeBytes: policy.MaxFileSizeBytes,
+		Extension:        strings.ToLower(path.Ext(filename)),
+		MIMEType:         detectMIMEType(content),
+	}
+
+	switch {
+	case policy.MaxFileSizeBytes > 0 && violation.Size > policy.MaxFileSizeBytes:
+		violation.Reason = fileTooLarge
+	case !listAllows(policy.AllowedExtensions, policy.DeniedExtensions, violation.Extension, extensionMatches):
+		violation.Reason = extensionNotAllowed
+	case !listAllows(policy.AllowedMIMETypes, policy.DeniedMIMETypes, violation.MIMEType, mimeTypeMatches):
+		violation.Reason = typeNotAllowed
+	default:
+		return nil
+	}
+	return &violation
+}
+
+// detectMIMEType returns the MIME type of the content, without parameters such as its charset
+func detectMIMEType(content []byte) string {
+	mimeType := http.DetectContentType(content)
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.TrimSpace(mimeType)
+}
+
+// listAllows returns false if the value matches the deny-list, or if there is an allow-list that it does not match
+func listAllows(allowed []string, denied []string, value string, matches func(pattern, value string) bool) bool {
+	for _, pattern := range denied {
+		if matches(pattern, value) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if matches(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func extensionMatches(pattern, extension string) bool {
+	pattern = strings.ToLower(pattern)
+	if pattern != "" && !strings.HasPrefix(pattern, ".") {
+		pattern = "." + pattern
+	}
+	return pattern == extension
+}
+
+func mimeTypeMatches(pattern, mimeType string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == mimeType
+}
@@ -0,0 +1,84 @@
+package datahandling
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFilePolicy(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(policy config.FilePolicyCfg) {
+		serverCfg.FilePolicy = policy
+	}(serverCfg.FilePolicy)
+
+	serverCfg.FilePolicy = config.FilePolicyCfg{}
+	assert.Nil(t, checkFilePolicy(config.GetConfig(), "anything.bin", []byte{0, 1, 2}), "an empty policy should allow everything")
+
+	serverCfg.FilePolicy = config.FilePolicyCfg{
+		MaxFileSizeBytes: 10,
+		DeniedExtensions: []string{"EXE", ".dll"},
+		DeniedMIMETypes:  []string{"image/*"},
+	}
+	assert.Nil(t, checkFilePolicy(config.GetConfig(), "main.go", []byte("package a")))
+	violation := checkFilePolicy(config.GetConfig(), "main.go", []byte("package main"))
+	require.NotNil(t, violation)
+	assert.Equal(t, fileTooLarge, violation.Reason)
+	assert.EqualValues(t, 12, violation.Size)
+
+	violation = checkFilePolicy(config.GetConfig(), "setup.exe", []byte("MZ"))
+	require.NotNil(t, violation)
+	assert.Equal(t, extensionNotAllowed, violation.Reason)
+	assert.Equal(t, ".exe", violation.Extension)
+
+	violation = checkFilePolicy(config.GetConfig(), "logo.txt", []byte("\x89PNG\r\n\x1a\n"))
+	require.NotNil(t, violation)
+	assert.Equal(t, typeNotAllowed, violation.Reason)
+	assert.Equal(t, "image/png", violation.MIMEType)
+
+	serverCfg.FilePolicy = config.FilePolicyCfg{
+		AllowedExtensions: []string{".go", ".md"},
+		AllowedMIMETypes:  []string{"text/plain"},
+	}
+	assert.Nil(t, checkFilePolicy(config.GetConfig(), "README.MD", []byte("# Readme")))
+	violation = checkFilePolicy(config.GetConfig(), "Makefile", []byte("all:"))
+	require.NotNil(t, violation)
+	assert.Equal(t, extensionNotAllowed, violation.Reason)
+	violation = checkFilePolicy(config.GetConfig(), "page.md", []byte("<html><body></body></html>"))
+	require.NotNil(t, violation)
+	assert.Equal(t, typeNotAllowed, violation.Reason)
+}
+
+func TestFileCreateRequest_FilePolicy(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(policy config.FilePolicyCfg) {
+		serverCfg.FilePolicy = policy
+	}(serverCfg.FilePolicy)
+	serverCfg.FilePolicy = config.FilePolicyCfg{MaxFileSizeBytes: 4}
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	req := *new(fileCreateRequest)
+	setBaseFields(&req)
+	req.Resource = "File"
+	req.Method = "Create"
+	req.Name = "big.txt"
+	req.ProjectID = projectID
+	req.FileBytes = []byte("too big")
+
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 1)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFileRejected, resp.Status)
+	assert.Equal(t, fileTooLarge, resp.Data.(filePolicyViolation).Reason)
+	assert.Empty(t, db.Files[projectID], "rejected files should not be created")
+}
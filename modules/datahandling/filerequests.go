@@ -1,9 +1,16 @@
 package datahandling
 
 import (
+	"context"
+	"errors"
+	"path"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
-	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/modules/search"
 	"github.com/CodeCollaborate/Server/utils"
 )
 
@@ -44,20 +51,47 @@ func initFileRequests() {
 	authenticatedRequestMap["File.Change"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(fileChangeRequest), req)
 	}
+	// Connections whose changes keep being made against stale versions are told how to catch up; see resync.go
+	methodMiddleware["File.Change"] = []middleware{hintResync, timeChange}
 
 	authenticatedRequestMap["File.Pull"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(filePullRequest), req)
 	}
 
+	authenticatedRequestMap["File.GetHistory"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileGetHistoryRequest), req)
+	}
+
+	authenticatedRequestMap["File.Annotate"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileAnnotateRequest), req)
+	}
+
+	authenticatedRequestMap["File.Diff"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileDiffRequest), req)
+	}
+
+	authenticatedRequestMap["File.Search"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileSearchRequest), req)
+	}
+
+	authenticatedRequestMap["File.SetMetadata"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileSetMetadataRequest), req)
+	}
+
+	authenticatedRequestMap["File.GetMetadata"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(fileGetMetadataRequest), req)
+	}
+
 	fileRequestsSetup = true
 }
 
 // File.Create
 type fileCreateRequest struct {
-	Name         string
+	Name         string `validate:"required"`
 	RelativePath string
-	ProjectID    int64
+	ProjectID    int64 `validate:"required"`
 	FileBytes    []byte
+	LineEndings  string `validate:"omitempty,oneof=LF CRLF"` // The client's line endings; see lineendings.go
 	abstractRequest
 }
 
@@ -66,7 +100,7 @@ func (f *fileCreateRequest) setAbstractRequest(req *abstractRequest) {
 }
 
 func (f fileCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, f.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(f.abstractRequest, f.ProjectID, config.CapabilityEditFiles, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -77,21 +111,96 @@ func (f fileCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
-	fileID, err := db.MySQLFileCreate(f.SenderID, f.Name, f.RelativePath, f.ProjectID)
+	if res, err := archivedResponse(f.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	f.RelativePath, err = matchDirectoryCase(f.config(), f.ProjectID, 0, f.RelativePath, db)
 	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+	if closures, err := checkFileCollision(f.abstractRequest, f.ProjectID, 0, f.RelativePath, f.Name, db); closures != nil {
+		return closures, err
+	}
+
+	rules, err := projectIgnoreRules(f.ProjectID, pathsCaseInsensitive(f.config()), db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+	if rule, ignored := rules.match(f.RelativePath, f.Name); ignored {
+		res := messages.Response{
+			Status: messages.StatusFileRejected,
+			Tag:    f.Tag,
+			Data:   filePolicyViolation{Reason: pathIgnored, IgnoreRule: rule},
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	normalized, err := normalizesLineEndings(f.ProjectID, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+	if normalized {
+		f.FileBytes = []byte(toLF(string(f.FileBytes)))
+	}
+
+	if violation := checkFilePolicy(f.config(), f.Name, f.FileBytes); violation != nil {
+		res := messages.Response{
+			Status: messages.StatusFileRejected,
+			Tag:    f.Tag,
+			Data:   *violation,
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	result, err := scanContent(f.config(), f.FileBytes)
+	if err != nil {
+		// Contents that could not be scanned are refused, rather than let through unchecked
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+	if result.Infected {
+		quarantineFile(f.config(), f.ProjectID, path.Join(f.RelativePath, f.Name), f.FileBytes, result, f.SenderID, db)
+		res := messages.Response{
+			Status: messages.StatusFileRejected,
+			Tag:    f.Tag,
+			Data: filePolicyViolation{
+				Reason:    contentFlagged,
+				Size:      int64(len(f.FileBytes)),
+				Signature: result.Signature,
+			},
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	err = checkQuota(f.config(), f.ProjectID, f.SenderID, int64(len(f.FileBytes)), db)
+	if err == errQuotaExceeded {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusQuotaExceeded, f.Tag)}}, nil
+	} else if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
+	fileID, err := db.MySQLFileCreate(f.SenderID, f.Name, f.RelativePath, f.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
 	_, err = db.FileWrite(f.RelativePath, f.Name, f.ProjectID, f.FileBytes)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		f.removeFailedFile(fileID, false, db)
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	err = db.CBInsertNewFile(fileID, newFileVersion, make([]string, 0))
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		f.removeFailedFile(fileID, true, db)
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
+	err = db.MySQLFileAddSize(fileID, int64(len(f.FileBytes)))
+	utils.LogError("Failed to record file size", err, utils.LogFields{
+		"FileID": fileID,
+	})
+
 	res := messages.Response{
 		Status: messages.StatusSuccess,
 		Tag:    f.Tag,
@@ -117,13 +226,28 @@ func (f fileCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		},
 	}.Wrap()
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(f.ProjectID)}}, nil
+	scheduleFileIndex(f.config(), fileID, db)
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(f.ProjectID, 0, not)}, nil
+}
+
+// removeFailedFile removes what was created of a file that could not be created, so that it doesn't collide with the
+// client's retry
+func (f fileCreateRequest) removeFailedFile(fileID int64, written bool, db dbfs.DBFS) {
+	if written {
+		utils.LogError("Failed to remove contents of half-created file", db.FileDelete(f.RelativePath, f.Name, f.ProjectID), utils.LogFields{
+			"FileID": fileID,
+		})
+	}
+	utils.LogError("Failed to remove half-created file", db.MySQLFileDelete(fileID), utils.LogFields{
+		"FileID": fileID,
+	})
 }
 
 // File.Rename
 type fileRenameRequest struct {
-	FileID  int64
-	NewName string
+	FileID  int64  `validate:"required"`
+	NewName string `validate:"required"`
 	abstractRequest
 }
 
@@ -134,10 +258,10 @@ func (f *fileRenameRequest) setAbstractRequest(req *abstractRequest) {
 func (f fileRenameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, fileMeta.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityEditFiles, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -148,14 +272,22 @@ func (f fileRenameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	if closures, err := checkFileCollision(f.abstractRequest, fileMeta.ProjectID, f.FileID, fileMeta.RelativePath, f.NewName, db); closures != nil {
+		return closures, err
+	}
+
 	err = db.MySQLFileRename(f.FileID, f.NewName)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	err = db.FileMove(fileMeta.RelativePath, fileMeta.Filename, fileMeta.RelativePath, f.NewName, fileMeta.ProjectID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	res := messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)
@@ -170,12 +302,14 @@ func (f fileRenameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		},
 	}.Wrap()
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(fileMeta.ProjectID)}}, nil
+	scheduleFileIndex(f.config(), f.FileID, db)
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(fileMeta.ProjectID, f.FileID, not)}, nil
 }
 
 // File.Move
 type fileMoveRequest struct {
-	FileID  int64
+	FileID  int64 `validate:"required"`
 	NewPath string
 	abstractRequest
 }
@@ -187,10 +321,10 @@ func (f *fileMoveRequest) setAbstractRequest(req *abstractRequest) {
 func (f fileMoveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, fileMeta.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityEditFiles, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -201,14 +335,26 @@ func (f fileMoveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	f.NewPath, err = matchDirectoryCase(f.config(), fileMeta.ProjectID, f.FileID, f.NewPath, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+	if closures, err := checkFileCollision(f.abstractRequest, fileMeta.ProjectID, f.FileID, f.NewPath, fileMeta.Filename, db); closures != nil {
+		return closures, err
+	}
+
 	err = db.MySQLFileMove(f.FileID, f.NewPath)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	err = db.FileMove(fileMeta.RelativePath, fileMeta.Filename, f.NewPath, fileMeta.Filename, fileMeta.ProjectID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	res := messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)
@@ -223,12 +369,14 @@ func (f fileMoveRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		},
 	}.Wrap()
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(fileMeta.ProjectID)}}, nil
+	scheduleFileIndex(f.config(), f.FileID, db)
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(fileMeta.ProjectID, f.FileID, not)}, nil
 }
 
 // File.Delete
 type fileDeleteRequest struct {
-	FileID int64
+	FileID int64 `validate:"required"`
 	abstractRequest
 }
 
@@ -239,10 +387,10 @@ func (f *fileDeleteRequest) setAbstractRequest(req *abstractRequest) {
 func (f fileDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, fileMeta.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityEditFiles, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -253,19 +401,29 @@ func (f fileDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
 	err = db.MySQLFileDelete(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	err = db.FileDelete(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
 	err = db.CBDeleteFile(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	if err := search.Unindex(f.config(), f.FileID); err != nil {
+		utils.LogError("Search: failed to remove file from index", err, utils.LogFields{
+			"FileID": f.FileID,
+		})
 	}
 
 	res := messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)
@@ -278,14 +436,16 @@ func (f fileDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 
 	return []dhClosure{
 		toSenderClosure{msg: res},
-		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(fileMeta.ProjectID)},
+		projectNotificationClosure(fileMeta.ProjectID, f.FileID, not),
 	}, nil
 }
 
 // File.Change
 type fileChangeRequest struct {
-	FileID  int64
-	Changes string
+	FileID      int64  `validate:"required"`
+	Changes     string `validate:"required"`
+	LineEndings string `validate:"omitempty,oneof=LF CRLF"` // The line endings of the text Changes was made against
+	Coalesce    bool   // Whether the change may be composed with the connection's others; see changebatch.go
 	abstractRequest
 }
 
@@ -298,10 +458,10 @@ func (f fileChangeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	// Specifically, this prevents CouchBase from incrementing a version number without the notifications being sent out.
 	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
 	}
 
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, fileMeta.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityEditFiles, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -312,28 +472,92 @@ func (f fileChangeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	// Patches from CRLF clients are converted to the LF the file is stored with
+	var history *lfHistory
+	if f.LineEndings == lineEndingsCRLF {
+		history, err = loadLFHistory(fileMeta, db)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+	}
+	if history != nil {
+		converted, err := history.fromCRLF(f.Changes)
+		if err == errBaseVersionUnavailable {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusVersionOutOfDate, f.Tag)}}, err
+		} else if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+		f.Changes = converted
+	}
+	f.Changes = stampAuthorship(f.Changes, f.SenderID)
+
+	if f.Coalesce && history == nil {
+		return coalesceChange(f, fileMeta, db)
+	}
+	return f.appendChange(fileMeta, history, db)
+}
+
+// fileChangeResponse is the Data of File.Change responses
+type fileChangeResponse struct {
+	FileVersion    int64
+	Changes        string
+	MissingPatches []string
+	LineEndings    string // CRLF if Changes and MissingPatches were converted to the client's CRLF
+}
+
+// appendChange appends the change, once it has been authorized and converted to LF, to the file, and notifies the
+// project's subscribers
+func (f fileChangeRequest) appendChange(fileMeta dbfs.FileMeta, history *lfHistory, db dbfs.DBFS) ([]dhClosure, error) {
+	// Changes that cannot be parsed are left for CBAppendFileChange to reject
+	if delta, err := patchSizeDelta(f.Changes); err == nil {
+		err = checkQuota(f.config(), fileMeta.ProjectID, fileMeta.Creator, delta, db)
+		if err == errQuotaExceeded {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusQuotaExceeded, f.Tag)}}, nil
+		} else if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+	}
+
 	// TODO (normal/optional): verify changes are valid changes
 	changes, version, missing, numchanges, err := db.CBAppendFileChange(fileMeta, f.Changes)
 	if err != nil {
-		if err == dbfs.ErrVersionOutOfDate {
-			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusVersionOutOfDate, f.Tag)}}, err
-		} else if err == dbfs.ErrResourceNotFound {
-			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	// The appended changes may have been transformed against concurrent ones, so they are what is counted
+	if delta, err := patchSizeDelta(changes); err == nil {
+		err = db.MySQLFileAddSize(f.FileID, delta)
+		utils.LogError("Failed to record file size", err, utils.LogFields{
+			"FileID": f.FileID,
+		})
+	}
+
+	// The notification carries the stored patch; only the sender's response is converted back
+	resChanges, resMissing, resLineEndings := changes, missing, ""
+	if history != nil {
+		resChanges, resMissing, err = history.changeToCRLF(changes, missing)
+		if err != nil {
+			utils.LogError("Failed to convert patches to CRLF", err, utils.LogFields{
+				"FileID": f.FileID,
+			})
+			resChanges, resMissing = changes, missing
+		} else {
+			resLineEndings = lineEndingsCRLF
 		}
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
 	res := messages.Response{
 		Status: messages.StatusSuccess,
 		Tag:    f.Tag,
-		Data: struct {
-			FileVersion    int64
-			Changes        string
-			MissingPatches []string
-		}{
+		Data: fileChangeResponse{
 			FileVersion:    version,
-			Changes:        changes,
-			MissingPatches: missing,
+			Changes:        resChanges,
+			MissingPatches: resMissing,
+			LineEndings:    resLineEndings,
 		},
 	}.Wrap()
 	not := messages.Notification{
@@ -349,19 +573,29 @@ func (f fileChangeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		},
 	}.Wrap()
 
-	// Trigger scrunching if longer than maxBufferLength
-	if numchanges > dbfs.MaxBufferLength {
+	recordGitExportChange(f.FileID, f.SenderID)
+
+	// Trigger scrunching if longer than maxBufferLength. It outlives the request, so isn't abandoned with it.
+	if numchanges > dbfs.MaxBufferLength() {
+		db := db.WithContext(context.Background())
 		go func() {
-			db.ScrunchFile(fileMeta)
+			reanchorFileComments(fileMeta, db)
+			if err := db.ScrunchFile(fileMeta); err == nil && scanScrunchedFile(f.config(), fileMeta, f.SenderID, db) {
+				exportScrunchedFile(fileMeta, db)
+			}
 		}()
 	}
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(fileMeta.ProjectID)}}, nil
+	scheduleFileIndex(f.config(), f.FileID, db)
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(fileMeta.ProjectID, f.FileID, not)}, nil
 }
 
 // File.Pull
 type filePullRequest struct {
-	FileID int64
+	FileID      int64  `validate:"required"`
+	LineEndings string `validate:"omitempty,oneof=LF CRLF"` // The client's line endings; see lineendings.go
+	Materialize bool   // Return the file's text with the changes applied, instead of its contents and the changes
 	abstractRequest
 }
 
@@ -371,11 +605,122 @@ func (f *filePullRequest) setAbstractRequest(req *abstractRequest) {
 
 func (f filePullRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	rawFile, changes, err := db.PullFile(fileMeta)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	// Pulls are still answered without the hash, which the client only needs to validate its cache
+	hash, err := pulledContentHash(fileMeta, *rawFile, changes, db)
+	if err != nil {
+		utils.LogError("Failed to compute content hash", err, utils.LogFields{
+			"FileID": f.FileID,
+		})
+	}
+
+	fileBytes, lineEndings := *rawFile, ""
+	if f.LineEndings == lineEndingsCRLF {
+		normalized, err := normalizesLineEndings(fileMeta.ProjectID, db)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+		var history *lfHistory
+		if normalized {
+			history, err = newLFHistory(fileBytes, changes)
+			if err != nil {
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+			}
+		}
+		if history != nil {
+			if changes, err = history.allToCRLF(changes); err != nil {
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+			}
+			fileBytes, lineEndings = []byte(toCRLF(history.text)), lineEndingsCRLF
+		}
+	}
+
+	// Thin clients would rather not replay the changes themselves, so they are applied here; the changes converted to
+	// CRLF apply to the converted contents as well
+	version := hash.Version
+	if f.Materialize {
+		patches, err := patching.GetPatches(changes)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+		text, err := patching.PatchText(string(fileBytes), patches)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+		if version, err = pulledVersion(fileMeta, patches, db); err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+		}
+		fileBytes, changes = []byte(text), []string{}
+	}
+
+	authorship, err := describeAuthorship(changes, db)
 	if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
-	hasPermission, err := dbfs.PermissionAtLeast(f.SenderID, fileMeta.ProjectID, "read", db)
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			FileBytes   []byte
+			Changes     []string
+			Authorship  []patchAuthorship // The metadata of each of Changes
+			LineEndings string            // CRLF if FileBytes and Changes were converted to the client's CRLF
+			Version     int64             // The version once Changes are applied; 0 if not materialized and without a ContentHash
+			ContentHash string            // The SHA-256 of the file's text at Version, as stored; see contenthash.go
+		}{
+			FileBytes:   fileBytes,
+			Changes:     changes,
+			Authorship:  authorship,
+			LineEndings: lineEndings,
+			Version:     version,
+			ContentHash: hash.Hash,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// File.GetHistory
+type fileGetHistoryRequest struct {
+	FileID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (f *fileGetHistoryRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileGetHistoryRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  f.Resource,
@@ -386,20 +731,352 @@ func (f filePullRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
 	}
 
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	// Only the patches since the file was last scrunched are kept
+	changes, _, version, _, err := db.PullChanges(fileMeta)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	authorship, err := describeAuthorship(changes, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			FileVersion int64
+			Changes     []string
+			Authorship  []patchAuthorship // The metadata of each of Changes
+		}{
+			FileVersion: version,
+			Changes:     changes,
+			Authorship:  authorship,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// File.Annotate
+type fileAnnotateRequest struct {
+	FileID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (f *fileAnnotateRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileAnnotateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	rawFile, changes, err := db.PullFile(fileMeta)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	lines, err := annotateLines(*rawFile, changes, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			Lines []patchAuthorship // The patch that last changed each line, in order
+		}{
+			Lines: lines,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// File.Diff
+type fileDiffRequest struct {
+	FileID      int64  `validate:"required"`
+	FromVersion int64  `validate:"required"`
+	ToVersion   int64  `validate:"min=0"`                   // 0 for the file's current version
+	LineEndings string `validate:"omitempty,oneof=LF CRLF"` // The client's line endings; see lineendings.go
+	abstractRequest
+}
+
+func (f *fileDiffRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileDiffRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
 	rawFile, changes, err := db.PullFile(fileMeta)
 	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	version, err := db.CBGetFileVersion(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	toVersion := f.ToVersion
+	if toVersion == 0 {
+		toVersion = version
+	}
+	patch, err := diffVersions(*rawFile, changes, version, f.FromVersion, toVersion)
+	if err == errBaseVersionUnavailable {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusVersionOutOfDate, f.Tag)}}, nil
+	} else if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
+	diff, lineEndings := patch.String(), ""
+	if f.LineEndings == lineEndingsCRLF {
+		normalized, err := normalizesLineEndings(fileMeta.ProjectID, db)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		}
+		var history *lfHistory
+		if normalized {
+			history, err = newLFHistory(*rawFile, changes)
+			if err != nil {
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+			}
+		}
+		if history != nil {
+			if diff, err = history.toCRLF(diff); err != nil {
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+			}
+			lineEndings = lineEndingsCRLF
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			FromVersion int64
+			ToVersion   int64
+			Changes     string
+			LineEndings string // CRLF if Changes was converted to the client's CRLF
+		}{
+			FromVersion: f.FromVersion,
+			ToVersion:   toVersion,
+			Changes:     diff,
+			LineEndings: lineEndings,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// File.Search
+type fileSearchRequest struct {
+	FileID     int64  `validate:"required"`
+	Query      string `validate:"required"`
+	MaxResults int    `validate:"min=0"`
+	abstractRequest
+}
+
+func (f *fileSearchRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileSearchRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	return searchResponse(search.Query{
+		ProjectID:  fileMeta.ProjectID,
+		FileID:     f.FileID,
+		Text:       f.Query,
+		MaxResults: f.MaxResults,
+	}, f.config(), f.Tag, db)
+}
+
+// Limits on client-defined file metadata; keys and values are limited by the MySQL schema
+const (
+	maxFileMetadataKeys        = 50
+	maxFileMetadataKeyLength   = 64
+	maxFileMetadataValueLength = 1024
+)
+
+var errInvalidFileMetadata = errors.New("File metadata keys must be 1 to 64 characters, values at most 1024 characters, and files may have at most 50 keys")
+
+// File.SetMetadata
+type fileSetMetadataRequest struct {
+	FileID   int64             `validate:"required"`
+	Metadata map[string]string `validate:"required"` // Keys to set; keys with empty values are removed
+	abstractRequest
+}
+
+func (f *fileSetMetadataRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileSetMetadataRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityEditFiles, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(fileMeta.ProjectID, f.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	current, err := db.MySQLFileGetMetadata(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	if !validFileMetadata(current, f.Metadata) {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, errInvalidFileMetadata
+	}
+
+	err = db.MySQLFileSetMetadata(f.FileID, f.Metadata)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)
+	not := messages.Notification{
+		Resource:   f.Resource,
+		Method:     f.Method,
+		ResourceID: f.FileID,
+		Data: struct {
+			Metadata map[string]string
+		}{
+			Metadata: f.Metadata,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(fileMeta.ProjectID, f.FileID, not)}, nil
+}
+
+// validFileMetadata checks the keys and values being set, and that the file will not have too many keys afterwards.
+func validFileMetadata(current map[string]string, changes map[string]string) bool {
+	if len(changes) == 0 {
+		return false
+	}
+
+	numKeys := len(current)
+	for key, value := range changes {
+		keyLength := utf8.RuneCountInString(key)
+		if keyLength == 0 || keyLength > maxFileMetadataKeyLength || utf8.RuneCountInString(value) > maxFileMetadataValueLength {
+			return false
+		}
+
+		_, exists := current[key]
+		if value == "" && exists {
+			numKeys--
+		} else if value != "" && !exists {
+			numKeys++
+		}
+	}
+	return numKeys <= maxFileMetadataKeys
+}
+
+// File.GetMetadata
+type fileGetMetadataRequest struct {
+	FileID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (f *fileGetMetadataRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f fileGetMetadataRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	fileMeta, err := db.MySQLFileGetInfo(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(f.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  f.Resource,
+			"Method":    f.Method,
+			"SenderID":  f.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+	}
+
+	metadata, err := db.MySQLFileGetMetadata(f.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
 	res := messages.Response{
 		Status: messages.StatusSuccess,
 		Tag:    f.Tag,
 		Data: struct {
-			FileBytes []byte
-			Changes   []string
+			Metadata map[string]string
 		}{
-			FileBytes: *rawFile,
-			Changes:   changes,
+			Metadata: metadata,
 		},
 	}.Wrap()
 
@@ -3,11 +3,14 @@ package datahandling
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var geneMeta = dbfs.UserMeta{
@@ -42,7 +45,7 @@ func TestFileCreateRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 9, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -60,7 +63,7 @@ func TestFileCreateRequest_Process(t *testing.T) {
 	// is the data actually correct
 	FileID := reflect.ValueOf(resp.Data).FieldByName("FileID").Interface().(int64)
 
-	if closure.key != fmt.Sprintf("Project-%d", projectid) {
+	if closure.key != fmt.Sprintf("Project-%d.Project.File.Create", projectid) {
 		t.Fatal("notification sent to wrong channel")
 	}
 
@@ -93,7 +96,7 @@ func TestFileRenameRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 6, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -109,7 +112,7 @@ func TestFileRenameRequest_Process(t *testing.T) {
 		t.Fatalf("Process function responded with status: %d", resp.Status)
 	}
 
-	if closure.key != fmt.Sprintf("Project-%d", projectid) {
+	if closure.key != fmt.Sprintf("Project-%d.File-%d.File.%s", projectid, req.FileID, req.Method) {
 		t.Fatal("notification sent to wrong channel")
 	}
 
@@ -150,7 +153,7 @@ func TestFileMoveRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 6, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -166,7 +169,7 @@ func TestFileMoveRequest_Process(t *testing.T) {
 		t.Fatalf("Process function responded with status: %d", resp.Status)
 	}
 
-	if closure.key != fmt.Sprintf("Project-%d", projectid) {
+	if closure.key != fmt.Sprintf("Project-%d.File-%d.File.%s", projectid, req.FileID, req.Method) {
 		t.Fatal("notification sent to wrong channel")
 	}
 
@@ -184,6 +187,55 @@ func TestFileMoveRequest_Process(t *testing.T) {
 
 }
 
+func TestFileMoveAndRename_Collision(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectid, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileid, _ := db.MySQLFileCreate("loganga", "main.go", "src", projectid)
+	otherid, _ := db.MySQLFileCreate("loganga", "main.go", "cmd", projectid)
+	db.MySQLFileCreate("loganga", "util.go", "src", projectid)
+
+	respond := func(req request) messages.Response {
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+	move := func(newPath string) messages.Response {
+		req := fileMoveRequest{FileID: fileid, NewPath: newPath}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Move"
+		return respond(&req)
+	}
+	rename := func(newName string) messages.Response {
+		req := fileRenameRequest{FileID: fileid, NewName: newName}
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Rename"
+		return respond(&req)
+	}
+
+	res := move("cmd/")
+	assert.Equal(t, messages.StatusConflict, res.Status)
+	assert.Equal(t, otherid, reflect.ValueOf(res.Data).FieldByName("FileID").Int())
+
+	res = rename("util.go")
+	assert.Equal(t, messages.StatusConflict, res.Status)
+
+	// The file itself is not a collision
+	assert.Equal(t, messages.StatusSuccess, move("src").Status)
+	assert.Equal(t, messages.StatusSuccess, rename("main.go").Status)
+
+	// Neither file was changed by the rejected requests
+	file, _ := db.MySQLFileGetInfo(fileid)
+	assert.Equal(t, "src", file.RelativePath)
+	assert.Equal(t, "main.go", file.Filename)
+
+	assert.Equal(t, messages.StatusSuccess, move("lib").Status)
+	assert.Equal(t, messages.StatusSuccess, rename("lib.go").Status)
+}
+
 func TestFileDeleteRequest_Process(t *testing.T) {
 	configSetup(t)
 	req := *new(fileDeleteRequest)
@@ -206,7 +258,7 @@ func TestFileDeleteRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 5, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 6, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -222,7 +274,7 @@ func TestFileDeleteRequest_Process(t *testing.T) {
 		t.Fatalf("Process function responded with status: %d", resp.Status)
 	}
 
-	if closure.key != fmt.Sprintf("Project-%d", projectid) {
+	if closure.key != fmt.Sprintf("Project-%d.File-%d.File.%s", projectid, req.FileID, req.Method) {
 		t.Fatal("notification sent to wrong channel")
 	}
 
@@ -231,8 +283,10 @@ func TestFileDeleteRequest_Process(t *testing.T) {
 		t.Fatal("wrong FileID recieved in notification")
 	}
 
-	if _, ok := db.Files[fileid]; ok {
-		t.Fatal("File still exists")
+	for _, file := range db.Files[projectid] {
+		if file.FileID == fileid {
+			t.Fatal("File still exists")
+		}
 	}
 
 }
@@ -262,7 +316,7 @@ func TestFileChangeRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 3, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 6, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -278,7 +332,7 @@ func TestFileChangeRequest_Process(t *testing.T) {
 		t.Fatalf("Process function responded with status: %d", resp.Status)
 	}
 
-	if closure.key != fmt.Sprintf("Project-%d", projectid) {
+	if closure.key != fmt.Sprintf("Project-%d.File-%d.File.%s", projectid, req.FileID, req.Method) {
 		t.Fatal("notification sent to wrong channel")
 	}
 
@@ -288,7 +342,7 @@ func TestFileChangeRequest_Process(t *testing.T) {
 	}
 
 	changes := reflect.ValueOf(closure.msg.ServerMessage.(messages.Notification).Data).FieldByName("Changes").Interface().(string)
-	if changes != req.Changes {
+	if withoutAuthorship(t, changes) != req.Changes {
 		t.Fatal("wrong changes recieved in notification")
 	}
 
@@ -312,7 +366,7 @@ func TestFileChangeRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 3, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 5, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 1 ||
@@ -328,6 +382,40 @@ func TestFileChangeRequest_Process(t *testing.T) {
 
 }
 
+// BenchmarkFileChangeRequest_Process measures the server's handling of a change, apart from the database
+func BenchmarkFileChangeRequest_Process(b *testing.B) {
+	configSetup(b)
+	req := *new(fileChangeRequest)
+	setBaseFields(&req)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectid, err := db.MySQLProjectCreate("loganga", "hi")
+	require.NoError(b, err)
+	fileid, err := db.MySQLFileCreate("loganga", "new file", "", projectid)
+	require.NoError(b, err)
+	db.CBInsertNewFile(fileid, newFileVersion, []string{})
+
+	req.Resource = "File"
+	req.Method = "Change"
+	req.FileID = fileid
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Changes are kept from reaching the length that starts a scrunch, which would race with the next change
+		if len(db.FileChanges[fileid]) >= dbfs.MaxBufferLength() {
+			b.StopTimer()
+			db.FileChanges[fileid] = nil
+			b.StartTimer()
+		}
+
+		req.Changes = fmt.Sprintf("v%d:\n0:+1:a:\n%d", db.FileVersion[fileid], i)
+		if _, err := req.process(db); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestFilePullRequest_Process(t *testing.T) {
 	configSetup(t)
 	req := *new(filePullRequest)
@@ -354,7 +442,7 @@ func TestFilePullRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	if db.FunctionCallCount != 3 {
+	if db.FunctionCallCount != 6 {
 		t.Fatal("did not call correct number of db functions")
 	}
 
@@ -375,4 +463,147 @@ func TestFilePullRequest_Process(t *testing.T) {
 	if changes != fileChanges[0] {
 		t.Fatalf("wrong file changes, expected: %v, got: %v", changes, fileChanges)
 	}
+	if hash := reflect.ValueOf(resp.Data).FieldByName("ContentHash").String(); hash != contentHash("a") {
+		t.Fatalf("wrong content hash, expected the hash of the patched text, got: %v", hash)
+	}
+}
+
+func TestFilePullRequest_Materialize(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", ".", projectID)
+	db.FileWrite(".", "file", projectID, []byte("one\ntwo\n"))
+	db.FileVersion[fileID] = 5
+	db.FileChanges[fileID] = []string{"v3:\n0:+1:x:\n8", "v4:\n5:-3:two:\n9"}
+
+	pull := filePullRequest{FileID: fileID, Materialize: true}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	res, _ := processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := reflect.ValueOf(res.Data)
+	assert.Equal(t, "xone\n\n", string(data.FieldByName("FileBytes").Bytes()))
+	assert.Empty(t, data.FieldByName("Changes").Interface())
+	assert.Empty(t, data.FieldByName("Authorship").Interface())
+	assert.EqualValues(t, 5, data.FieldByName("Version").Int())
+	assert.Equal(t, contentHash("xone\n\n"), data.FieldByName("ContentHash").String())
+
+	// Without changes, the contents are the text, at the file's version
+	db.FileChanges[fileID] = nil
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data = reflect.ValueOf(res.Data)
+	assert.Equal(t, "one\ntwo\n", string(data.FieldByName("FileBytes").Bytes()))
+	assert.EqualValues(t, 5, data.FieldByName("Version").Int())
+}
+
+func TestFileMetadataRequests_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "hi")
+	fileID, _ := db.MySQLFileCreate(geneMeta.Username, "new file", "", projectID)
+
+	setReq := fileSetMetadataRequest{
+		FileID:   fileID,
+		Metadata: map[string]string{"language": "go", "encoding": "utf-8"},
+	}
+	setBaseFields(&setReq)
+	setReq.Resource = "File"
+	setReq.Method = "SetMetadata"
+
+	closures, err := setReq.process(db)
+	assert.NoError(t, err)
+	assert.Len(t, closures, 2)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status)
+	not := closures[1].(toRabbitChannelClosure)
+	assert.Equal(t, rabbitmq.RabbitProjectRoutingKey(projectID, setReq.FileID, "File", "SetMetadata"), not.key, "changes should be broadcast to the project")
+	assert.Equal(t, setReq.Metadata, reflect.ValueOf(not.msg.ServerMessage.(messages.Notification).Data).FieldByName("Metadata").Interface())
+
+	setReq.Metadata = map[string]string{"encoding": ""}
+	closures, err = setReq.process(db)
+	assert.NoError(t, err)
+
+	getReq := fileGetMetadataRequest{FileID: fileID}
+	setBaseFields(&getReq)
+	closures, err = getReq.process(db)
+	assert.NoError(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status)
+	assert.Equal(t, map[string]string{"language": "go"}, reflect.ValueOf(resp.Data).FieldByName("Metadata").Interface())
+
+	setReq.Metadata = map[string]string{"": "no key"}
+	closures, err = setReq.process(db)
+	assert.Equal(t, errInvalidFileMetadata, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status)
+
+	getReq.SenderID = "notloganga"
+	closures, _ = getReq.process(db)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status)
+}
+
+func TestValidFileMetadata(t *testing.T) {
+	full := make(map[string]string)
+	for i := 0; i < maxFileMetadataKeys; i++ {
+		full[fmt.Sprintf("key%d", i)] = "value"
+	}
+
+	assert.True(t, validFileMetadata(nil, map[string]string{"language": "go"}))
+	assert.False(t, validFileMetadata(nil, map[string]string{}), "there should be something to set")
+	assert.False(t, validFileMetadata(nil, map[string]string{strings.Repeat("k", maxFileMetadataKeyLength+1): "go"}))
+	assert.False(t, validFileMetadata(nil, map[string]string{"language": strings.Repeat("v", maxFileMetadataValueLength+1)}))
+	assert.False(t, validFileMetadata(full, map[string]string{"language": "go"}), "files should have a limited number of keys")
+	assert.True(t, validFileMetadata(full, map[string]string{"key0": "", "language": "go"}), "removed keys should make room")
+	assert.True(t, validFileMetadata(full, map[string]string{"key0": "changed"}))
+}
+
+func TestFileRequests_DatabaseFaults(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	create := new(fileCreateRequest)
+	setBaseFields(create)
+	create.Resource = "File"
+	create.Method = "Create"
+	create.Name = "new file"
+	create.RelativePath = "."
+	create.ProjectID = projectID
+	create.FileBytes = []byte("hello")
+
+	db.FailCall("FileWrite", 1, nil)
+	closures, err := create.process(db)
+	assert.Equal(t, dbfs.ErrInjectedFault, err)
+	// Injected faults stand in for an unreachable database, so the client is told to try again
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusServFail, resp.Status)
+	assert.True(t, reflect.ValueOf(resp.Data).FieldByName("Retryable").Bool())
+
+	_, err = create.process(db)
+	require.NoError(t, err)
+	fileID := db.FileIDCounter
+
+	change := new(fileChangeRequest)
+	setBaseFields(change)
+	change.Resource = "File"
+	change.Method = "Change"
+	change.FileID = fileID
+	change.Changes = "v1:\n0:+1:a:\n5"
+
+	// A client that loses the race with another's change is told to catch up
+	db.ConflictFileChanges(fileID, 1)
+	closures, err = change.process(db)
+	assert.Equal(t, dbfs.ErrVersionOutOfDate, err)
+	assert.Equal(t, messages.StatusVersionOutOfDate, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	closures, err = change.process(db)
+	require.NoError(t, err)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
 }
@@ -0,0 +1,238 @@
+package datahandling
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Exports file contents to Git, either as each file is scrunched, or as periodic snapshots of the files changed since
+ * the last one. The users that changed a file since its last export are credited as the commit's authors.
+ */
+
+var gitExport struct {
+	mutex    sync.Mutex
+	repo     *gitexport.Repository
+	snapshot bool
+	changes  map[int64]map[string]int // The number of changes each user has made to each file since its last export
+	paths    map[int64]string         // The path each file was last exported to
+}
+
+// EnableGitExport starts exporting file contents to the repository. In snapshot mode, changed files are exported every
+// interval, until control is shut down; otherwise, each file is exported when it is scrunched.
+func EnableGitExport(repo *gitexport.Repository, snapshotInterval time.Duration, db dbfs.DBFS, control *utils.Control) {
+	gitExport.mutex.Lock()
+	gitExport.repo = repo
+	gitExport.snapshot = snapshotInterval > 0
+	gitExport.changes = make(map[int64]map[string]int)
+	gitExport.paths = make(map[int64]string)
+	gitExport.mutex.Unlock()
+
+	if snapshotInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-control.Exit:
+				return
+			case <-ticker.C:
+				err := exportGitSnapshot(db)
+				utils.LogError("Failed to export snapshot to Git", err, nil)
+			}
+		}
+	}()
+}
+
+// recordGitExportChange notes that the user changed the file, so that they are credited when it is next exported
+func recordGitExportChange(fileID int64, username string) {
+	gitExport.mutex.Lock()
+	defer gitExport.mutex.Unlock()
+
+	if gitExport.repo == nil {
+		return
+	}
+	if gitExport.changes[fileID] == nil {
+		gitExport.changes[fileID] = make(map[string]int)
+	}
+	gitExport.changes[fileID][username]++
+}
+
+// exportScrunchedFile exports the file after it has been scrunched, unless exporting snapshots
+func exportScrunchedFile(meta dbfs.FileMeta, db dbfs.DBFS) {
+	gitExport.mutex.Lock()
+	enabled := gitExport.repo != nil && !gitExport.snapshot
+	gitExport.mutex.Unlock()
+	if !enabled {
+		return
+	}
+
+	err := exportToGit([]int64{meta.FileID}, fmt.Sprintf("Scrunch %s", path.Join(meta.RelativePath, meta.Filename)), db)
+	utils.LogError("Failed to export scrunched file to Git", err, utils.LogFields{
+		"FileID": meta.FileID,
+	})
+}
+
+// exportGitSnapshot exports every file changed since the last snapshot
+func exportGitSnapshot(db dbfs.DBFS) error {
+	gitExport.mutex.Lock()
+	fileIDs := make([]int64, 0, len(gitExport.changes))
+	for fileID := range gitExport.changes {
+		fileIDs = append(fileIDs, fileID)
+	}
+	gitExport.mutex.Unlock()
+	if len(fileIDs) == 0 {
+		return nil
+	}
+
+	return exportToGit(fileIDs, fmt.Sprintf("Snapshot of %d changed files", len(fileIDs)), db)
+}
+
+// exportBeforeArchiving exports the files' changes that have yet to be, since archived files can't be read
+func exportBeforeArchiving(files []dbfs.FileMeta, db dbfs.DBFS) {
+	gitExport.mutex.Lock()
+	fileIDs := []int64{}
+	if gitExport.repo != nil {
+		for _, file := range files {
+			if _, changed := gitExport.changes[file.FileID]; changed {
+				fileIDs = append(fileIDs, file.FileID)
+			}
+		}
+	}
+	gitExport.mutex.Unlock()
+	if len(fileIDs) == 0 {
+		return
+	}
+
+	err := exportToGit(fileIDs, fmt.Sprintf("Archive %d changed files", len(fileIDs)), db)
+	utils.LogError("Failed to export files to Git before archiving them", err, nil)
+}
+
+// exportToGit commits the current contents of the files. Files that no longer exist, or have since been archived,
+// are skipped.
+func exportToGit(fileIDs []int64, message string, db dbfs.DBFS) error {
+	gitExport.mutex.Lock()
+	repo := gitExport.repo
+	changes := make(map[int64]map[string]int)
+	for _, fileID := range fileIDs {
+		changes[fileID] = gitExport.changes[fileID]
+		delete(gitExport.changes, fileID)
+	}
+	gitExport.mutex.Unlock()
+
+	commit := gitexport.Commit{Message: message}
+	paths := make(map[int64]string)
+	changeCounts := make(map[string]int)
+	for _, fileID := range fileIDs {
+		meta, err := db.MySQLFileGetInfo(fileID)
+		if err != nil {
+			continue
+		}
+		rawFile, fileChanges, err := db.PullFile(meta)
+		if err != nil {
+			if state, stateErr := db.MySQLProjectGetArchiveState(meta.ProjectID); stateErr == nil && state != "" {
+				continue
+			}
+			restoreGitExportChanges(changes)
+			return err
+		}
+		content := string(*rawFile)
+		if len(fileChanges) > 0 {
+			content, err = patching.PatchTextFromString(content, fileChanges)
+			if err != nil {
+				restoreGitExportChanges(changes)
+				return err
+			}
+		}
+
+		paths[fileID] = path.Join(strconv.FormatInt(meta.ProjectID, 10), meta.RelativePath, meta.Filename)
+		commit.Files = append(commit.Files, gitexport.File{Path: paths[fileID], Content: []byte(content)})
+		for username, count := range changes[fileID] {
+			changeCounts[username] += count
+		}
+	}
+
+	// Files that were moved or renamed since their last export are removed from their old paths
+	gitExport.mutex.Lock()
+	for fileID, newPath := range paths {
+		if oldPath, ok := gitExport.paths[fileID]; ok && oldPath != newPath {
+			commit.Removed = append(commit.Removed, oldPath)
+		}
+	}
+	gitExport.mutex.Unlock()
+
+	commit.Authors = gitAuthors(changeCounts, db)
+	err := repo.Commit(commit)
+	if _, pushFailed := err.(gitexport.PushError); err != nil && !pushFailed {
+		restoreGitExportChanges(changes)
+		return err
+	}
+
+	gitExport.mutex.Lock()
+	for fileID, newPath := range paths {
+		gitExport.paths[fileID] = newPath
+	}
+	gitExport.mutex.Unlock()
+	return err
+}
+
+// restoreGitExportChanges keeps crediting the users of an export that failed, for the next attempt
+func restoreGitExportChanges(changes map[int64]map[string]int) {
+	gitExport.mutex.Lock()
+	defer gitExport.mutex.Unlock()
+
+	for fileID, counts := range changes {
+		if gitExport.changes[fileID] == nil {
+			gitExport.changes[fileID] = make(map[string]int)
+		}
+		for username, count := range counts {
+			gitExport.changes[fileID][username] += count
+		}
+	}
+}
+
+// gitAuthors returns the users that made the changes, most changes first. Changes made under a username the user
+// has since changed from are counted under their current one.
+func gitAuthors(counts map[string]int, db dbfs.DBFS) []gitexport.Author {
+	changeCounts := make(map[string]int, len(counts))
+	for username, count := range counts {
+		changeCounts[usernameAliases.resolve(username, db)] += count
+	}
+
+	usernames := make([]string, 0, len(changeCounts))
+	for username := range changeCounts {
+		usernames = append(usernames, username)
+	}
+	sort.Slice(usernames, func(i, j int) bool {
+		if changeCounts[usernames[i]] != changeCounts[usernames[j]] {
+			return changeCounts[usernames[i]] > changeCounts[usernames[j]]
+		}
+		return usernames[i] < usernames[j]
+	})
+
+	authors := make([]gitexport.Author, len(usernames))
+	for i, username := range usernames {
+		authors[i] = gitexport.Author{Name: username}
+		user, err := db.MySQLUserLookup(username)
+		if err != nil {
+			continue
+		}
+		if name := strings.TrimSpace(user.FirstName + " " + user.LastName); name != "" {
+			authors[i].Name = name
+		}
+		authors[i].Email = user.Email
+	}
+	return authors
+}
@@ -0,0 +1,67 @@
+package datahandling
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportToGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmpDir, err := ioutil.TempDir("", "gitexport")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	remote := filepath.Join(tmpDir, "remote.git")
+	require.NoError(t, exec.Command("git", "init", "--bare", "--quiet", remote).Run())
+
+	repo, err := gitexport.Open(config.GitExportCfg{Remote: remote, WorkDir: filepath.Join(tmpDir, "clone")})
+	require.NoError(t, err)
+	db := dbfs.NewDBMock()
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	EnableGitExport(repo, 0, db, control)
+	defer func() {
+		gitExport.mutex.Lock()
+		gitExport.repo = nil
+		gitExport.mutex.Unlock()
+	}()
+
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "exported")
+	fileID, _ := db.MySQLFileCreate(geneMeta.Username, "file.txt", "src", projectID)
+	db.FileWrite("src", "file.txt", projectID, []byte("helloworld"))
+	db.CBAppendFileChange(dbfs.FileMeta{FileID: fileID}, "v0:\n0:+1:a:\n10")
+
+	recordGitExportChange(fileID, notGeneMeta.Username)
+	recordGitExportChange(fileID, geneMeta.Username)
+	recordGitExportChange(fileID, geneMeta.Username)
+	meta, _ := db.MySQLFileGetInfo(fileID)
+	exportScrunchedFile(meta, db)
+
+	show := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = remote
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+	assert.Equal(t, "ahelloworld", show("show", "master:"+strconv.FormatInt(projectID, 10)+"/src/file.txt"))
+	// The user with the most changes is the author
+	assert.Equal(t, geneMeta.Email, show("log", "-1", "--format=%ae", "master"))
+	assert.Contains(t, show("log", "-1", "--format=%B", "master"), "Co-authored-by: ")
+	assert.Empty(t, gitExport.changes, "exported changes should no longer be credited")
+}
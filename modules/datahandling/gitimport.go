@@ -0,0 +1,302 @@
+package datahandling
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Project.ImportFromGit seeds a project with the files of a Git repository. The repository is cloned once the request
+ * has been answered; the import's progress is sent to the project's subscribers as Project.ImportFromGit notifications.
+ */
+
+// maxGitImportFiles is the most files a single import creates
+const maxGitImportFiles = 5000
+
+// maxGitImportFileSize is the size of the largest file imported; larger files are skipped
+const maxGitImportFileSize = 1 << 20
+
+// gitImportProgressInterval is the number of files imported between progress notifications
+const gitImportProgressInterval = 100
+
+// gitImportTimeout is how long cloning the repository may take
+var gitImportTimeout = 5 * time.Minute
+
+// Stages of an import, as reported in its notifications
+const (
+	gitImportCloning   = "Cloning"
+	gitImportImporting = "Importing"
+	gitImportDone      = "Done"
+	gitImportFailed    = "Failed"
+)
+
+// Project.ImportFromGit
+type projectImportFromGitRequest struct {
+	ProjectID int64  `validate:"required"`
+	URL       string `validate:"required"`
+	Branch    string // Optional; defaults to the repository's default branch
+	abstractRequest
+}
+
+func (p *projectImportFromGitRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectImportFromGitRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityEditFiles, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+	if res, err := archivedResponse(p.ProjectID, p.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+	if p.URL == "" {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, nil
+	}
+
+	// The response only confirms that the import has started
+	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
+	return []dhClosure{toSenderClosure{msg: res}, gitImportClosure{request: p}}, nil
+}
+
+// gitImportProgress is the Data of Project.ImportFromGit notifications
+type gitImportProgress struct {
+	URL           string
+	Stage         string
+	FilesImported int
+	FilesSkipped  int // Files that were too large, not text, not allowed by the file policy, ignored, quarantined, or already in the project. Files in ignored directories are not counted.
+}
+
+type gitImportClosure struct {
+	request projectImportFromGitRequest
+}
+
+// gitImportClosure.call clones the repository and creates its files, notifying the project's subscribers of its
+// progress. It runs in the request's handler, which keeps the connection's publisher open until the import finishes.
+func (cont gitImportClosure) call(dh DataHandler) error {
+	p := cont.request
+	progress := gitImportProgress{URL: p.URL, Stage: gitImportCloning}
+	notify := func() {
+		not := messages.Notification{
+			Resource:   p.Resource,
+			Method:     p.Method,
+			ResourceID: p.ProjectID,
+			Data:       progress,
+		}.Wrap()
+		// The importer is sent its progress too, since its response only says that the import has started
+		closure := projectNotificationClosure(p.ProjectID, 0, not)
+		closure.includeSender = true
+		err := closure.call(dh)
+		utils.LogError("Failed to send import progress", err, utils.LogFields{
+			"ProjectID": p.ProjectID,
+		})
+	}
+	notify()
+
+	err := importFromGit(p, dh.Db, &progress, notify)
+	if err != nil {
+		progress.Stage = gitImportFailed
+	} else {
+		progress.Stage = gitImportDone
+	}
+	notify()
+	return err
+}
+
+// importFromGit clones the repository into a temporary directory, and creates a file in the project for each of its
+// text files
+func importFromGit(p projectImportFromGitRequest, db dbfs.DBFS, progress *gitImportProgress, notify func()) error {
+	tmpDir, err := ioutil.TempDir("", "gitimport")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+	cloneDir := filepath.Join(tmpDir, "repo")
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitImportTimeout)
+	defer cancel()
+	if err := gitexport.ShallowClone(ctx, p.URL, p.Branch, cloneDir); err != nil {
+		return err
+	}
+
+	// The repository's own .ccignore rules apply after the project's
+	rules, err := projectIgnoreRules(p.ProjectID, pathsCaseInsensitive(p.config()), db)
+	if err != nil {
+		return err
+	}
+	repoRules, err := readIgnoreFile(filepath.Join(cloneDir, ".ccignore"), pathsCaseInsensitive(p.config()))
+	if err != nil {
+		utils.LogError("Ignoring invalid .ccignore", err, utils.LogFields{
+			"ProjectID": p.ProjectID,
+			"URL":       p.URL,
+		})
+	}
+	rules = append(rules, repoRules...)
+
+	progress.Stage = gitImportImporting
+	notify()
+
+	// Files are created a batch at a time rather than one round-trip per file. A batch is created before the progress
+	// including it is sent, so that the files reported as imported can be opened.
+	var batch []dbfs.FileMeta
+	var contents [][]byte
+	var batchBytes int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		sizes := make([]int64, len(batch))
+		for i := range batch {
+			sizes[i] = int64(len(contents[i]))
+		}
+		fileIDs, err := db.MySQLFilesCreate(batch, sizes)
+		if err != nil {
+			return err
+		}
+		created := []int64{}
+		for i, fileID := range fileIDs {
+			if fileID == 0 {
+				utils.LogDebug("Skipped importing file already in the project", utils.LogFields{
+					"ProjectID":    p.ProjectID,
+					"RelativePath": batch[i].RelativePath,
+					"Filename":     batch[i].Filename,
+				})
+				progress.FilesSkipped++
+				continue
+			}
+			if _, err := db.FileWrite(batch[i].RelativePath, batch[i].Filename, p.ProjectID, contents[i]); err != nil {
+				return err
+			}
+			created = append(created, fileID)
+		}
+		if len(created) > 0 {
+			if err := db.CBInsertNewFiles(created, newFileVersion); err != nil {
+				return err
+			}
+		}
+		for _, fileID := range created {
+			scheduleFileIndex(p.config(), fileID, db)
+		}
+		progress.FilesImported += len(created)
+		batch, contents, batchBytes = batch[:0], contents[:0], 0
+		return nil
+	}
+
+	err = filepath.Walk(cloneDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if relPath, err := filepath.Rel(cloneDir, path); err == nil && relPath != "." {
+				if _, ignored := rules.matchDir(filepath.ToSlash(relPath)); ignored {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		}
+		// Symlinks and other special files are not imported
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if progress.FilesImported+len(batch) >= maxGitImportFiles {
+			progress.FilesSkipped++
+			return nil
+		}
+
+		relPath, err := filepath.Rel(cloneDir, path)
+		if err != nil {
+			return err
+		}
+		if _, ignored := rules.match(filepath.ToSlash(filepath.Dir(relPath)), filepath.Base(relPath)); ignored {
+			progress.FilesSkipped++
+			return nil
+		}
+		file, fileBytes, ok, err := readGitFile(p, db, path, relPath, info, batchBytes)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			progress.FilesSkipped++
+			return nil
+		}
+		batch = append(batch, file)
+		contents = append(contents, fileBytes)
+		batchBytes += int64(len(fileBytes))
+		if len(batch) == gitImportProgressInterval {
+			if err := flush(); err != nil {
+				return err
+			}
+			notify()
+		}
+		return nil
+	})
+	// Files already read are kept even if the import failed part way
+	if flushErr := flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// readGitFile reads and checks the file, returning false if it is to be skipped. pendingBytes is the size of the files
+// read but not yet created, which count towards the project's quota.
+func readGitFile(p projectImportFromGitRequest, db dbfs.DBFS, path string, relPath string, info os.FileInfo,
+	pendingBytes int64) (dbfs.FileMeta, []byte, bool, error) {
+	if info.Size() > maxGitImportFileSize {
+		return dbfs.FileMeta{}, nil, false, nil
+	}
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return dbfs.FileMeta{}, nil, false, err
+	}
+	if !utf8.Valid(fileBytes) {
+		return dbfs.FileMeta{}, nil, false, nil
+	}
+
+	relativePath := filepath.ToSlash(filepath.Dir(relPath))
+	if relativePath == "." {
+		relativePath = ""
+	}
+	filename := filepath.Base(relPath)
+
+	if checkFilePolicy(p.config(), relPath, fileBytes) != nil {
+		return dbfs.FileMeta{}, nil, false, nil
+	}
+	result, err := scanContent(p.config(), fileBytes)
+	if err != nil {
+		return dbfs.FileMeta{}, nil, false, err
+	}
+	if result.Infected {
+		quarantineFile(p.config(), p.ProjectID, filepath.ToSlash(relPath), fileBytes, result, p.SenderID, db)
+		return dbfs.FileMeta{}, nil, false, nil
+	}
+	if err := checkQuota(p.config(), p.ProjectID, p.SenderID, pendingBytes+int64(len(fileBytes)), db); err != nil {
+		return dbfs.FileMeta{}, nil, false, err
+	}
+
+	file := dbfs.FileMeta{
+		Creator:      p.SenderID,
+		ProjectID:    p.ProjectID,
+		RelativePath: relativePath,
+		Filename:     filename,
+	}
+	return file, fileBytes, true, nil
+}
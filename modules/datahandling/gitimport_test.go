@@ -0,0 +1,125 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGitRepo creates a repository with the given files committed, returning its file:// URL
+func newTestGitRepo(t *testing.T, dir string, files map[string][]byte) string {
+	for path, content := range files {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, ioutil.WriteFile(fullPath, content, 0644))
+	}
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "-A"},
+		{"-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return "file://" + filepath.ToSlash(dir)
+}
+
+func importNotifications(t *testing.T, messageChan chan rabbitmq.AMQPMessage) []gitImportProgress {
+	var progress []gitImportProgress
+	for len(messageChan) > 0 {
+		msg := <-messageChan
+		var not struct {
+			ServerMessage struct {
+				Method string
+				Data   gitImportProgress
+			}
+		}
+		require.NoError(t, json.Unmarshal(msg.Message, &not))
+		if not.ServerMessage.Method == "ImportFromGit" {
+			// The importer is sent its own progress
+			assert.Nil(t, msg.Headers["ExcludeOrigin"])
+			progress = append(progress, not.ServerMessage.Data)
+		}
+	}
+	return progress
+}
+
+func TestProjectImportFromGitRequest_Process(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	configSetup(t)
+	tmpDir, err := ioutil.TempDir("", "gitimport")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	repoURL := newTestGitRepo(t, tmpDir, map[string][]byte{
+		"README.md":   []byte("# Imported\n"),
+		"src/main.go": []byte("package main\n"),
+		"logo.png":    {0x89, 'P', 'N', 'G', 0xff, 0xfe},
+	})
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "imported")
+
+	req := *new(projectImportFromGitRequest)
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "ImportFromGit"
+	req.ProjectID = projectID
+	req.URL = repoURL
+
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	// Local repositories may not be imported by default
+	messageChan := make(chan rabbitmq.AMQPMessage, 16)
+	dh := DataHandler{MessageChan: messageChan, Db: db}
+	assert.Equal(t, gitexport.ErrProtocolNotAllowed, closures[1].call(dh))
+	progress := importNotifications(t, messageChan)
+	require.NotEmpty(t, progress)
+	assert.Equal(t, gitImportFailed, progress[len(progress)-1].Stage)
+
+	defer func(protocols []string) { gitexport.CloneProtocols = protocols }(gitexport.CloneProtocols)
+	gitexport.CloneProtocols = []string{"file"}
+	require.NoError(t, closures[1].call(dh))
+	progress = importNotifications(t, messageChan)
+	require.Len(t, progress, 3)
+	assert.Equal(t, []string{gitImportCloning, gitImportImporting, gitImportDone},
+		[]string{progress[0].Stage, progress[1].Stage, progress[2].Stage})
+	// The binary file is skipped
+	assert.Equal(t, 2, progress[2].FilesImported)
+	assert.Equal(t, 1, progress[2].FilesSkipped)
+
+	files, err := db.MySQLProjectGetFiles(projectID)
+	require.NoError(t, err)
+	paths := map[string]bool{}
+	for _, file := range files {
+		paths[filepath.Join(file.RelativePath, file.Filename)] = true
+		assert.Equal(t, newFileVersion, db.FileVersion[file.FileID], "every imported file needs a document")
+	}
+	assert.Equal(t, map[string]bool{"README.md": true, "src/main.go": true}, paths)
+
+	// Files already in the project are skipped
+	require.NoError(t, closures[1].call(dh))
+	progress = importNotifications(t, messageChan)
+	assert.Equal(t, 0, progress[len(progress)-1].FilesImported)
+	assert.Equal(t, 3, progress[len(progress)-1].FilesSkipped)
+	files, err = db.MySQLProjectGetFiles(projectID)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+}
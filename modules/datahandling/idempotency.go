@@ -0,0 +1,176 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Requests that create something, or change a file, may carry an IdempotencyKey. The first request with a key
+ * reserves it, and its outcome is recorded. Later requests from the same user with the same key are answered with
+ * that outcome instead of being processed again, or told that it is still being processed, so that they can be retried
+ * later. This lets a client retry a request after its connection drops, without knowing whether the first attempt got
+ * through. Notifications are only sent for the first attempt.
+ *
+ * Reservations are leased: if the request that reserved a key hasn't finished once the lease has passed, such as
+ * because the server processing it crashed, a retry takes over the reservation, and is processed in its place.
+ *
+ * Server failures are not recorded, so that the request can be retried.
+ */
+
+// IdempotencyWindow is how long the outcome of a request with an IdempotencyKey is kept
+var IdempotencyWindow = 24 * time.Hour
+
+// idempotencyLease is how long a request holds its IdempotencyKey's reservation, if the RequestTimeout is shorter
+var idempotencyLease = time.Minute
+
+// leaseFor returns how long a request holds its IdempotencyKey's reservation: long enough for it to have finished,
+// or timed out, before a retry takes over
+func leaseFor(cfg *config.Config) time.Duration {
+	timeout, err := cfg.ServerConfig.RequestTimeoutDuration()
+	if err == nil && timeout > idempotencyLease {
+		return timeout
+	}
+	return idempotencyLease
+}
+
+// maxIdempotencyKeyLength is the length of the IdempotentRequest.IdempotencyKey column
+const maxIdempotencyKeyLength = 64
+
+// idempotentMethods are the requests whose IdempotencyKey is honoured; it is ignored on others. User.CreateAPIToken is
+// deliberately excluded, since its response holds the secret token.
+var idempotentMethods = map[string]bool{
+	"File.Create":           true,
+	"File.Change":           true,
+	"Project.Create":        true,
+	"Project.ImportFromGit": true,
+	"Team.Create":           true,
+}
+
+// newIdempotencyErrorResponse tells the client why its IdempotencyKey can't be used
+func newIdempotencyErrorResponse(tag int64, problem string) *messages.ServerMessageWrapper {
+	return newValidationErrorResponse(tag, &requestValidationError{
+		Reason: "Invalid request",
+		Fields: []fieldError{{Field: "IdempotencyKey", Problem: problem}},
+	})
+}
+
+// idempotencyRetryAfter is how long a retry of a request still being processed is told to wait before trying again
+const idempotencyRetryAfter = time.Second
+
+// newInProgressResponse tells a retry that the request it repeats is still being processed, so that it can be made
+// again later, with the same IdempotencyKey
+func newInProgressResponse(tag int64) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusFail,
+		Tag:    tag,
+		Data: struct {
+			Reason     string
+			RetryAfter int64 // Seconds until the request should be made again
+			Retryable  bool
+		}{
+			Reason:     "Request in progress",
+			RetryAfter: int64(idempotencyRetryAfter / time.Second),
+			Retryable:  true,
+		},
+	}.Wrap()
+}
+
+// processIdempotently processes the request, unless it repeats the IdempotencyKey of an earlier request, in which
+// case the earlier request's response is returned
+func (dh DataHandler) processIdempotently(req *abstractRequest, fullRequest request, db dbfs.DBFS) ([]dhClosure, error) {
+	method := req.Resource + "." + req.Method
+	if req.IdempotencyKey == "" || !idempotentMethods[method] {
+		return fullRequest.process(db)
+	}
+	if len(req.IdempotencyKey) > maxIdempotencyKeyLength {
+		problem := fmt.Sprintf("must be at most %d bytes long", maxIdempotencyKeyLength)
+		return []dhClosure{toSenderClosure{msg: newIdempotencyErrorResponse(req.Tag, problem)}}, nil
+	}
+
+	// A key released by a request that failed, while this one was looking it up, is reserved again
+	for attempt := 1; ; attempt++ {
+		reserved, err := db.MySQLIdempotentRequestReserve(req.SenderID, req.IdempotencyKey, method, IdempotencyWindow,
+			leaseFor(req.config()))
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, req.Tag)}}, err
+		}
+		if reserved {
+			break
+		}
+
+		recorded, err := db.MySQLIdempotentRequestGet(req.SenderID, req.IdempotencyKey, IdempotencyWindow)
+		if err == dbfs.ErrNoData && attempt < 2 {
+			continue
+		} else if err == dbfs.ErrNoData {
+			return []dhClosure{toSenderClosure{msg: newInProgressResponse(req.Tag)}}, nil
+		} else if err != nil {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, req.Tag)}}, err
+		}
+		if recorded.Method != method {
+			return []dhClosure{toSenderClosure{msg: newIdempotencyErrorResponse(req.Tag, "was already used for "+recorded.Method)}}, nil
+		}
+		if recorded.Status == 0 {
+			return []dhClosure{toSenderClosure{msg: newInProgressResponse(req.Tag)}}, nil
+		}
+
+		utils.LogDebug("Replaying response to idempotent request", utils.LogFields{
+			"Resource": req.Resource,
+			"Method":   req.Method,
+			"SenderID": req.SenderID,
+		})
+		res := messages.Response{
+			Status: recorded.Status,
+			Tag:    req.Tag,
+			Data:   json.RawMessage(recorded.Response),
+		}
+		return []dhClosure{toSenderClosure{msg: res.Wrap()}}, nil
+	}
+
+	closures, err := fullRequest.process(db)
+
+	// Recorded outside of the request's context, since the outcome matters most when the client has disconnected
+	var recordErr error
+	res, ok := senderResponse(closures, req.Tag)
+	if !ok || res.Status == messages.StatusServFail {
+		recordErr = dh.Db.MySQLIdempotentRequestRelease(req.SenderID, req.IdempotencyKey)
+	} else {
+		var data []byte
+		data, recordErr = json.Marshal(res.Data)
+		if recordErr == nil {
+			recordErr = dh.Db.MySQLIdempotentRequestSet(dbfs.IdempotentRequestMeta{
+				Username: req.SenderID,
+				Key:      req.IdempotencyKey,
+				Method:   method,
+				Status:   res.Status,
+				Response: data,
+			})
+		}
+	}
+	utils.LogError("Failed to record idempotent request", recordErr, utils.LogFields{
+		"Resource": req.Resource,
+		"Method":   req.Method,
+		"SenderID": req.SenderID,
+	})
+	return closures, err
+}
+
+// senderResponse returns the response to the request with the given tag, from the closures that process it
+func senderResponse(closures []dhClosure, tag int64) (messages.Response, bool) {
+	for _, closure := range closures {
+		toSender, ok := closure.(toSenderClosure)
+		if !ok {
+			continue
+		}
+		if res, ok := toSender.msg.ServerMessage.(messages.Response); ok && res.Tag == tag {
+			return res, true
+		}
+	}
+	return messages.Response{}, false
+}
@@ -0,0 +1,100 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessIdempotently(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	dh := DataHandler{Db: db}
+
+	send := func(tag int64, key string, resource string, method string, data string) []dhClosure {
+		absReq := &abstractRequest{
+			Tag:            tag,
+			Resource:       resource,
+			Method:         method,
+			SenderID:       geneMeta.Username,
+			Data:           json.RawMessage(data),
+			IdempotencyKey: key,
+		}
+		req, err := authenticatedRequest(absReq)
+		require.NoError(t, err)
+		closures, _ := dh.processIdempotently(absReq, req, db)
+		return closures
+	}
+	response := func(closures []dhClosure, tag int64) messages.Response {
+		res, ok := senderResponse(closures, tag)
+		require.True(t, ok)
+		return res
+	}
+	projectID := func(res messages.Response) int64 {
+		var data struct {
+			ProjectID int64
+		}
+		encoded, err := json.Marshal(res.Data)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(encoded, &data))
+		return data.ProjectID
+	}
+
+	first := send(1, "create-1", "Project", "Create", `{"Name": "hi"}`)
+	require.Equal(t, messages.StatusSuccess, response(first, 1).Status)
+
+	// A retry is answered with the original outcome, without creating a second project or notifying anyone
+	retry := send(2, "create-1", "Project", "Create", `{"Name": "hi"}`)
+	require.Len(t, retry, 1)
+	assert.Equal(t, messages.StatusSuccess, response(retry, 2).Status)
+	assert.Equal(t, projectID(response(first, 1)), projectID(response(retry, 2)))
+	assert.Len(t, db.Projects[geneMeta.Username], 1)
+
+	// Requests without a key are processed every time
+	send(3, "", "Project", "Create", `{"Name": "hi2"}`)
+	send(4, "", "Project", "Create", `{"Name": "hi3"}`)
+	assert.Len(t, db.Projects[geneMeta.Username], 3)
+
+	// Keys can't be reused for another method
+	res := response(send(5, "create-1", "Team", "Create", `{"Name": "team"}`), 5)
+	assert.Equal(t, messages.StatusFail, res.Status)
+	assert.Empty(t, db.Teams)
+
+	res = response(send(6, strings.Repeat("k", maxIdempotencyKeyLength+1), "Project", "Create", `{"Name": "hi"}`), 6)
+	assert.Equal(t, messages.StatusFail, res.Status)
+
+	// Retries of a request still being processed are told so straight away
+	reserved, err := db.MySQLIdempotentRequestReserve(geneMeta.Username, "pending", "Project.Create", IdempotencyWindow,
+		idempotencyLease)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	started := time.Now()
+	res = response(send(9, "pending", "Project", "Create", `{"Name": "hi"}`), 9)
+	assert.Equal(t, messages.StatusFail, res.Status)
+	assert.True(t, time.Since(started) < time.Second, "retries should not wait for the request to finish")
+
+	// Until the request's lease has passed, when a retry takes its place
+	defer func(lease time.Duration) {
+		idempotencyLease = lease
+	}(idempotencyLease)
+	idempotencyLease = 0
+	res = response(send(10, "pending", "Project", "Create", `{"Name": "pending"}`), 10)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Len(t, db.Projects[geneMeta.Username], 4)
+	idempotencyLease = time.Minute
+
+	// Server failures are not recorded, so that they can be retried
+	db.FailCall("MySQLProjectCreate", 1, nil)
+	res = response(send(7, "create-2", "Project", "Create", `{"Name": "hi4"}`), 7)
+	assert.Equal(t, messages.StatusServFail, res.Status)
+	res = response(send(8, "create-2", "Project", "Create", `{"Name": "hi4"}`), 8)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Len(t, db.Projects[geneMeta.Username], 5)
+}
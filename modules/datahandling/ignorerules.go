@@ -0,0 +1,280 @@
+package datahandling
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Projects can have ignore rules, in the format of a .ccignore file, which keep files such as build artifacts and
+ * dependencies out of the project. File.Create rejects ignored files with StatusFileRejected, and Project.ImportFromGit
+ * skips them, along with those ignored by a .ccignore file at the root of the repository.
+ *
+ * The format is a subset of .gitignore's. Each rule is a pattern, matched against the file's path in the project:
+ *
+ *	node_modules/	a trailing '/' matches only directories, and everything in them
+ *	*.o		patterns without a '/' match a file or directory of that name anywhere in the project
+ *	build/*.js	patterns with a '/' match paths from the project's root
+ *	docs/**		'**' matches any number of directories
+ *	!keep.o		a leading '!' re-includes files ignored by the rules before it, unless their directory is ignored
+ *
+ * Within a path segment, '*' matches any characters, '?' matches one, and [...] matches a range, as in path.Match.
+ * Blank rules, and rules starting with '#', are ignored. Projects may have at most 500 rules.
+ */
+
+// ignoreRule is a parsed ignore rule
+type ignoreRule struct {
+	rule     string   // As written
+	segments []string // The pattern, split into path segments
+	negated  bool
+	dirOnly  bool
+	anchored bool // Matched from the project's root, rather than against any file or directory name
+	foldCase bool // Matched ignoring case, as paths are compared when CaseInsensitivePaths is set
+}
+
+// ignoreRules are a project's parsed ignore rules, in order
+type ignoreRules []ignoreRule
+
+// parseIgnoreRules parses ignore rules, returning an error describing the first that is invalid. Rules parsed with
+// foldCase match paths whatever their case.
+func parseIgnoreRules(rules []string, foldCase bool) (ignoreRules, error) {
+	parsed := ignoreRules{}
+	for _, rule := range rules {
+		// Rules are stored one per line
+		if strings.ContainsAny(rule, "\r\n") {
+			return nil, fmt.Errorf("Ignore rule %q spans more than one line", rule)
+		}
+		pattern := strings.TrimSpace(rule)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		ignore := ignoreRule{rule: rule, foldCase: foldCase}
+		if strings.HasPrefix(pattern, "!") {
+			ignore.negated = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			ignore.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		ignore.anchored = strings.Contains(pattern, "/")
+		pattern = strings.TrimLeft(pattern, "/")
+		if pattern == "" {
+			return nil, fmt.Errorf("Ignore rule %q has no pattern", rule)
+		}
+
+		ignore.segments = strings.Split(pattern, "/")
+		for _, segment := range ignore.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("Ignore rule %q is malformed: %v", rule, err)
+			}
+		}
+		parsed = append(parsed, ignore)
+	}
+	return parsed, nil
+}
+
+// match returns the rule that decides that the file is ignored, if it is. Files in ignored directories are ignored,
+// whatever the rules after say about them.
+func (rules ignoreRules) match(relativePath string, filename string) (string, bool) {
+	segments := append(splitPath(relativePath), filename)
+	for end := 1; end < len(segments); end++ {
+		if rule, ignored := rules.matchPath(segments[:end], true); ignored {
+			return rule, true
+		}
+	}
+	return rules.matchPath(segments, false)
+}
+
+// matchDir returns the rule that decides that the directory, and so everything in it, is ignored, if it is
+func (rules ignoreRules) matchDir(relativePath string) (string, bool) {
+	segments := splitPath(relativePath)
+	for end := 1; end <= len(segments); end++ {
+		if rule, ignored := rules.matchPath(segments[:end], true); ignored {
+			return rule, true
+		}
+	}
+	return "", false
+}
+
+// matchPath returns the last rule that matches the path, if the path is ignored
+func (rules ignoreRules) matchPath(segments []string, isDir bool) (string, bool) {
+	matched, ignored := "", false
+	for _, rule := range rules {
+		if rule.matches(segments, isDir) {
+			matched, ignored = rule.rule, !rule.negated
+		}
+	}
+	if !ignored {
+		return "", false
+	}
+	return matched, true
+}
+
+// matches returns true if the rule matches the path of a file or directory
+func (rule ignoreRule) matches(segments []string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		return matchSegment(rule.segments[0], segments[len(segments)-1], rule.foldCase)
+	}
+	return matchSegments(rule.segments, segments, rule.foldCase)
+}
+
+// matchSegments returns true if the pattern's segments match the path's, with "**" matching any number of segments
+func matchSegments(pattern []string, segments []string, foldCase bool) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:], foldCase) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(segments) > 0 && matchSegment(pattern[0], segments[0], foldCase) &&
+		matchSegments(pattern[1:], segments[1:], foldCase)
+}
+
+// matchSegment returns true if the pattern matches a single path segment, ignoring case if foldCase is set
+func matchSegment(pattern string, segment string, foldCase bool) bool {
+	if foldCase {
+		pattern, segment = strings.ToLower(pattern), strings.ToLower(segment)
+	}
+	matched, _ := path.Match(pattern, segment)
+	return matched
+}
+
+// readIgnoreFile reads the rules in a .ccignore file, returning none if there is no such file
+func readIgnoreFile(filename string, foldCase bool) (ignoreRules, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ignoreRules{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseIgnoreRules(strings.Split(strings.Replace(string(contents), "\r\n", "\n", -1), "\n"), foldCase)
+}
+
+// projectIgnoreRules returns the project's parsed ignore rules
+func projectIgnoreRules(projectID int64, foldCase bool, db dbfs.DBFS) (ignoreRules, error) {
+	rules, err := db.MySQLProjectGetIgnoreRules(projectID)
+	if err != nil {
+		return nil, err
+	}
+	// Rules are checked when they are set, so stored rules that fail to parse were written some other way
+	parsed, err := parseIgnoreRules(rules, foldCase)
+	if err != nil {
+		utils.LogError("Invalid stored ignore rules", err, utils.LogFields{
+			"ProjectID": projectID,
+		})
+	}
+	return parsed, nil
+}
+
+// Project.SetIgnoreRules
+type projectSetIgnoreRulesRequest struct {
+	ProjectID int64    `validate:"required"`
+	Rules     []string `validate:"max=500"` // Replaces the project's rules; empty removes them
+	abstractRequest
+}
+
+func (p *projectSetIgnoreRulesRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectSetIgnoreRulesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityManageSettings, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	if _, err := parseIgnoreRules(p.Rules, false); err != nil {
+		res := messages.Response{
+			Status: messages.StatusFail,
+			Tag:    p.Tag,
+			Data: struct {
+				Error string
+			}{
+				Error: err.Error(),
+			},
+		}.Wrap()
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	err = db.MySQLProjectSetIgnoreRules(p.ProjectID, p.Rules)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
+	not := messages.Notification{
+		Resource:   p.Resource,
+		Method:     p.Method,
+		ResourceID: p.ProjectID,
+		Data: struct {
+			Rules []string
+		}{
+			Rules: p.Rules,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(p.ProjectID, 0, not)}, nil
+}
+
+// Project.GetIgnoreRules
+type projectGetIgnoreRulesRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (p *projectGetIgnoreRulesRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectGetIgnoreRulesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	rules, err := db.MySQLProjectGetIgnoreRules(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data: struct {
+			Rules []string
+		}{
+			Rules: rules,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
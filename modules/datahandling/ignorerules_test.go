@@ -0,0 +1,159 @@
+package datahandling
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreRules(t *testing.T) {
+	rules, err := parseIgnoreRules([]string{"# build output", "", "  build/ ", "!keep.o", "/dist/*.js"}, false)
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.Equal(t, ignoreRule{rule: "  build/ ", segments: []string{"build"}, dirOnly: true}, rules[0])
+	assert.Equal(t, ignoreRule{rule: "!keep.o", segments: []string{"keep.o"}, negated: true}, rules[1])
+	assert.Equal(t, ignoreRule{rule: "/dist/*.js", segments: []string{"dist", "*.js"}, anchored: true}, rules[2])
+
+	for _, invalid := range []string{"/", "!", "[a-", "a\nb"} {
+		_, err := parseIgnoreRules([]string{invalid}, false)
+		assert.Error(t, err, "%q should be invalid", invalid)
+	}
+}
+
+func TestIgnoreRules_Match(t *testing.T) {
+	configSetup(t)
+	rules, err := parseIgnoreRules([]string{
+		"node_modules/",
+		"*.o",
+		"!keep.o",
+		"build/*.js",
+		"docs/**/draft.md",
+		"logs/",
+		"!logs/important.log",
+	}, false)
+	require.NoError(t, err)
+
+	tests := []struct {
+		relativePath string
+		filename     string
+		rule         string
+	}{
+		{"", "main.go", ""},
+		{"node_modules/left-pad", "index.js", "node_modules/"},
+		{"web/node_modules", "index.js", "node_modules/"},
+		{"", "node_modules", ""}, // A file, not a directory
+		{"src", "main.o", "*.o"},
+		{"src", "keep.o", ""},
+		{"build", "app.js", "build/*.js"},
+		{"src/build", "app.js", ""}, // Rules with a '/' are matched from the root
+		{"build/nested", "app.js", ""},
+		{"docs", "draft.md", "docs/**/draft.md"},
+		{"docs/a/b", "draft.md", "docs/**/draft.md"},
+		{"logs", "important.log", "logs/"}, // Files in ignored directories can't be re-included
+	}
+	for _, test := range tests {
+		rule, ignored := rules.match(test.relativePath, test.filename)
+		assert.Equal(t, test.rule != "", ignored, "%s/%s", test.relativePath, test.filename)
+		assert.Equal(t, test.rule, rule, "%s/%s", test.relativePath, test.filename)
+	}
+
+	rule, ignored := rules.matchDir("web/node_modules/left-pad")
+	assert.True(t, ignored)
+	assert.Equal(t, "node_modules/", rule)
+	_, ignored = rules.matchDir("web/src")
+	assert.False(t, ignored)
+}
+
+func TestProjectIgnoreRulesRequests(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+
+	set := projectSetIgnoreRulesRequest{ProjectID: projectID, Rules: []string{"node_modules/", "*.o"}}
+	setBaseFields(&set)
+	set.Resource = "Project"
+	set.Method = "SetIgnoreRules"
+	res, not := processForTest(t, &set, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	require.NotNil(t, not)
+	assert.Equal(t, "SetIgnoreRules", not.Method)
+	assert.Equal(t, []string{"node_modules/", "*.o"}, db.ProjectIgnoreRules[projectID])
+
+	get := projectGetIgnoreRulesRequest{ProjectID: projectID}
+	setBaseFields(&get)
+	get.Resource = "Project"
+	get.Method = "GetIgnoreRules"
+	res, _ = processForTest(t, &get, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []string{"node_modules/", "*.o"}, reflect.ValueOf(res.Data).FieldByName("Rules").Interface())
+
+	// Invalid rules are rejected, leaving the project's rules as they were
+	set.Rules = []string{"[a-"}
+	res, _ = processForTest(t, &set, db)
+	assert.Equal(t, messages.StatusFail, res.Status)
+	assert.Equal(t, []string{"node_modules/", "*.o"}, db.ProjectIgnoreRules[projectID])
+
+	// Files matching the rules can't be created
+	create := fileCreateRequest{Name: "index.js", RelativePath: "web/node_modules/left-pad", ProjectID: projectID}
+	setBaseFields(&create)
+	create.Resource = "File"
+	create.Method = "Create"
+	res, _ = processForTest(t, &create, db)
+	assert.Equal(t, messages.StatusFileRejected, res.Status)
+	assert.Equal(t, filePolicyViolation{Reason: pathIgnored, IgnoreRule: "node_modules/"}, res.Data)
+
+	create.RelativePath = "web"
+	res, _ = processForTest(t, &create, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+}
+
+func TestProjectImportFromGit_IgnoreRules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	configSetup(t)
+	tmpDir, err := ioutil.TempDir("", "gitimport")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	repoURL := newTestGitRepo(t, tmpDir, map[string][]byte{
+		".ccignore":                    []byte("# Generated\r\n*.min.js\r\n"),
+		"src/main.js":                  []byte("main();\n"),
+		"src/main.min.js":              []byte("main();"),
+		"node_modules/left-pad/pad.js": []byte("pad();\n"),
+	})
+	defer func(protocols []string) { gitexport.CloneProtocols = protocols }(gitexport.CloneProtocols)
+	gitexport.CloneProtocols = []string{"file"}
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "imported")
+	db.ProjectIgnoreRules[projectID] = []string{"node_modules/"}
+
+	req := projectImportFromGitRequest{ProjectID: projectID, URL: repoURL}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "ImportFromGit"
+	messageChan := make(chan rabbitmq.AMQPMessage, 16)
+	require.NoError(t, gitImportClosure{request: req}.call(DataHandler{MessageChan: messageChan, Db: db}))
+	progress := importNotifications(t, messageChan)
+	assert.Equal(t, 1, progress[len(progress)-1].FilesSkipped)
+
+	files, err := db.MySQLProjectGetFiles(projectID)
+	require.NoError(t, err)
+	paths := map[string]bool{}
+	for _, file := range files {
+		paths[filepath.Join(file.RelativePath, file.Filename)] = true
+	}
+	assert.Equal(t, map[string]bool{".ccignore": true, "src/main.js": true}, paths)
+}
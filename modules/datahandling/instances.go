@@ -0,0 +1,131 @@
+package datahandling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Each server registers itself in the instance registry, a MySQL row it refreshes every instanceHeartbeatInterval
+ * with its connection count, so that admins of multi-server deployments can list the running servers with
+ * Admin.ListInstances. Admins drain a server, such as before taking it down, with Admin.DrainInstance; the server
+ * picks this up on its next heartbeat, and from then on refuses new connections and fails its health check, so that
+ * load balancers stop sending it clients, while its existing connections carry on until they close.
+ *
+ * Servers that stop sending heartbeats are listed as unresponsive, and forgotten after instanceForgetAfter. Each
+ * heartbeat also picks up changes to maintenance mode; see maintenance.go.
+ */
+
+// instanceHeartbeatInterval is how often each server refreshes its registration
+const instanceHeartbeatInterval = 15 * time.Second
+
+// instanceUnresponsiveAfter is how long after its last heartbeat a server is listed as unresponsive
+const instanceUnresponsiveAfter = 3 * instanceHeartbeatInterval
+
+// instanceForgetAfter is how long after its last heartbeat a server is removed from the registry
+const instanceForgetAfter = 24 * time.Hour
+
+// InstanceID identifies this server in the instance registry. It is different each time the server starts.
+var InstanceID = newInstanceID()
+
+// draining is 1 once this server has been asked to stop accepting new connections
+var draining int32
+
+func newInstanceID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Draining returns whether this server has been asked to stop accepting new connections
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+func setDraining(drain bool) {
+	value := int32(0)
+	if drain {
+		value = 1
+	}
+	if atomic.SwapInt32(&draining, value) != value {
+		utils.LogInfo("Drain state changed", utils.LogFields{
+			"InstanceID": InstanceID,
+			"Draining":   drain,
+		})
+	}
+}
+
+// InstanceInfo describes this server to the instance registry
+type InstanceInfo struct {
+	Name        string
+	Version     string
+	Connections func() int // The number of open WebSocket connections
+}
+
+// StartInstanceHeartbeats registers this server in the instance registry, and keeps its registration up to date
+// until told to exit, when it is removed
+func StartInstanceHeartbeats(info InstanceInfo, db dbfs.DBFS, control *utils.Control) {
+	host, err := os.Hostname()
+	utils.LogError("Failed to get hostname", err, nil)
+	instance := dbfs.InstanceMeta{
+		InstanceID: InstanceID,
+		Name:       info.Name,
+		Host:       host,
+		Version:    info.Version,
+		StartedAt:  time.Now(),
+	}
+
+	go func() {
+		ticker := time.NewTicker(instanceHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if info.Connections != nil {
+				instance.Connections = info.Connections()
+			}
+			err := sendHeartbeat(instance, db, time.Now())
+			utils.LogError("Failed to send instance heartbeat", err, utils.LogFields{
+				"InstanceID": InstanceID,
+			})
+			err = refreshMaintenance(db)
+			utils.LogError("Failed to read maintenance mode", err, nil)
+
+			select {
+			case <-control.Exit:
+				err := db.MySQLInstanceDelete(InstanceID)
+				utils.LogError("Failed to remove instance from the registry", err, utils.LogFields{
+					"InstanceID": InstanceID,
+				})
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sendHeartbeat refreshes the instance's registration, and applies any change to its drain state
+func sendHeartbeat(instance dbfs.InstanceMeta, db dbfs.DBFS, now time.Time) error {
+	drain, err := db.MySQLInstanceHeartbeat(instance, now.Add(-instanceForgetAfter))
+	if err != nil {
+		return err
+	}
+	setDraining(drain)
+	return nil
+}
+
+// instanceHealth describes a registered server's state to admins
+func instanceHealth(instance dbfs.InstanceMeta, now time.Time) string {
+	switch {
+	case now.Sub(instance.LastHeartbeat) > instanceUnresponsiveAfter:
+		return "unresponsive"
+	case instance.Draining:
+		return "draining"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,83 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendHeartbeat(t *testing.T) {
+	defer setDraining(false)
+	db := dbfs.NewDBMock()
+	now := time.Now()
+	db.Instances["gone"] = dbfs.InstanceMeta{InstanceID: "gone", LastHeartbeat: now.Add(-instanceForgetAfter - time.Minute)}
+
+	instance := dbfs.InstanceMeta{InstanceID: InstanceID, Name: "cc-1", Connections: 3}
+	require.NoError(t, sendHeartbeat(instance, db, now))
+	assert.NotContains(t, db.Instances, "gone")
+	assert.Equal(t, 3, db.Instances[InstanceID].Connections)
+	assert.False(t, Draining())
+
+	require.NoError(t, db.MySQLInstanceSetDraining(InstanceID, true))
+	require.NoError(t, sendHeartbeat(instance, db, now))
+	assert.True(t, Draining())
+	assert.True(t, db.Instances[InstanceID].Draining, "heartbeats should not reset the drain state")
+
+	assert.Equal(t, "draining", instanceHealth(db.Instances[InstanceID], now))
+	assert.Equal(t, "ok", instanceHealth(dbfs.InstanceMeta{LastHeartbeat: now}, now))
+	assert.Equal(t, "unresponsive", instanceHealth(dbfs.InstanceMeta{LastHeartbeat: now}, now.Add(time.Minute)))
+}
+
+func TestAdminInstanceRequests(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+	defer setDraining(false)
+
+	db := dbfs.NewDBMock()
+	db.Instances[InstanceID] = dbfs.InstanceMeta{InstanceID: InstanceID, Name: "cc-1", LastHeartbeat: time.Now()}
+	db.Instances["other"] = dbfs.InstanceMeta{InstanceID: "other", Name: "cc-2", LastHeartbeat: time.Now()}
+
+	list := adminListInstancesRequest{}
+	setBaseFields(&list)
+	list.Resource = "Admin"
+	list.Method = "ListInstances"
+	res, _ := processForTest(t, &list, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	serverCfg.Admins = []string{list.SenderID}
+	drain := adminDrainInstanceRequest{InstanceID: "other", Draining: true}
+	setBaseFields(&drain)
+	drain.Resource = "Admin"
+	drain.Method = "DrainInstance"
+	res, _ = processForTest(t, &drain, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.True(t, db.Instances["other"].Draining)
+	assert.False(t, Draining(), "other servers should only drain on their next heartbeat")
+
+	drain.InstanceID = InstanceID
+	res, _ = processForTest(t, &drain, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.True(t, Draining(), "the server the admin is connected to should drain immediately")
+
+	drain.InstanceID = "missing"
+	res, _ = processForTest(t, &drain, db)
+	assert.Equal(t, messages.StatusNotFound, res.Status)
+
+	res, _ = processForTest(t, &list, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	instances := reflect.ValueOf(res.Data).FieldByName("Instances")
+	require.Equal(t, 2, instances.Len())
+	assert.Equal(t, "cc-1", instances.Index(0).FieldByName("Name").String())
+	assert.True(t, instances.Index(0).FieldByName("Self").Bool())
+	assert.Equal(t, "draining", instances.Index(1).FieldByName("Health").String())
+	assert.False(t, instances.Index(1).FieldByName("Self").Bool())
+}
@@ -0,0 +1,157 @@
+package datahandling
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Integrity checking of the files on disk. Every file with a row in MySQL is checked to exist on disk, and to match
+ * the checksum recorded when it was written. Files that are missing or corrupt are restored from the swap file of an
+ * interrupted scrunch if there is one; otherwise they are reported, and must be restored from a backup, such as the
+ * Git export.
+ */
+
+// integrityPageSize is the number of files fetched from MySQL at a time
+const integrityPageSize = 500
+
+var integrityMetrics = expvar.NewMap("integrity")
+
+// IntegrityReport is the result of checking every file
+type IntegrityReport struct {
+	Started      time.Time
+	Finished     time.Time
+	FilesChecked int
+	Missing      []int64 // FileIDs of files not on disk
+	Corrupt      []int64 // FileIDs of files that do not match their checksum, or could not be read
+	Repaired     []int64 // FileIDs of missing or corrupt files that were restored
+}
+
+var integrity struct {
+	running    sync.Mutex // held while checking, so that checks never overlap
+	mutex      sync.Mutex
+	lastReport *IntegrityReport
+}
+
+// LastIntegrityReport returns the report of the last completed check, or nil if none has completed
+func LastIntegrityReport() *IntegrityReport {
+	integrity.mutex.Lock()
+	defer integrity.mutex.Unlock()
+	return integrity.lastReport
+}
+
+// CheckIntegrity checks every file, attempting to repair those that are missing or corrupt
+func CheckIntegrity(db dbfs.DBFS) (*IntegrityReport, error) {
+	integrity.running.Lock()
+	defer integrity.running.Unlock()
+
+	report := &IntegrityReport{
+		Started:  time.Now(),
+		Missing:  []int64{},
+		Corrupt:  []int64{},
+		Repaired: []int64{},
+	}
+
+	var afterFileID int64
+	for {
+		files, err := db.MySQLFileList(afterFileID, integrityPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			checkFileIntegrity(file, report, db)
+		}
+		if len(files) < integrityPageSize {
+			break
+		}
+		afterFileID = files[len(files)-1].FileID
+	}
+	report.Finished = time.Now()
+
+	integrity.mutex.Lock()
+	integrity.lastReport = report
+	integrity.mutex.Unlock()
+
+	utils.LogInfo("Integrity check complete", utils.LogFields{
+		"FilesChecked": report.FilesChecked,
+		"Missing":      len(report.Missing),
+		"Corrupt":      len(report.Corrupt),
+		"Repaired":     len(report.Repaired),
+		"Duration":     report.Finished.Sub(report.Started).Seconds(),
+	})
+	return report, nil
+}
+
+func checkFileIntegrity(file dbfs.FileMeta, report *IntegrityReport, db dbfs.DBFS) {
+	report.FilesChecked++
+	integrityMetrics.Add("FilesChecked", 1)
+
+	err := db.FileVerify(file)
+	if err == nil {
+		return
+	}
+	if err == dbfs.ErrFileMissing {
+		report.Missing = append(report.Missing, file.FileID)
+		integrityMetrics.Add("Missing", 1)
+	} else {
+		report.Corrupt = append(report.Corrupt, file.FileID)
+		integrityMetrics.Add("Corrupt", 1)
+	}
+
+	if restoreErr := db.FileRestoreFromSwap(file); restoreErr == nil {
+		report.Repaired = append(report.Repaired, file.FileID)
+		integrityMetrics.Add("Repaired", 1)
+		utils.LogWarn("Restored file from its swap file", utils.LogFields{
+			"FileID":    file.FileID,
+			"ProjectID": file.ProjectID,
+			"Problem":   err.Error(),
+		})
+		return
+	}
+	utils.LogError("File failed integrity check", err, utils.LogFields{
+		"FileID":       file.FileID,
+		"ProjectID":    file.ProjectID,
+		"RelativePath": file.RelativePath,
+		"Filename":     file.Filename,
+	})
+}
+
+// StartIntegrityChecks checks every file each interval, until told to exit
+func StartIntegrityChecks(interval time.Duration, db dbfs.DBFS, control *utils.Control) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-control.Exit:
+				return
+			case <-ticker.C:
+				_, err := checkIntegrityOnce(db)
+				utils.LogError("Failed to check file integrity", err, nil)
+			}
+		}
+	}()
+}
+
+// integrityLockName is the name of the lock held during scheduled checks, so that when every server runs them, each
+// interval's check is made by only one of them
+const integrityLockName = "integrity-check"
+
+// checkIntegrityOnce checks every file, unless another server is already checking them, in which case it returns a
+// nil report
+func checkIntegrityOnce(db dbfs.DBFS) (*IntegrityReport, error) {
+	lock, err := db.MySQLLockAcquire(integrityLockName, 0)
+	if err == dbfs.ErrLockHeld {
+		utils.LogDebug("Skipping integrity check; another server is checking", nil)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	return CheckIntegrity(db)
+}
@@ -0,0 +1,82 @@
+package datahandling
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+	serverCfg.Admins = []string{"admin"}
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	okID, _ := db.MySQLFileCreate("loganga", "ok", "", projectID)
+	missingID, _ := db.MySQLFileCreate("loganga", "missing", "", projectID)
+	corruptID, _ := db.MySQLFileCreate("loganga", "corrupt", "", projectID)
+	db.FileIntegrityErrors[missingID] = dbfs.ErrFileMissing
+	db.FileIntegrityErrors[corruptID] = dbfs.ErrChecksumMismatch
+
+	process := func(req request) messages.Response {
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+	checkReq := new(adminCheckIntegrityRequest)
+	setBaseFields(checkReq)
+	checkReq.Resource = "Admin"
+	checkReq.Method = "CheckIntegrity"
+	reportReq := new(adminGetIntegrityReportRequest)
+	setBaseFields(reportReq)
+	reportReq.Resource = "Admin"
+	reportReq.Method = "GetIntegrityReport"
+
+	assert.Equal(t, messages.StatusUnauthorized, process(checkReq).Status)
+	assert.Equal(t, messages.StatusUnauthorized, process(reportReq).Status)
+
+	checkReq.SenderID = "admin"
+	reportReq.SenderID = "admin"
+
+	resp := process(checkReq)
+	require.Equal(t, messages.StatusSuccess, resp.Status)
+	report := resp.Data.(*IntegrityReport)
+	assert.Equal(t, 3, report.FilesChecked)
+	assert.Equal(t, []int64{missingID}, report.Missing)
+	assert.Equal(t, []int64{corruptID}, report.Corrupt)
+	assert.Empty(t, report.Repaired, "there are no swap files to restore from")
+	assert.NotContains(t, report.Missing, okID)
+
+	resp = process(reportReq)
+	require.Equal(t, messages.StatusSuccess, resp.Status)
+	assert.Equal(t, report, resp.Data)
+
+	// Files are restored from their swap files if there are any
+	swap := []byte("swapped")
+	db.Swp = &swap
+	report, err := CheckIntegrity(db)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{missingID, corruptID}, report.Repaired)
+	assert.Empty(t, db.FileIntegrityErrors)
+
+	// Scheduled checks are skipped while another server is checking
+	lock, err := db.MySQLLockAcquire(integrityLockName, 0)
+	require.NoError(t, err)
+	report, err = checkIntegrityOnce(db)
+	assert.NoError(t, err)
+	assert.Nil(t, report)
+	lock.Release()
+
+	report, err = checkIntegrityOnce(db)
+	assert.NoError(t, err)
+	assert.NotNil(t, report)
+}
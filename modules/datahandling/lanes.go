@@ -0,0 +1,204 @@
+package datahandling
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Requests are processed in priority lanes, so that bulk requests, such as importing a large project, can't delay the
+ * interactive ones collaborators make as they type. Each lane has its own limit on the requests of it being processed
+ * at once, its Workers, beyond which they wait for one to finish, and on those waiting, its QueueLimit, beyond which
+ * they are refused with StatusConcurrencyLimited. By default, bulk requests are processed a few at a time, and
+ * interactive and normal requests are not limited, so no number of bulk requests can hold them up.
+ *
+ * Requests that are abandoned, or time out, while they wait give up their place in the queue, and are not processed.
+ *
+ * Each server's lanes are configured with its PriorityLanes when it processes its first request. The requests each lane
+ * queued, refused and abandoned are exported through expvar, under "priorityLanes".
+ */
+
+const (
+	laneInteractive = "interactive"
+	laneNormal      = "normal"
+	laneBulk        = "bulk"
+)
+
+// requestLanes are the lanes of the requests that aren't processed in the normal lane
+var requestLanes = map[string]string{
+	"File.Change": laneInteractive,
+
+	"Admin.CheckIntegrity":  laneBulk,
+	"Admin.GetQuotaReport":  laneBulk,
+	"Admin.ScrunchFile":     laneBulk,
+	"Project.Archive":       laneBulk,
+	"Project.ImportFromGit": laneBulk,
+	"Project.Sync":          laneBulk,
+	"Project.Unarchive":     laneBulk,
+	"User.ExportData":       laneBulk,
+}
+
+// defaultLaneCfgs are the limits of each lane, where they aren't configured
+var defaultLaneCfgs = map[string]config.PriorityLaneCfg{
+	laneInteractive: {Workers: -1, QueueLimit: -1},
+	laneNormal:      {Workers: -1, QueueLimit: -1},
+	laneBulk:        {Workers: 4, QueueLimit: 64},
+}
+
+// Reason given in StatusConcurrencyLimited responses to requests refused by their lane
+const reasonLaneFull = "Too many requests of this priority waiting on this server"
+
+var laneMetrics = expvar.NewMap("priorityLanes")
+
+var errLaneFull = errors.New("Too many requests waiting in the priority lane")
+
+// priorityLanes are the lanes of the servers in this process
+var priorityLanes = &laneSet{}
+
+type laneSet struct {
+	mutex sync.Mutex
+	lanes map[*config.Config]map[string]*priorityLane // By the server's config; nil for the process's
+}
+
+// lane returns the lane of the Resource.Method on the server with the config, configuring its lanes if they haven't
+// been
+func (set *laneSet) lane(cfg *config.Config, method string) *priorityLane {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	if set.lanes == nil {
+		set.lanes = make(map[*config.Config]map[string]*priorityLane)
+	}
+	lanes, ok := set.lanes[cfg]
+	if !ok {
+		serverCfg := cfg
+		if serverCfg == nil {
+			serverCfg = config.GetConfig()
+		}
+		cfgs := serverCfg.ServerConfig.PriorityLanes
+		lanes = make(map[string]*priorityLane)
+		for name, cfg := range defaultLaneCfgs {
+			if configured := cfgs[name]; configured.Workers != 0 {
+				cfg.Workers = configured.Workers
+			}
+			if configured := cfgs[name]; configured.QueueLimit != 0 {
+				cfg.QueueLimit = configured.QueueLimit
+			}
+			lanes[name] = newPriorityLane(name, cfg)
+		}
+		set.lanes[cfg] = lanes
+	}
+
+	name, ok := requestLanes[method]
+	if !ok {
+		name = laneNormal
+	}
+	return lanes[name]
+}
+
+type priorityLane struct {
+	name       string
+	workers    chan struct{} // Holds a value for each request being processed; nil if the lane isn't limited
+	queueLimit int           // Negative if unlimited
+
+	mutex   sync.Mutex
+	waiting int
+}
+
+func newPriorityLane(name string, cfg config.PriorityLaneCfg) *priorityLane {
+	lane := &priorityLane{name: name, queueLimit: cfg.QueueLimit}
+	if cfg.Workers > 0 {
+		lane.workers = make(chan struct{}, cfg.Workers)
+	}
+	return lane
+}
+
+// acquire waits for one of the lane's workers to be free, returning errLaneFull without waiting if too many requests
+// are already waiting, or the context's error if it is done first. Requests that acquire a worker must release it.
+func (lane *priorityLane) acquire(ctx context.Context) error {
+	if lane.workers == nil {
+		return nil
+	}
+	select {
+	case lane.workers <- struct{}{}:
+		return nil
+	default:
+	}
+
+	lane.mutex.Lock()
+	if lane.queueLimit >= 0 && lane.waiting >= lane.queueLimit {
+		lane.mutex.Unlock()
+		return errLaneFull
+	}
+	lane.waiting++
+	lane.mutex.Unlock()
+	laneMetrics.Add(lane.name+".Queued", 1)
+	defer func() {
+		lane.mutex.Lock()
+		lane.waiting--
+		lane.mutex.Unlock()
+	}()
+
+	select {
+	case lane.workers <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		laneMetrics.Add(lane.name+".Abandoned", 1)
+		return ctx.Err()
+	}
+}
+
+// release frees the worker the request acquired
+func (lane *priorityLane) release() {
+	if lane.workers != nil {
+		<-lane.workers
+	}
+}
+
+// admitToLane processes the request once a worker of its lane is free, refusing it if too many are waiting already
+func admitToLane(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		req := call.req
+		lane := priorityLanes.lane(req.cfg, req.Resource+"."+req.Method)
+		err := lane.acquire(call.context())
+		if err != nil && err != errLaneFull {
+			// The client disconnected, or the request timed out, while it waited; it is not processed
+			utils.LogDebug("Abandoned request waiting in its priority lane", utils.LogFields{
+				"SenderID": req.SenderID,
+				"Resource": req.Resource,
+				"Method":   req.Method,
+				"Lane":     lane.name,
+			})
+			return []dhClosure{toSenderClosure{msg: messages.Response{
+				Status: messages.StatusServFail,
+				Tag:    req.Tag,
+				Data: struct {
+					Retryable bool
+				}{
+					Retryable: true,
+				},
+			}.Wrap()}}, err
+		}
+		if err == errLaneFull {
+			laneMetrics.Add(lane.name+".Refused", 1)
+			utils.LogWarn("Refused request over its priority lane's queue limit", utils.LogFields{
+				"SenderID": req.SenderID,
+				"Resource": req.Resource,
+				"Method":   req.Method,
+				"Lane":     lane.name,
+				"Limit":    lane.queueLimit,
+			})
+			return []dhClosure{toSenderClosure{msg: newConcurrencyLimitedResponse(req.Tag, reasonLaneFull, lane.queueLimit)}}, nil
+		}
+		defer lane.release()
+
+		return next(dh, call, db)
+	}
+}
@@ -0,0 +1,148 @@
+package datahandling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmitToLane(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(lanes map[string]config.PriorityLaneCfg) {
+		serverCfg.PriorityLanes = lanes
+		priorityLanes = &laneSet{}
+	}(serverCfg.PriorityLanes)
+	serverCfg.PriorityLanes = map[string]config.PriorityLaneCfg{
+		laneBulk:        {Workers: 1, QueueLimit: 1},
+		laneInteractive: {Workers: 1},
+	}
+	priorityLanes = &laneSet{}
+
+	assert.Equal(t, laneInteractive, priorityLanes.lane(nil, "File.Change").name)
+	assert.Equal(t, laneBulk, priorityLanes.lane(nil, "Project.ImportFromGit").name)
+	assert.Equal(t, laneNormal, priorityLanes.lane(nil, "Project.Rename").name)
+	assert.Equal(t, -1, priorityLanes.lane(nil, "File.Change").queueLimit, "unconfigured limits should have their defaults")
+
+	started := make(chan string, 4)
+	finish := map[string]chan bool{
+		"Project.ImportFromGit": make(chan bool),
+		"Project.Sync":          make(chan bool),
+		"File.Change":           make(chan bool),
+	}
+	process := admitToLane(func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		method := call.req.Resource + "." + call.req.Method
+		started <- method
+		<-finish[method]
+		return nil, nil
+	})
+	handle := func(resource, method string) chan []dhClosure {
+		done := make(chan []dhClosure, 1)
+		go func() {
+			closures, _ := process(DataHandler{}, &requestCall{req: &abstractRequest{Resource: resource, Method: method}}, nil)
+			done <- closures
+		}()
+		return done
+	}
+
+	// The bulk lane's worker is busy, so the next bulk request waits, and the one after that is refused
+	first := handle("Project", "ImportFromGit")
+	require.Equal(t, "Project.ImportFromGit", <-started)
+	second := handle("Project", "Sync")
+	for lane := priorityLanes.lane(nil, "Project.Sync"); ; time.Sleep(time.Millisecond) {
+		lane.mutex.Lock()
+		waiting := lane.waiting
+		lane.mutex.Unlock()
+		if waiting == 1 {
+			break
+		}
+	}
+	refused := <-handle("User", "ExportData")
+	require.Len(t, refused, 1)
+	res := refused[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusConcurrencyLimited, res.Status)
+	assert.Equal(t, concurrencyLimitedResponse{Reason: reasonLaneFull, Limit: 1}, res.Data)
+
+	// Requests of other lanes aren't held up by it
+	change := handle("File", "Change")
+	assert.Equal(t, "File.Change", <-started)
+	finish["File.Change"] <- true
+	<-change
+
+	finish["Project.ImportFromGit"] <- true
+	<-first
+	assert.Equal(t, "Project.Sync", <-started, "the waiting request should be processed once the worker is free")
+	finish["Project.Sync"] <- true
+	<-second
+}
+
+func TestAdmitToLane_Abandoned(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(lanes map[string]config.PriorityLaneCfg) {
+		serverCfg.PriorityLanes = lanes
+		priorityLanes = &laneSet{}
+	}(serverCfg.PriorityLanes)
+	serverCfg.PriorityLanes = map[string]config.PriorityLaneCfg{laneBulk: {Workers: 1, QueueLimit: 1}}
+	priorityLanes = &laneSet{}
+
+	finish := make(chan bool)
+	processed := make(chan string, 3)
+	process := admitToLane(func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		processed <- call.req.Method
+		if call.req.Method == "ImportFromGit" {
+			<-finish
+		}
+		return nil, nil
+	})
+	first := make(chan bool)
+	go func() {
+		process(DataHandler{}, &requestCall{req: &abstractRequest{Resource: "Project", Method: "ImportFromGit"}}, nil)
+		close(first)
+	}()
+	require.Equal(t, "ImportFromGit", <-processed)
+
+	// A request whose client disconnects while it waits gives up its place, without being processed
+	ctx, cancel := context.WithCancel(context.Background())
+	abandoned := make(chan []dhClosure, 1)
+	go func() {
+		closures, err := process(DataHandler{}, &requestCall{req: &abstractRequest{Resource: "Project", Method: "Sync"}, ctx: ctx}, nil)
+		assert.Equal(t, context.Canceled, err)
+		abandoned <- closures
+	}()
+	lane := priorityLanes.lane(nil, "Project.Sync")
+	waiting := func() int {
+		lane.mutex.Lock()
+		defer lane.mutex.Unlock()
+		return lane.waiting
+	}
+	for waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	closures := <-abandoned
+	require.Len(t, closures, 1)
+	assert.Equal(t, messages.StatusServFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	assert.Equal(t, 0, waiting())
+
+	// So the next request may wait in its place
+	next := make(chan bool)
+	go func() {
+		process(DataHandler{}, &requestCall{req: &abstractRequest{Resource: "User", Method: "ExportData"}}, nil)
+		close(next)
+	}()
+	for waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	finish <- true
+	<-first
+	<-next
+	assert.Equal(t, "ExportData", <-processed)
+	assert.Empty(t, processed, "the abandoned request should not have been processed")
+}
@@ -0,0 +1,193 @@
+package datahandling
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Keystroke latency: the time from the server receiving a File.Change to the publisher publishing its notification to
+ * the project's other subscribers, which includes the time spent waiting for a batch of coalesced changes (see
+ * changebatch.go). The percentiles of the changes made within the ChangeLatencySLO's window are exported through
+ * expvar, under "changeLatency", and Admin.GetLatencyReport reports them with how the server is doing against the
+ * objective. Each server reports the changes it received.
+ */
+
+// maxLatencySamples is the most changes whose latency is kept; on busy servers, the report only covers the latest
+const maxLatencySamples = 1 << 16
+
+var changeLatency = &latencyRecorder{}
+
+func init() {
+	expvar.Publish("changeLatency", expvar.Func(func() interface{} {
+		var slo config.LatencySLOCfg
+		if cfg := config.GetConfig(); cfg != nil {
+			slo = cfg.ServerConfig.ChangeLatencySLO
+		}
+		return newLatencyReport(changeLatency, slo, time.Now())
+	}))
+}
+
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// latencyRecorder keeps the latest maxLatencySamples latencies, oldest first from next once it has wrapped around
+type latencyRecorder struct {
+	mutex   sync.Mutex
+	samples []latencySample
+	next    int
+}
+
+func (recorder *latencyRecorder) record(at time.Time, latency time.Duration) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	sample := latencySample{at: at, latency: latency}
+	if len(recorder.samples) < maxLatencySamples {
+		recorder.samples = append(recorder.samples, sample)
+		return
+	}
+	recorder.samples[recorder.next] = sample
+	recorder.next = (recorder.next + 1) % maxLatencySamples
+}
+
+// since returns the latencies recorded at or after the cutoff, sorted
+func (recorder *latencyRecorder) since(cutoff time.Time) []time.Duration {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	latencies := []time.Duration{}
+	for _, sample := range recorder.samples {
+		if !sample.at.Before(cutoff) {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies
+}
+
+// latencyReport is the Data of Admin.GetLatencyReport. Latencies are in milliseconds.
+type latencyReport struct {
+	Window    string
+	Changes   int // The number of changes the report covers
+	P50       float64
+	P95       float64
+	P99       float64
+	Max       float64
+	Threshold string
+	Target    float64
+	// The fraction of the changes that took at most Threshold; 1 if there were none
+	WithinThreshold float64
+	Met             bool
+	// The fraction of the slow changes the objective allows that remain; negative once it has been missed
+	ErrorBudgetRemaining float64
+}
+
+func newLatencyReport(recorder *latencyRecorder, slo config.LatencySLOCfg, now time.Time) latencyReport {
+	threshold, window, err := slo.Durations()
+	if err != nil {
+		utils.LogError("Invalid change latency objective", err, utils.LogFields{
+			"Threshold": slo.Threshold,
+			"Window":    slo.Window,
+		})
+		threshold, window, _ = config.LatencySLOCfg{}.Durations()
+	}
+	latencies := recorder.since(now.Add(-window))
+
+	report := latencyReport{
+		Window:          window.String(),
+		Changes:         len(latencies),
+		Threshold:       threshold.String(),
+		Target:          slo.TargetFraction(),
+		WithinThreshold: 1,
+	}
+	if len(latencies) > 0 {
+		report.P50 = milliseconds(percentile(latencies, 0.50))
+		report.P95 = milliseconds(percentile(latencies, 0.95))
+		report.P99 = milliseconds(percentile(latencies, 0.99))
+		report.Max = milliseconds(latencies[len(latencies)-1])
+
+		within := sort.Search(len(latencies), func(i int) bool { return latencies[i] > threshold })
+		report.WithinThreshold = float64(within) / float64(len(latencies))
+	}
+	report.Met = report.WithinThreshold >= report.Target
+	if allowed := 1 - report.Target; allowed > 0 {
+		report.ErrorBudgetRemaining = 1 - (1-report.WithinThreshold)/allowed
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// timeChangeNotification has the latency of the change recorded once its notification has been published
+func timeChangeNotification(closures []dhClosure, received time.Time) {
+	for i, closure := range closures {
+		notification, ok := closure.(toRabbitChannelClosure)
+		if !ok || notification.event != "File.Change" {
+			continue
+		}
+		notification.published = func() {
+			now := time.Now()
+			changeLatency.record(now, now.Sub(received))
+		}
+		closures[i] = notification
+	}
+}
+
+// timeChange has the latency of the File.Change recorded, from when its message was received
+func timeChange(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		closures, err := next(dh, call, db)
+		timeChangeNotification(closures, call.received)
+		return closures, err
+	}
+}
+
+// Admin.GetLatencyReport
+type adminGetLatencyReportRequest struct {
+	abstractRequest
+}
+
+func (a *adminGetLatencyReportRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminGetLatencyReportRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    a.Tag,
+		Data:   newLatencyReport(changeLatency, a.config().ServerConfig.ChangeLatencySLO, time.Now()),
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
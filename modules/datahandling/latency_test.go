@@ -0,0 +1,100 @@
+package datahandling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyReport(t *testing.T) {
+	now := time.Now()
+	recorder := &latencyRecorder{}
+	recorder.record(now.Add(-2*time.Hour), time.Hour) // Outside the window
+	for i := 1; i <= 100; i++ {
+		recorder.record(now.Add(-time.Minute), time.Duration(i)*time.Millisecond)
+	}
+
+	slo := config.LatencySLOCfg{Threshold: "95ms", Target: 0.9}
+	report := newLatencyReport(recorder, slo, now)
+	assert.Equal(t, 100, report.Changes)
+	assert.Equal(t, 50.0, report.P50)
+	assert.Equal(t, 95.0, report.P95)
+	assert.Equal(t, 99.0, report.P99)
+	assert.Equal(t, 100.0, report.Max)
+	assert.Equal(t, 0.95, report.WithinThreshold)
+	assert.True(t, report.Met)
+	assert.InDelta(t, 0.5, report.ErrorBudgetRemaining, 1e-9)
+
+	slo.Target = 0.99
+	report = newLatencyReport(recorder, slo, now)
+	assert.False(t, report.Met)
+	assert.True(t, report.ErrorBudgetRemaining < 0)
+
+	report = newLatencyReport(&latencyRecorder{}, config.LatencySLOCfg{}, now)
+	assert.Equal(t, 0, report.Changes)
+	assert.True(t, report.Met, "the objective is met when there were no changes")
+	assert.Equal(t, "100ms", report.Threshold)
+	assert.Equal(t, "1h0m0s", report.Window)
+}
+
+func TestLatencyRecorder_KeepsLatest(t *testing.T) {
+	recorder := &latencyRecorder{}
+	at := time.Now()
+	for i := 0; i < maxLatencySamples+10; i++ {
+		recorder.record(at, time.Duration(i))
+	}
+	latencies := recorder.since(at)
+	require.Len(t, latencies, maxLatencySamples)
+	assert.Equal(t, time.Duration(10), latencies[0], "the oldest samples should have been replaced")
+}
+
+func TestTimeChangeNotification(t *testing.T) {
+	defer func(recorder *latencyRecorder) {
+		changeLatency = recorder
+	}(changeLatency)
+	changeLatency = &latencyRecorder{}
+	not := messages.Notification{Resource: "File", Method: "Change", ResourceID: 1}.Wrap()
+	closures := []dhClosure{
+		toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, 1)},
+		projectNotificationClosure(1, 1, not),
+	}
+	timeChangeNotification(closures, time.Now().Add(-time.Second))
+
+	messageChan := make(chan rabbitmq.AMQPMessage, 1)
+	dh := DataHandler{MessageChan: messageChan, Db: dbfs.NewDBMock()}
+	require.NoError(t, closures[1].call(dh))
+	msg := <-messageChan
+	require.NotNil(t, msg.Published)
+	assert.Empty(t, changeLatency.since(time.Time{}), "the latency should only be recorded once it is published")
+
+	msg.Published()
+	latencies := changeLatency.since(time.Time{})
+	require.Len(t, latencies, 1)
+	assert.True(t, latencies[0] >= time.Second)
+}
+
+func TestAdminGetLatencyReport(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+
+	req := adminGetLatencyReportRequest{}
+	setBaseFields(&req)
+	req.Resource = "Admin"
+	req.Method = "GetLatencyReport"
+	res, _ := processForTest(t, &req, dbfs.NewDBMock())
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	serverCfg.Admins = []string{req.SenderID}
+	res, _ = processForTest(t, &req, dbfs.NewDBMock())
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.IsType(t, latencyReport{}, res.Data)
+}
@@ -0,0 +1,171 @@
+package datahandling
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+/**
+ * Projects preserve their files' line endings as written, unless their line-ending policy is LF. Then, file contents
+ * are stored with LF line endings whatever the platform of the client that wrote them, so that saving a file on
+ * Windows doesn't rewrite every line of it.
+ *
+ * Clients that edit with CRLF line endings declare it with LineEndings: "CRLF" on File.Create, File.Change and
+ * File.Pull. The patches they send are converted to LF before they are stored, and the contents and patches they are
+ * sent back are converted to CRLF. Notifications carry the stored LF patches, which such clients convert against their
+ * own copy of the file with patching.Patch.ConvertToCRLF.
+ *
+ * Files that already held CRLF line endings when the policy was set are left as they are, since converting them would
+ * invalidate every patch made against them.
+ */
+
+// Line endings that projects may store files with, besides "Preserve", and that clients may declare
+const (
+	lineEndingsLF   = "LF"
+	lineEndingsCRLF = "CRLF"
+)
+
+// errBaseVersionUnavailable is returned when a patch is based on a version of the file that has been scrunched
+var errBaseVersionUnavailable = errors.New("The version the patch is based on is no longer available")
+
+// normalizesLineEndings returns true if the project stores its files with LF line endings
+func normalizesLineEndings(projectID int64, db dbfs.DBFS) (bool, error) {
+	policy, err := db.MySQLProjectGetLineEndings(projectID)
+	return policy == lineEndingsLF, err
+}
+
+// toLF replaces CRLF line endings with LF
+func toLF(text string) string {
+	return strings.Replace(text, "\r\n", "\n", -1)
+}
+
+// toCRLF replaces the LF line endings of LF text with CRLF
+func toCRLF(text string) string {
+	return strings.Replace(text, "\n", "\r\n", -1)
+}
+
+// lfHistory is the LF text of a file, and the patches stored since, from which the text at any of those versions can
+// be rebuilt to convert patches against
+type lfHistory struct {
+	text    string
+	patches []*patching.Patch
+}
+
+// loadLFHistory returns the history of a file that is stored with LF line endings, or nil if the file's line endings
+// are preserved as written
+func loadLFHistory(file dbfs.FileMeta, db dbfs.DBFS) (*lfHistory, error) {
+	normalized, err := normalizesLineEndings(file.ProjectID, db)
+	if err != nil || !normalized {
+		return nil, err
+	}
+
+	raw, changes, err := db.PullFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return newLFHistory(*raw, changes)
+}
+
+// newLFHistory returns the history of a file in a project that normalizes line endings, from its stored contents and
+// the patches stored since, or nil if the file holds CRLF line endings
+func newLFHistory(raw []byte, changes []string) (*lfHistory, error) {
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &lfHistory{text: string(raw), patches: patches}
+	if latest, err := patching.PatchText(history.text, patches); err != nil || strings.Contains(latest, "\r\n") {
+		// Written before the policy was set
+		return nil, err
+	}
+	return history, nil
+}
+
+// textAt returns the file's text at the given version
+func (history *lfHistory) textAt(version int64) (string, error) {
+	if len(history.patches) > 0 && version < history.patches[0].BaseVersion {
+		return "", errBaseVersionUnavailable
+	}
+	applied := 0
+	for applied < len(history.patches) && history.patches[applied].BaseVersion < version {
+		applied++
+	}
+	return patching.PatchText(history.text, history.patches[:applied])
+}
+
+// record adds a stored patch to the history, unless the history already has it
+func (history *lfHistory) record(patchStr string) error {
+	patch, err := patching.NewPatchFromString(patchStr)
+	if err != nil {
+		return err
+	}
+	if n := len(history.patches); n > 0 && patch.BaseVersion <= history.patches[n-1].BaseVersion {
+		return nil
+	}
+	history.patches = append(history.patches, patch)
+	return nil
+}
+
+// fromCRLF converts a patch made against the CRLF text of the file to LF
+func (history *lfHistory) fromCRLF(patchStr string) (string, error) {
+	patch, err := patching.NewPatchFromString(patchStr)
+	if err != nil {
+		return "", err
+	}
+	base, err := history.textAt(patch.BaseVersion)
+	if err != nil {
+		return "", err
+	}
+	return patch.ConvertToLF(toCRLF(base)).String(), nil
+}
+
+// toCRLF converts a stored patch to apply to the CRLF text of the file
+func (history *lfHistory) toCRLF(patchStr string) (string, error) {
+	patch, err := patching.NewPatchFromString(patchStr)
+	if err != nil {
+		return "", err
+	}
+	base, err := history.textAt(patch.BaseVersion)
+	if err != nil {
+		return "", err
+	}
+	crlfBase := toCRLF(base)
+	converted := patch.ConvertToCRLF(crlfBase)
+	// ConvertToCRLF counts the document's length as if its base were LF text
+	converted.DocLength = utf8.RuneCountInString(crlfBase)
+	return converted.String(), nil
+}
+
+// allToCRLF converts stored patches to apply to the CRLF text of the file
+func (history *lfHistory) allToCRLF(patchStrs []string) ([]string, error) {
+	converted := make([]string, len(patchStrs))
+	for i, patchStr := range patchStrs {
+		var err error
+		if converted[i], err = history.toCRLF(patchStr); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// changeToCRLF converts the response to a change: the client's patch as it was stored, and the stored patches the
+// client had not seen, which may include some stored after the history was read
+func (history *lfHistory) changeToCRLF(changes string, missing []string) (string, []string, error) {
+	for _, patchStr := range append(append([]string{}, missing...), changes) {
+		if err := history.record(patchStr); err != nil {
+			return "", nil, err
+		}
+	}
+
+	convertedMissing, err := history.allToCRLF(missing)
+	if err != nil {
+		return "", nil, err
+	}
+	converted, err := history.toCRLF(changes)
+	return converted, convertedMissing, err
+}
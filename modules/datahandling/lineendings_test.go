@@ -0,0 +1,133 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processForTest processes the request, returning its response and the notification it sends, if any
+func processForTest(t *testing.T, req request, db dbfs.DBFS) (messages.Response, *messages.Notification) {
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	res := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	if len(closures) < 2 {
+		return res, nil
+	}
+	not := closures[1].(toRabbitChannelClosure).msg.ServerMessage.(messages.Notification)
+	return res, &not
+}
+
+func TestLineEndings_Normalized(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	setPolicy := projectSetLineEndingsRequest{ProjectID: projectID, LineEndings: "LF"}
+	setBaseFields(&setPolicy)
+	setPolicy.Resource = "Project"
+	setPolicy.Method = "SetLineEndings"
+	res, not := processForTest(t, &setPolicy, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, "LF", reflect.ValueOf(not.Data).FieldByName("LineEndings").String())
+
+	create := fileCreateRequest{Name: "file", ProjectID: projectID, FileBytes: []byte("one\r\ntwo\r\n"), LineEndings: "CRLF"}
+	setBaseFields(&create)
+	create.Resource = "File"
+	create.Method = "Create"
+	res, _ = processForTest(t, &create, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	fileID := reflect.ValueOf(res.Data).FieldByName("FileID").Int()
+	assert.Equal(t, "one\ntwo\n", string(*db.File), "contents should be stored with LF line endings")
+
+	// "x" inserted at the start of the second line of the CRLF text
+	change := fileChangeRequest{FileID: fileID, Changes: "v1:\n5:+1:x:\n10", LineEndings: "CRLF"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+	res, not = processForTest(t, &change, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []string{"v1:\n4:+1:x:\n8"}, allWithoutAuthorship(t, db.FileChanges[fileID]), "the patch should be stored against the LF text")
+	assert.Equal(t, "v1:\n5:+1:x:\n10", withoutAuthorship(t, reflect.ValueOf(res.Data).FieldByName("Changes").String()))
+	assert.Equal(t, "CRLF", reflect.ValueOf(res.Data).FieldByName("LineEndings").String())
+	assert.Equal(t, "v1:\n4:+1:x:\n8", withoutAuthorship(t, reflect.ValueOf(not.Data).FieldByName("Changes").String()))
+
+	// Clients that don't declare their line endings are sent the stored patches
+	change = fileChangeRequest{FileID: fileID, Changes: "v2:\n9:+1:y:\n9"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+	res, _ = processForTest(t, &change, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, "v2:\n9:+1:y:\n9", withoutAuthorship(t, reflect.ValueOf(res.Data).FieldByName("Changes").String()))
+	assert.Equal(t, "", reflect.ValueOf(res.Data).FieldByName("LineEndings").String())
+
+	pull := filePullRequest{FileID: fileID, LineEndings: "CRLF"}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := reflect.ValueOf(res.Data)
+	assert.Equal(t, "one\r\ntwo\r\n", string(data.FieldByName("FileBytes").Bytes()))
+	assert.Equal(t, []string{"v1:\n5:+1:x:\n10", "v2:\n11:+1:y:\n11"}, allWithoutAuthorship(t, data.FieldByName("Changes").Interface()))
+	assert.Equal(t, "CRLF", data.FieldByName("LineEndings").String())
+
+	pull.Materialize = true
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data = reflect.ValueOf(res.Data)
+	assert.Equal(t, "one\r\nxtwo\r\ny", string(data.FieldByName("FileBytes").Bytes()))
+	assert.Empty(t, data.FieldByName("Changes").Interface())
+
+	// A patch based on a version that was scrunched can't be converted
+	db.FileChanges[fileID] = db.FileChanges[fileID][1:]
+	*db.File = []byte("one\nxtwo\n")
+	change = fileChangeRequest{FileID: fileID, Changes: "v1:\n0:+1:z:\n10", LineEndings: "CRLF"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+	closures, _ := change.process(db)
+	assert.Equal(t, messages.StatusVersionOutOfDate, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
+
+func TestLineEndings_Preserved(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	create := fileCreateRequest{Name: "file", ProjectID: projectID, FileBytes: []byte("one\r\ntwo\r\n"), LineEndings: "CRLF"}
+	setBaseFields(&create)
+	create.Resource = "File"
+	create.Method = "Create"
+	res, _ := processForTest(t, &create, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	fileID := reflect.ValueOf(res.Data).FieldByName("FileID").Int()
+	assert.Equal(t, "one\r\ntwo\r\n", string(*db.File))
+
+	change := fileChangeRequest{FileID: fileID, Changes: "v1:\n5:+1:x:\n10", LineEndings: "CRLF"}
+	setBaseFields(&change)
+	change.Resource = "File"
+	change.Method = "Change"
+	res, _ = processForTest(t, &change, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []string{"v1:\n5:+1:x:\n10"}, allWithoutAuthorship(t, db.FileChanges[fileID]))
+	assert.Equal(t, "", reflect.ValueOf(res.Data).FieldByName("LineEndings").String())
+
+	// Files that held CRLF line endings before the project was normalized are left as they are
+	require.NoError(t, db.MySQLProjectSetLineEndings(projectID, "LF"))
+	pull := filePullRequest{FileID: fileID, LineEndings: "CRLF"}
+	setBaseFields(&pull)
+	pull.Resource = "File"
+	pull.Method = "Pull"
+	res, _ = processForTest(t, &pull, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []string{"v1:\n5:+1:x:\n10"}, allWithoutAuthorship(t, reflect.ValueOf(res.Data).FieldByName("Changes").Interface()))
+	assert.Equal(t, "", reflect.ValueOf(res.Data).FieldByName("LineEndings").String())
+}
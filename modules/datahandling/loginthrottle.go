@@ -0,0 +1,200 @@
+package datahandling
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Failed User.Login attempts are counted against the account they were for and the address they came from. Once
+ * either has failed too many times in a row, logins to that account, or from that address, are refused with
+ * StatusTooManyAttempts until the lockout passes, without checking the password; each further failure doubles the
+ * lockout, up to the configured maximum. A successful login clears its account's count, but not its address's, so
+ * that one account the attacker controls can't be used to keep guessing at others. Admins can clear either with
+ * Admin.UnlockLogin.
+ *
+ * Counts are kept by the server that received the attempts, so a client spreading its guesses across servers gets a
+ * proportionally larger budget.
+ *
+ * User.RequestPasswordReset, which anyone can make, is throttled the same way, with the same settings, but separately:
+ * every request counts as a failure, so that the reset emails can't be used to flood an account's inbox, until the
+ * account's password is reset.
+ */
+
+// errLoginThrottled is returned by Login when the account or address is locked out
+var errLoginThrottled = errors.New("too many failed login attempts")
+
+// errPasswordResetThrottled is returned by RequestPasswordReset when the account or address is locked out
+var errPasswordResetThrottled = errors.New("too many password reset requests")
+
+// loginThrottles counts failed logins on this server
+var loginThrottles = &loginThrottle{failures: make(map[string]*loginFailures)}
+
+// passwordResetThrottles counts password reset requests on this server
+var passwordResetThrottles = &loginThrottle{failures: make(map[string]*loginFailures)}
+
+// tooManyAttemptsResponse is the Data of a StatusTooManyAttempts response
+type tooManyAttemptsResponse struct {
+	RetryAfter int64 // Seconds until another attempt will be considered
+}
+
+func newTooManyAttemptsResponse(tag int64, retryAfter time.Duration) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusTooManyAttempts,
+		Tag:    tag,
+		Data: tooManyAttemptsResponse{
+			RetryAfter: int64(math.Ceil(retryAfter.Seconds())),
+		},
+	}.Wrap()
+}
+
+func accountThrottleKey(username string) string {
+	return "user:" + username
+}
+
+func addressThrottleKey(remoteAddr string) string {
+	return "addr:" + remoteAddr
+}
+
+// loginThrottleSettings returns the configured thresholds and lockouts, and whether throttling is enabled
+func loginThrottleSettings(cfg config.LoginThrottleCfg) (maxFailures, ipMaxFailures int, lockout,
+	maxLockout time.Duration, enabled bool) {
+	if cfg.Disabled {
+		return 0, 0, 0, 0, false
+	}
+	maxFailures, ipMaxFailures = cfg.MaxFailures, cfg.IPMaxFailures
+	if maxFailures <= 0 {
+		maxFailures = 5
+	}
+	if ipMaxFailures <= 0 {
+		ipMaxFailures = 20
+	}
+	lockout, maxLockout, err := cfg.LockoutDurations()
+	if err != nil {
+		utils.LogError("Invalid login lockout; using the defaults", err, utils.LogFields{
+			"Lockout":    cfg.Lockout,
+			"MaxLockout": cfg.MaxLockout,
+		})
+		lockout, maxLockout, _ = config.LoginThrottleCfg{}.LockoutDurations()
+	}
+	return maxFailures, ipMaxFailures, lockout, maxLockout, true
+}
+
+// loginFailures is the failed logins of an account or address since its last success
+type loginFailures struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// loginThrottle counts failed logins by account and address
+type loginThrottle struct {
+	mutex    sync.Mutex
+	failures map[string]*loginFailures
+	pruned   time.Time
+}
+
+// lockedFor returns how much longer logins to the account, or from the address, are refused; 0 if they are not
+func (throttle *loginThrottle) lockedFor(cfg config.LoginThrottleCfg, username string, remoteAddr string,
+	now time.Time) time.Duration {
+	if _, _, _, _, enabled := loginThrottleSettings(cfg); !enabled {
+		return 0
+	}
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	var longest time.Duration
+	for _, key := range throttle.keys(username, remoteAddr) {
+		if failures, ok := throttle.failures[key]; ok && failures.lockedUntil.After(now) {
+			if remaining := failures.lockedUntil.Sub(now); remaining > longest {
+				longest = remaining
+			}
+		}
+	}
+	return longest
+}
+
+// fail counts a failed login to the account from the address, locking either out once it has failed too many times
+func (throttle *loginThrottle) fail(cfg config.LoginThrottleCfg, username string, remoteAddr string, now time.Time) {
+	maxFailures, ipMaxFailures, lockout, maxLockout, enabled := loginThrottleSettings(cfg)
+	if !enabled {
+		return
+	}
+
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	throttle.prune(now, maxLockout)
+	for _, key := range throttle.keys(username, remoteAddr) {
+		threshold := maxFailures
+		if key != accountThrottleKey(username) {
+			threshold = ipMaxFailures
+		}
+
+		failures, ok := throttle.failures[key]
+		if !ok {
+			failures = &loginFailures{}
+			throttle.failures[key] = failures
+		}
+		failures.count++
+		failures.lastFailure = now
+		if failures.count >= threshold {
+			failures.lockedUntil = now.Add(lockoutAfter(failures.count-threshold, lockout, maxLockout))
+		}
+	}
+}
+
+// lockoutAfter doubles the lockout for each failure past the threshold, up to maxLockout
+func lockoutAfter(extraFailures int, lockout, maxLockout time.Duration) time.Duration {
+	for i := 0; i < extraFailures && lockout < maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxLockout {
+		return maxLockout
+	}
+	return lockout
+}
+
+// succeed clears the account's failed logins
+func (throttle *loginThrottle) succeed(username string) {
+	throttle.unlock(accountThrottleKey(username))
+}
+
+// unlock clears the failed logins of the given key, returning whether there were any
+func (throttle *loginThrottle) unlock(key string) bool {
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	_, ok := throttle.failures[key]
+	delete(throttle.failures, key)
+	return ok
+}
+
+// keys returns the keys a login is counted against; the address is skipped if it is unknown
+func (throttle *loginThrottle) keys(username string, remoteAddr string) []string {
+	keys := []string{accountThrottleKey(username)}
+	if remoteAddr != "" {
+		keys = append(keys, addressThrottleKey(remoteAddr))
+	}
+	return keys
+}
+
+// prune forgets accounts and addresses that have not failed for maxLockout, at most once a second
+func (throttle *loginThrottle) prune(now time.Time, maxLockout time.Duration) {
+	if now.Sub(throttle.pruned) < time.Second {
+		return
+	}
+	for key, failures := range throttle.failures {
+		if !failures.lockedUntil.After(now) && now.Sub(failures.lastFailure) >= maxLockout {
+			delete(throttle.failures, key)
+		}
+	}
+	throttle.pruned = now
+}
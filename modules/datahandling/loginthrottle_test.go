@@ -0,0 +1,121 @@
+package datahandling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.LoginThrottleCfg) {
+		serverCfg.LoginThrottle = cfg
+	}(serverCfg.LoginThrottle)
+	serverCfg.LoginThrottle = config.LoginThrottleCfg{MaxFailures: 3, IPMaxFailures: 4, Lockout: "10s", MaxLockout: "35s"}
+
+	throttle := &loginThrottle{failures: make(map[string]*loginFailures)}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		throttle.fail(serverCfg.LoginThrottle, "alice", "10.0.0.1", now)
+	}
+	assert.Zero(t, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "10.0.0.1", now))
+
+	// The third failure locks out the account, and each later one doubles the lockout, up to the maximum
+	throttle.fail(serverCfg.LoginThrottle, "alice", "10.0.0.1", now)
+	assert.Equal(t, 10*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "", now))
+	assert.Equal(t, 5*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "", now.Add(5*time.Second)))
+	assert.Zero(t, throttle.lockedFor(serverCfg.LoginThrottle, "bob", "10.0.0.2", now))
+
+	// The fourth locks out the address too, for any account
+	throttle.fail(serverCfg.LoginThrottle, "alice", "10.0.0.1", now)
+	assert.Equal(t, 20*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "", now))
+	assert.Equal(t, 10*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "bob", "10.0.0.1", now))
+
+	throttle.fail(serverCfg.LoginThrottle, "alice", "10.0.0.1", now)
+	assert.Equal(t, 35*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "", now))
+
+	// Success clears the account, but not the address
+	throttle.succeed("alice")
+	assert.Zero(t, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "", now))
+	assert.Equal(t, 20*time.Second, throttle.lockedFor(serverCfg.LoginThrottle, "alice", "10.0.0.1", now))
+	assert.True(t, throttle.unlock(addressThrottleKey("10.0.0.1")))
+	assert.False(t, throttle.unlock(addressThrottleKey("10.0.0.1")))
+
+	// Failures are forgotten once the maximum lockout has passed without any
+	throttle.fail(serverCfg.LoginThrottle, "bob", "", now)
+	throttle.fail(serverCfg.LoginThrottle, "carol", "", now.Add(36*time.Second))
+	assert.NotContains(t, throttle.failures, accountThrottleKey("bob"))
+	assert.Contains(t, throttle.failures, accountThrottleKey("carol"))
+
+	serverCfg.LoginThrottle.Disabled = true
+	for i := 0; i < 5; i++ {
+		throttle.fail(serverCfg.LoginThrottle, "dave", "", now)
+	}
+	assert.Zero(t, throttle.lockedFor(serverCfg.LoginThrottle, "dave", "", now))
+}
+
+func TestUserLoginRequest_ProcessThrottled(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.LoginThrottleCfg, admins []string) {
+		serverCfg.LoginThrottle = cfg
+		serverCfg.Admins = admins
+	}(serverCfg.LoginThrottle, serverCfg.Admins)
+	serverCfg.LoginThrottle = config.LoginThrottleCfg{MaxFailures: 2, IPMaxFailures: 100, Lockout: "1m"}
+
+	user := geneMeta
+	user.Username = "throttled"
+	hashed, err := auth.HashPassword(nil, user.Password)
+	require.NoError(t, err)
+	user.Password = hashed
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(user)
+	defer loginThrottles.unlock(accountThrottleKey(user.Username))
+	defer loginThrottles.unlock(addressThrottleKey("192.0.2.7"))
+
+	login := func(password string) messages.Response {
+		req := userLoginRequest{Username: "Throttled", Password: password}
+		setBaseFields(&req)
+		req.Resource = "User"
+		req.Method = "Login"
+		req.remoteAddr = "192.0.2.7"
+		closures, _ := req.process(db)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+	assert.Equal(t, messages.StatusUnauthorized, login("hunter2").Status)
+	assert.Equal(t, messages.StatusUnauthorized, login("hunter2").Status)
+
+	// Even the right password is refused while locked out, and the password is not checked
+	db.FunctionCallCount = 0
+	res := login(geneMeta.Password)
+	assert.Equal(t, messages.StatusTooManyAttempts, res.Status)
+	assert.Equal(t, tooManyAttemptsResponse{RetryAfter: 60}, res.Data)
+	assert.Equal(t, 0, db.FunctionCallCount)
+
+	unlock := adminUnlockLoginRequest{Username: "throttled"}
+	setBaseFields(&unlock)
+	unlock.Resource = "Admin"
+	unlock.Method = "UnlockLogin"
+	res, _ = processForTest(t, &unlock, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	serverCfg.Admins = []string{unlock.SenderID}
+	res, _ = processForTest(t, &unlock, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, struct {
+		Cleared bool
+	}{true}, res.Data)
+
+	assert.Equal(t, messages.StatusSuccess, login(geneMeta.Password).Status)
+
+	res, _ = processForTest(t, &adminUnlockLoginRequest{abstractRequest: unlock.abstractRequest}, db)
+	assert.Equal(t, messages.StatusFail, res.Status)
+}
@@ -0,0 +1,201 @@
+package datahandling
+
+import (
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * In maintenance mode, such as while the databases are being migrated, the server refuses requests that change
+ * anything with StatusMaintenance, and only processes those in maintenanceAllowedMethods, which read, log in, and
+ * manage subscriptions, along with admin requests. Notifications, including those queued for connections that
+ * resume their session, are still delivered.
+ *
+ * Admins put every server into maintenance mode, or take them out of it, with Admin.SetMaintenance, which is stored
+ * in MySQL and announced to every connected client with a Server.Maintenance notification. The server the request
+ * was made on applies it at once, and the others on their next instance heartbeat; see instances.go. A server can
+ * also be started in maintenance mode with the Maintenance setting of its config, which is not announced.
+ */
+
+// defaultMaintenanceMessage is the reason given for refused requests if admins didn't give one
+const defaultMaintenanceMessage = "The server is down for maintenance"
+
+// maintenanceAllowedMethods are the requests, besides admin requests, processed in maintenance mode. Logins are
+// allowed so that users can still read their projects, though they may record the login, or the account of a new
+// external identity.
+var maintenanceAllowedMethods = map[string]bool{
+	"Comment.List":                   true,
+	"File.Annotate":                  true,
+	"File.Diff":                      true,
+	"File.GetHistory":                true,
+	"File.GetMetadata":               true,
+	"File.Pull":                      true,
+	"File.Search":                    true,
+	"Notification.GetAcks":           true,
+	"Project.GetFiles":               true,
+	"Project.GetIgnoreRules":         true,
+	"Project.GetNotificationsSince":  true,
+	"Project.GetOnlineClients":       true,
+	"Project.GetPermissionConstants": true,
+	"Project.GetSettings":            true,
+	"Project.ListRoles":              true,
+	"Project.Lookup":                 true,
+	"Project.Search":                 true,
+	"Project.Subscribe":              true,
+	"Project.Sync":                   true,
+	"Project.Unsubscribe":            true,
+	"Session.Resume":                 true,
+	"User.ExportData":                true,
+	"User.GetAvatar":                 true,
+	"User.GetNotificationPrefs":      true,
+	"User.ListSessions":              true,
+	"User.Login":                     true,
+	"User.LoginExternal":             true,
+	"User.Lookup":                    true,
+	"User.Projects":                  true,
+	"User.Search":                    true,
+}
+
+// storedMaintenance is the maintenance mode admins last set, as this server last read it
+var storedMaintenance = &maintenanceState{}
+
+type maintenanceState struct {
+	mutex       sync.Mutex
+	maintenance dbfs.MaintenanceMeta
+}
+
+func (state *maintenanceState) get() dbfs.MaintenanceMeta {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	return state.maintenance
+}
+
+func (state *maintenanceState) set(maintenance dbfs.MaintenanceMeta) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	if state.maintenance.Enabled != maintenance.Enabled {
+		utils.LogInfo("Maintenance mode changed", utils.LogFields{
+			"Enabled": maintenance.Enabled,
+			"SetBy":   maintenance.SetBy,
+		})
+	}
+	state.maintenance = maintenance
+}
+
+// InMaintenance returns whether the server with the config is in maintenance mode, either because admins set it or
+// because of its config, and the reason to give for refused requests
+func InMaintenance(cfg *config.Config) (bool, string) {
+	stored := storedMaintenance.get()
+	if !stored.Enabled && !cfg.ServerConfig.Maintenance {
+		return false, ""
+	}
+	if stored.Enabled && stored.Message != "" {
+		return true, stored.Message
+	}
+	return true, defaultMaintenanceMessage
+}
+
+// refreshMaintenance reads the maintenance mode admins last set from MySQL
+func refreshMaintenance(db dbfs.DBFS) error {
+	maintenance, err := db.MySQLMaintenanceGet()
+	if err != nil {
+		return err
+	}
+	storedMaintenance.set(maintenance)
+	return nil
+}
+
+// maintenanceResponse returns the response refusing the request if the server is in maintenance mode and the request
+// may change something, or nil if it may be processed
+func maintenanceResponse(req *abstractRequest) *messages.ServerMessageWrapper {
+	method := req.Resource + "." + req.Method
+	if maintenanceAllowedMethods[method] || req.Resource == "Admin" {
+		return nil
+	}
+	maintenance, reason := InMaintenance(req.config())
+	if !maintenance {
+		return nil
+	}
+	return messages.Response{
+		Status: messages.StatusMaintenance,
+		Tag:    req.Tag,
+		Data: struct {
+			Reason    string
+			Retryable bool
+		}{
+			Reason:    reason,
+			Retryable: true,
+		},
+	}.Wrap()
+}
+
+// refuseDuringMaintenance answers requests that may change something with StatusMaintenance, while the server is in
+// maintenance mode
+func refuseDuringMaintenance(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		if refused := maintenanceResponse(call.req); refused != nil {
+			return []dhClosure{toSenderClosure{msg: refused}}, nil
+		}
+		return next(dh, call, db)
+	}
+}
+
+// Admin.SetMaintenance puts every server into maintenance mode, or takes them out of it
+type adminSetMaintenanceRequest struct {
+	Enabled bool
+	Message string `validate:"max=1024"` // Shown to users; defaults to defaultMaintenanceMessage
+	abstractRequest
+}
+
+func (a *adminSetMaintenanceRequest) setAbstractRequest(req *abstractRequest) {
+	a.abstractRequest = *req
+}
+
+func (a adminSetMaintenanceRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if !isServerAdmin(a.config(), a.SenderID) {
+		utils.LogError("API permission error", errNotAdmin, utils.LogFields{
+			"Resource": a.Resource,
+			"Method":   a.Method,
+			"SenderID": a.SenderID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, a.Tag)}}, nil
+	}
+
+	maintenance := dbfs.MaintenanceMeta{
+		Enabled: a.Enabled,
+		Message: a.Message,
+		SetBy:   a.SenderID,
+	}
+	if err := db.MySQLMaintenanceSet(maintenance); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, a.Tag)}}, err
+	}
+	storedMaintenance.set(maintenance)
+
+	message := a.Message
+	if a.Enabled && message == "" {
+		message = defaultMaintenanceMessage
+	}
+	not := messages.Notification{
+		Resource: "Server",
+		Method:   "Maintenance",
+		Data: struct {
+			Enabled bool
+			Message string
+		}{
+			Enabled: a.Enabled,
+			Message: message,
+		},
+	}.Wrap()
+
+	return []dhClosure{
+		toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, a.Tag)},
+		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitBroadcastKey, includeSender: true},
+	}, nil
+}
@@ -0,0 +1,104 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenance_RefusesChanges(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(maintenance bool) {
+		serverCfg.Maintenance = maintenance
+	}(serverCfg.Maintenance)
+	serverCfg.Maintenance = true
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	handle := func(resource, method, data string) (int, string) {
+		messageChan := make(chan rabbitmq.AMQPMessage, 8)
+		dh := DataHandler{MessageChan: messageChan, Db: db}
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		dh.Handle(0, []byte(fmt.Sprintf(
+			`{"Tag": 1, "Resource": %q, "Method": %q, "SenderID": "loganga", "SenderToken": %q, "Data": %s}`,
+			resource, method, testToken(t, "loganga"), data)), wg)
+		require.Len(t, messageChan, 1)
+		var res struct {
+			ServerMessage struct {
+				Status int
+				Data   struct {
+					Reason    string
+					Retryable bool
+				}
+			}
+		}
+		require.NoError(t, json.Unmarshal((<-messageChan).Message, &res))
+		if res.ServerMessage.Status == messages.StatusMaintenance {
+			assert.True(t, res.ServerMessage.Data.Retryable)
+		}
+		return res.ServerMessage.Status, res.ServerMessage.Data.Reason
+	}
+
+	status, reason := handle("Project", "Create", `{"Name": "hi"}`)
+	assert.Equal(t, messages.StatusMaintenance, status)
+	assert.Equal(t, defaultMaintenanceMessage, reason)
+	assert.Empty(t, db.Projects["loganga"], "the project should not have been created")
+
+	status, _ = handle("User", "Lookup", `{"Usernames": ["loganga"]}`)
+	assert.Equal(t, messages.StatusSuccess, status, "reads should still be processed")
+
+	serverCfg.Maintenance = false
+	status, _ = handle("Project", "Create", `{"Name": "hi"}`)
+	assert.Equal(t, messages.StatusSuccess, status)
+}
+
+func TestAdminSetMaintenance(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+	defer storedMaintenance.set(dbfs.MaintenanceMeta{})
+
+	db := dbfs.NewDBMock()
+	set := adminSetMaintenanceRequest{Enabled: true, Message: "Upgrading the database"}
+	setBaseFields(&set)
+	set.Resource = "Admin"
+	set.Method = "SetMaintenance"
+	res, _ := processForTest(t, &set, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+	assert.False(t, db.Maintenance.Enabled)
+
+	serverCfg.Admins = []string{set.SenderID}
+	closures, err := set.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	announcement := closures[1].(toRabbitChannelClosure)
+	assert.Equal(t, rabbitmq.RabbitBroadcastKey, announcement.key)
+	not := announcement.msg.ServerMessage.(messages.Notification)
+	assert.Equal(t, "Server.Maintenance", not.Resource+"."+not.Method)
+
+	assert.True(t, db.Maintenance.Enabled)
+	assert.Equal(t, "loganga", db.Maintenance.SetBy)
+	maintenance, reason := InMaintenance(config.GetConfig())
+	assert.True(t, maintenance, "the server the admin is connected to should enter maintenance mode immediately")
+	assert.Equal(t, "Upgrading the database", reason)
+
+	// Other servers pick it up on their next heartbeat
+	db.Maintenance.Enabled = false
+	require.NoError(t, refreshMaintenance(db))
+	maintenance, _ = InMaintenance(config.GetConfig())
+	assert.False(t, maintenance)
+}
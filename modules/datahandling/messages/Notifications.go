@@ -8,6 +8,10 @@ type Notification struct {
 	Method     string
 	ResourceID int64
 	Data       interface{}
+	// Sequence orders a project's notifications, so that clients can detect those they missed and fetch them with
+	// Project.GetNotificationsSince. It is 0 for notifications that are not sent to a project's subscribers, and for
+	// ephemeral ones.
+	Sequence int64 `json:",omitempty"`
 }
 
 // Wrap builds the server message wrapper for this Notification struct
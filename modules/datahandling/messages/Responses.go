@@ -62,6 +62,28 @@ const StatusNotFound int = 404
 // StatusVersionOutOfDate represents a state in which the client has an outdated version of the resource
 const StatusVersionOutOfDate int = 409 // (409 = conflict)
 
+// StatusConflict represents a request that would give a resource the same name as another; the response carries the
+// other resource's ID
+const StatusConflict int = 419 // (409 = conflict is taken by StatusVersionOutOfDate)
+
+// StatusQuotaExceeded represents a request that would take a project or user over their storage quota
+const StatusQuotaExceeded int = 413 // (413 = payload too large)
+
+// StatusFileRejected represents a file that the server's file policy does not allow, because of its size or type
+const StatusFileRejected int = 422 // (422 = unprocessable entity)
+
+// StatusArchived represents a request for the files of a project that is archived, or being archived or unarchived; the
+// response carries the project's archive state
+const StatusArchived int = 423 // (423 = locked)
+
+// StatusTooManyAttempts represents a login refused because of repeated failed attempts; the response carries the
+// number of seconds until the client may try again
+const StatusTooManyAttempts int = 429 // (429 = too many requests)
+
+// StatusConcurrencyLimited represents a request refused because the user has too many connections, or the connection
+// too many requests in progress; the response carries which limit was reached
+const StatusConcurrencyLimited int = 439 // (429 = too many requests is taken by StatusTooManyAttempts)
+
 // StatusPartialFail represents a partial failure in processing the request
 const StatusPartialFail int = 499
 
@@ -71,5 +93,9 @@ const StatusServFail int = 500
 // StatusUnimplemented represents a called method that has not yet been implemented
 const StatusUnimplemented = 501
 
+// StatusMaintenance represents a request refused because the server is in maintenance mode, in which only requests
+// that don't change anything are processed; the response carries the reason
+const StatusMaintenance int = 503 // (503 = service unavailable)
+
 // StatusServPartialFail represents an internal failure in processing part of the request.
 const StatusServPartialFail int = 599
@@ -0,0 +1,124 @@
+package datahandling
+
+import (
+	"context"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Handle runs each request through a chain of middleware, which wrap its processing with the checks and records it
+ * needs: each middleware is given the next processor in the chain, and returns one that may answer the request
+ * itself, or call the next one and add to, or change, the closures it returns. The chain is, outermost first:
+ *
+ *   requestMiddleware, which every request runs through, and which parses and authenticates it
+ *   methodMiddleware for the request's Resource.Method, registered alongside its constructor
+ *   admissionMiddleware, which decides whether the parsed request may be processed now
+ *
+ * with processRequest at the end.
+ */
+
+// requestCall is the request being handled, as it passes through the chain
+type requestCall struct {
+	req      *abstractRequest
+	message  []byte          // The message the request was parsed from
+	received time.Time       // When the message was received
+	ctx      context.Context // Done once the request is abandoned or times out; nil if it never is
+
+	full          request // The parsed request; set by parseRequest, if it succeeds
+	authenticated bool    // Whether the sender was authenticated; set by parseRequest
+}
+
+// context returns the context the request is processed in
+func (call *requestCall) context() context.Context {
+	if call.ctx == nil {
+		return context.Background()
+	}
+	return call.ctx
+}
+
+// processor handles the request, returning the closures that complete it
+type processor func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error)
+
+// middleware wraps a processor in another
+type middleware func(next processor) processor
+
+// requestMiddleware wraps every request, outermost first
+var requestMiddleware = []middleware{auditRequest, resolveExternalIDs, parseRequest}
+
+// methodMiddleware wraps requests to each Resource.Method, once they have been parsed, outermost first
+var methodMiddleware = make(map[string][]middleware)
+
+// admissionMiddleware wraps every parsed request, just before it is processed, outermost first
+var admissionMiddleware = []middleware{limitConnections, refuseDuringMaintenance, admitToLane}
+
+// chain wraps the processor in the middleware, the first of which is outermost
+func chain(final processor, middlewares ...[]middleware) processor {
+	var all []middleware
+	for _, m := range middlewares {
+		all = append(all, m...)
+	}
+	for i := len(all) - 1; i >= 0; i-- {
+		final = all[i](final)
+	}
+	return final
+}
+
+// requestChain returns the processor for requests to the method
+func requestChain(method string) processor {
+	return chain(processRequest, requestMiddleware, methodMiddleware[method], admissionMiddleware)
+}
+
+// parseRequest authenticates and parses the request, answering it itself if that fails
+func parseRequest(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		req := call.req
+		fullRequest, err := getFullRequest(req, db)
+		_, unauthenticated := unauthenticatedRequestMap[req.Resource+"."+req.Method]
+		call.authenticated = !unauthenticated && err != ErrAuthenticationFailed
+
+		if invalid, ok := err.(*requestValidationError); ok {
+			utils.LogDebug("Invalid request data", utils.LogFields{
+				"Resource": req.Resource,
+				"Method":   req.Method,
+				"Error":    invalid.Error(),
+			})
+			return []dhClosure{toSenderClosure{msg: newValidationErrorResponse(req.Tag, invalid)}}, err
+		} else if err != nil {
+			utils.LogError("getFullRequest failed", err, utils.LogFields{
+				"Request": string(call.message),
+			})
+			if err == ErrAuthenticationFailed || err == ErrForbiddenByToken {
+				utils.LogDebug("User not logged in", utils.LogFields{
+					"Resource": req.Resource,
+					"Method":   req.Method,
+				})
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, req.Tag)}}, err
+			}
+			utils.LogDebug("No such resource/method", utils.LogFields{
+				"Resource": req.Resource,
+				"Method":   req.Method,
+			})
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnimplemented, req.Tag)}}, err
+		}
+
+		call.full = fullRequest
+		return next(dh, call, db)
+	}
+}
+
+// processRequest processes the parsed request
+func processRequest(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+	closures, err := dh.processIdempotently(call.req, call.full, db)
+	if err != nil {
+		utils.LogError("Failed to process request", err, utils.LogFields{
+			"Resource": call.req.Resource,
+			"Method":   call.req.Method,
+		})
+		// TODO: forward error message onto client? (or at least inform that error occurred)
+	}
+	return closures, err
+}
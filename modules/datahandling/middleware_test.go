@@ -0,0 +1,84 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMiddleware appends its name to the order it is run in, before and after the processor it wraps
+func recordingMiddleware(name string, order *[]string) middleware {
+	return func(next processor) processor {
+		return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+			*order = append(*order, name)
+			closures, err := next(dh, call, db)
+			*order = append(*order, "/"+name)
+			return closures, err
+		}
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	order := []string{}
+	final := func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		order = append(order, "process")
+		return nil, nil
+	}
+
+	process := chain(final,
+		[]middleware{recordingMiddleware("a", &order), recordingMiddleware("b", &order)},
+		nil,
+		[]middleware{recordingMiddleware("c", &order)})
+	_, err := process(DataHandler{}, &requestCall{req: &abstractRequest{}}, dbfs.NewDBMock())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "process", "/c", "/b", "/a"}, order)
+}
+
+func TestMethodMiddleware(t *testing.T) {
+	configSetup(t)
+	defer delete(methodMiddleware, "Project.Lookup")
+
+	order := []string{}
+	refuse := func(next processor) processor {
+		return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+			assert.True(t, call.authenticated)
+			require.IsType(t, &projectLookupRequest{}, call.full, "the request should have been parsed")
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusWrongRequest, call.req.Tag)}}, nil
+		}
+	}
+	methodMiddleware["Project.Lookup"] = []middleware{recordingMiddleware("lookup", &order), refuse}
+
+	db := dbfs.NewDBMock()
+	handle := func(resource, method string) int {
+		messageChan := make(chan rabbitmq.AMQPMessage, 8)
+		dh := DataHandler{MessageChan: messageChan, Db: db}
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		dh.Handle(0, []byte(fmt.Sprintf(
+			`{"Tag": 1, "Resource": %q, "Method": %q, "SenderID": "loganga", "SenderToken": %q, "Data": {"ProjectIDs": [1]}}`,
+			resource, method, testToken(t, "loganga"))), wg)
+		require.Len(t, messageChan, 1)
+		var res struct {
+			ServerMessage struct {
+				Status int
+			}
+		}
+		require.NoError(t, json.Unmarshal((<-messageChan).Message, &res))
+		return res.ServerMessage.Status
+	}
+
+	assert.Equal(t, messages.StatusWrongRequest, handle("Project", "Lookup"))
+	assert.Equal(t, []string{"lookup", "/lookup"}, order)
+
+	// Other methods aren't wrapped by it, nor are requests that fail to parse
+	handle("Project", "GetPermissionConstants")
+	assert.Equal(t, messages.StatusUnimplemented, handle("Project", "NoSuchMethod"))
+	assert.Equal(t, []string{"lookup", "/lookup"}, order)
+}
@@ -0,0 +1,131 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Users mute the projects and events they aren't interested in, such as File.SetMetadata, with
+ * User.SetNotificationPrefs. Mutes are kept in MySQL, and sent to each of the user's connections with the "Mute" rabbit
+ * command, which drops muted notifications before they are written to the client (see rabbitmq/mutes.go): when the
+ * preferences change, to every connection subscribed to the user's own notifications, and when a connection subscribes
+ * to a project or resumes a session, to that connection.
+ *
+ * Muted notifications still take up a sequence number, so clients that mute events will see gaps; when they ask for
+ * the notifications they missed, Project.GetNotificationsSince leaves muted ones out too. Notifications sent directly
+ * to the user, such as being granted access to a project, are never muted.
+ */
+
+// maxNotificationMutes is the most projects, and the most events, a user may mute
+const maxNotificationMutes = 100
+
+var errTooManyMutes = errors.New("Too many muted projects or events")
+
+// muteClosure sends the user's mutes to the connections subscribed to key, or to the sender's connection if key is ""
+func muteClosure(prefs dbfs.NotificationPrefsMeta, key string) rabbitCommandClosure {
+	return rabbitCommandClosure{
+		Command: "Mute",
+		Tag:     -1,
+		Key:     key,
+		Data:    muteData(prefs),
+	}
+}
+
+func muteData(prefs dbfs.NotificationPrefsMeta) rabbitmq.MuteData {
+	return rabbitmq.MuteData{
+		ProjectIDs: prefs.MutedProjects,
+		Events:     prefs.MutedEvents,
+	}
+}
+
+// notificationMuted reports whether the stored project notification is one of the user's mutes
+func notificationMuted(mutes *rabbitmq.Mutes, projectID int64, notification json.RawMessage) bool {
+	var not struct {
+		Resource string
+		Method   string
+	}
+	if err := json.Unmarshal(notification, &not); err != nil {
+		return false
+	}
+	return mutes.Muted(map[string]interface{}{
+		"Project": rabbitmq.RabbitProjectQueueName(projectID),
+		"Event":   not.Resource + "." + not.Method,
+	})
+}
+
+// User.GetNotificationPrefs
+type userGetNotificationPrefsRequest struct {
+	abstractRequest
+}
+
+func (u *userGetNotificationPrefsRequest) setAbstractRequest(req *abstractRequest) {
+	u.abstractRequest = *req
+}
+
+func (u userGetNotificationPrefsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	prefs, err := db.MySQLUserGetNotificationPrefs(u.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, u.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    u.Tag,
+		Data:   prefs,
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// User.SetNotificationPrefs
+type userSetNotificationPrefsRequest struct {
+	MutedProjects []int64
+	MutedEvents   []string // "Resource.Method" or "Resource.*", such as "File.SetMetadata"
+	abstractRequest
+}
+
+func (u *userSetNotificationPrefsRequest) setAbstractRequest(req *abstractRequest) {
+	u.abstractRequest = *req
+}
+
+func (u userSetNotificationPrefsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if len(u.MutedProjects) > maxNotificationMutes || len(u.MutedEvents) > maxNotificationMutes {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, u.Tag)}}, errTooManyMutes
+	}
+	for _, event := range u.MutedEvents {
+		if !rabbitmq.ValidEvent(event) {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, u.Tag)}},
+				rabbitmq.ErrInvalidSubscriptionEvent
+		}
+	}
+
+	prefs := dbfs.NotificationPrefsMeta{
+		MutedProjects: u.MutedProjects,
+		MutedEvents:   u.MutedEvents,
+	}
+	if prefs.MutedProjects == nil {
+		prefs.MutedProjects = []int64{}
+	}
+	if prefs.MutedEvents == nil {
+		prefs.MutedEvents = []string{}
+	}
+	if err := db.MySQLUserSetNotificationPrefs(u.SenderID, prefs); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, u.Tag)}}, err
+	}
+
+	utils.LogInfo("Notification preferences changed", utils.LogFields{
+		"SenderID":      u.SenderID,
+		"MutedProjects": len(prefs.MutedProjects),
+		"MutedEvents":   len(prefs.MutedEvents),
+	})
+	// The sender's own connection is subscribed to the user's notifications too
+	return []dhClosure{
+		toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, u.Tag)},
+		muteClosure(prefs, rabbitmq.RabbitUserQueueName(u.SenderID)),
+	}, nil
+}
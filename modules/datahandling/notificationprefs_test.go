@@ -0,0 +1,113 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSetNotificationPrefs(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	set := userSetNotificationPrefsRequest{MutedProjects: []int64{3}, MutedEvents: []string{"File.SetMetadata"}}
+	setBaseFields(&set)
+	set.Resource = "User"
+	set.Method = "SetNotificationPrefs"
+	get := userGetNotificationPrefsRequest{}
+	setBaseFields(&get)
+	get.Resource = "User"
+	get.Method = "GetNotificationPrefs"
+
+	closures, err := set.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	// Each of the user's connections is sent the new mutes
+	mute := closures[1].(rabbitCommandClosure)
+	assert.Equal(t, "Mute", mute.Command)
+	assert.Equal(t, rabbitmq.RabbitUserQueueName("loganga"), mute.Key)
+	assert.Equal(t, rabbitmq.MuteData{ProjectIDs: []int64{3}, Events: []string{"File.SetMetadata"}}, mute.Data)
+
+	res, _ := processForTest(t, &get, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, dbfs.NotificationPrefsMeta{MutedProjects: []int64{3}, MutedEvents: []string{"File.SetMetadata"}}, res.Data)
+
+	// Events must be of the same form as in subscription filters
+	set.MutedEvents = []string{"File.#"}
+	closures, err = set.process(db)
+	assert.Equal(t, rabbitmq.ErrInvalidSubscriptionEvent, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	// Muting nothing clears the preferences
+	set.MutedProjects, set.MutedEvents = nil, nil
+	_, err = set.process(db)
+	require.NoError(t, err)
+	res, _ = processForTest(t, &get, db)
+	assert.Equal(t, dbfs.NotificationPrefsMeta{MutedProjects: []int64{}, MutedEvents: []string{}}, res.Data)
+}
+
+func TestProjectSubscribe_Mutes(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "muted")
+	db.MySQLUserSetNotificationPrefs("loganga", dbfs.NotificationPrefsMeta{MutedProjects: []int64{projectID}})
+
+	req := projectSubscribeRequest{ProjectID: projectID}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "Subscribe"
+
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	mute := closures[0].(rabbitCommandClosure)
+	assert.Equal(t, "Mute", mute.Command)
+	assert.Equal(t, "", mute.Key, "the mutes should be sent to the subscribing connection")
+	assert.Equal(t, []int64{projectID}, mute.Data.(rabbitmq.MuteData).ProjectIDs)
+}
+
+func TestProjectGetNotificationsSince_Mutes(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+
+	messageChan := make(chan rabbitmq.AMQPMessage, 8)
+	dh := DataHandler{MessageChan: messageChan, Db: db}
+	for _, method := range []string{"Rename", "SetLineEndings", "SetIgnoreRules"} {
+		not := messages.Notification{Resource: "Project", Method: method, ResourceID: projectID}.Wrap()
+		require.NoError(t, projectNotificationClosure(projectID, 0, not).call(dh))
+	}
+	// Published notifications carry what is needed to drop them for users who muted them
+	msg := <-messageChan
+	assert.Equal(t, rabbitmq.RabbitProjectQueueName(projectID), msg.Headers["Project"])
+	assert.Equal(t, "Project.Rename", msg.Headers["Event"])
+
+	db.MySQLUserSetNotificationPrefs("loganga", dbfs.NotificationPrefsMeta{MutedEvents: []string{"Project.SetLineEndings"}})
+	req := projectGetNotificationsSinceRequest{ProjectID: projectID}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "GetNotificationsSince"
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+
+	var data struct {
+		Notifications []messages.Notification
+	}
+	resJSON, err := json.Marshal(res.Data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(resJSON, &data))
+	var methods []string
+	for _, notification := range data.Notifications {
+		methods = append(methods, notification.Method)
+	}
+	assert.Equal(t, []string{"Rename", "SetIgnoreRules"}, methods)
+}
@@ -0,0 +1,78 @@
+package datahandling
+
+import (
+	"encoding/json"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Notifications sent to a project's subscribers carry a Sequence number, which increases by one with each of the
+ * project's notifications, so that clients can tell when they missed one, such as while they were reconnecting.
+ * Notifications are stored in Couchbase before they are published, and kept for a day; clients that see a gap fetch
+ * what they missed with Project.GetNotificationsSince. If those notifications are no longer stored, it responds with
+ * StatusVersionOutOfDate, and clients resync the project instead.
+ *
+ * Notifications may be delivered out of order, since different servers publish them, so a gap may only mean that the
+ * missing notification has not arrived yet. Ephemeral notifications, which may be dropped, are not sequenced.
+ */
+
+// Project.GetNotificationsSince
+type projectGetNotificationsSinceRequest struct {
+	ProjectID int64 `validate:"required"`
+	Sequence  int64 `validate:"min=0"` // The last notification the client received; 0 for every notification
+	abstractRequest
+}
+
+func (p *projectGetNotificationsSinceRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectGetNotificationsSinceRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	notifications, err := db.CBGetNotificationsSince(p.ProjectID, p.Sequence)
+	if err == dbfs.ErrVersionOutOfDate {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusVersionOutOfDate, p.Tag)}}, nil
+	} else if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, err
+	}
+
+	// Muted notifications were dropped when they were delivered, so they aren't missing
+	prefs, err := db.MySQLUserGetNotificationPrefs(p.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+	mutes := rabbitmq.NewMutes()
+	mutes.Set(muteData(prefs))
+	unmuted := []json.RawMessage{}
+	for _, notification := range notifications {
+		if !notificationMuted(mutes, p.ProjectID, notification) {
+			unmuted = append(unmuted, notification)
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data: struct {
+			Notifications []json.RawMessage
+		}{
+			Notifications: unmuted,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
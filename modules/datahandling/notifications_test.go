@@ -0,0 +1,88 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectNotificationClosure_Sequence(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	messageChan := make(chan rabbitmq.AMQPMessage, 4)
+	dh := DataHandler{MessageChan: messageChan, Db: db}
+
+	notify := func(method string) toRabbitChannelClosure {
+		return projectNotificationClosure(1, 0, messages.Notification{
+			Resource:   "Project",
+			Method:     method,
+			ResourceID: 1,
+		}.Wrap())
+	}
+	require.NoError(t, notify("Rename").call(dh))
+	require.NoError(t, notify("SetLineEndings").call(dh))
+	cursor := notify("Cursor")
+	cursor.ephemeral = true
+	require.NoError(t, cursor.call(dh))
+
+	var published []int64
+	for len(messageChan) > 0 {
+		var msg struct {
+			ServerMessage messages.Notification
+		}
+		require.NoError(t, json.Unmarshal((<-messageChan).Message, &msg))
+		published = append(published, msg.ServerMessage.Sequence)
+	}
+	// Ephemeral notifications are not sequenced
+	assert.Equal(t, []int64{1, 2, 0}, published)
+	assert.Len(t, db.Notifications[1], 2)
+}
+
+func TestProjectGetNotificationsSinceRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+
+	dh := DataHandler{MessageChan: make(chan rabbitmq.AMQPMessage, 8), Db: db}
+	for _, method := range []string{"Rename", "SetLineEndings", "SetIgnoreRules"} {
+		not := messages.Notification{Resource: "Project", Method: method, ResourceID: projectID}.Wrap()
+		require.NoError(t, projectNotificationClosure(projectID, 0, not).call(dh))
+	}
+
+	req := projectGetNotificationsSinceRequest{ProjectID: projectID, Sequence: 1}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "GetNotificationsSince"
+	methods := func() []string {
+		res, _ := processForTest(t, &req, db)
+		require.Equal(t, messages.StatusSuccess, res.Status)
+		var data struct {
+			Notifications []messages.Notification
+		}
+		resJSON, err := json.Marshal(res.Data)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(resJSON, &data))
+		var methods []string
+		for i, notification := range data.Notifications {
+			assert.Equal(t, req.Sequence+int64(i)+1, notification.Sequence)
+			methods = append(methods, notification.Method)
+		}
+		return methods
+	}
+	assert.Equal(t, []string{"SetLineEndings", "SetIgnoreRules"}, methods())
+
+	// Notifications that have been assigned a sequence number, but not stored, end the results
+	delete(db.Notifications[projectID], 3)
+	assert.Equal(t, []string{"SetLineEndings"}, methods())
+
+	// Clients whose next notification has expired must resync
+	delete(db.Notifications[projectID], 2)
+	res, _ := processForTest(t, &req, db)
+	assert.Equal(t, messages.StatusVersionOutOfDate, res.Status)
+}
@@ -0,0 +1,23 @@
+package datahandling
+
+/**
+ * Requests that list a user's projects or a project's files can be paged, so that users with hundreds of them aren't
+ * sent everything in a single response. Those requests take an Offset, the number of results to skip, and a Limit, the
+ * number of results to return, of at most 1000; a Limit of 0 returns every result after the Offset, as the
+ * requests did before they could be paged. Responses include the Total number of results, so that clients can tell
+ * how many pages there are.
+ *
+ * Results are paged before they are looked up, so that only the requested page's versions and details are fetched.
+ */
+
+// page returns the bounds of the requested page of total results, as slice indices
+func page(total int, offset int, limit int) (int, int) {
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return offset, end
+}
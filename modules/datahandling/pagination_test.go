@@ -0,0 +1,92 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPage(t *testing.T) {
+	tests := []struct {
+		total, offset, limit int
+		start, end           int
+	}{
+		{10, 0, 0, 0, 10},
+		{10, 3, 0, 3, 10},
+		{10, 0, 4, 0, 4},
+		{10, 8, 4, 8, 10},
+		{10, 10, 4, 10, 10},
+		{10, 12, 4, 10, 10},
+		{0, 0, 4, 0, 0},
+	}
+	for _, test := range tests {
+		start, end := page(test.total, test.offset, test.limit)
+		assert.Equal(t, test.start, start, "start of %+v", test)
+		assert.Equal(t, test.end, end, "end of %+v", test)
+	}
+}
+
+func TestProjectGetFilesRequest_Paging(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "big project")
+	for _, name := range []string{"file1", "file2", "file3", "file4", "file5"} {
+		db.MySQLFileCreate("loganga", name, "", projectID)
+	}
+
+	req := projectGetFilesRequest{ProjectID: projectID, Offset: 1, Limit: 2}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "GetFiles"
+	db.FunctionCallCount = 0
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+
+	// Only the page's versions are looked up
+	assert.Equal(t, 7, db.FunctionCallCount)
+	data := reflect.ValueOf(res.Data)
+	files := data.FieldByName("Files").Interface().([]fileLookupResult)
+	require.Len(t, files, 2)
+	assert.Equal(t, "file2", files[0].Filename)
+	assert.Equal(t, "file3", files[1].Filename)
+	assert.Equal(t, int64(5), data.FieldByName("Total").Int())
+
+	req.Offset = 4
+	req.Limit = 0
+	res, _ = processForTest(t, &req, db)
+	files = reflect.ValueOf(res.Data).FieldByName("Files").Interface().([]fileLookupResult)
+	require.Len(t, files, 1)
+	assert.Equal(t, "file5", files[0].Filename)
+}
+
+func TestUserProjectsRequest_Paging(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectIDs := make([]int64, 3)
+	for i := range projectIDs {
+		projectIDs[i], _ = db.MySQLProjectCreate("loganga", "project")
+	}
+
+	req := userProjectsRequest{Offset: 2, Limit: 5}
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "Projects"
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := reflect.ValueOf(res.Data)
+	projects := data.FieldByName("Projects").Interface().([]projectLookupResult)
+	require.Len(t, projects, 1)
+	assert.Equal(t, projectIDs[2], projects[0].ProjectID)
+	assert.Equal(t, int64(3), data.FieldByName("Total").Int())
+
+	// The limit is validated
+	abs := &abstractRequest{Resource: "User", Method: "Projects", Data: []byte(`{"Limit": 1001}`)}
+	_, err := commonJSON(new(userProjectsRequest), abs)
+	assert.IsType(t, &requestValidationError{}, err)
+}
@@ -1,14 +1,18 @@
 package datahandling
 
 import (
-	"time"
-
+	"errors"
+	"fmt"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
 	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/modules/search"
 	"github.com/CodeCollaborate/Server/utils"
 )
 
@@ -34,6 +38,14 @@ func initProjectRequests() {
 		return commonJSON(new(projectGetPermissionConstantsRequest), req)
 	}
 
+	authenticatedRequestMap["Project.ListRoles"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectListRolesRequest), req)
+	}
+
+	authenticatedRequestMap["Project.Search"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectSearchRequest), req)
+	}
+
 	authenticatedRequestMap["Project.GrantPermissions"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(projectGrantPermissionsRequest), req)
 	}
@@ -54,6 +66,10 @@ func initProjectRequests() {
 		return commonJSON(new(projectGetFilesRequest), req)
 	}
 
+	authenticatedRequestMap["Project.ImportFromGit"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectImportFromGitRequest), req)
+	}
+
 	authenticatedRequestMap["Project.Subscribe"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(projectSubscribeRequest), req)
 	}
@@ -66,12 +82,48 @@ func initProjectRequests() {
 		return commonJSON(new(projectDeleteRequest), req)
 	}
 
+	authenticatedRequestMap["Project.Archive"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectArchiveRequest), req)
+	}
+
+	authenticatedRequestMap["Project.Unarchive"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectUnarchiveRequest), req)
+	}
+
+	authenticatedRequestMap["Project.SetLineEndings"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectSetLineEndingsRequest), req)
+	}
+
+	authenticatedRequestMap["Project.SetIgnoreRules"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectSetIgnoreRulesRequest), req)
+	}
+
+	authenticatedRequestMap["Project.GetIgnoreRules"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectGetIgnoreRulesRequest), req)
+	}
+
+	authenticatedRequestMap["Project.GetSettings"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectGetSettingsRequest), req)
+	}
+
+	authenticatedRequestMap["Project.UpdateSettings"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectUpdateSettingsRequest), req)
+	}
+
+	authenticatedRequestMap["Project.GetNotificationsSince"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectGetNotificationsSinceRequest), req)
+	}
+
+	authenticatedRequestMap["Project.Sync"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(projectSyncRequest), req)
+	}
+
 	projectRequestsSetup = true
 }
 
 // Project.Create
 type projectCreateRequest struct {
-	Name string
+	Name string `validate:"required"`
 	abstractRequest
 }
 
@@ -80,11 +132,14 @@ func (p *projectCreateRequest) setAbstractRequest(req *abstractRequest) {
 }
 
 func (p projectCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if problem, err := checkProjectName(db, p.SenderID, p.Name, 0); err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, err
+	} else if problem != "" {
+		return []dhClosure{toSenderClosure{msg: newProjectNameRejectedResponse(p.Tag, "Name", problem)}}, nil
+	}
+
 	projectID, err := db.MySQLProjectCreate(p.SenderID, p.Name)
 	if err != nil {
-		//if err == project already exists {
-		// TODO(shapiro): implement a specific error for this on the mysql.go side
-		//}
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, nil
 	}
 
@@ -103,8 +158,8 @@ func (p projectCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 
 // Project.Rename
 type projectRenameRequest struct {
-	ProjectID int64
-	NewName   string
+	ProjectID int64  `validate:"required"`
+	NewName   string `validate:"required"`
 	abstractRequest
 }
 
@@ -113,7 +168,7 @@ func (p *projectRenameRequest) setAbstractRequest(req *abstractRequest) {
 }
 
 func (p projectRenameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "write", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityRenameProject, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -124,24 +179,97 @@ func (p projectRenameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
 	}
 
-	err = db.MySQLProjectRename(p.ProjectID, p.NewName)
+	oldName, permissions, err := db.MySQLProjectLookup(p.ProjectID, p.SenderID)
 	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+	renamed := projectRenamed{
+		ProjectID: p.ProjectID,
+		OldName:   oldName,
+		NewName:   p.NewName,
+	}
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data:   renamed,
+	}.Wrap()
+	if oldName == p.NewName {
+		return []dhClosure{toSenderClosure{msg: res}}, nil
+	}
+
+	// Names are unique among the owner's projects, rather than the sender's
+	owner := p.SenderID
+	for username, permission := range permissions {
+		if permission.PermissionLevel == config.OwnerRole.Level {
+			owner = username
+		}
+	}
+	if problem, err := checkProjectName(db, owner, p.NewName, p.ProjectID); err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, err
+	} else if problem != "" {
+		return []dhClosure{toSenderClosure{msg: newProjectNameRejectedResponse(p.Tag, "NewName", problem)}}, nil
+	}
+
+	err = db.MySQLProjectRename(p.ProjectID, p.NewName)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
 	}
 
-	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
 	not := messages.Notification{
 		Resource:   p.Resource,
 		Method:     p.Method,
 		ResourceID: p.ProjectID,
-		Data: struct {
-			NewName string
-		}{
-			NewName: p.NewName,
-		},
+		Data:       renamed,
 	}.Wrap()
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(p.ProjectID)}}, nil
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(p.ProjectID, 0, not)}, nil
+}
+
+// projectRenamed is the Data of the response and notification for Project.Rename
+type projectRenamed struct {
+	ProjectID int64
+	OldName   string
+	NewName   string
+}
+
+// maxProjectNameLength matches the width of the Project.Name column
+const maxProjectNameLength = 50
+
+// checkProjectName returns why the name can't be given to a project of the owner's, or "" if it can. The project
+// being renamed, if any, is excluded when checking that the name is unique.
+func checkProjectName(db dbfs.DBFS, owner string, name string, projectID int64) (string, error) {
+	switch {
+	case !utf8.ValidString(name):
+		return "must be valid UTF-8", nil
+	case utf8.RuneCountInString(name) > maxProjectNameLength:
+		return fmt.Sprintf("must be at most %d characters long", maxProjectNameLength), nil
+	case strings.TrimSpace(name) != name:
+		return "must not start or end with whitespace", nil
+	case strings.ContainsAny(name, "/\\"):
+		return "must not contain slashes", nil
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return "must not contain control characters", nil
+	}
+
+	projects, err := db.MySQLUserProjects(owner)
+	if err != nil {
+		return "", err
+	}
+	for _, project := range projects {
+		if project.ProjectID != projectID && project.PermissionLevel == config.OwnerRole.Level &&
+			strings.EqualFold(project.Name, name) {
+			return "is already the name of another of the owner's projects", nil
+		}
+	}
+	return "", nil
+}
+
+// newProjectNameRejectedResponse tells the client why the project name it asked for can't be used
+func newProjectNameRejectedResponse(tag int64, field string, problem string) *messages.ServerMessageWrapper {
+	return newValidationErrorResponse(tag, &requestValidationError{
+		Reason: "Invalid project name",
+		Fields: []fieldError{{Field: field, Problem: problem}},
+	})
 }
 
 // Project.GetPermissionConstants
@@ -167,16 +295,49 @@ func (p projectGetPermissionConstantsRequest) process(db dbfs.DBFS) ([]dhClosure
 	return []dhClosure{toSenderClosure{msg: res}}, nil
 }
 
+// Project.ListRoles
+type projectListRolesRequest struct {
+	abstractRequest
+}
+
+func (p *projectListRolesRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectListRolesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data: struct {
+			Roles []config.Role
+		}{
+			Roles: config.Roles,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// requestedRole resolves the role a grant request asks for. Clients name the role; the numeric PermissionLevel is
+// still accepted from older clients.
+func requestedRole(name string, level int8) (config.Role, error) {
+	if name != "" {
+		return config.RoleByName(name)
+	}
+	return config.RoleByLevel(level)
+}
+
 // Project.GrantPermissions
 type projectGrantPermissionsRequest struct {
-	ProjectID       int64
-	GrantUsername   string
-	PermissionLevel int8
+	ProjectID       int64  `validate:"required"`
+	GrantUsername   string `validate:"required"`
+	Role            string // The project's DefaultRole, if neither Role nor PermissionLevel is given
+	PermissionLevel int8   // Deprecated: use Role
 	abstractRequest
 }
 
 func (p projectGrantPermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "admin", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityManageAccess, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -196,24 +357,25 @@ func (p projectGrantPermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, erro
 
 	// TODO: Add if User exists check
 
-	requestPerm, err := config.PermissionByLevel(p.PermissionLevel)
-	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, nil
+	if p.Role == "" && p.PermissionLevel == 0 {
+		p.Role, err = projectDefaultRole(p.ProjectID, db)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+		}
 	}
-
-	ownerPerm, err := config.PermissionByLabel("owner")
+	role, err := requestedRole(p.Role, p.PermissionLevel)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, nil
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, nil
 	}
 
-	if requestPerm.Level == ownerPerm.Level {
+	if role.Name == config.OwnerRole.Name {
 		// TODO(shapiro): implement changing ownership
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnimplemented, p.Tag)}}, nil
 	}
 
-	err = db.MySQLProjectGrantPermission(p.ProjectID, p.GrantUsername, p.PermissionLevel, p.SenderID)
+	err = db.MySQLProjectGrantPermission(p.ProjectID, p.GrantUsername, role.Level, p.SenderID)
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
 	}
 
 	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
@@ -223,16 +385,18 @@ func (p projectGrantPermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, erro
 		ResourceID: p.ProjectID,
 		Data: struct {
 			GrantUsername   string
+			Role            string
 			PermissionLevel int8
 		}{
 			GrantUsername:   p.GrantUsername,
-			PermissionLevel: p.PermissionLevel,
+			Role:            role.Name,
+			PermissionLevel: role.Level,
 		},
 	}.Wrap()
 
 	return []dhClosure{
 		toSenderClosure{msg: res},
-		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(p.ProjectID)},
+		projectNotificationClosure(p.ProjectID, 0, not),
 		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitUserQueueName(p.GrantUsername)}}, nil
 }
 
@@ -242,13 +406,13 @@ func (p *projectGrantPermissionsRequest) setAbstractRequest(req *abstractRequest
 
 // Project.RevokePermissions
 type projectRevokePermissionsRequest struct {
-	ProjectID      int64
-	RevokeUsername string
+	ProjectID      int64  `validate:"required"`
+	RevokeUsername string `validate:"required"`
 	abstractRequest
 }
 
 func (p projectRevokePermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "admin", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityManageAccess, db)
 	if err != nil {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -262,7 +426,7 @@ func (p projectRevokePermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, err
 	p.RevokeUsername = strings.ToLower(p.RevokeUsername)
 
 	// allow case where user is removing themselves from a project
-	if !hasPermission && p.SenderID != p.RevokeUsername {
+	if (!hasPermission && p.SenderID != p.RevokeUsername) || !p.tokenAllowsProject(p.ProjectID) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
 	}
 
@@ -270,17 +434,12 @@ func (p projectRevokePermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, err
 
 	if err != nil {
 		if err == dbfs.ErrNoDbChange {
-			ownerPerm, err := config.PermissionByLabel("owner")
-			if err != nil {
-				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, nil
-			}
-
 			_, permissions, err := db.MySQLProjectLookup(p.ProjectID, p.SenderID)
 			if err != nil {
-				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, err
+				return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
 			}
 			for username, lvl := range permissions {
-				if lvl.PermissionLevel == ownerPerm.Level && username == p.RevokeUsername {
+				if lvl.PermissionLevel == config.OwnerRole.Level && username == p.RevokeUsername {
 					// request is trying to remove owner, we can be more specific in errors
 					if p.SenderID == username {
 						// the owner is trying to remove themselves
@@ -317,7 +476,7 @@ func (p projectRevokePermissionsRequest) process(db dbfs.DBFS) ([]dhClosure, err
 
 	return []dhClosure{
 		toSenderClosure{msg: res},
-		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(p.ProjectID)},
+		projectNotificationClosure(p.ProjectID, 0, not),
 		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitUserQueueName(p.RevokeUsername)},
 		unsubscribeCommand}, nil
 }
@@ -328,7 +487,7 @@ func (p *projectRevokePermissionsRequest) setAbstractRequest(req *abstractReques
 
 // Project.GetOnlineClients
 type projectGetOnlineClientsRequest struct {
-	ProjectID int64
+	ProjectID int64 `validate:"required"`
 	abstractRequest
 }
 
@@ -354,6 +513,7 @@ type projectLookupResult struct {
 	ProjectID   int64
 	Name        string
 	Permissions map[string](dbfs.ProjectPermission)
+	Archive     string // "archiving", "archived" or "unarchiving"; empty for live projects
 }
 
 func (p projectLookupRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
@@ -368,7 +528,7 @@ func (p projectLookupRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	i := 0
 	for _, id := range p.ProjectIDs {
 		// it's better to do a cheap lookup and then an expensive one if required than an expensive one every time
-		hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, id, "read", db)
+		hasPermission, err := authorizeProject(p.abstractRequest, id, config.CapabilityViewProject, db)
 		if err != nil || !hasPermission {
 			utils.LogError("API permission error", err, utils.LogFields{
 				"Resource":  p.Resource,
@@ -438,10 +598,16 @@ func projectLookup(senderID string, projectID int64, db dbfs.DBFS) (projectLooku
 		return result, err
 	}
 
+	archive, err := db.MySQLProjectGetArchiveState(projectID)
+	if err != nil {
+		return result, err
+	}
+
 	result = projectLookupResult{
 		ProjectID:   projectID,
 		Name:        name,
 		Permissions: permissions,
+		Archive:     archive,
 	}
 
 	return result, nil
@@ -453,10 +619,16 @@ func (p *projectLookupRequest) setAbstractRequest(req *abstractRequest) {
 
 // Project.GetFiles
 type projectGetFilesRequest struct {
-	ProjectID int64
+	ProjectID int64  `validate:"required"`
+	Offset    int    `validate:"min=0"`
+	Limit     int    `validate:"min=0,max=1000"` // 0 returns every file after Offset
+	Directory string // Optional; only files in this directory, or its subdirectories, are returned
+	Glob      string `validate:"max=255"` // Optional; only files whose names match are returned. '*' matches any characters, and '?' matches one
 	abstractRequest
 }
 
+var errInvalidGlob = errors.New("Globs match file names, and may not contain '/'")
+
 type fileLookupResult struct {
 	FileID       int64
 	Filename     string
@@ -464,10 +636,12 @@ type fileLookupResult struct {
 	CreationDate time.Time
 	RelativePath string
 	Version      int64
+	Metadata     map[string]string
+	ContentHash  string // The SHA-256 of the file's text at Version, if recorded; see contenthash.go
 }
 
 func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "read", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -478,13 +652,28 @@ func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
 	}
 
-	files, err := db.MySQLProjectGetFiles(p.ProjectID)
+	if res, err := archivedResponse(p.ProjectID, p.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	if strings.Contains(p.Glob, "/") {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, errInvalidGlob
+	}
+
+	// Filters are applied by the database, so that only the files requested are fetched
+	var files []dbfs.FileMeta
+	if p.Directory == "" && p.Glob == "" {
+		files, err = db.MySQLProjectGetFiles(p.ProjectID)
+	} else {
+		files, err = db.MySQLProjectGetFilesFiltered(p.ProjectID, p.Directory, p.Glob)
+	}
 	if err != nil {
 		res := messages.Response{
 			Status: messages.StatusFail,
 			Tag:    p.Tag,
 			Data: struct {
 				Files []fileLookupResult
+				Total int
 			}{
 				Files: make([]fileLookupResult, 0),
 			},
@@ -493,22 +682,38 @@ func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: res}}, nil
 	}
 
+	total := len(files)
+	start, end := page(total, p.Offset, p.Limit)
+	files = files[start:end]
 	resultData := make([]fileLookupResult, len(files))
 
 	i := 0
-	var errOut error
+	// Files are still returned if their metadata can't be; the response is then a partial failure
+	metadata, errOut := db.MySQLProjectGetFileMetadata(p.ProjectID)
+	hashes, err := db.MySQLProjectGetContentHashes(p.ProjectID)
+	if err != nil {
+		errOut = err
+	}
 	for _, file := range files {
 		version, err := db.CBGetFileVersion(file.FileID)
 		if err != nil {
 			errOut = err
 		} else {
+			fileMetadata := metadata[file.FileID]
+			if fileMetadata == nil {
+				fileMetadata = make(map[string]string)
+			}
 			resultData[i] = fileLookupResult{
 				FileID:       file.FileID,
 				Filename:     file.Filename,
 				Creator:      file.Creator,
 				CreationDate: file.CreationDate,
 				RelativePath: file.RelativePath,
-				Version:      version}
+				Version:      version,
+				Metadata:     fileMetadata}
+			if hash := hashes[file.FileID]; hash.Version == version {
+				resultData[i].ContentHash = hash.Hash
+			}
 			i++
 		}
 	}
@@ -522,8 +727,10 @@ func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 				Tag:    p.Tag,
 				Data: struct {
 					Files []fileLookupResult
+					Total int
 				}{
 					Files: resultData,
+					Total: total,
 				},
 			}.Wrap()
 			return []dhClosure{toSenderClosure{msg: res}}, nil
@@ -533,8 +740,10 @@ func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 			Tag:    p.Tag,
 			Data: struct {
 				Files []fileLookupResult
+				Total int
 			}{
 				Files: resultData,
+				Total: total,
 			},
 		}.Wrap()
 		return []dhClosure{toSenderClosure{msg: res}}, nil
@@ -544,8 +753,10 @@ func (p projectGetFilesRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		Tag:    p.Tag,
 		Data: struct {
 			Files []fileLookupResult
+			Total int
 		}{
 			Files: resultData,
+			Total: total,
 		},
 	}.Wrap()
 
@@ -558,12 +769,14 @@ func (p *projectGetFilesRequest) setAbstractRequest(req *abstractRequest) {
 
 // Project.Subscribe
 type projectSubscribeRequest struct {
-	ProjectID int64
+	ProjectID int64    `validate:"required"`
+	Events    []string // Optional; "Resource.Method" or "Resource.*". Only these notifications are received
+	FileIDs   []int64  // Optional; only notifications about these files, or the whole project, are received
 	abstractRequest
 }
 
 func (p projectSubscribeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "read", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
 	if err != nil || !hasPermission {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -574,14 +787,31 @@ func (p projectSubscribeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
 	}
 
+	bindings, err := rabbitmq.RabbitProjectBindingKeys(p.ProjectID, rabbitmq.SubscriptionFilter{
+		Events:  p.Events,
+		FileIDs: p.FileIDs,
+	})
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, err
+	}
+
+	// The connection drops what the sender muted, including the notifications of this project if it is muted
+	prefs, err := db.MySQLUserGetNotificationPrefs(p.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	// Subscribing to a project again replaces its filter
 	cmdClosure := rabbitCommandClosure{
 		Command: "Subscribe",
 		Tag:     p.Tag,
 		Data: rabbitmq.RabbitQueueData{
-			Key: rabbitmq.RabbitProjectQueueName(p.ProjectID),
+			Key:      rabbitmq.RabbitProjectQueueName(p.ProjectID),
+			Bindings: bindings,
 		},
+		username: p.SenderID,
 	}
-	return []dhClosure{cmdClosure}, nil
+	return []dhClosure{muteClosure(prefs, ""), cmdClosure}, nil
 }
 
 func (p *projectSubscribeRequest) setAbstractRequest(req *abstractRequest) {
@@ -590,7 +820,7 @@ func (p *projectSubscribeRequest) setAbstractRequest(req *abstractRequest) {
 
 // Project.Unsubscribe
 type projectUnsubscribeRequest struct {
-	ProjectID int64
+	ProjectID int64 `validate:"required"`
 	abstractRequest
 }
 
@@ -611,12 +841,12 @@ func (p *projectUnsubscribeRequest) setAbstractRequest(req *abstractRequest) {
 
 // Project.Delete
 type projectDeleteRequest struct {
-	ProjectID int64
+	ProjectID int64 `validate:"required"`
 	abstractRequest
 }
 
 func (p projectDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
-	hasPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "owner", db)
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityDeleteProject, db)
 	if err != nil {
 		utils.LogError("API permission error", err, utils.LogFields{
 			"Resource":  p.Resource,
@@ -628,7 +858,7 @@ func (p projectDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	}
 
 	if !hasPermission {
-		hasCurrentProjectPermission, err := dbfs.PermissionAtLeast(p.SenderID, p.ProjectID, "read", db)
+		hasCurrentProjectPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
 		if err != nil {
 			utils.LogError("API permission error", err, utils.LogFields{
 				"Resource":  p.Resource,
@@ -652,13 +882,32 @@ func (p projectDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
 	}
 
+	// The files' documents are looked up first, since they can't be once the project is gone
+	files, err := db.MySQLProjectGetFiles(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
 	err = db.MySQLProjectDelete(p.ProjectID, p.SenderID)
 	if err != nil {
-		if err == dbfs.ErrNoDbChange {
-			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, err
-		}
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, p.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	fileIDs := make([]int64, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.FileID
+	}
+	if err := db.CBDeleteFiles(fileIDs); err != nil {
+		utils.LogError("Failed to delete project's file documents", err, utils.LogFields{
+			"ProjectID": p.ProjectID,
+			"Files":     len(fileIDs),
+		})
+	}
 
+	if err := search.IndexerFor(p.config()).DeleteProject(p.ProjectID); err != nil {
+		utils.LogError("Search: failed to remove project from index", err, utils.LogFields{
+			"ProjectID": p.ProjectID,
+		})
 	}
 
 	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
@@ -669,9 +918,83 @@ func (p projectDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		Data:       struct{}{},
 	}.Wrap()
 
-	return []dhClosure{toSenderClosure{msg: res}, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(p.ProjectID)}}, nil
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(p.ProjectID, 0, not)}, nil
 }
 
 func (p *projectDeleteRequest) setAbstractRequest(req *abstractRequest) {
 	p.abstractRequest = *req
 }
+
+// Project.SetLineEndings
+type projectSetLineEndingsRequest struct {
+	ProjectID   int64  `validate:"required"`
+	LineEndings string `validate:"oneof=Preserve LF"` // See lineendings.go
+	abstractRequest
+}
+
+func (p *projectSetLineEndingsRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectSetLineEndingsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityManageSettings, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	err = db.MySQLProjectSetLineEndings(p.ProjectID, p.LineEndings)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)
+	not := messages.Notification{
+		Resource:   p.Resource,
+		Method:     p.Method,
+		ResourceID: p.ProjectID,
+		Data: struct {
+			LineEndings string
+		}{
+			LineEndings: p.LineEndings,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(p.ProjectID, 0, not)}, nil
+}
+
+// Project.Search
+type projectSearchRequest struct {
+	ProjectID  int64  `validate:"required"`
+	Query      string `validate:"required"`
+	MaxResults int    `validate:"min=0"`
+	abstractRequest
+}
+
+func (p *projectSearchRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectSearchRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	return searchResponse(search.Query{
+		ProjectID:  p.ProjectID,
+		Text:       p.Query,
+		MaxResults: p.MaxResults,
+	}, p.config(), p.Tag, db)
+}
@@ -2,6 +2,7 @@ package datahandling
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/CodeCollaborate/Server/modules/config"
@@ -9,6 +10,7 @@ import (
 	"github.com/CodeCollaborate/Server/modules/dbfs"
 	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setBaseFields(req request) {
@@ -41,7 +43,7 @@ func TestProjectCreateRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	if db.FunctionCallCount != 1 {
+	if db.FunctionCallCount != 2 {
 		t.Fatal("did not call correct number of db functions")
 	}
 
@@ -58,7 +60,7 @@ func TestProjectCreateRequest_Process(t *testing.T) {
 	}
 	// is the data actually correct
 	projectID := reflect.ValueOf(resp.Data).FieldByName("ProjectID").Interface().(int64)
-	if projectID != db.ProjectIDCounter-1 {
+	if projectID != db.ProjectIDCounter {
 		t.Fatal("Incorrect projectID was returned")
 	}
 
@@ -99,7 +101,7 @@ func TestProjectRenameRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 2, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -119,9 +121,62 @@ func TestProjectRenameRequest_Process(t *testing.T) {
 	if not.ResourceID != db.ProjectIDCounter-1 {
 		t.Fatalf("Incorrect projectID was returned, expected %d, recieved %d", db.ProjectIDCounter-1, not.ResourceID)
 	}
+	assert.Equal(t, projectRenamed{ProjectID: req.ProjectID, OldName: "new stuff", NewName: "newer stuff"}, not.Data)
+	assert.Equal(t, not.Data, resp.Data)
 
 }
 
+func TestProjectNameValidation(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "jshap"})
+	projectID, _ := db.MySQLProjectCreate("loganga", "codecollab")
+	otherID, _ := db.MySQLProjectCreate("loganga", "plugin")
+	sharedID, _ := db.MySQLProjectCreate("jshap", "shared")
+	require.NoError(t, db.MySQLProjectGrantPermission(sharedID, "loganga", config.AdminRole.Level, "jshap"))
+
+	rename := func(projectID int64, name string) messages.Response {
+		req := projectRenameRequest{ProjectID: projectID, NewName: name}
+		setBaseFields(&req)
+		req.Resource = "Project"
+		req.Method = "Rename"
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+
+	tests := []struct {
+		desc      string
+		projectID int64
+		name      string
+		status    int
+	}{
+		{"Taken by another of the owner's projects", projectID, "Plugin", messages.StatusFail},
+		{"Too long", projectID, strings.Repeat("x", maxProjectNameLength+1), messages.StatusFail},
+		{"Padded", projectID, " codecollab2", messages.StatusFail},
+		{"Slash", projectID, "code/collab", messages.StatusFail},
+		{"Control character", projectID, "code\ncollab", messages.StatusFail},
+		{"Unchanged", projectID, "codecollab", messages.StatusSuccess},
+		{"Changing case", otherID, "Plugin", messages.StatusSuccess},
+		{"Unique among the owner's projects, not the sender's", sharedID, "codecollab", messages.StatusSuccess},
+		{"Unicode", projectID, "Zusammenarbeit für alle", messages.StatusSuccess},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.status, rename(test.projectID, test.name).Status, test.desc)
+	}
+
+	// Creating a project follows the same rules
+	req := projectCreateRequest{Name: "plugin"}
+	setBaseFields(&req)
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	res := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, res.Status)
+	assert.Equal(t, []fieldError{{Field: "Name", Problem: "is already the name of another of the owner's projects"}},
+		res.Data.(*requestValidationError).Fields)
+}
+
 func TestProjectGetPermissionConstantsRequest_Process(t *testing.T) {
 	configSetup(t)
 	req := *new(projectGetPermissionConstantsRequest)
@@ -148,6 +203,54 @@ func TestProjectGetPermissionConstantsRequest_Process(t *testing.T) {
 	}
 }
 
+func TestProjectListRolesRequest_Process(t *testing.T) {
+	configSetup(t)
+	req := *new(projectListRolesRequest)
+	setBaseFields(&req)
+	db := dbfs.NewDBMock()
+
+	closures, err := req.process(db)
+	assert.Nil(t, err)
+	assert.Zero(t, db.FunctionCallCount, "unexpected db calls for listing roles")
+
+	assert.Equal(t, 1, len(closures), "unexpected number of returned closures")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	roles := reflect.ValueOf(resp.Data).FieldByName("Roles").Interface().([]config.Role)
+	assert.Equal(t, config.Roles, roles)
+}
+
+func TestProjectGrantPermissionsRequest_ProcessRole(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.Users["loganga"] = geneMeta
+	db.Users["notloganga"] = dbfs.UserMeta{Username: "notloganga"}
+	projectID, _ := db.MySQLProjectCreate("loganga", "new stuff")
+
+	req := projectGrantPermissionsRequest{
+		ProjectID:     projectID,
+		GrantUsername: "notloganga",
+		Role:          "admin",
+	}
+	setBaseFields(&req)
+
+	closures, err := req.process(db)
+	assert.NoError(t, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status)
+	assert.Equal(t, config.AdminRole.Level, db.Projects["notloganga"][0].PermissionLevel, "role should be stored by level")
+
+	not := closures[1].(toRabbitChannelClosure).msg.ServerMessage.(messages.Notification)
+	assert.Equal(t, "admin", reflect.ValueOf(not.Data).FieldByName("Role").Interface())
+
+	req.Role = "superuser"
+	closures, err = req.process(db)
+	assert.NoError(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status, "unknown roles should be rejected")
+}
+
 func TestProjectGrantPermissionsRequest_Process(t *testing.T) {
 	configSetup(t)
 	req := *new(projectGrantPermissionsRequest)
@@ -264,7 +367,7 @@ func TestProjectRevokePermissionsRequest_Process(t *testing.T) {
 
 	// is the project notification actually correct
 	assert.Equal(t,
-		rabbitmq.RabbitProjectQueueName(projectID),
+		rabbitmq.RabbitProjectRoutingKey(projectID, 0, req.Resource, req.Method),
 		closures[1].(toRabbitChannelClosure).key,
 		"notification isn't being sent to project correctly")
 
@@ -329,7 +432,7 @@ func TestProjectLookupRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 6, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 1 ||
@@ -380,7 +483,7 @@ func TestProjectGetFilesRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 5, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 8, db.FunctionCallCount, "did not call correct number of db functions")
 
 	// are we notifying the right people
 	if len(closures) != 1 ||
@@ -427,17 +530,56 @@ func TestProjectSubscribe_Process(t *testing.T) {
 	}
 
 	// are we notifying the right people
-	if len(closures) != 1 ||
-		reflect.TypeOf(closures[0]).String() != "datahandling.rabbitCommandClosure" {
+	if len(closures) != 2 ||
+		reflect.TypeOf(closures[1]).String() != "datahandling.rabbitCommandClosure" {
 		t.Fatalf("did not properly process, recieved %d closure(s)", len(closures))
 	}
+	assert.Equal(t, "Mute", closures[0].(rabbitCommandClosure).Command, "the sender's mutes should be applied first")
 
-	sub := closures[0].(rabbitCommandClosure)
+	sub := closures[1].(rabbitCommandClosure)
 	// did the server return success status
 	channelKey := rabbitmq.RabbitProjectQueueName(req.ProjectID)
 	if sub.Data.(rabbitmq.RabbitQueueData).Key != channelKey {
 		t.Fatalf("Subscribe function wanted to subscribe to the wrong channel\n expected: %s, got: %s", channelKey, sub.Data.(rabbitmq.RabbitQueueData).Key)
 	}
+	assert.Equal(t, []string{channelKey + ".#"}, sub.Data.(rabbitmq.RabbitQueueData).Bindings,
+		"unfiltered subscriptions should receive all of the project's notifications")
+}
+
+func TestProjectSubscribe_ProcessFilter(t *testing.T) {
+	configSetup(t)
+	req := *new(projectSubscribeRequest)
+	setBaseFields(&req)
+	db := dbfs.NewDBMock()
+
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "new stuff")
+
+	req.Resource = "Project"
+	req.Method = "Subscribe"
+	req.ProjectID = projectID
+	req.Events = []string{"File.Change", "Project.*"}
+	req.FileIDs = []int64{7}
+
+	closures, err := req.process(db)
+	assert.NoError(t, err)
+	assert.Len(t, closures, 2)
+	assert.IsType(t, rabbitCommandClosure{}, closures[1])
+
+	channelKey := rabbitmq.RabbitProjectQueueName(projectID)
+	assert.Equal(t, []string{
+		channelKey + ".Project.File.Change",
+		channelKey + ".Project.Project.*",
+		channelKey + ".File-7.File.Change",
+		channelKey + ".File-7.Project.*",
+	}, closures[1].(rabbitCommandClosure).Data.(rabbitmq.RabbitQueueData).Bindings)
+
+	req.Events = []string{"File.#"}
+	closures, err = req.process(db)
+	assert.Equal(t, rabbitmq.ErrInvalidSubscriptionEvent, err)
+	assert.Len(t, closures, 1)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status)
 }
 
 func TestProjectUnsubscribe_Process(t *testing.T) {
@@ -480,6 +622,8 @@ func TestProjectDeleteRequest_process(t *testing.T) {
 	db := dbfs.NewDBMock()
 	db.Users["loganga"] = geneMeta
 	projID, err := db.MySQLProjectCreate("loganga", "new project")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", ".", projID)
+	db.CBInsertNewFile(fileID, 1, []string{})
 
 	db.FunctionCallCount = 0
 	req.ProjectID = projID
@@ -490,7 +634,9 @@ func TestProjectDeleteRequest_process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	assert.Equal(t, 2, db.FunctionCallCount, "did not call correct number of db functions")
+	assert.Equal(t, 4, db.FunctionCallCount, "did not call correct number of db functions")
+	// the files' documents are deleted along with the project
+	assert.NotContains(t, db.FileVersion, fileID)
 
 	// are we notifying the right people
 	if len(closures) != 2 ||
@@ -564,7 +710,7 @@ func TestProjectDeleteTurnsIntoRevokeRequest(t *testing.T) {
 
 	// is the project notification actually correct
 	assert.Equal(t,
-		rabbitmq.RabbitProjectQueueName(projectID),
+		rabbitmq.RabbitProjectRoutingKey(projectID, 0, req.Resource, req.Method),
 		closures[1].(toRabbitChannelClosure).key,
 		"notification isn't being sent to project correctly")
 
@@ -602,3 +748,33 @@ func TestProjectDeleteTurnsIntoRevokeRequest(t *testing.T) {
 		t.Fatal("Database was not properly modified")
 	}
 }
+
+func TestProjectGetFilesRequest_Filters(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "monorepo")
+	db.MySQLFileCreate("loganga", "main.go", "server", projectID)
+	db.MySQLFileCreate("loganga", "README.md", "server", projectID)
+	db.MySQLFileCreate("loganga", "index.js", "client", projectID)
+	db.MySQLFileCreate("loganga", "api.go", "server/api", projectID)
+
+	req := projectGetFilesRequest{ProjectID: projectID, Directory: "server", Glob: "*.go"}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "GetFiles"
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	data := reflect.ValueOf(res.Data)
+	files := data.FieldByName("Files").Interface().([]fileLookupResult)
+	require.Len(t, files, 2)
+	assert.Equal(t, "main.go", files[0].Filename)
+	assert.Equal(t, "api.go", files[1].Filename)
+	assert.Equal(t, int64(2), data.FieldByName("Total").Int())
+
+	// Globs match names, not paths
+	req.Glob = "api/*.go"
+	closures, err := req.process(db)
+	assert.Equal(t, errInvalidGlob, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
@@ -0,0 +1,186 @@
+package datahandling
+
+import (
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * A project's settings are read together with Project.GetSettings, and changed together with Project.UpdateSettings,
+ * which replaces the settings it is given, leaving the others as they were, and notifies the project's subscribers of
+ * every setting. Project.SetLineEndings and Project.SetIgnoreRules still change a single setting, notifying
+ * subscribers with their own notifications.
+ *
+ * Only server admins may override a project's storage quota. New settings are stored in the project's settings
+ * document (see dbfs.ProjectSettingsMeta), rather than in tables of their own.
+ */
+
+// projectSettings is the Data of Project.GetSettings and Project.UpdateSettings responses, and of the
+// Project.UpdateSettings notification
+type projectSettings struct {
+	LineEndings string   // Preserve or LF; see lineendings.go
+	IgnoreRules []string // See ignorerules.go
+	QuotaBytes  int64    // The project's storage quota override; 0 if the configured default applies
+	DefaultRole string   // The role Project.GrantPermissions grants if the request names none; "" if it must name one
+}
+
+func newProjectSettings(settings dbfs.ProjectSettingsMeta) projectSettings {
+	lineEndings := settings.LineEndings
+	if lineEndings == "" {
+		lineEndings = "Preserve"
+	}
+	return projectSettings{
+		LineEndings: lineEndings,
+		IgnoreRules: settings.IgnoreRules,
+		QuotaBytes:  settings.QuotaBytes,
+		DefaultRole: settings.DefaultRole,
+	}
+}
+
+// projectDefaultRole returns the name of the role granted to users of the project when no role is given, or "" if it
+// has none
+func projectDefaultRole(projectID int64, db dbfs.DBFS) (string, error) {
+	settings, err := db.MySQLProjectGetSettings(projectID)
+	return settings.DefaultRole, err
+}
+
+// settingsErrorResponse refuses a Project.UpdateSettings request for an invalid setting
+func settingsErrorResponse(tag int64, err error) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusFail,
+		Tag:    tag,
+		Data: struct {
+			Error string
+		}{
+			Error: err.Error(),
+		},
+	}.Wrap()
+}
+
+// Project.GetSettings
+type projectGetSettingsRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (p *projectGetSettingsRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectGetSettingsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	settings, err := db.MySQLProjectGetSettings(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data:   newProjectSettings(settings),
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Project.UpdateSettings
+type projectUpdateSettingsRequest struct {
+	ProjectID int64 `validate:"required"`
+	// The settings to change; those left out are unchanged
+	LineEndings *string   `validate:"omitempty,oneof=Preserve LF"`
+	IgnoreRules *[]string `validate:"omitempty,max=500"` // Empty removes the project's rules
+	QuotaBytes  *int64    // Server admins only; 0 or less removes the override
+	DefaultRole *string   // Empty removes the default
+	abstractRequest
+}
+
+func (p *projectUpdateSettingsRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectUpdateSettingsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityManageSettings, db)
+	if err == nil && hasPermission && p.QuotaBytes != nil {
+		hasPermission = isServerAdmin(p.config(), p.SenderID)
+	}
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	if p.IgnoreRules != nil {
+		if _, err := parseIgnoreRules(*p.IgnoreRules, false); err != nil {
+			return []dhClosure{toSenderClosure{msg: settingsErrorResponse(p.Tag, err)}}, nil
+		}
+	}
+	if p.DefaultRole != nil && *p.DefaultRole != "" {
+		role, err := config.RoleByName(*p.DefaultRole)
+		if err == nil && role.Name == config.OwnerRole.Name {
+			err = config.ErrNoMatchingRole
+		}
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: settingsErrorResponse(p.Tag, err)}}, nil
+		}
+	}
+
+	settings, err := db.MySQLProjectGetSettings(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+	if p.LineEndings != nil {
+		settings.LineEndings = *p.LineEndings
+		if settings.LineEndings == "Preserve" {
+			settings.LineEndings = ""
+		}
+	}
+	if p.IgnoreRules != nil {
+		settings.IgnoreRules = *p.IgnoreRules
+	}
+	if p.QuotaBytes != nil {
+		settings.QuotaBytes = *p.QuotaBytes
+		if settings.QuotaBytes < 0 {
+			settings.QuotaBytes = 0
+		}
+	}
+	if p.DefaultRole != nil {
+		settings.DefaultRole = *p.DefaultRole
+	}
+	if settings.IgnoreRules == nil {
+		settings.IgnoreRules = []string{}
+	}
+
+	err = db.MySQLProjectSetSettings(p.ProjectID, settings)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    p.Tag,
+		Data:   newProjectSettings(settings),
+	}.Wrap()
+	not := messages.Notification{
+		Resource:   p.Resource,
+		Method:     p.Method,
+		ResourceID: p.ProjectID,
+		Data:       newProjectSettings(settings),
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(p.ProjectID, 0, not)}, nil
+}
@@ -0,0 +1,87 @@
+package datahandling
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectSettingsRequests(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "project")
+	db.ProjectIgnoreRules[projectID] = []string{"*.o"}
+
+	get := projectGetSettingsRequest{ProjectID: projectID}
+	setBaseFields(&get)
+	get.Resource = "Project"
+	get.Method = "GetSettings"
+	res, _ := processForTest(t, &get, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, projectSettings{LineEndings: "Preserve", IgnoreRules: []string{"*.o"}}, res.Data)
+
+	lf, role := "LF", "write"
+	update := projectUpdateSettingsRequest{ProjectID: projectID, LineEndings: &lf, DefaultRole: &role}
+	setBaseFields(&update)
+	update.Resource = "Project"
+	update.Method = "UpdateSettings"
+	res, not := processForTest(t, &update, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	expected := projectSettings{LineEndings: "LF", IgnoreRules: []string{"*.o"}, DefaultRole: "write"}
+	assert.Equal(t, expected, res.Data, "settings left out should be unchanged")
+	require.NotNil(t, not)
+	assert.Equal(t, "UpdateSettings", not.Method)
+	assert.Equal(t, expected, not.Data)
+	assert.Equal(t, "LF", db.ProjectLineEndings[projectID])
+
+	// Settings are only changed if every one of them is valid
+	invalidRules, owner := []string{"[a-"}, "owner"
+	for _, invalid := range []projectUpdateSettingsRequest{
+		{ProjectID: projectID, IgnoreRules: &invalidRules, LineEndings: &lf},
+		{ProjectID: projectID, DefaultRole: &owner},
+	} {
+		invalid.abstractRequest = update.abstractRequest
+		res, _ = processForTest(t, &invalid, db)
+		assert.Equal(t, messages.StatusFail, res.Status)
+	}
+	assert.Equal(t, "write", db.ProjectSettings[projectID])
+
+	// Only server admins may override the quota
+	quota := int64(1 << 20)
+	update = projectUpdateSettingsRequest{ProjectID: projectID, QuotaBytes: &quota, abstractRequest: update.abstractRequest}
+	res, _ = processForTest(t, &update, db)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+	assert.Empty(t, db.ProjectQuotas)
+
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string) {
+		serverCfg.Admins = admins
+	}(serverCfg.Admins)
+	serverCfg.Admins = []string{"loganga"}
+	res, _ = processForTest(t, &update, db)
+	assert.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, quota, db.ProjectQuotas[projectID])
+}
+
+func TestProjectGrantPermissionsRequest_DefaultRole(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.Users["loganga"] = geneMeta
+	db.Users["notloganga"] = dbfs.UserMeta{Username: "notloganga"}
+	projectID, _ := db.MySQLProjectCreate("loganga", "new stuff")
+
+	grant := projectGrantPermissionsRequest{ProjectID: projectID, GrantUsername: "notloganga"}
+	setBaseFields(&grant)
+	res, _ := processForTest(t, &grant, db)
+	assert.Equal(t, messages.StatusFail, res.Status, "a role must be given without a default")
+
+	db.ProjectSettings[projectID] = "write"
+	res, _ = processForTest(t, &grant, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, config.WriteRole.Level, db.Projects["notloganga"][0].PermissionLevel)
+}
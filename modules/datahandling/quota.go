@@ -0,0 +1,76 @@
+package datahandling
+
+import (
+	"errors"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+/**
+ * Storage quotas. The size of each file is tracked as it is created and changed, and counts towards the quota of its
+ * project, and of the user that created it. Projects use the configured default quota unless an admin overrides it.
+ */
+
+// errQuotaExceeded is returned when a write would take a project or user over their storage quota
+var errQuotaExceeded = errors.New("Storage quota exceeded")
+
+// projectQuota returns the project's quota in bytes, or 0 if it is unlimited
+func projectQuota(cfg *config.Config, projectID int64, db dbfs.DBFS) (int64, error) {
+	quota, err := db.MySQLProjectGetQuota(projectID)
+	if err != nil || quota > 0 {
+		return quota, err
+	}
+	return cfg.ServerConfig.ProjectQuotaBytes, nil
+}
+
+// checkQuota returns errQuotaExceeded if adding delta bytes to a file in the project, created by the given user, would
+// take either of them over their quotas in the config
+func checkQuota(cfg *config.Config, projectID int64, creator string, delta int64, db dbfs.DBFS) error {
+	if delta <= 0 {
+		return nil
+	}
+
+	quota, err := projectQuota(cfg, projectID, db)
+	if err != nil {
+		return err
+	}
+	if quota > 0 {
+		usage, err := db.MySQLProjectGetUsage(projectID)
+		if err != nil {
+			return err
+		}
+		if usage+delta > quota {
+			return errQuotaExceeded
+		}
+	}
+
+	if quota := cfg.ServerConfig.UserQuotaBytes; quota > 0 {
+		usage, err := db.MySQLUserGetUsage(creator)
+		if err != nil {
+			return err
+		}
+		if usage+delta > quota {
+			return errQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// patchSizeDelta returns the number of bytes the patch adds to a file; it is negative if the patch shrinks the file
+func patchSizeDelta(changes string) (int64, error) {
+	patch, err := patching.NewPatchFromString(changes)
+	if err != nil {
+		return 0, err
+	}
+	var delta int64
+	for _, diff := range patch.Changes {
+		if diff.Insertion {
+			delta += int64(len(diff.Changes))
+		} else {
+			delta -= int64(len(diff.Changes))
+		}
+	}
+	return delta, nil
+}
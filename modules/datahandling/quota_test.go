@@ -0,0 +1,193 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatchSizeDelta(t *testing.T) {
+	delta, err := patchSizeDelta("v0:\n0:+3:abc,\n2:-1:x:\n10")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, delta)
+
+	_, err = patchSizeDelta("not a patch")
+	assert.Error(t, err)
+}
+
+func TestQuotaEnforcement(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(projectQuota, userQuota int64) {
+		serverCfg.ProjectQuotaBytes = projectQuota
+		serverCfg.UserQuotaBytes = userQuota
+	}(serverCfg.ProjectQuotaBytes, serverCfg.UserQuotaBytes)
+	serverCfg.ProjectQuotaBytes = 10
+	serverCfg.UserQuotaBytes = 0
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+
+	create := func(name string, content string) int {
+		req := *new(fileCreateRequest)
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Create"
+		req.Name = name
+		req.ProjectID = projectID
+		req.FileBytes = []byte(content)
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status
+	}
+	change := func(fileID int64, changes string) int {
+		req := *new(fileChangeRequest)
+		setBaseFields(&req)
+		req.Resource = "File"
+		req.Method = "Change"
+		req.FileID = fileID
+		req.Changes = changes
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status
+	}
+
+	assert.Equal(t, messages.StatusSuccess, create("a", "12345678"))
+	fileID := db.FileIDCounter
+	assert.Equal(t, messages.StatusQuotaExceeded, create("b", "123"), "file should not fit in the project's quota")
+
+	assert.Equal(t, messages.StatusSuccess, change(fileID, "v1:\n0:+2:ab:\n8"))
+	assert.Equal(t, messages.StatusQuotaExceeded, change(fileID, "v2:\n0:+1:c:\n10"))
+	assert.Equal(t, messages.StatusSuccess, change(fileID, "v2:\n0:-4:abcd:\n10"), "removing text is always allowed")
+
+	usage, _ := db.MySQLProjectGetUsage(projectID)
+	assert.EqualValues(t, 6, usage)
+
+	// An admin override takes precedence over the default
+	db.MySQLProjectSetQuota(projectID, 100)
+	assert.Equal(t, messages.StatusSuccess, create("b", "123"))
+
+	// User quotas count every file the user created
+	serverCfg.UserQuotaBytes = 12
+	assert.Equal(t, messages.StatusQuotaExceeded, create("c", "1234"))
+	assert.Equal(t, messages.StatusSuccess, create("c", "123"))
+}
+
+func TestAdminRequests_Process(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string, projectQuota int64) {
+		serverCfg.Admins = admins
+		serverCfg.ProjectQuotaBytes = projectQuota
+	}(serverCfg.Admins, serverCfg.ProjectQuotaBytes)
+	serverCfg.Admins = []string{"Admin"}
+	serverCfg.ProjectQuotaBytes = 50
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+	db.MySQLFileAddSize(fileID, 20)
+
+	getUsage := func(sender string) messages.Response {
+		req := *new(adminGetProjectUsageRequest)
+		setBaseFields(&req)
+		req.SenderID = sender
+		req.Resource = "Admin"
+		req.Method = "GetProjectUsage"
+		req.ProjectID = projectID
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+	setQuota := func(sender string, quota int64) int {
+		req := *new(adminSetProjectQuotaRequest)
+		setBaseFields(&req)
+		req.SenderID = sender
+		req.Resource = "Admin"
+		req.Method = "SetProjectQuota"
+		req.ProjectID = projectID
+		req.QuotaBytes = quota
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status
+	}
+
+	assert.Equal(t, messages.StatusUnauthorized, getUsage("loganga").Status)
+	assert.Equal(t, messages.StatusUnauthorized, setQuota("loganga", 1000))
+
+	resp := getUsage("admin")
+	require.Equal(t, messages.StatusSuccess, resp.Status)
+	assert.Equal(t, struct {
+		UsedBytes  int64
+		QuotaBytes int64
+		Override   bool
+	}{20, 50, false}, resp.Data)
+
+	assert.Equal(t, messages.StatusSuccess, setQuota("admin", 1000))
+	resp = getUsage("admin")
+	assert.Equal(t, struct {
+		UsedBytes  int64
+		QuotaBytes int64
+		Override   bool
+	}{20, 1000, true}, resp.Data)
+
+	assert.Equal(t, messages.StatusSuccess, setQuota("admin", 0))
+	assert.Empty(t, db.ProjectQuotas)
+}
+
+func TestAdminGetQuotaReport(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(admins []string, projectQuota int64) {
+		serverCfg.Admins = admins
+		serverCfg.ProjectQuotaBytes = projectQuota
+	}(serverCfg.Admins, serverCfg.ProjectQuotaBytes)
+	serverCfg.Admins = []string{"admin"}
+	serverCfg.ProjectQuotaBytes = 50
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	small, _ := db.MySQLProjectCreate("loganga", "small")
+	large, _ := db.MySQLProjectCreate("loganga", "large")
+	for projectID, size := range map[int64]int64{small: 10, large: 30} {
+		fileID, _ := db.MySQLFileCreate("loganga", "file", "", projectID)
+		db.MySQLFileAddSize(fileID, size)
+	}
+	db.MySQLProjectSetQuota(large, 20)
+
+	report := func(sender string, limit int) messages.Response {
+		req := *new(adminGetQuotaReportRequest)
+		setBaseFields(&req)
+		req.SenderID = sender
+		req.Resource = "Admin"
+		req.Method = "GetQuotaReport"
+		req.Limit = limit
+		closures, err := req.process(db)
+		require.NoError(t, err)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	}
+
+	assert.Equal(t, messages.StatusUnauthorized, report("loganga", 0).Status)
+
+	// Projects using the most storage come first, with the quota that applies to them
+	resp := report("admin", 0)
+	require.Equal(t, messages.StatusSuccess, resp.Status)
+	projects := reflect.ValueOf(resp.Data).FieldByName("Projects")
+	require.Equal(t, 2, projects.Len())
+	largeQuota := projects.Index(0).Interface()
+	assert.Equal(t, large, reflect.ValueOf(largeQuota).FieldByName("ProjectID").Int())
+	assert.Equal(t, "loganga", reflect.ValueOf(largeQuota).FieldByName("Owner").String())
+	assert.EqualValues(t, 20, reflect.ValueOf(largeQuota).FieldByName("QuotaBytes").Int())
+	assert.True(t, reflect.ValueOf(largeQuota).FieldByName("Override").Bool())
+	smallQuota := projects.Index(1).Interface()
+	assert.EqualValues(t, 50, reflect.ValueOf(smallQuota).FieldByName("QuotaBytes").Int(), "the default quota should apply")
+
+	assert.Equal(t, 1, reflect.ValueOf(report("admin", 1).Data).FieldByName("Projects").Len())
+}
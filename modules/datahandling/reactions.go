@@ -0,0 +1,210 @@
+package datahandling
+
+import (
+	"errors"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Clients show who has seen a change or comment with read receipts on the project's sequenced notifications; see
+ * notifications.go. Notification.Ack records the sequence number of the last notification the user has seen, which
+ * never goes back, and tells the project's other subscribers with an ephemeral Notification.Ack notification;
+ * Notification.GetAcks returns everyone's, so clients can tell who has seen each notification. Users may also react
+ * to comments, usually with an emoji, with Comment.React; reactions are returned by Comment.List.
+ */
+
+var errInvalidAckSequence = errors.New("The project has not sent a notification with that sequence number")
+
+var reactionRequestsSetup = false
+
+// initReactionRequests populates the requestMap from requestmap.go with the appropriate constructors for the read
+// receipt and reaction methods
+func initReactionRequests() {
+	if reactionRequestsSetup {
+		return
+	}
+
+	authenticatedRequestMap["Notification.Ack"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(notificationAckRequest), req)
+	}
+
+	authenticatedRequestMap["Notification.GetAcks"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(notificationGetAcksRequest), req)
+	}
+
+	authenticatedRequestMap["Comment.React"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(commentReactRequest), req)
+	}
+
+	reactionRequestsSetup = true
+}
+
+// Notification.Ack
+type notificationAckRequest struct {
+	ProjectID int64 `validate:"required"`
+	Sequence  int64 `validate:"required,min=1"` // The last of the project's notifications the user has seen
+	abstractRequest
+}
+
+func (n *notificationAckRequest) setAbstractRequest(req *abstractRequest) {
+	n.abstractRequest = *req
+}
+
+func (n notificationAckRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(n.abstractRequest, n.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  n.Resource,
+			"Method":    n.Method,
+			"SenderID":  n.SenderID,
+			"ProjectID": n.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, n.Tag)}}, nil
+	}
+
+	latest, err := db.CBGetNotificationSequence(n.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, n.Tag)}}, err
+	}
+	if n.Sequence > latest {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, n.Tag)}}, errInvalidAckSequence
+	}
+
+	err = db.MySQLNotificationAck(n.SenderID, n.ProjectID, n.Sequence)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, n.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, n.Tag)
+	not := messages.Notification{
+		Resource:   n.Resource,
+		Method:     n.Method,
+		ResourceID: n.ProjectID,
+		Data: struct {
+			Username string
+			Sequence int64
+		}{
+			Username: n.SenderID,
+			Sequence: n.Sequence,
+		},
+	}.Wrap()
+	// Acks are superseded by the user's next one, and recorded for Notification.GetAcks, so they needn't be sequenced
+	ack := projectNotificationClosure(n.ProjectID, 0, not)
+	ack.ephemeral = true
+
+	return []dhClosure{toSenderClosure{msg: res}, ack}, nil
+}
+
+// Notification.GetAcks
+type notificationGetAcksRequest struct {
+	ProjectID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (n *notificationGetAcksRequest) setAbstractRequest(req *abstractRequest) {
+	n.abstractRequest = *req
+}
+
+func (n notificationGetAcksRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(n.abstractRequest, n.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  n.Resource,
+			"Method":    n.Method,
+			"SenderID":  n.SenderID,
+			"ProjectID": n.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, n.Tag)}}, nil
+	}
+
+	acks, err := db.MySQLProjectGetNotificationAcks(n.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, n.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    n.Tag,
+		Data: struct {
+			Acks []dbfs.NotificationAckMeta
+		}{
+			Acks: acks,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Comment.React
+type commentReactRequest struct {
+	CommentID int64  `validate:"required"`
+	Reaction  string `validate:"required,max=16"`
+	Remove    bool   // Removes the user's reaction instead
+	abstractRequest
+}
+
+func (c *commentReactRequest) setAbstractRequest(req *abstractRequest) {
+	c.abstractRequest = *req
+}
+
+func (c commentReactRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	comment, fileMeta, err := commentFile(c.CommentID, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	hasPermission, err := authorizeProject(c.abstractRequest, fileMeta.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  c.Resource,
+			"Method":    c.Method,
+			"SenderID":  c.SenderID,
+			"ProjectID": fileMeta.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, c.Tag)}}, nil
+	}
+
+	reaction := dbfs.CommentReactionMeta{CommentID: comment.CommentID, Username: c.SenderID, Reaction: c.Reaction}
+	err = db.MySQLCommentSetReaction(reaction, c.Remove)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+
+	fileReactions, err := db.MySQLFileGetCommentReactions(comment.FileID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, c.Tag)}}, err
+	}
+	reactions := []dbfs.CommentReactionMeta{}
+	for _, reaction := range fileReactions {
+		if reaction.CommentID == comment.CommentID {
+			reactions = append(reactions, reaction)
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    c.Tag,
+		Data: struct {
+			Reactions []dbfs.CommentReactionMeta // Every reaction to the comment
+		}{
+			Reactions: reactions,
+		},
+	}.Wrap()
+	not := messages.Notification{
+		Resource:   c.Resource,
+		Method:     c.Method,
+		ResourceID: comment.CommentID,
+		Data: struct {
+			dbfs.CommentReactionMeta
+			Remove bool
+		}{
+			CommentReactionMeta: reaction,
+			Remove:              c.Remove,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}, projectNotificationClosure(fileMeta.ProjectID, comment.FileID, not)}, nil
+}
@@ -0,0 +1,101 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationAck(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "seen")
+	db.MySQLProjectGrantPermission(projectID, "notloganga", config.ReadRole.Level, "loganga")
+	db.NotificationSequences[projectID] = 5
+
+	ack := func(senderID string, sequence int64) (*notificationAckRequest, []dhClosure, error) {
+		req := &notificationAckRequest{ProjectID: projectID, Sequence: sequence}
+		req.setAbstractRequest(&abstractRequest{Resource: "Notification", Method: "Ack", SenderID: senderID})
+		closures, err := req.process(db)
+		return req, closures, err
+	}
+
+	_, closures, err := ack("loganga", 4)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	notification := closures[1].(toRabbitChannelClosure)
+	assert.True(t, notification.ephemeral, "acks shouldn't be sequenced")
+	assert.Equal(t, "Ack", notification.msg.ServerMessage.(messages.Notification).Method)
+
+	// Acks never go back, nor past the latest notification
+	_, _, err = ack("loganga", 2)
+	require.NoError(t, err)
+	_, closures, err = ack("notloganga", 6)
+	assert.Equal(t, errInvalidAckSequence, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	_, _, err = ack("notloganga", 5)
+	require.NoError(t, err)
+
+	req := &notificationGetAcksRequest{ProjectID: projectID}
+	req.setAbstractRequest(&abstractRequest{Resource: "Notification", Method: "GetAcks", SenderID: "notloganga"})
+	res, _ := processForTest(t, req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	acks := reflect.ValueOf(res.Data).FieldByName("Acks").Interface().([]dbfs.NotificationAckMeta)
+	require.Len(t, acks, 2)
+	assert.Equal(t, "loganga", acks[0].Username)
+	assert.EqualValues(t, 4, acks[0].Sequence)
+	assert.Equal(t, "notloganga", acks[1].Username)
+	assert.EqualValues(t, 5, acks[1].Sequence)
+}
+
+func TestCommentReact(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "reviewed")
+	fileID, _ := db.MySQLFileCreate("loganga", "reviewed.txt", ".", projectID)
+	db.MySQLProjectGrantPermission(projectID, "notloganga", config.ReadRole.Level, "loganga")
+	commentID, _ := db.MySQLCommentCreate(dbfs.CommentMeta{FileID: fileID, Author: "loganga", Body: "Rename?"})
+	otherID, _ := db.MySQLCommentCreate(dbfs.CommentMeta{FileID: fileID, Author: "loganga", Body: "Typo"})
+
+	react := func(senderID string, commentID int64, reaction string, remove bool) []dbfs.CommentReactionMeta {
+		res, not := processForTest(t, commentRequest(&commentReactRequest{CommentID: commentID, Reaction: reaction,
+			Remove: remove}, "React", senderID), db)
+		require.Equal(t, messages.StatusSuccess, res.Status)
+		require.NotNil(t, not)
+		assert.Equal(t, commentID, not.ResourceID)
+		return reflect.ValueOf(res.Data).FieldByName("Reactions").Interface().([]dbfs.CommentReactionMeta)
+	}
+
+	react("loganga", otherID, "👀", false)
+	react("loganga", commentID, "👍", false)
+	react("loganga", commentID, "👍", false)
+	reactions := react("notloganga", commentID, "👍", false)
+	assert.Equal(t, []dbfs.CommentReactionMeta{
+		{CommentID: commentID, Username: "loganga", Reaction: "👍"},
+		{CommentID: commentID, Username: "notloganga", Reaction: "👍"},
+	}, reactions, "reactions should only be counted once per user")
+
+	reactions = react("loganga", commentID, "👍", true)
+	assert.Equal(t, []dbfs.CommentReactionMeta{{CommentID: commentID, Username: "notloganga", Reaction: "👍"}}, reactions)
+
+	// Reactions are listed with the comments
+	res, _ := processForTest(t, commentRequest(&commentListRequest{FileID: fileID}, "List", "notloganga"), db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []dbfs.CommentReactionMeta{
+		{CommentID: commentID, Username: "notloganga", Reaction: "👍"},
+		{CommentID: otherID, Username: "loganga", Reaction: "👀"},
+	}, reflect.ValueOf(res.Data).FieldByName("Reactions").Interface())
+
+	// Reactions go with the file's comments
+	db.MySQLFileDelete(fileID)
+	assert.Empty(t, db.CommentReactions)
+}
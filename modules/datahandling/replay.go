@@ -0,0 +1,117 @@
+package datahandling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Authenticated requests carry the Timestamp they were sent at, in seconds since the Unix epoch, and a Nonce unique
+ * to each request, so that a captured WebSocket frame can't be sent again to repeat a destructive request, such as
+ * File.Delete. If the ReplayWindow is configured, requests whose Timestamp is further than it from the server's clock
+ * are rejected, and every Nonce a user sends is remembered until its request's Timestamp falls out of the window; a
+ * request repeating one is rejected. Requests without a Nonce are only rejected if RequireNonce is set, so that older
+ * clients keep working until it is.
+ *
+ * Nonces are remembered by the server that received them. A frame replayed to a different server is still rejected
+ * once the window has passed.
+ */
+
+// maxNonceLength bounds the memory each remembered nonce takes
+const maxNonceLength = 64
+
+// nonces are the nonces seen within the replay window, by sender
+var nonces = &nonceCache{seen: make(map[nonceKey]time.Time)}
+
+type nonceKey struct {
+	username string
+	nonce    string
+}
+
+// nonceCache remembers nonces until their requests' Timestamps fall out of the replay window
+type nonceCache struct {
+	mutex  sync.Mutex
+	seen   map[nonceKey]time.Time // When the nonce can be forgotten
+	pruned time.Time
+}
+
+// add remembers the nonce until the given time, returning false if it has already been seen
+func (cache *nonceCache) add(key nonceKey, until time.Time, now time.Time) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if forget, ok := cache.seen[key]; ok && now.Before(forget) {
+		return false
+	}
+	cache.seen[key] = until
+
+	// Forgetting is only needed to bound memory, so it is done at most once a second
+	if now.Sub(cache.pruned) >= time.Second {
+		for key, forget := range cache.seen {
+			if !now.Before(forget) {
+				delete(cache.seen, key)
+			}
+		}
+		cache.pruned = now
+	}
+	return true
+}
+
+// newReplayError tells the client which field of its request's envelope is rejected
+func newReplayError(field string, problem string) *requestValidationError {
+	return &requestValidationError{
+		Reason: "Invalid request",
+		Fields: []fieldError{{Field: field, Problem: problem}},
+	}
+}
+
+// checkReplay returns an error if the authenticated request was sent outside the replay window, or repeats a nonce
+func checkReplay(req *abstractRequest, now time.Time) *requestValidationError {
+	cfg := req.config().ServerConfig
+	window, err := cfg.ReplayWindowDuration()
+	if err != nil {
+		utils.LogError("Invalid ReplayWindow; requests are not checked for replays", err, utils.LogFields{
+			"ReplayWindow": cfg.ReplayWindow,
+		})
+		return nil
+	}
+	if window == 0 {
+		return nil
+	}
+
+	sent := time.Unix(req.Timestamp, 0)
+	if sent.Before(now.Add(-window)) || sent.After(now.Add(window)) {
+		return newReplayError("Timestamp", fmt.Sprintf("must be within %s of the server's time", window))
+	}
+
+	if req.Nonce == "" {
+		if cfg.RequireNonce {
+			return newReplayError("Nonce", "is required")
+		}
+		return nil
+	}
+	if len(req.Nonce) > maxNonceLength {
+		return newReplayError("Nonce", fmt.Sprintf("must be at most %d bytes long", maxNonceLength))
+	}
+	if !nonces.add(nonceKey{username: req.SenderID, nonce: req.Nonce}, sent.Add(window), now) {
+		utils.LogWarn("Rejected replayed request", utils.LogFields{
+			"Resource": req.Resource,
+			"Method":   req.Method,
+			"SenderID": req.SenderID,
+		})
+		return newReplayError("Nonce", "was already used")
+	}
+	return nil
+}
+
+// NewNonce returns a random nonce, for transports that build a request's envelope on the server
+func NewNonce() string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	return hex.EncodeToString(nonce)
+}
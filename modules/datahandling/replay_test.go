@@ -0,0 +1,66 @@
+package datahandling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckReplay(t *testing.T) {
+	configSetup(t)
+	now := time.Now()
+	req := abstractRequest{SenderID: "loganga", Resource: "File", Method: "Delete", Timestamp: now.Unix(), Nonce: NewNonce()}
+
+	// Nothing is checked unless the window is configured
+	assert.Nil(t, checkReplay(&req, now))
+	assert.Nil(t, checkReplay(&req, now))
+
+	defer func(cfg config.ServerCfg) { config.GetConfig().ServerConfig = cfg }(config.GetConfig().ServerConfig)
+	config.GetConfig().ServerConfig.ReplayWindow = "5m"
+	req.Nonce = NewNonce()
+	assert.Nil(t, checkReplay(&req, now))
+	invalid := checkReplay(&req, now.Add(time.Minute))
+	require.NotNil(t, invalid)
+	assert.Equal(t, "Nonce", invalid.Fields[0].Field)
+
+	// Nonces are per user
+	other := req
+	other.SenderID = "geneh"
+	assert.Nil(t, checkReplay(&other, now))
+
+	// Requests outside the window are rejected, whatever their nonce
+	for _, sent := range []time.Time{now.Add(-6 * time.Minute), now.Add(6 * time.Minute)} {
+		stale := req
+		stale.Timestamp = sent.Unix()
+		stale.Nonce = NewNonce()
+		invalid := checkReplay(&stale, now)
+		require.NotNil(t, invalid)
+		assert.Equal(t, "Timestamp", invalid.Fields[0].Field)
+	}
+
+	// Requests without a nonce are only rejected if one is required
+	req.Nonce = ""
+	assert.Nil(t, checkReplay(&req, now))
+	config.GetConfig().ServerConfig.RequireNonce = true
+	invalid = checkReplay(&req, now)
+	require.NotNil(t, invalid)
+	assert.Equal(t, "Nonce", invalid.Fields[0].Field)
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := &nonceCache{seen: make(map[nonceKey]time.Time)}
+	now := time.Now()
+	key := nonceKey{username: "loganga", nonce: "abc"}
+
+	assert.True(t, cache.add(key, now.Add(time.Minute), now))
+	assert.False(t, cache.add(key, now.Add(time.Minute), now.Add(30*time.Second)))
+
+	// Nonces are forgotten once their requests fall out of the window
+	later := now.Add(2 * time.Minute)
+	assert.True(t, cache.add(nonceKey{username: "loganga", nonce: "def"}, later.Add(time.Minute), later))
+	assert.Len(t, cache.seen, 1)
+	assert.True(t, cache.add(key, later.Add(time.Minute), later))
+}
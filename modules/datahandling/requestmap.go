@@ -2,8 +2,10 @@ package datahandling
 
 import (
 	"errors"
+	"strings"
+	"time"
 
-	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
 )
 
 /**
@@ -20,19 +22,44 @@ func init() {
 	initProjectRequests()
 	initUserRequests()
 	initFileRequests()
+	initTeamRequests()
+	initSessionRequests()
+	initAdminRequests()
+	initCommentRequests()
+	initReactionRequests()
 }
 
-func getFullRequest(req *abstractRequest) (request, error) {
+func getFullRequest(req *abstractRequest, db dbfs.DBFS) (request, error) {
 	if _, contains := unauthenticatedRequestMap[(*req).Resource+"."+(*req).Method]; contains {
 		// unauthenticated request
 		return unauthenticatedRequest(req)
 	}
 
 	// authenticated request
-	if config.GetConfig().ServerConfig.DisableAuth || authenticate(*req) == nil {
+	if req.config().ServerConfig.DisableAuth {
 		return authenticatedRequest(req)
 	}
-	return nil, ErrAuthenticationFailed
+
+	var err error
+	if strings.HasPrefix(req.SenderToken, apiTokenPrefix) {
+		err = authenticateAPIToken(req, db)
+	} else if err = authenticate(*req); err == nil && revokedTokens.isRevoked(req.SenderToken, db) {
+		err = errors.New("authenticate - session token was revoked")
+	}
+	if err != nil {
+		return nil, ErrAuthenticationFailed
+	}
+	// Requests are processed as the sender's current username, even if their token was issued to one they had before
+	req.SenderID = usernameAliases.resolve(req.SenderID, db)
+
+	if invalid := checkReplay(req, time.Now()); invalid != nil {
+		return nil, invalid
+	}
+
+	if err := authorizeRequest(req); err != nil {
+		return nil, err
+	}
+	return authenticatedRequest(req)
 }
 
 // authenticatedRequest returns fully parsed Request from the given authenticated AbstractRequest
@@ -3,8 +3,12 @@ package datahandling
 import (
 	"encoding/json"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -27,7 +31,7 @@ func TestProjectCreateRequest(t *testing.T) {
 		"\"Name\": \"Namey\"" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -48,7 +52,7 @@ func TestProjectRenameRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,7 +70,7 @@ func TestProjectGetPermissionConstantsRequest(t *testing.T) {
 	req.SenderToken = testToken(t, TestSenderID)
 	req.Data = json.RawMessage("{}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -76,6 +80,24 @@ func TestProjectGetPermissionConstantsRequest(t *testing.T) {
 	}
 }
 
+func TestProjectListRolesRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Project"
+	req.Method = "ListRoles"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.projectListRolesRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
 func TestProjectGrantPermissionsRequest(t *testing.T) {
 	req := *new(abstractRequest)
 	req.Resource = "Project"
@@ -88,7 +110,7 @@ func TestProjectGrantPermissionsRequest(t *testing.T) {
 		"\"PermissionLevel\": 1" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -109,7 +131,7 @@ func TestProjectRevokePermissionsRequest(t *testing.T) {
 		"\"RevokeUsername\": \"loganga\"" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -129,7 +151,7 @@ func TestProjectGetOnlineClientsRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -146,7 +168,7 @@ func TestProjectLookupRequest(t *testing.T) {
 	req.SenderID = TestSenderID
 	req.SenderToken = testToken(t, TestSenderID)
 	req.Data = json.RawMessage("{\"ProjectIds\": [12345, 38292]}")
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -166,7 +188,7 @@ func TestProjectGetFilesRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -186,7 +208,7 @@ func TestProjectSubscribeRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -206,7 +228,7 @@ func TestProjectUnsubscribeRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -226,7 +248,7 @@ func TestProjectDeleteRequest(t *testing.T) {
 		"\"ProjectID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -251,7 +273,7 @@ func TestFileCreateRequest(t *testing.T) {
 		"\"FileBytes\": [2]" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -272,7 +294,7 @@ func TestFileRenameRequest(t *testing.T) {
 		"\"FileID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -293,7 +315,7 @@ func TestFileMoveRequest(t *testing.T) {
 		"\"FileID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -313,7 +335,7 @@ func TestFileDeleteRequest(t *testing.T) {
 		"\"FileID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -335,7 +357,7 @@ func TestFileChangeRequest(t *testing.T) {
 		"\"Changes\": \"ok\"" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -345,6 +367,89 @@ func TestFileChangeRequest(t *testing.T) {
 	}
 }
 
+func TestFileSearchRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "File"
+	req.Method = "Search"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"FileID\": 12345, " +
+		"\"Query\": \"func\"" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.fileSearchRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+func TestProjectSearchRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Project"
+	req.Method = "Search"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"ProjectID\": 12345, " +
+		"\"Query\": \"func\"" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.projectSearchRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+func TestFileSetMetadataRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "File"
+	req.Method = "SetMetadata"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"FileID\": 12345, " +
+		"\"Metadata\": {\"language\": \"go\"}" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.fileSetMetadataRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+func TestFileGetMetadataRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "File"
+	req.Method = "GetMetadata"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"FileID\": 12345" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.fileGetMetadataRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
 func TestFilePullRequest(t *testing.T) {
 	req := *new(abstractRequest)
 	req.Resource = "File"
@@ -355,7 +460,7 @@ func TestFilePullRequest(t *testing.T) {
 		"\"FileID\": 12345" +
 		"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -365,6 +470,94 @@ func TestFilePullRequest(t *testing.T) {
 	}
 }
 
+// Team functions
+
+func TestTeamCreateRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Team"
+	req.Method = "Create"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"Name\": \"Namey\"" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.teamCreateRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+func TestTeamAddMemberRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Team"
+	req.Method = "AddMember"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"TeamID\": 12345, " +
+		"\"Username\": \"jshap70\", " +
+		"\"IsAdmin\": true" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.teamAddMemberRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+func TestTeamGrantProjectAccessRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Team"
+	req.Method = "GrantProjectAccess"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"TeamID\": 12345, " +
+		"\"ProjectID\": 12345, " +
+		"\"PermissionLevel\": 4" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.teamGrantProjectAccessRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
+// Session functions
+
+func TestSessionResumeRequest(t *testing.T) {
+	req := *new(abstractRequest)
+	req.Resource = "Session"
+	req.Method = "Resume"
+	req.SenderID = TestSenderID
+	req.SenderToken = testToken(t, TestSenderID)
+	req.Data = json.RawMessage("{" +
+		"\"SessionID\": \"0123456789abcdef0123456789abcdef\"" +
+		"}")
+
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.TypeOf(newRequest).String() != "*datahandling.sessionResumeRequest" {
+		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
+	}
+}
+
 // User functions
 
 func TestUserLookupRequest(t *testing.T) {
@@ -376,7 +569,7 @@ func TestUserLookupRequest(t *testing.T) {
 	req.Data = json.RawMessage(
 		"{\"Usernames\": [\"jshap70\"]" +
 			"}")
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -393,7 +586,7 @@ func TestUserProjectsRequest(t *testing.T) {
 	req.SenderID = TestSenderID
 	req.SenderToken = testToken(t, TestSenderID)
 	req.Data = json.RawMessage("{}")
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -410,7 +603,7 @@ func TestUserDeleteRequest(t *testing.T) {
 	req.SenderID = TestSenderID
 	req.SenderToken = testToken(t, TestSenderID)
 	req.Data = json.RawMessage("{}")
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	assert.Nil(t, err, "error getting User.Delete request")
 
 	assert.IsType(t, &userDeleteRequest{}, newRequest, "returned wrong request type")
@@ -434,7 +627,7 @@ func TestUserRegisterRequest(t *testing.T) {
 			"\"Password\":\"correct horse battery staple\"" +
 			"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -453,7 +646,7 @@ func TestUserLoginRequest(t *testing.T) {
 			"\"Password\":\"correct horse battery staple\"" +
 			"}")
 
-	newRequest, err := getFullRequest(&req)
+	newRequest, err := getFullRequest(&req, dbfs.NewDBMock())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -462,3 +655,74 @@ func TestUserLoginRequest(t *testing.T) {
 		t.Fatalf("wrong request type, got: %s", reflect.TypeOf(newRequest))
 	}
 }
+
+// The client library's request types must match the requests the server accepts
+func TestClientRequestsInSync(t *testing.T) {
+	requestMaps := []map[string](func(req *abstractRequest) (request, error)){authenticatedRequestMap, unauthenticatedRequestMap}
+	for _, requestMap := range requestMaps {
+		for name := range requestMap {
+			_, ok := client.Requests[name]
+			assert.True(t, ok, "%s is missing from the client", name)
+		}
+	}
+
+	for name, clientReq := range client.Requests {
+		constructor, ok := authenticatedRequestMap[name]
+		if !ok {
+			constructor, ok = unauthenticatedRequestMap[name]
+		}
+		if !assert.True(t, ok, "%s is not a request the server accepts", name) {
+			continue
+		}
+
+		parts := strings.SplitN(name, ".", 2)
+		req, err := constructor(&abstractRequest{Resource: parts[0], Method: parts[1], Data: json.RawMessage("{}")})
+		if _, invalid := err.(*requestValidationError); err != nil && !invalid {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		assert.Equal(t, requestFields(reflect.TypeOf(req)), requestFields(reflect.TypeOf(clientReq)), name)
+	}
+}
+
+// requestFields returns the types of the exported fields of a request's data, by name
+func requestFields(typ reflect.Type) map[string]string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	fields := make(map[string]string)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		fields[field.Name] = fieldShape(field.Type)
+	}
+	return fields
+}
+
+// fieldShape describes the type of a field; structs, such as those of the entries of a list, are described by their
+// exported fields, since the client and server each have their own
+func fieldShape(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return "*" + fieldShape(typ.Elem())
+	case reflect.Slice:
+		return "[]" + fieldShape(typ.Elem())
+	case reflect.Map:
+		return "map[" + fieldShape(typ.Key()) + "]" + fieldShape(typ.Elem())
+	case reflect.Struct:
+		fields := requestFields(typ)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		shape := "struct{"
+		for _, name := range names {
+			shape += name + " " + fields[name] + "; "
+		}
+		return shape + "}"
+	}
+	return typ.String()
+}
@@ -0,0 +1,182 @@
+package datahandling
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * A client that keeps sending File.Change requests against stale versions of a file will keep being answered with
+ * StatusVersionOutOfDate, and may keep retrying rather than catching up. Once a connection has had resyncHintConflicts
+ * changes to the same file rejected in a row, the server sends it a File.ResyncRequired notification with the file's
+ * current version and the patch from the version the client's last change was made against, as File.Diff returns, so
+ * that the client can apply it and rebase its pending changes. If that version's patches are no longer kept, the patch
+ * is left out, and the client must pull the file instead. Accepted changes clear the count, as does sending the hint.
+ *
+ * Counts are kept by the server the connection is on, by session, so only WebSocket connections are sent hints.
+ */
+
+// resyncHintConflicts is how many changes to a file a connection has rejected in a row before it is sent a hint
+const resyncHintConflicts = 3
+
+// resyncHintWindow is how long a connection's rejected changes are counted for after the last of them
+const resyncHintWindow = 5 * time.Minute
+
+// staleChanges counts the rejected changes of this server's connections
+var staleChanges = &staleChangeTracker{counts: make(map[staleChangeKey]staleChangeCount)}
+
+type staleChangeKey struct {
+	sessionID string
+	fileID    int64
+}
+
+type staleChangeCount struct {
+	rejected int
+	last     time.Time
+}
+
+type staleChangeTracker struct {
+	counts map[staleChangeKey]staleChangeCount
+	mutex  sync.Mutex
+}
+
+// record counts the outcome of a connection's change to a file, and returns whether it should be sent a hint
+func (tracker *staleChangeTracker) record(sessionID string, fileID int64, stale bool, now time.Time) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	key := staleChangeKey{sessionID: sessionID, fileID: fileID}
+	if !stale {
+		delete(tracker.counts, key)
+		return false
+	}
+
+	// Counts of connections that have since closed, or caught up by other means, are forgotten
+	for other, count := range tracker.counts {
+		if now.Sub(count.last) > resyncHintWindow {
+			delete(tracker.counts, other)
+		}
+	}
+
+	count := tracker.counts[key]
+	count.rejected++
+	count.last = now
+	if count.rejected >= resyncHintConflicts {
+		delete(tracker.counts, key)
+		return true
+	}
+	tracker.counts[key] = count
+	return false
+}
+
+// resyncRequired is the Data of File.ResyncRequired notifications
+type resyncRequired struct {
+	FileVersion int64  // The file's current version
+	FromVersion int64  // The version the client's last change was made against; 0 if Changes is empty
+	Changes     string // The patch from FromVersion to FileVersion; empty if the client must pull the file
+	LineEndings string // CRLF if Changes was converted to the client's CRLF
+}
+
+type resyncHintClosure struct {
+	change fileChangeRequest
+	stale  bool // Whether the change was rejected for being made against a stale version
+}
+
+// newResyncHintClosure returns the closure counting the outcome of the File.Change request, given the status it was
+// answered with
+func newResyncHintClosure(change fileChangeRequest, status int) resyncHintClosure {
+	return resyncHintClosure{change: change, stale: status == messages.StatusVersionOutOfDate}
+}
+
+// hintResync counts the outcome of File.Change requests, for the connection to be sent a hint once it needs one
+func hintResync(next processor) processor {
+	return func(dh DataHandler, call *requestCall, db dbfs.DBFS) ([]dhClosure, error) {
+		closures, err := next(dh, call, db)
+		if change, ok := call.full.(*fileChangeRequest); ok {
+			if res, ok := senderResponse(closures, call.req.Tag); ok {
+				closures = append(closures, newResyncHintClosure(*change, res.Status))
+			}
+		}
+		return closures, err
+	}
+}
+
+// resyncHintClosure.call sends the connection a hint once it has had too many changes to the file rejected
+func (cont resyncHintClosure) call(dh DataHandler) error {
+	if dh.SessionID == "" || !staleChanges.record(dh.SessionID, cont.change.FileID, cont.stale, time.Now()) {
+		return nil
+	}
+
+	hint, err := cont.hint(dh.Db)
+	if err != nil {
+		return err
+	}
+	utils.LogDebug("Sending resync hint", utils.LogFields{
+		"FileID":      cont.change.FileID,
+		"SenderID":    cont.change.SenderID,
+		"FileVersion": hint.FileVersion,
+	})
+
+	not := messages.Notification{
+		Resource:   "File",
+		Method:     "ResyncRequired",
+		ResourceID: cont.change.FileID,
+		Data:       hint,
+	}.Wrap()
+	return toSenderClosure{msg: not}.call(dh)
+}
+
+// hint returns the file's current version, and the patch to it from the version the rejected change was made against
+func (cont resyncHintClosure) hint(db dbfs.DBFS) (resyncRequired, error) {
+	fileMeta, err := db.MySQLFileGetInfo(cont.change.FileID)
+	if err != nil {
+		return resyncRequired{}, err
+	}
+	rawFile, changes, err := db.PullFile(fileMeta)
+	if err != nil {
+		return resyncRequired{}, err
+	}
+	version, err := db.CBGetFileVersion(fileMeta.FileID)
+	if err != nil {
+		return resyncRequired{}, err
+	}
+
+	hint := resyncRequired{FileVersion: version}
+	stale, err := patching.NewPatchFromString(cont.change.Changes)
+	if err != nil {
+		return hint, nil
+	}
+	patch, err := diffVersions(*rawFile, changes, version, stale.BaseVersion, version)
+	if err == errBaseVersionUnavailable || err == errVersionRange {
+		return hint, nil
+	} else if err != nil {
+		return resyncRequired{}, err
+	}
+	hint.FromVersion, hint.Changes = stale.BaseVersion, patch.String()
+
+	if cont.change.LineEndings == lineEndingsCRLF {
+		normalized, err := normalizesLineEndings(fileMeta.ProjectID, db)
+		if err != nil {
+			return resyncRequired{}, err
+		}
+		var history *lfHistory
+		if normalized {
+			history, err = newLFHistory(*rawFile, changes)
+			if err != nil {
+				return resyncRequired{}, err
+			}
+		}
+		if history != nil {
+			if hint.Changes, err = history.toCRLF(hint.Changes); err != nil {
+				return resyncRequired{}, err
+			}
+			hint.LineEndings = lineEndingsCRLF
+		}
+	}
+	return hint, nil
+}
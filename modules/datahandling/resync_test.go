@@ -0,0 +1,110 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resyncHints returns the File.ResyncRequired notifications sent to the client
+func resyncHints(t *testing.T, messageChan chan rabbitmq.AMQPMessage) []resyncRequired {
+	var hints []resyncRequired
+	for len(messageChan) > 0 {
+		msg := <-messageChan
+		var not struct {
+			ServerMessage struct {
+				Method     string
+				ResourceID int64
+				Data       resyncRequired
+			}
+		}
+		require.NoError(t, json.Unmarshal(msg.Message, &not))
+		if not.ServerMessage.Method == "ResyncRequired" {
+			hints = append(hints, not.ServerMessage.Data)
+		}
+	}
+	return hints
+}
+
+func TestResyncHints(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "stale")
+	fileID, _ := db.MySQLFileCreate("loganga", "stale.txt", ".", projectID)
+	raw := []byte("one\ntwo\n")
+	db.File = &raw
+	db.FileVersion[fileID] = 6
+	db.FileChanges[fileID] = []string{"v3:\n0:+1:x:\n8", "v4:\n5:-3:two:\n9", "v5:\n5:+5:three:\n6"}
+
+	messageChan := make(chan rabbitmq.AMQPMessage, 64)
+	dh := DataHandler{MessageChan: messageChan, WebsocketID: 1, SessionID: "stale-session", Db: db}
+	tag := 0
+	change := func(changes string) {
+		tag++
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		dh.Handle(0, []byte(fmt.Sprintf(
+			`{"Tag": %d, "Resource": "File", "Method": "Change", "SenderID": %q, "SenderToken": %q, "Data": {"FileID": %d, "Changes": %q}}`,
+			tag, "loganga", testToken(t, "loganga"), fileID, changes)), wg)
+	}
+
+	db.ConflictFileChanges(fileID, resyncHintConflicts-1)
+	for i := 0; i < resyncHintConflicts-1; i++ {
+		change("v4:\n0:+1:y:\n9")
+	}
+	assert.Empty(t, resyncHints(t, messageChan))
+
+	// Accepted changes clear the count
+	change("v6:\n0:+1:y:\n11")
+	db.ConflictFileChanges(fileID, resyncHintConflicts)
+	for i := 0; i < resyncHintConflicts-1; i++ {
+		change("v4:\n0:+1:y:\n9")
+	}
+	assert.Empty(t, resyncHints(t, messageChan))
+
+	change("v4:\n0:+1:y:\n9")
+	hints := resyncHints(t, messageChan)
+	require.Len(t, hints, 1)
+	assert.EqualValues(t, 7, hints[0].FileVersion)
+	assert.EqualValues(t, 4, hints[0].FromVersion)
+	patch, err := patching.NewPatchFromString(hints[0].Changes)
+	require.NoError(t, err)
+	text, err := patching.PatchText("xone\ntwo\n", []*patching.Patch{patch})
+	require.NoError(t, err)
+	assert.Equal(t, "yxone\nthree\n", text)
+
+	// Sending the hint clears the count, and changes against versions without patches are told to pull
+	for i := 0; i < resyncHintConflicts; i++ {
+		change("v99:\n0:+1:y:\n3")
+	}
+	hints = resyncHints(t, messageChan)
+	require.Len(t, hints, 1)
+	assert.Equal(t, resyncRequired{FileVersion: 7}, hints[0])
+
+	// Connections without a session aren't sent hints
+	dh.SessionID = ""
+	for i := 0; i < resyncHintConflicts; i++ {
+		change("v99:\n0:+1:y:\n3")
+	}
+	assert.Empty(t, resyncHints(t, messageChan))
+}
+
+func TestStaleChangeTracker_Expiry(t *testing.T) {
+	tracker := &staleChangeTracker{counts: make(map[staleChangeKey]staleChangeCount)}
+	start := time.Now()
+	for i := 0; i < resyncHintConflicts-1; i++ {
+		assert.False(t, tracker.record("session", 1, true, start))
+	}
+	assert.False(t, tracker.record("session", 2, true, start.Add(resyncHintWindow+time.Second)))
+	assert.Len(t, tracker.counts, 1, "counts older than the window should be forgotten")
+	assert.False(t, tracker.record("session", 1, true, start.Add(resyncHintWindow+time.Second)))
+}
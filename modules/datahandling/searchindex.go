@@ -0,0 +1,107 @@
+package datahandling
+
+import (
+	"context"
+	"path"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/modules/search"
+)
+
+/**
+ * Keeps the search index in sync with project files.
+ */
+
+// fileDocumentLoader loads the file's current metadata and fully patched contents for indexing. The metadata is looked
+// up when the loader runs, so renames and moves made in the meantime are picked up.
+func fileDocumentLoader(fileID int64, db dbfs.DBFS) search.Loader {
+	return func() (search.Document, bool, error) {
+		fileMeta, err := db.MySQLFileGetInfo(fileID)
+		if err != nil {
+			return search.Document{}, false, err
+		}
+		if fileMeta.Filename == "" {
+			// Deleted since it was scheduled; unknown files have empty metadata
+			return search.Document{}, false, nil
+		}
+
+		rawFile, changes, err := db.PullFile(fileMeta)
+		if err != nil {
+			return search.Document{}, false, err
+		}
+		doc := search.Document{
+			FileID:    fileMeta.FileID,
+			ProjectID: fileMeta.ProjectID,
+			Path:      path.Join(fileMeta.RelativePath, fileMeta.Filename),
+		}
+		// Binary files are indexed without contents, so that they aren't reported as missing
+		if search.Indexable(*rawFile) {
+			doc.Content, err = patching.PatchTextFromString(string(*rawFile), changes)
+			if err != nil {
+				return search.Document{}, false, err
+			}
+		}
+		return doc, true, nil
+	}
+}
+
+// scheduleFileIndex reindexes the file in the index of the server with the config once it stops changing.
+func scheduleFileIndex(cfg *config.Config, fileID int64, db dbfs.DBFS) {
+	// The file is loaded after the request has finished, so it must not be abandoned along with the request
+	search.ScheduleIndex(cfg, fileID, fileDocumentLoader(fileID, db.WithContext(context.Background())))
+}
+
+// ensureProjectIndexed indexes any of the project's files that are missing from the index of the server with the config,
+// such as after the embedded index was lost on restart.
+func ensureProjectIndexed(cfg *config.Config, projectID int64, db dbfs.DBFS) error {
+	files, err := db.MySQLProjectGetFiles(projectID)
+	if err != nil {
+		return err
+	}
+	fileIDs := make([]int64, len(files))
+	for i, file := range files {
+		fileIDs[i] = file.FileID
+	}
+
+	missing, err := search.IndexerFor(cfg).Missing(fileIDs)
+	if err != nil {
+		return err
+	}
+	for _, fileID := range missing {
+		if err := search.IndexNow(cfg, fileID, fileDocumentLoader(fileID, db)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchResponse runs the query against the project in the index of the server with the config, indexing any missing
+// files first, and builds the response for File.Search and Project.Search.
+func searchResponse(query search.Query, cfg *config.Config, tag int64, db dbfs.DBFS) ([]dhClosure, error) {
+	if err := ensureProjectIndexed(cfg, query.ProjectID, db); err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, tag)}}, err
+	}
+
+	matches, err := search.IndexerFor(cfg).Search(query)
+	if err != nil {
+		if err == search.ErrEmptyQuery {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, tag)}}, err
+		}
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    tag,
+		Data: struct {
+			Matches []search.Match
+		}{
+			Matches: matches,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
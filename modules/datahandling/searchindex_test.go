@@ -0,0 +1,60 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchMatches(t *testing.T, closures []dhClosure) []search.Match {
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	if !assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status") {
+		t.FailNow()
+	}
+	return reflect.ValueOf(resp.Data).FieldByName("Matches").Interface().([]search.Match)
+}
+
+func TestSearchRequests_Process(t *testing.T) {
+	configSetup(t)
+	search.SetIndexer(search.NewMemoryIndexer())
+	defer search.SetIndexer(nil)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "searchable")
+	fileID, _ := db.MySQLFileCreate(geneMeta.Username, "main.go", "src", projectID)
+	db.FileWrite("src", "main.go", projectID, []byte("package main\n\nfunc main() {\n}\n"))
+
+	// The file was never indexed, so the search indexes it first
+	projectReq := projectSearchRequest{ProjectID: projectID, Query: "func main"}
+	setBaseFields(&projectReq)
+	closures, err := projectReq.process(db)
+	assert.NoError(t, err)
+	assert.Equal(t, []search.Match{
+		{FileID: fileID, Path: "src/main.go", Line: 3, Snippet: "func main() {"},
+	}, searchMatches(t, closures))
+
+	fileReq := fileSearchRequest{FileID: fileID, Query: "PACKAGE"}
+	setBaseFields(&fileReq)
+	closures, err = fileReq.process(db)
+	assert.NoError(t, err)
+	matches := searchMatches(t, closures)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, 1, matches[0].Line)
+
+	projectReq.Query = ""
+	closures, err = projectReq.process(db)
+	assert.Equal(t, search.ErrEmptyQuery, err)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	projectReq.Query = "main"
+	projectReq.SenderID = notGeneMeta.Username
+	closures, err = projectReq.process(db)
+	assert.NoError(t, err)
+	assert.Equal(t, messages.StatusUnauthorized, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
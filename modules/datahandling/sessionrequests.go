@@ -0,0 +1,137 @@
+package datahandling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Each websocket connection has a session, which records its subscriptions in MySQL. A client that reconnects, to
+ * any server instance, can resume the subscriptions of its previous session instead of subscribing again.
+ */
+
+// SessionResumeWindow is how long a session's subscriptions are kept after its connection closes. Sessions with an
+// open connection must be touched more often than this.
+var SessionResumeWindow = time.Hour
+
+var errSessionNotOwned = errors.New("The session belongs to another user")
+
+var sessionRequestsSetup = false
+
+// initSessionRequests populates the requestMap from requestmap.go with the appropriate constructors for the session methods
+func initSessionRequests() {
+	if sessionRequestsSetup {
+		return
+	}
+
+	authenticatedRequestMap["Session.Resume"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(sessionResumeRequest), req)
+	}
+
+	sessionRequestsSetup = true
+}
+
+// NewSessionID returns a random session ID
+func NewSessionID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Session.Resume
+type sessionResumeRequest struct {
+	SessionID string // The previous connection's session; if empty, only the current session's ID is returned
+	abstractRequest
+}
+
+func (s *sessionResumeRequest) setAbstractRequest(req *abstractRequest) {
+	s.abstractRequest = *req
+}
+
+func (s sessionResumeRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if s.SessionID == "" {
+		return []dhClosure{sessionClosure{tag: s.Tag, resumed: []string{}}}, nil
+	}
+
+	subs, err := db.MySQLSessionGetSubscriptions(s.SessionID, SessionResumeWindow)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, s.Tag)}}, err
+	}
+	if len(subs) == 0 {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, s.Tag)}}, nil
+	}
+	for _, sub := range subs {
+		if !strings.EqualFold(sub.Username, s.SenderID) {
+			utils.LogError("API permission error", errSessionNotOwned, utils.LogFields{
+				"Resource":  s.Resource,
+				"Method":    s.Method,
+				"SenderID":  s.SenderID,
+				"SessionID": s.SessionID,
+			})
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, s.Tag)}}, nil
+		}
+	}
+
+	closures := []dhClosure{}
+	resumed := []string{}
+	for _, sub := range subs {
+		if !s.mayResume(sub, db) {
+			continue
+		}
+		// Resumed subscriptions are recorded under the new session
+		closures = append(closures, rabbitCommandClosure{
+			Command: "Subscribe",
+			Tag:     -1,
+			Data: rabbitmq.RabbitQueueData{
+				Key:      sub.Key,
+				Bindings: sub.Bindings,
+			},
+			username: s.SenderID,
+		})
+		resumed = append(resumed, sub.Key)
+	}
+
+	if len(resumed) > 0 {
+		prefs, err := db.MySQLUserGetNotificationPrefs(s.SenderID)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, s.Tag)}}, err
+		}
+		closures = append([]dhClosure{muteClosure(prefs, "")}, closures...)
+	}
+
+	err = db.MySQLSessionDelete(s.SessionID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, s.Tag)}}, err
+	}
+
+	return append(closures, sessionClosure{tag: s.Tag, resumed: resumed}), nil
+}
+
+// mayResume checks that the sender may still make the subscription; access to a project may have been revoked since
+// it was recorded.
+func (s sessionResumeRequest) mayResume(sub dbfs.SessionSubscriptionMeta, db dbfs.DBFS) bool {
+	if sub.Key == rabbitmq.RabbitUserQueueName(s.SenderID) {
+		return len(sub.Bindings) == 0
+	}
+
+	projectID, ok := rabbitmq.ParseRabbitProjectQueueName(sub.Key)
+	if !ok {
+		return false
+	}
+	for _, binding := range sub.Bindings {
+		if !strings.HasPrefix(binding, sub.Key+".") {
+			return false
+		}
+	}
+	hasPermission, err := authorizeProject(s.abstractRequest, projectID, config.CapabilityViewProject, db)
+	return err == nil && hasPermission
+}
@@ -0,0 +1,135 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oldSessionID = "0123456789abcdef0123456789abcdef"
+
+func TestSessionResumeRequest_Process(t *testing.T) {
+	configSetup(t)
+	req := *new(sessionResumeRequest)
+	setBaseFields(&req)
+	req.Resource = "Session"
+	req.Method = "Resume"
+	req.SessionID = oldSessionID
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "resumed")
+	otherProjectID, _ := db.MySQLProjectCreate(notGeneMeta.Username, "revoked")
+
+	for _, sub := range []dbfs.SessionSubscriptionMeta{
+		{Key: rabbitmq.RabbitUserQueueName(geneMeta.Username)},
+		{Key: rabbitmq.RabbitProjectQueueName(projectID), Bindings: []string{rabbitmq.RabbitProjectQueueName(projectID) + ".#"}},
+		{Key: rabbitmq.RabbitProjectQueueName(otherProjectID), Bindings: []string{rabbitmq.RabbitProjectQueueName(otherProjectID) + ".#"}},
+	} {
+		sub.SessionID = oldSessionID
+		sub.Username = geneMeta.Username
+		require.NoError(t, db.MySQLSessionSubscriptionSet(sub, SessionResumeWindow))
+	}
+
+	closures, err := req.process(db)
+	assert.NoError(t, err)
+	// The subscription to the project the user can no longer view is not resumed, and the user's mutes are applied first
+	require.Len(t, closures, 4)
+	assert.Equal(t, "Mute", closures[0].(rabbitCommandClosure).Command)
+	resumedKeys := map[string]bool{}
+	for _, closure := range closures[1:3] {
+		cmd := closure.(rabbitCommandClosure)
+		assert.Equal(t, "Subscribe", cmd.Command)
+		assert.Equal(t, geneMeta.Username, cmd.username)
+		resumedKeys[cmd.Data.(rabbitmq.RabbitQueueData).Key] = true
+	}
+	assert.Equal(t, map[string]bool{
+		rabbitmq.RabbitUserQueueName(geneMeta.Username): true,
+		rabbitmq.RabbitProjectQueueName(projectID):      true,
+	}, resumedKeys)
+	assert.Len(t, closures[3].(sessionClosure).resumed, 2)
+	assert.Empty(t, db.Sessions[oldSessionID], "the old session should be deleted")
+
+	// Sessions can only be resumed once
+	closures, err = req.process(db)
+	assert.NoError(t, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status)
+
+	// Other users' sessions cannot be resumed
+	db.MySQLSessionSubscriptionSet(dbfs.SessionSubscriptionMeta{
+		SessionID: oldSessionID,
+		Key:       rabbitmq.RabbitUserQueueName(notGeneMeta.Username),
+		Username:  notGeneMeta.Username,
+	}, SessionResumeWindow)
+	closures, err = req.process(db)
+	assert.NoError(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status)
+	assert.NotEmpty(t, db.Sessions[oldSessionID], "the other user's session should be kept")
+
+	// Without a SessionID, only the current session is returned
+	req.SessionID = ""
+	closures, err = req.process(db)
+	assert.NoError(t, err)
+	require.Len(t, closures, 1)
+	assert.IsType(t, sessionClosure{}, closures[0])
+}
+
+func TestSessionRecordsSubscriptions(t *testing.T) {
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	messageChan := make(chan rabbitmq.AMQPMessage, 3)
+	dh := DataHandler{
+		MessageChan: messageChan,
+		WebsocketID: 1,
+		SessionID:   NewSessionID(),
+		Db:          db,
+	}
+	key := rabbitmq.RabbitProjectQueueName(1)
+
+	err := rabbitCommandClosure{
+		Command:  "Subscribe",
+		Tag:      -1,
+		Data:     rabbitmq.RabbitQueueData{Key: key, Bindings: []string{key + ".#"}},
+		username: geneMeta.Username,
+	}.call(dh)
+	assert.NoError(t, err)
+	subs, _ := db.MySQLSessionGetSubscriptions(dh.SessionID, time.Minute)
+	require.Len(t, subs, 1)
+	assert.Equal(t, []string{key + ".#"}, subs[0].Bindings)
+
+	err = rabbitCommandClosure{
+		Command: "Unsubscribe",
+		Tag:     -1,
+		Data:    rabbitmq.RabbitQueueData{Key: key},
+	}.call(dh)
+	assert.NoError(t, err)
+	subs, _ = db.MySQLSessionGetSubscriptions(dh.SessionID, time.Minute)
+	assert.Empty(t, subs)
+
+	err = sessionClosure{tag: 5, resumed: []string{key}}.call(dh)
+	assert.NoError(t, err)
+	<-messageChan
+	<-messageChan
+	var resp struct {
+		ServerMessage struct {
+			Tag  int64
+			Data struct {
+				SessionID string
+				Resumed   []string
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal((<-messageChan).Message, &resp))
+	assert.Equal(t, int64(5), resp.ServerMessage.Tag)
+	assert.Equal(t, dh.SessionID, resp.ServerMessage.Data.SessionID)
+	assert.Equal(t, []string{key}, resp.ServerMessage.Data.Resumed)
+}
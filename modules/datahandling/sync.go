@@ -0,0 +1,298 @@
+package datahandling
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Project.Sync reconciles a client's copy of a project with the server's, so that editors starting up don't have to
+ * pull every file. The client sends a manifest of the files it has, each with its path, the version it is at, and,
+ * optionally, the SHA-256 of its contents. Once the request has been answered, the changes needed to bring the
+ * client's copy up to date are sent to it as Project.Sync notifications, in chunks, the last of which is marked Done:
+ *
+ *	Create	the file's current contents, for files the client doesn't have, and files it has that can't be patched
+ *	Patch	the patch from the client's version to the current version, as File.Diff returns
+ *	Delete	files the client has that are no longer in the project
+ *
+ * Files the client has at their current version are left out. Hashes are checked against the file's contents at the
+ * client's version, so that copies changed without being synced are replaced; a client that doesn't know the version
+ * of its copy sends a Version of 0 and its hash, and is sent an empty patch to the current version if it matches.
+ * Contents, hashes and patches are of the files as stored, without converting line endings.
+ */
+
+// maxSyncManifest is the most files a manifest may list
+const maxSyncManifest = 10000
+
+// A chunk is sent once it has syncChunkEntries entries, or its contents and patches are at least syncChunkBytes
+const (
+	syncChunkEntries = 50
+	syncChunkBytes   = 1 << 20
+)
+
+// syncSendTimeout is how long a chunk waits for space in the connection's outbound queue before the sync is abandoned
+const syncSendTimeout = 30 * time.Second
+
+// Actions of sync entries
+const (
+	syncCreate = "Create"
+	syncPatch  = "Patch"
+	syncDelete = "Delete"
+)
+
+var (
+	errInvalidSyncHash = errors.New("Hashes must be the hex-encoded SHA-256 of the file's contents")
+	errSyncStalled     = errors.New("The client did not keep up with the sync")
+)
+
+// syncPath returns the path of the file within the project, as clients list it in sync manifests
+func syncPath(relativePath string, filename string) string {
+	return strings.TrimPrefix(path.Join(relativePath, filename), "/")
+}
+
+type syncManifestEntry struct {
+	Path    string
+	Version int64  // The version the client's copy is at; 0 if unknown
+	Hash    string // Optional; the hex-encoded SHA-256 of the client's copy
+}
+
+// syncEntry is a change to the client's copy of a file
+type syncEntry struct {
+	Action    string
+	Path      string
+	FileID    int64  `json:",omitempty"`
+	Version   int64  `json:",omitempty"` // The version the file is at once the entry is applied
+	FileBytes []byte `json:",omitempty"` // Creates: the file's contents
+	Patch     string `json:",omitempty"` // Patches: the patch to apply to the client's copy
+}
+
+// syncChunk is the Data of Project.Sync notifications
+type syncChunk struct {
+	Tag     int64 // The tag of the Project.Sync request
+	Entries []syncEntry
+	Done    bool     // Set on the last chunk
+	Failed  []string `json:",omitempty"` // On the last chunk, the paths of files that couldn't be read, which must be pulled
+}
+
+// Project.Sync
+type projectSyncRequest struct {
+	ProjectID int64 `validate:"required"`
+	Files     []syncManifestEntry
+	abstractRequest
+}
+
+func (p *projectSyncRequest) setAbstractRequest(req *abstractRequest) {
+	p.abstractRequest = *req
+}
+
+func (p projectSyncRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(p.abstractRequest, p.ProjectID, config.CapabilityViewProject, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  p.Resource,
+			"Method":    p.Method,
+			"SenderID":  p.SenderID,
+			"ProjectID": p.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, p.Tag)}}, nil
+	}
+
+	if res, err := archivedResponse(p.ProjectID, p.Tag, db); res != nil {
+		return []dhClosure{toSenderClosure{msg: res}}, err
+	}
+
+	if len(p.Files) > maxSyncManifest {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, nil
+	}
+	manifest := make(map[string]syncManifestEntry, len(p.Files))
+	for _, file := range p.Files {
+		if file.Hash != "" {
+			if _, err := hex.DecodeString(file.Hash); err != nil || len(file.Hash) != sha256.Size*2 {
+				return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, p.Tag)}}, errInvalidSyncHash
+			}
+		}
+		manifest[strings.TrimPrefix(path.Clean("/"+file.Path), "/")] = file
+	}
+
+	files, err := db.MySQLProjectGetFiles(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+	hashes, err := db.MySQLProjectGetContentHashes(p.ProjectID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, p.Tag)}}, err
+	}
+
+	return []dhClosure{
+		toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, p.Tag)},
+		syncClosure{projectID: p.ProjectID, tag: p.Tag, files: files, hashes: hashes, manifest: manifest},
+	}, nil
+}
+
+type syncClosure struct {
+	projectID int64
+	tag       int64
+	files     []dbfs.FileMeta
+	hashes    map[int64]dbfs.ContentHashMeta // The recorded content hashes, by FileID
+	manifest  map[string]syncManifestEntry   // By path
+}
+
+// syncClosure.call works out the changes to the client's copy, and streams them to the client. Like
+// Project.ImportFromGit, it runs in the request's handler, so that the chunks are sent as fast as the client takes them.
+func (cont syncClosure) call(dh DataHandler) error {
+	stream := syncStream{dh: dh, projectID: cont.projectID, chunk: syncChunk{Tag: cont.tag, Entries: []syncEntry{}}}
+	var failed []string
+
+	remaining := make(map[string]bool, len(cont.manifest))
+	for filePath := range cont.manifest {
+		remaining[filePath] = true
+	}
+	for _, file := range cont.files {
+		filePath := syncPath(file.RelativePath, file.Filename)
+		clientFile, hasCopy := cont.manifest[filePath]
+		delete(remaining, filePath)
+
+		entry, changed, err := syncFile(file, filePath, clientFile, hasCopy, cont.hashes[file.FileID], dh.Db)
+		if err != nil {
+			utils.LogError("Failed to sync file", err, utils.LogFields{
+				"ProjectID": cont.projectID,
+				"FileID":    file.FileID,
+			})
+			failed = append(failed, filePath)
+			continue
+		}
+		if changed {
+			if err := stream.add(entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	deleted := make([]string, 0, len(remaining))
+	for filePath := range remaining {
+		deleted = append(deleted, filePath)
+	}
+	sort.Strings(deleted)
+	for _, filePath := range deleted {
+		if err := stream.add(syncEntry{Action: syncDelete, Path: filePath}); err != nil {
+			return err
+		}
+	}
+
+	stream.chunk.Done = true
+	stream.chunk.Failed = failed
+	return stream.send()
+}
+
+// syncFile returns the change to the client's copy of the file, and false if it is already up to date
+func syncFile(file dbfs.FileMeta, filePath string, clientFile syncManifestEntry, hasCopy bool,
+	recorded dbfs.ContentHashMeta, db dbfs.DBFS) (syncEntry, bool, error) {
+	version, err := db.CBGetFileVersion(file.FileID)
+	if err != nil {
+		return syncEntry{}, false, err
+	}
+	// Without a hash, the client's version is trusted; with one, the file needn't be read if its hash is recorded
+	if hasCopy && clientFile.Version == version &&
+		(clientFile.Hash == "" || recorded.Version == version && recorded.Hash == clientFile.Hash) {
+		return syncEntry{}, false, nil
+	}
+
+	rawFile, changes, err := db.PullFile(file)
+	if err != nil {
+		return syncEntry{}, false, err
+	}
+	patches, err := patching.GetPatches(changes)
+	if err != nil {
+		return syncEntry{}, false, err
+	}
+	current, err := textAtVersion(*rawFile, patches, version, version)
+	if err != nil {
+		return syncEntry{}, false, err
+	}
+	if recorded.Version < version {
+		recordContentHash(file.FileID, dbfs.ContentHashMeta{Version: version, Hash: contentHash(current)}, db)
+	}
+
+	entry := syncEntry{Path: filePath, FileID: file.FileID, Version: version}
+	switch {
+	case hasCopy && clientFile.Version > 0 && clientFile.Version <= version:
+		if clientFile.Hash != "" {
+			text, err := textAtVersion(*rawFile, patches, version, clientFile.Version)
+			if err != nil || contentHash(text) != clientFile.Hash {
+				break
+			}
+		}
+		if clientFile.Version == version {
+			return syncEntry{}, false, nil
+		}
+		patch, err := diffVersions(*rawFile, changes, version, clientFile.Version, version)
+		if err == errBaseVersionUnavailable {
+			break
+		} else if err != nil {
+			return syncEntry{}, false, err
+		}
+		entry.Action, entry.Patch = syncPatch, patch.String()
+		return entry, true, nil
+	case hasCopy && clientFile.Version == 0 && clientFile.Hash == contentHash(current):
+		// The client has the current contents, but not their version
+		patch := patching.NewPatch(version, patching.Diffs{}, utf8.RuneCountInString(current))
+		entry.Action, entry.Patch = syncPatch, patch.String()
+		return entry, true, nil
+	}
+
+	entry.Action, entry.FileBytes = syncCreate, []byte(current)
+	return entry, true, nil
+}
+
+// syncStream sends sync entries to the client in chunks
+type syncStream struct {
+	dh        DataHandler
+	projectID int64
+	chunk     syncChunk
+	bytes     int
+}
+
+func (stream *syncStream) add(entry syncEntry) error {
+	stream.chunk.Entries = append(stream.chunk.Entries, entry)
+	stream.bytes += len(entry.FileBytes) + len(entry.Patch)
+	if len(stream.chunk.Entries) >= syncChunkEntries || stream.bytes >= syncChunkBytes {
+		return stream.send()
+	}
+	return nil
+}
+
+// send sends the chunk, waiting for space in the outbound queue rather than dropping it, since a client missing part
+// of a sync would have to start over
+func (stream *syncStream) send() error {
+	not := messages.Notification{
+		Resource:   "Project",
+		Method:     "Sync",
+		ResourceID: stream.projectID,
+		Data:       stream.chunk,
+	}.Wrap()
+	msg, err := senderMessage(stream.dh, not)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case stream.dh.MessageChan <- msg:
+	case <-time.After(syncSendTimeout):
+		return errSyncStalled
+	}
+	stream.chunk = syncChunk{Tag: stream.chunk.Tag, Entries: []syncEntry{}}
+	stream.bytes = 0
+	return nil
+}
@@ -0,0 +1,169 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncChunks returns the Project.Sync chunks sent to the client
+func syncChunks(t *testing.T, messageChan chan rabbitmq.AMQPMessage) []syncChunk {
+	var chunks []syncChunk
+	for len(messageChan) > 0 {
+		msg := <-messageChan
+		var not struct {
+			ServerMessage struct {
+				Method string
+				Data   syncChunk
+			}
+		}
+		require.NoError(t, json.Unmarshal(msg.Message, &not))
+		if not.ServerMessage.Method == "Sync" {
+			chunks = append(chunks, not.ServerMessage.Data)
+		}
+	}
+	return chunks
+}
+
+func runSync(t *testing.T, db *dbfs.DatabaseMock, projectID int64, manifest []syncManifestEntry) []syncChunk {
+	req := projectSyncRequest{ProjectID: projectID, Files: manifest}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "Sync"
+
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+
+	messageChan := make(chan rabbitmq.AMQPMessage, 64)
+	require.NoError(t, closures[1].call(DataHandler{MessageChan: messageChan, Db: db}))
+	chunks := syncChunks(t, messageChan)
+	require.NotEmpty(t, chunks)
+	for _, chunk := range chunks {
+		assert.Equal(t, req.Tag, chunk.Tag)
+	}
+	assert.True(t, chunks[len(chunks)-1].Done)
+	return chunks
+}
+
+func TestProjectSync(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "synced")
+
+	raw := []byte("one\ntwo\n")
+	db.File = &raw
+	changes := []string{
+		"v3:\n0:+1:x:\n8",
+		"v4:\n5:-3:two:\n9",
+		"v5:\n5:+5:three:\n6",
+	}
+	texts := map[int64]string{3: "one\ntwo\n", 4: "xone\ntwo\n", 5: "xone\n\n", 6: "xone\nthree\n"}
+	create := func(relativePath string, filename string, version int64, changes []string) int64 {
+		fileID, _ := db.MySQLFileCreate("loganga", filename, relativePath, projectID)
+		db.FileVersion[fileID] = version
+		db.FileChanges[fileID] = changes
+		return fileID
+	}
+	create(".", "behind.txt", 6, changes)
+	create("src", "current.txt", 3, nil)
+	create("src", "unknown.txt", 6, changes)
+	missingID := create("", "missing.txt", 6, changes)
+	create(".", "edited.txt", 6, changes)
+	create(".", "scrunched.txt", 6, changes)
+
+	chunks := runSync(t, db, projectID, []syncManifestEntry{
+		{Path: "behind.txt", Version: 4},
+		{Path: "src/current.txt", Version: 3},
+		{Path: "/src/unknown.txt", Hash: contentHash(texts[6])},
+		{Path: "edited.txt", Version: 5, Hash: contentHash("changed offline")},
+		{Path: "scrunched.txt", Version: 2},
+		{Path: "deleted.txt", Version: 1},
+	})
+	require.Len(t, chunks, 1)
+	assert.Empty(t, chunks[0].Failed)
+
+	entries := map[string]syncEntry{}
+	for _, entry := range chunks[0].Entries {
+		entries[entry.Path] = entry
+	}
+	assert.Len(t, entries, 6)
+	assert.NotContains(t, entries, "src/current.txt", "files at their current version should be left out")
+
+	// Patches take the client's copy to the current version
+	behind := entries["behind.txt"]
+	assert.Equal(t, syncPatch, behind.Action)
+	assert.EqualValues(t, 6, behind.Version)
+	patch, err := patching.NewPatchFromString(behind.Patch)
+	require.NoError(t, err)
+	text, err := patching.PatchText(texts[4], []*patching.Patch{patch})
+	require.NoError(t, err)
+	assert.Equal(t, texts[6], text)
+
+	// A copy with the current contents is only told its version
+	unknown := entries["src/unknown.txt"]
+	assert.Equal(t, syncPatch, unknown.Action)
+	assert.EqualValues(t, 6, unknown.Version)
+	patch, err = patching.NewPatchFromString(unknown.Patch)
+	require.NoError(t, err)
+	assert.Empty(t, patch.Changes)
+
+	// Files the client lacks, or whose copies can't be patched, are sent in full
+	for _, path := range []string{"missing.txt", "edited.txt", "scrunched.txt"} {
+		assert.Equal(t, syncCreate, entries[path].Action, path)
+		assert.Equal(t, texts[6], string(entries[path].FileBytes), path)
+	}
+	assert.Equal(t, missingID, entries["missing.txt"].FileID)
+
+	assert.Equal(t, syncEntry{Action: syncDelete, Path: "deleted.txt"}, entries["deleted.txt"])
+
+	// Files that can't be read are reported, rather than failing the sync
+	db.FailCall("PullFile", 1, dbfs.ErrCouchbaseUnavailable)
+	chunks = runSync(t, db, projectID, nil)
+	assert.Len(t, chunks[len(chunks)-1].Failed, 1)
+}
+
+func TestProjectSync_Chunks(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "synced")
+
+	raw := []byte("contents")
+	db.File = &raw
+	for i := 0; i < syncChunkEntries+1; i++ {
+		fileID, _ := db.MySQLFileCreate("loganga", fmt.Sprintf("file-%d", i), ".", projectID)
+		db.CBInsertNewFile(fileID, 1, []string{})
+	}
+
+	chunks := runSync(t, db, projectID, nil)
+	require.Len(t, chunks, 2)
+	assert.Len(t, chunks[0].Entries, syncChunkEntries)
+	assert.False(t, chunks[0].Done)
+	assert.Len(t, chunks[1].Entries, 1)
+}
+
+func TestProjectSync_InvalidHash(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "synced")
+
+	req := projectSyncRequest{ProjectID: projectID, Files: []syncManifestEntry{{Path: "a.txt", Hash: "abc"}}}
+	setBaseFields(&req)
+	req.Resource = "Project"
+	req.Method = "Sync"
+	closures, err := req.process(db)
+	assert.Equal(t, errInvalidSyncHash, err)
+	require.Len(t, closures, 1)
+	assert.Equal(t, messages.StatusFail, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+}
@@ -0,0 +1,211 @@
+package datahandling
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+var teamRequestsSetup = false
+
+// initTeamRequests populates the requestMap from requestmap.go with the appropriate constructors for the team methods
+func initTeamRequests() {
+	if teamRequestsSetup {
+		return
+	}
+
+	authenticatedRequestMap["Team.Create"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(teamCreateRequest), req)
+	}
+
+	authenticatedRequestMap["Team.AddMember"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(teamAddMemberRequest), req)
+	}
+
+	authenticatedRequestMap["Team.GrantProjectAccess"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(teamGrantProjectAccessRequest), req)
+	}
+
+	teamRequestsSetup = true
+}
+
+var errInvalidTeamName = errors.New("Team names must be between 1 and 50 characters")
+
+// teamMember returns the sender's membership of the team, or nil if they are not a member.
+func teamMember(teamID int64, username string, db dbfs.DBFS) (*dbfs.TeamMemberMeta, []dbfs.TeamMemberMeta, error) {
+	members, err := db.MySQLTeamGetMembers(teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, member := range members {
+		if member.Username == username {
+			return &members[i], members, nil
+		}
+	}
+	return nil, members, nil
+}
+
+// Team.Create
+type teamCreateRequest struct {
+	Name string `validate:"required"`
+	abstractRequest
+}
+
+func (t *teamCreateRequest) setAbstractRequest(req *abstractRequest) {
+	t.abstractRequest = *req
+}
+
+func (t teamCreateRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if t.Name == "" || len(t.Name) > 50 {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, t.Tag)}}, errInvalidTeamName
+	}
+
+	teamID, err := db.MySQLTeamCreate(t.SenderID, t.Name)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, t.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    t.Tag,
+		Data: struct {
+			TeamID int64
+		}{
+			TeamID: teamID,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// Team.AddMember
+type teamAddMemberRequest struct {
+	TeamID   int64  `validate:"required"`
+	Username string `validate:"required"`
+	IsAdmin  bool
+	abstractRequest
+}
+
+func (t *teamAddMemberRequest) setAbstractRequest(req *abstractRequest) {
+	t.abstractRequest = *req
+}
+
+func (t teamAddMemberRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	sender, _, err := teamMember(t.TeamID, t.SenderID, db)
+	if err != nil || sender == nil || !sender.IsAdmin {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource": t.Resource,
+			"Method":   t.Method,
+			"SenderID": t.SenderID,
+			"TeamID":   t.TeamID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, t.Tag)}}, nil
+	}
+
+	t.Username = strings.ToLower(t.Username)
+
+	err = db.MySQLTeamAddMember(t.TeamID, t.Username, t.IsAdmin, t.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, t.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, t.Tag)
+	not := messages.Notification{
+		Resource:   t.Resource,
+		Method:     t.Method,
+		ResourceID: t.TeamID,
+		Data: struct {
+			Username string
+			IsAdmin  bool
+		}{
+			Username: t.Username,
+			IsAdmin:  t.IsAdmin,
+		},
+	}.Wrap()
+
+	return []dhClosure{
+		toSenderClosure{msg: res},
+		toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitUserQueueName(t.Username)}}, nil
+}
+
+// Team.GrantProjectAccess
+type teamGrantProjectAccessRequest struct {
+	TeamID          int64 `validate:"required"`
+	ProjectID       int64 `validate:"required"`
+	Role            string
+	PermissionLevel int8 // Deprecated: use Role
+	abstractRequest
+}
+
+func (t *teamGrantProjectAccessRequest) setAbstractRequest(req *abstractRequest) {
+	t.abstractRequest = *req
+}
+
+func (t teamGrantProjectAccessRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	hasPermission, err := authorizeProject(t.abstractRequest, t.ProjectID, config.CapabilityManageAccess, db)
+	if err != nil || !hasPermission {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource":  t.Resource,
+			"Method":    t.Method,
+			"SenderID":  t.SenderID,
+			"ProjectID": t.ProjectID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, t.Tag)}}, nil
+	}
+
+	// Only members can grant their team access, so that team IDs can't be guessed to share projects with strangers
+	sender, members, err := teamMember(t.TeamID, t.SenderID, db)
+	if err != nil || sender == nil {
+		utils.LogError("API permission error", err, utils.LogFields{
+			"Resource": t.Resource,
+			"Method":   t.Method,
+			"SenderID": t.SenderID,
+			"TeamID":   t.TeamID,
+		})
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, t.Tag)}}, nil
+	}
+
+	role, err := requestedRole(t.Role, t.PermissionLevel)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, t.Tag)}}, nil
+	}
+
+	// Projects have a single owner, who must be a user
+	if role.Name == config.OwnerRole.Name {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, t.Tag)}}, nil
+	}
+
+	err = db.MySQLTeamGrantProjectAccess(t.TeamID, t.ProjectID, role.Level, t.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, t.Tag)}}, err
+	}
+
+	res := messages.NewEmptyResponse(messages.StatusSuccess, t.Tag)
+	not := messages.Notification{
+		Resource:   t.Resource,
+		Method:     t.Method,
+		ResourceID: t.ProjectID,
+		Data: struct {
+			TeamID          int64
+			Role            string
+			PermissionLevel int8
+		}{
+			TeamID:          t.TeamID,
+			Role:            role.Name,
+			PermissionLevel: role.Level,
+		},
+	}.Wrap()
+
+	closures := []dhClosure{
+		toSenderClosure{msg: res},
+		projectNotificationClosure(t.ProjectID, 0, not)}
+	for _, member := range members {
+		closures = append(closures, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitUserQueueName(member.Username)})
+	}
+	return closures, nil
+}
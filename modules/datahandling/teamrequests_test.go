@@ -0,0 +1,146 @@
+package datahandling
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+)
+
+var notGeneMeta = dbfs.UserMeta{
+	FirstName: "Notgene",
+	LastName:  "NotLogan",
+	Email:     "notloganga@codecollaborate.com",
+	Username:  "notloganga",
+}
+
+func TestTeamCreateRequest_Process(t *testing.T) {
+	configSetup(t)
+	req := *new(teamCreateRequest)
+	setBaseFields(&req)
+
+	req.Resource = "Team"
+	req.Method = "Create"
+	req.Name = "CodeCollaborate"
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.FunctionCallCount = 0
+
+	closures, err := req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, db.FunctionCallCount, "unexpected db calls for team create")
+
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+	teamID := reflect.ValueOf(resp.Data).FieldByName("TeamID").Int()
+	assert.Equal(t, []dbfs.TeamMemberMeta{{Username: geneMeta.Username, IsAdmin: true}}, db.TeamMembers[teamID],
+		"creator should be the team's admin")
+
+	req.Name = ""
+	closures, err = req.process(db)
+	assert.Equal(t, errInvalidTeamName, err)
+}
+
+func TestTeamAddMemberRequest_Process(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	teamID, _ := db.MySQLTeamCreate(geneMeta.Username, "CodeCollaborate")
+
+	req := *new(teamAddMemberRequest)
+	req.setAbstractRequest(&abstractRequest{SenderID: notGeneMeta.Username})
+	req.Resource = "Team"
+	req.Method = "AddMember"
+	req.TeamID = teamID
+	req.Username = notGeneMeta.Username
+
+	closures, err := req.process(db)
+	assert.Nil(t, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "non-members should not be able to add members")
+
+	setBaseFields(&req)
+	req.Username = "NotLoganGA"
+	db.FunctionCallCount = 0
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.FunctionCallCount, "unexpected db calls for team add member")
+	assert.Equal(t, 2, len(closures), "unexpected number of returned closures")
+
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+	assert.Equal(t, rabbitmq.RabbitUserQueueName(notGeneMeta.Username), closures[1].(toRabbitChannelClosure).key,
+		"new member should be notified")
+	assert.Contains(t, db.TeamMembers[teamID], dbfs.TeamMemberMeta{Username: notGeneMeta.Username})
+
+	// Members who aren't admins can't add others
+	req.setAbstractRequest(&abstractRequest{SenderID: notGeneMeta.Username})
+	req.Username = "someoneelse"
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+}
+
+func TestTeamGrantProjectAccessRequest_Process(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	teamID, _ := db.MySQLTeamCreate(geneMeta.Username, "CodeCollaborate")
+	db.MySQLTeamAddMember(teamID, notGeneMeta.Username, false, geneMeta.Username)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "new stuff")
+
+	writePerm, _ := config.PermissionByLabel("write")
+
+	req := *new(teamGrantProjectAccessRequest)
+	setBaseFields(&req)
+	req.Resource = "Team"
+	req.Method = "GrantProjectAccess"
+	req.TeamID = teamID
+	req.ProjectID = projectID
+	req.PermissionLevel = writePerm.Level
+
+	_, err := db.MySQLUserProjectPermissionLookup(projectID, notGeneMeta.Username)
+	assert.Equal(t, dbfs.ErrNoData, err, "member should not have access before the grant")
+
+	db.FunctionCallCount = 0
+	closures, err := req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, db.FunctionCallCount, "unexpected db calls for team grant project access")
+
+	// Sender, project channel, and each member
+	assert.Equal(t, 4, len(closures), "unexpected number of returned closures")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	level, err := db.MySQLUserProjectPermissionLookup(projectID, notGeneMeta.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, writePerm.Level, level, "team members should get the team's permission")
+
+	projects, _ := db.MySQLUserProjects(notGeneMeta.Username)
+	assert.Equal(t, []dbfs.ProjectMeta{{ProjectID: projectID, Name: "new stuff", PermissionLevel: writePerm.Level}}, projects)
+
+	ownerPerm, _ := config.PermissionByLabel("owner")
+	req.PermissionLevel = ownerPerm.Level
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status, "teams should not be able to own projects")
+
+	// Team members with write access can't grant access themselves
+	req.setAbstractRequest(&abstractRequest{SenderID: notGeneMeta.Username})
+	req.PermissionLevel = writePerm.Level
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+}
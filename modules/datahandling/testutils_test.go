@@ -7,7 +7,7 @@ import (
 	"github.com/CodeCollaborate/Server/modules/config"
 )
 
-func configSetup(t *testing.T) {
+func configSetup(t testing.TB) {
 	config.SetConfigDir("../../config")
 	err := config.LoadConfig()
 	if err != nil {
@@ -0,0 +1,340 @@
+package datahandling
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Users' personal data, for data protection requests. User.ExportData returns an archive of what the server keeps
+ * about the sender: their profile, the projects they are a member of, and the patches they authored. User.Delete
+ * removes their account, then erases their authorship from the patches they made in projects that outlive it, as
+ * the UserErasure setting says: "anonymize" replaces their username with a pseudonym, so that collaborators can still
+ * tell which changes were made together, and "scrub" removes the author, client and time altogether. What each
+ * erasure changed is recorded in the audit log as a "User.Erasure" entry, for admins to review with
+ * Admin.GetAuditLog; it doesn't name the pseudonym, so that it can't be traced back to the user.
+ *
+ * Only the patches since each file was last scrunched are stored with their metadata, so those are all there is to
+ * export or erase. The audit log is kept by design, with the usernames of its entries; notifications that were sent
+ * with the user's username expire with the project's other notifications, a day after they were sent.
+ */
+
+// Policies for what deleting a user does to the authorship of their patches
+const (
+	userErasureAnonymize = "anonymize"
+	userErasureScrub     = "scrub"
+)
+
+// userErasurePageSize is how many files are read from MySQL at a time while erasing a user's authorship
+const userErasurePageSize = 500
+
+// exportedChange is a patch the user authored, in changes.json of their exported data
+type exportedChange struct {
+	ProjectID    int64
+	FileID       int64
+	RelativePath string
+	Filename     string
+	FileVersion  int64 // The version of the file the patch made
+	ClientID     string
+	Timestamp    int64
+	Patch        string
+}
+
+// User.ExportData
+type userExportDataRequest struct {
+	abstractRequest
+}
+
+func (f *userExportDataRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userExportDataRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	user, err := db.MySQLUserLookup(f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	archive, err := exportUserData(user, db)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			Archive []byte // A zip archive of profile.json, projects.json, changes.json and the user's avatar, if any
+		}{
+			Archive: archive,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// exportUserData returns a zip archive of the user's profile, their projects, and the patches they authored in them
+// that are still stored. Files whose patches can't be read, such as those of archived projects, are skipped.
+func exportUserData(user dbfs.UserMeta, db dbfs.DBFS) ([]byte, error) {
+	aliases, err := db.MySQLUserAliases(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := db.MySQLUserGetNotificationPrefs(user.Username)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := db.MySQLUserProjects(user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	profile := struct {
+		dbfs.UserMeta
+		FormerUsernames   []string
+		NotificationPrefs dbfs.NotificationPrefsMeta
+	}{
+		UserMeta:          user,
+		FormerUsernames:   aliases,
+		NotificationPrefs: prefs,
+	}
+
+	authors := map[string]bool{user.Username: true}
+	for _, alias := range aliases {
+		authors[alias] = true
+	}
+	changes := []exportedChange{}
+	for _, project := range projects {
+		files, err := db.MySQLProjectGetFiles(project.ProjectID)
+		if err != nil {
+			utils.LogError("Failed to list files for data export", err, utils.LogFields{
+				"Username":  user.Username,
+				"ProjectID": project.ProjectID,
+			})
+			continue
+		}
+		for _, file := range files {
+			changes = append(changes, exportFileChanges(file, authors, db)...)
+		}
+	}
+
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	for name, value := range map[string]interface{}{
+		"profile.json":  profile,
+		"projects.json": projects,
+		"changes.json":  changes,
+	} {
+		if err := writeZipJSON(archive, name, value); err != nil {
+			return nil, err
+		}
+	}
+	if user.AvatarHash != "" {
+		raw, err := db.AvatarRead(user.Username)
+		if err != nil && err != dbfs.ErrNoData {
+			return nil, err
+		}
+		if err == nil {
+			if err := writeZipFile(archive, "avatar", raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// exportFileChanges returns the file's stored patches that any of the authors made
+func exportFileChanges(file dbfs.FileMeta, authors map[string]bool, db dbfs.DBFS) []exportedChange {
+	stored, _, _, _, err := db.PullChanges(file)
+	if err != nil {
+		utils.LogError("Failed to read changes for data export", err, utils.LogFields{
+			"FileID": file.FileID,
+		})
+		return nil
+	}
+
+	changes := []exportedChange{}
+	for _, change := range stored {
+		patch, err := patching.NewPatchFromString(change)
+		if err != nil || !authors[patch.Metadata.Author] {
+			continue
+		}
+		changes = append(changes, exportedChange{
+			ProjectID:    file.ProjectID,
+			FileID:       file.FileID,
+			RelativePath: file.RelativePath,
+			Filename:     file.Filename,
+			FileVersion:  patch.BaseVersion + 1,
+			ClientID:     patch.Metadata.ClientID,
+			Timestamp:    patch.Metadata.Timestamp,
+			Patch:        change,
+		})
+	}
+	return changes
+}
+
+func writeZipJSON(archive *zip.Writer, name string, value interface{}) error {
+	raw, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeZipFile(archive, name, raw)
+}
+
+func writeZipFile(archive *zip.Writer, name string, raw []byte) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// userErasure is what a deleted user's authorship is erased from, gathered before their account is deleted
+type userErasure struct {
+	username           string
+	aliases            []string
+	projectsDeleted    []int64 // Projects the user owned, which were deleted with them
+	membershipsRemoved []int64 // Projects of others the user was a member of
+	avatarDeleted      bool
+}
+
+// userErasureReport is the Details of the "User.Erasure" audit log entry
+type userErasureReport struct {
+	Policy             string
+	FormerUsernames    int
+	ProjectsDeleted    []int64
+	MembershipsRemoved []int64
+	AvatarDeleted      bool
+	FilesScanned       int
+	FilesChanged       int // Files that had patches the user authored
+	ChangesErased      int
+	FilesFailed        int // Files whose patches could not be rewritten, and still name the user
+	Started            time.Time
+	Finished           time.Time
+}
+
+// userErasurePolicy returns the config's policy for deleted users' authorship
+func userErasurePolicy(cfg *config.Config) string {
+	if cfg.ServerConfig.UserErasure == userErasureScrub {
+		return userErasureScrub
+	}
+	return userErasureAnonymize
+}
+
+// newErasurePseudonym returns a name for a deleted user's patches that doesn't reveal who they were
+func newErasurePseudonym() string {
+	id := make([]byte, 4)
+	rand.Read(id)
+	return "deleted-" + hex.EncodeToString(id)
+}
+
+// eraseAuthorship rewrites the metadata of every stored patch the user made under any of their usernames, as the
+// policy says, and returns what was changed
+func eraseAuthorship(erasure userErasure, policy string, db dbfs.DBFS) (userErasureReport, error) {
+	report := userErasureReport{
+		Policy:             policy,
+		FormerUsernames:    len(erasure.aliases),
+		ProjectsDeleted:    erasure.projectsDeleted,
+		MembershipsRemoved: erasure.membershipsRemoved,
+		AvatarDeleted:      erasure.avatarDeleted,
+		Started:            time.Now(),
+	}
+
+	authors := map[string]bool{erasure.username: true}
+	for _, alias := range erasure.aliases {
+		authors[alias] = true
+	}
+	pseudonym := newErasurePseudonym()
+	rewrite := func(change string) string {
+		patch, err := patching.NewPatchFromString(change)
+		if err != nil || !authors[patch.Metadata.Author] {
+			return change
+		}
+		if policy == userErasureScrub {
+			patch.Metadata = patching.Metadata{}
+		} else {
+			patch.Metadata.Author = pseudonym
+		}
+		return patch.String()
+	}
+
+	var afterFileID int64
+	for {
+		files, err := db.MySQLFileList(afterFileID, userErasurePageSize)
+		if err != nil {
+			return report, err
+		}
+		for _, file := range files {
+			report.FilesScanned++
+			erased, err := db.CBRewriteFileChanges(file.FileID, rewrite)
+			if err != nil {
+				report.FilesFailed++
+				utils.LogError("Failed to erase authorship", err, utils.LogFields{
+					"FileID": file.FileID,
+				})
+				continue
+			}
+			if erased > 0 {
+				report.FilesChanged++
+				report.ChangesErased += erased
+			}
+		}
+		if len(files) < userErasurePageSize {
+			break
+		}
+		afterFileID = files[len(files)-1].FileID
+	}
+	report.Finished = time.Now()
+	return report, nil
+}
+
+type userErasureClosure struct {
+	erasure userErasure
+}
+
+// userErasureClosure.call erases the deleted user's authorship in the background, since every file is scanned, then
+// records what was erased in the audit log
+func (cont userErasureClosure) call(dh DataHandler) error {
+	db := dh.Db.WithContext(context.Background())
+	go func() {
+		erasure := cont.erasure
+		report, err := eraseAuthorship(erasure, userErasurePolicy(dh.config()), db)
+		if err != nil {
+			utils.LogError("Failed to erase deleted user's authorship", err, utils.LogFields{
+				"Username": erasure.username,
+			})
+		}
+
+		status := messages.StatusSuccess
+		if err != nil || report.FilesFailed > 0 {
+			status = messages.StatusServPartialFail
+		}
+		details, _ := json.Marshal(report)
+		err = db.MySQLAuditLogAppend(dbfs.AuditEntryMeta{
+			Event:   "User.Erasure",
+			Actor:   erasure.username,
+			Status:  status,
+			Details: string(details),
+		})
+		utils.LogError("Failed to record audit log entry", err, utils.LogFields{
+			"Event": "User.Erasure",
+			"Actor": erasure.username,
+		})
+	}()
+	return nil
+}
@@ -0,0 +1,145 @@
+package datahandling
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readZip returns the contents of each file in the archive, by name
+func readZip(t *testing.T, archive []byte) map[string][]byte {
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range r.File {
+		f, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = ioutil.ReadAll(f)
+		f.Close()
+		require.NoError(t, err)
+	}
+	return files
+}
+
+// newAuthoredFile creates a file in the project whose stored patches were made by each of the authors, in order
+func newAuthoredFile(db *dbfs.DatabaseMock, projectID int64, name string, authors ...string) int64 {
+	fileID, _ := db.MySQLFileCreate("loganga", name, "", projectID)
+	db.CBInsertNewFile(fileID, 1, []string{})
+	for i, author := range authors {
+		meta := patching.Metadata{Author: author, ClientID: "vim", Timestamp: 1500000000}
+		change := fmt.Sprintf("v%d:\n%d:+1:x:\n%d:\n%s", i+1, i, i, meta.String())
+		db.FileChanges[fileID] = append(db.FileChanges[fileID], change)
+	}
+	db.FileVersion[fileID] = int64(len(authors) + 1)
+	return fileID
+}
+
+func TestUserExportDataRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserChangeUsername("loganga", "gene")
+	db.MySQLUserChangeUsername("gene", "loganga")
+	db.AvatarWrite("loganga", []byte("png"))
+	db.MySQLUserSetAvatar("loganga", "hash")
+	defer usernameAliases.forget("loganga", "gene")
+
+	projectID, _ := db.MySQLProjectCreate("loganga", "hi")
+	newAuthoredFile(db, projectID, "file", "gene", "someone", "loganga")
+
+	req := userExportDataRequest{}
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "ExportData"
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+
+	files := readZip(t, reflect.ValueOf(res.Data).FieldByName("Archive").Bytes())
+	assert.Equal(t, []byte("png"), files["avatar"])
+
+	profile := struct {
+		Username        string
+		Password        string
+		FormerUsernames []string
+	}{}
+	require.NoError(t, json.Unmarshal(files["profile.json"], &profile))
+	assert.Equal(t, "loganga", profile.Username)
+	assert.Empty(t, profile.Password, "password hashes should not be exported")
+	assert.Equal(t, []string{"gene"}, profile.FormerUsernames)
+
+	projects := []dbfs.ProjectMeta{}
+	require.NoError(t, json.Unmarshal(files["projects.json"], &projects))
+	require.Len(t, projects, 1)
+	assert.Equal(t, projectID, projects[0].ProjectID)
+
+	changes := []exportedChange{}
+	require.NoError(t, json.Unmarshal(files["changes.json"], &changes))
+	require.Len(t, changes, 2, "only changes made under the user's usernames should be exported")
+	assert.EqualValues(t, 2, changes[0].FileVersion)
+	assert.EqualValues(t, 4, changes[1].FileVersion)
+	assert.Equal(t, "vim", changes[1].ClientID)
+}
+
+func TestUserDeleteRequest_Erasure(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "someone"})
+	db.MySQLUserChangeUsername("loganga", "gene")
+	db.MySQLUserChangeUsername("gene", "loganga")
+	defer usernameAliases.forget("loganga", "gene")
+
+	ownProjectID, _ := db.MySQLProjectCreate("loganga", "own")
+	sharedProjectID, _ := db.MySQLProjectCreate("someone", "shared")
+	db.MySQLProjectGrantPermission(sharedProjectID, "loganga", 5, "someone")
+	fileID := newAuthoredFile(db, sharedProjectID, "file", "gene", "someone", "loganga")
+
+	req := userDeleteRequest{}
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "Delete"
+	closures, err := req.process(db)
+	require.NoError(t, err)
+	require.IsType(t, userErasureClosure{}, closures[len(closures)-1])
+	erasure := closures[len(closures)-1].(userErasureClosure).erasure
+	assert.Equal(t, []string{"gene"}, erasure.aliases)
+	assert.Equal(t, []int64{ownProjectID}, erasure.projectsDeleted)
+	assert.Equal(t, []int64{sharedProjectID}, erasure.membershipsRemoved)
+
+	report, err := eraseAuthorship(erasure, userErasureAnonymize, db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.FilesChanged)
+	assert.Equal(t, 2, report.ChangesErased)
+	assert.Equal(t, 0, report.FilesFailed)
+
+	authors := []string{}
+	for _, change := range db.FileChanges[fileID] {
+		patch, err := patching.NewPatchFromString(change)
+		require.NoError(t, err)
+		authors = append(authors, patch.Metadata.Author)
+		assert.Equal(t, "vim", patch.Metadata.ClientID, "anonymizing should keep the rest of the metadata")
+	}
+	assert.True(t, strings.HasPrefix(authors[0], "deleted-"))
+	assert.Equal(t, authors[0], authors[2], "the user's changes should share a pseudonym")
+	assert.Equal(t, "someone", authors[1])
+
+	report, err = eraseAuthorship(userErasure{username: authors[0]}, userErasureScrub, db)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.ChangesErased)
+	for _, i := range []int{0, 2} {
+		patch, err := patching.NewPatchFromString(db.FileChanges[fileID][i])
+		require.NoError(t, err)
+		assert.True(t, patch.Metadata.IsEmpty(), "scrubbing should remove all of the metadata")
+	}
+}
@@ -1,13 +1,24 @@
 package datahandling
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // Registers the formats that avatars may be in
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/mail"
 	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/CodeCollaborate/Server/utils"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var userRequestsSetup = false
@@ -26,28 +37,100 @@ func initUserRequests() {
 		return commonJSON(new(userLoginRequest), req)
 	}
 
+	unauthenticatedRequestMap["User.LoginExternal"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userLoginExternalRequest), req)
+	}
+
+	unauthenticatedRequestMap["User.VerifyEmail"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userVerifyEmailRequest), req)
+	}
+
+	unauthenticatedRequestMap["User.RequestPasswordReset"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userRequestPasswordResetRequest), req)
+	}
+
+	unauthenticatedRequestMap["User.ConfirmReset"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userConfirmResetRequest), req)
+	}
+
+	authenticatedRequestMap["User.RequestEmailVerification"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userRequestEmailVerificationRequest), req)
+	}
+
+	authenticatedRequestMap["User.CreateAPIToken"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userCreateAPITokenRequest), req)
+	}
+
+	authenticatedRequestMap["User.RevokeAPIToken"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userRevokeAPITokenRequest), req)
+	}
+
 	authenticatedRequestMap["User.Delete"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(userDeleteRequest), req)
 	}
 
+	authenticatedRequestMap["User.ListSessions"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userListSessionsRequest), req)
+	}
+
+	authenticatedRequestMap["User.RevokeSession"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userRevokeSessionRequest), req)
+	}
+
+	authenticatedRequestMap["User.ExportData"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userExportDataRequest), req)
+	}
+
 	authenticatedRequestMap["User.Lookup"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(userLookupRequest), req)
 	}
 
+	authenticatedRequestMap["User.Search"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userSearchRequest), req)
+	}
+
+	authenticatedRequestMap["User.SetUnlisted"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userSetUnlistedRequest), req)
+	}
+
+	authenticatedRequestMap["User.UpdateProfile"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userUpdateProfileRequest), req)
+	}
+
+	authenticatedRequestMap["User.ChangeUsername"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userChangeUsernameRequest), req)
+	}
+
+	authenticatedRequestMap["User.SetAvatar"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userSetAvatarRequest), req)
+	}
+
+	authenticatedRequestMap["User.GetAvatar"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userGetAvatarRequest), req)
+	}
+
 	authenticatedRequestMap["User.Projects"] = func(req *abstractRequest) (request, error) {
 		return commonJSON(new(userProjectsRequest), req)
 	}
 
+	authenticatedRequestMap["User.GetNotificationPrefs"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userGetNotificationPrefsRequest), req)
+	}
+
+	authenticatedRequestMap["User.SetNotificationPrefs"] = func(req *abstractRequest) (request, error) {
+		return commonJSON(new(userSetNotificationPrefsRequest), req)
+	}
+
 	userRequestsSetup = true
 }
 
 // User.Register
 type userRegisterRequest struct {
-	Username  string
+	Username  string `validate:"required"`
 	FirstName string
 	LastName  string
-	Email     string
-	Password  string
+	Email     string `validate:"required"`
+	Password  string `validate:"required"`
 	abstractRequest
 }
 
@@ -58,7 +141,11 @@ func (f *userRegisterRequest) setAbstractRequest(req *abstractRequest) {
 func (f userRegisterRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	f.Username = strings.ToLower(f.Username)
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(f.Password), bcrypt.DefaultCost)
+	if err := auth.ValidatePassword(f.config(), f.Username, f.Password); err != nil {
+		return []dhClosure{toSenderClosure{msg: newPasswordRejectedResponse(f.Tag, err)}}, err
+	}
+
+	hashed, err := auth.HashPassword(f.config(), f.Password)
 	if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
@@ -68,11 +155,9 @@ func (f userRegisterRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		FirstName: f.FirstName,
 		LastName:  f.LastName,
 		Email:     f.Email,
-		Password:  string(hashed),
+		Password:  hashed,
 	}
 
-	// TODO (non-immediate/required): password validation
-
 	err = db.MySQLUserRegister(newUser)
 
 	if err != nil {
@@ -81,13 +166,24 @@ func (f userRegisterRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		}
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
-	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, err
+
+	closures := []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}
+
+	// Registration still succeeds if the email can't be sent; the user can request another one.
+	verification, err := newAccountTokenEmail(db, newUser, verifyEmailPurpose)
+	if err != nil {
+		utils.LogError("Failed to create email verification token", err, utils.LogFields{
+			"Username": f.Username,
+		})
+		return closures, nil
+	}
+	return append(closures, verification), nil
 }
 
 // User.Login
 type userLoginRequest struct {
-	Username string
-	Password string
+	Username string `validate:"required"`
+	Password string `validate:"required"`
 	abstractRequest
 }
 
@@ -98,27 +194,180 @@ func (f *userLoginRequest) setAbstractRequest(req *abstractRequest) {
 func (f userLoginRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	f.Username = strings.ToLower(f.Username)
 
+	// Locked out accounts and addresses are refused before the password is checked; see loginthrottle.go
+	if retryAfter := loginThrottles.lockedFor(f.config().ServerConfig.LoginThrottle, f.Username, f.remoteAddr, time.Now()); retryAfter > 0 {
+		return []dhClosure{toSenderClosure{msg: newTooManyAttemptsResponse(f.Tag, retryAfter)}}, errLoginThrottled
+	}
+
 	hashed, err := db.MySQLUserGetPass(f.Username)
 	if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
 	if hashed == "" {
+		loginThrottles.fail(f.config().ServerConfig.LoginThrottle, f.Username, f.remoteAddr, time.Now())
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, err
+	}
+
+	needsRehash, err := auth.VerifyPassword(f.config(), hashed, f.Password)
+	if err != nil {
+		loginThrottles.fail(f.config().ServerConfig.LoginThrottle, f.Username, f.remoteAddr, time.Now())
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, err
 	}
+	loginThrottles.succeed(f.Username)
 
-	if err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(f.Password)); err != nil {
+	if f.config().ServerConfig.RequireEmailVerification {
+		user, err := db.MySQLUserLookup(f.Username)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+		}
+		if !user.EmailVerified {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, errEmailNotVerified
+		}
+	}
+
+	// Upgrade legacy or outdated hashes now that we have the plaintext; login still succeeds if this fails.
+	if needsRehash {
+		rehashed, err := auth.HashPassword(f.config(), f.Password)
+		if err == nil {
+			err = db.MySQLUserSetPass(f.Username, rehashed)
+		}
+		utils.LogError("Failed to upgrade password hash", err, utils.LogFields{
+			"Username": f.Username,
+		})
+	}
+
+	return newLoginClosures(f.config(), f.Username, f.Tag)
+}
+
+// User.LoginExternal
+type userLoginExternalRequest struct {
+	Provider string `validate:"required"`
+	IDToken  string `validate:"required"` // For GitHub, the OAuth access token
+	abstractRequest
+}
+
+func (f *userLoginExternalRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userLoginExternalRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	identity, err := auth.VerifyExternalToken(f.config(), f.Provider, f.IDToken)
+	if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, err
 	}
 
-	signed, err := newAuthToken(f.Username)
+	username, err := db.MySQLExternalIdentityLookup(identity.Provider, identity.Subject)
+	if err == dbfs.ErrNoData {
+		username, err = provisionExternalUser(db, identity)
+	}
 	if err != nil {
 		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
 	}
 
+	if f.config().ServerConfig.RequireEmailVerification {
+		user, err := db.MySQLUserLookup(username)
+		if err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+		}
+		if !user.EmailVerified {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, errEmailNotVerified
+		}
+	}
+
+	return newLoginClosures(f.config(), username, f.Tag)
+}
+
+// maxExternalUsernameAttempts is how many numbered variants of the suggested username are tried before giving up
+const maxExternalUsernameAttempts = 20
+
+// provisionExternalUser creates a local account for a first-time external login, and links it to the identity.
+// Existing local accounts are never linked automatically, even if the emails match, since the provider may not have
+// verified the email, or the local account may belong to someone else.
+func provisionExternalUser(db dbfs.DBFS, identity *auth.ExternalIdentity) (string, error) {
+	base := externalUsername(identity.Username)
+
+	for i := 1; i <= maxExternalUsernameAttempts; i++ {
+		username := base
+		if i > 1 {
+			suffix := strconv.Itoa(i)
+			if len(username)+len(suffix) > maxUsernameLength {
+				username = username[:maxUsernameLength-len(suffix)]
+			}
+			username += suffix
+		}
+
+		if _, err := db.MySQLUserLookup(username); err != dbfs.ErrNoData {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		// No password is set, so the account can only be used through the provider until the user resets it.
+		err := db.MySQLUserRegister(dbfs.UserMeta{
+			Username:  username,
+			FirstName: identity.FirstName,
+			LastName:  identity.LastName,
+			Email:     identity.Email,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if identity.EmailVerified {
+			err = db.MySQLUserSetEmailVerified(username)
+			utils.LogError("Failed to mark provisioned user's email as verified", err, utils.LogFields{
+				"Username": username,
+			})
+		}
+		if err := db.MySQLExternalIdentityLink(identity.Provider, identity.Subject, username); err != nil {
+			return "", err
+		}
+
+		utils.LogInfo("Provisioned user for external identity", utils.LogFields{
+			"Username": username,
+			"Provider": identity.Provider,
+		})
+		return username, nil
+	}
+
+	return "", errNoAvailableUsername
+}
+
+// maxUsernameLength matches the width of the User.Username column
+const maxUsernameLength = 25
+
+var errNoAvailableUsername = errors.New("Could not find an available username for the external identity")
+
+// externalUsername lowercases the suggested username, and strips any characters that aren't letters, digits,
+// '.', '_' or '-'.
+func externalUsername(suggested string) string {
+	username := []rune{}
+	for _, r := range strings.ToLower(suggested) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			username = append(username, r)
+		}
+	}
+	if len(username) == 0 {
+		return "user"
+	}
+	if len(username) > maxUsernameLength {
+		username = username[:maxUsernameLength]
+	}
+	return string(username)
+}
+
+// newLoginClosures issues a session token for the user, and subscribes them to their own notifications.
+func newLoginClosures(cfg *config.Config, username string, tag int64) ([]dhClosure, error) {
+	signed, err := newAuthToken(cfg, username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, tag)}}, err
+	}
+
 	res := messages.Response{
 		Status: messages.StatusSuccess,
-		Tag:    f.Tag,
+		Tag:    tag,
 		Data: struct {
 			Token string
 		}{
@@ -133,13 +382,316 @@ func (f userLoginRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 			Command: "Subscribe",
 			Tag:     -1,
 			Data: rabbitmq.RabbitQueueData{
-				Key: rabbitmq.RabbitUserQueueName(f.Username),
+				Key: rabbitmq.RabbitUserQueueName(username),
 			},
+			username: username,
 		},
 	}, nil
 }
 
-// User.Delete
+const (
+	verifyEmailPurpose   = "verify_email"
+	passwordResetPurpose = "password_reset"
+
+	verifyEmailValidity   = 48 * time.Hour
+	passwordResetValidity = time.Hour
+)
+
+var errEmailNotVerified = errors.New("The user has not verified their email address")
+
+// newPasswordRejectedResponse tells the client why the password policy rejected their password.
+func newPasswordRejectedResponse(tag int64, err error) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusFail,
+		Tag:    tag,
+		Data: struct {
+			Reason string
+		}{
+			Reason: err.Error(),
+		},
+	}.Wrap()
+}
+
+// newAccountTokenEmail creates a single-use token for the given purpose, and returns the closure that emails it to the user.
+func newAccountTokenEmail(db dbfs.DBFS, user dbfs.UserMeta, purpose string) (dhClosure, error) {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	validity := verifyEmailValidity
+	msg := mail.Message{
+		To:      user.Email,
+		Subject: "Verify your CodeCollaborate email address",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the following code to verify your email address. It expires in %s.\n\n%s\n",
+			user.FirstName, validity, token),
+	}
+	if purpose == passwordResetPurpose {
+		validity = passwordResetValidity
+		msg = mail.Message{
+			To:      user.Email,
+			Subject: "Reset your CodeCollaborate password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the following code to reset your password. It expires in %s.\n"+
+				"If you did not request a password reset, you can ignore this email.\n\n%s\n",
+				user.FirstName, validity, token),
+		}
+	}
+
+	if err := db.MySQLUserTokenCreate(user.Username, hash, purpose, validity); err != nil {
+		return nil, err
+	}
+	return emailClosure{msg: msg}, nil
+}
+
+// User.VerifyEmail
+type userVerifyEmailRequest struct {
+	Token string `validate:"required"`
+	abstractRequest
+}
+
+func (f *userVerifyEmailRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userVerifyEmailRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	username, err := db.MySQLUserTokenConsume(auth.HashToken(f.Token), verifyEmailPurpose)
+	if err != nil {
+		if err == dbfs.ErrNoData {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, err
+		}
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	// ErrNoDbChange means the email was already verified
+	if err := db.MySQLUserSetEmailVerified(username); err != nil && err != dbfs.ErrNoDbChange {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+}
+
+// User.RequestEmailVerification
+type userRequestEmailVerificationRequest struct {
+	abstractRequest
+}
+
+func (f *userRequestEmailVerificationRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userRequestEmailVerificationRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	user, err := db.MySQLUserLookup(f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	if user.EmailVerified {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+	}
+
+	verification, err := newAccountTokenEmail(db, user, verifyEmailPurpose)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}, verification}, nil
+}
+
+// User.RequestPasswordReset
+type userRequestPasswordResetRequest struct {
+	Username string `validate:"required"`
+	abstractRequest
+}
+
+func (f *userRequestPasswordResetRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userRequestPasswordResetRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	f.Username = strings.ToLower(f.Username)
+
+	// Every request is counted, whether or not the user exists; see loginthrottle.go
+	throttleCfg := f.config().ServerConfig.LoginThrottle
+	if retryAfter := passwordResetThrottles.lockedFor(throttleCfg, f.Username, f.remoteAddr, time.Now()); retryAfter > 0 {
+		return []dhClosure{toSenderClosure{msg: newTooManyAttemptsResponse(f.Tag, retryAfter)}}, errPasswordResetThrottled
+	}
+	passwordResetThrottles.fail(throttleCfg, f.Username, f.remoteAddr, time.Now())
+
+	// Always report success, so that this can't be used to find out which usernames exist.
+	closures := []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}
+
+	user, err := db.MySQLUserLookup(f.Username)
+	if err != nil {
+		if err == dbfs.ErrNoData {
+			return closures, nil
+		}
+		return closures, err
+	}
+
+	reset, err := newAccountTokenEmail(db, user, passwordResetPurpose)
+	if err != nil {
+		return closures, err
+	}
+
+	return append(closures, reset), nil
+}
+
+// User.ConfirmReset
+type userConfirmResetRequest struct {
+	Token       string `validate:"required"`
+	NewPassword string `validate:"required"`
+	abstractRequest
+}
+
+func (f *userConfirmResetRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userConfirmResetRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	// Check what we can before using up the token
+	if err := auth.ValidatePassword(f.config(), "", f.NewPassword); err != nil {
+		return []dhClosure{toSenderClosure{msg: newPasswordRejectedResponse(f.Tag, err)}}, err
+	}
+
+	username, err := db.MySQLUserTokenConsume(auth.HashToken(f.Token), passwordResetPurpose)
+	if err != nil {
+		if err == dbfs.ErrNoData {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, err
+		}
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	// The token has been used up at this point; the user must request a new one if the password is rejected here.
+	if err := auth.ValidatePassword(f.config(), username, f.NewPassword); err != nil {
+		return []dhClosure{toSenderClosure{msg: newPasswordRejectedResponse(f.Tag, err)}}, err
+	}
+
+	hashed, err := auth.HashPassword(f.config(), f.NewPassword)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+	}
+
+	if err := db.MySQLUserSetPass(username, hashed); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	passwordResetThrottles.succeed(username)
+
+	// Receiving the reset email proves ownership of the address
+	if err := db.MySQLUserSetEmailVerified(username); err != nil && err != dbfs.ErrNoDbChange {
+		utils.LogError("Failed to mark email as verified", err, utils.LogFields{
+			"Username": username,
+		})
+	}
+
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+}
+
+// User.CreateAPIToken
+type userCreateAPITokenRequest struct {
+	Name       string  `validate:"required"`
+	Scope      string  `validate:"oneof=read write admin"`
+	ProjectIDs []int64 // If non-empty, the only projects the token may access
+	Validity   string  // Duration, such as "720h"; the token never expires if empty
+	abstractRequest
+}
+
+func (f *userCreateAPITokenRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userCreateAPITokenRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if f.Name == "" || len(f.Name) > maxAPITokenNameLength || !validAPITokenScope(f.Scope) {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, errInvalidAPIToken
+	}
+
+	var validity time.Duration
+	if f.Validity != "" {
+		var err error
+		validity, err = time.ParseDuration(f.Validity)
+		if err != nil || validity <= 0 {
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, errInvalidAPIToken
+		}
+	}
+
+	// Tokens can't be granted access to projects the user can't see
+	for _, projectID := range f.ProjectIDs {
+		hasPermission, err := authorizeProject(f.abstractRequest, projectID, config.CapabilityViewProject, db)
+		if err != nil || !hasPermission {
+			utils.LogError("API permission error", err, utils.LogFields{
+				"Resource":  f.Resource,
+				"Method":    f.Method,
+				"SenderID":  f.SenderID,
+				"ProjectID": projectID,
+			})
+			return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusUnauthorized, f.Tag)}}, nil
+		}
+	}
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusServFail, f.Tag)}}, err
+	}
+
+	tokenID, err := db.MySQLAPITokenCreate(hash, dbfs.APITokenMeta{
+		Username:   f.SenderID,
+		Name:       f.Name,
+		Scope:      f.Scope,
+		ProjectIDs: f.ProjectIDs,
+	}, validity)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	// This is the only time the token is ever returned; only its hash is stored
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			TokenID int64
+			Token   string
+		}{
+			TokenID: tokenID,
+			Token:   apiTokenPrefix + token,
+		},
+	}.Wrap()
+
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// maxAPITokenNameLength matches the width of the APIToken.Name column
+const maxAPITokenNameLength = 50
+
+var errInvalidAPIToken = errors.New("API tokens require a name, a scope of read, write or admin, and a positive validity")
+
+func validAPITokenScope(scope string) bool {
+	for _, valid := range apiTokenScopes {
+		if scope == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// User.RevokeAPIToken
+type userRevokeAPITokenRequest struct {
+	TokenID int64 `validate:"required"`
+	abstractRequest
+}
+
+func (f *userRevokeAPITokenRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userRevokeAPITokenRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	err := db.MySQLAPITokenRevoke(f.TokenID, f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+}
+
+// User.Delete deletes the sender's account and the projects they own, then erases their authorship from the patches
+// they made in others' projects; see userdata.go
 type userDeleteRequest struct {
 	abstractRequest
 }
@@ -149,10 +701,48 @@ func (f *userDeleteRequest) setAbstractRequest(req *abstractRequest) {
 }
 
 func (f userDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	// The user's former usernames and memberships are deleted with them, but their patches still name them
+	user, err := db.MySQLUserLookup(f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	aliases, err := db.MySQLUserAliases(f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	projects, err := db.MySQLUserProjects(f.SenderID)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
 	deletedIDs, err := db.MySQLUserDelete(f.SenderID)
 
 	if err != nil {
-		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, err
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	erasure := userErasure{
+		username:           f.SenderID,
+		aliases:            aliases,
+		projectsDeleted:    deletedIDs,
+		membershipsRemoved: []int64{},
+		avatarDeleted:      user.AvatarHash != "",
+	}
+	if err := db.AvatarDelete(f.SenderID); err != nil {
+		erasure.avatarDeleted = false
+		utils.LogError("Failed to delete avatar", err, utils.LogFields{
+			"Username": f.SenderID,
+		})
+	}
+	usernameAliases.forget(append(aliases, f.SenderID)...)
+
+	deleted := map[int64]bool{}
+	for _, projectID := range deletedIDs {
+		deleted[projectID] = true
+	}
+	for _, project := range projects {
+		if !deleted[project.ProjectID] {
+			erasure.membershipsRemoved = append(erasure.membershipsRemoved, project.ProjectID)
+		}
 	}
 	closures := []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}
 
@@ -165,10 +755,10 @@ func (f userDeleteRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 			Data:       struct{}{},
 		}.Wrap()
 
-		closures = append(closures, toRabbitChannelClosure{msg: not, key: rabbitmq.RabbitProjectQueueName(projectID)})
+		closures = append(closures, projectNotificationClosure(projectID, 0, not))
 	}
 
-	return closures, nil
+	return append(closures, userErasureClosure{erasure: erasure}), nil
 }
 
 // User.Lookup
@@ -228,8 +818,241 @@ func (f userLookupRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	return []dhClosure{toSenderClosure{msg: res}}, erro
 }
 
+// defaultUserSearchResults is how many users User.Search returns if no Limit is given
+const defaultUserSearchResults = 10
+
+// User.Search finds users by a prefix of their username, email, first or last name, so that clients can complete
+// usernames as they are typed. Unlisted users are only found by their exact username, as User.Lookup finds them.
+type userSearchRequest struct {
+	Prefix string `validate:"required,min=2,max=50"`
+	Limit  int    `validate:"min=0,max=50"` // 0 for defaultUserSearchResults
+	abstractRequest
+}
+
+func (f *userSearchRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userSearchRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	limit := f.Limit
+	if limit == 0 {
+		limit = defaultUserSearchResults
+	}
+
+	users, err := db.MySQLUserSearch(f.Prefix, limit)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			Users []dbfs.UserMeta // Only their Username, FirstName and LastName
+		}{
+			Users: users,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// User.SetUnlisted
+type userSetUnlistedRequest struct {
+	Unlisted bool // Hides the user from User.Search, other than by their exact username
+	abstractRequest
+}
+
+func (f *userSetUnlistedRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userSetUnlistedRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if err := db.MySQLUserSetUnlisted(f.SenderID, f.Unlisted); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+}
+
+// User.UpdateProfile
+type userUpdateProfileRequest struct {
+	FirstName string `validate:"max=30"`
+	LastName  string `validate:"max=30"`
+	abstractRequest
+}
+
+func (f *userUpdateProfileRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userUpdateProfileRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if err := db.MySQLUserUpdateProfile(f.SenderID, f.FirstName, f.LastName); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+}
+
+var errInvalidUsername = errors.New("Usernames may only contain letters, digits, '.', '_' and '-'")
+
+// User.ChangeUsername renames the sender everywhere their username is referenced. Their old username becomes an alias
+// of the new one, which no one else may take, so that tokens issued to it keep working until they expire; see
+// aliases.go. The response carries a session token for the new username.
+type userChangeUsernameRequest struct {
+	NewUsername string `validate:"required,max=25"`
+	abstractRequest
+}
+
+func (f *userChangeUsernameRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userChangeUsernameRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	newUsername := strings.ToLower(f.NewUsername)
+	if externalUsername(newUsername) != newUsername {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFail, f.Tag)}}, errInvalidUsername
+	}
+
+	if err := db.MySQLUserChangeUsername(f.SenderID, newUsername); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	usernameAliases.forget(f.SenderID, newUsername)
+
+	// The rename has been made, so a failure to move the avatar only loses the image
+	if err := moveAvatar(db, f.SenderID, newUsername); err != nil {
+		utils.LogError("Failed to move avatar to new username", err, utils.LogFields{
+			"Username":    f.SenderID,
+			"NewUsername": newUsername,
+		})
+	}
+
+	return newLoginClosures(f.config(), newUsername, f.Tag)
+}
+
+// moveAvatar moves the user's avatar, if they have one, to where it is kept for their new username
+func moveAvatar(db dbfs.DBFS, oldUsername string, newUsername string) error {
+	raw, err := db.AvatarRead(oldUsername)
+	if err == dbfs.ErrNoData {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := db.AvatarWrite(newUsername, raw); err != nil {
+		return err
+	}
+	return db.AvatarDelete(oldUsername)
+}
+
+// maxAvatarSize is the largest avatar, in bytes, that User.SetAvatar accepts
+const maxAvatarSize = 256 << 10
+
+// maxAvatarDimension is the largest width and height, in pixels, of the avatars User.SetAvatar accepts
+const maxAvatarDimension = 1024
+
+var errInvalidAvatar = errors.New("Avatars must be PNG, JPEG or GIF images of at most 256KB and 1024x1024 pixels")
+
+// validateAvatar checks that the avatar is a PNG, JPEG or GIF image within the size limits
+func validateAvatar(raw []byte) error {
+	if len(raw) > maxAvatarSize {
+		return errInvalidAvatar
+	}
+	// The dimensions are checked before decoding, so that small files can't claim enormous images
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil || cfg.Width > maxAvatarDimension || cfg.Height > maxAvatarDimension {
+		return errInvalidAvatar
+	}
+	if _, _, err := image.Decode(bytes.NewReader(raw)); err != nil {
+		return errInvalidAvatar
+	}
+	return nil
+}
+
+// User.SetAvatar replaces the sender's avatar, which others fetch with User.GetAvatar or from the REST API's
+// /users/{username}/avatar. An empty Image removes it.
+type userSetAvatarRequest struct {
+	Image []byte
+	abstractRequest
+}
+
+func (f *userSetAvatarRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userSetAvatarRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	if len(f.Image) == 0 {
+		if err := db.MySQLUserSetAvatar(f.SenderID, ""); err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+		}
+		if err := db.AvatarDelete(f.SenderID); err != nil {
+			return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+		}
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)}}, nil
+	}
+
+	if err := validateAvatar(f.Image); err != nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusFileRejected, f.Tag)}}, err
+	}
+
+	hash, err := db.AvatarWrite(f.SenderID, f.Image)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	if err := db.MySQLUserSetAvatar(f.SenderID, hash); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			AvatarHash string
+		}{
+			AvatarHash: hash,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// User.GetAvatar
+type userGetAvatarRequest struct {
+	Username string `validate:"required"`
+	abstractRequest
+}
+
+func (f *userGetAvatarRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userGetAvatarRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	user, err := db.MySQLUserLookup(strings.ToLower(f.Username))
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	if user.AvatarHash == "" {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, f.Tag)}}, nil
+	}
+
+	raw, err := db.AvatarRead(user.Username)
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			AvatarHash string // Changes whenever the avatar does, so clients may cache it by hash
+			Image      []byte
+		}{
+			AvatarHash: user.AvatarHash,
+			Image:      raw,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
 // User.Projects
 type userProjectsRequest struct {
+	Offset int `validate:"min=0"`
+	Limit  int `validate:"min=0,max=1000"` // 0 returns every project after Offset
 	abstractRequest
 }
 
@@ -241,6 +1064,17 @@ func (f userProjectsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 	var errOut error
 	projects, errOut := db.MySQLUserProjects(f.SenderID)
 
+	// Projects the sender's API token can't access are left out of the total, as well as the results
+	allowed := make([]dbfs.ProjectMeta, 0, len(projects))
+	for _, project := range projects {
+		if f.tokenAllowsProject(project.ProjectID) {
+			allowed = append(allowed, project)
+		}
+	}
+	total := len(allowed)
+	start, end := page(total, f.Offset, f.Limit)
+	projects = allowed[start:end]
+
 	resultData := make([]projectLookupResult, len(projects))
 
 	i := 0
@@ -268,8 +1102,10 @@ func (f userProjectsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 			Tag:    f.Tag,
 			Data: struct {
 				Projects []projectLookupResult
+				Total    int
 			}{
 				Projects: resultData,
+				Total:    total,
 			},
 		}.Wrap()
 		return []dhClosure{toSenderClosure{msg: res}}, errOut
@@ -280,8 +1116,10 @@ func (f userProjectsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
 		Tag:    f.Tag,
 		Data: struct {
 			Projects []projectLookupResult
+			Total    int
 		}{
 			Projects: resultData,
+			Total:    total,
 		},
 	}.Wrap()
 
@@ -1,13 +1,21 @@
 package datahandling
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/CodeCollaborate/Server/modules/auth"
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestUserRegisterRequest_Process(t *testing.T) {
@@ -33,7 +41,7 @@ func TestUserRegisterRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	if db.FunctionCallCount != 1 {
+	if db.FunctionCallCount != 2 {
 		t.Fatal("did not call correct number of db functions")
 	}
 	// did gene it actually added
@@ -42,10 +50,14 @@ func TestUserRegisterRequest_Process(t *testing.T) {
 	}
 
 	// are we notifying the right people
-	if len(closures) != 1 ||
-		reflect.TypeOf(closures[0]).String() != "datahandling.toSenderClosure" {
+	if len(closures) != 2 ||
+		reflect.TypeOf(closures[0]).String() != "datahandling.toSenderClosure" ||
+		reflect.TypeOf(closures[1]).String() != "datahandling.emailClosure" {
 		t.Fatalf("did not properly process, recieved %d closure(s)", len(closures))
 	}
+	if len(db.UserTokens) != 1 {
+		t.Fatal("did not create email verification token")
+	}
 	// did the server return success status
 	cont := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status
 	if cont != messages.StatusSuccess {
@@ -58,7 +70,74 @@ func TestUserRegisterRequest_Process(t *testing.T) {
 	}
 }
 
-// userLoginRequest.process is unimplemented
+func TestUserRegisterRequest_ProcessWeakPassword(t *testing.T) {
+	configSetup(t)
+	req := *new(userRegisterRequest)
+	setBaseFields(&req)
+
+	req.Resource = "User"
+	req.Method = "Register"
+
+	req.Username = "loganga"
+	req.Password = "loganga1"
+
+	db := dbfs.NewDBMock()
+
+	closures, err := req.process(db)
+	assert.Equal(t, auth.ErrPasswordContainsUsername, err)
+	assert.Equal(t, 0, db.FunctionCallCount, "user should not have been registered")
+
+	assert.Equal(t, 1, len(closures), "unexpected number of returned closures")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status, "unexpected response status")
+}
+
+func TestUserLoginRequest_Process(t *testing.T) {
+	configSetup(t)
+
+	// Users registered before argon2id still have bcrypt hashes
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte("correct horse battery staple"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyUser := geneMeta
+	legacyUser.Password = string(legacyHash)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(legacyUser)
+	db.FunctionCallCount = 0
+
+	req := *new(userLoginRequest)
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "Login"
+	req.Username = legacyUser.Username
+	req.Password = "incorrect horse battery staple"
+
+	closures, err := req.process(db)
+	assert.Equal(t, auth.ErrMismatchedPassword, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+	assert.Equal(t, string(legacyHash), db.Users[legacyUser.Username].Password, "hash should not change on failed login")
+
+	req.Password = "correct horse battery staple"
+	db.FunctionCallCount = 0
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.FunctionCallCount, "expected the password hash to be upgraded")
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	upgraded := db.Users[legacyUser.Username].Password
+	assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"), "legacy hash was not upgraded")
+
+	// Already upgraded; should not re-hash again
+	db.FunctionCallCount = 0
+	_, err = req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, db.FunctionCallCount, "unexpected db calls for user login")
+	assert.Equal(t, upgraded, db.Users[legacyUser.Username].Password)
+}
 
 func TestUserDeleteRequest_Process(t *testing.T) {
 	configSetup(t)
@@ -75,10 +154,11 @@ func TestUserDeleteRequest_Process(t *testing.T) {
 
 	closures, err := req.process(db)
 	assert.Nil(t, err)
-	assert.Equal(t, 2, db.FunctionCallCount, "unexpected db calls for user delete")
+	assert.Equal(t, 6, db.FunctionCallCount, "unexpected db calls for user delete")
 
-	assert.Equal(t, 1, len(closures), "unexpected number of returned closures")
+	assert.Equal(t, 2, len(closures), "unexpected number of returned closures")
 	assert.IsType(t, toSenderClosure{}, closures[0], "incorrect closure type")
+	assert.IsType(t, userErasureClosure{}, closures[1], "incorrect closure type")
 
 	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
 
@@ -100,12 +180,13 @@ func TestUserDeleteRequest_Process(t *testing.T) {
 
 	closures, err = req.process(db)
 	assert.Nil(t, err)
-	assert.Equal(t, 2, db.FunctionCallCount, "unexpected db calls for user delete")
+	assert.Equal(t, 6, db.FunctionCallCount, "unexpected db calls for user delete")
 
-	assert.Equal(t, 3, len(closures), "unexpected number of returned closures")
+	assert.Equal(t, 4, len(closures), "unexpected number of returned closures")
 	assert.IsType(t, toSenderClosure{}, closures[0], "incorrect closure type")
 	assert.IsType(t, toRabbitChannelClosure{}, closures[1], "incorrect closure type")
 	assert.IsType(t, toRabbitChannelClosure{}, closures[2], "incorrect closure type")
+	assert.IsType(t, userErasureClosure{}, closures[3], "incorrect closure type")
 
 	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
 	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
@@ -168,6 +249,120 @@ func TestUserLookupRequest_Process(t *testing.T) {
 	}
 }
 
+func TestUserSearchRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "logan", FirstName: "Logan", Email: "logan@codecollaborate.com"})
+
+	search := func(prefix string, limit int) []string {
+		req := userSearchRequest{Prefix: prefix, Limit: limit}
+		setBaseFields(&req)
+		req.Resource = "User"
+		req.Method = "Search"
+		res, _ := processForTest(t, &req, db)
+		require.Equal(t, messages.StatusSuccess, res.Status)
+		var usernames []string
+		for _, user := range reflect.ValueOf(res.Data).FieldByName("Users").Interface().([]dbfs.UserMeta) {
+			assert.Empty(t, user.Email, "emails shouldn't be returned")
+			usernames = append(usernames, user.Username)
+		}
+		return usernames
+	}
+
+	assert.Equal(t, []string{"logan", "loganga"}, search("LOGAN", 0), "exact usernames should come first")
+	assert.Equal(t, []string{"loganga"}, search("gene", 0))
+	assert.Equal(t, []string{"notloganga"}, search("notlo", 0))
+	assert.Equal(t, []string{"logan"}, search("log", 1))
+
+	// Unlisted users are only found by their exact username
+	req := userSetUnlistedRequest{Unlisted: true}
+	setBaseFields(&req)
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, []string{"logan"}, search("logan", 0))
+	assert.Equal(t, []string{"loganga"}, search("loganga", 0))
+}
+
+func TestUserUpdateProfileRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	req := userUpdateProfileRequest{FirstName: "Gene", LastName: "Logan"}
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "UpdateProfile"
+	res, _ := processForTest(t, &req, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, "Gene", db.Users["loganga"].FirstName)
+	assert.Equal(t, "Logan", db.Users["loganga"].LastName)
+}
+
+func TestUserSetAvatarRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+
+	encode := func(width, height int) []byte {
+		raw := &bytes.Buffer{}
+		require.NoError(t, png.Encode(raw, image.NewGray(image.Rect(0, 0, width, height))))
+		return raw.Bytes()
+	}
+	setAvatar := func(raw []byte) (messages.Response, error) {
+		req := userSetAvatarRequest{Image: raw}
+		setBaseFields(&req)
+		req.Resource = "User"
+		req.Method = "SetAvatar"
+		closures, err := req.process(db)
+		return closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response), err
+	}
+	rejected := func(raw []byte) {
+		res, err := setAvatar(raw)
+		assert.Equal(t, errInvalidAvatar, err)
+		assert.Equal(t, messages.StatusFileRejected, res.Status)
+	}
+	getAvatar := func(username string) messages.Response {
+		req := userGetAvatarRequest{Username: username}
+		setBaseFields(&req)
+		req.Resource = "User"
+		req.Method = "GetAvatar"
+		req.SenderID = "notloganga"
+		res, _ := processForTest(t, &req, db)
+		return res
+	}
+
+	avatar := encode(16, 16)
+	res, err := setAvatar(avatar)
+	require.NoError(t, err)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	hash := reflect.ValueOf(res.Data).FieldByName("AvatarHash").String()
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, db.Users["loganga"].AvatarHash)
+
+	res = getAvatar("LOGANGA")
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Equal(t, hash, reflect.ValueOf(res.Data).FieldByName("AvatarHash").String())
+	assert.Equal(t, avatar, reflect.ValueOf(res.Data).FieldByName("Image").Bytes())
+	assert.Equal(t, messages.StatusNotFound, getAvatar("notloganga").Status)
+
+	// Anything but small images is rejected, leaving the current avatar
+	rejected([]byte("<svg></svg>"))
+	rejected(encode(maxAvatarDimension+1, 1))
+	rejected(avatar[:len(avatar)-8])
+	rejected(make([]byte, maxAvatarSize+1))
+	assert.Equal(t, hash, db.Users["loganga"].AvatarHash)
+
+	res, err = setAvatar(nil)
+	require.NoError(t, err)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.Empty(t, db.Users["loganga"].AvatarHash)
+	assert.Empty(t, db.Avatars)
+	assert.Equal(t, messages.StatusNotFound, getAvatar("loganga").Status)
+}
+
 func TestUserProjectsRequest_Process(t *testing.T) {
 	configSetup(t)
 	req := *new(userProjectsRequest)
@@ -209,7 +404,7 @@ func TestUserProjectsRequest_Process(t *testing.T) {
 	}
 
 	// didn't call extra db functions
-	if db.FunctionCallCount != 2 {
+	if db.FunctionCallCount != 3 {
 		t.Fatalf("did not call correct number of db functions, called %d # of arguments", db.FunctionCallCount)
 	}
 
@@ -272,3 +467,326 @@ func TestUserProjectsRequest_Process(t *testing.T) {
 	assert.Nil(t, err, "did not get permission")
 	assert.Equal(t, ownerPerm.Level, projects[1].Permissions[notgene.Username].PermissionLevel, "not all permissions returned for project")
 }
+
+// tokenFromEmail extracts the token from the last line of an account email
+func tokenFromEmail(t *testing.T, closure dhClosure) string {
+	email, ok := closure.(emailClosure)
+	if !ok {
+		t.Fatalf("expected emailClosure, got %T", closure)
+	}
+	lines := strings.Split(strings.TrimSpace(email.msg.Body), "\n")
+	return lines[len(lines)-1]
+}
+
+func TestUserVerifyEmailRequest_Process(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	verifyReq := *new(userRequestEmailVerificationRequest)
+	setBaseFields(&verifyReq)
+	verifyReq.Resource = "User"
+	verifyReq.Method = "RequestEmailVerification"
+
+	closures, err := verifyReq.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(closures), "unexpected number of returned closures")
+	assert.Equal(t, geneMeta.Email, closures[1].(emailClosure).msg.To, "email sent to wrong address")
+	token := tokenFromEmail(t, closures[1])
+
+	req := *new(userVerifyEmailRequest)
+	setBaseFields(&req)
+	req.Resource = "User"
+	req.Method = "VerifyEmail"
+	req.Token = "wrongToken"
+
+	closures, err = req.process(db)
+	assert.Equal(t, dbfs.ErrNoData, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+	assert.False(t, db.Users[geneMeta.Username].EmailVerified)
+
+	req.Token = token
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+	assert.True(t, db.Users[geneMeta.Username].EmailVerified, "email was not verified")
+
+	// tokens are single use
+	_, err = req.process(db)
+	assert.Equal(t, dbfs.ErrNoData, err)
+}
+
+func TestUserPasswordReset_Process(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	resetReq := *new(userRequestPasswordResetRequest)
+	setBaseFields(&resetReq)
+	resetReq.Resource = "User"
+	resetReq.Method = "RequestPasswordReset"
+	resetReq.Username = "nonexistent"
+
+	closures, err := resetReq.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(closures), "no email should be sent for unknown users")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unknown users should not be revealed")
+
+	resetReq.Username = "LoganGA"
+	closures, err = resetReq.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(closures), "unexpected number of returned closures")
+	token := tokenFromEmail(t, closures[1])
+
+	confirmReq := *new(userConfirmResetRequest)
+	setBaseFields(&confirmReq)
+	confirmReq.Resource = "User"
+	confirmReq.Method = "ConfirmReset"
+	confirmReq.Token = token
+	confirmReq.NewPassword = "short"
+
+	closures, err = confirmReq.process(db)
+	assert.Equal(t, auth.ErrPasswordTooShort, err)
+	_, ok := db.UserTokens[auth.HashToken(token)]
+	assert.True(t, ok, "token should not be used up by a password that is obviously invalid")
+
+	confirmReq.NewPassword = "a brand new horse battery staple"
+	closures, err = confirmReq.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	_, err = auth.VerifyPassword(nil, db.Users[geneMeta.Username].Password, "a brand new horse battery staple")
+	assert.Nil(t, err, "password was not reset")
+
+	closures, err = confirmReq.process(db)
+	assert.Equal(t, dbfs.ErrNoData, err, "tokens are single use")
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+}
+
+func TestUserPasswordReset_Throttled(t *testing.T) {
+	configSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(throttleCfg config.LoginThrottleCfg) {
+		serverCfg.LoginThrottle = throttleCfg
+	}(serverCfg.LoginThrottle)
+	serverCfg.LoginThrottle = config.LoginThrottleCfg{MaxFailures: 2, IPMaxFailures: 3}
+	defer func() {
+		for _, key := range []string{accountThrottleKey(geneMeta.Username), accountThrottleKey("nonexistent"),
+			addressThrottleKey("192.0.2.1"), addressThrottleKey("192.0.2.2")} {
+			passwordResetThrottles.unlock(key)
+		}
+	}()
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	resetReq := *new(userRequestPasswordResetRequest)
+	setBaseFields(&resetReq)
+	resetReq.Resource = "User"
+	resetReq.Method = "RequestPasswordReset"
+	resetReq.Username = geneMeta.Username
+	resetReq.remoteAddr = "192.0.2.1"
+
+	for i := 0; i < 2; i++ {
+		closures, err := resetReq.process(db)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(closures), "the reset email should be sent")
+	}
+	closures, err := resetReq.process(db)
+	assert.Equal(t, errPasswordResetThrottled, err)
+	require.Equal(t, 1, len(closures), "no more emails should be sent to the account")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusTooManyAttempts, resp.Status)
+
+	// The address is throttled too, whether or not the users it asks for exist
+	resetReq.Username = "nonexistent"
+	_, err = resetReq.process(db)
+	assert.Nil(t, err)
+	_, err = resetReq.process(db)
+	assert.Equal(t, errPasswordResetThrottled, err)
+
+	// Resetting the password clears the account's count, but not the address's
+	passwordResetThrottles.succeed(geneMeta.Username)
+	resetReq.Username = geneMeta.Username
+	_, err = resetReq.process(db)
+	assert.Equal(t, errPasswordResetThrottled, err)
+	resetReq.remoteAddr = "192.0.2.2"
+	_, err = resetReq.process(db)
+	assert.Nil(t, err)
+}
+
+func TestUserLoginExternalRequest_Process(t *testing.T) {
+	configSetup(t)
+	req := *new(userLoginExternalRequest)
+	setBaseFields(&req)
+
+	req.Resource = "User"
+	req.Method = "LoginExternal"
+	req.Provider = "not-configured"
+	req.IDToken = "token"
+
+	db := dbfs.NewDBMock()
+	closures, err := req.process(db)
+	assert.Equal(t, auth.ErrUnknownProvider, err)
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "unexpected response status")
+	assert.Equal(t, 0, db.FunctionCallCount, "no db calls expected for an unverified token")
+}
+
+func TestProvisionExternalUser(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	identity := &auth.ExternalIdentity{
+		Provider:      "google",
+		Subject:       "1234567890",
+		Username:      geneMeta.Username,
+		Email:         "gene@example.com",
+		EmailVerified: true,
+		FirstName:     "Gene",
+		LastName:      "Hynson",
+	}
+
+	username, err := provisionExternalUser(db, identity)
+	assert.NoError(t, err)
+	assert.Equal(t, geneMeta.Username+"2", username, "existing local user should not be reused")
+	assert.True(t, db.Users[username].EmailVerified, "email verified by the provider should be marked verified")
+	assert.Equal(t, "", db.Users[username].Password, "provisioned users should not have a password")
+
+	linked, err := db.MySQLExternalIdentityLookup("google", "1234567890")
+	assert.NoError(t, err)
+	assert.Equal(t, username, linked)
+
+	identity.Subject = "0987654321"
+	identity.EmailVerified = false
+	username, err = provisionExternalUser(db, identity)
+	assert.NoError(t, err)
+	assert.Equal(t, geneMeta.Username+"3", username)
+	assert.False(t, db.Users[username].EmailVerified)
+}
+
+func TestExternalUsername(t *testing.T) {
+	assert.Equal(t, "gene.hynson", externalUsername("Gene.Hynson"))
+	assert.Equal(t, "genehynson", externalUsername("gene hynson!"))
+	assert.Equal(t, "user", externalUsername("密码"))
+	assert.Equal(t, strings.Repeat("a", maxUsernameLength), externalUsername(strings.Repeat("a", 40)))
+}
+
+func TestUserAPITokenRequests_Process(t *testing.T) {
+	configSetup(t)
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	projectID, _ := db.MySQLProjectCreate(geneMeta.Username, "_test_project")
+
+	req := *new(userCreateAPITokenRequest)
+	req.setAbstractRequest(&abstractRequest{SenderID: geneMeta.Username})
+	req.Resource = "User"
+	req.Method = "CreateAPIToken"
+	req.Name = "ci"
+	req.Scope = "owner"
+
+	closures, err := req.process(db)
+	assert.Equal(t, errInvalidAPIToken, err, "owner scope should not be allowed")
+	resp := closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusFail, resp.Status, "unexpected response status")
+
+	req.Scope = "read"
+	req.ProjectIDs = []int64{projectID + 1}
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusUnauthorized, resp.Status, "tokens should not be granted access to other users' projects")
+
+	req.ProjectIDs = []int64{projectID}
+	req.Validity = "720h"
+	db.FunctionCallCount = 0
+	closures, err = req.process(db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.FunctionCallCount, "unexpected db calls for create API token")
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	created := reflect.ValueOf(resp.Data)
+	tokenID := created.FieldByName("TokenID").Int()
+	token := created.FieldByName("Token").String()
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix), "API tokens should be prefixed")
+
+	stored, err := db.MySQLAPITokenLookup(auth.HashToken(strings.TrimPrefix(token, apiTokenPrefix)))
+	assert.NoError(t, err)
+	assert.Equal(t, tokenID, stored.TokenID)
+	assert.Equal(t, []int64{projectID}, stored.ProjectIDs)
+	assert.False(t, stored.ExpiresAt.IsZero(), "token should expire")
+
+	revoke := *new(userRevokeAPITokenRequest)
+	revoke.setAbstractRequest(&abstractRequest{SenderID: "someoneelse"})
+	revoke.TokenID = tokenID
+	closures, err = revoke.process(db)
+	assert.Equal(t, dbfs.ErrNoDbChange, err, "users should not be able to revoke other users' tokens")
+
+	revoke.SenderID = geneMeta.Username
+	closures, err = revoke.process(db)
+	assert.Nil(t, err)
+	resp = closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response)
+	assert.Equal(t, messages.StatusSuccess, resp.Status, "unexpected response status")
+
+	_, err = db.MySQLAPITokenLookup(auth.HashToken(strings.TrimPrefix(token, apiTokenPrefix)))
+	assert.Equal(t, dbfs.ErrNoData, err)
+}
+
+func TestUserChangeUsernameRequest_Process(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+	db.MySQLUserRegister(notGeneMeta)
+	projectID, _ := db.MySQLProjectCreate("loganga", "renamed")
+	db.AvatarWrite("loganga", []byte("avatar"))
+
+	changeUsername := func(newUsername string) ([]dhClosure, messages.Response, error) {
+		req := userChangeUsernameRequest{NewUsername: newUsername}
+		setBaseFields(&req)
+		req.Resource = "User"
+		req.Method = "ChangeUsername"
+		closures, err := req.process(db)
+		return closures, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response), err
+	}
+
+	_, res, err := changeUsername("gene/logan")
+	assert.Equal(t, errInvalidUsername, err)
+	assert.Equal(t, messages.StatusFail, res.Status)
+
+	_, res, err = changeUsername("NotLoganGA")
+	assert.Equal(t, dbfs.ErrNoDbChange, err, "other users' usernames can't be taken")
+	assert.Equal(t, messages.StatusFail, res.Status)
+
+	defer usernameAliases.forget("loganga", "genelogan")
+	closures, res, err := changeUsername("GeneLogan")
+	require.NoError(t, err)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	assert.NotEmpty(t, reflect.ValueOf(res.Data).FieldByName("Token").String())
+	if assert.Len(t, closures, 2) {
+		subscribe := closures[1].(rabbitCommandClosure)
+		assert.Equal(t, rabbitmq.RabbitUserQueueName("genelogan"), subscribe.Data.(rabbitmq.RabbitQueueData).Key,
+			"the user should be subscribed to notifications for their new username")
+	}
+
+	_, exists := db.Users["loganga"]
+	assert.False(t, exists)
+	assert.Equal(t, geneMeta.Email, db.Users["genelogan"].Email)
+	if assert.Len(t, db.Projects["genelogan"], 1) {
+		assert.Equal(t, projectID, db.Projects["genelogan"][0].ProjectID)
+	}
+	assert.Equal(t, "genelogan", db.Aliases["loganga"])
+	assert.Equal(t, []byte("avatar"), db.Avatars["genelogan"])
+	assert.NotContains(t, db.Avatars, "loganga")
+	assert.Equal(t, "genelogan", usernameAliases.resolve("loganga", db))
+}
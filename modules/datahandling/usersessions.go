@@ -0,0 +1,288 @@
+package datahandling
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Users can list the connections they make authenticated requests on with User.ListSessions, and revoke them with
+ * User.RevokeSession. A connection's session is recorded in MySQL once the user makes an authenticated request on it,
+ * with the device and address it connects from and the server it is on, and its activity at most every
+ * sessionActivityInterval after that. The record is removed when the connection closes, and forgotten if its server
+ * stops without removing it, once the connection has not been touched for SessionResumeWindow.
+ *
+ * Revoking a session sends its connection, on whichever server it is, a command to disconnect, and the session token
+ * it last used is refused from then on, until it expires, so that the client can't reconnect with it; connections
+ * that share the token are refused too. Each server caches whether tokens are revoked for revokedTokenTTL, so a
+ * revoked token may be accepted for that long by servers other than the one that revoked it. Sessions authenticated
+ * with API tokens are disconnected, but their tokens are revoked with User.RevokeAPIToken.
+ */
+
+// sessionActivityInterval is how often a connection's activity is recorded, while the user makes requests on it
+const sessionActivityInterval = time.Minute
+
+// maxDeviceLength is the longest User-Agent recorded as a session's device
+const maxDeviceLength = 255
+
+// revokedTokenTTL is how long whether a session token is revoked is cached
+const revokedTokenTTL = time.Minute
+
+// maxRevokedTokenEntries bounds the cache of revoked tokens; it is emptied when it grows past this
+const maxRevokedTokenEntries = 10000
+
+// sessionActivity tracks when the activity of users on this server's connections was last recorded
+var sessionActivity = &sessionActivityTracker{recorded: make(map[string]sessionActivityEntry)}
+
+type sessionActivityTracker struct {
+	mutex    sync.Mutex
+	recorded map[string]sessionActivityEntry // By session ID and username
+}
+
+type sessionActivityEntry struct {
+	sessionID string
+	tokenHash string
+	at        time.Time
+}
+
+// due returns whether the user's activity on the session should be recorded, because it hasn't been for
+// sessionActivityInterval or they have started using another token, and notes that it is being recorded
+func (tracker *sessionActivityTracker) due(sessionID string, username string, tokenHash string, now time.Time) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	key := sessionID + " " + username
+	entry, ok := tracker.recorded[key]
+	if ok && entry.tokenHash == tokenHash && now.Sub(entry.at) < sessionActivityInterval {
+		return false
+	}
+	tracker.recorded[key] = sessionActivityEntry{sessionID: sessionID, tokenHash: tokenHash, at: now}
+	return true
+}
+
+// forget removes the session's entries, once its connection closes, returning whether any activity was recorded
+func (tracker *sessionActivityTracker) forget(sessionID string) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	recorded := false
+	for key, entry := range tracker.recorded {
+		if entry.sessionID == sessionID {
+			delete(tracker.recorded, key)
+			recorded = true
+		}
+	}
+	return recorded
+}
+
+// sessionTokenHash returns the hash a session token is recorded under; "" for API tokens
+func sessionTokenHash(token string) string {
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		return ""
+	}
+	return auth.HashToken(token)
+}
+
+// recordSessionActivity records that the sender made an authenticated request on the connection. Failures are only
+// logged, since they don't affect the request.
+func (dh DataHandler) recordSessionActivity(req *abstractRequest, db dbfs.DBFS) {
+	if dh.SessionID == "" {
+		return
+	}
+	now := time.Now()
+	hash := sessionTokenHash(req.SenderToken)
+	if !sessionActivity.due(dh.SessionID, req.SenderID, hash, now) {
+		return
+	}
+
+	validity, err := dh.config().ServerConfig.TokenValidityDuration()
+	if err != nil {
+		utils.LogError("Invalid token validity", err, nil)
+	}
+	device := dh.UserAgent
+	if len(device) > maxDeviceLength {
+		device = device[:maxDeviceLength]
+	}
+	// Tokens are not parsed for their expiry; those issued before now expire sooner than a new one would
+	err = db.MySQLUserSessionRecord(dbfs.UserSessionMeta{
+		SessionID:    dh.SessionID,
+		Username:     req.SenderID,
+		WebsocketID:  dh.WebsocketID,
+		InstanceID:   InstanceID,
+		RemoteAddr:   dh.RemoteAddr,
+		Device:       device,
+		TokenHash:    hash,
+		TokenExpires: now.Add(validity),
+	}, now.Add(-SessionResumeWindow))
+	utils.LogError("Failed to record session activity", err, utils.LogFields{
+		"SessionID": dh.SessionID,
+		"Username":  req.SenderID,
+	})
+}
+
+// endSession forgets the connection's session, unless it was revoked, once the connection has closed
+func (dh DataHandler) endSession() {
+	if !sessionActivity.forget(dh.SessionID) {
+		return
+	}
+	err := dh.Db.MySQLUserSessionEnd(dh.SessionID)
+	utils.LogError("Failed to end session", err, utils.LogFields{
+		"SessionID": dh.SessionID,
+	})
+}
+
+// revokedTokens caches whether session tokens are revoked on this server
+var revokedTokens = &revokedTokenCache{entries: make(map[string]revokedTokenEntry)}
+
+type revokedTokenCache struct {
+	mutex   sync.Mutex
+	entries map[string]revokedTokenEntry // By token hash
+}
+
+type revokedTokenEntry struct {
+	revoked bool
+	expires time.Time
+}
+
+// isRevoked returns whether the session token was revoked. Tokens whose revocation can't be checked, such as while
+// MySQL is unavailable, are accepted, as they are while their signature is the only thing checked.
+func (cache *revokedTokenCache) isRevoked(token string, db dbfs.DBFS) bool {
+	hash := sessionTokenHash(token)
+	if hash == "" {
+		return false
+	}
+
+	now := time.Now()
+	cache.mutex.Lock()
+	entry, ok := cache.entries[hash]
+	cache.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.revoked
+	}
+
+	revoked, err := db.MySQLUserSessionTokenRevoked(hash)
+	if err != nil {
+		utils.LogError("Failed to check whether session token is revoked", err, nil)
+		return false
+	}
+	cache.set(hash, revoked, now.Add(revokedTokenTTL))
+	return revoked
+}
+
+// revoke notes that the token with the given hash was revoked by this server, until it expires
+func (cache *revokedTokenCache) revoke(tokenHash string, expires time.Time) {
+	cache.set(tokenHash, true, expires)
+}
+
+func (cache *revokedTokenCache) set(tokenHash string, revoked bool, expires time.Time) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if len(cache.entries) >= maxRevokedTokenEntries {
+		cache.entries = make(map[string]revokedTokenEntry)
+	}
+	cache.entries[tokenHash] = revokedTokenEntry{revoked: revoked, expires: expires}
+}
+
+// userSession is a session in the response to User.ListSessions
+type userSession struct {
+	SessionID   string
+	Device      string // The User-Agent the connection was opened with, if any
+	RemoteAddr  string
+	InstanceID  string // The server the connection is on; see Admin.ListInstances
+	ConnectedAt int64  // Seconds since the Unix epoch
+	LastActive  int64  // Seconds since the Unix epoch
+	Current     bool   // Whether this is the connection the request was made on
+}
+
+// User.ListSessions
+type userListSessionsRequest struct {
+	abstractRequest
+}
+
+func (f *userListSessionsRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userListSessionsRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	sessions, err := db.MySQLUserSessionList(f.SenderID, time.Now().Add(-SessionResumeWindow))
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+
+	listed := make([]userSession, len(sessions))
+	for i, session := range sessions {
+		listed[i] = userSession{
+			SessionID:   session.SessionID,
+			Device:      session.Device,
+			RemoteAddr:  session.RemoteAddr,
+			InstanceID:  session.InstanceID,
+			ConnectedAt: session.ConnectedAt.Unix(),
+			LastActive:  session.LastActive.Unix(),
+			Current:     session.SessionID == f.sessionID,
+		}
+	}
+
+	res := messages.Response{
+		Status: messages.StatusSuccess,
+		Tag:    f.Tag,
+		Data: struct {
+			Sessions []userSession
+		}{
+			Sessions: listed,
+		},
+	}.Wrap()
+	return []dhClosure{toSenderClosure{msg: res}}, nil
+}
+
+// User.RevokeSession
+type userRevokeSessionRequest struct {
+	SessionID string `validate:"required"`
+	abstractRequest
+}
+
+func (f *userRevokeSessionRequest) setAbstractRequest(req *abstractRequest) {
+	f.abstractRequest = *req
+}
+
+func (f userRevokeSessionRequest) process(db dbfs.DBFS) ([]dhClosure, error) {
+	// Sessions whose connections have not been touched for a while are still revoked, since their token may be valid
+	sessions, err := db.MySQLUserSessionList(f.SenderID, time.Unix(0, 0))
+	if err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	var revoked *dbfs.UserSessionMeta
+	for i := range sessions {
+		if sessions[i].SessionID == f.SessionID {
+			revoked = &sessions[i]
+		}
+	}
+	if revoked == nil {
+		return []dhClosure{toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusNotFound, f.Tag)}}, nil
+	}
+
+	if err := db.MySQLUserSessionRevoke(f.SenderID, f.SessionID); err != nil {
+		return []dhClosure{toSenderClosure{msg: dbErrorResponse(err, f.Tag)}}, err
+	}
+	if revoked.TokenHash != "" {
+		revokedTokens.revoke(revoked.TokenHash, revoked.TokenExpires)
+	}
+
+	// The response is sent first, in case the session revoked is the sender's own
+	return []dhClosure{
+		toSenderClosure{msg: messages.NewEmptyResponse(messages.StatusSuccess, f.Tag)},
+		rabbitCommandClosure{
+			Command: "Disconnect",
+			Tag:     -1,
+			Key:     rabbitmq.RabbitWebsocketQueueName(revoked.WebsocketID),
+			Data:    struct{}{},
+		},
+	}, nil
+}
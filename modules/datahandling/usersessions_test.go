@@ -0,0 +1,92 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSessions(t *testing.T) {
+	configSetup(t)
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(geneMeta)
+
+	laptopToken, err := newAuthToken(config.GetConfig(), "loganga")
+	require.NoError(t, err)
+	phoneToken, err := newAuthToken(config.GetConfig(), "loganga")
+	require.NoError(t, err)
+	laptop := DataHandler{WebsocketID: 1, SessionID: NewSessionID(), Db: db, RemoteAddr: "10.0.0.1", UserAgent: "vim"}
+	phone := DataHandler{WebsocketID: 2, SessionID: NewSessionID(), Db: db, RemoteAddr: "10.0.0.2", UserAgent: "phone"}
+	defer laptop.Close()
+	defer phone.Close()
+
+	laptop.recordSessionActivity(&abstractRequest{SenderID: "loganga", SenderToken: laptopToken}, db)
+	phone.recordSessionActivity(&abstractRequest{SenderID: "loganga", SenderToken: phoneToken}, db)
+	db.FunctionCallCount = 0
+	laptop.recordSessionActivity(&abstractRequest{SenderID: "loganga", SenderToken: laptopToken}, db)
+	assert.Equal(t, 0, db.FunctionCallCount, "activity should only be recorded every sessionActivityInterval")
+
+	list := userListSessionsRequest{}
+	setBaseFields(&list)
+	list.sessionID = laptop.SessionID
+	res, _ := processForTest(t, &list, db)
+	require.Equal(t, messages.StatusSuccess, res.Status)
+	sessions := reflect.ValueOf(res.Data).FieldByName("Sessions").Interface().([]userSession)
+	require.Len(t, sessions, 2)
+	for _, session := range sessions {
+		assert.Equal(t, session.SessionID == laptop.SessionID, session.Current)
+		if session.Current {
+			assert.Equal(t, "vim", session.Device)
+			assert.Equal(t, "10.0.0.1", session.RemoteAddr)
+		}
+	}
+
+	revoke := userRevokeSessionRequest{SessionID: phone.SessionID}
+	setBaseFields(&revoke)
+	closures, err := revoke.process(db)
+	require.NoError(t, err)
+	require.Len(t, closures, 2)
+	assert.Equal(t, messages.StatusSuccess, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status)
+	disconnect := closures[1].(rabbitCommandClosure)
+	assert.Equal(t, "Disconnect", disconnect.Command)
+	assert.Equal(t, rabbitmq.RabbitWebsocketQueueName(phone.WebsocketID), disconnect.Key)
+
+	closures, err = revoke.process(db)
+	require.NoError(t, err)
+	assert.Equal(t, messages.StatusNotFound, closures[0].(toSenderClosure).msg.ServerMessage.(messages.Response).Status,
+		"sessions should only be revoked once")
+
+	for _, test := range []struct {
+		token   string
+		revoked bool
+	}{
+		{laptopToken, false},
+		{phoneToken, true},
+	} {
+		req := abstractRequest{
+			Resource:    "User",
+			Method:      "ListSessions",
+			SenderID:    "loganga",
+			SenderToken: test.token,
+			Data:        json.RawMessage(`{}`),
+		}
+		_, err := getFullRequest(&req, db)
+		if test.revoked {
+			assert.Equal(t, ErrAuthenticationFailed, err, "the revoked session's token should be refused")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+
+	// Sessions are forgotten once their connection closes
+	laptop.Close()
+	res, _ = processForTest(t, &list, db)
+	assert.Empty(t, reflect.ValueOf(res.Data).FieldByName("Sessions").Interface())
+}
@@ -0,0 +1,199 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+)
+
+/**
+ * Request data is validated before the request is processed, so that a missing or malformed field is reported to the
+ * client, rather than being processed as its zero value. Fields are checked against the rules in their validate tag,
+ * separated by commas:
+ *
+ *	required	the field must be present and non-zero
+ *	omitempty	the rules that follow are skipped if the field is absent or zero
+ *	min=N		numbers must be at least N; strings, slices and maps must have at least N elements
+ *	max=N		numbers must be at most N; strings, slices and maps must have at most N elements
+ *	oneof=a b	strings must be one of the space-separated values
+ *
+ * Pointer fields, which tell absent values from zero ones, are checked against the value they point to.
+ *
+ * Invalid requests are answered with StatusFail, and a requestValidationError listing every invalid field.
+ */
+
+// fieldError describes why a field of the request data is invalid
+type fieldError struct {
+	Field   string // Empty if the data as a whole is invalid
+	Problem string
+}
+
+// requestValidationError is returned by commonJSON for request data that fails to decode or validate, and is the Data
+// of the response to the request
+type requestValidationError struct {
+	Reason string
+	Fields []fieldError
+}
+
+func (err *requestValidationError) Error() string {
+	problems := make([]string, len(err.Fields))
+	for i, field := range err.Fields {
+		problems[i] = strings.TrimSpace(field.Field + " " + field.Problem)
+	}
+	return err.Reason + ": " + strings.Join(problems, "; ")
+}
+
+// newValidationErrorResponse tells the client which fields of its request were invalid
+func newValidationErrorResponse(tag int64, err *requestValidationError) *messages.ServerMessageWrapper {
+	return messages.Response{
+		Status: messages.StatusFail,
+		Tag:    tag,
+		Data:   err,
+	}.Wrap()
+}
+
+// decodeRequestData unmarshals the request data into req, and validates it. Empty data is treated as an empty object.
+func decodeRequestData(data json.RawMessage, req request) error {
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, req); err != nil {
+			return decodeError(err)
+		}
+	}
+	if fields := validateFields(reflect.ValueOf(req)); len(fields) > 0 {
+		return &requestValidationError{Reason: "Invalid request data", Fields: fields}
+	}
+	return nil
+}
+
+// decodeError describes an error from unmarshalling request data
+func decodeError(err error) *requestValidationError {
+	invalid := &requestValidationError{Reason: "Malformed request data"}
+	switch err := err.(type) {
+	case *json.UnmarshalTypeError:
+		if err.Field == "" {
+			invalid.Fields = []fieldError{{Problem: "must be an object"}}
+		} else {
+			invalid.Fields = []fieldError{{Field: err.Field, Problem: "must be " + describeType(err.Type)}}
+		}
+	default:
+		invalid.Fields = []fieldError{{Problem: "is not valid JSON"}}
+	}
+	return invalid
+}
+
+// describeType names a type as it appears in JSON
+func describeType(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("an integer of at most %d bits", typ.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("a non-negative integer of at most %d bits", typ.Bits())
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return "a base64-encoded string"
+		}
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// validateFields checks the exported fields of the struct v points to against their validate tags
+func validateFields(v reflect.Value) []fieldError {
+	v = reflect.Indirect(v)
+	typ := v.Type()
+	fields := []fieldError{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		rules := field.Tag.Get("validate")
+		if rules == "" || field.PkgPath != "" {
+			continue
+		}
+		for _, rule := range strings.Split(rules, ",") {
+			if rule == "omitempty" {
+				if isZero(v.Field(i)) {
+					break
+				}
+				continue
+			}
+			if problem := checkRule(reflect.Indirect(v.Field(i)), rule); problem != "" {
+				fields = append(fields, fieldError{Field: field.Name, Problem: problem})
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// checkRule returns the problem with the value if it breaks the rule, or "" if it does not
+func checkRule(value reflect.Value, rule string) string {
+	name, arg := rule, ""
+	if i := strings.Index(rule, "="); i >= 0 {
+		name, arg = rule[:i], rule[i+1:]
+	}
+
+	switch name {
+	case "required":
+		if isZero(value) {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			panic("invalid validate rule " + rule)
+		}
+		size, unit := measure(value)
+		if name == "min" && size < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if name == "max" && size > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	default:
+		panic("unknown validate rule " + rule)
+	}
+	return ""
+}
+
+// isZero returns true if the value is its type's zero value, or an empty slice or map
+func isZero(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Invalid:
+		// What a nil pointer points to
+		return true
+	case reflect.Slice, reflect.Map, reflect.String:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+// measure returns the value of a number, or the length of anything else, with the unit the length is counted in
+func measure(value reflect.Value) (int64, string) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), ""
+	case reflect.String:
+		return int64(value.Len()), " bytes long"
+	default:
+		return int64(value.Len()), " items"
+	}
+}
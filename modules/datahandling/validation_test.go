@@ -0,0 +1,71 @@
+package datahandling
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommonJSON_Validation(t *testing.T) {
+	tests := []struct {
+		desc   string
+		req    request
+		data   string
+		fields []fieldError
+	}{
+		{"Valid", new(projectRenameRequest), `{"ProjectID": 3, "NewName": "new"}`, nil},
+		{"Missing fields", new(projectRenameRequest), `{}`, []fieldError{
+			{Field: "ProjectID", Problem: "is required"},
+			{Field: "NewName", Problem: "is required"},
+		}},
+		{"Wrong type", new(projectRenameRequest), `{"ProjectID": "3", "NewName": "new"}`, []fieldError{
+			{Field: "ProjectID", Problem: "must be an integer of at most 64 bits"},
+		}},
+		{"Out of range", new(projectGrantPermissionsRequest), `{"ProjectID": 3, "GrantUsername": "a", "PermissionLevel": 1000}`, []fieldError{
+			{Field: "PermissionLevel", Problem: "must be an integer of at most 8 bits"},
+		}},
+		{"Not an object", new(projectRenameRequest), `[]`, []fieldError{{Problem: "must be an object"}}},
+		{"Not JSON", new(projectRenameRequest), `{"ProjectID": 3`, []fieldError{{Problem: "is not valid JSON"}}},
+		{"Below minimum", new(projectSearchRequest), `{"ProjectID": 3, "Query": "a", "MaxResults": -1}`, []fieldError{
+			{Field: "MaxResults", Problem: "must be at least 0"},
+		}},
+		{"Not one of", new(userCreateAPITokenRequest), `{"Name": "ci", "Scope": "owner"}`, []fieldError{
+			{Field: "Scope", Problem: "must be one of read, write, admin"},
+		}},
+		{"Optional field absent", new(filePullRequest), `{"FileID": 1}`, nil},
+		{"Optional field not one of", new(filePullRequest), `{"FileID": 1, "LineEndings": "CR"}`, []fieldError{
+			{Field: "LineEndings", Problem: "must be one of LF, CRLF"},
+		}},
+		{"Optional pointer absent", new(projectUpdateSettingsRequest), `{"ProjectID": 1}`, nil},
+		{"Optional pointer not one of", new(projectUpdateSettingsRequest), `{"ProjectID": 1, "LineEndings": "CR"}`, []fieldError{
+			{Field: "LineEndings", Problem: "must be one of Preserve, LF"},
+		}},
+		{"No data", new(userProjectsRequest), ``, nil},
+	}
+
+	for _, test := range tests {
+		_, err := commonJSON(test.req, &abstractRequest{Data: json.RawMessage(test.data)})
+		if test.fields == nil {
+			assert.NoError(t, err, test.desc)
+			continue
+		}
+		require.IsType(t, &requestValidationError{}, err, test.desc)
+		assert.Equal(t, test.fields, err.(*requestValidationError).Fields, test.desc)
+	}
+}
+
+func TestCommonJSON_EnvelopeNotOverwritten(t *testing.T) {
+	absReq := &abstractRequest{
+		Tag:      7,
+		SenderID: "loganga",
+		Data:     json.RawMessage(`{"ProjectID": 3, "NewName": "new", "SenderID": "admin", "Tag": 1}`),
+	}
+	req, err := commonJSON(new(projectRenameRequest), absReq)
+	require.NoError(t, err)
+
+	rename := req.(*projectRenameRequest)
+	assert.Equal(t, "loganga", rename.SenderID)
+	assert.Equal(t, int64(7), rename.Tag)
+}
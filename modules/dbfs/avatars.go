@@ -0,0 +1,73 @@
+package dbfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * Users' avatars are stored as file contents are (see contents.go), so they are encrypted and deduplicated as
+ * configured, one per user:
+ *
+ *   <ProjectPath>/_avatars/<Username>
+ *
+ * The hash of each user's current avatar is recorded in MySQL with MySQLUserSetAvatar.
+ */
+
+// avatarDirName is the directory avatars are kept in, alongside the project directories
+const avatarDirName = "_avatars"
+
+// avatarPath returns where the user's avatar is kept
+func avatarPath(cfg *config.Config, username string) (string, error) {
+	if username == "" || strings.Contains(username, filePathSeparator) || strings.HasPrefix(username, ".") {
+		return "", ErrMaliciousRequest
+	}
+	return filepath.Join(cfg.ServerConfig.ProjectPath, avatarDirName, username), nil
+}
+
+// AvatarWrite stores the user's avatar, replacing any previous one, and returns the SHA-256 of the image
+func (di *DatabaseImpl) AvatarWrite(username string, raw []byte) (string, error) {
+	location, err := avatarPath(di.config(), username)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(location), 0744); err != nil {
+		return "", err
+	}
+	if err := writeContents(di.config(), location, raw); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AvatarRead returns the user's avatar. Returns ErrNoData if they have none
+func (di *DatabaseImpl) AvatarRead(username string) ([]byte, error) {
+	location, err := avatarPath(di.config(), username)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := readContents(di.config(), location)
+	if os.IsNotExist(err) {
+		return nil, ErrNoData
+	}
+	return raw, err
+}
+
+// AvatarDelete removes the user's avatar, if they have one
+func (di *DatabaseImpl) AvatarDelete(username string) error {
+	location, err := avatarPath(di.config(), username)
+	if err != nil {
+		return err
+	}
+	err = removeContents(di.config(), location)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package dbfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvatarStorage(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(dedup bool) {
+		serverCfg.DeduplicateFiles = dedup
+	}(serverCfg.DeduplicateFiles)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+	serverCfg.DeduplicateFiles = true
+
+	di := new(DatabaseImpl)
+	_, err := di.AvatarRead("loganga")
+	assert.Equal(t, ErrNoData, err)
+
+	hash, err := di.AvatarWrite("loganga", []byte("first"))
+	require.NoError(t, err)
+	assert.Equal(t, "a7937b64b8caa58f03721bb6bacf5c78cb235febe0e70b1b84cd99541461a08e", hash)
+	_, err = di.AvatarWrite("loganga", []byte("second"))
+	require.NoError(t, err)
+	raw, err := di.AvatarRead("loganga")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(raw))
+	assert.Len(t, listBlobs(t, serverCfg.ProjectPath), 1, "replaced avatars should be released")
+
+	require.NoError(t, di.AvatarDelete("loganga"))
+	require.NoError(t, di.AvatarDelete("loganga"))
+	_, err = di.AvatarRead("loganga")
+	assert.Equal(t, ErrNoData, err)
+	assert.Empty(t, listBlobs(t, serverCfg.ProjectPath))
+
+	_, err = di.AvatarWrite("../loganga", []byte("first"))
+	assert.Equal(t, ErrMaliciousRequest, err)
+}
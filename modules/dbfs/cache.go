@@ -0,0 +1,372 @@
+package dbfs
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * A read-through cache of MySQLFileGetInfo, MySQLUserProjectPermissionLookup and MySQLProjectGetArchiveState, which
+ * every File.Change calls. Files' entries are dropped when they are moved, renamed or deleted, users' permissions when
+ * they are granted or revoked, and projects' archive states when they are archived or unarchived. Changes that could affect many entries, such as to teams, or deleting a project or user, drop every entry,
+ * by moving to the next generation: entries' keys include the generation, so those of earlier generations are never
+ * read again, and expire. Hits and misses are exported through expvar, under "metadatacache".
+ */
+
+// defaultMaxCacheEntries is the most entries the in-memory cache keeps, if not configured
+const defaultMaxCacheEntries = 100000
+
+// cacheGenerationRefresh is how often the generation is reread from a shared cache, so that servers see each other's
+// invalidations of every entry
+const cacheGenerationRefresh = time.Second
+
+const cacheGenerationKey = "cc:generation"
+
+var cacheMetrics = expvar.NewMap("metadatacache")
+
+// cacheStore is where cache entries are kept. Errors are treated as misses.
+type cacheStore interface {
+	get(key string) ([]byte, bool, error)
+	set(key string, value []byte, ttl time.Duration) error
+	del(key string) error
+	// incr increments the counter at key, which never expires, and returns its new value
+	incr(key string) (int64, error)
+}
+
+type metadataCache struct {
+	store cacheStore
+	ttl   time.Duration
+
+	mutex        sync.Mutex
+	generation   int64
+	generationAt time.Time // When generation was last read from the store
+}
+
+// newMetadataCache creates the cache described by the config, or returns nil if it is disabled
+func newMetadataCache(cfg config.MetadataCacheCfg, redisCfg config.ConnCfg) (*metadataCache, error) {
+	if cfg.Disabled {
+		return nil, nil
+	}
+	ttl, err := cfg.TTLDuration()
+	if err != nil {
+		return nil, err
+	}
+
+	var store cacheStore
+	switch cfg.Backend {
+	case "", "memory":
+		maxEntries := cfg.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultMaxCacheEntries
+		}
+		store = newMemoryCacheStore(maxEntries)
+	case "redis":
+		store = newRedisCacheStore(redisCfg)
+	default:
+		return nil, fmt.Errorf("Unknown metadata cache backend %q", cfg.Backend)
+	}
+	return &metadataCache{store: store, ttl: ttl}, nil
+}
+
+// metadataCache returns the connections' cache, creating it the first time it is used; nil if it is disabled
+func (di *DatabaseImpl) metadataCache() *metadataCache {
+	di = di.root()
+	di.cacheOnce.Do(func() {
+		cache, err := newMetadataCache(di.config().ServerConfig.MetadataCache, di.config().ConnectionConfig["Redis"])
+		utils.LogError("Invalid metadata cache configuration; caching is disabled", err, nil)
+		di.cache = cache
+	})
+	return di.cache
+}
+
+// currentGeneration returns the generation entries are read and written in
+func (c *metadataCache) currentGeneration() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if time.Since(c.generationAt) < cacheGenerationRefresh {
+		return c.generation
+	}
+	value, ok, err := c.store.get(cacheGenerationKey)
+	if err != nil {
+		// Without the generation, entries written in it can't be trusted; this one won't have any
+		return -1
+	}
+	generation := int64(0)
+	if ok {
+		generation, _ = strconv.ParseInt(string(value), 10, 64)
+	}
+	c.generation, c.generationAt = generation, time.Now()
+	return generation
+}
+
+func (c *metadataCache) key(format string, args ...interface{}) (string, bool) {
+	generation := c.currentGeneration()
+	if generation < 0 {
+		return "", false
+	}
+	return fmt.Sprintf("cc:%d:", generation) + fmt.Sprintf(format, args...), true
+}
+
+func (c *metadataCache) get(key string, ok bool) ([]byte, bool) {
+	if c == nil || !ok {
+		return nil, false
+	}
+	value, hit, err := c.store.get(key)
+	if err != nil {
+		utils.LogWarn("Failed to read from metadata cache", utils.LogFields{
+			"Key":   key,
+			"error": err.Error(),
+		})
+	}
+	if hit {
+		cacheMetrics.Add("Hits", 1)
+	} else {
+		cacheMetrics.Add("Misses", 1)
+	}
+	return value, hit
+}
+
+func (c *metadataCache) set(key string, ok bool, value []byte) {
+	if c == nil || !ok {
+		return
+	}
+	if err := c.store.set(key, value, c.ttl); err != nil {
+		utils.LogWarn("Failed to write to metadata cache", utils.LogFields{
+			"Key":   key,
+			"error": err.Error(),
+		})
+	}
+}
+
+func (c *metadataCache) forget(key string, ok bool) {
+	if c == nil {
+		return
+	}
+	if !ok {
+		// The entry may be in the generation that could not be read
+		c.forgetAll()
+		return
+	}
+	if err := c.store.del(key); err != nil {
+		utils.LogError("Failed to drop metadata cache entry; dropping every entry", err, utils.LogFields{
+			"Key": key,
+		})
+		c.forgetAll()
+	}
+}
+
+// forgetAll drops every entry, by moving to the next generation
+func (c *metadataCache) forgetAll() {
+	if c == nil {
+		return
+	}
+	generation, err := c.store.incr(cacheGenerationKey)
+	utils.LogError("Failed to drop metadata cache entries", err, nil)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err == nil {
+		c.generation, c.generationAt = generation, time.Now()
+	} else {
+		// Reread the generation the next time it is needed, in case another server moved on
+		c.generationAt = time.Time{}
+	}
+}
+
+func (c *metadataCache) fileKey(fileID int64) (string, bool) {
+	return c.key("file:%d", fileID)
+}
+
+func (c *metadataCache) permissionKey(projectID int64, username string) (string, bool) {
+	return c.key("permission:%d:%s", projectID, username)
+}
+
+func (c *metadataCache) archiveStateKey(projectID int64) (string, bool) {
+	return c.key("archive:%d", projectID)
+}
+
+func (c *metadataCache) fileMeta(fileID int64) (FileMeta, bool) {
+	var file FileMeta
+	if c == nil {
+		return file, false
+	}
+	value, ok := c.get(c.fileKey(fileID))
+	if !ok || json.Unmarshal(value, &file) != nil {
+		return file, false
+	}
+	return file, true
+}
+
+func (c *metadataCache) setFileMeta(file FileMeta) {
+	if c == nil {
+		return
+	}
+	value, err := json.Marshal(file)
+	if err != nil {
+		return
+	}
+	key, ok := c.fileKey(file.FileID)
+	c.set(key, ok, value)
+}
+
+func (c *metadataCache) forgetFileMeta(fileID int64) {
+	if c == nil {
+		return
+	}
+	key, ok := c.fileKey(fileID)
+	c.forget(key, ok)
+}
+
+func (c *metadataCache) permission(projectID int64, username string) (int8, bool) {
+	if c == nil {
+		return 0, false
+	}
+	value, ok := c.get(c.permissionKey(projectID, username))
+	if !ok {
+		return 0, false
+	}
+	permission, err := strconv.ParseInt(string(value), 10, 8)
+	return int8(permission), err == nil
+}
+
+func (c *metadataCache) setPermission(projectID int64, username string, permission int8) {
+	if c == nil {
+		return
+	}
+	key, ok := c.permissionKey(projectID, username)
+	c.set(key, ok, []byte(strconv.Itoa(int(permission))))
+}
+
+func (c *metadataCache) forgetPermission(projectID int64, username string) {
+	if c == nil {
+		return
+	}
+	key, ok := c.permissionKey(projectID, username)
+	c.forget(key, ok)
+}
+
+func (c *metadataCache) archiveState(projectID int64) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	value, ok := c.get(c.archiveStateKey(projectID))
+	return string(value), ok
+}
+
+func (c *metadataCache) setArchiveState(projectID int64, state string) {
+	if c == nil {
+		return
+	}
+	key, ok := c.archiveStateKey(projectID)
+	c.set(key, ok, []byte(state))
+}
+
+func (c *metadataCache) forgetArchiveState(projectID int64) {
+	if c == nil {
+		return
+	}
+	key, ok := c.archiveStateKey(projectID)
+	c.forget(key, ok)
+}
+
+// staleness returns how long other servers may go on reading an entry this one dropped: until it expires, if each
+// server has its own cache, or not at all, if they share one
+func (c *metadataCache) staleness() time.Duration {
+	if c == nil {
+		return 0
+	}
+	if _, ok := c.store.(*memoryCacheStore); ok {
+		return c.ttl
+	}
+	return 0
+}
+
+// memoryCacheStore keeps entries in this server's memory. Once it is full, expired entries are dropped, and if that
+// isn't enough, every entry is.
+type memoryCacheStore struct {
+	mutex      sync.Mutex
+	entries    map[string]memoryCacheEntry
+	maxEntries int
+}
+
+type memoryCacheEntry struct {
+	value   []byte
+	expires time.Time // Zero for entries that never expire
+}
+
+func newMemoryCacheStore(maxEntries int) *memoryCacheStore {
+	return &memoryCacheStore{
+		entries:    make(map[string]memoryCacheEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+func (store *memoryCacheStore) get(key string) ([]byte, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	entry, ok := store.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		delete(store.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (store *memoryCacheStore) set(key string, value []byte, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.entries[key]; !ok && len(store.entries) >= store.maxEntries {
+		store.evict()
+	}
+	store.entries[key] = memoryCacheEntry{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// evict makes room for an entry; the mutex must be held
+func (store *memoryCacheStore) evict() {
+	now := time.Now()
+	for key, entry := range store.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(store.entries, key)
+		}
+	}
+	if len(store.entries) < store.maxEntries {
+		return
+	}
+	for key, entry := range store.entries {
+		if !entry.expires.IsZero() {
+			delete(store.entries, key)
+		}
+	}
+}
+
+func (store *memoryCacheStore) del(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.entries, key)
+	return nil
+}
+
+func (store *memoryCacheStore) incr(key string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	value, _ := strconv.ParseInt(string(store.entries[key].value), 10, 64)
+	value++
+	store.entries[key] = memoryCacheEntry{value: []byte(strconv.FormatInt(value, 10))}
+	return value, nil
+}
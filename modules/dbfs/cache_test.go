@@ -0,0 +1,185 @@
+package dbfs
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataCache(t *testing.T) {
+	cache, err := newMetadataCache(config.MetadataCacheCfg{}, config.ConnCfg{})
+	require.NoError(t, err)
+
+	file := FileMeta{FileID: 4, ProjectID: 2, Filename: "a.go", RelativePath: "src", Creator: "loganga"}
+	_, ok := cache.fileMeta(file.FileID)
+	assert.False(t, ok)
+	cache.setFileMeta(file)
+	cached, ok := cache.fileMeta(file.FileID)
+	assert.True(t, ok)
+	assert.Equal(t, file, cached)
+	cache.forgetFileMeta(file.FileID)
+	_, ok = cache.fileMeta(file.FileID)
+	assert.False(t, ok, "the file should have been dropped")
+
+	cache.setPermission(2, "loganga", 10)
+	permission, ok := cache.permission(2, "loganga")
+	assert.True(t, ok)
+	assert.EqualValues(t, 10, permission)
+	_, ok = cache.permission(2, "gene")
+	assert.False(t, ok)
+
+	cache.setArchiveState(2, "")
+	state, ok := cache.archiveState(2)
+	assert.True(t, ok, "live projects should be cached too")
+	assert.Equal(t, "", state)
+	cache.forgetArchiveState(2)
+	_, ok = cache.archiveState(2)
+	assert.False(t, ok, "the archive state should have been dropped")
+	cache.setArchiveState(2, "archived")
+
+	cache.setFileMeta(file)
+	cache.forgetAll()
+	_, ok = cache.archiveState(2)
+	assert.False(t, ok, "every entry should have been dropped")
+	_, ok = cache.permission(2, "loganga")
+	assert.False(t, ok, "every entry should have been dropped")
+	_, ok = cache.fileMeta(file.FileID)
+	assert.False(t, ok, "every entry should have been dropped")
+
+	assert.Equal(t, 10*time.Second, cache.staleness(), "servers with their own caches may read dropped entries until they expire")
+
+	cache, err = newMetadataCache(config.MetadataCacheCfg{Disabled: true}, config.ConnCfg{})
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+	cache.setFileMeta(file)
+	_, ok = cache.fileMeta(file.FileID)
+	assert.False(t, ok, "a disabled cache should never hit")
+
+	_, err = newMetadataCache(config.MetadataCacheCfg{Backend: "memcached"}, config.ConnCfg{})
+	assert.Error(t, err)
+}
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := newMemoryCacheStore(2)
+	require.NoError(t, store.set("a", []byte("1"), time.Hour))
+	require.NoError(t, store.set("b", []byte("2"), -time.Second))
+	require.NoError(t, store.set("c", []byte("3"), time.Hour))
+	_, ok, _ := store.get("b")
+	assert.False(t, ok, "expired entries should be evicted first")
+	value, ok, _ := store.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+
+	require.NoError(t, store.set("d", []byte("4"), time.Hour))
+	assert.Len(t, store.entries, 1, "once no entry has expired, every entry should be evicted")
+
+	generation, err := store.incr(cacheGenerationKey)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, generation)
+	generation, _ = store.incr(cacheGenerationKey)
+	assert.EqualValues(t, 2, generation)
+}
+
+// fakeRedis answers GET, SET, DEL and INCR, ignoring expiry, and AUTH with the given password
+func fakeRedis(t *testing.T, password string) (net.Listener, uint16) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var mutex sync.Mutex
+	values := map[string]string{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, n)
+					for i := range args {
+						line, _ = reader.ReadString('\n')
+						size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+						arg := make([]byte, size+2)
+						io.ReadFull(reader, arg)
+						args[i] = string(arg[:size])
+					}
+
+					mutex.Lock()
+					var reply string
+					switch args[0] {
+					case "AUTH":
+						if args[len(args)-1] == password {
+							reply = "+OK\r\n"
+						} else {
+							reply = "-WRONGPASS invalid password\r\n"
+						}
+					case "GET":
+						if value, ok := values[args[1]]; ok {
+							reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+						} else {
+							reply = "$-1\r\n"
+						}
+					case "SET":
+						values[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case "DEL":
+						delete(values, args[1])
+						reply = ":1\r\n"
+					case "INCR":
+						n, _ := strconv.ParseInt(values[args[1]], 10, 64)
+						values[args[1]] = strconv.FormatInt(n+1, 10)
+						reply = ":" + values[args[1]] + "\r\n"
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mutex.Unlock()
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+
+	return listener, uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestRedisCacheStore(t *testing.T) {
+	listener, port := fakeRedis(t, "hunter2")
+	defer listener.Close()
+	store := newRedisCacheStore(config.ConnCfg{Host: "127.0.0.1", Port: port, Password: "hunter2"})
+
+	_, ok, err := store.get("a")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, store.set("a", []byte("one\r\ntwo"), time.Minute))
+	value, ok, err := store.get("a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "one\r\ntwo", string(value))
+	require.NoError(t, store.del("a"))
+	_, ok, _ = store.get("a")
+	assert.False(t, ok)
+
+	generation, err := store.incr(cacheGenerationKey)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, generation)
+
+	wrong := newRedisCacheStore(config.ConnCfg{Host: "127.0.0.1", Port: port, Password: "password"})
+	_, _, err = wrong.get("a")
+	assert.Error(t, err, "the connection should be refused with the wrong password")
+}
@@ -0,0 +1,149 @@
+package dbfs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/couchbase/gocb"
+)
+
+/**
+ * A circuit breaker around Couchbase, so that an outage fails requests immediately rather than making each wait for
+ * the full timeout. After BreakerThreshold consecutive connection failures or timeouts, operations fail with
+ * ErrCouchbaseUnavailable. Every couchbaseRetryInterval, one operation is let through to test the connection, and
+ * the health checks started by StartCouchbaseHealthChecks probe it as well; the first success closes the breaker.
+ */
+
+// ErrCouchbaseUnavailable is returned, without contacting Couchbase, while Couchbase is failing
+var ErrCouchbaseUnavailable = newError(CategoryUnavailable, true, "Couchbase is unavailable")
+
+// defaultBreakerThreshold is the number of consecutive failures that open the breaker, if not configured
+const defaultBreakerThreshold = 5
+
+// couchbaseRetryInterval is how long the breaker stays open before Couchbase is tried again
+var couchbaseRetryInterval = 10 * time.Second
+
+// couchbaseHealthCheckKey is read by health checks; it need not exist, since a miss still means Couchbase answered
+const couchbaseHealthCheckKey = "_healthcheck"
+
+type circuitBreaker struct {
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func breakerThreshold(cfg *config.Config) int {
+	threshold := int(cfg.ConnectionConfig["Couchbase"].BreakerThreshold)
+	if threshold <= 0 {
+		return defaultBreakerThreshold
+	}
+	return threshold
+}
+
+// allow returns false if operations should fail fast. Once the breaker has been open for couchbaseRetryInterval,
+// one operation is allowed through per interval to test the connection.
+func (b *circuitBreaker) allow(threshold int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < threshold {
+		return true
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(couchbaseRetryInterval)
+	return true
+}
+
+// record updates the breaker with the result of an operation
+func (b *circuitBreaker) record(err error, threshold int) {
+	if isCouchbaseUnavailableErr(err) {
+		b.failure(err, threshold)
+	} else {
+		b.success(threshold)
+	}
+}
+
+func (b *circuitBreaker) success(threshold int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures >= threshold {
+		utils.LogInfo("Couchbase: connection recovered, closing circuit breaker", nil)
+	}
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure(err error, threshold int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.failures++
+	if b.failures == threshold {
+		utils.LogWarn("Couchbase: failing, opening circuit breaker", utils.LogFields{
+			"Failures":   b.failures,
+			"RetryAfter": couchbaseRetryInterval.String(),
+			"LastError":  err.Error(),
+		})
+	}
+	if b.failures >= threshold {
+		b.openUntil = time.Now().Add(couchbaseRetryInterval)
+	}
+}
+
+// isCouchbaseUnavailableErr returns true for errors meaning Couchbase could not be reached, rather than that it
+// refused the operation
+func isCouchbaseUnavailableErr(err error) bool {
+	switch err {
+	case gocb.ErrTimeout, gocb.ErrNetwork, gocb.ErrOverload:
+		return true
+	}
+	return false
+}
+
+// cbResult records the result of a Couchbase operation with the circuit breaker, and returns it
+func (di *DatabaseImpl) cbResult(err error) error {
+	di.root().couchbaseBreaker.record(err, breakerThreshold(di.config()))
+	return err
+}
+
+// cbTimedResult is cbResult for an operation on the document that started at the given time, logging it if it was slow
+func (di *DatabaseImpl) cbTimedResult(operation string, key string, started time.Time, err error) error {
+	logSlowCouchbase(di.context(), di.config(), operation, key, started)
+	return di.cbResult(err)
+}
+
+// StartCouchbaseHealthChecks probes Couchbase every couchbaseRetryInterval until told to exit, reconnecting if the
+// connection was lost
+func (di *DatabaseImpl) StartCouchbaseHealthChecks(control *utils.Control) {
+	go func() {
+		ticker := time.NewTicker(couchbaseRetryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-control.Exit:
+				return
+			case <-ticker.C:
+				di.probeCouchbase()
+			}
+		}
+	}()
+}
+
+// probeCouchbase checks that Couchbase answers, bypassing the circuit breaker
+func (di *DatabaseImpl) probeCouchbase() error {
+	cb, err := di.connectCouchbase()
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	_, err = cb.bucket.Get(couchbaseHealthCheckKey, &value)
+	if err == gocb.ErrKeyNotFound {
+		err = nil
+	}
+	return di.cbResult(err)
+}
@@ -0,0 +1,83 @@
+package dbfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/couchbase/gocb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	testConfigSetup(t)
+	defer func(interval time.Duration) {
+		couchbaseRetryInterval = interval
+	}(couchbaseRetryInterval)
+	couchbaseRetryInterval = 50 * time.Millisecond
+
+	di := new(DatabaseImpl)
+	breaker := &di.couchbaseBreaker
+
+	// Errors from Couchbase itself don't count
+	for i := 0; i < defaultBreakerThreshold; i++ {
+		di.cbResult(gocb.ErrKeyNotFound)
+	}
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+
+	for i := 0; i < defaultBreakerThreshold-1; i++ {
+		di.cbResult(gocb.ErrTimeout)
+	}
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+	di.cbResult(gocb.ErrTimeout)
+	assert.False(t, breaker.allow(defaultBreakerThreshold), "breaker should open after consecutive timeouts")
+
+	_, err := di.openCouchBase()
+	assert.Equal(t, ErrCouchbaseUnavailable, err)
+
+	// After the retry interval, a single operation is let through to test the connection
+	time.Sleep(couchbaseRetryInterval)
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+	assert.False(t, breaker.allow(defaultBreakerThreshold))
+
+	// Failing again keeps it open for another interval
+	di.cbResult(gocb.ErrNetwork)
+	assert.False(t, breaker.allow(defaultBreakerThreshold))
+	time.Sleep(couchbaseRetryInterval)
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+
+	di.cbResult(nil)
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+	assert.True(t, breaker.allow(defaultBreakerThreshold))
+}
+
+func TestCircuitBreaker_Threshold(t *testing.T) {
+	testConfigSetup(t)
+	cfg := *config.GetConfig()
+	cfg.ConnectionConfig = map[string]config.ConnCfg{"Couchbase": {BreakerThreshold: 1}}
+
+	// The threshold is that of the DatabaseImpl's own config
+	di := NewDatabaseImpl(&cfg)
+	di.cbResult(gocb.ErrTimeout)
+	_, err := di.openCouchBase()
+	assert.Equal(t, ErrCouchbaseUnavailable, err)
+
+	breaker := new(circuitBreaker)
+	breaker.failure(errors.New("could not connect"), breakerThreshold(&cfg))
+	assert.False(t, breaker.allow(breakerThreshold(&cfg)))
+}
+
+func TestCouchbaseConnString(t *testing.T) {
+	assert.Equal(t, "couchbase://localhost:11210", couchbaseConnString(config.ConnCfg{
+		Host: "couchbase://localhost",
+		Port: 11210,
+	}))
+	assert.Equal(t, "couchbases://db:11207?certpath=%2Fetc%2Fca.pem&kv_pool_size=4", couchbaseConnString(config.ConnCfg{
+		Host:      "db",
+		Port:      11207,
+		UseTLS:    true,
+		TLSCAFile: "/etc/ca.pem",
+		PoolSize:  4,
+	}))
+}
@@ -0,0 +1,187 @@
+package dbfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/couchbase/gocb"
+)
+
+/**
+ * Cold storage of the files of archived projects. Archiving a file applies all of its changes, moves its contents out
+ * of the project directory, and removes its Couchbase document, so that dormant projects take no space in Couchbase or
+ * the blob store. Archived files are kept, encrypted if configured, in ColdStoragePath:
+ *
+ *   <ColdStoragePath>/<ProjectID>/<FileID>        the contents
+ *   <ColdStoragePath>/<ProjectID>/<FileID>.json   the file's version, and the checksum of its contents
+ *
+ * Files are kept by ID rather than by path, since archived files can't be moved. The .json file is written last when
+ * archiving, and removed first when unarchiving, so a file is archived exactly when it exists. Archiving and
+ * unarchiving can be repeated, so that one that was interrupted is finished by trying again.
+ */
+
+// coldStorageDirName is the default cold storage directory, alongside the project directories
+const coldStorageDirName = "_archive"
+
+// coldFileInfo is the contents of an archived file's .json file
+type coldFileInfo struct {
+	Version  int64
+	Checksum string // The SHA-256 of the contents, before encryption
+}
+
+// coldStoragePath returns where the file's contents are kept while it is archived
+func coldStoragePath(cfg *config.Config, meta FileMeta) string {
+	serverCfg := cfg.ServerConfig
+	dir := serverCfg.ColdStoragePath
+	if dir == "" {
+		dir = filepath.Join(serverCfg.ProjectPath, coldStorageDirName)
+	}
+	return filepath.Join(dir, strconv.FormatInt(meta.ProjectID, 10), strconv.FormatInt(meta.FileID, 10))
+}
+
+// readColdInfo returns the info of the file archived at the location, or ErrNoData if it isn't archived
+func readColdInfo(location string) (coldFileInfo, error) {
+	info := coldFileInfo{}
+	raw, err := ioutil.ReadFile(location + ".json")
+	if os.IsNotExist(err) {
+		return info, ErrNoData
+	} else if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(raw, &info)
+	return info, err
+}
+
+// readColdContents returns the contents of the file archived at the location, checked against their checksum
+func readColdContents(cfg *config.Config, location string, info coldFileInfo) ([]byte, error) {
+	stored, err := ioutil.ReadFile(location)
+	if os.IsNotExist(err) {
+		return nil, ErrFileMissing
+	} else if err != nil {
+		return nil, err
+	}
+	raw, err := decryptContents(cfg, stored)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	if hex.EncodeToString(sum[:]) != info.Checksum {
+		return nil, ErrChecksumMismatch
+	}
+	return raw, nil
+}
+
+// FileArchive moves the file, with all of its changes applied, to cold storage, and removes its Couchbase document.
+// The file must not be changed meanwhile, such as by making its project read-only first.
+func (di *DatabaseImpl) FileArchive(meta FileMeta) error {
+	location := coldStoragePath(di.config(), meta)
+	if _, err := readColdInfo(location); err == ErrNoData {
+		if err := di.writeColdFile(meta, location); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// The file is archived; what remains frees the space it took
+	if err := di.CBDeleteFile(meta.FileID); err != nil && err != gocb.ErrKeyNotFound && err != ErrResourceNotFound {
+		return err
+	}
+	if err := di.FileDelete(meta.RelativePath, meta.Filename, meta.ProjectID); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := di.deleteSwp(meta.RelativePath, meta.Filename, meta.ProjectID); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeColdFile writes the file's current contents and version to cold storage
+func (di *DatabaseImpl) writeColdFile(meta FileMeta, location string) error {
+	// A scrunch in progress is left to finish, and no other is started, so that no changes are taken from the
+	// document while it is read
+	lock, err := di.MySQLLockAcquire(scrunchLockName(meta.FileID), time.Duration(ScrunchingExpiryLength)*time.Second)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	rawFile, changes, err := di.PullFile(meta)
+	if err != nil {
+		return err
+	}
+	contents := string(*rawFile)
+	if len(changes) > 0 {
+		contents, err = patching.PatchTextFromString(contents, changes)
+		if err != nil {
+			return err
+		}
+	}
+	version, err := di.CBGetFileVersion(meta.FileID)
+	if err != nil {
+		return err
+	}
+
+	stored, err := encryptContents(di.config(), []byte(contents))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(location), 0744); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(location, stored, 0744); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(contents))
+	info, err := json.Marshal(coldFileInfo{Version: version, Checksum: hex.EncodeToString(sum[:])})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(location+".json", info, 0744)
+}
+
+// FileUnarchive moves the file back from cold storage, and recreates its Couchbase document with the version it was
+// archived at. Files that aren't archived are left as they are.
+func (di *DatabaseImpl) FileUnarchive(meta FileMeta) error {
+	location := coldStoragePath(di.config(), meta)
+	info, err := readColdInfo(location)
+	if err == ErrNoData {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	raw, err := readColdContents(di.config(), location, info)
+	if err != nil {
+		return err
+	}
+
+	if _, err := di.FileWrite(meta.RelativePath, meta.Filename, meta.ProjectID, raw); err != nil {
+		return err
+	}
+	// A document left by an interrupted unarchive has no changes, since archived files can't be changed
+	if err := di.CBDeleteFile(meta.FileID); err != nil && err != gocb.ErrKeyNotFound && err != ErrResourceNotFound {
+		return err
+	}
+	if err := di.CBInsertNewFile(meta.FileID, info.Version, []string{}); err != nil {
+		return err
+	}
+
+	if err := os.Remove(location + ".json"); err != nil {
+		return err
+	}
+	if err := os.Remove(location); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Removed once the project's last file is unarchived
+	os.Remove(filepath.Dir(location))
+	return nil
+}
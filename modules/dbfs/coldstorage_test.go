@@ -0,0 +1,53 @@
+package dbfs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseImpl_FileArchive(t *testing.T) {
+	di, file := setupFile(t, defaultBaseFile, defaultChanges)
+
+	defer os.RemoveAll(config.GetConfig().ServerConfig.ProjectPath)
+	defer di.CBDeleteFile(file.FileID)
+
+	version, err := di.CBGetFileVersion(file.FileID)
+	require.NoError(t, err)
+
+	require.NoError(t, di.FileArchive(file))
+	_, err = di.CBGetFileVersion(file.FileID)
+	assert.Error(t, err, "the Couchbase document should be removed")
+	_, err = di.FileRead(file.RelativePath, file.Filename, file.ProjectID)
+	assert.True(t, os.IsNotExist(err), "the file should be moved out of the project")
+	assert.NoError(t, di.FileVerify(file), "archived files should be verified in cold storage")
+	require.NoError(t, di.FileArchive(file), "archiving again should do nothing")
+
+	// Corruption in cold storage is detected
+	location := coldStoragePath(config.GetConfig(), file)
+	stored, err := ioutil.ReadFile(location)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(location, []byte("corrupt"), 0744))
+	assert.Error(t, di.FileVerify(file))
+	assert.Error(t, di.FileUnarchive(file))
+	require.NoError(t, ioutil.WriteFile(location, stored, 0744))
+
+	require.NoError(t, di.FileUnarchive(file))
+	fileBytes, changes, err := di.PullFile(file)
+	require.NoError(t, err)
+	assert.Empty(t, changes, "every change should have been applied when archiving")
+	expected, err := patching.PatchTextFromString(defaultBaseFile, defaultChanges)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(*fileBytes))
+	unarchivedVersion, err := di.CBGetFileVersion(file.FileID)
+	require.NoError(t, err)
+	assert.Equal(t, version, unarchivedVersion)
+	_, err = os.Stat(location)
+	assert.True(t, os.IsNotExist(err), "the file should be removed from cold storage")
+	assert.NoError(t, di.FileUnarchive(file), "unarchiving a live file should do nothing")
+}
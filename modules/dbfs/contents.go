@@ -0,0 +1,381 @@
+package dbfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * Storage of file contents on disk. Contents are encrypted if configured (see encryption.go), and, if
+ * ServerConfig.DeduplicateFiles is set, stored once per distinct content in a blob directory:
+ *
+ *   <ProjectPath>/_blobs/ab/cd/<sha256>        the contents, where the hash begins "abcd"
+ *   <ProjectPath>/_blobs/ab/cd/<sha256>.refs   the number of files referring to them
+ *
+ * Blobs are fanned out by the start of their hash so that no one directory holds every distinct file. Blobs stored
+ * directly in _blobs, as they were before, are moved into place by MigrateBlobLayout, or as they are used.
+ *
+ * Each file's usual path then holds a pointer to its blob, rather than its contents, so files are still found by
+ * project, path and name. Blobs are removed once no file refers to them. Files written before deduplication was
+ * enabled, and pointers written while it was, remain readable whichever way it is configured.
+ *
+ * Contents that look like a pointer are never taken for one: they are stored escaped (see encryption.go), and a
+ * pointer is only followed if the file's checksum is the hash it points to, which is never the case for contents that
+ * merely look like one, such as those stored before they were escaped.
+ *
+ * The SHA-256 of every file's contents is kept at the same relative path under <ProjectPath>/_checksums, so that
+ * corruption can be detected; see FileVerify.
+ */
+
+// blobPointerPrefix begins files that point to a blob, followed by the blob's hash
+var blobPointerPrefix = []byte("CCBLOB1:")
+
+// blobDirName is the directory of the blob store, alongside the project directories, which are named by ID
+const blobDirName = "_blobs"
+
+// checksumDirName is the directory the checksums of files are kept in, alongside the project directories
+const checksumDirName = "_checksums"
+
+// ErrChecksumMismatch is returned when a file's contents do not match its checksum
+var ErrChecksumMismatch = newError(CategoryCorrupt, false, "File contents do not match their checksum")
+
+// ErrFileMissing is returned when a file, or the blob it points to, is not on disk
+var ErrFileMissing = newError(CategoryCorrupt, false, "File is missing from disk")
+
+// blobMutex serializes updates to blob reference counts
+var blobMutex sync.Mutex
+
+func blobDir(cfg *config.Config) string {
+	return filepath.Join(cfg.ServerConfig.ProjectPath, blobDirName)
+}
+
+// blobPath returns where the blob with the given hash is kept
+func blobPath(cfg *config.Config, hash string) string {
+	return filepath.Join(blobDir(cfg), hash[0:2], hash[2:4], hash)
+}
+
+// isBlobHash returns true if the name is the hash of a blob
+func isBlobHash(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// migrateFlatBlob moves the blob with the given hash to its place in the fan-out, if it is still stored directly in
+// the blob directory. Must be called with blobMutex held.
+func migrateFlatBlob(cfg *config.Config, hash string) (bool, error) {
+	flatPath := filepath.Join(blobDir(cfg), hash)
+	if _, err := os.Stat(flatPath); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	newPath := blobPath(cfg, hash)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0744); err != nil {
+		return false, err
+	}
+	// The contents are moved last, so that an interrupted move is finished the next time
+	if err := os.Rename(flatPath+".refs", newPath+".refs"); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if err := os.Rename(flatPath, newPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MigrateBlobLayout moves the blobs stored directly in the blob directory into the fan-out, returning the number moved
+func MigrateBlobLayout(cfg *config.Config) (int, error) {
+	blobMutex.Lock()
+	defer blobMutex.Unlock()
+
+	infos, err := ioutil.ReadDir(blobDir(cfg))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, info := range infos {
+		hash := strings.TrimSuffix(info.Name(), ".refs")
+		if info.IsDir() || !isBlobHash(hash) {
+			continue
+		}
+		moved, err := migrateFlatBlob(cfg, hash)
+		if err != nil {
+			return migrated, err
+		}
+		if moved {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// blobPointer returns the hash of the blob that the stored file points to, if it is a pointer
+func blobPointer(stored []byte) (string, bool) {
+	if !bytes.HasPrefix(stored, blobPointerPrefix) || len(stored) != len(blobPointerPrefix)+sha256.Size*2 {
+		return "", false
+	}
+	hash := string(stored[len(blobPointerPrefix):])
+	if !isBlobHash(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+// storedBlobPointer returns the hash of the blob that the file stored at the location points to, if it is a pointer.
+// Pointers are written with the blob's hash as the file's checksum; pointers written before checksums were kept have
+// none.
+func storedBlobPointer(cfg *config.Config, location string, stored []byte) (string, bool) {
+	hash, ok := blobPointer(stored)
+	if !ok {
+		return "", false
+	}
+	sumPath, err := checksumPath(cfg, location)
+	if err != nil {
+		return "", false
+	}
+	sum, err := ioutil.ReadFile(sumPath)
+	if os.IsNotExist(err) {
+		return hash, true
+	}
+	return hash, err == nil && strings.TrimSpace(string(sum)) == hash
+}
+
+// checksumPath returns where the checksum of the file at the location is kept
+func checksumPath(cfg *config.Config, location string) (string, error) {
+	projectPath := cfg.ServerConfig.ProjectPath
+	rel, err := filepath.Rel(projectPath, location)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(projectPath, checksumDirName, rel), nil
+}
+
+// writeContents stores the contents at the location, replacing whatever was there
+func writeContents(cfg *config.Config, location string, raw []byte) error {
+	sum := sha256.Sum256(raw)
+	hash := hex.EncodeToString(sum[:])
+
+	if !cfg.ServerConfig.DeduplicateFiles {
+		contents, err := encryptContents(cfg, raw)
+		if err != nil {
+			return err
+		}
+		if err := replaceContents(cfg, location, contents); err != nil {
+			return err
+		}
+		return writeChecksum(cfg, location, hash)
+	}
+
+	if err := acquireBlob(cfg, hash, raw); err != nil {
+		return err
+	}
+	if err := replaceContents(cfg, location, append(append([]byte{}, blobPointerPrefix...), hash...)); err != nil {
+		releaseBlob(cfg, hash)
+		return err
+	}
+	return writeChecksum(cfg, location, hash)
+}
+
+// writeChecksum records the checksum of the file at the location
+func writeChecksum(cfg *config.Config, location string, hash string) error {
+	sumPath, err := checksumPath(cfg, location)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sumPath), 0744); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sumPath, []byte(hash), 0744)
+}
+
+// replaceContents writes the stored form of a file, releasing the blob the previous one pointed to, if any
+func replaceContents(cfg *config.Config, location string, stored []byte) error {
+	previous, err := ioutil.ReadFile(location)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := ioutil.WriteFile(location, stored, 0744); err != nil {
+		return err
+	}
+	if hash, ok := storedBlobPointer(cfg, location, previous); ok {
+		return releaseBlob(cfg, hash)
+	}
+	return nil
+}
+
+// readContents returns the contents stored at the location
+func readContents(cfg *config.Config, location string) ([]byte, error) {
+	stored, err := ioutil.ReadFile(location)
+	if err != nil {
+		return stored, err
+	}
+	if hash, ok := storedBlobPointer(cfg, location, stored); ok {
+		stored, err = ioutil.ReadFile(blobPath(cfg, hash))
+		if os.IsNotExist(err) {
+			blobMutex.Lock()
+			_, err = migrateFlatBlob(cfg, hash)
+			blobMutex.Unlock()
+			if err == nil {
+				stored, err = ioutil.ReadFile(blobPath(cfg, hash))
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decryptContents(cfg, stored)
+}
+
+// removeContents removes the file at the location, releasing its blob, if it has one
+func removeContents(cfg *config.Config, location string) error {
+	stored, err := ioutil.ReadFile(location)
+	if err != nil {
+		return err
+	}
+	hash, isPointer := storedBlobPointer(cfg, location, stored)
+	if err := os.Remove(location); err != nil {
+		return err
+	}
+	if sumPath, err := checksumPath(cfg, location); err == nil {
+		os.Remove(sumPath)
+	}
+	if isPointer {
+		return releaseBlob(cfg, hash)
+	}
+	return nil
+}
+
+// moveContents moves the file at src to dst, with its checksum
+func moveContents(cfg *config.Config, src string, dst string) error {
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	srcSum, err := checksumPath(cfg, src)
+	if err != nil {
+		return err
+	}
+	dstSum, err := checksumPath(cfg, dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstSum), 0744); err != nil {
+		return err
+	}
+	if err := os.Rename(srcSum, dstSum); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// verifyContents checks the contents stored at the location against their checksum. Files written before checksums
+// were kept are only checked to be readable.
+func verifyContents(cfg *config.Config, location string) error {
+	raw, err := readContents(cfg, location)
+	if os.IsNotExist(err) {
+		return ErrFileMissing
+	} else if err != nil {
+		return err
+	}
+	sumPath, err := checksumPath(cfg, location)
+	if err != nil {
+		return err
+	}
+	expected, err := ioutil.ReadFile(sumPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(raw)
+	if hex.EncodeToString(sum[:]) != strings.TrimSpace(string(expected)) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// copyContents stores the contents of the file at src at dst as well
+func copyContents(cfg *config.Config, src string, dst string) error {
+	raw, err := readContents(cfg, src)
+	if err != nil {
+		return err
+	}
+	return writeContents(cfg, dst, raw)
+}
+
+// acquireBlob adds a reference to the blob with the given hash, storing its contents if it is new
+func acquireBlob(cfg *config.Config, hash string, raw []byte) error {
+	blobMutex.Lock()
+	defer blobMutex.Unlock()
+
+	path := blobPath(cfg, hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0744); err != nil {
+		return err
+	}
+	refs, err := blobRefs(cfg, hash)
+	if err != nil {
+		return err
+	}
+	if refs == 0 {
+		contents, err := encryptContents(cfg, raw)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, contents, 0744); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path+".refs", []byte(strconv.Itoa(refs+1)), 0744)
+}
+
+// releaseBlob removes a reference to the blob with the given hash, deleting it if it was the last
+func releaseBlob(cfg *config.Config, hash string) error {
+	blobMutex.Lock()
+	defer blobMutex.Unlock()
+
+	refs, err := blobRefs(cfg, hash)
+	if err != nil {
+		return err
+	}
+	path := blobPath(cfg, hash)
+	if refs <= 1 {
+		if err := os.Remove(path + ".refs"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return ioutil.WriteFile(path+".refs", []byte(strconv.Itoa(refs-1)), 0744)
+}
+
+// blobRefs returns the number of references to the blob, or 0 if it does not exist. Must be called with blobMutex
+// held.
+func blobRefs(cfg *config.Config, hash string) (int, error) {
+	if _, err := migrateFlatBlob(cfg, hash); err != nil {
+		return 0, err
+	}
+	refs, err := ioutil.ReadFile(blobPath(cfg, hash) + ".refs")
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(refs)))
+}
@@ -0,0 +1,234 @@
+package dbfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileDeduplication(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(dedup bool) {
+		serverCfg.DeduplicateFiles = dedup
+	}(serverCfg.DeduplicateFiles)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+
+	di := new(DatabaseImpl)
+	lockfile := []byte("left-pad 1.3.0\n")
+
+	// Files written before deduplication was enabled stay readable
+	serverCfg.DeduplicateFiles = false
+	_, err := di.FileWrite(".", "old.lock", 1, lockfile)
+	require.NoError(t, err)
+
+	serverCfg.DeduplicateFiles = true
+	_, err = di.FileWrite(".", "yarn.lock", 1, lockfile)
+	require.NoError(t, err)
+	_, err = di.FileWrite("vendor", "yarn.lock", 2, lockfile)
+	require.NoError(t, err)
+	_, err = di.FileWrite(".", "other.txt", 2, []byte("other"))
+	require.NoError(t, err)
+
+	blobs := func() []string {
+		return listBlobs(t, serverCfg.ProjectPath)
+	}
+	assert.Len(t, blobs(), 2, "identical contents should be stored once")
+
+	for _, file := range []struct {
+		relpath   string
+		filename  string
+		projectID int64
+	}{{".", "old.lock", 1}, {".", "yarn.lock", 1}, {"vendor", "yarn.lock", 2}} {
+		read, err := di.FileRead(file.relpath, file.filename, file.projectID)
+		require.NoError(t, err)
+		assert.Equal(t, lockfile, *read)
+	}
+
+	// Moving a file keeps its reference; changing one copy leaves the other unchanged
+	require.NoError(t, di.FileMove("vendor", "yarn.lock", ".", "yarn.lock", 2))
+	_, err = di.FileWrite(".", "yarn.lock", 1, []byte("left-pad 1.3.1\n"))
+	require.NoError(t, err)
+	read, err := di.FileRead(".", "yarn.lock", 2)
+	require.NoError(t, err)
+	assert.Equal(t, lockfile, *read)
+	assert.Len(t, blobs(), 3)
+
+	// Swapping in a scrunched file releases the old contents
+	require.NoError(t, di.FileWriteToSwap(FileMeta{RelativePath: ".", Filename: "yarn.lock", ProjectID: 2}, []byte("swapped")))
+	require.NoError(t, di.swapSwp(".", "yarn.lock", 2))
+	require.NoError(t, di.deleteSwp(".", "yarn.lock", 2))
+	assert.Len(t, blobs(), 3, "the unused lockfile blob should have been replaced by the swapped contents")
+
+	// Blobs are deleted with their last reference
+	require.NoError(t, di.FileDelete(".", "yarn.lock", 1))
+	require.NoError(t, di.FileDelete(".", "yarn.lock", 2))
+	require.NoError(t, di.FileDelete(".", "other.txt", 2))
+	assert.Empty(t, blobs())
+}
+
+func TestFileDeduplication_PointerLikeContents(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(dedup bool) {
+		serverCfg.DeduplicateFiles = dedup
+	}(serverCfg.DeduplicateFiles)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+
+	di := new(DatabaseImpl)
+	secret := []byte("another project's secret\n")
+	sum := sha256.Sum256(secret)
+	pointer := []byte("CCBLOB1:" + hex.EncodeToString(sum[:]))
+
+	serverCfg.DeduplicateFiles = true
+	_, err := di.FileWrite(".", "secret.txt", 1, secret)
+	require.NoError(t, err)
+
+	// With deduplication disabled, a file whose contents are exactly a pointer to the other project's blob is read as
+	// written, and writing or deleting it leaves the blob alone
+	serverCfg.DeduplicateFiles = false
+	_, err = di.FileWrite(".", "pointer.txt", 2, pointer)
+	require.NoError(t, err)
+	read, err := di.FileRead(".", "pointer.txt", 2)
+	require.NoError(t, err)
+	assert.Equal(t, pointer, *read)
+	_, err = di.FileWrite(".", "pointer.txt", 2, []byte("overwritten"))
+	require.NoError(t, err)
+	_, err = di.FileWrite(".", "pointer.txt", 2, pointer)
+	require.NoError(t, err)
+	require.NoError(t, di.FileDelete(".", "pointer.txt", 2))
+
+	read, err = di.FileRead(".", "secret.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, secret, *read)
+	assert.Len(t, listBlobs(t, serverCfg.ProjectPath), 1)
+
+	// Nor are such contents followed if they were stored unescaped, before they were escaped, as their checksum is of
+	// their own text
+	loc, err := di.FileWrite(".", "legacy.txt", 2, []byte("placeholder"))
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(loc, pointer, 0744))
+	pointerSum := sha256.Sum256(pointer)
+	require.NoError(t, writeChecksum(config.GetConfig(), loc, hex.EncodeToString(pointerSum[:])))
+	read, err = di.FileRead(".", "legacy.txt", 2)
+	require.NoError(t, err)
+	assert.Equal(t, pointer, *read)
+	require.NoError(t, di.FileDelete(".", "legacy.txt", 2))
+	read, err = di.FileRead(".", "secret.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, secret, *read)
+}
+
+// listBlobs returns the paths of the blobs in the blob store, relative to it
+func listBlobs(t *testing.T, projectPath string) []string {
+	dir := filepath.Join(projectPath, blobDirName)
+	names := []string{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && filepath.Ext(path) != ".refs" {
+			rel, _ := filepath.Rel(dir, path)
+			names = append(names, rel)
+		}
+		return nil
+	})
+	return names
+}
+
+func TestMigrateBlobLayout(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(dedup bool) {
+		serverCfg.DeduplicateFiles = dedup
+	}(serverCfg.DeduplicateFiles)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+	serverCfg.DeduplicateFiles = true
+
+	di := new(DatabaseImpl)
+	_, err := di.FileWrite(".", "a.txt", 1, []byte("a"))
+	require.NoError(t, err)
+	_, err = di.FileWrite(".", "b.txt", 1, []byte("b"))
+	require.NoError(t, err)
+	_, err = di.FileWrite(".", "b2.txt", 1, []byte("b"))
+	require.NoError(t, err)
+
+	blobs := listBlobs(t, serverCfg.ProjectPath)
+	require.Len(t, blobs, 2)
+	for _, blob := range blobs {
+		hash := filepath.Base(blob)
+		assert.Equal(t, filepath.Join(hash[0:2], hash[2:4], hash), blob)
+	}
+
+	// Move the blobs back to where they were kept before they were fanned out
+	dir := filepath.Join(serverCfg.ProjectPath, blobDirName)
+	for _, blob := range blobs {
+		require.NoError(t, os.Rename(filepath.Join(dir, blob), filepath.Join(dir, filepath.Base(blob))))
+		require.NoError(t, os.Rename(filepath.Join(dir, blob+".refs"), filepath.Join(dir, filepath.Base(blob)+".refs")))
+	}
+
+	// Flat blobs are found, and moved, as they are used
+	read, err := di.FileRead(".", "a.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a"), *read)
+	sum := sha256.Sum256([]byte("a"))
+	aHash := hex.EncodeToString(sum[:])
+	assert.Contains(t, listBlobs(t, serverCfg.ProjectPath), filepath.Join(aHash[0:2], aHash[2:4], aHash))
+
+	migrated, err := MigrateBlobLayout(config.GetConfig())
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	assert.Equal(t, blobs, listBlobs(t, serverCfg.ProjectPath))
+
+	// Reference counts were moved with them
+	require.NoError(t, di.FileDelete(".", "b.txt", 1))
+	read, err = di.FileRead(".", "b2.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("b"), *read)
+	require.NoError(t, di.FileDelete(".", "b2.txt", 1))
+	require.NoError(t, di.FileDelete(".", "a.txt", 1))
+	assert.Empty(t, listBlobs(t, serverCfg.ProjectPath))
+}
+
+func TestFileIntegrity(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer os.RemoveAll(serverCfg.ProjectPath)
+
+	di := new(DatabaseImpl)
+	meta := FileMeta{RelativePath: "src", Filename: "main.go", ProjectID: 3}
+	loc, err := di.FileWrite(meta.RelativePath, meta.Filename, meta.ProjectID, []byte("package main\n"))
+	require.NoError(t, err)
+	assert.NoError(t, di.FileVerify(meta))
+
+	// Checksums follow the file when it is moved
+	require.NoError(t, di.FileMove("src", "main.go", "cmd", "main.go", 3))
+	meta.RelativePath = "cmd"
+	assert.NoError(t, di.FileVerify(meta))
+	loc = filepath.Join(filepath.Dir(filepath.Dir(loc)), "cmd", "main.go")
+
+	require.NoError(t, ioutil.WriteFile(loc, []byte("package mian\n"), 0744))
+	assert.Equal(t, ErrChecksumMismatch, di.FileVerify(meta))
+
+	// Without a swap file, corrupt files can't be repaired
+	assert.Equal(t, ErrNoData, di.FileRestoreFromSwap(meta))
+
+	require.NoError(t, di.FileWriteToSwap(meta, []byte("package main\n")))
+	require.NoError(t, di.FileRestoreFromSwap(meta))
+	assert.NoError(t, di.FileVerify(meta))
+
+	require.NoError(t, os.Remove(loc))
+	assert.Equal(t, ErrFileMissing, di.FileVerify(meta))
+
+	// Files written before checksums were kept are only checked to be readable
+	legacy, err := di.FileWrite(".", "legacy.txt", 3, []byte("old"))
+	require.NoError(t, err)
+	sumPath, err := checksumPath(config.GetConfig(), legacy)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(sumPath))
+	assert.NoError(t, di.FileVerify(FileMeta{RelativePath: ".", Filename: "legacy.txt", ProjectID: 3}))
+}
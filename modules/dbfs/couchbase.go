@@ -1,10 +1,13 @@
 package dbfs
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 	"math"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/patching"
@@ -29,30 +32,47 @@ type cbFile struct {
 	PullSwp          bool     `json:"pullswp"`
 }
 
+// openCouchBase returns the Couchbase connection, connecting if necessary. Returns ErrCouchbaseUnavailable while the
+// circuit breaker is open.
 func (di *DatabaseImpl) openCouchBase() (*couchbaseConn, error) {
+	// The Couchbase client can't abandon operations once they are sent, so they are only checked before they start
+	if err := di.context().Err(); err != nil {
+		return nil, err
+	}
+	di = di.root()
+
+	if !di.couchbaseBreaker.allow(breakerThreshold(di.config())) {
+		return nil, ErrCouchbaseUnavailable
+	}
+	cb, err := di.connectCouchbase()
+	return cb, classify(err, CategoryUnavailable, true)
+}
+
+func (di *DatabaseImpl) connectCouchbase() (*couchbaseConn, error) {
+	di = di.root()
+	di.couchbaseMutex.Lock()
+	defer di.couchbaseMutex.Unlock()
+
 	if di.couchbaseDB != nil && di.couchbaseDB.bucket != nil {
 		return di.couchbaseDB, nil
 	}
 
 	if di.couchbaseDB == nil || di.couchbaseDB.config == (config.ConnCfg{}) {
 		di.couchbaseDB = new(couchbaseConn)
-		configMap := config.GetConfig()
+		configMap := di.config()
 		di.couchbaseDB.config = configMap.ConnectionConfig["Couchbase"]
 	}
 
 	var documentsCluster *gocb.Cluster
 	var err error
 
-	if strings.HasPrefix(di.couchbaseDB.config.Host, "couchbase://") {
-		documentsCluster, err = gocb.Connect(di.couchbaseDB.config.Host + ":" + strconv.Itoa(int(di.couchbaseDB.config.Port)))
-	} else {
-		documentsCluster, err = gocb.Connect("couchbase://" + di.couchbaseDB.config.Host + ":" + strconv.Itoa(int(di.couchbaseDB.config.Port)))
-	}
+	documentsCluster, err = gocb.Connect(couchbaseConnString(di.couchbaseDB.config))
 
 	if err != nil {
 		utils.LogError("Couchbase: could not connect to couchbase", err, utils.LogFields{
 			"Host": di.couchbaseDB.config.Host,
 		})
+		di.couchbaseBreaker.failure(err, breakerThreshold(di.config()))
 		return di.couchbaseDB, err
 	}
 
@@ -60,8 +80,16 @@ func (di *DatabaseImpl) openCouchBase() (*couchbaseConn, error) {
 		di.couchbaseDB.config.Schema = "documents"
 	}
 
-	schemaBucket, err := documentsCluster.OpenBucket(di.couchbaseDB.config.Schema, di.couchbaseDB.config.Password)
+	password, err := di.couchbaseDB.config.ResolvePassword()
+	if err != nil {
+		utils.LogError("Couchbase: could not resolve password", err, nil)
+		return di.couchbaseDB, err
+	}
+
+	schemaBucket, err := documentsCluster.OpenBucket(di.couchbaseDB.config.Schema, password)
 	if err != nil {
+		di.couchbaseBreaker.failure(err, breakerThreshold(di.config()))
+		di.couchbaseDB.config.InvalidatePassword()
 		utils.LogError("Couchbase: could not open bucket", err, utils.LogFields{
 			"Host":   di.couchbaseDB.config.Host,
 			"Bucket": di.couchbaseDB.config.Schema,
@@ -72,8 +100,10 @@ func (di *DatabaseImpl) openCouchBase() (*couchbaseConn, error) {
 
 	// need to use 2nd bucket b/c couchbase has document expiry, not key expiry
 	locksBucketName := di.couchbaseDB.config.Schema + "_scrunching_locks"
-	slBucket, err := documentsCluster.OpenBucket(locksBucketName, di.couchbaseDB.config.Password)
+	slBucket, err := documentsCluster.OpenBucket(locksBucketName, password)
 	if err != nil {
+		di.couchbaseBreaker.failure(err, breakerThreshold(di.config()))
+		di.couchbaseDB.config.InvalidatePassword()
 		utils.LogError("Couchbase: could not open bucket", err, utils.LogFields{
 			"Host":   di.couchbaseDB.config.Host,
 			"Bucket": locksBucketName,
@@ -85,9 +115,40 @@ func (di *DatabaseImpl) openCouchBase() (*couchbaseConn, error) {
 	return di.couchbaseDB, nil
 }
 
+// couchbaseConnString builds the connection string for the given config, using couchbases:// if TLS is enabled.
+// gocb only supports verifying the server against a CA file; client certificates are not supported.
+func couchbaseConnString(cfg config.ConnCfg) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(cfg.Host, "couchbase://"), "couchbases://")
+	connString := "couchbase://" + host + ":" + strconv.Itoa(int(cfg.Port))
+	options := []string{}
+
+	if cfg.UseTLS {
+		connString = "couchbases://" + host + ":" + strconv.Itoa(int(cfg.Port))
+		if cfg.TLSCAFile != "" {
+			options = append(options, "certpath="+url.QueryEscape(cfg.TLSCAFile))
+		}
+		if cfg.TLSCertFile != "" || cfg.TLSSkipVerify {
+			utils.LogWarn("Couchbase: client certificates and TLSSkipVerify are not supported; ignoring", utils.LogFields{
+				"Host": cfg.Host,
+			})
+		}
+	}
+	if cfg.PoolSize > 0 {
+		options = append(options, "kv_pool_size="+strconv.Itoa(cfg.PoolSize))
+	}
+	if len(options) > 0 {
+		connString += "?" + strings.Join(options, "&")
+	}
+	return connString
+}
+
 // CloseCouchbase closes the CouchBase db connection
 // YOU PROBABLY DON'T NEED TO RUN THIS EVER
 func (di *DatabaseImpl) CloseCouchbase() error {
+	di = di.root()
+	di.couchbaseMutex.Lock()
+	defer di.couchbaseMutex.Unlock()
+
 	if di.couchbaseDB != nil && di.couchbaseDB.bucket != nil {
 		di.couchbaseDB.bucket.Close()
 		di.couchbaseDB = nil
@@ -106,12 +167,19 @@ func (di *DatabaseImpl) cbInsertNewFile(file cbFile) error {
 		return err
 	}
 
-	_, err = cb.bucket.Insert(strconv.FormatInt(file.FileID, 10), file, 0)
-	return err
+	key := strconv.FormatInt(file.FileID, 10)
+	started := time.Now()
+	_, err = cb.bucket.Insert(key, file, 0)
+	return di.cbTimedResult("Insert", key, started, err)
 }
 
 // CBInsertNewFile inserts a new document with the given arguments
 func (di *DatabaseImpl) CBInsertNewFile(fileID int64, version int64, changes []string) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBInsertNewFile(fileID, version, changes)
+	}
 	return di.cbInsertNewFile(cbFile{
 		FileID:           fileID,
 		Version:          version,
@@ -125,23 +193,119 @@ func (di *DatabaseImpl) CBInsertNewFile(fileID int64, version int64, changes []s
 
 // CBDeleteFile deletes the document with FileID == fileID from couchbase
 func (di *DatabaseImpl) CBDeleteFile(fileID int64) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBDeleteFile(fileID)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return err
+	}
+	key := strconv.FormatInt(fileID, 10)
+	started := time.Now()
+	_, err = cb.bucket.Remove(key, 0)
+	return di.cbTimedResult("Remove", key, started, err)
+}
+
+// cbBulkBatchSize is the most operations sent to couchbase in one batch
+const cbBulkBatchSize = 128
+
+// cbDo sends the operations to couchbase in batches, so that each batch takes a single round-trip. The result of each
+// operation is left in its Err.
+func (di *DatabaseImpl) cbDo(ops []gocb.BulkOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return err
 	}
-	_, err = cb.bucket.Remove(strconv.FormatInt(fileID, 10), 0)
-	return err
+	for start := 0; start < len(ops); start += cbBulkBatchSize {
+		end := start + cbBulkBatchSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+		started := time.Now()
+		if err := di.cbTimedResult("Do", "", started, cb.bucket.Do(ops[start:end])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CBInsertNewFiles inserts a new document with no changes at the given version for each of the fileIDs
+func (di *DatabaseImpl) CBInsertNewFiles(fileIDs []int64, version int64) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBInsertNewFiles(fileIDs, version)
+	}
+	ops := make([]gocb.BulkOp, len(fileIDs))
+	for i, fileID := range fileIDs {
+		ops[i] = &gocb.InsertOp{
+			Key: strconv.FormatInt(fileID, 10),
+			Value: cbFile{
+				FileID:           fileID,
+				Version:          version,
+				Changes:          []string{},
+				UseTemp:          false,
+				TempChanges:      []string{},
+				PullSwp:          false,
+				RemainingChanges: []string{},
+			},
+		}
+	}
+	if err := di.cbDo(ops); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := op.(*gocb.InsertOp).Err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CBDeleteFiles deletes the documents of each of the fileIDs from couchbase. Files without a document, such as archived
+// ones, are skipped.
+func (di *DatabaseImpl) CBDeleteFiles(fileIDs []int64) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBDeleteFiles(fileIDs)
+	}
+	ops := make([]gocb.BulkOp, len(fileIDs))
+	for i, fileID := range fileIDs {
+		ops[i] = &gocb.RemoveOp{Key: strconv.FormatInt(fileID, 10)}
+	}
+	if err := di.cbDo(ops); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if err := op.(*gocb.RemoveOp).Err; err != nil && err != gocb.ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
 }
 
 // CBGetFileVersion returns the current version of the file for the given FileID
 func (di *DatabaseImpl) CBGetFileVersion(fileID int64) (int64, error) {
+	if store, err := di.documentStore(); err != nil {
+		return -1, err
+	} else if store != nil {
+		return store.CBGetFileVersion(fileID)
+	}
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return -1, err
 	}
 
-	frag, err := cb.bucket.LookupIn(strconv.FormatInt(fileID, 10)).Get("version").Execute()
-	if err != nil {
+	key := strconv.FormatInt(fileID, 10)
+	started := time.Now()
+	frag, err := cb.bucket.LookupIn(key).Get("version").Execute()
+	if di.cbTimedResult("LookupIn", key, started, err) != nil {
 		return -1, err
 	}
 
@@ -154,35 +318,16 @@ func (di *DatabaseImpl) CBGetFileVersion(fileID int64) (int64, error) {
 	return version, err
 }
 
-// CBAppendFileChange mutates the file document with the new change and sets the new version number
-// Returns the new version number, the missing patches, the total count of patches tracked, and an error, if any.
-func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (string, int64, []string, int, error) {
-	cb, err := di.openCouchBase()
-	if err != nil {
-		return "", -1, nil, 0, err
-	}
-
-	// optimistic locking operation
-	// check the version is accurate and get the object's cas,
-	// then use it in the MutateIn call to verify the document hasn't updated underneath us
-	prevChangeStrs, cas, version, useTemp, err := di.PullChanges(fileMeta)
-	if err != nil {
-		return "", -1, nil, 0, err
-	}
-
+// transformChange transforms the change against the patches made since its base version, given the document's
+// changes and version. Returns the transformed change, based on the document's version, and the patches it was
+// transformed against, as they were stored.
+func transformChange(prevChangeStrs []string, version int64, patchStr string) (*patching.Patch, []string, error) {
 	prevChanges, err := patching.GetPatches(prevChangeStrs)
 	if err != nil {
 		utils.LogError("Failed to parse previous changes into patch objects", err, utils.LogFields{
 			"PrevChanges": prevChangeStrs,
 		})
-		return "", -1, nil, 0, err
-	}
-
-	if cas == uint64(0) {
-		utils.LogWarn("Couchbase returned a CAS value of 0, optimistic locking is unavailable", utils.LogFields{
-			"cas":  cas,
-			"File": fileMeta,
-		})
+		return nil, nil, err
 	}
 
 	minVersion := version
@@ -192,7 +337,7 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 			utils.LogError("Failed to parse first patch", err, utils.LogFields{
 				"PatchStr": prevChangeStrs[0],
 			})
-			return "", -1, nil, 0, ErrInternalServerError
+			return nil, nil, ErrInternalServerError
 		}
 
 		// Allow transform-patches to start on the same base version as the head (after linearization, we have all the necessary patches)
@@ -205,7 +350,7 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 	// Build patch, transform changes against newer changes.
 	change, err := patching.NewPatchFromString(patchStr)
 	if err != nil {
-		return "", -1, nil, 0, errors.New("Failed to parse patch")
+		return nil, nil, &Error{Category: CategoryInvalid, Message: "Failed to parse patch", Cause: err}
 	}
 
 	// For every patch, calculate the patches that it does not have.
@@ -229,14 +374,14 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 	if change.BaseVersion > version {
 		// check to make sure the patch is being applied to the most recent revision
 		utils.LogError("BaseVersion too high", ErrVersionOutOfDate, nil)
-		return "", -1, nil, 0, ErrVersionOutOfDate
+		return nil, nil, ErrVersionOutOfDate
 	} else if change.BaseVersion == version {
 		// If we are building on the server's base version, don't need to transform.
 		startIndex = int64(len(prevChangeStrs))
 	} else if change.BaseVersion < minVersion {
 		// if it's less than the minVersion, we've scrunched.
 		utils.LogError("BaseVersion less than minVersion", ErrVersionOutOfDate, nil)
-		return "", -1, nil, 0, ErrVersionOutOfDate
+		return nil, nil, ErrVersionOutOfDate
 	} else if change.BaseVersion == minVersion {
 		// If it's equal to the minVersion, we use the entire array
 		startIndex = int64(0)
@@ -250,7 +395,7 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 					"PatchStr":   strings.Replace(prevChangeStrs[startIndex], "\n", "\\n", -1),
 					"StartIndex": startIndex,
 				})
-				return "", -1, nil, 0, ErrInternalServerError
+				return nil, nil, ErrInternalServerError
 			}
 
 			if change.BaseVersion > otherPatch.BaseVersion {
@@ -266,7 +411,7 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 	// In other words, we've probably scrunched the changes we're looking for.
 	if startIndex < 0 {
 		utils.LogError("StartIndex was negative", ErrVersionOutOfDate, nil)
-		return "", -1, nil, 0, ErrVersionOutOfDate
+		return nil, nil, ErrVersionOutOfDate
 	}
 
 	if startIndex < minStartIndex {
@@ -305,13 +450,51 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 				"Patch":             strings.Replace(change.String(), "\n", "\\n", -1),
 				"consolidatedPatch": strings.Replace(consolidatedPatch.String(), "\n", "\\n", -1),
 			})
-			return "", -1, nil, 0, err
+			return nil, nil, err
 		}
 
 		transformedPatch = transformResults.PatchXPrime
 		transformedPatch.BaseVersion = version
 	}
 
+	// TODO: Evaluate whether prevChangesCopy is the correct item to send back
+	// use prevChangesCopy, so we don't send back the transformed patch set
+	return transformedPatch, prevChangesCopy[minStartIndex:], nil
+}
+
+// CBAppendFileChange mutates the file document with the new change and sets the new version number
+// Returns the new version number, the missing patches, the total count of patches tracked, and an error, if any.
+func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (string, int64, []string, int, error) {
+	if store, err := di.documentStore(); err != nil {
+		return "", -1, nil, 0, err
+	} else if store != nil {
+		return store.CBAppendFileChange(fileMeta, patchStr)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return "", -1, nil, 0, err
+	}
+
+	// optimistic locking operation
+	// check the version is accurate and get the object's cas,
+	// then use it in the MutateIn call to verify the document hasn't updated underneath us
+	prevChangeStrs, cas, version, useTemp, err := di.PullChanges(fileMeta)
+	if err != nil {
+		return "", -1, nil, 0, err
+	}
+
+	if cas == uint64(0) {
+		utils.LogWarn("Couchbase returned a CAS value of 0, optimistic locking is unavailable", utils.LogFields{
+			"cas":  cas,
+			"File": fileMeta,
+		})
+	}
+
+	transformedPatch, missing, err := transformChange(prevChangeStrs, version, patchStr)
+	if err != nil {
+		return "", -1, nil, 0, err
+	}
+
 	// use the cas to make sure the document hasn't changed
 	builder := cb.bucket.MutateIn(strconv.FormatInt(fileMeta.FileID, 10), gocb.Cas(cas), 0)
 
@@ -323,12 +506,238 @@ func (di *DatabaseImpl) CBAppendFileChange(fileMeta FileMeta, patchStr string) (
 
 	builder = builder.Counter("version", 1, false)
 
+	started := time.Now()
 	_, err = builder.Execute()
-	if err != nil {
+	if di.cbTimedResult("MutateIn", strconv.FormatInt(fileMeta.FileID, 10), started, err) != nil {
 		return "", -1, nil, 0, err
 	}
 
-	// TODO: Evaluate whether prevChangesCopy is the correct item to send back
-	// use prevChangesCopy, so we don't send back the transformed patch set
-	return transformedPatch.String(), version + 1, prevChangesCopy[minStartIndex:], len(prevChangeStrs) + 1, err
+	return transformedPatch.String(), version + 1, missing, len(prevChangeStrs) + 1, err
+}
+
+// maxRewriteAttempts is how many times CBRewriteFileChanges reads the document again after it was changed underneath it
+const maxRewriteAttempts = 10
+
+// CBRewriteFileChanges replaces each of the file's stored patches with what rewrite returns for it, without changing
+// the file's version, such as to erase their authorship. Returns the number of patches that were changed.
+func (di *DatabaseImpl) CBRewriteFileChanges(fileID int64, rewrite func(change string) string) (int, error) {
+	if store, err := di.documentStore(); err != nil {
+		return 0, err
+	} else if store != nil {
+		return store.CBRewriteFileChanges(fileID, rewrite)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return 0, err
+	}
+	key := strconv.FormatInt(fileID, 10)
+
+	for attempt := 0; attempt < maxRewriteAttempts; attempt++ {
+		file := cbFile{}
+		started := time.Now()
+		cas, err := cb.bucket.Get(key, &file)
+		if di.cbTimedResult("Get", key, started, err) != nil {
+			return 0, err
+		}
+
+		// Changes being scrunched, and those made meanwhile, are kept apart until the scrunch finishes
+		rewritten := 0
+		for _, changes := range [][]string{file.Changes, file.TempChanges, file.RemainingChanges} {
+			for i, change := range changes {
+				if changed := rewrite(change); changed != change {
+					changes[i] = changed
+					rewritten++
+				}
+			}
+		}
+		if rewritten == 0 {
+			return 0, nil
+		}
+
+		// The CAS makes sure no change was appended, or scrunched, since the document was read
+		started = time.Now()
+		_, err = cb.bucket.Replace(key, file, cas, 0)
+		if err == gocb.ErrKeyExists {
+			continue
+		}
+		if di.cbTimedResult("Replace", key, started, err) != nil {
+			return 0, err
+		}
+		return rewritten, nil
+	}
+	return 0, ErrVersionOutOfDate
+}
+
+// CBGetFileChanges returns the file's changes that have not been scrunched into its contents, oldest first, and its
+// version
+func (di *DatabaseImpl) CBGetFileChanges(fileID int64) ([]string, int64, error) {
+	if store, err := di.documentStore(); err != nil {
+		return nil, -1, err
+	} else if store != nil {
+		return store.CBGetFileChanges(fileID)
+	}
+	changes, _, version, _, err := di.PullChanges(FileMeta{FileID: fileID})
+	if err != nil {
+		return nil, -1, err
+	}
+	return changes, version, nil
+}
+
+// CBRemoveFileChanges removes the file's oldest num changes, once they have been scrunched into its contents. Returns
+// ErrNoDbChange if it has fewer. Scrunching files kept in Couchbase doesn't use it, since it keeps the changes made
+// meanwhile apart, as deleteForScrunching describes; this removes them from those that aren't being scrunched.
+func (di *DatabaseImpl) CBRemoveFileChanges(fileID int64, num int) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBRemoveFileChanges(fileID, num)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return err
+	}
+	key := strconv.FormatInt(fileID, 10)
+
+	for attempt := 0; attempt < maxRewriteAttempts; attempt++ {
+		file := cbFile{}
+		started := time.Now()
+		cas, err := cb.bucket.Get(key, &file)
+		if di.cbTimedResult("Get", key, started, err) != nil {
+			return err
+		}
+		if len(file.Changes) < num {
+			return ErrNoDbChange
+		}
+
+		// The CAS makes sure no change was appended since the document was read
+		file.Changes = file.Changes[num:]
+		started = time.Now()
+		_, err = cb.bucket.Replace(key, file, cas, 0)
+		if err == gocb.ErrKeyExists {
+			continue
+		}
+		return di.cbTimedResult("Replace", key, started, err)
+	}
+	return ErrVersionOutOfDate
+}
+
+// notificationRetention is how long a project's notifications are stored, for clients that missed them to fetch
+const notificationRetention = 24 * time.Hour
+
+// maxNotificationsSince is the most notifications CBGetNotificationsSince returns; clients that are further behind
+// resync instead
+const maxNotificationsSince = 1000
+
+// notificationSequenceKey is the key of the counter document holding the project's latest notification sequence
+// number. It does not expire, so that sequence numbers are never reused.
+func notificationSequenceKey(projectID int64) string {
+	return fmt.Sprintf("project-%d-notification-sequence", projectID)
+}
+
+// notificationKey is the key of the document holding the project's notification with the given sequence number
+func notificationKey(projectID int64, sequence int64) string {
+	return fmt.Sprintf("project-%d-notification-%d", projectID, sequence)
+}
+
+// CBNextNotificationSequence returns the next sequence number of the project's notifications, starting from 1
+func (di *DatabaseImpl) CBNextNotificationSequence(projectID int64) (int64, error) {
+	if store, err := di.documentStore(); err != nil {
+		return -1, err
+	} else if store != nil {
+		return store.CBNextNotificationSequence(projectID)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return -1, err
+	}
+
+	started := time.Now()
+	sequence, _, err := cb.bucket.Counter(notificationSequenceKey(projectID), 1, 1, 0)
+	if di.cbTimedResult("Counter", notificationSequenceKey(projectID), started, err) != nil {
+		return -1, err
+	}
+	return int64(sequence), nil
+}
+
+// CBInsertNotification stores the project's notification with the given sequence number, for notificationRetention
+func (di *DatabaseImpl) CBInsertNotification(projectID int64, sequence int64, notification json.RawMessage) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.CBInsertNotification(projectID, sequence, notification)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return err
+	}
+
+	key := notificationKey(projectID, sequence)
+	started := time.Now()
+	_, err = cb.bucket.Insert(key, notification, uint32(notificationRetention.Seconds()))
+	return di.cbTimedResult("Insert", key, started, err)
+}
+
+// CBGetNotificationSequence returns the sequence number of the project's latest notification; 0 if it has sent none
+func (di *DatabaseImpl) CBGetNotificationSequence(projectID int64) (int64, error) {
+	if store, err := di.documentStore(); err != nil {
+		return -1, err
+	} else if store != nil {
+		return store.CBGetNotificationSequence(projectID)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return -1, err
+	}
+
+	// Adding 0 reads the counter, creating it at 0 for projects that have not sent any notifications
+	started := time.Now()
+	latest, _, err := cb.bucket.Counter(notificationSequenceKey(projectID), 0, 0, 0)
+	if di.cbTimedResult("Counter", notificationSequenceKey(projectID), started, err) != nil {
+		return -1, err
+	}
+	return int64(latest), nil
+}
+
+// CBGetNotificationsSince returns the project's stored notifications after the given sequence number, in order, up
+// to the first that has not been stored yet. Returns ErrVersionOutOfDate if the notification after the given
+// sequence number is no longer stored, or more than maxNotificationsSince notifications have been sent since.
+func (di *DatabaseImpl) CBGetNotificationsSince(projectID int64, sequence int64) ([]json.RawMessage, error) {
+	if store, err := di.documentStore(); err != nil {
+		return nil, err
+	} else if store != nil {
+		return store.CBGetNotificationsSince(projectID, sequence)
+	}
+	cb, err := di.openCouchBase()
+	if err != nil {
+		return nil, err
+	}
+
+	// Adding 0 reads the counter, creating it at 0 for projects that have not sent any notifications
+	started := time.Now()
+	latest, _, err := cb.bucket.Counter(notificationSequenceKey(projectID), 0, 0, 0)
+	if di.cbTimedResult("Counter", notificationSequenceKey(projectID), started, err) != nil {
+		return nil, err
+	}
+	if int64(latest)-sequence > maxNotificationsSince {
+		return nil, ErrVersionOutOfDate
+	}
+
+	notifications := []json.RawMessage{}
+	for next := sequence + 1; next <= int64(latest); next++ {
+		var notification json.RawMessage
+		started := time.Now()
+		_, err := cb.bucket.Get(notificationKey(projectID, next), &notification)
+		if err == gocb.ErrKeyNotFound {
+			// Notifications expire oldest first, so a missing first notification has expired; any later one has been
+			// assigned its sequence number, but not stored yet
+			if next == sequence+1 {
+				return nil, ErrVersionOutOfDate
+			}
+			break
+		} else if di.cbTimedResult("Get", notificationKey(projectID, next), started, err) != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
 }
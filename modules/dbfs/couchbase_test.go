@@ -117,6 +117,39 @@ func TestDatabaseImpl_CBDeleteFile(t *testing.T) {
 	}
 }
 
+func TestDatabaseImpl_CBBulkFiles(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	// More files than fit in one batch
+	fileIDs := make([]int64, cbBulkBatchSize+2)
+	for i := range fileIDs {
+		fileIDs[i] = int64(1000 + i)
+	}
+	di.CBDeleteFiles(fileIDs)
+
+	err := di.CBInsertNewFiles(fileIDs, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fileID := range []int64{fileIDs[0], fileIDs[len(fileIDs)-1]} {
+		ver, err := di.CBGetFileVersion(fileID)
+		assert.NoError(t, err)
+		assert.EqualValues(t, 3, ver)
+	}
+
+	err = di.CBInsertNewFiles(fileIDs[:1], 3)
+	assert.Error(t, err, "inserting a file that already has a document should fail")
+
+	// Deleting files without documents succeeds
+	err = di.CBDeleteFiles(append(fileIDs, 999))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = di.CBGetFileVersion(fileIDs[0])
+	assert.Error(t, err)
+}
+
 func TestDatabaseImpl_CBGetFileVersion(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
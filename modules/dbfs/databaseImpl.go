@@ -1,7 +1,99 @@
 package dbfs
 
-// DatabaseImpl is the concrete implementation of the DBFS interface
+import (
+	"context"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+// DatabaseImpl is the concrete implementation of the DBFS interface. Its zero value uses the process's config, as
+// config.GetConfig returns it; NewDatabaseImpl creates one with a config of its own.
 type DatabaseImpl struct {
-	couchbaseDB *couchbaseConn
-	mysqldb     *mysqlConn
+	cfg *config.Config // nil for the process's config; see config
+
+	couchbaseDB      *couchbaseConn
+	couchbaseMutex   sync.Mutex
+	couchbaseBreaker circuitBreaker
+	mysqldb          *mysqlConn
+	mysqlMutex       sync.Mutex // Guards mysqldb, but not its use; see getMySQLConn
+	cacheOnce        sync.Once
+	cache            *metadataCache // nil if caching is disabled; see cache.go
+
+	storesMutex sync.Mutex
+	storesOpen  bool
+	documents   DocumentStore // nil if documents are kept in Couchbase; see storage.go
+	files       FileStore     // nil if files are kept on the filesystem
+	pullMutex   sync.RWMutex  // Write-locked while scrunching files whose documents are in another store; see multi.go
+
+	// Set on the copies returned by WithContext, which share the connections of the parent
+	parent *DatabaseImpl
+	ctx    context.Context
+}
+
+// NewDatabaseImpl creates a DatabaseImpl that connects to the databases, and keeps files where, the config gives
+func NewDatabaseImpl(cfg *config.Config) *DatabaseImpl {
+	return &DatabaseImpl{cfg: cfg}
+}
+
+// config returns the config the DatabaseImpl was created with, or the process's, if it was created without one
+func (di *DatabaseImpl) config() *config.Config {
+	if cfg := di.root().cfg; cfg != nil {
+		return cfg
+	}
+	return config.GetConfig()
+}
+
+// WithContext returns a DBFS using the same connections, whose database operations are abandoned once ctx is done
+func (di *DatabaseImpl) WithContext(ctx context.Context) DBFS {
+	return &DatabaseImpl{parent: di.root(), ctx: ctx}
+}
+
+// root returns the DatabaseImpl that holds the connections
+func (di *DatabaseImpl) root() *DatabaseImpl {
+	if di.parent != nil {
+		return di.parent
+	}
+	return di
+}
+
+// context returns the context database operations are made in
+func (di *DatabaseImpl) context() context.Context {
+	if di.ctx != nil {
+		return di.ctx
+	}
+	return context.Background()
+}
+
+// stores returns the configured document and file stores, opening them if necessary; nil for those DatabaseImpl
+// implements itself
+func (di *DatabaseImpl) stores() (DocumentStore, FileStore, error) {
+	di = di.root()
+	di.storesMutex.Lock()
+	defer di.storesMutex.Unlock()
+
+	if !di.storesOpen {
+		documents, err := openDocumentStore(di.config())
+		if err != nil {
+			return nil, nil, err
+		}
+		files, err := openFileStore(di.config())
+		if err != nil {
+			return nil, nil, err
+		}
+		di.documents, di.files, di.storesOpen = documents, files, true
+	}
+	return di.documents, di.files, nil
+}
+
+// documentStore returns the configured document store; nil if it is Couchbase
+func (di *DatabaseImpl) documentStore() (DocumentStore, error) {
+	documents, _, err := di.stores()
+	return documents, err
+}
+
+// fileStore returns the configured file store; nil if it is the filesystem
+func (di *DatabaseImpl) fileStore() (FileStore, error) {
+	_, files, err := di.stores()
+	return files, err
 }
@@ -0,0 +1,60 @@
+package dbfs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseImpl_WithContext(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scoped := di.WithContext(ctx).(*DatabaseImpl)
+	assert.Equal(t, ctx, scoped.context())
+	assert.Equal(t, context.Background(), di.context())
+
+	// Contexts derived from a scoped DatabaseImpl still share the original's connections
+	assert.True(t, di == scoped.WithContext(context.Background()).(*DatabaseImpl).root())
+
+	cancel()
+	_, err := scoped.openCouchBase()
+	assert.Equal(t, context.Canceled, err)
+	_, err = scoped.CBGetFileVersion(1)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDatabaseImpl_OwnConfig(t *testing.T) {
+	testConfigSetup(t)
+
+	// Each DatabaseImpl keeps its files where its own config says, whatever the process's config is
+	var dbs []*DatabaseImpl
+	for i := 0; i < 2; i++ {
+		projectPath, err := ioutil.TempDir("", "owncfg")
+		require.NoError(t, err)
+		defer os.RemoveAll(projectPath)
+
+		cfg := *config.GetConfig()
+		cfg.ServerConfig.ProjectPath = projectPath
+		dbs = append(dbs, NewDatabaseImpl(&cfg))
+	}
+	for i, di := range dbs {
+		_, err := di.FileWrite(".", "own.txt", 1, []byte{byte(i)})
+		require.NoError(t, err)
+	}
+	for i, di := range dbs {
+		_, err := os.Stat(filepath.Join(di.config().ServerConfig.ProjectPath, "1", "own.txt"))
+		assert.NoError(t, err)
+		raw, err := di.WithContext(context.Background()).FileRead(".", "own.txt", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{byte(i)}, *raw, "copies returned by WithContext should keep the config")
+	}
+	assert.True(t, new(DatabaseImpl).config() == config.GetConfig())
+}
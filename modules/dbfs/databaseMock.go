@@ -1,8 +1,18 @@
 package dbfs
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/CodeCollaborate/Server/modules/config"
@@ -14,20 +24,76 @@ import (
 // fields are exported in case you're a masochist and wan't to initialize this by hand
 type DatabaseMock struct {
 	Users    map[string](UserMeta)
+	Aliases  map[string]string // Usernames users changed from -> their current username
 	Projects map[string]([]ProjectMeta)
 	Files    map[int64]([]FileMeta)
 
-	FileVersion map[int64]int64
-	FileChanges map[int64][]string
+	UserTokens         map[string]UserTokenMeta
+	ExternalIdentities map[ExternalIdentityKey]string
+	APITokens          map[string]APITokenMeta
+	Sessions           map[string]map[string]SessionSubscriptionMeta // SessionID -> Key -> Subscription
+	UserSessions       map[string]UserSessionMeta                    // SessionID + " " + Username -> Session
+	RevokedTokens      map[string]bool                               // Token hashes of revoked sessions
+	IdempotentRequests map[string]map[string]IdempotentRequestMeta   // Username -> Key -> Outcome
+	AuditLog           []AuditEntryMeta
+	Instances          map[string]InstanceMeta
+	Maintenance        MaintenanceMeta
+	ChangeFeedCursors  map[int64]int64 // ProjectID -> Sequence
+	Locks              map[string]bool // Held locks, by name
+	Avatars            map[string][]byte
 
-	ProjectIDCounter int64
-	FileIDCounter    int64
+	// concurrentMutex guards the tables a connection's requests use concurrently: Sessions and UserSessions, since
+	// subscriptions and activity are recorded after the response is sent, while the client may already be making its
+	// next request, IdempotentRequests, since retries are handled while the request they repeat is still being
+	// processed, AuditLog, which every connection appends to, Instances and Maintenance, which heartbeats read and
+	// update in the background, ChangeFeedCursors, which the change feed advances in the background, and Locks
+	concurrentMutex sync.Mutex
+
+	Teams           map[int64]TeamMeta
+	TeamMembers     map[int64][]TeamMemberMeta
+	TeamPermissions map[int64]map[int64]int8 // TeamID -> ProjectID -> PermissionLevel
+
+	FileVersion  map[int64]int64
+	FileChanges  map[int64][]string
+	FileMetadata map[int64]map[string]string
+	FileSizes    map[int64]int64
+	FileHashes   map[int64]ContentHashMeta
+
+	Comments         map[int64]CommentMeta
+	CommentReactions []CommentReactionMeta // In the order they were made
+
+	// FileIntegrityErrors are returned by FileVerify, by FileID, until the file is restored from its swap file
+	FileIntegrityErrors map[int64]error
+
+	ProjectQuotas      map[int64]int64
+	ProjectLineEndings map[int64]string
+	ProjectIgnoreRules map[int64][]string
+	ProjectSettings    map[int64]string // The DefaultRole of projects that have one
+
+	ExternalIDs map[string]map[int64]string // Resource -> ID -> ExternalID
+
+	ProjectArchiveStates map[int64]string
+	ArchivedFiles        map[int64]int64 // FileID -> Version it was archived at
+
+	NotificationPrefs     map[string]NotificationPrefsMeta
+	NotificationSequences map[int64]int64
+	Notifications         map[int64]map[int64]json.RawMessage      // ProjectID -> Sequence -> Notification
+	NotificationAcks      map[int64]map[string]NotificationAckMeta // ProjectID -> Username -> Ack
+
+	ProjectIDCounter  int64
+	FileIDCounter     int64
+	APITokenIDCounter int64
+	TeamIDCounter     int64
+	CommentIDCounter  int64
 
 	File *[]byte
 	Swp  *[]byte
 
 	// FunctionCallCount is the tracker of how many db functions are called
 	FunctionCallCount int
+
+	// Failures, delays and conflicts injected by tests; see databaseMockFaults.go
+	faults mockFaults
 }
 
 // constructor
@@ -35,52 +101,201 @@ type DatabaseMock struct {
 // NewDBMock is the constructor of the db mock object. It allows us to initialize the maps it holds.
 func NewDBMock() *DatabaseMock {
 	return &DatabaseMock{
-		Users:       make(map[string](UserMeta)),
-		Projects:    make(map[string]([]ProjectMeta)),
-		Files:       make(map[int64]([]FileMeta)),
-		FileVersion: make(map[int64]int64),
-		FileChanges: make(map[int64][]string),
+		Users:               make(map[string](UserMeta)),
+		Aliases:             make(map[string]string),
+		Projects:            make(map[string]([]ProjectMeta)),
+		Files:               make(map[int64]([]FileMeta)),
+		UserTokens:          make(map[string]UserTokenMeta),
+		ExternalIdentities:  make(map[ExternalIdentityKey]string),
+		APITokens:           make(map[string]APITokenMeta),
+		Sessions:            make(map[string]map[string]SessionSubscriptionMeta),
+		UserSessions:        make(map[string]UserSessionMeta),
+		RevokedTokens:       make(map[string]bool),
+		IdempotentRequests:  make(map[string]map[string]IdempotentRequestMeta),
+		Instances:           make(map[string]InstanceMeta),
+		ChangeFeedCursors:   make(map[int64]int64),
+		Locks:               make(map[string]bool),
+		Avatars:             make(map[string][]byte),
+		Teams:               make(map[int64]TeamMeta),
+		TeamMembers:         make(map[int64][]TeamMemberMeta),
+		TeamPermissions:     make(map[int64]map[int64]int8),
+		FileVersion:         make(map[int64]int64),
+		FileChanges:         make(map[int64][]string),
+		FileMetadata:        make(map[int64]map[string]string),
+		FileSizes:           make(map[int64]int64),
+		FileHashes:          make(map[int64]ContentHashMeta),
+		Comments:            make(map[int64]CommentMeta),
+		FileIntegrityErrors: make(map[int64]error),
+		ProjectQuotas:       make(map[int64]int64),
+		ProjectLineEndings:  make(map[int64]string),
+		ProjectIgnoreRules:  make(map[int64][]string),
+		ProjectSettings:     make(map[int64]string),
+		ExternalIDs:         make(map[string]map[int64]string),
+
+		ProjectArchiveStates: make(map[int64]string),
+		ArchivedFiles:        make(map[int64]int64),
+
+		NotificationPrefs:     make(map[string]NotificationPrefsMeta),
+		NotificationSequences: make(map[int64]int64),
+		Notifications:         make(map[int64]map[int64]json.RawMessage),
+		NotificationAcks:      make(map[int64]map[string]NotificationAckMeta),
 	}
 }
 
+// WithContext returns the mock itself, since its operations never block. It is not counted in FunctionCallCount.
+func (dm *DatabaseMock) WithContext(ctx context.Context) DBFS {
+	return dm
+}
+
 // couchbase
 
 // CloseCouchbase is a mock of the real implementation
 func (dm *DatabaseMock) CloseCouchbase() error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // CBInsertNewFile is a mock of the real implementation
 func (dm *DatabaseMock) CBInsertNewFile(fileID int64, version int64, changes []string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
 	dm.FileVersion[fileID] = version
 	dm.FileChanges[fileID] = changes
-	dm.FunctionCallCount++
 	return nil
 }
 
 // CBDeleteFile is a mock of the real implementation
 func (dm *DatabaseMock) CBDeleteFile(fileID int64) error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
+	delete(dm.FileVersion, fileID)
+	delete(dm.FileChanges, fileID)
+	return nil
+}
+
+// CBInsertNewFiles is a mock of the real implementation
+func (dm *DatabaseMock) CBInsertNewFiles(fileIDs []int64, version int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for _, fileID := range fileIDs {
+		dm.FileVersion[fileID] = version
+		dm.FileChanges[fileID] = []string{}
+	}
+	return nil
+}
+
+// CBDeleteFiles is a mock of the real implementation
+func (dm *DatabaseMock) CBDeleteFiles(fileIDs []int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for _, fileID := range fileIDs {
+		delete(dm.FileVersion, fileID)
+		delete(dm.FileChanges, fileID)
+	}
 	return nil
 }
 
 // CBGetFileVersion is a mock of the real implementation
 func (dm *DatabaseMock) CBGetFileVersion(fileID int64) (int64, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
 	return dm.FileVersion[fileID], nil
 }
 
+// CBGetFileChanges is a mock of the real implementation
+func (dm *DatabaseMock) CBGetFileChanges(fileID int64) ([]string, int64, error) {
+	if err := dm.call(); err != nil {
+		return nil, -1, err
+	}
+	return dm.FileChanges[fileID], dm.FileVersion[fileID], nil
+}
+
+// CBRemoveFileChanges is a mock of the real implementation
+func (dm *DatabaseMock) CBRemoveFileChanges(fileID int64, num int) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if len(dm.FileChanges[fileID]) < num {
+		return ErrNoDbChange
+	}
+	dm.FileChanges[fileID] = dm.FileChanges[fileID][num:]
+	return nil
+}
+
+// CBNextNotificationSequence is a mock of the real implementation
+func (dm *DatabaseMock) CBNextNotificationSequence(projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	dm.NotificationSequences[projectID]++
+	return dm.NotificationSequences[projectID], nil
+}
+
+// CBInsertNotification is a mock of the real implementation. Notifications never expire; tests delete them instead.
+func (dm *DatabaseMock) CBInsertNotification(projectID int64, sequence int64, notification json.RawMessage) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if dm.Notifications[projectID] == nil {
+		dm.Notifications[projectID] = make(map[int64]json.RawMessage)
+	}
+	if _, ok := dm.Notifications[projectID][sequence]; ok {
+		return ErrNoDbChange
+	}
+	dm.Notifications[projectID][sequence] = notification
+	return nil
+}
+
+// CBGetNotificationSequence is a mock of the real implementation
+func (dm *DatabaseMock) CBGetNotificationSequence(projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	return dm.NotificationSequences[projectID], nil
+}
+
+// CBGetNotificationsSince is a mock of the real implementation
+func (dm *DatabaseMock) CBGetNotificationsSince(projectID int64, sequence int64) ([]json.RawMessage, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	latest := dm.NotificationSequences[projectID]
+	if latest-sequence > maxNotificationsSince {
+		return nil, ErrVersionOutOfDate
+	}
+
+	notifications := []json.RawMessage{}
+	for next := sequence + 1; next <= latest; next++ {
+		notification, ok := dm.Notifications[projectID][next]
+		if !ok {
+			if next == sequence+1 {
+				return nil, ErrVersionOutOfDate
+			}
+			break
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
 // ScrunchFile moves a file from the starting path to the end path
 func (dm *DatabaseMock) ScrunchFile(meta FileMeta) error {
-	dm.FunctionCallCount++
-
+	if err := dm.call(); err != nil {
+		return err
+	}
 	_, changes, err := dm.PullFile(meta)
 	if err != nil {
 		return fmt.Errorf("Scrunching - Failed to retrieve patches and file for scrunching: %v", err)
 	}
-	if len(changes) > MaxBufferLength {
-		changes, baseFile, err := dm.getForScrunching(meta, MinBufferLength)
+	if len(changes) > MaxBufferLength() {
+		changes, baseFile, err := dm.getForScrunching(meta, MinBufferLength())
 		if err != nil {
 			return fmt.Errorf("Scrunching - Failed to retrieve patches and file for scrunching: %v", err)
 		}
@@ -94,6 +309,7 @@ func (dm *DatabaseMock) ScrunchFile(meta FileMeta) error {
 		if err := dm.deleteForScrunching(meta, len(changes)); err != nil {
 			return fmt.Errorf("Scrunching - Failed to removed scrunched changes: %v", err)
 		}
+		recordScrunchedHash(dm, meta, changes, result)
 	}
 	return nil
 }
@@ -101,7 +317,9 @@ func (dm *DatabaseMock) ScrunchFile(meta FileMeta) error {
 // GetForScrunching gets all but the remainder entries for a file and creates a temp swp file.
 // Returns the changes for scrunching, location of the swap file, and any errors
 func (dm *DatabaseMock) getForScrunching(fileMeta FileMeta, remainder int) ([]string, []byte, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return nil, nil, err
+	}
 	changes := dm.FileChanges[fileMeta.FileID]
 	dm.Swp = new([]byte)
 	return changes[0 : len(changes)-remainder], *dm.Swp, nil
@@ -110,7 +328,9 @@ func (dm *DatabaseMock) getForScrunching(fileMeta FileMeta, remainder int) ([]st
 // DeleteForScrunching deletes `num` elements from the front of `changes` for file with `fileID` and deletes the
 // swp file
 func (dm *DatabaseMock) deleteForScrunching(fileMeta FileMeta, num int) error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	dm.File = dm.Swp
 	dm.Swp = nil
 	dm.FileChanges[fileMeta.FileID] = dm.FileChanges[fileMeta.FileID][num:]
@@ -119,7 +339,9 @@ func (dm *DatabaseMock) deleteForScrunching(fileMeta FileMeta, num int) error {
 
 // PullFile pulls the changes and the file bytes from the databases
 func (dm *DatabaseMock) PullFile(meta FileMeta) (*[]byte, []string, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return nil, nil, err
+	}
 	changes := dm.FileChanges[meta.FileID]
 	if dm.File == nil {
 		return new([]byte), []string{}, ErrNoData
@@ -129,22 +351,25 @@ func (dm *DatabaseMock) PullFile(meta FileMeta) (*[]byte, []string, error) {
 
 // PullChanges pulls the changes from the databases
 func (dm *DatabaseMock) PullChanges(meta FileMeta) ([]string, uint64, int64, bool, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return nil, 0, -1, false, err
+	}
 	changes := dm.FileChanges[meta.FileID]
 	return changes, 0, dm.FileVersion[meta.FileID], false, nil
 }
 
 // CBAppendFileChange is a mock of the real implementation
 func (dm *DatabaseMock) CBAppendFileChange(file FileMeta, patch string) (string, int64, []string, int, error) {
-	dm.FunctionCallCount++
-
+	if err := dm.call(); err != nil {
+		return "", -1, nil, 0, err
+	}
 	change, err := patching.NewPatchFromString(patch)
 	if err != nil {
-		return "", -1, nil, 0, errors.New("Failed to parse patch")
+		return "", -1, nil, 0, &Error{Category: CategoryInvalid, Message: "Failed to parse patch", Cause: err}
 	}
 
 	// check to make sure the patch is being applied to the most recent revision
-	if change.BaseVersion > dm.FileVersion[file.FileID] {
+	if change.BaseVersion > dm.FileVersion[file.FileID] || dm.conflict(file.FileID) {
 		return "", -1, nil, 0, ErrVersionOutOfDate
 	}
 
@@ -156,223 +381,1117 @@ func (dm *DatabaseMock) CBAppendFileChange(file FileMeta, patch string) (string,
 	return patch, dm.FileVersion[file.FileID], nil, len(dm.FileChanges[file.FileID]), nil
 }
 
+// CBRewriteFileChanges is a mock of the real implementation
+func (dm *DatabaseMock) CBRewriteFileChanges(fileID int64, rewrite func(change string) string) (int, error) {
+	if err := dm.call(); err != nil {
+		return 0, err
+	}
+	changes := dm.FileChanges[fileID]
+	rewritten := 0
+	for i, change := range changes {
+		if changed := rewrite(change); changed != change {
+			changes[i] = changed
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
+
 // mysql
 
 // CloseMySQL is a mock of the real implementation
 func (dm *DatabaseMock) CloseMySQL() error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	return nil
 }
 
 // MySQLUserRegister is a mock of the real implementation
 func (dm *DatabaseMock) MySQLUserRegister(user UserMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
 	if _, ok := dm.Users[user.Username]; ok {
 		return ErrNoDbChange
 	}
+	if _, ok := dm.Aliases[user.Username]; ok {
+		return ErrNoDbChange
+	}
 	dm.Users[user.Username] = user
-	dm.FunctionCallCount++
 	return nil
 }
 
 // MySQLUserGetPass is a mock of the real implementation
 func (dm *DatabaseMock) MySQLUserGetPass(username string) (string, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return "", err
+	}
 	return dm.Users[username].Password, nil
 }
 
-// MySQLUserDelete is a mock of the real implementation
-func (dm *DatabaseMock) MySQLUserDelete(username string) ([]int64, error) {
-	dm.FunctionCallCount += 2
-
-	var deletedIDs []int64
-	ownerPerm, err := config.PermissionByLabel("owner")
-	if err != nil {
-		return deletedIDs, err
+// MySQLUserSetPass is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSetPass(username string, password string) error {
+	if err := dm.call(); err != nil {
+		return err
 	}
-
-	for _, project := range dm.Projects[username] {
-		if project.PermissionLevel == ownerPerm.Level {
-			deletedIDs = append(deletedIDs, project.ProjectID)
-		}
+	user, ok := dm.Users[username]
+	if !ok {
+		return ErrNoDbChange
 	}
+	user.Password = password
+	dm.Users[username] = user
+	return nil
+}
 
-	if _, ok := dm.Users[username]; ok {
-		delete(dm.Users, username)
-	} else {
-		return []int64{}, ErrNoDbChange
+// MySQLUserSetEmailVerified is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSetEmailVerified(username string) error {
+	if err := dm.call(); err != nil {
+		return err
 	}
-
-	// go through everyone's projects and delete ones which were owned by `username`
-	// this is pretty gross... I can't wait for the refactor of this :/
-	for username, projects := range dm.Projects {
-		var indices []int
-		for i, project := range projects {
-			for _, deletedID := range deletedIDs {
-				if project.ProjectID == deletedID {
-					indices = append(indices, i)
-				}
-				break // continue to next i
-			}
-		}
-		// remove the found projects
-		initialLen := len(dm.Projects[username])
-		for offset, i := range indices {
-			projectsSlice := dm.Projects[username]
-			if i != initialLen-1 {
-				dm.Projects[username] = append(projectsSlice[0:i-offset], projectsSlice[i+1-offset:]...)
-			} else {
-				dm.Projects[username] = projectsSlice[0 : i-offset]
-			}
-		}
+	user, ok := dm.Users[username]
+	if !ok {
+		return ErrNoDbChange
 	}
+	user.EmailVerified = true
+	dm.Users[username] = user
+	return nil
+}
 
-	return deletedIDs, nil
+// MySQLUserSetUnlisted is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSetUnlisted(username string, unlisted bool) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	user, ok := dm.Users[username]
+	if !ok {
+		return nil
+	}
+	user.Unlisted = unlisted
+	dm.Users[username] = user
+	return nil
 }
 
-// MySQLUserLookup is a mock of the real implementation
-func (dm *DatabaseMock) MySQLUserLookup(username string) (user UserMeta, err error) {
-	dm.FunctionCallCount++
-	if user, ok := dm.Users[username]; ok {
-		return user, nil
+// MySQLUserUpdateProfile is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserUpdateProfile(username string, firstName string, lastName string) error {
+	if err := dm.call(); err != nil {
+		return err
 	}
-	return user, err
+	user, ok := dm.Users[username]
+	if !ok {
+		return nil
+	}
+	user.FirstName = firstName
+	user.LastName = lastName
+	dm.Users[username] = user
+	return nil
 }
 
-// MySQLUserProjects is a mock of the real implementation
-func (dm *DatabaseMock) MySQLUserProjects(username string) ([]ProjectMeta, error) {
-	dm.FunctionCallCount++
-	return dm.Projects[username], nil
+// MySQLUserSetAvatar is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSetAvatar(username string, avatarHash string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	user, ok := dm.Users[username]
+	if !ok {
+		return nil
+	}
+	user.AvatarHash = avatarHash
+	dm.Users[username] = user
+	return nil
 }
 
-// MySQLProjectCreate is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectCreate(username string, projectName string) (int64, error) {
-	dm.FunctionCallCount++
+// MySQLUserChangeUsername is a mock of the real implementation. Avatars are kept by the avatar store, so aren't renamed
+func (dm *DatabaseMock) MySQLUserChangeUsername(oldUsername string, newUsername string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	user, ok := dm.Users[oldUsername]
+	if !ok {
+		return ErrNoDbChange
+	}
+	if _, ok := dm.Users[newUsername]; ok {
+		return ErrNoDbChange
+	}
+	if aliasOf, ok := dm.Aliases[newUsername]; ok && aliasOf != oldUsername {
+		return ErrNoDbChange
+	}
 
-	perm, _ := config.PermissionByLabel("owner")
-	proj := ProjectMeta{
-		PermissionLevel: perm.Level,
-		ProjectID:       dm.ProjectIDCounter,
-		Name:            projectName,
+	rename := func(username *string) {
+		if *username == oldUsername {
+			*username = newUsername
+		}
 	}
-	dm.ProjectIDCounter++
-	dm.Projects[username] = append(dm.Projects[username], proj)
-	return proj.ProjectID, nil
-}
 
-// MySQLProjectDelete is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectDelete(projectID int64, senderID string) error {
-	dm.FunctionCallCount++
-	// so this is kinda horrible, but it is easy to follow what's going on
-	for username, projects := range dm.Projects {
-		var index = int64(-1)
-		for i, proj := range projects {
-			if proj.ProjectID == projectID {
-				index = int64(i)
-			}
+	user.Username = newUsername
+	delete(dm.Users, oldUsername)
+	dm.Users[newUsername] = user
+	if projects, ok := dm.Projects[oldUsername]; ok {
+		delete(dm.Projects, oldUsername)
+		dm.Projects[newUsername] = projects
+	}
+	for _, files := range dm.Files {
+		for i := range files {
+			rename(&files[i].Creator)
 		}
-		if int64(len(dm.Projects[username])) > index+1 {
-			dm.Projects[username] = append(dm.Projects[username][:index], dm.Projects[username][(index+1):]...)
-		} else {
-			dm.Projects[username] = dm.Projects[username][:index]
+	}
+	for teamID, team := range dm.Teams {
+		rename(&team.Creator)
+		dm.Teams[teamID] = team
+	}
+	for _, members := range dm.TeamMembers {
+		for i := range members {
+			rename(&members[i].Username)
+		}
+	}
+	for commentID, comment := range dm.Comments {
+		rename(&comment.Author)
+		rename(&comment.ResolvedBy)
+		dm.Comments[commentID] = comment
+	}
+	for i := range dm.CommentReactions {
+		rename(&dm.CommentReactions[i].Username)
+	}
+	for hash, token := range dm.UserTokens {
+		rename(&token.Username)
+		dm.UserTokens[hash] = token
+	}
+	for hash, token := range dm.APITokens {
+		rename(&token.Username)
+		dm.APITokens[hash] = token
+	}
+	for key, username := range dm.ExternalIdentities {
+		rename(&username)
+		dm.ExternalIdentities[key] = username
+	}
+	if prefs, ok := dm.NotificationPrefs[oldUsername]; ok {
+		delete(dm.NotificationPrefs, oldUsername)
+		dm.NotificationPrefs[newUsername] = prefs
+	}
+	for _, acks := range dm.NotificationAcks {
+		if ack, ok := acks[oldUsername]; ok {
+			delete(acks, oldUsername)
+			ack.Username = newUsername
+			acks[newUsername] = ack
+		}
+	}
+	dm.concurrentMutex.Lock()
+	for key, session := range dm.UserSessions {
+		if session.Username == oldUsername {
+			delete(dm.UserSessions, key)
+			session.Username = newUsername
+			dm.UserSessions[session.SessionID+" "+newUsername] = session
+		}
+	}
+	dm.concurrentMutex.Unlock()
+
+	for alias, aliasOf := range dm.Aliases {
+		if aliasOf == oldUsername {
+			dm.Aliases[alias] = newUsername
 		}
-		delete(dm.Files, index)
 	}
+	delete(dm.Aliases, newUsername)
+	dm.Aliases[oldUsername] = newUsername
 	return nil
 }
 
-// MySQLProjectGetFiles is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectGetFiles(projectID int64) ([]FileMeta, error) {
-	dm.FunctionCallCount++
-	return dm.Files[projectID], nil
+// MySQLUserResolveAlias is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserResolveAlias(alias string) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
+	}
+	username, ok := dm.Aliases[alias]
+	if !ok {
+		return "", ErrNoData
+	}
+	return username, nil
 }
 
-// MySQLProjectGrantPermission is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectGrantPermission(projectID int64, grantUsername string, permissionLevel int8, grantedByUsername string) error {
-	dm.FunctionCallCount++
-	found := false
-
-	// check if you're changing permission rather than adding
-	for _, proj := range dm.Projects[grantUsername] {
-		if proj.ProjectID == projectID {
-			proj.PermissionLevel = permissionLevel
-			found = true
-			break
+// MySQLUserAliases is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserAliases(username string) ([]string, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	aliases := []string{}
+	for alias, aliasOf := range dm.Aliases {
+		if aliasOf == username {
+			aliases = append(aliases, alias)
 		}
 	}
-	if !found {
-		// add if not found
-		for _, proj := range dm.Projects[grantedByUsername] {
-			if proj.ProjectID == projectID {
-				dm.Projects[grantUsername] = append(dm.Projects[grantUsername], ProjectMeta{
-					PermissionLevel: permissionLevel,
-					ProjectID:       projectID,
-					Name:            proj.Name,
-				})
-				found = true
-			}
+	sort.Strings(aliases)
+	return aliases, nil
+}
+
+// MySQLUserSearch is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSearch(prefix string, maxResults int) ([]UserMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	prefix = strings.ToLower(prefix)
+	users := []UserMeta{}
+	for _, user := range dm.Users {
+		matches := false
+		for _, field := range []string{user.Username, user.Email, user.FirstName, user.LastName} {
+			matches = matches || strings.HasPrefix(strings.ToLower(field), prefix)
 		}
-		if !found {
-			return ErrNoDbChange
+		if user.Username == prefix || matches && !user.Unlisted {
+			users = append(users, UserMeta{Username: user.Username, FirstName: user.FirstName, LastName: user.LastName})
 		}
 	}
-	return nil
+	sort.Slice(users, func(i, j int) bool {
+		if (users[i].Username == prefix) != (users[j].Username == prefix) {
+			return users[i].Username == prefix
+		}
+		return users[i].Username < users[j].Username
+	})
+	if len(users) > maxResults {
+		users = users[:maxResults]
+	}
+	return users, nil
 }
 
-// MySQLProjectRevokePermission is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectRevokePermission(projectID int64, revokeUsername string, revokedByUsername string) error {
-	dm.FunctionCallCount++
-	index := -1
-	for i, proj := range dm.Projects[revokeUsername] {
-		if proj.ProjectID == projectID {
-			index = i
-		}
+// MySQLUserTokenCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserTokenCreate(username string, tokenHash string, purpose string, validity time.Duration) error {
+	if err := dm.call(); err != nil {
+		return err
 	}
-	if index < 0 {
-		return errors.New("project not found")
+	if _, ok := dm.Users[username]; !ok {
+		return ErrNoDbChange
 	}
-	if len(dm.Projects[revokeUsername]) > index+1 {
-		dm.Projects[revokeUsername] = append(
-			dm.Projects[revokeUsername][:index],
-			dm.Projects[revokeUsername][index+1:]...)
-	} else {
-		dm.Projects[revokeUsername] = dm.Projects[revokeUsername][:index]
+	for hash, token := range dm.UserTokens {
+		if token.Username == username && token.Purpose == purpose {
+			delete(dm.UserTokens, hash)
+		}
+	}
+	dm.UserTokens[tokenHash] = UserTokenMeta{
+		Username:  username,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(validity),
 	}
 	return nil
 }
 
-// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID
-func (dm *DatabaseMock) MySQLUserProjectPermissionLookup(projectID int64, username string) (int8, error) {
-	dm.FunctionCallCount++
-	for _, proj := range dm.Projects[username] {
-		if proj.ProjectID == projectID {
-			return proj.PermissionLevel, nil
-		}
+// MySQLUserTokenConsume is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserTokenConsume(tokenHash string, purpose string) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
 	}
-	return 0, ErrNoData
+	token, ok := dm.UserTokens[tokenHash]
+	if !ok || token.Purpose != purpose || !time.Now().Before(token.ExpiresAt) {
+		return "", ErrNoData
+	}
+	delete(dm.UserTokens, tokenHash)
+	return token.Username, nil
 }
 
-// MySQLProjectRename is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectRename(projectID int64, newName string) error {
-	dm.FunctionCallCount++
-	// so inefficient but whatever, it's a mock
-	found := false
-	for _, projects := range dm.Projects {
-		for _, project := range projects {
-			if project.ProjectID == projectID {
-				project.Name = newName
-				found = true
-			}
-		}
+// MySQLAPITokenCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLAPITokenCreate(tokenHash string, token APITokenMeta, validity time.Duration) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
 	}
-	if !found {
-		return ErrNoDbChange
+	if _, ok := dm.Users[token.Username]; !ok {
+		return -1, ErrNoDbChange
 	}
-	return nil
+	dm.APITokenIDCounter++
+	token.TokenID = dm.APITokenIDCounter
+	token.CreationDate = time.Now()
+	if validity > 0 {
+		token.ExpiresAt = token.CreationDate.Add(validity)
+	}
+	dm.APITokens[tokenHash] = token
+	return token.TokenID, nil
 }
 
-// MySQLProjectLookup is a mock of the real implementation
-func (dm *DatabaseMock) MySQLProjectLookup(projectID int64, username string) (name string, permissions map[string]ProjectPermission, err error) {
+// MySQLAPITokenLookup is a mock of the real implementation
+func (dm *DatabaseMock) MySQLAPITokenLookup(tokenHash string) (APITokenMeta, error) {
+	if err := dm.call(); err != nil {
+		return APITokenMeta{}, err
+	}
+	token, ok := dm.APITokens[tokenHash]
+	if !ok || (!token.ExpiresAt.IsZero() && !time.Now().Before(token.ExpiresAt)) {
+		return APITokenMeta{}, ErrNoData
+	}
+	return token, nil
+}
+
+// MySQLAPITokenRevoke is a mock of the real implementation
+func (dm *DatabaseMock) MySQLAPITokenRevoke(tokenID int64, username string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for hash, token := range dm.APITokens {
+		if token.TokenID == tokenID && token.Username == username {
+			delete(dm.APITokens, hash)
+			return nil
+		}
+	}
+	return ErrNoDbChange
+}
+
+// MySQLExternalIdentityLookup is a mock of the real implementation
+func (dm *DatabaseMock) MySQLExternalIdentityLookup(provider string, subject string) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
+	}
+	username, ok := dm.ExternalIdentities[ExternalIdentityKey{Provider: provider, Subject: subject}]
+	if !ok {
+		return "", ErrNoData
+	}
+	return username, nil
+}
+
+// MySQLExternalIdentityLink is a mock of the real implementation
+func (dm *DatabaseMock) MySQLExternalIdentityLink(provider string, subject string, username string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	key := ExternalIdentityKey{Provider: provider, Subject: subject}
+	if _, ok := dm.ExternalIdentities[key]; ok {
+		return ErrNoDbChange
+	}
+	if _, ok := dm.Users[username]; !ok {
+		return ErrNoDbChange
+	}
+	dm.ExternalIdentities[key] = username
+	return nil
+}
+
+// MySQLSessionSubscriptionSet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLSessionSubscriptionSet(sub SessionSubscriptionMeta, validity time.Duration) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	if _, ok := dm.Users[sub.Username]; !ok {
+		return ErrNoDbChange
+	}
+	if dm.Sessions[sub.SessionID] == nil {
+		dm.Sessions[sub.SessionID] = make(map[string]SessionSubscriptionMeta)
+	}
+	sub.LastSeen = time.Now()
+	dm.Sessions[sub.SessionID][sub.Key] = sub
+	return nil
+}
+
+// MySQLSessionSubscriptionRemove is a mock of the real implementation
+func (dm *DatabaseMock) MySQLSessionSubscriptionRemove(sessionID string, key string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	delete(dm.Sessions[sessionID], key)
+	return nil
+}
+
+// MySQLSessionGetSubscriptions is a mock of the real implementation
+func (dm *DatabaseMock) MySQLSessionGetSubscriptions(sessionID string, validity time.Duration) ([]SessionSubscriptionMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	subs := []SessionSubscriptionMeta{}
+	for _, sub := range dm.Sessions[sessionID] {
+		if time.Since(sub.LastSeen) < validity {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// MySQLSessionTouch is a mock of the real implementation
+func (dm *DatabaseMock) MySQLSessionTouch(sessionID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	for key, sub := range dm.Sessions[sessionID] {
+		sub.LastSeen = time.Now()
+		dm.Sessions[sessionID][key] = sub
+	}
+	return nil
+}
+
+// MySQLSessionDelete is a mock of the real implementation
+func (dm *DatabaseMock) MySQLSessionDelete(sessionID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	delete(dm.Sessions, sessionID)
+	return nil
+}
+
+// MySQLUserSessionRecord is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSessionRecord(session UserSessionMeta, forgetBefore time.Time) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	if _, ok := dm.Users[session.Username]; !ok {
+		return ErrNoDbChange
+	}
+	key := session.SessionID + " " + session.Username
+	if recorded, ok := dm.UserSessions[key]; ok {
+		session.ConnectedAt = recorded.ConnectedAt
+	} else {
+		session.ConnectedAt = time.Now()
+	}
+	session.LastActive = time.Now()
+	dm.UserSessions[key] = session
+	return nil
+}
+
+// MySQLUserSessionList is a mock of the real implementation. Sessions are only forgotten once they end.
+func (dm *DatabaseMock) MySQLUserSessionList(username string, activeSince time.Time) ([]UserSessionMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	sessions := []UserSessionMeta{}
+	for _, session := range dm.UserSessions {
+		if session.Username == username {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActive.After(sessions[j].LastActive)
+	})
+	return sessions, nil
+}
+
+// MySQLUserSessionRevoke is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSessionRevoke(username string, sessionID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	key := sessionID + " " + username
+	session, ok := dm.UserSessions[key]
+	if !ok {
+		return ErrNoDbChange
+	}
+	delete(dm.UserSessions, key)
+	if session.TokenHash != "" {
+		dm.RevokedTokens[session.TokenHash] = true
+	}
+	return nil
+}
+
+// MySQLUserSessionTokenRevoked is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSessionTokenRevoked(tokenHash string) (bool, error) {
+	if err := dm.call(); err != nil {
+		return false, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	return dm.RevokedTokens[tokenHash], nil
+}
+
+// MySQLUserSessionEnd is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSessionEnd(sessionID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	for key, session := range dm.UserSessions {
+		if session.SessionID == sessionID {
+			delete(dm.UserSessions, key)
+		}
+	}
+	return nil
+}
+
+// MySQLIdempotentRequestGet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLIdempotentRequestGet(username string, key string, validity time.Duration) (IdempotentRequestMeta, error) {
+	if err := dm.call(); err != nil {
+		return IdempotentRequestMeta{}, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	req, ok := dm.IdempotentRequests[username][key]
+	if !ok || time.Since(req.Created) >= validity {
+		return IdempotentRequestMeta{Username: username, Key: key}, ErrNoData
+	}
+	return req, nil
+}
+
+// MySQLIdempotentRequestReserve is a mock of the real implementation
+func (dm *DatabaseMock) MySQLIdempotentRequestReserve(username string, key string, method string, validity time.Duration,
+	lease time.Duration) (bool, error) {
+	if err := dm.call(); err != nil {
+		return false, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	if _, ok := dm.Users[username]; !ok {
+		return false, ErrNoDbChange
+	}
+	if dm.IdempotentRequests[username] == nil {
+		dm.IdempotentRequests[username] = make(map[string]IdempotentRequestMeta)
+	}
+	if existing, ok := dm.IdempotentRequests[username][key]; ok && time.Since(existing.Created) < validity {
+		if existing.Status != 0 || time.Since(existing.Created) < lease {
+			return false, nil
+		}
+	}
+	dm.IdempotentRequests[username][key] = IdempotentRequestMeta{
+		Username: username,
+		Key:      key,
+		Method:   method,
+		Created:  time.Now(),
+	}
+	return true, nil
+}
+
+// MySQLIdempotentRequestSet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLIdempotentRequestSet(req IdempotentRequestMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	existing, ok := dm.IdempotentRequests[req.Username][req.Key]
+	if !ok {
+		return nil
+	}
+	existing.Status = req.Status
+	existing.Response = req.Response
+	dm.IdempotentRequests[req.Username][req.Key] = existing
+	return nil
+}
+
+// MySQLIdempotentRequestRelease is a mock of the real implementation
+func (dm *DatabaseMock) MySQLIdempotentRequestRelease(username string, key string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	delete(dm.IdempotentRequests[username], key)
+	return nil
+}
+
+// MySQLAuditLogAppend is a mock of the real implementation
+func (dm *DatabaseMock) MySQLAuditLogAppend(entry AuditEntryMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	entry.AuditID = int64(len(dm.AuditLog)) + 1
+	entry.Time = time.Now()
+	dm.AuditLog = append(dm.AuditLog, entry)
+	return nil
+}
+
+// MySQLAuditLogQuery is a mock of the real implementation
+func (dm *DatabaseMock) MySQLAuditLogQuery(filter AuditLogFilter) ([]AuditEntryMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	entries := []AuditEntryMeta{}
+	for _, entry := range dm.AuditLog {
+		if len(entries) == filter.Limit {
+			break
+		}
+		if entry.Time.Before(filter.Since) || !entry.Time.Before(filter.Until) || entry.AuditID <= filter.AfterAuditID ||
+			(filter.Event != "" && !strings.EqualFold(entry.Event, filter.Event)) ||
+			(filter.Actor != "" && !strings.EqualFold(entry.Actor, filter.Actor)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// MySQLInstanceHeartbeat is a mock of the real implementation
+func (dm *DatabaseMock) MySQLInstanceHeartbeat(instance InstanceMeta, forgetBefore time.Time) (bool, error) {
+	if err := dm.call(); err != nil {
+		return false, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	// Only admins set Draining
+	instance.Draining = dm.Instances[instance.InstanceID].Draining
+	instance.LastHeartbeat = time.Now()
+	dm.Instances[instance.InstanceID] = instance
+
+	for instanceID, existing := range dm.Instances {
+		if existing.LastHeartbeat.Before(forgetBefore) {
+			delete(dm.Instances, instanceID)
+		}
+	}
+	return dm.Instances[instance.InstanceID].Draining, nil
+}
+
+// MySQLInstanceList is a mock of the real implementation
+func (dm *DatabaseMock) MySQLInstanceList() ([]InstanceMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	instances := []InstanceMeta{}
+	for _, instance := range dm.Instances {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Name != instances[j].Name {
+			return instances[i].Name < instances[j].Name
+		}
+		return instances[i].InstanceID < instances[j].InstanceID
+	})
+	return instances, nil
+}
+
+// MySQLInstanceSetDraining is a mock of the real implementation
+func (dm *DatabaseMock) MySQLInstanceSetDraining(instanceID string, draining bool) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	instance, ok := dm.Instances[instanceID]
+	if !ok {
+		return ErrNoDbChange
+	}
+	instance.Draining = draining
+	dm.Instances[instanceID] = instance
+	return nil
+}
+
+// MySQLInstanceDelete is a mock of the real implementation
+func (dm *DatabaseMock) MySQLInstanceDelete(instanceID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	delete(dm.Instances, instanceID)
+	return nil
+}
+
+// MySQLMaintenanceGet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLMaintenanceGet() (MaintenanceMeta, error) {
+	if err := dm.call(); err != nil {
+		return MaintenanceMeta{}, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	return dm.Maintenance, nil
+}
+
+// MySQLMaintenanceSet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLMaintenanceSet(maintenance MaintenanceMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	maintenance.SetAt = time.Now()
+	dm.Maintenance = maintenance
+	return nil
+}
+
+// MySQLChangeFeedCursorGet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLChangeFeedCursorGet(projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return 0, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	return dm.ChangeFeedCursors[projectID], nil
+}
+
+// MySQLChangeFeedCursorAdvance is a mock of the real implementation
+func (dm *DatabaseMock) MySQLChangeFeedCursorAdvance(projectID int64, fromSequence int64, toSequence int64) (bool, error) {
+	if err := dm.call(); err != nil {
+		return false, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	if dm.ChangeFeedCursors[projectID] != fromSequence {
+		return false, nil
+	}
+	dm.ChangeFeedCursors[projectID] = toSequence
+	return true, nil
+}
+
+// MySQLLockAcquire is a mock of the real implementation. Waiting is not mocked: held locks fail immediately
+func (dm *DatabaseMock) MySQLLockAcquire(name string, wait time.Duration) (Lock, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	dm.concurrentMutex.Lock()
+	defer dm.concurrentMutex.Unlock()
+
+	if dm.Locks[name] {
+		return nil, ErrLockHeld
+	}
+	dm.Locks[name] = true
+	return &mockLock{dm: dm, name: name}, nil
+}
+
+type mockLock struct {
+	dm   *DatabaseMock
+	name string
+}
+
+func (lock *mockLock) Release() error {
+	lock.dm.concurrentMutex.Lock()
+	defer lock.dm.concurrentMutex.Unlock()
+
+	delete(lock.dm.Locks, lock.name)
+	return nil
+}
+
+// MySQLUserDelete is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserDelete(username string) ([]int64, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
 	dm.FunctionCallCount++
+
+	var deletedIDs []int64
+	for _, project := range dm.Projects[username] {
+		if project.PermissionLevel == config.OwnerRole.Level {
+			deletedIDs = append(deletedIDs, project.ProjectID)
+		}
+	}
+
+	if _, ok := dm.Users[username]; ok {
+		delete(dm.Users, username)
+	} else {
+		return []int64{}, ErrNoDbChange
+	}
+
+	// go through everyone's projects and delete ones which were owned by `username`
+	for _, deletedID := range deletedIDs {
+		dm.removeProject(deletedID)
+	}
+	delete(dm.Projects, username)
+	delete(dm.NotificationPrefs, username)
+	for alias, aliasOf := range dm.Aliases {
+		if aliasOf == username {
+			delete(dm.Aliases, alias)
+		}
+	}
+	for _, acks := range dm.NotificationAcks {
+		delete(acks, username)
+	}
+	dm.concurrentMutex.Lock()
+	for key, session := range dm.UserSessions {
+		if session.Username == username {
+			delete(dm.UserSessions, key)
+		}
+	}
+	dm.concurrentMutex.Unlock()
+	remaining := []CommentReactionMeta{}
+	for _, reaction := range dm.CommentReactions {
+		if reaction.Username != username {
+			remaining = append(remaining, reaction)
+		}
+	}
+	dm.CommentReactions = remaining
+
+	return deletedIDs, nil
+}
+
+// MySQLUserLookup is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserLookup(username string) (user UserMeta, err error) {
+	if err = dm.call(); err != nil {
+		return user, err
+	}
+	if user, ok := dm.Users[username]; ok {
+		return user, nil
+	}
+	return user, ErrNoData
+}
+
+// MySQLUserProjects is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserProjects(username string) ([]ProjectMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	projects := append([]ProjectMeta{}, dm.Projects[username]...)
+
+	for projectID, level := range dm.teamPermissions(username) {
+		found := false
+		for i, project := range projects {
+			if project.ProjectID == projectID {
+				found = true
+				if level > project.PermissionLevel {
+					projects[i].PermissionLevel = level
+				}
+			}
+		}
+		if !found {
+			projects = append(projects, ProjectMeta{
+				ProjectID:       projectID,
+				Name:            dm.projectName(projectID),
+				PermissionLevel: level,
+			})
+		}
+	}
+	return projects, nil
+}
+
+// teamPermissions returns the highest permission level granted to any of the user's teams, for each project
+func (dm *DatabaseMock) teamPermissions(username string) map[int64]int8 {
+	levels := make(map[int64]int8)
+	for teamID, members := range dm.TeamMembers {
+		for _, member := range members {
+			if member.Username != username {
+				continue
+			}
+			for projectID, level := range dm.TeamPermissions[teamID] {
+				if level > levels[projectID] {
+					levels[projectID] = level
+				}
+			}
+		}
+	}
+	return levels
+}
+
+func (dm *DatabaseMock) projectName(projectID int64) string {
+	for _, projects := range dm.Projects {
+		for _, project := range projects {
+			if project.ProjectID == projectID {
+				return project.Name
+			}
+		}
+	}
+	return ""
+}
+
+// MySQLProjectCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectCreate(username string, projectName string) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	dm.ProjectIDCounter++
+	proj := ProjectMeta{
+		PermissionLevel: config.OwnerRole.Level,
+		ProjectID:       dm.ProjectIDCounter,
+		Name:            projectName,
+	}
+	dm.Projects[username] = append(dm.Projects[username], proj)
+	return proj.ProjectID, nil
+}
+
+// MySQLProjectDelete is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectDelete(projectID int64, senderID string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if !dm.removeProject(projectID) {
+		return ErrNoDbChange
+	}
+	return nil
+}
+
+// removeProject removes the project, and its files, from every user and team, returning false if it did not exist
+func (dm *DatabaseMock) removeProject(projectID int64) bool {
+	found := false
+	for username, projects := range dm.Projects {
+		remaining := []ProjectMeta{}
+		for _, project := range projects {
+			if project.ProjectID == projectID {
+				found = true
+			} else {
+				remaining = append(remaining, project)
+			}
+		}
+		dm.Projects[username] = remaining
+	}
+	for _, file := range dm.Files[projectID] {
+		delete(dm.FileVersion, file.FileID)
+		delete(dm.FileChanges, file.FileID)
+		delete(dm.FileMetadata, file.FileID)
+		delete(dm.FileSizes, file.FileID)
+		delete(dm.FileHashes, file.FileID)
+		dm.deleteFileComments(file.FileID)
+	}
+	delete(dm.Files, projectID)
+	for _, levels := range dm.TeamPermissions {
+		delete(levels, projectID)
+	}
+	delete(dm.ProjectQuotas, projectID)
+	delete(dm.ProjectLineEndings, projectID)
+	delete(dm.ProjectIgnoreRules, projectID)
+	delete(dm.ProjectSettings, projectID)
+	delete(dm.NotificationAcks, projectID)
+	return found
+}
+
+// MySQLProjectGetFiles is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetFiles(projectID int64) ([]FileMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	return dm.Files[projectID], nil
+}
+
+// MySQLProjectGetFilesFiltered is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetFilesFiltered(projectID int64, directory string, glob string) ([]FileMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+
+	// Compared case-insensitively, like the columns' collation
+	directory = strings.ToLower(cleanDirectory(directory))
+	names := regexp.MustCompile("(?is)^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(glob)) + "$")
+	files := []FileMeta{}
+	for _, file := range dm.Files[projectID] {
+		relativePath := strings.ToLower(cleanDirectory(file.RelativePath))
+		inDirectory := directory == "" || relativePath == directory || strings.HasPrefix(relativePath, directory+"/")
+		if inDirectory && (glob == "" || names.MatchString(file.Filename)) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// MySQLProjectGrantPermission is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGrantPermission(projectID int64, grantUsername string, permissionLevel int8, grantedByUsername string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	found := false
+
+	// check if you're changing permission rather than adding
+	for i, proj := range dm.Projects[grantUsername] {
+		if proj.ProjectID == projectID {
+			dm.Projects[grantUsername][i].PermissionLevel = permissionLevel
+			found = true
+			break
+		}
+	}
+	if !found {
+		// add if not found
+		for _, proj := range dm.Projects[grantedByUsername] {
+			if proj.ProjectID == projectID {
+				dm.Projects[grantUsername] = append(dm.Projects[grantUsername], ProjectMeta{
+					PermissionLevel: permissionLevel,
+					ProjectID:       projectID,
+					Name:            proj.Name,
+				})
+				found = true
+			}
+		}
+		if !found {
+			return ErrNoDbChange
+		}
+	}
+	return nil
+}
+
+// MySQLProjectRevokePermission is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectRevokePermission(projectID int64, revokeUsername string, revokedByUsername string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	index := -1
+	for i, proj := range dm.Projects[revokeUsername] {
+		if proj.ProjectID == projectID {
+			index = i
+		}
+	}
+	if index < 0 {
+		return errors.New("project not found")
+	}
+	if len(dm.Projects[revokeUsername]) > index+1 {
+		dm.Projects[revokeUsername] = append(
+			dm.Projects[revokeUsername][:index],
+			dm.Projects[revokeUsername][index+1:]...)
+	} else {
+		dm.Projects[revokeUsername] = dm.Projects[revokeUsername][:index]
+	}
+	return nil
+}
+
+// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID
+func (dm *DatabaseMock) MySQLUserProjectPermissionLookup(projectID int64, username string) (int8, error) {
+	if err := dm.call(); err != nil {
+		return 0, err
+	}
+	level, found := dm.teamPermissions(username)[projectID]
+	for _, proj := range dm.Projects[username] {
+		if proj.ProjectID == projectID {
+			found = true
+			if proj.PermissionLevel > level {
+				level = proj.PermissionLevel
+			}
+		}
+	}
+	if !found {
+		return 0, ErrNoData
+	}
+	return level, nil
+}
+
+// MySQLProjectRename is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectRename(projectID int64, newName string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	// so inefficient but whatever, it's a mock
+	found := false
+	for _, projects := range dm.Projects {
+		for i, project := range projects {
+			if project.ProjectID == projectID {
+				projects[i].Name = newName
+				found = true
+			}
+		}
+	}
+	if !found {
+		return ErrNoDbChange
+	}
+	return nil
+}
+
+// MySQLProjectLookup is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectLookup(projectID int64, username string) (name string, permissions map[string]ProjectPermission, err error) {
+	if err = dm.call(); err != nil {
+		return name, permissions, err
+	}
 	permissions = make(map[string]ProjectPermission)
 	for user, projects := range dm.Projects {
 		for _, project := range projects {
@@ -386,109 +1505,779 @@ func (dm *DatabaseMock) MySQLProjectLookup(projectID int64, username string) (na
 			}
 		}
 	}
-	return name, permissions, err
+	return name, permissions, err
+}
+
+// MySQLTeamCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLTeamCreate(username string, teamName string) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	if _, ok := dm.Users[username]; !ok {
+		return -1, ErrNoDbChange
+	}
+	dm.TeamIDCounter++
+	dm.Teams[dm.TeamIDCounter] = TeamMeta{
+		TeamID:  dm.TeamIDCounter,
+		Name:    teamName,
+		Creator: username,
+	}
+	dm.TeamMembers[dm.TeamIDCounter] = []TeamMemberMeta{{Username: username, IsAdmin: true}}
+	return dm.TeamIDCounter, nil
+}
+
+// MySQLTeamAddMember is a mock of the real implementation
+func (dm *DatabaseMock) MySQLTeamAddMember(teamID int64, username string, isAdmin bool, addedByUsername string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if _, ok := dm.Teams[teamID]; !ok {
+		return ErrNoDbChange
+	}
+	if _, ok := dm.Users[username]; !ok {
+		return ErrNoDbChange
+	}
+	for i, member := range dm.TeamMembers[teamID] {
+		if member.Username == username {
+			dm.TeamMembers[teamID][i].IsAdmin = isAdmin
+			return nil
+		}
+	}
+	dm.TeamMembers[teamID] = append(dm.TeamMembers[teamID], TeamMemberMeta{Username: username, IsAdmin: isAdmin})
+	return nil
+}
+
+// MySQLTeamGetMembers is a mock of the real implementation
+func (dm *DatabaseMock) MySQLTeamGetMembers(teamID int64) ([]TeamMemberMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	return dm.TeamMembers[teamID], nil
+}
+
+// MySQLTeamGrantProjectAccess is a mock of the real implementation
+func (dm *DatabaseMock) MySQLTeamGrantProjectAccess(teamID int64, projectID int64, permissionLevel int8, grantedByUsername string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if _, ok := dm.Teams[teamID]; !ok {
+		return ErrNoDbChange
+	}
+	if dm.TeamPermissions[teamID] == nil {
+		dm.TeamPermissions[teamID] = make(map[int64]int8)
+	}
+	dm.TeamPermissions[teamID][projectID] = permissionLevel
+	return nil
+}
+
+// MySQLFileCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileCreate(username string, filename string, relativePath string, projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	dm.FileIDCounter++
+	dm.Files[projectID] = append(
+		dm.Files[projectID],
+		FileMeta{
+			ProjectID:    projectID,
+			CreationDate: time.Now(),
+			Creator:      username,
+			FileID:       dm.FileIDCounter,
+			Filename:     filename,
+			RelativePath: relativePath,
+		})
+	return dm.FileIDCounter, nil
+}
+
+// MySQLFilesCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFilesCreate(files []FileMeta, sizes []int64) ([]int64, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	if len(sizes) != len(files) {
+		return nil, ErrInvalidData
+	}
+	fileIDs := make([]int64, len(files))
+	for i, file := range files {
+		exists := false
+		for _, existing := range dm.Files[file.ProjectID] {
+			if existing.RelativePath == file.RelativePath && existing.Filename == file.Filename {
+				exists = true
+			}
+		}
+		if exists {
+			continue
+		}
+		dm.FileIDCounter++
+		dm.Files[file.ProjectID] = append(
+			dm.Files[file.ProjectID],
+			FileMeta{
+				ProjectID:    file.ProjectID,
+				CreationDate: time.Now(),
+				Creator:      file.Creator,
+				FileID:       dm.FileIDCounter,
+				Filename:     file.Filename,
+				RelativePath: file.RelativePath,
+			})
+		dm.FileSizes[dm.FileIDCounter] = sizes[i]
+		fileIDs[i] = dm.FileIDCounter
+	}
+	return fileIDs, nil
+}
+
+// MySQLFileDelete is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileDelete(fileID int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for projectID, files := range dm.Files {
+		for i, file := range files {
+			if file.FileID == fileID {
+				if len(dm.Files[projectID]) > i+1 {
+					dm.Files[projectID] = append(
+						dm.Files[projectID][:i],
+						dm.Files[projectID][i+1:]...)
+				} else {
+					dm.Files[projectID] = dm.Files[projectID][:i]
+				}
+				delete(dm.FileVersion, fileID)
+				delete(dm.FileSizes, fileID)
+				delete(dm.FileMetadata, fileID)
+				delete(dm.FileHashes, fileID)
+				dm.deleteFileComments(fileID)
+				return nil
+			}
+		}
+	}
+	return ErrNoDbChange
+}
+
+// MySQLFileMove is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileMove(fileID int64, newPath string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for _, files := range dm.Files {
+		for i, file := range files {
+			if file.FileID == fileID {
+				files[i].RelativePath = newPath
+				return nil
+			}
+		}
+	}
+	return ErrNoDbChange
+}
+
+// MySQLFileRename is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileRename(fileID int64, newName string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for _, files := range dm.Files {
+		for i, file := range files {
+			if file.FileID == fileID {
+				files[i].Filename = newName
+				return nil
+			}
+		}
+	}
+	return ErrNoDbChange
+}
+
+// MySQLFileGetInfo is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetInfo(fileID int64) (filey FileMeta, err error) {
+	if err = dm.call(); err != nil {
+		return filey, err
+	}
+	for _, files := range dm.Files {
+		for _, file := range files {
+			if file.FileID == fileID {
+				return file, err
+			}
+		}
+	}
+	// The real implementation finds no rows, rather than failing
+	filey.FileID = fileID
+	return filey, err
+}
+
+// MySQLFileGetByPath is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetByPath(projectID int64, relativePath string, filename string) ([]FileMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	files := []FileMeta{}
+	for _, file := range dm.Files[projectID] {
+		// Compared case-insensitively, like the columns' collation
+		if strings.EqualFold(filepath.Clean(file.RelativePath), filepath.Clean(relativePath)) &&
+			strings.EqualFold(file.Filename, filename) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// MySQLFileList is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileList(afterFileID int64, limit int) ([]FileMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	files := []FileMeta{}
+	for _, projectFiles := range dm.Files {
+		for _, file := range projectFiles {
+			if file.FileID > afterFileID {
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].FileID < files[j].FileID
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, nil
+}
+
+// MySQLFileGetMetadata is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetMetadata(fileID int64) (map[string]string, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]string)
+	for key, value := range dm.FileMetadata[fileID] {
+		metadata[key] = value
+	}
+	return metadata, nil
+}
+
+// MySQLFileSetMetadata is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileSetMetadata(fileID int64, metadata map[string]string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if dm.FileMetadata[fileID] == nil {
+		dm.FileMetadata[fileID] = make(map[string]string)
+	}
+	for key, value := range metadata {
+		if value == "" {
+			delete(dm.FileMetadata[fileID], key)
+		} else {
+			dm.FileMetadata[fileID][key] = value
+		}
+	}
+	return nil
 }
 
-// MySQLFileCreate is a mock of the real implementation
-func (dm *DatabaseMock) MySQLFileCreate(username string, filename string, relativePath string, projectID int64) (int64, error) {
-	dm.FunctionCallCount++
-	dm.FileIDCounter++
-	dm.Files[projectID] = append(
-		dm.Files[projectID],
-		FileMeta{
-			ProjectID:    projectID,
-			CreationDate: time.Now(),
-			Creator:      username,
-			FileID:       dm.FileIDCounter,
-			Filename:     filename,
-			RelativePath: relativePath,
-		})
-	return dm.FileIDCounter, nil
+// MySQLProjectGetFileMetadata is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetFileMetadata(projectID int64) (map[int64]map[string]string, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	metadata := make(map[int64]map[string]string)
+	for _, file := range dm.Files[projectID] {
+		if len(dm.FileMetadata[file.FileID]) == 0 {
+			continue
+		}
+		metadata[file.FileID] = make(map[string]string)
+		for key, value := range dm.FileMetadata[file.FileID] {
+			metadata[file.FileID][key] = value
+		}
+	}
+	return metadata, nil
 }
 
-// MySQLFileDelete is a mock of the real implementation
-func (dm *DatabaseMock) MySQLFileDelete(fileID int64) error {
-	dm.FunctionCallCount++
-	for projectID, files := range dm.Files {
-		for i, file := range files {
-			if file.FileID == fileID {
-				if len(dm.Files[projectID]) > i+1 {
-					dm.Files[projectID] = append(
-						dm.Files[projectID][:i],
-						dm.Files[projectID][i+1:]...)
-				} else {
-					dm.Files[projectID] = dm.Files[projectID][:i]
-				}
-				delete(dm.FileVersion, fileID)
-				return nil
+// MySQLFileAddSize is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileAddSize(fileID int64, delta int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	dm.FileSizes[fileID] += delta
+	if dm.FileSizes[fileID] < 0 {
+		dm.FileSizes[fileID] = 0
+	}
+	return nil
+}
+
+// MySQLFileGetContentHash is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetContentHash(fileID int64) (ContentHashMeta, error) {
+	if err := dm.call(); err != nil {
+		return ContentHashMeta{}, err
+	}
+	return dm.FileHashes[fileID], nil
+}
+
+// MySQLFileSetContentHash is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileSetContentHash(fileID int64, hash ContentHashMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if hash.Version >= dm.FileHashes[fileID].Version {
+		dm.FileHashes[fileID] = hash
+	}
+	return nil
+}
+
+// MySQLProjectGetContentHashes is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetContentHashes(projectID int64) (map[int64]ContentHashMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	hashes := make(map[int64]ContentHashMeta)
+	for _, file := range dm.Files[projectID] {
+		if hash, ok := dm.FileHashes[file.FileID]; ok {
+			hashes[file.FileID] = hash
+		}
+	}
+	return hashes, nil
+}
+
+// MySQLCommentCreate is a mock of the real implementation
+func (dm *DatabaseMock) MySQLCommentCreate(comment CommentMeta) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	dm.CommentIDCounter++
+	comment.CommentID = dm.CommentIDCounter
+	if comment.ThreadID == 0 {
+		comment.ThreadID = comment.CommentID
+	}
+	comment.Created = time.Now()
+	dm.Comments[comment.CommentID] = comment
+	return comment.CommentID, nil
+}
+
+// MySQLCommentGet is a mock of the real implementation
+func (dm *DatabaseMock) MySQLCommentGet(commentID int64) (CommentMeta, error) {
+	if err := dm.call(); err != nil {
+		return CommentMeta{}, err
+	}
+	comment, ok := dm.Comments[commentID]
+	if !ok {
+		return CommentMeta{}, ErrNoData
+	}
+	return comment, nil
+}
+
+// MySQLFileGetComments is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetComments(fileID int64) ([]CommentMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	comments := []CommentMeta{}
+	for _, comment := range dm.Comments {
+		if comment.FileID == fileID {
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].CommentID < comments[j].CommentID })
+	return comments, nil
+}
+
+// MySQLCommentSetAnchor is a mock of the real implementation
+func (dm *DatabaseMock) MySQLCommentSetAnchor(comment CommentMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	stored, ok := dm.Comments[comment.CommentID]
+	if !ok {
+		return nil
+	}
+	stored.Version, stored.Start, stored.End, stored.Outdated = comment.Version, comment.Start, comment.End, comment.Outdated
+	dm.Comments[comment.CommentID] = stored
+	return nil
+}
+
+// MySQLCommentSetResolved is a mock of the real implementation
+func (dm *DatabaseMock) MySQLCommentSetResolved(commentID int64, resolvedBy string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if stored, ok := dm.Comments[commentID]; ok {
+		stored.ResolvedBy = resolvedBy
+		dm.Comments[commentID] = stored
+	}
+	return nil
+}
+
+// MySQLCommentSetReaction is a mock of the real implementation
+func (dm *DatabaseMock) MySQLCommentSetReaction(reaction CommentReactionMeta, remove bool) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	for i, existing := range dm.CommentReactions {
+		if existing == reaction {
+			if remove {
+				dm.CommentReactions = append(dm.CommentReactions[:i:i], dm.CommentReactions[i+1:]...)
 			}
+			return nil
 		}
+	}
+	if !remove {
+		dm.CommentReactions = append(dm.CommentReactions, reaction)
+	}
+	return nil
+}
 
+// MySQLFileGetCommentReactions is a mock of the real implementation
+func (dm *DatabaseMock) MySQLFileGetCommentReactions(fileID int64) ([]CommentReactionMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
 	}
-	return ErrNoDbChange
+	reactions := []CommentReactionMeta{}
+	for _, reaction := range dm.CommentReactions {
+		if dm.Comments[reaction.CommentID].FileID == fileID {
+			reactions = append(reactions, reaction)
+		}
+	}
+	sort.SliceStable(reactions, func(i, j int) bool { return reactions[i].CommentID < reactions[j].CommentID })
+	return reactions, nil
 }
 
-// MySQLFileMove is a mock of the real implementation
-func (dm *DatabaseMock) MySQLFileMove(fileID int64, newPath string) error {
-	dm.FunctionCallCount++
+// deleteFileComments deletes the file's comments, as the MySQL foreign keys do when the file is deleted
+func (dm *DatabaseMock) deleteFileComments(fileID int64) {
+	for commentID, comment := range dm.Comments {
+		if comment.FileID == fileID {
+			delete(dm.Comments, commentID)
+		}
+	}
+	remaining := []CommentReactionMeta{}
+	for _, reaction := range dm.CommentReactions {
+		if _, ok := dm.Comments[reaction.CommentID]; ok {
+			remaining = append(remaining, reaction)
+		}
+	}
+	dm.CommentReactions = remaining
+}
+
+// MySQLNotificationAck is a mock of the real implementation
+func (dm *DatabaseMock) MySQLNotificationAck(username string, projectID int64, sequence int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if dm.NotificationAcks[projectID] == nil {
+		dm.NotificationAcks[projectID] = make(map[string]NotificationAckMeta)
+	}
+	if sequence > dm.NotificationAcks[projectID][username].Sequence {
+		dm.NotificationAcks[projectID][username] = NotificationAckMeta{Username: username, Sequence: sequence, Acked: time.Now()}
+	}
+	return nil
+}
+
+// MySQLProjectGetNotificationAcks is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetNotificationAcks(projectID int64) ([]NotificationAckMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	acks := []NotificationAckMeta{}
+	for _, ack := range dm.NotificationAcks[projectID] {
+		acks = append(acks, ack)
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].Username < acks[j].Username })
+	return acks, nil
+}
+
+// MySQLProjectGetUsage is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetUsage(projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	var usage int64
+	for _, file := range dm.Files[projectID] {
+		usage += dm.FileSizes[file.FileID]
+	}
+	return usage, nil
+}
+
+// MySQLProjectUsageReport is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectUsageReport(maxResults int) ([]ProjectUsageMeta, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	report := []ProjectUsageMeta{}
+	for owner, projects := range dm.Projects {
+		for _, project := range projects {
+			if project.PermissionLevel != config.OwnerRole.Level {
+				continue
+			}
+			usage := ProjectUsageMeta{
+				ProjectID:  project.ProjectID,
+				Name:       project.Name,
+				Owner:      owner,
+				QuotaBytes: dm.ProjectQuotas[project.ProjectID],
+			}
+			for _, file := range dm.Files[project.ProjectID] {
+				usage.UsedBytes += dm.FileSizes[file.FileID]
+			}
+			report = append(report, usage)
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].UsedBytes != report[j].UsedBytes {
+			return report[i].UsedBytes > report[j].UsedBytes
+		}
+		return report[i].ProjectID < report[j].ProjectID
+	})
+	if len(report) > maxResults {
+		report = report[:maxResults]
+	}
+	return report, nil
+}
+
+// MySQLUserGetUsage is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserGetUsage(username string) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	var usage int64
 	for _, files := range dm.Files {
 		for _, file := range files {
-			if file.FileID == fileID {
-				file.RelativePath = newPath
-				return nil
+			if file.Creator == username {
+				usage += dm.FileSizes[file.FileID]
 			}
 		}
+	}
+	return usage, nil
+}
 
+// MySQLUserGetNotificationPrefs is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserGetNotificationPrefs(username string) (NotificationPrefsMeta, error) {
+	if err := dm.call(); err != nil {
+		return NotificationPrefsMeta{}, err
 	}
-	return ErrNoDbChange
+	prefs, ok := dm.NotificationPrefs[username]
+	if !ok {
+		return NotificationPrefsMeta{MutedProjects: []int64{}, MutedEvents: []string{}}, nil
+	}
+	return prefs, nil
 }
 
-// MySQLFileRename is a mock of the real implementation
-func (dm *DatabaseMock) MySQLFileRename(fileID int64, newName string) error {
-	dm.FunctionCallCount++
-	for _, files := range dm.Files {
-		for _, file := range files {
-			if file.FileID == fileID {
-				file.Filename = newName
-				return nil
+// MySQLUserSetNotificationPrefs is a mock of the real implementation
+func (dm *DatabaseMock) MySQLUserSetNotificationPrefs(username string, prefs NotificationPrefsMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if len(prefs.MutedProjects) == 0 && len(prefs.MutedEvents) == 0 {
+		delete(dm.NotificationPrefs, username)
+	} else {
+		dm.NotificationPrefs[username] = prefs
+	}
+	return nil
+}
+
+// MySQLProjectGetQuota is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetQuota(projectID int64) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
+	}
+	return dm.ProjectQuotas[projectID], nil
+}
+
+// MySQLProjectSetQuota is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectSetQuota(projectID int64, quotaBytes int64) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if quotaBytes > 0 {
+		dm.ProjectQuotas[projectID] = quotaBytes
+	} else {
+		delete(dm.ProjectQuotas, projectID)
+	}
+	return nil
+}
+
+// MySQLProjectGetLineEndings is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetLineEndings(projectID int64) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
+	}
+	return dm.ProjectLineEndings[projectID], nil
+}
+
+// MySQLProjectSetLineEndings is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectSetLineEndings(projectID int64, policy string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if policy == "Preserve" {
+		delete(dm.ProjectLineEndings, projectID)
+	} else {
+		dm.ProjectLineEndings[projectID] = policy
+	}
+	return nil
+}
+
+// MySQLProjectGetArchiveState is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetArchiveState(projectID int64) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
+	}
+	return dm.ProjectArchiveStates[projectID], nil
+}
+
+// MySQLProjectSetArchiveState is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectSetArchiveState(projectID int64, state string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if state == "" {
+		delete(dm.ProjectArchiveStates, projectID)
+	} else {
+		dm.ProjectArchiveStates[projectID] = state
+	}
+	return nil
+}
+
+// MySQLProjectGetIgnoreRules is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetIgnoreRules(projectID int64) ([]string, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	rules, ok := dm.ProjectIgnoreRules[projectID]
+	if !ok {
+		return []string{}, nil
+	}
+	return rules, nil
+}
+
+// MySQLProjectSetIgnoreRules is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectSetIgnoreRules(projectID int64, rules []string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		delete(dm.ProjectIgnoreRules, projectID)
+	} else {
+		dm.ProjectIgnoreRules[projectID] = rules
+	}
+	return nil
+}
+
+// MySQLProjectGetSettings is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectGetSettings(projectID int64) (ProjectSettingsMeta, error) {
+	if err := dm.call(); err != nil {
+		return ProjectSettingsMeta{}, err
+	}
+	rules, ok := dm.ProjectIgnoreRules[projectID]
+	if !ok {
+		rules = []string{}
+	}
+	return ProjectSettingsMeta{
+		LineEndings: dm.ProjectLineEndings[projectID],
+		IgnoreRules: rules,
+		QuotaBytes:  dm.ProjectQuotas[projectID],
+		DefaultRole: dm.ProjectSettings[projectID],
+	}, nil
+}
+
+// MySQLProjectSetSettings is a mock of the real implementation
+func (dm *DatabaseMock) MySQLProjectSetSettings(projectID int64, settings ProjectSettingsMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if settings.LineEndings == "" {
+		delete(dm.ProjectLineEndings, projectID)
+	} else {
+		dm.ProjectLineEndings[projectID] = settings.LineEndings
+	}
+	if len(settings.IgnoreRules) == 0 {
+		delete(dm.ProjectIgnoreRules, projectID)
+	} else {
+		dm.ProjectIgnoreRules[projectID] = settings.IgnoreRules
+	}
+	if settings.QuotaBytes > 0 {
+		dm.ProjectQuotas[projectID] = settings.QuotaBytes
+	} else {
+		delete(dm.ProjectQuotas, projectID)
+	}
+	if settings.DefaultRole == "" {
+		delete(dm.ProjectSettings, projectID)
+	} else {
+		dm.ProjectSettings[projectID] = settings.DefaultRole
+	}
+	return nil
+}
+
+// MySQLExternalIDsGet is a mock of the real implementation. Resources are given their ExternalID when it is first read.
+func (dm *DatabaseMock) MySQLExternalIDsGet(resource string, ids []int64) (map[int64]string, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	if resource != "Project" && resource != "File" {
+		return nil, ErrInvalidData
+	}
+	if dm.ExternalIDs[resource] == nil {
+		dm.ExternalIDs[resource] = make(map[int64]string)
+	}
+	externalIDs := make(map[int64]string)
+	for _, id := range ids {
+		if !dm.resourceExists(resource, id) {
+			continue
+		}
+		if _, ok := dm.ExternalIDs[resource][id]; !ok {
+			raw := make([]byte, 16)
+			if _, err := rand.Read(raw); err != nil {
+				return nil, err
 			}
+			raw[6] = raw[6]&0x0f | 0x40
+			raw[8] = raw[8]&0x3f | 0x80
+			dm.ExternalIDs[resource][id] = fmt.Sprintf("%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:])
 		}
+		externalIDs[id] = dm.ExternalIDs[resource][id]
+	}
+	return externalIDs, nil
+}
 
+// MySQLExternalIDResolve is a mock of the real implementation
+func (dm *DatabaseMock) MySQLExternalIDResolve(resource string, externalID string) (int64, error) {
+	if err := dm.call(); err != nil {
+		return -1, err
 	}
-	return ErrNoDbChange
+	for id, stored := range dm.ExternalIDs[resource] {
+		if stored == externalID && dm.resourceExists(resource, id) {
+			return id, nil
+		}
+	}
+	return -1, ErrNoData
 }
 
-// MySQLFileGetInfo is a mock of the real implementation
-func (dm *DatabaseMock) MySQLFileGetInfo(fileID int64) (filey FileMeta, err error) {
-	dm.FunctionCallCount++
+func (dm *DatabaseMock) resourceExists(resource string, id int64) bool {
+	if resource == "Project" {
+		return dm.projectName(id) != ""
+	}
 	for _, files := range dm.Files {
 		for _, file := range files {
-			if file.FileID == fileID {
-				return file, err
+			if file.FileID == id {
+				return true
 			}
 		}
-
 	}
-	return filey, err
+	return false
 }
 
 // FileWrite is a mock of the real implementation
 func (dm *DatabaseMock) FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return "", err
+	}
 	dm.File = &raw
 	return "./this_path_shouldnt_be_used_anywhere", nil
 }
 
 // FileDelete is a mock of the real implementation
 func (dm *DatabaseMock) FileDelete(relpath string, filename string, projectID int64) error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	dm.File = nil
 	return nil
 }
 
 // FileRead is a mock of the real implementation
 func (dm *DatabaseMock) FileRead(relpath string, filename string, projectID int64) (*[]byte, error) {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
 	if dm.File == nil {
 		dm.File = &[]byte{}
 	}
@@ -497,14 +2286,111 @@ func (dm *DatabaseMock) FileRead(relpath string, filename string, projectID int6
 
 // FileMove moves a file form the starting path to the end path
 func (dm *DatabaseMock) FileMove(startRelpath string, startFilename string, endRelpath string, endFilename string, projectID int64) error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	// we only keep track of one file anyway
 	return nil
 }
 
 // FileWriteToSwap writes the swapfile for the file with the given info
 func (dm *DatabaseMock) FileWriteToSwap(meta FileMeta, raw []byte) error {
-	dm.FunctionCallCount++
+	if err := dm.call(); err != nil {
+		return err
+	}
 	dm.Swp = &raw
 	return nil
 }
+
+// FileVerify is a mock of the real implementation
+func (dm *DatabaseMock) FileVerify(meta FileMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	return dm.FileIntegrityErrors[meta.FileID]
+}
+
+// FileReadSwap is a mock of the real implementation
+func (dm *DatabaseMock) FileReadSwap(meta FileMeta) (*[]byte, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	if dm.Swp == nil {
+		return nil, ErrNoData
+	}
+	return dm.Swp, nil
+}
+
+// FileRestoreFromSwap is a mock of the real implementation
+func (dm *DatabaseMock) FileRestoreFromSwap(meta FileMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if dm.Swp == nil {
+		return ErrNoData
+	}
+	dm.File = dm.Swp
+	delete(dm.FileIntegrityErrors, meta.FileID)
+	return nil
+}
+
+// FileArchive is a mock of the real implementation. File contents are shared by every file in the mock, so only
+// versions and changes are archived.
+func (dm *DatabaseMock) FileArchive(meta FileMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	if _, ok := dm.ArchivedFiles[meta.FileID]; ok {
+		return nil
+	}
+	dm.ArchivedFiles[meta.FileID] = dm.FileVersion[meta.FileID]
+	delete(dm.FileVersion, meta.FileID)
+	delete(dm.FileChanges, meta.FileID)
+	return nil
+}
+
+// FileUnarchive is a mock of the real implementation
+func (dm *DatabaseMock) FileUnarchive(meta FileMeta) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	version, ok := dm.ArchivedFiles[meta.FileID]
+	if !ok {
+		return nil
+	}
+	dm.FileVersion[meta.FileID] = version
+	dm.FileChanges[meta.FileID] = []string{}
+	delete(dm.ArchivedFiles, meta.FileID)
+	return nil
+}
+
+// AvatarWrite is a mock of the real implementation
+func (dm *DatabaseMock) AvatarWrite(username string, raw []byte) (string, error) {
+	if err := dm.call(); err != nil {
+		return "", err
+	}
+	dm.Avatars[username] = raw
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AvatarRead is a mock of the real implementation
+func (dm *DatabaseMock) AvatarRead(username string) ([]byte, error) {
+	if err := dm.call(); err != nil {
+		return nil, err
+	}
+	raw, ok := dm.Avatars[username]
+	if !ok {
+		return nil, ErrNoData
+	}
+	return raw, nil
+}
+
+// AvatarDelete is a mock of the real implementation
+func (dm *DatabaseMock) AvatarDelete(username string) error {
+	if err := dm.call(); err != nil {
+		return err
+	}
+	delete(dm.Avatars, username)
+	return nil
+}
@@ -0,0 +1,154 @@
+package dbfs
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Fault injection for DatabaseMock, so that tests can exercise the paths taken when the database misbehaves: any call
+ * can be made to fail or to be slow, and appends to a file can be made to lose the race with another client's change.
+ * Functions are named as they are in DBFS, such as "MySQLFileCreate".
+ */
+
+// ErrInjectedFault is returned by calls made to fail without a particular error
+var ErrInjectedFault = newError(CategoryUnavailable, true, "Injected database fault")
+
+// mockFaults is the fault injection state of a DatabaseMock
+type mockFaults struct {
+	mutex     sync.Mutex
+	calls     map[string]int           // Function -> number of calls made
+	failures  map[string][]mockFailure // Function -> failures still to happen
+	latency   map[string]time.Duration // Function -> delay; "" delays every function
+	conflicts map[int64]int            // FileID -> number of appends still to conflict
+}
+
+type mockFailure struct {
+	call int // The call that fails, counting every call to the function; 0 fails every call
+	err  error
+}
+
+// FailCall makes the nth call to the function from now fail with the given error, or ErrInjectedFault if it is nil.
+// If n is 0, every call fails until ClearFaults.
+func (dm *DatabaseMock) FailCall(function string, n int, err error) {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	if err == nil {
+		err = ErrInjectedFault
+	}
+	if dm.faults.failures == nil {
+		dm.faults.failures = make(map[string][]mockFailure)
+	}
+	failure := mockFailure{err: err}
+	if n > 0 {
+		failure.call = dm.faults.calls[function] + n
+	}
+	dm.faults.failures[function] = append(dm.faults.failures[function], failure)
+}
+
+// SetLatency delays every call to the function by the given duration, or every call to any function if function is
+// empty. A latency of 0 removes the delay.
+func (dm *DatabaseMock) SetLatency(function string, latency time.Duration) {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	if dm.faults.latency == nil {
+		dm.faults.latency = make(map[string]time.Duration)
+	}
+	if latency > 0 {
+		dm.faults.latency[function] = latency
+	} else {
+		delete(dm.faults.latency, function)
+	}
+}
+
+// ConflictFileChanges makes the next n changes appended to the file fail with ErrVersionOutOfDate, as if another
+// client's change had been appended first.
+func (dm *DatabaseMock) ConflictFileChanges(fileID int64, n int) {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	if dm.faults.conflicts == nil {
+		dm.faults.conflicts = make(map[int64]int)
+	}
+	dm.faults.conflicts[fileID] += n
+}
+
+// ClearFaults removes every injected failure, delay and conflict. Call counts are kept.
+func (dm *DatabaseMock) ClearFaults() {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	dm.faults.failures = nil
+	dm.faults.latency = nil
+	dm.faults.conflicts = nil
+}
+
+// CallCount returns the number of calls made to the function
+func (dm *DatabaseMock) CallCount(function string) int {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	return dm.faults.calls[function]
+}
+
+// call records a call to the DatabaseMock function calling it, returning the error it should fail with, if any
+func (dm *DatabaseMock) call() error {
+	function := callerName()
+
+	dm.faults.mutex.Lock()
+	dm.FunctionCallCount++
+	if dm.faults.calls == nil {
+		dm.faults.calls = make(map[string]int)
+	}
+	dm.faults.calls[function]++
+	callNum := dm.faults.calls[function]
+
+	latency, ok := dm.faults.latency[function]
+	if !ok {
+		latency = dm.faults.latency[""]
+	}
+
+	var err error
+	failures := dm.faults.failures[function]
+	for i, failure := range failures {
+		if failure.call == 0 || failure.call == callNum {
+			err = failure.err
+			if failure.call != 0 {
+				dm.faults.failures[function] = append(failures[:i:i], failures[i+1:]...)
+			}
+			break
+		}
+	}
+	dm.faults.mutex.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return err
+}
+
+// conflict returns true if a change appended to the file should conflict, consuming it
+func (dm *DatabaseMock) conflict(fileID int64) bool {
+	dm.faults.mutex.Lock()
+	defer dm.faults.mutex.Unlock()
+
+	if dm.faults.conflicts[fileID] <= 0 {
+		return false
+	}
+	dm.faults.conflicts[fileID]--
+	return true
+}
+
+// callerName returns the name of the method that called the function calling it
+func callerName() string {
+	pcs := make([]uintptr, 1)
+	if runtime.Callers(3, pcs) == 0 {
+		return ""
+	}
+	frame, _ := runtime.CallersFrames(pcs).Next()
+	return frame.Function[strings.LastIndex(frame.Function, ".")+1:]
+}
@@ -0,0 +1,109 @@
+package dbfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatabaseMock_FailCall(t *testing.T) {
+	dm := NewDBMock()
+	require.NoError(t, dm.MySQLUserRegister(UserMeta{Username: "loganga"}))
+
+	// Only the second call from now fails
+	errBroken := errors.New("broken")
+	dm.FailCall("MySQLProjectCreate", 2, errBroken)
+	_, err := dm.MySQLProjectCreate("loganga", "a")
+	assert.NoError(t, err)
+	_, err = dm.MySQLProjectCreate("loganga", "b")
+	assert.Equal(t, errBroken, err)
+	_, err = dm.MySQLProjectCreate("loganga", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dm.CallCount("MySQLProjectCreate"))
+
+	// Failed calls are still counted, and don't change anything
+	projects, err := dm.MySQLUserProjects("loganga")
+	require.NoError(t, err)
+	assert.Len(t, projects, 2)
+	assert.Equal(t, 5, dm.FunctionCallCount)
+
+	dm.FailCall("MySQLUserLookup", 0, nil)
+	for i := 0; i < 3; i++ {
+		_, err = dm.MySQLUserLookup("loganga")
+		assert.Equal(t, ErrInjectedFault, err)
+	}
+	dm.ClearFaults()
+	_, err = dm.MySQLUserLookup("loganga")
+	assert.NoError(t, err)
+}
+
+func TestDatabaseMock_SetLatency(t *testing.T) {
+	dm := NewDBMock()
+	dm.SetLatency("", 20*time.Millisecond)
+	dm.SetLatency("CBGetFileVersion", 0)
+
+	start := time.Now()
+	dm.MySQLProjectGetQuota(1)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond, "every function should be delayed")
+
+	dm.SetLatency("CBGetFileVersion", time.Millisecond)
+	start = time.Now()
+	dm.CBGetFileVersion(1)
+	assert.True(t, time.Since(start) < 20*time.Millisecond, "a function's own latency should take precedence")
+}
+
+func TestDatabaseMock_ConflictFileChanges(t *testing.T) {
+	dm := NewDBMock()
+	require.NoError(t, dm.CBInsertNewFile(1, 1, []string{}))
+	file := FileMeta{FileID: 1}
+
+	dm.ConflictFileChanges(1, 1)
+	_, _, _, _, err := dm.CBAppendFileChange(file, "v1:\n0:+1:a:\n0")
+	assert.Equal(t, ErrVersionOutOfDate, err)
+	_, version, _, _, err := dm.CBAppendFileChange(file, "v1:\n0:+1:a:\n0")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, version)
+}
+
+func TestDatabaseMock_Parity(t *testing.T) {
+	dm := NewDBMock()
+	require.NoError(t, dm.MySQLUserRegister(UserMeta{Username: "loganga"}))
+	require.NoError(t, dm.MySQLUserRegister(UserMeta{Username: "jshap70"}))
+	projectID, err := dm.MySQLProjectCreate("loganga", "hi")
+	require.NoError(t, err)
+	otherID, err := dm.MySQLProjectCreate("jshap70", "other")
+	require.NoError(t, err)
+	require.NoError(t, dm.MySQLProjectGrantPermission(projectID, "jshap70", 1, "loganga"))
+	require.NoError(t, dm.MySQLProjectGrantPermission(projectID, "jshap70", 4, "loganga"))
+
+	// Changes are made to the stored rows, not to copies of them
+	require.NoError(t, dm.MySQLProjectRename(projectID, "renamed"))
+	level, err := dm.MySQLUserProjectPermissionLookup(projectID, "jshap70")
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, level)
+
+	fileID, err := dm.MySQLFileCreate("loganga", "a.txt", ".", projectID)
+	require.NoError(t, err)
+	require.NoError(t, dm.MySQLFileMove(fileID, "src"))
+	require.NoError(t, dm.MySQLFileRename(fileID, "b.txt"))
+	file, err := dm.MySQLFileGetInfo(fileID)
+	require.NoError(t, err)
+	assert.Equal(t, "src", file.RelativePath)
+	assert.Equal(t, "b.txt", file.Filename)
+
+	// Deleting a project removes it, and its files, from everyone, leaving other projects alone
+	require.NoError(t, dm.MySQLProjectDelete(projectID, "loganga"))
+	assert.Equal(t, ErrNoDbChange, dm.MySQLProjectDelete(projectID, "loganga"))
+	projects, err := dm.MySQLUserProjects("jshap70")
+	require.NoError(t, err)
+	require.Len(t, projects, 1)
+	assert.Equal(t, otherID, projects[0].ProjectID)
+	assert.Empty(t, dm.Files[projectID])
+
+	file, err = dm.MySQLFileGetInfo(fileID)
+	require.NoError(t, err)
+	assert.Equal(t, FileMeta{FileID: fileID}, file)
+}
@@ -1,10 +1,102 @@
 package dbfs
 
-// Dbfs is the globally used dbfs object for the server
-var Dbfs DBFS
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// DocumentStore is the document database the server keeps files' changes and projects' notifications in. It is
+// implemented by DatabaseImpl, with Couchbase, and by MemoryDocumentStore; others can be registered with
+// RegisterDocumentStore. Implementations must pass the conformance tests in the documentstoretest package.
+type DocumentStore interface {
+	// CBInsertNewFile inserts a new document with the given arguments
+	CBInsertNewFile(fileID int64, version int64, changes []string) error
+
+	// CBDeleteFile deletes the document with FileID == fileID from couchbase
+	CBDeleteFile(fileID int64) error
+
+	// CBInsertNewFiles inserts a new document with no changes at the given version for each of the fileIDs, in batches
+	// rather than one round-trip per file
+	CBInsertNewFiles(fileIDs []int64, version int64) error
+
+	// CBDeleteFiles deletes the documents of each of the fileIDs from couchbase, in batches; files without a document are
+	// skipped
+	CBDeleteFiles(fileIDs []int64) error
+
+	// CBGetFileVersion returns the current version of the file for the given FileID
+	CBGetFileVersion(fileID int64) (int64, error)
+
+	// CBAppendFileChange mutates the file document with the new change and sets the new version number
+	// Returns the new version number, the missing patches, the total count of patches tracked, and an error, if any.
+	// Changes based on a version after the file's, or before its earliest patch, fail with ErrVersionOutOfDate.
+	CBAppendFileChange(file FileMeta, patches string) (string, int64, []string, int, error)
+
+	// CBRewriteFileChanges replaces each of the file's stored patches with what rewrite returns for it, without changing
+	// the file's version, such as to erase their authorship. Returns the number of patches that were changed.
+	CBRewriteFileChanges(fileID int64, rewrite func(change string) string) (int, error)
+
+	// CBGetFileChanges returns the file's changes that have not been scrunched into its contents, oldest first, and its
+	// version
+	CBGetFileChanges(fileID int64) ([]string, int64, error)
+
+	// CBRemoveFileChanges removes the file's oldest num changes, once they have been scrunched into its contents.
+	// Returns ErrNoDbChange if it has fewer.
+	CBRemoveFileChanges(fileID int64, num int) error
+
+	// CBNextNotificationSequence returns the next sequence number of the project's notifications, starting from 1
+	CBNextNotificationSequence(projectID int64) (int64, error)
+
+	// CBInsertNotification stores the project's notification with the given sequence number, for notificationRetention
+	CBInsertNotification(projectID int64, sequence int64, notification json.RawMessage) error
+
+	// CBGetNotificationsSince returns the project's stored notifications after the given sequence number, in order, up
+	// to the first that has not been stored yet. Returns ErrVersionOutOfDate if the notification after the given
+	// sequence number is no longer stored, or more than maxNotificationsSince notifications have been sent since.
+	CBGetNotificationsSince(projectID int64, sequence int64) ([]json.RawMessage, error)
+
+	// CBGetNotificationSequence returns the sequence number of the project's latest notification; 0 if it has sent none
+	CBGetNotificationSequence(projectID int64) (int64, error)
+}
+
+// FileStore is the storage the server keeps files' contents in, as of their last scrunch, along with the swap files
+// scrunches write them to first. Paths are relative to the project's directory, and those leading out of it are
+// refused with ErrMaliciousRequest. It is implemented by DatabaseImpl, on the local filesystem; others can be
+// registered with RegisterFileStore. Implementations must pass the conformance tests in the filestoretest package.
+type FileStore interface {
+	// FileWrite writes the file with the given bytes to a calculated path, and
+	// returns that path so it can be put in MySQL
+	FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error)
+
+	// FileRead returns the contents of the file
+	FileRead(relpath string, filename string, projectID int64) (*[]byte, error)
+
+	// FileDelete deletes the file with the given metadata from the file system
+	// Couple this with dbfs.MySQLFileDelete and dbfs.CBDeleteFile
+	FileDelete(relpath string, filename string, projectID int64) error
+
+	// FileMove moves a file form the starting path to the end path
+	FileMove(startRelpath string, startFilename string, endRelpath string, endFilename string, projectID int64) error
+
+	// FileWriteToSwap writes the swapfile for the file with the given info
+	FileWriteToSwap(meta FileMeta, raw []byte) error
+
+	// FileReadSwap returns the contents last written to the file's swap file. Returns ErrNoData if it has none
+	FileReadSwap(meta FileMeta) (*[]byte, error)
+
+	// FileVerify checks that the file exists, and that its contents match their checksum. Returns ErrFileMissing or
+	// ErrChecksumMismatch if not.
+	FileVerify(meta FileMeta) error
+
+	// FileRestoreFromSwap replaces the file with its swap file, if there is an intact one; ErrNoData if there isn't
+	FileRestoreFromSwap(meta FileMeta) error
+}
 
 // DBFS is the interface which maps all of the necessary database and file system functions
 type DBFS interface {
+	// WithContext returns a DBFS sharing this one's connections, whose operations are abandoned once ctx is done
+	WithContext(ctx context.Context) DBFS
+
 	// multi
 
 	// ScrunchFile scrunches the file for the given metadata. All new changes called while scrunching is
@@ -32,18 +124,7 @@ type DBFS interface {
 	// YOU PROBABLY DON'T NEED TO RUN THIS EVER
 	CloseCouchbase() error
 
-	// CBInsertNewFile inserts a new document with the given arguments
-	CBInsertNewFile(fileID int64, version int64, changes []string) error
-
-	// CBDeleteFile deletes the document with FileID == fileID from couchbase
-	CBDeleteFile(fileID int64) error
-
-	// CBGetFileVersion returns the current version of the file for the given FileID
-	CBGetFileVersion(fileID int64) (int64, error)
-
-	// CBAppendFileChange mutates the file document with the new change and sets the new version number
-	// Returns the new version number, the missing patches, the total count of patches tracked, and an error, if any.
-	CBAppendFileChange(file FileMeta, patches string) (string, int64, []string, int, error)
+	DocumentStore
 
 	// MySQL
 
@@ -57,6 +138,150 @@ type DBFS interface {
 	// MySQLUserGetPass is used to get the key and hash of a stored password to verify that a value is correct
 	MySQLUserGetPass(username string) (password string, err error)
 
+	// MySQLUserSetPass replaces the stored password hash for the given user
+	MySQLUserSetPass(username string, password string) error
+
+	// MySQLUserSetEmailVerified marks the given user's email address as verified
+	MySQLUserSetEmailVerified(username string) error
+
+	// MySQLUserSetUnlisted sets whether the user is hidden from MySQLUserSearch, other than by their exact username
+	MySQLUserSetUnlisted(username string, unlisted bool) error
+
+	// MySQLUserSearch returns up to maxResults users whose username, email, first or last name starts with the prefix,
+	// with only their Username, FirstName and LastName, ordered by username after the user whose username is the prefix
+	MySQLUserSearch(prefix string, maxResults int) ([]UserMeta, error)
+
+	// MySQLUserUpdateProfile replaces the user's first and last name
+	MySQLUserUpdateProfile(username string, firstName string, lastName string) error
+
+	// MySQLUserSetAvatar records the hash of the user's avatar, as returned by AvatarWrite; "" if they have none
+	MySQLUserSetAvatar(username string, avatarHash string) error
+
+	// MySQLUserChangeUsername renames the user everywhere their username is referenced, keeping the old username as an
+	// alias of the new one. Returns ErrNoDbChange if the user doesn't exist, or the new username is another user's, or
+	// was another user's
+	MySQLUserChangeUsername(oldUsername string, newUsername string) error
+
+	// MySQLUserResolveAlias returns the current username of the user who had the given username.
+	// Returns ErrNoData if no user changed their username from it
+	MySQLUserResolveAlias(alias string) (username string, err error)
+
+	// MySQLUserAliases returns the usernames the user changed from, oldest first
+	MySQLUserAliases(username string) ([]string, error)
+
+	// MySQLUserTokenCreate stores the hash of a single-use token for the given user and purpose, replacing any
+	// previous token for that purpose
+	MySQLUserTokenCreate(username string, tokenHash string, purpose string, validity time.Duration) error
+
+	// MySQLUserTokenConsume deletes the token with the given hash, and returns the user it was issued to.
+	// Returns ErrNoData if the token does not exist, has expired, or was issued for a different purpose
+	MySQLUserTokenConsume(tokenHash string, purpose string) (username string, err error)
+
+	// MySQLAPITokenCreate stores the hash of a new API token, returning its ID. A validity of 0 never expires
+	MySQLAPITokenCreate(tokenHash string, token APITokenMeta, validity time.Duration) (tokenID int64, err error)
+
+	// MySQLAPITokenLookup returns the API token with the given hash.
+	// Returns ErrNoData if the token does not exist or has expired
+	MySQLAPITokenLookup(tokenHash string) (APITokenMeta, error)
+
+	// MySQLAPITokenRevoke deletes the given user's API token with the given ID
+	MySQLAPITokenRevoke(tokenID int64, username string) error
+
+	// MySQLExternalIdentityLookup returns the user linked to the given external provider's subject.
+	// Returns ErrNoData if no user has been linked
+	MySQLExternalIdentityLookup(provider string, subject string) (username string, err error)
+
+	// MySQLExternalIdentityLink links the given external provider's subject to a user
+	MySQLExternalIdentityLink(provider string, subject string, username string) error
+
+	// MySQLSessionSubscriptionSet records the subscription in the session registry, replacing any previous bindings
+	// for the same session and key. Subscriptions expire once they have not been set for the validity period.
+	MySQLSessionSubscriptionSet(sub SessionSubscriptionMeta, validity time.Duration) error
+
+	// MySQLSessionSubscriptionRemove removes the session's subscription to the given key
+	MySQLSessionSubscriptionRemove(sessionID string, key string) error
+
+	// MySQLSessionGetSubscriptions returns the session's subscriptions that were set within the validity period
+	MySQLSessionGetSubscriptions(sessionID string, validity time.Duration) ([]SessionSubscriptionMeta, error)
+
+	// MySQLSessionTouch keeps the session's subscriptions from expiring, while its connection is open
+	MySQLSessionTouch(sessionID string) error
+
+	// MySQLSessionDelete removes all of the session's subscriptions
+	MySQLSessionDelete(sessionID string) error
+
+	// MySQLUserSessionRecord records that the user made a request on the session's connection, and forgets the user's
+	// sessions whose connections have not been touched since forgetBefore, and revoked sessions whose token expired
+	MySQLUserSessionRecord(session UserSessionMeta, forgetBefore time.Time) error
+
+	// MySQLUserSessionList returns the user's sessions that are not revoked, and whose connections have been touched
+	// since activeSince, most recently active first
+	MySQLUserSessionList(username string, activeSince time.Time) ([]UserSessionMeta, error)
+
+	// MySQLUserSessionRevoke revokes the user's session, whose token is then refused until it expires. Returns
+	// ErrNoDbChange if the user has no such session.
+	MySQLUserSessionRevoke(username string, sessionID string) error
+
+	// MySQLUserSessionTokenRevoked returns whether the session token with the given hash belongs to a revoked session
+	MySQLUserSessionTokenRevoked(tokenHash string) (bool, error)
+
+	// MySQLUserSessionEnd forgets the session once its connection closes, unless it was revoked
+	MySQLUserSessionEnd(sessionID string) error
+
+	// MySQLIdempotentRequestGet returns the outcome recorded for the user's idempotency key within the validity period.
+	// Returns ErrNoData if there is none
+	MySQLIdempotentRequestGet(username string, key string, validity time.Duration) (IdempotentRequestMeta, error)
+
+	// MySQLIdempotentRequestReserve records that a request with the user's idempotency key is being processed, with a
+	// Status of 0. Returns false if the key has already been used within the validity period, unless it is only
+	// reserved, and was reserved longer than the lease ago, in which case the reservation is taken over
+	MySQLIdempotentRequestReserve(username string, key string, method string, validity time.Duration,
+		lease time.Duration) (bool, error)
+
+	// MySQLIdempotentRequestSet records the outcome of the request that reserved the user's idempotency key
+	MySQLIdempotentRequestSet(req IdempotentRequestMeta) error
+
+	// MySQLIdempotentRequestRelease removes the user's idempotency key, so that the request can be retried
+	MySQLIdempotentRequestRelease(username string, key string) error
+
+	// MySQLAuditLogAppend adds an entry to the audit log; AuditID and Time are set by the database
+	MySQLAuditLogAppend(entry AuditEntryMeta) error
+
+	// MySQLAuditLogQuery returns the entries of the audit log matching the filter, oldest first
+	MySQLAuditLogQuery(filter AuditLogFilter) ([]AuditEntryMeta, error)
+
+	// MySQLInstanceHeartbeat records that the server instance is running, and forgets instances that have not sent a
+	// heartbeat since forgetBefore. Returns whether the instance has been asked to drain.
+	MySQLInstanceHeartbeat(instance InstanceMeta, forgetBefore time.Time) (bool, error)
+
+	// MySQLInstanceList returns every registered server instance, ordered by name
+	MySQLInstanceList() ([]InstanceMeta, error)
+
+	// MySQLInstanceSetDraining sets whether the server instance should stop accepting new connections. Returns
+	// ErrNoDbChange if there is no such instance
+	MySQLInstanceSetDraining(instanceID string, draining bool) error
+
+	// MySQLInstanceDelete removes the server instance from the registry, such as when it shuts down
+	MySQLInstanceDelete(instanceID string) error
+
+	// MySQLMaintenanceGet returns whether the servers are in maintenance mode, as admins last set it
+	MySQLMaintenanceGet() (MaintenanceMeta, error)
+
+	// MySQLMaintenanceSet sets whether the servers are in maintenance mode; SetAt is set by the database
+	MySQLMaintenanceSet(maintenance MaintenanceMeta) error
+
+	// MySQLChangeFeedCursorGet returns the sequence number of the last of the project's notifications the change feed
+	// exported; 0 if it has exported none
+	MySQLChangeFeedCursorGet(projectID int64) (int64, error)
+
+	// MySQLChangeFeedCursorAdvance moves the project's change feed cursor from one sequence number to another, returning
+	// false if the cursor was no longer at fromSequence, because another server advanced it first
+	MySQLChangeFeedCursorAdvance(projectID int64, fromSequence int64, toSequence int64) (bool, error)
+
+	// MySQLLockAcquire takes the named lock shared by every server, waiting up to wait for another holder to release
+	// it. Returns ErrLockHeld if it is still held after the wait
+	MySQLLockAcquire(name string, wait time.Duration) (Lock, error)
+
 	// MySQLUserDelete deletes a user from MySQL
 	MySQLUserDelete(username string) ([]int64, error)
 
@@ -75,6 +300,11 @@ type DBFS interface {
 	// MySQLProjectGetFiles returns the Files from the project with projectID = projectID
 	MySQLProjectGetFiles(projectID int64) (files []FileMeta, err error)
 
+	// MySQLProjectGetFilesFiltered returns the Files from the project in the directory, or its subdirectories, with names
+	// matching the glob, in which '*' matches any characters and '?' matches one. An empty directory matches the whole
+	// project. Like MySQLFileGetByPath, paths and names are compared ignoring case.
+	MySQLProjectGetFilesFiltered(projectID int64, directory string, glob string) ([]FileMeta, error)
+
 	// MySQLProjectGrantPermission gives the user `grantUsername` the permission `permissionLevel` on project `projectID`
 	MySQLProjectGrantPermission(projectID int64, grantUsername string, permissionLevel int8, grantedByUsername string) error
 
@@ -82,19 +312,37 @@ type DBFS interface {
 	// DOES NOT WORK FOR OWNER (which is kinda a good thing)
 	MySQLProjectRevokePermission(projectID int64, revokeUsername string, revokedByUsername string) error
 
-	// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID
+	// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID,
+	// which is the highest of their own permission, and those granted to any of their teams
 	MySQLUserProjectPermissionLookup(projectID int64, username string) (int8, error)
 
 	// MySQLProjectRename allows for you to rename projects
 	MySQLProjectRename(projectID int64, newName string) error
 
-	// MySQLProjectLookup returns the project name and permissions for a project with ProjectID = 'projectID'
+	// MySQLProjectLookup returns the project name and permissions for a project with ProjectID = 'projectID'. Returns
+	// ErrNoData unless `username` has access to it; an empty username looks the project up for a server admin.
 	// NOTE: There's an important to do on the DatabaseImpl version of this
 	MySQLProjectLookup(projectID int64, username string) (name string, permissions map[string]ProjectPermission, err error)
 
+	// MySQLTeamCreate creates a new team, with the creator as its first admin
+	MySQLTeamCreate(username string, teamName string) (teamID int64, err error)
+
+	// MySQLTeamAddMember adds the user to the team, or updates their admin flag if they are already a member
+	MySQLTeamAddMember(teamID int64, username string, isAdmin bool, addedByUsername string) error
+
+	// MySQLTeamGetMembers returns the members of the team
+	MySQLTeamGetMembers(teamID int64) ([]TeamMemberMeta, error)
+
+	// MySQLTeamGrantProjectAccess gives every member of the team the permission `permissionLevel` on project `projectID`
+	MySQLTeamGrantProjectAccess(teamID int64, projectID int64, permissionLevel int8, grantedByUsername string) error
+
 	// MySQLFileCreate create a new file in MySQL
 	MySQLFileCreate(username string, filename string, relativePath string, projectID int64) (fileID int64, err error)
 
+	// MySQLFilesCreate creates each of the files, with sizes[i] as the size of files[i], in batches rather than one
+	// round-trip per file. It returns the ID of each of the files, in order, or 0 for files that already exist.
+	MySQLFilesCreate(files []FileMeta, sizes []int64) (fileIDs []int64, err error)
+
 	// MySQLFileDelete deletes a file from the MySQL database
 	// this does not delete the actual file
 	MySQLFileDelete(fileID int64) error
@@ -108,19 +356,135 @@ type DBFS interface {
 	// MySQLFileGetInfo returns the meta data about the given file
 	MySQLFileGetInfo(fileID int64) (FileMeta, error)
 
+	// MySQLFileGetByPath returns the meta data about the files with the given path and name in the project. Paths and
+	// names are compared ignoring case, as the columns' collation does, so callers that need an exact match must
+	// check the results.
+	MySQLFileGetByPath(projectID int64, relativePath string, filename string) ([]FileMeta, error)
+
+	// MySQLFileList returns up to limit files, across all projects, with FileIDs greater than afterFileID, in order
+	MySQLFileList(afterFileID int64, limit int) ([]FileMeta, error)
+
+	// MySQLFileGetMetadata returns the client-defined key/value metadata of the given file
+	MySQLFileGetMetadata(fileID int64) (map[string]string, error)
+
+	// MySQLFileSetMetadata sets the given metadata keys on the file; keys with empty values are removed
+	MySQLFileSetMetadata(fileID int64, metadata map[string]string) error
+
+	// MySQLProjectGetFileMetadata returns the metadata of every file in the project that has any, keyed by fileID
+	MySQLProjectGetFileMetadata(projectID int64) (map[int64]map[string]string, error)
+
+	// MySQLFileAddSize adds delta to the stored size of the file, in bytes; the size never goes below zero
+	MySQLFileAddSize(fileID int64, delta int64) error
+
+	// MySQLFileGetContentHash returns the hash of the file's text at the latest version it has been computed for
+	MySQLFileGetContentHash(fileID int64) (ContentHashMeta, error)
+
+	// MySQLFileSetContentHash records the hash of the file's text at the given version, unless a later version's is
+	// already recorded
+	MySQLFileSetContentHash(fileID int64, hash ContentHashMeta) error
+
+	// MySQLProjectGetContentHashes returns the recorded hash of every file in the project that has one, keyed by fileID
+	MySQLProjectGetContentHashes(projectID int64) (map[int64]ContentHashMeta, error)
+
+	// MySQLCommentCreate creates the comment, starting a thread if its ThreadID is 0, and returns its CommentID
+	MySQLCommentCreate(comment CommentMeta) (int64, error)
+
+	// MySQLCommentGet returns the comment; returns ErrNoData if it does not exist
+	MySQLCommentGet(commentID int64) (CommentMeta, error)
+
+	// MySQLFileGetComments returns every comment on the file, in the order they were created
+	MySQLFileGetComments(fileID int64) ([]CommentMeta, error)
+
+	// MySQLCommentSetAnchor sets the Version, Start, End and Outdated of the comment's anchor
+	MySQLCommentSetAnchor(comment CommentMeta) error
+
+	// MySQLCommentSetResolved sets who resolved the thread started by the comment; empty to reopen it
+	MySQLCommentSetResolved(commentID int64, resolvedBy string) error
+
+	// MySQLCommentSetReaction adds the user's reaction to the comment, or removes it
+	MySQLCommentSetReaction(reaction CommentReactionMeta, remove bool) error
+
+	// MySQLFileGetCommentReactions returns the reactions to every comment on the file, by comment, in the order they
+	// were made
+	MySQLFileGetCommentReactions(fileID int64) ([]CommentReactionMeta, error)
+
+	// MySQLNotificationAck records that the user has seen the project's notifications up to the given sequence number,
+	// unless they have already seen later ones
+	MySQLNotificationAck(username string, projectID int64, sequence int64) error
+
+	// MySQLProjectGetNotificationAcks returns the last of the project's notifications each user has seen, by username
+	MySQLProjectGetNotificationAcks(projectID int64) ([]NotificationAckMeta, error)
+
+	// MySQLProjectGetUsage returns the total size of the project's files, in bytes
+	MySQLProjectGetUsage(projectID int64) (int64, error)
+
+	// MySQLProjectUsageReport returns the usage of the maxResults projects using the most storage, most first
+	MySQLProjectUsageReport(maxResults int) ([]ProjectUsageMeta, error)
+
+	// MySQLUserGetUsage returns the total size of the files the user created, in bytes
+	MySQLUserGetUsage(username string) (int64, error)
+
+	// MySQLUserGetNotificationPrefs returns the projects and events the user has muted; none if they have muted nothing
+	MySQLUserGetNotificationPrefs(username string) (NotificationPrefsMeta, error)
+
+	// MySQLUserSetNotificationPrefs replaces the projects and events the user has muted
+	MySQLUserSetNotificationPrefs(username string, prefs NotificationPrefsMeta) error
+
+	// MySQLProjectGetQuota returns the project's storage quota override, in bytes, or 0 if it has none
+	MySQLProjectGetQuota(projectID int64) (int64, error)
+
+	// MySQLProjectSetQuota overrides the project's storage quota; quotas of 0 or less remove the override
+	MySQLProjectSetQuota(projectID int64, quotaBytes int64) error
+
+	// MySQLProjectGetLineEndings returns the project's line-ending policy, or "" if it preserves line endings as written
+	MySQLProjectGetLineEndings(projectID int64) (string, error)
+
+	// MySQLProjectSetLineEndings sets the project's line-ending policy; "Preserve" removes it
+	MySQLProjectSetLineEndings(projectID int64, policy string) error
+
+	// MySQLProjectGetArchiveState returns whether the project is "archiving", "archived" or "unarchiving", or "" if it is
+	// live
+	MySQLProjectGetArchiveState(projectID int64) (string, error)
+
+	// MySQLProjectSetArchiveState sets the project's archive state; "" makes it live
+	MySQLProjectSetArchiveState(projectID int64, state string) error
+
+	// MySQLProjectGetIgnoreRules returns the project's ignore rules, or none if it has none
+	MySQLProjectGetIgnoreRules(projectID int64) ([]string, error)
+
+	// MySQLProjectSetIgnoreRules replaces the project's ignore rules; empty rules remove them
+	MySQLProjectSetIgnoreRules(projectID int64, rules []string) error
+
+	// MySQLProjectGetSettings returns every one of the project's settings
+	MySQLProjectGetSettings(projectID int64) (ProjectSettingsMeta, error)
+
+	// MySQLProjectSetSettings replaces every one of the project's settings, at once
+	MySQLProjectSetSettings(projectID int64, settings ProjectSettingsMeta) error
+
+	// MySQLExternalIDsGet returns the ExternalIDs of the "Project"s or "File"s with the given IDs, by ID. Those that
+	// don't exist are left out.
+	MySQLExternalIDsGet(resource string, ids []int64) (map[int64]string, error)
+
+	// MySQLExternalIDResolve returns the ID of the "Project" or "File" with the ExternalID. Returns ErrNoData if there
+	// is none
+	MySQLExternalIDResolve(resource string, externalID string) (int64, error)
+
 	// filesystem
 
-	// FileWrite writes the file with the given bytes to a calculated path, and
-	// returns that path so it can be put in MySQL
-	FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error)
+	FileStore
 
-	// FileDelete deletes the file with the given metadata from the file system
-	// Couple this with dbfs.MySQLFileDelete and dbfs.CBDeleteFile
-	FileDelete(relpath string, filename string, projectID int64) error
+	// FileArchive moves the file, with all of its changes applied, to cold storage, and removes its Couchbase document
+	FileArchive(meta FileMeta) error
 
-	// FileMove moves a file form the starting path to the end path
-	FileMove(startRelpath string, startFilename string, endRelpath string, endFilename string, projectID int64) error
+	// FileUnarchive moves the file back from cold storage, and recreates its Couchbase document
+	FileUnarchive(meta FileMeta) error
 
-	// FileWriteToSwap writes the swapfile for the file with the given info
-	FileWriteToSwap(meta FileMeta, raw []byte) error
+	// AvatarWrite stores the user's avatar, replacing any previous one, and returns the SHA-256 of the image
+	AvatarWrite(username string, raw []byte) (string, error)
+
+	// AvatarRead returns the user's avatar. Returns ErrNoData if they have none
+	AvatarRead(username string) ([]byte, error)
+
+	// AvatarDelete removes the user's avatar, if they have one
+	AvatarDelete(username string) error
 }
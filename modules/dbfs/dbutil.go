@@ -1,36 +1,15 @@
 package dbfs
 
 import (
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/CodeCollaborate/Server/modules/config"
 )
 
-// ErrNoDbChange : No rows or values in the DB were changed, which was an unexpected result
-var ErrNoDbChange = errors.New("No entries were correctly altered")
-
-// ErrNoData : No rows or values were found for this value in the database
-var ErrNoData = errors.New("No entries were found")
-
-// ErrVersionOutOfDate : The request attempted to mutate an out of date resource
-var ErrVersionOutOfDate = errors.New("The request attempted to modify an out of date resource")
-
-// ErrInvalidData : The request contained invalid data
-var ErrInvalidData = errors.New("The request contained invalid data")
-
-// ErrInternalServerError : The request failed on an invalid server state
-var ErrInternalServerError = errors.New("The request failed on an invalid server state")
-
-// ErrResourceNotFound : The request attempted to mutate an out of date resource
-var ErrResourceNotFound = errors.New("No such resource was found")
-
-// ErrDbNotInitialized : Active db connection does not exist
-var ErrDbNotInitialized = errors.New("The database was not propperly initialized before execution")
-
-// ErrMaliciousRequest : The request attempted to directly tamper with our filesystem / database
-var ErrMaliciousRequest = errors.New("The request attempted to directly tamper with our filesystem / database")
-
 // ProjectPermission is the type which represents the permission relationship on projects
 type ProjectPermission struct {
 	Username        string
@@ -46,6 +25,43 @@ type ProjectMeta struct {
 	PermissionLevel int8
 }
 
+// ProjectUsageMeta is the type which represents a project's storage usage, and its quota override
+type ProjectUsageMeta struct {
+	ProjectID  int64
+	Name       string
+	Owner      string
+	UsedBytes  int64
+	QuotaBytes int64 // The project's storage quota override; 0 if it has none
+}
+
+// ProjectSettingsMeta is the type which represents a project's settings, from the MySQL `ProjectSettings` table, and
+// those of the settings that have tables of their own
+type ProjectSettingsMeta struct {
+	LineEndings string   // "" if the project preserves line endings as written
+	IgnoreRules []string // Empty if the project has none
+	QuotaBytes  int64    // The project's storage quota override; 0 if it has none
+	DefaultRole string   // The role users are granted if none is given; "" if there is none
+}
+
+// projectSettingsDocument holds the settings stored as JSON in the `ProjectSettings` table; settings are added here,
+// rather than in tables of their own
+type projectSettingsDocument struct {
+	DefaultRole string `json:",omitempty"`
+}
+
+// TeamMeta is the type which represents a row in the MySQL `Team` table
+type TeamMeta struct {
+	TeamID  int64
+	Name    string
+	Creator string
+}
+
+// TeamMemberMeta is the type which represents a row in the MySQL `TeamMember` table
+type TeamMemberMeta struct {
+	Username string
+	IsAdmin  bool // Admins may add members to the team
+}
+
 // FileMeta is the type that contains all the metadata about a file
 type FileMeta struct {
 	FileID       int64
@@ -56,24 +72,210 @@ type FileMeta struct {
 	Filename     string
 }
 
+// ContentHashMeta is the type which represents a row in the MySQL `FileContentHash` table
+type ContentHashMeta struct {
+	Version int64  // The version of the file the hash is of; 0 if the file hasn't been hashed
+	Hash    string // The hex-encoded SHA-256 of the file's text at Version
+}
+
+// ContentHash returns the hex-encoded SHA-256 of a file's contents, as stored in ContentHashMeta
+func ContentHash(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// CommentMeta is the type which represents a row in the MySQL `Comment` table
+type CommentMeta struct {
+	CommentID  int64
+	ThreadID   int64 // The CommentID of the thread's first comment; its own CommentID for the first comment
+	FileID     int64
+	Author     string
+	Body       string
+	Created    time.Time
+	Version    int64  // The version of the file the anchor is in
+	Start      int    // The offset of the start of the anchored range, in Version's text
+	End        int    // The offset of the end of the anchored range, exclusive
+	Outdated   bool   // Whether the anchor could no longer be carried forward, as the file's patches were scrunched
+	ResolvedBy string // The user who resolved the thread; empty if it is open
+}
+
+// CommentReactionMeta is the type which represents a row in the MySQL `CommentReaction` table
+type CommentReactionMeta struct {
+	CommentID int64
+	Username  string
+	Reaction  string // Usually an emoji
+}
+
+// NotificationAckMeta is the type which represents a row in the MySQL `NotificationAck` table
+type NotificationAckMeta struct {
+	Username string
+	Sequence int64 // The last of the project's notifications the user has seen
+	Acked    time.Time
+}
+
 // UserMeta is the type that contains all the metadata about a user
 type UserMeta struct {
+	Username      string
+	Password      string
+	Email         string
+	FirstName     string
+	LastName      string
+	EmailVerified bool
+	Unlisted      bool   // Whether the user is hidden from searches, other than by their exact username
+	AvatarHash    string // The SHA-256 of the user's avatar, which serves as its ETag; "" if they have none
+}
+
+// UserTokenMeta is the type which represents a row in the MySQL `UserToken` table
+type UserTokenMeta struct {
 	Username  string
-	Password  string
-	Email     string
-	FirstName string
-	LastName  string
+	Purpose   string
+	ExpiresAt time.Time
+}
+
+// APITokenMeta is the type which represents a row in the MySQL `APIToken` table
+type APITokenMeta struct {
+	TokenID      int64
+	Username     string
+	Name         string
+	Scope        string  // The highest permission label the token may act with
+	ProjectIDs   []int64 // If non-empty, the only projects the token may access
+	CreationDate time.Time
+	ExpiresAt    time.Time // Zero if the token never expires
 }
 
-// PermissionAtLeast is a helper to verify a user has at least the given permission on the given project
-func PermissionAtLeast(username string, projectID int64, label string, db DBFS) (bool, error) {
-	required, err := config.PermissionByLabel(label)
+// SessionSubscriptionMeta is the type which represents a row in the MySQL `SessionSubscription` table
+type SessionSubscriptionMeta struct {
+	SessionID string
+	Key       string // The queue subscribed to, such as "Project-12"
+	Username  string
+	Bindings  []string // The routing keys bound for the subscription; empty if only Key is bound
+	LastSeen  time.Time
+}
+
+// UserSessionMeta is the type which represents a row in the MySQL `UserSession` table
+type UserSessionMeta struct {
+	SessionID    string
+	Username     string
+	WebsocketID  uint64 // Identifies the connection's queue, which commands to the connection are sent to
+	InstanceID   string // The server the connection is on
+	RemoteAddr   string
+	Device       string    // The User-Agent the connection was opened with, if any
+	TokenHash    string    // The hex SHA-256 of the session token last used on the connection; "" for API tokens
+	TokenExpires time.Time // When the token expires, after which revoked sessions are forgotten
+	ConnectedAt  time.Time
+	LastActive   time.Time // When the user last made a request on the connection
+}
+
+// NotificationPrefsMeta is the type which represents a row in the MySQL `UserNotificationPrefs` table
+type NotificationPrefsMeta struct {
+	MutedProjects []int64
+	MutedEvents   []string // "Resource.Method" or "Resource.*", such as "File.SetMetadata"
+}
+
+// IdempotentRequestMeta is the type which represents a row in the MySQL `IdempotentRequest` table
+type IdempotentRequestMeta struct {
+	Username string
+	Key      string
+	Method   string // The request's "Resource.Method"
+	Status   int    // 0 while the request is being processed
+	Response []byte // The JSON data of the response
+	Created  time.Time
+}
+
+// AuditEntryMeta is the type which represents a row in the MySQL `AuditLog` table
+type AuditEntryMeta struct {
+	AuditID    int64
+	Time       time.Time
+	Event      string // The request's "Resource.Method"
+	Actor      string // The authenticated sender; empty for requests made without a session, such as logins
+	RemoteAddr string // The IP address the request came from, if known
+	ProjectID  int64  // 0 if the request is not about a project
+	Status     int    // The status of the request's response
+	Details    string // The request's data, as JSON, with passwords and tokens redacted
+}
+
+// InstanceMeta is the type which represents a row in the MySQL `ServerInstance` table
+type InstanceMeta struct {
+	InstanceID    string // Random, and different each time a server starts
+	Name          string // The server's configured Name
+	Host          string // The hostname of the machine the server runs on
+	Version       string
+	StartedAt     time.Time
+	LastHeartbeat time.Time
+	Connections   int  // The number of open WebSocket connections
+	Draining      bool // Whether the server has been asked to stop accepting new connections
+}
+
+// MaintenanceMeta is the type which represents the row in the MySQL `ServerMaintenance` table
+type MaintenanceMeta struct {
+	Enabled bool
+	Message string // Shown to users while maintenance mode is enabled
+	SetBy   string // The admin who last enabled or disabled maintenance mode
+	SetAt   time.Time
+}
+
+// Lock is a lock held by this server, from MySQLLockAcquire
+type Lock interface {
+	Release() error
+}
+
+// AuditLogFilter selects entries of the audit log. Empty Events and Actors match any.
+type AuditLogFilter struct {
+	Since        time.Time // Inclusive
+	Until        time.Time // Exclusive
+	AfterAuditID int64     // Entries up to and including this one are skipped, to page through results
+	Event        string
+	Actor        string
+	Limit        int
+}
+
+// ExternalIdentityKey is the primary key of a row in the MySQL `ExternalIdentity` table
+type ExternalIdentityKey struct {
+	Provider string
+	Subject  string
+}
+
+// ProjectRole returns the user's effective role on the given project, combining their direct, team and owner grants
+func ProjectRole(username string, projectID int64, db DBFS) (config.Role, error) {
+	level, err := db.MySQLUserProjectPermissionLookup(projectID, username)
 	if err != nil {
-		return false, err
+		return config.Role{}, err
+	}
+	role, ok := config.EffectiveRole(level)
+	if !ok {
+		return config.Role{}, ErrNoData
 	}
-	actual, err := db.MySQLUserProjectPermissionLookup(projectID, username)
+	return role, nil
+}
+
+// HasCapability is a helper to verify a user's role on the given project allows the given capability
+func HasCapability(username string, projectID int64, capability config.Capability, db DBFS) (bool, error) {
+	role, err := ProjectRole(username, projectID, db)
 	if err != nil {
 		return false, err
 	}
-	return required.Level <= actual, nil
+	return role.Can(capability), nil
+}
+
+// cleanDirectory cleans a directory, as paths are cleaned when files are stored, returning "" for the project's root
+func cleanDirectory(directory string) string {
+	directory = strings.Trim(filepath.ToSlash(filepath.Clean(directory)), "/")
+	if directory == "." {
+		return ""
+	}
+	return directory
+}
+
+// escapeLike escapes the characters that are special in MySQL LIKE patterns
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+// globToLike converts a glob, in which '*' matches any characters and '?' matches one, into a MySQL LIKE pattern. An
+// empty glob matches everything.
+func globToLike(glob string) string {
+	if glob == "" {
+		return "%"
+	}
+	return strings.NewReplacer("*", "%", "?", "_").Replace(escapeLike(glob))
 }
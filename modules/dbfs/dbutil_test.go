@@ -0,0 +1,54 @@
+package dbfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGlobToLike(t *testing.T) {
+	assert.Equal(t, "%", globToLike(""))
+	assert.Equal(t, "%.go", globToLike("*.go"))
+	assert.Equal(t, "file_.t%", globToLike("file?.t*"))
+	assert.Equal(t, `100\%\_done\\%`, globToLike(`100%_done\*`))
+}
+
+func TestCleanDirectory(t *testing.T) {
+	assert.Equal(t, "", cleanDirectory(""))
+	assert.Equal(t, "", cleanDirectory("."))
+	assert.Equal(t, "", cleanDirectory("/"))
+	assert.Equal(t, "src/main", cleanDirectory("./src/main/"))
+}
+
+func TestDatabaseMock_MySQLProjectGetFilesFiltered(t *testing.T) {
+	dm := NewDBMock()
+	projectID, _ := dm.MySQLProjectCreate("loganga", "monorepo")
+	paths := [][2]string{
+		{"", "README.md"},
+		{"src", "main.go"},
+		{"src/util", "util.go"},
+		{"src/util", "util_test.go"},
+		{"srcs", "other.go"},
+		{"docs", "guide.md"},
+	}
+	for _, path := range paths {
+		dm.MySQLFileCreate("loganga", path[1], path[0], projectID)
+	}
+
+	names := func(directory string, glob string) []string {
+		files, err := dm.MySQLProjectGetFilesFiltered(projectID, directory, glob)
+		assert.NoError(t, err)
+		names := []string{}
+		for _, file := range files {
+			names = append(names, file.Filename)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"main.go", "util.go", "util_test.go"}, names("src", ""))
+	assert.Equal(t, []string{"util.go", "util_test.go"}, names("./SRC/util/", ""))
+	assert.Equal(t, []string{"main.go", "util.go", "util_test.go", "other.go"}, names("", "*.go"))
+	assert.Equal(t, []string{"util.go"}, names("src", "util.g?"))
+	assert.Equal(t, []string{"README.md", "guide.md"}, names(".", "*.MD"))
+	assert.Empty(t, names("lib", ""))
+}
@@ -0,0 +1,234 @@
+package dbfs
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// MemoryDocumentStore is a DocumentStore that keeps its documents in memory, for tools and tests that run without
+// Couchbase. Changes are transformed as Couchbase's are, and notifications expire after notificationRetention. It is
+// safe for concurrent use.
+type MemoryDocumentStore struct {
+	mutex                 sync.Mutex
+	files                 map[int64]*memoryFile
+	notificationSequences map[int64]int64
+	notifications         map[int64]map[int64]memoryNotification // ProjectID -> sequence -> notification
+}
+
+type memoryFile struct {
+	version int64
+	changes []string
+}
+
+type memoryNotification struct {
+	notification json.RawMessage
+	expires      time.Time
+}
+
+// NewMemoryDocumentStore creates an empty MemoryDocumentStore
+func NewMemoryDocumentStore() *MemoryDocumentStore {
+	return &MemoryDocumentStore{
+		files:                 make(map[int64]*memoryFile),
+		notificationSequences: make(map[int64]int64),
+		notifications:         make(map[int64]map[int64]memoryNotification),
+	}
+}
+
+// CBInsertNewFile inserts a new document with the given arguments
+func (store *MemoryDocumentStore) CBInsertNewFile(fileID int64, version int64, changes []string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.files[fileID]; ok {
+		return ErrNoDbChange
+	}
+	store.files[fileID] = &memoryFile{version: version, changes: append([]string{}, changes...)}
+	return nil
+}
+
+// CBDeleteFile deletes the file's document
+func (store *MemoryDocumentStore) CBDeleteFile(fileID int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, ok := store.files[fileID]; !ok {
+		return ErrResourceNotFound
+	}
+	delete(store.files, fileID)
+	return nil
+}
+
+// CBInsertNewFiles inserts a new document with no changes at the given version for each of the fileIDs. Like
+// Couchbase's batches, the files before one that already has a document are inserted.
+func (store *MemoryDocumentStore) CBInsertNewFiles(fileIDs []int64, version int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, fileID := range fileIDs {
+		if _, ok := store.files[fileID]; ok {
+			return ErrNoDbChange
+		}
+		store.files[fileID] = &memoryFile{version: version, changes: []string{}}
+	}
+	return nil
+}
+
+// CBDeleteFiles deletes the documents of each of the fileIDs; files without a document are skipped
+func (store *MemoryDocumentStore) CBDeleteFiles(fileIDs []int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, fileID := range fileIDs {
+		delete(store.files, fileID)
+	}
+	return nil
+}
+
+// CBGetFileVersion returns the current version of the file for the given FileID
+func (store *MemoryDocumentStore) CBGetFileVersion(fileID int64) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	file, ok := store.files[fileID]
+	if !ok {
+		return -1, ErrResourceNotFound
+	}
+	return file.version, nil
+}
+
+// CBAppendFileChange transforms the change against those it is missing, and appends it to the file's document.
+// Returns the transformed change, the new version number, the missing patches, and the number of patches stored.
+func (store *MemoryDocumentStore) CBAppendFileChange(file FileMeta, patchStr string) (string, int64, []string, int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	doc, ok := store.files[file.FileID]
+	if !ok {
+		return "", -1, nil, 0, ErrResourceNotFound
+	}
+
+	transformed, missing, err := transformChange(doc.changes, doc.version, patchStr)
+	if err != nil {
+		return "", -1, nil, 0, err
+	}
+
+	doc.changes = append(doc.changes, transformed.String())
+	doc.version++
+	return transformed.String(), doc.version, missing, len(doc.changes), nil
+}
+
+// CBRewriteFileChanges replaces each of the file's stored patches with what rewrite returns for it, without changing
+// the file's version. Returns the number of patches that were changed.
+func (store *MemoryDocumentStore) CBRewriteFileChanges(fileID int64, rewrite func(change string) string) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	doc, ok := store.files[fileID]
+	if !ok {
+		return 0, ErrResourceNotFound
+	}
+	rewritten := 0
+	for i, change := range doc.changes {
+		if changed := rewrite(change); changed != change {
+			doc.changes[i] = changed
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
+
+// CBGetFileChanges returns the file's changes that have not been scrunched into its contents, oldest first, and its
+// version
+func (store *MemoryDocumentStore) CBGetFileChanges(fileID int64) ([]string, int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	doc, ok := store.files[fileID]
+	if !ok {
+		return nil, -1, ErrResourceNotFound
+	}
+	return append([]string{}, doc.changes...), doc.version, nil
+}
+
+// CBRemoveFileChanges removes the file's oldest num changes. Returns ErrNoDbChange if it has fewer.
+func (store *MemoryDocumentStore) CBRemoveFileChanges(fileID int64, num int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	doc, ok := store.files[fileID]
+	if !ok {
+		return ErrResourceNotFound
+	}
+	if len(doc.changes) < num {
+		return ErrNoDbChange
+	}
+	doc.changes = append([]string{}, doc.changes[num:]...)
+	return nil
+}
+
+// CBNextNotificationSequence returns the next sequence number of the project's notifications, starting from 1
+func (store *MemoryDocumentStore) CBNextNotificationSequence(projectID int64) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.notificationSequences[projectID]++
+	return store.notificationSequences[projectID], nil
+}
+
+// CBInsertNotification stores the project's notification with the given sequence number, for notificationRetention
+func (store *MemoryDocumentStore) CBInsertNotification(projectID int64, sequence int64, notification json.RawMessage) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.notifications[projectID] == nil {
+		store.notifications[projectID] = make(map[int64]memoryNotification)
+	}
+	if stored, ok := store.notifications[projectID][sequence]; ok && time.Now().Before(stored.expires) {
+		return ErrNoDbChange
+	}
+	store.notifications[projectID][sequence] = memoryNotification{
+		notification: notification,
+		expires:      time.Now().Add(notificationRetention),
+	}
+	return nil
+}
+
+// CBGetNotificationsSince returns the project's stored notifications after the given sequence number, in order, up
+// to the first that has not been stored yet. Returns ErrVersionOutOfDate if the notification after the given
+// sequence number has expired, or more than maxNotificationsSince notifications have been sent since.
+func (store *MemoryDocumentStore) CBGetNotificationsSince(projectID int64, sequence int64) ([]json.RawMessage, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	latest := store.notificationSequences[projectID]
+	if latest-sequence > maxNotificationsSince {
+		return nil, ErrVersionOutOfDate
+	}
+
+	now := time.Now()
+	notifications := []json.RawMessage{}
+	for next := sequence + 1; next <= latest; next++ {
+		stored, ok := store.notifications[projectID][next]
+		if ok && !now.Before(stored.expires) {
+			delete(store.notifications[projectID], next)
+			ok = false
+		}
+		if !ok {
+			if next == sequence+1 {
+				return nil, ErrVersionOutOfDate
+			}
+			break
+		}
+		notifications = append(notifications, stored.notification)
+	}
+	return notifications, nil
+}
+
+// CBGetNotificationSequence returns the sequence number of the project's latest notification; 0 if it has sent none
+func (store *MemoryDocumentStore) CBGetNotificationSequence(projectID int64) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.notificationSequences[projectID], nil
+}
@@ -0,0 +1,24 @@
+package dbfs_test
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/dbfs/documentstoretest"
+)
+
+func TestMemoryDocumentStore(t *testing.T) {
+	documentstoretest.RunAll(t, dbfs.NewMemoryDocumentStore())
+}
+
+func TestDatabaseImpl_DocumentStore(t *testing.T) {
+	config.SetConfigDir("../../config")
+	if err := config.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	di := new(dbfs.DatabaseImpl)
+	defer di.CloseCouchbase()
+
+	documentstoretest.RunAll(t, di)
+}
@@ -0,0 +1,279 @@
+// Package documentstoretest checks that a dbfs.DocumentStore keeps the semantics the server relies on, so that
+// document stores other than Couchbase can be swapped in with confidence. Each implementation's tests should call
+// RunAll with a store of its own.
+package documentstoretest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FirstFileID is the first of the file IDs the tests use. Any documents of files from FirstFileID to
+// FirstFileID+99 are deleted, so stores shared with other data, such as a development Couchbase bucket, may be used.
+// Projects' notification sequence numbers can't be reset, so the tests only depend on the sequence numbers they
+// are given.
+const FirstFileID = 9000000
+
+// ProjectID is the project the tests send notifications for
+const ProjectID = 9000000
+
+// RunAll runs each of the conformance tests against the store
+func RunAll(t *testing.T, store dbfs.DocumentStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store dbfs.DocumentStore)
+	}{
+		{"Files", testFiles},
+		{"BulkFiles", testBulkFiles},
+		{"AppendFileChange", testAppendFileChange},
+		{"RewriteFileChanges", testRewriteFileChanges},
+		{"GetRemoveFileChanges", testGetRemoveFileChanges},
+		{"Notifications", testNotifications},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, store)
+		})
+	}
+}
+
+// testFiles checks that a file's document is inserted once, and can be deleted once
+func testFiles(t *testing.T, store dbfs.DocumentStore) {
+	fileID := int64(FirstFileID)
+	store.CBDeleteFile(fileID)
+	defer store.CBDeleteFile(fileID)
+
+	_, err := store.CBGetFileVersion(fileID)
+	assert.Error(t, err, "files without a document have no version")
+
+	require.NoError(t, store.CBInsertNewFile(fileID, 2, []string{"v1:\n0:+2:hi:\n0"}))
+	version, err := store.CBGetFileVersion(fileID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, version)
+
+	assert.Error(t, store.CBInsertNewFile(fileID, 5, []string{}), "a file's document should only be inserted once")
+	version, err = store.CBGetFileVersion(fileID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, version, "a failed insert should not change the document")
+
+	require.NoError(t, store.CBDeleteFile(fileID))
+	_, err = store.CBGetFileVersion(fileID)
+	assert.Error(t, err, "deleted files have no version")
+	assert.Error(t, store.CBDeleteFile(fileID), "a file's document should only be deleted once")
+}
+
+// testBulkFiles checks that documents are inserted and deleted in bulk, skipping files without documents on delete
+func testBulkFiles(t *testing.T, store dbfs.DocumentStore) {
+	fileIDs := []int64{FirstFileID + 10, FirstFileID + 11, FirstFileID + 12}
+	require.NoError(t, store.CBDeleteFiles(fileIDs))
+	defer store.CBDeleteFiles(fileIDs)
+
+	require.NoError(t, store.CBInsertNewFiles(fileIDs, 3))
+	for _, fileID := range fileIDs {
+		version, err := store.CBGetFileVersion(fileID)
+		require.NoError(t, err)
+		assert.EqualValues(t, 3, version)
+	}
+	assert.Error(t, store.CBInsertNewFiles(fileIDs[:1], 3), "a file's document should only be inserted once")
+
+	require.NoError(t, store.CBDeleteFiles(append(fileIDs, FirstFileID+13)), "files without documents should be skipped")
+	for _, fileID := range fileIDs {
+		_, err := store.CBGetFileVersion(fileID)
+		assert.Error(t, err, "deleted files have no version")
+	}
+}
+
+// testAppendFileChange checks that changes are appended in order, and that those made on earlier versions are
+// transformed against the changes they missed
+func testAppendFileChange(t *testing.T, store dbfs.DocumentStore) {
+	file := dbfs.FileMeta{
+		FileID:       FirstFileID + 20,
+		Creator:      "_testuser1",
+		RelativePath: ".",
+		ProjectID:    ProjectID,
+		Filename:     "_test_document_store",
+	}
+	store.CBDeleteFile(file.FileID)
+	defer store.CBDeleteFile(file.FileID)
+
+	_, _, _, _, err := store.CBAppendFileChange(file, "v1:\n0:+5:hello:\n0")
+	assert.Error(t, err, "changes can't be appended to files without a document")
+
+	require.NoError(t, store.CBInsertNewFile(file.FileID, 1, []string{}))
+
+	// Changes on the latest version are appended as they are
+	hello := "v1:\n0:+5:hello:\n0"
+	transformed, version, missing, count, err := store.CBAppendFileChange(file, hello)
+	require.NoError(t, err)
+	assert.Equal(t, hello, transformed)
+	assert.EqualValues(t, 2, version)
+	assert.Empty(t, missing)
+	assert.Equal(t, 1, count)
+
+	world := "v2:\n5:+6:+world:\n5"
+	transformed, version, missing, count, err = store.CBAppendFileChange(file, world)
+	require.NoError(t, err)
+	assert.Equal(t, world, transformed)
+	assert.EqualValues(t, 3, version)
+	assert.Empty(t, missing)
+	assert.Equal(t, 2, count)
+
+	// Changes on earlier versions are transformed against the patches made since, which are returned as they are stored
+	transformed, version, missing, count, err = store.CBAppendFileChange(file, "v2:\n0:+1:%3E:\n5")
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, version)
+	assert.Equal(t, []string{world}, missing)
+	assert.Equal(t, 3, count)
+	patch, err := patching.NewPatchFromString(transformed)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, patch.BaseVersion, "transformed changes should be based on the version they follow")
+	text, err := patching.PatchTextFromString("hello", append(missing, transformed))
+	require.NoError(t, err)
+	assert.Equal(t, ">hello world", text)
+
+	version, err = store.CBGetFileVersion(file.FileID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, version)
+
+	// Changes on versions the store doesn't have the patches since are refused
+	_, _, _, _, err = store.CBAppendFileChange(file, "v9:\n0:+1:x:\n12")
+	assert.Equal(t, dbfs.ErrVersionOutOfDate, err, "changes on versions after the file's should be refused")
+	_, _, _, _, err = store.CBAppendFileChange(file, "v0:\n0:+1:x:\n0")
+	assert.Equal(t, dbfs.ErrVersionOutOfDate, err, "changes on versions before the file's patches should be refused")
+	_, _, _, _, err = store.CBAppendFileChange(file, "not a patch")
+	assert.Error(t, err)
+
+	version, err = store.CBGetFileVersion(file.FileID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, version, "refused changes should not change the version")
+}
+
+// testRewriteFileChanges checks that stored patches are replaced in place, keeping the file's version
+func testRewriteFileChanges(t *testing.T, store dbfs.DocumentStore) {
+	file := dbfs.FileMeta{
+		FileID:       FirstFileID + 30,
+		Creator:      "_testuser1",
+		RelativePath: ".",
+		ProjectID:    ProjectID,
+		Filename:     "_test_document_store",
+	}
+	store.CBDeleteFile(file.FileID)
+	defer store.CBDeleteFile(file.FileID)
+
+	rename := func(change string) string {
+		return strings.Replace(change, "author=_testuser1", "author=_testuser2", -1)
+	}
+	_, err := store.CBRewriteFileChanges(file.FileID, rename)
+	assert.Error(t, err, "files without a document have no changes to rewrite")
+
+	hello := "v1:\n0:+5:hello:\n0:\nauthor=_testuser1"
+	world := "v2:\n5:+6:+world:\n5:\nauthor=_testuser3"
+	require.NoError(t, store.CBInsertNewFile(file.FileID, 1, []string{}))
+	_, _, _, _, err = store.CBAppendFileChange(file, hello)
+	require.NoError(t, err)
+	_, _, _, _, err = store.CBAppendFileChange(file, world)
+	require.NoError(t, err)
+
+	rewritten, err := store.CBRewriteFileChanges(file.FileID, rename)
+	require.NoError(t, err)
+	assert.Equal(t, 1, rewritten, "only the changes rewrite altered should be counted")
+
+	rewritten, err = store.CBRewriteFileChanges(file.FileID, rename)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rewritten, "rewriting again should change nothing")
+
+	version, err := store.CBGetFileVersion(file.FileID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, version, "rewriting changes should not change the version")
+
+	// The stored patches are those missed by a change on the first version
+	_, _, missing, _, err := store.CBAppendFileChange(file, "v1:\n0:+1:%3E:\n0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1:\n0:+5:hello:\n0:\nauthor=_testuser2", world}, missing)
+}
+
+// testGetRemoveFileChanges checks that a file's changes are fetched in order, and that scrunched changes are removed
+// from the oldest, keeping the file's version
+func testGetRemoveFileChanges(t *testing.T, store dbfs.DocumentStore) {
+	file := dbfs.FileMeta{
+		FileID:       FirstFileID + 40,
+		Creator:      "_testuser1",
+		RelativePath: ".",
+		ProjectID:    ProjectID,
+		Filename:     "_test_document_store",
+	}
+	store.CBDeleteFile(file.FileID)
+	defer store.CBDeleteFile(file.FileID)
+
+	_, _, err := store.CBGetFileChanges(file.FileID)
+	assert.Error(t, err, "files without a document have no changes")
+	assert.Error(t, store.CBRemoveFileChanges(file.FileID, 1), "files without a document have no changes to remove")
+
+	hello := "v1:\n0:+5:hello:\n0"
+	world := "v2:\n5:+6:+world:\n5"
+	require.NoError(t, store.CBInsertNewFile(file.FileID, 1, []string{}))
+	_, _, _, _, err = store.CBAppendFileChange(file, hello)
+	require.NoError(t, err)
+	_, _, _, _, err = store.CBAppendFileChange(file, world)
+	require.NoError(t, err)
+
+	changes, version, err := store.CBGetFileChanges(file.FileID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{hello, world}, changes)
+	assert.EqualValues(t, 3, version)
+
+	assert.Equal(t, dbfs.ErrNoDbChange, store.CBRemoveFileChanges(file.FileID, 3),
+		"removing more changes than the file has should fail")
+	require.NoError(t, store.CBRemoveFileChanges(file.FileID, 1))
+	changes, version, err = store.CBGetFileChanges(file.FileID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{world}, changes, "the oldest changes should be removed")
+	assert.EqualValues(t, 3, version, "removing changes should not change the version")
+}
+
+// testNotifications checks that notifications are numbered in order, and fetched up to the first that isn't stored
+func testNotifications(t *testing.T, store dbfs.DocumentStore) {
+	latest, err := store.CBGetNotificationSequence(ProjectID)
+	require.NoError(t, err)
+
+	notifications, err := store.CBGetNotificationsSince(ProjectID, latest)
+	require.NoError(t, err)
+	assert.Empty(t, notifications, "there are no notifications after the latest")
+
+	next := func() int64 {
+		sequence, err := store.CBNextNotificationSequence(ProjectID)
+		require.NoError(t, err)
+		return sequence
+	}
+	first, second, third, fourth := next(), next(), next(), next()
+	assert.Equal(t, []int64{latest + 1, latest + 2, latest + 3, latest + 4}, []int64{first, second, third, fourth},
+		"sequence numbers should be assigned in order")
+	sequence, err := store.CBGetNotificationSequence(ProjectID)
+	require.NoError(t, err)
+	assert.Equal(t, fourth, sequence)
+
+	// The first and third notifications are never stored
+	require.NoError(t, store.CBInsertNotification(ProjectID, second, json.RawMessage(`{"n":2}`)))
+	require.NoError(t, store.CBInsertNotification(ProjectID, fourth, json.RawMessage(`{"n":4}`)))
+	assert.Error(t, store.CBInsertNotification(ProjectID, second, json.RawMessage(`{"n":5}`)),
+		"a notification should only be stored once")
+
+	_, err = store.CBGetNotificationsSince(ProjectID, latest)
+	assert.Equal(t, dbfs.ErrVersionOutOfDate, err, "clients missing a notification that isn't stored should resync")
+
+	notifications, err = store.CBGetNotificationsSince(ProjectID, first)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1, "notifications should be fetched up to the first that isn't stored yet")
+	assert.JSONEq(t, `{"n":2}`, string(notifications[0]))
+
+	notifications, err = store.CBGetNotificationsSince(ProjectID, third)
+	require.NoError(t, err)
+	require.Len(t, notifications, 1)
+	assert.JSONEq(t, `{"n":4}`, string(notifications[0]))
+}
@@ -0,0 +1,129 @@
+package dbfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * At-rest encryption of the files on disk, configured by ServerConfig.FileEncryption. Encrypted files start with a
+ * header naming the key they were encrypted with:
+ *
+ *   "CCENC1" | key ID length (1 byte) | key ID | nonce (12 bytes) | AES-GCM ciphertext
+ *
+ * The header is authenticated along with the contents. Files without the header are read as they are, so that files
+ * written before encryption was enabled remain readable.
+ *
+ * Plaintext that begins like a header, such as a file describing this format, would then be mistaken for an encrypted
+ * file, or a pointer to a blob (see contents.go), so it is written after a header of its own, "CCRAW1", which is stripped when it is read. Other plaintext is
+ * written as it is.
+ */
+
+var encryptedFileMagic = []byte("CCENC1")
+
+// plainFileMagic begins plaintext files whose contents would otherwise be mistaken for the stored form of a file
+var plainFileMagic = []byte("CCRAW1")
+
+// reservedPrefixes begin the stored forms of files; plaintext beginning with any of them is written after
+// plainFileMagic
+var reservedPrefixes = [][]byte{encryptedFileMagic, plainFileMagic, blobPointerPrefix}
+
+// ErrUnknownEncryptionKey is returned when reading a file encrypted with a key that is not configured
+var ErrUnknownEncryptionKey = newError(CategoryCorrupt, false, "File is encrypted with a key that is not configured")
+
+// ErrCorruptEncryptedFile is returned when an encrypted file's header is truncated
+var ErrCorruptEncryptedFile = newError(CategoryCorrupt, false, "Encrypted file is corrupt")
+
+// encryptionAEAD returns the cipher for the configured key with the given ID
+func encryptionAEAD(cfg *config.Config, keyID string) (cipher.AEAD, error) {
+	secretRef, ok := cfg.ServerConfig.FileEncryption.Keys[keyID]
+	if !ok {
+		return nil, ErrUnknownEncryptionKey
+	}
+	encoded, err := config.ResolveSecret(secretRef)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve encryption key %q: %v", keyID, err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("encryption key %q must be 32 bytes, base64-encoded", keyID)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptContents encrypts the contents with the current key, or returns them as plaintext if encryption is disabled
+func encryptContents(cfg *config.Config, raw []byte) ([]byte, error) {
+	keyID := cfg.ServerConfig.FileEncryption.KeyID
+	if keyID == "" {
+		return plainContents(raw), nil
+	}
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("encryption key ID %q is too long", keyID)
+	}
+	aead, err := encryptionAEAD(cfg, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(encryptedFileMagic)+1+len(keyID)+aead.NonceSize())
+	header = append(header, encryptedFileMagic...)
+	header = append(header, byte(len(keyID)))
+	header = append(header, keyID...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, raw, header), nil
+}
+
+// plainContents returns the stored form of the plaintext, which only differs from it if it begins with a reserved
+// prefix
+func plainContents(raw []byte) []byte {
+	for _, prefix := range reservedPrefixes {
+		if bytes.HasPrefix(raw, prefix) {
+			return append(append(make([]byte, 0, len(plainFileMagic)+len(raw)), plainFileMagic...), raw...)
+		}
+	}
+	return raw
+}
+
+// decryptContents decrypts contents written by encryptContents; contents without the header are returned unchanged
+func decryptContents(cfg *config.Config, contents []byte) ([]byte, error) {
+	if bytes.HasPrefix(contents, plainFileMagic) {
+		return contents[len(plainFileMagic):], nil
+	}
+	if !bytes.HasPrefix(contents, encryptedFileMagic) {
+		return contents, nil
+	}
+
+	rest := contents[len(encryptedFileMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, ErrCorruptEncryptedFile
+	}
+	keyID := string(rest[1 : 1+int(rest[0])])
+	aead, err := encryptionAEAD(cfg, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLength := len(encryptedFileMagic) + 1 + len(keyID) + aead.NonceSize()
+	if len(contents) < headerLength {
+		return nil, ErrCorruptEncryptedFile
+	}
+	header := contents[:headerLength]
+	nonce := header[headerLength-aead.NonceSize():]
+	return aead.Open(nil, nonce, contents[headerLength:], header)
+}
@@ -0,0 +1,125 @@
+package dbfs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeysProvider resolves "testkeys:<id>" to a key made of repeating the first byte of the ID
+type testKeysProvider struct{}
+
+func (testKeysProvider) GetSecret(ref string) (string, time.Duration, error) {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{ref[0]}, 32)), 0, nil
+}
+
+func TestFileEncryption(t *testing.T) {
+	testConfigSetup(t)
+	config.RegisterSecretsProvider("testkeys", testKeysProvider{})
+	defer config.RegisterSecretsProvider("testkeys", nil)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.FileEncryptionCfg) {
+		serverCfg.FileEncryption = cfg
+	}(serverCfg.FileEncryption)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+
+	di := new(DatabaseImpl)
+	fileText := []byte("Hello World!\nWelcome to my file\n")
+
+	// Files written before encryption was enabled stay readable
+	serverCfg.FileEncryption = config.FileEncryptionCfg{}
+	_, err := di.FileWrite(".", "plain.txt", 10, fileText)
+	require.NoError(t, err)
+
+	serverCfg.FileEncryption = config.FileEncryptionCfg{
+		KeyID: "a",
+		Keys:  map[string]string{"a": "testkeys:a"},
+	}
+	loc, err := di.FileWrite(".", "secret.txt", 10, fileText)
+	require.NoError(t, err)
+	onDisk, err := ioutil.ReadFile(loc)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(onDisk, []byte("Hello")), "contents should be encrypted on disk")
+
+	read, err := di.FileRead(".", "secret.txt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, fileText, *read)
+	read, err = di.FileRead(".", "plain.txt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, fileText, *read)
+
+	// Swap files are encrypted too
+	require.NoError(t, di.FileWriteToSwap(FileMeta{RelativePath: ".", Filename: "secret.txt", ProjectID: 10}, []byte("swap")))
+	swap, err := di.swapRead(".", "secret.txt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("swap"), *swap)
+
+	// After rotating keys, files written with the old key are still readable
+	serverCfg.FileEncryption = config.FileEncryptionCfg{
+		KeyID: "b",
+		Keys:  map[string]string{"a": "testkeys:a", "b": "testkeys:b"},
+	}
+	read, err = di.FileRead(".", "secret.txt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, fileText, *read)
+	_, err = di.FileWrite(".", "rotated.txt", 10, fileText)
+	require.NoError(t, err)
+
+	serverCfg.FileEncryption.Keys = map[string]string{"b": "testkeys:b"}
+	_, err = di.FileRead(".", "secret.txt", 10)
+	assert.Equal(t, ErrUnknownEncryptionKey, err)
+	read, err = di.FileRead(".", "rotated.txt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, fileText, *read)
+
+	// Tampered contents are rejected
+	rotatedPath := filepath.Join(serverCfg.ProjectPath, "10", "rotated.txt")
+	onDisk, err = ioutil.ReadFile(rotatedPath)
+	require.NoError(t, err)
+	onDisk[len(onDisk)-1] ^= 1
+	require.NoError(t, ioutil.WriteFile(rotatedPath, onDisk, 0744))
+	_, err = di.FileRead(".", "rotated.txt", 10)
+	assert.Error(t, err)
+}
+
+func TestFileEncryption_PlaintextLikeHeader(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.FileEncryptionCfg, dedup bool) {
+		serverCfg.FileEncryption = cfg
+		serverCfg.DeduplicateFiles = dedup
+	}(serverCfg.FileEncryption, serverCfg.DeduplicateFiles)
+	defer os.RemoveAll(serverCfg.ProjectPath)
+	serverCfg.FileEncryption = config.FileEncryptionCfg{}
+
+	// Files that begin like an encrypted file's header, with encryption never enabled, are read as they were written
+	di := new(DatabaseImpl)
+	for _, dedup := range []bool{false, true} {
+		serverCfg.DeduplicateFiles = dedup
+		for i, text := range []string{"CCENC1", "CCENC1\x01aabcdefghijklmnop", "CCRAW1CCENC1 is the header"} {
+			name := fmt.Sprintf("format-%t-%d.md", dedup, i)
+			_, err := di.FileWrite(".", name, 10, []byte(text))
+			require.NoError(t, err)
+			read, err := di.FileRead(".", name, 10)
+			require.NoError(t, err, text)
+			assert.Equal(t, text, string(*read))
+		}
+	}
+
+	// Other plaintext is stored as it is
+	serverCfg.DeduplicateFiles = false
+	loc, err := di.FileWrite(".", "plain.txt", 10, []byte("CCENC"))
+	require.NoError(t, err)
+	onDisk, err := ioutil.ReadFile(loc)
+	require.NoError(t, err)
+	assert.Equal(t, "CCENC", string(onDisk))
+}
@@ -0,0 +1,125 @@
+package dbfs
+
+import "github.com/CodeCollaborate/Server/modules/dblock"
+
+/**
+ * Errors returned by DBFS are *Error values, which say what kind of failure they are, so that requests can respond to
+ * them without knowing which database or call they came from (see datahandling/dberrors.go). The errors below are
+ * shared values that can be compared with ==. Errors from the databases themselves are returned as they are, except
+ * where the failure is known, such as not being able to connect, in which case they are wrapped with their category;
+ * anything without a category is treated as CategoryInternal.
+ */
+
+// ErrorCategory is the kind of failure an Error is
+type ErrorCategory int
+
+const (
+	// CategoryInternal is an unexpected failure, such as an inconsistent database
+	CategoryInternal ErrorCategory = iota
+	// CategoryNotFound means the resource the request named does not exist
+	CategoryNotFound
+	// CategoryNoChange means nothing was changed, such as when the row to update has gone, or the change was already made
+	CategoryNoChange
+	// CategoryConflict means the request was based on an out of date version of the resource
+	CategoryConflict
+	// CategoryInvalid means the request contained data that can't be stored
+	CategoryInvalid
+	// CategoryForbidden means the request tried to reach outside of what it may touch
+	CategoryForbidden
+	// CategoryBusy means another server is working on the resource
+	CategoryBusy
+	// CategoryUnavailable means a database could not be reached
+	CategoryUnavailable
+	// CategoryCorrupt means stored data failed its integrity checks
+	CategoryCorrupt
+)
+
+var categoryNames = map[ErrorCategory]string{
+	CategoryInternal:    "Internal",
+	CategoryNotFound:    "NotFound",
+	CategoryNoChange:    "NoChange",
+	CategoryConflict:    "Conflict",
+	CategoryInvalid:     "Invalid",
+	CategoryForbidden:   "Forbidden",
+	CategoryBusy:        "Busy",
+	CategoryUnavailable: "Unavailable",
+	CategoryCorrupt:     "Corrupt",
+}
+
+func (category ErrorCategory) String() string {
+	return categoryNames[category]
+}
+
+// Error is a database error, with the kind of failure it is
+type Error struct {
+	Category  ErrorCategory
+	Retryable bool   // Whether the same request may succeed if it is made again later
+	Message   string // Describes the failure; the Cause's message if it has no message of its own
+	Cause     error  // The underlying error, if any
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// Unwrap returns the underlying error, if any
+func (err *Error) Unwrap() error {
+	return err.Cause
+}
+
+func newError(category ErrorCategory, retryable bool, message string) *Error {
+	return &Error{Category: category, Retryable: retryable, Message: message}
+}
+
+// classify wraps err with the category, unless it already has one
+func classify(err error, category ErrorCategory, retryable bool) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{Category: category, Retryable: retryable, Message: err.Error(), Cause: err}
+}
+
+// Category returns the kind of failure err is; CategoryInternal if it has none
+func Category(err error) ErrorCategory {
+	if dbErr, ok := err.(*Error); ok {
+		return dbErr.Category
+	}
+	return CategoryInternal
+}
+
+// Retryable reports whether a request that failed with err may succeed if it is made again later
+func Retryable(err error) bool {
+	dbErr, ok := err.(*Error)
+	return ok && dbErr.Retryable
+}
+
+// ErrNoDbChange : No rows or values in the DB were changed, which was an unexpected result
+var ErrNoDbChange = newError(CategoryNoChange, false, "No entries were correctly altered")
+
+// ErrNoData : No rows or values were found for this value in the database
+var ErrNoData = newError(CategoryNotFound, false, "No entries were found")
+
+// ErrVersionOutOfDate : The request attempted to mutate an out of date resource
+var ErrVersionOutOfDate = newError(CategoryConflict, false, "The request attempted to modify an out of date resource")
+
+// ErrInvalidData : The request contained invalid data
+var ErrInvalidData = newError(CategoryInvalid, false, "The request contained invalid data")
+
+// ErrInternalServerError : The request failed on an invalid server state
+var ErrInternalServerError = newError(CategoryInternal, false, "The request failed on an invalid server state")
+
+// ErrResourceNotFound : The request attempted to mutate a resource that does not exist
+var ErrResourceNotFound = newError(CategoryNotFound, false, "No such resource was found")
+
+// ErrDbNotInitialized : Active db connection does not exist
+var ErrDbNotInitialized = newError(CategoryUnavailable, true, "The database was not propperly initialized before execution")
+
+// ErrLockHeld : Another server holds the lock
+var ErrLockHeld = &Error{Category: CategoryBusy, Retryable: true, Message: dblock.ErrLockHeld.Error(), Cause: dblock.ErrLockHeld}
+
+// ErrMaliciousRequest : The request attempted to directly tamper with our filesystem / database
+var ErrMaliciousRequest = newError(CategoryForbidden, false,
+	"The request attempted to directly tamper with our filesystem / database")
@@ -0,0 +1,33 @@
+package dbfs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/dblock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCategory(t *testing.T) {
+	assert.Equal(t, CategoryNotFound, Category(ErrNoData))
+	assert.Equal(t, CategoryConflict, Category(ErrVersionOutOfDate))
+	assert.Equal(t, CategoryInternal, Category(errors.New("unknown")), "errors without a category should be internal")
+	assert.Equal(t, CategoryInternal, Category(nil))
+	assert.True(t, Retryable(ErrCouchbaseUnavailable))
+	assert.False(t, Retryable(ErrNoDbChange))
+	assert.False(t, Retryable(errors.New("unknown")))
+	assert.Equal(t, dblock.ErrLockHeld, ErrLockHeld.Unwrap())
+	assert.Equal(t, "Busy", CategoryBusy.String())
+}
+
+func TestClassify(t *testing.T) {
+	assert.Nil(t, classify(nil, CategoryUnavailable, true))
+	assert.Equal(t, ErrNoData, classify(ErrNoData, CategoryUnavailable, true), "categorized errors should be kept")
+
+	cause := errors.New("connection refused")
+	err := classify(cause, CategoryUnavailable, true)
+	assert.Equal(t, CategoryUnavailable, Category(err))
+	assert.True(t, Retryable(err))
+	assert.Equal(t, cause.Error(), err.Error())
+	assert.Equal(t, cause, err.(*Error).Unwrap())
+}
@@ -1,15 +1,10 @@
 package dbfs
 
 import (
-	"errors"
-	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"github.com/CodeCollaborate/Server/modules/config"
 )
 
 var filePathSeparator = strconv.QuoteRune(os.PathSeparator)[1:2]
@@ -17,6 +12,11 @@ var filePathSeparator = strconv.QuoteRune(os.PathSeparator)[1:2]
 // FileWrite writes the file with the given bytes to a calculated path, and
 // returns that path so it can be put in MySQL
 func (di *DatabaseImpl) FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error) {
+	if store, err := di.fileStore(); err != nil {
+		return "", err
+	} else if store != nil {
+		return store.FileWrite(relpath, filename, projectID, raw)
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return "", err
@@ -26,7 +26,7 @@ func (di *DatabaseImpl) FileWrite(relpath string, filename string, projectID int
 		return "", err
 	}
 	fileLocation := filepath.Join(relFilePath, filename)
-	err = ioutil.WriteFile(fileLocation, raw, 0744)
+	err = writeContents(di.config(), fileLocation, raw)
 	if err != nil {
 		return "", err
 	}
@@ -37,27 +37,42 @@ func (di *DatabaseImpl) FileWrite(relpath string, filename string, projectID int
 // FileDelete deletes the file with the given metadata from the file system
 // Couple this with dbfs.MySQLFileDelete and dbfs.CBDeleteFile
 func (di *DatabaseImpl) FileDelete(relpath string, filename string, projectID int64) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.FileDelete(relpath, filename, projectID)
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return err
 	}
 	fileLocation := filepath.Join(relFilePath, filename)
-	return os.Remove(fileLocation)
+	return removeContents(di.config(), fileLocation)
 }
 
 // FileRead returns the project file from the calculated location on the disk
 func (di *DatabaseImpl) FileRead(relpath string, filename string, projectID int64) (*[]byte, error) {
+	if store, err := di.fileStore(); err != nil {
+		return new([]byte), err
+	} else if store != nil {
+		return store.FileRead(relpath, filename, projectID)
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return new([]byte), err
 	}
 	fileLocation := filepath.Join(relFilePath, filename)
-	fileBytes, err := ioutil.ReadFile(fileLocation)
+	fileBytes, err := readContents(di.config(), fileLocation)
 	return &fileBytes, err
 }
 
 // FileMove moves a file form the starting path to the end path
 func (di *DatabaseImpl) FileMove(startRelpath string, startFilename string, endRelpath string, endFilename string, projectID int64) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.FileMove(startRelpath, startFilename, endRelpath, endFilename, projectID)
+	}
 	startRelFilePath, err := di.getFilepath(startRelpath, startFilename, projectID)
 	if err != nil {
 		return err
@@ -74,12 +89,22 @@ func (di *DatabaseImpl) FileMove(startRelpath string, startFilename string, endR
 	startFileLocation := filepath.Join(startRelFilePath, startFilename)
 	endFileLocation := filepath.Join(endRelFilePath, endFilename)
 
-	err = os.Rename(startFileLocation, endFileLocation)
+	err = moveContents(di.config(), startFileLocation, endFileLocation)
 	return err
 }
 
 // returns the swap file contents and any error
 func (di *DatabaseImpl) makeSwp(relpath string, filename string, projectID int64) ([]byte, error) {
+	if store, err := di.fileStore(); err != nil {
+		return []byte{}, err
+	} else if store != nil {
+		fileBytes, err := store.FileRead(relpath, filename, projectID)
+		if err != nil {
+			return []byte{}, err
+		}
+		meta := FileMeta{RelativePath: relpath, Filename: filename, ProjectID: projectID}
+		return *fileBytes, store.FileWriteToSwap(meta, *fileBytes)
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return []byte{}, err
@@ -87,12 +112,11 @@ func (di *DatabaseImpl) makeSwp(relpath string, filename string, projectID int64
 	fileLocation := filepath.Join(relFilePath, filename)
 	swapLoc := di.getSwpLocation(fileLocation)
 
-	err = di.fileCopy(fileLocation, swapLoc)
+	fileBytes, err := readContents(di.config(), fileLocation)
 	if err != nil {
 		return []byte{}, err
 	}
-
-	fileBytes, err := ioutil.ReadFile(swapLoc)
+	err = writeContents(di.config(), swapLoc, fileBytes)
 	return fileBytes, err
 }
 
@@ -104,12 +128,31 @@ func (di *DatabaseImpl) swapRead(relpath string, filename string, projectID int6
 	}
 	fileLocation := filepath.Join(relFilePath, filename)
 	swapLocation := di.getSwpLocation(fileLocation)
-	fileBytes, err := ioutil.ReadFile(swapLocation)
+	fileBytes, err := readContents(di.config(), swapLocation)
 	return &fileBytes, err
 }
 
+// FileReadSwap returns the contents last written to the file's swap file. Returns ErrNoData if it has none
+func (di *DatabaseImpl) FileReadSwap(meta FileMeta) (*[]byte, error) {
+	if store, err := di.fileStore(); err != nil {
+		return new([]byte), err
+	} else if store != nil {
+		return store.FileReadSwap(meta)
+	}
+	fileBytes, err := di.swapRead(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if os.IsNotExist(err) {
+		return new([]byte), ErrNoData
+	}
+	return fileBytes, err
+}
+
 // FileWriteToSwap writes the swapfile for the file with the given info
 func (di *DatabaseImpl) FileWriteToSwap(meta FileMeta, raw []byte) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.FileWriteToSwap(meta, raw)
+	}
 	relFilePath, err := di.getFilepath(meta.RelativePath, meta.Filename, meta.ProjectID)
 	if err != nil {
 		return err
@@ -117,11 +160,17 @@ func (di *DatabaseImpl) FileWriteToSwap(meta FileMeta, raw []byte) error {
 	fileLocation := filepath.Join(relFilePath, meta.Filename)
 	swapLoc := di.getSwpLocation(fileLocation)
 
-	return ioutil.WriteFile(swapLoc, raw, 0744)
+	return writeContents(di.config(), swapLoc, raw)
 }
 
 // returns any error
 func (di *DatabaseImpl) deleteSwp(relpath string, filename string, projectID int64) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		// Other stores keep swap files, which the next scrunch overwrites
+		return nil
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return err
@@ -129,11 +178,16 @@ func (di *DatabaseImpl) deleteSwp(relpath string, filename string, projectID int
 	fileLocation := filepath.Join(relFilePath, filename)
 	swapLoc := di.getSwpLocation(fileLocation)
 
-	return os.Remove(swapLoc)
+	return removeContents(di.config(), swapLoc)
 }
 
 // swaps the swapfile to the location of the real file
 func (di *DatabaseImpl) swapSwp(relpath string, filename string, projectID int64) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.FileRestoreFromSwap(FileMeta{RelativePath: relpath, Filename: filename, ProjectID: projectID})
+	}
 	relFilePath, err := di.getFilepath(relpath, filename, projectID)
 	if err != nil {
 		return err
@@ -141,46 +195,10 @@ func (di *DatabaseImpl) swapSwp(relpath string, filename string, projectID int64
 	fileLocation := filepath.Join(relFilePath, filename)
 	swapLoc := di.getSwpLocation(fileLocation)
 
-	err = di.fileCopy(swapLoc, fileLocation)
+	err = copyContents(di.config(), swapLoc, fileLocation)
 	return err
 }
 
-func (di *DatabaseImpl) fileCopy(src string, dst string) error {
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-	if !srcInfo.Mode().IsRegular() {
-		return errors.New("non-regular source file cannot be copied")
-	}
-	_, err = os.Stat(dst)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			err = os.Remove(dst)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	in, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer in.Close()
-
-	out, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	if _, err = io.Copy(out, in); err != nil {
-		return err
-	}
-	return out.Sync()
-}
-
 // cleanPath cleans the relative filepath given and verifies that the filename is safe
 func (di *DatabaseImpl) getFilepath(relpath string, filename string, projectID int64) (string, error) {
 	if strings.Contains(filename, filePathSeparator) {
@@ -191,10 +209,61 @@ func (di *DatabaseImpl) getFilepath(relpath string, filename string, projectID i
 		return "", ErrMaliciousRequest
 	}
 
-	projectFolderParentPath := config.GetConfig().ServerConfig.ProjectPath
+	projectFolderParentPath := di.config().ServerConfig.ProjectPath
 	return filepath.Join(projectFolderParentPath, strconv.FormatInt(projectID, 10), cleanPath), nil
 }
 
 func (di *DatabaseImpl) getSwpLocation(filepath string) string {
 	return filepath + ".swp"
 }
+
+// FileVerify checks that the file exists, and that its contents match their checksum. Returns ErrFileMissing or
+// ErrChecksumMismatch if not, or the error reading it if it can not be decrypted. Archived files are checked in cold
+// storage.
+func (di *DatabaseImpl) FileVerify(meta FileMeta) error {
+	store, err := di.fileStore()
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		err = store.FileVerify(meta)
+	} else {
+		var relFilePath string
+		relFilePath, err = di.getFilepath(meta.RelativePath, meta.Filename, meta.ProjectID)
+		if err != nil {
+			return err
+		}
+		err = verifyContents(di.config(), filepath.Join(relFilePath, meta.Filename))
+	}
+	if err == ErrFileMissing {
+		location := coldStoragePath(di.config(), meta)
+		if info, infoErr := readColdInfo(location); infoErr == nil {
+			_, err = readColdContents(di.config(), location, info)
+		}
+	}
+	return err
+}
+
+// FileRestoreFromSwap replaces the file with its swap file, if one was left behind by an interrupted scrunch and its
+// contents match their checksum. Returns ErrNoData if there is no intact swap file.
+//
+// The swap file may already have some of the changes in Couchbase applied to it, depending on where the scrunch was
+// interrupted, so this should only be used once the file itself is lost.
+func (di *DatabaseImpl) FileRestoreFromSwap(meta FileMeta) error {
+	if store, err := di.fileStore(); err != nil {
+		return err
+	} else if store != nil {
+		return store.FileRestoreFromSwap(meta)
+	}
+	relFilePath, err := di.getFilepath(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	fileLocation := filepath.Join(relFilePath, meta.Filename)
+	swapLoc := di.getSwpLocation(fileLocation)
+
+	if err := verifyContents(di.config(), swapLoc); err != nil {
+		return ErrNoData
+	}
+	return copyContents(di.config(), swapLoc, fileLocation)
+}
@@ -0,0 +1,168 @@
+package dbfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// MemoryFileStore is a FileStore that keeps files' contents in memory, for tools and tests that run without a
+// filesystem to write projects to. Its swap files are kept until they are overwritten, as with other stores. It is
+// safe for concurrent use.
+type MemoryFileStore struct {
+	mutex sync.Mutex
+	files map[string][]byte // By the file's key
+	swaps map[string][]byte // By the key of the file they are for
+}
+
+// NewMemoryFileStore creates an empty MemoryFileStore
+func NewMemoryFileStore() *MemoryFileStore {
+	return &MemoryFileStore{
+		files: make(map[string][]byte),
+		swaps: make(map[string][]byte),
+	}
+}
+
+// memoryFileKey names the file within the store, refusing paths outside of its project as getFilepath does
+func memoryFileKey(relpath string, filename string, projectID int64) (string, error) {
+	if strings.Contains(filename, filePathSeparator) {
+		return "", ErrMaliciousRequest
+	}
+	cleanPath := filepath.Clean(relpath)
+	if strings.HasPrefix(cleanPath, "..") {
+		return "", ErrMaliciousRequest
+	}
+	return filepath.Join(fmt.Sprint(projectID), cleanPath, filename), nil
+}
+
+// FileWrite stores the file with the given bytes, and returns its key
+func (store *MemoryFileStore) FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error) {
+	key, err := memoryFileKey(relpath, filename, projectID)
+	if err != nil {
+		return "", err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.files[key] = append([]byte{}, raw...)
+	return key, nil
+}
+
+// FileRead returns the contents of the file
+func (store *MemoryFileStore) FileRead(relpath string, filename string, projectID int64) (*[]byte, error) {
+	key, err := memoryFileKey(relpath, filename, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	raw, ok := store.files[key]
+	if !ok {
+		return nil, ErrFileMissing
+	}
+	contents := append([]byte{}, raw...)
+	return &contents, nil
+}
+
+// FileDelete deletes the file
+func (store *MemoryFileStore) FileDelete(relpath string, filename string, projectID int64) error {
+	key, err := memoryFileKey(relpath, filename, projectID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.files[key]; !ok {
+		return ErrFileMissing
+	}
+	delete(store.files, key)
+	return nil
+}
+
+// FileMove moves a file from the starting path to the end path
+func (store *MemoryFileStore) FileMove(startRelpath string, startFilename string, endRelpath string,
+	endFilename string, projectID int64) error {
+	startKey, err := memoryFileKey(startRelpath, startFilename, projectID)
+	if err != nil {
+		return err
+	}
+	endKey, err := memoryFileKey(endRelpath, endFilename, projectID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	raw, ok := store.files[startKey]
+	if !ok {
+		return ErrFileMissing
+	}
+	delete(store.files, startKey)
+	store.files[endKey] = raw
+	return nil
+}
+
+// FileWriteToSwap writes the swap file for the file with the given info
+func (store *MemoryFileStore) FileWriteToSwap(meta FileMeta, raw []byte) error {
+	key, err := memoryFileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.swaps[key] = append([]byte{}, raw...)
+	return nil
+}
+
+// FileReadSwap returns the contents last written to the file's swap file. Returns ErrNoData if it has none
+func (store *MemoryFileStore) FileReadSwap(meta FileMeta) (*[]byte, error) {
+	key, err := memoryFileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	raw, ok := store.swaps[key]
+	if !ok {
+		return nil, ErrNoData
+	}
+	contents := append([]byte{}, raw...)
+	return &contents, nil
+}
+
+// FileVerify checks that the file exists. Returns ErrFileMissing if not; contents kept in memory can't be corrupted.
+func (store *MemoryFileStore) FileVerify(meta FileMeta) error {
+	key, err := memoryFileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.files[key]; !ok {
+		return ErrFileMissing
+	}
+	return nil
+}
+
+// FileRestoreFromSwap replaces the file with its swap file. Returns ErrNoData if there is none
+func (store *MemoryFileStore) FileRestoreFromSwap(meta FileMeta) error {
+	key, err := memoryFileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	raw, ok := store.swaps[key]
+	if !ok {
+		return ErrNoData
+	}
+	store.files[key] = append([]byte{}, raw...)
+	return nil
+}
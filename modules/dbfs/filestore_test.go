@@ -0,0 +1,55 @@
+package dbfs_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/dbfs/filestoretest"
+	"github.com/stretchr/testify/require"
+)
+
+// fileStoreKeysProvider resolves "filestorekeys:<id>" to a key made of repeating the first byte of the ID
+type fileStoreKeysProvider struct{}
+
+func (fileStoreKeysProvider) GetSecret(ref string) (string, time.Duration, error) {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{ref[0]}, 32)), 0, nil
+}
+
+func TestDatabaseImpl_FileStore(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+	config.RegisterSecretsProvider("filestorekeys", fileStoreKeysProvider{})
+	defer config.RegisterSecretsProvider("filestorekeys", nil)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(cfg config.ServerCfg) {
+		*serverCfg = cfg
+	}(*serverCfg)
+
+	configs := []struct {
+		name        string
+		deduplicate bool
+		encryption  config.FileEncryptionCfg
+	}{
+		{"Plain", false, config.FileEncryptionCfg{}},
+		{"Deduplicated", true, config.FileEncryptionCfg{}},
+		{"Encrypted", false, config.FileEncryptionCfg{KeyID: "a", Keys: map[string]string{"a": "filestorekeys:a"}}},
+	}
+	for _, cfg := range configs {
+		t.Run(cfg.name, func(t *testing.T) {
+			projectPath, err := ioutil.TempDir("", "filestore")
+			require.NoError(t, err)
+			defer os.RemoveAll(projectPath)
+
+			serverCfg.ProjectPath = projectPath
+			serverCfg.DeduplicateFiles = cfg.deduplicate
+			serverCfg.FileEncryption = cfg.encryption
+			filestoretest.RunAll(t, new(dbfs.DatabaseImpl))
+		})
+	}
+}
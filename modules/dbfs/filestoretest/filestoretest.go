@@ -0,0 +1,197 @@
+// Package filestoretest checks that a dbfs.FileStore keeps the semantics the server relies on, including those of
+// the swap files scrunching depends on, so that new storage backends, or wrappers of existing ones, are held to the
+// same behaviour as the local filesystem. Each implementation's tests should call RunAll with a store of its own.
+package filestoretest
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ProjectID is the project the tests store files in. Stores should be empty, since swap files the tests write can't
+// be removed through a FileStore.
+const ProjectID = 9000000
+
+var contents = []byte("Hello World!\nWelcome to my file\n")
+
+// RunAll runs each of the conformance tests against the store
+func RunAll(t *testing.T, store dbfs.FileStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store dbfs.FileStore)
+	}{
+		{"WriteRead", testWriteRead},
+		{"Paths", testPaths},
+		{"Delete", testDelete},
+		{"Move", testMove},
+		{"SharedContents", testSharedContents},
+		{"Verify", testVerify},
+		{"Swap", testSwap},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, store)
+		})
+	}
+}
+
+// read returns the file's contents, failing the test if it can't be read
+func read(t *testing.T, store dbfs.FileStore, relpath string, filename string) []byte {
+	raw, err := store.FileRead(relpath, filename, ProjectID)
+	require.NoError(t, err)
+	require.NotNil(t, raw)
+	return *raw
+}
+
+// testWriteRead checks that files read back as they were last written
+func testWriteRead(t *testing.T, store dbfs.FileStore) {
+	_, err := store.FileRead(".", "write.txt", ProjectID)
+	assert.Error(t, err, "files that were never written can't be read")
+
+	location, err := store.FileWrite(".", "write.txt", ProjectID, contents)
+	require.NoError(t, err)
+	defer store.FileDelete(".", "write.txt", ProjectID)
+	assert.NotEmpty(t, location, "writes should return where the file was stored")
+	assert.Equal(t, contents, read(t, store, ".", "write.txt"))
+
+	_, err = store.FileWrite("./nested/dir/", "write.txt", ProjectID, []byte("nested"))
+	require.NoError(t, err)
+	defer store.FileDelete("nested/dir", "write.txt", ProjectID)
+	assert.Equal(t, []byte("nested"), read(t, store, "nested/dir", "write.txt"),
+		"equivalent relative paths should name the same file")
+	assert.Equal(t, contents, read(t, store, ".", "write.txt"), "files in other directories should be kept apart")
+
+	_, err = store.FileWrite(".", "write.txt", ProjectID, []byte("replaced"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("replaced"), read(t, store, ".", "write.txt"))
+
+	_, err = store.FileWrite(".", "empty.txt", ProjectID, []byte{})
+	require.NoError(t, err)
+	defer store.FileDelete(".", "empty.txt", ProjectID)
+	assert.Empty(t, read(t, store, ".", "empty.txt"), "empty files should be stored")
+}
+
+// testPaths checks that files can't be stored outside of their project
+func testPaths(t *testing.T, store dbfs.FileStore) {
+	for _, relpath := range []string{"..", "../1", "fake/../../../"} {
+		_, err := store.FileWrite(relpath, "escape.txt", ProjectID, contents)
+		assert.Equal(t, dbfs.ErrMaliciousRequest, err, "writes to %q should be refused", relpath)
+		_, err = store.FileRead(relpath, "escape.txt", ProjectID)
+		assert.Equal(t, dbfs.ErrMaliciousRequest, err, "reads from %q should be refused", relpath)
+	}
+	_, err := store.FileWrite(".", "dir/escape.txt", ProjectID, contents)
+	assert.Equal(t, dbfs.ErrMaliciousRequest, err, "file names may not contain a path")
+
+	_, err = store.FileWrite(".", "stay.txt", ProjectID, contents)
+	require.NoError(t, err)
+	defer store.FileDelete(".", "stay.txt", ProjectID)
+	assert.Equal(t, dbfs.ErrMaliciousRequest, store.FileMove(".", "stay.txt", "..", "stay.txt", ProjectID))
+	assert.Equal(t, contents, read(t, store, ".", "stay.txt"), "refused moves should leave the file in place")
+}
+
+// testDelete checks that deleted files are gone
+func testDelete(t *testing.T, store dbfs.FileStore) {
+	_, err := store.FileWrite(".", "delete.txt", ProjectID, contents)
+	require.NoError(t, err)
+
+	require.NoError(t, store.FileDelete(".", "delete.txt", ProjectID))
+	_, err = store.FileRead(".", "delete.txt", ProjectID)
+	assert.Error(t, err, "deleted files can't be read")
+	assert.Error(t, store.FileDelete(".", "delete.txt", ProjectID), "files can only be deleted once")
+}
+
+// testMove checks that moved files are only found at their new path
+func testMove(t *testing.T, store dbfs.FileStore) {
+	_, err := store.FileWrite(".", "move.txt", ProjectID, contents)
+	require.NoError(t, err)
+
+	require.NoError(t, store.FileMove(".", "move.txt", "newdir", "moved.txt", ProjectID))
+	defer store.FileDelete("newdir", "moved.txt", ProjectID)
+	assert.Equal(t, contents, read(t, store, "newdir", "moved.txt"))
+	_, err = store.FileRead(".", "move.txt", ProjectID)
+	assert.Error(t, err, "moved files can't be read from where they were")
+
+	moved := dbfs.FileMeta{RelativePath: "newdir", Filename: "moved.txt", ProjectID: ProjectID}
+	assert.NoError(t, store.FileVerify(moved), "moved files should match their checksum")
+
+	assert.Error(t, store.FileMove(".", "move.txt", "newdir", "again.txt", ProjectID),
+		"files that don't exist can't be moved")
+}
+
+// testSharedContents checks that files with the same contents are independent of each other, as they may not be in
+// stores that deduplicate them
+func testSharedContents(t *testing.T, store dbfs.FileStore) {
+	for _, name := range []string{"first.txt", "second.txt"} {
+		_, err := store.FileWrite(".", name, ProjectID, contents)
+		require.NoError(t, err)
+	}
+	defer store.FileDelete(".", "second.txt", ProjectID)
+
+	require.NoError(t, store.FileDelete(".", "first.txt", ProjectID))
+	assert.Equal(t, contents, read(t, store, ".", "second.txt"), "deleting a copy should leave the others")
+
+	_, err := store.FileWrite(".", "second.txt", ProjectID, []byte("changed"))
+	require.NoError(t, err)
+	_, err = store.FileWrite(".", "first.txt", ProjectID, contents)
+	require.NoError(t, err)
+	defer store.FileDelete(".", "first.txt", ProjectID)
+	assert.Equal(t, contents, read(t, store, ".", "first.txt"), "contents should be stored again once released")
+	assert.Equal(t, []byte("changed"), read(t, store, ".", "second.txt"))
+}
+
+// testVerify checks that files are verified against their contents
+func testVerify(t *testing.T, store dbfs.FileStore) {
+	meta := dbfs.FileMeta{RelativePath: ".", Filename: "verify.txt", ProjectID: ProjectID}
+	assert.Equal(t, dbfs.ErrFileMissing, store.FileVerify(meta), "files that were never written are missing")
+
+	_, err := store.FileWrite(meta.RelativePath, meta.Filename, meta.ProjectID, contents)
+	require.NoError(t, err)
+	assert.NoError(t, store.FileVerify(meta))
+
+	require.NoError(t, store.FileDelete(meta.RelativePath, meta.Filename, meta.ProjectID))
+	assert.Equal(t, dbfs.ErrFileMissing, store.FileVerify(meta), "deleted files are missing")
+}
+
+// testSwap checks that swap files are kept apart from the files they are for, until they are restored
+func testSwap(t *testing.T, store dbfs.FileStore) {
+	meta := dbfs.FileMeta{RelativePath: ".", Filename: "swap.txt", ProjectID: ProjectID}
+	scrunched := append(append([]byte{}, contents...), "with its changes applied\n"...)
+
+	_, err := store.FileWrite(meta.RelativePath, meta.Filename, meta.ProjectID, contents)
+	require.NoError(t, err)
+	defer store.FileDelete(meta.RelativePath, meta.Filename, meta.ProjectID)
+	assert.Equal(t, dbfs.ErrNoData, store.FileRestoreFromSwap(meta), "files without a swap file can't be restored")
+	_, err = store.FileReadSwap(meta)
+	assert.Equal(t, dbfs.ErrNoData, err, "files without a swap file have nothing to read from it")
+
+	require.NoError(t, store.FileWriteToSwap(meta, scrunched))
+	swap, err := store.FileReadSwap(meta)
+	require.NoError(t, err)
+	assert.Equal(t, scrunched, *swap)
+	assert.Equal(t, contents, read(t, store, meta.RelativePath, meta.Filename),
+		"writing the swap file should leave the file as it was")
+	assert.NoError(t, store.FileVerify(meta))
+
+	require.NoError(t, store.FileWriteToSwap(meta, scrunched[:len(contents)+4]))
+	require.NoError(t, store.FileWriteToSwap(meta, scrunched))
+
+	// A file lost while its swap file was kept is restored from it
+	require.NoError(t, store.FileDelete(meta.RelativePath, meta.Filename, meta.ProjectID))
+	require.NoError(t, store.FileRestoreFromSwap(meta))
+	assert.Equal(t, scrunched, read(t, store, meta.RelativePath, meta.Filename),
+		"restored files should have the contents last written to their swap file")
+	assert.NoError(t, store.FileVerify(meta), "restored files should match their checksum")
+
+	// Swap files are kept, so a file can be restored again
+	_, err = store.FileWrite(meta.RelativePath, meta.Filename, meta.ProjectID, []byte("overwritten"))
+	require.NoError(t, err)
+	require.NoError(t, store.FileRestoreFromSwap(meta))
+	assert.Equal(t, scrunched, read(t, store, meta.RelativePath, meta.Filename))
+
+	// Swap files belong to the path they were written for
+	other := dbfs.FileMeta{RelativePath: "other", Filename: "swap.txt", ProjectID: ProjectID}
+	assert.Equal(t, dbfs.ErrNoData, store.FileRestoreFromSwap(other))
+}
@@ -4,24 +4,55 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/patching"
 	"github.com/CodeCollaborate/Server/utils"
 )
 
-// TODO (wongb): Move this to config
+// minBufferLength and maxBufferLength are read by requests while the config may be reloaded, so they are only
+// accessed atomically; see MinBufferLength and MaxBufferLength
+var minBufferLength int64 = 50
+var maxBufferLength int64 = 50 * 10
 
-// MinBufferLength specifies the minimum number of patches left in the database after scrunching
-var MinBufferLength = 50
+// MinBufferLength returns the minimum number of patches left in the database after scrunching
+func MinBufferLength() int {
+	return int(atomic.LoadInt64(&minBufferLength))
+}
 
-// MaxBufferLength specifies the maximum number of patches left in the database before scrunching
-var MaxBufferLength = MinBufferLength * 10
+// MaxBufferLength returns the maximum number of patches left in the database before scrunching
+func MaxBufferLength() int {
+	return int(atomic.LoadInt64(&maxBufferLength))
+}
+
+// SetBufferLengths sets the minimum and maximum number of patches left in the database around scrunching
+func SetBufferLengths(min, max int) {
+	atomic.StoreInt64(&minBufferLength, int64(min))
+	atomic.StoreInt64(&maxBufferLength, int64(max))
+}
 
 // ScrunchingExpiryLength specifies the maximum time we will allow scrunching to occur before we
 // consider it failed and could retry
 var ScrunchingExpiryLength = uint32((5 * time.Minute).Seconds())
 
+func init() {
+	// Buffer lengths are safe to change at runtime; in-progress scrunches keep the values they started with.
+	config.OnChange("dbfs", func(oldCfg, newCfg *config.Config) {
+		min, max := MinBufferLength(), MaxBufferLength()
+		if newCfg.ServerConfig.MinBufferLength > 0 {
+			min = newCfg.ServerConfig.MinBufferLength
+		}
+		if newCfg.ServerConfig.MaxBufferLength > 0 {
+			max = newCfg.ServerConfig.MaxBufferLength
+		} else if newCfg.ServerConfig.MinBufferLength > 0 {
+			max = min * 10
+		}
+		SetBufferLengths(min, max)
+	})
+}
+
 // ScrunchFile scrunches all but the last minBufferLength items into the file on disk
 // It then removes the changes from Couchbase
 func (di *DatabaseImpl) ScrunchFile(meta FileMeta) error {
@@ -31,7 +62,19 @@ func (di *DatabaseImpl) ScrunchFile(meta FileMeta) error {
 
 	start := time.Now()
 
-	changes, baseFile, err := di.getForScrunching(meta, MinBufferLength)
+	// Another server scrunching the same file will have taken the changes this one would
+	lock, err := di.MySQLLockAcquire(scrunchLockName(meta.FileID), 0)
+	if err == ErrLockHeld {
+		utils.LogDebug("Scrunching: Already scrunching on another server", utils.LogFields{
+			"FileID": meta.FileID,
+		})
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Scrunching - Failed to lock file for scrunching: %v", err)
+	}
+	defer lock.Release()
+
+	changes, baseFile, err := di.getForScrunching(meta, MinBufferLength())
 	if err != nil {
 		return fmt.Errorf("Scrunching - Failed to retrieve patches and file for scrunching: %v", err)
 	}
@@ -68,6 +111,8 @@ func (di *DatabaseImpl) ScrunchFile(meta FileMeta) error {
 		return fmt.Errorf("Scrunching - Failed to removed scrunched changes: %v", err)
 	}
 
+	recordScrunchedHash(di, meta, changes, result)
+
 	elapsed := time.Since(start)
 
 	utils.LogDebug("Scrunching: Done", utils.LogFields{
@@ -78,17 +123,55 @@ func (di *DatabaseImpl) ScrunchFile(meta FileMeta) error {
 	return nil
 }
 
+// recordScrunchedHash records the hash of the scrunched text, which is at the version after the last of the changes
+// scrunched into it. Failures are only logged; the hash is computed again when the file is next pulled.
+func recordScrunchedHash(db DBFS, meta FileMeta, changes []string, text string) {
+	patch, err := patching.NewPatchFromString(changes[len(changes)-1])
+	if err == nil {
+		err = db.MySQLFileSetContentHash(meta.FileID, ContentHashMeta{
+			Version: patch.BaseVersion + 1,
+			Hash:    ContentHash([]byte(text)),
+		})
+	}
+	if err != nil {
+		utils.LogError("Scrunching: Failed to record content hash", err, utils.LogFields{
+			"FileID": meta.FileID,
+		})
+	}
+}
+
+// scrunchLockName is the name of the lock held while scrunching the file. The Couchbase scrunching lock is still
+// taken as well, for servers that don't take this one, such as during rolling upgrades.
+func scrunchLockName(fileID int64) string {
+	return "scrunch-" + strconv.FormatInt(fileID, 10)
+}
+
 // GetForScrunching gets all but the remainder entries for a file and creates a temp swp file
 // returns the changes for scrunching, the swap file contents, and any errors
 func (di *DatabaseImpl) getForScrunching(fileMeta FileMeta, remainder int) ([]string, []byte, error) {
+	if store, err := di.documentStore(); err != nil {
+		return []string{}, []byte{}, err
+	} else if store != nil {
+		changes, _, err := store.CBGetFileChanges(fileMeta.FileID)
+		if err != nil {
+			return []string{}, []byte{}, err
+		}
+		if len(changes)-(remainder+1) < 0 {
+			return []string{}, []byte{}, ErrNoDbChange
+		}
+		swp, err := di.makeSwp(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID)
+		return changes[0 : len(changes)-remainder], swp, err
+	}
+
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return []string{}, []byte{}, err
 	}
 	fileKey := strconv.FormatInt(fileMeta.FileID, 10)
 
+	started := time.Now()
 	frag, err := cb.bucket.LookupIn(fileKey).Get("changes").Execute()
-	if err != nil {
+	if di.cbTimedResult("LookupIn", fileKey, started, err) != nil {
 		return []string{}, []byte{}, ErrResourceNotFound
 	}
 
@@ -122,6 +205,12 @@ func (di *DatabaseImpl) getForScrunching(fileMeta FileMeta, remainder int) ([]st
 // DeleteForScrunching deletes `num` elements from the front of `changes` for file with `fileID` and deletes the
 // swp file
 func (di *DatabaseImpl) deleteForScrunching(fileMeta FileMeta, num int) error {
+	if store, err := di.documentStore(); err != nil {
+		return err
+	} else if store != nil {
+		return di.removeScrunchedChanges(store, fileMeta, num)
+	}
+
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return err
@@ -135,8 +224,9 @@ func (di *DatabaseImpl) deleteForScrunching(fileMeta FileMeta, num int) error {
 	builder := cb.bucket.MutateIn(fileKey, 0, 0)
 	builder = builder.Upsert("tempchanges", []string{}, false)
 	builder = builder.Upsert("usetemp", true, false)
+	started := time.Now()
 	_, err = builder.Execute()
-	if err != nil {
+	if di.cbTimedResult("MutateIn", fileKey, started, err) != nil {
 		return err
 	}
 
@@ -230,6 +320,45 @@ func (di *DatabaseImpl) deleteForScrunching(fileMeta FileMeta, num int) error {
 	return err
 }
 
+// removeScrunchedChanges replaces the file with its swap file, and removes the changes scrunched into it from a store
+// other than Couchbase. Unlike Couchbase's documents, which keep the changes being scrunched apart until the scrunch
+// finishes, other stores only hold each file's changes, so pulls are held off meanwhile, lest they apply the changes
+// to the scrunched file again. Only this server's pulls are held off, so stores shared by several servers must be
+// scrunched by one of them at a time.
+func (di *DatabaseImpl) removeScrunchedChanges(store DocumentStore, fileMeta FileMeta, num int) error {
+	root := di.root()
+	root.pullMutex.Lock()
+	defer root.pullMutex.Unlock()
+
+	original, err := di.FileRead(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID)
+	if err != nil {
+		return err
+	}
+	if err := di.swapSwp(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID); err != nil {
+		return err
+	}
+	if err := store.CBRemoveFileChanges(fileMeta.FileID, num); err != nil {
+		// undo the swap, so that the changes are only applied once
+		if _, undoErr := di.FileWrite(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID, *original); undoErr != nil {
+			utils.LogError("error restoring file after failing to remove scrunched changes", undoErr, utils.LogFields{
+				"Filename":     fileMeta.Filename,
+				"ProjectID":    fileMeta.ProjectID,
+				"File relpath": fileMeta.RelativePath,
+			})
+		}
+		return err
+	}
+
+	if err := di.deleteSwp(fileMeta.RelativePath, fileMeta.Filename, fileMeta.ProjectID); err != nil {
+		utils.LogError("error deleting swap file", err, utils.LogFields{
+			"Filename":     fileMeta.Filename,
+			"ProjectID":    fileMeta.ProjectID,
+			"File relpath": fileMeta.RelativePath,
+		})
+	}
+	return nil
+}
+
 // scrunchingAddLock hints to the server that the file with key `key` is currently being scrunched
 func (di *DatabaseImpl) scrunchingAddLock(key string) error {
 	cb, err := di.openCouchBase()
@@ -238,8 +367,9 @@ func (di *DatabaseImpl) scrunchingAddLock(key string) error {
 	}
 
 	empty := true
+	started := time.Now()
 	_, err = cb.scrunchingLocksBucket.Insert(key, &empty, ScrunchingExpiryLength)
-	return err
+	return di.cbTimedResult("Insert", key, started, err)
 }
 
 // scrunchingRemoveLock removes the scrunching lock on the file with key `key` so that it can be scrunched later
@@ -249,20 +379,41 @@ func (di *DatabaseImpl) scrunchingRemoveLock(key string) error {
 		return err
 	}
 
+	started := time.Now()
 	_, err = cb.scrunchingLocksBucket.Remove(key, 0)
-	return err
+	return di.cbTimedResult("Remove", key, started, err)
 }
 
 // PullFile pulls the changes and the file bytes from the databases
 func (di *DatabaseImpl) PullFile(meta FileMeta) (*[]byte, []string, error) {
+	if store, err := di.documentStore(); err != nil {
+		return new([]byte), []string{}, err
+	} else if store != nil {
+		root := di.root()
+		root.pullMutex.RLock()
+		defer root.pullMutex.RUnlock()
+
+		changes, _, err := store.CBGetFileChanges(meta.FileID)
+		if err != nil {
+			return new([]byte), []string{}, err
+		}
+		bytes, err := di.FileRead(meta.RelativePath, meta.Filename, meta.ProjectID)
+		if err != nil {
+			return new([]byte), []string{}, err
+		}
+		return bytes, changes, nil
+	}
+
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return new([]byte), []string{}, err
 	}
 
 	file := cbFile{}
-	_, err = cb.bucket.Get(strconv.FormatInt(meta.FileID, 10), &file)
-	if err != nil {
+	key := strconv.FormatInt(meta.FileID, 10)
+	started := time.Now()
+	_, err = cb.bucket.Get(key, &file)
+	if di.cbTimedResult("Get", key, started, err) != nil {
 		return new([]byte), []string{}, err
 	}
 	var changes []string
@@ -271,7 +422,7 @@ func (di *DatabaseImpl) PullFile(meta FileMeta) (*[]byte, []string, error) {
 		changes = append(file.RemainingChanges, file.TempChanges...)
 		changes = append(changes, file.Changes...)
 
-		bytes, err := di.swapRead(meta.RelativePath, meta.Filename, meta.ProjectID)
+		bytes, err := di.FileReadSwap(meta)
 		if err != nil {
 			return new([]byte), []string{}, err
 		}
@@ -292,14 +443,26 @@ func (di *DatabaseImpl) PullFile(meta FileMeta) (*[]byte, []string, error) {
 // PullChanges pulls the changes from the databases and returns them along with the temporary lock value,
 // the file version, and the useTemp flag
 func (di *DatabaseImpl) PullChanges(meta FileMeta) ([]string, uint64, int64, bool, error) {
+	if store, err := di.documentStore(); err != nil {
+		return []string{}, 0, math.MaxInt64, false, err
+	} else if store != nil {
+		changes, version, err := store.CBGetFileChanges(meta.FileID)
+		if err != nil {
+			return []string{}, 0, math.MaxInt64, false, err
+		}
+		return changes, 0, version, false, nil
+	}
+
 	cb, err := di.openCouchBase()
 	if err != nil {
 		return []string{}, 0, math.MaxInt64, false, err
 	}
 
 	file := cbFile{}
-	cas, err := cb.bucket.Get(strconv.FormatInt(meta.FileID, 10), &file)
-	if err != nil {
+	key := strconv.FormatInt(meta.FileID, 10)
+	started := time.Now()
+	cas, err := cb.bucket.Get(key, &file)
+	if di.cbTimedResult("Get", key, started, err) != nil {
 		return []string{}, 0, math.MaxInt64, false, err
 	}
 	var changes []string
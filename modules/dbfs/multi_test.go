@@ -58,8 +58,7 @@ func TestDatabaseImpl_PullFile(t *testing.T) {
 }
 
 func TestDatabaseImpl_ScrunchFile(t *testing.T) {
-	MinBufferLength = 5
-	MaxBufferLength = 30
+	SetBufferLengths(5, 30)
 	patches := make([]string, 50)
 	resultPatches := make([]string, 5)
 	expectedOutput := bytes.Buffer{}
@@ -77,8 +76,8 @@ func TestDatabaseImpl_ScrunchFile(t *testing.T) {
 	}
 
 	expectedOutput.WriteString("te")
-	for i := len(patches) - MinBufferLength - 1; i >= 0; i-- {
-		if i < len(patches)-MinBufferLength {
+	for i := len(patches) - MinBufferLength() - 1; i >= 0; i-- {
+		if i < len(patches)-MinBufferLength() {
 			expectedOutput.WriteString(fmt.Sprintf("%d", i))
 		}
 	}
@@ -95,7 +94,7 @@ func TestDatabaseImpl_ScrunchFile(t *testing.T) {
 	fileBytes, changes, err := di.PullFile(file)
 	assert.NoError(t, err, "error pulling file")
 
-	assert.Len(t, changes, MinBufferLength, "changes size was an unexpected length")
+	assert.Len(t, changes, MinBufferLength(), "changes size was an unexpected length")
 	assert.Equal(t, resultPatches, changes, "changes didn't contain correct changes")
 
 	assert.EqualValues(t, expectedOutput.String(), string(*fileBytes), "Scrunched file differed from expected output")
@@ -141,6 +140,50 @@ func TestDatabaseImpl_DeleteForScrunching(t *testing.T) {
 	assert.EqualValues(t, newRawFile, string(*raw), "raw file did not match")
 }
 
+func TestDatabaseImpl_Scrunching_MemoryStores(t *testing.T) {
+	testConfigSetup(t)
+	serverCfg := &config.GetConfig().ServerConfig
+	defer func(documentStore string, fileStore string) {
+		serverCfg.DocumentStore = documentStore
+		serverCfg.FileStore = fileStore
+	}(serverCfg.DocumentStore, serverCfg.FileStore)
+	serverCfg.DocumentStore = "Memory"
+	serverCfg.FileStore = "Memory"
+
+	di := new(DatabaseImpl)
+	file := FileMeta{RelativePath: "./", Filename: "_test_file_123", ProjectID: 0, FileID: 0}
+	require.NoError(t, di.CBInsertNewFile(file.FileID, 0, []string{}))
+	_, err := di.FileWrite(file.RelativePath, file.Filename, file.ProjectID, []byte(defaultBaseFile))
+	require.NoError(t, err)
+	for _, change := range defaultChanges {
+		_, _, _, _, err = di.CBAppendFileChange(file, change)
+		require.NoError(t, err)
+	}
+
+	_, _, err = di.getForScrunching(file, 2)
+	assert.Equal(t, ErrNoDbChange, err, "files with no more changes than the remainder should not be scrunched")
+	changes, swp, err := di.getForScrunching(file, 1)
+	require.NoError(t, err)
+	assert.Equal(t, transformedChanges[:1], changes)
+	assert.Equal(t, defaultBaseFile, string(swp))
+
+	scrunched, err := patching.PatchTextFromString(string(swp), changes)
+	require.NoError(t, err)
+	require.NoError(t, di.FileWriteToSwap(file, []byte(scrunched)))
+	require.NoError(t, di.deleteForScrunching(file, len(changes)))
+
+	checkPullFile(t, di, file, transformedChanges[1:], scrunched)
+	pulled, _, version, _, err := di.PullChanges(file)
+	require.NoError(t, err)
+	assert.Equal(t, transformedChanges[1:], pulled)
+	assert.EqualValues(t, 2, version, "scrunching should not change the version")
+
+	// Changes that can't be removed leave the file as it was
+	require.NoError(t, di.FileWriteToSwap(file, []byte("scrunched again")))
+	assert.Error(t, di.deleteForScrunching(file, 2))
+	checkPullFile(t, di, file, transformedChanges[1:], scrunched)
+}
+
 func TestDatabaseImpl_PullFile_MidDelete(t *testing.T) {
 	di, file := setupFile(t, defaultBaseFile, defaultChanges)
 
@@ -287,3 +330,22 @@ func checkPullFile(t *testing.T, di *DatabaseImpl, testFile FileMeta, expectedCh
 	assert.EqualValues(t, expectedChanges, changesNew, "file did on contain expected changes")
 	assert.EqualValues(t, expectedRaw, string(*raw), "raw file did not match")
 }
+
+func TestBufferLengthsConcurrentReload(t *testing.T) {
+	defer SetBufferLengths(MinBufferLength(), MaxBufferLength())
+
+	// Requests read the lengths while a config reload sets them; run with -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 100; i++ {
+			SetBufferLengths(i, i*10)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.True(t, MaxBufferLength() >= MinBufferLength())
+	}
+	<-done
+	assert.Equal(t, 100, MinBufferLength())
+	assert.Equal(t, 1000, MaxBufferLength())
+}
@@ -1,84 +1,249 @@
 package dbfs
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql" // required to load into local namespace to
-	// initialize sql driver mapping in sql.Open("mysql", ...)
 	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dblock"
+	"github.com/CodeCollaborate/Server/modules/migrations"
 	"github.com/CodeCollaborate/Server/utils"
+	"github.com/go-sql-driver/mysql" // also initializes sql driver mapping in sql.Open("mysql", ...)
 )
 
+// Name the TLS config is registered under with the MySQL driver
+const mysqlTLSConfigName = "codecollaborate"
+
 type mysqlConn struct {
-	config config.ConnCfg
-	db     *sql.DB
+	config    config.ConnCfg
+	serverCfg *config.Config // The config the connection was made with, for logging slow queries
+	db        *sql.DB
+
+	stmtMutex sync.Mutex
+	stmts     map[string]*sql.Stmt // Prepared statements, by query
+}
+
+// prepared returns the prepared statement for the query, preparing it the first time it is used. database/sql then
+// prepares it once on each connection it runs on, rather than on every call.
+func (c *mysqlConn) prepared(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.stmtMutex.Lock()
+	defer c.stmtMutex.Unlock()
+
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if c.stmts == nil {
+		c.stmts = make(map[string]*sql.Stmt)
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// queryContext runs the query as a prepared statement, abandoning it if the context is done first
+func (c *mysqlConn) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.prepared(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logSlowQuery(ctx, c.serverCfg, query, args, time.Now())
+	return stmt.QueryContext(ctx, args...)
+}
+
+// execContext runs the statement as a prepared statement, abandoning it if the context is done first
+func (c *mysqlConn) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.prepared(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer logSlowQuery(ctx, c.serverCfg, query, args, time.Now())
+	return stmt.ExecContext(ctx, args...)
 }
 
+// close closes the prepared statements and the connection pool
+func (c *mysqlConn) close() error {
+	c.stmtMutex.Lock()
+	for _, stmt := range c.stmts {
+		stmt.Close()
+	}
+	c.stmts = nil
+	c.stmtMutex.Unlock()
+	return c.db.Close()
+}
+
+// retiredPoolGrace is how long a replaced pool is kept open, for the queries of callers that still hold it
+const retiredPoolGrace = time.Minute
+
+// getMySQLConn returns the connection pool, opening it if necessary. database/sql reconnects the pool's dropped
+// connections itself, so the pool is only replaced if it can't reach MySQL while a new one, with the password resolved
+// again, can; such as once the password has been rotated.
 func (di *DatabaseImpl) getMySQLConn() (*mysqlConn, error) {
-	if di.mysqldb != nil && di.mysqldb.db != nil {
-		err := di.mysqldb.db.Ping()
-		if err == nil {
-			return di.mysqldb, nil
-		}
+	di = di.root()
+	di.mysqlMutex.Lock()
+	current := di.mysqldb
+	di.mysqlMutex.Unlock()
+	if current != nil && current.db.Ping() == nil {
+		return current, nil
+	}
+
+	di.mysqlMutex.Lock()
+	defer di.mysqlMutex.Unlock()
+	if di.mysqldb != current {
+		// Another caller replaced the pool while this one was pinging it
+		return di.mysqldb, nil
+	}
+
+	var replacement *mysqlConn
+	var err error
+	if current != nil {
+		replacement, err = openMySQL(current.config, current.serverCfg)
+	} else {
+		replacement, err = openMySQL(di.config().ConnectionConfig["MySQL"], di.config())
+	}
+	if err != nil {
+		// Any current pool is kept, to reconnect by itself once MySQL is reachable again
+		return nil, err
 	}
 
-	if di.mysqldb == nil || di.mysqldb.config == (config.ConnCfg{}) {
-		di.mysqldb = new(mysqlConn)
-		configMap := config.GetConfig()
-		di.mysqldb.config = configMap.ConnectionConfig["MySQL"]
+	di.mysqldb = replacement
+	if current != nil {
+		go func() {
+			time.Sleep(retiredPoolGrace)
+			current.close()
+		}()
 	}
+	return replacement, nil
+}
 
-	if di.mysqldb.config.Schema == "" {
+// openMySQL opens a connection pool with the config, and checks that it can reach MySQL
+func openMySQL(connCfg config.ConnCfg, serverCfg *config.Config) (*mysqlConn, error) {
+	if connCfg.Schema == "" {
 		panic("No MySQL schema found in config")
 	}
 
-	connString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=%ds&parseTime=true",
-		di.mysqldb.config.Username,
-		di.mysqldb.config.Password,
-		di.mysqldb.config.Host,
-		di.mysqldb.config.Port,
-		di.mysqldb.config.Schema,
-		di.mysqldb.config.Timeout)
+	password, err := connCfg.ResolvePassword()
+	if err != nil {
+		utils.LogError("Unable to resolve MySQL password", err, nil)
+		return nil, err
+	}
+
+	tlsConfig, err := connCfg.TLSConfig()
+	if err != nil {
+		utils.LogError("Unable to load MySQL TLS configuration", err, nil)
+		return nil, err
+	}
+	tlsConfigName := ""
+	if tlsConfig != nil {
+		if err = mysql.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+			utils.LogError("Unable to register MySQL TLS configuration", err, nil)
+			return nil, err
+		}
+		tlsConfigName = mysqlTLSConfigName
+	}
+	connString, err := mysqlDSN(connCfg, password, tlsConfigName)
+	if err != nil {
+		utils.LogError("Invalid MySQL connection config", err, nil)
+		return nil, err
+	}
 	db, err := sql.Open("mysql", connString)
 	if err == nil {
-		for i := uint16(0); i < di.mysqldb.config.NumRetries; i++ {
-			if err = db.Ping(); err != nil {
+		err = configureMySQLPool(db, connCfg)
+	}
+	if err == nil {
+		for attempt := uint16(1); ; attempt++ {
+			if db.Ping() == nil {
+				break
+			}
+			if attempt >= connCfg.NumRetries {
 				err = ErrDbNotInitialized
-				time.Sleep(3 * time.Second)
-			} else {
-				di.mysqldb.db = db
-				err = nil
 				break
 			}
+			time.Sleep(3 * time.Second)
 		}
 	}
 
 	utils.LogError("Unable to connect to MySQL", err, utils.LogFields{
-		"Host":   di.mysqldb.config.Host,
-		"Port":   di.mysqldb.config.Port,
-		"Schema": di.mysqldb.config.Schema,
+		"Host":   connCfg.Host,
+		"Port":   connCfg.Port,
+		"Schema": connCfg.Schema,
 	})
 	if err != nil {
-		di.mysqldb = nil
+		if db != nil {
+			db.Close()
+		}
+		// Credentials may have been rotated; refetch them on the next attempt.
+		connCfg.InvalidatePassword()
+		return nil, classify(err, CategoryUnavailable, true)
+	}
+	return &mysqlConn{config: connCfg, serverCfg: serverCfg, db: db}, nil
+}
+
+// mysqlDSN returns the data source name that connects with the config and password, and the registered TLS config,
+// if it is named. The driver formats the credentials, which may hold any character once resolved from a secret.
+func mysqlDSN(connCfg config.ConnCfg, password string, tlsConfigName string) (string, error) {
+	params := fmt.Sprintf("timeout=%ds&parseTime=true", connCfg.Timeout)
+	if tlsConfigName != "" {
+		params += "&tls=" + tlsConfigName
+	}
+	addr := net.JoinHostPort(connCfg.Host, strconv.Itoa(int(connCfg.Port)))
+	dsnCfg, err := mysql.ParseDSN(fmt.Sprintf("tcp(%s)/%s?%s", addr, connCfg.Schema, params))
+	if err != nil {
+		return "", err
+	}
+	dsnCfg.User = connCfg.Username
+	dsnCfg.Passwd = password
+	return dsnCfg.FormatDSN(), nil
+}
+
+// configureMySQLPool applies the connection pool limits in the config
+func configureMySQLPool(db *sql.DB, cfg config.ConnCfg) error {
+	lifetime, err := cfg.ConnMaxLifetimeDuration()
+	if err != nil {
+		return err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
 	}
-	return di.mysqldb, err
+	db.SetConnMaxLifetime(lifetime)
+	return nil
 }
 
 // CloseMySQL closes the MySQL db connection
 // YOU PROBABLY DON'T NEED TO RUN THIS EVER
 func (di *DatabaseImpl) CloseMySQL() error {
-	if di.mysqldb != nil && di.mysqldb.db != nil {
-		err := di.mysqldb.db.Close()
+	di = di.root()
+	di.mysqlMutex.Lock()
+	defer di.mysqlMutex.Unlock()
+
+	if di.mysqldb != nil {
+		err := di.mysqldb.close()
 		di.mysqldb = nil
 		return err
 	}
 	return ErrDbNotInitialized
 }
 
+// MigrateMySQL brings the MySQL schema up to date, returning the migrations that were applied
+func (di *DatabaseImpl) MigrateMySQL() ([]migrations.Migration, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+	return migrations.Apply(mysqlConn.db)
+}
+
 /**
 STORED PROCEDURES
 */
@@ -90,7 +255,7 @@ func (di *DatabaseImpl) MySQLUserRegister(user UserMeta) error {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL user_register(?,?,?,?,?)", user.Username, user.Password, user.Email, user.FirstName, user.LastName)
+	result, err := mysqlConn.execContext(di.context(), "CALL user_register(?,?,?,?,?)", user.Username, user.Password, user.Email, user.FirstName, user.LastName)
 	if err != nil {
 		return err
 	}
@@ -110,10 +275,11 @@ func (di *DatabaseImpl) MySQLUserGetPass(username string) (password string, err
 		return "", err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL user_get_password(?)", username)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_get_password(?)", username)
 	if err != nil {
 		return "", err
 	}
+	defer rows.Close()
 
 	password = ""
 
@@ -127,413 +293,2333 @@ func (di *DatabaseImpl) MySQLUserGetPass(username string) (password string, err
 	return password, nil
 }
 
-// MySQLUserDelete deletes a user from MySQL
-func (di *DatabaseImpl) MySQLUserDelete(username string) ([]int64, error) {
+// MySQLUserSetPass replaces the stored password hash for the given user
+func (di *DatabaseImpl) MySQLUserSetPass(username string, password string) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return []int64{}, err
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL user_set_password(?,?)", username, password)
+	if err != nil {
+		return err
 	}
+	numRows, err := result.RowsAffected()
 
-	rows, err := mysqlConn.db.Query("Call user_get_projectids(?)", username)
+	if err != nil || numRows == 0 {
+		return ErrNoDbChange
+	}
 
-	var projectIDs []int64
-	for rows.Next() {
-		projectID := int64(-1)
-		err = rows.Scan(&projectID)
-		if err != nil {
-			return []int64{}, err
-		}
-		if projectID == -1 {
-			return []int64{}, ErrNoData
-		}
-		projectIDs = append(projectIDs, projectID)
+	return nil
+}
+
+// MySQLUserSetEmailVerified marks the given user's email address as verified
+func (di *DatabaseImpl) MySQLUserSetEmailVerified(username string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL user_delete(?)", username)
+	result, err := mysqlConn.execContext(di.context(), "CALL user_set_email_verified(?)", username)
 	if err != nil {
-		return []int64{}, err
+		return err
 	}
-	numrows, err := result.RowsAffected()
+	numRows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
-		return []int64{}, ErrNoDbChange
+	if err != nil || numRows == 0 {
+		return ErrNoDbChange
 	}
 
-	return projectIDs, nil
+	return nil
 }
 
-// MySQLUserLookup returns user information about a user with the username 'username'
-func (di *DatabaseImpl) MySQLUserLookup(username string) (user UserMeta, err error) {
+// MySQLUserTokenCreate stores the hash of a single-use token for the given user and purpose, replacing any
+// previous token for that purpose
+func (di *DatabaseImpl) MySQLUserTokenCreate(username string, tokenHash string, purpose string, validity time.Duration) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return user, err
+		return err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL user_lookup(?)", username)
+	result, err := mysqlConn.execContext(di.context(), "CALL user_token_create(?,?,?,?)", tokenHash, username, purpose, int64(validity/time.Second))
 	if err != nil {
-		return user, err
+		return err
 	}
+	numRows, err := result.RowsAffected()
 
-	result := false
+	if err != nil || numRows == 0 {
+		return ErrNoDbChange
+	}
+
+	return nil
+}
+
+// MySQLUserTokenConsume deletes the token with the given hash, and returns the user it was issued to.
+// Returns ErrNoData if the token does not exist, has expired, or was issued for a different purpose
+func (di *DatabaseImpl) MySQLUserTokenConsume(tokenHash string, purpose string) (string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_token_consume(?,?)", tokenHash, purpose)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	username := ""
 	for rows.Next() {
-		err = rows.Scan(&user.FirstName, &user.LastName, &user.Email, &user.Username)
+		err = rows.Scan(&username)
 		if err != nil {
-			return user, err
+			return "", err
 		}
-		result = true
 	}
-	if !result {
-		return user, ErrNoData
+	if username == "" {
+		return "", ErrNoData
 	}
-	return user, nil
+
+	return username, nil
 }
 
-// MySQLUserProjects returns the projectID, the project name, and the permission level the user `username` has on that project
-func (di *DatabaseImpl) MySQLUserProjects(username string) ([]ProjectMeta, error) {
+// MySQLAPITokenCreate stores the hash of a new API token, returning its ID. A validity of 0 never expires
+func (di *DatabaseImpl) MySQLAPITokenCreate(tokenHash string, token APITokenMeta, validity time.Duration) (int64, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return nil, err
+		return -1, err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL user_projects(?)", username)
-	if err != nil {
-		return nil, err
+	projectIDs := make([]string, len(token.ProjectIDs))
+	for i, projectID := range token.ProjectIDs {
+		projectIDs[i] = strconv.FormatInt(projectID, 10)
 	}
 
-	projects := []ProjectMeta{}
+	rows, err := mysqlConn.queryContext(di.context(), "CALL api_token_create(?,?,?,?,?,?)", tokenHash, token.Username, token.Name,
+		token.Scope, strings.Join(projectIDs, ","), int64(validity/time.Second))
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
 
+	tokenID := int64(-1)
 	for rows.Next() {
-		project := ProjectMeta{}
-		err = rows.Scan(&project.ProjectID, &project.Name, &project.PermissionLevel)
+		err = rows.Scan(&tokenID)
 		if err != nil {
-			return nil, err
+			return -1, err
 		}
-		projects = append(projects, project)
 	}
 
-	return projects, nil
+	return tokenID, nil
 }
 
-// MySQLProjectCreate create a new project in MySQL
-func (di *DatabaseImpl) MySQLProjectCreate(username string, projectName string) (projectID int64, err error) {
+// MySQLAPITokenLookup returns the API token with the given hash.
+// Returns ErrNoData if the token does not exist or has expired
+func (di *DatabaseImpl) MySQLAPITokenLookup(tokenHash string) (APITokenMeta, error) {
+	token := APITokenMeta{}
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return -1, err
+		return token, err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL project_create(?,?)", projectName, username)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL api_token_lookup(?)", tokenHash)
 	if err != nil {
-		return -1, err
+		return token, err
 	}
+	defer rows.Close()
+
+	found := false
 	for rows.Next() {
-		err = rows.Scan(&projectID)
+		var projectIDs string
+		var expiresAt mysql.NullTime
+		err = rows.Scan(&token.TokenID, &token.Username, &token.Name, &token.Scope, &projectIDs,
+			&token.CreationDate, &expiresAt)
 		if err != nil {
-			return -1, err
+			return token, err
+		}
+		if expiresAt.Valid {
+			token.ExpiresAt = expiresAt.Time
+		}
+		for _, projectID := range strings.Split(projectIDs, ",") {
+			if projectID == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(projectID, 10, 64)
+			if err != nil {
+				return token, err
+			}
+			token.ProjectIDs = append(token.ProjectIDs, id)
 		}
+		found = true
+	}
+	if !found {
+		return token, ErrNoData
 	}
 
-	return projectID, nil
+	return token, nil
 }
 
-// MySQLProjectDelete deletes a project from MySQL
-func (di *DatabaseImpl) MySQLProjectDelete(projectID int64, senderID string) error {
+// MySQLAPITokenRevoke deletes the given user's API token with the given ID
+func (di *DatabaseImpl) MySQLAPITokenRevoke(tokenID int64, username string) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL project_delete(?,?)", projectID, senderID)
+	result, err := mysqlConn.execContext(di.context(), "CALL api_token_revoke(?,?)", tokenID, username)
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
+	numRows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
+	if err != nil || numRows == 0 {
 		return ErrNoDbChange
 	}
+
 	return nil
 }
 
-// MySQLProjectGetFiles returns the Files from the project with projectID = projectID
-func (di *DatabaseImpl) MySQLProjectGetFiles(projectID int64) (files []FileMeta, err error) {
+// MySQLExternalIdentityLookup returns the user linked to the given external provider's subject.
+// Returns ErrNoData if no user has been linked
+func (di *DatabaseImpl) MySQLExternalIdentityLookup(provider string, subject string) (string, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL project_get_files(?)", projectID)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL external_identity_lookup(?,?)", provider, subject)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	defer rows.Close()
 
-	files = []FileMeta{}
-
+	username := ""
 	for rows.Next() {
-		file := FileMeta{}
-		err = rows.Scan(&file.FileID, &file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		err = rows.Scan(&username)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
-		files = append(files, file)
+	}
+	if username == "" {
+		return "", ErrNoData
 	}
 
-	return files, nil
+	return username, nil
 }
 
-// MySQLProjectGrantPermission gives the user `grantUsername` the permission `permissionLevel` on project `projectID`
-func (di *DatabaseImpl) MySQLProjectGrantPermission(projectID int64, grantUsername string, permissionLevel int8, grantedByUsername string) error {
+// MySQLExternalIdentityLink links the given external provider's subject to a user
+func (di *DatabaseImpl) MySQLExternalIdentityLink(provider string, subject string, username string) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL project_grant_permissions(?, ?, ?, ?)", projectID, grantUsername, permissionLevel, grantedByUsername)
+	result, err := mysqlConn.execContext(di.context(), "CALL external_identity_link(?,?,?)", provider, subject, username)
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
+	numRows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
+	if err != nil || numRows == 0 {
 		return ErrNoDbChange
 	}
+
 	return nil
 }
 
-// MySQLProjectRevokePermission removes revokeUsername's permissions from the project
-// DOES NOT WORK FOR OWNER (which is kinda a good thing)
-func (di *DatabaseImpl) MySQLProjectRevokePermission(projectID int64, revokeUsername string, revokedByUsername string) error {
+// MySQLSessionSubscriptionSet records the subscription in the session registry, replacing any previous bindings
+// for the same session and key. The user's expired subscriptions are removed at the same time.
+func (di *DatabaseImpl) MySQLSessionSubscriptionSet(sub SessionSubscriptionMeta, validity time.Duration) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL project_revoke_permissions(?, ?)", projectID, revokeUsername)
+	bindings, err := json.Marshal(sub.Bindings)
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
-		return ErrNoDbChange
+	_, err = mysqlConn.execContext(di.context(), "CALL session_subscription_set(?,?,?,?,?)", sub.SessionID, sub.Key, sub.Username,
+		string(bindings), int64(validity/time.Second))
+	return err
+}
+
+// MySQLSessionSubscriptionRemove removes the session's subscription to the given key
+func (di *DatabaseImpl) MySQLSessionSubscriptionRemove(sessionID string, key string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
 	}
-	return nil
+
+	_, err = mysqlConn.execContext(di.context(), "CALL session_subscription_remove(?,?)", sessionID, key)
+	return err
 }
 
-// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID
-func (di *DatabaseImpl) MySQLUserProjectPermissionLookup(projectID int64, username string) (int8, error) {
+// MySQLSessionGetSubscriptions returns the session's subscriptions that were set within the validity period
+func (di *DatabaseImpl) MySQLSessionGetSubscriptions(sessionID string, validity time.Duration) ([]SessionSubscriptionMeta, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL user_project_permission(?, ?)", username, projectID)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL session_get_subscriptions(?,?)", sessionID, int64(validity/time.Second))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	var permission int8
+	defer rows.Close()
 
-	result := false
+	subs := []SessionSubscriptionMeta{}
 	for rows.Next() {
-		err = rows.Scan(&permission)
+		sub := SessionSubscriptionMeta{SessionID: sessionID}
+		var bindings string
+		err = rows.Scan(&sub.Key, &sub.Username, &bindings, &sub.LastSeen)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		result = true
-	}
-	if !result {
-		return 0, ErrNoData
+		err = json.Unmarshal([]byte(bindings), &sub.Bindings)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
 	}
 
-	return permission, nil
+	return subs, nil
 }
 
-// MySQLProjectRename allows for you to rename projects
-func (di *DatabaseImpl) MySQLProjectRename(projectID int64, newName string) error {
+// MySQLSessionTouch keeps the session's subscriptions from expiring, while its connection is open
+func (di *DatabaseImpl) MySQLSessionTouch(sessionID string) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL project_rename(?, ?)", projectID, newName)
+	_, err = mysqlConn.execContext(di.context(), "CALL session_touch(?)", sessionID)
+	return err
+}
+
+// MySQLSessionDelete removes all of the session's subscriptions
+func (di *DatabaseImpl) MySQLSessionDelete(sessionID string) error {
+	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
-		return ErrNoDbChange
-	}
-	return nil
+	_, err = mysqlConn.execContext(di.context(), "CALL session_delete(?)", sessionID)
+	return err
 }
 
-// MySQLProjectLookup returns the project name and permissions for a project with ProjectID = 'projectID'
-//
-// Looking them up 1 at a time may seem worse, however we're looking up rows based on their primary key
-// so we get the speed benefits of it having a unique index on it
-// Thoughts:
-// 		FIND_IN_SET doesn't use any indices at all,
-// 		both IN and FIND_IN_SET have issues with integers
-// 		more issues when there are a variable number of ID's because MySQL doesn't have arrays
-//
-// http://stackoverflow.com/a/8150183 <- preferred if we switch b/c FIND_IN_SET doesn't use indexes
-func (di *DatabaseImpl) MySQLProjectLookup(projectID int64, username string) (name string, permissions map[string]ProjectPermission, err error) {
-	permissions = make(map[string](ProjectPermission))
+// MySQLUserSessionRecord records that the user made a request on the session's connection, and forgets the user's
+// sessions whose connections have not been touched since forgetBefore, and revoked sessions whose token expired
+func (di *DatabaseImpl) MySQLUserSessionRecord(session UserSessionMeta, forgetBefore time.Time) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return "", permissions, err
+		return err
 	}
 
-	// TODO (optional): un-hardcode '10' as the owner constant in the MySQL ProjectLookup stored proc
+	// WebsocketIDs are random, and stored as signed integers
+	_, err = mysqlConn.execContext(di.context(), "CALL user_session_record(?,?,?,?,?,?,?,?,?)", session.SessionID,
+		session.Username, int64(session.WebsocketID), session.InstanceID, session.RemoteAddr, session.Device,
+		session.TokenHash, session.TokenExpires.Unix(), forgetBefore.Unix())
+	return err
+}
 
-	rows, err := mysqlConn.db.Query("CALL project_lookup(?)", projectID)
+// MySQLUserSessionList returns the user's sessions that are not revoked, and whose connections have been touched since
+// activeSince, most recently active first
+func (di *DatabaseImpl) MySQLUserSessionList(username string, activeSince time.Time) ([]UserSessionMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return "", permissions, err
+		return nil, err
 	}
 
-	result := false
-	var hasAccess = false
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_session_list(?,?)", username, activeSince.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UserSessionMeta{}
 	for rows.Next() {
-		perm := ProjectPermission{}
-		var timeVal string
-		err = rows.Scan(&name, &perm.Username, &perm.PermissionLevel, &perm.GrantedBy, &timeVal)
-		perm.GrantedDate, _ = time.Parse("2006-01-02 15:04:05", timeVal)
+		session := UserSessionMeta{Username: username}
+		var websocketID, tokenExpires, connectedAt, lastActive int64
+		err = rows.Scan(&session.SessionID, &websocketID, &session.InstanceID, &session.RemoteAddr, &session.Device,
+			&session.TokenHash, &tokenExpires, &connectedAt, &lastActive)
 		if err != nil {
-			return "", permissions, err
-		}
-		if !hasAccess && perm.PermissionLevel > 0 && perm.Username == username {
-			hasAccess = true
+			return nil, err
 		}
-		permissions[perm.Username] = perm
-		result = true
+		session.WebsocketID = uint64(websocketID)
+		session.TokenExpires = time.Unix(tokenExpires, 0)
+		session.ConnectedAt = time.Unix(connectedAt, 0)
+		session.LastActive = time.Unix(lastActive, 0)
+		sessions = append(sessions, session)
 	}
 
-	// verify user has access to view this info
-	if !result || !hasAccess {
-		return "", make(map[string](ProjectPermission)), ErrNoData
-	}
-	return name, permissions, err
+	return sessions, nil
 }
 
-// MySQLFileCreate create a new file in MySQL
-func (di *DatabaseImpl) MySQLFileCreate(username string, filename string, relativePath string, projectID int64) (int64, error) {
-	filename = filepath.Clean(filename)
-	if strings.Contains(filename, filePathSeparator) || strings.Contains(filename, "..") {
-		return -1, ErrMaliciousRequest
+// MySQLUserSessionRevoke revokes the user's session, whose token is then refused until it expires. Returns
+// ErrNoDbChange if the user has no such session.
+func (di *DatabaseImpl) MySQLUserSessionRevoke(username string, sessionID string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
 	}
 
-	relativePath = filepath.Clean(relativePath)
-	if strings.HasPrefix(relativePath, "..") {
-		return -1, ErrMaliciousRequest
+	result, err := mysqlConn.execContext(di.context(), "CALL user_session_revoke(?,?)", sessionID, username)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+	if err != nil {
+		return err
 	}
+	if numrows == 0 {
+		return ErrNoDbChange
+	}
+	return nil
+}
 
+// MySQLUserSessionTokenRevoked returns whether the session token with the given hash belongs to a revoked session
+func (di *DatabaseImpl) MySQLUserSessionTokenRevoked(tokenHash string) (bool, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return -1, err
+		return false, err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL file_create(?,?,?,?)", username, filename, relativePath, projectID)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_session_token_revoked(?)", tokenHash)
 	if err != nil {
-		return -1, err
+		return false, err
 	}
+	defer rows.Close()
 
-	var fileID int64
+	count := 0
 	for rows.Next() {
-		err = rows.Scan(&fileID)
+		err = rows.Scan(&count)
 		if err != nil {
-			return -1, ErrNoDbChange
+			return false, err
 		}
 	}
+	return count > 0, nil
+}
 
-	return fileID, nil
+// MySQLUserSessionEnd forgets the session once its connection closes, unless it was revoked
+func (di *DatabaseImpl) MySQLUserSessionEnd(sessionID string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL user_session_end(?)", sessionID)
+	return err
 }
 
-// MySQLFileDelete deletes a file from the MySQL database
-// this does not delete the actual file
-func (di *DatabaseImpl) MySQLFileDelete(fileID int64) error {
+// MySQLIdempotentRequestGet returns the outcome recorded for the user's idempotency key within the validity period
+func (di *DatabaseImpl) MySQLIdempotentRequestGet(username string, key string, validity time.Duration) (IdempotentRequestMeta, error) {
+	req := IdempotentRequestMeta{Username: username, Key: key}
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return req, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL idempotent_request_get(?,?,?)", username, key, int64(validity/time.Second))
+	if err != nil {
+		return req, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return req, ErrNoData
+	}
+	var response string
+	err = rows.Scan(&req.Method, &req.Status, &response, &req.Created)
+	req.Response = []byte(response)
+	return req, err
+}
+
+// MySQLIdempotentRequestReserve records that a request with the user's idempotency key is being processed, taking over
+// a reservation whose lease has passed
+func (di *DatabaseImpl) MySQLIdempotentRequestReserve(username string, key string, method string, validity time.Duration,
+	lease time.Duration) (bool, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL idempotent_request_reserve(?,?,?,?,?)", username, key, method,
+		int64(validity/time.Second), int64(lease/time.Second))
+	if err != nil {
+		return false, err
+	}
+	// The rows affected by a procedure are those of its last statement, the insert
+	numrows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return numrows > 0, nil
+}
+
+// MySQLIdempotentRequestSet records the outcome of the request that reserved the user's idempotency key
+func (di *DatabaseImpl) MySQLIdempotentRequestSet(req IdempotentRequestMeta) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL file_delete(?)", fileID)
+	_, err = mysqlConn.execContext(di.context(), "CALL idempotent_request_set(?,?,?,?)", req.Username, req.Key, req.Status,
+		string(req.Response))
+	return err
+}
+
+// MySQLIdempotentRequestRelease removes the user's idempotency key, so that the request can be retried
+func (di *DatabaseImpl) MySQLIdempotentRequestRelease(username string, key string) error {
+	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
 
-	if err != nil || numrows == 0 {
-		return ErrNoDbChange
+	_, err = mysqlConn.execContext(di.context(), "CALL idempotent_request_release(?,?)", username, key)
+	return err
+}
+
+// MySQLAuditLogAppend adds an entry to the audit log; AuditID and Time are set by the database
+func (di *DatabaseImpl) MySQLAuditLogAppend(entry AuditEntryMeta) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
 	}
-	return nil
+
+	_, err = mysqlConn.execContext(di.context(), "CALL audit_log_append(?,?,?,?,?,?)",
+		entry.Event, entry.Actor, entry.RemoteAddr, entry.ProjectID, entry.Status, entry.Details)
+	return err
 }
 
-// MySQLFileMove updates MySQL with the  new path of the file with FileID == 'fileID'
-func (di *DatabaseImpl) MySQLFileMove(fileID int64, newPath string) error {
-	newPathClean := filepath.Clean(newPath)
-	if strings.HasPrefix(newPathClean, "..") {
-		return ErrMaliciousRequest
+// MySQLAuditLogQuery returns the entries of the audit log matching the filter, oldest first
+func (di *DatabaseImpl) MySQLAuditLogQuery(filter AuditLogFilter) ([]AuditEntryMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL audit_log_query(?,?,?,?,?,?)", filter.Since.Unix(),
+		filter.Until.Unix(), filter.AfterAuditID, filter.Event, filter.Actor, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntryMeta{}
+	for rows.Next() {
+		entry := AuditEntryMeta{}
+		var unixTime int64
+		err = rows.Scan(&entry.AuditID, &unixTime, &entry.Event, &entry.Actor, &entry.RemoteAddr, &entry.ProjectID,
+			&entry.Status, &entry.Details)
+		if err != nil {
+			return nil, err
+		}
+		entry.Time = time.Unix(unixTime, 0)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// MySQLInstanceHeartbeat records that the server instance is running, and forgets instances that have not sent a
+// heartbeat since forgetBefore. Returns whether the instance has been asked to drain.
+func (di *DatabaseImpl) MySQLInstanceHeartbeat(instance InstanceMeta, forgetBefore time.Time) (bool, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL server_instance_heartbeat(?,?,?,?,?,?,?)", instance.InstanceID,
+		instance.Name, instance.Host, instance.Version, instance.StartedAt.Unix(), instance.Connections, forgetBefore.Unix())
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	draining := false
+	for rows.Next() {
+		err = rows.Scan(&draining)
+		if err != nil {
+			return false, err
+		}
+	}
+	return draining, nil
+}
+
+// MySQLInstanceList returns every registered server instance, ordered by name
+func (di *DatabaseImpl) MySQLInstanceList() ([]InstanceMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL server_instance_list()")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instances := []InstanceMeta{}
+	for rows.Next() {
+		instance := InstanceMeta{}
+		var startedAt, lastHeartbeat int64
+		err = rows.Scan(&instance.InstanceID, &instance.Name, &instance.Host, &instance.Version, &startedAt,
+			&lastHeartbeat, &instance.Connections, &instance.Draining)
+		if err != nil {
+			return nil, err
+		}
+		instance.StartedAt = time.Unix(startedAt, 0)
+		instance.LastHeartbeat = time.Unix(lastHeartbeat, 0)
+		instances = append(instances, instance)
 	}
 
+	return instances, nil
+}
+
+// MySQLInstanceSetDraining sets whether the server instance should stop accepting new connections
+func (di *DatabaseImpl) MySQLInstanceSetDraining(instanceID string, draining bool) error {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
 
-	result, err := mysqlConn.db.Exec("CALL file_move(?, ?)", fileID, newPathClean)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL server_instance_set_draining(?,?)", instanceID, draining)
 	if err != nil {
 		return err
 	}
-	numrows, err := result.RowsAffected()
+	defer rows.Close()
 
-	if err != nil || numrows == 0 {
+	found := 0
+	for rows.Next() {
+		err = rows.Scan(&found)
+		if err != nil {
+			return err
+		}
+	}
+	if found == 0 {
 		return ErrNoDbChange
 	}
 	return nil
 }
 
-// MySQLFileRename updates MySQL with the new name of the file with FileID == 'fileID'
-func (di *DatabaseImpl) MySQLFileRename(fileID int64, newName string) error {
-	if strings.Contains(newName, filePathSeparator) {
-		return ErrMaliciousRequest
+// MySQLInstanceDelete removes the server instance from the registry
+func (di *DatabaseImpl) MySQLInstanceDelete(instanceID string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
 	}
 
+	_, err = mysqlConn.execContext(di.context(), "CALL server_instance_delete(?)", instanceID)
+	return err
+}
+
+// MySQLMaintenanceGet returns whether the servers are in maintenance mode, as admins last set it
+func (di *DatabaseImpl) MySQLMaintenanceGet() (MaintenanceMeta, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return err
+		return MaintenanceMeta{}, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL server_maintenance_get()")
+	if err != nil {
+		return MaintenanceMeta{}, err
+	}
+	defer rows.Close()
+
+	maintenance := MaintenanceMeta{}
+	for rows.Next() {
+		var setAt int64
+		err = rows.Scan(&maintenance.Enabled, &maintenance.Message, &maintenance.SetBy, &setAt)
+		if err != nil {
+			return MaintenanceMeta{}, err
+		}
+		maintenance.SetAt = time.Unix(setAt, 0)
 	}
+	return maintenance, nil
+}
 
-	result, err := mysqlConn.db.Exec("CALL file_rename(?, ?)", fileID, newName)
+// MySQLMaintenanceSet sets whether the servers are in maintenance mode
+func (di *DatabaseImpl) MySQLMaintenanceSet(maintenance MaintenanceMeta) error {
+	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
 		return err
 	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL server_maintenance_set(?,?,?)", maintenance.Enabled,
+		maintenance.Message, maintenance.SetBy)
+	return err
+}
+
+// MySQLChangeFeedCursorGet returns the sequence number of the last of the project's notifications the change feed
+// exported; 0 if it has exported none
+func (di *DatabaseImpl) MySQLChangeFeedCursorGet(projectID int64) (int64, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL change_feed_cursor_get(?)", projectID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var sequence int64
+	for rows.Next() {
+		if err = rows.Scan(&sequence); err != nil {
+			return 0, err
+		}
+	}
+	return sequence, nil
+}
+
+// MySQLChangeFeedCursorAdvance moves the project's change feed cursor, if it is still at fromSequence
+func (di *DatabaseImpl) MySQLChangeFeedCursorAdvance(projectID int64, fromSequence int64, toSequence int64) (bool, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL change_feed_cursor_advance(?,?,?)", projectID, fromSequence,
+		toSequence)
+	if err != nil {
+		return false, err
+	}
 	numrows, err := result.RowsAffected()
+	return numrows > 0, err
+}
 
-	if err != nil || numrows == 0 {
-		return ErrNoDbChange
+// MySQLLockAcquire takes the named lock shared by every server, waiting up to wait for another holder to release it
+func (di *DatabaseImpl) MySQLLockAcquire(name string, wait time.Duration) (Lock, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	lock, err := dblock.Acquire(di.context(), mysqlConn.db, name, wait)
+	if err == dblock.ErrLockHeld {
+		return nil, ErrLockHeld
+	} else if err != nil {
+		return nil, err
+	}
+	return lock, nil
 }
 
-// MySQLFileGetInfo returns the meta data about the given file
-func (di *DatabaseImpl) MySQLFileGetInfo(fileID int64) (FileMeta, error) {
-	file := FileMeta{}
+// MySQLUserDelete deletes a user from MySQL
+func (di *DatabaseImpl) MySQLUserDelete(username string) ([]int64, error) {
 	mysqlConn, err := di.getMySQLConn()
 	if err != nil {
-		return file, err
+		return []int64{}, err
 	}
 
-	rows, err := mysqlConn.db.Query("CALL file_get_info(?)", fileID)
+	rows, err := mysqlConn.queryContext(di.context(), "Call user_get_projectids(?)", username)
 	if err != nil {
-		return file, err
+		return []int64{}, err
 	}
+	defer rows.Close()
 
-	file.FileID = fileID
+	var projectIDs []int64
 	for rows.Next() {
-		err = rows.Scan(&file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		projectID := int64(-1)
+		err = rows.Scan(&projectID)
 		if err != nil {
-			return file, err
+			return []int64{}, err
+		}
+		if projectID == -1 {
+			return []int64{}, ErrNoData
 		}
+		projectIDs = append(projectIDs, projectID)
 	}
 
-	return file, nil
+	result, err := mysqlConn.execContext(di.context(), "CALL user_delete(?)", username)
+	if err != nil {
+		return []int64{}, err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return []int64{}, ErrNoDbChange
+	}
+
+	di.metadataCache().forgetAll()
+	return projectIDs, nil
+}
+
+// MySQLUserLookup returns user information about a user with the username 'username'
+func (di *DatabaseImpl) MySQLUserLookup(username string) (user UserMeta, err error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return user, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_lookup(?)", username)
+	if err != nil {
+		return user, err
+	}
+	defer rows.Close()
+
+	result := false
+	for rows.Next() {
+		err = rows.Scan(&user.FirstName, &user.LastName, &user.Email, &user.Username, &user.EmailVerified, &user.Unlisted,
+			&user.AvatarHash)
+		if err != nil {
+			return user, err
+		}
+		result = true
+	}
+	if !result {
+		return user, ErrNoData
+	}
+	return user, nil
+}
+
+// MySQLUserSetUnlisted sets whether the user is hidden from MySQLUserSearch, other than by their exact username
+func (di *DatabaseImpl) MySQLUserSetUnlisted(username string, unlisted bool) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL user_set_unlisted(?, ?)", username, unlisted)
+	return err
+}
+
+// MySQLUserUpdateProfile replaces the user's first and last name
+func (di *DatabaseImpl) MySQLUserUpdateProfile(username string, firstName string, lastName string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL user_update_profile(?, ?, ?)", username, firstName, lastName)
+	return err
+}
+
+// MySQLUserSetAvatar records the hash of the user's avatar, as returned by AvatarWrite; "" if they have none
+func (di *DatabaseImpl) MySQLUserSetAvatar(username string, avatarHash string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL user_set_avatar(?, ?)", username, avatarHash)
+	return err
+}
+
+// MySQLUserChangeUsername renames the user everywhere their username is referenced, keeping the old username as an
+// alias of the new one. Returns ErrNoDbChange if the user doesn't exist, or the new username is another user's, or
+// was another user's
+func (di *DatabaseImpl) MySQLUserChangeUsername(oldUsername string, newUsername string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	tx, err := mysqlConn.db.BeginTx(di.context(), nil)
+	if err != nil {
+		return err
+	}
+
+	// Users may take back a username they had, but not one that another user has or had
+	var taken int
+	err = tx.QueryRowContext(di.context(), "CALL username_taken(?,?)", newUsername, oldUsername).Scan(&taken)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if taken > 0 {
+		tx.Rollback()
+		return ErrNoDbChange
+	}
+
+	// Every foreign key to User.Username cascades, so this renames the user's permissions, files and tokens
+	result, err := tx.ExecContext(di.context(), "CALL user_change_username(?,?)", oldUsername, newUsername)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if numRows, err := result.RowsAffected(); err != nil || numRows == 0 {
+		tx.Rollback()
+		return ErrNoDbChange
+	}
+
+	if _, err := tx.ExecContext(di.context(), "CALL username_alias_add(?,?)", oldUsername, newUsername); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	// The user's files and permissions were renamed along with them
+	di.metadataCache().forgetAll()
+	return nil
+}
+
+// MySQLUserResolveAlias returns the current username of the user who had the given username.
+// Returns ErrNoData if no user changed their username from it
+func (di *DatabaseImpl) MySQLUserResolveAlias(alias string) (string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL username_alias_resolve(?)", alias)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	username := ""
+	for rows.Next() {
+		err = rows.Scan(&username)
+		if err != nil {
+			return "", err
+		}
+	}
+	if username == "" {
+		return "", ErrNoData
+	}
+
+	return username, nil
+}
+
+// MySQLUserAliases returns the usernames the user changed from, oldest first
+func (di *DatabaseImpl) MySQLUserAliases(username string) ([]string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL username_alias_list(?)", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []string{}
+	for rows.Next() {
+		alias := ""
+		err = rows.Scan(&alias)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+// MySQLUserSearch returns up to maxResults users whose username, email, first or last name starts with the prefix, with
+// only their Username, FirstName and LastName, ordered by username after the user whose username is the prefix
+func (di *DatabaseImpl) MySQLUserSearch(prefix string, maxResults int) ([]UserMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_search(?, ?, ?)", strings.ToLower(prefix),
+		escapeLike(prefix)+"%", maxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserMeta{}
+	for rows.Next() {
+		user := UserMeta{}
+		err = rows.Scan(&user.Username, &user.FirstName, &user.LastName)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// MySQLUserProjects returns the projectID, the project name, and the permission level the user `username` has on that project
+func (di *DatabaseImpl) MySQLUserProjects(username string) ([]ProjectMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_projects(?)", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []ProjectMeta{}
+
+	for rows.Next() {
+		project := ProjectMeta{}
+		err = rows.Scan(&project.ProjectID, &project.Name, &project.PermissionLevel)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+
+	return projects, nil
+}
+
+// MySQLProjectCreate create a new project in MySQL
+func (di *DatabaseImpl) MySQLProjectCreate(username string, projectName string) (projectID int64, err error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return -1, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_create(?,?)", projectName, username)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = rows.Scan(&projectID)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return projectID, nil
+}
+
+// MySQLProjectDelete deletes a project from MySQL
+func (di *DatabaseImpl) MySQLProjectDelete(projectID int64, senderID string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL project_delete(?,?)", projectID, senderID)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	// The project's files and permissions are all gone
+	di.metadataCache().forgetAll()
+	return nil
+}
+
+// MySQLProjectGetFiles returns the Files from the project with projectID = projectID
+func (di *DatabaseImpl) MySQLProjectGetFiles(projectID int64) (files []FileMeta, err error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_get_files(?)", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files = []FileMeta{}
+
+	for rows.Next() {
+		file := FileMeta{}
+		err = rows.Scan(&file.FileID, &file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// MySQLProjectGetFilesFiltered returns the Files from the project in the directory, or its subdirectories, with names
+// matching the glob, compared ignoring case
+func (di *DatabaseImpl) MySQLProjectGetFilesFiltered(projectID int64, directory string, glob string) ([]FileMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	directory = cleanDirectory(directory)
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_get_files_filtered(?, ?, ?, ?)",
+		projectID, directory, escapeLike(directory)+"/%", globToLike(glob))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []FileMeta{}
+	for rows.Next() {
+		file := FileMeta{}
+		err = rows.Scan(&file.FileID, &file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// MySQLProjectGrantPermission gives the user `grantUsername` the permission `permissionLevel` on project `projectID`
+func (di *DatabaseImpl) MySQLProjectGrantPermission(projectID int64, grantUsername string, permissionLevel int8, grantedByUsername string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL project_grant_permissions(?, ?, ?, ?)", projectID, grantUsername, permissionLevel, grantedByUsername)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	di.metadataCache().forgetPermission(projectID, grantUsername)
+	return nil
+}
+
+// MySQLProjectRevokePermission removes revokeUsername's permissions from the project
+// DOES NOT WORK FOR OWNER (which is kinda a good thing)
+func (di *DatabaseImpl) MySQLProjectRevokePermission(projectID int64, revokeUsername string, revokedByUsername string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL project_revoke_permissions(?, ?)", projectID, revokeUsername)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	di.metadataCache().forgetPermission(projectID, revokeUsername)
+	return nil
+}
+
+// MySQLUserProjectPermissionLookup returns the permission level of `username` on the project with the given projectID
+func (di *DatabaseImpl) MySQLUserProjectPermissionLookup(projectID int64, username string) (int8, error) {
+	if permission, ok := di.metadataCache().permission(projectID, username); ok {
+		return permission, nil
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_project_permission(?, ?)", username, projectID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var permission int8
+
+	result := false
+	for rows.Next() {
+		err = rows.Scan(&permission)
+		if err != nil {
+			return 0, err
+		}
+		result = true
+	}
+	if !result {
+		return 0, ErrNoData
+	}
+
+	di.metadataCache().setPermission(projectID, username, permission)
+	return permission, nil
+}
+
+// MySQLProjectRename allows for you to rename projects
+func (di *DatabaseImpl) MySQLProjectRename(projectID int64, newName string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL project_rename(?, ?)", projectID, newName)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	return nil
+}
+
+// MySQLProjectLookup returns the project name and permissions for a project with ProjectID = 'projectID'
+//
+// Looking them up 1 at a time may seem worse, however we're looking up rows based on their primary key
+// so we get the speed benefits of it having a unique index on it
+// Thoughts:
+// 		FIND_IN_SET doesn't use any indices at all,
+// 		both IN and FIND_IN_SET have issues with integers
+// 		more issues when there are a variable number of ID's because MySQL doesn't have arrays
+//
+// http://stackoverflow.com/a/8150183 <- preferred if we switch b/c FIND_IN_SET doesn't use indexes
+func (di *DatabaseImpl) MySQLProjectLookup(projectID int64, username string) (name string, permissions map[string]ProjectPermission, err error) {
+	permissions = make(map[string](ProjectPermission))
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return "", permissions, err
+	}
+
+	// TODO (optional): un-hardcode '10' as the owner constant in the MySQL ProjectLookup stored proc
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_lookup(?)", projectID)
+	if err != nil {
+		return "", permissions, err
+	}
+	defer rows.Close()
+
+	result := false
+	var hasAccess = false
+	for rows.Next() {
+		perm := ProjectPermission{}
+		var timeVal string
+		err = rows.Scan(&name, &perm.Username, &perm.PermissionLevel, &perm.GrantedBy, &timeVal)
+		perm.GrantedDate, _ = time.Parse("2006-01-02 15:04:05", timeVal)
+		if err != nil {
+			return "", permissions, err
+		}
+		if !hasAccess && perm.PermissionLevel > 0 && perm.Username == username {
+			hasAccess = true
+		}
+		permissions[perm.Username] = perm
+		result = true
+	}
+
+	// verify user has access to view this info; admins look projects up without a username
+	if !result || (!hasAccess && username != "") {
+		return "", make(map[string](ProjectPermission)), ErrNoData
+	}
+	return name, permissions, err
+}
+
+// MySQLTeamCreate creates a new team, with the creator as its first admin
+func (di *DatabaseImpl) MySQLTeamCreate(username string, teamName string) (int64, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return -1, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL team_create(?,?)", teamName, username)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	teamID := int64(-1)
+	for rows.Next() {
+		err = rows.Scan(&teamID)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return teamID, nil
+}
+
+// MySQLTeamAddMember adds the user to the team, or updates their admin flag if they are already a member
+func (di *DatabaseImpl) MySQLTeamAddMember(teamID int64, username string, isAdmin bool, addedByUsername string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL team_add_member(?,?,?,?)", teamID, username, isAdmin, addedByUsername)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	// The member now has the team's permissions, on projects that aren't known here
+	di.metadataCache().forgetAll()
+	return nil
+}
+
+// MySQLTeamGetMembers returns the members of the team
+func (di *DatabaseImpl) MySQLTeamGetMembers(teamID int64) ([]TeamMemberMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL team_get_members(?)", teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []TeamMemberMeta{}
+	for rows.Next() {
+		member := TeamMemberMeta{}
+		err = rows.Scan(&member.Username, &member.IsAdmin)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// MySQLTeamGrantProjectAccess gives every member of the team the permission `permissionLevel` on project `projectID`
+func (di *DatabaseImpl) MySQLTeamGrantProjectAccess(teamID int64, projectID int64, permissionLevel int8, grantedByUsername string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL team_grant_project_access(?,?,?,?)", teamID, projectID, permissionLevel, grantedByUsername)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	// Every member's permission on the project may have changed
+	di.metadataCache().forgetAll()
+	return nil
+}
+
+// cleanFilePath cleans the file's name and relative path, refusing ones that would reach outside of the project
+func cleanFilePath(filename string, relativePath string) (string, string, error) {
+	filename = filepath.Clean(filename)
+	if strings.Contains(filename, filePathSeparator) || strings.Contains(filename, "..") {
+		return "", "", ErrMaliciousRequest
+	}
+
+	relativePath = filepath.Clean(relativePath)
+	if strings.HasPrefix(relativePath, "..") {
+		return "", "", ErrMaliciousRequest
+	}
+	return filename, relativePath, nil
+}
+
+// MySQLFileCreate create a new file in MySQL
+func (di *DatabaseImpl) MySQLFileCreate(username string, filename string, relativePath string, projectID int64) (int64, error) {
+	filename, relativePath, err := cleanFilePath(filename, relativePath)
+	if err != nil {
+		return -1, err
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return -1, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_create(?,?,?,?)", username, filename, relativePath, projectID)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	var fileID int64
+	for rows.Next() {
+		err = rows.Scan(&fileID)
+		if err != nil {
+			return -1, ErrNoDbChange
+		}
+	}
+
+	return fileID, nil
+}
+
+// mysqlFilesCreateBatchSize is the most files created by a single call to files_create
+const mysqlFilesCreateBatchSize = 500
+
+// MySQLFilesCreate creates each of the files, with its Creator, ProjectID, RelativePath and Filename, and sizes[i] as
+// the size of files[i], in batches rather than one round-trip per file. It returns the ID of each of the files, in
+// order; files that already exist are left as they are, and their ID is returned as 0. None of the files are created if
+// any of their paths are invalid.
+func (di *DatabaseImpl) MySQLFilesCreate(files []FileMeta, sizes []int64) ([]int64, error) {
+	if len(sizes) != len(files) {
+		return nil, ErrInvalidData
+	}
+
+	type newFile struct {
+		Creator      string
+		ProjectID    int64
+		RelativePath string
+		Filename     string
+		Size         int64
+	}
+	newFiles := make([]newFile, len(files))
+	for i, file := range files {
+		filename, relativePath, err := cleanFilePath(file.Filename, file.RelativePath)
+		if err != nil {
+			return nil, err
+		}
+		newFiles[i] = newFile{
+			Creator:      file.Creator,
+			ProjectID:    file.ProjectID,
+			RelativePath: relativePath,
+			Filename:     filename,
+			Size:         sizes[i],
+		}
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	fileIDs := make([]int64, 0, len(files))
+	for start := 0; start < len(newFiles); start += mysqlFilesCreateBatchSize {
+		end := start + mysqlFilesCreateBatchSize
+		if end > len(newFiles) {
+			end = len(newFiles)
+		}
+		batch, err := json.Marshal(newFiles[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err := mysqlConn.queryContext(di.context(), "CALL files_create(?)", string(batch))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var fileID sql.NullInt64
+			if err := rows.Scan(&fileID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			fileIDs = append(fileIDs, fileID.Int64)
+		}
+		rows.Close()
+	}
+	if len(fileIDs) != len(files) {
+		return nil, ErrInternalServerError
+	}
+
+	return fileIDs, nil
+}
+
+// MySQLFileDelete deletes a file from the MySQL database
+// this does not delete the actual file
+func (di *DatabaseImpl) MySQLFileDelete(fileID int64) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL file_delete(?)", fileID)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	di.metadataCache().forgetFileMeta(fileID)
+	return nil
+}
+
+// MySQLFileMove updates MySQL with the  new path of the file with FileID == 'fileID'
+func (di *DatabaseImpl) MySQLFileMove(fileID int64, newPath string) error {
+	newPathClean := filepath.Clean(newPath)
+	if strings.HasPrefix(newPathClean, "..") {
+		return ErrMaliciousRequest
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL file_move(?, ?)", fileID, newPathClean)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	di.metadataCache().forgetFileMeta(fileID)
+	return nil
+}
+
+// MySQLFileRename updates MySQL with the new name of the file with FileID == 'fileID'
+func (di *DatabaseImpl) MySQLFileRename(fileID int64, newName string) error {
+	if strings.Contains(newName, filePathSeparator) {
+		return ErrMaliciousRequest
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	result, err := mysqlConn.execContext(di.context(), "CALL file_rename(?, ?)", fileID, newName)
+	if err != nil {
+		return err
+	}
+	numrows, err := result.RowsAffected()
+
+	if err != nil || numrows == 0 {
+		return ErrNoDbChange
+	}
+	di.metadataCache().forgetFileMeta(fileID)
+	return nil
+}
+
+// MySQLFileGetInfo returns the meta data about the given file
+func (di *DatabaseImpl) MySQLFileGetInfo(fileID int64) (FileMeta, error) {
+	if file, ok := di.metadataCache().fileMeta(fileID); ok {
+		return file, nil
+	}
+
+	file := FileMeta{}
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return file, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_get_info(?)", fileID)
+	if err != nil {
+		return file, err
+	}
+	defer rows.Close()
+
+	file.FileID = fileID
+	for rows.Next() {
+		err = rows.Scan(&file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		if err != nil {
+			return file, err
+		}
+	}
+
+	// Files that don't exist aren't cached, since they may be created under a reused ID
+	if file.ProjectID != 0 {
+		di.metadataCache().setFileMeta(file)
+	}
+	return file, nil
+}
+
+// MySQLFileGetByPath returns the meta data about the files with the given path and name in the project, compared
+// ignoring case
+func (di *DatabaseImpl) MySQLFileGetByPath(projectID int64, relativePath string, filename string) ([]FileMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_get_by_path(?, ?, ?)", projectID, filepath.Clean(relativePath), filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []FileMeta{}
+	for rows.Next() {
+		file := FileMeta{}
+		err = rows.Scan(&file.FileID, &file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// MySQLFileList returns up to limit files, across all projects, with FileIDs greater than afterFileID, in order
+func (di *DatabaseImpl) MySQLFileList(afterFileID int64, limit int) ([]FileMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_list(?, ?)", afterFileID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []FileMeta{}
+	for rows.Next() {
+		file := FileMeta{}
+		err = rows.Scan(&file.FileID, &file.Creator, &file.CreationDate, &file.RelativePath, &file.ProjectID, &file.Filename)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// MySQLFileGetMetadata returns the client-defined key/value metadata of the given file
+func (di *DatabaseImpl) MySQLFileGetMetadata(fileID int64) (map[string]string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_metadata_get(?)", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+
+	return metadata, nil
+}
+
+// MySQLFileSetMetadata sets the given metadata keys on the file; keys with empty values are removed.
+// The keys are all set, or none are.
+func (di *DatabaseImpl) MySQLFileSetMetadata(fileID int64, metadata map[string]string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	tx, err := mysqlConn.db.BeginTx(di.context(), nil)
+	if err != nil {
+		return err
+	}
+	for key, value := range metadata {
+		if value == "" {
+			_, err = tx.ExecContext(di.context(), "CALL file_metadata_delete(?,?)", fileID, key)
+		} else {
+			_, err = tx.ExecContext(di.context(), "CALL file_metadata_set(?,?,?)", fileID, key, value)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// MySQLProjectGetFileMetadata returns the metadata of every file in the project that has any, keyed by fileID
+func (di *DatabaseImpl) MySQLProjectGetFileMetadata(projectID int64) (map[int64]map[string]string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_get_file_metadata(?)", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[int64]map[string]string)
+	for rows.Next() {
+		var fileID int64
+		var key, value string
+		err = rows.Scan(&fileID, &key, &value)
+		if err != nil {
+			return nil, err
+		}
+		if metadata[fileID] == nil {
+			metadata[fileID] = make(map[string]string)
+		}
+		metadata[fileID][key] = value
+	}
+
+	return metadata, nil
+}
+
+// MySQLFileAddSize adds delta to the stored size of the file, in bytes; the size never goes below zero
+func (di *DatabaseImpl) MySQLFileAddSize(fileID int64, delta int64) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL file_size_add(?, ?)", fileID, delta)
+	return err
+}
+
+// MySQLFileGetContentHash returns the hash of the file's text at the latest version it has been computed for
+func (di *DatabaseImpl) MySQLFileGetContentHash(fileID int64) (ContentHashMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return ContentHashMeta{}, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_content_hash_get(?)", fileID)
+	if err != nil {
+		return ContentHashMeta{}, err
+	}
+	defer rows.Close()
+
+	var hash ContentHashMeta
+	for rows.Next() {
+		err = rows.Scan(&hash.Version, &hash.Hash)
+		if err != nil {
+			return ContentHashMeta{}, err
+		}
+	}
+
+	return hash, nil
+}
+
+// MySQLFileSetContentHash records the hash of the file's text at the given version, unless a later version's is
+// already recorded
+func (di *DatabaseImpl) MySQLFileSetContentHash(fileID int64, hash ContentHashMeta) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL file_content_hash_set(?, ?, ?)", fileID, hash.Version, hash.Hash)
+	return err
+}
+
+// MySQLProjectGetContentHashes returns the recorded hash of every file in the project that has one, keyed by fileID
+func (di *DatabaseImpl) MySQLProjectGetContentHashes(projectID int64) (map[int64]ContentHashMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_get_file_content_hashes(?)", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := make(map[int64]ContentHashMeta)
+	for rows.Next() {
+		var fileID int64
+		var hash ContentHashMeta
+		err = rows.Scan(&fileID, &hash.Version, &hash.Hash)
+		if err != nil {
+			return nil, err
+		}
+		hashes[fileID] = hash
+	}
+
+	return hashes, nil
+}
+
+// MySQLCommentCreate creates the comment, starting a thread if its ThreadID is 0, and returns its CommentID
+func (di *DatabaseImpl) MySQLCommentCreate(comment CommentMeta) (int64, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return -1, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL comment_create(?,?,?,?,?,?,?)", comment.ThreadID,
+		comment.FileID, comment.Author, comment.Body, comment.Version, comment.Start, comment.End)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	var commentID int64
+	for rows.Next() {
+		err = rows.Scan(&commentID)
+		if err != nil {
+			return -1, ErrNoDbChange
+		}
+	}
+
+	return commentID, nil
+}
+
+// scanComments reads the comments returned by comment_get and file_get_comments
+func scanComments(rows *sql.Rows) ([]CommentMeta, error) {
+	comments := []CommentMeta{}
+	for rows.Next() {
+		comment := CommentMeta{}
+		var created int64
+		err := rows.Scan(&comment.CommentID, &comment.ThreadID, &comment.FileID, &comment.Author, &comment.Body,
+			&created, &comment.Version, &comment.Start, &comment.End, &comment.Outdated, &comment.ResolvedBy)
+		if err != nil {
+			return nil, err
+		}
+		comment.Created = time.Unix(created, 0)
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// MySQLCommentGet returns the comment; returns ErrNoData if it does not exist
+func (di *DatabaseImpl) MySQLCommentGet(commentID int64) (CommentMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return CommentMeta{}, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL comment_get(?)", commentID)
+	if err != nil {
+		return CommentMeta{}, err
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return CommentMeta{}, err
+	}
+	if len(comments) == 0 {
+		return CommentMeta{}, ErrNoData
+	}
+
+	return comments[0], nil
+}
+
+// MySQLFileGetComments returns every comment on the file, in the order they were created
+func (di *DatabaseImpl) MySQLFileGetComments(fileID int64) ([]CommentMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_get_comments(?)", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+// MySQLCommentSetAnchor sets the Version, Start, End and Outdated of the comment's anchor
+func (di *DatabaseImpl) MySQLCommentSetAnchor(comment CommentMeta) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL comment_set_anchor(?, ?, ?, ?, ?)", comment.CommentID,
+		comment.Version, comment.Start, comment.End, comment.Outdated)
+	return err
+}
+
+// MySQLCommentSetResolved sets who resolved the thread started by the comment; empty to reopen it
+func (di *DatabaseImpl) MySQLCommentSetResolved(commentID int64, resolvedBy string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL comment_set_resolved(?, ?)", commentID, resolvedBy)
+	return err
+}
+
+// MySQLCommentSetReaction adds the user's reaction to the comment, or removes it
+func (di *DatabaseImpl) MySQLCommentSetReaction(reaction CommentReactionMeta, remove bool) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL comment_reaction_set(?, ?, ?, ?)", reaction.CommentID,
+		reaction.Username, reaction.Reaction, remove)
+	return err
+}
+
+// MySQLFileGetCommentReactions returns the reactions to every comment on the file, by comment, in the order they were
+// made
+func (di *DatabaseImpl) MySQLFileGetCommentReactions(fileID int64) ([]CommentReactionMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL file_get_comment_reactions(?)", fileID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []CommentReactionMeta{}
+	for rows.Next() {
+		reaction := CommentReactionMeta{}
+		err = rows.Scan(&reaction.CommentID, &reaction.Username, &reaction.Reaction)
+		if err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+
+	return reactions, nil
+}
+
+// MySQLNotificationAck records that the user has seen the project's notifications up to the given sequence number,
+// unless they have already seen later ones
+func (di *DatabaseImpl) MySQLNotificationAck(username string, projectID int64, sequence int64) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL notification_ack(?, ?, ?)", username, projectID, sequence)
+	return err
+}
+
+// MySQLProjectGetNotificationAcks returns the last of the project's notifications each user has seen, by username
+func (di *DatabaseImpl) MySQLProjectGetNotificationAcks(projectID int64) ([]NotificationAckMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_get_notification_acks(?)", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acks := []NotificationAckMeta{}
+	for rows.Next() {
+		ack := NotificationAckMeta{}
+		var acked int64
+		err = rows.Scan(&ack.Username, &ack.Sequence, &acked)
+		if err != nil {
+			return nil, err
+		}
+		ack.Acked = time.Unix(acked, 0)
+		acks = append(acks, ack)
+	}
+
+	return acks, nil
+}
+
+// MySQLProjectGetUsage returns the total size of the project's files, in bytes
+func (di *DatabaseImpl) MySQLProjectGetUsage(projectID int64) (int64, error) {
+	return di.queryBytes("CALL project_get_usage(?)", projectID)
+}
+
+// MySQLProjectUsageReport returns the usage of the maxResults projects using the most storage, most first
+func (di *DatabaseImpl) MySQLProjectUsageReport(maxResults int) ([]ProjectUsageMeta, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_usage_report(?)", maxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []ProjectUsageMeta{}
+	for rows.Next() {
+		usage := ProjectUsageMeta{}
+		err = rows.Scan(&usage.ProjectID, &usage.Name, &usage.Owner, &usage.UsedBytes, &usage.QuotaBytes)
+		if err != nil {
+			return nil, err
+		}
+		report = append(report, usage)
+	}
+
+	return report, nil
+}
+
+// MySQLUserGetUsage returns the total size of the files the user created, in bytes
+func (di *DatabaseImpl) MySQLUserGetUsage(username string) (int64, error) {
+	return di.queryBytes("CALL user_get_usage(?)", username)
+}
+
+// MySQLUserGetNotificationPrefs returns the projects and events the user has muted; none if they have muted nothing
+func (di *DatabaseImpl) MySQLUserGetNotificationPrefs(username string) (NotificationPrefsMeta, error) {
+	prefs := NotificationPrefsMeta{MutedProjects: []int64{}, MutedEvents: []string{}}
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return prefs, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL user_notification_prefs_get(?)", username)
+	if err != nil {
+		return prefs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projects, events string
+		err = rows.Scan(&projects, &events)
+		if err != nil {
+			return prefs, err
+		}
+		if err = json.Unmarshal([]byte(projects), &prefs.MutedProjects); err != nil {
+			return prefs, err
+		}
+		if err = json.Unmarshal([]byte(events), &prefs.MutedEvents); err != nil {
+			return prefs, err
+		}
+	}
+
+	return prefs, nil
+}
+
+// MySQLUserSetNotificationPrefs replaces the projects and events the user has muted
+func (di *DatabaseImpl) MySQLUserSetNotificationPrefs(username string, prefs NotificationPrefsMeta) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	// Stored as JSON arrays; muting nothing removes the row
+	if prefs.MutedProjects == nil {
+		prefs.MutedProjects = []int64{}
+	}
+	if prefs.MutedEvents == nil {
+		prefs.MutedEvents = []string{}
+	}
+	projects, err := json.Marshal(prefs.MutedProjects)
+	if err != nil {
+		return err
+	}
+	events, err := json.Marshal(prefs.MutedEvents)
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL user_notification_prefs_set(?, ?, ?)", username, string(projects),
+		string(events))
+	return err
+}
+
+// MySQLProjectGetQuota returns the project's storage quota override, in bytes, or 0 if it has none
+func (di *DatabaseImpl) MySQLProjectGetQuota(projectID int64) (int64, error) {
+	return di.queryBytes("CALL project_quota_get(?)", projectID)
+}
+
+// MySQLProjectSetQuota overrides the project's storage quota; quotas of 0 or less remove the override
+func (di *DatabaseImpl) MySQLProjectSetQuota(projectID int64, quotaBytes int64) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL project_quota_set(?, ?)", projectID, quotaBytes)
+	return err
+}
+
+// MySQLProjectGetLineEndings returns the project's line-ending policy, or "" if it preserves line endings as written
+func (di *DatabaseImpl) MySQLProjectGetLineEndings(projectID int64) (string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_line_endings_get(?)", projectID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var policy string
+	for rows.Next() {
+		err = rows.Scan(&policy)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return policy, nil
+}
+
+// MySQLProjectSetLineEndings sets the project's line-ending policy; "Preserve" removes it
+func (di *DatabaseImpl) MySQLProjectSetLineEndings(projectID int64, policy string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL project_line_endings_set(?, ?)", projectID, policy)
+	return err
+}
+
+// MySQLProjectGetArchiveState returns whether the project is "archiving", "archived" or "unarchiving", or "" if it is
+// live
+func (di *DatabaseImpl) MySQLProjectGetArchiveState(projectID int64) (string, error) {
+	if state, ok := di.metadataCache().archiveState(projectID); ok {
+		return state, nil
+	}
+	state, err := di.projectArchiveState(projectID)
+	if err != nil {
+		return "", err
+	}
+	di.metadataCache().setArchiveState(projectID, state)
+	return state, nil
+}
+
+// projectArchiveState reads the project's archive state from MySQL, bypassing the cache
+func (di *DatabaseImpl) projectArchiveState(projectID int64) (string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_archive_get(?)", projectID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var state string
+	for rows.Next() {
+		err = rows.Scan(&state)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return state, nil
+}
+
+// MySQLProjectSetArchiveState sets the project's archive state; "" makes it live. Making a live project read-only
+// returns once no server can still have it cached as live.
+func (di *DatabaseImpl) MySQLProjectSetArchiveState(projectID int64, state string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+	previous, err := di.projectArchiveState(projectID)
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL project_archive_set(?, ?)", projectID, state)
+	di.metadataCache().forgetArchiveState(projectID)
+	if err == nil && previous == "" && state != "" {
+		time.Sleep(di.metadataCache().staleness())
+	}
+	return err
+}
+
+// MySQLProjectGetIgnoreRules returns the project's ignore rules, or none if it has none
+func (di *DatabaseImpl) MySQLProjectGetIgnoreRules(projectID int64) ([]string, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_ignore_rules_get(?)", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Rules are stored one per line
+	rules := []string{}
+	for rows.Next() {
+		var stored string
+		err = rows.Scan(&stored)
+		if err != nil {
+			return nil, err
+		}
+		rules = strings.Split(stored, "\n")
+	}
+
+	return rules, nil
+}
+
+// MySQLProjectSetIgnoreRules replaces the project's ignore rules; empty rules remove them
+func (di *DatabaseImpl) MySQLProjectSetIgnoreRules(projectID int64, rules []string) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = mysqlConn.execContext(di.context(), "CALL project_ignore_rules_set(?, ?)", projectID, strings.Join(rules, "\n"))
+	return err
+}
+
+// MySQLProjectGetSettings returns every one of the project's settings
+func (di *DatabaseImpl) MySQLProjectGetSettings(projectID int64) (ProjectSettingsMeta, error) {
+	settings := ProjectSettingsMeta{IgnoreRules: []string{}}
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return settings, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL project_settings_get(?)", projectID)
+	if err != nil {
+		return settings, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rules, stored string
+		err = rows.Scan(&settings.LineEndings, &rules, &settings.QuotaBytes, &stored)
+		if err != nil {
+			return settings, err
+		}
+		if rules != "" {
+			settings.IgnoreRules = strings.Split(rules, "\n")
+		}
+		var document projectSettingsDocument
+		if err = json.Unmarshal([]byte(stored), &document); err != nil {
+			return settings, err
+		}
+		settings.DefaultRole = document.DefaultRole
+	}
+
+	return settings, nil
+}
+
+// MySQLProjectSetSettings replaces every one of the project's settings, at once
+func (di *DatabaseImpl) MySQLProjectSetSettings(projectID int64, settings ProjectSettingsMeta) error {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return err
+	}
+
+	document, err := json.Marshal(projectSettingsDocument{DefaultRole: settings.DefaultRole})
+	if err != nil {
+		return err
+	}
+	lineEndings := settings.LineEndings
+	if lineEndings == "" {
+		lineEndings = "Preserve"
+	}
+
+	tx, err := mysqlConn.db.BeginTx(di.context(), nil)
+	if err != nil {
+		return err
+	}
+	calls := []struct {
+		query string
+		arg   interface{}
+	}{
+		{"CALL project_line_endings_set(?, ?)", lineEndings},
+		{"CALL project_ignore_rules_set(?, ?)", strings.Join(settings.IgnoreRules, "\n")},
+		{"CALL project_quota_set(?, ?)", settings.QuotaBytes},
+		{"CALL project_settings_set(?, ?)", string(document)},
+	}
+	for _, call := range calls {
+		if _, err := tx.ExecContext(di.context(), call.query, projectID, call.arg); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// externalIDProcedures are the prefixes of the ExternalID procedures of each resource that has them
+var externalIDProcedures = map[string]string{
+	"Project": "project",
+	"File":    "file",
+}
+
+// MySQLExternalIDsGet returns the ExternalIDs of the "Project"s or "File"s with the given IDs, by ID. Those that
+// don't exist are left out.
+func (di *DatabaseImpl) MySQLExternalIDsGet(resource string, ids []int64) (map[int64]string, error) {
+	externalIDs := make(map[int64]string)
+	procedure, ok := externalIDProcedures[resource]
+	if !ok {
+		return externalIDs, ErrInvalidData
+	}
+	list := []string{}
+	for _, id := range ids {
+		if id > 0 {
+			list = append(list, strconv.FormatInt(id, 10))
+		}
+	}
+	if len(list) == 0 {
+		return externalIDs, nil
+	}
+
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return externalIDs, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL "+procedure+"_external_ids_get(?)", strings.Join(list, ","))
+	if err != nil {
+		return externalIDs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var externalID string
+		err = rows.Scan(&id, &externalID)
+		if err != nil {
+			return externalIDs, err
+		}
+		externalIDs[id] = externalID
+	}
+
+	return externalIDs, nil
+}
+
+// MySQLExternalIDResolve returns the ID of the "Project" or "File" with the ExternalID. Returns ErrNoData if there is
+// none
+func (di *DatabaseImpl) MySQLExternalIDResolve(resource string, externalID string) (int64, error) {
+	procedure, ok := externalIDProcedures[resource]
+	if !ok {
+		return -1, ErrInvalidData
+	}
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return -1, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), "CALL "+procedure+"_external_id_resolve(?)", externalID)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	id := int64(-1)
+	for rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			return -1, err
+		}
+	}
+	if id == -1 {
+		return -1, ErrNoData
+	}
+
+	return id, nil
+}
+
+// queryBytes runs a procedure that selects a single byte count, returning 0 if it selects no rows
+func (di *DatabaseImpl) queryBytes(query string, arg interface{}) (int64, error) {
+	mysqlConn, err := di.getMySQLConn()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := mysqlConn.queryContext(di.context(), query, arg)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var bytes int64
+	for rows.Next() {
+		err = rows.Scan(&bytes)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return bytes, nil
 }
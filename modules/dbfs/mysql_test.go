@@ -1,11 +1,15 @@
 package dbfs
 
 import (
+	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var userOne = UserMeta{
@@ -59,6 +63,68 @@ func TestDatabaseImpl_CloseMySQL(t *testing.T) {
 	}
 }
 
+func TestMySQLDSN(t *testing.T) {
+	// Passwords, such as rotated secrets, may hold any character
+	connCfg := config.ConnCfg{Host: "db.example.com", Port: 3306, Schema: "cc", Username: "cc", Timeout: 5}
+	dsn, err := mysqlDSN(connCfg, "p@ss/w:rd?&", "")
+	require.NoError(t, err)
+	parsed, err := mysql.ParseDSN(dsn)
+	require.NoError(t, err)
+	assert.Equal(t, "cc", parsed.User)
+	assert.Equal(t, "p@ss/w:rd?&", parsed.Passwd)
+	assert.Equal(t, "db.example.com:3306", parsed.Addr)
+	assert.Equal(t, "cc", parsed.DBName)
+	assert.Equal(t, 5*time.Second, parsed.Timeout)
+	assert.True(t, parsed.ParseTime)
+}
+
+func TestDatabaseImpl_MySQLUnreachable(t *testing.T) {
+	// Nothing listens on port 1, so neither the pool nor its replacement can reach MySQL
+	connCfg := config.ConnCfg{Host: "127.0.0.1", Port: 1, Schema: "cc", Timeout: 1, NumRetries: 1}
+	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:1)/cc?timeout=1s")
+	require.NoError(t, err)
+	pool := &mysqlConn{config: connCfg, db: db}
+	di := &DatabaseImpl{mysqldb: pool}
+
+	_, err = di.getMySQLConn()
+	assert.Error(t, err)
+	assert.Equal(t, pool, di.mysqldb, "the pool should be kept, to reconnect by itself")
+	assert.NotEqual(t, "sql: database is closed", db.Ping().Error(), "the pool should not have been closed")
+	assert.NoError(t, di.CloseMySQL())
+}
+
+func TestDatabaseImpl_MySQLPreparedStatements(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	defer di.CloseMySQL()
+
+	_, err := di.MySQLUserLookup(userOne.Username)
+	assert.NoError(t, err)
+	_, err = di.MySQLUserLookup(userTwo.Username)
+	assert.NoError(t, err)
+
+	my, err := di.getMySQLConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, my.stmts, 1, "the lookup should have been prepared once")
+}
+
+func TestConfigureMySQLPool(t *testing.T) {
+	db, err := sql.Open("mysql", "user:pass@tcp(localhost:3306)/testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = configureMySQLPool(db, config.ConnCfg{MaxOpenConns: 20, MaxIdleConns: 5, ConnMaxLifetime: "5m"})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, db.Stats().MaxOpenConnections)
+
+	err = configureMySQLPool(db, config.ConnCfg{ConnMaxLifetime: "forever"})
+	assert.Error(t, err)
+}
+
 func TestDatabaseImpl_MySQLUserRegister(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
@@ -96,6 +162,289 @@ func TestDatabaseImpl_MySQLUserGetPass(t *testing.T) {
 	di.MySQLUserDelete(userOne.Username)
 }
 
+func TestDatabaseImpl_MySQLUserSetPass(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = di.MySQLUserSetPass(userOne.Username, "new secure hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pass, err := di.MySQLUserGetPass(userOne.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pass != "new secure hash" {
+		t.Fatal("Password was not updated")
+	}
+
+	err = di.MySQLUserSetPass("nonexistentUser", "new secure hash")
+	assert.EqualError(t, err, ErrNoDbChange.Error(), "expected no user to be updated")
+
+	di.MySQLUserDelete(userOne.Username)
+}
+
+func TestDatabaseImpl_MySQLUserToken(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = di.MySQLUserTokenCreate(userOne.Username, "tokenHash1", "verify_email", time.Hour)
+	assert.NoError(t, err)
+
+	_, err = di.MySQLUserTokenConsume("tokenHash1", "password_reset")
+	assert.EqualError(t, err, ErrNoData.Error(), "token should not be valid for a different purpose")
+
+	username, err := di.MySQLUserTokenConsume("tokenHash1", "verify_email")
+	assert.NoError(t, err)
+	assert.Equal(t, userOne.Username, username)
+
+	_, err = di.MySQLUserTokenConsume("tokenHash1", "verify_email")
+	assert.EqualError(t, err, ErrNoData.Error(), "token should only be usable once")
+
+	err = di.MySQLUserSetEmailVerified(userOne.Username)
+	assert.NoError(t, err)
+	user, err := di.MySQLUserLookup(userOne.Username)
+	assert.NoError(t, err)
+	assert.True(t, user.EmailVerified, "email should be verified")
+
+	di.MySQLUserDelete(userOne.Username)
+}
+
+func TestDatabaseImpl_MySQLAPIToken(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenID, err := di.MySQLAPITokenCreate("apiTokenHash1", APITokenMeta{
+		Username:   userOne.Username,
+		Name:       "ci",
+		Scope:      "read",
+		ProjectIDs: []int64{1, 42},
+	}, 0)
+	assert.NoError(t, err)
+
+	token, err := di.MySQLAPITokenLookup("apiTokenHash1")
+	assert.NoError(t, err)
+	assert.Equal(t, tokenID, token.TokenID)
+	assert.Equal(t, userOne.Username, token.Username)
+	assert.Equal(t, "ci", token.Name)
+	assert.Equal(t, "read", token.Scope)
+	assert.Equal(t, []int64{1, 42}, token.ProjectIDs)
+	assert.True(t, token.ExpiresAt.IsZero(), "token should never expire")
+
+	err = di.MySQLAPITokenRevoke(tokenID, userTwo.Username)
+	assert.EqualError(t, err, ErrNoDbChange.Error(), "users should not be able to revoke other users' tokens")
+
+	err = di.MySQLAPITokenRevoke(tokenID, userOne.Username)
+	assert.NoError(t, err)
+
+	_, err = di.MySQLAPITokenLookup("apiTokenHash1")
+	assert.EqualError(t, err, ErrNoData.Error(), "token should be revoked")
+
+	di.MySQLUserDelete(userOne.Username)
+}
+
+func TestDatabaseImpl_MySQLSession(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := SessionSubscriptionMeta{
+		SessionID: "0123456789abcdef0123456789abcdef",
+		Key:       "Project-1",
+		Username:  userOne.Username,
+		Bindings:  []string{"Project-1.*.File.#"},
+	}
+	err = di.MySQLSessionSubscriptionSet(sub, time.Hour)
+	assert.NoError(t, err)
+
+	// Setting the same key again replaces its bindings
+	sub.Bindings = []string{"Project-1.#"}
+	err = di.MySQLSessionSubscriptionSet(sub, time.Hour)
+	assert.NoError(t, err)
+
+	sub.Key = "User-" + userOne.Username
+	sub.Bindings = nil
+	err = di.MySQLSessionSubscriptionSet(sub, time.Hour)
+	assert.NoError(t, err)
+
+	subs, err := di.MySQLSessionGetSubscriptions(sub.SessionID, time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, subs, 2)
+	for _, s := range subs {
+		assert.Equal(t, userOne.Username, s.Username)
+		if s.Key == "Project-1" {
+			assert.Equal(t, []string{"Project-1.#"}, s.Bindings)
+		}
+	}
+
+	err = di.MySQLSessionTouch(sub.SessionID)
+	assert.NoError(t, err)
+
+	err = di.MySQLSessionSubscriptionRemove(sub.SessionID, "Project-1")
+	assert.NoError(t, err)
+	subs, err = di.MySQLSessionGetSubscriptions(sub.SessionID, time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, subs, 1)
+
+	err = di.MySQLSessionDelete(sub.SessionID)
+	assert.NoError(t, err)
+	subs, err = di.MySQLSessionGetSubscriptions(sub.SessionID, time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, subs, "session should be deleted")
+
+	di.MySQLUserDelete(userOne.Username)
+}
+
+func TestDatabaseImpl_MySQLUserSession(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := UserSessionMeta{
+		SessionID:    "0123456789abcdef0123456789abcdef",
+		Username:     userOne.Username,
+		WebsocketID:  12,
+		InstanceID:   "instance",
+		RemoteAddr:   "10.0.0.1",
+		Device:       "vim",
+		TokenHash:    "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		TokenExpires: time.Now().Add(time.Hour),
+	}
+	err = di.MySQLUserSessionRecord(session, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	sessions, err := di.MySQLUserSessionList(userOne.Username, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, session.WebsocketID, sessions[0].WebsocketID)
+	assert.Equal(t, session.Device, sessions[0].Device)
+	assert.Equal(t, session.TokenHash, sessions[0].TokenHash)
+
+	revoked, err := di.MySQLUserSessionTokenRevoked(session.TokenHash)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	err = di.MySQLUserSessionRevoke(userOne.Username, session.SessionID)
+	assert.NoError(t, err)
+	err = di.MySQLUserSessionRevoke(userOne.Username, session.SessionID)
+	assert.Equal(t, ErrNoDbChange, err, "sessions should only be revoked once")
+
+	revoked, err = di.MySQLUserSessionTokenRevoked(session.TokenHash)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	sessions, err = di.MySQLUserSessionList(userOne.Username, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, sessions, "revoked sessions should not be listed")
+
+	// Revoked sessions outlive their connection, so that their token stays refused
+	err = di.MySQLUserSessionEnd(session.SessionID)
+	assert.NoError(t, err)
+	revoked, err = di.MySQLUserSessionTokenRevoked(session.TokenHash)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	di.MySQLUserDelete(userOne.Username)
+}
+
+func TestDatabaseImpl_MySQLMaintenance(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	defer di.MySQLMaintenanceSet(MaintenanceMeta{})
+
+	err := di.MySQLMaintenanceSet(MaintenanceMeta{Enabled: true, Message: "Upgrading", SetBy: userOne.Username})
+	require.NoError(t, err)
+	maintenance, err := di.MySQLMaintenanceGet()
+	require.NoError(t, err)
+	assert.True(t, maintenance.Enabled)
+	assert.Equal(t, "Upgrading", maintenance.Message)
+	assert.Equal(t, userOne.Username, maintenance.SetBy)
+
+	err = di.MySQLMaintenanceSet(MaintenanceMeta{SetBy: userOne.Username})
+	require.NoError(t, err)
+	maintenance, err = di.MySQLMaintenanceGet()
+	require.NoError(t, err)
+	assert.False(t, maintenance.Enabled)
+	assert.Empty(t, maintenance.Message)
+}
+
+func TestDatabaseImpl_MySQLLockAcquire(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	defer di.CloseMySQL()
+
+	lock, err := di.MySQLLockAcquire("_test_lock", 0)
+	require.NoError(t, err)
+
+	// Locks belong to their connection, so a second acquire fails even from the same server
+	_, err = di.MySQLLockAcquire("_test_lock", 0)
+	assert.Equal(t, ErrLockHeld, err)
+	_, err = di.MySQLLockAcquire("_test_lock", time.Second)
+	assert.Equal(t, ErrLockHeld, err, "should give up after the wait")
+
+	assert.NoError(t, lock.Release())
+	lock, err = di.MySQLLockAcquire("_test_lock", 0)
+	require.NoError(t, err, "should be free once released")
+	assert.NoError(t, lock.Release())
+}
+
+func TestDatabaseImpl_MySQLExternalIdentity(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	di.MySQLUserDelete(userOne.Username)
+
+	err := di.MySQLUserRegister(userOne)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = di.MySQLExternalIdentityLookup("google", "subject-1")
+	assert.EqualError(t, err, ErrNoData.Error(), "identity should not be linked yet")
+
+	err = di.MySQLExternalIdentityLink("google", "subject-1", userOne.Username)
+	assert.NoError(t, err)
+
+	username, err := di.MySQLExternalIdentityLookup("google", "subject-1")
+	assert.NoError(t, err)
+	assert.Equal(t, userOne.Username, username)
+
+	_, err = di.MySQLExternalIdentityLookup("github", "subject-1")
+	assert.EqualError(t, err, ErrNoData.Error(), "identities should be scoped to their provider")
+
+	di.MySQLUserDelete(userOne.Username)
+
+	_, err = di.MySQLExternalIdentityLookup("google", "subject-1")
+	assert.EqualError(t, err, ErrNoData.Error(), "identity should be deleted with its user")
+}
+
 func TestDatabaseImpl_MySQLUserDelete(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
@@ -184,6 +533,133 @@ func TestDatabaseImpl_MySQLUserLookup(t *testing.T) {
 	}
 }
 
+func TestDatabaseImpl_MySQLUserSearch(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	for _, user := range []UserMeta{userOne, userTwo} {
+		di.MySQLUserDelete(user.Username)
+		assert.Nil(t, di.MySQLUserRegister(user))
+		defer di.MySQLUserDelete(user.Username)
+	}
+
+	users, err := di.MySQLUserSearch("_test_", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []UserMeta{
+		{Username: userOne.Username, FirstName: userOne.FirstName, LastName: userOne.LastName},
+		{Username: userTwo.Username, FirstName: userTwo.FirstName, LastName: userTwo.LastName},
+	}, users)
+
+	users, err = di.MySQLUserSearch("fahs", 10)
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, userTwo.Username, users[0].Username)
+	}
+
+	// Underscores are matched literally, rather than as LIKE wildcards
+	users, err = di.MySQLUserSearch("_test_email_", 10)
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+
+	assert.Nil(t, di.MySQLUserSetUnlisted(userTwo.Username, true))
+	user, err := di.MySQLUserLookup(userTwo.Username)
+	assert.Nil(t, err)
+	assert.True(t, user.Unlisted)
+	users, err = di.MySQLUserSearch("_test_", 1)
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, userOne.Username, users[0].Username)
+	}
+	users, err = di.MySQLUserSearch(userTwo.Username, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, userTwo.Username, users[0].Username, "unlisted users should be found by their exact username")
+	}
+}
+
+func TestDatabaseImpl_MySQLUserProfile(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	assert.Nil(t, di.MySQLUserRegister(userOne))
+	defer di.MySQLUserDelete(userOne.Username)
+
+	assert.Nil(t, di.MySQLUserUpdateProfile(userOne.Username, "Renamed", "User"))
+	hash := "a7937b64b8caa58f03721bb6bacf5c78cb235febe0e70b1b84cd99541461a08e"
+	assert.Nil(t, di.MySQLUserSetAvatar(userOne.Username, hash))
+	user, err := di.MySQLUserLookup(userOne.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, "Renamed", user.FirstName)
+	assert.Equal(t, "User", user.LastName)
+	assert.Equal(t, hash, user.AvatarHash)
+
+	assert.Nil(t, di.MySQLUserSetAvatar(userOne.Username, ""))
+	user, err = di.MySQLUserLookup(userOne.Username)
+	assert.Nil(t, err)
+	assert.Empty(t, user.AvatarHash)
+}
+
+func TestDatabaseImpl_MySQLUserChangeUsername(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+	renamed := "_test_renamed"
+
+	for _, username := range []string{userOne.Username, userTwo.Username, renamed} {
+		di.MySQLUserDelete(username)
+	}
+	assert.Nil(t, di.MySQLUserRegister(userOne))
+	assert.Nil(t, di.MySQLUserRegister(userTwo))
+	defer di.MySQLUserDelete(userTwo.Username)
+	defer di.MySQLUserDelete(renamed)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, err := di.MySQLProjectCreate(userOne.Username, "renamedproject")
+	assert.Nil(t, err)
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+
+	assert.Equal(t, ErrNoDbChange, di.MySQLUserChangeUsername(userOne.Username, userTwo.Username),
+		"other users' usernames can't be taken")
+	assert.Equal(t, ErrNoDbChange, di.MySQLUserChangeUsername("_test_nobody", "_test_somebody"))
+
+	assert.Nil(t, di.MySQLUserChangeUsername(userOne.Username, renamed))
+	user, err := di.MySQLUserLookup(renamed)
+	assert.Nil(t, err)
+	assert.Equal(t, userOne.Email, user.Email)
+	projects, err := di.MySQLUserProjects(renamed)
+	assert.Nil(t, err)
+	if assert.Len(t, projects, 1) {
+		assert.Equal(t, projectID, projects[0].ProjectID, "the user's projects should follow them")
+	}
+
+	username, err := di.MySQLUserResolveAlias(userOne.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, renamed, username)
+	_, err = di.MySQLUserResolveAlias(renamed)
+	assert.Equal(t, ErrNoData, err, "current usernames aren't aliases")
+	aliases, err := di.MySQLUserAliases(renamed)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{userOne.Username}, aliases)
+
+	reuse := userTwo
+	reuse.Username = userOne.Username
+	reuse.Email = "_test_reuse@codecollab.cc"
+	assert.Equal(t, ErrNoDbChange, di.MySQLUserRegister(reuse), "old usernames can't be registered")
+	assert.Equal(t, ErrNoDbChange, di.MySQLUserChangeUsername(userTwo.Username, userOne.Username),
+		"old usernames can't be taken by other users")
+
+	// Users may take back their old username, which then resolves to itself
+	assert.Nil(t, di.MySQLUserChangeUsername(renamed, userOne.Username))
+	_, err = di.MySQLUserResolveAlias(userOne.Username)
+	assert.Equal(t, ErrNoData, err)
+	username, err = di.MySQLUserResolveAlias(renamed)
+	assert.Nil(t, err)
+	assert.Equal(t, userOne.Username, username)
+	aliases, err = di.MySQLUserAliases(userOne.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{renamed}, aliases)
+}
+
 func TestDatabaseImpl_MySQLUserProjects(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
@@ -487,6 +963,62 @@ func TestDatabaseImpl_MySqlUserProjectPermissionLookup(t *testing.T) {
 	assert.Equal(t, readPerm.Level, permLevel, "expected user have read permission")
 }
 
+func TestDatabaseImpl_MySQLTeam(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	di.MySQLUserDelete(userTwo.Username)
+
+	defer func() {
+		di.MySQLUserDelete(userOne.Username)
+		di.MySQLUserDelete(userTwo.Username)
+	}()
+
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	err = di.MySQLUserRegister(userTwo)
+	assert.Nil(t, err)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+
+	teamID, err := di.MySQLTeamCreate(userOne.Username, "_test_team")
+	assert.Nil(t, err)
+
+	err = di.MySQLTeamAddMember(teamID, userTwo.Username, false, userOne.Username)
+	assert.Nil(t, err)
+
+	members, err := di.MySQLTeamGetMembers(teamID)
+	assert.Nil(t, err)
+	assert.Len(t, members, 2)
+	assert.Contains(t, members, TeamMemberMeta{Username: userOne.Username, IsAdmin: true}, "creator should be an admin of the team")
+	assert.Contains(t, members, TeamMemberMeta{Username: userTwo.Username, IsAdmin: false})
+
+	_, err = di.MySQLUserProjectPermissionLookup(projectID, userTwo.Username)
+	assert.EqualError(t, err, ErrNoData.Error(), "expected user not have permission")
+
+	writePerm, _ := config.PermissionByLabel("write")
+	err = di.MySQLTeamGrantProjectAccess(teamID, projectID, writePerm.Level, userOne.Username)
+	assert.Nil(t, err)
+
+	permLevel, err := di.MySQLUserProjectPermissionLookup(projectID, userTwo.Username)
+	assert.Nil(t, err, "unexpected error from mysql permission lookup")
+	assert.Equal(t, writePerm.Level, permLevel, "expected user to have the team's permission")
+
+	// The highest of the user's own and their teams' permissions applies
+	adminPerm, _ := config.PermissionByLabel("admin")
+	err = di.MySQLProjectGrantPermission(projectID, userTwo.Username, adminPerm.Level, userOne.Username)
+	assert.Nil(t, err)
+	permLevel, err = di.MySQLUserProjectPermissionLookup(projectID, userTwo.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, adminPerm.Level, permLevel)
+
+	projects, err := di.MySQLUserProjects(userTwo.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, []ProjectMeta{{ProjectID: projectID, Name: "codecollabcore", PermissionLevel: adminPerm.Level}}, projects)
+}
+
 func TestDatabaseImpl_MySQLProjectRename(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
@@ -546,6 +1078,56 @@ func TestDatabaseImpl_MySQLFileCreate(t *testing.T) {
 	assert.Error(t, err, "expected duplicate insertion to fail")
 }
 
+func TestDatabaseImpl_MySQLFilesCreate(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	erro := di.MySQLUserRegister(userOne)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	existingID, err := di.MySQLFileCreate(userOne.Username, "existing", ".", projectID)
+	assert.NoError(t, err)
+
+	// More files than fit in one batch, and one that is already in the project
+	files := []FileMeta{{Creator: userOne.Username, ProjectID: projectID, RelativePath: ".", Filename: "existing"}}
+	sizes := []int64{4}
+	for i := 0; i < mysqlFilesCreateBatchSize+1; i++ {
+		files = append(files, FileMeta{
+			Creator:      userOne.Username,
+			ProjectID:    projectID,
+			RelativePath: "src",
+			Filename:     fmt.Sprintf("file-%d", i),
+		})
+		sizes = append(sizes, 10)
+	}
+	fileIDs, err := di.MySQLFilesCreate(files, sizes)
+	assert.NoError(t, err, "mysql error")
+	assert.Len(t, fileIDs, len(files))
+	assert.EqualValues(t, 0, fileIDs[0], "existing files should be left as they are")
+	assert.NotZero(t, fileIDs[len(fileIDs)-1])
+
+	created, _ := di.MySQLProjectGetFiles(projectID)
+	assert.Equal(t, len(files), len(created), "Project incorrect file count")
+	usage, err := di.MySQLProjectGetUsage(projectID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 10*(mysqlFilesCreateBatchSize+1), usage, "the sizes should be stored with the files")
+	assert.NotEqual(t, existingID, fileIDs[1])
+
+	// Nothing is created if any of the paths are invalid
+	_, err = di.MySQLFilesCreate([]FileMeta{
+		{Creator: userOne.Username, ProjectID: projectID, RelativePath: ".", Filename: "fine"},
+		{Creator: userOne.Username, ProjectID: projectID, RelativePath: "../..", Filename: "passwd"},
+	}, []int64{0, 0})
+	assert.Equal(t, ErrMaliciousRequest, err)
+	created, _ = di.MySQLProjectGetFiles(projectID)
+	assert.Equal(t, len(files), len(created))
+}
+
 func TestDatabaseImpl_MySQLFileDelete(t *testing.T) {
 	testConfigSetup(t)
 	di := new(DatabaseImpl)
@@ -658,3 +1240,346 @@ func TestDatabaseImpl_MySQLFileGetInfo(t *testing.T) {
 		t.Fatalf("Wrong return, got project: %v", filebefore)
 	}
 }
+
+func TestDatabaseImpl_MySQLFileGetByPath(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	erro := di.MySQLUserRegister(userOne)
+	if erro != nil {
+		t.Fatal(erro)
+	}
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, _ := di.MySQLFileCreate(userOne.Username, "file-y", "src/main", projectID)
+	defer di.MySQLFileDelete(fileID)
+
+	files, err := di.MySQLFileGetByPath(projectID, "src/main/", "file-y")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, fileID, files[0].FileID)
+	assert.Equal(t, "src/main", files[0].RelativePath)
+
+	files, err = di.MySQLFileGetByPath(projectID, "Src/Main", "FILE-Y")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	files, err = di.MySQLFileGetByPath(projectID, "src", "file-y")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	files, err = di.MySQLFileGetByPath(projectID+1, "src/main", "file-y")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestDatabaseImpl_MySQLFileMetadata(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, _ := di.MySQLFileCreate(userOne.Username, "file-y", ".", projectID)
+	otherFileID, _ := di.MySQLFileCreate(userOne.Username, "file-z", ".", projectID)
+
+	err = di.MySQLFileSetMetadata(fileID, map[string]string{"language": "go", "encoding": "utf-8"})
+	assert.Nil(t, err)
+	err = di.MySQLFileSetMetadata(fileID, map[string]string{"language": "golang", "encoding": ""})
+	assert.Nil(t, err)
+
+	metadata, err := di.MySQLFileGetMetadata(fileID)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"language": "golang"}, metadata, "values should be replaced, and empty values removed")
+
+	metadata, err = di.MySQLFileGetMetadata(otherFileID)
+	assert.Nil(t, err)
+	assert.Empty(t, metadata)
+
+	projectMetadata, err := di.MySQLProjectGetFileMetadata(projectID)
+	assert.Nil(t, err)
+	assert.Equal(t, map[int64]map[string]string{fileID: {"language": "golang"}}, projectMetadata)
+}
+
+func TestDatabaseImpl_MySQLQuota(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, _ := di.MySQLFileCreate(userOne.Username, "file-y", ".", projectID)
+	otherFileID, _ := di.MySQLFileCreate(userOne.Username, "file-z", ".", projectID)
+
+	assert.Nil(t, di.MySQLFileAddSize(fileID, 100))
+	assert.Nil(t, di.MySQLFileAddSize(fileID, -30))
+	assert.Nil(t, di.MySQLFileAddSize(otherFileID, 5))
+	assert.Nil(t, di.MySQLFileAddSize(otherFileID, -50))
+
+	usage, err := di.MySQLProjectGetUsage(projectID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 70, usage, "sizes should never go below zero")
+
+	usage, err = di.MySQLUserGetUsage(userOne.Username)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 70, usage)
+
+	err = di.MySQLFileDelete(fileID)
+	assert.Nil(t, err)
+	usage, err = di.MySQLProjectGetUsage(projectID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, usage, "deleted files should no longer count towards usage")
+
+	quota, err := di.MySQLProjectGetQuota(projectID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, quota)
+
+	assert.Nil(t, di.MySQLProjectSetQuota(projectID, 1000))
+	assert.Nil(t, di.MySQLProjectSetQuota(projectID, 2000))
+	quota, err = di.MySQLProjectGetQuota(projectID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 2000, quota)
+
+	assert.Nil(t, di.MySQLProjectSetQuota(projectID, 0))
+	quota, err = di.MySQLProjectGetQuota(projectID)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 0, quota, "setting a quota of 0 should remove the override")
+}
+
+func TestDatabaseImpl_MySQLLineEndings(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+
+	policy, err := di.MySQLProjectGetLineEndings(projectID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", policy)
+
+	assert.Nil(t, di.MySQLProjectSetLineEndings(projectID, "LF"))
+	policy, err = di.MySQLProjectGetLineEndings(projectID)
+	assert.Nil(t, err)
+	assert.Equal(t, "LF", policy)
+
+	assert.Nil(t, di.MySQLProjectSetLineEndings(projectID, "Preserve"))
+	policy, err = di.MySQLProjectGetLineEndings(projectID)
+	assert.Nil(t, err)
+	assert.Equal(t, "", policy, "preserving line endings should remove the policy")
+}
+
+func TestDatabaseImpl_MySQLContentHashes(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, err := di.MySQLFileCreate(userOne.Username, "hashed.txt", ".", projectID)
+	assert.Nil(t, err)
+
+	hash, err := di.MySQLFileGetContentHash(fileID)
+	assert.Nil(t, err)
+	assert.Equal(t, ContentHashMeta{}, hash)
+
+	current := ContentHashMeta{Version: 5, Hash: ContentHash([]byte("five"))}
+	assert.Nil(t, di.MySQLFileSetContentHash(fileID, ContentHashMeta{Version: 3, Hash: ContentHash([]byte("three"))}))
+	assert.Nil(t, di.MySQLFileSetContentHash(fileID, current))
+	assert.Nil(t, di.MySQLFileSetContentHash(fileID, ContentHashMeta{Version: 4, Hash: ContentHash([]byte("four"))}))
+	hash, err = di.MySQLFileGetContentHash(fileID)
+	assert.Nil(t, err)
+	assert.Equal(t, current, hash, "hashes of earlier versions should not replace later ones")
+
+	hashes, err := di.MySQLProjectGetContentHashes(projectID)
+	assert.Nil(t, err)
+	assert.Equal(t, map[int64]ContentHashMeta{fileID: current}, hashes)
+
+	assert.Nil(t, di.MySQLFileDelete(fileID))
+	hashes, err = di.MySQLProjectGetContentHashes(projectID)
+	assert.Nil(t, err)
+	assert.Empty(t, hashes)
+}
+
+func TestDatabaseImpl_MySQLComments(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, err := di.MySQLFileCreate(userOne.Username, "reviewed.txt", ".", projectID)
+	assert.Nil(t, err)
+
+	_, err = di.MySQLCommentGet(-1)
+	assert.Equal(t, ErrNoData, err)
+
+	rootID, err := di.MySQLCommentCreate(CommentMeta{FileID: fileID, Author: userOne.Username, Body: "Rename?",
+		Version: 3, Start: 1, End: 4})
+	assert.Nil(t, err)
+	replyID, err := di.MySQLCommentCreate(CommentMeta{ThreadID: rootID, FileID: fileID, Author: userOne.Username,
+		Body: "Sure"})
+	assert.Nil(t, err)
+
+	root, err := di.MySQLCommentGet(rootID)
+	assert.Nil(t, err)
+	assert.Equal(t, rootID, root.ThreadID, "the first comment of a thread should be its own thread")
+	assert.Equal(t, "Rename?", root.Body)
+	assert.Equal(t, 4, root.End)
+	assert.False(t, root.Created.IsZero())
+
+	root.Version, root.Start, root.End, root.Outdated = 5, 3, 6, true
+	assert.Nil(t, di.MySQLCommentSetAnchor(root))
+	assert.Nil(t, di.MySQLCommentSetResolved(rootID, userOne.Username))
+	root.ResolvedBy = userOne.Username
+
+	comments, err := di.MySQLFileGetComments(fileID)
+	assert.Nil(t, err)
+	if assert.Len(t, comments, 2) {
+		assert.Equal(t, root, comments[0])
+		assert.Equal(t, replyID, comments[1].CommentID)
+		assert.Equal(t, rootID, comments[1].ThreadID)
+	}
+
+	assert.Nil(t, di.MySQLFileDelete(fileID))
+	_, err = di.MySQLCommentGet(replyID)
+	assert.Equal(t, ErrNoData, err)
+}
+
+func TestDatabaseImpl_MySQLReactionsAndAcks(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	projectID, _ := di.MySQLProjectCreate(userOne.Username, "codecollabcore")
+	defer di.MySQLProjectDelete(projectID, userOne.Username)
+	fileID, err := di.MySQLFileCreate(userOne.Username, "reviewed.txt", ".", projectID)
+	assert.Nil(t, err)
+	commentID, err := di.MySQLCommentCreate(CommentMeta{FileID: fileID, Author: userOne.Username, Body: "Rename?"})
+	assert.Nil(t, err)
+
+	thumbsUp := CommentReactionMeta{CommentID: commentID, Username: userOne.Username, Reaction: "👍"}
+	eyes := CommentReactionMeta{CommentID: commentID, Username: userOne.Username, Reaction: "👀"}
+	assert.Nil(t, di.MySQLCommentSetReaction(thumbsUp, false))
+	assert.Nil(t, di.MySQLCommentSetReaction(thumbsUp, false))
+	assert.Nil(t, di.MySQLCommentSetReaction(eyes, false))
+	assert.Nil(t, di.MySQLCommentSetReaction(eyes, true))
+	reactions, err := di.MySQLFileGetCommentReactions(fileID)
+	assert.Nil(t, err)
+	assert.Equal(t, []CommentReactionMeta{thumbsUp}, reactions)
+
+	assert.Nil(t, di.MySQLNotificationAck(userOne.Username, projectID, 5))
+	assert.Nil(t, di.MySQLNotificationAck(userOne.Username, projectID, 3))
+	acks, err := di.MySQLProjectGetNotificationAcks(projectID)
+	assert.Nil(t, err)
+	if assert.Len(t, acks, 1) {
+		assert.Equal(t, userOne.Username, acks[0].Username)
+		assert.EqualValues(t, 5, acks[0].Sequence, "earlier acks should not take the user's place back")
+	}
+
+	assert.Nil(t, di.MySQLFileDelete(fileID))
+	reactions, err = di.MySQLFileGetCommentReactions(fileID)
+	assert.Nil(t, err)
+	assert.Empty(t, reactions)
+}
+
+func TestDatabaseImpl_MySQLNotificationPrefs(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	prefs, err := di.MySQLUserGetNotificationPrefs(userOne.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, NotificationPrefsMeta{MutedProjects: []int64{}, MutedEvents: []string{}}, prefs)
+
+	muted := NotificationPrefsMeta{MutedProjects: []int64{4, 7}, MutedEvents: []string{"File.SetMetadata", "Project.*"}}
+	assert.Nil(t, di.MySQLUserSetNotificationPrefs(userOne.Username, muted))
+	prefs, err = di.MySQLUserGetNotificationPrefs(userOne.Username)
+	assert.Nil(t, err)
+	assert.Equal(t, muted, prefs)
+
+	assert.Nil(t, di.MySQLUserSetNotificationPrefs(userOne.Username, NotificationPrefsMeta{}))
+	prefs, err = di.MySQLUserGetNotificationPrefs(userOne.Username)
+	assert.Nil(t, err)
+	assert.Empty(t, prefs.MutedProjects, "muting nothing should remove the preferences")
+	assert.Empty(t, prefs.MutedEvents)
+}
+
+func TestDatabaseImpl_MySQLIdempotentRequest(t *testing.T) {
+	testConfigSetup(t)
+	di := new(DatabaseImpl)
+
+	di.MySQLUserDelete(userOne.Username)
+	err := di.MySQLUserRegister(userOne)
+	assert.Nil(t, err)
+	defer di.MySQLUserDelete(userOne.Username)
+
+	_, err = di.MySQLIdempotentRequestGet(userOne.Username, "retry-1", time.Hour)
+	assert.Equal(t, ErrNoData, err)
+
+	reserved, err := di.MySQLIdempotentRequestReserve(userOne.Username, "retry-1", "Project.Create", time.Hour, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, reserved)
+	reserved, err = di.MySQLIdempotentRequestReserve(userOne.Username, "retry-1", "Project.Create", time.Hour, time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, reserved, "keys should only be reserved once")
+
+	// Reservations whose lease has passed are taken over
+	reserved, err = di.MySQLIdempotentRequestReserve(userOne.Username, "retry-1", "Project.Create", time.Hour, 0)
+	assert.Nil(t, err)
+	assert.True(t, reserved, "the reservation should have been taken over")
+
+	pending, err := di.MySQLIdempotentRequestGet(userOne.Username, "retry-1", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pending.Status)
+
+	err = di.MySQLIdempotentRequestSet(IdempotentRequestMeta{
+		Username: userOne.Username,
+		Key:      "retry-1",
+		Status:   200,
+		Response: []byte(`{"ProjectID":12}`),
+	})
+	assert.Nil(t, err)
+
+	recorded, err := di.MySQLIdempotentRequestGet(userOne.Username, "retry-1", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, "Project.Create", recorded.Method)
+	assert.Equal(t, 200, recorded.Status)
+	assert.Equal(t, `{"ProjectID":12}`, string(recorded.Response))
+	reserved, err = di.MySQLIdempotentRequestReserve(userOne.Username, "retry-1", "Project.Create", time.Hour, 0)
+	assert.Nil(t, err)
+	assert.False(t, reserved, "recorded outcomes should not be taken over")
+
+	assert.Nil(t, di.MySQLIdempotentRequestRelease(userOne.Username, "retry-1"))
+	_, err = di.MySQLIdempotentRequestGet(userOne.Username, "retry-1", time.Hour)
+	assert.Equal(t, ErrNoData, err)
+}
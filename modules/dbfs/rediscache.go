@@ -0,0 +1,198 @@
+package dbfs
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * A minimal Redis client for the metadata cache, speaking RESP (https://redis.io/docs/reference/protocol-spec/) over
+ * a single connection; just enough to GET, SET, DEL and INCR. The connection is made when it is first needed, and
+ * again after it fails.
+ */
+
+type redisCacheStore struct {
+	connCfg config.ConnCfg
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newRedisCacheStore(connCfg config.ConnCfg) *redisCacheStore {
+	return &redisCacheStore{connCfg: connCfg}
+}
+
+func (store *redisCacheStore) timeout() time.Duration {
+	if store.connCfg.Timeout == 0 {
+		return time.Second
+	}
+	return time.Duration(store.connCfg.Timeout) * time.Second
+}
+
+// connect dials the server and authenticates; the mutex must be held
+func (store *redisCacheStore) connect() error {
+	port := store.connCfg.Port
+	if port == 0 {
+		port = 6379
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(store.connCfg.Host, strconv.Itoa(int(port))), store.timeout())
+	if err != nil {
+		return err
+	}
+	if store.connCfg.UseTLS {
+		tlsConfig, err := store.connCfg.TLSConfig()
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = store.connCfg.Host
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+	store.conn, store.reader = conn, bufio.NewReader(conn)
+
+	password, err := store.connCfg.ResolvePassword()
+	if err == nil && password != "" {
+		args := []string{"AUTH", password}
+		if store.connCfg.Username != "" {
+			args = []string{"AUTH", store.connCfg.Username, password}
+		}
+		_, err = store.roundTrip(args...)
+	}
+	if err != nil {
+		store.disconnect()
+		store.connCfg.InvalidatePassword()
+	}
+	return err
+}
+
+// disconnect closes the connection; the mutex must be held
+func (store *redisCacheStore) disconnect() {
+	if store.conn != nil {
+		store.conn.Close()
+	}
+	store.conn, store.reader = nil, nil
+}
+
+// do sends the command and returns its reply, reconnecting first if needed. A nil reply, for missing keys, is
+// returned as nil.
+func (store *redisCacheStore) do(args ...string) (interface{}, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.conn == nil {
+		if err := store.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := store.roundTrip(args...)
+	if _, ok := err.(redisError); !ok && err != nil {
+		// The connection may be out of step with its replies
+		store.disconnect()
+	}
+	return reply, err
+}
+
+// roundTrip writes the command and reads its reply; the mutex must be held
+func (store *redisCacheStore) roundTrip(args ...string) (interface{}, error) {
+	store.conn.SetDeadline(time.Now().Add(store.timeout()))
+	writer := bufio.NewWriter(store.conn)
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(store.reader)
+}
+
+// redisError is an error reply from the server, after which the connection can still be used
+type redisError string
+
+func (err redisError) Error() string {
+	return "Redis: " + string(err)
+}
+
+var errRedisProtocol = errors.New("Redis: malformed reply")
+
+// readRedisReply reads a simple string, error, integer or bulk string reply; commands the cache uses don't reply with
+// arrays
+func readRedisReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errRedisProtocol
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		value := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, value); err != nil {
+			return nil, err
+		}
+		return value[:size], nil
+	}
+	return nil, errRedisProtocol
+}
+
+func (store *redisCacheStore) get(key string) ([]byte, bool, error) {
+	reply, err := store.do("GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, errRedisProtocol
+	}
+	return value, true, nil
+}
+
+func (store *redisCacheStore) set(key string, value []byte, ttl time.Duration) error {
+	_, err := store.do("SET", key, string(value), "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	return err
+}
+
+func (store *redisCacheStore) del(key string) error {
+	_, err := store.do("DEL", key)
+	return err
+}
+
+func (store *redisCacheStore) incr(key string) (int64, error) {
+	reply, err := store.do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := reply.(int64)
+	if !ok {
+		return 0, errRedisProtocol
+	}
+	return value, nil
+}
@@ -0,0 +1,124 @@
+package dbfs
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/migrations"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * MySQL statements and Couchbase operations that take longer than ServerConfig.SlowQueryThreshold are logged, with the
+ * trace ID of the request that made them. Statements are logged with the name of the procedure they call, and their
+ * arguments named by the procedure's parameters. Arguments that hold credentials or what users wrote are redacted,
+ * and long ones are shortened, so that the slow log can be kept at warning level.
+ */
+
+// callPattern matches the procedure a statement calls
+var callPattern = regexp.MustCompile(`^CALL ([a-z_]+)\(`)
+
+// sensitiveArgs are the procedure parameters, besides those the logger treats as sensitive, whose arguments are
+// redacted
+var sensitiveArgs = map[string]bool{
+	"pass":      true, // Password hashes
+	"email":     true,
+	"body":      true, // Comments
+	"details":   true, // Audit log entries
+	"response":  true, // Idempotent requests' responses
+	"metaValue": true, // File metadata
+}
+
+// maxLoggedArgLength is the length that longer arguments are shortened to
+const maxLoggedArgLength = 64
+
+// slowQueryThreshold returns how long database operations may take before they are logged; 0 if they never are
+func slowQueryThreshold(cfg *config.Config) time.Duration {
+	threshold, err := cfg.ServerConfig.SlowQueryThresholdDuration()
+	if err != nil {
+		utils.LogError("Invalid slow query threshold", err, utils.LogFields{
+			"SlowQueryThreshold": cfg.ServerConfig.SlowQueryThreshold,
+		})
+	}
+	return threshold
+}
+
+// logSlowQuery logs the MySQL statement, if it took longer than the slow query threshold since it started
+func logSlowQuery(ctx context.Context, cfg *config.Config, query string, args []interface{}, started time.Time) {
+	elapsed := time.Since(started)
+	threshold := slowQueryThreshold(cfg)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	procedure := query
+	if match := callPattern.FindStringSubmatch(query); match != nil {
+		procedure = match[1]
+	}
+	utils.LogWarn("Slow MySQL query", utils.LogFields{
+		"TraceID":   utils.TraceID(ctx),
+		"Procedure": procedure,
+		"Args":      loggedArgs(procedure, args),
+		"Duration":  elapsed.String(),
+	})
+}
+
+// logSlowCouchbase logs the Couchbase operation on the document, if it took longer than the slow query threshold
+// since it started
+func logSlowCouchbase(ctx context.Context, cfg *config.Config, operation string, key string, started time.Time) {
+	elapsed := time.Since(started)
+	threshold := slowQueryThreshold(cfg)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	utils.LogWarn("Slow Couchbase operation", utils.LogFields{
+		"TraceID":   utils.TraceID(ctx),
+		"Operation": operation,
+		"Key":       key,
+		"Duration":  elapsed.String(),
+	})
+}
+
+// loggedArgs returns the arguments of a call to the procedure, by parameter name, as they are logged. If the
+// procedure's parameters aren't known, they are numbered, and strings aren't logged, since what they hold can't be
+// told.
+func loggedArgs(procedure string, args []interface{}) map[string]interface{} {
+	names := migrations.ProcedureParams()[procedure]
+	if len(names) != len(args) {
+		names = nil
+	}
+
+	logged := make(map[string]interface{}, len(args))
+	for i, arg := range args {
+		key := "$" + strconv.Itoa(i+1)
+		sensitive := true
+		if names != nil {
+			key = names[i]
+			sensitive = sensitiveArgs[key] || utils.IsSensitiveField(key)
+		}
+
+		switch value := arg.(type) {
+		case string:
+			if sensitive {
+				logged[key] = utils.Redacted
+			} else if len(value) > maxLoggedArgLength {
+				logged[key] = value[:maxLoggedArgLength] + "..."
+			} else {
+				logged[key] = value
+			}
+		case []byte:
+			logged[key] = utils.Redacted
+		default:
+			if sensitive && names != nil {
+				logged[key] = utils.Redacted
+			} else {
+				logged[key] = value
+			}
+		}
+	}
+	return logged
+}
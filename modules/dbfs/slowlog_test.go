@@ -0,0 +1,31 @@
+package dbfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggedArgs(t *testing.T) {
+	args := loggedArgs("user_register", []interface{}{"loganga", "$2a$10$hash", "loganga@example.com", "Logan", "Gore"})
+	assert.Equal(t, map[string]interface{}{
+		"username":  "loganga",
+		"pass":      utils.Redacted,
+		"email":     utils.Redacted,
+		"firstName": "Logan",
+		"lastName":  "Gore",
+	}, args, "arguments should be named by parameter, with sensitive ones redacted")
+
+	long := strings.Repeat("a", maxLoggedArgLength+10)
+	args = loggedArgs("user_register", []interface{}{long, "", "", "", ""})
+	assert.Equal(t, long[:maxLoggedArgLength]+"...", args["username"], "long arguments should be shortened")
+
+	args = loggedArgs("not_a_procedure", []interface{}{"secret", int64(4), []byte("contents")})
+	assert.Equal(t, map[string]interface{}{
+		"$1": utils.Redacted,
+		"$2": int64(4),
+		"$3": utils.Redacted,
+	}, args, "strings and bytes of unknown parameters should be redacted")
+}
@@ -0,0 +1,107 @@
+package dbfs
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * The stores DatabaseImpl keeps documents and files' contents in are chosen by name, with ServerConfig.DocumentStore
+ * and ServerConfig.FileStore. "Couchbase" and "Filesystem", the defaults, are built into DatabaseImpl; other stores
+ * are created by the factory registered under their name. Forks and programs embedding the server can add their own,
+ * such as one backed by Ceph, without changing this package, by registering them from an init function of their own
+ * package.
+ *
+ * Optional stores are kept out of the default build by importing their package from a file with a build tag, as the
+ * WebDAV file store in webdavstore is by stores_webdav.go, which only builds with "go build -tags webdav":
+ *
+ *   //go:build webdav
+ *   // +build webdav
+ *
+ *   package main
+ *
+ *   import _ "github.com/CodeCollaborate/Server/modules/dbfs/webdavstore"
+ *
+ * Stores must pass the conformance tests in the documentstoretest and filestoretest packages.
+ */
+
+// DocumentStoreFactory creates a DocumentStore with the config
+type DocumentStoreFactory func(cfg *config.Config) (DocumentStore, error)
+
+// FileStoreFactory creates a FileStore with the config
+type FileStoreFactory func(cfg *config.Config) (FileStore, error)
+
+// ErrUnknownStore is returned when the configured store has no registered factory
+var ErrUnknownStore = errors.New("No store registered with the given name")
+
+var storesMutex sync.Mutex
+var documentStores = map[string]DocumentStoreFactory{
+	"Memory": func(cfg *config.Config) (DocumentStore, error) {
+		return NewMemoryDocumentStore(), nil
+	},
+}
+var fileStores = map[string]FileStoreFactory{
+	"Memory": func(cfg *config.Config) (FileStore, error) {
+		return NewMemoryFileStore(), nil
+	},
+}
+
+// RegisterDocumentStore registers the factory of the document store with the given name, replacing any existing
+// factory. A nil factory unregisters the name.
+func RegisterDocumentStore(name string, factory DocumentStoreFactory) {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	if factory == nil {
+		delete(documentStores, name)
+	} else {
+		documentStores[name] = factory
+	}
+}
+
+// RegisterFileStore registers the factory of the file store with the given name, replacing any existing factory. A nil
+// factory unregisters the name.
+func RegisterFileStore(name string, factory FileStoreFactory) {
+	storesMutex.Lock()
+	defer storesMutex.Unlock()
+
+	if factory == nil {
+		delete(fileStores, name)
+	} else {
+		fileStores[name] = factory
+	}
+}
+
+// openDocumentStore creates the document store the config names; nil for Couchbase, which DatabaseImpl implements
+func openDocumentStore(cfg *config.Config) (DocumentStore, error) {
+	name := cfg.ServerConfig.DocumentStore
+	if name == "" || name == "Couchbase" {
+		return nil, nil
+	}
+
+	storesMutex.Lock()
+	factory, ok := documentStores[name]
+	storesMutex.Unlock()
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+	return factory(cfg)
+}
+
+// openFileStore creates the file store the config names; nil for the filesystem, which DatabaseImpl implements
+func openFileStore(cfg *config.Config) (FileStore, error) {
+	name := cfg.ServerConfig.FileStore
+	if name == "" || name == "Filesystem" {
+		return nil, nil
+	}
+
+	storesMutex.Lock()
+	factory, ok := fileStores[name]
+	storesMutex.Unlock()
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,68 @@
+package dbfs_test
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/dbfs/documentstoretest"
+	"github.com/CodeCollaborate/Server/modules/dbfs/filestoretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryFileStore(t *testing.T) {
+	filestoretest.RunAll(t, dbfs.NewMemoryFileStore())
+}
+
+// storeTestConfig loads the config, selecting the named stores until the returned function is called
+func storeTestConfig(t *testing.T, documentStore string, fileStore string) func() {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+	serverCfg := &config.GetConfig().ServerConfig
+	original := *serverCfg
+	serverCfg.DocumentStore = documentStore
+	serverCfg.FileStore = fileStore
+	return func() {
+		*serverCfg = original
+	}
+}
+
+func TestDatabaseImpl_RegisteredStores(t *testing.T) {
+	documents := dbfs.NewMemoryDocumentStore()
+	files := dbfs.NewMemoryFileStore()
+	dbfs.RegisterDocumentStore("Test", func(cfg *config.Config) (dbfs.DocumentStore, error) {
+		return documents, nil
+	})
+	defer dbfs.RegisterDocumentStore("Test", nil)
+	dbfs.RegisterFileStore("Test", func(cfg *config.Config) (dbfs.FileStore, error) {
+		return files, nil
+	})
+	defer dbfs.RegisterFileStore("Test", nil)
+	defer storeTestConfig(t, "Test", "Test")()
+
+	di := new(dbfs.DatabaseImpl)
+	documentstoretest.RunAll(t, di)
+	filestoretest.RunAll(t, di)
+
+	// The stores are the registered ones
+	_, err := di.FileWrite(".", "registered.txt", 1, []byte("hello"))
+	require.NoError(t, err)
+	raw, err := files.FileRead(".", "registered.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), *raw)
+	require.NoError(t, di.CBInsertNewFile(1, 1, []string{}))
+	version, err := documents.CBGetFileVersion(1)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, version)
+}
+
+func TestDatabaseImpl_UnknownStore(t *testing.T) {
+	defer storeTestConfig(t, "Unregistered", "")()
+
+	di := new(dbfs.DatabaseImpl)
+	_, err := di.CBGetFileVersion(1)
+	assert.Equal(t, dbfs.ErrUnknownStore, err)
+	_, err = di.FileRead(".", "file.txt", 1)
+	assert.Equal(t, dbfs.ErrUnknownStore, err, "neither store is used if one is unknown")
+}
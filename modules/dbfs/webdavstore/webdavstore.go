@@ -0,0 +1,375 @@
+// Package webdavstore keeps files' contents on a WebDAV server, such as Apache's mod_dav, nginx or Nextcloud, so that
+// several servers can share them without a shared filesystem. It registers itself as the "WebDAV" file store, and is
+// only built into the server with the webdav build tag:
+//
+//	go build -tags webdav
+//
+// and the config:
+//
+//	ServerConfig.FileStore = "WebDAV"
+//	ConnectionConfig["WebDAV"] = {Host, Port, Username, Password, UseTLS, Schema}
+//
+// The connection's Schema is the path files are kept under on the server. Files are kept under "files/", the swap
+// files scrunching leaves behind under "swap/", and the SHA-256 checksum of each under "checksums/", mirroring them.
+package webdavstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+)
+
+// ConnectionName is the ConnectionConfig entry of the WebDAV server
+const ConnectionName = "WebDAV"
+
+// errNoConnection is returned when the WebDAV store is configured without a connection to its server
+var errNoConnection = errors.New("The WebDAV file store requires a \"WebDAV\" connection")
+
+// errNotFound is returned by requests for resources that don't exist
+var errNotFound = errors.New("webdav: not found")
+
+// errConflict is returned by requests whose parent collection doesn't exist
+var errConflict = errors.New("webdav: parent collection does not exist")
+
+// errExists is returned by MKCOL requests for collections that already exist
+var errExists = errors.New("webdav: collection already exists")
+
+func init() {
+	dbfs.RegisterFileStore(ConnectionName, func(cfg *config.Config) (dbfs.FileStore, error) {
+		connCfg, ok := cfg.ConnectionConfig[ConnectionName]
+		if !ok || connCfg.Host == "" {
+			return nil, errNoConnection
+		}
+		return New(connCfg)
+	})
+}
+
+// Store is a dbfs.FileStore that keeps files' contents on a WebDAV server. It is safe for concurrent use.
+type Store struct {
+	baseURL string // Up to and including the connection's Schema, without a trailing slash
+	connCfg config.ConnCfg
+	client  *http.Client
+}
+
+// New creates a store on the WebDAV server described by the connection config. Its password is resolved for each
+// request, so that rotated secrets are picked up.
+func New(connCfg config.ConnCfg) (*Store, error) {
+	tlsConfig, err := connCfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if connCfg.UseTLS {
+		scheme = "https"
+	}
+	host := connCfg.Host
+	if connCfg.Port != 0 {
+		host = net.JoinHostPort(connCfg.Host, strconv.Itoa(int(connCfg.Port)))
+	}
+	timeout := time.Duration(connCfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &Store{
+		baseURL: scheme + "://" + host + escapePath(strings.TrimSuffix(path.Clean("/"+connCfg.Schema), "/")),
+		connCfg: connCfg,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// fileKey names the file within the store, refusing paths outside of its project as the filesystem store does
+func fileKey(relpath string, filename string, projectID int64) (string, error) {
+	if strings.Contains(filename, "/") {
+		return "", dbfs.ErrMaliciousRequest
+	}
+	cleanPath := path.Clean(relpath)
+	if strings.HasPrefix(cleanPath, "..") || strings.HasPrefix(cleanPath, "/") {
+		return "", dbfs.ErrMaliciousRequest
+	}
+	return path.Join(strconv.FormatInt(projectID, 10), cleanPath, filename), nil
+}
+
+// FileWrite writes the file with the given bytes, and returns its URL
+func (store *Store) FileWrite(relpath string, filename string, projectID int64, raw []byte) (string, error) {
+	key, err := fileKey(relpath, filename, projectID)
+	if err != nil {
+		return "", err
+	}
+	if err := store.writeContents(path.Join("files", key), raw); err != nil {
+		return "", err
+	}
+	return store.url(path.Join("files", key)), nil
+}
+
+// FileRead returns the contents of the file
+func (store *Store) FileRead(relpath string, filename string, projectID int64) (*[]byte, error) {
+	key, err := fileKey(relpath, filename, projectID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := store.get(path.Join("files", key))
+	if err == errNotFound {
+		return nil, dbfs.ErrFileMissing
+	} else if err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// FileDelete deletes the file, and its checksum
+func (store *Store) FileDelete(relpath string, filename string, projectID int64) error {
+	key, err := fileKey(relpath, filename, projectID)
+	if err != nil {
+		return err
+	}
+	err = store.do("DELETE", path.Join("files", key), nil, nil, nil)
+	if err == errNotFound {
+		return dbfs.ErrFileMissing
+	} else if err != nil {
+		return err
+	}
+	err = store.do("DELETE", path.Join("checksums", "files", key), nil, nil, nil)
+	if err != nil && err != errNotFound {
+		return err
+	}
+	return nil
+}
+
+// FileMove moves a file, and its checksum, from the starting path to the end path
+func (store *Store) FileMove(startRelpath string, startFilename string, endRelpath string,
+	endFilename string, projectID int64) error {
+	startKey, err := fileKey(startRelpath, startFilename, projectID)
+	if err != nil {
+		return err
+	}
+	endKey, err := fileKey(endRelpath, endFilename, projectID)
+	if err != nil {
+		return err
+	}
+
+	err = store.move(path.Join("files", startKey), path.Join("files", endKey))
+	if err == errNotFound {
+		return dbfs.ErrFileMissing
+	} else if err != nil {
+		return err
+	}
+	err = store.move(path.Join("checksums", "files", startKey), path.Join("checksums", "files", endKey))
+	if err != nil && err != errNotFound {
+		return err
+	}
+	return nil
+}
+
+// FileWriteToSwap writes the swap file for the file with the given info
+func (store *Store) FileWriteToSwap(meta dbfs.FileMeta, raw []byte) error {
+	key, err := fileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	return store.writeContents(path.Join("swap", key), raw)
+}
+
+// FileReadSwap returns the contents last written to the file's swap file. Returns ErrNoData if it has none
+func (store *Store) FileReadSwap(meta dbfs.FileMeta) (*[]byte, error) {
+	key, err := fileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := store.get(path.Join("swap", key))
+	if err == errNotFound {
+		return nil, dbfs.ErrNoData
+	} else if err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// FileVerify checks that the file exists, and that its contents match their checksum. Returns ErrFileMissing or
+// ErrChecksumMismatch if not.
+func (store *Store) FileVerify(meta dbfs.FileMeta) error {
+	key, err := fileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	_, err = store.verifyContents(path.Join("files", key))
+	return err
+}
+
+// FileRestoreFromSwap replaces the file with its swap file, if there is one whose contents match their checksum.
+// Returns ErrNoData if there is no intact swap file.
+func (store *Store) FileRestoreFromSwap(meta dbfs.FileMeta) error {
+	key, err := fileKey(meta.RelativePath, meta.Filename, meta.ProjectID)
+	if err != nil {
+		return err
+	}
+	raw, err := store.verifyContents(path.Join("swap", key))
+	if err != nil {
+		return dbfs.ErrNoData
+	}
+	return store.writeContents(path.Join("files", key), raw)
+}
+
+// writeContents stores the contents at the location, followed by their checksum
+func (store *Store) writeContents(location string, raw []byte) error {
+	sum := sha256.Sum256(raw)
+	if err := store.put(location, raw); err != nil {
+		return err
+	}
+	return store.put(path.Join("checksums", location), []byte(hex.EncodeToString(sum[:])))
+}
+
+// verifyContents returns the contents at the location, if they match their checksum. Contents without a checksum are
+// not checked. Returns ErrFileMissing if there are none, or ErrChecksumMismatch if they don't match.
+func (store *Store) verifyContents(location string) ([]byte, error) {
+	raw, err := store.get(location)
+	if err == errNotFound {
+		return nil, dbfs.ErrFileMissing
+	} else if err != nil {
+		return nil, err
+	}
+	expected, err := store.get(path.Join("checksums", location))
+	if err == errNotFound {
+		return raw, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	if hex.EncodeToString(sum[:]) != strings.TrimSpace(string(expected)) {
+		return nil, dbfs.ErrChecksumMismatch
+	}
+	return raw, nil
+}
+
+// get returns the contents of the resource at the location
+func (store *Store) get(location string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := store.do("GET", location, nil, nil, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// put stores the contents at the location, creating its parent collections if they don't exist
+func (store *Store) put(location string, raw []byte) error {
+	err := store.do("PUT", location, nil, raw, nil)
+	if err != errConflict {
+		return err
+	}
+	if err := store.makeCollections(path.Dir(location)); err != nil {
+		return err
+	}
+	return store.do("PUT", location, nil, raw, nil)
+}
+
+// move moves the resource at the location to the destination, replacing any resource there, and creating its parent
+// collections if they don't exist
+func (store *Store) move(location string, destination string) error {
+	headers := map[string]string{
+		"Destination": store.url(destination),
+		"Overwrite":   "T",
+	}
+	err := store.do("MOVE", location, headers, nil, nil)
+	if err != errConflict {
+		return err
+	}
+	if err := store.makeCollections(path.Dir(destination)); err != nil {
+		return err
+	}
+	return store.do("MOVE", location, headers, nil, nil)
+}
+
+// makeCollections creates the collection at the location, and any of its parents that don't exist
+func (store *Store) makeCollections(location string) error {
+	if location == "." || location == "/" {
+		return nil
+	}
+	err := store.do("MKCOL", location+"/", nil, nil, nil)
+	if err == errConflict {
+		if err := store.makeCollections(path.Dir(location)); err != nil {
+			return err
+		}
+		err = store.do("MKCOL", location+"/", nil, nil, nil)
+	}
+	if err == errExists {
+		return nil
+	}
+	return err
+}
+
+// url returns the URL of the location in the store
+func (store *Store) url(location string) string {
+	return store.baseURL + escapePath("/"+location)
+}
+
+// escapePath escapes each of the path's segments for use in a URL
+func escapePath(location string) string {
+	segments := strings.Split(location, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends the request for the location in the store, and copies the response's body to result, if it is not nil
+func (store *Store) do(method string, location string, headers map[string]string, body []byte, result io.Writer) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, store.url(location), reqBody)
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if store.connCfg.Username != "" {
+		password, err := store.connCfg.ResolvePassword()
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(store.connCfg.Username, password)
+	}
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return errConflict
+	case method == "MKCOL" && resp.StatusCode == http.StatusMethodNotAllowed:
+		return errExists
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webdav: %s %s returned status %d: %s", method, location, resp.StatusCode, msg)
+	}
+	if result == nil {
+		return nil
+	}
+	_, err = io.Copy(result, resp.Body)
+	return err
+}
@@ -0,0 +1,157 @@
+package webdavstore
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/dbfs/filestoretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWebDAV fakes the parts of WebDAV used by the store: resources can only be created in collections that exist, as
+// on real servers
+type testWebDAV struct {
+	mutex       sync.Mutex
+	resources   map[string][]byte
+	collections map[string]bool
+}
+
+func newTestWebDAV() (*httptest.Server, *testWebDAV) {
+	dav := &testWebDAV{
+		resources:   make(map[string][]byte),
+		collections: map[string]bool{"/": true},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "dav" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status, body := dav.serve(r)
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	return server, dav
+}
+
+// serve returns the status of the request, and the body of the resource for GETs
+func (dav *testWebDAV) serve(r *http.Request) (int, []byte) {
+	dav.mutex.Lock()
+	defer dav.mutex.Unlock()
+
+	location := path.Clean(r.URL.Path)
+	switch r.Method {
+	case "PUT":
+		if !dav.collections[path.Dir(location)] {
+			return http.StatusConflict, nil
+		}
+		dav.resources[location], _ = ioutil.ReadAll(r.Body)
+		return http.StatusCreated, nil
+	case "GET":
+		raw, ok := dav.resources[location]
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		return http.StatusOK, raw
+	case "DELETE":
+		if _, ok := dav.resources[location]; !ok {
+			return http.StatusNotFound, nil
+		}
+		delete(dav.resources, location)
+		return http.StatusNoContent, nil
+	case "MKCOL":
+		if dav.collections[location] {
+			return http.StatusMethodNotAllowed, nil
+		}
+		if !dav.collections[path.Dir(location)] {
+			return http.StatusConflict, nil
+		}
+		dav.collections[location] = true
+		return http.StatusCreated, nil
+	case "MOVE":
+		destination, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+		raw, ok := dav.resources[location]
+		if !ok {
+			return http.StatusNotFound, nil
+		}
+		if !dav.collections[path.Dir(destination.Path)] {
+			return http.StatusConflict, nil
+		}
+		delete(dav.resources, location)
+		dav.resources[path.Clean(destination.Path)] = raw
+		return http.StatusCreated, nil
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+// connCfg returns the connection config of the fake server, keeping files under the Schema
+func connCfg(t *testing.T, server *httptest.Server, schema string) config.ConnCfg {
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(serverURL.Host)
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+	return config.ConnCfg{
+		Host:     host,
+		Port:     uint16(portNum),
+		Username: "dav",
+		Password: "secret",
+		Schema:   schema,
+	}
+}
+
+func TestStore(t *testing.T) {
+	server, dav := newTestWebDAV()
+	defer server.Close()
+	dav.collections["/codecollaborate"] = true
+
+	store, err := New(connCfg(t, server, "codecollaborate"))
+	require.NoError(t, err)
+	filestoretest.RunAll(t, store)
+
+	// Names are escaped, and kept under the Schema
+	_, err = store.FileWrite("a dir", "100% #1?.txt", 1, []byte("escaped"))
+	require.NoError(t, err)
+	raw, err := store.FileRead("a dir", "100% #1?.txt", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("escaped"), *raw)
+	assert.Equal(t, []byte("escaped"), dav.resources["/codecollaborate/files/1/a dir/100% #1?.txt"])
+
+	// Contents changed on the server are caught by their checksum
+	dav.resources["/codecollaborate/files/1/a dir/100% #1?.txt"] = []byte("tampered")
+	assert.Equal(t, dbfs.ErrChecksumMismatch, store.FileVerify(dbfs.FileMeta{
+		RelativePath: "a dir",
+		Filename:     "100% #1?.txt",
+		ProjectID:    1,
+	}))
+}
+
+func TestStore_Registered(t *testing.T) {
+	server, dav := newTestWebDAV()
+	defer server.Close()
+
+	cfg := &config.Config{ConnectionConfig: config.ConnCfgMap{ConnectionName: connCfg(t, server, "")}}
+	cfg.ServerConfig.FileStore = ConnectionName
+	_, err := dbfs.NewDatabaseImpl(cfg).FileWrite(".", "registered.txt", 1, []byte("contents"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("contents"), dav.resources["/files/1/registered.txt"],
+		"the server's files should be written to the configured WebDAV server")
+
+	cfg = &config.Config{}
+	cfg.ServerConfig.FileStore = ConnectionName
+	_, err = dbfs.NewDatabaseImpl(cfg).FileWrite(".", "registered.txt", 1, []byte("contents"))
+	assert.Equal(t, errNoConnection, err, "the store should require a connection")
+}
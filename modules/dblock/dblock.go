@@ -0,0 +1,74 @@
+package dblock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/**
+ * Dblock provides locks shared by every server using the same MySQL database, so that only one server at a time
+ * migrates the schema, scrunches a given file, or runs a maintenance job. Locks are MySQL user-level locks (GET_LOCK),
+ * which belong to the connection that took them, so each lock holds a connection of its own until it is released.
+ * If the server holding a lock dies, MySQL releases the lock once it notices the connection has gone.
+ */
+
+// namePrefix keeps the locks apart from those of other applications sharing the MySQL server, whose lock names are
+// not scoped to a schema
+const namePrefix = "codecollaborate_"
+
+// MaxNameLength is the longest name a lock may have, leaving room for the prefix within MySQL's limit of 64
+const MaxNameLength = 64 - len(namePrefix)
+
+// ErrLockHeld is returned if another holder kept the lock for longer than the wait
+var ErrLockHeld = errors.New("Lock is held by another server")
+
+// ErrNameTooLong is returned for names longer than MaxNameLength
+var ErrNameTooLong = errors.New("Lock name is too long")
+
+// Lock is a held lock
+type Lock struct {
+	conn *sql.Conn
+	name string
+}
+
+// Acquire takes the named lock, waiting up to wait for another holder to release it; a wait of 0 fails immediately
+// if the lock is held. Locks are not reentrant: a server that asks for a lock it already holds waits for itself.
+func Acquire(ctx context.Context, db *sql.DB, name string, wait time.Duration) (*Lock, error) {
+	if len(name) > MaxNameLength {
+		return nil, ErrNameTooLong
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// GET_LOCK waits in whole seconds, and returns NULL on errors, such as the connection being killed
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", namePrefix+name, int(wait.Seconds())).Scan(&locked)
+	if err == nil && (!locked.Valid || locked.Int64 != 1) {
+		err = ErrLockHeld
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Lock{conn: conn, name: namePrefix + name}, nil
+}
+
+// Conn returns the connection that holds the lock, for work that must run in the same session
+func (lock *Lock) Conn() *sql.Conn {
+	return lock.conn
+}
+
+// Release releases the lock, and returns its connection to the pool
+func (lock *Lock) Release() error {
+	_, err := lock.conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", lock.name)
+	closeErr := lock.conn.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,55 @@
+package gitexport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CloneProtocols are the protocols ShallowClone may use. Local and SSH repositories are not allowed by default, so
+// that users cannot import the server's own files, or use its SSH keys.
+var CloneProtocols = []string{"https"}
+
+// ErrProtocolNotAllowed is returned when cloning a repository with a protocol not in CloneProtocols
+var ErrProtocolNotAllowed = errors.New("Repository URL protocol is not allowed")
+
+// ShallowClone clones the latest commit of the repository's branch into dir, which must not exist yet. If branch is
+// empty, the remote's default branch is cloned.
+func ShallowClone(ctx context.Context, repoURL string, branch string, dir string) error {
+	parsed, err := url.Parse(repoURL)
+	if err != nil || !protocolAllowed(parsed.Scheme) {
+		return ErrProtocolNotAllowed
+	}
+
+	args := []string{"clone", "--quiet", "--depth", "1", "--single-branch"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	cmd := exec.CommandContext(ctx, "git", append(args, "--", repoURL, dir)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_LFS_SKIP_SMUDGE=1",
+		// Also applies to submodules and redirects
+		"GIT_ALLOW_PROTOCOL="+strings.Join(CloneProtocols, ":"),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git clone: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func protocolAllowed(scheme string) bool {
+	for _, protocol := range CloneProtocols {
+		if scheme == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package gitexport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * Mirrors file contents to a Git remote, committing and pushing through the git command line client, which must be
+ * installed and able to authenticate to the remote without prompting (such as with an SSH key or credential helper).
+ */
+
+// ErrInvalidPath is returned for file paths that are absolute, or outside the repository
+var ErrInvalidPath = errors.New("File path is outside the repository")
+
+// PushError is returned by Commit if the commit was made, but could not be pushed
+type PushError struct {
+	Err error
+}
+
+func (e PushError) Error() string {
+	return "Failed to push commit: " + e.Err.Error()
+}
+
+// Author is a user credited with a commit
+type Author struct {
+	Name  string
+	Email string
+}
+
+func (a Author) String() string {
+	return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+}
+
+// File is the content to commit for a path, relative to the repository root
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Commit is a set of files to write and remove in a single commit
+type Commit struct {
+	Message string
+	Authors []Author // The first is the commit's author; the others are credited with Co-authored-by trailers
+	Files   []File
+	Removed []string
+}
+
+// Repository is a local clone of the export remote
+type Repository struct {
+	cfg   config.GitExportCfg
+	dir   string
+	mutex sync.Mutex
+}
+
+// Open prepares the local clone of the remote, creating it if needed, and checks out the configured branch
+func Open(cfg config.GitExportCfg) (*Repository, error) {
+	if cfg.Branch == "" {
+		cfg.Branch = "master"
+	}
+	if cfg.CommitterName == "" {
+		cfg.CommitterName = "CodeCollaborate"
+	}
+	dir := cfg.WorkDir
+	if dir == "" {
+		dir = filepath.Join("data", "gitexport")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &Repository{cfg: cfg, dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := r.git("init"); err != nil {
+			return nil, err
+		}
+		if _, err := r.git("remote", "add", "origin", cfg.Remote); err != nil {
+			return nil, err
+		}
+	} else if _, err := r.git("remote", "set-url", "origin", cfg.Remote); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.git("fetch", "origin"); err != nil {
+		return nil, err
+	}
+	remoteBranch := "origin/" + cfg.Branch
+	if _, err := r.git("rev-parse", "--verify", "--quiet", remoteBranch); err == nil {
+		_, err = r.git("checkout", "-B", cfg.Branch, remoteBranch)
+		return r, err
+	}
+	// The branch is new; its first commit creates it
+	if _, err := r.git("rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+		_, err = r.git("symbolic-ref", "HEAD", "refs/heads/"+cfg.Branch)
+		return r, err
+	}
+	_, err := r.git("checkout", "-B", cfg.Branch)
+	return r, err
+}
+
+// git runs a git command in the repository, returning its output
+func (r *Repository) git(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// localPath returns the path of the file in the clone
+func (r *Repository) localPath(path string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) ||
+		cleaned == ".git" || strings.HasPrefix(cleaned, ".git"+string(filepath.Separator)) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(r.dir, cleaned), nil
+}
+
+// Commit writes the commit's files, and commits and pushes them. Nothing is committed if no file changed. If the push
+// fails, a PushError is returned; the commit is kept, and pushed with the next one.
+func (r *Repository) Commit(c Commit) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	paths := []string{}
+	for _, file := range c.Files {
+		localPath, err := r.localPath(file.Path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(localPath, file.Content, 0644); err != nil {
+			return err
+		}
+		paths = append(paths, localPath)
+	}
+	for _, path := range c.Removed {
+		localPath, err := r.localPath(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		paths = append(paths, localPath)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if _, err := r.git(append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		return err
+	}
+	if _, err := r.git("diff", "--cached", "--quiet"); err == nil {
+		// Nothing changed since the last commit
+		return nil
+	}
+
+	message := c.Message
+	args := []string{
+		"-c", "user.name=" + r.cfg.CommitterName,
+		"-c", "user.email=" + r.cfg.CommitterEmail,
+		"commit", "--quiet",
+	}
+	if len(c.Authors) > 0 {
+		args = append(args, "--author", c.Authors[0].String())
+		if len(c.Authors) > 1 {
+			message += "\n"
+			for _, coAuthor := range c.Authors[1:] {
+				message += "\nCo-authored-by: " + coAuthor.String()
+			}
+		}
+	}
+	if _, err := r.git(append(args, "-m", message)...); err != nil {
+		return err
+	}
+
+	if _, err := r.git("push", "--quiet", "origin", r.cfg.Branch); err != nil {
+		return PushError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package gitexport
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRemote creates a bare repository to export to, returning its path and a function that removes it
+func newTestRemote(t *testing.T) (string, func()) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tmpDir, err := ioutil.TempDir("", "gitexport")
+	require.NoError(t, err)
+	remote := filepath.Join(tmpDir, "remote.git")
+	require.NoError(t, exec.Command("git", "init", "--bare", "--quiet", remote).Run())
+	return remote, func() { os.RemoveAll(tmpDir) }
+}
+
+func remoteGit(t *testing.T, remote string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = remote
+	out, err := cmd.Output()
+	require.NoError(t, err, strings.Join(args, " "))
+	return strings.TrimSpace(string(out))
+}
+
+func TestRepositoryCommit(t *testing.T) {
+	remote, cleanup := newTestRemote(t)
+	defer cleanup()
+
+	cfg := config.GitExportCfg{
+		Remote:         remote,
+		Branch:         "export",
+		WorkDir:        filepath.Join(filepath.Dir(remote), "clone"),
+		CommitterEmail: "server@example.com",
+	}
+	repo, err := Open(cfg)
+	require.NoError(t, err)
+
+	err = repo.Commit(Commit{
+		Message: "Scrunch src/main.go",
+		Authors: []Author{{"Gene", "gene@example.com"}, {"Joel", "joel@example.com"}},
+		Files:   []File{{Path: "12/src/main.go", Content: []byte("package main\n")}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "package main", remoteGit(t, remote, "show", "export:12/src/main.go"))
+	assert.Equal(t, "Gene <gene@example.com>", remoteGit(t, remote, "log", "-1", "--format=%an <%ae>", "export"))
+	assert.Equal(t, "CodeCollaborate <server@example.com>", remoteGit(t, remote, "log", "-1", "--format=%cn <%ce>", "export"))
+	assert.Contains(t, remoteGit(t, remote, "log", "-1", "--format=%B", "export"), "Co-authored-by: Joel <joel@example.com>")
+
+	// Unchanged files make no commit
+	require.NoError(t, repo.Commit(Commit{Message: "Again", Files: []File{{Path: "12/src/main.go", Content: []byte("package main\n")}}}))
+	assert.Equal(t, "1", remoteGit(t, remote, "rev-list", "--count", "export"))
+
+	// Moves remove the old path; a reopened clone continues from the remote branch
+	repo, err = Open(cfg)
+	require.NoError(t, err)
+	require.NoError(t, repo.Commit(Commit{
+		Message: "Move",
+		Files:   []File{{Path: "12/main.go", Content: []byte("package main\n")}},
+		Removed: []string{"12/src/main.go"},
+	}))
+	assert.Equal(t, "12/main.go", remoteGit(t, remote, "ls-tree", "-r", "--name-only", "export"))
+	assert.Equal(t, "2", remoteGit(t, remote, "rev-list", "--count", "export"))
+
+	for _, path := range []string{"../escape", "/etc/passwd", ".git/config", "12/../../escape"} {
+		assert.Equal(t, ErrInvalidPath, repo.Commit(Commit{Files: []File{{Path: path}}}), path)
+	}
+}
@@ -0,0 +1,131 @@
+package grpcapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+/**
+ * gRPC over HTTP/2 (https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md), on top of net/http: messages are
+ * length-prefixed in the request and response bodies, and the call's status is sent in the trailers.
+ */
+
+// gRPC status codes
+const (
+	statusOK                = 0
+	statusInvalidArgument   = 3
+	statusResourceExhausted = 8
+	statusUnimplemented     = 12
+	statusInternal          = 13
+	statusUnavailable       = 14
+	statusUnauthenticated   = 16
+)
+
+// maxMessageSize is the largest request message accepted, matching the default of gRPC servers
+const maxMessageSize = 4 << 20
+
+var errCompressedMessage = errors.New("Compressed messages are not supported")
+var errMessageTooLarge = errors.New("Message exceeds the maximum size")
+
+// callError is an error with the gRPC status to end the call with
+type callError struct {
+	code    int
+	message string
+}
+
+func (e callError) Error() string {
+	return fmt.Sprintf("gRPC status %d: %s", e.code, e.message)
+}
+
+// readMessage reads a length-prefixed message from the request body
+func readMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errCompressedMessage
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxMessageSize {
+		return nil, errMessageTooLarge
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// stream writes length-prefixed messages to the response, and ends the call with a status
+type stream struct {
+	responseWriter http.ResponseWriter
+	headerWritten  bool
+}
+
+func newStream(responseWriter http.ResponseWriter) *stream {
+	header := responseWriter.Header()
+	header.Set("Content-Type", "application/grpc")
+	header.Add("Trailer", "Grpc-Status")
+	header.Add("Trailer", "Grpc-Message")
+	return &stream{responseWriter: responseWriter}
+}
+
+func (s *stream) writeHeader() {
+	if !s.headerWritten {
+		s.responseWriter.WriteHeader(http.StatusOK)
+		s.headerWritten = true
+	}
+}
+
+// send writes the message, and flushes it to the client
+func (s *stream) send(message []byte) error {
+	s.writeHeader()
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	if _, err := s.responseWriter.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := s.responseWriter.Write(message); err != nil {
+		return err
+	}
+	if flusher, ok := s.responseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// finish ends the call with the status of err; nil ends it successfully
+func (s *stream) finish(err error) {
+	s.writeHeader()
+	code, message := statusOK, ""
+	if err != nil {
+		code, message = statusInternal, err.Error()
+		if callErr, ok := err.(callError); ok {
+			code, message = callErr.code, callErr.message
+		}
+	}
+	s.responseWriter.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		s.responseWriter.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+}
+
+// encodeGRPCMessage percent-encodes the status message, as the protocol requires
+func encodeGRPCMessage(message string) string {
+	var encoded bytes.Buffer
+	for i := 0; i < len(message); i++ {
+		b := message[i]
+		if b < ' ' || b > '~' || b == '%' {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		} else {
+			encoded.WriteByte(b)
+		}
+	}
+	return encoded.String()
+}
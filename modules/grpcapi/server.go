@@ -0,0 +1,390 @@
+package grpcapi
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * The gRPC service defined in codecollaborate.proto. Requests are processed by the same datahandling processors as
+ * WebSocket requests, and notifications are delivered through the same message broker.
+ */
+
+// ServicePath is the path prefix of the service's methods, under which the Server is registered
+const ServicePath = "/codecollaborate.CodeCollaborate/"
+
+// callBufferSize is the number of messages of a single Call buffered while they are collected
+const callBufferSize = 64
+
+// subscribeBufferSize is the number of messages buffered for each Subscribe stream
+const subscribeBufferSize = 256
+
+var errSlowSubscriber = errors.New("Subscriber is not reading its messages")
+
+// Server serves the gRPC API
+type Server struct {
+	exchangeName  string
+	cfg           *config.Config
+	db            dbfs.DBFS
+	broker        broker.Broker
+	authenticator datahandling.Authenticator
+	publish       chan<- rabbitmq.AMQPMessage
+}
+
+// NewServer creates a Server that publishes through the broker, until control is shut down. Requests are handled as
+// the server with the config, nil for the process's, and the authenticator, if any, does; see datahandling.DataHandler.
+func NewServer(exchangeName string, cfg *config.Config, db dbfs.DBFS, b broker.Broker,
+	authenticator datahandling.Authenticator, control *utils.Control) *Server {
+	pubCfg := rabbitmq.NewPubConfig(func(msg rabbitmq.AMQPMessage) {
+		if msg.ErrHandler != nil {
+			msg.ErrHandler()
+		}
+	}, callBufferSize)
+	pubSubCfg := &rabbitmq.AMQPPubSubCfg{
+		ExchangeName: exchangeName,
+		PubCfg:       pubCfg,
+		Control:      utils.NewControl(1),
+	}
+
+	go func() {
+		<-control.Exit
+		pubSubCfg.Control.Shutdown()
+	}()
+	go func() {
+		err := b.RunPublisher(pubSubCfg)
+		utils.LogError("gRPC publisher error encountered", err, nil)
+	}()
+
+	return &Server{
+		exchangeName:  exchangeName,
+		cfg:           cfg,
+		db:            db,
+		broker:        b,
+		authenticator: authenticator,
+		publish:       pubCfg.Messages,
+	}
+}
+
+// newQueueID returns a random ID for the broker queue of a call, as websocket IDs are
+func newQueueID() uint64 {
+	var id [8]byte
+	rand.Read(id[:])
+	return binary.BigEndian.Uint64(id[:])
+}
+
+// ServeHTTP handles a gRPC call to one of the service's methods
+func (s *Server) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	if !datahandling.ClientAllowed(s.cfg, request) {
+		http.Error(responseWriter, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if request.Method != "POST" || request.ProtoMajor != 2 {
+		http.Error(responseWriter, "gRPC requires POST over HTTP/2", http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := request.Header.Get("Content-Type")
+	if contentType != "application/grpc" && contentType != "application/grpc+proto" {
+		http.Error(responseWriter, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	st := newStream(responseWriter)
+	switch strings.TrimPrefix(request.URL.Path, ServicePath) {
+	case "Call":
+		st.finish(s.call(st, request))
+	case "Subscribe":
+		st.finish(s.subscribe(st, request))
+	default:
+		st.finish(callError{code: statusUnimplemented, message: "Unknown method " + request.URL.Path})
+	}
+}
+
+// readRequestMessage reads the single request message of a call
+func readRequestMessage(request *http.Request) ([]byte, error) {
+	message, err := readMessage(request.Body)
+	if err != nil {
+		return nil, callError{code: statusInvalidArgument, message: err.Error()}
+	}
+	return message, nil
+}
+
+// toProtoMessage converts a JSON-encoded messages.ServerMessageWrapper
+func toProtoMessage(wrapperJSON []byte) (protoServerMessage, error) {
+	var wrapper struct {
+		Type          string
+		Timestamp     int64
+		ServerMessage json.RawMessage
+	}
+	if err := json.Unmarshal(wrapperJSON, &wrapper); err != nil {
+		return protoServerMessage{}, err
+	}
+
+	msg := protoServerMessage{Timestamp: wrapper.Timestamp}
+	switch wrapper.Type {
+	case "Response":
+		msg.Response = &protoResponse{}
+		if err := json.Unmarshal(wrapper.ServerMessage, msg.Response); err != nil {
+			return protoServerMessage{}, err
+		}
+	case "Notification":
+		msg.Notification = &protoNotification{}
+		if err := json.Unmarshal(wrapper.ServerMessage, msg.Notification); err != nil {
+			return protoServerMessage{}, err
+		}
+	default:
+		return protoServerMessage{}, fmt.Errorf("Unknown server message type %q", wrapper.Type)
+	}
+	return msg, nil
+}
+
+// jsonRequest is a request in the JSON form that the WebSocket protocol uses
+type jsonRequest struct {
+	Tag         int64
+	Resource    string
+	SenderID    string
+	SenderToken string
+	Method      string
+	Timestamp   int64
+	Nonce       string
+	Data        json.RawMessage
+}
+
+// handleRequest runs the request through a DataHandler for the given queue, as sent from remoteAddr
+func (s *Server) handleRequest(req jsonRequest, queueID uint64, messageChan chan<- rabbitmq.AMQPMessage, remoteAddr string) error {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	dh := datahandling.DataHandler{
+		MessageChan:   messageChan,
+		WebsocketID:   queueID,
+		Db:            s.db,
+		Config:        s.cfg,
+		RemoteAddr:    remoteAddr,
+		Authenticator: s.authenticator,
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	return dh.Handle(websocket.TextMessage, reqJSON, wg)
+}
+
+// call processes a single request. The response is returned to the caller, and everything else is published.
+func (s *Server) call(st *stream, request *http.Request) error {
+	message, err := readRequestMessage(request)
+	if err != nil {
+		return err
+	}
+	var req protoRequest
+	if err := req.unmarshal(message); err != nil {
+		return callError{code: statusInvalidArgument, message: err.Error()}
+	}
+	data := json.RawMessage("{}")
+	if req.Data != nil {
+		if data, err = json.Marshal(req.Data); err != nil {
+			// Only numbers that JSON can't represent, such as NaN, fail to encode
+			return callError{code: statusInvalidArgument, message: "Data is not representable in JSON"}
+		}
+	}
+
+	queueID := newQueueID()
+	messageChan := make(chan rabbitmq.AMQPMessage, callBufferSize)
+	responseChan := s.collectCallMessages(messageChan, rabbitmq.RabbitWebsocketQueueName(queueID))
+	s.handleRequest(jsonRequest{
+		Tag:         req.Tag,
+		Resource:    req.Resource,
+		SenderID:    req.SenderID,
+		SenderToken: req.SenderToken,
+		Method:      req.Method,
+		Timestamp:   time.Now().Unix(),
+		Nonce:       datahandling.NewNonce(),
+		Data:        data,
+	}, queueID, messageChan, datahandling.ClientAddr(s.cfg, request))
+	close(messageChan)
+
+	response := <-responseChan
+	if response == nil {
+		return callError{code: statusInternal, message: "Request produced no response"}
+	}
+
+	reply, err := toProtoMessage(response)
+	if err != nil {
+		return err
+	}
+	return st.send(reply.Response.marshal())
+}
+
+// collectCallMessages reads the messages a call produces as its request is processed, since it may produce more than
+// fit in messageChan: those to other queues are published, and the call's response is sent on the returned channel
+// once messageChan is closed, or nil if there was none
+func (s *Server) collectCallMessages(messageChan <-chan rabbitmq.AMQPMessage, queueName string) <-chan []byte {
+	responseChan := make(chan []byte, 1)
+	go func() {
+		var response []byte
+		for msg := range messageChan {
+			if msg.RoutingKey != queueName {
+				select {
+				case s.publish <- msg:
+				default:
+					utils.LogError("gRPC publisher message queue full; failed to add new message", errors.New("Channel buffer full"), utils.LogFields{
+						"RoutingKey": msg.RoutingKey,
+					})
+				}
+				continue
+			}
+			if response != nil {
+				continue
+			}
+
+			switch msg.ContentType {
+			case rabbitmq.ContentTypeMsg:
+				if msg.Headers["MessageType"] == "Response" {
+					response = msg.Message
+				}
+			case rabbitmq.ContentTypeCmd:
+				// Calls have no queue to subscribe; subscriptions are made with Subscribe instead
+				var cmd rabbitmq.RabbitCommandJSON
+				if err := json.Unmarshal(msg.Message, &cmd); err == nil && cmd.Tag >= 0 {
+					response, _ = json.Marshal(messages.NewEmptyResponse(messages.StatusWrongRequest, cmd.Tag))
+				}
+			}
+		}
+		responseChan <- response
+	}()
+	return responseChan
+}
+
+// messageWriterFunc adapts a function to rabbitmq.MessageWriter
+type messageWriterFunc func(messageType int, data []byte) error
+
+func (f messageWriterFunc) WriteMessage(messageType int, data []byte) error {
+	return f(messageType, data)
+}
+
+// subscribe subscribes a queue to the requested projects, and streams its messages until the call is cancelled
+func (s *Server) subscribe(st *stream, request *http.Request) error {
+	message, err := readRequestMessage(request)
+	if err != nil {
+		return err
+	}
+	var req protoSubscribeRequest
+	if err := req.unmarshal(message); err != nil {
+		return callError{code: statusInvalidArgument, message: err.Error()}
+	}
+
+	queueID := newQueueID()
+	out := make(chan []byte, subscribeBufferSize)
+	pubSubCfg := &rabbitmq.AMQPPubSubCfg{
+		ExchangeName: s.exchangeName,
+		SubCfg:       &rabbitmq.AMQPSubCfg{QueueID: queueID, Keys: []string{rabbitmq.RabbitBroadcastKey}},
+		Control:      utils.NewControl(1),
+	}
+	defer pubSubCfg.Control.Shutdown()
+
+	// Closed if the stream falls behind, before it is shut down
+	slow := make(chan struct{})
+	var slowOnce sync.Once
+	enqueue := func(messageType int, data []byte) error {
+		select {
+		case out <- data:
+			return nil
+		default:
+			slowOnce.Do(func() { close(slow) })
+			pubSubCfg.Control.Shutdown()
+			return errSlowSubscriber
+		}
+	}
+	commandHandler := rabbitmq.RabbitCommandHandler{
+		WSConn:        messageWriterFunc(enqueue),
+		WSID:          queueID,
+		ExchangeName:  s.exchangeName,
+		Subscriptions: rabbitmq.NewSubscriptions(),
+		Mutes:         rabbitmq.NewMutes(),
+		Binder:        s.broker,
+	}
+	pubSubCfg.SubCfg.HandleMessageFunc = func(msg rabbitmq.AMQPMessage) error {
+		if msg.ContentType == rabbitmq.ContentTypeCmd {
+			return commandHandler.HandleCommand(msg)
+		}
+		if commandHandler.Mutes.Muted(msg.Headers) {
+			return nil
+		}
+		return enqueue(websocket.TextMessage, msg.Message)
+	}
+
+	go func() {
+		err := s.broker.RunSubscriber(pubSubCfg)
+		if err != nil {
+			utils.LogError("gRPC subscriber error encountered. Exiting", err, nil)
+			pubSubCfg.Control.Shutdown()
+		}
+	}()
+	ready := make(chan struct{})
+	go func() {
+		pubSubCfg.Control.Ready.Wait()
+		close(ready)
+	}()
+	select {
+	case <-ready:
+	case <-pubSubCfg.Control.Exit:
+		return callError{code: statusUnavailable, message: "Failed to subscribe"}
+	}
+
+	for i, projectID := range req.ProjectIDs {
+		data, err := json.Marshal(struct {
+			ProjectID int64
+			Events    []string
+			FileIDs   []int64
+		}{projectID, req.Events, req.FileIDs})
+		if err != nil {
+			return err
+		}
+		s.handleRequest(jsonRequest{
+			Tag:         int64(i + 1),
+			Resource:    "Project",
+			SenderID:    req.SenderID,
+			SenderToken: req.SenderToken,
+			Method:      "Subscribe",
+			Timestamp:   time.Now().Unix(),
+			Nonce:       datahandling.NewNonce(),
+			Data:        data,
+		}, queueID, s.publish, datahandling.ClientAddr(s.cfg, request))
+	}
+
+	for {
+		select {
+		case data := <-out:
+			msg, err := toProtoMessage(data)
+			if err != nil {
+				return err
+			}
+			if err := st.send(msg.marshal()); err != nil {
+				return err
+			}
+		case <-request.Context().Done():
+			return nil
+		case <-pubSubCfg.Control.Exit:
+			select {
+			case <-slow:
+				return callError{code: statusResourceExhausted, message: errSlowSubscriber.Error()}
+			default:
+				return callError{code: statusUnavailable, message: "Subscription ended"}
+			}
+		}
+	}
+}
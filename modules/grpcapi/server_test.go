@@ -0,0 +1,207 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// configSetup loads a config with a known token signing key, and returns a token for the user signed with it
+func configSetup(t *testing.T, username string) string {
+	tmpDir, err := ioutil.TempDir("", "grpcapi-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(tmpDir, "signing.pem")
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	serverCfg, err := json.Marshal(config.ServerCfg{Name: "CodeCollaborate", TokenSigningKeyFile: keyFile})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "server.cfg"), serverCfg, 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmpDir, "conn.cfg"), []byte("{}"), 0600))
+	config.SetConfigDir(tmpDir)
+	require.NoError(t, config.LoadConfig())
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, struct {
+		Username     string
+		CreationTime int64
+		Validity     int64
+		jwt.StandardClaims
+	}{username, time.Now().Unix(), time.Now().Add(time.Minute).Unix(), jwt.StandardClaims{}}).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+// newTestClient returns a client that speaks HTTP/2 in cleartext, as gRPC clients do without TLS
+func newTestClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+}
+
+func frame(message []byte) []byte {
+	framed := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(message)))
+	return append(framed, message...)
+}
+
+func startCall(t *testing.T, ctx context.Context, client *http.Client, url string, message []byte) *http.Response {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(frame(message)))
+	require.NoError(t, err)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp
+}
+
+func readServerMessage(t *testing.T, body io.Reader) protoServerMessage {
+	message, err := readMessage(body)
+	require.NoError(t, err)
+	var msg protoServerMessage
+	require.NoError(t, msg.unmarshal(message))
+	return msg
+}
+
+func readResponse(t *testing.T, body io.Reader) protoResponse {
+	message, err := readMessage(body)
+	require.NoError(t, err)
+	var res protoResponse
+	require.NoError(t, res.unmarshal(message))
+	return res
+}
+
+func TestServer(t *testing.T) {
+	token := configSetup(t, "gene")
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "gene", Email: "gene@example.com"})
+	projectID, err := db.MySQLProjectCreate("gene", "grpc")
+	require.NoError(t, err)
+
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	server := NewServer("CodeCollaborate", nil, db, broker.NewMemoryBroker(), nil, control)
+	httpServer := httptest.NewServer(h2c.NewHandler(server, &http2.Server{}))
+	defer httpServer.Close()
+	client := newTestClient()
+
+	// The subscription's response is streamed first
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscription := startCall(t, ctx, client, httpServer.URL+ServicePath+"Subscribe", protoSubscribeRequest{
+		SenderID:    "gene",
+		SenderToken: token,
+		ProjectIDs:  []int64{projectID},
+	}.marshal())
+	defer subscription.Body.Close()
+	msg := readServerMessage(t, subscription.Body)
+	require.NotNil(t, msg.Response)
+	assert.Equal(t, int64(1), msg.Response.Tag)
+	assert.Equal(t, int32(200), msg.Response.Status)
+
+	// Calls return their response, and their notifications are streamed to subscribers
+	call := startCall(t, context.Background(), client, httpServer.URL+ServicePath+"Call", protoRequest{
+		Resource:    "Project",
+		Method:      "Rename",
+		SenderID:    "gene",
+		SenderToken: token,
+		Tag:         5,
+		Data:        map[string]interface{}{"ProjectID": float64(projectID), "NewName": "renamed"},
+	}.marshal())
+	res := readResponse(t, call.Body)
+	assert.Equal(t, int64(5), res.Tag)
+	assert.Equal(t, int32(200), res.Status)
+	_, err = ioutil.ReadAll(call.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "0", call.Trailer.Get("Grpc-Status"))
+	call.Body.Close()
+
+	msg = readServerMessage(t, subscription.Body)
+	require.NotNil(t, msg.Notification)
+	assert.Equal(t, "Rename", msg.Notification.Method)
+	assert.Equal(t, projectID, msg.Notification.ResourceID)
+	require.IsType(t, map[string]interface{}{}, msg.Notification.Data)
+	assert.Equal(t, "renamed", msg.Notification.Data.(map[string]interface{})["NewName"])
+
+	// Unauthenticated calls get an unauthorized response, as over the WebSocket
+	call = startCall(t, context.Background(), client, httpServer.URL+ServicePath+"Call", protoRequest{
+		Resource: "Project",
+		Method:   "Rename",
+		SenderID: "gene",
+		Tag:      6,
+	}.marshal())
+	assert.Equal(t, int32(401), readResponse(t, call.Body).Status)
+	call.Body.Close()
+
+	// Unknown methods end with Unimplemented
+	call = startCall(t, context.Background(), client, httpServer.URL+ServicePath+"Publish", nil)
+	_, err = ioutil.ReadAll(call.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "12", call.Trailer.Get("Grpc-Status"))
+	call.Body.Close()
+}
+
+func TestCollectCallMessages(t *testing.T) {
+	// Calls may produce many more messages than are buffered, such as the progress of a Project.ImportFromGit
+	publish := make(chan rabbitmq.AMQPMessage, 1)
+	server := &Server{publish: publish}
+	queueName := rabbitmq.RabbitWebsocketQueueName(1)
+	messageChan := make(chan rabbitmq.AMQPMessage, callBufferSize)
+	responseChan := server.collectCallMessages(messageChan, queueName)
+
+	for i := 0; i < 4*callBufferSize; i++ {
+		messageChan <- rabbitmq.AMQPMessage{
+			Headers:     map[string]interface{}{"MessageType": "Notification"},
+			RoutingKey:  queueName,
+			ContentType: rabbitmq.ContentTypeMsg,
+			Message:     []byte(`{"Type":"Notification"}`),
+		}
+	}
+	messageChan <- rabbitmq.AMQPMessage{
+		Headers:     map[string]interface{}{"MessageType": "Response"},
+		RoutingKey:  queueName,
+		ContentType: rabbitmq.ContentTypeMsg,
+		Message:     []byte(`{"Type":"Response"}`),
+	}
+	messageChan <- rabbitmq.AMQPMessage{RoutingKey: rabbitmq.RabbitProjectQueueName(1), ContentType: rabbitmq.ContentTypeMsg}
+	close(messageChan)
+
+	assert.Equal(t, `{"Type":"Response"}`, string(<-responseChan))
+	assert.Equal(t, rabbitmq.RabbitProjectQueueName(1), (<-publish).RoutingKey)
+}
@@ -0,0 +1,440 @@
+package grpcapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+/**
+ * Protocol buffer encoding of the messages in codecollaborate.proto. They only use strings, numbers and the
+ * google.protobuf.Struct types, so the encoding is written out here rather than generated. Struct data is held as
+ * encoding/json decodes JSON into an interface{}: nil, bool, float64, string, []interface{} and map[string]interface{}.
+ */
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errMalformedMessage = errors.New("Malformed protocol buffer message")
+
+type protoRequest struct {
+	Resource    string
+	Method      string
+	SenderID    string
+	SenderToken string
+	Tag         int64
+	Data        map[string]interface{} // nil if unset
+}
+
+type protoResponse struct {
+	Tag    int64
+	Status int32
+	Data   interface{}
+}
+
+type protoNotification struct {
+	Resource   string
+	Method     string
+	ResourceID int64
+	Data       interface{}
+	Sequence   int64
+}
+
+// protoServerMessage holds one of Response and Notification
+type protoServerMessage struct {
+	Timestamp    int64
+	Response     *protoResponse
+	Notification *protoNotification
+}
+
+type protoSubscribeRequest struct {
+	SenderID    string
+	SenderToken string
+	ProjectIDs  []int64
+	Events      []string
+	FileIDs     []int64
+}
+
+func appendVarint(buf []byte, value uint64) []byte {
+	for value >= 0x80 {
+		buf = append(buf, byte(value)|0x80)
+		value >>= 7
+	}
+	return append(buf, byte(value))
+}
+
+func appendTag(buf []byte, field int, wireType int) []byte {
+	return appendVarint(buf, uint64(field)<<3|uint64(wireType))
+}
+
+func appendBytesField(buf []byte, field int, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	return appendMessageField(buf, field, value)
+}
+
+// appendMessageField appends a length-delimited field even if it is empty, as set message fields are
+func appendMessageField(buf []byte, field int, value []byte) []byte {
+	buf = appendTag(buf, field, wireBytes)
+	buf = appendVarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+func appendInt64Field(buf []byte, field int, value int64) []byte {
+	if value == 0 {
+		return buf
+	}
+	buf = appendTag(buf, field, wireVarint)
+	return appendVarint(buf, uint64(value))
+}
+
+// appendPackedInt64s appends the values as a packed repeated field, as proto3 encodes repeated numbers
+func appendPackedInt64s(buf []byte, field int, values []int64) []byte {
+	if len(values) == 0 {
+		return buf
+	}
+	var packed []byte
+	for _, value := range values {
+		packed = appendVarint(packed, uint64(value))
+	}
+	return appendBytesField(buf, field, packed)
+}
+
+// appendStruct appends the encoding of a google.protobuf.Struct, whose fields are sorted so that it is stable
+func appendStruct(buf []byte, fields map[string]interface{}) []byte {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var entry []byte
+		entry = appendMessageField(entry, 1, []byte(key))
+		entry = appendMessageField(entry, 2, appendValue(nil, fields[key]))
+		buf = appendMessageField(buf, 1, entry)
+	}
+	return buf
+}
+
+// appendValue appends the encoding of a google.protobuf.Value. Values of other types are encoded as null, as they
+// can't come from JSON.
+func appendValue(buf []byte, value interface{}) []byte {
+	switch value := value.(type) {
+	case float64:
+		buf = appendTag(buf, 2, wireFixed64)
+		var bits [8]byte
+		binary.LittleEndian.PutUint64(bits[:], math.Float64bits(value))
+		return append(buf, bits[:]...)
+	case string:
+		return appendMessageField(buf, 3, []byte(value))
+	case bool:
+		buf = appendTag(buf, 4, wireVarint)
+		if value {
+			return appendVarint(buf, 1)
+		}
+		return appendVarint(buf, 0)
+	case map[string]interface{}:
+		return appendMessageField(buf, 5, appendStruct(nil, value))
+	case []interface{}:
+		var list []byte
+		for _, element := range value {
+			list = appendMessageField(list, 1, appendValue(nil, element))
+		}
+		return appendMessageField(buf, 6, list)
+	default:
+		buf = appendTag(buf, 1, wireVarint)
+		return appendVarint(buf, 0)
+	}
+}
+
+// appendDataField appends data as a google.protobuf.Value field, unless it is nil
+func appendDataField(buf []byte, field int, data interface{}) []byte {
+	if data == nil {
+		return buf
+	}
+	return appendMessageField(buf, field, appendValue(nil, data))
+}
+
+func (m protoRequest) marshal() []byte {
+	var buf []byte
+	buf = appendBytesField(buf, 1, []byte(m.Resource))
+	buf = appendBytesField(buf, 2, []byte(m.Method))
+	buf = appendBytesField(buf, 3, []byte(m.SenderID))
+	buf = appendBytesField(buf, 4, []byte(m.SenderToken))
+	buf = appendInt64Field(buf, 5, m.Tag)
+	if m.Data == nil {
+		return buf
+	}
+	return appendMessageField(buf, 6, appendStruct(nil, m.Data))
+}
+
+func (m protoResponse) marshal() []byte {
+	var buf []byte
+	buf = appendInt64Field(buf, 1, m.Tag)
+	buf = appendInt64Field(buf, 2, int64(m.Status))
+	return appendDataField(buf, 3, m.Data)
+}
+
+func (m protoNotification) marshal() []byte {
+	var buf []byte
+	buf = appendBytesField(buf, 1, []byte(m.Resource))
+	buf = appendBytesField(buf, 2, []byte(m.Method))
+	buf = appendInt64Field(buf, 3, m.ResourceID)
+	buf = appendDataField(buf, 4, m.Data)
+	return appendInt64Field(buf, 5, m.Sequence)
+}
+
+func (m protoServerMessage) marshal() []byte {
+	var buf []byte
+	buf = appendInt64Field(buf, 1, m.Timestamp)
+	if m.Response != nil {
+		buf = appendMessageField(buf, 2, m.Response.marshal())
+	}
+	if m.Notification != nil {
+		buf = appendMessageField(buf, 3, m.Notification.marshal())
+	}
+	return buf
+}
+
+func (m protoSubscribeRequest) marshal() []byte {
+	var buf []byte
+	buf = appendBytesField(buf, 1, []byte(m.SenderID))
+	buf = appendBytesField(buf, 2, []byte(m.SenderToken))
+	buf = appendPackedInt64s(buf, 3, m.ProjectIDs)
+	for _, event := range m.Events {
+		buf = appendTag(buf, 4, wireBytes)
+		buf = appendVarint(buf, uint64(len(event)))
+		buf = append(buf, event...)
+	}
+	return appendPackedInt64s(buf, 5, m.FileIDs)
+}
+
+// protoField is a decoded field; value holds varints and fixed64s, and bytes length-delimited fields
+type protoField struct {
+	number   int
+	wireType int
+	value    uint64
+	bytes    []byte
+}
+
+// readFields decodes the fields of a message, calling handle for each. Fixed32 fields are skipped, since none of our
+// messages use them.
+func readFields(buf []byte, handle func(protoField) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errMalformedMessage
+		}
+		buf = buf[n:]
+		field := protoField{number: int(key >> 3), wireType: int(key & 7)}
+
+		switch field.wireType {
+		case wireVarint:
+			field.value, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errMalformedMessage
+			}
+			buf = buf[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < length {
+				return errMalformedMessage
+			}
+			field.bytes = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return errMalformedMessage
+			}
+			field.value = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return errMalformedMessage
+			}
+			buf = buf[4:]
+			continue
+		default:
+			return errMalformedMessage
+		}
+
+		if err := handle(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendInt64s decodes a repeated int64 field, which may be packed or not
+func appendInt64s(values []int64, field protoField) ([]int64, error) {
+	if field.wireType == wireVarint {
+		return append(values, int64(field.value)), nil
+	}
+	packed := field.bytes
+	for len(packed) > 0 {
+		value, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return nil, errMalformedMessage
+		}
+		values = append(values, int64(value))
+		packed = packed[n:]
+	}
+	return values, nil
+}
+
+func (m *protoRequest) unmarshal(buf []byte) error {
+	return readFields(buf, func(field protoField) error {
+		switch field.number {
+		case 1:
+			m.Resource = string(field.bytes)
+		case 2:
+			m.Method = string(field.bytes)
+		case 3:
+			m.SenderID = string(field.bytes)
+		case 4:
+			m.SenderToken = string(field.bytes)
+		case 5:
+			m.Tag = int64(field.value)
+		case 6:
+			data, err := readStruct(field.bytes)
+			if err != nil {
+				return err
+			}
+			m.Data = data
+		}
+		return nil
+	})
+}
+
+func (m *protoResponse) unmarshal(buf []byte) error {
+	return readFields(buf, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			m.Tag = int64(field.value)
+		case 2:
+			m.Status = int32(field.value)
+		case 3:
+			m.Data, err = readValue(field.bytes)
+		}
+		return err
+	})
+}
+
+func (m *protoNotification) unmarshal(buf []byte) error {
+	return readFields(buf, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			m.Resource = string(field.bytes)
+		case 2:
+			m.Method = string(field.bytes)
+		case 3:
+			m.ResourceID = int64(field.value)
+		case 4:
+			m.Data, err = readValue(field.bytes)
+		case 5:
+			m.Sequence = int64(field.value)
+		}
+		return err
+	})
+}
+
+func (m *protoServerMessage) unmarshal(buf []byte) error {
+	return readFields(buf, func(field protoField) error {
+		switch field.number {
+		case 1:
+			m.Timestamp = int64(field.value)
+		case 2:
+			m.Response, m.Notification = &protoResponse{}, nil
+			return m.Response.unmarshal(field.bytes)
+		case 3:
+			m.Response, m.Notification = nil, &protoNotification{}
+			return m.Notification.unmarshal(field.bytes)
+		}
+		return nil
+	})
+}
+
+// readStruct decodes a google.protobuf.Struct
+func readStruct(buf []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	err := readFields(buf, func(field protoField) error {
+		if field.number != 1 {
+			return nil
+		}
+		var key string
+		var value interface{}
+		err := readFields(field.bytes, func(entryField protoField) error {
+			var err error
+			switch entryField.number {
+			case 1:
+				key = string(entryField.bytes)
+			case 2:
+				value, err = readValue(entryField.bytes)
+			}
+			return err
+		})
+		fields[key] = value
+		return err
+	})
+	return fields, err
+}
+
+// readValue decodes a google.protobuf.Value; one with no kind set is null
+func readValue(buf []byte) (interface{}, error) {
+	var value interface{}
+	err := readFields(buf, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			value = nil
+		case 2:
+			value = math.Float64frombits(field.value)
+		case 3:
+			value = string(field.bytes)
+		case 4:
+			value = field.value != 0
+		case 5:
+			value, err = readStruct(field.bytes)
+		case 6:
+			list := []interface{}{}
+			err = readFields(field.bytes, func(element protoField) error {
+				if element.number != 1 {
+					return nil
+				}
+				value, err := readValue(element.bytes)
+				list = append(list, value)
+				return err
+			})
+			value = list
+		}
+		return err
+	})
+	return value, err
+}
+
+func (m *protoSubscribeRequest) unmarshal(buf []byte) error {
+	return readFields(buf, func(field protoField) error {
+		var err error
+		switch field.number {
+		case 1:
+			m.SenderID = string(field.bytes)
+		case 2:
+			m.SenderToken = string(field.bytes)
+		case 3:
+			m.ProjectIDs, err = appendInt64s(m.ProjectIDs, field)
+		case 4:
+			m.Events = append(m.Events, string(field.bytes))
+		case 5:
+			m.FileIDs, err = appendInt64s(m.FileIDs, field)
+		}
+		return err
+	})
+}
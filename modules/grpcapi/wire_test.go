@@ -0,0 +1,115 @@
+package grpcapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtoRequestRoundTrip(t *testing.T) {
+	req := protoRequest{
+		Resource:    "File",
+		Method:      "Pull",
+		SenderID:    "gene",
+		SenderToken: "token",
+		Tag:         300,
+		Data: map[string]interface{}{
+			"FileID":   1.0,
+			"Offset":   0.0,
+			"Filename": "",
+			"Private":  false,
+			"Meta":     map[string]interface{}{"Tags": []interface{}{"a", -1.5, true, nil}, "Empty": map[string]interface{}{}},
+			"Missing":  nil,
+			"NoLines":  []interface{}{},
+		},
+	}
+	var decoded protoRequest
+	require.NoError(t, decoded.unmarshal(req.marshal()))
+	assert.Equal(t, req, decoded)
+
+	// Requests without data have none
+	req.Data = nil
+	decoded = protoRequest{}
+	require.NoError(t, decoded.unmarshal(req.marshal()))
+	assert.Nil(t, decoded.Data)
+}
+
+func TestProtoServerMessageRoundTrip(t *testing.T) {
+	for _, msg := range []protoServerMessage{
+		{Timestamp: 17, Response: &protoResponse{Tag: 3, Status: 200, Data: map[string]interface{}{"FileVersion": 4.0}}},
+		{Timestamp: 17, Response: &protoResponse{Tag: 3, Status: -1}},
+		{Timestamp: 17, Notification: &protoNotification{
+			Resource:   "File",
+			Method:     "Change",
+			ResourceID: 1 << 40,
+			Data:       map[string]interface{}{"Changes": "v1:\n1:+1:e:\n1"},
+			Sequence:   9,
+		}},
+	} {
+		var decoded protoServerMessage
+		require.NoError(t, decoded.unmarshal(msg.marshal()))
+		assert.Equal(t, msg, decoded)
+	}
+}
+
+func TestToProtoMessage(t *testing.T) {
+	msg, err := toProtoMessage([]byte(`{"Type":"Response","Timestamp":17,"ServerMessage":{"Tag":2,"Status":404,"Data":{}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, protoServerMessage{
+		Timestamp: 17,
+		Response:  &protoResponse{Tag: 2, Status: 404, Data: map[string]interface{}{}},
+	}, msg)
+
+	msg, err = toProtoMessage([]byte(`{"Type":"Notification","Timestamp":17,"ServerMessage":` +
+		`{"Resource":"Project","Method":"Rename","ResourceID":5,"Data":{"NewName":"b"},"Sequence":2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, protoServerMessage{
+		Timestamp: 17,
+		Notification: &protoNotification{
+			Resource:   "Project",
+			Method:     "Rename",
+			ResourceID: 5,
+			Data:       map[string]interface{}{"NewName": "b"},
+			Sequence:   2,
+		},
+	}, msg)
+
+	_, err = toProtoMessage([]byte(`{"Type":"Command","Timestamp":17,"ServerMessage":{}}`))
+	assert.Error(t, err)
+}
+
+func TestProtoSubscribeRequestRoundTrip(t *testing.T) {
+	req := protoSubscribeRequest{
+		SenderID:    "gene",
+		SenderToken: "token",
+		ProjectIDs:  []int64{1, 200, 1 << 40},
+		Events:      []string{"File.*", "Project.Rename"},
+		FileIDs:     []int64{7},
+	}
+	var decoded protoSubscribeRequest
+	require.NoError(t, decoded.unmarshal(req.marshal()))
+	assert.Equal(t, req, decoded)
+}
+
+func TestReadFields(t *testing.T) {
+	// Unpacked repeated numbers are accepted too, and unknown fields are skipped
+	var buf []byte
+	buf = appendInt64Field(buf, 3, 4)
+	buf = appendInt64Field(buf, 3, 5)
+	buf = appendTag(buf, 9, wireFixed32)
+	buf = append(buf, 1, 2, 3, 4)
+	buf = appendBytesField(buf, 10, []byte("unknown"))
+	var decoded protoSubscribeRequest
+	require.NoError(t, decoded.unmarshal(buf))
+	assert.Equal(t, []int64{4, 5}, decoded.ProjectIDs)
+
+	// Truncated messages are rejected
+	buf = appendBytesField(nil, 1, []byte("gene"))
+	assert.Equal(t, errMalformedMessage, decoded.unmarshal(buf[:len(buf)-1]))
+	assert.Equal(t, errMalformedMessage, decoded.unmarshal([]byte{0x80}))
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	assert.Equal(t, "100%25 done%0A", encodeGRPCMessage("100% done\n"))
+}
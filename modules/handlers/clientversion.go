@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Client version gating. Clients name themselves and their version when they connect, in the X-Client-Version
+ * header, such as "vim/1.4.2", or in the client_version query parameter, since browsers can't set headers on
+ * WebSocket connections. Clients older than the server's MinClientVersions allow are refused before the connection is
+ * upgraded, with 426 Upgrade Required and a message naming the version they need, so that clients with known protocol
+ * bugs can't corrupt documents.
+ */
+
+const (
+	clientVersionHeader = "X-Client-Version"
+	clientVersionParam  = "client_version"
+)
+
+// anyClient is the key of MinClientVersions that applies to clients not named in it
+const anyClient = "*"
+
+// clientVersion returns the name and version the client connected with; either may be empty
+func clientVersion(request *http.Request) (string, string) {
+	value := request.Header.Get(clientVersionHeader)
+	if value == "" {
+		value = request.URL.Query().Get(clientVersionParam)
+	}
+	i := strings.LastIndex(value, "/")
+	if i < 0 {
+		return "", strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+1:])
+}
+
+// outdatedClientReason returns why the client must upgrade before it may connect, or "" if its version is allowed
+func outdatedClientReason(request *http.Request, minVersions map[string]string) string {
+	name, version := clientVersion(request)
+	minVersion, ok := minVersions[name]
+	if !ok {
+		minVersion, ok = minVersions[anyClient]
+	}
+	if !ok || (version != "" && compareVersions(version, minVersion) >= 0) {
+		return ""
+	}
+
+	if name == "" {
+		name = "This client"
+	}
+	if version == "" {
+		return fmt.Sprintf("%s did not send its version in the %s header; version %s or later is required", name,
+			clientVersionHeader, minVersion)
+	}
+	return fmt.Sprintf("%s %s is no longer supported; upgrade to version %s or later", name, version, minVersion)
+}
+
+// compareVersions compares dotted version numbers, such as "1.10.2", returning -1, 0 or 1. A leading "v" and any
+// pre-release or build suffix, after a "-" or "+", are ignored; missing parts, and parts that aren't numbers, count
+// as 0.
+func compareVersions(a, b string) int {
+	aParts, bParts := versionParts(a), versionParts(b)
+	for len(aParts) < len(bParts) {
+		aParts = append(aParts, 0)
+	}
+	for len(bParts) < len(aParts) {
+		bParts = append(bParts, 0)
+	}
+	for i := range aParts {
+		if aParts[i] < bParts[i] {
+			return -1
+		} else if aParts[i] > bParts[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := []int{}
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	return parts
+}
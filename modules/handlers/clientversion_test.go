@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.4.0", "1.4.0", 0},
+		{"1.4", "1.4.0", 0},
+		{"v1.4.0", "1.4.0", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"1.4.0-beta", "1.4.0", 0},
+		{"1.3.9", "1.4", -1},
+		{"2", "1.99.99", 1},
+	} {
+		assert.Equal(t, test.expected, compareVersions(test.a, test.b), "%s vs %s", test.a, test.b)
+	}
+}
+
+func TestOutdatedClientReason(t *testing.T) {
+	minVersions := map[string]string{"vim": "1.4.0", "*": "0.9"}
+	for _, test := range []struct {
+		header   string
+		query    string
+		outdated bool
+	}{
+		{"vim/1.4.2", "", false},
+		{"vim/1.3.0", "", true},
+		{"", "vim/1.3.0", true},
+		{"atom/0.9.1", "", false},
+		{"atom/0.8", "", true},
+		{"", "", true},
+	} {
+		request := httptest.NewRequest("GET", "/ws/", nil)
+		if test.header != "" {
+			request.Header.Set(clientVersionHeader, test.header)
+		}
+		if test.query != "" {
+			request.URL.RawQuery = clientVersionParam + "=" + test.query
+		}
+		reason := outdatedClientReason(request, minVersions)
+		assert.Equal(t, test.outdated, reason != "", "%q %q: %s", test.header, test.query, reason)
+	}
+
+	assert.Empty(t, outdatedClientReason(httptest.NewRequest("GET", "/ws/", nil), nil),
+		"clients should be allowed without MinClientVersions")
+}
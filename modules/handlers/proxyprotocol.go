@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+/**
+ * Load balancers that forward raw TCP, such as for TLS passthrough, can't add X-Forwarded-For headers. They can instead
+ * send a PROXY protocol header at the start of each connection, naming the client it came from. If ProxyProtocol is
+ * set, connections from TrustedProxies must start with a version 1 header, and take the client's address as their
+ * RemoteAddr; connections from anywhere else are used as they are, so that clients can't claim to be someone else.
+ *
+ * The header is read when the connection is first used, rather than when it is accepted, so that a slow proxy can't
+ * hold up the listener.
+ */
+
+// maxProxyHeaderLength is the longest a version 1 header may be, including its CRLF
+const maxProxyHeaderLength = 107
+
+// proxyHeaderTimeout is how long a trusted proxy has to send the header once the connection is used
+const proxyHeaderTimeout = 5 * time.Second
+
+var errInvalidProxyHeader = errors.New("Invalid PROXY protocol header")
+
+// proxyProtocolListener accepts connections that may start with a PROXY protocol header
+type proxyProtocolListener struct {
+	net.Listener
+	policy *config.NetworkPolicy
+}
+
+func (listener proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !listener.policy.TrustsProxy(tcpAddr.IP) {
+		return conn, nil
+	}
+	return &proxyProtocolConn{Conn: conn, reader: bufio.NewReaderSize(conn, maxProxyHeaderLength)}, nil
+}
+
+// proxyProtocolConn is a connection from a trusted proxy, whose RemoteAddr is the client named in its header
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr
+	err        error
+}
+
+// readHeader reads the header the first time the connection is used
+func (conn *proxyProtocolConn) readHeader() {
+	conn.once.Do(func() {
+		conn.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer conn.Conn.SetReadDeadline(time.Time{})
+
+		line, err := conn.reader.ReadSlice('\n')
+		if err != nil {
+			conn.err = errInvalidProxyHeader
+			return
+		}
+		conn.remoteAddr, conn.err = parseProxyHeader(string(line))
+		if conn.err == nil && conn.remoteAddr == nil {
+			// The proxy doesn't know who the client is, such as for its own health checks
+			conn.remoteAddr = conn.Conn.RemoteAddr()
+		}
+	})
+}
+
+func (conn *proxyProtocolConn) Read(b []byte) (int, error) {
+	conn.readHeader()
+	if conn.err != nil {
+		return 0, conn.err
+	}
+	return conn.reader.Read(b)
+}
+
+func (conn *proxyProtocolConn) RemoteAddr() net.Addr {
+	conn.readHeader()
+	if conn.err != nil {
+		return conn.Conn.RemoteAddr()
+	}
+	return conn.remoteAddr
+}
+
+// parseProxyHeader parses a version 1 header, such as "PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\r\n", returning
+// the source address it names; nil for "PROXY UNKNOWN"
+func parseProxyHeader(line string) (net.Addr, error) {
+	if len(line) > maxProxyHeaderLength || !strings.HasSuffix(line, "\r\n") {
+		return nil, errInvalidProxyHeader
+	}
+	fields := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errInvalidProxyHeader
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, errInvalidProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProxyHeader(t *testing.T) {
+	addr, err := parseProxyHeader("PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.7:56324", addr.String())
+
+	addr, err = parseProxyHeader("PROXY TCP6 2001:db8::7 2001:db8::1 56324 443\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "[2001:db8::7]:56324", addr.String())
+
+	addr, err = parseProxyHeader("PROXY UNKNOWN\r\n")
+	assert.NoError(t, err)
+	assert.Nil(t, addr)
+
+	for _, line := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\n",
+		"PROXY TCP4 2001:db8::7 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.7 198.51.100.1 65536 443\r\n",
+		"PROXY UDP4 192.0.2.7 198.51.100.1 56324 443\r\n",
+	} {
+		_, err := parseProxyHeader(line)
+		assert.Equal(t, errInvalidProxyHeader, err, line)
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer inner.Close()
+
+	policy, err := config.ServerCfg{TrustedProxies: []string{"127.0.0.1"}}.NetworkPolicy()
+	require.NoError(t, err)
+	listener := proxyProtocolListener{Listener: inner, policy: policy}
+
+	send := func(data string) {
+		client, err := net.Dial("tcp", inner.Addr().String())
+		require.NoError(t, err)
+		client.Write([]byte(data))
+		client.Close()
+	}
+
+	go send("PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\r\nhello")
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.7:56324", conn.RemoteAddr().String())
+	body, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	conn.Close()
+
+	// Trusted proxies must send the header
+	go send("hello\r\n")
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(conn)
+	assert.Equal(t, errInvalidProxyHeader, err)
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+	conn.Close()
+
+	// Anyone else's header is left for the HTTP server to reject
+	policy, err = config.ServerCfg{TrustedProxies: []string{"192.0.2.1"}}.NetworkPolicy()
+	require.NoError(t, err)
+	listener.policy = policy
+	go send("PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\r\n")
+	conn, err = listener.Accept()
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "PROXY TCP4 192.0.2.7 198.51.100.1 56324 443\r\n", string(body))
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+	conn.Close()
+}
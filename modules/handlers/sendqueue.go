@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"expvar"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/compression"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * Outgoing messages are buffered per websocket, so that a client that stops reading cannot block the subscriber
+ * that delivers its messages. Ephemeral messages are dropped, oldest first, when the buffer is full; other messages
+ * wait for space, and the client is disconnected if none frees up in time.
+ */
+
+// sendQueueSize is the number of outgoing messages buffered for each websocket
+const sendQueueSize = 256
+
+// sendTimeout is how long a message that cannot be dropped waits for space in a full send queue, before the client is
+// disconnected
+var sendTimeout = 5 * time.Second
+
+// writeTimeout is how long a single write to the client may take, before the client is disconnected
+var writeTimeout = 10 * time.Second
+
+var errSlowClient = errors.New("Client is not reading its messages")
+var errSendQueueClosed = errors.New("Send queue closed")
+
+var sendQueueMetrics = expvar.NewMap("websocket")
+
+// maxCompressedNotifications is the number of dictionary-compressed notifications cached, so that a notification
+// fanned out to many websockets is compressed once
+const maxCompressedNotifications = 1024
+
+var compressedNotifications = struct {
+	sync.Mutex
+	entries map[string][]byte
+}{entries: make(map[string][]byte)}
+
+// wsWriter is the part of *websocket.Conn that the send queue uses
+type wsWriter interface {
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	EnableWriteCompression(enable bool)
+	Close() error
+}
+
+type outgoingMessage struct {
+	messageType int
+	data        []byte
+	ephemeral   bool
+	// Notifications are compressed with the negotiated dictionary, if any
+	notification bool
+}
+
+type sendQueue struct {
+	conn    wsWriter
+	control *utils.Control
+	// Messages of at least this many bytes are compressed, if the client negotiated compression; 0 disables it
+	compressionThreshold int
+	// The compression dictionary negotiated with the client, if any
+	dictionary string
+
+	mutex    sync.Mutex
+	messages []outgoingMessage
+
+	queued  chan struct{} // Signalled when a message is queued
+	written chan struct{} // Signalled when a message is taken off the queue
+}
+
+func newSendQueue(conn wsWriter, control *utils.Control, compressionThreshold int, dictionary string) *sendQueue {
+	return &sendQueue{
+		conn:                 conn,
+		control:              control,
+		compressionThreshold: compressionThreshold,
+		dictionary:           dictionary,
+		messages:             make([]outgoingMessage, 0, sendQueueSize),
+		queued:               make(chan struct{}, 1),
+		written:              make(chan struct{}, 1),
+	}
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// WriteMessage queues a message that must not be dropped, such as a response, so that the queue can be used as the
+// websocket's rabbitmq.MessageWriter
+func (q *sendQueue) WriteMessage(messageType int, data []byte) error {
+	return q.push(outgoingMessage{messageType: messageType, data: data})
+}
+
+// push queues the message. If the queue is full, an ephemeral message replaces the oldest queued ephemeral message,
+// or is dropped if there are none; other messages wait up to sendTimeout for space.
+func (q *sendQueue) push(msg outgoingMessage) error {
+	var timeout <-chan time.Time
+	for {
+		q.mutex.Lock()
+		if len(q.messages) < sendQueueSize {
+			q.messages = append(q.messages, msg)
+			q.mutex.Unlock()
+			wake(q.queued)
+			return nil
+		}
+		if msg.ephemeral {
+			q.dropOldestEphemeral(msg)
+			q.mutex.Unlock()
+			return nil
+		}
+		q.mutex.Unlock()
+
+		if timeout == nil {
+			timeout = time.After(sendTimeout)
+		}
+		select {
+		case <-q.written:
+		case <-q.control.Exit:
+			return errSendQueueClosed
+		case <-timeout:
+			q.disconnect(errSlowClient)
+			return errSlowClient
+		}
+	}
+}
+
+// dropOldestEphemeral makes room for the ephemeral message by dropping the oldest queued ephemeral message, or drops
+// msg if there are none. The mutex must be held.
+func (q *sendQueue) dropOldestEphemeral(msg outgoingMessage) {
+	sendQueueMetrics.Add("EphemeralDropped", 1)
+	for i, queued := range q.messages {
+		if queued.ephemeral {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			q.messages = append(q.messages, msg)
+			return
+		}
+	}
+}
+
+// pop waits for the next message, returning false once the websocket is shut down
+func (q *sendQueue) pop() (outgoingMessage, bool) {
+	for {
+		q.mutex.Lock()
+		if len(q.messages) > 0 {
+			msg := q.messages[0]
+			q.messages = q.messages[1:]
+			q.mutex.Unlock()
+			wake(q.written)
+			return msg, true
+		}
+		q.mutex.Unlock()
+
+		select {
+		case <-q.queued:
+		case <-q.control.Exit:
+			return outgoingMessage{}, false
+		}
+	}
+}
+
+// run writes queued messages to the client until the websocket is shut down, or a write fails
+func (q *sendQueue) run() {
+	for {
+		msg, ok := q.pop()
+		if !ok {
+			return
+		}
+
+		if q.dictionary != "" && msg.notification {
+			if compressed, ok := compressNotification(q.dictionary, msg.data); ok {
+				sendQueueMetrics.Add("DictionaryCompressed", 1)
+				sendQueueMetrics.Add("DictionaryBytesSaved", int64(len(msg.data)-len(compressed)))
+				msg = outgoingMessage{messageType: websocket.BinaryMessage, data: compressed}
+			}
+		}
+
+		compress := msg.messageType != websocket.BinaryMessage &&
+			q.compressionThreshold > 0 && len(msg.data) >= q.compressionThreshold
+		if compress {
+			sendQueueMetrics.Add("Compressed", 1)
+		}
+		q.conn.EnableWriteCompression(compress)
+		q.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		err := q.conn.WriteMessage(msg.messageType, msg.data)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				err = errSlowClient
+			}
+			q.disconnect(err)
+			return
+		}
+	}
+}
+
+// compressNotification returns the notification compressed with the dictionary, and whether that made it smaller
+func compressNotification(dictionary string, data []byte) ([]byte, bool) {
+	key := dictionary + "\x00" + string(data)
+	compressedNotifications.Lock()
+	compressed, ok := compressedNotifications.entries[key]
+	compressedNotifications.Unlock()
+	if !ok {
+		var err error
+		compressed, err = compression.Compress(dictionary, data)
+		if err != nil {
+			utils.LogError("Failed to compress notification", err, utils.LogFields{
+				"Dictionary": dictionary,
+			})
+			return nil, false
+		}
+
+		compressedNotifications.Lock()
+		if len(compressedNotifications.entries) >= maxCompressedNotifications {
+			compressedNotifications.entries = make(map[string][]byte)
+		}
+		compressedNotifications.entries[key] = compressed
+		compressedNotifications.Unlock()
+	}
+	return compressed, len(compressed) < len(data)
+}
+
+// disconnect closes the connection, which stops the websocket's read loop
+func (q *sendQueue) disconnect(err error) {
+	if err == errSlowClient {
+		sendQueueMetrics.Add("SlowClientDisconnects", 1)
+	}
+	utils.LogError("Failed to send message, terminating connection", err, nil)
+	q.conn.Close()
+	q.control.Shutdown()
+}
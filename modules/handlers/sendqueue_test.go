@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/compression"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWSConn records written messages, and blocks writes until unblocked
+type fakeWSConn struct {
+	mutex      sync.Mutex
+	written    []string
+	types      []int
+	compressed []bool
+	compress   bool
+	blocked    chan struct{}
+	closed     bool
+}
+
+func newFakeWSConn() *fakeWSConn {
+	return &fakeWSConn{blocked: make(chan struct{})}
+}
+
+func (c *fakeWSConn) WriteMessage(messageType int, data []byte) error {
+	<-c.blocked
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.written = append(c.written, string(data))
+	c.types = append(c.types, messageType)
+	c.compressed = append(c.compressed, c.compress)
+	return nil
+}
+
+func (c *fakeWSConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *fakeWSConn) EnableWriteCompression(enable bool) {
+	c.compress = enable
+}
+
+func (c *fakeWSConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeWSConn) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closed
+}
+
+func TestSendQueueDropsOldestEphemeral(t *testing.T) {
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	q := newSendQueue(newFakeWSConn(), control, 0, "")
+
+	assert.NoError(t, q.push(outgoingMessage{data: []byte("cursor-1"), ephemeral: true}))
+	for i := 1; i < sendQueueSize; i++ {
+		assert.NoError(t, q.push(outgoingMessage{data: []byte("change")}))
+	}
+
+	// The queue is full; the oldest ephemeral message makes room for the new one
+	assert.NoError(t, q.push(outgoingMessage{data: []byte("cursor-2"), ephemeral: true}))
+	assert.Len(t, q.messages, sendQueueSize)
+	assert.Equal(t, "change", string(q.messages[0].data))
+	assert.Equal(t, "cursor-2", string(q.messages[sendQueueSize-1].data))
+
+	// With no ephemeral messages left to replace, new ones are dropped
+	q.messages = q.messages[:sendQueueSize-1]
+	assert.NoError(t, q.push(outgoingMessage{data: []byte("change")}))
+	assert.NoError(t, q.push(outgoingMessage{data: []byte("cursor-3"), ephemeral: true}))
+	for _, msg := range q.messages {
+		assert.NotEqual(t, "cursor-3", string(msg.data))
+	}
+}
+
+func TestSendQueueDisconnectsSlowClient(t *testing.T) {
+	defer func(timeout time.Duration) { sendTimeout = timeout }(sendTimeout)
+	sendTimeout = 50 * time.Millisecond
+
+	conn := newFakeWSConn()
+	control := utils.NewControl(0)
+	q := newSendQueue(conn, control, 0, "")
+	go q.run()
+
+	// The writer takes one message and blocks on it; the rest fill the queue
+	assert.NoError(t, q.WriteMessage(1, []byte("response")))
+	for {
+		q.mutex.Lock()
+		taken := len(q.messages) == 0
+		q.mutex.Unlock()
+		if taken {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < sendQueueSize; i++ {
+		assert.NoError(t, q.WriteMessage(1, []byte("response")))
+	}
+	assert.Equal(t, errSlowClient, q.WriteMessage(1, []byte("response")))
+	assert.True(t, conn.isClosed(), "slow client should be disconnected")
+
+	select {
+	case <-control.Exit:
+	default:
+		t.Fatal("websocket should be shut down")
+	}
+	close(conn.blocked)
+}
+
+func TestSendQueueWrites(t *testing.T) {
+	conn := newFakeWSConn()
+	close(conn.blocked)
+	control := utils.NewControl(0)
+	q := newSendQueue(conn, control, 2, "")
+	go q.run()
+
+	assert.NoError(t, q.WriteMessage(1, []byte("1")))
+	assert.NoError(t, q.push(outgoingMessage{data: []byte("22"), ephemeral: true}))
+	assert.NoError(t, q.WriteMessage(1, []byte("333")))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		conn.mutex.Lock()
+		n := len(conn.written)
+		conn.mutex.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	control.Shutdown()
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	assert.Equal(t, []string{"1", "22", "333"}, conn.written)
+	assert.Equal(t, []bool{false, true, true}, conn.compressed, "only messages over the threshold should be compressed")
+}
+
+func TestSendQueueCompressesNotifications(t *testing.T) {
+	conn := newFakeWSConn()
+	close(conn.blocked)
+	control := utils.NewControl(0)
+	q := newSendQueue(conn, control, 1, compression.NotificationsV1)
+	go q.run()
+
+	notification := []byte(`{"Type":"Notification","Timestamp":1760000000000,"ServerMessage":{"Resource":"File",` +
+		`"Method":"Change","ResourceID":42,"Data":{"FileVersion":7,"Changes":"v6:\n12:+1:a:\n40"},"Sequence":9}}`)
+	assert.NoError(t, q.push(outgoingMessage{messageType: websocket.TextMessage, data: notification, notification: true}))
+	assert.NoError(t, q.WriteMessage(websocket.TextMessage, []byte(`{"Type":"Response"}`)))
+	assert.NoError(t, q.push(outgoingMessage{messageType: websocket.TextMessage, data: []byte("{}"), notification: true}))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		conn.mutex.Lock()
+		n := len(conn.written)
+		conn.mutex.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	control.Shutdown()
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	require.Len(t, conn.written, 3)
+
+	// Notifications are sent compressed, as binary, without permessage-deflate on top
+	assert.Equal(t, websocket.BinaryMessage, conn.types[0])
+	assert.False(t, conn.compressed[0])
+	assert.True(t, len(conn.written[0]) < len(notification)/2, "notification should compress to under half its size")
+	decompressed, err := compression.Decompress(compression.NotificationsV1, []byte(conn.written[0]))
+	require.NoError(t, err)
+	assert.Equal(t, notification, decompressed)
+
+	// Responses, and notifications that don't get smaller, are sent as they are
+	assert.Equal(t, []int{websocket.TextMessage, websocket.TextMessage}, conn.types[1:])
+	assert.Equal(t, []string{`{"Type":"Response"}`, "{}"}, conn.written[1:])
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+/**
+ * Server starts the HTTP(S) listener that hosts the WebSocket endpoint.
+ */
+
+// ListenAndServe serves the given handler on the configured port, using TLS if UseTLS is set.
+// If HTTPRedirectPort is set, plain HTTP requests on that port are redirected to the TLS listener.
+// If EnableGRPC is set without TLS, HTTP/2 is also accepted in cleartext, since gRPC requires it.
+// If ProxyProtocol is set, connections from TrustedProxies start with a PROXY protocol header; see proxyprotocol.go.
+// Blocks until the listener fails.
+func ListenAndServe(cfg config.ServerCfg, handler http.Handler) error {
+	return ListenAndServeContext(context.Background(), cfg, handler)
+}
+
+// ListenAndServeContext is ListenAndServe, but closes the listener once ctx is done, returning nil. WebSocket
+// connections already accepted are left to close on their own.
+func ListenAndServeContext(ctx context.Context, cfg config.ServerCfg, handler http.Handler) error {
+	addr := fmt.Sprintf(":%d", cfg.Port)
+
+	// Checked here so that invalid networks are reported at startup, rather than refusing every client
+	policy, err := cfg.NetworkPolicy()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if cfg.ProxyProtocol {
+		listener = proxyProtocolListener{Listener: listener, policy: policy}
+	}
+
+	if !cfg.UseTLS {
+		if cfg.EnableGRPC {
+			if handler == nil {
+				handler = http.DefaultServeMux
+			}
+			handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+		return serveUntilDone(ctx, &http.Server{Handler: handler}, func(server *http.Server) error {
+			return server.Serve(listener)
+		})
+	}
+
+	tlsConfig, certManager, err := NewTLSConfig(cfg)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	if cfg.HTTPRedirectPort != 0 {
+		var redirectHandler http.Handler = newHTTPSRedirectHandler(cfg.Port)
+		if certManager != nil {
+			// Let's Encrypt HTTP-01 challenges must be answered over plain HTTP
+			redirectHandler = certManager.HTTPHandler(redirectHandler)
+		}
+		go func() {
+			redirectAddr := fmt.Sprintf(":%d", cfg.HTTPRedirectPort)
+			err := http.ListenAndServe(redirectAddr, redirectHandler)
+			utils.LogError("HTTP redirect listener failed", err, utils.LogFields{
+				"Address": redirectAddr,
+			})
+		}()
+	}
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	// Certificates are already in the TLSConfig
+	return serveUntilDone(ctx, server, func(server *http.Server) error {
+		return server.ServeTLS(listener, "", "")
+	})
+}
+
+// serveUntilDone serves with the server until it fails, or ctx is done, in which case it is closed, and nil returned
+func serveUntilDone(ctx context.Context, server *http.Server, serve func(*http.Server) error) error {
+	served := make(chan struct{})
+	defer close(served)
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Close()
+		case <-served:
+		}
+	}()
+
+	err := serve(server)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// NewTLSConfig builds the TLS configuration for the given server config. The returned autocert.Manager is nil unless
+// certificates are being requested from Let's Encrypt.
+func NewTLSConfig(cfg config.ServerCfg) (*tls.Config, *autocert.Manager, error) {
+	minVersion, err := cfg.TLSMinVersionID()
+	if err != nil {
+		return nil, nil, err
+	}
+	cipherSuites, err := cfg.TLSCipherSuiteIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}
+
+	if !cfg.UseAutocert() {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		return tlsConfig, nil, nil
+	}
+
+	cacheDir := cfg.TLSAutocertCacheDir
+	if cacheDir == "" {
+		cacheDir = "certs"
+	}
+	certManager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.Host),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+	tlsConfig.GetCertificate = certManager.GetCertificate
+	tlsConfig.NextProtos = []string{"http/1.1", "acme-tls/1"}
+	if cfg.EnableGRPC {
+		tlsConfig.NextProtos = append([]string{"h2"}, tlsConfig.NextProtos...)
+	}
+
+	return tlsConfig, certManager, nil
+}
+
+// newHTTPSRedirectHandler redirects all requests, including WebSocket upgrades, to the same host and path over HTTPS.
+func newHTTPSRedirectHandler(tlsPort uint16) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		host, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			host = request.Host
+		}
+		if tlsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(int(tlsPort)))
+		}
+
+		target := "https://" + host + request.URL.RequestURI()
+		http.Redirect(responseWriter, request, target, http.StatusMovedPermanently)
+	})
+}
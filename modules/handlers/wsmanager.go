@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/compression"
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/datahandling"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
@@ -21,20 +29,50 @@ import (
 
 const outboundMessageQueueBufferSize = 32
 
-// Counter for unique ID of WebSockets Connections. Unique to hostname.
-var atomicIDCounter uint64
+// defaultCompressionThreshold is the size, in bytes, of the smallest message that is compressed if
+// ServerConfig.CompressionThreshold is not set
+const defaultCompressionThreshold = 1024
 
-// Define WebSocket Upgrader that ignores origin; there is never going to be a referral source.
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+// openConnections is the number of open WebSocket connections
+var openConnections int64
+
+// ConnectionCount returns the number of open WebSocket connections, of every WebSocketHandler in the process
+func ConnectionCount() int {
+	return int(atomic.LoadInt64(&openConnections))
+}
+
+// HealthCheck answers load balancers' health checks, failing once the server is draining
+func HealthCheck(responseWriter http.ResponseWriter, request *http.Request) {
+	if datahandling.Draining() {
+		http.Error(responseWriter, "draining", 503)
+		return
+	}
+	responseWriter.Write([]byte("ok"))
+}
+
+// newWebsocketID returns a random ID for a WebSocket connection. IDs are random rather than counted, so that they are
+// not reused when the server restarts, and clients resuming a session cannot be confused with earlier connections.
+func newWebsocketID() uint64 {
+	var id [8]byte
+	rand.Read(id[:])
+	return binary.BigEndian.Uint64(id[:])
 }
 
-// NewWSConn accepts a HTTP Upgrade request, creating a new websocket connection.
+// WebSocketHandler accepts HTTP Upgrade requests, creating a new websocket connection for each.
 // Once a WebSocket connection is created, will setup the Receiving and Sending routines,
-// then
-func NewWSConn(responseWriter http.ResponseWriter, request *http.Request) {
+// then handle its requests with a DataHandler.
+type WebSocketHandler struct {
+	Config  *config.Config // The server's config; defaults to the process's, following its reloads
+	Db      dbfs.DBFS
+	Broker  broker.Broker  // Defaults to RabbitMQ
+	Control *utils.Control // Disconnects the handler's clients when shut down, if set
+
+	// Authenticator checks login tokens in place of those the server issues, if set; see datahandling.DataHandler
+	Authenticator datahandling.Authenticator
+}
+
+// ServeHTTP accepts the HTTP Upgrade request, and handles the connection until it is closed
+func (h *WebSocketHandler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
 	// Receive and upgrade request
 	if request.URL.Path != "/ws/" {
 		http.Error(responseWriter, "Not found", 404)
@@ -44,43 +82,95 @@ func NewWSConn(responseWriter http.ResponseWriter, request *http.Request) {
 		http.Error(responseWriter, "Method not allowed", 405)
 		return
 	}
-	wsConn, err := upgrader.Upgrade(responseWriter, request, nil)
+	if datahandling.Draining() {
+		http.Error(responseWriter, "Server is draining", 503)
+		return
+	}
+	remoteAddr := datahandling.ClientAddr(h.Config, request)
+	if !datahandling.ClientAllowed(h.Config, request) {
+		utils.LogDebug("Refused connection from a denied network", utils.LogFields{
+			"RemoteAddr": remoteAddr,
+		})
+		http.Error(responseWriter, "Forbidden", 403)
+		return
+	}
+	cfg := h.Config
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
+	if cfg.ServerConfig.RequireSubprotocol && !offersSubprotocol(request, cfg.ServerConfig.Subprotocols) {
+		http.Error(responseWriter, "Unsupported subprotocol", 400)
+		return
+	}
+	if reason := outdatedClientReason(request, cfg.ServerConfig.MinClientVersions); reason != "" {
+		utils.LogDebug("Refused connection from an outdated client", utils.LogFields{
+			"RemoteAddr": remoteAddr,
+			"Reason":     reason,
+		})
+		http.Error(responseWriter, reason, 426)
+		return
+	}
+
+	dictionary := negotiateDictionary(request, cfg.ServerConfig)
+	var responseHeader http.Header
+	if dictionary != "" {
+		responseHeader = http.Header{compression.Header: []string{dictionary}}
+	}
+
+	wsConn, err := newUpgrader(cfg.ServerConfig).Upgrade(responseWriter, request, responseHeader)
 	if err != nil {
-		utils.LogError("Failed to upgrade connection", err, nil)
+		utils.LogError("Failed to upgrade connection", err, utils.LogFields{
+			"RemoteAddr": remoteAddr,
+			"Origin":     request.Header.Get("Origin"),
+		})
 		return
 	}
 	defer wsConn.Close()
-	cfg := config.GetConfig()
+	atomic.AddInt64(&openConnections, 1)
+	defer atomic.AddInt64(&openConnections, -1)
+	if cfg.ServerConfig.MaxMessageSize > 0 {
+		wsConn.SetReadLimit(cfg.ServerConfig.MaxMessageSize)
+	}
 
 	// TODO: Send data blob
 
 	// Generate unique ID for this websocket
-	wsID := atomic.AddUint64(&atomicIDCounter, 1)
+	wsID := newWebsocketID()
 
 	pubCfg := rabbitmq.NewPubConfig(func(msg rabbitmq.AMQPMessage) {
 		// TODO(wongb): Do we need to send errors back to the client on publishing fail? Can we just kill the socket?
-		msg.ErrHandler()
+		if msg.ErrHandler != nil {
+			msg.ErrHandler()
+		}
 	}, outboundMessageQueueBufferSize)
 
 	subCfg := &rabbitmq.AMQPSubCfg{
 		QueueID:     wsID,
-		Keys:        []string{},
+		Keys:        []string{rabbitmq.RabbitBroadcastKey},
 		IsWorkQueue: false,
 	}
 
 	pubSubCfg := rabbitmq.NewAMQPPubSubCfg(cfg.ServerConfig.Name, pubCfg, subCfg)
 
-	subCfg.HandleMessageFunc = newAMQPMessageHandler(wsID, pubSubCfg, wsConn)
+	// Messages are written to the client by the send queue, so that a slow client does not hold up the subscriber
+	sendQ := newSendQueue(wsConn, pubSubCfg.Control, compressionThreshold(cfg.ServerConfig), dictionary)
+	go sendQ.run()
+
+	var msgBroker broker.Broker = rabbitmq.RabbitBroker{}
+	if h.Broker != nil {
+		msgBroker = h.Broker
+	}
+	subCfg.HandleMessageFunc = newAMQPMessageHandler(wsID, pubSubCfg, sendQ, msgBroker)
 
 	go func() {
-		err := rabbitmq.RunPublisher(pubSubCfg)
+		err := msgBroker.RunPublisher(pubSubCfg)
 		if err != nil {
 			utils.LogError("Publisher error encountered. Exiting", err, nil)
 			pubSubCfg.Control.Shutdown()
 		}
 	}()
 	go func() {
-		err := rabbitmq.RunSubscriber(pubSubCfg)
+		err := msgBroker.RunSubscriber(pubSubCfg)
 		if err != nil {
 			utils.LogError("Subscriber error encountered. Exiting", err, nil)
 			pubSubCfg.Control.Shutdown()
@@ -89,16 +179,57 @@ func NewWSConn(responseWriter http.ResponseWriter, request *http.Request) {
 
 	pubSubCfg.Control.Ready.Wait()
 
+	// Requests still running when the client disconnects are abandoned
+	ctx, cancel := context.WithCancel(context.Background())
+
 	// we don't actually need more than 1 datahandler per websocket
 	dh := datahandling.DataHandler{
-		MessageChan: pubCfg.Messages,
-		WebsocketID: wsID,
-		Db:          dbfs.Dbfs,
+		MessageChan:   pubCfg.Messages,
+		WebsocketID:   wsID,
+		SessionID:     datahandling.NewSessionID(),
+		Db:            h.Db,
+		Config:        h.Config,
+		Context:       ctx,
+		RemoteAddr:    remoteAddr,
+		UserAgent:     request.UserAgent(),
+		Authenticator: h.Authenticator,
+		Order:         datahandling.NewMessageOrder(),
 	}
 
+	// Keep the session's subscriptions while connected, so that they can be resumed after a disconnect
+	go func() {
+		ticker := time.NewTicker(datahandling.SessionResumeWindow / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pubSubCfg.Control.Exit:
+				return
+			case <-ticker.C:
+				err := dh.Db.MySQLSessionTouch(dh.SessionID)
+				utils.LogError("Failed to touch session", err, utils.LogFields{
+					"SessionID": dh.SessionID,
+				})
+			}
+		}
+	}()
+
 	// Waitgroup to make sure channel is closed at appropriate time.
 	dhCompleted := &sync.WaitGroup{}
 
+	// If the publisher or subscriber fail, or the handler is shut down, stop reading from the client too
+	var handlerExit <-chan bool
+	if h.Control != nil {
+		handlerExit = h.Control.Exit
+	}
+	go func() {
+		select {
+		case <-pubSubCfg.Control.Exit:
+		case <-handlerExit:
+			pubSubCfg.Control.Shutdown()
+		}
+		wsConn.Close()
+	}()
+
 loop:
 	for {
 		select {
@@ -107,43 +238,163 @@ loop:
 		default:
 			messageType, message, err := wsConn.ReadMessage()
 			if err != nil {
-				utils.LogError("Failed to read message, terminating connection", err, nil)
+				utils.LogError("Failed to read message, terminating connection", err, utils.LogFields{
+					"RemoteAddr": remoteAddr,
+				})
 				pubSubCfg.Control.Shutdown()
 				break loop
 			}
 
 			dhCompleted.Add(1)
-			go dh.Handle(messageType, message, dhCompleted)
+			msgHandler := dh.Receive()
+			go msgHandler.Handle(messageType, message, dhCompleted)
 		}
 	}
 
+	cancel()
+
 	// Wait for all datahandlers to complete before closing channel
-	dhCompleted.Wait()
+	drainRequests(dhCompleted, pubCfg.Messages)
 	close(pubCfg.Messages)
+	dh.Close()
+}
+
+// drainRequests waits for the connection's datahandlers to complete after it has been shut down. The publisher has
+// stopped by then, so the messages they send are discarded, rather than left to block them once the buffer is full.
+func drainRequests(dhCompleted *sync.WaitGroup, messages <-chan rabbitmq.AMQPMessage) {
+	completed := make(chan struct{})
+	go func() {
+		dhCompleted.Wait()
+		close(completed)
+	}()
+
+	for {
+		select {
+		case <-completed:
+			return
+		case msg := <-messages:
+			sendQueueMetrics.Add("DiscardedOnDisconnect", 1)
+			utils.LogDebug("Discarding message sent after disconnect", utils.LogFields{
+				"RoutingKey": msg.RoutingKey,
+			})
+		}
+	}
+}
+
+// compressionThreshold returns the size of the smallest message to compress, or 0 if compression is disabled
+func compressionThreshold(cfg config.ServerCfg) int {
+	switch {
+	case cfg.DisableCompression:
+		return 0
+	case cfg.CompressionThreshold > 0:
+		return cfg.CompressionThreshold
+	default:
+		return defaultCompressionThreshold
+	}
+}
+
+// negotiateDictionary returns the dictionary to compress notifications to the client with, or "" if it offered none
+// the server has, or compression is disabled
+func negotiateDictionary(request *http.Request, cfg config.ServerCfg) string {
+	if cfg.DisableCompression {
+		return ""
+	}
+	offered := request.Header.Get(compression.Header)
+	if offered == "" {
+		offered = request.URL.Query().Get(compression.Param)
+	}
+	return compression.Negotiate(offered)
+}
+
+// newUpgrader returns an upgrader for the configured origin, subprotocol and compression policy
+func newUpgrader(cfg config.ServerCfg) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: func(request *http.Request) bool {
+			return originAllowed(request, cfg.AllowedOrigins)
+		},
+		Subprotocols: cfg.Subprotocols,
+		// Offer permessage-deflate; it is only used if the client asks for it
+		EnableCompression: !cfg.DisableCompression,
+	}
+}
+
+// originAllowed returns whether the page that opened the connection, if any, may connect. Allowed origins are matched
+// case-insensitively, and may use "*." in place of any number of subdomains.
+func originAllowed(request *http.Request, allowedOrigins []string) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(allowedOrigins) == 0 {
+		return strings.EqualFold(originURL.Host, request.Host)
+	}
+
+	for _, allowed := range allowedOrigins {
+		switch {
+		case allowed == "*", strings.EqualFold(allowed, origin):
+			return true
+		case strings.Contains(allowed, "://*."):
+			parts := strings.SplitN(allowed, "://*", 2)
+			if strings.EqualFold(originURL.Scheme, parts[0]) && len(originURL.Host) > len(parts[1]) &&
+				strings.HasSuffix(strings.ToLower(originURL.Host), strings.ToLower(parts[1])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// offersSubprotocol returns whether the client offered one of the server's subprotocols
+func offersSubprotocol(request *http.Request, subprotocols []string) bool {
+	for _, offered := range websocket.Subprotocols(request) {
+		for _, subprotocol := range subprotocols {
+			if offered == subprotocol {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func newAMQPMessageHandler(websocketID uint64, cfg *rabbitmq.AMQPPubSubCfg, wsConn *websocket.Conn) func(rabbitmq.AMQPMessage) error {
+func newAMQPMessageHandler(websocketID uint64, cfg *rabbitmq.AMQPPubSubCfg, sendQ *sendQueue, binder rabbitmq.QueueBinder) func(rabbitmq.AMQPMessage) error {
 	queueName := rabbitmq.RabbitWebsocketQueueName(websocketID)
+	subscriptions := rabbitmq.NewSubscriptions()
+	mutes := rabbitmq.NewMutes()
 
 	return func(msg rabbitmq.AMQPMessage) error {
 		switch msg.ContentType {
 		case rabbitmq.ContentTypeMsg:
-			// If notification with self as origin, early-out; ignore our own notifications.
-			if val, ok := msg.Headers["MessageType"]; ok && val == "Notification" {
-				if val, ok := msg.Headers["Origin"]; ok && val == queueName {
-					return nil
-				}
+			// Messages that exclude their origin are not echoed back to the websocket that sent them
+			if exclude, _ := msg.Headers["ExcludeOrigin"].(bool); exclude && msg.Headers["Origin"] == queueName {
+				return nil
+			}
+			if mutes.Muted(msg.Headers) {
+				return nil
 			}
 
 			utils.LogDebug("Sending Message", utils.LogFields{
 				"Message": string(msg.Message),
 			})
-			return wsConn.WriteMessage(websocket.TextMessage, msg.Message)
+			ephemeral, _ := msg.Headers["Ephemeral"].(bool)
+			return sendQ.push(outgoingMessage{
+				messageType:  websocket.TextMessage,
+				data:         msg.Message,
+				ephemeral:    ephemeral,
+				notification: msg.Headers["MessageType"] == "Notification",
+			})
 		case rabbitmq.ContentTypeCmd:
 			rch := rabbitmq.RabbitCommandHandler{
-				ExchangeName: cfg.ExchangeName,
-				WSConn:       wsConn,
-				WSID:         cfg.SubCfg.QueueID,
+				ExchangeName:  cfg.ExchangeName,
+				WSConn:        sendQ,
+				WSID:          cfg.SubCfg.QueueID,
+				Subscriptions: subscriptions,
+				Mutes:         mutes,
+				Binder:        binder,
+				Disconnect:    cfg.Control.Shutdown,
 			}
 			return rch.HandleCommand(msg)
 		default:
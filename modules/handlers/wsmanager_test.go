@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/compression"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainRequests(t *testing.T) {
+	messages := make(chan rabbitmq.AMQPMessage, 2)
+	dhCompleted := &sync.WaitGroup{}
+
+	// Datahandlers that send more messages than are buffered must not block once the publisher has stopped
+	for i := 0; i < 3; i++ {
+		dhCompleted.Add(1)
+		go func() {
+			defer dhCompleted.Done()
+			for j := 0; j < 5; j++ {
+				messages <- rabbitmq.AMQPMessage{RoutingKey: "Project-1"}
+			}
+		}()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		drainRequests(dhCompleted, messages)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("Datahandlers did not complete")
+	}
+}
+
+func TestAMQPMessageHandler_ExcludeOrigin(t *testing.T) {
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	q := newSendQueue(newFakeWSConn(), control, 0, "")
+	handle := newAMQPMessageHandler(1, &rabbitmq.AMQPPubSubCfg{}, q, nil)
+
+	own := rabbitmq.RabbitWebsocketQueueName(1)
+	other := rabbitmq.RabbitWebsocketQueueName(2)
+	msgs := []rabbitmq.AMQPMessage{
+		{Headers: map[string]interface{}{"Origin": own, "ExcludeOrigin": true}, Message: []byte("own")},
+		{Headers: map[string]interface{}{"Origin": other, "ExcludeOrigin": true}, Message: []byte("other")},
+		{Headers: map[string]interface{}{"Origin": own}, Message: []byte("included")},
+	}
+	for _, msg := range msgs {
+		msg.ContentType = rabbitmq.ContentTypeMsg
+		assert.NoError(t, handle(msg))
+	}
+
+	// Only the sender's own message that excludes it is dropped
+	if assert.Len(t, q.messages, 2) {
+		assert.Equal(t, "other", string(q.messages[0].data))
+		assert.Equal(t, "included", string(q.messages[1].data))
+	}
+}
+
+func TestAMQPMessageHandler_Mute(t *testing.T) {
+	control := utils.NewControl(0)
+	defer control.Shutdown()
+	q := newSendQueue(newFakeWSConn(), control, 0, "")
+	handle := newAMQPMessageHandler(1, &rabbitmq.AMQPPubSubCfg{SubCfg: &rabbitmq.AMQPSubCfg{}}, q, nil)
+
+	mute, err := json.Marshal(rabbitmq.RabbitCommandStruct{
+		Command: "Mute",
+		Tag:     -1,
+		Data:    rabbitmq.MuteData{Events: []string{"File.SetMetadata"}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, handle(rabbitmq.AMQPMessage{ContentType: rabbitmq.ContentTypeCmd, Message: mute}))
+
+	project := rabbitmq.RabbitProjectQueueName(1)
+	msgs := []rabbitmq.AMQPMessage{
+		{Headers: map[string]interface{}{"Project": project, "Event": "File.SetMetadata"}, Message: []byte("muted")},
+		{Headers: map[string]interface{}{"Project": project, "Event": "File.Change"}, Message: []byte("change")},
+	}
+	for _, msg := range msgs {
+		msg.ContentType = rabbitmq.ContentTypeMsg
+		assert.NoError(t, handle(msg))
+	}
+
+	if assert.Len(t, q.messages, 1) {
+		assert.Equal(t, "change", string(q.messages[0].data))
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	request := httptest.NewRequest("GET", "http://cc.example.com/ws/", nil)
+	assert.True(t, originAllowed(request, nil), "clients other than browsers send no origin")
+
+	request.Header.Set("Origin", "https://cc.example.com")
+	assert.True(t, originAllowed(request, nil), "pages from the server's own host should be allowed by default")
+	request.Header.Set("Origin", "https://evil.example.org")
+	assert.False(t, originAllowed(request, nil))
+	assert.True(t, originAllowed(request, []string{"*"}))
+
+	allowed := []string{"https://app.example.org", "https://*.example.net"}
+	for origin, expected := range map[string]bool{
+		"https://App.Example.org":     true,
+		"http://app.example.org":      false,
+		"https://ide.example.net":     true,
+		"https://a.b.example.net":     true,
+		"https://example.net":         false,
+		"http://ide.example.net":      false,
+		"https://ide.example.net.com": false,
+		"https://cc.example.com":      false,
+	} {
+		request.Header.Set("Origin", origin)
+		assert.Equal(t, expected, originAllowed(request, allowed), origin)
+	}
+}
+
+func TestOffersSubprotocol(t *testing.T) {
+	request := httptest.NewRequest("GET", "/ws/", nil)
+	assert.False(t, offersSubprotocol(request, []string{"codecollaborate.v1"}))
+
+	request.Header.Set("Sec-WebSocket-Protocol", "chat, codecollaborate.v1")
+	assert.True(t, offersSubprotocol(request, []string{"codecollaborate.v1"}))
+	assert.False(t, offersSubprotocol(request, []string{"codecollaborate.v2"}))
+	assert.False(t, offersSubprotocol(request, nil))
+}
+
+func TestNegotiateDictionary(t *testing.T) {
+	cfg := config.ServerCfg{}
+	request := httptest.NewRequest("GET", "/ws/", nil)
+	assert.Equal(t, "", negotiateDictionary(request, cfg))
+
+	request.Header.Set(compression.Header, "notifications-v9, "+compression.NotificationsV1)
+	assert.Equal(t, compression.NotificationsV1, negotiateDictionary(request, cfg))
+	cfg.DisableCompression = true
+	assert.Equal(t, "", negotiateDictionary(request, cfg))
+
+	// Browsers offer them in the query, as they can't set headers
+	request = httptest.NewRequest("GET", "/ws/?"+compression.Param+"="+compression.NotificationsV1, nil)
+	assert.Equal(t, compression.NotificationsV1, negotiateDictionary(request, config.ServerCfg{}))
+}
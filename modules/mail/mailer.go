@@ -0,0 +1,208 @@
+package mail
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Outgoing email for the CodeCollaborate Server.
+ */
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var mailerMutex sync.RWMutex
+var mailers = make(map[*config.Config]Mailer) // By the config of the server they send for; nil for the process's
+
+// SetMailer sets the mailer used by Send.
+func SetMailer(m Mailer) {
+	SetMailerFor(nil, m)
+}
+
+// SetMailerFor sets the mailer of the server with the config; a nil config is the process's, whose mailer Send uses.
+// Setting a nil mailer restores the default.
+func SetMailerFor(cfg *config.Config, m Mailer) {
+	cfg = processKey(cfg)
+	mailerMutex.Lock()
+	defer mailerMutex.Unlock()
+
+	if m == nil {
+		delete(mailers, cfg)
+		return
+	}
+	mailers[cfg] = m
+}
+
+// GetMailer returns the mailer used by Send. If none has been set, uses an SMTPMailer if an "SMTP" connection is
+// configured, or a LogMailer otherwise.
+func GetMailer() Mailer {
+	return MailerFor(nil)
+}
+
+// MailerFor returns the mailer of the server with the config, or the process's if the config is nil or the process's.
+// If none has been set, one is made from the config as GetMailer's is.
+func MailerFor(cfg *config.Config) Mailer {
+	cfg = processKey(cfg)
+
+	mailerMutex.RLock()
+	m := mailers[cfg]
+	mailerMutex.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	mailerMutex.Lock()
+	defer mailerMutex.Unlock()
+	if mailers[cfg] == nil {
+		defaultCfg := cfg
+		if defaultCfg == nil {
+			defaultCfg = config.GetConfig()
+		}
+		mailers[cfg] = newDefaultMailer(defaultCfg)
+	}
+	return mailers[cfg]
+}
+
+// processKey returns nil for the process's config, under which its mailer is kept
+func processKey(cfg *config.Config) *config.Config {
+	if cfg == config.GetConfig() {
+		return nil
+	}
+	return cfg
+}
+
+// Send sends the message with the current mailer.
+func Send(msg Message) error {
+	return GetMailer().Send(msg)
+}
+
+func newDefaultMailer(cfg *config.Config) Mailer {
+	if cfg != nil {
+		if connCfg, ok := cfg.ConnectionConfig["SMTP"]; ok && connCfg.Host != "" {
+			return &SMTPMailer{
+				ConnCfg: connCfg,
+				From:    cfg.ServerConfig.EmailFrom,
+			}
+		}
+	}
+	utils.LogWarn("No SMTP connection configured; emails will be logged instead of sent", nil)
+	return LogMailer{}
+}
+
+// LogMailer logs messages instead of sending them; for development and testing.
+type LogMailer struct{}
+
+// Send logs the message's recipient and subject at Info level. Its body is not logged, since it may hold tokens that
+// would let anyone reading the logs verify the address or reset the password.
+func (LogMailer) Send(msg Message) error {
+	utils.LogInfo("Email not sent; no mailer configured", utils.LogFields{
+		"To":      msg.To,
+		"Subject": msg.Subject,
+	})
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP relay, using STARTTLS when the server supports it.
+type SMTPMailer struct {
+	ConnCfg config.ConnCfg
+	From    string
+}
+
+// Send sends the message through the configured SMTP relay.
+func (m *SMTPMailer) Send(msg Message) error {
+	addr := net.JoinHostPort(m.ConnCfg.Host, strconv.Itoa(int(m.ConnCfg.Port)))
+
+	timeout := time.Duration(m.ConnCfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.ConnCfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		tlsConfig, err := m.ConnCfg.TLSConfig()
+		if err != nil {
+			return err
+		}
+		if tlsConfig == nil {
+			tlsConfig, err = config.ConnCfg{UseTLS: true}.TLSConfig()
+			if err != nil {
+				return err
+			}
+		}
+		tlsConfig.ServerName = m.ConnCfg.Host
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if m.ConnCfg.Username != "" {
+		password, err := m.ConnCfg.ResolvePassword()
+		if err != nil {
+			return err
+		}
+		if err := client.Auth(smtp.PlainAuth("", m.ConnCfg.Username, password, m.ConnCfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(formatMessage(m.From, msg)); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func formatMessage(from string, msg Message) []byte {
+	// Strip newlines from headers, so that user-controlled values can't inject extra headers
+	stripNewlines := strings.NewReplacer("\r", "", "\n", "")
+
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		stripNewlines.Replace(from),
+		stripNewlines.Replace(msg.To),
+		stripNewlines.Replace(msg.Subject),
+		time.Now().Format(time.RFC1123Z),
+		strings.Replace(msg.Body, "\n", "\r\n", -1)))
+}
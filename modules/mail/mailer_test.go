@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingMailer struct {
+	sent []Message
+}
+
+func (m *recordingMailer) Send(msg Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	recorder := &recordingMailer{}
+	SetMailer(recorder)
+	defer SetMailer(nil)
+
+	msg := Message{To: "loganga@codecollaborate.com", Subject: "Subject", Body: "Body"}
+	assert.Nil(t, Send(msg))
+	assert.Equal(t, []Message{msg}, recorder.sent)
+}
+
+func TestMailerFor(t *testing.T) {
+	processMailer := &recordingMailer{}
+	SetMailer(processMailer)
+	defer SetMailer(nil)
+
+	serverCfg := &config.Config{
+		ConnectionConfig: config.ConnCfgMap{"SMTP": {Host: "smtp.example.com", Port: 587}},
+	}
+	serverCfg.ServerConfig.EmailFrom = "noreply@example.com"
+	defer SetMailerFor(serverCfg, nil)
+
+	assert.Equal(t, processMailer, MailerFor(nil))
+	assert.Equal(t, &SMTPMailer{ConnCfg: serverCfg.ConnectionConfig["SMTP"], From: "noreply@example.com"},
+		MailerFor(serverCfg), "a server's default mailer should be made from its own config")
+
+	serverMailer := &recordingMailer{}
+	SetMailerFor(serverCfg, serverMailer)
+	assert.Nil(t, MailerFor(serverCfg).Send(Message{To: "loganga@codecollaborate.com"}))
+	assert.Len(t, serverMailer.sent, 1)
+	assert.Empty(t, processMailer.sent, "a server's mailer should not replace the process's")
+}
+
+func TestLogMailer(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	assert.Nil(t, LogMailer{}.Send(Message{
+		To:      "loganga@codecollaborate.com",
+		Subject: "Reset your password",
+		Body:    "Your token is secret-token",
+	}))
+	assert.Contains(t, logged.String(), "Reset your password")
+	assert.NotContains(t, logged.String(), "secret-token", "tokens in the body should not be logged")
+}
+
+func TestFormatMessage(t *testing.T) {
+	formatted := string(formatMessage("noreply@codecollaborate.com", Message{
+		To:      "loganga@codecollaborate.com\r\nBcc: attacker@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	}))
+
+	headers := strings.SplitN(formatted, "\r\n\r\n", 2)[0]
+	assert.Contains(t, headers, "From: noreply@codecollaborate.com\r\n")
+	assert.Contains(t, headers, "Subject: Reset your password\r\n")
+	assert.NotContains(t, headers, "\r\nBcc:", "newlines in headers should be stripped")
+	assert.True(t, strings.HasSuffix(formatted, "line one\r\nline two\r\n"), "body should use CRLF line endings")
+}
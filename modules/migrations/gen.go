@@ -0,0 +1,52 @@
+//go:build ignore
+// +build ignore
+
+// gen.go embeds the migrations in sql/ into embedded.go, so that they are built into the server. Run it with
+// `go generate` after adding a migration.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	paths, err := filepath.Glob(filepath.Join("sql", "*.sql"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen.go from the files in sql/. DO NOT EDIT.\n\npackage migrations\n\n")
+	buf.WriteString("var embedded = map[string]string{\n")
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&buf, "%s: \"\"", strconv.Quote(filepath.Base(path)))
+		for _, line := range strings.SplitAfter(string(contents), "\n") {
+			if line != "" {
+				fmt.Fprintf(&buf, " +\n%s", strconv.Quote(line))
+			}
+		}
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("embedded.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
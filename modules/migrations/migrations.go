@@ -0,0 +1,216 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/dblock"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Migrations of the MySQL schema. Each migration is a SQL script in sql/, named <version>_<name>.sql, which is built
+ * into the server by `go generate`. Scripts use the syntax of the mysql client, including DELIMITER, so that the
+ * procedures can be written as they are dumped by mysqldump.
+ *
+ * The versions that have been applied are recorded in the SchemaMigration table. Applying a migration is not atomic,
+ * since MySQL commits schema changes immediately, so a migration that fails part way must be fixed by hand.
+ */
+
+//go:generate go run gen.go
+
+// Migration is a change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// lockName is the name of the lock held while migrating, so that only one server migrates at a time
+const lockName = "migrations"
+
+// lockTimeout is how long to wait for another server to finish migrating
+const lockTimeout = 5 * time.Minute
+
+// baselineVersion is the version of the schema as it was set up by hand, before migrations were introduced
+const baselineVersion = 1
+
+// ErrLockTimeout is returned if another server was migrating for longer than lockTimeout
+var ErrLockTimeout = errors.New("Timed out waiting for another server to finish migrating")
+
+var migrations = parseEmbedded()
+
+// List returns every migration, in order
+func List() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+func parseEmbedded() []Migration {
+	result := []Migration{}
+	for filename, script := range embedded {
+		name := strings.TrimSuffix(filename, ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			panic(fmt.Sprintf("migration %q must be named <version>_<name>.sql", filename))
+		}
+		result = append(result, Migration{Version: version, Name: parts[1], SQL: script})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	for i := 1; i < len(result); i++ {
+		if result[i].Version == result[i-1].Version {
+			panic(fmt.Sprintf("migrations %q and %q have the same version", result[i-1].Name, result[i].Name))
+		}
+	}
+	return result
+}
+
+// Apply runs the migrations that have not been applied to the database yet, in order, returning those it ran
+func Apply(db *sql.DB) ([]Migration, error) {
+	ctx := context.Background()
+
+	lock, err := dblock.Acquire(ctx, db, lockName, lockTimeout)
+	if err == dblock.ErrLockHeld {
+		return nil, ErrLockTimeout
+	} else if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	// Session variables set by the scripts last only as long as the connection, so every script runs on the one
+	// holding the lock
+	conn := lock.Conn()
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `SchemaMigration` ("+
+		"`Version` int(11) NOT NULL, "+
+		"`Name` varchar(100) COLLATE utf8_unicode_ci NOT NULL, "+
+		"`AppliedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP, "+
+		"PRIMARY KEY (`Version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci")
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(applied) == 0 {
+		adopted, err := adoptManualSchema(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if adopted {
+			applied[baselineVersion] = true
+		}
+	}
+
+	ran := []Migration{}
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		utils.LogInfo("Applying migration", utils.LogFields{
+			"Version": migration.Version,
+			"Name":    migration.Name,
+		})
+		for _, statement := range splitStatements(migration.SQL) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return ran, fmt.Errorf("migration %d (%s) failed: %v", migration.Version, migration.Name, err)
+			}
+		}
+		if err := recordMigration(ctx, conn, migration); err != nil {
+			return ran, err
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT `Version` FROM `SchemaMigration`")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// adoptManualSchema records the baseline as applied if the schema was set up by hand, returning whether it was
+func adoptManualSchema(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var tables int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables "+
+		"WHERE table_schema = DATABASE() AND table_name = 'User'").Scan(&tables)
+	if err != nil || tables == 0 {
+		return false, err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version == baselineVersion {
+			utils.LogInfo("Existing schema found; recording it as the baseline migration", utils.LogFields{
+				"Version": migration.Version,
+			})
+			return true, recordMigration(ctx, conn, migration)
+		}
+	}
+	return false, nil
+}
+
+func recordMigration(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	_, err := conn.ExecContext(ctx, "INSERT INTO `SchemaMigration` (`Version`, `Name`) VALUES (?, ?)",
+		migration.Version, migration.Name)
+	return err
+}
+
+// splitStatements splits a script into the statements to execute, as the mysql client would. Comment lines between
+// statements are dropped, and DELIMITER changes the string that ends statements.
+func splitStatements(script string) []string {
+	delimiter := ";"
+	statements := []string{}
+	var current bytes.Buffer
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current.Len() == 0 {
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			if fields := strings.Fields(trimmed); len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+				delimiter = fields[1]
+				continue
+			}
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, delimiter) {
+			statement := strings.TrimSuffix(strings.TrimSpace(current.String()), delimiter)
+			if statement = strings.TrimSpace(statement); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		}
+	}
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
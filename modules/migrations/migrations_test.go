@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedUpToDate(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("sql", "*.sql"))
+	require.NoError(t, err)
+	require.Len(t, embedded, len(paths), "run go generate after adding a migration")
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, string(contents), embedded[filepath.Base(path)], "run go generate after changing %s", path)
+	}
+}
+
+func TestList(t *testing.T) {
+	list := List()
+	require.NotEmpty(t, list)
+	assert.Equal(t, baselineVersion, list[0].Version)
+	for i := 1; i < len(list); i++ {
+		assert.True(t, list[i].Version > list[i-1].Version, "migrations should be in order")
+	}
+
+	for _, migration := range list {
+		assert.NotEmpty(t, splitStatements(migration.SQL), "migration %d has no statements", migration.Version)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- A comment
+/*!40101 SET NAMES utf8 */;
+
+CREATE TABLE t (
+  -- a column
+  id int
+);
+DELIMITER ;;
+CREATE PROCEDURE p()
+BEGIN
+SELECT 1;
+SELECT 2;
+END ;;
+DELIMITER ;
+INSERT INTO t VALUES (1)`
+
+	assert.Equal(t, []string{
+		"/*!40101 SET NAMES utf8 */",
+		"CREATE TABLE t (\n  -- a column\n  id int\n)",
+		"CREATE PROCEDURE p()\nBEGIN\nSELECT 1;\nSELECT 2;\nEND",
+		"INSERT INTO t VALUES (1)",
+	}, splitStatements(script))
+}
+
+func TestProcedureParams(t *testing.T) {
+	params := ProcedureParams()
+	assert.Equal(t, []string{"username", "pass", "email", "firstName", "lastName"}, params["user_register"])
+	assert.Equal(t, []string{"username", "avatarHash"}, params["user_set_avatar"])
+	assert.Equal(t, []string{"commentID", "username", "reaction", "remove"}, params["comment_reaction_set"])
+	assert.Equal(t, []string{}, parseParams(") BEGIN SELECT 1; END"))
+
+	// Procedures redefined by later migrations take their latest parameters
+	redefined := parseProcedureParams([]Migration{
+		{SQL: "CREATE PROCEDURE `p`(IN a int(11))\nBEGIN\nSELECT a;\nEND"},
+		{SQL: "DELIMITER ;;\nCREATE PROCEDURE `p`(IN a int(11), IN b decimal(10,2))\nBEGIN\nSELECT a, b;\nEND ;;"},
+	})
+	assert.Equal(t, map[string][]string{"p": {"a", "b"}}, redefined)
+}
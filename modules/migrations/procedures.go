@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+)
+
+// procedurePattern matches the start of a procedure definition, capturing its name
+var procedurePattern = regexp.MustCompile("PROCEDURE `([a-z_]+)`\\(")
+
+var procedureParams = parseProcedureParams(migrations)
+
+// ProcedureParams returns the names of the parameters of each stored procedure, as the latest migration to define it
+// declares them
+func ProcedureParams() map[string][]string {
+	return procedureParams
+}
+
+func parseProcedureParams(list []Migration) map[string][]string {
+	params := make(map[string][]string)
+	for _, migration := range list {
+		for _, statement := range splitStatements(migration.SQL) {
+			match := procedurePattern.FindStringSubmatchIndex(statement)
+			if match == nil {
+				continue
+			}
+			name := statement[match[2]:match[3]]
+			params[name] = parseParams(statement[match[1]:])
+		}
+	}
+	return params
+}
+
+// parseParams returns the names of the parameters in the list that begins the definition, up to its closing
+// parenthesis. Types such as varchar(25) have parentheses of their own.
+func parseParams(definition string) []string {
+	names := []string{}
+	depth := 0
+	start := 0
+	for i, c := range definition {
+		switch c {
+		case '(':
+			depth++
+		case ')', ',':
+			if depth > 0 {
+				if c == ')' {
+					depth--
+				}
+				continue
+			}
+			if fields := strings.Fields(definition[start:i]); len(fields) > 0 {
+				switch strings.ToUpper(fields[0]) {
+				case "IN", "OUT", "INOUT":
+					fields = fields[1:]
+				}
+				if len(fields) > 0 {
+					names = append(names, fields[0])
+				}
+			}
+			if c == ')' {
+				return names
+			}
+			start = i + 1
+		}
+	}
+	return names
+}
@@ -0,0 +1,26 @@
+-- Migrates permission levels stored before project roles were introduced (see modules/config/permissions.go).
+--
+-- Every stored level must now be the level of a role: read (1), write (4), admin (8) or owner (10). Levels in between
+-- are rounded down to the role below them, so that nobody gains access they did not have. Owners are tracked by
+-- Project.Owner rather than by grants, so granted levels are capped at admin, and grants below read are removed.
+-- The script can be run repeatedly.
+
+START TRANSACTION;
+
+DELETE FROM `Permissions` WHERE `PermissionLevel` < 1;
+UPDATE `Permissions` SET `PermissionLevel` = CASE
+    WHEN `PermissionLevel` >= 8 THEN 8
+    WHEN `PermissionLevel` >= 4 THEN 4
+    ELSE 1
+  END
+WHERE `PermissionLevel` NOT IN (1, 4, 8);
+
+DELETE FROM `TeamPermissions` WHERE `PermissionLevel` < 1;
+UPDATE `TeamPermissions` SET `PermissionLevel` = CASE
+    WHEN `PermissionLevel` >= 8 THEN 8
+    WHEN `PermissionLevel` >= 4 THEN 4
+    ELSE 1
+  END
+WHERE `PermissionLevel` NOT IN (1, 4, 8);
+
+COMMIT;
@@ -0,0 +1,69 @@
+-- Adds the IdempotentRequest table, which records the outcomes of requests made with an IdempotencyKey, so that
+-- retried requests are answered with the original outcome (see modules/datahandling/idempotency.go).
+
+CREATE TABLE IF NOT EXISTS `IdempotentRequest` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `IdempotencyKey` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Method` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Status` int(11) NOT NULL,
+  `Response` mediumtext COLLATE utf8_unicode_ci NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Username`,`IdempotencyKey`),
+  KEY `idx_IdempotentRequest_Created` (`Created`),
+  CONSTRAINT `fk_IdempotentRequest_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `idempotent_request_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_get`(IN username varchar(25),
+                                                                     IN idempotencyKey varchar(64),
+                                                                     IN validSeconds int)
+  BEGIN
+    SELECT Method, Status, Response, Created
+    FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey
+      AND IdempotentRequest.Created > DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `idempotent_request_release`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_release`(IN username varchar(25),
+                                                                         IN idempotencyKey varchar(64))
+  BEGIN
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `idempotent_request_reserve`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_reserve`(IN username varchar(25),
+                                                                         IN idempotencyKey varchar(64),
+                                                                         IN method varchar(64),
+                                                                         IN validSeconds int)
+  BEGIN
+    -- Outcomes are only looked up within the validity period, so the user's expired ones are cleaned up here
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.Created <= DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+    INSERT IGNORE INTO IdempotentRequest (Username, IdempotencyKey, Method, Status, Response)
+    VALUES (username, idempotencyKey, method, 0, '');
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `idempotent_request_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_set`(IN username varchar(25),
+                                                                     IN idempotencyKey varchar(64),
+                                                                     IN status int,
+                                                                     IN response mediumtext)
+  BEGIN
+    UPDATE IdempotentRequest
+    SET IdempotentRequest.Status = status, IdempotentRequest.Response = response
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey;
+  END ;;
+DELIMITER ;
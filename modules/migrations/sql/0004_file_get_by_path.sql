@@ -0,0 +1,16 @@
+-- Adds file_get_by_path, which finds the file at a path in a project, so that moves and renames can be checked for
+-- collisions with other files.
+
+DROP PROCEDURE IF EXISTS `file_get_by_path`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_by_path`(IN projectID bigint(20),
+                                                               IN relativePath varchar(2083),
+                                                               IN filename varchar(50))
+  BEGIN
+    SELECT `File`.`FileID`, `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
+    FROM File
+    WHERE `File`.`ProjectID` = projectID
+      AND `File`.`RelativePath` = relativePath
+      AND `File`.`Filename` = filename;
+  END ;;
+DELIMITER ;
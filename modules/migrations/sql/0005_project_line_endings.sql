@@ -0,0 +1,35 @@
+-- Adds the ProjectLineEndings table, which holds the line-ending policy of projects that don't preserve their files'
+-- line endings as written (see modules/datahandling/lineendings.go).
+
+CREATE TABLE IF NOT EXISTS `ProjectLineEndings` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Policy` varchar(16) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectLineEndings_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `project_line_endings_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_line_endings_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Policy
+    FROM ProjectLineEndings
+    WHERE ProjectLineEndings.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_line_endings_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_line_endings_set`(IN projectID bigint(20), IN policy varchar(16))
+  BEGIN
+    IF policy = 'Preserve' THEN
+      DELETE FROM ProjectLineEndings
+      WHERE ProjectLineEndings.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectLineEndings (ProjectID, Policy)
+      VALUES (projectID, policy)
+      ON DUPLICATE KEY UPDATE
+        Policy = policy;
+    END IF;
+  END ;;
+DELIMITER ;
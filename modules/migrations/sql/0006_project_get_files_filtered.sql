@@ -0,0 +1,17 @@
+-- Adds project_get_files_filtered, which lists the files in a directory of a project, and its subdirectories, whose
+-- names match a LIKE pattern, so that clients opening one folder of a large project aren't sent every file in it.
+
+DROP PROCEDURE IF EXISTS `project_get_files_filtered`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_files_filtered`(IN projectID bigint(20),
+                                                                        IN directory varchar(2083),
+                                                                        IN subdirectories varchar(2083),
+                                                                        IN filenames varchar(255))
+  BEGIN
+    SELECT `File`.`FileID`, `File`.`Creator`, `File`.`CreationDate`, `File`.`RelativePath`, `File`.`ProjectID`, `File`.`Filename`
+    FROM File
+    WHERE `File`.`ProjectID` = projectID
+      AND (directory = '' OR `File`.`RelativePath` = directory OR `File`.`RelativePath` LIKE subdirectories)
+      AND `File`.`Filename` LIKE filenames;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,35 @@
+-- Adds the ProjectIgnoreRules table, which holds the rules for files that are kept out of projects, in the format of a
+-- .ccignore file (see modules/datahandling/ignorerules.go).
+
+CREATE TABLE IF NOT EXISTS `ProjectIgnoreRules` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Rules` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectIgnoreRules_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `project_ignore_rules_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_ignore_rules_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Rules
+    FROM ProjectIgnoreRules
+    WHERE ProjectIgnoreRules.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_ignore_rules_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_ignore_rules_set`(IN projectID bigint(20), IN rules text)
+  BEGIN
+    IF rules = '' THEN
+      DELETE FROM ProjectIgnoreRules
+      WHERE ProjectIgnoreRules.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectIgnoreRules (ProjectID, Rules)
+      VALUES (projectID, rules)
+      ON DUPLICATE KEY UPDATE
+        Rules = rules;
+    END IF;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,50 @@
+-- Adds the AuditLog table, an append-only record of logins, token and password changes, permission changes and admin
+-- requests (see modules/datahandling/audit.go). It has no foreign keys, so that entries outlive the users and projects
+-- they are about.
+
+CREATE TABLE IF NOT EXISTS `AuditLog` (
+  `AuditID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `Time` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Event` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Actor` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `ProjectID` bigint(20) NOT NULL DEFAULT '0',
+  `Status` int(11) NOT NULL,
+  `Details` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`AuditID`),
+  KEY `idx_AuditLog_Time` (`Time`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `audit_log_append`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_append`(IN event varchar(64),
+                                                               IN actor varchar(25),
+                                                               IN projectID bigint(20),
+                                                               IN status int(11),
+                                                               IN details text)
+  BEGIN
+    INSERT INTO AuditLog (Event, Actor, ProjectID, Status, Details)
+    VALUES (event, actor, projectID, status, details);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `audit_log_query`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_query`(IN sinceTime bigint(20),
+                                                              IN untilTime bigint(20),
+                                                              IN afterAuditID bigint(20),
+                                                              IN event varchar(64),
+                                                              IN actor varchar(25),
+                                                              IN maxEntries int(11))
+  BEGIN
+    SELECT AuditLog.AuditID, UNIX_TIMESTAMP(AuditLog.Time), AuditLog.Event, AuditLog.Actor, AuditLog.ProjectID,
+      AuditLog.Status, AuditLog.Details
+    FROM AuditLog
+    WHERE AuditLog.Time >= FROM_UNIXTIME(sinceTime)
+      AND AuditLog.Time < FROM_UNIXTIME(untilTime)
+      AND AuditLog.AuditID > afterAuditID
+      AND (event = '' OR AuditLog.Event = event)
+      AND (actor = '' OR AuditLog.Actor = actor)
+    ORDER BY AuditLog.AuditID
+    LIMIT maxEntries;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,41 @@
+-- Records the IP address each audited request came from (see modules/datahandling/clientaddr.go). Entries from
+-- before this migration have an empty address.
+
+ALTER TABLE `AuditLog`
+  ADD COLUMN `RemoteAddr` varchar(45) COLLATE utf8_unicode_ci NOT NULL DEFAULT '' AFTER `Actor`;
+
+DROP PROCEDURE IF EXISTS `audit_log_append`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_append`(IN event varchar(64),
+                                                               IN actor varchar(25),
+                                                               IN remoteAddr varchar(45),
+                                                               IN projectID bigint(20),
+                                                               IN status int(11),
+                                                               IN details text)
+  BEGIN
+    INSERT INTO AuditLog (Event, Actor, RemoteAddr, ProjectID, Status, Details)
+    VALUES (event, actor, remoteAddr, projectID, status, details);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `audit_log_query`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `audit_log_query`(IN sinceTime bigint(20),
+                                                              IN untilTime bigint(20),
+                                                              IN afterAuditID bigint(20),
+                                                              IN event varchar(64),
+                                                              IN actor varchar(25),
+                                                              IN maxEntries int(11))
+  BEGIN
+    SELECT AuditLog.AuditID, UNIX_TIMESTAMP(AuditLog.Time), AuditLog.Event, AuditLog.Actor, AuditLog.RemoteAddr,
+      AuditLog.ProjectID, AuditLog.Status, AuditLog.Details
+    FROM AuditLog
+    WHERE AuditLog.Time >= FROM_UNIXTIME(sinceTime)
+      AND AuditLog.Time < FROM_UNIXTIME(untilTime)
+      AND AuditLog.AuditID > afterAuditID
+      AND (event = '' OR AuditLog.Event = event)
+      AND (actor = '' OR AuditLog.Actor = actor)
+    ORDER BY AuditLog.AuditID
+    LIMIT maxEntries;
+  END ;;
+DELIMITER ;
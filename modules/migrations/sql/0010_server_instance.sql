@@ -0,0 +1,79 @@
+-- Adds the ServerInstance table, the registry of running servers that each server keeps its own row of up to date
+-- (see modules/datahandling/instances.go). Draining is set by admins, and read back by the server on its next
+-- heartbeat.
+
+CREATE TABLE IF NOT EXISTS `ServerInstance` (
+  `InstanceID` varchar(32) COLLATE utf8_unicode_ci NOT NULL,
+  `Name` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `Host` varchar(255) COLLATE utf8_unicode_ci NOT NULL,
+  `Version` varchar(64) COLLATE utf8_unicode_ci NOT NULL,
+  `StartedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastHeartbeat` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Connections` int(11) NOT NULL DEFAULT '0',
+  `Draining` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`InstanceID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `server_instance_heartbeat`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_heartbeat`(IN instanceID varchar(32),
+                                                                        IN name varchar(64),
+                                                                        IN host varchar(255),
+                                                                        IN version varchar(64),
+                                                                        IN startedAt bigint(20),
+                                                                        IN connections int(11),
+                                                                        IN forgetBefore bigint(20))
+  BEGIN
+    INSERT INTO ServerInstance (InstanceID, Name, Host, Version, StartedAt, Connections)
+    VALUES (instanceID, name, host, version, FROM_UNIXTIME(startedAt), connections)
+    ON DUPLICATE KEY UPDATE
+      Name = name,
+      Host = host,
+      Version = version,
+      LastHeartbeat = CURRENT_TIMESTAMP,
+      Connections = connections;
+
+    DELETE FROM ServerInstance
+    WHERE ServerInstance.LastHeartbeat < FROM_UNIXTIME(forgetBefore);
+
+    SELECT Draining
+    FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `server_instance_list`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_list`()
+  BEGIN
+    SELECT InstanceID, Name, Host, Version, UNIX_TIMESTAMP(StartedAt), UNIX_TIMESTAMP(LastHeartbeat), Connections,
+      Draining
+    FROM ServerInstance
+    ORDER BY Name, InstanceID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `server_instance_set_draining`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_set_draining`(IN instanceID varchar(32),
+                                                                           IN draining tinyint(1))
+  BEGIN
+    UPDATE ServerInstance
+    SET ServerInstance.Draining = draining
+    WHERE ServerInstance.InstanceID = instanceID;
+
+    -- Rows whose Draining is already set are not counted as affected
+    SELECT COUNT(*)
+    FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `server_instance_delete`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_instance_delete`(IN instanceID varchar(32))
+  BEGIN
+    DELETE FROM ServerInstance
+    WHERE ServerInstance.InstanceID = instanceID;
+  END ;;
+DELIMITER ;
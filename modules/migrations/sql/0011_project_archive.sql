@@ -0,0 +1,37 @@
+-- Adds the ProjectArchive table, which holds the state of projects that are archived, or being archived or unarchived
+-- (see modules/datahandling/archive.go). Projects without a row are live.
+
+CREATE TABLE IF NOT EXISTS `ProjectArchive` (
+  `ProjectID` bigint(20) NOT NULL,
+  `State` varchar(16) COLLATE utf8_unicode_ci NOT NULL,
+  `Since` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectArchive_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `project_archive_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_archive_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT State
+    FROM ProjectArchive
+    WHERE ProjectArchive.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_archive_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_archive_set`(IN projectID bigint(20), IN state varchar(16))
+  BEGIN
+    IF state = '' THEN
+      DELETE FROM ProjectArchive
+      WHERE ProjectArchive.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectArchive (ProjectID, State)
+      VALUES (projectID, state)
+      ON DUPLICATE KEY UPDATE
+        State = state,
+        Since = CURRENT_TIMESTAMP;
+    END IF;
+  END ;;
+DELIMITER ;
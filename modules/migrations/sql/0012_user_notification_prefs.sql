@@ -0,0 +1,39 @@
+-- Adds the UserNotificationPrefs table, which holds the projects and events each user has muted (see
+-- modules/datahandling/notificationprefs.go). Users without a row receive every notification.
+
+CREATE TABLE IF NOT EXISTS `UserNotificationPrefs` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `MutedProjects` text COLLATE utf8_unicode_ci NOT NULL,
+  `MutedEvents` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`Username`),
+  CONSTRAINT `fk_UserNotificationPrefs_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `user_notification_prefs_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_notification_prefs_get`(IN username varchar(25))
+  BEGIN
+    SELECT MutedProjects, MutedEvents
+    FROM UserNotificationPrefs
+    WHERE UserNotificationPrefs.Username = username;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_notification_prefs_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_notification_prefs_set`(IN username varchar(25),
+                                                                          IN mutedProjects text,
+                                                                          IN mutedEvents text)
+  BEGIN
+    IF mutedProjects = '[]' AND mutedEvents = '[]' THEN
+      DELETE FROM UserNotificationPrefs
+      WHERE UserNotificationPrefs.Username = username;
+    ELSE
+      INSERT INTO UserNotificationPrefs (Username, MutedProjects, MutedEvents)
+      VALUES (username, mutedProjects, mutedEvents)
+      ON DUPLICATE KEY UPDATE
+        MutedProjects = mutedProjects,
+        MutedEvents = mutedEvents;
+    END IF;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,53 @@
+-- Adds files_create, which creates many files in a single call, for imports. MySQL has no table-valued parameters, so
+-- the files are passed as a JSON array of objects with Creator, ProjectID, RelativePath, Filename and Size.
+
+DROP PROCEDURE IF EXISTS `files_create`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `files_create`(IN files json)
+  BEGIN
+    DECLARE i int DEFAULT 0;
+    DECLARE creator varchar(25);
+    DECLARE projectID bigint(20);
+    DECLARE relativePath varchar(2083);
+    DECLARE filename varchar(50);
+    DECLARE size bigint(20);
+    DECLARE newFileID bigint(20);
+
+    DROP TEMPORARY TABLE IF EXISTS `FilesCreated`;
+    CREATE TEMPORARY TABLE `FilesCreated` (
+      `Idx` int NOT NULL,
+      `FileID` bigint(20) DEFAULT NULL,
+      PRIMARY KEY (`Idx`)
+    );
+
+    WHILE i < JSON_LENGTH(files) DO
+      SET creator = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].Creator')));
+      SET projectID = JSON_EXTRACT(files, CONCAT('$[', i, '].ProjectID'));
+      SET relativePath = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].RelativePath')));
+      SET filename = JSON_UNQUOTE(JSON_EXTRACT(files, CONCAT('$[', i, '].Filename')));
+      SET size = JSON_EXTRACT(files, CONCAT('$[', i, '].Size'));
+
+      IF ( NOT EXISTS ( SELECT `File`.`FileID`
+                        FROM `File`
+                        WHERE `File`.`ProjectID` = projectID AND `File`.`RelativePath` = relativePath AND `File`.`Filename` = filename ) ) THEN
+        INSERT INTO `File` (Creator, RelativePath, ProjectID, Filename)
+        VALUES (creator, relativePath, projectID, filename);
+        SET newFileID = LAST_INSERT_ID();
+        INSERT INTO FileSize (FileID, Bytes)
+        VALUES (newFileID, GREATEST(size, 0));
+        INSERT INTO `FilesCreated` (Idx, FileID)
+        VALUES (i, newFileID);
+      ELSE
+        -- Files that already exist are left as they are
+        INSERT INTO `FilesCreated` (Idx, FileID)
+        VALUES (i, NULL);
+      END IF;
+      SET i = i + 1;
+    END WHILE;
+
+    SELECT `FilesCreated`.`FileID`
+    FROM `FilesCreated`
+    ORDER BY `FilesCreated`.`Idx`;
+    DROP TEMPORARY TABLE `FilesCreated`;
+  END ;;
+DELIMITER ;
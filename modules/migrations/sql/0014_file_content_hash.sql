@@ -0,0 +1,45 @@
+-- Adds the FileContentHash table, which holds the SHA-256 of each file's text at the latest version it has been
+-- computed for (see modules/datahandling/contenthash.go). Files without a row haven't been hashed yet.
+
+CREATE TABLE IF NOT EXISTS `FileContentHash` (
+  `FileID` bigint(20) NOT NULL,
+  `Version` bigint(20) NOT NULL,
+  `Hash` char(64) COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`FileID`),
+  CONSTRAINT `fk_FileContentHash_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `file_content_hash_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_content_hash_get`(IN fileID bigint(20))
+  BEGIN
+    SELECT Version, Hash
+    FROM FileContentHash
+    WHERE FileContentHash.FileID = fileID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `file_content_hash_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_content_hash_set`(IN fileID bigint(20), IN version bigint(20),
+                                                                     IN hash char(64))
+  BEGIN
+    -- Hashes of earlier versions, from servers that fell behind, don't replace later ones
+    INSERT INTO FileContentHash (FileID, Version, Hash)
+    VALUES (fileID, version, hash)
+    ON DUPLICATE KEY UPDATE
+      Hash = IF(version >= FileContentHash.Version, hash, FileContentHash.Hash),
+      Version = GREATEST(version, FileContentHash.Version);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_get_file_content_hashes`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_file_content_hashes`(IN projectID bigint(20))
+  BEGIN
+    SELECT FileContentHash.FileID, Version, Hash
+    FROM FileContentHash
+    JOIN `File` ON `File`.FileID = FileContentHash.FileID
+    WHERE `File`.ProjectID = projectID;
+  END ;;
+DELIMITER ;
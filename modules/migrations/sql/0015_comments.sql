@@ -0,0 +1,86 @@
+-- Adds the Comment table, which holds comment threads on ranges of files' text (see
+-- modules/datahandling/commentrequests.go). Threads start with a comment anchored to a range of the file at a version;
+-- replies have the CommentID of the comment that started the thread as their ThreadID, and no anchor of their own.
+
+CREATE TABLE IF NOT EXISTS `Comment` (
+  `CommentID` bigint(20) NOT NULL AUTO_INCREMENT,
+  `ThreadID` bigint(20) DEFAULT NULL,
+  `FileID` bigint(20) NOT NULL,
+  `Author` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Body` text COLLATE utf8_unicode_ci NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Version` bigint(20) NOT NULL DEFAULT '0',
+  `StartOffset` int(11) NOT NULL DEFAULT '0',
+  `EndOffset` int(11) NOT NULL DEFAULT '0',
+  `Outdated` tinyint(1) NOT NULL DEFAULT '0',
+  `ResolvedBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`CommentID`),
+  KEY `fk_Comment_ThreadID_idx` (`ThreadID`),
+  KEY `fk_Comment_FileID_idx` (`FileID`),
+  KEY `fk_Comment_Author_idx` (`Author`),
+  CONSTRAINT `fk_Comment_ThreadID` FOREIGN KEY (`ThreadID`) REFERENCES `Comment` (`CommentID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_Comment_FileID` FOREIGN KEY (`FileID`) REFERENCES `File` (`FileID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_Comment_Author` FOREIGN KEY (`Author`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `comment_create`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_create`(IN threadID bigint(20), IN fileID bigint(20),
+                                                             IN author varchar(25), IN body text,
+                                                             IN version bigint(20), IN startOffset int(11),
+                                                             IN endOffset int(11))
+  BEGIN
+    INSERT INTO Comment (ThreadID, FileID, Author, Body, Version, StartOffset, EndOffset)
+    VALUES (NULLIF(threadID, 0), fileID, author, body, version, startOffset, endOffset);
+    SELECT LAST_INSERT_ID();
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `comment_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_get`(IN commentID bigint(20))
+  BEGIN
+    SELECT Comment.CommentID, COALESCE(Comment.ThreadID, Comment.CommentID), Comment.FileID, Comment.Author,
+      Comment.Body, UNIX_TIMESTAMP(Comment.Created), Comment.Version, Comment.StartOffset, Comment.EndOffset,
+      Comment.Outdated, Comment.ResolvedBy
+    FROM Comment
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `comment_set_anchor`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_set_anchor`(IN commentID bigint(20), IN version bigint(20),
+                                                                 IN startOffset int(11), IN endOffset int(11),
+                                                                 IN outdated tinyint(1))
+  BEGIN
+    UPDATE Comment
+    SET Comment.Version = version, Comment.StartOffset = startOffset, Comment.EndOffset = endOffset,
+      Comment.Outdated = outdated
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `comment_set_resolved`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_set_resolved`(IN commentID bigint(20),
+                                                                   IN resolvedBy varchar(25))
+  BEGIN
+    UPDATE Comment
+    SET Comment.ResolvedBy = resolvedBy
+    WHERE Comment.CommentID = commentID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `file_get_comments`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_comments`(IN fileID bigint(20))
+  BEGIN
+    SELECT Comment.CommentID, COALESCE(Comment.ThreadID, Comment.CommentID), Comment.FileID, Comment.Author,
+      Comment.Body, UNIX_TIMESTAMP(Comment.Created), Comment.Version, Comment.StartOffset, Comment.EndOffset,
+      Comment.Outdated, Comment.ResolvedBy
+    FROM Comment
+    WHERE Comment.FileID = fileID
+    ORDER BY Comment.CommentID;
+  END ;;
+DELIMITER ;
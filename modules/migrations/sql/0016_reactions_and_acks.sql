@@ -0,0 +1,78 @@
+-- Adds the NotificationAck table, which holds the sequence number of the last of each project's notifications each
+-- user has seen, and the CommentReaction table, which holds users' reactions to comments (see
+-- modules/datahandling/reactions.go). Reactions are usually emoji, so they are stored as utf8mb4.
+
+CREATE TABLE IF NOT EXISTS `NotificationAck` (
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `ProjectID` bigint(20) NOT NULL,
+  `Sequence` bigint(20) NOT NULL,
+  `Acked` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Username`,`ProjectID`),
+  KEY `fk_NotificationAck_ProjectID_idx` (`ProjectID`),
+  CONSTRAINT `fk_NotificationAck_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_NotificationAck_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS `CommentReaction` (
+  `CommentID` bigint(20) NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Reaction` varchar(16) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+  `Created` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`CommentID`,`Username`,`Reaction`),
+  KEY `fk_CommentReaction_Username_idx` (`Username`),
+  CONSTRAINT `fk_CommentReaction_CommentID` FOREIGN KEY (`CommentID`) REFERENCES `Comment` (`CommentID`) ON DELETE CASCADE ON UPDATE CASCADE,
+  CONSTRAINT `fk_CommentReaction_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `comment_reaction_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `comment_reaction_set`(IN commentID bigint(20), IN username varchar(25),
+                                                                   IN reaction varchar(16) CHARACTER SET utf8mb4,
+                                                                   IN remove tinyint(1))
+  BEGIN
+    IF remove THEN
+      DELETE FROM CommentReaction
+      WHERE CommentReaction.CommentID = commentID AND CommentReaction.Username = username
+        AND CommentReaction.Reaction = reaction;
+    ELSE
+      INSERT IGNORE INTO CommentReaction (CommentID, Username, Reaction)
+      VALUES (commentID, username, reaction);
+    END IF;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `file_get_comment_reactions`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_get_comment_reactions`(IN fileID bigint(20))
+  BEGIN
+    SELECT CommentReaction.CommentID, CommentReaction.Username, CommentReaction.Reaction
+    FROM CommentReaction
+    JOIN Comment ON Comment.CommentID = CommentReaction.CommentID
+    WHERE Comment.FileID = fileID
+    ORDER BY CommentReaction.CommentID, CommentReaction.Created, CommentReaction.Username;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `notification_ack`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `notification_ack`(IN username varchar(25), IN projectID bigint(20),
+                                                               IN sequence bigint(20))
+  BEGIN
+    -- Acks that arrive out of order don't take the user's place back
+    INSERT INTO NotificationAck (Username, ProjectID, Sequence)
+    VALUES (username, projectID, sequence)
+    ON DUPLICATE KEY UPDATE
+      Sequence = GREATEST(sequence, NotificationAck.Sequence);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_get_notification_acks`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_notification_acks`(IN projectID bigint(20))
+  BEGIN
+    SELECT NotificationAck.Username, NotificationAck.Sequence, UNIX_TIMESTAMP(NotificationAck.Acked)
+    FROM NotificationAck
+    WHERE NotificationAck.ProjectID = projectID
+    ORDER BY NotificationAck.Username;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,59 @@
+-- Adds prefix search of users (see User.Search in modules/datahandling/userrequests.go). Users who are Unlisted are
+-- only found by their exact username. Usernames and emails are already indexed; names are indexed here.
+
+ALTER TABLE `User`
+  ADD COLUMN `Unlisted` tinyint(1) NOT NULL DEFAULT '0' AFTER `EmailVerified`,
+  ADD KEY `FirstName_INDEX` (`FirstName`),
+  ADD KEY `LastName_INDEX` (`LastName`);
+
+DROP PROCEDURE IF EXISTS `user_lookup`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_lookup`(IN username varchar(25))
+  BEGIN
+    SELECT FirstName, LastName, Email, Username, EmailVerified, Unlisted
+    FROM User where User.Username = username;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_search`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_search`(IN username varchar(25), IN pattern varchar(101),
+                                                          IN maxResults int(11))
+  BEGIN
+    -- Each prefix is matched separately, so that each match can use its column's index
+    SELECT Matches.Username, Matches.FirstName, Matches.LastName
+    FROM (
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Username = username
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.Username LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.Email LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.FirstName LIKE pattern
+      UNION
+      SELECT User.Username, User.FirstName, User.LastName
+      FROM User
+      WHERE User.Unlisted = 0 AND User.LastName LIKE pattern
+    ) AS Matches
+    ORDER BY Matches.Username = username DESC, Matches.Username
+    LIMIT maxResults;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_set_unlisted`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_unlisted`(IN username varchar(25), IN unlisted tinyint(1))
+  BEGIN
+    UPDATE User
+    SET User.Unlisted = unlisted
+    WHERE User.Username = username;
+  END ;;
+DELIMITER ;
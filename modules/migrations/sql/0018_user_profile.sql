@@ -0,0 +1,35 @@
+-- Adds users' avatars (see User.SetAvatar in modules/datahandling/userrequests.go). The images are kept with the file
+-- contents; AvatarHash is the SHA-256 of the user's current one, or empty if they have none, and is used as its ETag.
+
+ALTER TABLE `User`
+  ADD COLUMN `AvatarHash` char(64) COLLATE utf8_unicode_ci NOT NULL DEFAULT '' AFTER `Unlisted`;
+
+DROP PROCEDURE IF EXISTS `user_lookup`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_lookup`(IN username varchar(25))
+  BEGIN
+    SELECT FirstName, LastName, Email, Username, EmailVerified, Unlisted, AvatarHash
+    FROM User where User.Username = username;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_set_avatar`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_avatar`(IN username varchar(25), IN avatarHash char(64))
+  BEGIN
+    UPDATE User
+    SET User.AvatarHash = avatarHash
+    WHERE User.Username = username;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_update_profile`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_update_profile`(IN username varchar(25), IN firstName varchar(30),
+                                                                  IN lastName varchar(30))
+  BEGIN
+    UPDATE User
+    SET User.FirstName = firstName, User.LastName = lastName
+    WHERE User.Username = username;
+  END ;;
+DELIMITER ;
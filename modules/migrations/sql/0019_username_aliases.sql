@@ -0,0 +1,92 @@
+-- Lets users change their usernames (see User.ChangeUsername in modules/datahandling/userrequests.go). Every foreign
+-- key to User.Username already cascades on update, so renaming the User row renames the user's permissions, files,
+-- projects, teams and tokens with it; the names recorded without a foreign key, of who granted access, added team
+-- members and resolved comments, are renamed by user_change_username itself. The audit log keeps the names actions
+-- were taken under.
+--
+-- Each name a user had is kept in UsernameAlias, pointing to their current one, so that session tokens issued to the
+-- old name and authors recorded in stored patches still resolve. Aliases can't be registered by anyone else, and are
+-- removed with their user.
+
+CREATE TABLE `UsernameAlias` (
+  `Alias` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `CreatedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`Alias`),
+  KEY `fk_UsernameAlias_Username_idx` (`Username`),
+  CONSTRAINT `fk_UsernameAlias_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `user_register`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_register`(IN username varchar(25),
+                                                            IN pass varchar(100),
+                                                            IN email varchar(50),
+                                                            IN firstName varchar(30),
+                                                            IN lastName varchar(30))
+  BEGIN
+    INSERT INTO User (Username, Password, Email, FirstName, LastName)
+    SELECT username, pass, email, firstName, lastName
+    FROM DUAL
+    WHERE NOT EXISTS (SELECT 1 FROM UsernameAlias WHERE UsernameAlias.Alias = username);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_change_username`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_change_username`(IN oldUsername varchar(25),
+                                                                   IN newUsername varchar(25))
+  BEGIN
+    UPDATE Permissions
+    SET Permissions.GrantedBy = newUsername
+    WHERE Permissions.GrantedBy = oldUsername;
+
+    UPDATE TeamPermissions
+    SET TeamPermissions.GrantedBy = newUsername
+    WHERE TeamPermissions.GrantedBy = oldUsername;
+
+    UPDATE TeamMember
+    SET TeamMember.AddedBy = newUsername
+    WHERE TeamMember.AddedBy = oldUsername;
+
+    UPDATE Comment
+    SET Comment.ResolvedBy = newUsername
+    WHERE Comment.ResolvedBy = oldUsername;
+
+    UPDATE User
+    SET User.Username = newUsername
+    WHERE User.Username = oldUsername;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `username_alias_add`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_add`(IN alias varchar(25), IN username varchar(25))
+  BEGIN
+    DELETE FROM UsernameAlias
+    WHERE UsernameAlias.Alias = username;
+
+    INSERT INTO UsernameAlias (Alias, Username)
+    VALUES (alias, username);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `username_alias_resolve`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_resolve`(IN alias varchar(25))
+  BEGIN
+    SELECT Username
+    FROM UsernameAlias
+    WHERE UsernameAlias.Alias = alias;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `username_taken`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_taken`(IN username varchar(25), IN exceptUsername varchar(25))
+  BEGIN
+    SELECT (SELECT COUNT(*) FROM User WHERE User.Username = username) +
+           (SELECT COUNT(*) FROM UsernameAlias
+            WHERE UsernameAlias.Alias = username AND UsernameAlias.Username <> exceptUsername);
+  END ;;
+DELIMITER ;
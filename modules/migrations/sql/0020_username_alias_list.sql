@@ -0,0 +1,13 @@
+-- Lists the usernames a user had, for User.ExportData and for erasing the authorship of the patches they made under
+-- them when they are deleted (see modules/datahandling/userdata.go).
+
+DROP PROCEDURE IF EXISTS `username_alias_list`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `username_alias_list`(IN username varchar(25))
+  BEGIN
+    SELECT Alias
+    FROM UsernameAlias
+    WHERE UsernameAlias.Username = username
+    ORDER BY UsernameAlias.CreatedAt, UsernameAlias.Alias;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,116 @@
+-- Adds the UserSession table, which records each connection users make authenticated requests on, so that they can
+-- list and revoke them (see modules/datahandling/usersessions.go). Rows are removed when their connection closes,
+-- except for those of revoked sessions, which are kept until their token expires so that it keeps being refused.
+-- session_touch now keeps the connection's row from being forgotten as well.
+
+CREATE TABLE IF NOT EXISTS `UserSession` (
+  `SessionID` char(32) COLLATE utf8_unicode_ci NOT NULL,
+  `Username` varchar(25) COLLATE utf8_unicode_ci NOT NULL,
+  `WebsocketID` bigint(20) NOT NULL,
+  `InstanceID` varchar(32) COLLATE utf8_unicode_ci NOT NULL,
+  `RemoteAddr` varchar(45) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `Device` varchar(255) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `TokenHash` char(64) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `TokenExpires` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `ConnectedAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastActive` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `LastHeartbeat` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  `Revoked` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`SessionID`,`Username`),
+  KEY `fk_UserSession_Username_idx` (`Username`),
+  KEY `idx_UserSession_TokenHash` (`TokenHash`),
+  CONSTRAINT `fk_UserSession_Username` FOREIGN KEY (`Username`) REFERENCES `User` (`Username`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `user_session_record`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_record`(IN sessionID char(32),
+                                                                  IN username varchar(25),
+                                                                  IN websocketID bigint(20),
+                                                                  IN instanceID varchar(32),
+                                                                  IN remoteAddr varchar(45),
+                                                                  IN device varchar(255),
+                                                                  IN tokenHash char(64),
+                                                                  IN tokenExpires bigint(20),
+                                                                  IN forgetBefore bigint(20))
+  BEGIN
+    INSERT INTO UserSession (SessionID, Username, WebsocketID, InstanceID, RemoteAddr, Device, TokenHash, TokenExpires)
+    VALUES (sessionID, username, websocketID, instanceID, remoteAddr, device, tokenHash, FROM_UNIXTIME(tokenExpires))
+    ON DUPLICATE KEY UPDATE
+      RemoteAddr = remoteAddr,
+      Device = device,
+      TokenHash = tokenHash,
+      TokenExpires = FROM_UNIXTIME(tokenExpires),
+      LastActive = CURRENT_TIMESTAMP,
+      LastHeartbeat = CURRENT_TIMESTAMP;
+
+    -- Rows of connections on servers that stopped without removing them, and of revoked sessions whose token expired
+    DELETE FROM UserSession
+    WHERE UserSession.Username = username
+      AND ((UserSession.Revoked = 0 AND UserSession.LastHeartbeat < FROM_UNIXTIME(forgetBefore))
+        OR (UserSession.Revoked = 1 AND UserSession.TokenExpires < CURRENT_TIMESTAMP));
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_session_list`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_list`(IN username varchar(25),
+                                                                IN activeSince bigint(20))
+  BEGIN
+    SELECT SessionID, WebsocketID, InstanceID, RemoteAddr, Device, TokenHash, UNIX_TIMESTAMP(TokenExpires),
+      UNIX_TIMESTAMP(ConnectedAt), UNIX_TIMESTAMP(LastActive)
+    FROM UserSession
+    WHERE UserSession.Username = username
+      AND UserSession.Revoked = 0
+      AND UserSession.LastHeartbeat >= FROM_UNIXTIME(activeSince)
+    ORDER BY UserSession.LastActive DESC, UserSession.SessionID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_session_revoke`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_revoke`(IN sessionID char(32),
+                                                                  IN username varchar(25))
+  BEGIN
+    UPDATE UserSession
+    SET UserSession.Revoked = 1
+    WHERE UserSession.SessionID = sessionID
+      AND UserSession.Username = username
+      AND UserSession.Revoked = 0;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_session_token_revoked`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_token_revoked`(IN tokenHash char(64))
+  BEGIN
+    SELECT COUNT(*)
+    FROM UserSession
+    WHERE UserSession.TokenHash = tokenHash
+      AND UserSession.Revoked = 1;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_session_end`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_session_end`(IN sessionID char(32))
+  BEGIN
+    DELETE FROM UserSession
+    WHERE UserSession.SessionID = sessionID
+      AND UserSession.Revoked = 0;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `session_touch`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `session_touch`(IN sessionID char(32))
+  BEGIN
+    UPDATE SessionSubscription
+    SET LastSeen = CURRENT_TIMESTAMP
+    WHERE SessionSubscription.SessionID = sessionID;
+
+    UPDATE UserSession
+    SET LastHeartbeat = CURRENT_TIMESTAMP
+    WHERE UserSession.SessionID = sessionID;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,38 @@
+-- Adds the ServerMaintenance table, which holds whether the servers are in maintenance mode (see
+-- modules/datahandling/maintenance.go). It has at most one row, set by admins, and read by every server on its
+-- heartbeat.
+
+CREATE TABLE IF NOT EXISTS `ServerMaintenance` (
+  `MaintenanceID` tinyint(1) NOT NULL DEFAULT '1',
+  `Enabled` tinyint(1) NOT NULL DEFAULT '0',
+  `Message` varchar(1024) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `SetBy` varchar(25) COLLATE utf8_unicode_ci NOT NULL DEFAULT '',
+  `SetAt` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`MaintenanceID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `server_maintenance_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_maintenance_get`()
+  BEGIN
+    SELECT Enabled, Message, SetBy, UNIX_TIMESTAMP(SetAt)
+    FROM ServerMaintenance
+    WHERE ServerMaintenance.MaintenanceID = 1;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `server_maintenance_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `server_maintenance_set`(IN enabled tinyint(1),
+                                                                     IN message varchar(1024),
+                                                                     IN setBy varchar(25))
+  BEGIN
+    INSERT INTO ServerMaintenance (MaintenanceID, Enabled, Message, SetBy)
+    VALUES (1, enabled, message, setBy)
+    ON DUPLICATE KEY UPDATE
+      Enabled = enabled,
+      Message = message,
+      SetBy = setBy,
+      SetAt = CURRENT_TIMESTAMP;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,36 @@
+-- Adds the ChangeFeedCursor table, which holds the sequence number of the last of each project's notifications the
+-- change feed exported (see modules/datahandling/changefeed.go).
+
+CREATE TABLE IF NOT EXISTS `ChangeFeedCursor` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Sequence` bigint(20) NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ChangeFeedCursor_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `change_feed_cursor_advance`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `change_feed_cursor_advance`(IN projectID bigint(20),
+                                                                         IN fromSequence bigint(20),
+                                                                         IN toSequence bigint(20))
+  BEGIN
+    IF fromSequence = 0 THEN
+      INSERT IGNORE INTO ChangeFeedCursor (ProjectID, Sequence)
+      VALUES (projectID, toSequence);
+    ELSE
+      UPDATE ChangeFeedCursor
+      SET ChangeFeedCursor.Sequence = toSequence
+      WHERE ChangeFeedCursor.ProjectID = projectID AND ChangeFeedCursor.Sequence = fromSequence;
+    END IF;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `change_feed_cursor_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `change_feed_cursor_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT Sequence
+    FROM ChangeFeedCursor
+    WHERE ChangeFeedCursor.ProjectID = projectID;
+  END ;;
+DELIMITER ;
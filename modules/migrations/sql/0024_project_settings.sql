@@ -0,0 +1,43 @@
+-- Adds the ProjectSettings table, which holds the settings of projects that don't have a table of their own, as a JSON
+-- object, so that new settings don't need a migration (see modules/datahandling/projectsettings.go).
+
+CREATE TABLE IF NOT EXISTS `ProjectSettings` (
+  `ProjectID` bigint(20) NOT NULL,
+  `Settings` text COLLATE utf8_unicode_ci NOT NULL,
+  PRIMARY KEY (`ProjectID`),
+  CONSTRAINT `fk_ProjectSettings_ProjectID` FOREIGN KEY (`ProjectID`) REFERENCES `Project` (`ProjectID`) ON DELETE CASCADE ON UPDATE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+DROP PROCEDURE IF EXISTS `project_settings_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_settings_get`(IN projectID bigint(20))
+  BEGIN
+    SELECT
+      COALESCE(ProjectLineEndings.Policy, ''),
+      COALESCE(ProjectIgnoreRules.Rules, ''),
+      COALESCE(ProjectQuota.QuotaBytes, 0),
+      COALESCE(ProjectSettings.Settings, '{}')
+    FROM Project
+      LEFT JOIN ProjectLineEndings ON ProjectLineEndings.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectIgnoreRules ON ProjectIgnoreRules.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectQuota ON ProjectQuota.ProjectID = Project.ProjectID
+      LEFT JOIN ProjectSettings ON ProjectSettings.ProjectID = Project.ProjectID
+    WHERE Project.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_settings_set`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_settings_set`(IN projectID bigint(20), IN settings text)
+  BEGIN
+    IF settings = '{}' THEN
+      DELETE FROM ProjectSettings
+      WHERE ProjectSettings.ProjectID = projectID;
+    ELSE
+      INSERT INTO ProjectSettings (ProjectID, Settings)
+      VALUES (projectID, settings)
+      ON DUPLICATE KEY UPDATE
+        Settings = settings;
+    END IF;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,111 @@
+-- Adds ExternalID to projects and files: a random UUID that requests may name them by in place of their ProjectID or
+-- FileID, and that responses carry alongside those, since sequential IDs can be guessed, and collide between databases
+-- (see modules/datahandling/externalids.go). Every existing project and file is given one.
+
+DROP FUNCTION IF EXISTS `random_uuid`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` FUNCTION `random_uuid`() RETURNS char(36) CHARSET utf8
+    NO SQL
+  BEGIN
+    -- A version 4 UUID, from MySQL's cryptographically secure generator, rather than UUID(), which is based on the time
+    DECLARE bytes char(32) DEFAULT LOWER(HEX(RANDOM_BYTES(16)));
+    RETURN CONCAT_WS('-',
+      SUBSTR(bytes, 1, 8),
+      SUBSTR(bytes, 9, 4),
+      CONCAT('4', SUBSTR(bytes, 14, 3)),
+      CONCAT(SUBSTR('89ab', CONV(SUBSTR(bytes, 17, 1), 16, 10) % 4 + 1, 1), SUBSTR(bytes, 18, 3)),
+      SUBSTR(bytes, 21, 12));
+  END ;;
+DELIMITER ;
+
+ALTER TABLE `Project`
+  ADD COLUMN `ExternalID` char(36) COLLATE utf8_unicode_ci NOT NULL DEFAULT '' AFTER `Owner`;
+UPDATE `Project` SET `ExternalID` = random_uuid() WHERE `ExternalID` = '';
+ALTER TABLE `Project`
+  ADD UNIQUE KEY `ExternalID_UNIQUE` (`ExternalID`);
+
+ALTER TABLE `File`
+  ADD COLUMN `ExternalID` char(36) COLLATE utf8_unicode_ci NOT NULL DEFAULT '' AFTER `Filename`;
+UPDATE `File` SET `ExternalID` = random_uuid() WHERE `ExternalID` = '';
+ALTER TABLE `File`
+  ADD UNIQUE KEY `ExternalID_UNIQUE` (`ExternalID`);
+
+-- Rows copied from another database keep the ExternalID they were given there
+DROP TRIGGER IF EXISTS `Project_BEFORE_INSERT`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` TRIGGER `Project_BEFORE_INSERT` BEFORE INSERT ON `Project` FOR EACH ROW
+  BEGIN
+    IF NEW.ExternalID = '' THEN
+      SET NEW.ExternalID = random_uuid();
+    END IF;
+  END ;;
+DELIMITER ;
+
+DROP TRIGGER IF EXISTS `File_BEFORE_INSERT`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` TRIGGER `File_BEFORE_INSERT` BEFORE INSERT ON `File` FOR EACH ROW
+  BEGIN
+    IF NEW.ExternalID = '' THEN
+      SET NEW.ExternalID = random_uuid();
+    END IF;
+  END ;;
+DELIMITER ;
+
+-- Selected the columns of File by position
+DROP PROCEDURE IF EXISTS `project_get_files`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_get_files`(IN projectID bigint(20))
+  BEGIN
+    SELECT FileID, Creator, CreationDate, RelativePath, ProjectID, Filename
+    FROM File
+    WHERE File.ProjectID = projectID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `file_external_id_resolve`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_external_id_resolve`(IN externalID char(36))
+  BEGIN
+    SELECT FileID
+    FROM File
+    WHERE File.ExternalID = externalID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `file_external_ids_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `file_external_ids_get`(IN fileIDs text)
+  BEGIN
+    -- fileIDs is a comma-separated list, checked before it is made part of the query
+    IF fileIDs REGEXP '^[0-9]+(,[0-9]+)*$' THEN
+      SET @query = CONCAT('SELECT FileID, ExternalID FROM File WHERE FileID IN (', fileIDs, ')');
+      PREPARE statement FROM @query;
+      EXECUTE statement;
+      DEALLOCATE PREPARE statement;
+    END IF;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_external_id_resolve`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_external_id_resolve`(IN externalID char(36))
+  BEGIN
+    SELECT ProjectID
+    FROM Project
+    WHERE Project.ExternalID = externalID;
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `project_external_ids_get`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_external_ids_get`(IN projectIDs text)
+  BEGIN
+    -- projectIDs is a comma-separated list, checked before it is made part of the query
+    IF projectIDs REGEXP '^[0-9]+(,[0-9]+)*$' THEN
+      SET @query = CONCAT('SELECT ProjectID, ExternalID FROM Project WHERE ProjectID IN (', projectIDs, ')');
+      PREPARE statement FROM @query;
+      EXECUTE statement;
+      DEALLOCATE PREPARE statement;
+    END IF;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,22 @@
+-- Adds project_usage_report, which lists the projects using the most storage, with their quota overrides, for the
+-- admin quota report (see Admin.GetQuotaReport).
+
+DROP PROCEDURE IF EXISTS `project_usage_report`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `project_usage_report`(IN maxResults int)
+  BEGIN
+    SELECT
+      Project.ProjectID,
+      Project.Name,
+      Project.Owner,
+      COALESCE(SUM(FileSize.Bytes), 0) AS UsedBytes,
+      COALESCE(ProjectQuota.QuotaBytes, 0)
+    FROM Project
+      LEFT JOIN `File` ON `File`.ProjectID = Project.ProjectID
+      LEFT JOIN FileSize ON FileSize.FileID = `File`.FileID
+      LEFT JOIN ProjectQuota ON ProjectQuota.ProjectID = Project.ProjectID
+    GROUP BY Project.ProjectID, Project.Name, Project.Owner, ProjectQuota.QuotaBytes
+    ORDER BY UsedBytes DESC, Project.ProjectID
+    LIMIT maxResults;
+  END ;;
+DELIMITER ;
@@ -0,0 +1,26 @@
+-- Gives the reservations of idempotency keys a lease, so that a key reserved by a request that never finished, such as
+-- one on a server that crashed, can be taken over by a retry once the lease has passed. A reservation's Created time is
+-- when it was reserved (see modules/datahandling/idempotency.go).
+
+DROP PROCEDURE IF EXISTS `idempotent_request_reserve`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `idempotent_request_reserve`(IN username varchar(25),
+                                                                         IN idempotencyKey varchar(64),
+                                                                         IN method varchar(64),
+                                                                         IN validSeconds int,
+                                                                         IN leaseSeconds int)
+  BEGIN
+    -- Outcomes are only looked up within the validity period, so the user's expired ones are cleaned up here
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.Created <= DATE_SUB(NOW(), INTERVAL validSeconds SECOND);
+    -- A reservation whose lease has passed was made by a request that never finished, so it is taken over
+    DELETE FROM IdempotentRequest
+    WHERE IdempotentRequest.Username = username
+      AND IdempotentRequest.IdempotencyKey = idempotencyKey
+      AND IdempotentRequest.Status = 0
+      AND IdempotentRequest.Created <= DATE_SUB(NOW(), INTERVAL leaseSeconds SECOND);
+    INSERT IGNORE INTO IdempotentRequest (Username, IdempotencyKey, Method, Status, Response)
+    VALUES (username, idempotencyKey, method, 0, '');
+  END ;;
+DELIMITER ;
@@ -0,0 +1,30 @@
+-- Widens the User.Password column, and the password parameters of user_register and user_set_password, to fit argon2id
+-- hashes made with any configured PasswordHashMemory, PasswordHashIterations and PasswordHashThreads. The default
+-- parameters' hashes are 97 characters; larger parameters take up to 113 (see modules/auth/passwords.go).
+
+ALTER TABLE `User`
+  MODIFY COLUMN `Password` varchar(255) COLLATE utf8_unicode_ci NOT NULL;
+
+DROP PROCEDURE IF EXISTS `user_register`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_register`(IN username varchar(25),
+                                                            IN pass varchar(255),
+                                                            IN email varchar(50),
+                                                            IN firstName varchar(30),
+                                                            IN lastName varchar(30))
+  BEGIN
+    INSERT INTO User (Username, Password, Email, FirstName, LastName)
+    SELECT username, pass, email, firstName, lastName
+    FROM DUAL
+    WHERE NOT EXISTS (SELECT 1 FROM UsernameAlias WHERE UsernameAlias.Alias = username);
+  END ;;
+DELIMITER ;
+
+DROP PROCEDURE IF EXISTS `user_set_password`;
+DELIMITER ;;
+CREATE DEFINER=`root`@`localhost` PROCEDURE `user_set_password`(IN username varchar(25),
+                                                                IN pass varchar(255))
+  BEGIN
+    UPDATE User SET User.Password = pass WHERE User.Username = username;
+  END ;;
+DELIMITER ;
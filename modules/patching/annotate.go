@@ -0,0 +1,90 @@
+package patching
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorPatchMismatch is the error thrown if a patch does not apply to the text being annotated
+var ErrorPatchMismatch = errors.New("Patch does not apply to the annotated text")
+
+// AnnotateText applies the provided patches onto the given text, strictly in the order given, and returns the index of
+// the patch that last changed each line of the result, or -1 for lines unchanged since the given text.
+//
+// A line is changed by a patch that inserts any of its characters, including its line break, or that deletes from
+// within it. Deleting whole lines changes no remaining line.
+func AnnotateText(text string, patches []*Patch) ([]int, error) {
+	runes := []rune(text)
+	origins := make([]int, len(runes))
+	for i := range origins {
+		origins[i] = -1
+	}
+
+	for index, patch := range patches {
+		newRunes := make([]rune, 0, len(runes))
+		newOrigins := make([]int, 0, len(origins))
+		pos := 0
+		markNext := false
+
+		copyTo := func(end int) {
+			for ; pos < end; pos++ {
+				newRunes = append(newRunes, runes[pos])
+				if markNext {
+					newOrigins = append(newOrigins, index)
+					markNext = false
+				} else {
+					newOrigins = append(newOrigins, origins[pos])
+				}
+			}
+		}
+
+		for _, diff := range patch.Changes {
+			if diff.StartIndex < pos || diff.StartIndex > len(runes) {
+				return nil, ErrorPatchMismatch
+			}
+			copyTo(diff.StartIndex)
+
+			changes := []rune(diff.Changes)
+			if diff.Insertion {
+				for _, r := range changes {
+					newRunes = append(newRunes, r)
+					newOrigins = append(newOrigins, index)
+				}
+				markNext = false
+				continue
+			}
+
+			if pos+len(changes) > len(runes) || string(runes[pos:pos+len(changes)]) != diff.Changes {
+				return nil, ErrorPatchMismatch
+			}
+			pos += len(changes)
+
+			if n := len(newRunes); n > 0 && newRunes[n-1] != '\n' {
+				// Deleted from within the line
+				newOrigins[n-1] = index
+			} else if !strings.HasSuffix(diff.Changes, "\n") {
+				// Deleted from the start of the line that follows
+				markNext = true
+			}
+		}
+		copyTo(len(runes))
+
+		runes, origins = newRunes, newOrigins
+	}
+
+	lines := []int{}
+	line := -1
+	for i, r := range runes {
+		if origins[i] > line {
+			line = origins[i]
+		}
+		if r == '\n' {
+			lines = append(lines, line)
+			line = -1
+		}
+	}
+	if len(runes) == 0 || runes[len(runes)-1] != '\n' {
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
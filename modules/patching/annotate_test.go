@@ -0,0 +1,50 @@
+package patching
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotateText(t *testing.T) {
+	tests := []struct {
+		desc     string
+		text     string
+		patches  []string
+		expected []int
+	}{
+		{"No patches", "one\ntwo\n", nil, []int{-1, -1}},
+		{"Empty file", "", nil, []int{-1}},
+		{"Insertion within a line", "one\ntwo\n", []string{"v1:\n5:+1:x:\n8"}, []int{-1, 0}},
+		{"Inserted lines", "one\ntwo\n", []string{"v1:\n4:+6:a%0Ab%0Ac%0A:\n8"}, []int{-1, 0, 0, 0, -1}},
+		{"Line break added to the last line", "one\ntwo", []string{"v1:\n7:+1:%0A:\n7"}, []int{-1, 0}},
+		{"Deletion within a line", "one\ntwo\n", []string{"v1:\n1:-1:n:\n8"}, []int{0, -1}},
+		{"Deletion from the start of a line", "one\ntwo\n", []string{"v1:\n4:-2:tw:\n8"}, []int{-1, 0}},
+		{"Deleted lines", "one\ntwo\nthree\n", []string{"v1:\n4:-4:two%0A:\n14"}, []int{-1, -1}},
+		{"Joined lines", "one\ntwo\n", []string{"v1:\n3:-1:%0A:\n8"}, []int{0}},
+		{
+			"Later patches take precedence",
+			"one\ntwo\nthree\n",
+			[]string{"v1:\n0:+1:x:\n14", "v2:\n5:+1:y,\n11:+1:z:\n15", "v3:\n0:-1:x:\n17"},
+			[]int{2, 1, 1},
+		},
+	}
+
+	for _, test := range tests {
+		patches, err := GetPatches(test.patches)
+		require.Nil(t, err)
+		lines, err := AnnotateText(test.text, patches)
+		require.Nil(t, err, test.desc)
+		require.Equal(t, test.expected, lines, test.desc)
+	}
+
+	patches, err := GetPatches([]string{"v1:\n0:-3:two:\n8"})
+	require.Nil(t, err)
+	_, err = AnnotateText("one\ntwo\n", patches)
+	require.Equal(t, ErrorPatchMismatch, err, "Did not throw an error on mismatched deletion")
+
+	patches, err = GetPatches([]string{"v1:\n20:+1:x:\n8"})
+	require.Nil(t, err)
+	_, err = AnnotateText("one\ntwo\n", patches)
+	require.Equal(t, ErrorPatchMismatch, err, "Did not throw an error on insertion past the end")
+}
@@ -0,0 +1,99 @@
+package patching_test
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/patching"
+	"github.com/CodeCollaborate/Server/modules/patching/ptest"
+	"github.com/stretchr/testify/require"
+)
+
+// scrunchedPatches is the number of patches a scrunch applies with the default buffer lengths
+const scrunchedPatches = 450
+
+// benchmarkGenerator makes documents the size of a typical source file, with changes the size of typing
+func benchmarkGenerator() *ptest.Generator {
+	g := ptest.NewGenerator(1)
+	g.MaxDocLength = 8000
+	g.MaxDiffLength = 20
+	return g
+}
+
+// benchmarkDocument returns a document of at least half the generator's maximum length
+func benchmarkDocument(g *ptest.Generator) string {
+	for {
+		if doc := g.Document(); len(doc) >= g.MaxDocLength/2 {
+			return doc
+		}
+	}
+}
+
+func BenchmarkNewPatchFromString(b *testing.B) {
+	g := benchmarkGenerator()
+	patchStr := g.Patch(0, benchmarkDocument(g)).String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patching.NewPatchFromString(patchStr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPatch_Apply(b *testing.B) {
+	g := benchmarkGenerator()
+	doc := benchmarkDocument(g)
+	patch := g.Patch(0, doc)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patch.Apply(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTransformPatches(b *testing.B) {
+	g := benchmarkGenerator()
+	doc := benchmarkDocument(g)
+	patchX, patchY := g.Patch(0, doc), g.Patch(0, doc)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patching.TransformPatches(patchX, patchY); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConsolidatePatches(b *testing.B) {
+	g := benchmarkGenerator()
+	patches, err := g.PatchSequence(0, benchmarkDocument(g), 20)
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patching.ConsolidatePatches(patches); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPatchTextFromString_Scrunch applies as many patches as a scrunch does
+func BenchmarkPatchTextFromString_Scrunch(b *testing.B) {
+	g := benchmarkGenerator()
+	doc := benchmarkDocument(g)
+	patches, err := g.PatchSequence(0, doc, scrunchedPatches)
+	require.NoError(b, err)
+	patchStrs := make([]string, len(patches))
+	for i, patch := range patches {
+		patchStrs[i] = patch.String()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patching.PatchTextFromString(doc, patchStrs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"unicode/utf8"
@@ -20,6 +21,60 @@ type Patch struct {
 
 	// DocLength is the length of the document prior to the application of this patch
 	DocLength int
+
+	// Metadata describes who made the patch, and when. It is empty for patches that were stored without it.
+	Metadata Metadata
+}
+
+// Metadata describes the authorship of a patch. It is written after the document length, as URL-encoded values, and
+// only if any are set, so that patches without it keep their old format, and old parsers skip it.
+type Metadata struct {
+	// Author is the username of the user who made the patch
+	Author string
+
+	// ClientID identifies the client the patch was made in, as the client chooses
+	ClientID string
+
+	// Timestamp is when the server received the patch, in seconds since the Unix epoch
+	Timestamp int64
+}
+
+// IsEmpty returns true if none of the metadata is set
+func (meta Metadata) IsEmpty() bool {
+	return meta == Metadata{}
+}
+
+func (meta Metadata) String() string {
+	values := url.Values{}
+	if meta.Author != "" {
+		values.Set("author", meta.Author)
+	}
+	if meta.ClientID != "" {
+		values.Set("client", meta.ClientID)
+	}
+	if meta.Timestamp != 0 {
+		values.Set("time", strconv.FormatInt(meta.Timestamp, 10))
+	}
+	return values.Encode()
+}
+
+// newMetadataFromString parses metadata from its string representation, ignoring any values it does not know
+func newMetadataFromString(str string) (Metadata, error) {
+	meta := Metadata{}
+	values, err := url.ParseQuery(str)
+	if err != nil {
+		return meta, err
+	}
+
+	meta.Author = values.Get("author")
+	meta.ClientID = values.Get("client")
+	if timestamp := values.Get("time"); timestamp != "" {
+		meta.Timestamp, err = strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return meta, err
+		}
+	}
+	return meta, nil
 }
 
 // GetPatches creates an array of patches, given the array of strings
@@ -71,6 +126,13 @@ func NewPatchFromString(str string) (*Patch, error) {
 	}
 	patch.DocLength = int(docLen64)
 
+	if len(parts) > 3 {
+		patch.Metadata, err = newMetadataFromString(parts[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	diffStrs := strings.Split(parts[1], ",\n")
 
 	for _, diffStr := range diffStrs {
@@ -96,7 +158,9 @@ func (patch *Patch) ConvertToCRLF(base string) *Patch {
 		newChanges = append(newChanges, diff.ConvertToCRLF(base))
 	}
 
-	return NewPatch(patch.BaseVersion, newChanges, utf8.RuneCountInString(strings.Replace(base, "\n", "\r\n", -1)))
+	converted := NewPatch(patch.BaseVersion, newChanges, utf8.RuneCountInString(strings.Replace(base, "\n", "\r\n", -1)))
+	converted.Metadata = patch.Metadata
+	return converted
 }
 
 // ConvertToLF converts this patch from using CRLF to LF line separators given the base text to patch.
@@ -107,7 +171,36 @@ func (patch *Patch) ConvertToLF(base string) *Patch {
 		newChanges = append(newChanges, diff.ConvertToLF(base))
 	}
 
-	return NewPatch(patch.BaseVersion, newChanges, utf8.RuneCountInString(strings.Replace(base, "\r\n", "\n", -1)))
+	converted := NewPatch(patch.BaseVersion, newChanges, utf8.RuneCountInString(strings.Replace(base, "\r\n", "\n", -1)))
+	converted.Metadata = patch.Metadata
+	return converted
+}
+
+// Undo returns the patch that reverts this patch, to apply to the document this patch produced.
+func (patch *Patch) Undo() *Patch {
+	undoChanges := Diffs{}
+	docLength := patch.DocLength
+
+	for i, diff := range patch.Changes {
+		// Insertions before the diff shift it right; deletions shift it left only once they end before it
+		startIndex := diff.StartIndex
+		for _, prev := range patch.Changes[:i] {
+			if prev.Insertion {
+				startIndex += prev.Length()
+			} else if prev.StartIndex < diff.StartIndex {
+				startIndex -= prev.Length()
+			}
+		}
+		undoChanges = append(undoChanges, NewDiff(!diff.Insertion, startIndex, diff.Changes))
+
+		if diff.Insertion {
+			docLength += diff.Length()
+		} else {
+			docLength -= diff.Length()
+		}
+	}
+
+	return NewPatch(patch.BaseVersion+1, undoChanges, docLength)
 }
 
 func (patch *Patch) String() string {
@@ -124,6 +217,10 @@ func (patch *Patch) String() string {
 		}
 	}
 	buffer.WriteString(fmt.Sprintf(":\n%d", patch.DocLength))
+	if !patch.Metadata.IsEmpty() {
+		buffer.WriteString(":\n")
+		buffer.WriteString(patch.Metadata.String())
+	}
 
 	return buffer.String()
 }
@@ -70,6 +70,57 @@ func TestPatch_NewPatchFromStringInvalidFormats(t *testing.T) {
 	require.NotNil(t, err, "Did not throw an error on empty changes")
 }
 
+func TestPatch_Metadata(t *testing.T) {
+	patch, err := NewPatchFromString("v6:\n3:-8:deletion:\n11")
+	require.Nil(t, err)
+	require.True(t, patch.Metadata.IsEmpty())
+
+	patch.Metadata = Metadata{Author: "loganga", ClientID: "eclipse:\n2", Timestamp: 1476000000}
+	patchString := "v6:\n3:-8:deletion:\n11:\nauthor=loganga&client=eclipse%3A%0A2&time=1476000000"
+	require.Equal(t, patchString, patch.String())
+
+	parsed, err := NewPatchFromString(patchString)
+	require.Nil(t, err)
+	require.Equal(t, patch, parsed)
+
+	// Values the parser doesn't know are skipped
+	parsed, err = NewPatchFromString("v6:\n3:-8:deletion:\n11:\nauthor=loganga&editor=vim")
+	require.Nil(t, err)
+	require.Equal(t, Metadata{Author: "loganga"}, parsed.Metadata)
+
+	_, err = NewPatchFromString("v6:\n3:-8:deletion:\n11:\ntime=yesterday")
+	require.NotNil(t, err, "Did not throw an error on invalid timestamp")
+
+	// Conversion and transformation keep each patch's metadata
+	converted := patch.ConvertToLF("ab\r\ncdefghijk")
+	require.Equal(t, patch.Metadata, converted.Metadata)
+
+	other := NewPatch(6, Diffs{NewDiff(true, 0, "x")}, 11)
+	other.Metadata = Metadata{Author: "gene"}
+	result, err := TransformPatches(patch, other)
+	require.Nil(t, err)
+	require.Equal(t, patch.Metadata, result.PatchXPrime.Metadata)
+	require.Equal(t, other.Metadata, result.PatchYPrime.Metadata)
+}
+
+func TestPatch_Undo(t *testing.T) {
+	tests := []struct {
+		patch    string
+		expected string
+	}{
+		{"v1:\n2:+3:abc:\n8", "v2:\n2:-3:abc:\n11"},
+		{"v1:\n2:-3:abc:\n8", "v2:\n2:+3:abc:\n5"},
+		{"v1:\n2:+3:xyz,\n2:-3:abc:\n8", "v2:\n2:-3:xyz,\n5:+3:abc:\n8"},
+		{"v1:\n0:-2:ab,\n4:+1:x,\n6:-1:z:\n8", "v2:\n0:+2:ab,\n2:-1:x,\n5:+1:z:\n6"},
+	}
+
+	for _, test := range tests {
+		patch, err := NewPatchFromString(test.patch)
+		require.Nil(t, err)
+		require.Equal(t, test.expected, patch.Undo().String(), test.patch)
+	}
+}
+
 func TestPatch_ConvertToCRLF(t *testing.T) {
 	patch, err := NewPatchFromString("v0:\n0:+5:test%0A:\n12")
 	require.Nil(t, err)
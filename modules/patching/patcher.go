@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"strings"
-	"unicode/utf8"
 )
 
 // PatchTextFromString applies the provided patches onto the given text. The patches are applied strictly in the order given.
@@ -26,70 +24,70 @@ func PatchTextFromString(text string, patchesStr []string) (string, error) {
 // ErrorIllegalLocation is the error thrown if a diff attempts to insert in an invalid location, such as between an \r and \n
 var ErrorIllegalLocation = errors.New("Attempted to apply diff at an illegal lcoation")
 
+// ErrorOutOfBounds is the error thrown if a diff starts or ends past the end of the text it is applied to
+var ErrorOutOfBounds = errors.New("Attempted to apply diff outside the bounds of the text")
+
+// ErrorOverlappingDiffs is the error thrown if a diff starts within the text deleted by the diff before it
+var ErrorOverlappingDiffs = errors.New("Attempted to modify diff within range of previous deletion")
+
 // PatchText applies the provided patches onto the given text. The patches are applied strictly in the order given.
 // This method completes in O(n*m) time, where n is the base text length, and m is the number of patches.
 func PatchText(text string, patches []*Patch) (string, error) {
-	useCRLF := strings.Contains(text, "\r\n")
-
 	for _, patch := range patches {
-		noOpLength := 0
-		prevEndIndex := 0
-		var prevDiff *Diff
-		var buffer bytes.Buffer
-
-		if useCRLF {
-			patch.ConvertToCRLF(text)
+		var err error
+		if text, err = patch.Apply(text); err != nil {
+			return "", err
 		}
+	}
+	return text, nil
+}
 
-		for _, diff := range patch.Changes {
-			if diff.StartIndex > 0 && diff.StartIndex < utf8.RuneCountInString(text) &&
-				text[diff.StartIndex-1] == '\r' && text[diff.StartIndex] == '\n' {
-				return "", ErrorIllegalLocation
-			}
-
-			noOpLength = diff.StartIndex
-			if prevDiff != nil {
-				if prevDiff.Insertion || prevDiff.StartIndex == diff.StartIndex {
-					noOpLength = diff.StartIndex - prevDiff.StartIndex
-				} else {
-					if prevDiff.StartIndex+prevDiff.Length() > diff.StartIndex {
-						return "", errors.New("Attempted to modify diff within range of previous deletion")
-					}
-					noOpLength = diff.StartIndex - (prevDiff.StartIndex + prevDiff.Length())
-				}
-			}
-
-			// Copy any text that is untouched
-			if noOpLength > 0 {
-				buffer.WriteString(text[prevEndIndex : prevEndIndex+noOpLength])
-			}
+// Apply applies this patch onto the given base text. Diffs are applied in order, and their indices count the
+// characters of the base text. Diffs that fall outside the base text, or delete text it doesn't have, are rejected
+// rather than applied.
+func (patch *Patch) Apply(base string) (string, error) {
+	text := []rune(base)
+	var buffer bytes.Buffer
+	var prevDiff *Diff
+	pos := 0
 
-			if diff.Insertion {
-				// Commit insertion
-				buffer.WriteString(diff.Changes)
+	for _, diff := range patch.Changes {
+		if diff.StartIndex < 0 || diff.StartIndex > len(text) {
+			return "", ErrorOutOfBounds
+		}
+		if diff.StartIndex > 0 && diff.StartIndex < len(text) &&
+			text[diff.StartIndex-1] == '\r' && text[diff.StartIndex] == '\n' {
+			return "", ErrorIllegalLocation
+		}
 
-				// End index is incremented only by the no-op length;
-				// insertions do not change the index in the original text
-				prevEndIndex += noOpLength
-			} else {
-				// Move to start of deletion
-				prevEndIndex += noOpLength
+		// A diff may start where the deletion before it did, to follow it
+		if diff.StartIndex < pos && (prevDiff == nil || prevDiff.Insertion || prevDiff.StartIndex != diff.StartIndex) {
+			return "", ErrorOverlappingDiffs
+		}
 
-				if text[prevEndIndex:prevEndIndex+diff.Length()] != diff.Changes {
-					return "", fmt.Errorf("PatchText: Deleted text [%s] does not match changes in diff: [%s]", text[prevEndIndex:prevEndIndex+diff.Length()], diff.Changes)
-				}
-				// Skip past the text that is deleted
-				prevEndIndex += diff.Length()
-			}
-			prevDiff = diff
+		// Copy any text that is untouched
+		if diff.StartIndex > pos {
+			buffer.WriteString(string(text[pos:diff.StartIndex]))
+			pos = diff.StartIndex
 		}
 
-		// Copy the remainder
-		if prevEndIndex < len(text) {
-			buffer.WriteString(text[prevEndIndex:])
+		if diff.Insertion {
+			buffer.WriteString(diff.Changes)
+		} else {
+			end := pos + diff.Length()
+			if end > len(text) {
+				return "", ErrorOutOfBounds
+			}
+			if deleted := string(text[pos:end]); deleted != diff.Changes {
+				return "", fmt.Errorf("Deleted text [%s] does not match changes in diff: [%s]", deleted, diff.Changes)
+			}
+			// Skip past the text that is deleted
+			pos = end
 		}
-		text = buffer.String()
+		prevDiff = diff
 	}
 
-	return text, nil
+	// Copy the remainder
+	buffer.WriteString(string(text[pos:]))
+	return buffer.String(), nil
 }
@@ -45,7 +45,7 @@ func TestFilePatcher_ApplyPatch(t *testing.T) {
 			desc:    "Single Patch, Single deletion, Incorrect base text",
 			patches: getPatchesOrDie(t, "v0:\n2:-1:s:\n10"),
 			text:    "aaaa",
-			error:   "PatchText: Deleted text [a] does not match changes in diff: [s]",
+			error:   "Deleted text [a] does not match changes in diff: [s]",
 		},
 		{
 			desc:     "Single Patch, Double insertion",
@@ -137,3 +137,34 @@ func TestFilePatcher_ApplyPatch(t *testing.T) {
 		}
 	}
 }
+
+func TestPatch_Apply(t *testing.T) {
+	tests := []struct {
+		desc     string
+		patch    string
+		text     string
+		expected string
+		err      error
+	}{
+		{"Multi-byte characters", "v0:\n3:-1:%C3%A9,\n4:+1:%E2%9C%93:\n4", "café", "caf✓", nil},
+		{"Insertion at the end", "v0:\n4:+1:s:\n4", "test", "tests", nil},
+		{"Insertion past the end", "v0:\n5:+1:s:\n4", "test", "", ErrorOutOfBounds},
+		{"Deletion past the end", "v0:\n3:-2:tt:\n4", "test", "", ErrorOutOfBounds},
+		{"Deletion following a deletion", "v0:\n1:-1:e,\n1:-1:s:\n4", "test", "tt", nil},
+		{"Diff within a deletion", "v0:\n0:-3:tes,\n2:+1:x:\n4", "test", "", ErrorOverlappingDiffs},
+		{"Insertion within a line ending", "v0:\n2:+1:x:\n4", "a\r\nb", "", ErrorIllegalLocation},
+	}
+
+	for _, test := range tests {
+		patch, err := NewPatchFromString(test.patch)
+		if err != nil {
+			t.Fatalf("TestPatch_Apply[%s]: Failed to build patch: %v", test.desc, err)
+		}
+		result, err := patch.Apply(test.text)
+		if err != test.err {
+			t.Errorf("TestPatch_Apply[%s]: Expected error %v, got %v", test.desc, test.err, err)
+		} else if result != test.expected {
+			t.Errorf("TestPatch_Apply[%s]: Expected %q, got %q", test.desc, test.expected, result)
+		}
+	}
+}
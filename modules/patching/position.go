@@ -0,0 +1,33 @@
+package patching
+
+// TransformPosition returns where the given offset into the patch's base text is once the patch is applied. Offsets
+// count characters, as diffs' indices do. Text inserted at the offset is placed before it if afterInsertions is set, and
+// after it otherwise; offsets within deleted text move to where the deletion was.
+func (patch *Patch) TransformPosition(pos int, afterInsertions bool) int {
+	shift := 0
+	for _, diff := range patch.Changes {
+		switch {
+		case diff.Insertion:
+			if diff.StartIndex < pos || diff.StartIndex == pos && afterInsertions {
+				shift += diff.Length()
+			}
+		case diff.StartIndex+diff.Length() <= pos:
+			shift -= diff.Length()
+		case diff.StartIndex < pos:
+			shift -= pos - diff.StartIndex
+		}
+	}
+	return pos + shift
+}
+
+// TransformRange returns where the range of the base text from start to end is once the patches are applied, in
+// order. Text inserted at either end of the range is left outside it, and a range whose text is deleted is left empty.
+func TransformRange(start int, end int, patches []*Patch) (int, int) {
+	for _, patch := range patches {
+		start, end = patch.TransformPosition(start, true), patch.TransformPosition(end, false)
+		if end < start {
+			end = start
+		}
+	}
+	return start, end
+}
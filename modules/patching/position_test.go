@@ -0,0 +1,48 @@
+package patching
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatch_TransformPosition(t *testing.T) {
+	tests := []struct {
+		desc            string
+		patch           string
+		pos             int
+		afterInsertions bool
+		expected        int
+	}{
+		{"Insertion before", "v1:\n2:+3:abc:\n10", 5, false, 8},
+		{"Insertion after", "v1:\n7:+3:abc:\n10", 5, false, 5},
+		{"Insertion at the position, kept after it", "v1:\n5:+3:abc:\n10", 5, false, 5},
+		{"Insertion at the position, placed before it", "v1:\n5:+3:abc:\n10", 5, true, 8},
+		{"Deletion before", "v1:\n1:-2:bc:\n10", 5, false, 3},
+		{"Deletion ending at the position", "v1:\n3:-2:de:\n10", 5, false, 3},
+		{"Deletion starting at the position", "v1:\n5:-2:fg:\n10", 5, false, 5},
+		{"Position within a deletion", "v1:\n3:-4:defg:\n10", 5, false, 3},
+		{"Several diffs", "v1:\n0:+2:xy,\n2:-1:c,\n8:+1:z:\n10", 5, false, 6},
+	}
+
+	for _, test := range tests {
+		patch, err := NewPatchFromString(test.patch)
+		require.Nil(t, err, test.desc)
+		require.Equal(t, test.expected, patch.TransformPosition(test.pos, test.afterInsertions), test.desc)
+	}
+}
+
+func TestTransformRange(t *testing.T) {
+	// "one\ntwo\nthree\n", with the range covering "two"
+	patches, err := GetPatches([]string{"v1:\n4:+1:x:\n14", "v2:\n8:+2:yz:\n15", "v3:\n0:-4:one%0A:\n17"})
+	require.Nil(t, err)
+	start, end := TransformRange(4, 7, patches)
+	require.Equal(t, 1, start, "text inserted at the start should be left outside the range")
+	require.Equal(t, 4, end, "text inserted at the end should be left outside the range")
+
+	patches, err = GetPatches([]string{"v1:\n3:-6:%0Atwo%0At:\n14"})
+	require.Nil(t, err)
+	start, end = TransformRange(4, 7, patches)
+	require.Equal(t, 3, start)
+	require.Equal(t, 3, end, "a deleted range should be left empty")
+}
@@ -0,0 +1,85 @@
+package ptest
+
+import (
+	"fmt"
+
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+// Case is a pair of concurrent patches to a document, and what the patching package makes of them. Patches are in
+// their string format, so that cases can be marshalled as JSON for client implementations to test against.
+type Case struct {
+	Seed     int64
+	Document string
+
+	// PatchX and PatchY are both based on Document
+	PatchX string
+	PatchY string
+
+	// UndoX reverts PatchX
+	UndoX string
+
+	// PatchXPrime is PatchX transformed to apply after PatchY, and PatchYPrime is PatchY transformed to apply after
+	// PatchX
+	PatchXPrime string
+	PatchYPrime string
+
+	// Result is the document after both patches are applied, in either order
+	Result string
+}
+
+// NewCase generates the case for the given seed, checking that it keeps every invariant
+func NewCase(seed int64) (Case, error) {
+	g := NewGenerator(seed)
+	doc := g.Document()
+	patchX := g.Patch(1, doc)
+	patchY := g.Patch(1, doc)
+	c := Case{
+		Seed:     seed,
+		Document: doc,
+		PatchX:   patchX.String(),
+		PatchY:   patchY.String(),
+		UndoX:    patchX.Undo().String(),
+	}
+
+	for _, patch := range []*patching.Patch{patchX, patchY} {
+		if err := CheckRoundTrip(patch); err != nil {
+			return Case{}, fmt.Errorf("seed %d: %v", seed, err)
+		}
+		if err := CheckUndo(doc, patch); err != nil {
+			return Case{}, fmt.Errorf("seed %d: %v", seed, err)
+		}
+	}
+
+	transformed, err := patching.TransformPatches(patchX, patchY)
+	if err != nil {
+		return Case{}, fmt.Errorf("seed %d: failed to transform %q against %q: %v", seed, c.PatchX, c.PatchY, err)
+	}
+	c.PatchXPrime = transformed.PatchXPrime.String()
+	c.PatchYPrime = transformed.PatchYPrime.String()
+	if c.Result, err = CheckConvergence(doc, patchX, patchY); err != nil {
+		return Case{}, fmt.Errorf("seed %d: %v", seed, err)
+	}
+
+	sequence, err := g.PatchSequence(1, doc, 1+g.rand.Intn(4))
+	if err != nil {
+		return Case{}, fmt.Errorf("seed %d: %v", seed, err)
+	}
+	if err := CheckConsolidation(doc, sequence); err != nil {
+		return Case{}, fmt.Errorf("seed %d: %v", seed, err)
+	}
+	return c, nil
+}
+
+// Corpus generates n cases, from consecutive seeds starting at the given one. It returns an error describing the first
+// case that breaks an invariant, if any does.
+func Corpus(seed int64, n int) ([]Case, error) {
+	cases := make([]Case, n)
+	for i := range cases {
+		var err error
+		if cases[i], err = NewCase(seed + int64(i)); err != nil {
+			return nil, err
+		}
+	}
+	return cases, nil
+}
@@ -0,0 +1,99 @@
+// Package ptest generates random documents and patches, and checks the invariants that the patching package must keep
+// for them, so that the operational transformation can be tested against many more cases than are written by hand.
+// Corpus exposes the generated cases, and their expected outcomes, so that client implementations of patching can be
+// tested against the same cases as the server.
+package ptest
+
+import (
+	"math/rand"
+
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+// DefaultAlphabet is the characters generated documents and insertions are made of. It omits '\r', since patches may
+// not split a CRLF line ending, and is limited to single-byte characters.
+var DefaultAlphabet = []rune("abcde \n")
+
+// Generator makes random documents and patches. Generators with the same seed and settings make the same documents
+// and patches.
+type Generator struct {
+	rand *rand.Rand
+
+	// Alphabet is the characters documents and insertions are made of
+	Alphabet []rune
+
+	// MaxDocLength is the length generated documents are at most
+	MaxDocLength int
+
+	// MaxDiffs is the number of diffs generated patches have at most, and at least one
+	MaxDiffs int
+
+	// MaxDiffLength is the length generated diffs are at most
+	MaxDiffLength int
+}
+
+// NewGenerator creates a generator with the given seed, and the default settings
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		rand:          rand.New(rand.NewSource(seed)),
+		Alphabet:      DefaultAlphabet,
+		MaxDocLength:  40,
+		MaxDiffs:      4,
+		MaxDiffLength: 6,
+	}
+}
+
+// Document returns a random document
+func (g *Generator) Document() string {
+	return g.text(g.rand.Intn(g.MaxDocLength + 1))
+}
+
+// Patch returns a random patch against the document, based on the given version
+func (g *Generator) Patch(baseVersion int64, doc string) *patching.Patch {
+	docLength := len([]rune(doc))
+	runes := []rune(doc)
+	diffs := patching.Diffs{}
+
+	pos := 0
+	numDiffs := 1 + g.rand.Intn(g.MaxDiffs)
+	for i := 0; i < numDiffs; i++ {
+		pos += g.rand.Intn(docLength - pos + 1)
+		if pos == docLength || g.rand.Intn(2) == 0 {
+			diffs = append(diffs, patching.NewDiff(true, pos, g.text(1+g.rand.Intn(g.MaxDiffLength))))
+			continue
+		}
+
+		length := 1 + g.rand.Intn(g.MaxDiffLength)
+		if pos+length > docLength {
+			length = docLength - pos
+		}
+		diffs = append(diffs, patching.NewDiff(false, pos, string(runes[pos:pos+length])))
+		pos += length
+	}
+
+	return patching.NewPatch(baseVersion, diffs, docLength)
+}
+
+// PatchSequence returns n random patches, each against the document the ones before it produce, starting from the
+// given version of the document
+func (g *Generator) PatchSequence(baseVersion int64, doc string, n int) ([]*patching.Patch, error) {
+	patches := make([]*patching.Patch, n)
+	for i := range patches {
+		patches[i] = g.Patch(baseVersion+int64(i), doc)
+
+		var err error
+		if doc, err = patchText(doc, patches[i:i+1]); err != nil {
+			return nil, err
+		}
+	}
+	return patches, nil
+}
+
+// text returns random text of the given length
+func (g *Generator) text(length int) string {
+	runes := make([]rune, length)
+	for i := range runes {
+		runes[i] = g.Alphabet[g.rand.Intn(len(g.Alphabet))]
+	}
+	return string(runes)
+}
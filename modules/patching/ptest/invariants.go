@@ -0,0 +1,103 @@
+package ptest
+
+import (
+	"fmt"
+
+	"github.com/CodeCollaborate/Server/modules/patching"
+)
+
+// patchText applies the patches to the document, as patching.PatchText does, but reports a patch that makes it panic
+// as an error, so that the rest of the cases are still checked
+func patchText(doc string, patches []*patching.Patch) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panicked: %v", r)
+		}
+	}()
+	return patching.PatchText(doc, patches)
+}
+
+// apply applies a single patch to the document
+func apply(doc string, patch *patching.Patch) (string, error) {
+	return patchText(doc, []*patching.Patch{patch})
+}
+
+// CheckRoundTrip checks that the patch is unchanged by formatting and parsing it
+func CheckRoundTrip(patch *patching.Patch) error {
+	parsed, err := patching.NewPatchFromString(patch.String())
+	if err != nil {
+		return fmt.Errorf("failed to parse %q: %v", patch.String(), err)
+	}
+	if parsed.String() != patch.String() {
+		return fmt.Errorf("%q was parsed as %q", patch.String(), parsed.String())
+	}
+	return nil
+}
+
+// CheckUndo checks that applying the patch to the document, and then its undo, gives back the document
+func CheckUndo(doc string, patch *patching.Patch) error {
+	patched, err := apply(doc, patch)
+	if err != nil {
+		return fmt.Errorf("failed to apply %q to %q: %v", patch.String(), doc, err)
+	}
+	undo := patch.Undo()
+	undone, err := apply(patched, undo)
+	if err != nil {
+		return fmt.Errorf("failed to apply undo %q to %q: %v", undo.String(), patched, err)
+	}
+	if undone != doc {
+		return fmt.Errorf("undoing %q on %q gave %q, not %q", patch.String(), doc, undone, doc)
+	}
+	return nil
+}
+
+// CheckConvergence checks that concurrent patches to the document, transformed against each other, give the same
+// document whichever is applied first. It returns the document they converge on.
+func CheckConvergence(doc string, patchX *patching.Patch, patchY *patching.Patch) (string, error) {
+	result, err := patching.TransformPatches(patchX, patchY)
+	if err != nil {
+		return "", fmt.Errorf("failed to transform %q against %q: %v", patchX.String(), patchY.String(), err)
+	}
+
+	xy, err := patchText(doc, []*patching.Patch{patchX, result.PatchYPrime})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply %q then %q to %q: %v", patchX.String(), result.PatchYPrime.String(), doc, err)
+	}
+	yx, err := patchText(doc, []*patching.Patch{patchY, result.PatchXPrime})
+	if err != nil {
+		return "", fmt.Errorf("failed to apply %q then %q to %q: %v", patchY.String(), result.PatchXPrime.String(), doc, err)
+	}
+	if xy != yx {
+		return "", fmt.Errorf("%q and %q on %q diverged: %q after X, but %q after Y", patchX.String(), patchY.String(), doc, xy, yx)
+	}
+	return xy, nil
+}
+
+// CheckConsolidation checks that applying the consolidation of a sequence of patches to the document gives the same
+// document as applying each in turn
+func CheckConsolidation(doc string, patches []*patching.Patch) error {
+	expected, err := patchText(doc, patches)
+	if err != nil {
+		return fmt.Errorf("failed to apply the patches to %q: %v", doc, err)
+	}
+
+	// Consolidation consumes the patches it is given
+	copies := make([]*patching.Patch, len(patches))
+	for i, patch := range patches {
+		if copies[i], err = patching.NewPatchFromString(patch.String()); err != nil {
+			return err
+		}
+	}
+	consolidated, err := patching.ConsolidatePatches(copies)
+	if err != nil {
+		return fmt.Errorf("failed to consolidate the patches: %v", err)
+	}
+	actual, err := apply(doc, consolidated)
+	if err != nil {
+		return fmt.Errorf("failed to apply consolidated %q to %q: %v", consolidated.String(), doc, err)
+	}
+	if actual != expected {
+		return fmt.Errorf("consolidated %q on %q gave %q, not %q", consolidated.String(), doc, actual, expected)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package ptest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorpus(t *testing.T) {
+	cases, err := Corpus(1, 2000)
+	require.Nil(t, err)
+	require.Len(t, cases, 2000)
+
+	// The same seed makes the same case
+	again, err := NewCase(cases[10].Seed)
+	require.Nil(t, err)
+	require.Equal(t, cases[10], again)
+}
+
+func TestInvariants_DetectBrokenPatches(t *testing.T) {
+	g := NewGenerator(1)
+	doc := "one\ntwo\n"
+
+	// A patch and its undo are only checked against the document they are for
+	patch := g.Patch(1, "three\n")
+	patch.Changes[0].Insertion = false
+	patch.Changes[0].StartIndex = 0
+	patch.Changes[0].Changes = "three"
+	require.NotNil(t, CheckUndo(doc, patch))
+
+	_, err := CheckConvergence(doc, patch, g.Patch(1, doc))
+	require.NotNil(t, err)
+
+	sequence, err := g.PatchSequence(1, doc, 3)
+	require.Nil(t, err)
+	require.Nil(t, CheckConsolidation(doc, sequence))
+	require.NotNil(t, CheckConsolidation("three\n", sequence))
+}
@@ -221,8 +221,11 @@ func TransformPatches(patchX *Patch, patchY *Patch) (*TransformResult, error) {
 		}
 	}
 
-	return &TransformResult{
+	result := &TransformResult{
 		NewPatch(patchY.BaseVersion+1, patchXPrime, newDocXLen),
 		NewPatch(patchX.BaseVersion+1, patchYPrime, newDocYLen),
-	}, nil
+	}
+	result.PatchXPrime.Metadata = patchX.Metadata
+	result.PatchYPrime.Metadata = patchY.Metadata
+	return result, nil
 }
@@ -0,0 +1,183 @@
+package rabbitmq
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/streadway/amqp"
+)
+
+/**
+ * The notification bridge federates the RabbitMQ brokers of several regions. Each region runs a bridge, which declares
+ * a durable queue on every peer region's broker, named for its own region, bound to the peer's project notifications,
+ * and republishes what it consumes from it to its own exchange, with the same routing key, so that the websockets
+ * subscribed to the project in its region receive them as if they had been published there. Notifications are
+ * acknowledged once they have been republished, or dead-lettered, so that none are lost while the bridge reconnects;
+ * those that wait longer than MaxAge are dropped.
+ *
+ * Relayed notifications carry the region they were first published in, in the Region header. Only notifications
+ * without one are relayed, so that each is relayed once, directly from the region it was published in to each of the
+ * others, and never back, nor on from one peer to another.
+ */
+
+// RabbitRegionHeader is the header relayed notifications carry the name of the region they were published in
+const RabbitRegionHeader = "Region"
+
+// bridgeBindingKey matches the routing keys of project notifications; see RabbitProjectRoutingKey. Other messages it
+// matches are not relayed.
+const bridgeBindingKey = "*.*.*.*"
+
+// bridgeRedialDelay is how long the bridge waits before reconnecting to a peer it lost its connection to
+var bridgeRedialDelay = 5 * time.Second
+
+var errBridgeDisconnected = errors.New("Lost connection to peer region's RabbitMQ")
+
+// BridgeCfg configures the notification bridge
+type BridgeCfg struct {
+	Region       string // This region
+	ExchangeName string // The exchange of every region
+	MaxAge       time.Duration
+	Peers        map[string]AMQPConnCfg // Each peer region's RabbitMQ
+}
+
+// BridgeQueueName returns the name of the queue a region's bridge consumes from on its peers' brokers
+func BridgeQueueName(region string) string {
+	return "Bridge-" + region
+}
+
+// RunBridge relays the project notifications of each peer region to this region's exchange, until control is shut
+// down. SetupRabbitExchange must have been called first.
+func RunBridge(cfg BridgeCfg, control *utils.Control) {
+	for region, peer := range cfg.Peers {
+		go func(region string, peer AMQPConnCfg) {
+			for {
+				err := bridgePeer(cfg, region, peer, control.Exit)
+				if err == nil {
+					return
+				}
+				utils.LogError("Notification bridge failed; reconnecting", err, utils.LogFields{
+					"Region": region,
+					"Host":   peer.Host,
+				})
+				peer.InvalidatePassword()
+				select {
+				case <-control.Exit:
+					return
+				case <-time.After(bridgeRedialDelay):
+				}
+			}
+		}(region, peer)
+	}
+}
+
+// bridgePeer relays the peer region's notifications until exit is closed, or it loses its connection to either broker
+func bridgePeer(cfg BridgeCfg, region string, peer AMQPConnCfg, exit <-chan bool) error {
+	connString, err := peer.ConnectionString()
+	if err != nil {
+		return err
+	}
+	conn, err := amqp.DialConfig(connString, amqp.Config{
+		SASL:            peer.saslMechanisms(),
+		Heartbeat:       defaultHeartbeat,
+		TLSClientConfig: peer.TLSConfig,
+		Dial:            getNewDialer(peer.Timeout),
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	queueName := BridgeQueueName(cfg.Region)
+	_, err = ch.QueueDeclare(
+		queueName, // name
+		true,      // durable - kept while the bridge reconnects
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		amqp.Table{"x-message-ttl": int64(cfg.MaxAge / time.Millisecond)},
+	)
+	if err != nil {
+		return err
+	}
+	if err = BindQueue(ch, queueName, bridgeBindingKey, cfg.ExchangeName); err != nil {
+		return err
+	}
+	deliveries, err := ch.Consume(
+		queueName, // queue
+		"",        // consumer
+		false,     // auto ack
+		true,      // exclusive - one bridge per region relays each notification
+		false,     // no local
+		false,     // no wait
+		nil,       // args
+	)
+	if err != nil {
+		return err
+	}
+
+	publisher := &confirmPublisher{exchangeName: cfg.ExchangeName}
+	defer publisher.close()
+
+	utils.LogInfo("Notification bridge connected", utils.LogFields{
+		"Region": region,
+		"Queue":  queueName,
+	})
+	for {
+		select {
+		case <-exit:
+			return nil
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return errBridgeDisconnected
+			}
+			if message, relay := bridgedMessage(delivery, region); relay {
+				if err := publisher.publish(message, exit); err != nil {
+					RecordDeadLetter(message, err)
+				} else {
+					publishMetrics.Add("Bridged", 1)
+				}
+			}
+			if err := delivery.Ack(false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// bridgedMessage returns the message to republish for a notification delivered from the peer region, or false if it
+// should not be relayed
+func bridgedMessage(delivery amqp.Delivery, region string) (AMQPMessage, bool) {
+	if _, relayed := delivery.Headers[RabbitRegionHeader]; relayed {
+		return AMQPMessage{}, false
+	}
+	contentType, err := strconv.Atoi(delivery.ContentType)
+	if err != nil || contentType != ContentTypeMsg {
+		return AMQPMessage{}, false
+	}
+	project, _ := delivery.Headers["Project"].(string)
+	if _, ok := ParseRabbitProjectQueueName(project); !ok || !strings.HasPrefix(delivery.RoutingKey, project+".") {
+		return AMQPMessage{}, false
+	}
+
+	headers := make(map[string]interface{}, len(delivery.Headers)+1)
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[RabbitRegionHeader] = region
+	return AMQPMessage{
+		Headers:     headers,
+		RoutingKey:  delivery.RoutingKey,
+		ContentType: contentType,
+		Persistent:  delivery.DeliveryMode == 2,
+		Message:     delivery.Body,
+	}, true
+}
@@ -0,0 +1,57 @@
+package rabbitmq
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+func TestBridgedMessage(t *testing.T) {
+	notification := amqp.Delivery{
+		Headers: amqp.Table{
+			"Project":   RabbitProjectQueueName(1),
+			"Event":     "File.Change",
+			"Ephemeral": false,
+		},
+		RoutingKey:   RabbitProjectRoutingKey(1, 2, "File", "Change"),
+		ContentType:  strconv.Itoa(ContentTypeMsg),
+		DeliveryMode: 2,
+		Body:         []byte(`{"Type":"Notification"}`),
+	}
+
+	message, relay := bridgedMessage(notification, "eu")
+	if !relay {
+		t.Fatal("Project notifications published in the peer region should be relayed")
+	}
+	if message.RoutingKey != notification.RoutingKey || string(message.Message) != string(notification.Body) ||
+		!message.Persistent || message.ContentType != ContentTypeMsg {
+		t.Fatalf("Relayed message incorrect: %+v", message)
+	}
+	if message.Headers[RabbitRegionHeader] != "eu" || message.Headers["Event"] != "File.Change" {
+		t.Fatalf("Relayed message should keep its headers, and name the region it was published in: %+v", message.Headers)
+	}
+	if _, ok := notification.Headers[RabbitRegionHeader]; ok {
+		t.Fatal("The delivered notification's headers should not be changed")
+	}
+
+	relayed := notification
+	relayed.Headers = amqp.Table{"Project": RabbitProjectQueueName(1), RabbitRegionHeader: "us"}
+	command := notification
+	command.ContentType = strconv.Itoa(ContentTypeCmd)
+	response := notification
+	response.Headers = amqp.Table{"MessageType": "Response"}
+	response.RoutingKey = "WS-host.example.com-1"
+	mismatched := notification
+	mismatched.RoutingKey = RabbitProjectRoutingKey(2, 0, "Project", "Rename")
+	for name, delivery := range map[string]amqp.Delivery{
+		"already relayed": relayed,
+		"command":         command,
+		"response":        response,
+		"other project":   mismatched,
+	} {
+		if _, relay := bridgedMessage(delivery, "eu"); relay {
+			t.Fatalf("Delivery should not be relayed: %s", name)
+		}
+	}
+}
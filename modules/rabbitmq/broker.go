@@ -0,0 +1,43 @@
+package rabbitmq
+
+// QueueBinder binds routing keys to a websocket's queue, so that it receives the messages published with them
+type QueueBinder interface {
+	BindQueue(queueName, key, exchangeName string) error
+	UnbindQueue(queueName, key, exchangeName string) error
+}
+
+// RabbitBroker publishes and receives messages through the RabbitMQ exchange; SetupRabbitExchange must have been
+// called first.
+type RabbitBroker struct{}
+
+// RunPublisher runs a publisher for the websocket; see RunPublisher
+func (RabbitBroker) RunPublisher(cfg *AMQPPubSubCfg) error {
+	return RunPublisher(cfg)
+}
+
+// RunSubscriber runs a subscriber for the websocket; see RunSubscriber
+func (RabbitBroker) RunSubscriber(cfg *AMQPPubSubCfg) error {
+	return RunSubscriber(cfg)
+}
+
+// BindQueue binds the key to the queue, on a new channel
+func (RabbitBroker) BindQueue(queueName, key, exchangeName string) error {
+	ch, err := GetChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return BindQueue(ch, queueName, key, exchangeName)
+}
+
+// UnbindQueue unbinds the key from the queue, on a new channel
+func (RabbitBroker) UnbindQueue(queueName, key, exchangeName string) error {
+	ch, err := GetChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return UnbindQueue(ch, queueName, key, exchangeName)
+}
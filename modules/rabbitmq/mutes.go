@@ -0,0 +1,75 @@
+package rabbitmq
+
+import (
+	"strings"
+	"sync"
+)
+
+/**
+ * Muting of project notifications. Bindings can only choose which notifications a websocket receives, not leave some
+ * out, and a user's mutes apply to every project they subscribe to, so muted notifications are dropped as they are
+ * delivered instead. Project notifications carry their project's queue name and "Resource.Method" in the Project and
+ * Event headers; each websocket is sent its user's mutes with the "Mute" command, and drops the notifications they
+ * match before they are written to the client.
+ */
+
+// MuteData is the data of the "Mute" command, which replaces the notifications a websocket drops
+type MuteData struct {
+	ProjectIDs []int64
+	Events     []string // "Resource.Method" or "Resource.*", such as "File.SetMetadata"
+}
+
+// ValidEvent reports whether the event is of the form "Resource.Method" or "Resource.*"
+func ValidEvent(event string) bool {
+	return subscriptionEventRegex.MatchString(event)
+}
+
+// Mutes records the project notifications a websocket drops
+type Mutes struct {
+	projects map[string]bool // Project queue names
+	events   map[string]bool
+	mutex    sync.RWMutex
+}
+
+// NewMutes creates a Mutes that drops nothing
+func NewMutes() *Mutes {
+	return &Mutes{
+		projects: make(map[string]bool),
+		events:   make(map[string]bool),
+	}
+}
+
+// Set replaces the muted projects and events
+func (m *Mutes) Set(data MuteData) {
+	projects := make(map[string]bool)
+	for _, projectID := range data.ProjectIDs {
+		projects[RabbitProjectQueueName(projectID)] = true
+	}
+	events := make(map[string]bool)
+	for _, event := range data.Events {
+		events[event] = true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.projects, m.events = projects, events
+}
+
+// Muted reports whether a message with the given headers is a muted project notification
+func (m *Mutes) Muted(headers map[string]interface{}) bool {
+	project, _ := headers["Project"].(string)
+	event, _ := headers["Event"].(string)
+	if project == "" {
+		return false
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.projects[project] || m.events[event] {
+		return true
+	}
+	if dot := strings.Index(event, "."); dot > 0 {
+		return m.events[event[:dot]+".*"]
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/streadway/amqp"
+)
+
+/**
+ * Reliable publishing: publisher confirms, bounded retries, and a dead-letter log for messages that could not be
+ * published. Counters are exported through expvar, under "rabbitmq", and served at /debug/vars on the debug port.
+ */
+
+// PublishMaxRetries is the number of times a message is retried after a failed publish, before it is dead-lettered
+var PublishMaxRetries = 4
+
+// PublishRetryBackoff is the delay before the first retry; it doubles for each subsequent retry, up to
+// maxPublishBackoff
+var PublishRetryBackoff = 100 * time.Millisecond
+
+// PublishConfirmTimeout is how long to wait for the broker to confirm a message
+var PublishConfirmTimeout = 5 * time.Second
+
+const maxPublishBackoff = 5 * time.Second
+
+var publishMetrics = expvar.NewMap("rabbitmq")
+
+var errPublishNacked = errors.New("RabbitMQ rejected the published message")
+var errConfirmTimeout = errors.New("Timed out waiting for RabbitMQ to confirm the published message")
+var errChannelClosed = errors.New("RabbitMQ channel closed")
+
+// PublishBackoff returns the delay before the given retry, starting from 1; it doubles from PublishRetryBackoff
+func PublishBackoff(retry int) time.Duration {
+	backoff := PublishRetryBackoff
+	for i := 1; i < retry && backoff < maxPublishBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPublishBackoff {
+		return maxPublishBackoff
+	}
+	return backoff
+}
+
+// confirmPublisher publishes on a channel in confirm mode, waiting for each message to be confirmed. The channel is
+// replaced if it fails.
+type confirmPublisher struct {
+	exchangeName string
+	ch           *amqp.Channel
+	confirms     chan amqp.Confirmation
+}
+
+func (p *confirmPublisher) open() error {
+	ch, err := GetChannel()
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		return errChannelClosed
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return err
+	}
+	p.ch = ch
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (p *confirmPublisher) close() {
+	if p.ch != nil {
+		p.ch.Close()
+		p.ch = nil
+	}
+}
+
+// publish publishes the message, retrying with exponential backoff until it is confirmed, PublishMaxRetries is
+// exceeded, or exit is closed. The last error is returned if the message could not be published.
+func (p *confirmPublisher) publish(message AMQPMessage, exit <-chan bool) error {
+	var err error
+	for attempt := 0; attempt <= PublishMaxRetries; attempt++ {
+		if attempt > 0 {
+			publishMetrics.Add("Retried", 1)
+			select {
+			case <-time.After(PublishBackoff(attempt)):
+			case <-exit:
+				return err
+			}
+		}
+
+		if p.ch == nil {
+			if err = p.open(); err != nil {
+				continue
+			}
+		}
+
+		err = p.publishOnce(message)
+		if err == nil {
+			publishMetrics.Add("Published", 1)
+			return nil
+		}
+		utils.LogWarn("Failed to publish AMQPMessage; retrying", utils.LogFields{
+			"RoutingKey": message.RoutingKey,
+			"Attempt":    attempt + 1,
+			"error":      err.Error(),
+		})
+		if err == errPublishNacked {
+			publishMetrics.Add("Nacked", 1)
+		} else {
+			// The channel may be broken, or have confirmations outstanding; start again on a new one.
+			p.close()
+		}
+	}
+	return err
+}
+
+func (p *confirmPublisher) publishOnce(message AMQPMessage) error {
+	deliveryMode := uint8(0)
+	if message.Persistent {
+		deliveryMode = 2
+	}
+
+	err := p.ch.Publish(
+		p.exchangeName,     // exchange
+		message.RoutingKey, // routing key
+		false,              // mandatory - must be placed on at least one queue, otherwise return to sender
+		false,              // immediate - must be delivered immediately. If no free workers, return to sender
+		amqp.Publishing{
+			Headers:      message.Headers,
+			ContentType:  strconv.Itoa(message.ContentType),
+			DeliveryMode: deliveryMode, // 0, 1 for transient, 2 for persistent
+			Body:         message.Message,
+		})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case confirm, ok := <-p.confirms:
+		if !ok {
+			return errChannelClosed
+		}
+		if !confirm.Ack {
+			return errPublishNacked
+		}
+		return nil
+	case <-time.After(PublishConfirmTimeout):
+		return errConfirmTimeout
+	}
+}
+
+var deadLetterMutex sync.Mutex
+var deadLetterLog io.Writer
+
+// SetDeadLetterLog sets where messages that could not be published are recorded, one JSON object per line. If it is
+// not set, they are only logged as errors.
+func SetDeadLetterLog(w io.Writer) {
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	deadLetterLog = w
+}
+
+// deadLetter is an entry in the dead-letter log
+type deadLetter struct {
+	Time        time.Time
+	RoutingKey  string
+	Headers     map[string]interface{}
+	ContentType int
+	Message     string
+	Error       string
+}
+
+// RecordDeadLetter records a message that could not be published, in the dead-letter log and metrics
+func RecordDeadLetter(message AMQPMessage, err error) {
+	publishMetrics.Add("DeadLettered", 1)
+	utils.LogError("Failed to publish AMQPMessage; giving up", err, utils.LogFields{
+		"RoutingKey": message.RoutingKey,
+		"Body":       string(message.Message),
+	})
+
+	deadLetterMutex.Lock()
+	defer deadLetterMutex.Unlock()
+
+	if deadLetterLog == nil {
+		return
+	}
+	entry := deadLetter{
+		Time:        time.Now(),
+		RoutingKey:  message.RoutingKey,
+		Headers:     message.Headers,
+		ContentType: message.ContentType,
+		Message:     string(message.Message),
+		Error:       err.Error(),
+	}
+	if err := json.NewEncoder(deadLetterLog).Encode(entry); err != nil {
+		utils.LogError("Failed to write to dead-letter log", err, nil)
+	}
+}
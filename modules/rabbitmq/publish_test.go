@@ -0,0 +1,57 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPublishBackoff(t *testing.T) {
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+	}
+	for i, backoff := range expected {
+		if PublishBackoff(i+1) != backoff {
+			t.Fatalf("Backoff for retry %d incorrect; expected %v, got %v", i+1, backoff, PublishBackoff(i+1))
+		}
+	}
+	if PublishBackoff(20) != maxPublishBackoff {
+		t.Fatalf("Backoff should be capped at %v, got %v", maxPublishBackoff, PublishBackoff(20))
+	}
+}
+
+func TestRecordDeadLetter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	SetDeadLetterLog(buf)
+	defer SetDeadLetterLog(nil)
+
+	before := publishMetrics.Get("DeadLettered")
+	message := AMQPMessage{
+		Headers:     map[string]interface{}{"Origin": "WS-host-1"},
+		RoutingKey:  RabbitProjectRoutingKey(1, 2, "File", "Change"),
+		ContentType: ContentTypeMsg,
+		Message:     []byte(`{"Type":"Notification"}`),
+	}
+	RecordDeadLetter(message, errors.New("publish failed"))
+
+	var entry deadLetter
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.RoutingKey != message.RoutingKey || entry.Message != string(message.Message) || entry.Error != "publish failed" {
+		t.Fatalf("Dead-letter entry incorrect: %+v", entry)
+	}
+	if entry.Headers["Origin"] != "WS-host-1" {
+		t.Fatal("Dead-letter entry should include the message headers")
+	}
+
+	after := publishMetrics.Get("DeadLettered")
+	if after == nil || (before != nil && after.String() == before.String()) {
+		t.Fatal("DeadLettered metric was not incremented")
+	}
+}
@@ -9,11 +9,20 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// MessageWriter sends messages to a websocket's client; it is implemented by *websocket.Conn
+type MessageWriter interface {
+	WriteMessage(messageType int, data []byte) error
+}
+
 // RabbitCommandHandler handles all rabbit commands (sub/unsub)
 type RabbitCommandHandler struct {
-	WSConn       *websocket.Conn
-	WSID         uint64
-	ExchangeName string
+	WSConn        MessageWriter
+	WSID          uint64
+	ExchangeName  string
+	Subscriptions *Subscriptions // The websocket's bound subscriptions; may be nil if they are not tracked
+	Mutes         *Mutes         // The notifications the websocket drops; may be nil if it drops none
+	Binder        QueueBinder    // Defaults to RabbitBroker
+	Disconnect    func()         // Closes the websocket, such as when its session is revoked; may be nil
 }
 
 // HandleCommand handles an individual command
@@ -30,6 +39,10 @@ func (r RabbitCommandHandler) HandleCommand(msg AMQPMessage) error {
 		return r.handleSubscribe(cmd)
 	case "Unsubscribe":
 		return r.handleUnsubscribe(cmd)
+	case "Mute":
+		return r.handleMute(cmd)
+	case "Disconnect":
+		return r.handleDisconnect()
 	default:
 		err := errors.New("Invalid rabbit command given")
 		utils.LogError("Invalid rabbit command given", err, utils.LogFields{
@@ -46,29 +59,38 @@ func (r RabbitCommandHandler) handleSubscribe(cmd RabbitCommandJSON) error {
 		return err
 	}
 
-	ch, err := GetChannel()
-	if err != nil {
-		return err
+	bindings := data.Bindings
+	if len(bindings) == 0 {
+		bindings = []string{data.Key}
 	}
 
-	msg := messages.NewEmptyResponse(messages.StatusSuccess, cmd.Tag)
-	err = BindQueue(ch, RabbitWebsocketQueueName(r.WSID), data.Key, r.ExchangeName)
-	if err != nil {
-		msg = messages.NewEmptyResponse(messages.StatusFail, cmd.Tag)
+	status := messages.StatusSuccess
+	for _, key := range bindings {
+		err = r.binder().BindQueue(RabbitWebsocketQueueName(r.WSID), key, r.ExchangeName)
+		if err != nil {
+			status = messages.StatusFail
+			break
+		}
 	}
 
-	// If no tag, do not send a response
-	// This is used in cases where we auto-register a client (ie, for username)
-	if cmd.Tag < 0 || r.WSConn == nil {
-		return nil
+	// Subscribing again replaces the subscription's filter; unbind the keys that are no longer wanted.
+	if status == messages.StatusSuccess && r.Subscriptions != nil {
+		wanted := make(map[string]bool)
+		for _, key := range bindings {
+			wanted[key] = true
+		}
+		for _, key := range r.Subscriptions.Replace(data.Key, bindings) {
+			if wanted[key] {
+				continue
+			}
+			err = r.binder().UnbindQueue(RabbitWebsocketQueueName(r.WSID), key, r.ExchangeName)
+			if err != nil {
+				status = messages.StatusFail
+			}
+		}
 	}
 
-	// Send response
-	msgJSON, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	return r.WSConn.WriteMessage(websocket.TextMessage, msgJSON)
+	return r.respond(cmd.Tag, status)
 }
 
 func (r RabbitCommandHandler) handleUnsubscribe(cmd RabbitCommandJSON) error {
@@ -78,25 +100,63 @@ func (r RabbitCommandHandler) handleUnsubscribe(cmd RabbitCommandJSON) error {
 		return err
 	}
 
-	ch, err := GetChannel()
+	var bindings []string
+	if r.Subscriptions != nil {
+		bindings = r.Subscriptions.Remove(data.Key)
+	}
+	if len(bindings) == 0 {
+		bindings = []string{data.Key}
+	}
+
+	status := messages.StatusSuccess
+	for _, key := range bindings {
+		err = r.binder().UnbindQueue(RabbitWebsocketQueueName(r.WSID), key, r.ExchangeName)
+		if err != nil {
+			status = messages.StatusFail
+		}
+	}
+
+	return r.respond(cmd.Tag, status)
+}
+
+func (r RabbitCommandHandler) handleMute(cmd RabbitCommandJSON) error {
+	var data MuteData
+	err := json.Unmarshal(cmd.Data, &data)
 	if err != nil {
 		return err
 	}
 
-	msg := messages.NewEmptyResponse(messages.StatusSuccess, cmd.Tag)
-	err = UnbindQueue(ch, RabbitWebsocketQueueName(r.WSID), data.Key, r.ExchangeName)
-	if err != nil {
-		msg = messages.NewEmptyResponse(messages.StatusFail, cmd.Tag)
+	if r.Mutes != nil {
+		r.Mutes.Set(data)
 	}
+	return r.respond(cmd.Tag, messages.StatusSuccess)
+}
+
+func (r RabbitCommandHandler) handleDisconnect() error {
+	if r.Disconnect == nil {
+		return errors.New("Websocket can't be disconnected")
+	}
+	r.Disconnect()
+	return nil
+}
+
+func (r RabbitCommandHandler) binder() QueueBinder {
+	if r.Binder == nil {
+		return RabbitBroker{}
+	}
+	return r.Binder
+}
 
+// respond sends the command's response to the websocket
+func (r RabbitCommandHandler) respond(tag int64, status int) error {
 	// If no tag, do not send a response
 	// This is used in cases where we auto-register a client (ie, for username)
-	if cmd.Tag < 0 || r.WSConn == nil {
+	if tag < 0 || r.WSConn == nil {
 		return nil
 	}
 
 	// Send response
-	msgJSON, err := json.Marshal(msg)
+	msgJSON, err := json.Marshal(messages.NewEmptyResponse(status, tag))
 	if err != nil {
 		return err
 	}
@@ -18,5 +18,6 @@ type RabbitCommandStruct struct {
 
 // RabbitQueueData represents the data needed to identify a specific RabbitMQ queue.
 type RabbitQueueData struct {
-	Key string
+	Key      string
+	Bindings []string // Routing keys to bind for the subscription; if empty, Key itself is bound
 }
@@ -3,10 +3,15 @@ package rabbitmq
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/utils"
+	"github.com/streadway/amqp"
 )
 
 /**
@@ -25,14 +30,49 @@ type AMQPConnCfg struct {
 }
 
 // ConnectionString returns the connection string, using amqps:// if TLSConfig has been set, amqp:// otherwise.
-func (cfg AMQPConnCfg) ConnectionString() string {
+// If a PasswordSecret is configured, it is resolved each time, so that rotated credentials are used on redial; an
+// error is returned if it can't be.
+func (cfg AMQPConnCfg) ConnectionString() (string, error) {
+	password, err := cfg.ResolvePassword()
+	if err != nil {
+		return "", err
+	}
+
+	connURL := url.URL{
+		Scheme: "amqp",
+		User:   url.UserPassword(cfg.Username, password),
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))),
+		Path:   "/",
+	}
 	if cfg.TLSConfig != nil {
-		return fmt.Sprintf("amqps://%s:%s@%s:%d/", cfg.Username, cfg.Password, cfg.Host, cfg.Port)
+		connURL.Scheme = "amqps"
+	}
+	return connURL.String(), nil
+}
+
+// saslMechanisms returns the EXTERNAL mechanism if authenticating with a client certificate and no username,
+// or nil to use the username and password from the connection string.
+func (cfg AMQPConnCfg) saslMechanisms() []amqp.Authentication {
+	if cfg.TLSConfig != nil && len(cfg.TLSConfig.Certificates) > 0 && cfg.Username == "" {
+		return []amqp.Authentication{externalAuth{}}
 	}
-	return fmt.Sprintf("amqp://%s:%s@%s:%d/", cfg.Username, cfg.Password, cfg.Host, cfg.Port)
+	return nil
+}
+
+// externalAuth implements the SASL EXTERNAL mechanism, where the broker authenticates the client from its TLS
+// certificate.
+type externalAuth struct{}
+
+func (externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (externalAuth) Response() string {
+	return ""
 }
 
-// AMQPExchCfg represents the basic variables of any exchange
+// AMQPExchCfg represents the basic variables of any exchange. Exchanges are declared as topic exchanges, so that
+// websockets can bind to a subset of a project's notifications; see RabbitProjectBindingKeys.
 type AMQPExchCfg struct {
 	ExchangeName string
 	Durable      bool
@@ -70,6 +110,10 @@ func (cfg AMQPSubCfg) QueueName() string {
 	return RabbitWebsocketQueueName(cfg.QueueID)
 }
 
+// RabbitBroadcastKey is the routing key every websocket's queue is bound to, for announcements to every connected
+// client
+const RabbitBroadcastKey = "Broadcast"
+
 // RabbitUserQueueName returns the name of the Queue a websocket for the given user would have
 func RabbitUserQueueName(username string) string {
 	return fmt.Sprintf("User-%s", username)
@@ -85,6 +129,19 @@ func RabbitProjectQueueName(projectID int64) string {
 	return fmt.Sprintf("Project-%d", projectID)
 }
 
+// ParseRabbitProjectQueueName returns the ID of the project with the given Queue name, or false if it is not the name
+// of a project's Queue
+func ParseRabbitProjectQueueName(queueName string) (int64, bool) {
+	if !strings.HasPrefix(queueName, "Project-") {
+		return 0, false
+	}
+	projectID, err := strconv.ParseInt(strings.TrimPrefix(queueName, "Project-"), 10, 64)
+	if err != nil || RabbitProjectQueueName(projectID) != queueName {
+		return 0, false
+	}
+	return projectID, true
+}
+
 // AMQPPubCfg represents the settings needed to create a new publisher
 type AMQPPubCfg struct {
 	PubErrHandler func(AMQPMessage) // Handler for publish errors
@@ -107,6 +164,7 @@ type AMQPMessage struct {
 	Persistent  bool
 	Message     []byte
 	ErrHandler  func()
+	Published   func() // Called, if set, once the publisher has published the message
 }
 
 const (
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/streadway/amqp"
 )
 
 func TestConnectionString(t *testing.T) {
@@ -20,9 +21,13 @@ func TestConnectionString(t *testing.T) {
 		},
 	}
 
-	if !strings.HasPrefix(connCfg.ConnectionString(), "amqp://") {
+	connString, err := connCfg.ConnectionString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(connString, "amqp://") {
 		t.Fatal("Connection protocol incorrect")
-	} else if !strings.HasSuffix(connCfg.ConnectionString(), "username:password@host:80/") {
+	} else if !strings.HasSuffix(connString, "username:password@host:80/") {
 		t.Fatal("Connection string incorrectly generated")
 	}
 
@@ -36,11 +41,52 @@ func TestConnectionString(t *testing.T) {
 		TLSConfig: &tls.Config{MinVersion: tls.VersionTLS12},
 	}
 
-	if !strings.HasPrefix(connCfgWithTLS.ConnectionString(), "amqps://") {
+	connString, err = connCfgWithTLS.ConnectionString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(connString, "amqps://") {
 		t.Fatal("Connection protocol incorrect")
-	} else if !strings.HasSuffix(connCfgWithTLS.ConnectionString(), "username:password@host:80/") {
+	} else if !strings.HasSuffix(connString, "username:password@host:80/") {
 		t.Fatal("Connection string incorrectly generated")
 	}
+
+	// Passwords, such as rotated secrets, may hold any character
+	connCfg.Password = "p@ss/w:rd?#"
+	connString, err = connCfg.ConnectionString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, err := amqp.ParseURI(connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Username != "username" || uri.Password != "p@ss/w:rd?#" || uri.Host != "host" || uri.Port != 80 {
+		t.Fatalf("Connection string incorrectly escaped: %s", connString)
+	}
+
+	connCfg.PasswordSecret = "file:/nonexistent/secret"
+	if _, err = connCfg.ConnectionString(); err == nil {
+		t.Fatal("Unresolvable passwords should not be replaced")
+	}
+}
+
+func TestSASLMechanisms(t *testing.T) {
+	connCfg := AMQPConnCfg{
+		ConnCfg: config.ConnCfg{
+			Username: "username",
+		},
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{{}}},
+	}
+	if connCfg.saslMechanisms() != nil {
+		t.Fatal("Username was given; should use PLAIN authentication")
+	}
+
+	connCfg.Username = ""
+	mechanisms := connCfg.saslMechanisms()
+	if len(mechanisms) != 1 || mechanisms[0].Mechanism() != "EXTERNAL" {
+		t.Fatal("Client certificate without username should use EXTERNAL authentication")
+	}
 }
 
 func TestQueueName(t *testing.T) {
@@ -65,3 +111,98 @@ func TestQueueName(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRabbitProjectQueueName(t *testing.T) {
+	projectID, ok := ParseRabbitProjectQueueName(RabbitProjectQueueName(42))
+	if !ok || projectID != 42 {
+		t.Fatalf("ParseRabbitProjectQueueName incorrect; got [%d, %t]", projectID, ok)
+	}
+
+	for _, queueName := range []string{"User-42", "Project-", "Project-042", "Project-42.#", "Project-+42"} {
+		if _, ok := ParseRabbitProjectQueueName(queueName); ok {
+			t.Fatalf("ParseRabbitProjectQueueName accepted [%s]", queueName)
+		}
+	}
+}
+
+func TestRabbitProjectBindingKeys(t *testing.T) {
+	routingKey := RabbitProjectRoutingKey(12, 34, "File", "Change")
+	if routingKey != "Project-12.File-34.File.Change" {
+		t.Fatalf("RabbitProjectRoutingKey incorrect; got [%s]", routingKey)
+	}
+	if key := RabbitProjectRoutingKey(12, 0, "Project", "Rename"); key != "Project-12.Project.Project.Rename" {
+		t.Fatalf("RabbitProjectRoutingKey incorrect; got [%s]", key)
+	}
+
+	tests := []struct {
+		filter   SubscriptionFilter
+		expected []string
+	}{
+		{SubscriptionFilter{}, []string{"Project-12.#"}},
+		{SubscriptionFilter{Events: []string{"File.Change", "File.*"}}, []string{"Project-12.*.File.Change", "Project-12.*.File.*"}},
+		{SubscriptionFilter{FileIDs: []int64{34, 34}}, []string{"Project-12.Project.#", "Project-12.File-34.#"}},
+		{SubscriptionFilter{Events: []string{"File.Change"}, FileIDs: []int64{34}}, []string{"Project-12.Project.File.Change", "Project-12.File-34.File.Change"}},
+	}
+	for _, test := range tests {
+		keys, err := RabbitProjectBindingKeys(12, test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(keys, ",") != strings.Join(test.expected, ",") {
+			t.Fatalf("RabbitProjectBindingKeys incorrect; expected %v, got %v", test.expected, keys)
+		}
+	}
+
+	for _, event := range []string{"File", "File.#", "*.Change", "File.Change.Extra", ""} {
+		_, err := RabbitProjectBindingKeys(12, SubscriptionFilter{Events: []string{event}})
+		if err != ErrInvalidSubscriptionEvent {
+			t.Fatalf("Event [%s] should be rejected", event)
+		}
+	}
+
+	fileIDs := make([]int64, MaxSubscriptionBindings)
+	for i := range fileIDs {
+		fileIDs[i] = int64(i + 1)
+	}
+	_, err := RabbitProjectBindingKeys(12, SubscriptionFilter{FileIDs: fileIDs})
+	if err != ErrTooManySubscriptionBindings {
+		t.Fatal("Filters needing too many bindings should be rejected")
+	}
+}
+
+func TestSubscriptions(t *testing.T) {
+	subs := NewSubscriptions()
+	if old := subs.Replace("Project-1", []string{"Project-1.#"}); len(old) != 0 {
+		t.Fatal("New subscription should have no previous bindings")
+	}
+	if old := subs.Replace("Project-1", []string{"Project-1.*.File.Change"}); len(old) != 1 || old[0] != "Project-1.#" {
+		t.Fatalf("Replace should return the previous bindings; got %v", old)
+	}
+	if old := subs.Remove("Project-1"); len(old) != 1 || old[0] != "Project-1.*.File.Change" {
+		t.Fatalf("Remove should return the current bindings; got %v", old)
+	}
+	if old := subs.Remove("Project-1"); len(old) != 0 {
+		t.Fatal("Removed subscription should have no bindings")
+	}
+}
+
+func TestMutes(t *testing.T) {
+	mutes := NewMutes()
+	change := map[string]interface{}{"Project": RabbitProjectQueueName(1), "Event": "File.Change"}
+	metadata := map[string]interface{}{"Project": RabbitProjectQueueName(1), "Event": "File.SetMetadata"}
+	otherProject := map[string]interface{}{"Project": RabbitProjectQueueName(2), "Event": "Project.Rename"}
+	direct := map[string]interface{}{"Origin": RabbitWebsocketQueueName(1)}
+	if mutes.Muted(change) || mutes.Muted(direct) {
+		t.Fatal("New mutes should drop nothing")
+	}
+
+	mutes.Set(MuteData{ProjectIDs: []int64{2}, Events: []string{"File.SetMetadata"}})
+	if mutes.Muted(change) || !mutes.Muted(metadata) || !mutes.Muted(otherProject) || mutes.Muted(direct) {
+		t.Fatal("Only the muted project and event should be dropped")
+	}
+
+	mutes.Set(MuteData{Events: []string{"File.*"}})
+	if !mutes.Muted(change) || !mutes.Muted(metadata) || mutes.Muted(otherProject) {
+		t.Fatal("Muting a resource should drop each of its methods, and setting mutes should replace them")
+	}
+}
@@ -55,15 +55,22 @@ func SetupRabbitExchange(cfg *AMQPConnCfg) error {
 
 			redialLoop:
 				for {
-					conn, err := amqp.DialConfig(cfg.ConnectionString(), amqp.Config{
-						Heartbeat: defaultHeartbeat,
-						Dial:      getNewDialer(cfg.Timeout),
-					})
+					var conn *amqp.Connection
+					connString, err := cfg.ConnectionString()
+					if err == nil {
+						conn, err = amqp.DialConfig(connString, amqp.Config{
+							SASL:            cfg.saslMechanisms(),
+							Heartbeat:       defaultHeartbeat,
+							TLSClientConfig: cfg.TLSConfig,
+							Dial:            getNewDialer(cfg.Timeout),
+						})
+					}
 					if err != nil {
 						utils.LogError("Failed to connect to RabbitMQ", err, utils.LogFields{
 							"Host": cfg.Host,
 							"Port": cfg.Port,
 						})
+						cfg.InvalidatePassword()
 						if retries >= cfg.NumRetries {
 							ready <- false
 							if channelQueue == nil {
@@ -97,7 +104,7 @@ func SetupRabbitExchange(cfg *AMQPConnCfg) error {
 					for _, exchange := range cfg.Exchanges {
 						err = ch.ExchangeDeclare(
 							exchange.ExchangeName, // name
-							"direct",              // type
+							"topic",               // type
 							exchange.Durable,      // durable
 							!exchange.Durable,     // auto-deleted
 							false,                 // internal
@@ -105,7 +112,10 @@ func SetupRabbitExchange(cfg *AMQPConnCfg) error {
 							nil,                   // arguments
 						)
 						if err != nil {
-							utils.LogError("Failed to declare exchange", err, nil)
+							utils.LogError("Failed to declare exchange", err, utils.LogFields{
+								"Exchange": exchange.ExchangeName,
+								"Hint":     "Exchanges declared as direct by older servers must be deleted before upgrading",
+							})
 							ch.Close()
 							conn.Close()
 							continue redialLoop
@@ -127,7 +137,14 @@ func SetupRabbitExchange(cfg *AMQPConnCfg) error {
 
 						select {
 						case <-cfg.Control.Exit:
-							break
+							// Closing the connection stops the publishers and subscribers using its channels; the
+							// exchange must be set up again before more are made
+							ch.Close()
+							conn.Close()
+							channelQueueCreationMutex.Lock()
+							channelQueue = nil
+							channelQueueCreationMutex.Unlock()
+							return
 						case channelQueue <- ch:
 						}
 					}
@@ -218,6 +235,17 @@ func RunSubscriber(cfg *AMQPPubSubCfg) error {
 		return err
 	}
 
+	// Exclusive queues live as long as the shared connection, and are only auto-deleted once they have had a consumer,
+	// so the websocket's queue is deleted explicitly when the subscriber exits
+	if !cfg.SubCfg.IsWorkQueue {
+		defer func() {
+			_, err := ch.QueueDelete(cfg.SubCfg.QueueName(), false, false, false)
+			utils.LogError("Failed to delete queue", err, utils.LogFields{
+				"Queue": cfg.SubCfg.QueueName(),
+			})
+		}()
+	}
+
 	for _, key := range append(cfg.SubCfg.Keys, cfg.SubCfg.QueueName()) {
 		err = BindQueue(ch,
 			cfg.SubCfg.QueueName(), // queue name
@@ -271,18 +299,20 @@ func RunSubscriber(cfg *AMQPPubSubCfg) error {
 }
 
 // RunPublisher creates a new publisher, and continually pushes messages submitted to the Go channel
-// to RabbitMQ.
+// to RabbitMQ. Messages are published with confirms, and retried if they fail; messages that still cannot be
+// published are dead-lettered, and passed to the PubErrHandler.
 func RunPublisher(cfg *AMQPPubSubCfg) error {
 	defer func() {
 		cfg.Control.Shutdown()
 	}()
 
-	ch, err := GetChannel()
+	publisher := &confirmPublisher{exchangeName: cfg.ExchangeName}
+	err := publisher.open()
 	if err != nil {
 		// Shut down subscriber if failed here.
 		return fmt.Errorf("RunPublisher: Failed to get new channel: %v", err)
 	}
-	defer ch.Close()
+	defer publisher.close()
 
 	// Signal that this Publisher is ready
 	cfg.Control.Ready.Done()
@@ -291,30 +321,14 @@ func RunPublisher(cfg *AMQPPubSubCfg) error {
 		case <-cfg.Control.Exit:
 			return nil
 		case message := <-cfg.PubCfg.Messages:
-
-			deliveryMode := uint8(0)
-			if message.Persistent {
-				deliveryMode = 2
-			}
-
-			err = ch.Publish(
-				cfg.ExchangeName,   // exchange
-				message.RoutingKey, // routing key
-				false,              // mandatory - must be placed on at least one queue, otherwise return to sender
-				false,              // immediate - must be delivered immediately. If no free workers, return to sender
-				amqp.Publishing{
-					Headers:      message.Headers,
-					ContentType:  strconv.Itoa(message.ContentType),
-					DeliveryMode: deliveryMode, // 0, 1 for transient, 2 for persistent
-					Body:         message.Message,
-				})
-
+			err = publisher.publish(message, cfg.Control.Exit)
 			if err != nil {
-				utils.LogError("Failed to publish AMQPMessage", err, utils.LogFields{
-					"RoutingKey": message.RoutingKey,
-					"Body":       string(message.Message),
-				})
-				// TODO (shapiro): decide on action at publish error: retry with count?
+				RecordDeadLetter(message, err)
+				if cfg.PubCfg.PubErrHandler != nil {
+					cfg.PubCfg.PubErrHandler(message)
+				}
+			} else if message.Published != nil {
+				message.Published()
 			}
 		}
 	}
@@ -0,0 +1,124 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+/**
+ * Routing keys and bindings for filtered project subscriptions.
+ *
+ * Project notifications are published to the topic exchange with keys of the form
+ *   Project-<ProjectID>.<Scope>.<Resource>.<Method>
+ * where Scope is "File-<FileID>" for notifications about an existing file, or "Project" for everything else (including
+ * new files). Websockets bind to the keys matching the projects, files and events they are interested in.
+ */
+
+// MaxSubscriptionBindings is the most routing keys a single project subscription may bind
+const MaxSubscriptionBindings = 100
+
+// ErrInvalidSubscriptionEvent is returned when a subscription filter contains an event that is not of the form
+// "Resource.Method" or "Resource.*"
+var ErrInvalidSubscriptionEvent = errors.New("Invalid event in subscription filter")
+
+// ErrTooManySubscriptionBindings is returned when a subscription filter would need more than MaxSubscriptionBindings
+// routing keys
+var ErrTooManySubscriptionBindings = errors.New("Subscription filter matches too many files and events")
+
+var subscriptionEventRegex = regexp.MustCompile(`^[A-Za-z]+\.([A-Za-z]+|\*)$`)
+
+// SubscriptionFilter limits the notifications a websocket receives for a project. Empty fields match everything.
+type SubscriptionFilter struct {
+	Events  []string // "Resource.Method" or "Resource.*", such as "File.Change"
+	FileIDs []int64  // Notifications about other files are dropped; project-wide notifications are still received
+}
+
+// RabbitProjectRoutingKey returns the routing key a project notification is published with. fileID is 0 for
+// notifications that are not about an existing file.
+func RabbitProjectRoutingKey(projectID int64, fileID int64, resource string, method string) string {
+	return fmt.Sprintf("%s.%s.%s.%s", RabbitProjectQueueName(projectID), projectScope(fileID), resource, method)
+}
+
+// RabbitProjectBindingKeys returns the routing keys to bind to receive the project's notifications matching the filter
+func RabbitProjectBindingKeys(projectID int64, filter SubscriptionFilter) ([]string, error) {
+	for _, event := range filter.Events {
+		if !subscriptionEventRegex.MatchString(event) {
+			return nil, ErrInvalidSubscriptionEvent
+		}
+	}
+
+	if len(filter.Events) == 0 && len(filter.FileIDs) == 0 {
+		return []string{RabbitProjectQueueName(projectID) + ".#"}, nil
+	}
+
+	scopes := []string{"*"}
+	if len(filter.FileIDs) > 0 {
+		scopes = []string{projectScope(0)}
+		for _, fileID := range filter.FileIDs {
+			scopes = append(scopes, projectScope(fileID))
+		}
+	}
+	events := filter.Events
+	if len(events) == 0 {
+		events = []string{"#"}
+	}
+	if len(scopes)*len(events) > MaxSubscriptionBindings {
+		return nil, ErrTooManySubscriptionBindings
+	}
+
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, scope := range scopes {
+		for _, event := range events {
+			key := fmt.Sprintf("%s.%s.%s", RabbitProjectQueueName(projectID), scope, event)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func projectScope(fileID int64) string {
+	if fileID == 0 {
+		return "Project"
+	}
+	return fmt.Sprintf("File-%d", fileID)
+}
+
+// Subscriptions records the routing keys bound for each of a websocket's subscriptions, so that they can be replaced
+// or unbound later.
+type Subscriptions struct {
+	bindings map[string][]string
+	mutex    sync.Mutex
+}
+
+// NewSubscriptions creates an empty Subscriptions
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{
+		bindings: make(map[string][]string),
+	}
+}
+
+// Replace records the bindings for the subscription key, returning the bindings previously recorded for it
+func (s *Subscriptions) Replace(key string, bindings []string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.bindings[key]
+	s.bindings[key] = bindings
+	return old
+}
+
+// Remove forgets the subscription key, returning the bindings recorded for it
+func (s *Subscriptions) Remove(key string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.bindings[key]
+	delete(s.bindings, key)
+	return old
+}
@@ -0,0 +1,228 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/utils"
+	"github.com/gorilla/websocket"
+)
+
+/**
+ * A read-only HTTP/JSON API, for dashboards and scripts that only need to fetch state:
+ *
+ *   GET /projects                 the sender's projects, as User.Projects returns them
+ *   GET /projects/{id}/files      the project's files, as Project.GetFiles returns them
+ *   GET /files/{id}/content       the file's current content
+ *   GET /users/{username}/avatar  the user's avatar, with its hash as its ETag
+ *
+ * Requests authenticate with HTTP basic auth, using the username and a login or API token as the password. They are
+ * processed as the equivalent WebSocket requests, so they are authorized the same way.
+ */
+
+// Paths are the paths under which the Handler must be registered
+var Paths = []string{"/projects", "/projects/", "/files/", "/users/"}
+
+// callBufferSize is the number of messages a request may produce
+const callBufferSize = 8
+
+var errNoResponse = errors.New("Request produced no response")
+
+// Handler serves the read API
+type Handler struct {
+	cfg           *config.Config
+	db            dbfs.DBFS
+	authenticator datahandling.Authenticator
+}
+
+// NewHandler creates a Handler that reads from db, handling requests as the server with the config, nil for the
+// process's, and the authenticator, if any, does; see datahandling.DataHandler
+func NewHandler(cfg *config.Config, db dbfs.DBFS, authenticator datahandling.Authenticator) *Handler {
+	return &Handler{cfg: cfg, db: db, authenticator: authenticator}
+}
+
+// response is the Response that a request was answered with
+type response struct {
+	Status int
+	Data   json.RawMessage
+}
+
+// ServeHTTP routes the request to the matching read operation
+func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	if !datahandling.ClientAllowed(h.cfg, request) {
+		http.Error(responseWriter, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if request.Method != "GET" {
+		responseWriter.Header().Set("Allow", "GET")
+		http.Error(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	username, token, ok := request.BasicAuth()
+	if !ok {
+		unauthorized(responseWriter)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "projects":
+		h.serveJSON(responseWriter, username, token, "User", "Projects", struct{}{})
+	case len(parts) == 3 && parts[0] == "projects" && parts[2] == "files":
+		projectID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			http.Error(responseWriter, "Not found", http.StatusNotFound)
+			return
+		}
+		h.serveJSON(responseWriter, username, token, "Project", "GetFiles", struct{ ProjectID int64 }{projectID})
+	case len(parts) == 3 && parts[0] == "files" && parts[2] == "content":
+		fileID, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			http.Error(responseWriter, "Not found", http.StatusNotFound)
+			return
+		}
+		h.serveFileContent(responseWriter, username, token, fileID)
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "avatar":
+		h.serveAvatar(responseWriter, request, username, token, parts[1])
+	default:
+		http.Error(responseWriter, "Not found", http.StatusNotFound)
+	}
+}
+
+func unauthorized(responseWriter http.ResponseWriter) {
+	responseWriter.Header().Set("WWW-Authenticate", `Basic realm="CodeCollaborate"`)
+	http.Error(responseWriter, "Unauthorized", http.StatusUnauthorized)
+}
+
+// call processes the request as the sender would over a WebSocket, and returns its response
+func (h *Handler) call(username, token, resource, method string, data interface{}) (response, error) {
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return response{}, err
+	}
+	reqJSON, err := json.Marshal(struct {
+		Tag         int64
+		Resource    string
+		SenderID    string
+		SenderToken string
+		Method      string
+		Timestamp   int64
+		Nonce       string
+		Data        json.RawMessage
+	}{0, resource, username, token, method, time.Now().Unix(), datahandling.NewNonce(), dataJSON})
+	if err != nil {
+		return response{}, err
+	}
+
+	messageChan := make(chan rabbitmq.AMQPMessage, callBufferSize)
+	dh := datahandling.DataHandler{
+		MessageChan:   messageChan,
+		Db:            h.db,
+		Config:        h.cfg,
+		Authenticator: h.authenticator,
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	dh.Handle(websocket.TextMessage, reqJSON, wg)
+	close(messageChan)
+
+	for msg := range messageChan {
+		if msg.ContentType != rabbitmq.ContentTypeMsg || msg.Headers["MessageType"] != "Response" {
+			continue
+		}
+		var wrapper struct {
+			ServerMessage response
+		}
+		err := json.Unmarshal(msg.Message, &wrapper)
+		return wrapper.ServerMessage, err
+	}
+	return response{}, errNoResponse
+}
+
+// writeStatus writes the HTTP status for an unsuccessful response, returning false if the response was successful
+func writeStatus(responseWriter http.ResponseWriter, res response, err error) bool {
+	switch {
+	case err != nil:
+		utils.LogError("REST request failed", err, nil)
+		http.Error(responseWriter, "Internal server error", http.StatusInternalServerError)
+	case res.Status == messages.StatusSuccess || res.Status == messages.StatusPartialFail:
+		return false
+	case res.Status == messages.StatusUnauthorized:
+		unauthorized(responseWriter)
+	case res.Status == messages.StatusFail || res.Status == messages.StatusNotFound:
+		// Reads only fail if what is being read does not exist
+		http.Error(responseWriter, "Not found", http.StatusNotFound)
+	default:
+		http.Error(responseWriter, "Internal server error", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// serveJSON writes the Data of the response to the request
+func (h *Handler) serveJSON(responseWriter http.ResponseWriter, username, token, resource, method string, data interface{}) {
+	res, err := h.call(username, token, resource, method, data)
+	if writeStatus(responseWriter, res, err) {
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.Write(res.Data)
+}
+
+// serveFileContent writes the file's content, with its pending changes applied
+func (h *Handler) serveFileContent(responseWriter http.ResponseWriter, username, token string, fileID int64) {
+	res, err := h.call(username, token, "File", "Pull", struct {
+		FileID      int64
+		Materialize bool
+	}{fileID, true})
+	if writeStatus(responseWriter, res, err) {
+		return
+	}
+
+	var pulled struct {
+		FileBytes []byte
+	}
+	err = json.Unmarshal(res.Data, &pulled)
+	if writeStatus(responseWriter, res, err) {
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/octet-stream")
+	responseWriter.Write(pulled.FileBytes)
+}
+
+// serveAvatar writes the user's avatar, or only that it has not changed if the request's ETag is still its hash
+func (h *Handler) serveAvatar(responseWriter http.ResponseWriter, request *http.Request, username, token, avatarUser string) {
+	res, err := h.call(username, token, "User", "GetAvatar", struct{ Username string }{avatarUser})
+	if writeStatus(responseWriter, res, err) {
+		return
+	}
+
+	var avatar struct {
+		AvatarHash string
+		Image      []byte
+	}
+	err = json.Unmarshal(res.Data, &avatar)
+	if writeStatus(responseWriter, res, err) {
+		return
+	}
+
+	// The URL stays the same when the avatar changes, so clients must revalidate, which is cheap with the ETag
+	etag := `"` + avatar.AvatarHash + `"`
+	responseWriter.Header().Set("ETag", etag)
+	responseWriter.Header().Set("Cache-Control", "private, no-cache")
+	if request.Header.Get("If-None-Match") == etag {
+		responseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	responseWriter.Header().Set("Content-Type", http.DetectContentType(avatar.Image))
+	responseWriter.Write(avatar.Image)
+}
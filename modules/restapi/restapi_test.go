@@ -0,0 +1,149 @@
+package restapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/auth"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, url, username, token string) (*http.Response, string) {
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if username != "" {
+		req.SetBasicAuth(username, token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestHandler(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "gene", Email: "gene@example.com"})
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "notgene", Email: "notgene@example.com"})
+	projectID, err := db.MySQLProjectCreate("gene", "rest")
+	require.NoError(t, err)
+	otherProjectID, err := db.MySQLProjectCreate("notgene", "private")
+	require.NoError(t, err)
+	fileID, err := db.MySQLFileCreate("gene", "file.txt", ".", projectID)
+	require.NoError(t, err)
+	_, err = db.FileWrite(".", "file.txt", projectID, []byte("helloworld"))
+	require.NoError(t, err)
+	_, _, _, _, err = db.CBAppendFileChange(dbfs.FileMeta{FileID: fileID}, "v0:\n0:+1:a:\n10")
+	require.NoError(t, err)
+
+	rawToken, hash, err := auth.NewToken()
+	require.NoError(t, err)
+	_, err = db.MySQLAPITokenCreate(hash, dbfs.APITokenMeta{Username: "gene", Name: "dashboard", Scope: "read"}, 0)
+	require.NoError(t, err)
+	token := "ccapi_" + rawToken
+
+	server := httptest.NewServer(NewHandler(nil, db, nil))
+	defer server.Close()
+
+	resp, body := get(t, server.URL+"/projects", "gene", token)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var projects struct {
+		Projects []struct{ ProjectID int64 }
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &projects))
+	require.Len(t, projects.Projects, 1)
+	assert.Equal(t, projectID, projects.Projects[0].ProjectID)
+
+	resp, body = get(t, server.URL+"/projects/"+strconv.FormatInt(projectID, 10)+"/files", "gene", token)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	var files struct {
+		Files []struct {
+			FileID   int64
+			Filename string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &files))
+	require.Len(t, files.Files, 1)
+	assert.Equal(t, "file.txt", files.Files[0].Filename)
+
+	// Content has the pending changes applied
+	resp, body = get(t, server.URL+"/files/"+strconv.FormatInt(fileID, 10)+"/content", "gene", token)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, "ahelloworld", body)
+
+	// Other users' projects, missing credentials and bad tokens are refused
+	resp, _ = get(t, server.URL+"/projects/"+strconv.FormatInt(otherProjectID, 10)+"/files", "gene", token)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp, _ = get(t, server.URL+"/projects", "", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+	resp, _ = get(t, server.URL+"/projects", "gene", "ccapi_wrong")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = get(t, server.URL+"/files/abc/content", "gene", token)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+"/projects", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestHandler_Avatar(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+
+	db := dbfs.NewDBMock()
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "gene", Email: "gene@example.com"})
+	db.MySQLUserRegister(dbfs.UserMeta{Username: "notgene", Email: "notgene@example.com"})
+	avatar := &bytes.Buffer{}
+	require.NoError(t, png.Encode(avatar, image.NewGray(image.Rect(0, 0, 8, 8))))
+	hash, err := db.AvatarWrite("notgene", avatar.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, db.MySQLUserSetAvatar("notgene", hash))
+
+	rawToken, tokenHash, err := auth.NewToken()
+	require.NoError(t, err)
+	_, err = db.MySQLAPITokenCreate(tokenHash, dbfs.APITokenMeta{Username: "gene", Name: "dashboard", Scope: "read"}, 0)
+	require.NoError(t, err)
+	token := "ccapi_" + rawToken
+
+	server := httptest.NewServer(NewHandler(nil, db, nil))
+	defer server.Close()
+
+	resp, body := get(t, server.URL+"/users/notgene/avatar", "gene", token)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `"`+hash+`"`, resp.Header.Get("ETag"))
+	assert.Equal(t, avatar.String(), body)
+
+	// Clients that have the current avatar are told it hasn't changed
+	req, err := http.NewRequest("GET", server.URL+"/users/notgene/avatar", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("gene", token)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = get(t, server.URL+"/users/gene/avatar", "gene", token)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, server.URL+"/users/nobody/avatar", "gene", token)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
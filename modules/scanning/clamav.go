@@ -0,0 +1,99 @@
+package scanning
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+// defaultClamAVPort is the port clamd listens on by default
+const defaultClamAVPort = 3310
+
+// clamAVChunkSize is the size of the chunks content is streamed to clamd in; clamd's StreamMaxLength limits the total
+const clamAVChunkSize = 64 * 1024
+
+// ClamAVScanner scans contents with a ClamAV daemon (clamd), streaming them over its INSTREAM command. The connection's
+// Host may be the path of clamd's unix socket, rather than a host name.
+type ClamAVScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamAVScanner creates a scanner for the clamd described by the connection config
+func NewClamAVScanner(connCfg config.ConnCfg) *ClamAVScanner {
+	timeout := time.Duration(connCfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	if strings.HasPrefix(connCfg.Host, "/") {
+		return &ClamAVScanner{network: "unix", address: connCfg.Host, timeout: timeout}
+	}
+	port := int(connCfg.Port)
+	if port == 0 {
+		port = defaultClamAVPort
+	}
+	return &ClamAVScanner{
+		network: "tcp",
+		address: net.JoinHostPort(connCfg.Host, strconv.Itoa(port)),
+		timeout: timeout,
+	}
+}
+
+// Scan streams the content to clamd, and parses its verdict
+func (c *ClamAVScanner) Scan(content []byte) (Result, error) {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(c.timeout))
+
+	writer := bufio.NewWriter(conn)
+	writer.WriteString("zINSTREAM\x00")
+	size := make([]byte, 4)
+	for len(content) > 0 {
+		chunk := content
+		if len(chunk) > clamAVChunkSize {
+			chunk = chunk[:clamAVChunkSize]
+		}
+		content = content[len(chunk):]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		writer.Write(size)
+		writer.Write(chunk)
+	}
+	// A zero-length chunk ends the stream
+	binary.BigEndian.PutUint32(size, 0)
+	writer.Write(size)
+	if err := writer.Flush(); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil {
+		return Result{}, err
+	}
+	return parseClamAVReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+// parseClamAVReply parses replies of the form "stream: OK" or "stream: <signature> FOUND"
+func parseClamAVReply(reply string) (Result, error) {
+	verdict := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	case strings.HasSuffix(verdict, " ERROR"):
+		return Result{}, errors.New("clamd: " + strings.TrimSuffix(verdict, " ERROR"))
+	default:
+		return Result{}, fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+}
@@ -0,0 +1,99 @@
+package scanning
+
+import (
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Malware scanning of file contents. Files are scanned when they are created, and again when their changes are
+ * scrunched into them, since that is when their full contents are written to disk.
+ */
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected  bool
+	Signature string // The name of the signature that matched, if infected
+}
+
+// Scanner checks file contents for malware
+type Scanner interface {
+	// Scan returns the verdict for the content. Errors mean the content could not be scanned, not that it is infected.
+	Scan(content []byte) (Result, error)
+}
+
+var scannerMutex sync.RWMutex
+var scanners = make(map[*config.Config]Scanner) // By the config of the server they scan for; nil for the process's
+var scannersSet = make(map[*config.Config]bool) // Distinguishes a default of no scanner from one not yet chosen
+
+// SetScanner sets the scanner returned by GetScanner; nil restores the default.
+func SetScanner(s Scanner) {
+	SetScannerFor(nil, s)
+}
+
+// SetScannerFor sets the scanner of the server with the config; a nil config is the process's. Setting a nil scanner
+// restores the default.
+func SetScannerFor(cfg *config.Config, s Scanner) {
+	cfg = processKey(cfg)
+	scannerMutex.Lock()
+	defer scannerMutex.Unlock()
+
+	scanners[cfg] = s
+	scannersSet[cfg] = s != nil
+}
+
+// GetScanner returns the content scanner, or nil if contents are not scanned. If none has been set, uses a
+// ClamAVScanner if a "ClamAV" connection is configured.
+func GetScanner() Scanner {
+	return ScannerFor(nil)
+}
+
+// ScannerFor returns the scanner of the server with the config, or the process's if the config is nil or the
+// process's; nil if contents are not scanned. If none has been set, one is made from the config as GetScanner's is.
+func ScannerFor(cfg *config.Config) Scanner {
+	cfg = processKey(cfg)
+
+	scannerMutex.RLock()
+	s, set := scanners[cfg], scannersSet[cfg]
+	scannerMutex.RUnlock()
+	if set {
+		return s
+	}
+
+	scannerMutex.Lock()
+	defer scannerMutex.Unlock()
+	if !scannersSet[cfg] {
+		defaultCfg := cfg
+		if defaultCfg == nil {
+			defaultCfg = config.GetConfig()
+		}
+		scanners[cfg] = newDefaultScanner(defaultCfg)
+		scannersSet[cfg] = true
+	}
+	return scanners[cfg]
+}
+
+// processKey returns nil for the process's config, under which its scanner is kept
+func processKey(cfg *config.Config) *config.Config {
+	if cfg == config.GetConfig() {
+		return nil
+	}
+	return cfg
+}
+
+func newDefaultScanner(cfg *config.Config) Scanner {
+	if cfg == nil {
+		return nil
+	}
+	connCfg, ok := cfg.ConnectionConfig["ClamAV"]
+	if !ok || connCfg.Host == "" {
+		return nil
+	}
+	utils.LogInfo("Scanning file contents with ClamAV", utils.LogFields{
+		"Host": connCfg.Host,
+		"Port": connCfg.Port,
+	})
+	return NewClamAVScanner(connCfg)
+}
@@ -0,0 +1,30 @@
+package scanning
+
+import (
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type cleanScanner struct{}
+
+func (cleanScanner) Scan(content []byte) (Result, error) {
+	return Result{}, nil
+}
+
+func TestScannerFor(t *testing.T) {
+	SetScanner(cleanScanner{})
+	defer SetScanner(nil)
+
+	serverCfg := &config.Config{
+		ConnectionConfig: config.ConnCfgMap{"ClamAV": {Host: "clamav.example.com", Port: 3310}},
+	}
+	defer SetScannerFor(serverCfg, nil)
+	assert.Equal(t, cleanScanner{}, ScannerFor(nil))
+	assert.IsType(t, &ClamAVScanner{}, ScannerFor(serverCfg), "a server's default scanner should be made from its own config")
+
+	otherCfg := &config.Config{}
+	defer SetScannerFor(otherCfg, nil)
+	assert.Nil(t, ScannerFor(otherCfg), "servers without a ClamAV connection should not scan")
+}
@@ -0,0 +1,237 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+)
+
+// defaultElasticsearchIndex is used if the connection's Schema is not set
+const defaultElasticsearchIndex = "codecollaborate-files"
+
+// ElasticsearchIndexer indexes documents in an Elasticsearch cluster, through its REST API; use for deployments with
+// several servers, or projects too large to index in memory.
+//
+// Elasticsearch only finds files containing the query's words as a phrase; matching lines are then found in the
+// returned files the same way as by the MemoryIndexer.
+type ElasticsearchIndexer struct {
+	baseURL  string // Including the index name
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewElasticsearchIndexer creates an indexer for the cluster described by the connection config. The connection's
+// Schema is used as the index name.
+func NewElasticsearchIndexer(connCfg config.ConnCfg) (*ElasticsearchIndexer, error) {
+	tlsConfig, err := connCfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	password, err := connCfg.ResolvePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "http"
+	if connCfg.UseTLS {
+		scheme = "https"
+	}
+	host := connCfg.Host
+	if connCfg.Port != 0 {
+		host = net.JoinHostPort(connCfg.Host, strconv.Itoa(int(connCfg.Port)))
+	}
+	index := connCfg.Schema
+	if index == "" {
+		index = defaultElasticsearchIndex
+	}
+	timeout := time.Duration(connCfg.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &ElasticsearchIndexer{
+		baseURL:  scheme + "://" + host + "/" + index,
+		username: connCfg.Username,
+		password: password,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}, nil
+}
+
+// Index adds or replaces the document for a file
+func (es *ElasticsearchIndexer) Index(doc Document) error {
+	return es.do("PUT", "/_doc/"+strconv.FormatInt(doc.FileID, 10), doc, nil)
+}
+
+// Delete removes a file from the index
+func (es *ElasticsearchIndexer) Delete(fileID int64) error {
+	err := es.do("DELETE", "/_doc/"+strconv.FormatInt(fileID, 10), nil, nil)
+	if err == errESNotFound {
+		return nil
+	}
+	return err
+}
+
+// DeleteProject removes all of a project's files from the index
+func (es *ElasticsearchIndexer) DeleteProject(projectID int64) error {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"term": map[string]interface{}{"ProjectID": projectID},
+		},
+	}
+	err := es.do("POST", "/_delete_by_query", body, nil)
+	if err == errESNotFound {
+		return nil
+	}
+	return err
+}
+
+// Missing returns those of the given files that have not been indexed
+func (es *ElasticsearchIndexer) Missing(fileIDs []int64) ([]int64, error) {
+	if len(fileIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(fileIDs))
+	for i, fileID := range fileIDs {
+		ids[i] = strconv.FormatInt(fileID, 10)
+	}
+	result := struct {
+		Docs []struct {
+			ID    string `json:"_id"`
+			Found bool   `json:"found"`
+		} `json:"docs"`
+	}{}
+	err := es.do("POST", "/_mget?_source=false", map[string]interface{}{"ids": ids}, &result)
+	if err == errESNotFound {
+		// The index has not been created yet
+		return fileIDs, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var missing []int64
+	for _, doc := range result.Docs {
+		if !doc.Found {
+			fileID, err := strconv.ParseInt(doc.ID, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			missing = append(missing, fileID)
+		}
+	}
+	return missing, nil
+}
+
+// Search returns the lines matching the query, ordered by path and line
+func (es *ElasticsearchIndexer) Search(query Query) ([]Match, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"ProjectID": query.ProjectID}},
+	}
+	if query.FileID != 0 {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"FileID": query.FileID}})
+	}
+	body := map[string]interface{}{
+		// Each file has at least one matching line
+		"size": query.MaxResults,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+				"must": map[string]interface{}{
+					"match_phrase": map[string]interface{}{"Content": query.Text},
+				},
+			},
+		},
+	}
+	result := struct {
+		Hits struct {
+			Hits []struct {
+				Source Document `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}{}
+	err = es.do("POST", "/_search", body, &result)
+	if err == errESNotFound {
+		return []Match{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	docs := make([]Document, len(result.Hits.Hits))
+	for i, hit := range result.Hits.Hits {
+		docs[i] = hit.Source
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Path < docs[j].Path
+	})
+
+	matches := []Match{}
+	for _, doc := range docs {
+		matches = append(matches, matchLines(doc, query.Text, query.MaxResults-len(matches))...)
+		if len(matches) >= query.MaxResults {
+			break
+		}
+	}
+	return matches, nil
+}
+
+var errESNotFound = errors.New("elasticsearch: not found")
+
+// do sends the request to the index, and decodes the response into result, if it is not nil.
+func (es *ElasticsearchIndexer) do(method string, path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, es.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if es.username != "" {
+		req.SetBasicAuth(es.username, es.password)
+	}
+
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errESNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("elasticsearch: %s %s returned status %d: %s", method, path, resp.StatusCode, msg)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
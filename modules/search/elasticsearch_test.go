@@ -0,0 +1,113 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestElasticsearch fakes the parts of the Elasticsearch API used by the indexer, for the index "files"
+func newTestElasticsearch(t *testing.T) (*httptest.Server, map[string]Document) {
+	docs := make(map[string]Document)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/files/_doc/"):
+			var doc Document
+			json.NewDecoder(r.Body).Decode(&doc)
+			docs[strings.TrimPrefix(r.URL.Path, "/files/_doc/")] = doc
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/files/_doc/"):
+			id := strings.TrimPrefix(r.URL.Path, "/files/_doc/")
+			if _, ok := docs[id]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(docs, id)
+		case r.Method == "POST" && r.URL.Path == "/files/_mget":
+			body := struct{ IDs []string }{}
+			json.NewDecoder(r.Body).Decode(&body)
+			result := []map[string]interface{}{}
+			for _, id := range body.IDs {
+				_, found := docs[id]
+				result = append(result, map[string]interface{}{"_id": id, "found": found})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"docs": result})
+		case r.Method == "POST" && r.URL.Path == "/files/_search":
+			body := struct {
+				Query struct {
+					Bool struct {
+						Filter []struct {
+							Term map[string]int64
+						}
+						Must struct {
+							MatchPhrase map[string]string `json:"match_phrase"`
+						}
+					}
+				}
+			}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			projectID := body.Query.Bool.Filter[0].Term["ProjectID"]
+			text := strings.ToLower(body.Query.Bool.Must.MatchPhrase["Content"])
+
+			hits := []map[string]interface{}{}
+			for _, doc := range docs {
+				if doc.ProjectID == projectID && strings.Contains(strings.ToLower(doc.Content), text) {
+					hits = append(hits, map[string]interface{}{"_source": doc})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"hits": map[string]interface{}{"hits": hits}})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	return server, docs
+}
+
+func TestElasticsearchIndexer(t *testing.T) {
+	server, docs := newTestElasticsearch(t)
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+	es, err := NewElasticsearchIndexer(config.ConnCfg{
+		Host:     serverURL.Hostname(),
+		Port:     uint16(port),
+		Username: "elastic",
+		Password: "secret",
+		Schema:   "files",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, es.Index(Document{FileID: 1, ProjectID: 1, Path: "b.txt", Content: "first\nsecond line"}))
+	assert.NoError(t, es.Index(Document{FileID: 2, ProjectID: 1, Path: "a.txt", Content: "Second"}))
+	assert.NoError(t, es.Index(Document{FileID: 3, ProjectID: 2, Path: "c.txt", Content: "second"}))
+	assert.Len(t, docs, 3)
+
+	matches, err := es.Search(Query{ProjectID: 1, Text: "second"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Match{
+		{FileID: 2, Path: "a.txt", Line: 1, Snippet: "Second"},
+		{FileID: 1, Path: "b.txt", Line: 2, Snippet: "second line"},
+	}, matches)
+
+	missing, err := es.Missing([]int64{1, 5})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{5}, missing)
+
+	assert.NoError(t, es.Delete(1))
+	assert.NoError(t, es.Delete(1), "deleting an unindexed file should succeed")
+	assert.Len(t, docs, 2)
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+// IngestDelay is how long a file must go without changes before it is reindexed. Files being edited change many
+// times a second, and reindexing loads and patches the whole file.
+var IngestDelay = 2 * time.Second
+
+// Loader returns the current document for a file, or ok=false if the file no longer exists.
+type Loader func() (doc Document, ok bool, err error)
+
+// ingestKey identifies a file in the index of the server with the config; nil for the process's
+type ingestKey struct {
+	cfg    *config.Config
+	fileID int64
+}
+
+var ingestMutex sync.Mutex
+var pendingIngests = make(map[ingestKey]*time.Timer)
+
+// ScheduleIndex reindexes the file in the index of the server with the config, with the document returned by load,
+// once the file has not been rescheduled for IngestDelay. A nil config is the process's.
+func ScheduleIndex(cfg *config.Config, fileID int64, load Loader) {
+	ingestMutex.Lock()
+	defer ingestMutex.Unlock()
+
+	key := ingestKey{cfg: processKey(cfg), fileID: fileID}
+
+	if pending, ok := pendingIngests[key]; ok {
+		pending.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(IngestDelay, func() {
+		ingestMutex.Lock()
+		// A newer change may have rescheduled the file while this was firing
+		if pendingIngests[key] == timer {
+			delete(pendingIngests, key)
+		}
+		ingestMutex.Unlock()
+
+		if err := IndexNow(cfg, fileID, load); err != nil {
+			utils.LogError("Search: failed to index file", err, utils.LogFields{
+				"FileID": fileID,
+			})
+		}
+	})
+	pendingIngests[key] = timer
+}
+
+// IndexNow loads and indexes a file immediately in the index of the server with the config. Files that no longer exist
+// are removed from the index.
+func IndexNow(cfg *config.Config, fileID int64, load Loader) error {
+	doc, ok, err := load()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return IndexerFor(cfg).Delete(fileID)
+	}
+	return IndexerFor(cfg).Index(doc)
+}
+
+// Unindex removes the file from the index of the server with the config, cancelling any pending reindex.
+func Unindex(cfg *config.Config, fileID int64) error {
+	key := ingestKey{cfg: processKey(cfg), fileID: fileID}
+	ingestMutex.Lock()
+	if pending, ok := pendingIngests[key]; ok {
+		pending.Stop()
+		delete(pendingIngests, key)
+	}
+	ingestMutex.Unlock()
+
+	return IndexerFor(cfg).Delete(fileID)
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleIndex(t *testing.T) {
+	mi := NewMemoryIndexer()
+	SetIndexer(mi)
+	defer SetIndexer(nil)
+
+	oldDelay := IngestDelay
+	IngestDelay = 50 * time.Millisecond
+	defer func() { IngestDelay = oldDelay }()
+
+	var loads int32
+	load := func() (Document, bool, error) {
+		atomic.AddInt32(&loads, 1)
+		return Document{FileID: 1, ProjectID: 1, Path: "a.txt", Content: "indexed"}, true, nil
+	}
+	for i := 0; i < 5; i++ {
+		ScheduleIndex(nil, 1, load)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "rapid changes should be indexed once")
+	matches, _ := mi.Search(Query{ProjectID: 1, Text: "indexed"})
+	assert.Len(t, matches, 1)
+
+	ScheduleIndex(nil, 1, load)
+	assert.NoError(t, Unindex(nil, 1))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "unindexing should cancel the pending reindex")
+	missing, _ := mi.Missing([]int64{1})
+	assert.Equal(t, []int64{1}, missing)
+}
+
+func TestScheduleIndex_ServerIndexer(t *testing.T) {
+	processIndexer := NewMemoryIndexer()
+	SetIndexer(processIndexer)
+	defer SetIndexer(nil)
+	serverCfg := &config.Config{}
+	serverIndexer := NewMemoryIndexer()
+	SetIndexerFor(serverCfg, serverIndexer)
+	defer SetIndexerFor(serverCfg, nil)
+
+	oldDelay := IngestDelay
+	IngestDelay = 50 * time.Millisecond
+	defer func() { IngestDelay = oldDelay }()
+
+	load := func(content string) Loader {
+		return func() (Document, bool, error) {
+			return Document{FileID: 1, ProjectID: 1, Path: "a.txt", Content: content}, true, nil
+		}
+	}
+	// The servers' databases may both have a file 1; neither's reindex cancels the other's
+	ScheduleIndex(nil, 1, load("process"))
+	ScheduleIndex(serverCfg, 1, load("server"))
+	time.Sleep(200 * time.Millisecond)
+
+	matches, _ := processIndexer.Search(Query{ProjectID: 1, Text: "process"})
+	assert.Len(t, matches, 1)
+	matches, _ = serverIndexer.Search(Query{ProjectID: 1, Text: "server"})
+	assert.Len(t, matches, 1)
+	matches, _ = processIndexer.Search(Query{ProjectID: 1, Text: "server"})
+	assert.Empty(t, matches, "a server's files should be indexed in its own indexer")
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryIndexer is an embedded index, kept in process memory. It is lost on restart, and rebuilt as projects are
+// searched; it suits single-server deployments and development.
+type MemoryIndexer struct {
+	docs  map[int64]Document
+	mutex sync.RWMutex
+}
+
+// NewMemoryIndexer creates an empty MemoryIndexer
+func NewMemoryIndexer() *MemoryIndexer {
+	return &MemoryIndexer{
+		docs: make(map[int64]Document),
+	}
+}
+
+// Index adds or replaces the document for a file
+func (mi *MemoryIndexer) Index(doc Document) error {
+	mi.mutex.Lock()
+	defer mi.mutex.Unlock()
+
+	mi.docs[doc.FileID] = doc
+	return nil
+}
+
+// Delete removes a file from the index
+func (mi *MemoryIndexer) Delete(fileID int64) error {
+	mi.mutex.Lock()
+	defer mi.mutex.Unlock()
+
+	delete(mi.docs, fileID)
+	return nil
+}
+
+// DeleteProject removes all of a project's files from the index
+func (mi *MemoryIndexer) DeleteProject(projectID int64) error {
+	mi.mutex.Lock()
+	defer mi.mutex.Unlock()
+
+	for fileID, doc := range mi.docs {
+		if doc.ProjectID == projectID {
+			delete(mi.docs, fileID)
+		}
+	}
+	return nil
+}
+
+// Missing returns those of the given files that have not been indexed
+func (mi *MemoryIndexer) Missing(fileIDs []int64) ([]int64, error) {
+	mi.mutex.RLock()
+	defer mi.mutex.RUnlock()
+
+	var missing []int64
+	for _, fileID := range fileIDs {
+		if _, ok := mi.docs[fileID]; !ok {
+			missing = append(missing, fileID)
+		}
+	}
+	return missing, nil
+}
+
+// Search returns the lines matching the query, ordered by path and line
+func (mi *MemoryIndexer) Search(query Query) ([]Match, error) {
+	query, err := query.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	mi.mutex.RLock()
+	var docs []Document
+	for _, doc := range mi.docs {
+		if doc.ProjectID == query.ProjectID && (query.FileID == 0 || doc.FileID == query.FileID) {
+			docs = append(docs, doc)
+		}
+	}
+	mi.mutex.RUnlock()
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Path < docs[j].Path
+	})
+
+	matches := []Match{}
+	for _, doc := range docs {
+		matches = append(matches, matchLines(doc, query.Text, query.MaxResults-len(matches))...)
+		if len(matches) >= query.MaxResults {
+			break
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIndexer(t *testing.T) {
+	mi := NewMemoryIndexer()
+	mi.Index(Document{FileID: 1, ProjectID: 1, Path: "src/b.go", Content: "package b\n\nfunc Hello() {}\n"})
+	mi.Index(Document{FileID: 2, ProjectID: 1, Path: "src/a.go", Content: "package a\n// hello, world\r\nfunc main() { hello() }"})
+	mi.Index(Document{FileID: 3, ProjectID: 2, Path: "other.go", Content: "hello from another project"})
+
+	matches, err := mi.Search(Query{ProjectID: 1, Text: "HELLO"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Match{
+		{FileID: 2, Path: "src/a.go", Line: 2, Snippet: "// hello, world"},
+		{FileID: 2, Path: "src/a.go", Line: 3, Snippet: "func main() { hello() }"},
+		{FileID: 1, Path: "src/b.go", Line: 3, Snippet: "func Hello() {}"},
+	}, matches, "matches should be ordered by path and line, and only from the project")
+
+	matches, err = mi.Search(Query{ProjectID: 1, FileID: 1, Text: "hello"})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+
+	matches, err = mi.Search(Query{ProjectID: 1, Text: "hello", MaxResults: 2})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 2)
+
+	_, err = mi.Search(Query{ProjectID: 1, Text: "  "})
+	assert.Equal(t, ErrEmptyQuery, err)
+
+	missing, err := mi.Missing([]int64{1, 2, 4})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4}, missing)
+
+	mi.Delete(2)
+	matches, _ = mi.Search(Query{ProjectID: 1, Text: "hello"})
+	assert.Len(t, matches, 1)
+
+	mi.DeleteProject(1)
+	matches, _ = mi.Search(Query{ProjectID: 1, Text: "hello"})
+	assert.Empty(t, matches)
+	matches, _ = mi.Search(Query{ProjectID: 2, Text: "hello"})
+	assert.Len(t, matches, 1, "other projects should be unaffected")
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("a", maxSnippetLength-1) + "é"
+	assert.Equal(t, strings.Repeat("a", maxSnippetLength-1), snippet(long), "snippets should not split characters")
+	assert.Equal(t, "short", snippet("\tshort  "))
+}
+
+func TestIndexable(t *testing.T) {
+	assert.True(t, Indexable([]byte("plain text")))
+	assert.False(t, Indexable([]byte{0x89, 'P', 'N', 'G', 0x00}))
+}
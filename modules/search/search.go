@@ -0,0 +1,193 @@
+package search
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Full-text search over project files.
+ *
+ * Files are indexed with their fully patched ("scrunched") contents, so that clients can search projects they have not
+ * pulled. Matches are reported per line. The index is kept up to date by the file requests; see Ingester.
+ */
+
+// Document is the indexed form of a file
+type Document struct {
+	FileID    int64
+	ProjectID int64
+	Path      string // Relative path and filename within the project
+	Content   string
+}
+
+// Match is a single line of a file that matches a query
+type Match struct {
+	FileID  int64
+	Path    string
+	Line    int // 1-based
+	Snippet string
+}
+
+// Query is a search over a project, or a single file in it
+type Query struct {
+	ProjectID  int64
+	FileID     int64 // If set, only this file is searched
+	Text       string
+	MaxResults int
+}
+
+// Indexer stores documents and searches them
+type Indexer interface {
+	// Index adds or replaces the document for a file
+	Index(doc Document) error
+	// Delete removes a file from the index; deleting a file that is not indexed is not an error
+	Delete(fileID int64) error
+	// DeleteProject removes all of a project's files from the index
+	DeleteProject(projectID int64) error
+	// Missing returns those of the given files that have not been indexed
+	Missing(fileIDs []int64) ([]int64, error)
+	// Search returns the lines matching the query, ordered by path and line
+	Search(query Query) ([]Match, error)
+}
+
+// DefaultMaxResults is used for queries that do not set MaxResults, and is also the most a query may request
+const DefaultMaxResults = 100
+
+// maxSnippetLength is the number of characters of a matching line returned in snippets
+const maxSnippetLength = 200
+
+// ErrEmptyQuery is returned when searching for an empty string
+var ErrEmptyQuery = errors.New("The search query is empty")
+
+var indexerMutex sync.RWMutex
+var indexers = make(map[*config.Config]Indexer) // By the config of the server they index for; nil for the process's
+
+// SetIndexer sets the indexer used by GetIndexer.
+func SetIndexer(i Indexer) {
+	SetIndexerFor(nil, i)
+}
+
+// SetIndexerFor sets the indexer of the server with the config; a nil config is the process's. Setting a nil indexer
+// restores the default.
+func SetIndexerFor(cfg *config.Config, i Indexer) {
+	cfg = processKey(cfg)
+	indexerMutex.Lock()
+	defer indexerMutex.Unlock()
+
+	if i == nil {
+		delete(indexers, cfg)
+		return
+	}
+	indexers[cfg] = i
+}
+
+// GetIndexer returns the search indexer. If none has been set, uses an ElasticsearchIndexer if an "Elasticsearch"
+// connection is configured, or an embedded MemoryIndexer otherwise.
+func GetIndexer() Indexer {
+	return IndexerFor(nil)
+}
+
+// IndexerFor returns the indexer of the server with the config, or the process's if the config is nil or the
+// process's. If none has been set, one is made from the config as GetIndexer's is.
+func IndexerFor(cfg *config.Config) Indexer {
+	cfg = processKey(cfg)
+
+	indexerMutex.RLock()
+	i := indexers[cfg]
+	indexerMutex.RUnlock()
+	if i != nil {
+		return i
+	}
+
+	indexerMutex.Lock()
+	defer indexerMutex.Unlock()
+	if indexers[cfg] == nil {
+		defaultCfg := cfg
+		if defaultCfg == nil {
+			defaultCfg = config.GetConfig()
+		}
+		indexers[cfg] = newDefaultIndexer(defaultCfg)
+	}
+	return indexers[cfg]
+}
+
+// processKey returns nil for the process's config, under which its indexer and pending ingests are kept
+func processKey(cfg *config.Config) *config.Config {
+	if cfg == config.GetConfig() {
+		return nil
+	}
+	return cfg
+}
+
+func newDefaultIndexer(cfg *config.Config) Indexer {
+	if cfg != nil {
+		if connCfg, ok := cfg.ConnectionConfig["Elasticsearch"]; ok && connCfg.Host != "" {
+			es, err := NewElasticsearchIndexer(connCfg)
+			if err == nil {
+				return es
+			}
+			utils.LogError("Failed to set up Elasticsearch; falling back to the embedded index", err, nil)
+		}
+	}
+	return NewMemoryIndexer()
+}
+
+// Indexable returns false for binary contents, which are not indexed.
+func Indexable(content []byte) bool {
+	return bytes.IndexByte(content, 0) < 0
+}
+
+// normalize validates the query, and applies the default result limit
+func (q Query) normalize() (Query, error) {
+	if strings.TrimSpace(q.Text) == "" {
+		return q, ErrEmptyQuery
+	}
+	if q.MaxResults <= 0 || q.MaxResults > DefaultMaxResults {
+		q.MaxResults = DefaultMaxResults
+	}
+	return q, nil
+}
+
+// matchLines returns the lines of the document that contain the query text, ignoring case; at most max are returned.
+func matchLines(doc Document, text string, max int) []Match {
+	text = strings.ToLower(text)
+
+	var matches []Match
+	for i, line := range strings.Split(doc.Content, "\n") {
+		if len(matches) >= max {
+			break
+		}
+		if !strings.Contains(strings.ToLower(line), text) {
+			continue
+		}
+		matches = append(matches, Match{
+			FileID:  doc.FileID,
+			Path:    doc.Path,
+			Line:    i + 1,
+			Snippet: snippet(line),
+		})
+	}
+	return matches
+}
+
+func snippet(line string) string {
+	line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+	if len(line) <= maxSnippetLength {
+		return line
+	}
+	// Don't cut a multi-byte character in half
+	end := maxSnippetLength
+	for end > 0 && !utf8RuneStart(line[end]) {
+		end--
+	}
+	return line[:end]
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
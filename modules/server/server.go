@@ -0,0 +1,450 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/datahandling"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/gitexport"
+	"github.com/CodeCollaborate/Server/modules/grpcapi"
+	"github.com/CodeCollaborate/Server/modules/handlers"
+	"github.com/CodeCollaborate/Server/modules/mail"
+	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/modules/restapi"
+	"github.com/CodeCollaborate/Server/modules/scanning"
+	"github.com/CodeCollaborate/Server/modules/search"
+	"github.com/CodeCollaborate/Server/utils"
+)
+
+/**
+ * Server is the whole CodeCollaborate server, for embedding in other Go programs:
+ *
+ *   srv, err := server.New(cfg, server.WithAuthenticator(checkOurToken))
+ *   ...
+ *   err = srv.Start(ctx)
+ *
+ * New takes the config, built in code or loaded with config.LoadConfig, and Options that give the server its
+ * dependencies in place of those it would create from the config, such as its database, message broker and
+ * authentication. Start connects whatever wasn't given, starts the background workers, and serves the WebSocket, REST
+ * and gRPC endpoints until its context is done. Programs that serve HTTP themselves can call Run, and mount Handler,
+ * instead. The server executable is built on it; see runner.go.
+ *
+ * Each Server handles requests with its own config, database, broker, authenticator, mailer, search index and malware
+ * scanner, so a program can run several. A server given the process's config, as returned by config.GetConfig,
+ * follows its reloads, and shares the mailer, search index and scanner of the process's config with any other server
+ * given it. Settings that apply to the whole process, such as logging and patch buffer lengths, are taken from the
+ * process's config, and the process is a single instance in the instance registry, whose drain and maintenance state
+ * its servers share.
+ */
+
+// Server is a CodeCollaborate server
+type Server struct {
+	cfg         *config.Config
+	handlerCfg  *config.Config // The config requests are handled with; nil for the process's, if cfg is it
+	db          dbfs.DBFS
+	broker      broker.Broker
+	auth        datahandling.Authenticator
+	mailer      mail.Mailer
+	indexer     search.Indexer
+	scanner     scanning.Scanner
+	deadLetters io.Writer
+	version     string
+
+	mux *http.ServeMux
+
+	mutex         sync.Mutex
+	running       bool
+	impl          *dbfs.DatabaseImpl      // The database the server connected to, if it wasn't given one
+	endpoints     map[string]http.Handler // By the pattern they are registered under in mux, while running
+	control       *utils.Control          // Shut down when the server stops, stopping its background workers
+	brokerControl *utils.Control          // Shut down when the server stops, closing the broker it connected to
+}
+
+// Option gives the server one of its dependencies
+type Option func(*Server)
+
+// WithDatabase makes the server use the database, rather than connecting to the ones configured. Schema migrations
+// are left to the program.
+func WithDatabase(db dbfs.DBFS) Option {
+	return func(server *Server) {
+		server.db = db
+	}
+}
+
+// WithBroker makes the server route messages through the broker, rather than the one configured
+func WithBroker(b broker.Broker) Option {
+	return func(server *Server) {
+		server.broker = b
+	}
+}
+
+// WithAuthenticator makes the server accept the tokens the Authenticator checks, in place of those it issues at login
+func WithAuthenticator(auth datahandling.Authenticator) Option {
+	return func(server *Server) {
+		server.auth = auth
+	}
+}
+
+// WithMailer makes the server send email with the mailer, rather than the "SMTP" connection configured
+func WithMailer(m mail.Mailer) Option {
+	return func(server *Server) {
+		server.mailer = m
+	}
+}
+
+// WithIndexer makes the server index project files with the indexer, rather than the "Elasticsearch" connection
+// configured or an embedded index
+func WithIndexer(i search.Indexer) Option {
+	return func(server *Server) {
+		server.indexer = i
+	}
+}
+
+// WithScanner makes the server scan file contents with the scanner, rather than the "ClamAV" connection configured
+func WithScanner(s scanning.Scanner) Option {
+	return func(server *Server) {
+		server.scanner = s
+	}
+}
+
+// WithDeadLetterLog records messages that can't be published in w; see rabbitmq.SetDeadLetterLog
+func WithDeadLetterLog(w io.Writer) Option {
+	return func(server *Server) {
+		server.deadLetters = w
+	}
+}
+
+// WithVersion sets the version the server reports to the instance registry; it defaults to "dev"
+func WithVersion(version string) Option {
+	return func(server *Server) {
+		server.version = version
+	}
+}
+
+// New creates a server with the config, returning an error if its token signing key can't be loaded
+func New(cfg *config.Config, options ...Option) (*Server, error) {
+	if cfg == nil {
+		return nil, errors.New("A config is required")
+	}
+	server := &Server{
+		cfg:     cfg,
+		version: "dev",
+		mux:     http.NewServeMux(),
+	}
+	if config.GetConfig() != cfg {
+		server.handlerCfg = cfg
+	}
+	for _, option := range options {
+		option(server)
+	}
+
+	if err := datahandling.LoadTokenSigningKey(cfg); err != nil {
+		return nil, err
+	}
+	// Requests look these up by the config they're handled with; those not given are made from it when first used
+	if server.mailer != nil {
+		mail.SetMailerFor(server.handlerCfg, server.mailer)
+	}
+	if server.indexer != nil {
+		search.SetIndexerFor(server.handlerCfg, server.indexer)
+	}
+	if server.scanner != nil {
+		scanning.SetScannerFor(server.handlerCfg, server.scanner)
+	}
+
+	server.mux.HandleFunc("/health", handlers.HealthCheck)
+	server.mux.Handle("/ws/", server.endpoint("/ws/"))
+	for _, path := range restapi.Paths {
+		server.mux.Handle(path, server.endpoint(path))
+	}
+	server.mux.Handle(grpcapi.ServicePath, server.endpoint(grpcapi.ServicePath))
+	return server, nil
+}
+
+// endpoint returns the handler registered under the pattern, which serves requests with the endpoint Run created for
+// it. Requests are refused while the server isn't running.
+func (server *Server) endpoint(pattern string) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		running := server.running
+		handler := server.endpoints[pattern]
+		server.mutex.Unlock()
+
+		switch {
+		case !running:
+			http.Error(responseWriter, "Server is not running", http.StatusServiceUnavailable)
+		case handler == nil:
+			http.NotFound(responseWriter, request)
+		default:
+			handler.ServeHTTP(responseWriter, request)
+		}
+	})
+}
+
+// Handler returns the handler of the server's HTTP endpoints, for programs that serve it themselves. It only serves
+// requests while the server is running.
+func (server *Server) Handler() http.Handler {
+	return server.mux
+}
+
+// Start connects the server's dependencies, starts its background workers, and serves its endpoints on the
+// configured port, blocking until ctx is done, Stop is called, or the listener fails. Its workers are stopped when it
+// returns.
+func (server *Server) Start(ctx context.Context) error {
+	if err := server.Run(); err != nil {
+		return err
+	}
+	defer server.Stop()
+
+	server.mutex.Lock()
+	control := server.control
+	server.mutex.Unlock()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-control.Exit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := handlers.ListenAndServeContext(ctx, server.cfg.ServerConfig, server.mux)
+	if err != nil {
+		utils.LogError("Could not bind to port", err, nil)
+	}
+	return err
+}
+
+// Run connects the server's dependencies, and starts its background workers, without listening for requests; the
+// program serves Handler itself. Stop stops them, after which the server may be run again.
+func (server *Server) Run() error {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.running {
+		return errors.New("The server is already running")
+	}
+
+	cfg := server.cfg
+	control := utils.NewControl(0)
+	if server.deadLetters != nil {
+		rabbitmq.SetDeadLetterLog(server.deadLetters)
+	}
+
+	// Websockets publish and receive messages through the broker selected by ServerConfig.Broker, whose connection is
+	// kept until the server stops
+	msgBroker := server.broker
+	var brokerControl *utils.Control
+	if msgBroker == nil {
+		brokerControl = utils.NewControl(1)
+		connected, err := broker.Connect(cfg, brokerControl)
+		if err != nil {
+			utils.LogError("Failed to connect to the message broker", err, utils.LogFields{
+				"Broker": cfg.ServerConfig.Broker,
+			})
+			brokerControl.Shutdown()
+			brokerControl = nil
+		} else {
+			msgBroker = connected
+		}
+	}
+
+	db := server.db
+	if db == nil {
+		if server.impl == nil {
+			impl := dbfs.NewDatabaseImpl(server.handlerCfg)
+			if cfg.ServerConfig.AutoMigrate {
+				applied, err := impl.MigrateMySQL()
+				if err != nil {
+					utils.LogError("Failed to migrate MySQL schema", err, nil)
+					if brokerControl != nil {
+						brokerControl.Shutdown()
+					}
+					return err
+				}
+				utils.LogInfo("MySQL schema is up to date", utils.LogFields{
+					"Applied": len(applied),
+				})
+			}
+			server.impl = impl
+		}
+		server.impl.StartCouchbaseHealthChecks(control)
+		db = server.impl
+	}
+
+	if migrated, err := dbfs.MigrateBlobLayout(cfg); err != nil {
+		utils.LogError("Failed to migrate blob store layout", err, nil)
+	} else if migrated > 0 {
+		utils.LogInfo("Migrated blob store layout", utils.LogFields{
+			"Blobs": migrated,
+		})
+	}
+
+	wsHandler := &handlers.WebSocketHandler{
+		Config:        server.handlerCfg,
+		Db:            db,
+		Broker:        msgBroker,
+		Control:       control,
+		Authenticator: server.auth,
+	}
+	endpoints := map[string]http.Handler{"/ws/": wsHandler}
+
+	datahandling.StartInstanceHeartbeats(datahandling.InstanceInfo{
+		Name:        cfg.ServerConfig.Name,
+		Version:     server.version,
+		Connections: handlers.ConnectionCount,
+	}, db, control)
+
+	if gitCfg := cfg.ServerConfig.GitExport; gitCfg.Remote != "" {
+		startGitExport(gitCfg, db, control)
+	}
+
+	if feedCfg := cfg.ServerConfig.ChangeFeed; len(feedCfg.Webhooks) > 0 {
+		err := datahandling.EnableChangeFeed(feedCfg, db, control)
+		utils.LogError("Failed to start the change feed", err, utils.LogFields{
+			"Interval": feedCfg.Interval,
+		})
+	}
+
+	if fedCfg := cfg.ServerConfig.Federation; fedCfg.Region != "" {
+		if _, ok := msgBroker.(rabbitmq.RabbitBroker); ok {
+			startFederation(fedCfg, cfg, control)
+		} else {
+			utils.LogError("Federation requires the RabbitMQ broker", errors.New("Federation is disabled"), utils.LogFields{
+				"Broker": cfg.ServerConfig.Broker,
+			})
+		}
+	}
+
+	if interval, err := cfg.ServerConfig.IntegrityCheckIntervalDuration(); err != nil || interval < 0 {
+		utils.LogError("Invalid integrity check interval", errors.New("IntegrityCheckInterval must be a positive duration"), utils.LogFields{
+			"IntegrityCheckInterval": cfg.ServerConfig.IntegrityCheckInterval,
+		})
+	} else if interval > 0 {
+		datahandling.StartIntegrityChecks(interval, db, control)
+	}
+
+	restHandler := restapi.NewHandler(server.handlerCfg, db, server.auth)
+	for _, path := range restapi.Paths {
+		endpoints[path] = restHandler
+	}
+
+	if cfg.ServerConfig.EnableGRPC && msgBroker != nil {
+		endpoints[grpcapi.ServicePath] = grpcapi.NewServer(cfg.ServerConfig.Name, server.handlerCfg, db, msgBroker,
+			server.auth, control)
+	}
+
+	server.running = true
+	server.endpoints = endpoints
+	server.control = control
+	server.brokerControl = brokerControl
+
+	utils.LogInfo("Starting server", utils.LogFields{
+		"InstanceID":   datahandling.InstanceID,
+		"Port":         cfg.ServerConfig.Port,
+		"Host":         cfg.ServerConfig.Host,
+		"TLS":          cfg.ServerConfig.UseTLS,
+		"RedirectPort": cfg.ServerConfig.HTTPRedirectPort,
+		"GRPC":         cfg.ServerConfig.EnableGRPC,
+	})
+	return nil
+}
+
+// Stop stops the server's background workers, disconnects its clients, closes the broker it connected to, and stops
+// Start's listener. It does nothing if the server isn't running.
+func (server *Server) Stop() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if !server.running {
+		return
+	}
+
+	server.running = false
+	server.endpoints = nil
+	server.control.Shutdown()
+	if server.brokerControl != nil {
+		server.brokerControl.Shutdown()
+	}
+}
+
+// startGitExport opens the Git export repository, and starts exporting file contents to it
+func startGitExport(gitCfg config.GitExportCfg, db dbfs.DBFS, control *utils.Control) {
+	var snapshotInterval time.Duration
+	switch gitCfg.Mode {
+	case "", "scrunch":
+	case "snapshot":
+		interval, err := gitCfg.SnapshotIntervalDuration()
+		if err == nil && interval <= 0 {
+			err = errors.New("SnapshotInterval must be positive")
+		}
+		if err != nil {
+			utils.LogError("Invalid Git export snapshot interval", err, utils.LogFields{
+				"SnapshotInterval": gitCfg.SnapshotInterval,
+			})
+			return
+		}
+		snapshotInterval = interval
+	default:
+		utils.LogError("Unknown Git export mode", errors.New("Mode must be \"scrunch\" or \"snapshot\""), utils.LogFields{
+			"Mode": gitCfg.Mode,
+		})
+		return
+	}
+
+	repo, err := gitexport.Open(gitCfg)
+	if err != nil {
+		utils.LogError("Failed to open Git export repository", err, utils.LogFields{
+			"Remote": gitCfg.Remote,
+		})
+		return
+	}
+	datahandling.EnableGitExport(repo, snapshotInterval, db, control)
+}
+
+// startFederation starts relaying project notifications from each peer region's RabbitMQ to this region's
+func startFederation(fedCfg config.FederationCfg, cfg *config.Config, control *utils.Control) {
+	maxAge, err := fedCfg.MaxAgeDuration()
+	if err == nil && maxAge <= 0 {
+		err = errors.New("MaxAge must be positive")
+	}
+	if err != nil {
+		utils.LogError("Invalid federation MaxAge", err, utils.LogFields{
+			"MaxAge": fedCfg.MaxAge,
+		})
+		return
+	}
+
+	bridgeCfg := rabbitmq.BridgeCfg{
+		Region:       fedCfg.Region,
+		ExchangeName: cfg.ServerConfig.Name,
+		MaxAge:       maxAge,
+		Peers:        make(map[string]rabbitmq.AMQPConnCfg),
+	}
+	for region, connName := range fedCfg.Peers {
+		connCfg, ok := cfg.ConnectionConfig[connName]
+		if !ok || region == fedCfg.Region {
+			utils.LogError("Invalid federation peer", errors.New("Peers must name another region, and a configured connection"),
+				utils.LogFields{
+					"Region":     region,
+					"Connection": connName,
+				})
+			continue
+		}
+		tlsConfig, err := connCfg.TLSConfig()
+		if err != nil {
+			utils.LogError("Invalid TLS config for federation peer", err, utils.LogFields{
+				"Region": region,
+			})
+			continue
+		}
+		bridgeCfg.Peers[region] = rabbitmq.AMQPConnCfg{ConnCfg: connCfg, TLSConfig: tlsConfig}
+	}
+	rabbitmq.RunBridge(bridgeCfg, control)
+}
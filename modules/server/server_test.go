@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRequiresConfig(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+}
+
+// get requests the path from the server, with the credentials if a username is given
+func get(t *testing.T, url string, username string, token string) (int, string) {
+	request, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+	if username != "" {
+		request.SetBasicAuth(username, token)
+	}
+	res, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestRunWithDependencies(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+
+	db := dbfs.NewDBMock()
+	srv, err := New(config.GetConfig(), WithDatabase(db), WithBroker(broker.NewMemoryBroker()))
+	require.NoError(t, err)
+	require.NoError(t, srv.Run())
+	defer srv.Stop()
+
+	httpServer := httptest.NewServer(srv.Handler())
+	defer httpServer.Close()
+	status, body := get(t, httpServer.URL+"/health", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "ok", body)
+
+	// Websockets are only served if the given broker is used, since no other is running
+	c, err := client.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/ws/", client.Options{})
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.UserRegister(client.UserRegisterRequest{
+		Username: "loganga",
+		Email:    "loganga@example.com",
+		Password: "correct horse battery staple",
+	}))
+	assert.Contains(t, db.Users, "loganga", "the given database should be used in place of the configured one")
+}
+
+func TestRunAgain(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+
+	srv, err := New(config.GetConfig(), WithDatabase(dbfs.NewDBMock()), WithBroker(broker.NewMemoryBroker()))
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(srv.Handler())
+	defer httpServer.Close()
+
+	status, _ := get(t, httpServer.URL+"/projects", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "requests should be refused until the server runs")
+
+	require.NoError(t, srv.Run())
+	assert.Error(t, srv.Run(), "a running server should not be run again")
+	status, _ = get(t, httpServer.URL+"/projects", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	srv.Stop()
+	status, _ = get(t, httpServer.URL+"/projects", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "requests should be refused once the server stops")
+
+	require.NoError(t, srv.Run(), "a stopped server should run again")
+	defer srv.Stop()
+	status, _ = get(t, httpServer.URL+"/projects", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestServersWithOwnConfigs(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+	processCfg := config.GetConfig()
+
+	// The second server only accepts tokens its authenticator issued, and websockets with its subprotocol
+	ownCfg := *processCfg
+	ownCfg.ServerConfig.RequireSubprotocol = true
+	ownCfg.ServerConfig.Subprotocols = []string{"codecollaborate"}
+	first, err := New(processCfg, WithDatabase(dbfs.NewDBMock()), WithBroker(broker.NewMemoryBroker()))
+	require.NoError(t, err)
+	second, err := New(&ownCfg, WithDatabase(dbfs.NewDBMock()), WithBroker(broker.NewMemoryBroker()),
+		WithAuthenticator(func(senderID string, token string) error {
+			if token != "issued-elsewhere" {
+				return errors.New("unknown token")
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, processCfg, config.GetConfig(), "servers should not replace the process's config")
+
+	for _, srv := range []*Server{first, second} {
+		require.NoError(t, srv.Run())
+		defer srv.Stop()
+	}
+	firstHTTP := httptest.NewServer(first.Handler())
+	defer firstHTTP.Close()
+	secondHTTP := httptest.NewServer(second.Handler())
+	defer secondHTTP.Close()
+
+	status, _ := get(t, firstHTTP.URL+"/projects", "loganga", "issued-elsewhere")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, body := get(t, secondHTTP.URL+"/projects", "loganga", "issued-elsewhere")
+	assert.Equal(t, http.StatusOK, status, body)
+
+	status, body = get(t, firstHTTP.URL+"/ws/", "", "")
+	assert.NotContains(t, body, "Unsupported subprotocol")
+	status, body = get(t, secondHTTP.URL+"/ws/", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "Unsupported subprotocol")
+}
+
+func TestServerWithOwnServices(t *testing.T) {
+	config.SetConfigDir("../../config")
+	require.NoError(t, config.LoadConfig())
+
+	ownCfg := *config.GetConfig()
+	indexer := search.NewMemoryIndexer()
+	_, err := New(&ownCfg, WithDatabase(dbfs.NewDBMock()), WithBroker(broker.NewMemoryBroker()), WithIndexer(indexer))
+	require.NoError(t, err)
+	defer search.SetIndexerFor(&ownCfg, nil)
+
+	assert.True(t, search.IndexerFor(&ownCfg) == search.Indexer(indexer))
+	assert.True(t, search.GetIndexer() != search.Indexer(indexer), "a server's indexer should not replace the process's")
+}
@@ -0,0 +1,107 @@
+package testserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/CodeCollaborate/Server/modules/broker"
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/config"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/CodeCollaborate/Server/modules/handlers"
+)
+
+/**
+ * Testserver runs the whole server in-process, for black-box tests of the WebSocket protocol that don't need MySQL,
+ * Couchbase or RabbitMQ: requests are handled by the real handlers, against an in-memory DBFS, and notifications are
+ * routed by the in-process broker.
+ *
+ * Each Server has its own database and broker, so tests may run several at once. The DatabaseMock is not safe for
+ * concurrent use; tests should wait for each response, as the client's methods do, before making the next request.
+ */
+
+// Server is a CodeCollaborate server running in-process
+type Server struct {
+	// URL is the address of the WebSocket endpoint, for Dial
+	URL string
+	// DB is the database the server uses
+	DB dbfs.DBFS
+	// Broker routes notifications between the server's websockets
+	Broker *broker.MemoryBroker
+	// Config is the server's config; tests may change it while the server runs
+	Config *config.Config
+
+	httpServer  *httptest.Server
+	connections sync.WaitGroup // WebSocket connections still being handled
+	projectDir  string         // Removed on Close, if the server created it
+}
+
+// DefaultConfig returns the configuration Start uses if none has been loaded, storing files under projectPath
+func DefaultConfig(projectPath string) *config.Config {
+	return &config.Config{
+		ServerConfig: config.ServerCfg{
+			Name:          "CodeCollaborate",
+			ProjectPath:   projectPath,
+			LogLevel:      "Warn",
+			TokenValidity: "1h",
+		},
+		ConnectionConfig: config.ConnCfgMap{},
+	}
+}
+
+// Start starts a server that uses the given database, or a new DatabaseMock if db is nil. The loaded configuration
+// is used, or DefaultConfig if there is none.
+func Start(db dbfs.DBFS) (*Server, error) {
+	server := &Server{
+		DB:     db,
+		Broker: broker.NewMemoryBroker(),
+		Config: config.GetConfig(),
+	}
+	if server.DB == nil {
+		server.DB = dbfs.NewDBMock()
+	}
+
+	if server.Config == nil {
+		projectDir, err := ioutil.TempDir("", "ccserver")
+		if err != nil {
+			return nil, err
+		}
+		server.projectDir = projectDir
+		server.Config = DefaultConfig(projectDir)
+	}
+
+	wsHandler := &handlers.WebSocketHandler{
+		Config: server.Config,
+		Db:     server.DB,
+		Broker: server.Broker,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/", func(w http.ResponseWriter, r *http.Request) {
+		server.connections.Add(1)
+		defer server.connections.Done()
+		wsHandler.ServeHTTP(w, r)
+	})
+	server.httpServer = httptest.NewServer(mux)
+	server.URL = "ws" + strings.TrimPrefix(server.httpServer.URL, "http") + "/ws/"
+
+	return server, nil
+}
+
+// Dial connects a new client to the server
+func (server *Server) Dial() (*client.Client, error) {
+	return client.Dial(server.URL, client.Options{})
+}
+
+// Close stops the server. Clients must be closed first, since Close waits for their connections to finish being
+// handled.
+func (server *Server) Close() {
+	server.httpServer.Close()
+	server.connections.Wait()
+	if server.projectDir != "" {
+		os.RemoveAll(server.projectDir)
+	}
+}
@@ -0,0 +1,68 @@
+package testserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodeCollaborate/Server/modules/client"
+	"github.com/CodeCollaborate/Server/modules/datahandling/messages"
+	"github.com/CodeCollaborate/Server/modules/dbfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	server, err := Start(nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	editor, err := server.Dial()
+	require.NoError(t, err)
+	defer editor.Close()
+	watcher, err := server.Dial()
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	// Requests that need a login are refused without one
+	res, err := editor.Send("Project", "Create", map[string]string{"Name": "nope"})
+	require.NoError(t, err)
+	assert.Equal(t, messages.StatusUnauthorized, res.Status)
+
+	const password = "correct horse battery staple"
+	register := client.UserRegisterRequest{
+		Username:  "loganga",
+		FirstName: "Logan",
+		LastName:  "Ga",
+		Email:     "loganga@example.com",
+		Password:  password,
+	}
+	require.NoError(t, editor.UserRegister(register))
+	assert.Error(t, editor.UserRegister(register), "usernames should be unique")
+	assert.Error(t, editor.UserLogin(client.UserLoginRequest{Username: "loganga", Password: "wrong password"}))
+	require.NoError(t, editor.UserLogin(client.UserLoginRequest{Username: "loganga", Password: password}))
+	require.NoError(t, watcher.UserLogin(client.UserLoginRequest{Username: "loganga", Password: password}))
+
+	projectID, err := editor.ProjectCreate(client.ProjectCreateRequest{Name: "hi"})
+	require.NoError(t, err)
+	require.NoError(t, watcher.ProjectSubscribe(client.ProjectSubscribeRequest{ProjectID: projectID}))
+
+	_, err = editor.FileCreate(client.FileCreateRequest{
+		Name:         "new file",
+		RelativePath: ".",
+		ProjectID:    projectID,
+		FileBytes:    []byte("hello"),
+	})
+	require.NoError(t, err)
+
+	notification, err := watcher.NextNotification(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "File", notification.Resource)
+	assert.Equal(t, "Create", notification.Method)
+	assert.Equal(t, projectID, notification.ResourceID)
+
+	// The database can be made to fail underneath the protocol
+	server.DB.(*dbfs.DatabaseMock).FailCall("MySQLProjectCreate", 1, nil)
+	_, err = editor.ProjectCreate(client.ProjectCreateRequest{Name: "broken"})
+	require.IsType(t, &client.StatusError{}, err)
+	assert.Equal(t, messages.StatusServFail, err.(*client.StatusError).Status)
+}
@@ -1,36 +1,50 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/CodeCollaborate/Server/modules/broker"
 	"github.com/CodeCollaborate/Server/modules/config"
 	"github.com/CodeCollaborate/Server/modules/dbfs"
-	"github.com/CodeCollaborate/Server/modules/handlers"
-	"github.com/CodeCollaborate/Server/modules/rabbitmq"
+	"github.com/CodeCollaborate/Server/modules/server"
 	"github.com/CodeCollaborate/Server/utils"
-	"golang.org/x/crypto/acme/autocert"
 )
 
 /**
- * Runner.go starts the server. It initializes processes and begins listening for websocket requests.
+ * Runner.go starts the server from its config files and flags; the server itself is in modules/server.
  */
 
 var logDir = flag.String("log_dir", "./data/logs/", "log file location")
+var standalone = flag.Bool("standalone", false, "run without an external message broker, routing messages in-process; for single-server deployments and development")
+var configPollInterval = flag.Duration("config_poll_interval", 30*time.Second, "interval at which config files are checked for changes; 0 reloads on SIGHUP only")
+
+// version is reported to the instance registry; set it when building with -ldflags "-X main.version=..."
+var version = "dev"
 
 func main() {
+	config.RegisterFlags(flag.CommandLine, "MySQL", "Couchbase", "RabbitMQ")
 	flag.Parse()
 
-	config.EnableLoggingToFile(*logDir)
 	err := config.LoadConfig()
 	if err != nil {
 		utils.LogFatal("Failed to load configuration", err, nil)
 	}
 	cfg := config.GetConfig()
+	if len(cfg.ServerConfig.Logging.Sinks) == 0 {
+		config.EnableLoggingToFile(*logDir)
+	}
+
+	// Apply runtime-safe config changes without a restart
+	configControl := utils.NewControl(0)
+	config.WatchConfig(*configPollInterval, configControl)
+	defer configControl.Shutdown()
 
 	// Get working directory
 	dir, err := os.Getwd()
@@ -40,38 +54,35 @@ func main() {
 		"Working Directory": dir,
 	})
 
-	// Creates a NewControl block for multithreading control
-	AMQPControl := utils.NewControl(1)
-
-	// RabbitMQ uses "Exchanges" as containers for Queues, and ours is initialized here.
-	rabbitmq.SetupRabbitExchange(
-		&rabbitmq.AMQPConnCfg{
-			ConnCfg: cfg.ConnectionConfig["RabbitMQ"],
-			Exchanges: []rabbitmq.AMQPExchCfg{
-				{
-					ExchangeName: cfg.ServerConfig.Name,
-					Durable:      true,
-				},
-			},
-			Control: AMQPControl,
-		},
-	)
-
-	dbfs.Dbfs = new(dbfs.DatabaseImpl)
-
-	http.HandleFunc("/ws/", handlers.NewWSConn)
-
-	addr := fmt.Sprintf(":%d", cfg.ServerConfig.Port)
-
-	//_, certErr := os.Stat("config/TLS/cert.pem")
-	//_, keyErr := os.Stat("config/TLS/key.pem")
-
-	//useTLS := certErr == nil && keyErr == nil
-	utils.LogInfo("Starting server", utils.LogFields{
-		"Address": addr,
-		"Host":    cfg.ServerConfig.Host,
-		"TLS":     cfg.ServerConfig.UseTLS,
-	})
+	// `server migrate` applies the pending schema migrations and exits
+	if flag.Arg(0) == "migrate" {
+		applied, err := new(dbfs.DatabaseImpl).MigrateMySQL()
+		utils.LogFatal("Failed to migrate MySQL schema", err, nil)
+		for _, migration := range applied {
+			fmt.Printf("Applied migration %04d_%s\n", migration.Version, migration.Name)
+		}
+		fmt.Printf("Schema is up to date; %d migrations applied\n", len(applied))
+		return
+	}
+
+	options := []server.Option{server.WithVersion(version)}
+	if *standalone {
+		options = append(options, server.WithBroker(broker.NewMemoryBroker()))
+	}
+
+	// Notifications that can't be published are kept alongside the logs, so they can be investigated or replayed
+	if *logDir != "" {
+		deadLetters, err := os.OpenFile(filepath.Join(*logDir, "deadletters.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			utils.LogError("Failed to open dead-letter log", err, nil)
+		} else {
+			defer deadLetters.Close()
+			options = append(options, server.WithDeadLetterLog(deadLetters))
+		}
+	}
+
+	srv, err := server.New(cfg, options...)
+	utils.LogFatal("Failed to create server", err, nil)
 
 	go func() {
 		addr := fmt.Sprintf("0.0.0.0:%d", cfg.ServerConfig.Port+1)
@@ -87,30 +98,6 @@ func main() {
 		}
 	}()
 
-	if cfg.ServerConfig.UseTLS {
-		dirCache := autocert.DirCache("certs")
-		certManager := autocert.Manager{
-			Prompt:     autocert.AcceptTOS,
-			HostPolicy: autocert.HostWhitelist(cfg.ServerConfig.Host), //your domain here
-			Cache:      dirCache,                                      //folder for storing certificates
-		}
-
-		server := &http.Server{
-			Addr: addr,
-			TLSConfig: &tls.Config{
-				GetCertificate: certManager.GetCertificate,
-			},
-		}
-
-		server.ListenAndServeTLS("", "") //key and cert are comming from Let's Encrypt
-	} else {
-		err = http.ListenAndServe(addr, nil)
-	}
-
-	utils.LogError("Could not bind to port", err, nil)
-
-	// Kill the SetupRabbitExchange thread (Multithreading control)
-	defer func() {
-		AMQPControl.Exit <- true
-	}()
+	err = srv.Start(context.Background())
+	utils.LogFatal("Server stopped", err, nil)
 }
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"os"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/CodeCollaborate/Server/modules/auth"
 )
 
 var (
@@ -24,10 +24,10 @@ func main() {
 
 	fmt.Printf("generating hash for password %s: \n", string(*password))
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	hashed, err := auth.HashPassword(nil, *password)
 	if err != nil {
 		fmt.Println("ERROR: problem making hash")
 		fmt.Println(err)
 	}
-	fmt.Println(string(hashed))
+	fmt.Println(hashed)
 }
@@ -0,0 +1,7 @@
+//go:build webdav
+// +build webdav
+
+package main
+
+// Keeps files' contents on a WebDAV server, when configured with FileStore "WebDAV"; see modules/dbfs/webdavstore
+import _ "github.com/CodeCollaborate/Server/modules/dbfs/webdavstore"
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+/**
+ * The Log* functions filter entries by level, per module, and can sample repeated messages, before passing them on to
+ * logrus. ConfigureLogging sets the levels and sampling, the format of entries, and the sinks they are written to;
+ * it may be called again at any time, such as when the configuration is reloaded.
+ *
+ * A module is the directory of the package that logged the entry, such as "dbfs" or "datahandling".
+ */
+
+// LogConfig configures the server's logs
+type LogConfig struct {
+	Level        string            // One of Panic, Fatal, Error, Warn, Info or Debug; defaults to Warn
+	ModuleLevels map[string]string // Levels for modules, overriding Level
+	Format       string            // "text" or "json"; if empty, the format is left as it is
+
+	// Each message is logged at most SampleInitial times a second per level, and after that only every
+	// SampleThereafter-th time. 0 disables sampling. Fatal entries are never sampled.
+	SampleInitial    int
+	SampleThereafter int
+
+	// Where entries are written. If empty, entries are written where they were before logging was configured.
+	Sinks []LogSink
+}
+
+// LogSink is a destination for log entries
+type LogSink struct {
+	Type       string // "stderr", "stdout", "file" or "syslog"
+	Path       string // file: the log file; rotated files are suffixed with .1, .2, and so on
+	MaxSizeMB  int    // file: the size at which the file is rotated; 0 never rotates
+	MaxBackups int    // file: the number of rotated files kept; defaults to 5
+	Network    string // syslog: "udp" or "tcp", or empty for the local syslog daemon
+	Address    string // syslog: the daemon's address, if Network is set
+	Tag        string // syslog: the program name entries are tagged with
+}
+
+var logState struct {
+	mutex    sync.RWMutex
+	level    log.Level            // The level of modules without their own
+	modules  map[string]log.Level // Levels of modules with their own
+	verbose  log.Level            // The most verbose of the levels; entries above it are dropped without a lookup
+	sampler  *logSampler          // nil if sampling is disabled
+	sinks    []io.Writer          // Written to by logOutput, if installed
+	syslogs  []syslogSink         // Fired by logHook, if installed
+	closers  []io.Closer          // Closed when the sinks are replaced
+	attached bool                 // Whether logOutput and logHook have been installed into logrus
+}
+
+func init() {
+	logState.level = log.InfoLevel
+	logState.verbose = log.InfoLevel
+}
+
+// ParseLogLevel parses a level name, ignoring case
+func ParseLogLevel(name string) (log.Level, error) {
+	switch strings.ToLower(name) {
+	case "panic":
+		return log.PanicLevel, nil
+	case "fatal":
+		return log.FatalLevel, nil
+	case "error":
+		return log.ErrorLevel, nil
+	case "warn", "warning":
+		return log.WarnLevel, nil
+	case "info":
+		return log.InfoLevel, nil
+	case "debug":
+		return log.DebugLevel, nil
+	}
+	return log.WarnLevel, fmt.Errorf("Unknown log level %q", name)
+}
+
+// ConfigureLogging applies the logging configuration. If any of it is invalid, nothing is applied.
+func ConfigureLogging(cfg LogConfig) error {
+	level := log.WarnLevel
+	if cfg.Level != "" {
+		var err error
+		if level, err = ParseLogLevel(cfg.Level); err != nil {
+			return err
+		}
+	}
+
+	verbose := level
+	modules := make(map[string]log.Level, len(cfg.ModuleLevels))
+	for module, name := range cfg.ModuleLevels {
+		moduleLevel, err := ParseLogLevel(name)
+		if err != nil {
+			return fmt.Errorf("Module %s: %v", module, err)
+		}
+		modules[module] = moduleLevel
+		if moduleLevel > verbose {
+			verbose = moduleLevel
+		}
+	}
+
+	var formatter log.Formatter
+	switch strings.ToLower(cfg.Format) {
+	case "":
+	case "text":
+		formatter = &log.TextFormatter{}
+	case "json":
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("Unknown log format %q", cfg.Format)
+	}
+
+	var sinks []io.Writer
+	var syslogs []syslogSink
+	var closers []io.Closer
+	for _, sink := range cfg.Sinks {
+		writer, err := openLogSink(sink)
+		if err != nil {
+			for _, closer := range closers {
+				closer.Close()
+			}
+			return fmt.Errorf("Failed to open %s log sink: %v", sink.Type, err)
+		}
+		if syslog, ok := writer.(syslogSink); ok {
+			syslogs = append(syslogs, syslog)
+		} else {
+			sinks = append(sinks, writer)
+		}
+		if closer, ok := writer.(io.Closer); ok && writer != os.Stdout && writer != os.Stderr {
+			closers = append(closers, closer)
+		}
+	}
+
+	var sampler *logSampler
+	if cfg.SampleInitial > 0 {
+		sampler = &logSampler{initial: cfg.SampleInitial, thereafter: cfg.SampleThereafter, counts: map[string]int{}}
+	}
+
+	logState.mutex.Lock()
+	var oldClosers []io.Closer
+	attach := len(cfg.Sinks) > 0 && !logState.attached
+	logState.level = level
+	logState.modules = modules
+	logState.verbose = verbose
+	logState.sampler = sampler
+	if len(cfg.Sinks) > 0 || logState.attached {
+		oldClosers = logState.closers
+		logState.sinks, logState.syslogs, logState.closers = sinks, syslogs, closers
+		logState.attached = true
+	}
+	logState.mutex.Unlock()
+
+	// Installed outside the lock, since logrus holds its own lock while writing to them
+	if attach {
+		log.SetOutput(logOutput{})
+		log.AddHook(logHook{})
+	}
+
+	// Entries are filtered by module before they reach logrus, which only needs to let the most verbose through
+	log.SetLevel(verbose)
+	if formatter != nil {
+		log.SetFormatter(formatter)
+	}
+	for _, closer := range oldClosers {
+		closer.Close()
+	}
+	return nil
+}
+
+// openLogSink opens the writer for a sink
+func openLogSink(sink LogSink) (io.Writer, error) {
+	switch strings.ToLower(sink.Type) {
+	case "stderr":
+		return os.Stderr, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "file":
+		if sink.Path == "" {
+			return nil, errors.New("no path given")
+		}
+		if err := os.MkdirAll(filepath.Dir(sink.Path), 0755); err != nil {
+			return nil, err
+		}
+		maxBackups := sink.MaxBackups
+		if maxBackups <= 0 {
+			maxBackups = 5
+		}
+		return openRotatingFile(sink.Path, int64(sink.MaxSizeMB)*1024*1024, maxBackups)
+	case "syslog":
+		return dialSyslog(sink.Network, sink.Address, sink.Tag)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", sink.Type)
+}
+
+// logModule returns the module a file belongs to
+func logModule(file string) string {
+	return filepath.Base(filepath.Dir(file))
+}
+
+// logEnabled returns true if entries of the level are logged for the module, and the entry isn't sampled out. Fatal
+// entries are always logged, since logging them exits.
+func logEnabled(level log.Level, module string, msg string) bool {
+	if level <= log.FatalLevel {
+		return true
+	}
+	logState.mutex.RLock()
+	threshold, ok := logState.modules[module]
+	if !ok {
+		threshold = logState.level
+	}
+	sampler := logState.sampler
+	logState.mutex.RUnlock()
+
+	return level <= threshold && sampler.allow(level, msg)
+}
+
+// logVerbose returns the most verbose level that any module logs at
+func logVerbose() log.Level {
+	logState.mutex.RLock()
+	defer logState.mutex.RUnlock()
+	return logState.verbose
+}
+
+// logSampler limits how often each message is logged, per second
+type logSampler struct {
+	initial    int
+	thereafter int
+
+	mutex  sync.Mutex
+	second int64
+	counts map[string]int
+}
+
+// allow counts an entry, returning true if it should be logged
+func (sampler *logSampler) allow(level log.Level, msg string) bool {
+	if sampler == nil {
+		return true
+	}
+	sampler.mutex.Lock()
+	defer sampler.mutex.Unlock()
+
+	if now := time.Now().Unix(); now != sampler.second {
+		sampler.second = now
+		sampler.counts = map[string]int{}
+	}
+	key := level.String() + ":" + msg
+	sampler.counts[key]++
+	n := sampler.counts[key]
+	return n <= sampler.initial || sampler.thereafter > 0 && (n-sampler.initial)%sampler.thereafter == 0
+}
+
+// logOutput writes formatted entries to the configured sinks, or to stderr if there are none
+type logOutput struct{}
+
+func (logOutput) Write(p []byte) (int, error) {
+	logState.mutex.RLock()
+	defer logState.mutex.RUnlock()
+	if len(logState.sinks) == 0 && len(logState.syslogs) == 0 {
+		return os.Stderr.Write(p)
+	}
+	for _, sink := range logState.sinks {
+		sink.Write(p)
+	}
+	return len(p), nil
+}
+
+// syslogSink writes entries to syslog, at the priority of their level
+type syslogSink interface {
+	io.Writer
+	writeEntry(level log.Level, line string) error
+}
+
+// logHook sends entries to the configured syslog sinks
+type logHook struct{}
+
+func (logHook) Fire(entry *log.Entry) error {
+	logState.mutex.RLock()
+	syslogs := logState.syslogs
+	logState.mutex.RUnlock()
+	if len(syslogs) == 0 {
+		return nil
+	}
+
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	for _, syslog := range syslogs {
+		syslog.writeEntry(entry.Level, line)
+	}
+	return nil
+}
+
+func (logHook) Levels() []log.Level {
+	return log.AllLevels
+}
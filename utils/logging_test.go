@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestConfigureLogging_ModuleLevels(t *testing.T) {
+	defer ConfigureLogging(LogConfig{})
+
+	err := ConfigureLogging(LogConfig{
+		Level:        "Warn",
+		ModuleLevels: map[string]string{"dbfs": "Debug", "websocket": "Error"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !logEnabled(log.DebugLevel, "dbfs", "msg") {
+		t.Fatal("Debug entries should be logged for dbfs")
+	}
+	if logEnabled(log.WarnLevel, "websocket", "msg") {
+		t.Fatal("Warn entries should not be logged for websocket")
+	}
+	if !logEnabled(log.WarnLevel, "datahandling", "msg") || logEnabled(log.InfoLevel, "datahandling", "msg") {
+		t.Fatal("Modules without their own level should log at Warn")
+	}
+	if logVerbose() != log.DebugLevel {
+		t.Fatalf("Expected the most verbose level to be Debug, got %s", logVerbose())
+	}
+	if module := logModule("/go/src/github.com/CodeCollaborate/Server/modules/dbfs/dbfs.go"); module != "dbfs" {
+		t.Fatalf("Expected module dbfs, got %s", module)
+	}
+}
+
+func TestConfigureLogging_Invalid(t *testing.T) {
+	defer ConfigureLogging(LogConfig{})
+
+	if err := ConfigureLogging(LogConfig{Level: "Debug"}); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []LogConfig{
+		{Level: "Loud"},
+		{ModuleLevels: map[string]string{"dbfs": "Loud"}},
+		{Format: "xml"},
+		{Sinks: []LogSink{{Type: "pigeon"}}},
+		{Sinks: []LogSink{{Type: "file"}}},
+	}
+	for _, cfg := range invalid {
+		if err := ConfigureLogging(cfg); err == nil {
+			t.Fatalf("Expected %+v to be rejected", cfg)
+		}
+	}
+
+	// Nothing of an invalid configuration is applied
+	if logVerbose() != log.DebugLevel {
+		t.Fatalf("Expected the level to still be Debug, got %s", logVerbose())
+	}
+}
+
+func TestLogSampler(t *testing.T) {
+	sampler := &logSampler{initial: 2, thereafter: 3, counts: map[string]int{}}
+
+	var logged []int
+	for i := 1; i <= 8; i++ {
+		if sampler.allow(log.InfoLevel, "repeated") {
+			logged = append(logged, i)
+		}
+	}
+	// The sampler resets each second; retry if the second passed mid-count
+	if len(logged) != 4 && sampler.allow(log.InfoLevel, "repeated") {
+		t.Skip("Sampling window reset during the test")
+	}
+	expected := []int{1, 2, 5, 8}
+	if len(logged) != len(expected) {
+		t.Fatalf("Expected entries %v to be logged, got %v", expected, logged)
+	}
+	for i := range expected {
+		if logged[i] != expected[i] {
+			t.Fatalf("Expected entries %v to be logged, got %v", expected, logged)
+		}
+	}
+
+	if !sampler.allow(log.InfoLevel, "different") || !sampler.allow(log.WarnLevel, "repeated") {
+		t.Fatal("Other messages and levels should be counted separately")
+	}
+
+	var disabled *logSampler
+	if !disabled.allow(log.InfoLevel, "repeated") {
+		t.Fatal("A nil sampler should allow everything")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.log")
+	file, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for name, contents := range expected {
+		actual, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != contents {
+			t.Fatalf("Expected %s to contain %q, got %q", name, contents, actual)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatal("Only 2 rotated files should be kept")
+	}
+}
+
+func TestConfigureLogging_FileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer log.SetOutput(os.Stderr)
+	defer ConfigureLogging(LogConfig{Format: "text", Sinks: []LogSink{{Type: "stderr"}}})
+
+	path := filepath.Join(dir, "server.log")
+	err = ConfigureLogging(LogConfig{
+		Level:  "Info",
+		Format: "json",
+		Sinks:  []LogSink{{Type: "file", Path: path}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	LogInfo("Written to the file", LogFields{"Key": "value"})
+	LogDebug("Not written", nil)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(contents), []byte("\n"))
+	if len(lines) != 1 {
+		t.Fatalf("Expected one entry, got %q", contents)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(lines[0], &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "Written to the file" || entry["Key"] != "value" || entry["Location"] == nil {
+		t.Fatalf("Unexpected entry %v", entry)
+	}
+}
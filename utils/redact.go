@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+/**
+ * Redaction of sensitive data from log entries. Fields whose names are sensitive are masked, as are the values of
+ * sensitive keys in fields holding JSON, such as the requests and messages that are logged, however deeply they are
+ * nested.
+ */
+
+// Redacted replaces sensitive values in log entries
+const Redacted = "[REDACTED]"
+
+// sensitiveWords are the words that mark a field or key as sensitive, wherever they appear in its name
+var sensitiveWords = []string{"password", "token", "secret"}
+
+// sensitiveNames are the field and key names that are sensitive in their entirety
+var sensitiveNames = map[string]bool{
+	"filebytes": true,
+}
+
+// IsSensitiveField returns true if values of the field or key with the given name are masked in logs
+func IsSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	if sensitiveNames[name] {
+		return true
+	}
+	for _, word := range sensitiveWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactJSON returns the JSON with the values of sensitive keys masked. If it cannot be parsed, and mentions a
+// sensitive key, the whole of it is masked, since what is sensitive in it cannot be told apart.
+func RedactJSON(data []byte) string {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		if mentionsSensitiveField(string(data)) {
+			return Redacted
+		}
+		return string(data)
+	}
+
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return Redacted
+	}
+	return string(redacted)
+}
+
+// redactValue masks the values of sensitive keys in a decoded JSON value
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if IsSensitiveField(key) {
+				value[key] = Redacted
+			} else {
+				value[key] = redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactValue(child)
+		}
+	}
+	return value
+}
+
+// mentionsSensitiveField returns true if the text contains a sensitive field name
+func mentionsSensitiveField(text string) bool {
+	text = strings.ToLower(text)
+	for _, word := range sensitiveWords {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	for name := range sensitiveNames {
+		if strings.Contains(text, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactField masks the value of a log field if its name is sensitive, and otherwise redacts it if it holds JSON
+func redactField(name string, value interface{}) interface{} {
+	if IsSensitiveField(name) {
+		return Redacted
+	}
+
+	var data []byte
+	switch value := value.(type) {
+	case string:
+		data = []byte(value)
+	case []byte:
+		data = value
+	case json.RawMessage:
+		data = value
+	default:
+		return value
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' && trimmed[0] != '[' {
+		return value
+	}
+	return RedactJSON(data)
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	message := `{"Tag":1,"Resource":"User","Method":"Login","Data":{"Username":"loganga","Password":"hunter2"},` +
+		`"SenderToken":"abc.def","Changes":[{"IDToken":"xyz","FileBytes":"aGk="}]}`
+
+	var redacted map[string]interface{}
+	if err := json.Unmarshal([]byte(RedactJSON([]byte(message))), &redacted); err != nil {
+		t.Fatal(err)
+	}
+
+	data := redacted["Data"].(map[string]interface{})
+	if data["Password"] != Redacted || data["Username"] != "loganga" {
+		t.Fatalf("Expected only the password to be redacted, got %v", data)
+	}
+	if redacted["SenderToken"] != Redacted || redacted["Method"] != "Login" || redacted["Tag"] != float64(1) {
+		t.Fatalf("Expected only the token to be redacted, got %v", redacted)
+	}
+	change := redacted["Changes"].([]interface{})[0].(map[string]interface{})
+	if change["IDToken"] != Redacted || change["FileBytes"] != Redacted {
+		t.Fatalf("Expected nested sensitive keys to be redacted, got %v", change)
+	}
+}
+
+func TestRedactJSON_Unparseable(t *testing.T) {
+	if redacted := RedactJSON([]byte(`{"Password": "hunter2"`)); redacted != Redacted {
+		t.Fatalf("Expected malformed JSON mentioning a password to be redacted, got %s", redacted)
+	}
+	if redacted := RedactJSON([]byte(`{"Username": "loganga"`)); redacted != `{"Username": "loganga"` {
+		t.Fatalf("Expected malformed JSON without sensitive keys to be left as it is, got %s", redacted)
+	}
+}
+
+func TestRedactField(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"Password", "hunter2", Redacted},
+		{"NewPassword", "hunter2", Redacted},
+		{"FileBytes", []byte("contents"), Redacted},
+		{"Username", "loganga", "loganga"},
+		{"FileID", 12, 12},
+		{"Request", `{"Token":"abc"}`, `{"Token":"[REDACTED]"}`},
+		{"Body", []byte(`[{"secret":1}]`), `[{"secret":"[REDACTED]"}]`},
+		{"Text", "{not json", "{not json"},
+	}
+	for _, test := range tests {
+		if actual := redactField(test.name, test.value); actual != test.expected {
+			t.Fatalf("Expected field %s with %v to be logged as %v, got %v", test.name, test.value, test.expected, actual)
+		}
+	}
+}
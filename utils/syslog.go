@@ -0,0 +1,39 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package utils
+
+import (
+	"log/syslog"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// syslogWriter is a syslog sink
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+// dialSyslog connects to a syslog daemon; the local one if network is empty
+func dialSyslog(network string, address string, tag string) (syslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogWriter{writer}, nil
+}
+
+func (writer syslogWriter) writeEntry(level log.Level, line string) error {
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return writer.Crit(line)
+	case log.ErrorLevel:
+		return writer.Err(line)
+	case log.WarnLevel:
+		return writer.Warning(line)
+	case log.InfoLevel:
+		return writer.Info(line)
+	default:
+		return writer.Debug(line)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package utils
+
+import (
+	"errors"
+)
+
+// dialSyslog fails, since syslog is not available on this platform
+func dialSyslog(network string, address string, tag string) (syslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
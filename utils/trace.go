@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+/**
+ * Trace IDs tie together the log entries of a request, including those of the database operations it makes, which
+ * are passed the request's context.
+ */
+
+type traceIDKey struct{}
+
+// NewTraceID returns a random trace ID
+func NewTraceID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// WithTraceID returns a copy of the context that carries the trace ID
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID returns the trace ID the context carries, or "" if it has none
+func TraceID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
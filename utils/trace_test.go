@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceID(t *testing.T) {
+	assert.Equal(t, "", TraceID(context.Background()))
+
+	traceID := NewTraceID()
+	assert.Len(t, traceID, 16)
+	assert.NotEqual(t, traceID, NewTraceID())
+	ctx, cancel := context.WithCancel(WithTraceID(context.Background(), traceID))
+	defer cancel()
+	assert.Equal(t, traceID, TraceID(ctx), "derived contexts should keep the trace ID")
+}
@@ -18,45 +18,62 @@ import (
 // LogFields is the logrus.Fields type, but wrapped for convenience.
 type LogFields log.Fields
 
-func addFunc(fields LogFields) LogFields {
-	if fields == nil {
-		fields = LogFields{}
+// logEntry logs the message and fields at the given level, with the location it was logged from, if the level is
+// enabled for the module that logged it. Sensitive fields are redacted.
+func logEntry(level log.Level, msg string, err error, fields LogFields) {
+	if level > log.FatalLevel && level > logVerbose() {
+		return
 	}
 
 	// pc[0] = runtime.Callers
-	// pc[1] = addFunc
-	// pc[2] = caller of addFunc (LogDebug, LogInfo, LogWarn...)
+	// pc[1] = logEntry
+	// pc[2] = caller of logEntry (LogDebug, LogInfo, LogWarn...)
 	// pc[3] = caller of logging functions
 	pc := make([]uintptr, 1)
 	runtime.Callers(3, pc)
 	f := runtime.FuncForPC(pc[0])
 	file, line := f.FileLine(pc[0])
-	fields["Location"] = fmt.Sprintf("%s:%d", file, line)
-	return fields
-}
+	if !logEnabled(level, logModule(file), msg) {
+		return
+	}
+
+	entryFields := make(log.Fields, len(fields)+2)
+	for key, value := range fields {
+		entryFields[key] = redactField(key, value)
+	}
+	entryFields["Location"] = fmt.Sprintf("%s:%d", file, line)
+	if err != nil {
+		entryFields["error"] = err.Error()
+	}
 
-func logWithFields(fields LogFields) *log.Entry {
-	// type assertion is not needed b/c type conversion to log.Fields works for LogFields
-	// see http://stackoverflow.com/questions/19577423/how-to-cast-to-a-type-alias-in-go
-	return log.WithFields(log.Fields(fields))
+	entry := log.WithFields(entryFields)
+	switch level {
+	case log.DebugLevel:
+		entry.Debug(msg)
+	case log.InfoLevel:
+		entry.Info(msg)
+	case log.WarnLevel:
+		entry.Warn(msg)
+	case log.ErrorLevel:
+		entry.Error(msg)
+	default:
+		entry.Fatal(msg)
+	}
 }
 
 // LogDebug logs the message, and fields given at DebugLevel
 func LogDebug(msg string, fields LogFields) {
-	funcFields := addFunc(fields)
-	logWithFields(funcFields).Debug(msg)
+	logEntry(log.DebugLevel, msg, nil, fields)
 }
 
 // LogInfo logs the message, and fields given at InfoLevel
 func LogInfo(msg string, fields LogFields) {
-	funcFields := addFunc(fields)
-	logWithFields(funcFields).Info(msg)
+	logEntry(log.InfoLevel, msg, nil, fields)
 }
 
 // LogWarn logs the message, and fields given at WarnLevel
 func LogWarn(msg string, fields LogFields) {
-	funcFields := addFunc(fields)
-	logWithFields(funcFields).Warn(msg)
+	logEntry(log.WarnLevel, msg, nil, fields)
 }
 
 // LogError logs the message, error and fields given at ErrorLevel if the error != nil
@@ -64,21 +81,15 @@ func LogError(msg string, err error, fields LogFields) {
 	if err == nil {
 		return
 	}
-
-	funcFields := addFunc(fields)
-	funcFields["error"] = err.Error()
-	logWithFields(funcFields).Error(msg)
+	logEntry(log.ErrorLevel, msg, err, fields)
 }
 
-// LogFatal logs the message, error and fields given at FatalLevel if the error != nil
+// LogFatal logs the message, error and fields given at FatalLevel if the error != nil, and exits
 func LogFatal(msg string, err error, fields LogFields) {
 	if err == nil {
 		return
 	}
-
-	funcFields := addFunc(fields)
-	funcFields["error"] = err.Error()
-	logWithFields(funcFields).Fatal(msg)
+	logEntry(log.FatalLevel, msg, err, fields)
 }
 
 // WaitTimeout will wait on the WaitGroup for a set amount of time,